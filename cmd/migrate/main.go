@@ -0,0 +1,28 @@
+// Command migrate manages the database schema with the migrations embedded in
+// internal/db/migrate, against DATABASE_URL:
+//
+//	go run ./cmd/migrate up
+//	go run ./cmd/migrate down -steps 1
+//	go run ./cmd/migrate status
+//	go run ./cmd/migrate create "add artist genre"
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/db/migrate"
+	"boilerplate/internal/logging"
+)
+
+func main() {
+	// Load .env.<GO_ENV> and .env, like the server
+	config.LoadFiles()
+	logging.Init()
+
+	if err := migrate.Command(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
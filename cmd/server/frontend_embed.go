@@ -0,0 +1,20 @@
+//go:build embed_frontend
+
+package main
+
+import (
+	"io/fs"
+	"log"
+
+	"boilerplate/internal/frontend"
+	"boilerplate/web"
+)
+
+// Serve the build embedded from web/dist (see web/doc.go); FRONTEND_DIR still takes precedence.
+func init() {
+	dist, err := fs.Sub(web.Dist, "dist")
+	if err != nil {
+		log.Fatalf("ERROR: Failed to open embedded frontend: %v", err)
+	}
+	frontend.Embedded = dist
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"boilerplate/internal/app"
+	"boilerplate/internal/config"
+	"boilerplate/internal/docs"
+	"boilerplate/internal/sdk"
+)
+
+// genSDK implements `server gen-sdk`: it builds the app (without starting it) and writes a
+// client for each requested language, e.g.
+//
+//	go run ./cmd/server gen-sdk -lang typescript,dart -out ./sdk
+func genSDK(args []string) error {
+	flags := flag.NewFlagSet("gen-sdk", flag.ContinueOnError)
+	languages := flags.String("lang", "typescript", "comma-separated languages: typescript, dart")
+	out := flags.String("out", "sdk", "output directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Step 1: Build the route table the server would serve
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fiberApp := app.NewApp(cfg)
+	spec := sdk.Build(docs.DefaultRegistry.Endpoints(fiberApp.GetRoutes(true)))
+
+	// Step 2: Write one file per language
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", *out, err)
+	}
+	for _, language := range strings.Split(*languages, ",") {
+		language = strings.TrimSpace(language)
+		source, err := sdk.Generate(language, spec)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(*out, sdk.Languages[language])
+		if err := os.WriteFile(path, source, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		log.Printf("Wrote %s (%d operations, %d message types)", path, len(spec.Operations), len(spec.Payloads))
+	}
+	return nil
+}
@@ -1,52 +1,87 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"boilerplate/internal/app"
-	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/db/migrate"
 	"boilerplate/internal/handlers"
-	"boilerplate/internal/realtime"
-
-	"github.com/joho/godotenv"
+	"boilerplate/internal/lifecycle"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/status"
 )
 
 func main() {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		log.Printf("using environment variables; godotenv.Load() returned: %v", err)
+	// Load .env.<GO_ENV> and .env (real environment variables take precedence)
+	config.LoadFiles()
+
+	// `server gen-sdk` writes the client SDKs and exits (see gen_sdk.go)
+	if len(os.Args) > 1 && os.Args[1] == "gen-sdk" {
+		if err := genSDK(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Initialize Redis cache
-	if err := cache.Init(); err != nil {
-		log.Printf("WARNING: Failed to initialize Redis cache: %v", err)
-		log.Println("Continuing without cache...")
+	// `server -migrate` applies the database migrations and exits, e.g. as a deploy's release command
+	if len(os.Args) > 1 && os.Args[1] == "-migrate" {
+		logging.Init()
+		if err := migrate.Command(context.Background(), []string{"up"}, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Initialize WebSocket hub
-	handlers.InitHub()
+	// Redact secrets (tokens, API keys, cookies) from all log output
+	logging.Init()
 
-	// Initialize Supabase Realtime client
-	if err := realtime.Init(); err != nil {
-		log.Printf("WARNING: Failed to initialize Supabase Realtime client: %v", err)
-		log.Println("Continuing without Realtime subscription...")
-	}
+	// Load and validate the configuration; exits listing every invalid or missing setting
+	cfg := config.MustLoad()
 
-	// Get PORT from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
-	}
+	// Start the subsystems in dependency order (see services.go); they stop in the reverse order
+	// once the server has shut down
+	registerServices(cfg)
+	startServices()
+
+	// Initialize app, served over HTTP/1.1 or, with HTTP2=tls or h2c, also HTTP/2
+	fiberApp := app.NewApp(cfg)
+	server := app.NewServer(fiberApp, cfg.Server)
 
-	// Initialize app
-	fiberApp := app.NewApp()
+	// Print the route table and which subsystems are enabled (also at GET /api/admin/startup)
+	startup.Log()
 
-	// Start Realtime subscriber in background
-	go realtime.SubscribeToPrices()
+	// On SIGINT/SIGTERM (e.g. a rolling deploy), first fail /readyz for SHUTDOWN_DRAIN_DELAY so load
+	// balancers stop sending new traffic, then tell WebSocket clients to reconnect elsewhere
+	// (close code 4503) and let in-flight requests finish before exiting
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Println("Shutting down...")
+		status.SetDraining(true)
+		time.Sleep(cfg.Server.DrainDelay)
+		handlers.GetHub().CloseAll(handlers.NewCloseError(handlers.CloseDraining, "server shutting down"))
+		if err := server.Shutdown(10 * time.Second); err != nil {
+			log.Printf("WARNING: Graceful shutdown failed: %v", err)
+		}
+	}()
 
 	// Start server
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(fiberApp.Listen(":" + port))
-}
+	log.Printf("Server starting on port %s", cfg.Port)
+	if err := server.Listen(":" + cfg.Port); err != nil {
+		log.Fatal(err)
+	}
 
+	// Stop the background loops, store the last request counts and close the database pool
+	if err := lifecycle.StopAll(context.Background()); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"boilerplate/internal/abuse"
+	"boilerplate/internal/apikey"
+	"boilerplate/internal/audit"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/db"
+	"boilerplate/internal/db/migrate"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/frontend"
+	"boilerplate/internal/functions"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/handlers"
+	"boilerplate/internal/health"
+	"boilerplate/internal/jobs"
+	"boilerplate/internal/lifecycle"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/memory"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/monitor"
+	"boilerplate/internal/notify"
+	"boilerplate/internal/plan"
+	"boilerplate/internal/profile"
+	"boilerplate/internal/push"
+	"boilerplate/internal/querycache"
+	"boilerplate/internal/realtime"
+	"boilerplate/internal/resource"
+	"boilerplate/internal/scheduler"
+	"boilerplate/internal/search"
+	"boilerplate/internal/seo"
+	"boilerplate/internal/signature"
+	"boilerplate/internal/slo"
+	"boilerplate/internal/storage"
+	"boilerplate/internal/templates"
+	"boilerplate/internal/usage"
+	"boilerplate/internal/webhook"
+)
+
+// booted is set once startServices has run: later starts are restarts.
+var booted atomic.Bool
+
+// registerServices registers the subsystems, in the order they start (see internal/lifecycle).
+// Each one depends on the subsystems it reads at startup, so it starts after them and stops
+// before them.
+//
+// The cache, job workers, scheduler and Realtime subscriber can also be restarted on their own
+// (POST /api/admin/restart/:service). A restart reads the .env files and the environment again,
+// so it applies changed settings. The job workers, scheduler and Realtime subscriber hold on to
+// the cache's client and locks, so they restart with the cache; the other packages keep the
+// client they got at startup until the process restarts.
+func registerServices(cfg *config.Config) {
+	// Apply the memory limit and GC target (GOMEMLIMIT or MEMORY_LIMIT_PERCENT, GOGC)
+	lifecycle.Register(lifecycle.Service{Name: "memory", Start: run(func() { memory.Init(cfg.Memory) })})
+
+	// Restrict outbound requests (proxies, JWKS, PostgREST) to the allowed hosts and schemes
+	lifecycle.Register(lifecycle.Service{Name: "egress", Start: run(func() { egress.Init(cfg.Egress) })})
+
+	// One pooled HTTP client, with timeouts and retries, for the GraphQL and REST proxies
+	lifecycle.Register(lifecycle.Service{
+		Name:      "proxy",
+		DependsOn: []string{"egress"},
+		Start:     run(func() { handlers.InitProxy(cfg.Proxy) }),
+	})
+
+	// The cache (Redis, Upstash or in-memory, see CACHE_BACKEND)
+	lifecycle.Register(lifecycle.Service{
+		Name:        "cache",
+		Restartable: true,
+		Start: func(context.Context) error {
+			cfg, err := settings(cfg)
+			if err != nil {
+				return err
+			}
+			return cache.Init(cfg.Cache)
+		},
+		// Nothing to stop: the client is replaced on start
+	})
+
+	// Direct Postgres access over a connection pool (DATABASE_URL), with read replicas
+	// (DATABASE_REPLICA_URLS) whose lag is checked in the background. The embedded migrations
+	// are applied if DATABASE_MIGRATE=true
+	lifecycle.Register(lifecycle.Service{
+		Name:  "db",
+		Start: func(context.Context) error { return db.Init(cfg.Database) },
+		Stop:  func(context.Context) error { db.Close(); return nil },
+	})
+	lifecycle.Register(lifecycle.Service{
+		Name:      "migrate",
+		DependsOn: []string{"db"},
+		Start:     func(context.Context) error { return migrate.Init(cfg.Database) },
+	})
+	lifecycle.Register(lifecycle.Background("db.replicas", db.RunReplicaMonitor, "db"))
+
+	// Cached repository reads, invalidated by tag on writes (QUERY_CACHE, QUERY_CACHE_TTL)
+	lifecycle.Register(lifecycle.Service{
+		Name:      "querycache",
+		DependsOn: []string{"cache"},
+		Start:     run(func() { querycache.Init(cfg.QueryCache) }),
+	})
+
+	// Rules that tag, throttle or block abusive clients, shared through the cache and reloaded
+	lifecycle.Register(lifecycle.Service{Name: "abuse", DependsOn: []string{"cache"}, Start: run(abuse.Init)})
+	lifecycle.Register(lifecycle.Background("abuse.reloader", abuse.RunReloader, "abuse"))
+
+	// API keys of machine clients (hashed in the cache or a table, see API_KEYS)
+	lifecycle.Register(lifecycle.Service{
+		Name:      "apikey",
+		DependsOn: []string{"cache", "egress"},
+		Start:     run(func() { apikey.Init(cfg.Auth, cfg.Supabase) }),
+	})
+
+	// Audit log for admin actions
+	lifecycle.Register(lifecycle.Service{Name: "audit", DependsOn: []string{"egress"}, Start: run(audit.Init)})
+
+	// Email, export and page templates (embedded, or TEMPLATES_DIR while developing them)
+	lifecycle.Register(lifecycle.Service{Name: "templates", Start: run(templates.Init)})
+
+	// Email and the account deletion workflow (GDPR erasure)
+	lifecycle.Register(lifecycle.Service{Name: "mail", DependsOn: []string{"templates"}, Start: run(mail.Init)})
+	lifecycle.Register(lifecycle.Service{Name: "gdpr", DependsOn: []string{"cache", "audit", "mail"}, Start: run(gdpr.Init)})
+	lifecycle.Register(lifecycle.Background("gdpr.worker", gdpr.RunWorker, "gdpr"))
+
+	// File uploads and user profiles (registered for GDPR erasure)
+	lifecycle.Register(lifecycle.Service{Name: "storage", DependsOn: []string{"gdpr"}, Start: run(storage.Init)})
+	lifecycle.Register(lifecycle.Service{Name: "profile", DependsOn: []string{"gdpr"}, Start: run(profile.Init)})
+
+	// The CRUD resources (watchlist, alerts, artists), whose trash is purged
+	lifecycle.Register(lifecycle.Service{
+		Name:      "resource",
+		DependsOn: []string{"cache", "gdpr"},
+		Start:     run(func() { resource.Init(cfg.Resource, cfg.Supabase) }),
+	})
+	lifecycle.Register(lifecycle.Background("resource.purger", resource.RunPurger, "resource"))
+
+	// Artist search (reads artists from the resource store in memory mode)
+	lifecycle.Register(lifecycle.Service{Name: "search", DependsOn: []string{"resource"}, Start: run(search.Init)})
+
+	// robots.txt and sitemap.xml (artist pages from the resource store, regenerated periodically)
+	lifecycle.Register(lifecycle.Service{Name: "seo", DependsOn: []string{"resource"}, Start: run(seo.Init)})
+	lifecycle.Register(lifecycle.Background("seo.generator", seo.RunGenerator, "seo"))
+
+	// Per-user request counts, rolled up to Postgres (registered for GDPR erasure). Stopping
+	// stores the counts of the last flush interval
+	lifecycle.Register(lifecycle.Service{Name: "usage", DependsOn: []string{"gdpr", "cache"}, Start: run(usage.Init)})
+	flusher := lifecycle.Background("usage.flusher", usage.RunFlusher, "usage")
+	stopFlusher := flusher.Stop
+	flusher.Stop = func(ctx context.Context) error {
+		if err := stopFlusher(ctx); err != nil {
+			return err
+		}
+		return usage.Flush(ctx)
+	}
+	lifecycle.Register(flusher)
+
+	// Plans and quotas, with subscriptions from the Stripe webhook
+	lifecycle.Register(lifecycle.Service{Name: "plan", DependsOn: []string{"usage"}, Start: run(plan.Init)})
+
+	// Third-party webhooks at /webhooks/:provider (Stripe registered by plan.Init, GitHub and
+	// Supabase from their secrets), deduplicated in the cache
+	lifecycle.Register(lifecycle.Service{
+		Name:      "webhook",
+		DependsOn: []string{"plan", "cache"},
+		Start:     run(func() { webhook.Init(cfg.Webhook) }),
+	})
+
+	// Push notifications over FCM and APNs (devices registered for GDPR erasure)
+	lifecycle.Register(lifecycle.Service{
+		Name:      "push",
+		DependsOn: []string{"gdpr"},
+		Start:     run(func() { push.Init(cfg.Push, cfg.Supabase) }),
+	})
+
+	// Notifications over the channels users chose (WebSocket, push, email or the daily digest),
+	// and price alert evaluation
+	lifecycle.Register(lifecycle.Service{Name: "notify", DependsOn: []string{"cache", "mail", "push", "profile", "resource"}, Start: run(notify.Init)})
+	lifecycle.Register(lifecycle.Background("notify.digester", notify.RunDigester, "notify"))
+
+	// Supabase Edge Functions client (also behind /api/functions/:name)
+	lifecycle.Register(lifecycle.Service{
+		Name:      "functions",
+		DependsOn: []string{"egress"},
+		Start:     run(func() { functions.Init(cfg.Functions, cfg.Supabase) }),
+	})
+
+	// Signature headers on outgoing webhooks and exports (SIGNING_SECRETS)
+	lifecycle.Register(lifecycle.Service{Name: "signature", Start: run(signature.Init)})
+
+	// SLO alert hooks (log, and SLO_ALERT_WEBHOOK_URL if set)
+	lifecycle.Register(lifecycle.Service{Name: "slo", Start: run(slo.Init)})
+
+	// The WebSocket hub
+	lifecycle.Register(lifecycle.Service{Name: "hub", Start: run(handlers.InitHub)})
+
+	// Relay the hub's messages between replicas over Redis pub/sub (WS_REDIS_BRIDGE). Realtime
+	// changes are relayed when a single replica consumes them: with leader election, in a cache
+	// shared between the replicas
+	lifecycle.Register(lifecycle.Service{
+		Name:      "hub.bridge",
+		DependsOn: []string{"hub"},
+		Start: func(context.Context) error {
+			elected := cfg.Realtime.LeaderElection && cfg.Cache.ResolvedBackend() != config.CacheMemory
+			return handlers.StartBridge(cfg.Hub, elected)
+		},
+		Stop: handlers.StopBridge,
+	})
+
+	// Near the memory limit, shed WebSocket clients and in-memory cache entries (the shedders are
+	// registered by the cache and the hub)
+	lifecycle.Register(lifecycle.Background("memory.watchdog", memory.RunWatchdog, "memory", "cache", "hub"))
+
+	// Goroutine counts and channel buffer usage, checked every MONITOR_INTERVAL (the hub and job
+	// queue register their channels, Realtime its goroutine bounds)
+	lifecycle.Register(lifecycle.Service{Name: "monitor", Start: run(func() { monitor.Init(cfg.Monitor) })})
+	lifecycle.Register(lifecycle.Background("monitor.checks", monitor.RunMonitor, "monitor", "hub"))
+
+	// GraphQL response cache (GRAPHQL_CACHE_TTL, off by default), and the allow-list, depth and
+	// complexity limits, mutation and introspection blocking
+	lifecycle.Register(lifecycle.Service{Name: "graphql.cache", DependsOn: []string{"cache"}, Start: run(handlers.InitGraphQLCache)})
+	lifecycle.Register(lifecycle.Service{
+		Name:  "graphql.guard",
+		Start: run(func() { handlers.InitGraphQLGuard(cfg.IsProduction()) }),
+	})
+
+	// The Supabase Realtime client, subscribed in the background
+	lifecycle.Register(lifecycle.Service{
+		Name:        "realtime",
+		DependsOn:   []string{"cache"},
+		Restartable: true,
+		Start: func(context.Context) error {
+			cfg, err := settings(cfg)
+			if err != nil {
+				return err
+			}
+			if err := realtime.Init(cfg.Realtime); err != nil {
+				return err
+			}
+			return realtime.Start(cfg.Realtime)
+		},
+		Stop: realtime.Stop,
+	})
+
+	// Background jobs, queued in the cache (see internal/jobs). The workers start after every
+	// package above has registered its handlers
+	lifecycle.Register(lifecycle.Service{
+		Name:        "jobs",
+		DependsOn:   []string{"cache"},
+		Restartable: true,
+		Start: func(context.Context) error {
+			cfg, err := settings(cfg)
+			if err != nil {
+				return err
+			}
+			jobs.Init(cfg.Jobs)
+			return jobs.StartWorkers()
+		},
+		Stop: jobs.StopWorkers,
+	})
+
+	// Recurring tasks on cron schedules, locked in the cache (SCHEDULER_<TASK> changes a
+	// schedule, or turns a task off). Registered tasks are added again on every start
+	for _, task := range []scheduler.Task{
+		{Name: "price-warmup", Schedule: "*/5 * * * *", Run: realtime.WarmPrices},
+		{Name: "price-cleanup", Schedule: "*/5 * * * *", Run: realtime.ClearDeletedPrices},
+		{Name: "jwks-refresh", Schedule: "*/30 * * * *", PerInstance: true, Run: func(ctx context.Context) error {
+			return middleware.RefreshJWKS(ctx, cfg.Auth.SupabaseURL)
+		}},
+	} {
+		if err := scheduler.Register(task); err != nil {
+			log.Printf("WARNING: Failed to schedule %s: %v", task.Name, err)
+		}
+	}
+	lifecycle.Register(lifecycle.Service{
+		Name:        "scheduler",
+		DependsOn:   []string{"cache"},
+		Restartable: true,
+		Start: func(context.Context) error {
+			if _, err := settings(cfg); err != nil {
+				return err
+			}
+			scheduler.Init()
+			return scheduler.StartScheduler()
+		},
+		Stop: scheduler.StopScheduler,
+	})
+
+	// Readiness checks of the configured dependencies (cache, Supabase, JWKS, Realtime, database)
+	lifecycle.Register(lifecycle.Service{
+		Name:      "health",
+		DependsOn: []string{"cache", "db", "realtime"},
+		Start:     run(func() { health.Init(cfg) }),
+	})
+
+	// Serve the frontend build at / if FRONTEND_DIR is set or one is embedded
+	lifecycle.Register(lifecycle.Service{Name: "frontend", Start: run(frontend.Init)})
+}
+
+// startServices starts the registered services. One failing to start is logged, and the server
+// runs without it.
+func startServices() {
+	if err := lifecycle.StartAll(context.Background()); err != nil {
+		log.Printf("WARNING: %v", err)
+		log.Println("Continuing without them...")
+	}
+	booted.Store(true)
+}
+
+// settings returns the configuration a service starts with: cfg at startup and, on a restart, the
+// .env files and environment read again, failing the restart when they are invalid.
+func settings(cfg *config.Config) (*config.Config, error) {
+	if !booted.Load() {
+		return cfg, nil
+	}
+	config.ReloadFiles()
+	return config.Load()
+}
+
+// run returns a Start hook calling init, for the subsystems whose initialization can't fail.
+func run(init func()) func(context.Context) error {
+	return func(context.Context) error {
+		init()
+		return nil
+	}
+}
@@ -0,0 +1,383 @@
+package abuse
+
+// Package abuse tags, throttles or blocks abusive clients (scrapers, credential stuffing,
+// vulnerability scanners) with rules that can be changed without a deploy: a step beyond the
+// rate limiter, which gives every client the same budget.
+//
+// A rule matches requests by path (globs: * within a segment, ** across segments), User-Agent
+// (case-insensitive regular expressions) and method, and takes its action on every match or,
+// with a rate, once a client (by IP) sends more than rate matching requests in window:
+//
+//	[
+//	  {"id": "scanners", "user_agents": ["sqlmap", "nikto", "masscan"], "action": "block", "ban_for": "24h"},
+//	  {"id": "wp-probes", "paths": ["/wp-admin/**", "/**/*.php"], "action": "block"},
+//	  {"id": "artist-scraping", "paths": ["/api/artists/**"], "rate": 300, "window": "1m", "action": "throttle"},
+//	  {"id": "headless", "user_agents": ["HeadlessChrome"], "action": "tag"}
+//	]
+//
+// Actions: tag only records the decision (handlers can read Tags(c)), throttle answers 429 until
+// the window ends, block answers 403, and with ban_for keeps answering 403 to the client for that
+// long, whatever it requests.
+//
+// Rules and bans are stored in the cache, so every instance applies the same ones, and re-read
+// every ABUSE_RULES_REFRESH (default 10s): PUT /api/admin/abuse/rules takes effect everywhere
+// within that interval. ABUSE_RULES_FILE seeds the rules when the cache has none. Without a cache
+// they are kept per instance. Every decision is logged, counted (abuse_decisions_total) and kept
+// for GET /api/admin/abuse/decisions.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/startup"
+)
+
+// Actions.
+const (
+	ActionTag      = "tag"      // Record the decision and let the request through
+	ActionThrottle = "throttle" // 429 until the rate window ends
+	ActionBlock    = "block"    // 403, and with BanFor every request for that long
+)
+
+// Cache keys of the shared rules and bans.
+const (
+	rulesKey = "abuse:rules"
+	bansKey  = "abuse:bans"
+)
+
+// storedTTL is the TTL of the rules and bans: they live until replaced, but the cache always
+// sets one.
+const storedTTL = 10 * 365 * 24 * time.Hour
+
+// defaultRefresh is the default of ABUSE_RULES_REFRESH.
+const defaultRefresh = 10 * time.Second
+
+// maxRules bounds the rules evaluated on every request.
+const maxRules = 100
+
+// DefaultEngine applies the rules to requests. It is nil until Init() or SetDefault() is called.
+var DefaultEngine *Engine
+
+// Rule is one rule, as stored and as accepted by PUT /api/admin/abuse/rules.
+type Rule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Paths       []string `json:"paths,omitempty"`       // Globs; any path when empty
+	UserAgents  []string `json:"user_agents,omitempty"` // Case-insensitive regular expressions; any when empty
+	Methods     []string `json:"methods,omitempty"`     // Any when empty
+	Rate        int      `json:"rate,omitempty"`        // Matching requests per client per window before the action applies (0: every match)
+	Window      string   `json:"window,omitempty"`      // Duration of the rate window, e.g. 1m
+	Action      string   `json:"action"`                // tag, throttle or block
+	BanFor      string   `json:"ban_for,omitempty"`     // block: how long the client stays blocked, e.g. 24h
+}
+
+// rule is a Rule ready to match requests.
+type rule struct {
+	Rule
+	paths      []*regexp.Regexp
+	userAgents []*regexp.Regexp
+	window     time.Duration
+	banFor     time.Duration
+}
+
+// Ban is a client blocked by a rule with ban_for.
+type Ban struct {
+	Rule  string    `json:"rule"`
+	Until time.Time `json:"until"`
+}
+
+// Engine evaluates the rules and keeps them, the bans and the recent decisions.
+type Engine struct {
+	store   cache.Store // Rules, bans and rate counters
+	shared  bool        // store is the cache (not a store of this instance)
+	refresh time.Duration
+	now     func() time.Time
+
+	rules atomic.Pointer[[]*rule]
+
+	bansMu sync.RWMutex
+	bans   map[string]Ban // By IP
+
+	decisions *decisionLog
+}
+
+// Init creates the default engine on the cache (call it after cache.Init) and loads the rules,
+// seeding them from ABUSE_RULES_FILE when the cache has none.
+func Init() {
+	engine := New(cache.GetClient(), getRefresh())
+	if err := engine.Reload(); err != nil {
+		slog.Error("Failed to load abuse rules", "error", err)
+	}
+
+	if file := os.Getenv("ABUSE_RULES_FILE"); file != "" && len(engine.Rules()) == 0 {
+		if err := engine.seed(file); err != nil {
+			slog.Error("Failed to load ABUSE_RULES_FILE", "file", file, "error", err)
+		}
+	}
+
+	DefaultEngine = engine
+	detail := fmt.Sprintf("%d rules, reloaded every %s", len(engine.Rules()), engine.refresh)
+	if !engine.shared {
+		detail = fmt.Sprintf("%d rules, kept per instance (no cache)", len(engine.Rules()))
+	}
+	startup.Report("abuse", true, detail)
+}
+
+// New creates an engine keeping its rules, bans and counters in store, re-read every refresh
+// by RunReloader. Without a store (no cache) they are kept in memory.
+func New(store cache.Store, refresh time.Duration) *Engine {
+	engine := &Engine{
+		store:     store,
+		shared:    store != nil,
+		refresh:   refresh,
+		now:       time.Now,
+		bans:      make(map[string]Ban),
+		decisions: newDecisionLog(maxDecisions),
+	}
+	if store == nil {
+		engine.store = cache.NewMemoryStore()
+	}
+	engine.rules.Store(&[]*rule{})
+	return engine
+}
+
+// SetDefault sets the default engine (nil disables the middleware). Mainly useful in tests.
+func SetDefault(engine *Engine) {
+	DefaultEngine = engine
+}
+
+// Get returns the default engine (nil if Init has not been called).
+func Get() *Engine {
+	return DefaultEngine
+}
+
+// RunReloader re-reads the rules and bans every ABUSE_RULES_REFRESH, so changes made through
+// another instance apply here. Call it in a goroutine after Init(); it runs until ctx is
+// cancelled.
+func RunReloader(ctx context.Context) {
+	engine := Get()
+	if engine == nil || !engine.shared {
+		return
+	}
+	ticker := time.NewTicker(engine.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := engine.Reload(); err != nil {
+			slog.Warn("Failed to reload abuse rules, keeping the current ones", "error", err)
+		}
+	}
+}
+
+// Rules returns the rules, in evaluation order.
+func (e *Engine) Rules() []Rule {
+	compiled := *e.rules.Load()
+	rules := make([]Rule, len(compiled))
+	for i, r := range compiled {
+		rules[i] = r.Rule
+	}
+	return rules
+}
+
+// SetRules validates rules and replaces the current ones, on every instance (see Reload). It
+// returns the previous rules.
+func (e *Engine) SetRules(rules []Rule) ([]Rule, error) {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.store.Set(rulesKey, string(raw), storedTTL); err != nil {
+		return nil, fmt.Errorf("failed to store abuse rules: %w", err)
+	}
+	previous := e.Rules()
+	e.rules.Store(&compiled)
+	slog.Info("Abuse rules updated", "rules", len(rules))
+	return previous, nil
+}
+
+// Reload re-reads the rules and bans from the store. Invalid stored rules are an error and leave
+// the current ones in place.
+func (e *Engine) Reload() error {
+	raw, err := e.store.Get(rulesKey)
+	if err != nil {
+		return fmt.Errorf("failed to read abuse rules: %w", err)
+	}
+	var rules []Rule
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+			return fmt.Errorf("invalid stored abuse rules: %w", err)
+		}
+	}
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return fmt.Errorf("invalid stored abuse rules: %w", err)
+	}
+	e.rules.Store(&compiled)
+
+	bans, err := e.loadBans()
+	if err != nil {
+		return err
+	}
+	e.bansMu.Lock()
+	e.bans = bans
+	e.bansMu.Unlock()
+	return nil
+}
+
+// seed stores the rules of a JSON file.
+func (e *Engine) seed(file string) error {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return err
+	}
+	_, err = e.SetRules(rules)
+	return err
+}
+
+// compileRules validates rules and prepares them for matching.
+func compileRules(rules []Rule) ([]*rule, error) {
+	if len(rules) > maxRules {
+		return nil, fmt.Errorf("at most %d rules", maxRules)
+	}
+	compiled := make([]*rule, 0, len(rules))
+	ids := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		c, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, r.ID, err)
+		}
+		if ids[r.ID] {
+			return nil, fmt.Errorf("rule %d: duplicate id %q", i, r.ID)
+		}
+		ids[r.ID] = true
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// compileRule validates one rule and compiles its patterns.
+func compileRule(r Rule) (*rule, error) {
+	if r.ID == "" || strings.ContainsAny(r.ID, " :") {
+		return nil, errors.New("id is required and may not contain spaces or colons")
+	}
+	if !slices.Contains([]string{ActionTag, ActionThrottle, ActionBlock}, r.Action) {
+		return nil, errors.New("action must be tag, throttle or block")
+	}
+	compiled := &rule{Rule: r}
+	compiled.Methods = make([]string, len(r.Methods))
+	for i, method := range r.Methods {
+		compiled.Methods[i] = strings.ToUpper(method)
+	}
+
+	for _, pattern := range r.Paths {
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("path %q must start with /", pattern)
+		}
+		compiled.paths = append(compiled.paths, globPattern(pattern))
+	}
+	for _, pattern := range r.UserAgents {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("user agent %q: %w", pattern, err)
+		}
+		compiled.userAgents = append(compiled.userAgents, re)
+	}
+
+	if r.Rate < 0 {
+		return nil, errors.New("rate may not be negative")
+	}
+	if r.Rate > 0 {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window < time.Second {
+			return nil, errors.New("window must be a duration of at least 1s, e.g. 1m")
+		}
+		compiled.window = window
+	} else if r.Action == ActionThrottle {
+		return nil, errors.New("throttle needs a rate and window")
+	}
+	if r.BanFor != "" {
+		if r.Action != ActionBlock {
+			return nil, errors.New("ban_for only applies to block")
+		}
+		banFor, err := time.ParseDuration(r.BanFor)
+		if err != nil || banFor <= 0 {
+			return nil, errors.New("ban_for must be a positive duration, e.g. 24h")
+		}
+		compiled.banFor = banFor
+	}
+	return compiled, nil
+}
+
+// globPattern compiles a path glob: ** matches anything (including /), * and ? match within a
+// segment.
+func globPattern(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			pattern.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			pattern.WriteString("[^/]*")
+		case glob[i] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// matches reports whether the rule's conditions hold for a request.
+func (r *rule) matches(req Request) bool {
+	if len(r.Methods) > 0 && !slices.Contains(r.Methods, req.Method) {
+		return false
+	}
+	if len(r.paths) > 0 && !slices.ContainsFunc(r.paths, func(re *regexp.Regexp) bool { return re.MatchString(req.Path) }) {
+		return false
+	}
+	if len(r.userAgents) > 0 && !slices.ContainsFunc(r.userAgents, func(re *regexp.Regexp) bool { return re.MatchString(req.UserAgent) }) {
+		return false
+	}
+	return true
+}
+
+// getRefresh returns ABUSE_RULES_REFRESH (default 10s).
+func getRefresh() time.Duration {
+	value := os.Getenv("ABUSE_RULES_REFRESH")
+	if value == "" {
+		return defaultRefresh
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid ABUSE_RULES_REFRESH, using the default", "value", value, "default", defaultRefresh.String())
+		return defaultRefresh
+	}
+	return d
+}
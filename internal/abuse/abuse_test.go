@@ -0,0 +1,160 @@
+package abuse
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEngine creates an engine on store with a clock the test moves.
+func newTestEngine(store cache.Store, now *time.Time) *Engine {
+	engine := New(store, time.Second)
+	engine.now = func() time.Time { return *now }
+	return engine
+}
+
+// TestCompileRules tests rule validation.
+func TestCompileRules(t *testing.T) {
+	invalid := map[string]Rule{
+		"no id":            {Action: ActionTag},
+		"unknown action":   {ID: "r", Action: "drop"},
+		"relative path":    {ID: "r", Paths: []string{"api/*"}, Action: ActionBlock},
+		"bad regexp":       {ID: "r", UserAgents: []string{"("}, Action: ActionBlock},
+		"throttle no rate": {ID: "r", Action: ActionThrottle},
+		"rate no window":   {ID: "r", Rate: 10, Action: ActionThrottle},
+		"ban on tag":       {ID: "r", Action: ActionTag, BanFor: "1h"},
+	}
+	for name, rule := range invalid {
+		_, err := compileRules([]Rule{rule})
+		assert.Error(t, err, name)
+	}
+
+	_, err := compileRules([]Rule{{ID: "r", Action: ActionTag}, {ID: "r", Action: ActionBlock}})
+	assert.ErrorContains(t, err, "duplicate")
+}
+
+// TestGlobPattern tests path globs.
+func TestGlobPattern(t *testing.T) {
+	testCases := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"/wp-admin/**", "/wp-admin/install.php", true},
+		{"/wp-admin/**", "/wp-admin", false},
+		{"/**/*.php", "/a/b/c.php", true},
+		{"/api/artists/*", "/api/artists/123", true},
+		{"/api/artists/*", "/api/artists/123/prices", false},
+		{"/.env", "/.env", true},
+		{"/.env", "/xenv", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, globPattern(tc.glob).MatchString(tc.path), "%s %s", tc.glob, tc.path)
+	}
+}
+
+// TestEvaluate tests tags, rates, blocks and bans.
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	engine := newTestEngine(cache.NewMemoryStore(), &now)
+	_, err := engine.SetRules([]Rule{
+		{ID: "headless", UserAgents: []string{"headlesschrome"}, Action: ActionTag},
+		{ID: "scraping", Paths: []string{"/api/artists/**"}, Methods: []string{"get"}, Rate: 2, Window: "1m", Action: ActionThrottle},
+		{ID: "scanners", UserAgents: []string{"sqlmap"}, Action: ActionBlock, BanFor: "1h"},
+	})
+	require.NoError(t, err)
+
+	browser := Request{IP: "1.1.1.1", Method: "GET", Path: "/api/artists/1", UserAgent: "Mozilla/5.0 HeadlessChrome/120"}
+	result := engine.Evaluate(browser)
+	assert.Equal(t, []string{"headless"}, result.Tags)
+	assert.Nil(t, result.Final)
+
+	// The third matching request in the window is throttled, until the window ends
+	engine.Evaluate(browser)
+	result = engine.Evaluate(browser)
+	require.NotNil(t, result.Final)
+	assert.Equal(t, ActionThrottle, result.Final.Action)
+	assert.Equal(t, time.Minute, result.Final.retryAfter)
+	assert.Nil(t, engine.Evaluate(Request{IP: "2.2.2.2", Method: "GET", Path: "/api/artists/1"}).Final, "rates are per client")
+	assert.Nil(t, engine.Evaluate(Request{IP: "1.1.1.1", Method: "POST", Path: "/api/artists/1"}).Final, "other methods don't match")
+	now = now.Add(time.Minute)
+	assert.Nil(t, engine.Evaluate(browser).Final)
+
+	// A block with ban_for bans the client from every path
+	scanner := Request{IP: "3.3.3.3", Method: "GET", Path: "/", UserAgent: "sqlmap/1.7"}
+	assert.Equal(t, ActionBlock, engine.Evaluate(scanner).Final.Action)
+	result = engine.Evaluate(Request{IP: "3.3.3.3", Method: "GET", Path: "/health"})
+	require.NotNil(t, result.Final)
+	assert.Equal(t, ActionBanned, result.Final.Action)
+	assert.Contains(t, engine.Bans(), "3.3.3.3")
+
+	now = now.Add(time.Hour)
+	assert.Nil(t, engine.Evaluate(Request{IP: "3.3.3.3", Method: "GET", Path: "/health"}).Final, "bans expire")
+
+	decisions := engine.Decisions()
+	require.NotEmpty(t, decisions)
+	assert.Equal(t, "scanners", decisions[0].Rule, "newest first")
+}
+
+// TestReload tests that rules and bans set on one instance apply on another after a reload.
+func TestReload(t *testing.T) {
+	now := time.Now()
+	store := cache.NewMemoryStore()
+	first, second := newTestEngine(store, &now), newTestEngine(store, &now)
+
+	_, err := first.SetRules([]Rule{{ID: "env", Paths: []string{"/.env"}, Action: ActionBlock, BanFor: "1h"}})
+	require.NoError(t, err)
+	require.NotNil(t, first.Evaluate(Request{IP: "4.4.4.4", Method: "GET", Path: "/.env"}).Final)
+
+	assert.Nil(t, second.Evaluate(Request{IP: "4.4.4.4", Method: "GET", Path: "/"}).Final)
+	require.NoError(t, second.Reload())
+	assert.Equal(t, first.Rules(), second.Rules())
+	assert.Equal(t, ActionBanned, second.Evaluate(Request{IP: "4.4.4.4", Method: "GET", Path: "/"}).Final.Action)
+
+	existed, err := second.Unban("4.4.4.4")
+	require.NoError(t, err)
+	assert.True(t, existed)
+	require.NoError(t, first.Reload())
+	assert.Empty(t, first.Bans())
+}
+
+// TestMiddleware tests the responses of throttled and blocked requests.
+func TestMiddleware(t *testing.T) {
+	engine := New(nil, time.Second)
+	_, err := engine.SetRules([]Rule{
+		{ID: "bots", UserAgents: []string{"bot"}, Action: ActionTag},
+		{ID: "login", Paths: []string{"/login"}, Rate: 1, Window: "1h", Action: ActionThrottle},
+		{ID: "php", Paths: []string{"/**/*.php"}, Action: ActionBlock},
+	})
+	require.NoError(t, err)
+	SetDefault(engine)
+	t.Cleanup(func() { SetDefault(nil) })
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.JSON(Tags(c))
+	})
+
+	do := func(path, userAgent string) (int, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter)
+	}
+
+	status, _ := do("/login", "friendly-bot")
+	assert.Equal(t, fiber.StatusOK, status)
+	status, retryAfter := do("/login", "friendly-bot")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.NotEmpty(t, retryAfter)
+
+	status, _ = do("/blog/index.php", "curl")
+	assert.Equal(t, fiber.StatusForbidden, status)
+}
@@ -0,0 +1,231 @@
+package abuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"boilerplate/internal/metrics"
+)
+
+// ActionBanned is the action of decisions about clients already banned by a block rule.
+const ActionBanned = "banned"
+
+// Request is what rules match on.
+type Request struct {
+	IP        string
+	Method    string
+	Path      string
+	UserAgent string
+}
+
+// Decision is the outcome of a rule for a request: tags, or the response that replaces the
+// handler's.
+type Decision struct {
+	Time      time.Time `json:"time"`
+	Rule      string    `json:"rule"`
+	Action    string    `json:"action"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	UserAgent string    `json:"user_agent,omitempty"`
+
+	retryAfter time.Duration // throttle: until the window ends
+}
+
+// Result is the outcome of every rule for a request.
+type Result struct {
+	Tags  []string  // IDs of the tag rules that applied
+	Final *Decision // The throttle or block decision answering the request, if any
+}
+
+// Evaluate applies the rules to req: every tag rule that applies, up to the first throttle or
+// block one. Rates are counted per rule and client. Cache failures let the request through.
+func (e *Engine) Evaluate(req Request) Result {
+	var result Result
+	now := e.now()
+
+	if b, ok := e.banned(req.IP, now); ok {
+		decision := e.newDecision(now, b.Rule, ActionBanned, req)
+		metrics.AbuseDecisions.WithLabelValues(b.Rule, ActionBanned).Inc()
+		result.Final = &decision
+		return result
+	}
+
+	for _, r := range *e.rules.Load() {
+		if !r.matches(req) {
+			continue
+		}
+		log := true
+		var retryAfter time.Duration
+		if r.Rate > 0 {
+			count, windowEnd, err := e.count(r, req.IP, now)
+			if err != nil {
+				slog.Warn("Failed to count requests for an abuse rule", "rule", r.ID, "error", err)
+				continue
+			}
+			if count <= int64(r.Rate) {
+				continue
+			}
+			// Over the rate, the action applies to every request until the window ends; only
+			// the first is logged
+			log = count == int64(r.Rate)+1
+			retryAfter = windowEnd.Sub(now)
+		}
+
+		decision := e.newDecision(now, r.ID, r.Action, req)
+		decision.retryAfter = retryAfter
+		metrics.AbuseDecisions.WithLabelValues(r.ID, r.Action).Inc()
+		if log {
+			e.record(decision)
+		}
+
+		switch r.Action {
+		case ActionTag:
+			result.Tags = append(result.Tags, r.ID)
+			continue
+		case ActionBlock:
+			if r.banFor > 0 {
+				e.ban(req.IP, Ban{Rule: r.ID, Until: now.Add(r.banFor)})
+			}
+		}
+		result.Final = &decision
+		return result
+	}
+	return result
+}
+
+// newDecision returns the decision of rule about req.
+func (e *Engine) newDecision(now time.Time, rule, action string, req Request) Decision {
+	return Decision{
+		Time:      now,
+		Rule:      rule,
+		Action:    action,
+		IP:        req.IP,
+		Method:    req.Method,
+		Path:      req.Path,
+		UserAgent: req.UserAgent,
+	}
+}
+
+// record logs a decision and keeps it for Decisions.
+func (e *Engine) record(decision Decision) {
+	slog.Warn("Abuse rule applied",
+		"rule", decision.Rule,
+		"action", decision.Action,
+		"ip", decision.IP,
+		"method", decision.Method,
+		"path", decision.Path,
+		"user_agent", decision.UserAgent,
+	)
+	e.decisions.add(decision)
+}
+
+// Decisions returns the most recent logged decisions, newest first.
+func (e *Engine) Decisions() []Decision {
+	return e.decisions.list()
+}
+
+// count increments the client's counter of the rule's current window and returns it, with the
+// end of the window.
+func (e *Engine) count(r *rule, ip string, now time.Time) (int64, time.Time, error) {
+	windowStart := now.Truncate(r.window)
+	key := "abuse:count:" + r.ID + ":" + ip + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+	count, err := e.store.Incr(key)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if count == 1 {
+		if err := e.store.Expire(key, r.window); err != nil {
+			return 0, time.Time{}, err
+		}
+	}
+	return count, windowStart.Add(r.window), nil
+}
+
+// banned returns the ban of ip, if it has one that hasn't expired.
+func (e *Engine) banned(ip string, now time.Time) (Ban, bool) {
+	e.bansMu.RLock()
+	defer e.bansMu.RUnlock()
+	b, ok := e.bans[ip]
+	return b, ok && now.Before(b.Until)
+}
+
+// Bans returns the bans that haven't expired, by IP.
+func (e *Engine) Bans() map[string]Ban {
+	now := e.now()
+	e.bansMu.RLock()
+	defer e.bansMu.RUnlock()
+	bans := make(map[string]Ban, len(e.bans))
+	for ip, b := range e.bans {
+		if now.Before(b.Until) {
+			bans[ip] = b
+		}
+	}
+	return bans
+}
+
+// ban bans ip here at once, and on the other instances at their next reload.
+func (e *Engine) ban(ip string, b Ban) {
+	e.bansMu.Lock()
+	e.bans[ip] = b
+	e.bansMu.Unlock()
+
+	if err := e.updateBans(func(bans map[string]Ban) { bans[ip] = b }); err != nil {
+		slog.Warn("Failed to store an abuse ban, it only applies to this instance", "ip", ip, "error", err)
+	}
+}
+
+// Unban lifts the ban of ip and reports whether it had one.
+func (e *Engine) Unban(ip string) (bool, error) {
+	e.bansMu.Lock()
+	_, existed := e.bans[ip]
+	delete(e.bans, ip)
+	e.bansMu.Unlock()
+
+	err := e.updateBans(func(bans map[string]Ban) {
+		if _, ok := bans[ip]; ok {
+			existed = true
+		}
+		delete(bans, ip)
+	})
+	return existed, err
+}
+
+// updateBans applies change to the stored bans, leaving out expired ones. Concurrent updates
+// from two instances may lose one; the ban still applies where it was made until the next reload.
+func (e *Engine) updateBans(change func(map[string]Ban)) error {
+	bans, err := e.loadBans()
+	if err != nil {
+		return err
+	}
+	change(bans)
+	now := e.now()
+	for ip, b := range bans {
+		if !now.Before(b.Until) {
+			delete(bans, ip)
+		}
+	}
+	raw, err := json.Marshal(bans)
+	if err != nil {
+		return err
+	}
+	return e.store.Set(bansKey, string(raw), storedTTL)
+}
+
+// loadBans reads the stored bans.
+func (e *Engine) loadBans() (map[string]Ban, error) {
+	bans := make(map[string]Ban)
+	raw, err := e.store.Get(bansKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read abuse bans: %w", err)
+	}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &bans); err != nil {
+			return nil, fmt.Errorf("invalid stored abuse bans: %w", err)
+		}
+	}
+	return bans, nil
+}
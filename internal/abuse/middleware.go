@@ -0,0 +1,97 @@
+package abuse
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"boilerplate/internal/apperror"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxDecisions is the number of logged decisions kept for GET /api/admin/abuse/decisions.
+const maxDecisions = 200
+
+// tagsLocal is the Locals key of the tags of the request.
+const tagsLocal = "abuse_tags"
+
+// Middleware applies the default engine's rules: throttled clients get a 429 with Retry-After,
+// blocked and banned ones a 403, and tagged requests continue with their tags (see Tags). Without
+// an engine it does nothing.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		engine := Get()
+		if engine == nil {
+			return c.Next()
+		}
+
+		// Copied: the IP keys bans, and logged decisions keep the whole request
+		result := engine.Evaluate(Request{
+			IP:        strings.Clone(c.IP()),
+			Method:    strings.Clone(c.Method()),
+			Path:      strings.Clone(c.Path()),
+			UserAgent: strings.Clone(c.Get(fiber.HeaderUserAgent)),
+		})
+		if len(result.Tags) > 0 {
+			c.Locals(tagsLocal, result.Tags)
+		}
+		if result.Final == nil {
+			return c.Next()
+		}
+
+		// The rule isn't named in the response: clients shouldn't learn what they tripped
+		if result.Final.Action == ActionThrottle {
+			seconds := int(math.Ceil(result.Final.retryAfter.Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(seconds, 1)))
+			return apperror.Write(c, apperror.RateLimited("Too many requests"))
+		}
+		return apperror.Write(c, apperror.Forbidden("Request blocked"))
+	}
+}
+
+// Tags returns the IDs of the tag rules that applied to the request.
+func Tags(c *fiber.Ctx) []string {
+	tags, _ := c.Locals(tagsLocal).([]string)
+	return tags
+}
+
+// decisionLog keeps the most recent decisions in a ring.
+type decisionLog struct {
+	mu      sync.Mutex
+	entries []Decision
+	next    int
+	full    bool
+}
+
+// newDecisionLog creates a log keeping size decisions.
+func newDecisionLog(size int) *decisionLog {
+	return &decisionLog{entries: make([]Decision, size)}
+}
+
+// add keeps decision, replacing the oldest one when the log is full.
+func (l *decisionLog) add(decision Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = decision
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the decisions, newest first.
+func (l *decisionLog) list() []Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+	decisions := make([]Decision, 0, count)
+	for i := 1; i <= count; i++ {
+		decisions = append(decisions, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return decisions
+}
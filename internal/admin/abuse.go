@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"encoding/json"
+	"strings"
+
+	"boilerplate/internal/abuse"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// abuseRulesRequest is the body of PUT /api/admin/abuse/rules.
+type abuseRulesRequest struct {
+	Rules []abuse.Rule `json:"rules"`
+}
+
+// GetAbuseRules returns the abuse rules, in evaluation order.
+func GetAbuseRules(c *fiber.Ctx) error {
+	engine := abuse.Get()
+	if engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Abuse rules not configured",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"rules": engine.Rules(),
+	})
+}
+
+// SetAbuseRules replaces the abuse rules. Every instance applies them within ABUSE_RULES_REFRESH.
+func SetAbuseRules(c *fiber.Ctx) error {
+	engine := abuse.Get()
+	if engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Abuse rules not configured",
+		})
+	}
+
+	var body abuseRulesRequest
+	if err := json.Unmarshal(c.Body(), &body); err != nil || body.Rules == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Request body must be {\"rules\": [...]}",
+		})
+	}
+	previous, err := engine.SetRules(body.Rules)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+			"field": "rules",
+		})
+	}
+
+	recordAudit(c, "abuse.rules.set", "all", fiber.Map{"rules": previous}, fiber.Map{"rules": body.Rules})
+
+	return c.JSON(fiber.Map{
+		"rules": engine.Rules(),
+	})
+}
+
+// ListAbuseDecisions returns the most recent decisions of this instance's abuse rules, newest
+// first, and the clients currently banned.
+func ListAbuseDecisions(c *fiber.Ctx) error {
+	engine := abuse.Get()
+	if engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Abuse rules not configured",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"decisions": engine.Decisions(),
+		"bans":      engine.Bans(),
+	})
+}
+
+// RemoveAbuseBan lifts the ban of a client (by IP) made by a block rule with ban_for.
+func RemoveAbuseBan(c *fiber.Ctx) error {
+	engine := abuse.Get()
+	if engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Abuse rules not configured",
+		})
+	}
+
+	ip := strings.Clone(c.Params("ip"))
+	existed, err := engine.Unban(ip)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to update the stored bans",
+		})
+	}
+	if !existed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No ban for this IP",
+		})
+	}
+
+	recordAudit(c, "abuse.ban.remove", ip, fiber.Map{"banned": true}, fiber.Map{"banned": false})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
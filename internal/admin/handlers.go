@@ -0,0 +1,608 @@
+package admin
+
+// Package admin provides operational endpoints for administrators (cache flush and epoch, broadcast,
+// rate-limit overrides, abuse rules and bans, dead background jobs, realtime restart, subsystem
+// restarts, draining, account deletion overrides), the audit log query endpoint, usage reports,
+// the request capture viewer, scheduled tasks, runtime health (goroutines and channel buffers),
+// SLO status and the startup summary. Every action writes an audit record with the acting user, the target and the
+// state before and after the change.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/capture"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/handlers"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/notify"
+	"boilerplate/internal/realtime"
+	"boilerplate/internal/signature"
+	"boilerplate/internal/slo"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/status"
+	"boilerplate/internal/stream"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// maxFlushKeys caps how many keys a single flush request may delete.
+	maxFlushKeys = 1000
+
+	// Audit log pagination defaults.
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+
+	// Usage report pagination defaults.
+	defaultUsagePageSize = 50
+	maxUsagePageSize     = 200
+)
+
+// flushRequest is the body of POST /api/admin/cache/flush.
+type flushRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// FlushCache deletes the given cache keys.
+func FlushCache(c *fiber.Ctx) error {
+	store := cache.GetClient()
+	if store == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Cache not configured",
+		})
+	}
+
+	var body flushRequest
+	if err := c.BodyParser(&body); err != nil || len(body.Keys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Request body must be {\"keys\": [...]} with at least one key",
+		})
+	}
+	if len(body.Keys) > maxFlushKeys {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Too many keys (max " + strconv.Itoa(maxFlushKeys) + ")",
+		})
+	}
+
+	// Step 1: Remember the old values for the audit record, then delete
+	before := make(map[string]string, len(body.Keys))
+	for _, key := range body.Keys {
+		value, err := store.Get(key)
+		if err != nil {
+			log.Printf("WARNING: Failed to read cache key %s before flush: %v", key, err)
+		}
+		if value != "" {
+			before[key] = value
+		}
+
+		if err := store.Del(key); err != nil {
+			log.Printf("ERROR: Failed to delete cache key %s: %v", key, err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error": "Failed to flush cache",
+			})
+		}
+	}
+
+	// Step 2: Audit
+	recordAudit(c, "cache.flush", strings.Join(body.Keys, ","), before, nil)
+
+	return c.JSON(fiber.Map{
+		"deleted": len(body.Keys),
+	})
+}
+
+// GetCacheEpoch returns the cache epoch embedded in every key.
+func GetCacheEpoch(c *fiber.Ctx) error {
+	epochStore := cache.GetEpoch()
+	if epochStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Cache not configured",
+		})
+	}
+
+	epoch, err := epochStore.Epoch()
+	if err != nil {
+		log.Printf("ERROR: Failed to read cache epoch: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to read cache epoch",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"schema_epoch": cache.SchemaEpoch,
+		"epoch":        epoch,
+	})
+}
+
+// BumpCacheEpoch increments the cache epoch, invalidating every cached entry at once
+// (prices, tenant data, captures, export links).
+func BumpCacheEpoch(c *fiber.Ctx) error {
+	epochStore := cache.GetEpoch()
+	if epochStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Cache not configured",
+		})
+	}
+
+	epoch, err := epochStore.Bump()
+	if err != nil {
+		log.Printf("ERROR: Failed to bump cache epoch: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to bump cache epoch",
+		})
+	}
+
+	recordAudit(c, "cache.epoch.bump", "all", fiber.Map{"epoch": epoch - 1}, fiber.Map{"epoch": epoch})
+
+	return c.JSON(fiber.Map{
+		"schema_epoch": cache.SchemaEpoch,
+		"epoch":        epoch,
+	})
+}
+
+// broadcastRequest is the body of POST /api/admin/broadcast.
+type broadcastRequest struct {
+	Message json.RawMessage `json:"message"`
+}
+
+// Broadcast sends a JSON message to every connected WebSocket client.
+func Broadcast(c *fiber.Ctx) error {
+	hub := handlers.GetHub()
+	if hub == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "WebSocket hub not running",
+		})
+	}
+
+	var body broadcastRequest
+	if err := c.BodyParser(&body); err != nil || len(body.Message) == 0 || !json.Valid(body.Message) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Request body must be {\"message\": <json>}",
+		})
+	}
+
+	clients := hub.ClientCount()
+	hub.Broadcast(body.Message)
+
+	recordAudit(c, "ws.broadcast", "all", nil, fiber.Map{
+		"message": body.Message,
+		"clients": clients,
+	})
+
+	return c.JSON(fiber.Map{
+		"clients": clients,
+	})
+}
+
+// overrideRequest is the body of PUT /api/admin/ratelimit/overrides/:key.
+type overrideRequest struct {
+	Max int `json:"max"`
+}
+
+// SetRateLimitOverride sets the per-minute limit for one rate-limit key
+// (e.g. "user:123" or an IP address).
+func SetRateLimitOverride(c *fiber.Ctx) error {
+	// Copied: params are views into the request's buffer, and the key outlives the request
+	key := strings.Clone(c.Params("key"))
+
+	var body overrideRequest
+	if err := c.BodyParser(&body); err != nil || body.Max <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Request body must be {\"max\": <positive integer>}",
+		})
+	}
+
+	previous, existed := middleware.SetRateLimitOverride(key, body.Max)
+
+	var before interface{}
+	if existed {
+		before = fiber.Map{"max": previous}
+	}
+	recordAudit(c, "ratelimit.override.set", key, before, fiber.Map{"max": body.Max})
+
+	return c.JSON(fiber.Map{
+		"key": key,
+		"max": body.Max,
+	})
+}
+
+// RemoveRateLimitOverride restores the default limit for one rate-limit key.
+func RemoveRateLimitOverride(c *fiber.Ctx) error {
+	key := strings.Clone(c.Params("key"))
+
+	previous, existed := middleware.RemoveRateLimitOverride(key)
+	if !existed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No override for this key",
+		})
+	}
+
+	recordAudit(c, "ratelimit.override.remove", key, fiber.Map{"max": previous}, nil)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RestartRealtime drops the Supabase Realtime connection so the subscriber reconnects, or makes a
+// subscriber that is waiting to reconnect (or gave up) reconnect now.
+func RestartRealtime(c *fiber.Ctx) error {
+	if err := realtime.Restart(); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c, "realtime.restart", "supabase", fiber.Map{"connected": true}, fiber.Map{"connected": false})
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status": "reconnecting",
+	})
+}
+
+// StartDraining makes this instance's /readyz fail so load balancers stop sending it new
+// traffic, e.g. before maintenance. Liveness (/healthz) is unaffected. Only the instance that
+// receives the request drains.
+func StartDraining(c *fiber.Ctx) error {
+	return setDraining(c, true)
+}
+
+// StopDraining makes this instance's /readyz report ready again.
+func StopDraining(c *fiber.Ctx) error {
+	return setDraining(c, false)
+}
+
+// setDraining starts or stops draining, auditing the change.
+func setDraining(c *fiber.Ctx, draining bool) error {
+	if status.SetDraining(draining) {
+		recordAudit(c, "readiness.drain", "instance", fiber.Map{"draining": !draining}, fiber.Map{"draining": draining})
+	}
+
+	_, since := status.Draining()
+	response := fiber.Map{"draining": draining}
+	if draining {
+		response["since"] = since
+	}
+	return c.JSON(response)
+}
+
+// userDeletionRequest is the body of POST /api/admin/users/:id/deletion.
+type userDeletionRequest struct {
+	Immediate bool `json:"immediate"` // Skip the grace period
+}
+
+// ScheduleUserDeletion schedules deletion of a user's account on their behalf, and emails them the
+// confirmation (their address is read from Supabase Auth, see notify.LookupEmail).
+// With {"immediate": true} the grace period is skipped (including for an already pending
+// request) and the data is erased on the next worker run.
+func ScheduleUserDeletion(c *fiber.Ctx) error {
+	userID := strings.Clone(c.Params("id"))
+
+	var body userDeletionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Request body must be {\"immediate\": true|false}",
+			})
+		}
+	}
+
+	// The user is emailed, as when they schedule it themselves (a failed lookup doesn't stop it)
+	email, err := notify.LookupEmail(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("WARNING: Failed to look up the email of user %s for the deletion notice: %v", userID, err)
+	}
+
+	actor, _ := c.Locals("user").(string)
+	request, err := gdpr.Schedule(c.UserContext(), userID, tenant.ID(c), email, actor)
+	if err == nil && body.Immediate {
+		request, err = gdpr.Expedite(c.UserContext(), userID)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to schedule account deletion: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to schedule account deletion",
+		})
+	}
+
+	recordAudit(c, "user.deletion.schedule", userID, nil, fiber.Map{
+		"request_id":    request.ID,
+		"scheduled_for": request.ScheduledFor,
+		"immediate":     body.Immediate,
+	})
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+// CancelUserDeletion cancels a user's pending account deletion.
+func CancelUserDeletion(c *fiber.Ctx) error {
+	userID := strings.Clone(c.Params("id"))
+
+	request, err := gdpr.Cancel(c.UserContext(), userID)
+	switch {
+	case errors.Is(err, gdpr.ErrNoRequest):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No deletion request for this user",
+		})
+	case errors.Is(err, gdpr.ErrNotPending):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Deletion request is not pending",
+			"status": request.Status,
+		})
+	case err != nil:
+		log.Printf("ERROR: Failed to cancel account deletion: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to cancel deletion request",
+		})
+	}
+
+	recordAudit(c, "user.deletion.cancel", userID,
+		fiber.Map{"request_id": request.ID, "status": gdpr.StatusPending},
+		fiber.Map{"request_id": request.ID, "status": request.Status})
+
+	return c.JSON(request)
+}
+
+// ListAudit returns audit records, newest first.
+//
+// Query parameters: page (default 1), limit (default 50, max 200), actor, action. With
+// format=json every matching record is streamed as a JSON array download, without pagination.
+func ListAudit(c *fiber.Ctx) error {
+	if audit.DefaultStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Audit log not configured",
+		})
+	}
+	if c.Query("format") == "json" {
+		return exportAudit(c, audit.Query{Actor: strings.Clone(c.Query("actor")), Action: strings.Clone(c.Query("action"))})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", defaultAuditPageSize)
+	if limit < 1 || limit > maxAuditPageSize {
+		limit = defaultAuditPageSize
+	}
+
+	// Ask for one extra record to know whether there is another page
+	records, err := audit.DefaultStore.List(c.UserContext(), audit.Query{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Limit:  limit + 1,
+		Offset: (page - 1) * limit,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to list audit records: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to load audit records",
+		})
+	}
+
+	hasMore := len(records) > limit
+	if hasMore {
+		records = records[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"records":  records,
+		"page":     page,
+		"limit":    limit,
+		"has_more": hasMore,
+	})
+}
+
+// exportAudit streams every record matching query, a page at a time (see internal/stream).
+// Records appended after the first page are left out, so they don't shift the later pages.
+func exportAudit(c *fiber.Ctx, query audit.Query) error {
+	pages := func(ctx context.Context, offset, limit int) ([]audit.Record, error) {
+		page := query
+		page.Offset, page.Limit = offset, limit
+		records, err := audit.DefaultStore.List(ctx, page)
+		if err == nil && offset == 0 && len(records) > 0 {
+			query.MaxID = records[0].ID
+		}
+		return records, err
+	}
+
+	if err := stream.JSONArray(c, pages, stream.Options{Filename: "audit.json"}); err != nil {
+		log.Printf("ERROR: Failed to export audit records: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to load audit records",
+		})
+	}
+	return nil
+}
+
+// ListUsage returns stored usage rollups per user, newest period first, for reports and billing
+// exports. This instance's pending counters are flushed first; other instances' counts may lag by
+// up to USAGE_FLUSH_INTERVAL.
+//
+// Query parameters: period (day, the default, or month), subject, tenant, from and to (inclusive
+// period starts, YYYY-MM-DD), page (default 1), limit (default 50, max 200). With format=csv or
+// format=json every matching rollup is streamed as a CSV or JSON array download, without
+// pagination.
+func ListUsage(c *fiber.Ctx) error {
+	if usage.DefaultStore == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Usage accounting not configured",
+		})
+	}
+
+	query := usage.Query{
+		Period:  c.Query("period", usage.Day),
+		Subject: c.Query("subject"),
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+	}
+	if query.Period != usage.Day && query.Period != usage.Month {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "period must be day or month",
+		})
+	}
+	for _, date := range []string{query.From, query.To} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "from and to must be dates (YYYY-MM-DD)",
+			})
+		}
+	}
+	if c.Context().QueryArgs().Has("tenant") {
+		tenantID := c.Query("tenant")
+		query.TenantID = &tenantID
+	}
+
+	if err := usage.Flush(c.UserContext()); err != nil {
+		log.Printf("WARNING: Failed to flush usage before the report: %v", err)
+	}
+
+	if format := c.Query("format"); format == "csv" || format == "json" {
+		return exportUsage(c, query, format)
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", defaultUsagePageSize)
+	if limit < 1 || limit > maxUsagePageSize {
+		limit = defaultUsagePageSize
+	}
+	// Ask for one extra rollup to know whether there is another page
+	query.Limit = limit + 1
+	query.Offset = (page - 1) * limit
+
+	rollups, err := usage.DefaultStore.List(c.UserContext(), query)
+	if err != nil {
+		log.Printf("ERROR: Failed to list usage rollups: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to load usage",
+		})
+	}
+
+	hasMore := len(rollups) > limit
+	if hasMore {
+		rollups = rollups[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"usage":    rollups,
+		"page":     page,
+		"limit":    limit,
+		"has_more": hasMore,
+	})
+}
+
+// usageCSVHeader names the columns of the usage CSV export.
+var usageCSVHeader = []string{"tenant_id", "subject", "period", "period_start", "count", "updated_at"}
+
+// exportUsage streams every rollup matching query as a CSV or JSON download, a page at a time
+// (see internal/stream). Without a "to" date, periods starting after today are left out, so
+// rollups of a period that starts during the export don't shift its pages.
+func exportUsage(c *fiber.Ctx, query usage.Query, format string) error {
+	// Copied: the stream outlives the request buffer the query parameters point into
+	query.Period, query.Subject = strings.Clone(query.Period), strings.Clone(query.Subject)
+	query.From, query.To = strings.Clone(query.From), strings.Clone(query.To)
+	if query.TenantID != nil {
+		tenantID := strings.Clone(*query.TenantID)
+		query.TenantID = &tenantID
+	}
+	if query.To == "" {
+		query.To = time.Now().UTC().Format(time.DateOnly)
+	}
+
+	pages := func(ctx context.Context, offset, limit int) ([]usage.Rollup, error) {
+		page := query
+		page.Offset, page.Limit = offset, limit
+		return usage.DefaultStore.List(ctx, page)
+	}
+
+	// Receivers check the signature over the whole export, which must then be built in memory
+	options := stream.Options{Filename: "usage-" + query.Period + "." + format, Buffer: signature.Enabled()}
+	var err error
+	if format == "json" {
+		err = stream.JSONArray(c, pages, options)
+	} else {
+		err = stream.CSV(c, usageCSVHeader, pages, func(rollup usage.Rollup) []string {
+			return []string{
+				rollup.TenantID, rollup.Subject, rollup.Period, rollup.PeriodStart,
+				strconv.FormatInt(rollup.Count, 10), rollup.UpdatedAt.UTC().Format(time.RFC3339),
+			}
+		}, options)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to export usage rollups: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to load usage",
+		})
+	}
+	return nil
+}
+
+// ListCaptures returns summaries of the recorded request/response pairs, newest first.
+func ListCaptures(c *fiber.Ctx) error {
+	captures, err := capture.List()
+	if err != nil {
+		log.Printf("ERROR: Failed to list captures: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load captures",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"captures": captures,
+	})
+}
+
+// GetCapture returns one recorded request/response pair.
+func GetCapture(c *fiber.Ctx) error {
+	recorded, err := capture.Get(c.Params("id"))
+	if errors.Is(err, capture.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Capture not found or expired",
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to load capture: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load capture",
+		})
+	}
+
+	return c.JSON(recorded)
+}
+
+// SLOStatus returns the compliance of every declared SLO over the rolling windows.
+func SLOStatus(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"objectives": slo.Snapshot(),
+	})
+}
+
+// StartupSummary returns the route table and subsystem report printed at boot.
+func StartupSummary(c *fiber.Ctx) error {
+	return c.JSON(startup.Get())
+}
+
+// recordAudit writes an audit record for the current admin.
+// The action has already happened at this point, so a failed write is logged with the
+// full record (the log is the fallback trail) rather than failing the request.
+func recordAudit(c *fiber.Ctx, action, target string, before, after interface{}) {
+	actor, _ := c.Locals("user").(string)
+
+	if err := audit.Log(c.UserContext(), actor, action, target, before, after); err != nil {
+		beforeJSON, _ := json.Marshal(before)
+		afterJSON, _ := json.Marshal(after)
+		log.Printf("ERROR: %v (actor=%s action=%s target=%s before=%s after=%s)",
+			err, actor, action, target, beforeJSON, afterJSON)
+	}
+}
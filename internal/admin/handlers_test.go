@@ -0,0 +1,271 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/jobs"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/usage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp creates an app with the admin handlers and the given user set as the actor.
+func newTestApp(t *testing.T) (*fiber.App, *audit.MemoryStore) {
+	original := audit.DefaultStore
+	store := audit.NewMemoryStore()
+	audit.SetDefault(store)
+	t.Cleanup(func() { audit.SetDefault(original) })
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", "admin-1")
+		return c.Next()
+	})
+	app.Put("/overrides/:key", SetRateLimitOverride)
+	app.Delete("/overrides/:key", RemoveRateLimitOverride)
+	app.Post("/realtime/restart", RestartRealtime)
+	app.Get("/audit", ListAudit)
+	app.Get("/usage", ListUsage)
+	app.Get("/cache/epoch", GetCacheEpoch)
+	app.Post("/cache/epoch", BumpCacheEpoch)
+	app.Get("/jobs", ListJobs)
+	app.Post("/jobs/:id/retry", RetryJob)
+	return app, store
+}
+
+// TestRateLimitOverride_Audited tests that setting, updating and removing an override are audited.
+func TestRateLimitOverride_Audited(t *testing.T) {
+	app, store := newTestApp(t)
+	defer middleware.RemoveRateLimitOverride("user:42")
+
+	send := func(method, body string) int {
+		req := httptest.NewRequest(method, "/overrides/user:42", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, send("PUT", `{"max": 500}`))
+	assert.Equal(t, http.StatusOK, send("PUT", `{"max": 1000}`))
+	assert.Equal(t, http.StatusBadRequest, send("PUT", `{"max": 0}`))
+	assert.Equal(t, http.StatusNoContent, send("DELETE", ""))
+	assert.Equal(t, http.StatusNotFound, send("DELETE", ""))
+
+	records, err := store.List(context.Background(), audit.Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	// Newest first: remove, update, create
+	assert.Equal(t, "ratelimit.override.remove", records[0].Action)
+	assert.JSONEq(t, `{"max":1000}`, string(records[0].Before))
+	assert.Equal(t, "ratelimit.override.set", records[1].Action)
+	assert.JSONEq(t, `{"max":500}`, string(records[1].Before))
+	assert.JSONEq(t, `{"max":1000}`, string(records[1].After))
+	assert.Nil(t, records[2].Before)
+	assert.Equal(t, "user:42", records[2].Target)
+	assert.Equal(t, "admin-1", records[2].Actor)
+}
+
+// TestBumpCacheEpoch_Audited tests that bumping the cache epoch invalidates entries and is audited.
+func TestBumpCacheEpoch_Audited(t *testing.T) {
+	app, store := newTestApp(t)
+
+	original := cache.DefaultEpoch
+	epochStore := cache.WithEpoch(cache.NewMemoryStore(), 0)
+	cache.DefaultEpoch = epochStore
+	t.Cleanup(func() { cache.DefaultEpoch = original })
+	require.NoError(t, epochStore.Set("price:123", "45.67", time.Minute))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/cache/epoch", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 1.0, body["epoch"])
+	assert.Equal(t, float64(cache.SchemaEpoch), body["schema_epoch"])
+
+	value, err := epochStore.Get("price:123")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	records, err := store.List(context.Background(), audit.Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "cache.epoch.bump", records[0].Action)
+	assert.JSONEq(t, `{"epoch":0}`, string(records[0].Before))
+	assert.JSONEq(t, `{"epoch":1}`, string(records[0].After))
+}
+
+// TestRetryJob_Audited tests that dead jobs are listed, and that retrying one queues it again and
+// is audited.
+func TestRetryJob_Audited(t *testing.T) {
+	app, store := newTestApp(t)
+
+	queue := jobs.New(nil, jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond})
+	jobs.SetDefault(queue)
+	t.Cleanup(func() { jobs.SetDefault(nil) })
+	id, err := queue.Enqueue("admin_test.unhandled", nil, jobs.Options{MaxAttempts: 1})
+	require.NoError(t, err)
+
+	// Without a handler, its only attempt fails
+	ctx, cancel := context.WithCancel(context.Background())
+	go queue.Run(ctx)
+	require.Eventually(t, func() bool {
+		stats, _ := queue.Stats()
+		return stats[jobs.StateDead] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/jobs", nil))
+	require.NoError(t, err)
+	var body struct {
+		Counts map[string]int64 `json:"counts"`
+		Jobs   []jobs.Job       `json:"jobs"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	assert.Equal(t, int64(1), body.Counts[jobs.StateDead])
+	require.Len(t, body.Jobs, 1)
+	assert.Contains(t, body.Jobs[0].LastError, "no handler")
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/jobs/"+id+"/retry", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, err = app.Test(httptest.NewRequest("POST", "/jobs/"+id+"/retry", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "no longer dead")
+
+	records, err := store.List(context.Background(), audit.Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "jobs.retry", records[0].Action)
+	assert.Equal(t, id, records[0].Target)
+}
+
+// TestRestartRealtime_NotConnected tests that restarting without a live connection is a conflict
+// and is not audited.
+func TestRestartRealtime_NotConnected(t *testing.T) {
+	app, store := newTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/realtime/restart", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	records, err := store.List(context.Background(), audit.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+// TestListAudit_Pagination tests page/limit handling and has_more.
+func TestListAudit_Pagination(t *testing.T) {
+	app, store := newTestApp(t)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Append(context.Background(), audit.Record{Actor: "admin-1", Action: "cache.flush"}))
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/audit?page=2&limit=2", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Records []audit.Record `json:"records"`
+		Page    int            `json:"page"`
+		HasMore bool           `json:"has_more"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Records, 2)
+	assert.Equal(t, int64(3), body.Records[0].ID)
+	assert.Equal(t, 2, body.Page)
+	assert.True(t, body.HasMore)
+}
+
+// TestListAudit_Export tests that format=json streams every matching record.
+func TestListAudit_Export(t *testing.T) {
+	app, store := newTestApp(t)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Append(context.Background(), audit.Record{Actor: "admin-1", Action: "cache.flush"}))
+	}
+	require.NoError(t, store.Append(context.Background(), audit.Record{Actor: "admin-1", Action: "drain.start"}))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/audit?action=cache.flush&format=json", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "audit.json")
+
+	var records []audit.Record
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&records))
+	require.Len(t, records, 5)
+	assert.Equal(t, int64(5), records[0].ID)
+}
+
+// TestListUsage tests filtering usage rollups and the CSV export.
+func TestListUsage(t *testing.T) {
+	app, _ := newTestApp(t)
+	original := usage.DefaultStore
+	store := usage.NewMemoryStore()
+	usage.SetDefault(store)
+	t.Cleanup(func() { usage.SetDefault(original) })
+
+	updated := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Save(context.Background(), []usage.Rollup{
+		{Subject: "u1", Period: usage.Day, PeriodStart: "2026-10-15", Count: 7, UpdatedAt: updated},
+		{Subject: "u2", Period: usage.Day, PeriodStart: "2026-10-16", Count: 3, UpdatedAt: updated},
+		{TenantID: "acme", Subject: "u3", Period: usage.Day, PeriodStart: "2026-10-16", Count: 1, UpdatedAt: updated},
+		{Subject: "u1", Period: usage.Month, PeriodStart: "2026-10-01", Count: 10, UpdatedAt: updated},
+	}))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/usage?tenant=&from=2026-10-16", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Usage []usage.Rollup `json:"usage"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Usage, 1)
+	assert.Equal(t, "u2", body.Usage[0].Subject)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/usage?period=month&format=csv", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "usage-month.csv")
+	csv, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant_id,subject,period,period_start,count,updated_at\n"+
+		",u1,month,2026-10-01,10,2026-10-16T12:00:00Z\n", string(csv))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/usage?period=day&format=json", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "usage-day.json")
+	var exported []usage.Rollup
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&exported))
+	assert.Len(t, exported, 3)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/usage?from=yesterday", nil))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"strings"
+
+	"boilerplate/internal/jobs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Page sizes of GET /api/admin/jobs.
+const (
+	defaultJobsPageSize = 50
+	maxJobsPageSize     = 200
+)
+
+// ListJobs returns the number of background jobs in each state and the first jobs of one.
+//
+// Query parameters: state (queued, running or dead, the default) and limit (default 50, max 200).
+func ListJobs(c *fiber.Ctx) error {
+	queue := jobs.Get()
+	if queue == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Job queue not configured",
+		})
+	}
+
+	state := strings.Clone(c.Query("state", jobs.StateDead))
+	if state != jobs.StateQueued && state != jobs.StateRunning && state != jobs.StateDead {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "state must be queued, running or dead",
+		})
+	}
+	limit := c.QueryInt("limit", defaultJobsPageSize)
+	if limit < 1 || limit > maxJobsPageSize {
+		limit = defaultJobsPageSize
+	}
+
+	stats, err := queue.Stats()
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to read the job queue",
+		})
+	}
+	list, err := queue.List(state, limit)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to read the job queue",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"counts": stats,
+		"state":  state,
+		"jobs":   list,
+	})
+}
+
+// RetryJob queues a dead job again, with its attempts reset.
+func RetryJob(c *fiber.Ctx) error {
+	queue := jobs.Get()
+	if queue == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Job queue not configured",
+		})
+	}
+
+	id := strings.Clone(c.Params("id"))
+	found, err := queue.Retry(id)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to update the job queue",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No dead job with this ID",
+		})
+	}
+
+	recordAudit(c, "jobs.retry", id, fiber.Map{"state": jobs.StateDead}, fiber.Map{"state": jobs.StateQueued})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DiscardJob deletes a dead job.
+func DiscardJob(c *fiber.Ctx) error {
+	queue := jobs.Get()
+	if queue == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Job queue not configured",
+		})
+	}
+
+	id := strings.Clone(c.Params("id"))
+	found, err := queue.Discard(id)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to update the job queue",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No dead job with this ID",
+		})
+	}
+
+	recordAudit(c, "jobs.discard", id, fiber.Map{"state": jobs.StateDead}, nil)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
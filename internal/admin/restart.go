@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"boilerplate/internal/lifecycle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// restartTimeout bounds how long a restart waits for the services to stop.
+const restartTimeout = 30 * time.Second
+
+// RestartService stops and starts a subsystem of this instance (and the subsystems depending on
+// it), re-reading its settings, without restarting the process.
+func RestartService(c *fiber.Ctx) error {
+	name := strings.Clone(c.Params("service"))
+	ctx, cancel := context.WithTimeout(c.UserContext(), restartTimeout)
+	defer cancel()
+
+	restarted, err := lifecycle.Restart(ctx, name)
+	if errors.Is(err, lifecycle.ErrUnknownService) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":    "Unknown service",
+			"services": restartable(),
+		})
+	}
+	if errors.Is(err, lifecycle.ErrNotRestartable) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":    "Service can't be restarted on its own",
+			"services": restartable(),
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to restart %s: %v", name, err)
+		recordAudit(c, "service.restart", name, nil, fiber.Map{"restarted": restarted, "error": err.Error()})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":     err.Error(),
+			"restarted": restarted,
+		})
+	}
+
+	recordAudit(c, "service.restart", name, nil, fiber.Map{"restarted": restarted})
+	return c.JSON(fiber.Map{"restarted": restarted})
+}
+
+// ListServices returns the subsystems in start order, whether they are running, and whether
+// RestartService can restart them.
+func ListServices(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"services": lifecycle.Services()})
+}
+
+// restartable returns the names of the services RestartService can restart.
+func restartable() []string {
+	var names []string
+	for _, service := range lifecycle.Services() {
+		if service.Restartable {
+			names = append(names, service.Name)
+		}
+	}
+	return names
+}
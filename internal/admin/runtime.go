@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"bytes"
+	"runtime/pprof"
+
+	"boilerplate/internal/monitor"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RuntimeStatus returns the number of goroutines, the tracked ones with their leaks, and the
+// buffer usage of the registered channels. With stacks=true it adds the goroutine profile (stacks
+// grouped by identical trace), to find where leaked goroutines are blocked.
+func RuntimeStatus(c *fiber.Ctx) error {
+	snapshot := monitor.Status()
+	if !c.QueryBool("stacks") {
+		return c.JSON(snapshot)
+	}
+
+	var stacks bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&stacks, 1); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read goroutine stacks",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"goroutines": snapshot.Goroutines,
+		"tracked":    snapshot.Tracked,
+		"channels":   snapshot.Channels,
+		"stacks":     stacks.String(),
+	})
+}
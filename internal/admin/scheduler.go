@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"boilerplate/internal/scheduler"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListScheduledTasks returns the scheduled tasks with their schedules and next runs, and their
+// last runs on this instance.
+func ListScheduledTasks(c *fiber.Ctx) error {
+	tasks := scheduler.Get()
+	if tasks == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Scheduler disabled",
+		})
+	}
+	return c.JSON(fiber.Map{"tasks": tasks.Tasks()})
+}
@@ -0,0 +1,112 @@
+package apikey
+
+// Package apikey authenticates machine-to-machine clients with API keys (the X-API-Key header,
+// see middleware.APIKeyAuth).
+//
+// Keys are never stored: the store holds the SHA-256 hash of each key with what it grants, its
+// owner, scopes and rate-limit tier. API_KEYS selects the store:
+//
+//   - redis: the cache, one JSON Key under "apikey:<hash>" (see CacheStore.Put)
+//   - table: the API_KEYS_TABLE table in Supabase (see schema.sql), read with the service role
+//     key and cached in memory for API_KEYS_CACHE_TTL
+//
+// Without API_KEYS, API keys are disabled and routes accepting them only take tokens.
+//
+// Issue a key with Generate and store its hash; hand the key itself to the client once.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/startup"
+)
+
+// Prefix starts every generated key, so leaked keys are easy to recognise (e.g. by secret
+// scanners).
+const Prefix = "sk_"
+
+// Key is what an API key grants. Its Hash identifies it in the store.
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Hash      string     `json:"key_hash"`
+	UserID    string     `json:"user_id,omitempty"`   // Owner: the key acts as this user ("" for service clients)
+	TenantID  string     `json:"tenant_id,omitempty"` // The only tenant the key may call ("" for any)
+	Scopes    []string   `json:"scopes,omitempty"`    // Checked like token scopes (see middleware.RequireScopes)
+	Tier      string     `json:"tier,omitempty"`      // Rate-limit tier (RATE_LIMIT_TIERS)
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Revoked   bool       `json:"revoked,omitempty"`
+}
+
+// Active reports whether the key may be used at now: not revoked and not expired.
+func (k *Key) Active(now time.Time) bool {
+	return !k.Revoked && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Store looks up API keys by hash.
+type Store interface {
+	// Lookup returns the key with hash, or nil if there is none.
+	Lookup(ctx context.Context, hash string) (*Key, error)
+}
+
+// DefaultStore is the store API keys are checked against. It is nil (API keys disabled) until
+// Init() or SetDefault() is called.
+var DefaultStore Store
+
+// Init configures the default store from cfg.APIKeys (API_KEYS).
+func Init(cfg config.Auth, supabase config.Supabase) {
+	switch cfg.APIKeys {
+	case config.APIKeysRedis:
+		DefaultStore = NewCacheStore()
+		startup.Report("api keys", true, "hashed keys in the cache")
+	case config.APIKeysTable:
+		DefaultStore = NewCachedStore(NewPostgRESTStore(supabase.URL, supabase.ServiceRoleKey, cfg.APIKeyTable), cfg.APIKeyCacheTTL)
+		startup.Report("api keys", true, fmt.Sprintf("hashed keys in the %s table, cached for %s", cfg.APIKeyTable, cfg.APIKeyCacheTTL))
+	default:
+		DefaultStore = nil
+		startup.Report("api keys", false, "API_KEYS not set")
+	}
+}
+
+// SetDefault replaces the default store (nil disables API keys). Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// Get returns the default store, or nil if API keys are disabled.
+func Get() Store {
+	return DefaultStore
+}
+
+// Hash returns the hash keys are stored under: the hex SHA-256 of the key. Keys are random
+// 256-bit values, so a fast hash is enough; there is nothing to brute-force.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new random key and its hash.
+func Generate() (key, hash string, err error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key = Prefix + base64.RawURLEncoding.EncodeToString(random)
+	return key, Hash(key), nil
+}
+
+// validHash reports whether hash looks like a Hash result, so lookups never send anything else
+// to the store.
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	return strings.Trim(hash, "0123456789abcdef") == ""
+}
@@ -0,0 +1,126 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerate tests that generated keys are unique, prefixed, and hash to the returned hash.
+func TestGenerate(t *testing.T) {
+	key, hash, err := Generate()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, Prefix))
+	assert.Equal(t, Hash(key), hash)
+	assert.True(t, validHash(hash))
+
+	other, _, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+// TestKey_Active tests revocation and expiry.
+func TestKey_Active(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	assert.True(t, (&Key{}).Active(now))
+	assert.True(t, (&Key{ExpiresAt: &later}).Active(now))
+	assert.False(t, (&Key{ExpiresAt: &earlier}).Active(now))
+	assert.False(t, (&Key{Revoked: true}).Active(now))
+}
+
+// TestCacheStore tests storing, looking up and deleting keys in the cache.
+func TestCacheStore(t *testing.T) {
+	original := cache.GetClient()
+	defer cache.SetDefault(original)
+	cache.SetDefault(cache.NewMemoryStore())
+
+	store := NewCacheStore()
+	key := Key{ID: "k1", Hash: Hash("sk_test"), Scopes: []string{"read"}, Tier: "partner"}
+	require.NoError(t, store.Put(key))
+
+	found, err := store.Lookup(context.Background(), key.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, &key, found)
+
+	found, err = store.Lookup(context.Background(), Hash("sk_other"))
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	require.NoError(t, store.Delete(key.Hash))
+	found, err = store.Lookup(context.Background(), key.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	assert.Error(t, store.Put(Key{ID: "bad", Hash: "sk_plain"}), "keys must be stored hashed")
+}
+
+// TestPostgRESTStore tests the table lookup.
+func TestPostgRESTStore(t *testing.T) {
+	hash := Hash("sk_test")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/v1/api_keys", r.URL.Path)
+		assert.Equal(t, "Bearer service", r.Header.Get("Authorization"))
+		if r.URL.Query().Get("key_hash") != "eq."+hash {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"id": "k1", "key_hash": "` + hash + `", "user_id": null, "scopes": ["read"], "tier": "partner", "created_at": "2026-01-01T00:00:00Z"}]`))
+	}))
+	defer server.Close()
+	store := NewPostgRESTStore(server.URL, "service", "api_keys")
+
+	key, err := store.Lookup(context.Background(), hash)
+	require.NoError(t, err)
+	require.NotNil(t, key)
+	assert.Equal(t, Key{ID: "k1", Hash: hash, Scopes: []string{"read"}, Tier: "partner"}, *key)
+
+	key, err = store.Lookup(context.Background(), Hash("sk_other"))
+	require.NoError(t, err)
+	assert.Nil(t, key)
+}
+
+// countingStore counts lookups.
+type countingStore struct {
+	Store
+	lookups atomic.Int32
+}
+
+func (s *countingStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	s.lookups.Add(1)
+	return s.Store.Lookup(ctx, hash)
+}
+
+// TestCachedStore tests that lookups, unknown keys included, are cached for the TTL.
+func TestCachedStore(t *testing.T) {
+	inner := &countingStore{Store: NewMemoryStore(Key{ID: "k1", Hash: Hash("sk_test")})}
+	store := NewCachedStore(inner, time.Minute).(*CachedStore)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		key, err := store.Lookup(context.Background(), Hash("sk_test"))
+		require.NoError(t, err)
+		assert.Equal(t, "k1", key.ID)
+		key, err = store.Lookup(context.Background(), Hash("sk_unknown"))
+		require.NoError(t, err)
+		assert.Nil(t, key)
+	}
+	assert.Equal(t, int32(2), inner.lookups.Load())
+
+	now = now.Add(2 * time.Minute)
+	_, err := store.Lookup(context.Background(), Hash("sk_test"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), inner.lookups.Load())
+
+	assert.Same(t, inner, NewCachedStore(inner, 0), "a TTL of 0 doesn't cache")
+}
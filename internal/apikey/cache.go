@@ -0,0 +1,144 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+)
+
+// errNoCache is returned by CacheStore when the cache is not initialized.
+var errNoCache = errors.New("cache not initialized")
+
+// storedKeyTTL is the TTL of keys without ExpiresAt in a CacheStore: they live until deleted, but
+// the cache always sets one.
+const storedKeyTTL = 10 * 365 * 24 * time.Hour
+
+// CacheStore keeps API keys in the cache (API_KEYS=redis), one JSON Key under "apikey:<hash>".
+type CacheStore struct{}
+
+// NewCacheStore creates a store on the default cache.
+func NewCacheStore() *CacheStore {
+	return &CacheStore{}
+}
+
+// cacheKey returns the cache key of the key with hash.
+func cacheKey(hash string) string {
+	return "apikey:" + hash
+}
+
+// Lookup returns the key with hash, or nil.
+func (s *CacheStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	store := cache.GetClient()
+	if store == nil {
+		return nil, errNoCache
+	}
+	if !validHash(hash) {
+		return nil, nil
+	}
+	value, err := store.Get(cacheKey(hash))
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var key Key
+	if err := json.Unmarshal([]byte(value), &key); err != nil {
+		return nil, fmt.Errorf("failed to parse API key: %w", err)
+	}
+	return &key, nil
+}
+
+// Put stores key under its hash, replacing any key with the same hash. Revoke a key by putting
+// it with Revoked set, or with Delete.
+func (s *CacheStore) Put(key Key) error {
+	store := cache.GetClient()
+	if store == nil {
+		return errNoCache
+	}
+	if !validHash(key.Hash) {
+		return fmt.Errorf("invalid API key hash %q", key.Hash)
+	}
+	value, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode API key: %w", err)
+	}
+	ttl := storedKeyTTL
+	if key.ExpiresAt != nil {
+		ttl = max(time.Until(*key.ExpiresAt), time.Second)
+	}
+	return store.Set(cacheKey(key.Hash), string(value), ttl)
+}
+
+// Delete removes the key with hash.
+func (s *CacheStore) Delete(hash string) error {
+	store := cache.GetClient()
+	if store == nil {
+		return errNoCache
+	}
+	return store.Del(cacheKey(hash))
+}
+
+// maxCachedLookups bounds the lookups a CachedStore keeps; unknown keys are cached too, so
+// clients sending random keys can't grow it without limit.
+const maxCachedLookups = 10000
+
+// CachedStore caches the lookups of another store in memory for a TTL, so each request with an
+// API key doesn't query the database. Revoking a key takes up to the TTL to apply.
+type CachedStore struct {
+	store Store
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedLookup
+	now     func() time.Time // Overridable clock for tests
+}
+
+// cachedLookup is a cached Lookup result (key is nil for unknown hashes).
+type cachedLookup struct {
+	key       *Key
+	expiresAt time.Time
+}
+
+// NewCachedStore caches the lookups of store for ttl. A ttl of 0 returns store itself.
+func NewCachedStore(store Store, ttl time.Duration) Store {
+	if ttl <= 0 {
+		return store
+	}
+	return &CachedStore{store: store, ttl: ttl, entries: make(map[string]cachedLookup), now: time.Now}
+}
+
+// Lookup returns the cached result for hash, or looks it up. Errors are not cached.
+func (s *CachedStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.entries[hash]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return copyKey(entry.key), nil
+	}
+
+	key, err := s.store.Lookup(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if len(s.entries) >= maxCachedLookups {
+		s.entries = make(map[string]cachedLookup)
+	}
+	s.entries[hash] = cachedLookup{key: key, expiresAt: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return copyKey(key), nil
+}
+
+// copyKey returns a copy of key (nil for nil), so callers can't change cached keys.
+func copyKey(key *Key) *Key {
+	if key == nil {
+		return nil
+	}
+	copied := *key
+	return &copied
+}
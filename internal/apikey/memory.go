@@ -0,0 +1,38 @@
+package apikey
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps API keys in process memory. It is used in tests.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key // By hash
+}
+
+// NewMemoryStore creates a store holding keys.
+func NewMemoryStore(keys ...Key) *MemoryStore {
+	m := &MemoryStore{keys: make(map[string]Key)}
+	for _, key := range keys {
+		m.keys[key.Hash] = key
+	}
+	return m
+}
+
+// Lookup returns a copy of the key with hash, or nil.
+func (m *MemoryStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if key, ok := m.keys[hash]; ok {
+		return &key, nil
+	}
+	return nil, nil
+}
+
+// Put inserts or replaces the key with key.Hash.
+func (m *MemoryStore) Put(key Key) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.Hash] = key
+}
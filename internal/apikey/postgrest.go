@@ -0,0 +1,68 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// PostgRESTStore reads API keys from a Postgres table through the Supabase REST API (PostgREST),
+// with the service role key. See schema.sql for the table.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/api_keys
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store reading table of the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey, table string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + table,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(5 * time.Second),
+	}
+}
+
+// Lookup returns the row whose key_hash is hash, or nil.
+func (s *PostgRESTStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	if !validHash(hash) {
+		return nil, nil
+	}
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("key_hash", "eq."+hash)
+	params.Set("limit", "1")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var rows []Key
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
@@ -0,0 +1,18 @@
+-- Hashed API keys of machine-to-machine clients, for API_KEYS=table (see internal/apikey). Run
+-- this in the Supabase SQL editor. Store apikey.Hash(key), never the key itself.
+
+create table if not exists api_keys (
+    id         text        primary key default gen_random_uuid()::text,
+    name       text        not null default '',
+    key_hash   text        not null unique,   -- Hex SHA-256 of the key
+    user_id    text,                          -- Owner the key acts as (null for service clients)
+    tenant_id  text,                          -- The only tenant the key may call (null for any)
+    scopes     text[]      not null default '{}',
+    tier       text        not null default '',  -- Rate-limit tier (RATE_LIMIT_TIERS)
+    expires_at timestamptz,
+    revoked    boolean     not null default false,
+    created_at timestamptz not null default now()
+);
+
+-- Only the backend (service role key) reads the table; no policy grants other roles access.
+alter table api_keys enable row level security;
@@ -0,0 +1,1401 @@
+package app_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/config"
+	"boilerplate/internal/docs"
+	"boilerplate/internal/frontend"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/handlers"
+	"boilerplate/internal/health"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/notify"
+	"boilerplate/internal/realtime"
+	"boilerplate/internal/realtimepb"
+	"boilerplate/internal/resource"
+	"boilerplate/internal/status"
+	"boilerplate/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestApp_Health tests that the health endpoint is reachable on the running app.
+func TestApp_Health(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/health", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestApp_ProtectedRoute tests that /api requires a valid token (HS256 and RS256 via mock JWKS).
+func TestApp_ProtectedRoute(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	// No token: answered with problem details
+	resp := h.Do(t, h.NewRequest(t, "GET", "/api/profile", ""))
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	var problem map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, "unauthorized", problem["code"])
+	assert.Equal(t, "/api/profile", problem["instance"])
+	assert.Equal(t, problem["detail"], problem["error"])
+
+	// HS256 token
+	req := h.NewRequest(t, "GET", "/api/profile", "")
+	req.Header.Set("Authorization", "Bearer "+testutil.HS256Token(t, "user-hs", nil))
+	resp = h.Do(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// RS256 token validated against the mock JWKS endpoint
+	req = h.NewRequest(t, "GET", "/api/profile", "")
+	req.Header.Set("Authorization", "Bearer "+h.Supabase.RS256Token(t, "user-rs", nil))
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "user-rs", body["user"])
+}
+
+// TestApp_GraphQLCacheInjection tests the proxy end to end with a cached price.
+func TestApp_GraphQLCacheInjection(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	h.Supabase.SetGraphQLResponse(http.StatusOK, `{"data":{"artists":[{"id":"a1","name":"Artist"}]}}`)
+	require.NoError(t, h.Cache.Set("price:a1", "9.99", time.Minute))
+
+	resp := h.Do(t, h.NewRequest(t, "POST", "/graphql", `{"query":"{ artists { id name currentPrice } }"}`))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data struct {
+			Artists []map[string]interface{} `json:"artists"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Data.Artists, 1)
+	assert.Equal(t, 9.99, body.Data.Artists[0]["currentPrice"])
+	assert.Len(t, h.Supabase.GraphQLRequests(), 1)
+}
+
+// TestApp_RequestID tests that each response carries a correlation ID and the GraphQL proxy
+// passes it on to Supabase.
+func TestApp_RequestID(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	req := h.NewRequest(t, "POST", "/graphql", `{"query":"{ artists { id } }"}`)
+	req.Header.Set("X-Request-ID", "req-123")
+	resp := h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "req-123", resp.Header.Get("X-Request-ID"))
+
+	requests := h.Supabase.GraphQLRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "req-123", requests[0].Header.Get("X-Request-ID"))
+
+	// Without one, an ID is generated
+	resp = h.Do(t, h.NewRequest(t, "GET", "/health", ""))
+	assert.NotEmpty(t, resp.Header.Get("X-Request-ID"))
+}
+
+// TestApp_RealtimeToWebSocket tests that a Realtime price change reaches WebSocket clients
+// and is written to the cache.
+func TestApp_RealtimeToWebSocket(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{StartRealtime: true})
+
+	client := h.DialWS(t, "/ws", nil)
+	h.WaitForClients(t, 1, 2*time.Second)
+
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 42.5)
+
+	var update map[string]interface{}
+	client.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "artist-1", update["artist_id"])
+	assert.Equal(t, "42.5", update["price"]) // Exact decimal string
+
+	cached, err := h.Cache.Get("price:artist-1")
+	require.NoError(t, err)
+	assert.Equal(t, "42.5", cached)
+}
+
+// TestApp_MetricsCountsUnknownKid tests that an RS256 token signed with an unknown key
+// is rejected and shows up in /metrics.
+func TestApp_MetricsCountsUnknownKid(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	token := h.Supabase.RS256Token(t, "user-rs", jwt.MapClaims{})
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	parsed.Header["kid"] = "rotated-away"
+	forged, err := parsed.SigningString()
+	require.NoError(t, err)
+
+	req := h.NewRequest(t, "GET", "/api/profile", "")
+	req.Header.Set("Authorization", "Bearer "+forged+".c2ln")
+	resp := h.Do(t, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/metrics", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `auth_failures_total{reason="unknown_kid"}`)
+	assert.Contains(t, string(body), `http_security_responses_total{route="/api/profile",status="401"}`)
+}
+
+// TestApp_AdminActionsAreAudited tests that admin endpoints require an admin and write audit records.
+func TestApp_AdminActionsAreAudited(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"ADMIN_USER_IDS": "admin-1"}})
+	require.NoError(t, h.Cache.Set("price:a1", "9.99", time.Minute))
+
+	// Non-admin users are rejected and nothing is audited
+	req := h.NewRequest(t, "POST", "/api/admin/cache/flush", `{"keys":["price:a1"]}`)
+	req.Header.Set("Authorization", "Bearer "+testutil.HS256Token(t, "user-1", nil))
+	resp := h.Do(t, req)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Admin flush
+	adminToken := "Bearer " + testutil.HS256Token(t, "admin-1", nil)
+	req = h.NewRequest(t, "POST", "/api/admin/cache/flush", `{"keys":["price:a1"]}`)
+	req.Header.Set("Authorization", adminToken)
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cached, err := h.Cache.Get("price:a1")
+	require.NoError(t, err)
+	assert.Equal(t, "", cached)
+
+	// The audit endpoint returns the record with the old value
+	req = h.NewRequest(t, "GET", "/api/admin/audit?action=cache.flush", "")
+	req.Header.Set("Authorization", adminToken)
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Records []struct {
+			Actor  string            `json:"actor"`
+			Action string            `json:"action"`
+			Target string            `json:"target"`
+			Before map[string]string `json:"before"`
+		} `json:"records"`
+		HasMore bool `json:"has_more"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Records, 1)
+	assert.Equal(t, "admin-1", body.Records[0].Actor)
+	assert.Equal(t, "price:a1", body.Records[0].Target)
+	assert.Equal(t, "9.99", body.Records[0].Before["price:a1"])
+	assert.False(t, body.HasMore)
+}
+
+// TestApp_TenantScopedRealtime tests that tenant rows are cached under the tenant prefix
+// and only reach WebSocket clients connected on that tenant's subdomain, with its token.
+func TestApp_TenantScopedRealtime(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{
+		Env:           map[string]string{"TENANT_BASE_DOMAIN": "api.example.test"},
+		StartRealtime: true,
+	})
+	tokenOf := func(tenantID string) string {
+		return "/ws?token=" + testutil.HS256Token(t, "user-"+tenantID, jwt.MapClaims{"tenant_id": tenantID})
+	}
+	acmeHost := http.Header{"Host": []string{"acme.api.example.test"}}
+
+	// Anonymous clients and other tenants' tokens can't listen on a tenant's subdomain
+	_, resp, err := websocket.DefaultDialer.Dial(h.WSURL+"/ws", acmeHost)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	_, resp, err = websocket.DefaultDialer.Dial(h.WSURL+tokenOf("globex"), acmeHost)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	acme := h.DialWS(t, tokenOf("acme"), acmeHost)
+	globex := h.DialWS(t, tokenOf("globex"), http.Header{"Host": []string{"globex.api.example.test"}})
+	h.WaitForClients(t, 2, 2*time.Second)
+
+	for _, row := range []struct {
+		tenant string
+		price  float64
+	}{{"acme", 1.5}, {"globex", 2.5}} {
+		h.Supabase.PushRealtime(t, map[string]interface{}{
+			"topic": "realtime:public:artist_metrics",
+			"event": "postgres_changes",
+			"payload": map[string]interface{}{
+				"eventType": "UPDATE",
+				"new":       map[string]interface{}{"artist_id": "artist-1", "price": row.price, "tenant_id": row.tenant},
+			},
+		})
+	}
+
+	// Each client's first message is its own tenant's update
+	var update map[string]interface{}
+	acme.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "acme", update["tenant_id"])
+	assert.Equal(t, "1.5", update["price"])
+
+	globex.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "globex", update["tenant_id"])
+	assert.Equal(t, "2.5", update["price"])
+
+	cached, err := h.Cache.Get("tenant:acme:price:artist-1")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", cached)
+	cached, err = h.Cache.Get("price:artist-1")
+	require.NoError(t, err)
+	assert.Equal(t, "", cached, "tenant rows must not be cached in the shared namespace")
+}
+
+// TestApp_TenantCORS tests that preflight requests are checked against the tenant's own origins.
+func TestApp_TenantCORS(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{
+		"TENANT_BASE_DOMAIN":  "api.example.test",
+		"TENANT_CORS_ORIGINS": `{"acme": ["https://app.acme.com"]}`,
+		"ALLOWED_ORIGINS":     "https://www.example.test",
+	}})
+
+	preflight := func(host, origin string) string {
+		req := h.NewRequest(t, "OPTIONS", "/api/profile", "")
+		req.Host = host
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		return h.Do(t, req).Header.Get("Access-Control-Allow-Origin")
+	}
+
+	// Tenant with its own origins
+	assert.Equal(t, "https://app.acme.com", preflight("acme.api.example.test", "https://app.acme.com"))
+	assert.Equal(t, "", preflight("acme.api.example.test", "https://www.example.test"))
+
+	// Other tenants and the bare domain use ALLOWED_ORIGINS
+	assert.Equal(t, "", preflight("globex.api.example.test", "https://app.acme.com"))
+	assert.Equal(t, "https://www.example.test", preflight("globex.api.example.test", "https://www.example.test"))
+	assert.Equal(t, "https://www.example.test", preflight("api.example.test", "https://www.example.test"))
+}
+
+// TestApp_CORSGroups tests the CORS policy of each route group: public GETs from any origin,
+// /api from the app's origins, /api/admin from the same origin only.
+func TestApp_CORSGroups(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{
+		"ALLOWED_ORIGINS": "https://app.example.test",
+	}})
+
+	preflight := func(path, origin, method string) *http.Response {
+		req := h.NewRequest(t, "OPTIONS", path, "")
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		return h.Do(t, req)
+	}
+
+	// Public GETs: any origin, without credentials
+	resp := preflight("/health", "https://elsewhere.test", "GET")
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Credentials"))
+
+	// Public routes written to keep the app's origins
+	assert.Empty(t, preflight("/graphql", "https://elsewhere.test", "POST").Header.Get("Access-Control-Allow-Origin"))
+	resp = preflight("/graphql", "https://app.example.test", "POST")
+	assert.Equal(t, "https://app.example.test", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+
+	// /api: the app's origins only, GETs included
+	assert.Empty(t, preflight("/api/profile", "https://elsewhere.test", "GET").Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "https://app.example.test", preflight("/api/profile", "https://app.example.test", "GET").Header.Get("Access-Control-Allow-Origin"))
+
+	// /api/admin: no cross-origin requests at all; same-origin and Origin-less requests go through
+	resp = preflight("/api/admin/slo", "https://app.example.test", "GET")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	req := h.NewRequest(t, "GET", "/api/admin/slo", "")
+	req.Header.Set("Origin", "http://"+req.Host)
+	assert.Equal(t, http.StatusUnauthorized, h.Do(t, req).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, h.Do(t, h.NewRequest(t, "GET", "/api/admin/slo", "")).StatusCode)
+}
+
+// TestApp_PreflightSkipsRateLimit tests that preflights are answered before auth and never
+// consume rate-limit quota, and carry Access-Control-Max-Age.
+func TestApp_PreflightSkipsRateLimit(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{
+		"ALLOWED_ORIGINS": "https://app.example.test",
+		"RATE_LIMIT_MAX":  "2",
+		"CORS_MAX_AGE":    "10m",
+	}})
+
+	for _, origin := range []string{"https://app.example.test", "https://elsewhere.test"} {
+		for i := 0; i < 3; i++ {
+			req := h.NewRequest(t, "OPTIONS", "/api/profile", "")
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization")
+			resp := h.Do(t, req)
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode, origin)
+			if origin == "https://app.example.test" {
+				assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+			}
+		}
+	}
+
+	// Same-origin preflights to /api/admin are answered too, not routed
+	req := h.NewRequest(t, "OPTIONS", "/api/admin/slo", "")
+	req.Header.Set("Origin", "http://"+req.Host)
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	assert.Equal(t, http.StatusNoContent, h.Do(t, req).StatusCode)
+
+	// The whole budget (2) is left
+	bearer := testutil.HS256Token(t, "preflight-user", nil)
+	for i := 0; i < 2; i++ {
+		req := h.NewRequest(t, "GET", "/api/profile", "")
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		assert.NotEqual(t, http.StatusTooManyRequests, h.Do(t, req).StatusCode)
+	}
+	req = h.NewRequest(t, "GET", "/api/profile", "")
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	assert.Equal(t, http.StatusTooManyRequests, h.Do(t, req).StatusCode)
+}
+
+// recordingMailer records the recipients of the emails sent.
+type recordingMailer struct {
+	to []string
+}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+	m.to = append(m.to, to)
+	return nil
+}
+
+// TestApp_AccountDeletionWorkflow tests scheduling, cancelling and the admin override
+// for account deletion, through to the worker erasing the data.
+func TestApp_AccountDeletionWorkflow(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"ADMIN_USER_IDS": "admin-1"}})
+	originalMailer, originalLookup := mail.DefaultMailer, notify.LookupEmail
+	t.Cleanup(func() {
+		mail.SetDefault(originalMailer)
+		notify.LookupEmail = originalLookup
+	})
+	mailer := &recordingMailer{}
+	mail.SetDefault(mailer)
+	notify.LookupEmail = func(ctx context.Context, userID string) (string, error) { return userID + "@example.com", nil }
+	userToken := "Bearer " + testutil.HS256Token(t, "user-1", jwt.MapClaims{"email": "user-1@example.com"})
+	adminToken := "Bearer " + testutil.HS256Token(t, "admin-1", nil)
+
+	// The user schedules deletion, sees it, and cancels it
+	req := h.NewRequest(t, "DELETE", "/api/me", "")
+	req.Header.Set("Authorization", userToken)
+	resp := h.Do(t, req)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var scheduled gdpr.Request
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&scheduled))
+	assert.Equal(t, gdpr.StatusPending, scheduled.Status)
+	assert.True(t, scheduled.ScheduledFor.After(time.Now().Add(24*time.Hour)))
+
+	req = h.NewRequest(t, "DELETE", "/api/me/deletion", "")
+	req.Header.Set("Authorization", userToken)
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req = h.NewRequest(t, "DELETE", "/api/me/deletion", "")
+	req.Header.Set("Authorization", userToken)
+	resp = h.Do(t, req)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// An admin forces an immediate deletion, which the user is told about and the worker completes
+	mailer.to = nil
+	req = h.NewRequest(t, "POST", "/api/admin/users/user-1/deletion", `{"immediate": true}`)
+	req.Header.Set("Authorization", adminToken)
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, []string{"user-1@example.com"}, mailer.to)
+
+	completed, err := gdpr.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, completed)
+
+	req = h.NewRequest(t, "GET", "/api/me/deletion", "")
+	req.Header.Set("Authorization", userToken)
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var latest gdpr.Request
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&latest))
+	assert.Equal(t, gdpr.StatusCompleted, latest.Status)
+	assert.Equal(t, "admin-1", latest.RequestedBy)
+
+	// The admin override is audited, with the deleted user's ID replaced by an alias
+	records, err := h.Audit.List(context.Background(), audit.Query{Action: "user.deletion.schedule"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "admin-1", records[0].Actor)
+	assert.Equal(t, "deleted-user-"+latest.ID, records[0].Target)
+}
+
+// TestApp_DataExport tests the asynchronous export and the signed download link.
+func TestApp_DataExport(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	userToken := "Bearer " + testutil.HS256Token(t, "user-1", jwt.MapClaims{"email": "user-1@example.com"})
+
+	// Poll until the export is ready
+	var export struct {
+		Status      string `json:"status"`
+		DownloadURL string `json:"download_url"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for export.Status != "ready" && time.Now().Before(deadline) {
+		req := h.NewRequest(t, "GET", "/api/me/export?format=json", "")
+		req.Header.Set("Authorization", userToken)
+		resp := h.Do(t, req)
+		require.Contains(t, []int{http.StatusOK, http.StatusAccepted}, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&export))
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, "ready", export.Status)
+
+	// The link works without a token; a tampered one doesn't
+	resp, err := http.Get(export.DownloadURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), ".json")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "user-1@example.com")
+
+	tampered, err := http.Get(export.DownloadURL + "0")
+	require.NoError(t, err)
+	tampered.Body.Close()
+	assert.Equal(t, http.StatusForbidden, tampered.StatusCode)
+}
+
+// TestApp_Profile tests reading, updating and validating the profile, and the avatar upload.
+func TestApp_Profile(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	userToken := "Bearer " + testutil.HS256Token(t, "user-1", nil)
+
+	send := func(method, path, body, contentType string) (*http.Response, map[string]interface{}) {
+		req := h.NewRequest(t, method, path, body)
+		req.Header.Set("Authorization", userToken)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp := h.Do(t, req)
+		var decoded map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&decoded))
+		return resp, decoded
+	}
+
+	// Empty until the first update
+	resp, body := send("GET", "/api/profile", "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "user-1", body["user"])
+	assert.Equal(t, "", body["profile"].(map[string]interface{})["display_name"])
+
+	// Updated, then read back
+	resp, _ = send("PUT", "/api/profile", `{"display_name": "Ada", "preferences": {"theme": "dark"}}`, "application/json")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, body = send("GET", "/api/profile", "", "")
+	profile := body["profile"].(map[string]interface{})
+	assert.Equal(t, "Ada", profile["display_name"])
+	assert.Equal(t, map[string]interface{}{"theme": "dark"}, profile["preferences"])
+
+	// Invalid values and unknown fields are rejected
+	resp, body = send("PUT", "/api/profile", `{"display_name": "`+strings.Repeat("a", 51)+`"}`, "application/json")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "display_name", body["field"])
+	resp, _ = send("PUT", "/api/profile", `{"avatar_url": "https://evil.example/x.png"}`, "application/json")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The avatar is stored and its URL saved on the profile
+	resp, body = send("PUT", "/api/profile/avatar", "\x89PNG", "image/png")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	avatarURL := body["profile"].(map[string]interface{})["avatar_url"].(string)
+	_, stored := h.Storage.Object(strings.TrimPrefix(avatarURL, "https://storage.test/"))
+	assert.True(t, stored)
+
+	resp, _ = send("PUT", "/api/profile/avatar", "<svg/>", "image/svg+xml")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+// TestApp_PreferencesSync tests that a preference change is pushed to the user's other
+// connections, and only theirs.
+func TestApp_PreferencesSync(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	token := testutil.HS256Token(t, "user-1", nil)
+
+	// An invalid token is refused at the handshake rather than silently ignored
+	_, resp, err := websocket.DefaultDialer.Dial(h.WSURL+"/ws?token=invalid", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	otherDevice := h.DialWS(t, "/ws?schema=2&token="+token, nil)
+	otherUser := h.DialWS(t, "/ws?token="+testutil.HS256Token(t, "user-2", nil), nil)
+	h.WaitForClients(t, 2, 2*time.Second)
+	otherDevice.ReadMessage(t, 2*time.Second) // Welcome
+
+	req := h.NewRequest(t, "PUT", "/api/preferences", `{"theme": "dark", "notifications.email": false}`)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var envelope struct {
+		Type string `json:"type"`
+		Data struct {
+			Preferences map[string]interface{} `json:"preferences"`
+			Changed     []string               `json:"changed"`
+		} `json:"data"`
+	}
+	otherDevice.ReadJSON(t, &envelope, 2*time.Second)
+	assert.Equal(t, "preferences", envelope.Type)
+	assert.Equal(t, []string{"notifications.email", "theme"}, envelope.Data.Changed)
+	assert.Equal(t, "dark", envelope.Data.Preferences["theme"])
+	assert.Equal(t, true, envelope.Data.Preferences["notifications.push"]) // Default
+
+	// The other user's first message is the next broadcast, not the preferences
+	h.Hub.Broadcast([]byte(`{"notice": "hello"}`))
+	var broadcast map[string]interface{}
+	otherUser.ReadJSON(t, &broadcast, 2*time.Second)
+	assert.Equal(t, "hello", broadcast["notice"])
+
+	// Values outside the schema are rejected
+	req = h.NewRequest(t, "PUT", "/api/preferences", `{"theme": "neon"}`)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp = h.Do(t, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+// TestApp_WebSocketUserChannel tests the token subprotocol and that SendToUser reaches only the
+// user's connections.
+func TestApp_WebSocketUserChannel(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	protocols := func(token string) http.Header {
+		return http.Header{"Sec-WebSocket-Protocol": {"app.ws.v2, " + handlers.TokenSubprotocolPrefix + token}}
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(h.WSURL+"/ws", protocols("invalid"))
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	user := h.DialWS(t, "/ws", protocols(testutil.HS256Token(t, "user-1", nil)))
+	assert.Equal(t, "app.ws.v2", user.Conn.Subprotocol(), "the token subprotocol is never selected")
+	anonymous := h.DialWS(t, "/ws?schema=2", nil)
+	h.WaitForClients(t, 2, 2*time.Second)
+	user.ReadMessage(t, 2*time.Second)      // Welcome
+	anonymous.ReadMessage(t, 2*time.Second) // Welcome
+
+	sent, err := h.Hub.SendToUser("user-1", "order_fill", map[string]string{"order_id": "o-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	var envelope handlers.Envelope
+	user.ReadJSON(t, &envelope, 2*time.Second)
+	assert.Equal(t, "order_fill", envelope.Type)
+	assert.JSONEq(t, `{"order_id": "o-1"}`, string(envelope.Data))
+
+	sent, err = h.Hub.SendToUser("user-2", "order_fill", map[string]string{"order_id": "o-2"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent, "not connected")
+
+	// The anonymous client's next message is the broadcast
+	h.Hub.Publish("notice", []byte(`{"notice": "hello"}`))
+	anonymous.ReadJSON(t, &envelope, 2*time.Second)
+	assert.Equal(t, "notice", envelope.Type)
+}
+
+// TestApp_Resources tests the soft-delete lifecycle of a watchlist item, and that artists are
+// read-only for users while admin writes are audited.
+func TestApp_Resources(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"ADMIN_USER_IDS": "admin-1"}})
+	userToken := "Bearer " + testutil.HS256Token(t, "user-1", nil)
+	adminToken := "Bearer " + testutil.HS256Token(t, "admin-1", nil)
+
+	send := func(method, path, body, token string) (*http.Response, map[string]interface{}) {
+		req := h.NewRequest(t, method, path, body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+		resp := h.Do(t, req)
+		var decoded map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp, decoded
+	}
+	count := func(path string) int {
+		resp, body := send("GET", path, "", userToken)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return len(body["items"].([]interface{}))
+	}
+
+	// Create, then validation
+	resp, item := send("POST", "/api/watchlist", `{"artist_id": "a1"}`, userToken)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	id := item["id"].(string)
+	resp, invalid := send("POST", "/api/watchlist", `{"note": "no artist"}`, userToken)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "artist_id", invalid["field"])
+
+	// Soft delete: gone from the list, in the trash, and restorable once
+	assert.Equal(t, 1, count("/api/watchlist"))
+	resp, deleted := send("DELETE", "/api/watchlist/"+id, "", userToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, deleted["deleted_at"])
+	assert.Equal(t, 0, count("/api/watchlist"))
+	assert.Equal(t, 1, count("/api/watchlist?deleted=true"))
+	resp, _ = send("GET", "/api/watchlist/"+id, "", userToken)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = send("POST", "/api/watchlist/"+id+"/restore", "", userToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = send("POST", "/api/watchlist/"+id+"/restore", "", userToken)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, 1, count("/api/watchlist"))
+
+	// Other users can't see it
+	resp, _ = send("GET", "/api/watchlist/"+id, "", "Bearer "+testutil.HS256Token(t, "user-2", nil))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Artists: users can't write, admins can, and admin writes are audited
+	resp, _ = send("POST", "/api/admin/artists", `{"name": "Nina"}`, userToken)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, artist := send("POST", "/api/admin/artists", `{"name": "Nina"}`, adminToken)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	artistID := artist["id"].(string)
+	assert.Equal(t, 1, count("/api/artists"))
+
+	resp, _ = send("DELETE", "/api/admin/artists/"+artistID, "", adminToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 0, count("/api/artists"))
+
+	records, err := h.Audit.List(context.Background(), audit.Query{Actor: "admin-1"})
+	require.NoError(t, err)
+	actions := make([]string, 0, len(records))
+	for _, record := range records {
+		actions = append(actions, record.Action)
+		assert.Equal(t, artistID, record.Target)
+	}
+	assert.ElementsMatch(t, []string{"artists.create", "artists.delete"}, actions)
+}
+
+// TestApp_OptimisticLocking tests that a PUT with a stale If-Match is rejected with 409 and the
+// current version, for profiles and alerts.
+func TestApp_OptimisticLocking(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	token := "Bearer " + testutil.HS256Token(t, "user-1", nil)
+
+	send := func(method, path, body, etag string) (*http.Response, map[string]interface{}) {
+		req := h.NewRequest(t, method, path, body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+		if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+		resp := h.Do(t, req)
+		var decoded map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp, decoded
+	}
+
+	// Profile: both devices read version 0, the first write wins
+	resp, _ := send("GET", "/api/profile", "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"0"`, etag)
+
+	resp, _ = send("PUT", "/api/profile", `{"display_name": "Phone"}`, etag)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+
+	resp, conflict := send("PUT", "/api/profile", `{"display_name": "Laptop"}`, etag)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, float64(1), conflict["current_version"])
+	assert.Equal(t, "Phone", conflict["current"].(map[string]interface{})["display_name"])
+
+	// Without If-Match the write applies as before; a malformed one is rejected
+	resp, _ = send("PUT", "/api/profile", `{"display_name": "Laptop"}`, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = send("PUT", "/api/profile", `{"display_name": "Tablet"}`, "version-2")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Alerts work the same way, weak ETags included
+	resp, alert := send("POST", "/api/alerts", `{"artist_id": "a1", "direction": "above", "threshold": "10"}`, "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	path := "/api/alerts/" + alert["id"].(string)
+	etag = resp.Header.Get("ETag")
+
+	resp, _ = send("PUT", path, `{"threshold": "20"}`, "W/"+etag)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, conflict = send("PUT", path, `{"threshold": "30"}`, etag)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, float64(2), conflict["current_version"])
+	assert.Equal(t, "20", conflict["current"].(map[string]interface{})["threshold"])
+}
+
+// TestApp_BulkOperations tests per-item statuses for individual and atomic bulk requests.
+func TestApp_BulkOperations(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	token := "Bearer " + testutil.HS256Token(t, "user-1", nil)
+
+	type bulkResponse struct {
+		Results []struct {
+			Index  int                    `json:"index"`
+			Status int                    `json:"status"`
+			Item   map[string]interface{} `json:"item"`
+			Error  string                 `json:"error"`
+			Field  string                 `json:"field"`
+		} `json:"results"`
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+	}
+	bulk := func(body string) (int, bulkResponse) {
+		req := h.NewRequest(t, "POST", "/api/alerts/bulk", body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+		resp := h.Do(t, req)
+		var decoded bulkResponse
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp.StatusCode, decoded
+	}
+
+	// Individually: the valid item is created, the invalid one reports 422
+	status, body := bulk(`{"operations": [
+		{"op": "create", "fields": {"artist_id": "a1", "direction": "above", "threshold": "10"}},
+		{"op": "create", "fields": {"artist_id": "a2", "direction": "sideways", "threshold": "10"}}
+	]}`)
+	require.Equal(t, http.StatusMultiStatus, status)
+	require.Len(t, body.Results, 2)
+	assert.Equal(t, http.StatusCreated, body.Results[0].Status)
+	assert.Equal(t, "a1", body.Results[0].Item["artist_id"])
+	assert.Equal(t, http.StatusUnprocessableEntity, body.Results[1].Status)
+	assert.Equal(t, "direction", body.Results[1].Field)
+	assert.Equal(t, 1, body.Succeeded)
+	id := body.Results[0].Item["id"].(string)
+
+	// Atomically: one missing row fails the batch and nothing is written
+	status, body = bulk(`{"atomic": true, "operations": [
+		{"op": "update", "id": "` + id + `", "fields": {"active": false}},
+		{"op": "delete", "id": "missing"}
+	]}`)
+	require.Equal(t, http.StatusMultiStatus, status)
+	assert.Equal(t, http.StatusFailedDependency, body.Results[0].Status)
+	assert.Equal(t, http.StatusNotFound, body.Results[1].Status)
+
+	req := h.NewRequest(t, "GET", "/api/alerts/"+id, "")
+	req.Header.Set("Authorization", token)
+	resp := h.Do(t, req)
+	var alert map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&alert))
+	assert.Equal(t, true, alert["active"])
+
+	// All valid: 200
+	status, body = bulk(`{"atomic": true, "operations": [{"op": "delete", "id": "` + id + `"}]}`)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, http.StatusOK, body.Results[0].Status)
+
+	status, _ = bulk(`{"operations": []}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// TestApp_Search tests ranked search with pagination and typeahead suggestions over artists.
+func TestApp_Search(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"ADMIN_USER_IDS": "admin-1"}})
+	userToken := "Bearer " + testutil.HS256Token(t, "user-1", nil)
+	adminToken := "Bearer " + testutil.HS256Token(t, "admin-1", nil)
+
+	get := func(path string) (*http.Response, map[string]interface{}) {
+		req := h.NewRequest(t, "GET", path, "")
+		req.Header.Set("Authorization", userToken)
+		resp := h.Do(t, req)
+		var decoded map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp, decoded
+	}
+	for _, name := range []string{"Nina Simone", "Nina", "The Nina Project", "Miles Davis"} {
+		req := h.NewRequest(t, "POST", "/api/admin/artists", `{"name": "`+name+`"}`)
+		req.Header.Set("Authorization", adminToken)
+		req.Header.Set("Content-Type", "application/json")
+		require.Equal(t, http.StatusCreated, h.Do(t, req).StatusCode)
+	}
+
+	// Best match first, with a second page
+	resp, body := get("/api/search?q=nina&limit=2")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	results := body["results"].([]interface{})
+	require.Len(t, results, 2)
+	assert.Equal(t, "Nina", results[0].(map[string]interface{})["name"])
+	assert.Equal(t, "Nina Simone", results[1].(map[string]interface{})["name"])
+	assert.Equal(t, true, body["has_more"])
+
+	_, body = get("/api/search?q=nina&limit=2&page=2")
+	assert.Equal(t, false, body["has_more"])
+	assert.Len(t, body["results"], 1)
+
+	// Misspellings still match
+	_, body = get("/api/search?q=nina+simon")
+	assert.Equal(t, "Nina Simone", body["results"].([]interface{})[0].(map[string]interface{})["name"])
+
+	// Typeahead
+	resp, body = get("/api/search/suggest?q=mil")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	suggestions := body["suggestions"].([]interface{})
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "Miles Davis", suggestions[0].(map[string]interface{})["name"])
+
+	// A query is required
+	resp, _ = get("/api/search?q=+")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = get("/api/search/suggest")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestApp_RobotsAndSitemap tests the crawler files, with and without SITE_URL.
+func TestApp_RobotsAndSitemap(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{
+		"SITE_URL":      "https://example.com",
+		"SITEMAP_PATHS": "/,/pricing",
+	}})
+	artist, err := resource.Artists.Create(context.Background(), resource.Owner{}, map[string]interface{}{"name": "Nina Simone"})
+	require.NoError(t, err)
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/robots.txt", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "public, max-age=3600", resp.Header.Get("Cache-Control"))
+	robots, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(robots), "Disallow: /api/\n")
+	assert.Contains(t, string(robots), "Sitemap: https://example.com/sitemap.xml")
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/sitemap.xml", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/xml")
+	sitemap, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(sitemap), "<loc>https://example.com/pricing</loc>")
+	assert.Contains(t, string(sitemap), "<loc>https://example.com/artists/"+artist.ID()+"</loc>")
+
+	// Without SITE_URL there is no sitemap
+	h = testutil.NewHarness(t, testutil.Options{Env: map[string]string{"SITE_URL": ""}})
+	resp = h.Do(t, h.NewRequest(t, "GET", "/sitemap.xml", ""))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// TestApp_SSRBatch tests that an SSR batch resolves authenticated routes through the full
+// middleware chain and that its per-user responses are not cacheable.
+func TestApp_SSRBatch(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"SSR_TOKEN": "ssr-secret"}})
+	token := "Bearer " + testutil.HS256Token(t, "user-1", nil)
+
+	req := h.NewRequest(t, "POST", "/internal/ssr/batch", `{"requests": [
+		{"id": "watchlist", "path": "/api/watchlist"},
+		{"id": "search", "path": "/api/search?q="}
+	]}`)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+	req.Header.Set("X-SSR-Request", "ssr-secret")
+	resp := h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "private, no-store", resp.Header.Get("Cache-Control"))
+
+	var body struct {
+		Responses []struct {
+			ID     string                 `json:"id"`
+			Status int                    `json:"status"`
+			Body   map[string]interface{} `json:"body"`
+		} `json:"responses"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Responses, 2)
+	assert.Equal(t, http.StatusOK, body.Responses[0].Status)
+	assert.Contains(t, body.Responses[0].Body, "items")
+	assert.Equal(t, http.StatusBadRequest, body.Responses[1].Status)
+
+	// Without the caller's token, the batched routes still require auth
+	req = h.NewRequest(t, "POST", "/internal/ssr/batch", `{"requests": [{"id": "watchlist", "path": "/api/watchlist"}]}`)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SSR-Request", "ssr-secret")
+	resp = h.Do(t, req)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, http.StatusUnauthorized, body.Responses[0].Status)
+}
+
+// TestApp_DegradedMode tests that a Realtime outage is reported by /health and flagged on
+// GraphQL responses that include cached prices.
+func TestApp_DegradedMode(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	h.Supabase.SetGraphQLResponse(http.StatusOK, `{"data":{"artists":[{"id":"a1","name":"Artist"}]}}`)
+	require.NoError(t, h.Cache.Set("price:a1", "9.99", time.Minute))
+
+	status.SetDown(status.Realtime, errors.New("connection lost"))
+
+	// /health still answers 200 but says degraded
+	resp := h.Do(t, h.NewRequest(t, "GET", "/health", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var health struct {
+		Status       string                       `json:"status"`
+		Dependencies map[string]status.Dependency `json:"dependencies"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	assert.Equal(t, "degraded", health.Status)
+	assert.Equal(t, status.StateDown, health.Dependencies[status.Realtime].State)
+
+	// The (possibly stale) cached price is still served, but flagged
+	resp = h.Do(t, h.NewRequest(t, "POST", "/graphql", `{"query":"{ artists { id name currentPrice } }"}`))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "realtime", resp.Header.Get("X-Degraded"))
+	var body struct {
+		Data struct {
+			Artists []map[string]interface{} `json:"artists"`
+		} `json:"data"`
+		Meta map[string]interface{} `json:"meta"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Data.Artists, 1)
+	assert.Equal(t, 9.99, body.Data.Artists[0]["currentPrice"])
+	assert.Equal(t, true, body.Meta["degraded"])
+
+	// Recovered: back to ok
+	status.SetUp(status.Realtime)
+	resp = h.Do(t, h.NewRequest(t, "GET", "/health", ""))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	assert.Equal(t, "ok", health.Status)
+}
+
+// TestApp_VersionNegotiation tests that /api/profile serves both versions by path and Accept.
+func TestApp_VersionNegotiation(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+	token := testutil.HS256Token(t, "user-1", nil)
+
+	profile := func(path, accept string) (*http.Response, map[string]interface{}) {
+		req := h.NewRequest(t, "GET", path, "")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp := h.Do(t, req)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp, body
+	}
+
+	// v1 (default): bare user ID
+	_, body := profile("/api/profile", "")
+	assert.Equal(t, "user-1", body["user"])
+
+	// v2 by media type
+	resp, body := profile("/api/profile", "application/vnd.app.v2+json")
+	assert.Equal(t, map[string]interface{}{"id": "user-1"}, body["user"])
+	assert.Equal(t, "application/vnd.app.v2+json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "2", resp.Header.Get("X-API-Version"))
+
+	// v2 by path, through the same route and middleware
+	_, body = profile("/api/v2/profile", "")
+	assert.Equal(t, map[string]interface{}{"id": "user-1"}, body["user"])
+}
+
+// TestApp_PriceMetaOverWebSocket tests that a client that asked for price metadata gets it in
+// its locale, while other clients receive the plain update.
+func TestApp_PriceMetaOverWebSocket(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{StartRealtime: true, Env: map[string]string{"PRICE_CURRENCY": "EUR"}})
+
+	plain := h.DialWS(t, "/ws", nil)
+	withMeta := h.DialWS(t, "/ws?price_meta=true", http.Header{"Accept-Language": []string{"de-DE"}})
+	h.WaitForClients(t, 2, 2*time.Second)
+
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 1234.5)
+
+	var update map[string]interface{}
+	withMeta.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "1234.5", update["price"])
+	assert.Equal(t, map[string]interface{}{
+		"currency":  "EUR",
+		"precision": 2.0,
+		"amount":    "1234.50",
+		"display":   "1.234,50 €",
+		"locale":    "de-DE",
+	}, update["price_meta"])
+
+	update = nil
+	plain.ReadJSON(t, &update, 2*time.Second)
+	assert.NotContains(t, update, "price_meta")
+}
+
+// TestApp_WebSocketSubscriptions tests the /ws protocol: a client subscribing to an artist's
+// topic gets an ack and only that artist's updates, and pings are answered.
+func TestApp_WebSocketSubscriptions(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{StartRealtime: true})
+
+	client := h.DialWS(t, "/ws", nil)
+	h.WaitForClients(t, 1, 2*time.Second)
+
+	client.SendJSON(t, map[string]string{"type": "subscribe", "topic": "prices:artist-2", "ref": "1"})
+	var reply map[string]interface{}
+	client.ReadJSON(t, &reply, 2*time.Second)
+	assert.Equal(t, map[string]interface{}{"type": "ack", "topic": "prices:artist-2", "ref": "1"}, reply)
+
+	client.SendText(t, `{"type": "ping", "ref": "2"}`)
+	reply = nil
+	client.ReadJSON(t, &reply, 2*time.Second)
+	assert.Equal(t, map[string]interface{}{"type": "pong", "ref": "2"}, reply)
+
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 10)
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-2", 20)
+	var update map[string]interface{}
+	client.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "artist-2", update["artist_id"], "artist-1 is not subscribed to")
+}
+
+// TestApp_WebSocketSchemaNegotiation tests the schema handshake: legacy clients keep bare
+// messages, schema 2 clients (by subprotocol or query) get a welcome and enveloped updates.
+func TestApp_WebSocketSchemaNegotiation(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{StartRealtime: true})
+
+	legacy := h.DialWS(t, "/ws", nil)
+	bySubprotocol := h.DialWS(t, "/ws", http.Header{"Sec-WebSocket-Protocol": []string{"app.ws.v2, app.ws.v1"}})
+	byQuery := h.DialWS(t, "/ws?schema=2", nil)
+	h.WaitForClients(t, 3, 2*time.Second)
+	assert.Equal(t, "app.ws.v2", bySubprotocol.Conn.Subprotocol())
+
+	for _, client := range []*testutil.WSClient{bySubprotocol, byQuery} {
+		var welcome map[string]interface{}
+		client.ReadJSON(t, &welcome, 2*time.Second)
+		assert.Equal(t, "welcome", welcome["type"])
+		assert.Equal(t, 2.0, welcome["version"])
+	}
+
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 42.5)
+
+	var update map[string]interface{}
+	legacy.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "artist-1", update["artist_id"])
+	assert.NotContains(t, update, "version")
+
+	var ids []interface{}
+	for _, client := range []*testutil.WSClient{bySubprotocol, byQuery} {
+		var envelope map[string]interface{}
+		client.ReadJSON(t, &envelope, 2*time.Second)
+		assert.Equal(t, "price_update", envelope["type"])
+		assert.Equal(t, 2.0, envelope["version"])
+		assert.NotEmpty(t, envelope["ts"])
+		data, ok := envelope["data"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "42.5", data["price"])
+		ids = append(ids, envelope["id"])
+	}
+	assert.Equal(t, ids[0], ids[1]) // One ID per message, whoever receives it
+
+	// Versions older than the oldest supported one are refused
+	_, resp, err := websocket.DefaultDialer.Dial(h.WSURL+"/ws?schema=0", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestApp_WebSocketProtobuf tests that a client can opt into protobuf frames.
+func TestApp_WebSocketProtobuf(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{StartRealtime: true})
+
+	client := h.DialWS(t, "/ws?encoding=protobuf", nil)
+	h.WaitForClients(t, 1, 2*time.Second)
+
+	readEnvelope := func() *realtimepb.Envelope {
+		client.Conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		frameType, data, err := client.Conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, frameType)
+		envelope := &realtimepb.Envelope{}
+		require.NoError(t, proto.Unmarshal(data, envelope))
+		return envelope
+	}
+
+	assert.Equal(t, int32(2), readEnvelope().GetWelcome().GetSchema())
+
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 42.5)
+	update := readEnvelope().GetPriceUpdate()
+	require.NotNil(t, update)
+	assert.Equal(t, "artist-1", update.GetArtistId())
+	assert.Equal(t, "42.5", update.GetPrice())
+}
+
+// TestApp_WebSocketDeltaMode tests that delta clients receive batched price_delta messages
+// with the latest price per artist, while full clients keep one message per change.
+func TestApp_WebSocketDeltaMode(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{StartRealtime: true})
+
+	delta := h.DialWS(t, "/ws?schema=2&mode=delta&delta_interval=200ms", nil)
+	full := h.DialWS(t, "/ws", nil)
+	h.WaitForClients(t, 2, 2*time.Second)
+
+	var welcome map[string]interface{}
+	delta.ReadJSON(t, &welcome, 2*time.Second)
+	assert.Equal(t, "welcome", welcome["type"])
+
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 10)
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-2", 20)
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 11)
+
+	// Changes of one artist may be conflated in the Realtime queue; read until the latest ones
+	latest := map[string]interface{}{}
+	for latest["artist-1"] != "11" || latest["artist-2"] != "20" {
+		var update map[string]interface{}
+		full.ReadJSON(t, &update, 2*time.Second)
+		require.Contains(t, update, "artist_id")
+		latest[update["artist_id"].(string)] = update["price"]
+	}
+
+	// The changes may straddle a flush; merge batches until both artists are seen
+	prices := map[string]interface{}{}
+	for len(prices) < 2 || prices["artist-1"] != "11" {
+		var envelope struct {
+			Type string `json:"type"`
+			Data struct {
+				Prices map[string]interface{} `json:"prices"`
+			} `json:"data"`
+		}
+		delta.ReadJSON(t, &envelope, 2*time.Second)
+		require.Equal(t, "price_delta", envelope.Type)
+		for artistID, price := range envelope.Data.Prices {
+			prices[artistID] = price
+		}
+	}
+	assert.Equal(t, map[string]interface{}{"artist-1": "11", "artist-2": "20"}, prices)
+
+	// Invalid modes are refused
+	_, resp, err := websocket.DefaultDialer.Dial(h.WSURL+"/ws?mode=sometimes", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestApp_Frontend tests that a configured frontend is served at / (gzipped) with the
+// client-side routing fallback, without shadowing the API, the demo page or unknown API paths.
+func TestApp_Frontend(t *testing.T) {
+	index := "<!doctype html><div id=app></div>" + strings.Repeat("<!-- padding -->", 100)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte(index), 0o644))
+	t.Setenv("FRONTEND_DIR", dir)
+	frontend.Init()
+	t.Cleanup(func() { frontend.SetDefault(nil) })
+
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	for _, path := range []string{"/", "/artists/123"} {
+		req := h.NewRequest(t, "GET", path, "")
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := h.Do(t, req)
+		require.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"), path)
+		assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"), path)
+
+		reader, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, index, string(body), path)
+	}
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/health", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/json")
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/demo", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "<div id=app>")
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/api/unknown", ""))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// TestApp_RealtimeLeaderElection tests that with leader election on, the replica holding the
+// lock consumes Realtime and broadcasts updates as usual.
+func TestApp_RealtimeLeaderElection(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{
+		Env:           map[string]string{"REALTIME_LEADER_ELECTION": "true", "REALTIME_LEADER_TTL": "3s"},
+		StartRealtime: true,
+	})
+	assert.True(t, realtime.IsLeader())
+
+	lock, err := h.Cache.Get("realtime:leader")
+	require.NoError(t, err)
+	assert.NotEmpty(t, lock, "the lock holds this replica's instance ID")
+
+	client := h.DialWS(t, "/ws", nil)
+	h.WaitForClients(t, 1, 2*time.Second)
+	h.Supabase.PushPriceChange(t, "UPDATE", "artist-1", 7)
+
+	var update map[string]interface{}
+	client.ReadJSON(t, &update, 2*time.Second)
+	assert.Equal(t, "artist-1", update["artist_id"])
+}
+
+// TestApp_SDK tests that the generated clients are served from the live route table.
+func TestApp_SDK(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/docs/sdk/typescript", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "getProfile<T = unknown>(query?: Query): Promise<T>")
+	assert.Contains(t, string(body), "export function subscribe(")
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/docs/sdk/dart", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/docs/sdk/cobol", ""))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// TestApp_OpenAPI tests that the OpenAPI document covers the app's routes with unique operation
+// IDs, declared schemas and auth, and that /docs loads Swagger UI for it.
+func TestApp_OpenAPI(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{})
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/openapi.json", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var document docs.Document
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&document))
+
+	operationIDs := make(map[string]string)
+	for path, operations := range document.Paths {
+		for method, operation := range operations {
+			previous, duplicate := operationIDs[operation.OperationID]
+			assert.False(t, duplicate, "%s %s has the operation ID of %s", method, path, previous)
+			operationIDs[operation.OperationID] = method + " " + path
+		}
+	}
+
+	profile := document.Paths["/api/profile"]["put"]
+	assert.NotEmpty(t, profile.Security)
+	assert.Contains(t, profile.Responses, "401")
+	assert.Contains(t, profile.RequestBody.Content["application/json"].Schema.Properties, "display_name")
+	assert.Contains(t, profile.Responses["200"].Content["application/json"].Schema.Properties, "profile")
+
+	create := document.Paths["/api/alerts"]["post"].RequestBody.Content["application/json"].Schema
+	assert.Equal(t, []string{"above", "below"}, create.Properties["direction"].Enum)
+	assert.Contains(t, create.Required, "artist_id")
+
+	assert.Contains(t, document.Paths["/api/admin/users/{id}/deletion"]["post"].Responses, "403")
+	assert.Empty(t, document.Paths["/healthz"]["get"].Security)
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/docs", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "url: '/openapi.json'")
+}
+
+// TestApp_Draining tests that draining fails readiness but not liveness, and can be undone.
+func TestApp_Draining(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"ADMIN_USER_IDS": "admin-1"}})
+	adminToken := "Bearer " + testutil.HS256Token(t, "admin-1", nil)
+	drain := func(method string) {
+		req := h.NewRequest(t, method, "/api/admin/drain", "")
+		req.Header.Set("Authorization", adminToken)
+		resp := h.Do(t, req)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/readyz", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	drain("POST")
+	resp = h.Do(t, h.NewRequest(t, "GET", "/readyz", ""))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp = h.Do(t, h.NewRequest(t, "GET", "/health", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	records, err := h.Audit.List(context.Background(), audit.Query{Action: "readiness.drain"})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	drain("DELETE")
+	resp = h.Do(t, h.NewRequest(t, "GET", "/readyz", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestApp_Readiness tests that /readyz checks the dependencies while /healthz stays 200.
+func TestApp_Readiness(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"READINESS_CACHE_TTL": "0"}})
+	var body struct {
+		Status string                   `json:"status"`
+		Checks map[string]health.Result `json:"checks"`
+	}
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/readyz", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	for _, name := range []string{health.CheckCache, health.CheckSupabase, health.CheckJWKS} {
+		assert.Equal(t, status.StateUp, body.Checks[name].State, name)
+	}
+	assert.False(t, body.Checks[health.CheckRealtime].Required)
+
+	// Every check required, Realtime included
+	t.Setenv("READINESS_REQUIRED", "")
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	health.Init(cfg)
+	status.SetDown(status.Realtime, errors.New("connection lost"))
+	resp = h.Do(t, h.NewRequest(t, "GET", "/readyz", ""))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "unready", body.Status)
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/healthz", ""))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "degraded", body.Status)
+}
+
+// TestApp_WebSocketUpgradeRateLimit tests that upgrade attempts have their own budget, rejected
+// handshakes included, and that exhausting it leaves the /api budget alone.
+func TestApp_WebSocketUpgradeRateLimit(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"RATE_LIMIT_WS_MAX": "2"}})
+	token := testutil.HS256Token(t, "user-1", nil)
+
+	_, resp, err := websocket.DefaultDialer.Dial(h.WSURL+"/ws?token=invalid", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	client := h.DialWS(t, "/ws?token="+token, nil)
+	defer client.Close()
+
+	_, resp, err = websocket.DefaultDialer.Dial(h.WSURL+"/ws?token="+token, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	req := h.NewRequest(t, http.MethodGet, "/api/profile", "")
+	req.Header.Set("Authorization", "Bearer "+token)
+	assert.NotEqual(t, http.StatusTooManyRequests, h.Do(t, req).StatusCode)
+}
+
+// TestApp_TemplatePreviews tests the template previews, and that they are only served in
+// development.
+func TestApp_TemplatePreviews(t *testing.T) {
+	h := testutil.NewHarness(t, testutil.Options{Env: map[string]string{"GO_ENV": "development"}})
+
+	resp := h.Do(t, h.NewRequest(t, "GET", "/dev/templates", ""))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	page, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(page), `href="/dev/templates/emails/digest.html"`)
+
+	req := h.NewRequest(t, "GET", "/dev/templates/emails/digest.txt", "")
+	req.Header.Set("Accept-Language", "de")
+	resp = h.Do(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Deine tägliche Zusammenfassung: 2 Benachrichtigungen", resp.Header.Get("X-Email-Subject"))
+
+	resp = h.Do(t, h.NewRequest(t, "GET", "/dev/templates/layouts/email.html", ""))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "layouts aren't templates of their own")
+
+	h = testutil.NewHarness(t, testutil.Options{Env: map[string]string{"GO_ENV": "staging"}})
+	resp = h.Do(t, h.NewRequest(t, "GET", "/dev/templates", ""))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/router"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// createCORSMiddleware returns the CORS middleware, applying the policy of each route group
+// (see corsGroups and router.CORSPolicy). Preflights are answered here, allowed or not, so they
+// never reach auth or rate limits. It panics on invalid groups, a programming error like an
+// invalid route.
+func createCORSMiddleware(cfg config.Server, groups []router.CORSGroup) fiber.Handler {
+	if err := router.ValidateCORSGroups(groups); err != nil {
+		panic(err)
+	}
+	appHandler := createAppCORSMiddleware(cfg)
+	publicHandler := cors.New(createPublicCORSConfig(cfg))
+	reportCORSGroups(groups)
+
+	return func(c *fiber.Ctx) error {
+		switch router.CORSPolicyFor(groups, c.Path()) {
+		case router.CORSPublic:
+			if isReadRequest(c) {
+				return publicHandler(c)
+			}
+		case router.CORSSameOrigin:
+			if origin := c.Get(fiber.HeaderOrigin); origin != "" && !sameOrigin(c, origin) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Cross-origin requests are not allowed",
+				})
+			}
+			if router.IsPreflight(c) {
+				return c.SendStatus(fiber.StatusNoContent) // Nothing to allow, and no route to reach
+			}
+			return c.Next()
+		}
+		return appHandler(c)
+	}
+}
+
+// createAppCORSMiddleware returns the CORS middleware of the app's origins.
+// Requests for a tenant with its own origins (see tenant.OriginResolver) are checked against
+// that tenant's list; everything else uses the global ALLOWED_ORIGINS configuration.
+// Requires tenant.Resolve to run first, since preflight requests carry no token.
+func createAppCORSMiddleware(cfg config.Server) fiber.Handler {
+	defaultConfig := createCORSConfig(cfg)
+	defaultHandler := cors.New(defaultConfig)
+
+	resolver := tenant.NewOriginResolver()
+	if resolver == nil {
+		return defaultHandler // No per-tenant origins configured
+	}
+
+	// One cors handler per distinct origin list, built on first use
+	var mu sync.Mutex
+	handlers := make(map[string]fiber.Handler)
+
+	return func(c *fiber.Ctx) error {
+		origins := resolver.Origins(c.UserContext(), tenant.ID(c))
+		if len(origins) == 0 {
+			return defaultHandler(c)
+		}
+
+		allowOrigins := strings.Join(origins, ",")
+
+		mu.Lock()
+		handler, ok := handlers[allowOrigins]
+		if !ok {
+			config := defaultConfig
+			config.AllowOrigins = allowOrigins
+			handler = cors.New(config)
+			handlers[allowOrigins] = handler
+		}
+		mu.Unlock()
+
+		return handler(c)
+	}
+}
+
+// createPublicCORSConfig creates the CORS configuration of router.CORSPublic groups: any origin,
+// GET and HEAD only, no credentials (browsers refuse a wildcard origin with credentials).
+func createPublicCORSConfig(cfg config.Server) cors.Config {
+	return cors.Config{
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,HEAD,OPTIONS",
+		AllowHeaders:  "Content-Type,Authorization,X-Requested-With,X-Request-ID",
+		ExposeHeaders: "ETag,X-Request-ID",
+		MaxAge:        corsMaxAge(cfg.CORSMaxAge),
+	}
+}
+
+// corsMaxAge converts CORS_MAX_AGE to cors.Config.MaxAge (seconds). 0 sends
+// Access-Control-Max-Age: 0 to turn caching off, rather than leaving the header out, which
+// browsers read as 5 seconds.
+func corsMaxAge(maxAge time.Duration) int {
+	if maxAge <= 0 {
+		return -1
+	}
+	return int(maxAge / time.Second)
+}
+
+// isReadRequest reports whether a request is a GET or HEAD, or the preflight of one.
+func isReadRequest(c *fiber.Ctx) bool {
+	method := c.Method()
+	if method == fiber.MethodOptions {
+		method = c.Get(fiber.HeaderAccessControlRequestMethod)
+	}
+	return method == fiber.MethodGet || method == fiber.MethodHead
+}
+
+// sameOrigin reports whether an Origin header names the host the request was sent to. Only the
+// host is compared: behind a TLS-terminating proxy the scheme seen here may differ.
+func sameOrigin(c *fiber.Ctx, origin string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, string(c.Request().Host()))
+}
+
+// reportCORSGroups adds the CORS groups to the startup summary.
+func reportCORSGroups(groups []router.CORSGroup) {
+	parts := make([]string, 0, len(groups))
+	for _, group := range groups {
+		parts = append(parts, group.Prefix+" "+group.Policy.String())
+	}
+	startup.Report("cors", true, strings.Join(parts, ", "))
+}
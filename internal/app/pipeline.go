@@ -0,0 +1,206 @@
+package app
+
+// The global middleware pipeline.
+//
+// Every global middleware has a name and a place in the default pipeline. MIDDLEWARE_DISABLE
+// leaves some out, MIDDLEWARE_ENABLE adds optional ones (off by default) at their place, and
+// MIDDLEWARE replaces the whole pipeline with the listed names, in that order. Downstream
+// projects add their own (tracing, maintenance mode, ...) with RegisterMiddleware instead of
+// editing setupMiddleware; registered middleware is optional and goes at the end of the
+// pipeline unless MIDDLEWARE places it elsewhere.
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"boilerplate/internal/abuse"
+	"boilerplate/internal/capture"
+	"boilerplate/internal/config"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/slo"
+	"boilerplate/internal/ssr"
+	"boilerplate/internal/status"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/timing"
+	"boilerplate/internal/usage"
+	"boilerplate/internal/version"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/gofiber/fiber/v2/middleware/helmet"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// MiddlewareFactory builds a global middleware from the configuration.
+type MiddlewareFactory func(cfg *config.Config) fiber.Handler
+
+// middlewareEntry is a named middleware in the pipeline.
+type middlewareEntry struct {
+	name     string
+	factory  MiddlewareFactory
+	optional bool // Only used when enabled (MIDDLEWARE_ENABLE or MIDDLEWARE)
+	required bool // Can't be left out (tenant isolation, panic recovery)
+}
+
+// builtinMiddleware is the default pipeline, in order.
+var builtinMiddleware = []middlewareEntry{
+	// Panic recovery middleware
+	{name: "recover", required: true, factory: func(*config.Config) fiber.Handler { return recover.New() }},
+
+	// Correlation ID (X-Request-ID) for logs, the GraphQL proxy and WebSocket connections
+	{name: "request_id", factory: func(*config.Config) fiber.Handler { return logging.RequestID() }},
+
+	// Structured request log: request ID, user ID, path, status, latency (redacted, see internal/logging)
+	{name: "access_log", factory: func(*config.Config) fiber.Handler { return logging.AccessLog() }},
+
+	// Request latency by route for Prometheus (http_request_duration_seconds)
+	{name: "metrics", factory: func(*config.Config) fiber.Handler { return metrics.Middleware() }},
+
+	// Per-phase timings (auth, cache, upstream, serialization); logs requests slower than SLOW_REQUEST_THRESHOLD
+	{name: "timing", factory: func(*config.Config) fiber.Handler { return timing.Middleware() }},
+
+	// Tag, throttle or block abusive clients with the rules in the cache (see internal/abuse)
+	{name: "abuse", factory: func(*config.Config) fiber.Handler { return abuse.Middleware() }},
+
+	// Security headers (X-Frame-Options, X-Content-Type-Options, Referrer-Policy, ...); optional
+	// because the cross-origin policies can break embedding the frontend
+	{name: "security_headers", optional: true, factory: func(*config.Config) fiber.Handler { return helmet.New() }},
+
+	// gzip/brotli response compression; optional because a proxy in front often does it
+	{name: "compress", optional: true, factory: func(*config.Config) fiber.Handler { return compress.New() }},
+
+	// Resolve the API version from /api/vN/... or Accept: application/vnd.app.vN+json
+	{name: "version", factory: func(*config.Config) fiber.Handler { return version.Middleware() }},
+
+	// Recognize SSR frontend requests (SSR_HEADER) and keep per-user responses out of their cache
+	{name: "ssr", factory: func(*config.Config) fiber.Handler { return ssr.Middleware() }},
+
+	// Resolve the tenant from the subdomain (TENANT_BASE_DOMAIN); /api also checks the JWT claim
+	{name: "tenant", required: true, factory: func(*config.Config) fiber.Handler { return tenant.Resolve() }},
+
+	// CORS by route group (see corsGroups): app origins (per tenant when configured,
+	// ALLOWED_ORIGINS otherwise), public GETs from anywhere, or same origin only
+	{name: "cors", factory: func(cfg *config.Config) fiber.Handler { return createCORSMiddleware(cfg.Server, corsGroups()) }},
+
+	// Count 401/403 responses per route for security dashboards
+	{name: "security_metrics", factory: func(*config.Config) fiber.Handler { return metrics.SecurityMiddleware() }},
+
+	// Count requests per user per day and month for quotas and billing (see internal/usage)
+	{name: "usage", factory: func(*config.Config) fiber.Handler { return usage.Middleware() }},
+
+	// Track per-route SLO compliance (objectives are declared next to the routes)
+	{name: "slo", factory: func(*config.Config) fiber.Handler { return slo.Middleware() }},
+
+	// Record sampled or debug-flagged request/response pairs (CAPTURE_SAMPLE_RATE, CAPTURE_DEBUG_TOKEN)
+	{name: "capture", factory: func(*config.Config) fiber.Handler { return capture.Middleware() }},
+
+	// Flag responses that relied on a dependency that is down (meta.degraded, X-Degraded)
+	{name: "status", factory: func(*config.Config) fiber.Handler { return status.Middleware() }},
+}
+
+// registered holds the middleware added with RegisterMiddleware, in registration order.
+var (
+	registeredMu sync.Mutex
+	registered   []middlewareEntry
+)
+
+// RegisterMiddleware adds an optional global middleware under name. It only runs when enabled
+// with MIDDLEWARE_ENABLE (at the end of the pipeline) or listed in MIDDLEWARE. Call it before
+// NewApp, e.g. from an init function. Registering a name twice replaces the first.
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	entry := middlewareEntry{name: name, factory: factory, optional: true}
+	for i, existing := range registered {
+		if existing.name == name {
+			registered[i] = entry
+			return
+		}
+	}
+	registered = append(registered, entry)
+}
+
+// availableMiddleware returns the built-in middleware followed by the registered ones.
+func availableMiddleware() []middlewareEntry {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	entries := append([]middlewareEntry(nil), builtinMiddleware...)
+	for _, entry := range registered {
+		if i := slices.IndexFunc(entries, func(e middlewareEntry) bool { return e.name == entry.name }); i >= 0 {
+			entries[i] = entry // A registered middleware replaces the built-in one of the same name
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// resolvePipeline returns the middleware to apply, in order, for cfg.
+// It fails on unknown names and on leaving out required middleware.
+func resolvePipeline(cfg config.Middleware) ([]middlewareEntry, error) {
+	available := availableMiddleware()
+	byName := make(map[string]middlewareEntry, len(available))
+	for _, entry := range available {
+		byName[entry.name] = entry
+	}
+
+	var unknown []string
+	for _, names := range [][]string{cfg.Order, cfg.Enable, cfg.Disable} {
+		for _, name := range names {
+			if _, ok := byName[name]; !ok {
+				unknown = append(unknown, name)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		known := make([]string, 0, len(byName))
+		for name := range byName {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown middleware %s (available: %s)",
+			strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+
+	// Step 1: The explicit order, or the default pipeline plus the enabled optional middleware
+	var pipeline []middlewareEntry
+	if len(cfg.Order) > 0 {
+		for _, name := range cfg.Order {
+			pipeline = append(pipeline, byName[name])
+		}
+	} else {
+		for _, entry := range available {
+			if !entry.optional || slices.Contains(cfg.Enable, entry.name) {
+				pipeline = append(pipeline, entry)
+			}
+		}
+	}
+
+	// Step 2: Leave out the disabled middleware
+	pipeline = slices.DeleteFunc(pipeline, func(entry middlewareEntry) bool {
+		return slices.Contains(cfg.Disable, entry.name)
+	})
+
+	// Step 3: Required middleware can be moved but not removed
+	for _, entry := range available {
+		if entry.required && !slices.ContainsFunc(pipeline, func(e middlewareEntry) bool { return e.name == entry.name }) {
+			return nil, fmt.Errorf("middleware %q is required and can't be left out", entry.name)
+		}
+	}
+	return pipeline, nil
+}
+
+// middlewareNames returns the names of pipeline, in order.
+func middlewareNames(pipeline []middlewareEntry) []string {
+	names := make([]string, len(pipeline))
+	for i, entry := range pipeline {
+		names[i] = entry.name
+	}
+	return names
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultNames is the default pipeline.
+var defaultNames = []string{
+	"recover", "request_id", "access_log", "metrics", "timing", "abuse", "version", "ssr", "tenant",
+	"cors", "security_metrics", "usage", "slo", "capture", "status",
+}
+
+// TestResolvePipeline tests the default pipeline and how the settings change it.
+func TestResolvePipeline(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  config.Middleware
+		want []string
+	}{
+		{"default", config.Middleware{}, defaultNames},
+		{
+			"enable optional",
+			config.Middleware{Enable: []string{"compress", "security_headers"}},
+			[]string{"recover", "request_id", "access_log", "metrics", "timing", "abuse", "security_headers", "compress",
+				"version", "ssr", "tenant", "cors", "security_metrics", "usage", "slo", "capture", "status"},
+		},
+		{
+			"disable",
+			config.Middleware{Disable: []string{"capture", "access_log"}},
+			[]string{"recover", "request_id", "metrics", "timing", "abuse", "version", "ssr", "tenant",
+				"cors", "security_metrics", "usage", "slo", "status"},
+		},
+		{
+			"explicit order",
+			config.Middleware{Order: []string{"request_id", "recover", "compress", "tenant", "cors"}, Disable: []string{"cors"}},
+			[]string{"request_id", "recover", "compress", "tenant"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := resolvePipeline(tc.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, middlewareNames(pipeline))
+		})
+	}
+}
+
+// TestResolvePipeline_Errors tests that unknown names and leaving out required middleware fail.
+func TestResolvePipeline_Errors(t *testing.T) {
+	_, err := resolvePipeline(config.Middleware{Enable: []string{"chaos"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown middleware chaos`)
+	assert.Contains(t, err.Error(), "security_headers")
+
+	_, err = resolvePipeline(config.Middleware{Disable: []string{"tenant"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"tenant" is required`)
+
+	_, err = resolvePipeline(config.Middleware{Order: []string{"tenant", "cors"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"recover" is required`)
+}
+
+// TestRegisterMiddleware tests that registered middleware only runs once enabled, at the end.
+func TestRegisterMiddleware(t *testing.T) {
+	registeredMu.Lock()
+	original := registered
+	registered = nil
+	registeredMu.Unlock()
+	t.Cleanup(func() {
+		registeredMu.Lock()
+		registered = original
+		registeredMu.Unlock()
+	})
+
+	RegisterMiddleware("maintenance", func(*config.Config) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusServiceUnavailable).SendString("maintenance")
+		}
+	})
+
+	pipeline, err := resolvePipeline(config.Middleware{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultNames, middlewareNames(pipeline))
+
+	pipeline, err = resolvePipeline(config.Middleware{Enable: []string{"maintenance"}})
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]string(nil), defaultNames...), "maintenance"), middlewareNames(pipeline))
+
+	app := fiber.New()
+	setupMiddleware(app, &config.Config{
+		Server:     config.Server{AllowedOrigins: "http://localhost:3000"},
+		Middleware: config.Middleware{Enable: []string{"maintenance", "security_headers"}},
+	})
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+}
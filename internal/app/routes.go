@@ -0,0 +1,844 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"boilerplate/internal/admin"
+	"boilerplate/internal/config"
+	"boilerplate/internal/docs"
+	"boilerplate/internal/frontend"
+	"boilerplate/internal/handlers"
+	"boilerplate/internal/health"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/profile"
+	"boilerplate/internal/resource"
+	"boilerplate/internal/router"
+	"boilerplate/internal/sdk"
+	"boilerplate/internal/seo"
+	"boilerplate/internal/signature"
+	"boilerplate/internal/slo"
+	"boilerplate/internal/ssr"
+	"boilerplate/internal/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/gofiber/websocket/v2"
+)
+
+// setupRoutes mounts the built-in routes, then the routes other packages added with
+// router.Register, then the frontend, whose catch-all route must not shadow any other.
+func setupRoutes(app *fiber.App, cfg *config.Config) {
+	table := append(routes(app, cfg), resourceRoutes()...)
+	table = append(table, devRoutes(cfg)...)
+	table = append(table, router.Registered()...)
+	router.MustMount(app, cfg, append(table, frontendRoutes()...))
+}
+
+// corsGroups declares the CORS policy of each group of routes (see router.CORSPolicy); the
+// longest matching prefix wins. Admin, server-to-server and metrics routes are same-origin only,
+// /api and /auth (whose session cookie needs credentials) serve the app's origins, and public
+// GETs (docs, health, robots.txt, exports, the frontend) can be fetched from anywhere. Public
+// non-GET routes such as POST /graphql keep the app's origins.
+func corsGroups() []router.CORSGroup {
+	return []router.CORSGroup{
+		{Prefix: "/", Policy: router.CORSPublic},
+		{Prefix: "/api", Policy: router.CORSApp},
+		{Prefix: "/auth", Policy: router.CORSApp},
+		{Prefix: "/api/admin", Policy: router.CORSSameOrigin},
+		{Prefix: "/dev", Policy: router.CORSSameOrigin},
+		{Prefix: "/internal", Policy: router.CORSSameOrigin},
+		{Prefix: "/webhooks", Policy: router.CORSSameOrigin},
+		{Prefix: "/metrics", Policy: router.CORSSameOrigin},
+	}
+}
+
+// routes declares every built-in route: path, handler, who may call it, its rate-limit profile,
+// cache policy, docs and SLO (see internal/router). Authenticated routes run Auth, then the
+// tenant from the token, then the rate limiter keyed on the (tenant-prefixed) user ID.
+func routes(app *fiber.App, cfg *config.Config) []router.Route {
+	return []router.Route{
+		// Public routes (no authentication required)
+
+		// Liveness probe: 200 while the process serves requests, with the reported dependencies
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/healthz",
+			Handler: health.LiveHandler,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Liveness probe",
+				Description: "Always 200; \"status\" is \"degraded\" while a reported dependency is down.",
+				Tags:        []string{"system"},
+			},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/health",
+			Handler: health.LiveHandler,
+			Cache:   router.NoStore,
+			Docs:    docs.Endpoint{Summary: "Health check (same as /healthz)", Tags: []string{"system"}},
+		},
+
+		// Readiness probe: checks the dependencies, and fails while the instance drains
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/readyz",
+			Handler: health.ReadyHandler,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary: "Readiness probe",
+				Description: "503 while the instance drains (on SIGTERM, or via POST /api/admin/drain) or while a required " +
+					"dependency check fails (cache, Supabase, JWKS, Realtime; see READINESS_REQUIRED), with every check's state.",
+				Tags:     []string{"system"},
+				Response: readinessBody{},
+			},
+		},
+
+		// Demo page with interactive documentation and testing (also served at the root
+		// unless a frontend is configured, see frontendRoutes)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/demo",
+			Handler: handlers.DemoPage,
+			Docs:    docs.Endpoint{Summary: "Interactive demo page", Tags: []string{"docs"}},
+		},
+
+		// Generated API docs: the OpenAPI document of the live route table, and Swagger UI for it
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/openapi.json",
+			Handler: docs.OpenAPIHandler(app),
+			Docs:    docs.Endpoint{Summary: "OpenAPI 3 document of this API", Tags: []string{"docs"}},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/docs",
+			Handler: docs.PageHandler,
+			Docs:    docs.Endpoint{Summary: "API documentation (Swagger UI) with try-it console", Tags: []string{"docs"}},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/docs/endpoints",
+			Handler: docs.EndpointsHandler(app),
+			Docs:    docs.Endpoint{Summary: "Documented endpoints as JSON", Tags: []string{"docs"}},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/docs/sdk/:language",
+			Handler: sdk.Handler(app),
+			Docs: docs.Endpoint{
+				Summary:     "Generated client SDK",
+				Description: "Typed client for the documented endpoints and the WebSocket protocol. language: typescript or dart.",
+				Tags:        []string{"docs"},
+			},
+		},
+
+		// Crawler files for a public site fronted by this server (see internal/seo)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/robots.txt",
+			Handler: seo.RobotsHandler,
+			Cache:   router.CachePolicy{MaxAge: time.Hour, Public: true},
+			Docs:    docs.Endpoint{Summary: "robots.txt", Tags: []string{"seo"}},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/sitemap.xml",
+			Handler: seo.SitemapHandler,
+			Cache:   router.CachePolicy{MaxAge: time.Hour, Public: true},
+			Docs: docs.Endpoint{
+				Summary:     "Sitemap of the public site",
+				Description: "SITEMAP_PATHS plus one page per artist, regenerated every SITEMAP_INTERVAL. 404 without SITE_URL.",
+				Tags:        []string{"seo"},
+			},
+		},
+
+		// Batched reads for SSR page builds (SSR requests with SSR_TOKEN only, see internal/ssr)
+		{
+			Method:  fiber.MethodPost,
+			Path:    "/internal/ssr/batch",
+			Handler: ssr.BatchHandler(app),
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary: "Resolve several GET requests in one round trip (SSR)",
+				Description: "Up to 20 /api/ paths, each run with the batch's Authorization header. Needs the SSR_HEADER " +
+					"header set to SSR_TOKEN.",
+				Tags:        []string{"ssr"},
+				ExampleBody: `{"requests": [{"id": "me", "path": "/api/profile"}, {"id": "artists", "path": "/api/artists?limit=10"}]}`,
+			},
+		},
+
+		// Prometheus metrics (protect with METRICS_TOKEN in production)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/metrics",
+			Handler: metrics.Handler(),
+			Docs:    docs.Endpoint{Summary: "Prometheus metrics", Tags: []string{"system"}},
+		},
+
+		// Data export downloads (access is granted by the signed link from GET /api/me/export;
+		// the file itself is signed for receivers when SIGNING_SECRETS is set)
+		signed(router.Route{
+			Method:  fiber.MethodGet,
+			Path:    "/exports/:id",
+			Handler: handlers.DownloadExport,
+			Docs:    docs.Endpoint{Summary: "Download a data export (signed link)", Tags: []string{"user"}},
+		}),
+
+		// Third-party webhooks: Stripe (keeping subscriptions up to date, see internal/plan),
+		// GitHub, Supabase and registered providers. Access is granted by the signature
+		{
+			Method:  fiber.MethodPost,
+			Path:    "/webhooks/:provider",
+			Handler: webhook.Receive,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Webhook receiver (Stripe, GitHub, Supabase)",
+				Description: "Verified with the provider's signature (Stripe-Signature and STRIPE_WEBHOOK_SECRET, X-Hub-Signature-256 and GITHUB_WEBHOOK_SECRET, Standard Webhooks headers and SUPABASE_WEBHOOK_SECRET) and deduplicated by event ID. Stripe's checkout.session.completed and customer.subscription.created/updated/deleted update subscriptions.",
+				Tags:        []string{"webhooks"},
+			},
+		},
+
+		// GraphQL proxy to Supabase: public, but mutations need a user's token and queries are
+		// checked against the allow-list and limits first (see handlers.GraphQLGuard)
+		{
+			Method:     router.MethodAll,
+			Path:       "/graphql",
+			Middleware: []fiber.Handler{handlers.GraphQLGuard(cfg.Auth)},
+			Handler:    handlers.GraphQLProxy,
+			Docs: docs.Endpoint{
+				Method:      fiber.MethodPost,
+				Summary:     "GraphQL proxy to Supabase",
+				Description: "Forwards the query to Supabase GraphQL, after checking it against the persisted query allow-list (GRAPHQL_PERSISTED_QUERIES, GRAPHQL_ALLOWLIST_ONLY), GRAPHQL_MAX_DEPTH and GRAPHQL_MAX_COMPLEXITY; anonymous mutations and, in production, introspection are rejected. A persisted query may be sent by hash (extensions.persistedQuery.sha256Hash). Cached prices are injected when currentPrice is requested; with GRAPHQL_CACHE_TTL set, query responses are cached per caller (X-Cache, Cache-Control: no-cache or no-store to skip).",
+				Tags:        []string{"graphql"},
+				ExampleBody: `{"query": "{ artists { id name currentPrice } }"}`,
+			},
+			// The objective covers POST, the method clients query with
+			SLO: &slo.Objective{Method: fiber.MethodPost, Latency: time.Second, LatencyTarget: 0.99, Availability: 0.999},
+		},
+
+		// REST (PostgREST) proxy to Supabase, for supabase-js REST calls; public like /graphql,
+		// Supabase applies row level security from the forwarded token
+		{
+			Method:  router.MethodAll,
+			Path:    "/rest/*",
+			Handler: handlers.RESTProxy,
+			Docs: docs.Endpoint{
+				Method:  fiber.MethodGet,
+				Summary: "REST (PostgREST) proxy to Supabase",
+				Description: "Forwards /rest/<table> and /rest/rpc/<function> (also under /rest/v1/) to Supabase's REST API with the " +
+					"request's method, headers and body. With current_price=true, artists rows get their cached currentPrice.",
+				Tags: []string{"rest"},
+			},
+		},
+
+		// Sessions through Supabase Auth, for browsers: the refresh token stays in an HttpOnly
+		// cookie (see handlers.Login). Logins are strictly limited to slow down password guessing.
+		{
+			Method:    fiber.MethodPost,
+			Path:      "/auth/login",
+			Handler:   handlers.Login(cfg.Session),
+			RateLimit: middleware.ProfileStrict,
+			Cache:     router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Sign in with email and password",
+				Description: "Signs in through Supabase Auth. The refresh token is set as an HttpOnly cookie scoped to /auth (AUTH_COOKIE_NAME); the body carries the access token, to send as Authorization: Bearer. Refused credentials return 401.",
+				Tags:        []string{"auth"},
+				ExampleBody: `{"email": "ada@example.com", "password": "secret"}`,
+				Request:     handlers.LoginRequest{},
+				Response:    handlers.SessionResponse{},
+			},
+		},
+		{
+			Method:    fiber.MethodPost,
+			Path:      "/auth/refresh",
+			Handler:   handlers.Refresh(cfg.Session),
+			RateLimit: middleware.ProfileDefault,
+			Cache:     router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Exchange the refresh token cookie for a new access token",
+				Description: "The cookie is replaced with the rotated refresh token. An expired or revoked session returns 401 and clears the cookie.",
+				Tags:        []string{"auth"},
+				Response:    handlers.SessionResponse{},
+			},
+		},
+		{
+			Method:    fiber.MethodPost,
+			Path:      "/auth/logout",
+			Handler:   handlers.Logout(cfg.Session),
+			RateLimit: middleware.ProfileDefault,
+			Cache:     router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Sign out",
+				Description: "Ends the session in Supabase Auth (with the Authorization token, or the refresh token cookie) and clears the cookie. Always returns 204.",
+				Tags:        []string{"auth"},
+			},
+		},
+
+		// WebSocket endpoint for Realtime updates
+		{
+			Method:     fiber.MethodGet,
+			Path:       "/ws",
+			RateLimit:  middleware.ProfileWebSocket, // Reconnect storms are cut off here, apart from /api
+			Middleware: []fiber.Handler{handlers.UpgradeWebSocket(cfg.Auth)},
+			Handler: websocket.New(handlers.WebSocketHandler, websocket.Config{
+				// Clients declare the message schema they support as a subprotocol (app.ws.v2)
+				Subprotocols: handlers.Subprotocols(),
+			}),
+			Docs: docs.Endpoint{
+				Summary: "WebSocket for realtime price updates",
+				Description: "Pushes realtime updates. The message schema is chosen with a subprotocol (app.ws.v2, app.ws.v1, " +
+					"or app.ws.proto for binary realtimepb.Envelope frames) or ?schema=: schema 2 wraps every message in " +
+					"an envelope {type, version, data, ts, id}, where type is price_update, price_delta, broadcast, welcome, " +
+					"error, preferences or notification; schema 1 sends the bare data, e.g. {artist_id, price, event}. " +
+					"Clients send JSON frames {type, topic, ref, payload}: subscribe (optionally throttled with " +
+					"payload {\"throttle\": \"1s\"}) and unsubscribe to receive only matching topics such as prices:*, " +
+					"and ping; the server answers ack, pong or error ({error, message} payload), copying ref.",
+				Tags:      []string{"realtime"},
+				WebSocket: true,
+			},
+		},
+
+		// Profile of the current user (display name, avatar, preferences)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/profile",
+			Handler: handlers.GetProfile,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Current user and their profile",
+				Description: "Users who never saved a profile get an empty one.",
+				Tags:        []string{"user"},
+				Response:    profileBody{},
+			},
+			SLO: &slo.Objective{Latency: 300 * time.Millisecond, LatencyTarget: 0.99, Availability: 0.999},
+		},
+		{
+			Method:  fiber.MethodPut,
+			Path:    "/api/profile",
+			Handler: handlers.UpdateProfile,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Update the current user's profile",
+				Description: "Omitted fields are left unchanged. display_name: up to 50 characters; preferences: a JSON object of up to 4 KB, replaced as a whole. Invalid values return 422 with the field.",
+				Tags:        []string{"user"},
+				ExampleBody: `{"display_name": "Ada", "preferences": {"theme": "dark"}}`,
+				Request:     profile.Update{},
+				Response:    profileBody{},
+			},
+		},
+		{
+			Method:    fiber.MethodPut,
+			Path:      "/api/profile/avatar",
+			Handler:   handlers.UploadAvatar,
+			Auth:      router.AuthUser,
+			RateLimit: middleware.ProfileStrict,
+			Cache:     router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Upload the current user's avatar",
+				Description: "The body is the raw image with its Content-Type: PNG, JPEG, WebP or GIF, up to 2 MB. Returns 503 when storage is not configured.",
+				Tags:        []string{"user"},
+			},
+		},
+
+		// Artist search (pg_trgm in Postgres; popular queries cached)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/search",
+			Handler: handlers.Search,
+			Auth:    router.AuthUser,
+			APIKey:  true,
+			Cache:   router.CachePolicy{MaxAge: 30 * time.Second},
+			Docs: docs.Endpoint{
+				Summary:     "Search artists",
+				Description: "Query parameters: q (required, up to 100 characters), page, limit (max 50). Ranked exact name, then name prefix, then word prefix, then fuzzy (trigram) matches.",
+				Tags:        []string{"search"},
+			},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/search/suggest",
+			Handler: handlers.SearchSuggest,
+			Auth:    router.AuthUser,
+			APIKey:  true,
+			Cache:   router.CachePolicy{MaxAge: 30 * time.Second},
+			Docs: docs.Endpoint{
+				Summary:     "Typeahead suggestions for artist names",
+				Description: "Artists whose name, or a word of it, starts with q; shortest names first. Query parameters: q, limit (default 8, max 20).",
+				Tags:        []string{"search"},
+			},
+		},
+
+		// Typed preferences (stored in the profile, checked against a schema of allowed keys)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/preferences",
+			Handler: handlers.GetPreferences,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:  "Current user's preferences, defaults included",
+				Tags:     []string{"user"},
+				Response: preferencesBody{},
+			},
+		},
+		{
+			Method:  fiber.MethodPut,
+			Path:    "/api/preferences",
+			Handler: handlers.UpdatePreferences,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Change some preferences",
+				Description: "Other keys are kept; null resets a key to its default. Unknown keys and wrongly typed values return 422. The user's WebSocket connections (?token=) receive a \"preferences\" message.",
+				Tags:        []string{"user"},
+				ExampleBody: `{"theme": "dark", "notifications.email": false}`,
+				Request:     map[string]any{},
+				Response:    preferencesBody{},
+			},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/preferences/schema",
+			Handler: handlers.PreferenceSchema,
+			Auth:    router.AuthUser,
+			Docs: docs.Endpoint{
+				Summary: "Allowed preference keys with their type and default",
+				Tags:    []string{"user"},
+			},
+		},
+
+		// Push notification devices of the current user (see internal/push)
+		{
+			Method:  fiber.MethodPost,
+			Path:    "/api/push/devices",
+			Handler: handlers.RegisterDevice,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Register a device for push notifications",
+				Description: "platform: android or web (FCM registration token) or ios (APNs device token). Call on every app start; tokens rotate. Returns 204.",
+				Tags:        []string{"push"},
+				ExampleBody: `{"token": "fcm-registration-token", "platform": "android"}`,
+				Request:     handlers.DeviceRequest{},
+			},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/push/devices",
+			Handler: handlers.ListDevices,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary: "Current user's registered devices",
+				Tags:    []string{"push"},
+			},
+		},
+		{
+			Method:  fiber.MethodDelete,
+			Path:    "/api/push/devices/:token",
+			Handler: handlers.UnregisterDevice,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Unregister a device (e.g. on sign-out)",
+				Description: "Unknown tokens are ignored. Returns 204.",
+				Tags:        []string{"push"},
+			},
+		},
+
+		// Request counts of the current user (see internal/usage)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/usage",
+			Handler: handlers.GetUsage,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Current user's request counts",
+				Description: "Today and this month (live), plus the history of one period. Query parameters: period (day or month), limit (default 30, max 366).",
+				Tags:        []string{"user"},
+			},
+		},
+
+		// Plan of the current user, with its features and quotas (see internal/plan)
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/plan",
+			Handler: handlers.GetPlan,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Current user's plan, features and quota usage",
+				Description: "plan is null when PLANS is not set (nothing is enforced).",
+				Tags:        []string{"user", "billing"},
+			},
+		},
+
+		// Account deletion (GDPR): scheduled after a grace period, cancellable until then.
+		// Exports are assembled in the background and are expensive, hence the strict profile.
+		{
+			Method:    fiber.MethodGet,
+			Path:      "/api/me/export",
+			Handler:   handlers.ExportAccount,
+			Auth:      router.AuthUser,
+			RateLimit: middleware.ProfileStrict,
+			Cache:     router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Export all data held for the current user",
+				Description: "Assembled in the background: poll until status is \"ready\", then fetch download_url. Query: format=zip (default) or json.",
+				Tags:        []string{"user"},
+			},
+		},
+		{
+			Method:  fiber.MethodDelete,
+			Path:    "/api/me",
+			Handler: handlers.DeleteAccount,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Schedule deletion of the current user's account and data",
+				Description: "Data is erased after GDPR_GRACE_PERIOD (default 30 days). A confirmation email is sent.",
+				Tags:        []string{"user"},
+			},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/api/me/deletion",
+			Handler: handlers.GetAccountDeletion,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs:    docs.Endpoint{Summary: "Current account deletion request", Tags: []string{"user"}},
+		},
+		{
+			Method:  fiber.MethodDelete,
+			Path:    "/api/me/deletion",
+			Handler: handlers.CancelAccountDeletion,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs:    docs.Endpoint{Summary: "Cancel a pending account deletion", Tags: []string{"user"}},
+		},
+
+		// Supabase Edge Functions, invoked with the caller's token (see internal/functions)
+		{
+			Method:  router.MethodAll,
+			Path:    "/api/functions/:name",
+			Handler: handlers.InvokeFunction,
+			Auth:    router.AuthUser,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Method:  fiber.MethodPost,
+				Summary: "Invoke a Supabase Edge Function",
+				Description: "Forwards the method, query, body and access token to the function and returns its response as is. " +
+					"404 for functions not listed in FUNCTIONS_ALLOWED (when set), 504 when it takes longer than FUNCTIONS_TIMEOUT.",
+				Tags:        []string{"functions"},
+				ExampleBody: `{"name": "Ada"}`,
+			},
+		},
+
+		// Admin routes (users listed in ADMIN_USER_IDS). Every action is written to the
+		// audit log, which is queryable at /api/admin/audit.
+		adminRoute(fiber.MethodPost, "/api/admin/cache/flush", admin.FlushCache, docs.Endpoint{
+			Summary:     "Delete cache keys",
+			ExampleBody: `{"keys": ["price:123"]}`,
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/cache/epoch", admin.GetCacheEpoch, docs.Endpoint{
+			Summary: "Current cache epoch",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/cache/epoch", admin.BumpCacheEpoch, docs.Endpoint{
+			Summary:     "Invalidate all cached data",
+			Description: "Increments the cache epoch embedded in every key; all instances switch to an empty key space within CACHE_EPOCH_REFRESH.",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/startup", admin.StartupSummary, docs.Endpoint{
+			Summary:     "Startup summary",
+			Description: "Registered routes with their middleware chain and rate limit, and enabled subsystems.",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/broadcast", admin.Broadcast, docs.Endpoint{
+			Summary:     "Send a message to all WebSocket clients",
+			ExampleBody: `{"message": {"type": "announcement", "text": "Maintenance at 22:00 UTC"}}`,
+		}),
+		adminRoute(fiber.MethodPut, "/api/admin/ratelimit/overrides/:key", admin.SetRateLimitOverride, docs.Endpoint{
+			Summary:     "Override the rate limit for a key (user:<id> or IP)",
+			ExampleBody: `{"max": 1000}`,
+		}),
+		adminRoute(fiber.MethodDelete, "/api/admin/ratelimit/overrides/:key", admin.RemoveRateLimitOverride, docs.Endpoint{
+			Summary: "Remove a rate limit override",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/abuse/rules", admin.GetAbuseRules, docs.Endpoint{
+			Summary: "Abuse rules, in evaluation order",
+		}),
+		adminRoute(fiber.MethodPut, "/api/admin/abuse/rules", admin.SetAbuseRules, docs.Endpoint{
+			Summary:     "Replace the abuse rules",
+			Description: "Rules match paths (globs), User-Agents (regular expressions) and methods, optionally over a rate, and tag, throttle or block the client. Every instance applies them within ABUSE_RULES_REFRESH.",
+			ExampleBody: `{"rules": [{"id": "scanners", "user_agents": ["sqlmap", "nikto"], "action": "block", "ban_for": "24h"}]}`,
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/abuse/decisions", admin.ListAbuseDecisions, docs.Endpoint{
+			Summary:     "Recent abuse rule decisions and banned clients",
+			Description: "Decisions of this instance, newest first; bans are shared by every instance.",
+		}),
+		adminRoute(fiber.MethodDelete, "/api/admin/abuse/bans/:ip", admin.RemoveAbuseBan, docs.Endpoint{
+			Summary: "Lift a client's ban",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/jobs", admin.ListJobs, docs.Endpoint{
+			Summary:     "Background job counts, and the jobs in one state",
+			Description: "state is queued, running or dead (the default: jobs that failed their last attempt, with their last error); limit defaults to 50.",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/jobs/:id/retry", admin.RetryJob, docs.Endpoint{
+			Summary: "Queue a dead job again, with its attempts reset",
+		}),
+		adminRoute(fiber.MethodDelete, "/api/admin/jobs/:id", admin.DiscardJob, docs.Endpoint{
+			Summary: "Delete a dead job",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/scheduler", admin.ListScheduledTasks, docs.Endpoint{
+			Summary:     "Scheduled tasks, their next runs and their last runs on this instance",
+			Description: "Each task's schedule (after SCHEDULER_<TASK>), whether it is enabled or running, and the time, duration, result and error of its last run here.",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/debug/runtime", admin.RuntimeStatus, docs.Endpoint{
+			Summary:     "Goroutines, leaked goroutines and channel buffers of this instance",
+			Description: "Tracked goroutine counts against their expected bounds, and the length and capacity of the WebSocket hub's broadcast queue and the job workers' slots. stacks=true adds the goroutine profile.",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/realtime/restart", admin.RestartRealtime, docs.Endpoint{
+			Summary:     "Reconnect the Supabase Realtime subscriber",
+			Description: "Drops the connection, or ends the wait before the next reconnect, also after the subscriber gave up (REALTIME_MAX_RECONNECTS).",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/services", admin.ListServices, docs.Endpoint{
+			Summary:     "Subsystems of this instance",
+			Description: "Every subsystem in start order, with the subsystems it depends on, whether it is running, and whether POST /api/admin/restart/{service} can restart it (cache, jobs, scheduler and realtime).",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/restart/:service", admin.RestartService, docs.Endpoint{
+			Summary:     "Restart a subsystem of this instance",
+			Description: "Stops the service and the services depending on it (the job workers, scheduler and Realtime subscriber depend on the cache), reads the .env files and environment again, and starts them. 404 for an unknown service, 409 for one that can only start with the process; a service failing to start stays stopped until the next restart.",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/drain", admin.StartDraining, docs.Endpoint{
+			Summary:     "Start draining this instance",
+			Description: "GET /readyz fails until DELETE /api/admin/drain, so load balancers stop sending new traffic; /healthz stays 200.",
+		}),
+		adminRoute(fiber.MethodDelete, "/api/admin/drain", admin.StopDraining, docs.Endpoint{
+			Summary: "Stop draining this instance",
+		}),
+		adminRoute(fiber.MethodPost, "/api/admin/users/:id/deletion", admin.ScheduleUserDeletion, docs.Endpoint{
+			Summary:     "Schedule deletion of a user's account",
+			Description: "With immediate=true the grace period is skipped and the data is erased on the next worker run.",
+			ExampleBody: `{"immediate": false}`,
+		}),
+		adminRoute(fiber.MethodDelete, "/api/admin/users/:id/deletion", admin.CancelUserDeletion, docs.Endpoint{
+			Summary: "Cancel a user's pending account deletion",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/audit", admin.ListAudit, docs.Endpoint{
+			Summary:     "Audit log of admin actions",
+			Description: "Newest first. Query parameters: page, limit (max 200), actor, action; format=json downloads every matching record.",
+		}),
+		signed(adminRoute(fiber.MethodGet, "/api/admin/usage", admin.ListUsage, docs.Endpoint{
+			Summary: "Request counts per user (usage report, billing export)",
+			Description: "Newest period first. Query parameters: period (day or month), subject, tenant, from, to (YYYY-MM-DD), " +
+				"page, limit (max 200); format=csv or format=json downloads every matching row.",
+		})),
+		adminRoute(fiber.MethodGet, "/api/admin/slo", admin.SLOStatus, docs.Endpoint{
+			Summary:     "SLO compliance per route",
+			Description: "Request, error and slow counts with compliance over the 5m and 1h windows.",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/captures", admin.ListCaptures, docs.Endpoint{
+			Summary:     "Recorded request/response pairs, newest first",
+			Description: "Requests are recorded at CAPTURE_SAMPLE_RATE, or when X-Debug-Capture carries CAPTURE_DEBUG_TOKEN.",
+		}),
+		adminRoute(fiber.MethodGet, "/api/admin/captures/:id", admin.GetCapture, docs.Endpoint{
+			Summary: "One recorded request/response pair",
+		}),
+	}
+}
+
+// devRoutes declares the routes served only in development (GO_ENV=development): template
+// previews, for working on emails and pages without sending them.
+func devRoutes(cfg *config.Config) []router.Route {
+	if cfg.Env != config.Development {
+		return nil
+	}
+	return []router.Route{
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/dev/templates",
+			Handler: handlers.TemplatePreviews,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary:     "Template previews (development only)",
+				Description: "An HTML page listing every email, export and page template, with links to their previews.",
+				Tags:        []string{"dev"},
+			},
+		},
+		{
+			Method:  fiber.MethodGet,
+			Path:    "/dev/templates/:dir/:file",
+			Handler: handlers.PreviewTemplate,
+			Cache:   router.NoStore,
+			Docs: docs.Endpoint{
+				Summary: "Preview a template (development only)",
+				Description: "Renders a template (e.g. emails/digest.html) with its sample data, in the locale from ?locale= or " +
+					"Accept-Language. Emails return their subject in X-Email-Subject.",
+				Tags: []string{"dev"},
+			},
+		},
+	}
+}
+
+// frontendRoutes serves the frontend build (FRONTEND_DIR or embedded, see internal/frontend) at /
+// with a fallback to index.html for client-side routes, or the demo page at / without one.
+func frontendRoutes() []router.Route {
+	site := frontend.Get()
+	if site == nil {
+		return []router.Route{{
+			Method:  fiber.MethodGet,
+			Path:    "/",
+			Handler: handlers.DemoPage,
+			Docs:    docs.Endpoint{Summary: "Interactive demo page (alias of /demo)", Tags: []string{"docs"}},
+		}}
+	}
+
+	return []router.Route{{
+		Method:     fiber.MethodGet,
+		Path:       "/*",
+		Middleware: []fiber.Handler{compress.New()},
+		Handler:    site.Handler(),
+		Docs: docs.Endpoint{
+			Summary:     "Frontend app",
+			Description: "Files of the frontend build; other non-API paths return index.html for client-side routing.",
+			Tags:        []string{"frontend"},
+		},
+	}}
+}
+
+// resourceRoutes declares the CRUD endpoints of every resource (see internal/resource).
+// Owned resources (watchlist, alerts) live under /api/<name> and act on the caller's rows.
+// Shared ones (artists) are readable by every user at /api/<name>; writes and the trash are under
+// /api/admin/<name>. DELETE is a soft delete, undone with POST .../:id/restore.
+func resourceRoutes() []router.Route {
+	var table []router.Route
+	for _, r := range resource.All() {
+		h := handlers.NewResourceHandlers(r)
+		userPath, writePath := "/api/"+r.Name, "/api/"+r.Name
+		if !r.Owned {
+			writePath = "/api/admin/" + r.Name
+		}
+		route := func(method, path string, handler fiber.Handler, write bool, endpoint docs.Endpoint) router.Route {
+			endpoint.Tags = []string{r.Name}
+			if write && !r.Owned {
+				return adminRoute(method, path, handler, endpoint)
+			}
+			// Reads also take API keys, for machine clients syncing data
+			return router.Route{Method: method, Path: path, Handler: handler, Auth: router.AuthUser, APIKey: !write, Cache: router.NoStore, Docs: endpoint}
+		}
+
+		table = append(table,
+			route(fiber.MethodGet, userPath, h.List, false, docs.Endpoint{
+				Summary:     "List " + r.Name,
+				Description: "Newest first. Query parameters: page, limit (max 200)" + ownedTrash(r) + ".",
+			}),
+			route(fiber.MethodGet, userPath+"/:id", h.Get, false, docs.Endpoint{Summary: "Get one of " + r.Name}),
+			route(fiber.MethodPost, writePath, h.Create, true, docs.Endpoint{
+				Summary:     "Create one of " + r.Name,
+				Description: "Fields: " + fieldList(r) + ".",
+				ExampleBody: exampleBody(r),
+				Request:     resourceSchema(r, true),
+			}),
+			route(fiber.MethodPut, writePath+"/:id", h.Update, true, docs.Endpoint{
+				Summary:     "Update one of " + r.Name,
+				Description: "Only the fields in the body change; null clears an optional field.",
+				ExampleBody: exampleBody(r),
+				Request:     resourceSchema(r, false),
+			}),
+			route(fiber.MethodDelete, writePath+"/:id", h.Delete, true, docs.Endpoint{
+				Summary:     "Delete one of " + r.Name,
+				Description: "Soft delete: restorable until purged (RESOURCE_RETENTION, default 30 days).",
+			}),
+			route(fiber.MethodPost, writePath+"/:id/restore", h.Restore, true, docs.Endpoint{
+				Summary: "Restore one of " + r.Name + " from the trash",
+			}),
+		)
+		if r.Owned {
+			bulk := route(fiber.MethodPost, userPath+"/bulk", h.Bulk, true, docs.Endpoint{
+				Summary: "Create, update, delete or restore several " + r.Name + " at once",
+				Description: "Up to 100 operations; each result has its own status. \"atomic\": true writes all " +
+					"or none. 200 if every operation succeeded, 207 otherwise.",
+				ExampleBody: `{"atomic": false, "operations": [{"op": "create", "fields": ` + exampleBody(r) + `}]}`,
+			})
+			bulk.RateLimit = middleware.ProfileStrict
+			table = append(table, bulk)
+		}
+		if !r.Owned {
+			table = append(table, route(fiber.MethodGet, writePath, h.List, true, docs.Endpoint{
+				Summary:     "List " + r.Name + " (admin)",
+				Description: "Query parameters: page, limit (max 200), deleted=true for the trash.",
+			}))
+		}
+	}
+	return table
+}
+
+// ownedTrash documents ?deleted=true on the user list, which only owned resources offer.
+func ownedTrash(r *resource.Resource) string {
+	if !r.Owned {
+		return ""
+	}
+	return ", deleted=true for the trash"
+}
+
+// fieldList describes a resource's writable fields for the docs, e.g. "artist_id (string, required)".
+func fieldList(r *resource.Resource) string {
+	parts := make([]string, 0, len(r.Fields))
+	for _, field := range r.Fields {
+		kind := string(field.Kind)
+		if len(field.Allowed) > 0 {
+			kind = strings.Join(field.Allowed, "|")
+		}
+		if field.Required {
+			kind += ", required"
+		}
+		parts = append(parts, field.Name+" ("+kind+")")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// exampleBody prefills the try-it console with a value for every field.
+func exampleBody(r *resource.Resource) string {
+	example := make(map[string]interface{}, len(r.Fields))
+	for _, field := range r.Fields {
+		switch {
+		case len(field.Allowed) > 0:
+			example[field.Name] = field.Allowed[0]
+		case field.Kind == resource.KindBoolean:
+			example[field.Name] = true
+		case field.Kind == resource.KindNumber:
+			example[field.Name] = 1
+		case field.Kind == resource.KindDecimal:
+			example[field.Name] = "10.00"
+		default:
+			example[field.Name] = "example"
+		}
+	}
+	encoded, _ := json.Marshal(example)
+	return string(encoded)
+}
+
+// adminRoute declares an admin endpoint: admins only, never cached, tagged "admin" in the docs.
+func adminRoute(method, path string, handler fiber.Handler, endpoint docs.Endpoint) router.Route {
+	endpoint.Tags = []string{"admin"}
+	return router.Route{
+		Method:  method,
+		Path:    path,
+		Handler: handler,
+		Auth:    router.AuthAdmin,
+		Cache:   router.NoStore,
+		Docs:    endpoint,
+	}
+}
+
+// signed adds signature headers (Webhook-Id, Webhook-Timestamp, Webhook-Signature) to a route's
+// successful responses when SIGNING_SECRETS is set, for exports consumed by other systems.
+func signed(route router.Route) router.Route {
+	route.Middleware = append(route.Middleware, signature.Middleware())
+	return route
+}
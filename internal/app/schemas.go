@@ -0,0 +1,57 @@
+package app
+
+import (
+	"boilerplate/internal/docs"
+	"boilerplate/internal/health"
+	"boilerplate/internal/profile"
+	"boilerplate/internal/resource"
+)
+
+// Response bodies of handlers answering with fiber.Map, declared for the OpenAPI document
+// (docs.Endpoint.Response). Keep them in step with the handlers.
+
+// readinessBody is the body of GET /readyz.
+type readinessBody struct {
+	Status string                   `json:"status"`           // ready, unready or draining
+	Failed []string                 `json:"failed,omitempty"` // Required checks that failed
+	Checks map[string]health.Result `json:"checks"`
+}
+
+// profileBody is the body of GET and PUT /api/profile (API version 2).
+type profileBody struct {
+	User struct {
+		ID       string `json:"id"`
+		TenantID string `json:"tenant_id,omitempty"`
+	} `json:"user"`
+	Profile profile.Profile `json:"profile"`
+}
+
+// preferencesBody is the body of GET and PUT /api/preferences.
+type preferencesBody struct {
+	Preferences map[string]any `json:"preferences"`
+}
+
+// resourceSchema describes the writable fields of r: the body of create (with the required
+// fields) and of update (every field optional).
+func resourceSchema(r *resource.Resource, create bool) *docs.Schema {
+	schema := &docs.Schema{Type: "object", Properties: make(map[string]*docs.Schema, len(r.Fields))}
+	for _, field := range r.Fields {
+		property := &docs.Schema{Type: string(field.Kind), Enum: field.Allowed, MaxLength: field.MaxLength}
+		switch field.Kind {
+		case resource.KindDecimal:
+			property.Type, property.Format = "string", "decimal" // e.g. "45.67"
+		case resource.KindString:
+			if property.MaxLength == 0 && len(field.Allowed) == 0 {
+				property.MaxLength = resource.DefaultMaxLength
+			}
+		}
+		if !field.Required {
+			property.Nullable = true // null clears an optional field
+		}
+		schema.Properties[field.Name] = property
+		if field.Required && create {
+			schema.Required = append(schema.Required, field.Name)
+		}
+	}
+	return schema
+}
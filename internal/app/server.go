@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// Server serves the app. fasthttp, which Fiber runs on, only speaks HTTP/1.1: with HTTP2=tls or
+// h2c, a net/http server accepts the connections instead (HTTP/2 and HTTP/1.1) and forwards each
+// request to the app over an in-memory listener. Responses are streamed back as the app writes
+// them (text/event-stream is flushed on every write), and WebSocket upgrades, which browsers make
+// over HTTP/1.1, are passed through.
+type Server struct {
+	app   *fiber.App
+	cfg   config.Server
+	front *http.Server                   // nil when HTTP/2 is off
+	inner *fasthttputil.InmemoryListener // The app's listener behind front
+}
+
+// clientAddrKey is the context key of the client's address, given to the app's connection.
+type clientAddrKey struct{}
+
+// NewServer returns the server of app, configured from cfg (HTTP2, TLS_CERT_FILE, TLS_KEY_FILE).
+func NewServer(app *fiber.App, cfg config.Server) *Server {
+	s := &Server{app: app, cfg: cfg}
+	if !cfg.HTTP2Enabled() {
+		startup.Report("http2", false, "HTTP/1.1 only")
+		return s
+	}
+
+	s.inner = fasthttputil.NewInmemoryListener()
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	if cfg.HTTP2 == config.HTTP2TLS {
+		protocols.SetHTTP2(true)
+		startup.Report("http2", true, "over TLS, with HTTP/1.1")
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+		startup.Report("http2", true, "h2c (prior knowledge), with HTTP/1.1")
+	}
+	s.front = &http.Server{
+		Handler:           newAppProxy(s.inner),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Listen serves on addr until Shutdown.
+func (s *Server) Listen(addr string) error {
+	if s.front == nil {
+		return s.app.Listen(addr)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves on ln until Shutdown.
+func (s *Server) Serve(ln net.Listener) error {
+	if s.front == nil {
+		return s.app.Listener(ln)
+	}
+
+	useTLS := s.cfg.HTTP2 == config.HTTP2TLS
+	if useTLS {
+		// Loaded before serving, so a bad certificate stops the server at once
+		certificate, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		s.front.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	}
+
+	go func() {
+		if err := s.app.Listener(s.inner); err != nil {
+			log.Printf("ERROR: App listener stopped: %v", err)
+		}
+	}()
+
+	var err error
+	if useTLS {
+		err = s.front.ServeTLS(ln, "", "") // ALPN offers h2 and http/1.1
+	} else {
+		err = s.front.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits up to timeout for in-flight requests.
+func (s *Server) Shutdown(timeout time.Duration) error {
+	if s.front == nil {
+		return s.app.ShutdownWithTimeout(timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	frontErr := s.front.Shutdown(ctx)
+	return errors.Join(frontErr, s.app.ShutdownWithContext(ctx))
+}
+
+// newAppProxy returns the handler forwarding requests to the app listening on inner. Each
+// request gets its own connection, dialed from the client's address, so c.IP() and the rate
+// limits see the client rather than the proxy. Host and X-Forwarded-For are passed as sent.
+func newAppProxy(inner *fasthttputil.InmemoryListener) http.Handler {
+	target := &url.URL{Scheme: "http", Host: "app"}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.Host = pr.In.Host
+			if pr.In.TLS != nil {
+				pr.Out.Header.Set(fiber.HeaderXForwardedProto, "https") // So c.Protocol() is https
+			}
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				local, _ := ctx.Value(clientAddrKey{}).(net.Addr)
+				return inner.DialWithLocalAddr(local)
+			},
+			DisableKeepAlives:  true, // A connection carries one client's address
+			DisableCompression: true,
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), clientAddrKey{}, net.TCPAddrFromAddrPort(addrPort)))
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	fiberws "github.com/gofiber/websocket/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveH2C serves app with HTTP2=h2c on a random local port and returns its address.
+func serveH2C(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	server := NewServer(app, config.Server{HTTP2: config.HTTP2Cleartext})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Shutdown(time.Second) })
+	return ln.Addr().String()
+}
+
+// h2cClient returns a client speaking cleartext HTTP/2 with prior knowledge.
+func h2cClient() *http.Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+}
+
+// TestServer_H2C tests that HTTP/2 requests reach the app with the client's address and Host,
+// and that HTTP/1.1 clients are still served.
+func TestServer_H2C(t *testing.T) {
+	app := fiber.New()
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(c.IP() + " " + c.Hostname())
+	})
+	addr := serveH2C(t, app)
+
+	resp, err := h2cClient().Get("http://" + addr + "/whoami")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	body, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Equal(t, "127.0.0.1 "+addr, body)
+
+	resp, err = http.Get("http://" + addr + "/whoami")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestServer_H2CStreaming tests that event streams reach HTTP/2 clients as they are written,
+// not when the response ends.
+func TestServer_H2CStreaming(t *testing.T) {
+	release := make(chan struct{})
+	app := fiber.New()
+	app.Get("/events", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			w.WriteString("data: first\n\n")
+			w.Flush()
+			<-release
+			w.WriteString("data: second\n\n")
+			w.Flush()
+		})
+		return nil
+	})
+	addr := serveH2C(t, app)
+
+	resp, err := h2cClient().Get("http://" + addr + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+
+	close(release)
+	reader.ReadString('\n')
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: second\n", line)
+}
+
+// TestServer_WebSocket tests that WebSocket upgrades are passed through to the app.
+func TestServer_WebSocket(t *testing.T) {
+	app := fiber.New()
+	app.Get("/ws", fiberws.New(func(conn *fiberws.Conn) {
+		messageType, message, err := conn.ReadMessage()
+		if err == nil {
+			conn.WriteMessage(messageType, append([]byte("echo: "), message...))
+		}
+	}))
+	addr := serveH2C(t, app)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello", string(message))
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key, and returns their
+// paths.
+func writeCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// TestServer_TLS tests that HTTP2=tls negotiates HTTP/2 and tells the app the request was HTTPS.
+func TestServer_TLS(t *testing.T) {
+	app := fiber.New()
+	app.Get("/protocol", func(c *fiber.Ctx) error {
+		return c.SendString(c.Protocol())
+	})
+	certFile, keyFile := writeCertificate(t)
+	server := NewServer(app, config.Server{HTTP2: config.HTTP2TLS, TLSCertFile: certFile, TLSKeyFile: keyFile})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Shutdown(time.Second) })
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/protocol")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	body, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Equal(t, "https", body)
+}
+
+// TestServer_TLSRequiresCertificate tests that HTTP2=tls fails to serve without a certificate
+// instead of falling back to cleartext.
+func TestServer_TLSRequiresCertificate(t *testing.T) {
+	server := NewServer(fiber.New(), config.Server{HTTP2: config.HTTP2TLS, TLSCertFile: "missing.pem", TLSKeyFile: "missing.pem"})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	err = server.Serve(ln)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing.pem")
+}
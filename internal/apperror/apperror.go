@@ -0,0 +1,207 @@
+package apperror
+
+// Package apperror gives errors an HTTP status, a stable machine-readable code and a message that
+// is safe to show to clients, and writes them as RFC 7807 problem details
+// (application/problem+json):
+//
+//	{
+//	  "type": "about:blank",
+//	  "title": "Too Many Requests",
+//	  "status": 429,
+//	  "detail": "Rate limit exceeded",
+//	  "instance": "/api/profile",
+//	  "code": "rate_limited",
+//	  "request_id": "0f9c...",
+//	  "error": "Rate limit exceeded"
+//	}
+//
+// "error" repeats detail for clients written against the earlier {"error": ...} bodies. With
+// PROBLEM_TYPE_BASE_URL set, type is that URL followed by the code (e.g.
+// https://docs.example.com/problems/rate_limited), for pages documenting each problem.
+//
+// Handlers return an *Error (or any error) and the app's error handler (Handler) writes it;
+// middleware that answers without returning an error calls Write. Wrapped causes are logged,
+// never sent: errors that aren't an *Error become a 500 with a generic message.
+//
+//	if user == nil {
+//		return apperror.NotFound("User not found")
+//	}
+//	if err != nil {
+//		return apperror.Unavailable("Failed to load user", err)
+//	}
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Codes, by the status they usually go with.
+const (
+	CodeBadRequest       = "bad_request"        // 400
+	CodeUnauthorized     = "unauthorized"       // 401
+	CodePaymentRequired  = "payment_required"   // 402: the plan doesn't include a feature
+	CodeForbidden        = "forbidden"          // 403
+	CodeNotFound         = "not_found"          // 404
+	CodeMethodNotAllowed = "method_not_allowed" // 405
+	CodeConflict         = "conflict"           // 409
+	CodeTooLarge         = "payload_too_large"  // 413
+	CodeValidation       = "validation_failed"  // 422
+	CodeRateLimited      = "rate_limited"       // 429: rate limiter
+	CodeQuotaExceeded    = "quota_exceeded"     // 429: plan quota
+	CodeInternal         = "internal_error"     // 500
+	CodeBadGateway       = "bad_gateway"        // 502: an upstream (Supabase, edge function) failed
+	CodeUnavailable      = "unavailable"        // 503: a dependency is down or not configured
+	CodeTimeout          = "timeout"            // 504: an upstream didn't answer in time
+)
+
+// internalMessage is the detail of errors that aren't an *Error.
+const internalMessage = "Internal server error"
+
+// Error is an error with its response.
+type Error struct {
+	Status  int            // HTTP status
+	Code    string         // Machine-readable, e.g. rate_limited
+	Message string         // Safe to show to clients (the problem's detail)
+	Fields  map[string]any // Extension members, e.g. {"field": "name"}
+	Err     error          // The cause, logged but never sent
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// With returns a copy of e with an extension member added to its problem.
+func (e *Error) With(key string, value any) *Error {
+	copied := *e
+	copied.Fields = make(map[string]any, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		copied.Fields[k] = v
+	}
+	copied.Fields[key] = value
+	return &copied
+}
+
+// New returns an error answered with status, code and message.
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap returns an error answered with status, code and message, logging err as its cause.
+func Wrap(err error, status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message, Err: err}
+}
+
+// BadRequest is a 400: the request is malformed.
+func BadRequest(message string) *Error {
+	return New(fiber.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Unauthorized is a 401: credentials are missing or invalid.
+func Unauthorized(message string) *Error {
+	return New(fiber.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is a 403: the caller may not do this.
+func Forbidden(message string) *Error {
+	return New(fiber.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is a 404.
+func NotFound(message string) *Error {
+	return New(fiber.StatusNotFound, CodeNotFound, message)
+}
+
+// Validation is a 422 about one field of the body: "<field> <message>", with the field as an
+// extension member.
+func Validation(field, message string) *Error {
+	return New(fiber.StatusUnprocessableEntity, CodeValidation, field+" "+message).With("field", field)
+}
+
+// RateLimited is a 429 from a rate limiter.
+func RateLimited(message string) *Error {
+	return New(fiber.StatusTooManyRequests, CodeRateLimited, message)
+}
+
+// Internal is a 500 with a generic message, logging err.
+func Internal(err error) *Error {
+	return Wrap(err, fiber.StatusInternalServerError, CodeInternal, internalMessage)
+}
+
+// BadGateway is a 502: an upstream failed. err is logged.
+func BadGateway(message string, err error) *Error {
+	return Wrap(err, fiber.StatusBadGateway, CodeBadGateway, message)
+}
+
+// Unavailable is a 503: a dependency is down or not configured. err (may be nil) is logged.
+func Unavailable(message string, err error) *Error {
+	return Wrap(err, fiber.StatusServiceUnavailable, CodeUnavailable, message)
+}
+
+// Timeout is a 504: an upstream didn't answer in time. err is logged.
+func Timeout(message string, err error) *Error {
+	return Wrap(err, fiber.StatusGatewayTimeout, CodeTimeout, message)
+}
+
+// From returns err as an *Error: itself (or the *Error it wraps), Fiber's errors with their
+// status (e.g. 404 for unknown routes, 413 for oversized bodies), or a 500 for anything else.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		message := fiberErr.Message
+		if fiberErr.Code >= fiber.StatusInternalServerError {
+			message = http.StatusText(fiberErr.Code)
+		}
+		return Wrap(err, fiberErr.Code, CodeFor(fiberErr.Code), message)
+	}
+	return Internal(err)
+}
+
+// CodeFor returns the usual code of an HTTP status.
+func CodeFor(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeBadRequest
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusPaymentRequired:
+		return CodePaymentRequired
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case fiber.StatusUnprocessableEntity:
+		return CodeValidation
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	case fiber.StatusBadGateway:
+		return CodeBadGateway
+	case fiber.StatusServiceUnavailable:
+		return CodeUnavailable
+	case fiber.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return fmt.Sprintf("http_%d", status)
+}
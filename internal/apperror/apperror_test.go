@@ -0,0 +1,83 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// problemOf serves err from a handler through Handler and returns the response and its body.
+func problemOf(t *testing.T, err error) (int, string, map[string]any) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: Handler})
+	app.Get("/things/:id", func(c *fiber.Ctx) error { return err })
+
+	resp, reqErr := app.Test(httptest.NewRequest("GET", "/things/1", nil))
+	require.NoError(t, reqErr)
+	raw, readErr := io.ReadAll(resp.Body)
+	require.NoError(t, readErr)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(raw, &body))
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderContentType), body
+}
+
+// TestHandler tests the problem written for an *Error with extension members.
+func TestHandler(t *testing.T) {
+	status, contentType, body := problemOf(t, Validation("name", "is required").With("type", "ignored"))
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Equal(t, ContentType, contentType)
+	assert.Equal(t, map[string]any{
+		"type":     "about:blank", // Extensions don't replace standard members
+		"title":    "Unprocessable Entity",
+		"status":   float64(422),
+		"detail":   "name is required",
+		"instance": "/things/1",
+		"code":     CodeValidation,
+		"error":    "name is required",
+		"field":    "name",
+	}, body)
+}
+
+// TestHandler_Type tests problem types under PROBLEM_TYPE_BASE_URL.
+func TestHandler_Type(t *testing.T) {
+	t.Setenv("PROBLEM_TYPE_BASE_URL", "https://docs.example.com/problems/")
+
+	_, _, body := problemOf(t, RateLimited("Rate limit exceeded"))
+	assert.Equal(t, "https://docs.example.com/problems/rate_limited", body["type"])
+}
+
+// TestFrom tests that causes are never sent: plain errors become a generic 500, Fiber's errors
+// keep their status.
+func TestFrom(t *testing.T) {
+	status, _, body := problemOf(t, errors.New("pq: password authentication failed"))
+	assert.Equal(t, fiber.StatusInternalServerError, status)
+	assert.Equal(t, "Internal server error", body["detail"])
+	assert.Equal(t, CodeInternal, body["code"])
+
+	status, _, body = problemOf(t, Unavailable("Failed to load user", errors.New("dial tcp: refused")))
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.Equal(t, "Failed to load user", body["detail"])
+
+	status, _, body = problemOf(t, fiber.NewError(fiber.StatusRequestEntityTooLarge, "Request Entity Too Large"))
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, CodeTooLarge, body["code"])
+
+	wrapped := From(errors.Join(errors.New("context"), NotFound("User not found")))
+	assert.Equal(t, fiber.StatusNotFound, wrapped.Status)
+}
+
+// TestWith tests that With doesn't modify the original error.
+func TestWith(t *testing.T) {
+	base := Forbidden("Missing scope")
+	extended := base.With("scope", "read:prices")
+
+	assert.Nil(t, base.Fields)
+	assert.Equal(t, map[string]any{"scope": "read:prices"}, extended.Fields)
+}
@@ -0,0 +1,97 @@
+package apperror
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"boilerplate/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ContentType is the media type of problem details (RFC 7807).
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type"`     // PROBLEM_TYPE_BASE_URL + code, or about:blank
+	Title    string `json:"title"`    // The status text, e.g. Too Many Requests
+	Status   int    `json:"status"`   // The HTTP status
+	Detail   string `json:"detail"`   // The safe message
+	Instance string `json:"instance"` // The request path
+
+	Code      string         `json:"code"`                 // e.g. rate_limited
+	RequestID string         `json:"request_id,omitempty"` // X-Request-ID, to quote in support requests
+	Error     string         `json:"error"`                // Same as detail, for clients of the earlier bodies
+	Fields    map[string]any `json:"-"`                    // Extension members, encoded at the top level
+}
+
+// MarshalJSON encodes the problem with its extension members at the top level. Extensions don't
+// replace the standard members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	encoded, err := json.Marshal(plain(p))
+	if err != nil || len(p.Fields) == 0 {
+		return encoded, err
+	}
+	members := make(map[string]any, len(p.Fields)+8)
+	for key, value := range p.Fields {
+		members[key] = value
+	}
+	var standard map[string]any
+	if err := json.Unmarshal(encoded, &standard); err != nil {
+		return nil, err
+	}
+	for key, value := range standard {
+		members[key] = value
+	}
+	return json.Marshal(members)
+}
+
+// ProblemFor returns the problem describing err for the request.
+func ProblemFor(c *fiber.Ctx, err error) Problem {
+	e := From(err)
+	return Problem{
+		Type:      typeOf(e.Code),
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  c.Path(),
+		Code:      e.Code,
+		RequestID: logging.GetRequestID(c),
+		Error:     e.Message,
+		Fields:    e.Fields,
+	}
+}
+
+// Write responds with the problem describing err, logging the cause of server errors.
+func Write(c *fiber.Ctx, err error) error {
+	e := From(err)
+	if e.Status >= fiber.StatusInternalServerError && e.Err != nil {
+		logging.FromRequest(c).Error(e.Message, "error", e.Err)
+	}
+	body, marshalErr := json.Marshal(ProblemFor(c, e))
+	if marshalErr != nil {
+		return marshalErr
+	}
+	c.Status(e.Status)
+	c.Set(fiber.HeaderContentType, ContentType)
+	return c.Send(body)
+}
+
+// Handler is the app's error handler (fiber.Config.ErrorHandler): errors returned by handlers and
+// middleware are answered with their problem.
+func Handler(c *fiber.Ctx, err error) error {
+	return Write(c, err)
+}
+
+// typeOf returns the problem type URI of a code.
+func typeOf(code string) string {
+	base := os.Getenv("PROBLEM_TYPE_BASE_URL")
+	if base == "" {
+		return "about:blank"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + code
+}
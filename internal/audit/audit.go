@@ -0,0 +1,129 @@
+package audit
+
+// Package audit records an append-only trail of admin actions (who did what, to what,
+// and the state before and after). Records are written to the audit_log table in Supabase
+// Postgres; see schema.sql for the table definition, which rejects updates and deletes.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"boilerplate/internal/startup"
+)
+
+// Record is a single audit entry.
+type Record struct {
+	ID        int64           `json:"id,omitempty"`     // Assigned by the database
+	Actor     string          `json:"actor"`            // User ID of the admin
+	Action    string          `json:"action"`           // e.g. "cache.flush"
+	Target    string          `json:"target"`           // What the action applied to
+	Before    json.RawMessage `json:"before,omitempty"` // State before the action (JSON)
+	After     json.RawMessage `json:"after,omitempty"`  // State after the action (JSON)
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Query filters and paginates audit records. Results are newest first.
+type Query struct {
+	Actor  string // Optional exact match
+	Action string // Optional exact match
+	MaxID  int64  // Optional: only records up to this ID, so new records don't shift the pages of an export
+	Limit  int
+	Offset int
+}
+
+// Store persists audit records. There is deliberately no update or delete method.
+type Store interface {
+	// Append writes a new record.
+	Append(ctx context.Context, record Record) error
+
+	// List returns records matching the query, newest first.
+	List(ctx context.Context, query Query) ([]Record, error)
+}
+
+// Pseudonymizer is implemented by stores that can replace a user ID in existing records.
+// It exists for GDPR erasure and is the only change the append-only table permits.
+type Pseudonymizer interface {
+	// Pseudonymize replaces userID with alias in the actor and target of every record.
+	// Returns the number of records changed.
+	Pseudonymize(ctx context.Context, userID, alias string) (int, error)
+}
+
+// DefaultStore is the audit store used by Log. It is nil until Init() or SetDefault() is called.
+var DefaultStore Store
+
+// Init initializes the default audit store.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, records go to Postgres through the
+// Supabase REST API. Otherwise an in-memory store is used, which is lost on restart.
+func Init() {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+
+	if supabaseURL == "" || serviceKey == "" {
+		log.Println("WARNING: SUPABASE_SERVICE_ROLE_KEY not set, audit records are kept in memory only")
+		startup.Report("audit", true, "in memory only (SUPABASE_SERVICE_ROLE_KEY not set)")
+		DefaultStore = NewMemoryStore()
+		return
+	}
+
+	DefaultStore = NewPostgRESTStore(supabaseURL, serviceKey)
+	log.Println("Audit log initialized (Supabase Postgres)")
+	startup.Report("audit", true, "Supabase Postgres")
+}
+
+// SetDefault replaces the default audit store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// Log writes an audit record to the default store.
+// before and after are encoded as JSON; pass nil when there is no state to record.
+func Log(ctx context.Context, actor, action, target string, before, after interface{}) error {
+	if DefaultStore == nil {
+		return fmt.Errorf("audit store not initialized")
+	}
+
+	record := Record{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var err error
+	if record.Before, err = encodeState(before); err != nil {
+		return fmt.Errorf("failed to encode before state: %w", err)
+	}
+	if record.After, err = encodeState(after); err != nil {
+		return fmt.Errorf("failed to encode after state: %w", err)
+	}
+
+	if err := DefaultStore.Append(ctx, record); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Pseudonymize replaces userID with alias in the default store's records.
+func Pseudonymize(ctx context.Context, userID, alias string) (int, error) {
+	pseudonymizer, ok := DefaultStore.(Pseudonymizer)
+	if !ok {
+		return 0, fmt.Errorf("audit store does not support pseudonymization")
+	}
+	return pseudonymizer.Pseudonymize(ctx, userID, alias)
+}
+
+// encodeState marshals a before/after value. nil stays nil so the column is NULL.
+func encodeState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	if raw, ok := state.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(state)
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLog_WritesToDefaultStore tests that Log encodes before/after state and appends a record.
+func TestLog_WritesToDefaultStore(t *testing.T) {
+	original := DefaultStore
+	defer SetDefault(original)
+
+	store := NewMemoryStore()
+	SetDefault(store)
+
+	require.NoError(t, Log(context.Background(), "admin-1", "ratelimit.override.set", "user:42",
+		map[string]int{"max": 100}, nil))
+
+	records, err := store.List(context.Background(), Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(1), records[0].ID)
+	assert.Equal(t, "admin-1", records[0].Actor)
+	assert.JSONEq(t, `{"max":100}`, string(records[0].Before))
+	assert.Nil(t, records[0].After)
+	assert.False(t, records[0].CreatedAt.IsZero())
+}
+
+// TestLog_NotInitialized tests that Log fails without a store.
+func TestLog_NotInitialized(t *testing.T) {
+	original := DefaultStore
+	defer SetDefault(original)
+	SetDefault(nil)
+
+	assert.Error(t, Log(context.Background(), "admin-1", "cache.flush", "k", nil, nil))
+}
+
+// TestMemoryStore_ListFiltersAndPages tests newest-first ordering, filters and offset/limit.
+func TestMemoryStore_ListFiltersAndPages(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	for _, action := range []string{"cache.flush", "ws.broadcast", "cache.flush", "cache.flush"} {
+		require.NoError(t, store.Append(ctx, Record{Actor: "admin-1", Action: action}))
+	}
+
+	records, err := store.List(ctx, Query{Action: "cache.flush", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, int64(4), records[0].ID)
+	assert.Equal(t, int64(3), records[1].ID)
+
+	records, err = store.List(ctx, Query{Action: "cache.flush", Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(1), records[0].ID)
+}
+
+// TestMemoryStore_Pseudonymize tests that only whole actors and target parts are replaced.
+func TestMemoryStore_Pseudonymize(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	for _, record := range []Record{
+		{Actor: "u1", Action: "profile.update", Target: "u1"},
+		{Actor: "admin-1", Action: "user.deletion.schedule", Target: "tenant:acme:user:u1"},
+		{Actor: "u10", Action: "profile.update", Target: "user:u10"},
+		{Actor: "admin-1", Action: "cache.flush", Target: "user:u1x"},
+	} {
+		require.NoError(t, store.Append(ctx, record))
+	}
+
+	changed, err := store.Pseudonymize(ctx, "u1", "deleted-user-x")
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+
+	records, err := store.List(ctx, Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "user:u1x", records[0].Target)
+	assert.Equal(t, Record{Actor: "u10", Target: "user:u10"}, Record{Actor: records[1].Actor, Target: records[1].Target})
+	assert.Equal(t, "tenant:acme:user:deleted-user-x", records[2].Target)
+	assert.Equal(t, Record{Actor: "deleted-user-x", Target: "deleted-user-x"}, Record{Actor: records[3].Actor, Target: records[3].Target})
+}
+
+// TestPostgRESTStore tests the requests sent to the Supabase REST API.
+func TestPostgRESTStore(t *testing.T) {
+	var inserted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/v1/audit_log", r.URL.Path)
+		assert.Equal(t, "service-key", r.Header.Get("apikey"))
+		assert.Equal(t, "Bearer service-key", r.Header.Get("Authorization"))
+
+		switch r.Method {
+		case "POST":
+			body, _ := io.ReadAll(r.Body)
+			require.NoError(t, json.Unmarshal(body, &inserted))
+			w.WriteHeader(http.StatusCreated)
+		case "GET":
+			assert.Equal(t, "id.desc", r.URL.Query().Get("order"))
+			assert.Equal(t, "11", r.URL.Query().Get("limit"))
+			assert.Equal(t, "20", r.URL.Query().Get("offset"))
+			assert.Equal(t, "eq.admin-1", r.URL.Query().Get("actor"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"id":7,"actor":"admin-1","action":"cache.flush","target":"k","before":{"k":"v"},"after":null,"created_at":"2026-01-02T03:04:05Z"}]`))
+		}
+	}))
+	defer server.Close()
+
+	store := NewPostgRESTStore(server.URL+"/", "service-key")
+	ctx := context.Background()
+
+	require.NoError(t, store.Append(ctx, Record{ID: 99, Actor: "admin-1", Action: "cache.flush", Target: "k"}))
+	assert.NotContains(t, inserted, "id", "the database assigns IDs")
+	assert.Equal(t, "cache.flush", inserted["action"])
+
+	records, err := store.List(ctx, Query{Actor: "admin-1", Limit: 11, Offset: 20})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(7), records[0].ID)
+	assert.JSONEq(t, `{"k":"v"}`, string(records[0].Before))
+}
+
+// TestPostgRESTStore_Error tests that non-2xx responses are returned as errors.
+func TestPostgRESTStore_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"permission denied"}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	store := NewPostgRESTStore(server.URL, "service-key")
+	err := store.Append(context.Background(), Record{Actor: "admin-1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+}
+
+// TestPostgRESTStore_Pseudonymize tests that pseudonymization goes through the database function.
+func TestPostgRESTStore_Pseudonymize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/rest/v1/rpc/audit_log_pseudonymize", r.URL.Path)
+
+		var params map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		assert.Equal(t, map[string]string{"p_user_id": "u1", "p_alias": "deleted-user-x"}, params)
+		_, _ = w.Write([]byte("3"))
+	}))
+	defer server.Close()
+
+	changed, err := NewPostgRESTStore(server.URL, "service-key").Pseudonymize(context.Background(), "u1", "deleted-user-x")
+	require.NoError(t, err)
+	assert.Equal(t, 3, changed)
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps audit records in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records []Record
+	nextID  int64
+}
+
+// NewMemoryStore creates an empty in-memory audit store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nextID: 1}
+}
+
+// Append stores a copy of the record with the next ID.
+func (m *MemoryStore) Append(ctx context.Context, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record.ID = m.nextID
+	m.nextID++
+	m.records = append(m.records, record)
+	return nil
+}
+
+// List returns matching records, newest first.
+func (m *MemoryStore) List(ctx context.Context, query Query) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Record, 0)
+	skipped := 0
+	for i := len(m.records) - 1; i >= 0; i-- {
+		record := m.records[i]
+		if query.Actor != "" && record.Actor != query.Actor {
+			continue
+		}
+		if query.Action != "" && record.Action != query.Action {
+			continue
+		}
+		if query.MaxID > 0 && record.ID > query.MaxID {
+			continue
+		}
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+		result = append(result, record)
+	}
+	return result, nil
+}
+
+// Pseudonymize replaces userID with alias in the actor and target of every record. Only whole
+// values match: the actor itself, and the target or one of its ":"-separated parts (as in
+// "user:<id>"), so erasing "u1" leaves "u10" alone.
+func (m *MemoryStore) Pseudonymize(ctx context.Context, userID, alias string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := 0
+	for i := range m.records {
+		record := &m.records[i]
+		target, targetChanged := replacePart(record.Target, userID, alias)
+		if record.Actor != userID && !targetChanged {
+			continue
+		}
+		if record.Actor == userID {
+			record.Actor = alias
+		}
+		record.Target = target
+		changed++
+	}
+	return changed, nil
+}
+
+// replacePart replaces the ":"-separated parts of value equal to old with replacement, and
+// reports whether there were any.
+func replacePart(value, old, replacement string) (string, bool) {
+	parts := strings.Split(value, ":")
+	replaced := false
+	for i, part := range parts {
+		if part == old {
+			parts[i] = replacement
+			replaced = true
+		}
+	}
+	return strings.Join(parts, ":"), replaced
+}
@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// tableName is the Postgres table holding audit records (see schema.sql).
+const tableName = "audit_log"
+
+// PostgRESTStore writes audit records to Postgres through the Supabase REST API (PostgREST).
+// It uses the service role key, because the audit_log table has RLS enabled with no policies:
+// neither anonymous nor signed-in users can read or write it directly.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/audit_log
+	rpcURL     string // e.g. https://xxx.supabase.co/rest/v1/rpc/audit_log_pseudonymize
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		rpcURL:     strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/rpc/audit_log_pseudonymize",
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Append inserts a record.
+func (s *PostgRESTStore) Append(ctx context.Context, record Record) error {
+	// Step 1: Encode the record (the database assigns the ID)
+	record.ID = 0
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	// Step 2: POST it to the table endpoint
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	s.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Prefer", "return=minimal")
+
+	// Step 3: Check the response
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// List returns matching records, newest first.
+func (s *PostgRESTStore) List(ctx context.Context, query Query) ([]Record, error) {
+	// Step 1: Build the PostgREST query string
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("order", "id.desc")
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if query.Offset > 0 {
+		params.Set("offset", strconv.Itoa(query.Offset))
+	}
+	if query.Actor != "" {
+		params.Set("actor", "eq."+query.Actor)
+	}
+	if query.Action != "" {
+		params.Set("action", "eq."+query.Action)
+	}
+	if query.MaxID > 0 {
+		params.Set("id", "lte."+strconv.FormatInt(query.MaxID, 10))
+	}
+
+	// Step 2: Send the request
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.setHeaders(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	// Step 3: Decode the rows
+	records := make([]Record, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to parse audit records: %w", err)
+	}
+	return records, nil
+}
+
+// Pseudonymize calls the audit_log_pseudonymize database function (see schema.sql),
+// which is the only path allowed to modify existing audit records.
+func (s *PostgRESTStore) Pseudonymize(ctx context.Context, userID, alias string) (int, error) {
+	body, err := json.Marshal(map[string]string{"p_user_id": userID, "p_alias": alias})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var changed int
+	if err := json.NewDecoder(resp.Body).Decode(&changed); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return changed, nil
+}
+
+// setHeaders adds the Supabase authentication headers.
+func (s *PostgRESTStore) setHeaders(req *http.Request) {
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+}
+
+// Compile-time checks that both stores satisfy Store and Pseudonymizer.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+
+	_ Pseudonymizer = (*PostgRESTStore)(nil)
+	_ Pseudonymizer = (*MemoryStore)(nil)
+)
@@ -0,0 +1,70 @@
+-- Audit trail of admin actions. Run this in the Supabase SQL editor.
+-- The table is append-only: a trigger rejects UPDATE, DELETE and TRUNCATE for every role.
+-- The single exception is GDPR pseudonymization through audit_log_pseudonymize(), which may
+-- only rewrite the actor and target columns.
+
+create table if not exists audit_log (
+    id         bigint generated always as identity primary key,
+    actor      text        not null,
+    action     text        not null,
+    target     text        not null default '',
+    before     jsonb,
+    after      jsonb,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists audit_log_actor_idx on audit_log (actor, id desc);
+create index if not exists audit_log_action_idx on audit_log (action, id desc);
+
+create or replace function audit_log_immutable() returns trigger
+language plpgsql as $$
+begin
+    if tg_op = 'UPDATE'
+       and current_setting('audit.pseudonymize', true) = 'on'
+       and new.id = old.id
+       and new.action = old.action
+       and new.before is not distinct from old.before
+       and new.after is not distinct from old.after
+       and new.created_at = old.created_at then
+        return new;
+    end if;
+    raise exception 'audit_log is append-only';
+end;
+$$;
+
+-- Replaces a user ID with an alias in actor/target (GDPR erasure). Returns the rows changed.
+-- Only whole values match: the actor, and the target or one of its ':'-separated parts (as in
+-- 'user:<id>'), so erasing 'u1' leaves 'u10' alone.
+create or replace function audit_log_pseudonymize(p_user_id text, p_alias text) returns integer
+language plpgsql security definer as $$
+declare
+    changed integer;
+begin
+    perform set_config('audit.pseudonymize', 'on', true);
+    update audit_log
+       set actor  = case when actor = p_user_id then p_alias else actor end,
+           target = array_to_string(array(
+               select case when part = p_user_id then p_alias else part end
+                 from unnest(string_to_array(target, ':')) with ordinality as parts(part, position)
+                order by position), ':')
+     where actor = p_user_id or p_user_id = any(string_to_array(target, ':'));
+    get diagnostics changed = row_count;
+    perform set_config('audit.pseudonymize', 'off', true);
+    return changed;
+end;
+$$;
+
+revoke all on function audit_log_pseudonymize(text, text) from public, anon, authenticated;
+
+drop trigger if exists audit_log_no_modify on audit_log;
+create trigger audit_log_no_modify
+    before update or delete on audit_log
+    for each row execute function audit_log_immutable();
+
+drop trigger if exists audit_log_no_truncate on audit_log;
+create trigger audit_log_no_truncate
+    before truncate on audit_log
+    for each statement execute function audit_log_immutable();
+
+-- RLS with no policies: only the service role (used by the backend) can access the table.
+alter table audit_log enable row level security;
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Compression algorithms (CACHE_COMPRESSION).
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+)
+
+// Header bytes marking how a stored value is encoded. Compressed values are stored as the header
+// byte followed by the base64 of the compressed bytes, so they survive the Upstash REST API (JSON
+// strings) as well as native Redis. Plain values that happen to start with a header byte are
+// stored behind headerRaw so they are never mistaken for compressed ones.
+const (
+	headerRaw    byte = 0x00
+	headerGzip   byte = 0x01
+	headerSnappy byte = 0x02
+)
+
+// compressedStore compresses values of at least threshold bytes before delegating to the
+// wrapped store, and decompresses them on read. Reads always recognise compressed entries,
+// even with compression turned off, so the setting can change without flushing the cache.
+type compressedStore struct {
+	store     Store
+	algorithm string
+	threshold int
+}
+
+// WithCompression returns a Store that compresses values of at least threshold bytes with
+// algorithm (CompressionGzip or CompressionSnappy). With CompressionNone values are written as
+// is but compressed entries are still decoded on read.
+func WithCompression(store Store, algorithm string, threshold int) Store {
+	if store == nil {
+		return nil
+	}
+	return &compressedStore{store: store, algorithm: algorithm, threshold: threshold}
+}
+
+// Get retrieves a value, decompressing it if needed.
+func (s *compressedStore) Get(key string) (string, error) {
+	value, err := s.store.Get(key)
+	if err != nil || value == "" {
+		return value, err
+	}
+	decoded, err := decodeValue(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress cached value for %s: %w", key, err)
+	}
+	return decoded, nil
+}
+
+// Set stores a value, compressed if it is at least threshold bytes long and compression makes it smaller.
+func (s *compressedStore) Set(key, value string, ttl time.Duration) error {
+	return s.store.Set(key, encodeValue(value, s.algorithm, s.threshold), ttl)
+}
+
+// Del removes a key.
+func (s *compressedStore) Del(key string) error {
+	return s.store.Del(key)
+}
+
+// Incr increments a counter. Counters are short, so they are never compressed.
+func (s *compressedStore) Incr(key string) (int64, error) {
+	return s.store.Incr(key)
+}
+
+// Expire sets the TTL of a key.
+func (s *compressedStore) Expire(key string, ttl time.Duration) error {
+	return s.store.Expire(key, ttl)
+}
+
+// MGet retrieves several values, decompressing each if needed.
+func (s *compressedStore) MGet(keys ...string) ([]string, error) {
+	values, err := s.store.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		if values[i], err = decodeValue(value); err != nil {
+			return nil, fmt.Errorf("failed to decompress cached value for %s: %w", keys[i], err)
+		}
+	}
+	return values, nil
+}
+
+// Pipeline runs the commands, compressing the values set and decompressing those read.
+func (s *compressedStore) Pipeline(commands []Command) ([]Result, error) {
+	encoded := make([]Command, len(commands))
+	for i, command := range commands {
+		if command.Name == CmdSet {
+			command.Value = encodeValue(command.Value, s.algorithm, s.threshold)
+		}
+		encoded[i] = command
+	}
+	results, err := Pipeline(s.store, encoded...)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if commands[i].Name != CmdGet || result.Err != nil || result.Value == "" {
+			continue
+		}
+		if results[i].Value, err = decodeValue(result.Value); err != nil {
+			results[i].Value, results[i].Err = "", fmt.Errorf("failed to decompress cached value for %s: %w", commands[i].Key, err)
+		}
+	}
+	return results, nil
+}
+
+// encodeValue returns value as stored: compressed with a header byte, escaped behind headerRaw,
+// or unchanged.
+func encodeValue(value, algorithm string, threshold int) string {
+	if algorithm != CompressionNone && len(value) >= threshold {
+		if compressed, ok := compress(value, algorithm); ok && len(compressed) < len(value) {
+			return compressed
+		}
+	}
+	if value != "" && value[0] <= headerSnappy {
+		return string(headerRaw) + value
+	}
+	return value
+}
+
+// compress returns the header byte and base64 of value compressed with algorithm.
+func compress(value, algorithm string) (string, bool) {
+	var header byte
+	var compressed []byte
+
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write([]byte(value)); err != nil {
+			return "", false
+		}
+		if err := writer.Close(); err != nil {
+			return "", false
+		}
+		header, compressed = headerGzip, buf.Bytes()
+	case CompressionSnappy:
+		header, compressed = headerSnappy, snappy.Encode(nil, []byte(value))
+	default:
+		return "", false
+	}
+	return string(header) + base64.StdEncoding.EncodeToString(compressed), true
+}
+
+// decodeValue reverses encodeValue. Values without a header byte are returned unchanged.
+func decodeValue(value string) (string, error) {
+	switch value[0] {
+	case headerRaw:
+		return value[1:], nil
+	case headerGzip:
+		compressed, err := base64.StdEncoding.DecodeString(value[1:])
+		if err != nil {
+			return "", err
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			return "", err
+		}
+		return string(decompressed), nil
+	case headerSnappy:
+		compressed, err := base64.StdEncoding.DecodeString(value[1:])
+		if err != nil {
+			return "", err
+		}
+		decompressed, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			return "", err
+		}
+		return string(decompressed), nil
+	default:
+		return value, nil
+	}
+}
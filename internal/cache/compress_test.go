@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// largeValue is a GraphQL-like response that compresses well.
+var largeValue = `{"data":{"artists":[` + strings.Repeat(`{"id":"123","name":"Artist","currentPrice":45.67},`, 60) + `{}]}}`
+
+// TestCompressedStore_RoundTrip tests that large values are stored compressed and read back intact.
+func TestCompressedStore_RoundTrip(t *testing.T) {
+	for _, algorithm := range []string{CompressionGzip, CompressionSnappy} {
+		t.Run(algorithm, func(t *testing.T) {
+			backend := NewMemoryStore()
+			store := WithCompression(backend, algorithm, 1024)
+
+			require.NoError(t, store.Set("gql", largeValue, time.Minute))
+			require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+
+			raw, err := backend.Get("gql")
+			require.NoError(t, err)
+			assert.Less(t, len(raw), len(largeValue)/2)
+			assert.True(t, utf8.ValidString(raw)) // Safe to send as a JSON string to Upstash
+			_, err = json.Marshal(raw)
+			require.NoError(t, err)
+
+			// Small values are stored as is
+			raw, _ = backend.Get("price:123")
+			assert.Equal(t, "45.67", raw)
+
+			for key, want := range map[string]string{"gql": largeValue, "price:123": "45.67"} {
+				value, err := store.Get(key)
+				require.NoError(t, err)
+				assert.Equal(t, want, value)
+			}
+		})
+	}
+}
+
+// TestCompressedStore_Compatibility tests reads with compression off and plain values that
+// look like compressed ones.
+func TestCompressedStore_Compatibility(t *testing.T) {
+	backend := NewMemoryStore()
+	require.NoError(t, WithCompression(backend, CompressionGzip, 0).Set("gql", largeValue, time.Minute))
+
+	// Turning compression off still decodes existing entries
+	store := WithCompression(backend, CompressionNone, 0)
+	value, err := store.Get("gql")
+	require.NoError(t, err)
+	assert.Equal(t, largeValue, value)
+
+	// Plain values starting with a header byte are escaped, not misread
+	require.NoError(t, store.Set("odd", "\x01not compressed", time.Minute))
+	value, err = store.Get("odd")
+	require.NoError(t, err)
+	assert.Equal(t, "\x01not compressed", value)
+
+	// Corrupt entries are an error, not garbage
+	require.NoError(t, backend.Set("bad", "\x01!!!", time.Minute))
+	_, err = store.Get("bad")
+	assert.Error(t, err)
+
+	// Misses stay misses
+	value, err = store.Get("missing")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+// TestCompressedStore_MGet tests that MGet decompresses each value through the epoch wrapper.
+func TestCompressedStore_MGet(t *testing.T) {
+	store := WithEpoch(WithCompression(NewMemoryStore(), CompressionGzip, 1024), 0)
+	require.NoError(t, store.Set("gql", largeValue, time.Minute))
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+
+	values, err := store.MGet("gql", "missing", "price:123")
+	require.NoError(t, err)
+	assert.Equal(t, []string{largeValue, "", "45.67"}, values)
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SchemaEpoch is part of every cache key. Bump it in the same change as anything that alters
+// how cached values are serialized (e.g. a new price format): after the deploy every instance
+// reads and writes a fresh key space, and entries in the old format are never read again
+// (they expire with their TTL).
+const SchemaEpoch = 1
+
+// epochKey stores the runtime epoch, incremented by POST /api/admin/cache/epoch.
+// It is the only key outside the versioned key space.
+const epochKey = "cache:epoch"
+
+// epochTTL keeps the runtime epoch for as long as any entry it versions could live;
+// Set needs a TTL (0 means the default of 5 minutes).
+const epochTTL = 10 * 365 * 24 * time.Hour
+
+// EpochStore embeds the cache epoch in every key: "v<SchemaEpoch>.<epoch>:<key>".
+// Incrementing the runtime epoch (Bump) moves every instance to an empty key space at once,
+// invalidating all cached data without iterating keys; old entries expire with their TTL.
+// The runtime epoch is shared through the wrapped store and re-read every refresh interval,
+// so other instances follow within that interval.
+type EpochStore struct {
+	store   Store
+	refresh time.Duration
+
+	mu       sync.Mutex
+	epoch    int64
+	loadedAt time.Time
+}
+
+var (
+	// DefaultEpoch is the epoch wrapper of the default cache store (nil until Init).
+	DefaultEpoch *EpochStore
+)
+
+// WithEpoch returns an EpochStore around store that re-reads the runtime epoch every refresh
+// (every call if refresh is 0).
+func WithEpoch(store Store, refresh time.Duration) *EpochStore {
+	if store == nil {
+		return nil
+	}
+	return &EpochStore{store: store, refresh: refresh}
+}
+
+// GetEpoch returns the default epoch store (nil if Init has not been called).
+func GetEpoch() *EpochStore {
+	return DefaultEpoch
+}
+
+// Epoch returns the current runtime epoch, re-reading it from the store when the cached
+// value is older than the refresh interval.
+func (e *EpochStore) Epoch() (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.loadedAt.IsZero() && time.Since(e.loadedAt) < e.refresh {
+		return e.epoch, nil
+	}
+
+	epoch, err := e.load()
+	if err != nil {
+		// Keep using the last known epoch; the next call retries
+		return e.epoch, err
+	}
+	e.epoch, e.loadedAt = epoch, time.Now()
+	return e.epoch, nil
+}
+
+// load reads the runtime epoch from the store (0 if it was never bumped).
+func (e *EpochStore) load() (int64, error) {
+	raw, err := e.store.Get(epochKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache epoch: %w", err)
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	epoch, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache epoch %q: %w", raw, err)
+	}
+	return epoch, nil
+}
+
+// Bump increments the runtime epoch, invalidating every cached entry, and returns the new epoch.
+// Concurrent bumps from two instances may both land on the same number; either way the old
+// key space is abandoned.
+func (e *EpochStore) Bump() (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	current, err := e.load()
+	if err != nil {
+		return 0, err
+	}
+	next := current + 1
+	if err := e.store.Set(epochKey, strconv.FormatInt(next, 10), epochTTL); err != nil {
+		return 0, fmt.Errorf("failed to store cache epoch: %w", err)
+	}
+
+	e.epoch, e.loadedAt = next, time.Now()
+	slog.Info("Cache epoch bumped, all cached data invalidated", "epoch", next)
+	return next, nil
+}
+
+// key returns the versioned form of key.
+func (e *EpochStore) key(key string) string {
+	epoch, err := e.Epoch()
+	if err != nil {
+		slog.Warn("Failed to load the cache epoch, using the last one", "epoch", epoch, "error", err)
+	}
+	return "v" + strconv.Itoa(SchemaEpoch) + "." + strconv.FormatInt(epoch, 10) + ":" + key
+}
+
+// Get retrieves the versioned key.
+func (e *EpochStore) Get(key string) (string, error) {
+	return e.store.Get(e.key(key))
+}
+
+// Set stores the versioned key.
+func (e *EpochStore) Set(key, value string, ttl time.Duration) error {
+	return e.store.Set(e.key(key), value, ttl)
+}
+
+// Del removes the versioned key.
+func (e *EpochStore) Del(key string) error {
+	return e.store.Del(e.key(key))
+}
+
+// Incr increments the versioned key.
+func (e *EpochStore) Incr(key string) (int64, error) {
+	return e.store.Incr(e.key(key))
+}
+
+// Expire sets the TTL of the versioned key.
+func (e *EpochStore) Expire(key string, ttl time.Duration) error {
+	return e.store.Expire(e.key(key), ttl)
+}
+
+// MGet retrieves the versioned keys.
+func (e *EpochStore) MGet(keys ...string) ([]string, error) {
+	versioned := make([]string, len(keys))
+	for i, key := range keys {
+		versioned[i] = e.key(key)
+	}
+	return e.store.MGet(versioned...)
+}
+
+// Pipeline runs the commands on the versioned keys.
+func (e *EpochStore) Pipeline(commands []Command) ([]Result, error) {
+	return Pipeline(e.store, withKeys(commands, e.key)...)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEpochStore_Bump tests that bumping the epoch hides every existing entry.
+func TestEpochStore_Bump(t *testing.T) {
+	backend := NewMemoryStore()
+	store := WithEpoch(backend, 0)
+
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+	raw, err := backend.Get("v1.0:price:123")
+	require.NoError(t, err)
+	assert.Equal(t, "45.67", raw)
+
+	epoch, err := store.Bump()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), epoch)
+
+	value, err := store.Get("price:123")
+	require.NoError(t, err)
+	assert.Equal(t, "", value) // Invalidated
+
+	require.NoError(t, store.Set("price:123", "50", time.Minute))
+	raw, _ = backend.Get("v1.1:price:123")
+	assert.Equal(t, "50", raw)
+}
+
+// TestEpochStore_SharedAcrossInstances tests that other instances pick up a bump after their
+// refresh interval.
+func TestEpochStore_SharedAcrossInstances(t *testing.T) {
+	backend := NewMemoryStore()
+	bumper := WithEpoch(backend, 0)
+	follower := WithEpoch(backend, time.Hour)
+
+	require.NoError(t, follower.Set("k", "old", time.Minute))
+	_, err := bumper.Bump()
+	require.NoError(t, err)
+
+	// Within the refresh interval the follower still uses its cached epoch
+	value, err := follower.Get("k")
+	require.NoError(t, err)
+	assert.Equal(t, "old", value)
+
+	follower.refresh = 0
+	value, err = follower.Get("k")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	// A corrupt epoch is reported and the last known one kept
+	require.NoError(t, backend.Set(epochKey, "nope", time.Minute))
+	epoch, err := follower.Epoch()
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), epoch)
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Locker is a distributed lock on a Redis key, held by an owner (a random ID per process) until
+// it expires or is released. Backends shared between replicas (Redis, Upstash) implement it; the
+// in-memory store does too, for tests and single-instance setups.
+//
+// Lock keys are used as-is: they are not prefixed with the cache epoch (bumping the epoch must
+// not hand the lock to a second owner) and are never compressed.
+type Locker interface {
+	// Acquire takes the lock for owner if nobody holds it, for ttl. It returns true if owner now
+	// holds the lock (also when it already did).
+	Acquire(key, owner string, ttl time.Duration) (bool, error)
+
+	// Refresh extends the lock to ttl from now if owner still holds it. It returns false if the
+	// lock expired or another owner took it.
+	Refresh(key, owner string, ttl time.Duration) (bool, error)
+
+	// Release frees the lock if owner holds it. Releasing a lock held by someone else is a no-op.
+	Release(key, owner string) error
+}
+
+// DefaultLocker is the lock backend of the default cache store, nil when the store is not
+// shared (or not initialized). Set by Init and SetDefault.
+var DefaultLocker Locker
+
+// GetLocker returns the default lock backend, or nil if there is none.
+func GetLocker() Locker {
+	return DefaultLocker
+}
+
+// Lua scripts for the owner-checked operations, so the check and the write are atomic.
+// They return 1 if owner holds (or held) the lock, 0 otherwise.
+const (
+	refreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then redis.call("PEXPIRE", KEYS[1], ARGV[2]) return 1 end return 0`
+	releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then redis.call("DEL", KEYS[1]) return 1 end return 0`
+	acquireScript = `if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then return 1 end if redis.call("GET", KEYS[1]) == ARGV[1] then redis.call("PEXPIRE", KEYS[1], ARGV[2]) return 1 end return 0`
+)
+
+// Acquire takes the lock with SET NX PX (or extends it if owner already holds it).
+func (r *RedisClient) Acquire(key, owner string, ttl time.Duration) (bool, error) {
+	return r.evalLock(acquireScript, key, owner, ttl)
+}
+
+// Refresh extends the lock if owner still holds it.
+func (r *RedisClient) Refresh(key, owner string, ttl time.Duration) (bool, error) {
+	return r.evalLock(refreshScript, key, owner, ttl)
+}
+
+// Release deletes the lock if owner holds it.
+func (r *RedisClient) Release(key, owner string) error {
+	_, err := r.evalLock(releaseScript, key, owner, 0)
+	return err
+}
+
+// evalLock runs a lock script and reports whether it returned 1.
+func (r *RedisClient) evalLock(script, key, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	result, err := r.client.Eval(ctx, script, []string{key}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, fmt.Errorf("redis lock %s failed: %w", key, err)
+	}
+	return result == 1, nil
+}
+
+// Acquire takes the lock with SET NX PX (or extends it if owner already holds it).
+func (c *Client) Acquire(key, owner string, ttl time.Duration) (bool, error) {
+	return c.evalLock(acquireScript, key, owner, ttl)
+}
+
+// Refresh extends the lock if owner still holds it.
+func (c *Client) Refresh(key, owner string, ttl time.Duration) (bool, error) {
+	return c.evalLock(refreshScript, key, owner, ttl)
+}
+
+// Release deletes the lock if owner holds it.
+func (c *Client) Release(key, owner string) error {
+	_, err := c.evalLock(releaseScript, key, owner, 0)
+	return err
+}
+
+// evalLock runs a lock script through the REST API and reports whether it returned 1.
+func (c *Client) evalLock(script, key, owner string, ttl time.Duration) (bool, error) {
+	command := []string{"EVAL", script, "1", key, owner, strconv.FormatInt(ttl.Milliseconds(), 10)}
+
+	resp, err := c.executeCommand(command)
+	if err != nil {
+		return false, fmt.Errorf("redis lock %s failed: %w", key, err)
+	}
+	result, err := resp.Int()
+	if err != nil {
+		return false, fmt.Errorf("redis lock %s failed: %w", key, err)
+	}
+	return result == 1, nil
+}
+
+// Acquire takes the lock if it is free or expired (or extends it if owner already holds it).
+func (m *MemoryStore) Acquire(key, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.entries[key]
+	if exists && entry.live(m.now()) && entry.value != owner {
+		return false, nil
+	}
+	m.entries[key] = memoryEntry{value: owner, expiresAt: m.now().Add(ttl)}
+	return true, nil
+}
+
+// Refresh extends the lock if owner still holds it.
+func (m *MemoryStore) Refresh(key, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.entries[key]
+	if !exists || !entry.live(m.now()) || entry.value != owner {
+		return false, nil
+	}
+	m.entries[key] = memoryEntry{value: owner, expiresAt: m.now().Add(ttl)}
+	return true, nil
+}
+
+// Release deletes the lock if owner holds it.
+func (m *MemoryStore) Release(key, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, exists := m.entries[key]; exists && entry.value == owner {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Compile-time checks that every shared backend satisfies Locker.
+var (
+	_ Locker = (*Client)(nil)
+	_ Locker = (*RedisClient)(nil)
+	_ Locker = (*MemoryStore)(nil)
+)
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryStore_Lock tests that only one owner holds a lock until it expires or is released.
+func TestMemoryStore_Lock(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	acquired, err := store.Acquire("lock", "a", 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, _ = store.Acquire("lock", "b", 10*time.Second)
+	assert.False(t, acquired, "held by a")
+	acquired, _ = store.Acquire("lock", "a", 10*time.Second)
+	assert.True(t, acquired, "re-acquiring your own lock succeeds")
+
+	held, _ := store.Refresh("lock", "b", 10*time.Second)
+	assert.False(t, held, "b can't refresh a's lock")
+	require.NoError(t, store.Release("lock", "b"))
+	acquired, _ = store.Acquire("lock", "b", 10*time.Second)
+	assert.False(t, acquired, "b can't release a's lock")
+
+	// a stops refreshing: the lock expires and b takes it
+	now = now.Add(11 * time.Second)
+	held, _ = store.Refresh("lock", "a", 10*time.Second)
+	assert.False(t, held)
+	acquired, _ = store.Acquire("lock", "b", 10*time.Second)
+	assert.True(t, acquired)
+
+	require.NoError(t, store.Release("lock", "b"))
+	acquired, _ = store.Acquire("lock", "a", 10*time.Second)
+	assert.True(t, acquired, "free after release")
+}
+
+// TestClient_LockCommands tests the commands the Upstash client sends for locks.
+func TestClient_LockCommands(t *testing.T) {
+	var commands [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req upstashRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		commands = append(commands, req.Command)
+		w.Write([]byte(`{"result": 1}`))
+	}))
+	defer server.Close()
+
+	client := NewUpstashClient(server.URL, "token")
+	acquired, err := client.Acquire("realtime:leader", "host-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	require.NoError(t, client.Release("realtime:leader", "host-1"))
+
+	require.Len(t, commands, 2)
+	assert.Equal(t, []string{"EVAL", acquireScript, "1", "realtime:leader", "host-1", "15000"}, commands[0])
+	assert.Equal(t, []string{"EVAL", releaseScript, "1", "realtime:leader", "host-1", "0"}, commands[1])
+}
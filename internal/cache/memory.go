@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process cache store backed by a map.
+// It is used as a deterministic fake in tests and works as a fallback for single-instance setups.
+// Values are not shared between replicas.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	queues  map[string]map[string]time.Time // Queue members by key, with their due times (see queue.go)
+	now     func() time.Time                // Overridable clock for tests
+}
+
+// memoryEntry is a single cached value with its expiry time (zero for keys without a TTL,
+// e.g. counters created by Incr).
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// live reports whether the entry has not expired at now.
+func (e memoryEntry) live(now time.Time) bool {
+	return e.expiresAt.IsZero() || now.Before(e.expiresAt)
+}
+
+// NewMemoryStore creates an empty in-memory cache store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		queues:  make(map[string]map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Get retrieves a value by key. Expired or missing keys are a cache miss.
+func (m *MemoryStore) Get(key string) (string, error) {
+	m.mu.RLock()
+	entry, exists := m.entries[key]
+	m.mu.RUnlock()
+
+	if !exists || !entry.live(m.now()) {
+		return "", nil
+	}
+	return entry.value, nil
+}
+
+// Set stores a value with the given TTL. If ttl is 0, uses the default TTL (5 minutes).
+func (m *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+
+	m.mu.Lock()
+	m.entries[key] = memoryEntry{value: value, expiresAt: m.now().Add(ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Del removes a key.
+func (m *MemoryStore) Del(key string) error {
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// Incr increments the integer stored under key, keeping its TTL. A missing or expired key
+// counts as 0 and is created without a TTL.
+func (m *MemoryStore) Incr(key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.entries[key]
+	if !exists || !entry.live(m.now()) {
+		entry = memoryEntry{value: "0"}
+	}
+	current, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of %s is not an integer", key)
+	}
+	entry.value = strconv.FormatInt(current+1, 10)
+	m.entries[key] = entry
+	return current + 1, nil
+}
+
+// Expire sets the TTL of key. Like Redis, a ttl of 0 or less deletes the key.
+func (m *MemoryStore) Expire(key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.entries[key]
+	if !exists || !entry.live(m.now()) {
+		return nil
+	}
+	if ttl <= 0 {
+		delete(m.entries, key)
+		return nil
+	}
+	entry.expiresAt = m.now().Add(ttl)
+	m.entries[key] = entry
+	return nil
+}
+
+// Shed removes the expired entries, then about fraction (0-1] of the entries with a TTL, in no
+// particular order, returning how many were removed. Counters without a TTL are kept. Registered
+// as the "cache" shedder of the memory watchdog when the in-memory backend is used.
+func (m *MemoryStore) Shed(fraction float64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	removed, expiring := 0, 0
+	for key, entry := range m.entries {
+		switch {
+		case !entry.live(now):
+			delete(m.entries, key)
+			removed++
+		case !entry.expiresAt.IsZero():
+			expiring++
+		}
+	}
+	quota := int(math.Ceil(fraction * float64(expiring)))
+	for key, entry := range m.entries {
+		if quota == 0 {
+			break
+		}
+		if !entry.expiresAt.IsZero() {
+			delete(m.entries, key)
+			removed++
+			quota--
+		}
+	}
+	return removed
+}
+
+// MGet retrieves several values at once, with an empty string for each miss.
+func (m *MemoryStore) MGet(keys ...string) ([]string, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i], _ = m.Get(key)
+	}
+	return values, nil
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryStore_SetAndGet tests that stored values can be read back.
+func TestMemoryStore_SetAndGet(t *testing.T) {
+	store := NewMemoryStore()
+
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+
+	value, err := store.Get("price:123")
+	require.NoError(t, err)
+	assert.Equal(t, "45.67", value)
+}
+
+// TestMemoryStore_Miss tests that missing keys return an empty string and no error.
+func TestMemoryStore_Miss(t *testing.T) {
+	store := NewMemoryStore()
+
+	value, err := store.Get("missing")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+// TestMemoryStore_Expiry tests that values expire after their TTL.
+func TestMemoryStore_Expiry(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+
+	// Advance the clock past the TTL
+	now = now.Add(2 * time.Minute)
+
+	value, err := store.Get("price:123")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+// TestSetDefault tests that SetDefault swaps the store returned by GetClient.
+func TestSetDefault(t *testing.T) {
+	original := GetClient()
+	defer SetDefault(original)
+
+	store := NewMemoryStore()
+	SetDefault(store)
+	assert.Equal(t, Store(store), GetClient())
+
+	SetDefault(nil)
+	assert.Nil(t, GetClient())
+}
+
+// TestMemoryStore_Del tests that deleted keys become a cache miss and missing keys are not an error.
+func TestMemoryStore_Del(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+
+	require.NoError(t, store.Del("price:123"))
+	require.NoError(t, store.Del("missing"))
+
+	value, err := store.Get("price:123")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+// TestMemoryStore_Incr tests that counters start at 1, keep their TTL and reject non-integers.
+func TestMemoryStore_Incr(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	count, err := store.Incr("hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	// A new counter has no TTL until Expire is called; Incr keeps it afterwards
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, store.Expire("hits", time.Minute))
+	count, err = store.Incr("hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	now = now.Add(2 * time.Minute)
+	count, err = store.Incr("hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count) // Expired, starts over
+
+	require.NoError(t, store.Set("name", "abc", time.Minute))
+	_, err = store.Incr("name")
+	assert.Error(t, err)
+}
+
+// TestMemoryStore_Expire tests that Expire changes the TTL and ignores missing keys.
+func TestMemoryStore_Expire(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+	require.NoError(t, store.Expire("price:123", time.Hour))
+	require.NoError(t, store.Expire("missing", time.Hour))
+
+	now = now.Add(30 * time.Minute)
+	value, err := store.Get("price:123")
+	require.NoError(t, err)
+	assert.Equal(t, "45.67", value)
+
+	// Like Redis, a non-positive TTL deletes the key
+	require.NoError(t, store.Expire("price:123", 0))
+	value, _ = store.Get("price:123")
+	assert.Equal(t, "", value)
+}
+
+// TestMemoryStore_MGet tests that MGet returns values in order with misses as empty strings.
+func TestMemoryStore_MGet(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.Set("price:1", "10", time.Minute))
+	require.NoError(t, store.Set("price:3", "30", time.Minute))
+
+	values, err := store.MGet("price:1", "price:2", "price:3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10", "", "30"}, values)
+
+	values, err = store.MGet()
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
+
+// TestMemoryStore_Shed tests that expired entries and a share of the cached ones are removed,
+// keeping counters.
+func TestMemoryStore_Shed(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Set("stale", "1", time.Second))
+	now = now.Add(2 * time.Second)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, store.Set(key, "1", time.Minute))
+	}
+	_, err := store.Incr("counter")
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, store.Shed(0.5), "the stale entry and half of the 4 cached ones")
+	assert.Len(t, store.entries, 3)
+	value, _ := store.Get("counter")
+	assert.Equal(t, "1", value)
+
+	assert.Equal(t, 1, store.Shed(0.1), "at least one")
+	assert.Equal(t, 1, store.Shed(1))
+	assert.Equal(t, 0, store.Shed(1))
+	assert.Len(t, store.entries, 1)
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Commands of a pipeline (Command.Name).
+const (
+	CmdGet    = "GET"
+	CmdSet    = "SET"
+	CmdDel    = "DEL"
+	CmdIncr   = "INCR"
+	CmdExpire = "EXPIRE"
+)
+
+// Command is one command of a pipeline. Each behaves like the Store method of the same name.
+type Command struct {
+	Name  string        // CmdGet, CmdSet, CmdDel, CmdIncr or CmdExpire
+	Key   string        //
+	Value string        // Value of CmdSet
+	TTL   time.Duration // TTL of CmdSet (0: the default TTL) and CmdExpire
+}
+
+// Result is the reply to one command of a pipeline.
+type Result struct {
+	Value string // CmdGet: the value, "" on a cache miss
+	Int   int64  // CmdIncr: the new value
+	Err   error  // The command failed; the others still ran
+}
+
+// Pipeliner is implemented by stores that send several commands in one round trip: one Upstash
+// request, or one RESP pipeline. Commands run in order but not atomically; other clients'
+// commands may run in between.
+type Pipeliner interface {
+	Pipeline(commands []Command) ([]Result, error)
+}
+
+// Pipeline runs commands on store, in one round trip when the store is a Pipeliner (the Upstash
+// and Redis backends, and the wrappers around them) and one command at a time otherwise. The
+// error is for the whole pipeline (e.g. the request failed); each command's is in its Result.
+//
+// Example: results, err := Pipeline(store, Command{Name: CmdIncr, Key: "a"}, Command{Name: CmdIncr, Key: "b"})
+func Pipeline(store Store, commands ...Command) ([]Result, error) {
+	if pipeliner, ok := store.(Pipeliner); ok {
+		results, err := pipeliner.Pipeline(commands)
+		if err == nil && len(results) != len(commands) {
+			return nil, fmt.Errorf("pipeline returned %d results for %d commands", len(results), len(commands))
+		}
+		return results, err
+	}
+
+	results := make([]Result, len(commands))
+	for i, command := range commands {
+		results[i] = run(store, command)
+	}
+	return results, nil
+}
+
+// run runs one command with the Store method of the same name.
+func run(store Store, command Command) Result {
+	var result Result
+	switch command.Name {
+	case CmdGet:
+		result.Value, result.Err = store.Get(command.Key)
+	case CmdSet:
+		result.Err = store.Set(command.Key, command.Value, command.TTL)
+	case CmdDel:
+		result.Err = store.Del(command.Key)
+	case CmdIncr:
+		result.Int, result.Err = store.Incr(command.Key)
+	case CmdExpire:
+		result.Err = store.Expire(command.Key, command.TTL)
+	default:
+		result.Err = fmt.Errorf("unknown pipeline command %q", command.Name)
+	}
+	return result
+}
+
+// withKeys returns a copy of commands with each key replaced by key(key), for the wrappers that
+// rewrite keys (prefix, epoch).
+func withKeys(commands []Command, key func(string) string) []Command {
+	rewritten := make([]Command, len(commands))
+	for i, command := range commands {
+		command.Key = key(command.Key)
+		rewritten[i] = command
+	}
+	return rewritten
+}
+
+// args returns the Redis command line of a command, as the Upstash client sends it.
+func (c Command) args() ([]string, error) {
+	switch c.Name {
+	case CmdGet, CmdDel, CmdIncr:
+		return []string{c.Name, c.Key}, nil
+	case CmdSet:
+		ttl := c.TTL
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		return []string{"SET", c.Key, c.Value, "EX", strconv.Itoa(int(ttl.Seconds()))}, nil
+	case CmdExpire:
+		return []string{"PEXPIRE", c.Key, strconv.FormatInt(c.TTL.Milliseconds(), 10)}, nil
+	default:
+		return nil, fmt.Errorf("unknown pipeline command %q", c.Name)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPipeline_Sequential tests that stores without pipelines run the commands one at a time,
+// through the wrappers.
+func TestPipeline_Sequential(t *testing.T) {
+	backend := NewMemoryStore()
+	store := WithPrefix(backend, "app:")
+
+	results, err := Pipeline(store,
+		Command{Name: CmdSet, Key: "a", Value: "1", TTL: time.Minute},
+		Command{Name: CmdIncr, Key: "n"},
+		Command{Name: CmdIncr, Key: "n"},
+		Command{Name: CmdGet, Key: "a"},
+		Command{Name: CmdGet, Key: "missing"},
+		Command{Name: "FLUSHALL"},
+	)
+	require.NoError(t, err)
+	require.Len(t, results, 6)
+	assert.Equal(t, int64(2), results[2].Int)
+	assert.Equal(t, "1", results[3].Value)
+	assert.Equal(t, "", results[4].Value)
+	assert.Error(t, results[5].Err)
+
+	raw, _ := backend.Get("app:a")
+	assert.Equal(t, "1", raw)
+}
+
+// TestClient_Pipeline tests that the Upstash client sends every command in one request.
+func TestClient_Pipeline(t *testing.T) {
+	var requests int
+	var received [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/pipeline", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte(`[{"result":"45.67"},{"result":null},{"result":3},{"error":"WRONGTYPE"}]`))
+	}))
+	defer server.Close()
+
+	client := NewUpstashClient(server.URL, "token")
+	results, err := Pipeline(client,
+		Command{Name: CmdGet, Key: "price:1"},
+		Command{Name: CmdGet, Key: "price:2"},
+		Command{Name: CmdIncr, Key: "n"},
+		Command{Name: CmdExpire, Key: "n", TTL: 2 * time.Second},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, [][]string{{"GET", "price:1"}, {"GET", "price:2"}, {"INCR", "n"}, {"PEXPIRE", "n", "2000"}}, received)
+
+	assert.Equal(t, "45.67", results[0].Value)
+	assert.Equal(t, "", results[1].Value)
+	assert.Equal(t, int64(3), results[2].Int)
+	assert.ErrorContains(t, results[3].Err, "WRONGTYPE")
+}
+
+// TestPipeline_Compressed tests that compressed values are decompressed in pipelines.
+func TestPipeline_Compressed(t *testing.T) {
+	backend := NewMemoryStore()
+	store := WithCompression(backend, CompressionGzip, 0)
+	value := strings.Repeat("a value long enough to compress ", 20)
+
+	results, err := Pipeline(store,
+		Command{Name: CmdSet, Key: "k", Value: value},
+		Command{Name: CmdGet, Key: "k"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, value, results[1].Value)
+
+	raw, _ := backend.Get("k")
+	assert.Less(t, len(raw), len(value))
+}
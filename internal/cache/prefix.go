@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"time"
+)
+
+// prefixedStore prepends a fixed prefix to every key before delegating to the wrapped store.
+type prefixedStore struct {
+	store  Store
+	prefix string
+}
+
+// WithPrefix returns a Store that namespaces every key with prefix (e.g. "tenant:acme:").
+// An empty prefix returns store unchanged.
+func WithPrefix(store Store, prefix string) Store {
+	if prefix == "" || store == nil {
+		return store
+	}
+	return &prefixedStore{store: store, prefix: prefix}
+}
+
+// Get retrieves the prefixed key.
+func (p *prefixedStore) Get(key string) (string, error) {
+	return p.store.Get(p.prefix + key)
+}
+
+// Set stores the prefixed key.
+func (p *prefixedStore) Set(key, value string, ttl time.Duration) error {
+	return p.store.Set(p.prefix+key, value, ttl)
+}
+
+// Del removes the prefixed key.
+func (p *prefixedStore) Del(key string) error {
+	return p.store.Del(p.prefix + key)
+}
+
+// Incr increments the prefixed key.
+func (p *prefixedStore) Incr(key string) (int64, error) {
+	return p.store.Incr(p.prefix + key)
+}
+
+// Expire sets the TTL of the prefixed key.
+func (p *prefixedStore) Expire(key string, ttl time.Duration) error {
+	return p.store.Expire(p.prefix+key, ttl)
+}
+
+// MGet retrieves the prefixed keys.
+func (p *prefixedStore) MGet(keys ...string) ([]string, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = p.prefix + key
+	}
+	return p.store.MGet(prefixed...)
+}
+
+// Pipeline runs the commands on the prefixed keys.
+func (p *prefixedStore) Pipeline(commands []Command) ([]Result, error) {
+	return Pipeline(p.store, withKeys(commands, func(key string) string { return p.prefix + key })...)
+}
@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Queue holds members (e.g. serialized jobs) in Redis sorted sets, ordered by the time each is
+// due. Backends shared between replicas (Redis, Upstash) implement it; the in-memory store does
+// too, for tests and single-instance setups.
+//
+// Like lock keys, queue keys are used as-is: not prefixed with the cache epoch (bumping it must
+// not drop queued work) and never compressed.
+type Queue interface {
+	// Schedule adds member to the queue at key, due at due. Scheduling a queued member moves it.
+	Schedule(key, member string, due time.Time) error
+
+	// Claim atomically moves up to n members of from that are due at now to to, due there at
+	// until, and returns them in due order. Two callers never claim the same member.
+	Claim(from, to string, now, until time.Time, n int) ([]string, error)
+
+	// Unschedule removes member from the queue at key and reports whether it was there.
+	Unschedule(key, member string) (bool, error)
+
+	// Scheduled returns the first n members of the queue at key, in due order.
+	Scheduled(key string, n int) ([]string, error)
+
+	// QueueLen returns the number of members in the queue at key.
+	QueueLen(key string) (int64, error)
+}
+
+// DefaultQueue is the queue backend of the default cache store, nil when the store is not shared
+// (or not initialized). Set by Init and SetDefault.
+var DefaultQueue Queue
+
+// GetQueue returns the default queue backend, or nil if there is none.
+func GetQueue() Queue {
+	return DefaultQueue
+}
+
+// claimScript moves the due members of KEYS[1] to KEYS[2] (ARGV: now and until in milliseconds,
+// and the maximum count) and returns them.
+const claimScript = `local members = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, member in ipairs(members) do
+	redis.call("ZREM", KEYS[1], member)
+	redis.call("ZADD", KEYS[2], ARGV[2], member)
+end
+return members`
+
+// Schedule adds member with ZADD, scored by its due time in milliseconds.
+func (r *RedisClient) Schedule(key, member string, due time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	if err := r.client.ZAdd(ctx, key, redis.Z{Score: float64(due.UnixMilli()), Member: member}).Err(); err != nil {
+		return fmt.Errorf("redis ZADD %s failed: %w", key, err)
+	}
+	return nil
+}
+
+// Claim moves the due members with a Lua script, so no other caller claims them too.
+func (r *RedisClient) Claim(from, to string, now, until time.Time, n int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	members, err := r.client.Eval(ctx, claimScript, []string{from, to}, now.UnixMilli(), until.UnixMilli(), n).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("redis claim %s failed: %w", from, err)
+	}
+	return members, nil
+}
+
+// Unschedule removes member with ZREM.
+func (r *RedisClient) Unschedule(key, member string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	removed, err := r.client.ZRem(ctx, key, member).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis ZREM %s failed: %w", key, err)
+	}
+	return removed == 1, nil
+}
+
+// Scheduled returns the first members with ZRANGE.
+func (r *RedisClient) Scheduled(key string, n int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	members, err := r.client.ZRange(ctx, key, 0, int64(n)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis ZRANGE %s failed: %w", key, err)
+	}
+	return members, nil
+}
+
+// QueueLen returns the size of the queue with ZCARD.
+func (r *RedisClient) QueueLen(key string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	count, err := r.client.ZCard(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis ZCARD %s failed: %w", key, err)
+	}
+	return count, nil
+}
+
+// Schedule adds member with ZADD, scored by its due time in milliseconds.
+func (c *Client) Schedule(key, member string, due time.Time) error {
+	if _, err := c.executeCommand([]string{"ZADD", key, strconv.FormatInt(due.UnixMilli(), 10), member}); err != nil {
+		return fmt.Errorf("redis ZADD %s failed: %w", key, err)
+	}
+	return nil
+}
+
+// Claim moves the due members with a Lua script, so no other caller claims them too.
+func (c *Client) Claim(from, to string, now, until time.Time, n int) ([]string, error) {
+	command := []string{"EVAL", claimScript, "2", from, to,
+		strconv.FormatInt(now.UnixMilli(), 10), strconv.FormatInt(until.UnixMilli(), 10), strconv.Itoa(n)}
+	resp, err := c.executeCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("redis claim %s failed: %w", from, err)
+	}
+	return resp.Strings()
+}
+
+// Unschedule removes member with ZREM.
+func (c *Client) Unschedule(key, member string) (bool, error) {
+	resp, err := c.executeCommand([]string{"ZREM", key, member})
+	if err != nil {
+		return false, fmt.Errorf("redis ZREM %s failed: %w", key, err)
+	}
+	removed, err := resp.Int()
+	return removed == 1, err
+}
+
+// Scheduled returns the first members with ZRANGE.
+func (c *Client) Scheduled(key string, n int) ([]string, error) {
+	resp, err := c.executeCommand([]string{"ZRANGE", key, "0", strconv.Itoa(n - 1)})
+	if err != nil {
+		return nil, fmt.Errorf("redis ZRANGE %s failed: %w", key, err)
+	}
+	return resp.Strings()
+}
+
+// QueueLen returns the size of the queue with ZCARD.
+func (c *Client) QueueLen(key string) (int64, error) {
+	resp, err := c.executeCommand([]string{"ZCARD", key})
+	if err != nil {
+		return 0, fmt.Errorf("redis ZCARD %s failed: %w", key, err)
+	}
+	return resp.Int()
+}
+
+// Schedule adds or moves member.
+func (m *MemoryStore) Schedule(key, member string, due time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.queues[key] == nil {
+		m.queues[key] = make(map[string]time.Time)
+	}
+	m.queues[key][member] = due
+	return nil
+}
+
+// Claim moves the due members.
+func (m *MemoryStore) Claim(from, to string, now, until time.Time, n int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var members []string
+	for _, member := range m.sortedLocked(from) {
+		if len(members) == n || m.queues[from][member].After(now) {
+			break
+		}
+		members = append(members, member)
+	}
+	if len(members) > 0 && m.queues[to] == nil {
+		m.queues[to] = make(map[string]time.Time)
+	}
+	for _, member := range members {
+		delete(m.queues[from], member)
+		m.queues[to][member] = until
+	}
+	return members, nil
+}
+
+// Unschedule removes member.
+func (m *MemoryStore) Unschedule(key, member string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.queues[key][member]
+	delete(m.queues[key], member)
+	return exists, nil
+}
+
+// Scheduled returns the first members.
+func (m *MemoryStore) Scheduled(key string, n int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := m.sortedLocked(key)
+	return members[:min(n, len(members))], nil
+}
+
+// QueueLen returns the size of the queue.
+func (m *MemoryStore) QueueLen(key string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.queues[key])), nil
+}
+
+// sortedLocked returns the members of the queue at key in due order, then member order like
+// Redis. Callers hold m.mu.
+func (m *MemoryStore) sortedLocked(key string) []string {
+	queue := m.queues[key]
+	members := make([]string, 0, len(queue))
+	for member := range queue {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if due, other := queue[members[i]], queue[members[j]]; !due.Equal(other) {
+			return due.Before(other)
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// Compile-time checks that every shared backend satisfies Queue.
+var (
+	_ Queue = (*Client)(nil)
+	_ Queue = (*RedisClient)(nil)
+	_ Queue = (*MemoryStore)(nil)
+)
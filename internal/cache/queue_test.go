@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryStore_Queue tests that members are claimed in due order, once, and only when due.
+func TestMemoryStore_Queue(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+
+	require.NoError(t, store.Schedule("queue", "later", now.Add(time.Minute)))
+	require.NoError(t, store.Schedule("queue", "second", now.Add(-time.Second)))
+	require.NoError(t, store.Schedule("queue", "first", now.Add(-time.Minute)))
+	scheduled, err := store.Scheduled("queue", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "later"}, scheduled)
+
+	claimed, err := store.Claim("queue", "running", now, now.Add(time.Hour), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, claimed)
+	claimed, _ = store.Claim("queue", "running", now, now.Add(time.Hour), 10)
+	assert.Equal(t, []string{"second"}, claimed, "later isn't due")
+	claimed, _ = store.Claim("queue", "running", now, now.Add(time.Hour), 10)
+	assert.Empty(t, claimed)
+
+	count, _ := store.QueueLen("running")
+	assert.Equal(t, int64(2), count)
+	removed, _ := store.Unschedule("running", "first")
+	assert.True(t, removed)
+	removed, _ = store.Unschedule("running", "first")
+	assert.False(t, removed)
+
+	// Claims from running back to queue once the lease ends
+	claimed, _ = store.Claim("running", "queue", now.Add(2*time.Hour), now.Add(2*time.Hour), 10)
+	assert.Equal(t, []string{"second"}, claimed)
+}
+
+// TestClient_QueueCommands tests the commands the Upstash client sends for queues.
+func TestClient_QueueCommands(t *testing.T) {
+	var commands [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req upstashRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		commands = append(commands, req.Command)
+		if req.Command[0] == "EVAL" {
+			w.Write([]byte(`{"result": ["job-1"]}`))
+			return
+		}
+		w.Write([]byte(`{"result": 1}`))
+	}))
+	defer server.Close()
+
+	client := NewUpstashClient(server.URL, "token")
+	due := time.UnixMilli(1_700_000_000_000)
+	require.NoError(t, client.Schedule("jobs:queued", "job-1", due))
+	claimed, err := client.Claim("jobs:queued", "jobs:running", due, due.Add(time.Minute), 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job-1"}, claimed)
+
+	require.Len(t, commands, 2)
+	assert.Equal(t, []string{"ZADD", "jobs:queued", "1700000000000", "job-1"}, commands[0])
+	assert.Equal(t, []string{"EVAL", claimScript, "2", "jobs:queued", "jobs:running", "1700000000000", "1700000060000", "5"}, commands[1])
+}
@@ -1,6 +1,6 @@
 package cache
 
-// Package cache provides a simple Redis client for caching data using Upstash.
+// This file is the Upstash backend of the cache package (CACHE_BACKEND=upstash).
 // Upstash is a serverless Redis service that uses a REST API instead of the traditional Redis protocol.
 
 import (
@@ -8,10 +8,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"boilerplate/internal/egress"
 )
 
 // Client represents a Redis cache client that connects to Upstash via REST API.
@@ -21,43 +23,15 @@ type Client struct {
 	client *http.Client
 }
 
-var (
-	// DefaultClient is the singleton Redis client instance used throughout the application.
-	DefaultClient *Client
-	
-	// defaultTTL is the default time-to-live for cached values (5 minutes).
-	defaultTTL = 5 * time.Minute
-)
-
-// Init initializes the default Redis client using environment variables.
-// Required: UPSTASH_REDIS_URL
-// Optional: UPSTASH_REDIS_TOKEN
-func Init() error {
-	url := os.Getenv("UPSTASH_REDIS_URL")
-	if url == "" {
-		return fmt.Errorf("UPSTASH_REDIS_URL environment variable is not set")
-	}
-
-	token := os.Getenv("UPSTASH_REDIS_TOKEN")
-	if token == "" {
-		log.Println("WARNING: UPSTASH_REDIS_TOKEN not set, requests may fail")
-	}
-
+// NewUpstashClient creates a cache client for the Upstash REST API.
+// The token is optional but most Upstash databases require it.
+func NewUpstashClient(url, token string) *Client {
 	// Create the client with a 10-second timeout for HTTP requests
-	DefaultClient = &Client{
+	return &Client{
 		url:    url,
 		token:  token,
-		client: &http.Client{Timeout: 10 * time.Second},
+		client: egress.NewClient(10 * time.Second),
 	}
-
-	log.Println("Redis cache client initialized")
-	return nil
-}
-
-// GetClient returns the default Redis client instance.
-// Returns nil if Init() has not been called yet.
-func GetClient() *Client {
-	return DefaultClient
 }
 
 // upstashRequest represents a request to Upstash REST API.
@@ -66,30 +40,80 @@ type upstashRequest struct {
 	Command []string `json:"command"` // Redis command as array, e.g., ["SET", "key", "value", "EX", "300"]
 }
 
-// upstashResponse represents a response from Upstash REST API.
-type upstashResponse struct {
-	Result string `json:"result"`        // The result value (for GET commands)
-	Error  string `json:"error,omitempty"` // Error message if the command failed
-}
-
 // executeCommand sends a Redis command to Upstash and returns the response.
-// This is a helper function that handles all the common HTTP request logic.
 func (c *Client) executeCommand(command []string) (*upstashResponse, error) {
 	if c == nil {
 		return nil, fmt.Errorf("Redis client not initialized")
 	}
 
-	// Step 1: Create the request body with the Redis command
-	reqBody := upstashRequest{Command: command}
-	jsonData, err := json.Marshal(reqBody)
+	// Step 1: Send the command and parse the response
+	var upstashResp upstashResponse
+	if err := c.post(c.url, upstashRequest{Command: command}, &upstashResp); err != nil {
+		return nil, err
+	}
+
+	// Step 2: Check for errors in the response
+	if upstashResp.Error != "" {
+		return nil, fmt.Errorf("Upstash error: %s", upstashResp.Error)
+	}
+
+	return &upstashResp, nil
+}
+
+// Pipeline sends several commands in one request to Upstash's /pipeline endpoint, which replies
+// with one result (or error) per command.
+func (c *Client) Pipeline(commands []Command) ([]Result, error) {
+	if c == nil {
+		return nil, fmt.Errorf("Redis client not initialized")
+	}
+	if len(commands) == 0 {
+		return []Result{}, nil
+	}
+
+	lines := make([][]string, len(commands))
+	for i, command := range commands {
+		args, err := command.args()
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = args
+	}
+	var responses []upstashResponse
+	if err := c.post(strings.TrimSuffix(c.url, "/")+"/pipeline", lines, &responses); err != nil {
+		return nil, err
+	}
+	if len(responses) != len(commands) {
+		return nil, fmt.Errorf("Upstash pipeline returned %d results for %d commands", len(responses), len(commands))
+	}
+
+	results := make([]Result, len(commands))
+	for i, resp := range responses {
+		switch {
+		case resp.Error != "":
+			results[i].Err = fmt.Errorf("Upstash error: %s", resp.Error)
+		case commands[i].Name == CmdGet:
+			results[i].Value, results[i].Err = resp.String()
+		case commands[i].Name == CmdSet:
+			// "OK"
+		default:
+			results[i].Int, results[i].Err = resp.Int()
+		}
+	}
+	return results, nil
+}
+
+// post sends body as JSON to url and decodes the JSON response into out.
+func (c *Client) post(url string, body, out any) error {
+	// Step 1: Create the request body
+	jsonData, err := json.Marshal(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Step 2: Create HTTP POST request
-	req, err := http.NewRequest("POST", c.url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	// Step 3: Set headers
@@ -101,28 +125,21 @@ func (c *Client) executeCommand(command []string) (*upstashResponse, error) {
 	// Step 4: Send the request
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Upstash: %w", err)
+		return fmt.Errorf("failed to connect to Upstash: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Step 5: Check HTTP status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Upstash API error (status %d): %s", resp.StatusCode, string(body))
+		return fmt.Errorf("Upstash API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	// Step 6: Parse the JSON response
-	var upstashResp upstashResponse
-	if err := json.NewDecoder(resp.Body).Decode(&upstashResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
 	}
-
-	// Step 7: Check for errors in the response
-	if upstashResp.Error != "" {
-		return nil, fmt.Errorf("Upstash error: %s", upstashResp.Error)
-	}
-
-	return &upstashResp, nil
+	return nil
 }
 
 // Set stores a value in Redis with the given key and expiration time.
@@ -158,12 +175,79 @@ func (c *Client) Get(key string) (string, error) {
 
 	resp, err := c.executeCommand(command)
 	if err != nil {
-		// Check if it's a "key not found" error (this is normal for cache misses)
-		if err.Error() == "Upstash error: key not found" || err.Error() == "Upstash error: nil" {
-			return "", nil // Cache miss - return empty string, no error
-		}
-		return "", err // Real error
+		return "", err
+	}
+
+	// A missing key is a null result: cache miss - return empty string, no error
+	return resp.String()
+}
+
+// Del removes a key from Redis. Deleting a missing key is not an error.
+//
+// Example: err := Del("price:123")
+func (c *Client) Del(key string) error {
+	// Build Redis command: DEL key (replies with the number of keys removed, 0 if it didn't exist)
+	command := []string{"DEL", key}
+
+	resp, err := c.executeCommand(command)
+	if err != nil {
+		return err
+	}
+	_, err = resp.Int()
+	return err
+}
+
+// Incr increments the integer stored under key and returns the new value.
+//
+// Example: count, err := Incr("ratelimit:user-1")
+func (c *Client) Incr(key string) (int64, error) {
+	// Build Redis command: INCR key (replies with the new value)
+	command := []string{"INCR", key}
+
+	resp, err := c.executeCommand(command)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Int()
+}
+
+// Expire sets the TTL of key. Expiring a missing key is not an error.
+//
+// Example: err := Expire("ratelimit:user-1", time.Minute)
+func (c *Client) Expire(key string, ttl time.Duration) error {
+	// Build Redis command: PEXPIRE key milliseconds (replies 1 if the key exists, 0 otherwise)
+	command := []string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)}
+
+	resp, err := c.executeCommand(command)
+	if err != nil {
+		return err
+	}
+	_, err = resp.Int()
+	return err
+}
+
+// MGet retrieves several values in one request, with an empty string for each missing key.
+//
+// Example: values, err := MGet("price:123", "price:456")
+func (c *Client) MGet(keys ...string) ([]string, error) {
+	// MGET without keys is a Redis error
+	if len(keys) == 0 {
+		return []string{}, nil
 	}
 
-	return resp.Result, nil
+	// Build Redis command: MGET key [key ...] (replies with an array, null for missing keys)
+	command := append([]string{"MGET"}, keys...)
+
+	resp, err := c.executeCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	values, err := resp.Strings()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(keys) {
+		return nil, fmt.Errorf("Upstash MGET returned %d values for %d keys", len(values), len(keys))
+	}
+	return values, nil
 }
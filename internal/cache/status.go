@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"time"
+
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/status"
+)
+
+// statusStore reports the health of the wrapped store to the dependency registry:
+// a failed command marks the cache down, a successful one marks it up again. It also counts
+// reads as hits or misses (cache_lookups_total).
+type statusStore struct {
+	store Store
+}
+
+// WithStatus returns a Store that reports every call's outcome to the status registry.
+func WithStatus(store Store) Store {
+	if store == nil {
+		return nil
+	}
+	return &statusStore{store: store}
+}
+
+// Get retrieves a value and reports the outcome.
+func (s *statusStore) Get(key string) (string, error) {
+	value, err := s.store.Get(key)
+	report(err)
+	if err == nil {
+		metrics.RecordCacheLookup(value)
+	}
+	return value, err
+}
+
+// Set stores a value and reports the outcome.
+func (s *statusStore) Set(key, value string, ttl time.Duration) error {
+	err := s.store.Set(key, value, ttl)
+	report(err)
+	return err
+}
+
+// Del removes a key and reports the outcome.
+func (s *statusStore) Del(key string) error {
+	err := s.store.Del(key)
+	report(err)
+	return err
+}
+
+// Incr increments a counter and reports the outcome.
+func (s *statusStore) Incr(key string) (int64, error) {
+	value, err := s.store.Incr(key)
+	report(err)
+	return value, err
+}
+
+// Expire sets a TTL and reports the outcome.
+func (s *statusStore) Expire(key string, ttl time.Duration) error {
+	err := s.store.Expire(key, ttl)
+	report(err)
+	return err
+}
+
+// MGet retrieves several values and reports the outcome.
+func (s *statusStore) MGet(keys ...string) ([]string, error) {
+	values, err := s.store.MGet(keys...)
+	report(err)
+	for _, value := range values {
+		metrics.RecordCacheLookup(value)
+	}
+	return values, err
+}
+
+// Pipeline runs several commands and reports the outcome: the pipeline's error, or else the
+// first command's.
+func (s *statusStore) Pipeline(commands []Command) ([]Result, error) {
+	results, err := Pipeline(s.store, commands...)
+	outcome := err
+	for i, result := range results {
+		if outcome == nil {
+			outcome = result.Err
+		}
+		if commands[i].Name == CmdGet && result.Err == nil {
+			metrics.RecordCacheLookup(result.Value)
+		}
+	}
+	report(outcome)
+	return results, err
+}
+
+// report updates the cache's entry in the status registry.
+func report(err error) {
+	if err != nil {
+		status.SetDown(status.Cache, err)
+		return
+	}
+	status.SetUp(status.Cache)
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/memory"
+	"boilerplate/internal/startup"
+)
+
+// Store is the interface every cache backend implements.
+// Handlers and the realtime subscriber depend on this interface instead of a concrete client,
+// so the Upstash REST client, a native Redis client and the in-memory store are interchangeable
+// (see CACHE_BACKEND).
+type Store interface {
+	// Get returns the value for key, or an empty string and nil error on a cache miss.
+	Get(key string) (string, error)
+
+	// Set stores value under key. A ttl of 0 means "use the default TTL".
+	Set(key, value string, ttl time.Duration) error
+
+	// Del removes key. Deleting a missing key is not an error.
+	Del(key string) error
+
+	// Incr atomically increments the integer stored under key and returns the new value.
+	// A missing key counts as 0 and is created without a TTL (see Expire); a value that is not
+	// an integer is an error. Like Redis, Incr keeps the key's TTL.
+	Incr(key string) (int64, error)
+
+	// Expire sets the TTL of key. Expiring a missing key is not an error.
+	Expire(key string, ttl time.Duration) error
+
+	// MGet returns the values of keys in order, with an empty string for each cache miss.
+	MGet(keys ...string) ([]string, error)
+}
+
+// startupName is the cache's entry in the startup summary.
+const startupName = "cache"
+
+var (
+	// DefaultClient is the singleton cache store used throughout the application.
+	// It is nil until Init() or SetDefault() is called.
+	DefaultClient Store
+
+	// defaultTTL is the default time-to-live for cached values (5 minutes).
+	defaultTTL = 5 * time.Minute
+)
+
+// Init initializes the default cache store from cfg (see config.Cache).
+//
+// Backend selection (CACHE_BACKEND, see config.Cache.ResolvedBackend):
+//   - redis: native Redis client via go-redis (REDIS_URL, e.g. redis://localhost:6379/0)
+//   - upstash: Upstash REST client (UPSTASH_REDIS_URL, UPSTASH_REDIS_TOKEN optional)
+//   - memory: in-process store, for local development and single-instance deployments
+//   - unset: redis if REDIS_URL is set, upstash if UPSTASH_REDIS_URL is, no cache otherwise
+//
+// Large values are compressed when CACHE_COMPRESSION is gzip or snappy (see compress.go), and
+// every key carries the cache epoch (see epoch.go).
+func Init(cfg config.Cache) error {
+	algorithm, threshold, refresh := cfg.Compression, cfg.CompressionThreshold, cfg.EpochRefresh
+
+	// Step 1: Create the backend
+	var backend interface {
+		Store
+		Locker
+		Queue
+	}
+	var detail string
+	switch cfg.ResolvedBackend() {
+	case config.CacheRedis:
+		client, err := NewRedisClient(cfg.RedisURL)
+		if err != nil {
+			startup.Report(startupName, false, err.Error())
+			return err
+		}
+		backend, detail = client, "native Redis"
+	case config.CacheUpstash:
+		if cfg.UpstashToken == "" {
+			slog.Warn("UPSTASH_REDIS_TOKEN not set, requests may fail")
+		}
+		backend, detail = NewUpstashClient(cfg.UpstashURL, cfg.UpstashToken), "Upstash REST"
+	case config.CacheMemory:
+		slog.Warn("Using the in-memory cache; cached data is not shared between instances")
+		store := NewMemoryStore()
+		memory.RegisterShedder("cache", store.Shed) // Near the memory limit, drop cached entries
+		backend, detail = store, "in-memory (not shared between instances)"
+	default:
+		startup.Report(startupName, false, "CACHE_BACKEND, REDIS_URL and UPSTASH_REDIS_URL not set")
+		return fmt.Errorf("no cache backend configured (set CACHE_BACKEND, REDIS_URL or UPSTASH_REDIS_URL)")
+	}
+
+	// Step 2: Wrap it with compression and the epoch. Failed commands mark the cache as down
+	// in the dependency registry (see internal/status)
+	DefaultEpoch = WithEpoch(WithCompression(backend, algorithm, threshold), refresh)
+	DefaultClient = WithStatus(DefaultEpoch)
+	DefaultLocker = backend
+	DefaultQueue = backend
+
+	slog.Info("Cache initialized", "backend", detail, "compression", algorithm)
+	startup.Report(startupName, true, detail+", compression: "+algorithm)
+	return nil
+}
+
+// SetDefault replaces the default cache store, and the default locker and queue if the store is
+// one.
+// Passing nil disables caching. Mainly useful in tests, e.g. SetDefault(NewMemoryStore()).
+func SetDefault(store Store) {
+	DefaultClient = store
+	DefaultLocker, _ = store.(Locker)
+	DefaultQueue, _ = store.(Queue)
+}
+
+// GetClient returns the default cache store.
+// Returns nil if Init() has not been called yet (or caching is disabled).
+func GetClient() Store {
+	return DefaultClient
+}
+
+// Compile-time checks that every backend satisfies Store.
+var (
+	_ Store = (*Client)(nil)
+	_ Store = (*RedisClient)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*EpochStore)(nil)
+)
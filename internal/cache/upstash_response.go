@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// upstashResponse represents a response from Upstash REST API.
+// The result is kept raw and decoded by the accessor matching the command's reply type:
+// bulk and simple strings (GET, SET) are JSON strings, integer replies (INCR, DEL, EXISTS) are
+// JSON numbers, missing keys are null and multi-bulk replies (MGET, KEYS) are arrays.
+type upstashResponse struct {
+	Result json.RawMessage `json:"result"`          // The raw result value
+	Error  string          `json:"error,omitempty"` // Error message if the command failed
+}
+
+// IsNil reports whether the result is null (e.g. GET on a missing key).
+func (r *upstashResponse) IsNil() bool {
+	return len(r.Result) == 0 || bytes.Equal(r.Result, []byte("null"))
+}
+
+// String returns a string result. A null result is an empty string.
+func (r *upstashResponse) String() (string, error) {
+	if r.IsNil() {
+		return "", nil
+	}
+	var value string
+	if err := json.Unmarshal(r.Result, &value); err != nil {
+		return "", fmt.Errorf("unexpected Upstash result %s: want a string", r.Result)
+	}
+	return value, nil
+}
+
+// Int returns an integer result. Numeric strings are accepted too, as Lua scripts and some
+// commands (INCRBYFLOAT aside) may return numbers as strings. A null result is 0.
+func (r *upstashResponse) Int() (int64, error) {
+	if r.IsNil() {
+		return 0, nil
+	}
+	var value int64
+	if err := json.Unmarshal(r.Result, &value); err == nil {
+		return value, nil
+	}
+	var text string
+	if err := json.Unmarshal(r.Result, &text); err == nil {
+		if parsed, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return parsed, nil
+		}
+	}
+	return 0, fmt.Errorf("unexpected Upstash result %s: want an integer", r.Result)
+}
+
+// Strings returns an array result. Null elements (e.g. missing keys in MGET) are empty strings;
+// a null result is an empty slice.
+func (r *upstashResponse) Strings() ([]string, error) {
+	if r.IsNil() {
+		return []string{}, nil
+	}
+	var items []*string
+	if err := json.Unmarshal(r.Result, &items); err != nil {
+		return nil, fmt.Errorf("unexpected Upstash result %s: want an array of strings", r.Result)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		if item != nil {
+			values[i] = *item
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeResponse decodes an Upstash response body like executeCommand does.
+func decodeResponse(t *testing.T, body string) *upstashResponse {
+	t.Helper()
+	var resp upstashResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	return &resp
+}
+
+// TestUpstashResponse_Accessors tests decoding of every reply type.
+func TestUpstashResponse_Accessors(t *testing.T) {
+	// String replies (GET, SET)
+	value, err := decodeResponse(t, `{"result": "45.67"}`).String()
+	require.NoError(t, err)
+	assert.Equal(t, "45.67", value)
+
+	// Integer replies (INCR, DEL, EXISTS), also as numeric strings from Lua scripts
+	n, err := decodeResponse(t, `{"result": 42}`).Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	n, err = decodeResponse(t, `{"result": "7"}`).Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+
+	// Null replies (GET on a missing key)
+	resp := decodeResponse(t, `{"result": null}`)
+	assert.True(t, resp.IsNil())
+	value, err = resp.String()
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+	n, err = resp.Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// Array replies (MGET), with null elements for missing keys
+	values, err := decodeResponse(t, `{"result": ["1.5", null, "2"]}`).Strings()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.5", "", "2"}, values)
+
+	// Wrong types are errors, not silent zero values
+	_, err = decodeResponse(t, `{"result": 1}`).String()
+	assert.Error(t, err)
+	_, err = decodeResponse(t, `{"result": "abc"}`).Int()
+	assert.Error(t, err)
+	_, err = decodeResponse(t, `{"result": "abc"}`).Strings()
+	assert.Error(t, err)
+}
+
+// TestClient_GetAndDel tests the Upstash client against the reply types Upstash sends.
+func TestClient_GetAndDel(t *testing.T) {
+	replies := map[string]string{
+		"GET price:1":     `{"result": "45.67"}`,
+		"GET price:2":     `{"result": null}`,
+		"DEL price:1":     `{"result": 1}`,
+		"DEL price:2":     `{"result": 0}`,
+		"GET price:error": `{"error": "WRONGTYPE Operation against a key holding the wrong kind of value"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req upstashRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Write([]byte(replies[req.Command[0]+" "+req.Command[1]]))
+	}))
+	defer server.Close()
+	client := NewUpstashClient(server.URL, "token")
+
+	value, err := client.Get("price:1")
+	require.NoError(t, err)
+	assert.Equal(t, "45.67", value)
+
+	value, err = client.Get("price:2")
+	require.NoError(t, err)
+	assert.Equal(t, "", value, "missing key is a cache miss")
+
+	assert.NoError(t, client.Del("price:1"))
+	assert.NoError(t, client.Del("price:2"), "deleting a missing key is not an error")
+
+	_, err = client.Get("price:error")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+}
@@ -0,0 +1,406 @@
+package capture
+
+// Package capture is a small "HTTP flight recorder": it records full request/response pairs
+// (headers and bodies, redacted) for a sample of requests, or for requests carrying the debug
+// header, and keeps them in the cache for a while so admins can inspect them through
+// GET /api/admin/captures.
+//
+// Capturing is off until CAPTURE_SAMPLE_RATE or CAPTURE_DEBUG_TOKEN is set.
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/ssr"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Capture reasons.
+const (
+	ReasonSample      = "sample"
+	ReasonDebugHeader = "debug_header"
+)
+
+const (
+	// indexKey holds the IDs of recent captures, newest first.
+	indexKey = "capture:index"
+
+	// idHeader is set on captured responses so the caller can look the capture up.
+	idHeader = "X-Capture-Id"
+
+	// Defaults for the environment settings.
+	defaultDebugHeader = "X-Debug-Capture"
+	defaultTTL         = time.Hour
+	defaultMaxBody     = 64 * 1024
+	defaultMaxEntries  = 500
+)
+
+// sensitiveHeaders are always replaced with the redaction mask (lowercase names).
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"apikey":              true,
+	"x-api-key":           true,
+
+	"sec-websocket-protocol": true, // May carry an access token (see handlers.TokenSubprotocolPrefix)
+}
+
+// Capture is one recorded request/response pair.
+type Capture struct {
+	ID              string            `json:"id"`
+	Reason          string            `json:"reason"`
+	Time            time.Time         `json:"time"`
+	DurationMs      float64           `json:"duration_ms"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	Status          int               `json:"status"`
+	UserID          string            `json:"user_id,omitempty"`
+	Tenant          string            `json:"tenant,omitempty"`
+	IP              string            `json:"ip"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Truncated       bool              `json:"truncated,omitempty"` // A body was longer than CAPTURE_MAX_BODY, or streamed
+}
+
+// Summary is the list view of a capture.
+type Summary struct {
+	ID         string    `json:"id"`
+	Reason     string    `json:"reason"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// ErrNotFound is returned for unknown or expired captures.
+var ErrNotFound = errors.New("capture not found")
+
+// config holds the capture settings read from the environment.
+type config struct {
+	sampleRate  float64
+	debugHeader string
+	ssrHeader   string // Carries SSR_TOKEN
+	debugToken  string
+	ttl         time.Duration
+	maxBody     int
+	maxEntries  int
+}
+
+// loadConfig reads the CAPTURE_* environment variables.
+func loadConfig() config {
+	cfg := config{
+		debugHeader: os.Getenv("CAPTURE_DEBUG_HEADER"),
+		ssrHeader:   ssr.Header(),
+		debugToken:  os.Getenv("CAPTURE_DEBUG_TOKEN"),
+		ttl:         defaultTTL,
+		maxBody:     defaultMaxBody,
+		maxEntries:  defaultMaxEntries,
+	}
+	if cfg.debugHeader == "" {
+		cfg.debugHeader = defaultDebugHeader
+	}
+
+	if raw := os.Getenv("CAPTURE_SAMPLE_RATE"); raw != "" {
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			log.Printf("WARNING: Invalid CAPTURE_SAMPLE_RATE %q (expected 0-1), sampling disabled", raw)
+		} else {
+			cfg.sampleRate = rate
+		}
+	}
+	if raw := os.Getenv("CAPTURE_TTL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			cfg.ttl = parsed
+		} else {
+			log.Printf("WARNING: Invalid CAPTURE_TTL %q, using %s", raw, defaultTTL)
+		}
+	}
+	if raw := os.Getenv("CAPTURE_MAX_BODY"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			cfg.maxBody = parsed
+		} else {
+			log.Printf("WARNING: Invalid CAPTURE_MAX_BODY %q, using %d", raw, defaultMaxBody)
+		}
+	}
+	if raw := os.Getenv("CAPTURE_MAX_ENTRIES"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			cfg.maxEntries = parsed
+		} else {
+			log.Printf("WARNING: Invalid CAPTURE_MAX_ENTRIES %q, using %d", raw, defaultMaxEntries)
+		}
+	}
+	return cfg
+}
+
+// Middleware records sampled requests and requests whose debug header (CAPTURE_DEBUG_HEADER,
+// default X-Debug-Capture) carries CAPTURE_DEBUG_TOKEN. Register it globally, after the logger.
+//
+// The debug header requires the token so clients can't make the server store arbitrary
+// amounts of data. Captured responses get an X-Capture-Id header. Captures are written to the
+// cache after the response is built; without a cache nothing is recorded.
+func Middleware() fiber.Handler {
+	cfg := loadConfig()
+	if cfg.sampleRate == 0 && cfg.debugToken == "" {
+		startup.Report("capture", false, "CAPTURE_SAMPLE_RATE and CAPTURE_DEBUG_TOKEN not set")
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+	log.Printf("Request capture enabled (sample rate %.4f, debug header %s)", cfg.sampleRate, cfg.debugHeader)
+	startup.Report("capture", true, fmt.Sprintf("sample rate %.4f, debug header %s", cfg.sampleRate, cfg.debugHeader))
+
+	return func(c *fiber.Ctx) error {
+		// Step 1: Decide whether to record this request (WebSocket upgrades have no useful body)
+		reason := ""
+		if cfg.debugToken != "" {
+			if value := c.Get(cfg.debugHeader); value != "" &&
+				subtle.ConstantTimeCompare([]byte(value), []byte(cfg.debugToken)) == 1 {
+				reason = ReasonDebugHeader
+			}
+		}
+		if reason == "" && cfg.sampleRate > 0 && mathrand.Float64() < cfg.sampleRate {
+			reason = ReasonSample
+		}
+		if reason == "" || strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") {
+			return c.Next()
+		}
+
+		store := cache.GetClient()
+		if store == nil {
+			return c.Next()
+		}
+
+		id, err := newID()
+		if err != nil {
+			log.Printf("WARNING: Skipping request capture: %v", err)
+			return c.Next()
+		}
+		c.Set(idHeader, id)
+
+		// Step 2: Run the rest of the chain (errors are turned into responses first, so the
+		// captured status and body match what the client receives)
+		start := time.Now()
+		if err := c.Next(); err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		// Step 3: Copy everything out of the context (it is reused after the handler returns)
+		capture := build(c, cfg, id, reason, start)
+
+		// Step 4: Store it in the background so capturing doesn't slow the response down
+		go save(store, cfg, capture)
+		return nil
+	}
+}
+
+// build assembles a redacted capture from the finished request. Its strings are copies: Fiber's
+// are views into the request's buffer, which is reused once the handler returns.
+func build(c *fiber.Ctx, cfg config, id, reason string, start time.Time) *Capture {
+	capture := &Capture{
+		ID:              id,
+		Reason:          reason,
+		Time:            start.UTC(),
+		DurationMs:      float64(time.Since(start).Microseconds()) / 1000,
+		Method:          strings.Clone(c.Method()),
+		Path:            strings.Clone(c.Path()),
+		Query:           redactQuery(string(c.Request().URI().QueryString())),
+		Status:          c.Response().StatusCode(),
+		Tenant:          strings.Clone(tenant.ID(c)),
+		IP:              strings.Clone(c.IP()),
+		RequestHeaders:  make(map[string]string),
+		ResponseHeaders: make(map[string]string),
+	}
+	capture.UserID, _ = c.Locals("user").(string)
+
+	tokenHeaders := []string{strings.ToLower(cfg.debugHeader), strings.ToLower(cfg.ssrHeader)}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		name := strings.ToLower(string(key))
+		capture.RequestHeaders[string(key)] = redactHeader(name, string(value), tokenHeaders)
+	})
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		name := strings.ToLower(string(key))
+		capture.ResponseHeaders[string(key)] = redactHeader(name, string(value), tokenHeaders)
+	})
+
+	var truncated bool
+	capture.RequestBody, truncated = truncate(c.Body(), cfg.maxBody)
+	capture.Truncated = truncated
+	if c.Response().IsBodyStream() {
+		// Reading a streamed body (see internal/stream) would buffer all of it
+		capture.Truncated = true
+	} else {
+		capture.ResponseBody, truncated = truncate(c.Response().Body(), cfg.maxBody)
+		capture.Truncated = capture.Truncated || truncated
+	}
+
+	capture.RequestBody = logging.Redact(capture.RequestBody)
+	capture.ResponseBody = logging.Redact(capture.ResponseBody)
+	return capture
+}
+
+// redactHeader masks credential headers and the headers carrying the debug and SSR tokens
+// (tokenHeaders, lowercase); other values go through the log redactor (which catches tokens in
+// any header).
+func redactHeader(name, value string, tokenHeaders []string) string {
+	if sensitiveHeaders[name] || slices.Contains(tokenHeaders, name) {
+		return logging.Mask
+	}
+	return logging.Redact(value)
+}
+
+// redactQuery masks secret query parameters. The redactor matches them after "?" or "&".
+func redactQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+	return strings.TrimPrefix(logging.Redact("?"+query), "?")
+}
+
+// truncate copies up to max bytes of body into a string.
+func truncate(body []byte, max int) (string, bool) {
+	if len(body) > max {
+		return string(body[:max]), true
+	}
+	return string(body), false
+}
+
+// indexMu serializes index updates from this instance. Instances sharing a cache can still
+// race and drop an entry from the index, which is acceptable for a debugging aid.
+var indexMu sync.Mutex
+
+// save stores the capture and adds it to the front of the index.
+func save(store cache.Store, cfg config, capture *Capture) {
+	encoded, err := json.Marshal(capture)
+	if err != nil {
+		log.Printf("WARNING: Failed to encode capture %s: %v", capture.ID, err)
+		return
+	}
+	if err := store.Set("capture:"+capture.ID, string(encoded), cfg.ttl); err != nil {
+		log.Printf("WARNING: Failed to store capture %s: %v", capture.ID, err)
+		return
+	}
+
+	summary := Summary{
+		ID:         capture.ID,
+		Reason:     capture.Reason,
+		Time:       capture.Time,
+		Method:     capture.Method,
+		Path:       capture.Path,
+		Status:     capture.Status,
+		DurationMs: capture.DurationMs,
+	}
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	index, err := readIndex(store)
+	if err != nil {
+		log.Printf("WARNING: Failed to read capture index, starting a new one: %v", err)
+	}
+	index = append([]Summary{summary}, index...)
+	if len(index) > cfg.maxEntries {
+		index = index[:cfg.maxEntries]
+	}
+
+	encoded, err = json.Marshal(index)
+	if err != nil {
+		log.Printf("WARNING: Failed to encode capture index: %v", err)
+		return
+	}
+	if err := store.Set(indexKey, string(encoded), cfg.ttl); err != nil {
+		log.Printf("WARNING: Failed to store capture index: %v", err)
+	}
+}
+
+// readIndex loads the capture index (newest first).
+func readIndex(store cache.Store) ([]Summary, error) {
+	raw, err := store.Get(indexKey)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+
+	var index []Summary
+	if err := json.Unmarshal([]byte(raw), &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// List returns summaries of the stored captures, newest first, dropping expired ones.
+func List() ([]Summary, error) {
+	store := cache.GetClient()
+	if store == nil {
+		return nil, fmt.Errorf("cache not configured")
+	}
+
+	index, err := readIndex(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture index: %w", err)
+	}
+
+	// Entries outlive their capture by up to one TTL; only list the ones that still exist
+	ttl := loadConfig().ttl
+	live := make([]Summary, 0, len(index))
+	for _, summary := range index {
+		if time.Since(summary.Time) <= ttl {
+			live = append(live, summary)
+		}
+	}
+	return live, nil
+}
+
+// Get returns a stored capture, or ErrNotFound.
+func Get(id string) (*Capture, error) {
+	store := cache.GetClient()
+	if store == nil {
+		return nil, fmt.Errorf("cache not configured")
+	}
+
+	raw, err := store.Get("capture:" + id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+	if raw == "" {
+		return nil, ErrNotFound
+	}
+
+	var capture Capture
+	if err := json.Unmarshal([]byte(raw), &capture); err != nil {
+		return nil, fmt.Errorf("failed to parse capture: %w", err)
+	}
+	return &capture, nil
+}
+
+// newID returns a random 64-bit hex ID.
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate capture ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
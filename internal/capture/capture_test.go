@@ -0,0 +1,130 @@
+package capture
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupApp builds an app with the capture middleware and an in-memory cache.
+func setupApp(t *testing.T, env map[string]string) *fiber.App {
+	t.Helper()
+
+	original := cache.GetClient()
+	cache.SetDefault(cache.NewMemoryStore())
+	t.Cleanup(func() { cache.SetDefault(original) })
+
+	for _, name := range []string{"CAPTURE_SAMPLE_RATE", "CAPTURE_DEBUG_TOKEN", "CAPTURE_DEBUG_HEADER", "CAPTURE_MAX_BODY", "SSR_HEADER"} {
+		t.Setenv(name, env[name])
+	}
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		c.Cookie(&fiber.Cookie{Name: "session", Value: "secret-session"})
+		return c.Status(fiber.StatusCreated).Send(c.Body())
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusTeapot, "nope")
+	})
+	return app
+}
+
+// waitForCapture polls until the capture is stored (saving happens in the background).
+func waitForCapture(t *testing.T, id string) *Capture {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		captured, err := Get(id)
+		if err == nil {
+			return captured
+		}
+		require.ErrorIs(t, err, ErrNotFound)
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("capture %s was not stored", id)
+	return nil
+}
+
+// TestMiddleware_DebugHeaderCapturesRedactedPair tests that the debug header records the full
+// pair with credentials masked, and that the capture is listed.
+func TestMiddleware_DebugHeaderCapturesRedactedPair(t *testing.T) {
+	app := setupApp(t, map[string]string{"CAPTURE_DEBUG_TOKEN": "debug-token-123"})
+
+	req := httptest.NewRequest("POST", "/echo?access_token=abcdefgh12345", strings.NewReader(`{"name":"test","password":"hunter2"}`))
+	req.Header.Set("Authorization", "Bearer some-token")
+	req.Header.Set("X-Debug-Capture", "debug-token-123")
+	req.Header.Set("X-SSR-Request", "ssr-token-123")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	id := resp.Header.Get("X-Capture-Id")
+	require.NotEmpty(t, id)
+
+	captured := waitForCapture(t, id)
+	assert.Equal(t, ReasonDebugHeader, captured.Reason)
+	assert.Equal(t, "POST", captured.Method)
+	assert.Equal(t, "/echo", captured.Path)
+	assert.Equal(t, fiber.StatusCreated, captured.Status)
+	assert.Equal(t, `{"name":"test","password":"[REDACTED]"}`, captured.RequestBody)
+	assert.Equal(t, `{"name":"test","password":"[REDACTED]"}`, captured.ResponseBody)
+	assert.Equal(t, logging.Mask, captured.RequestHeaders["Authorization"])
+	assert.Equal(t, logging.Mask, captured.RequestHeaders["X-Debug-Capture"])
+	assert.Equal(t, logging.Mask, captured.RequestHeaders["X-Ssr-Request"])
+	assert.Equal(t, logging.Mask, captured.ResponseHeaders["Set-Cookie"])
+	assert.NotContains(t, captured.Query, "abcdefgh12345")
+
+	summaries, err := List()
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, id, summaries[0].ID)
+}
+
+// TestMiddleware_OnlyWithValidToken tests that a wrong token or no configuration records nothing.
+func TestMiddleware_OnlyWithValidToken(t *testing.T) {
+	app := setupApp(t, map[string]string{"CAPTURE_DEBUG_TOKEN": "debug-token-123"})
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader("x"))
+	req.Header.Set("X-Debug-Capture", "guess")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("X-Capture-Id"))
+
+	app = setupApp(t, nil)
+	req = httptest.NewRequest("POST", "/echo", strings.NewReader("x"))
+	req.Header.Set("X-Debug-Capture", "debug-token-123")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("X-Capture-Id"))
+}
+
+// TestMiddleware_SampleRateAndErrors tests sampling, error responses and body truncation.
+func TestMiddleware_SampleRateAndErrors(t *testing.T) {
+	app := setupApp(t, map[string]string{"CAPTURE_SAMPLE_RATE": "1", "CAPTURE_MAX_BODY": "4"})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/fail", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusTeapot, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "nope", string(body))
+
+	captured := waitForCapture(t, resp.Header.Get("X-Capture-Id"))
+	assert.Equal(t, ReasonSample, captured.Reason)
+	assert.Equal(t, fiber.StatusTeapot, captured.Status)
+	assert.Equal(t, "nope", captured.ResponseBody)
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/echo", strings.NewReader("0123456789")))
+	require.NoError(t, err)
+	captured = waitForCapture(t, resp.Header.Get("X-Capture-Id"))
+	assert.Equal(t, "0123", captured.RequestBody)
+	assert.True(t, captured.Truncated)
+}
@@ -0,0 +1,1065 @@
+package config
+
+// Package config loads the core settings of the server (HTTP server, Supabase, auth, cache,
+// rate limits, Realtime, the WebSocket hub, outbound requests, the Supabase proxies, memory, the
+// database, the query cache, background jobs, resources, webhooks, push notifications, Edge
+// Functions and the runtime monitor) from the environment once at startup, into a typed Config
+// that is passed to app.NewApp, the Init functions of those packages and the middleware
+// constructors.
+//
+// Load applies the defaults, then validates everything at once: a missing required setting or a
+// value that doesn't parse is reported with every other problem, so a misconfigured deployment
+// fails on boot with one complete error instead of one warning at a time.
+//
+// Per-environment overrides: LoadFiles reads .env.<GO_ENV> before .env, so values in
+// .env.production win over .env, and real environment variables win over both. Some defaults
+// also depend on the environment (ALLOWED_ORIGINS falls back to localhost outside production).
+// ReloadFiles reads the files again, for the subsystems restarted through internal/lifecycle.
+//
+// Settings of the other optional subsystems (mail, GDPR, search, ...) are still read by their own
+// packages, next to the code that uses them.
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Environments (GO_ENV, or ENV).
+const (
+	Development = "development"
+	Production  = "production"
+)
+
+// devAllowedOrigins is the ALLOWED_ORIGINS fallback outside production.
+const devAllowedOrigins = "http://localhost:3000,http://localhost:8080,http://127.0.0.1:3000,http://127.0.0.1:8080"
+
+// Config is the server configuration.
+type Config struct {
+	Env  string // GO_ENV or ENV (default "development")
+	Port string // PORT (default "3000")
+
+	Server    Server
+	Supabase  Supabase
+	Auth      Auth
+	Session   Session
+	Cache     Cache
+	RateLimit RateLimit
+	Realtime  Realtime
+	Hub       Hub
+	Egress    Egress
+	Proxy     Proxy
+	Memory    Memory
+
+	Database   Database
+	QueryCache QueryCache
+	Jobs       Jobs
+	Resource   Resource
+	Webhook    Webhook
+	Push       Push
+	Functions  Functions
+	Monitor    Monitor
+
+	Middleware Middleware
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	AllowedOrigins    string   // ALLOWED_ORIGINS, comma-separated (required in production)
+	TrustedProxyCheck bool     // ENABLE_TRUSTED_PROXY_CHECK: read the client IP from X-Forwarded-For
+	TrustedProxies    []string // TRUSTED_PROXIES, IPs or CIDRs (required with TrustedProxyCheck)
+
+	// HTTP2 is how the server speaks HTTP/2 (HTTP2): off (default, HTTP/1.1 only), tls (HTTP/2
+	// and HTTP/1.1 over TLS, negotiated with ALPN) or h2c (cleartext HTTP/2 with prior knowledge
+	// and HTTP/1.1, for internal traffic from a load balancer or gRPC-style clients).
+	HTTP2       string
+	TLSCertFile string // TLS_CERT_FILE, PEM certificate chain (required with HTTP2=tls)
+	TLSKeyFile  string // TLS_KEY_FILE, PEM private key (required with HTTP2=tls)
+
+	// CORSMaxAge is how long browsers may cache a preflight's answer (CORS_MAX_AGE, default 2h,
+	// 0 to not cache). Chromium caps it at 2h and Firefox at 24h.
+	CORSMaxAge time.Duration
+
+	// DrainDelay is how long /readyz fails before shutdown starts on SIGTERM, so load balancers
+	// stop sending traffic first (SHUTDOWN_DRAIN_DELAY, default 5s, 0 to skip).
+	DrainDelay time.Duration
+}
+
+// HTTP2Enabled reports whether the server speaks HTTP/2 (HTTP2=tls or h2c).
+func (s Server) HTTP2Enabled() bool {
+	return s.HTTP2 == HTTP2TLS || s.HTTP2 == HTTP2Cleartext
+}
+
+// HTTP/2 modes (HTTP2).
+const (
+	HTTP2Off       = "off"
+	HTTP2TLS       = "tls"
+	HTTP2Cleartext = "h2c"
+)
+
+// Supabase holds the Supabase project credentials.
+type Supabase struct {
+	URL            string // SUPABASE_URL
+	AnonKey        string // SUPABASE_ANON_KEY
+	ServiceRoleKey string // SUPABASE_SERVICE_ROLE_KEY
+}
+
+// Auth configures token validation (see middleware.Auth).
+type Auth struct {
+	JWTSecret    string   // JWT_SECRET, for HS256 tokens
+	SupabaseURL  string   // SUPABASE_URL, whose JWKS verifies RS256 tokens
+	AdminUserIDs []string // ADMIN_USER_IDS, comma-separated
+	ScopeClaim   string   // SCOPE_CLAIM (default "scope")
+
+	// APIKeys is where the hashed API keys of machine clients are looked up (API_KEYS): redis
+	// (the cache), table (APIKeyTable in Supabase) or "" (default: API keys disabled).
+	APIKeys        string
+	APIKeyTable    string        // API_KEYS_TABLE (default "api_keys")
+	APIKeyCacheTTL time.Duration // API_KEYS_CACHE_TTL: how long table lookups are cached (default 1m, 0 to not cache)
+}
+
+// API key stores (API_KEYS).
+const (
+	APIKeysRedis = "redis"
+	APIKeysTable = "table"
+)
+
+// Session configures the /auth endpoints, which sign users in through Supabase Auth and keep
+// their refresh token in an HttpOnly cookie (see handlers.Login).
+type Session struct {
+	SupabaseURL string // SUPABASE_URL
+	AnonKey     string // SUPABASE_ANON_KEY
+
+	CookieName   string        // AUTH_COOKIE_NAME (default "refresh_token")
+	CookieDomain string        // AUTH_COOKIE_DOMAIN (default: the request's host only)
+	CookieMaxAge time.Duration // AUTH_COOKIE_MAX_AGE, how long the cookie is kept (default 720h, Supabase's default session)
+	CookieSecure bool          // AUTH_COOKIE_SECURE: sent over HTTPS only (default true in production)
+
+	// CookieSameSite is the cookie's SameSite attribute (AUTH_COOKIE_SAMESITE: lax, strict or
+	// none; default lax). none, for a frontend on another site, requires CookieSecure.
+	CookieSameSite string
+}
+
+// Enabled reports whether Supabase Auth credentials are configured.
+func (s Session) Enabled() bool {
+	return s.SupabaseURL != "" && s.AnonKey != ""
+}
+
+// Cookie SameSite modes (AUTH_COOKIE_SAMESITE).
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
+
+// Cache backends (CACHE_BACKEND).
+const (
+	CacheRedis   = "redis"
+	CacheUpstash = "upstash"
+	CacheMemory  = "memory"
+)
+
+// Cache configures the cache backend (see cache.Init).
+type Cache struct {
+	Backend              string        // CACHE_BACKEND: redis, upstash or memory (default: from the URLs below)
+	RedisURL             string        // REDIS_URL: native Redis (takes precedence over Upstash)
+	UpstashURL           string        // UPSTASH_REDIS_URL: Upstash REST
+	UpstashToken         string        // UPSTASH_REDIS_TOKEN
+	Compression          string        // CACHE_COMPRESSION: none, gzip or snappy (default none)
+	CompressionThreshold int           // CACHE_COMPRESSION_THRESHOLD in bytes (default 1024; smaller values rarely shrink)
+	EpochRefresh         time.Duration // CACHE_EPOCH_REFRESH (default 5s)
+}
+
+// ResolvedBackend returns the cache backend to use: Backend if set, otherwise redis when REDIS_URL
+// is set, upstash when UPSTASH_REDIS_URL is, and "" (no cache) when neither is.
+func (c Cache) ResolvedBackend() string {
+	switch {
+	case c.Backend != "":
+		return c.Backend
+	case c.RedisURL != "":
+		return CacheRedis
+	case c.UpstashURL != "":
+		return CacheUpstash
+	default:
+		return ""
+	}
+}
+
+// Enabled reports whether a cache backend is configured.
+func (c Cache) Enabled() bool {
+	return c.ResolvedBackend() != ""
+}
+
+// RateLimit configures the rate-limit profiles (see middleware.RateLimitProfile).
+type RateLimit struct {
+	Max          int    // RATE_LIMIT_MAX per minute (default 100)
+	StrictMax    int    // RATE_LIMIT_STRICT_MAX per minute (default 10)
+	WebSocketMax int    // RATE_LIMIT_WS_MAX WebSocket upgrade attempts per minute (default 30)
+	Storage      string // RATE_LIMIT_STORAGE: where requests are counted, memory (default) or redis
+
+	// Tiers are the per-minute limits of API key tiers (RATE_LIMIT_TIERS, e.g.
+	// "partner=1000,internal=5000"). They replace the default profile's limit for keys of the tier.
+	Tiers map[string]int
+}
+
+// Rate limit storages (RATE_LIMIT_STORAGE).
+const (
+	RateLimitMemory = "memory" // Per instance
+	RateLimitRedis  = "redis"  // In the shared cache, one budget across replicas
+)
+
+// Realtime configures the Supabase Realtime subscriber (see realtime.Start).
+type Realtime struct {
+	SupabaseURL    string        // SUPABASE_URL
+	AnonKey        string        // SUPABASE_ANON_KEY
+	TenantIDs      []string      // REALTIME_TENANT_IDS: only consume these tenants' rows
+	LeaderElection bool          // REALTIME_LEADER_ELECTION: only one replica consumes
+	LeaderTTL      time.Duration // REALTIME_LEADER_TTL, worst-case failover (default 15s, min 3s)
+	BackfillColumn string        // REALTIME_BACKFILL_COLUMN: timestamp column compared on reconnect (default updated_at)
+	BackfillLimit  int           // REALTIME_BACKFILL_LIMIT: most rows replayed per reconnect (default 1000, 0 disables)
+
+	// CheckpointStore is where the last processed commit timestamp is kept across restarts
+	// (REALTIME_CHECKPOINT_STORE: redis, postgres or none; default redis when the cache is set).
+	CheckpointStore    string
+	CheckpointInterval time.Duration // REALTIME_CHECKPOINT_INTERVAL, most often it is saved (default 5s)
+	ServiceRoleKey     string        // SUPABASE_SERVICE_ROLE_KEY, for the postgres checkpoint store
+
+	// SchemaCheckInterval is how often the subscribed tables' columns are checked against the ones
+	// the subscriber reads (REALTIME_SCHEMA_CHECK_INTERVAL, default 10m, 0 disables).
+	SchemaCheckInterval time.Duration
+
+	// HeartbeatInterval is how often a Phoenix heartbeat is sent; Supabase closes connections
+	// that stay silent for about a minute (REALTIME_HEARTBEAT_INTERVAL, default 25s).
+	HeartbeatInterval time.Duration
+
+	// Reconnects wait ReconnectMinDelay, doubling up to ReconnectMaxDelay, with jitter
+	// (REALTIME_RECONNECT_MIN_DELAY, default 1s; REALTIME_RECONNECT_MAX_DELAY, default 1m).
+	ReconnectMinDelay time.Duration
+	ReconnectMaxDelay time.Duration
+
+	// MaxReconnects is how many reconnects in a row may fail before the subscriber gives up
+	// (REALTIME_MAX_RECONNECTS, default 0: never).
+	MaxReconnects int
+
+	// Subscriptions are the tables listened to: the built-in prices subscription, then those of
+	// REALTIME_SUBSCRIPTIONS or REALTIME_SUBSCRIPTIONS_FILE (see RealtimeSubscription).
+	Subscriptions []RealtimeSubscription
+}
+
+// Realtime checkpoint stores (REALTIME_CHECKPOINT_STORE).
+const (
+	CheckpointRedis    = "redis"    // In the cache (REDIS_URL or Upstash)
+	CheckpointPostgres = "postgres" // In the realtime_checkpoints table, via the Supabase REST API
+	CheckpointNone     = "none"     // In memory only
+)
+
+// Enabled reports whether Realtime credentials are configured.
+func (r Realtime) Enabled() bool {
+	return r.SupabaseURL != "" && r.AnonKey != ""
+}
+
+// Hub configures how the WebSocket hubs of the replicas share messages (see handlers.StartBridge).
+type Hub struct {
+	// RedisBridge relays the messages published on one replica's hub to the others over Redis
+	// pub/sub (WS_REDIS_BRIDGE, default false). Requires REDIS_URL: Upstash REST can't subscribe.
+	RedisBridge bool
+	RedisURL    string // REDIS_URL
+	Channel     string // WS_REDIS_CHANNEL, the pub/sub channel (default "ws:hub")
+}
+
+// Egress restricts where outbound requests may go (see egress.Init).
+type Egress struct {
+	AllowedHosts   []string // EGRESS_ALLOWED_HOSTS ("api.example.com", "*.example.com"), plus the Supabase and Upstash hosts
+	AllowedSchemes []string // EGRESS_ALLOWED_SCHEMES (default https)
+	AllowLoopback  bool     // EGRESS_ALLOW_LOOPBACK: localhost over any scheme (default true outside production)
+}
+
+// Proxy configures the HTTP client the GraphQL and REST proxies reach Supabase with (see
+// handlers.InitProxy): one pool of keep-alive connections shared by every request.
+type Proxy struct {
+	MaxIdleConns int           // PROXY_MAX_IDLE_CONNS: idle connections kept open to Supabase (default 64)
+	MaxConns     int           // PROXY_MAX_CONNS: connections to Supabase at once (default 0, unlimited)
+	IdleTimeout  time.Duration // PROXY_IDLE_TIMEOUT before an idle connection is closed (default 90s)
+
+	DialTimeout     time.Duration // PROXY_DIAL_TIMEOUT (default 5s)
+	TLSTimeout      time.Duration // PROXY_TLS_TIMEOUT: TLS handshake (default 5s)
+	ResponseTimeout time.Duration // PROXY_RESPONSE_TIMEOUT: until Supabase's response headers (default 30s, 0: none)
+	Timeout         time.Duration // PROXY_TIMEOUT: the whole request, body included (default 60s, 0: none)
+
+	// Retries is how many times an idempotent request (a GraphQL query, a REST GET) is retried
+	// when it can't reach Supabase or gets a 502, 503 or 504 (PROXY_RETRIES, default 0). The
+	// first retry waits RetryBackoff (PROXY_RETRY_BACKOFF, default 100ms), doubling each time.
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+// Memory configures the Go runtime's memory limit and GC target, and the watchdog that sheds load
+// as memory in use nears the limit (see memory.Init). The runtime reads GOMEMLIMIT and GOGC
+// itself at startup; they are read here too so values from .env files apply, and so the watchdog
+// knows the limit.
+type Memory struct {
+	Limit        int64 // GOMEMLIMIT in bytes, e.g. 450MiB (default none)
+	LimitPercent int   // MEMORY_LIMIT_PERCENT: the limit as a share of the container's, when GOMEMLIMIT is unset (1-100)
+	GCPercent    int   // GOGC (default 100, -1 with "off")
+
+	WatchdogInterval time.Duration // MEMORY_WATCHDOG_INTERVAL (default 5s, 0 disables the watchdog)
+	WarnThreshold    float64       // MEMORY_WARN_THRESHOLD: share of the limit in use that is logged (default 0.8)
+	ShedThreshold    float64       // MEMORY_SHED_THRESHOLD: share of the limit in use above which load is shed (default 0.9)
+	ShedFraction     float64       // MEMORY_SHED_FRACTION of WebSocket clients and cached entries shed per check (default 0.1)
+}
+
+// Database configures the direct Postgres connection pool (see db.Init).
+type Database struct {
+	URL             string        // DATABASE_URL (default: the database is disabled)
+	Migrate         bool          // DATABASE_MIGRATE: apply the pending migrations at startup
+	MaxConns        int           // DATABASE_MAX_CONNS (default 10: Supabase limits connections per project)
+	MinConns        int           // DATABASE_MIN_CONNS (default 0)
+	MaxConnLifetime time.Duration // DATABASE_MAX_CONN_LIFETIME (default 30m)
+	MaxConnIdleTime time.Duration // DATABASE_MAX_CONN_IDLE_TIME (default 5m)
+	ConnectTimeout  time.Duration // DATABASE_CONNECT_TIMEOUT (default 5s)
+
+	ReplicaURLs          []string      // DATABASE_REPLICA_URLS, comma-separated read replicas
+	MaxReplicaLag        time.Duration // DATABASE_REPLICA_MAX_LAG, beyond which reads go to the primary (default 10s)
+	ReplicaCheckInterval time.Duration // DATABASE_REPLICA_CHECK_INTERVAL (default 5s)
+
+	StatementTimeout time.Duration // DATABASE_STATEMENT_TIMEOUT of WithTx statements (default 30s)
+	TxMaxAttempts    int           // DATABASE_TX_MAX_ATTEMPTS after serialization failures (default 3)
+}
+
+// QueryCache configures the cache of repository reads (see querycache.Init).
+type QueryCache struct {
+	Enabled bool          // QUERY_CACHE (default true; also needs a cache store)
+	TTL     time.Duration // QUERY_CACHE_TTL of results that don't set their own (default 1m)
+}
+
+// Jobs configures the background job queue (see jobs.Init).
+type Jobs struct {
+	Workers      int           // JOBS_WORKERS per instance (default 4, 0 only enqueues)
+	PollInterval time.Duration // JOBS_POLL_INTERVAL at which due jobs are claimed (default 1s)
+	Timeout      time.Duration // JOBS_TIMEOUT of each attempt (default 5m)
+	MaxAttempts  int           // JOBS_MAX_ATTEMPTS before a job is dead (default 5)
+
+	// Failed jobs are retried after BackoffMin, doubling up to BackoffMax (JOBS_BACKOFF_MIN,
+	// default 10s; JOBS_BACKOFF_MAX, default 1h).
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+}
+
+// Resource configures the CRUD resources' trash and cache (see resource.Init).
+type Resource struct {
+	Retention     time.Duration // RESOURCE_RETENTION: how long deleted rows can be restored (default 720h)
+	PurgeInterval time.Duration // RESOURCE_PURGE_INTERVAL (default 1h)
+	CacheTTL      time.Duration // RESOURCE_CACHE_TTL of cached lists (default 1m)
+}
+
+// Webhook configures the third-party webhooks at /webhooks/:provider (see webhook.Init).
+type Webhook struct {
+	DedupTTL       time.Duration // WEBHOOK_DEDUP_TTL: how long event IDs are remembered (default 72h)
+	GitHubSecrets  []string      // GITHUB_WEBHOOK_SECRET, comma-separated while rotating
+	SupabaseSecret string        // SUPABASE_WEBHOOK_SECRET, Standard Webhooks secrets (whsec_...)
+}
+
+// Push configures push notifications (see push.Init).
+type Push struct {
+	Workers      int           // PUSH_WORKERS (default 4)
+	QueueSize    int           // PUSH_QUEUE_SIZE (default 1000)
+	Retries      int           // PUSH_RETRIES of failed deliveries (default 3)
+	RetryBackoff time.Duration // PUSH_RETRY_BACKOFF before the first retry, doubled each time (default 2s)
+
+	FCMCredentialsFile string // FCM_CREDENTIALS_FILE, a service account key file (default: FCM disabled)
+	FCMProjectID       string // FCM_PROJECT_ID (default: the key's project)
+
+	APNsKeyFile string // APNS_KEY_FILE, a .p8 key (default: APNs disabled)
+	APNsKeyID   string // APNS_KEY_ID (required with APNsKeyFile)
+	APNsTeamID  string // APNS_TEAM_ID (required with APNsKeyFile)
+	APNsTopic   string // APNS_TOPIC, the app's bundle ID (required with APNsKeyFile)
+	APNsSandbox bool   // APNS_SANDBOX: send to the development environment
+}
+
+// Functions configures the Supabase Edge Functions client (see functions.Init).
+type Functions struct {
+	Timeout      time.Duration // FUNCTIONS_TIMEOUT of each attempt (default 30s)
+	Retries      int           // FUNCTIONS_RETRIES of calls marked Retry (default 0)
+	RetryBackoff time.Duration // FUNCTIONS_RETRY_BACKOFF before the first retry (default 200ms)
+	Allowed      []string      // FUNCTIONS_ALLOWED: functions the HTTP proxy may invoke (default: all)
+}
+
+// Monitor configures the goroutine and channel buffer checks (see monitor.Init).
+type Monitor struct {
+	Enabled  bool          // MONITOR (default true)
+	Interval time.Duration // MONITOR_INTERVAL (default 15s)
+}
+
+// Middleware selects and orders the global middleware (see app.RegisterMiddleware for the names).
+type Middleware struct {
+	Order   []string // MIDDLEWARE: the complete pipeline, in order (default: the built-in order)
+	Enable  []string // MIDDLEWARE_ENABLE: optional middleware to add at its default position
+	Disable []string // MIDDLEWARE_DISABLE: middleware to leave out
+}
+
+// IsProduction reports whether the server runs in production.
+func (c *Config) IsProduction() bool {
+	return c.Env == Production
+}
+
+// fileKeys are the variables set from the .env files, which ReloadFiles may change.
+var (
+	filesMu  sync.Mutex
+	fileKeys map[string]bool
+)
+
+// LoadFiles loads .env.<GO_ENV> and then .env into the environment, without overriding variables
+// that are already set. Missing files are skipped.
+func LoadFiles() {
+	loadFiles(nil)
+}
+
+// ReloadFiles reads the .env files again: the variables LoadFiles set from them take their new
+// values (or are unset when removed from the files), while the variables set in the process's
+// environment still win. Call Load afterwards for the new configuration.
+func ReloadFiles() {
+	filesMu.Lock()
+	previous := fileKeys
+	filesMu.Unlock()
+	loadFiles(previous)
+}
+
+// loadFiles sets the variables of the .env files that are unset, or in previous (set from the
+// files before).
+func loadFiles(previous map[string]bool) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	loaded := make(map[string]bool)
+	for _, name := range []string{".env." + getEnv(), ".env"} {
+		values, err := godotenv.Read(name)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("WARNING: Failed to load %s: %v", name, err)
+			}
+			continue
+		}
+		for key, value := range values {
+			if _, set := os.LookupEnv(key); loaded[key] || (set && !previous[key]) {
+				continue
+			}
+			os.Setenv(key, value)
+			loaded[key] = true
+		}
+		log.Printf("Loaded %s", name)
+	}
+	for key := range previous {
+		if !loaded[key] {
+			os.Unsetenv(key)
+		}
+	}
+	fileKeys = loaded
+}
+
+// Load reads the configuration from the environment, applies defaults and validates it.
+// The error lists every invalid or missing setting.
+func Load() (*Config, error) {
+	l := &loader{}
+	env := getEnv()
+	cfg := &Config{
+		Env:  env,
+		Port: l.string("PORT", "3000"),
+		Server: Server{
+			AllowedOrigins:    os.Getenv("ALLOWED_ORIGINS"),
+			TrustedProxyCheck: l.bool("ENABLE_TRUSTED_PROXY_CHECK", false),
+			TrustedProxies:    l.list("TRUSTED_PROXIES"),
+			HTTP2:             l.http2("HTTP2"),
+			TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+			TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+			CORSMaxAge:        l.duration("CORS_MAX_AGE", 2*time.Hour, 0),
+			DrainDelay:        l.duration("SHUTDOWN_DRAIN_DELAY", 5*time.Second, 0),
+		},
+		Supabase: Supabase{
+			URL:            os.Getenv("SUPABASE_URL"),
+			AnonKey:        os.Getenv("SUPABASE_ANON_KEY"),
+			ServiceRoleKey: os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
+		},
+		Auth: Auth{
+			JWTSecret:    os.Getenv("JWT_SECRET"),
+			SupabaseURL:  os.Getenv("SUPABASE_URL"),
+			AdminUserIDs: l.list("ADMIN_USER_IDS"),
+			ScopeClaim:   l.string("SCOPE_CLAIM", "scope"),
+
+			APIKeys:        l.apiKeys("API_KEYS"),
+			APIKeyTable:    l.string("API_KEYS_TABLE", "api_keys"),
+			APIKeyCacheTTL: l.duration("API_KEYS_CACHE_TTL", time.Minute, 0),
+		},
+		Session: Session{
+			SupabaseURL:    os.Getenv("SUPABASE_URL"),
+			AnonKey:        os.Getenv("SUPABASE_ANON_KEY"),
+			CookieName:     l.string("AUTH_COOKIE_NAME", "refresh_token"),
+			CookieDomain:   os.Getenv("AUTH_COOKIE_DOMAIN"),
+			CookieMaxAge:   l.duration("AUTH_COOKIE_MAX_AGE", 720*time.Hour, time.Minute),
+			CookieSecure:   l.bool("AUTH_COOKIE_SECURE", env == Production),
+			CookieSameSite: l.sameSite("AUTH_COOKIE_SAMESITE"),
+		},
+		Cache: Cache{
+			Backend:              l.cacheBackend("CACHE_BACKEND"),
+			RedisURL:             os.Getenv("REDIS_URL"),
+			UpstashURL:           os.Getenv("UPSTASH_REDIS_URL"),
+			UpstashToken:         os.Getenv("UPSTASH_REDIS_TOKEN"),
+			Compression:          l.compression("CACHE_COMPRESSION"),
+			CompressionThreshold: l.int("CACHE_COMPRESSION_THRESHOLD", 1024, 0),
+			EpochRefresh:         l.duration("CACHE_EPOCH_REFRESH", 5*time.Second, 0),
+		},
+		RateLimit: RateLimit{
+			Max:          l.int("RATE_LIMIT_MAX", 100, 1),
+			StrictMax:    l.int("RATE_LIMIT_STRICT_MAX", 10, 1),
+			WebSocketMax: l.int("RATE_LIMIT_WS_MAX", 30, 1),
+			Storage:      l.rateLimitStorage("RATE_LIMIT_STORAGE"),
+			Tiers:        l.tiers("RATE_LIMIT_TIERS"),
+		},
+		Realtime: Realtime{
+			SupabaseURL:    os.Getenv("SUPABASE_URL"),
+			AnonKey:        os.Getenv("SUPABASE_ANON_KEY"),
+			TenantIDs:      l.list("REALTIME_TENANT_IDS"),
+			LeaderElection: l.bool("REALTIME_LEADER_ELECTION", false),
+			LeaderTTL:      l.duration("REALTIME_LEADER_TTL", 15*time.Second, 3*time.Second),
+			BackfillColumn: l.string("REALTIME_BACKFILL_COLUMN", "updated_at"),
+			BackfillLimit:  l.int("REALTIME_BACKFILL_LIMIT", 1000, 0),
+
+			CheckpointStore:    l.checkpointStore("REALTIME_CHECKPOINT_STORE"),
+			CheckpointInterval: l.duration("REALTIME_CHECKPOINT_INTERVAL", 5*time.Second, time.Second),
+			ServiceRoleKey:     os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
+
+			SchemaCheckInterval: l.duration("REALTIME_SCHEMA_CHECK_INTERVAL", 10*time.Minute, 0),
+
+			HeartbeatInterval: l.duration("REALTIME_HEARTBEAT_INTERVAL", 25*time.Second, time.Second),
+			ReconnectMinDelay: l.duration("REALTIME_RECONNECT_MIN_DELAY", time.Second, 100*time.Millisecond),
+			ReconnectMaxDelay: l.duration("REALTIME_RECONNECT_MAX_DELAY", time.Minute, 100*time.Millisecond),
+			MaxReconnects:     l.int("REALTIME_MAX_RECONNECTS", 0, 0),
+
+			Subscriptions: l.subscriptions("REALTIME_SUBSCRIPTIONS", "REALTIME_SUBSCRIPTIONS_FILE"),
+		},
+		Hub: Hub{
+			RedisBridge: l.bool("WS_REDIS_BRIDGE", false),
+			RedisURL:    os.Getenv("REDIS_URL"),
+			Channel:     l.string("WS_REDIS_CHANNEL", "ws:hub"),
+		},
+		Egress: Egress{
+			AllowedHosts:   l.list("EGRESS_ALLOWED_HOSTS"),
+			AllowedSchemes: l.schemes("EGRESS_ALLOWED_SCHEMES"),
+			AllowLoopback:  l.bool("EGRESS_ALLOW_LOOPBACK", env != Production),
+		},
+		Proxy: Proxy{
+			MaxIdleConns:    l.int("PROXY_MAX_IDLE_CONNS", 64, 1),
+			MaxConns:        l.int("PROXY_MAX_CONNS", 0, 0),
+			IdleTimeout:     l.duration("PROXY_IDLE_TIMEOUT", 90*time.Second, time.Second),
+			DialTimeout:     l.duration("PROXY_DIAL_TIMEOUT", 5*time.Second, 100*time.Millisecond),
+			TLSTimeout:      l.duration("PROXY_TLS_TIMEOUT", 5*time.Second, 100*time.Millisecond),
+			ResponseTimeout: l.duration("PROXY_RESPONSE_TIMEOUT", 30*time.Second, 0),
+			Timeout:         l.duration("PROXY_TIMEOUT", time.Minute, 0),
+			Retries:         l.int("PROXY_RETRIES", 0, 0),
+			RetryBackoff:    l.duration("PROXY_RETRY_BACKOFF", 100*time.Millisecond, 0),
+		},
+		Memory: Memory{
+			Limit:            l.bytes("GOMEMLIMIT"),
+			LimitPercent:     l.int("MEMORY_LIMIT_PERCENT", 0, 0),
+			GCPercent:        l.gcPercent("GOGC"),
+			WatchdogInterval: l.duration("MEMORY_WATCHDOG_INTERVAL", 5*time.Second, 0),
+			WarnThreshold:    l.fraction("MEMORY_WARN_THRESHOLD", 0.8),
+			ShedThreshold:    l.fraction("MEMORY_SHED_THRESHOLD", 0.9),
+			ShedFraction:     l.fraction("MEMORY_SHED_FRACTION", 0.1),
+		},
+		Database: Database{
+			URL:             os.Getenv("DATABASE_URL"),
+			Migrate:         l.bool("DATABASE_MIGRATE", false),
+			MaxConns:        l.int("DATABASE_MAX_CONNS", 10, 1),
+			MinConns:        l.int("DATABASE_MIN_CONNS", 0, 0),
+			MaxConnLifetime: l.duration("DATABASE_MAX_CONN_LIFETIME", 30*time.Minute, time.Second),
+			MaxConnIdleTime: l.duration("DATABASE_MAX_CONN_IDLE_TIME", 5*time.Minute, time.Second),
+			ConnectTimeout:  l.duration("DATABASE_CONNECT_TIMEOUT", 5*time.Second, 100*time.Millisecond),
+
+			ReplicaURLs:          l.list("DATABASE_REPLICA_URLS"),
+			MaxReplicaLag:        l.duration("DATABASE_REPLICA_MAX_LAG", 10*time.Second, time.Millisecond),
+			ReplicaCheckInterval: l.duration("DATABASE_REPLICA_CHECK_INTERVAL", 5*time.Second, 100*time.Millisecond),
+
+			StatementTimeout: l.duration("DATABASE_STATEMENT_TIMEOUT", 30*time.Second, time.Millisecond),
+			TxMaxAttempts:    l.int("DATABASE_TX_MAX_ATTEMPTS", 3, 1),
+		},
+		QueryCache: QueryCache{
+			Enabled: l.bool("QUERY_CACHE", true),
+			TTL:     l.duration("QUERY_CACHE_TTL", time.Minute, time.Second),
+		},
+		Jobs: Jobs{
+			Workers:      l.int("JOBS_WORKERS", 4, 0),
+			PollInterval: l.duration("JOBS_POLL_INTERVAL", time.Second, 10*time.Millisecond),
+			Timeout:      l.duration("JOBS_TIMEOUT", 5*time.Minute, time.Second),
+			MaxAttempts:  l.int("JOBS_MAX_ATTEMPTS", 5, 1),
+			BackoffMin:   l.duration("JOBS_BACKOFF_MIN", 10*time.Second, time.Millisecond),
+			BackoffMax:   l.duration("JOBS_BACKOFF_MAX", time.Hour, time.Millisecond),
+		},
+		Resource: Resource{
+			Retention:     l.duration("RESOURCE_RETENTION", 30*24*time.Hour, time.Minute),
+			PurgeInterval: l.duration("RESOURCE_PURGE_INTERVAL", time.Hour, time.Second),
+			CacheTTL:      l.duration("RESOURCE_CACHE_TTL", time.Minute, time.Second),
+		},
+		Webhook: Webhook{
+			DedupTTL:       l.duration("WEBHOOK_DEDUP_TTL", 72*time.Hour, time.Minute),
+			GitHubSecrets:  l.list("GITHUB_WEBHOOK_SECRET"),
+			SupabaseSecret: strings.TrimSpace(os.Getenv("SUPABASE_WEBHOOK_SECRET")),
+		},
+		Push: Push{
+			Workers:      l.int("PUSH_WORKERS", 4, 1),
+			QueueSize:    l.int("PUSH_QUEUE_SIZE", 1000, 1),
+			Retries:      l.int("PUSH_RETRIES", 3, 0),
+			RetryBackoff: l.duration("PUSH_RETRY_BACKOFF", 2*time.Second, time.Millisecond),
+
+			FCMCredentialsFile: os.Getenv("FCM_CREDENTIALS_FILE"),
+			FCMProjectID:       os.Getenv("FCM_PROJECT_ID"),
+
+			APNsKeyFile: os.Getenv("APNS_KEY_FILE"),
+			APNsKeyID:   os.Getenv("APNS_KEY_ID"),
+			APNsTeamID:  os.Getenv("APNS_TEAM_ID"),
+			APNsTopic:   os.Getenv("APNS_TOPIC"),
+			APNsSandbox: l.bool("APNS_SANDBOX", false),
+		},
+		Functions: Functions{
+			Timeout:      l.duration("FUNCTIONS_TIMEOUT", 30*time.Second, 100*time.Millisecond),
+			Retries:      l.int("FUNCTIONS_RETRIES", 0, 0),
+			RetryBackoff: l.duration("FUNCTIONS_RETRY_BACKOFF", 200*time.Millisecond, time.Millisecond),
+			Allowed:      l.list("FUNCTIONS_ALLOWED"),
+		},
+		Monitor: Monitor{
+			Enabled:  l.bool("MONITOR", true),
+			Interval: l.duration("MONITOR_INTERVAL", 15*time.Second, 100*time.Millisecond),
+		},
+		Middleware: Middleware{
+			Order:   l.list("MIDDLEWARE"),
+			Enable:  l.list("MIDDLEWARE_ENABLE"),
+			Disable: l.list("MIDDLEWARE_DISABLE"),
+		},
+	}
+
+	// The configured upstreams are always allowed
+	for _, name := range []string{"SUPABASE_URL", "UPSTASH_REDIS_URL"} {
+		if host := l.host(name); host != "" {
+			cfg.Egress.AllowedHosts = append(cfg.Egress.AllowedHosts, host)
+		}
+	}
+
+	// Per-environment requirements and defaults
+	if cfg.Server.AllowedOrigins == "" {
+		if cfg.IsProduction() {
+			// Without it every origin would be allowed
+			l.fail("ALLOWED_ORIGINS is required in production")
+		} else {
+			cfg.Server.AllowedOrigins = devAllowedOrigins
+			log.Printf("INFO: ALLOWED_ORIGINS not set, using development fallback: %s", devAllowedOrigins)
+		}
+	}
+	if cfg.Server.TrustedProxyCheck && len(cfg.Server.TrustedProxies) == 0 {
+		// Trusting every proxy would let clients spoof their IP (and dodge rate limits)
+		l.fail("TRUSTED_PROXIES is required when ENABLE_TRUSTED_PROXY_CHECK=true")
+	}
+	if cfg.Server.HTTP2 == HTTP2TLS && (cfg.Server.TLSCertFile == "" || cfg.Server.TLSKeyFile == "") {
+		l.fail("TLS_CERT_FILE and TLS_KEY_FILE are required when HTTP2=tls")
+	}
+	switch {
+	case cfg.Cache.Backend == CacheRedis && cfg.Cache.RedisURL == "":
+		l.fail("REDIS_URL is required when CACHE_BACKEND=redis")
+	case cfg.Cache.Backend == CacheUpstash && cfg.Cache.UpstashURL == "":
+		l.fail("UPSTASH_REDIS_URL is required when CACHE_BACKEND=upstash")
+	}
+	if cfg.RateLimit.Storage == RateLimitRedis {
+		switch cfg.Cache.ResolvedBackend() {
+		case "":
+			l.fail("RATE_LIMIT_STORAGE=redis requires a cache (REDIS_URL, UPSTASH_REDIS_URL or CACHE_BACKEND)")
+		case CacheMemory:
+			log.Println("WARNING: RATE_LIMIT_STORAGE=redis with CACHE_BACKEND=memory, rate limits are not shared between replicas")
+		}
+	}
+	switch cfg.Auth.APIKeys {
+	case APIKeysRedis:
+		if !cfg.Cache.Enabled() {
+			l.fail("API_KEYS=redis requires a cache (REDIS_URL, UPSTASH_REDIS_URL or CACHE_BACKEND)")
+		}
+	case APIKeysTable:
+		if cfg.Supabase.URL == "" || cfg.Supabase.ServiceRoleKey == "" {
+			l.fail("API_KEYS=table requires SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY")
+		}
+		if !validColumn(cfg.Auth.APIKeyTable) {
+			l.fail("API_KEYS_TABLE must be a table name (letters, digits and _), got %q", cfg.Auth.APIKeyTable)
+		}
+	}
+	switch cfg.Realtime.CheckpointStore {
+	case "":
+		cfg.Realtime.CheckpointStore = CheckpointNone
+		if cfg.Cache.Enabled() {
+			cfg.Realtime.CheckpointStore = CheckpointRedis
+		}
+	case CheckpointRedis:
+		if !cfg.Cache.Enabled() {
+			l.fail("REALTIME_CHECKPOINT_STORE=redis requires a cache (REDIS_URL, UPSTASH_REDIS_URL or CACHE_BACKEND)")
+		}
+	case CheckpointPostgres:
+		if cfg.Realtime.SupabaseURL == "" || cfg.Realtime.ServiceRoleKey == "" {
+			l.fail("REALTIME_CHECKPOINT_STORE=postgres requires SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY")
+		}
+	}
+	if !validColumn(cfg.Realtime.BackfillColumn) {
+		// It is put into the PostgREST query as is
+		l.fail("REALTIME_BACKFILL_COLUMN must be a column name (letters, digits and _), got %q", cfg.Realtime.BackfillColumn)
+	}
+	if cfg.Realtime.ReconnectMaxDelay < cfg.Realtime.ReconnectMinDelay {
+		l.fail("REALTIME_RECONNECT_MAX_DELAY (%s) must not be less than REALTIME_RECONNECT_MIN_DELAY (%s)",
+			cfg.Realtime.ReconnectMaxDelay, cfg.Realtime.ReconnectMinDelay)
+	}
+	if cfg.Session.CookieSameSite == SameSiteNone && !cfg.Session.CookieSecure {
+		// Browsers drop SameSite=None cookies that are not Secure
+		l.fail("AUTH_COOKIE_SAMESITE=none requires AUTH_COOKIE_SECURE=true")
+	}
+	if cfg.Hub.RedisBridge && cfg.Hub.RedisURL == "" {
+		l.fail("WS_REDIS_BRIDGE=true requires REDIS_URL (native Redis; Upstash REST has no pub/sub)")
+	}
+	if cfg.Memory.LimitPercent > 100 {
+		l.fail("MEMORY_LIMIT_PERCENT must be at most 100, got %d", cfg.Memory.LimitPercent)
+	}
+	if cfg.Memory.WarnThreshold > cfg.Memory.ShedThreshold {
+		l.fail("MEMORY_WARN_THRESHOLD (%g) must not be more than MEMORY_SHED_THRESHOLD (%g)",
+			cfg.Memory.WarnThreshold, cfg.Memory.ShedThreshold)
+	}
+	if cfg.Database.MinConns > cfg.Database.MaxConns {
+		l.fail("DATABASE_MIN_CONNS (%d) must not be more than DATABASE_MAX_CONNS (%d)",
+			cfg.Database.MinConns, cfg.Database.MaxConns)
+	}
+	if cfg.Jobs.BackoffMax < cfg.Jobs.BackoffMin {
+		l.fail("JOBS_BACKOFF_MAX (%s) must not be less than JOBS_BACKOFF_MIN (%s)",
+			cfg.Jobs.BackoffMax, cfg.Jobs.BackoffMin)
+	}
+	if cfg.Push.APNsKeyFile != "" && (cfg.Push.APNsKeyID == "" || cfg.Push.APNsTeamID == "" || cfg.Push.APNsTopic == "") {
+		l.fail("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required with APNS_KEY_FILE")
+	}
+	seen := make(map[string]bool, len(cfg.Middleware.Order))
+	for _, name := range cfg.Middleware.Order {
+		if seen[name] {
+			l.fail("MIDDLEWARE lists %q twice", name)
+		}
+		seen[name] = true
+	}
+	for _, name := range cfg.Middleware.Enable {
+		if slices.Contains(cfg.Middleware.Disable, name) {
+			l.fail("%q is in both MIDDLEWARE_ENABLE and MIDDLEWARE_DISABLE", name)
+		}
+	}
+	if cfg.IsProduction() && cfg.Auth.JWTSecret == "" && cfg.Auth.SupabaseURL == "" {
+		l.fail("JWT_SECRET or SUPABASE_URL is required in production")
+	}
+
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// MustLoad is Load that exits on an invalid configuration.
+func MustLoad() *Config {
+	cfg, err := Load()
+	if err != nil {
+		log.Fatalf("CONFIG ERROR: %v", err)
+	}
+	return cfg
+}
+
+// getEnv returns GO_ENV, or ENV, defaulting to development.
+func getEnv() string {
+	for _, name := range []string{"GO_ENV", "ENV"} {
+		if value := strings.ToLower(strings.TrimSpace(os.Getenv(name))); value != "" {
+			return value
+		}
+	}
+	return Development
+}
+
+// validColumn reports whether name is a plain SQL identifier.
+func validColumn(name string) bool {
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// loader reads typed values from the environment, collecting the errors.
+type loader struct {
+	errs []error
+}
+
+// fail records a validation error.
+func (l *loader) fail(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+// string returns name, or fallback if it is unset.
+func (l *loader) string(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// list returns the comma-separated items of name, trimmed and without empty ones.
+func (l *loader) list(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// bool parses name as a boolean.
+func (l *loader) bool(name string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		l.fail("%s must be true or false, got %q", name, value)
+		return fallback
+	}
+	return parsed
+}
+
+// int parses name as an integer of at least min.
+func (l *loader) int(name string, fallback, min int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min {
+		l.fail("%s must be an integer of at least %d, got %q", name, min, value)
+		return fallback
+	}
+	return parsed
+}
+
+// duration parses name as a duration of at least min.
+func (l *loader) duration(name string, fallback, min time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < min {
+		l.fail("%s must be a duration of at least %s (e.g. 15s), got %q", name, min, value)
+		return fallback
+	}
+	return parsed
+}
+
+// fraction parses name as a number in (0, 1].
+func (l *loader) fraction(name string, fallback float64) float64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed <= 0 || parsed > 1 {
+		l.fail("%s must be a number between 0 and 1 (e.g. 0.9), got %q", name, value)
+		return fallback
+	}
+	return parsed
+}
+
+// byteUnits are the size suffixes GOMEMLIMIT accepts.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1}}
+
+// bytes parses name as a size in bytes with the Go runtime's GOMEMLIMIT syntax: an integer with
+// an optional B, KiB, MiB, GiB or TiB suffix, or "off" (0, like unset).
+func (l *loader) bytes(name string) int64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" || value == "off" {
+		return 0
+	}
+	number, size := value, int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, size = strings.TrimSuffix(value, unit.suffix), unit.size
+			break
+		}
+	}
+	parsed, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || parsed <= 0 || parsed > math.MaxInt64/size {
+		l.fail("%s must be a size in bytes with an optional B, KiB, MiB, GiB or TiB suffix (e.g. 450MiB), got %q", name, value)
+		return 0
+	}
+	return parsed * size
+}
+
+// gcPercent parses name as a GOGC value: a percentage of at least 0, or "off" (-1).
+func (l *loader) gcPercent(name string) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "off" {
+		return -1
+	}
+	return l.int(name, 100, 0)
+}
+
+// schemes parses a list of URL schemes (http or https), defaulting to https.
+func (l *loader) schemes(name string) []string {
+	schemes := l.list(name)
+	for i, scheme := range schemes {
+		schemes[i] = strings.ToLower(scheme)
+		if schemes[i] != "http" && schemes[i] != "https" {
+			l.fail("%s must only list http or https, got %q", name, scheme)
+		}
+	}
+	if len(schemes) == 0 {
+		return []string{"https"}
+	}
+	return schemes
+}
+
+// host returns the host (with its port, if any) of the absolute URL in name, or "" if it is unset.
+func (l *loader) host(name string) string {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return ""
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		l.fail("%s must be an absolute URL, got %q", name, value)
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+// compression parses a compression algorithm: none (also "" and "off"), gzip or snappy.
+func (l *loader) compression(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", "off", "none":
+		return "none"
+	case "gzip", "snappy":
+		return value
+	default:
+		l.fail("%s must be none, gzip or snappy, got %q", name, value)
+		return "none"
+	}
+}
+
+// http2 parses an HTTP/2 mode: off (also "" and "false"), tls or h2c.
+func (l *loader) http2(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", "false", HTTP2Off:
+		return HTTP2Off
+	case HTTP2TLS, HTTP2Cleartext:
+		return value
+	default:
+		l.fail("%s must be off, tls or h2c, got %q", name, value)
+		return HTTP2Off
+	}
+}
+
+// cacheBackend parses a cache backend: redis, upstash, memory or "" (chosen from the URLs).
+func (l *loader) cacheBackend(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", CacheRedis, CacheUpstash, CacheMemory:
+		return value
+	default:
+		l.fail("%s must be redis, upstash or memory, got %q", name, value)
+		return ""
+	}
+}
+
+// rateLimitStorage parses a rate limit storage: memory (also "") or redis.
+func (l *loader) rateLimitStorage(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", RateLimitMemory:
+		return RateLimitMemory
+	case RateLimitRedis:
+		return value
+	default:
+		l.fail("%s must be memory or redis, got %q", name, value)
+		return RateLimitMemory
+	}
+}
+
+// sameSite parses a cookie SameSite mode: lax (also ""), strict or none.
+func (l *loader) sameSite(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", SameSiteLax:
+		return SameSiteLax
+	case SameSiteStrict, SameSiteNone:
+		return value
+	default:
+		l.fail("%s must be lax, strict or none, got %q", name, value)
+		return SameSiteLax
+	}
+}
+
+// apiKeys parses an API key store: redis, table or "" (disabled, also "off" and "none").
+func (l *loader) apiKeys(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", "off", "none":
+		return ""
+	case APIKeysRedis, APIKeysTable:
+		return value
+	default:
+		l.fail("%s must be redis, table or off, got %q", name, value)
+		return ""
+	}
+}
+
+// tiers parses a comma-separated list of tier=limit pairs with limits of at least 1 (nil if unset).
+func (l *loader) tiers(name string) map[string]int {
+	var tiers map[string]int
+	for _, item := range l.list(name) {
+		tier, limit, _ := strings.Cut(item, "=")
+		tier = strings.TrimSpace(tier)
+		parsed, err := strconv.Atoi(strings.TrimSpace(limit))
+		if tier == "" || err != nil || parsed < 1 {
+			l.fail("%s must be tier=limit pairs with limits of at least 1 (e.g. partner=1000), got %q", name, item)
+			continue
+		}
+		if tiers == nil {
+			tiers = make(map[string]int)
+		}
+		tiers[tier] = parsed
+	}
+	return tiers
+}
+
+// checkpointStore parses a Realtime checkpoint store: redis, postgres, none or "" (chosen from the
+// cache settings).
+func (l *loader) checkpointStore(name string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch value {
+	case "", CheckpointRedis, CheckpointPostgres, CheckpointNone:
+		return value
+	default:
+		l.fail("%s must be redis, postgres or none, got %q", name, value)
+		return ""
+	}
+}
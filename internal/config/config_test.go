@@ -0,0 +1,632 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets every variable Load reads, so the machine's environment doesn't leak in.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"GO_ENV", "ENV", "PORT", "ALLOWED_ORIGINS", "ENABLE_TRUSTED_PROXY_CHECK", "TRUSTED_PROXIES", "CORS_MAX_AGE",
+		"HTTP2", "TLS_CERT_FILE", "TLS_KEY_FILE",
+		"SUPABASE_URL", "SUPABASE_ANON_KEY", "SUPABASE_SERVICE_ROLE_KEY", "JWT_SECRET", "ADMIN_USER_IDS",
+		"SCOPE_CLAIM", "CACHE_BACKEND", "REDIS_URL", "UPSTASH_REDIS_URL", "UPSTASH_REDIS_TOKEN", "CACHE_COMPRESSION",
+		"CACHE_COMPRESSION_THRESHOLD", "CACHE_EPOCH_REFRESH", "RATE_LIMIT_MAX", "RATE_LIMIT_STRICT_MAX", "RATE_LIMIT_WS_MAX", "RATE_LIMIT_STORAGE",
+		"REALTIME_TENANT_IDS", "REALTIME_LEADER_ELECTION", "REALTIME_LEADER_TTL",
+		"REALTIME_BACKFILL_COLUMN", "REALTIME_BACKFILL_LIMIT", "REALTIME_CHECKPOINT_STORE", "REALTIME_CHECKPOINT_INTERVAL",
+		"REALTIME_SCHEMA_CHECK_INTERVAL", "REALTIME_HEARTBEAT_INTERVAL", "REALTIME_RECONNECT_MIN_DELAY",
+		"REALTIME_RECONNECT_MAX_DELAY", "REALTIME_MAX_RECONNECTS", "REALTIME_SUBSCRIPTIONS", "REALTIME_SUBSCRIPTIONS_FILE",
+		"EGRESS_ALLOWED_HOSTS", "EGRESS_ALLOWED_SCHEMES", "EGRESS_ALLOW_LOOPBACK", "SHUTDOWN_DRAIN_DELAY",
+		"MIDDLEWARE", "MIDDLEWARE_ENABLE", "MIDDLEWARE_DISABLE",
+		"GOMEMLIMIT", "MEMORY_LIMIT_PERCENT", "GOGC", "MEMORY_WATCHDOG_INTERVAL", "MEMORY_WARN_THRESHOLD",
+		"MEMORY_SHED_THRESHOLD", "MEMORY_SHED_FRACTION",
+		"PROXY_MAX_IDLE_CONNS", "PROXY_MAX_CONNS", "PROXY_IDLE_TIMEOUT", "PROXY_DIAL_TIMEOUT", "PROXY_TLS_TIMEOUT",
+		"PROXY_RESPONSE_TIMEOUT", "PROXY_TIMEOUT", "PROXY_RETRIES", "PROXY_RETRY_BACKOFF",
+		"API_KEYS", "API_KEYS_TABLE", "API_KEYS_CACHE_TTL", "RATE_LIMIT_TIERS",
+		"WS_REDIS_BRIDGE", "WS_REDIS_CHANNEL",
+		"AUTH_COOKIE_NAME", "AUTH_COOKIE_DOMAIN", "AUTH_COOKIE_MAX_AGE", "AUTH_COOKIE_SECURE", "AUTH_COOKIE_SAMESITE",
+		"DATABASE_URL", "DATABASE_MIGRATE", "DATABASE_MAX_CONNS", "DATABASE_MIN_CONNS", "DATABASE_MAX_CONN_LIFETIME", "DATABASE_MAX_CONN_IDLE_TIME",
+		"DATABASE_CONNECT_TIMEOUT", "DATABASE_REPLICA_URLS", "DATABASE_REPLICA_MAX_LAG", "DATABASE_REPLICA_CHECK_INTERVAL",
+		"DATABASE_STATEMENT_TIMEOUT", "DATABASE_TX_MAX_ATTEMPTS", "QUERY_CACHE", "QUERY_CACHE_TTL",
+		"JOBS_WORKERS", "JOBS_POLL_INTERVAL", "JOBS_TIMEOUT", "JOBS_MAX_ATTEMPTS", "JOBS_BACKOFF_MIN", "JOBS_BACKOFF_MAX",
+		"RESOURCE_RETENTION", "RESOURCE_PURGE_INTERVAL", "RESOURCE_CACHE_TTL",
+		"WEBHOOK_DEDUP_TTL", "GITHUB_WEBHOOK_SECRET", "SUPABASE_WEBHOOK_SECRET",
+		"PUSH_WORKERS", "PUSH_QUEUE_SIZE", "PUSH_RETRIES", "PUSH_RETRY_BACKOFF", "FCM_CREDENTIALS_FILE", "FCM_PROJECT_ID",
+		"APNS_KEY_FILE", "APNS_KEY_ID", "APNS_TEAM_ID", "APNS_TOPIC", "APNS_SANDBOX",
+		"FUNCTIONS_TIMEOUT", "FUNCTIONS_RETRIES", "FUNCTIONS_RETRY_BACKOFF", "FUNCTIONS_ALLOWED", "MONITOR", "MONITOR_INTERVAL",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+// TestLoad_Defaults tests the defaults of a development environment.
+func TestLoad_Defaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Development, cfg.Env)
+	assert.False(t, cfg.IsProduction())
+	assert.Equal(t, "3000", cfg.Port)
+	assert.Equal(t, devAllowedOrigins, cfg.Server.AllowedOrigins)
+	assert.Equal(t, 5*time.Second, cfg.Server.DrainDelay)
+	assert.Equal(t, 2*time.Hour, cfg.Server.CORSMaxAge)
+	assert.Equal(t, HTTP2Off, cfg.Server.HTTP2)
+	assert.Equal(t, "scope", cfg.Auth.ScopeClaim)
+	assert.Equal(t, "none", cfg.Cache.Compression)
+	assert.Equal(t, 1024, cfg.Cache.CompressionThreshold)
+	assert.Equal(t, 5*time.Second, cfg.Cache.EpochRefresh)
+	assert.False(t, cfg.Cache.Enabled())
+	assert.Equal(t, RateLimit{Max: 100, StrictMax: 10, WebSocketMax: 30, Storage: RateLimitMemory}, cfg.RateLimit)
+	assert.Equal(t, 15*time.Second, cfg.Realtime.LeaderTTL)
+	assert.Equal(t, "updated_at", cfg.Realtime.BackfillColumn)
+	assert.Equal(t, 1000, cfg.Realtime.BackfillLimit)
+	assert.Equal(t, CheckpointNone, cfg.Realtime.CheckpointStore)
+	assert.Equal(t, 5*time.Second, cfg.Realtime.CheckpointInterval)
+	assert.Equal(t, 10*time.Minute, cfg.Realtime.SchemaCheckInterval)
+	assert.False(t, cfg.Realtime.Enabled())
+}
+
+// TestLoad_Values tests that set values are parsed and shared between sections.
+func TestLoad_Values(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("ENV", "Staging")
+	t.Setenv("PORT", "8080")
+	t.Setenv("SUPABASE_URL", "https://project.supabase.co")
+	t.Setenv("SUPABASE_ANON_KEY", "anon")
+	t.Setenv("ADMIN_USER_IDS", " admin-1, ,admin-2 ")
+	t.Setenv("CACHE_COMPRESSION", "Snappy")
+	t.Setenv("CACHE_COMPRESSION_THRESHOLD", "4096")
+	t.Setenv("RATE_LIMIT_MAX", "50")
+	t.Setenv("REALTIME_LEADER_ELECTION", "true")
+	t.Setenv("REALTIME_LEADER_TTL", "30s")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "staging", cfg.Env)
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, []string{"admin-1", "admin-2"}, cfg.Auth.AdminUserIDs)
+	assert.Equal(t, "https://project.supabase.co", cfg.Auth.SupabaseURL)
+	assert.True(t, cfg.Realtime.Enabled())
+	assert.Equal(t, "snappy", cfg.Cache.Compression)
+	assert.Equal(t, 4096, cfg.Cache.CompressionThreshold)
+	assert.Equal(t, 50, cfg.RateLimit.Max)
+	assert.True(t, cfg.Realtime.LeaderElection)
+	assert.Equal(t, 30*time.Second, cfg.Realtime.LeaderTTL)
+}
+
+// TestLoad_CacheBackend tests how the cache backend is chosen and that it needs its URL.
+func TestLoad_CacheBackend(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("UPSTASH_REDIS_URL", "https://cache.upstash.io")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, CacheUpstash, cfg.Cache.ResolvedBackend())
+
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, CacheRedis, cfg.Cache.ResolvedBackend())
+
+	t.Setenv("CACHE_BACKEND", "Memory")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, CacheMemory, cfg.Cache.ResolvedBackend())
+	assert.True(t, cfg.Cache.Enabled())
+
+	clearEnv(t)
+	t.Setenv("CACHE_BACKEND", "redis")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REDIS_URL is required when CACHE_BACKEND=redis")
+
+	t.Setenv("CACHE_BACKEND", "memcached")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CACHE_BACKEND must be redis, upstash or memory")
+}
+
+// TestLoad_RateLimitStorage tests that Redis rate limiting needs a cache.
+func TestLoad_RateLimitStorage(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RATE_LIMIT_STORAGE", "Redis")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "RATE_LIMIT_STORAGE=redis requires a cache")
+
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitRedis, cfg.RateLimit.Storage)
+
+	t.Setenv("RATE_LIMIT_STORAGE", "postgres")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "RATE_LIMIT_STORAGE must be memory or redis")
+}
+
+// TestLoad_CheckpointStore tests the default checkpoint store and what each store requires.
+func TestLoad_CheckpointStore(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, CheckpointRedis, cfg.Realtime.CheckpointStore)
+
+	t.Setenv("REALTIME_CHECKPOINT_STORE", "postgres")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REALTIME_CHECKPOINT_STORE=postgres requires SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY")
+
+	t.Setenv("SUPABASE_URL", "https://project.supabase.co")
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "service")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, CheckpointPostgres, cfg.Realtime.CheckpointStore)
+
+	clearEnv(t)
+	t.Setenv("REALTIME_CHECKPOINT_STORE", "redis")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REALTIME_CHECKPOINT_STORE=redis requires a cache")
+}
+
+// TestLoad_HubBridge tests that the Redis bridge requires REDIS_URL.
+func TestLoad_HubBridge(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.False(t, cfg.Hub.RedisBridge)
+	assert.Equal(t, "ws:hub", cfg.Hub.Channel)
+
+	t.Setenv("WS_REDIS_BRIDGE", "true")
+	t.Setenv("UPSTASH_REDIS_URL", "https://example.upstash.io")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WS_REDIS_BRIDGE=true requires REDIS_URL")
+
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	t.Setenv("WS_REDIS_CHANNEL", "ws:staging")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, Hub{RedisBridge: true, RedisURL: "redis://localhost:6379/0", Channel: "ws:staging"}, cfg.Hub)
+}
+
+// TestLoad_Session tests the session cookie's defaults and that SameSite=None requires Secure.
+func TestLoad_Session(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "refresh_token", cfg.Session.CookieName)
+	assert.Equal(t, 720*time.Hour, cfg.Session.CookieMaxAge)
+	assert.Equal(t, SameSiteLax, cfg.Session.CookieSameSite)
+	assert.False(t, cfg.Session.CookieSecure)
+
+	t.Setenv("AUTH_COOKIE_SAMESITE", "None")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AUTH_COOKIE_SAMESITE=none requires AUTH_COOKIE_SECURE=true")
+
+	t.Setenv("AUTH_COOKIE_SECURE", "true")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, SameSiteNone, cfg.Session.CookieSameSite)
+
+	t.Setenv("AUTH_COOKIE_SAMESITE", "loose")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AUTH_COOKIE_SAMESITE must be lax, strict or none")
+}
+
+// TestLoad_InvalidValues tests that every invalid value is reported in one error.
+func TestLoad_InvalidValues(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RATE_LIMIT_MAX", "0")
+	t.Setenv("CACHE_COMPRESSION", "lz4")
+	t.Setenv("REALTIME_LEADER_TTL", "1s")
+	t.Setenv("REALTIME_LEADER_ELECTION", "maybe")
+	t.Setenv("REALTIME_BACKFILL_COLUMN", "updated_at;drop")
+
+	_, err := Load()
+	require.Error(t, err)
+	for _, name := range []string{"RATE_LIMIT_MAX", "CACHE_COMPRESSION", "REALTIME_LEADER_TTL", "REALTIME_LEADER_ELECTION", "REALTIME_BACKFILL_COLUMN"} {
+		assert.Contains(t, err.Error(), name)
+	}
+}
+
+// TestLoad_RealtimeReconnect tests the heartbeat and reconnect settings and their bounds.
+func TestLoad_RealtimeReconnect(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 25*time.Second, cfg.Realtime.HeartbeatInterval)
+	assert.Equal(t, time.Second, cfg.Realtime.ReconnectMinDelay)
+	assert.Equal(t, time.Minute, cfg.Realtime.ReconnectMaxDelay)
+	assert.Equal(t, 0, cfg.Realtime.MaxReconnects)
+
+	t.Setenv("REALTIME_RECONNECT_MIN_DELAY", "30s")
+	t.Setenv("REALTIME_RECONNECT_MAX_DELAY", "10s")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REALTIME_RECONNECT_MAX_DELAY (10s) must not be less than REALTIME_RECONNECT_MIN_DELAY (30s)")
+}
+
+// TestLoad_RealtimeSubscriptions tests that subscriptions are added to the built-in prices one,
+// which can be moved to another table, and that invalid ones are reported.
+func TestLoad_RealtimeSubscriptions(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRealtimeSubscriptions(), cfg.Realtime.Subscriptions)
+
+	t.Setenv("REALTIME_SUBSCRIPTIONS", `[
+		{"name": "prices", "table": "artist_prices", "columns": {"price": "amount"}},
+		{"table": "listings", "filter": "status=eq.live", "columns": {"id": "listing_id", "title": "title"},
+		 "cache_key": "listing:{id}", "cache_ttl": "10m", "topic": "listing_update", "events": ["INSERT", "DELETE"]}
+	]`)
+	cfg, err = Load()
+	require.NoError(t, err)
+	require.Len(t, cfg.Realtime.Subscriptions, 2)
+	prices := cfg.Realtime.Subscriptions[0]
+	assert.Equal(t, "artist_prices", prices.Table)
+	assert.Equal(t, map[string]string{"artist_id": "artist_id", "price": "amount"}, prices.Columns)
+	assert.Equal(t, "price:{artist_id}", prices.CacheKey)
+	listings := cfg.Realtime.Subscriptions[1]
+	assert.Equal(t, "listings", listings.Name)
+	assert.Equal(t, "public", listings.Schema)
+	assert.Equal(t, 10*time.Minute, listings.CacheTTL)
+	assert.True(t, listings.HandlesEvent("DELETE"))
+	assert.False(t, listings.HandlesEvent("UPDATE"))
+
+	// The same subscriptions from a file
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"table": "listings", "topic": "listing_update"}]`), 0o600))
+	t.Setenv("REALTIME_SUBSCRIPTIONS", "")
+	t.Setenv("REALTIME_SUBSCRIPTIONS_FILE", path)
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "listing_update", cfg.Realtime.Subscriptions[1].Topic)
+
+	t.Setenv("REALTIME_SUBSCRIPTIONS_FILE", "")
+	t.Setenv("REALTIME_SUBSCRIPTIONS", `[
+		{"name": "prices", "topic": "prices"},
+		{"table": "listings", "cache_key": "listing:{slug}", "columns": {"id": "id"}},
+		{"name": "other", "table": "listings", "filter": "status=live", "topic": "x"},
+		{"table": "bad-table", "topic": "x", "events": ["TRUNCATE"]},
+		{"table": "quiet"}
+	]`)
+	_, err = Load()
+	require.Error(t, err)
+	for _, want := range []string{
+		"cache_key, topic and events of the prices subscription can't be changed",
+		"cache_key placeholder {slug} is not one of its columns",
+		"table public.listings has more than one subscription",
+		`filter must look like column=eq.value`,
+		`table must be a table name (letters, digits and _), got "bad-table"`,
+		`events must be INSERT, UPDATE or DELETE, got "TRUNCATE"`,
+		`subscription "quiet": needs a cache_key, a topic or both`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	t.Setenv("REALTIME_SUBSCRIPTIONS", `[{"table": "listings", "topc": "x"}]`)
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown field "topc"`)
+}
+
+// TestLoad_Middleware tests the middleware lists and their conflicts.
+func TestLoad_Middleware(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MIDDLEWARE_ENABLE", "compress, security_headers")
+	t.Setenv("MIDDLEWARE_DISABLE", "capture")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Middleware{Enable: []string{"compress", "security_headers"}, Disable: []string{"capture"}}, cfg.Middleware)
+
+	t.Setenv("MIDDLEWARE_DISABLE", "compress")
+	t.Setenv("MIDDLEWARE", "recover,tenant,recover")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"compress" is in both MIDDLEWARE_ENABLE and MIDDLEWARE_DISABLE`)
+	assert.Contains(t, err.Error(), `MIDDLEWARE lists "recover" twice`)
+}
+
+// TestLoad_Production tests the settings production requires.
+func TestLoad_Production(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GO_ENV", "production")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ALLOWED_ORIGINS is required in production")
+	assert.Contains(t, err.Error(), "JWT_SECRET or SUPABASE_URL is required in production")
+
+	t.Setenv("ALLOWED_ORIGINS", "https://app.example.com")
+	t.Setenv("JWT_SECRET", "secret")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.IsProduction())
+	assert.Equal(t, "https://app.example.com", cfg.Server.AllowedOrigins)
+}
+
+// TestLoad_TrustedProxies tests that the proxy check requires a proxy list.
+func TestLoad_TrustedProxies(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("ENABLE_TRUSTED_PROXY_CHECK", "true")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TRUSTED_PROXIES is required")
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.1"}, cfg.Server.TrustedProxies)
+}
+
+// TestLoad_HTTP2 tests the HTTP/2 modes and that TLS needs a certificate and key.
+func TestLoad_HTTP2(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("HTTP2", "H2C")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, HTTP2Cleartext, cfg.Server.HTTP2)
+
+	t.Setenv("HTTP2", "tls")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS_CERT_FILE and TLS_KEY_FILE are required when HTTP2=tls")
+
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/cert.pem")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/key.pem")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, HTTP2TLS, cfg.Server.HTTP2)
+
+	t.Setenv("HTTP2", "quic")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP2 must be off, tls or h2c")
+}
+
+// TestLoad_Egress tests the outbound allowlist, which always includes the configured upstreams.
+func TestLoad_Egress(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("SUPABASE_URL", "https://Project.supabase.co")
+	t.Setenv("UPSTASH_REDIS_URL", "https://cache.upstash.io:443")
+	t.Setenv("EGRESS_ALLOWED_HOSTS", "*.example.com")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.example.com", "project.supabase.co", "cache.upstash.io:443"}, cfg.Egress.AllowedHosts)
+	assert.Equal(t, []string{"https"}, cfg.Egress.AllowedSchemes)
+	assert.True(t, cfg.Egress.AllowLoopback)
+
+	// Production doesn't allow localhost unless asked to
+	t.Setenv("GO_ENV", "production")
+	t.Setenv("ALLOWED_ORIGINS", "https://app.example.com")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.False(t, cfg.Egress.AllowLoopback)
+
+	t.Setenv("SUPABASE_URL", "project.supabase.co")
+	t.Setenv("EGRESS_ALLOWED_SCHEMES", "https,ftp")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SUPABASE_URL must be an absolute URL")
+	assert.Contains(t, err.Error(), "EGRESS_ALLOWED_SCHEMES must only list http or https")
+}
+
+// TestLoad_Memory tests the GOMEMLIMIT and GOGC syntax and the watchdog thresholds.
+func TestLoad_Memory(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Memory{GCPercent: 100, WatchdogInterval: 5 * time.Second, WarnThreshold: 0.8, ShedThreshold: 0.9, ShedFraction: 0.1}, cfg.Memory)
+
+	for value, expected := range map[string]int64{"450MiB": 450 << 20, "1GiB": 1 << 30, "2048": 2048, "512B": 512, "off": 0} {
+		t.Setenv("GOMEMLIMIT", value)
+		cfg, err = Load()
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, cfg.Memory.Limit, value)
+	}
+	t.Setenv("GOGC", "off")
+	t.Setenv("MEMORY_LIMIT_PERCENT", "90")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, -1, cfg.Memory.GCPercent)
+	assert.Equal(t, 90, cfg.Memory.LimitPercent)
+
+	t.Setenv("GOMEMLIMIT", "450MB")
+	t.Setenv("GOGC", "-5")
+	t.Setenv("MEMORY_LIMIT_PERCENT", "120")
+	t.Setenv("MEMORY_WARN_THRESHOLD", "0.95")
+	t.Setenv("MEMORY_SHED_FRACTION", "2")
+	_, err = Load()
+	require.Error(t, err)
+	for _, name := range []string{"GOMEMLIMIT", "GOGC", "MEMORY_LIMIT_PERCENT must be at most 100", "MEMORY_WARN_THRESHOLD (0.95)", "MEMORY_SHED_FRACTION"} {
+		assert.Contains(t, err.Error(), name)
+	}
+}
+
+// TestLoad_Proxy tests the proxy client's defaults and validation.
+func TestLoad_Proxy(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Proxy{
+		MaxIdleConns: 64, IdleTimeout: 90 * time.Second, DialTimeout: 5 * time.Second, TLSTimeout: 5 * time.Second,
+		ResponseTimeout: 30 * time.Second, Timeout: time.Minute, RetryBackoff: 100 * time.Millisecond,
+	}, cfg.Proxy)
+
+	t.Setenv("PROXY_TIMEOUT", "0")
+	t.Setenv("PROXY_RETRIES", "2")
+	t.Setenv("PROXY_MAX_CONNS", "100")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), cfg.Proxy.Timeout)
+	assert.Equal(t, 2, cfg.Proxy.Retries)
+	assert.Equal(t, 100, cfg.Proxy.MaxConns)
+
+	t.Setenv("PROXY_MAX_IDLE_CONNS", "0")
+	t.Setenv("PROXY_DIAL_TIMEOUT", "soon")
+	t.Setenv("PROXY_RETRIES", "-1")
+	_, err = Load()
+	require.Error(t, err)
+	for _, name := range []string{"PROXY_MAX_IDLE_CONNS", "PROXY_DIAL_TIMEOUT", "PROXY_RETRIES"} {
+		assert.Contains(t, err.Error(), name)
+	}
+}
+
+// TestLoad_APIKeys tests the API key store and the rate-limit tiers.
+func TestLoad_APIKeys(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Auth.APIKeys)
+	assert.Equal(t, "api_keys", cfg.Auth.APIKeyTable)
+	assert.Equal(t, time.Minute, cfg.Auth.APIKeyCacheTTL)
+	assert.Empty(t, cfg.RateLimit.Tiers)
+
+	t.Setenv("API_KEYS", "table")
+	t.Setenv("SUPABASE_URL", "https://example.supabase.co")
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "service")
+	t.Setenv("RATE_LIMIT_TIERS", "partner=1000, internal = 5000")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, APIKeysTable, cfg.Auth.APIKeys)
+	assert.Equal(t, map[string]int{"partner": 1000, "internal": 5000}, cfg.RateLimit.Tiers)
+
+	t.Setenv("API_KEYS", "redis") // Without a cache
+	t.Setenv("RATE_LIMIT_TIERS", "partner")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "API_KEYS=redis")
+	assert.Contains(t, err.Error(), "RATE_LIMIT_TIERS")
+
+	t.Setenv("RATE_LIMIT_TIERS", "")
+	t.Setenv("API_KEYS", "table")
+	t.Setenv("API_KEYS_TABLE", "keys; drop")
+	_, err = Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "API_KEYS_TABLE")
+}
+
+// TestLoad_Subsystems tests the defaults and validation of the database, job, resource, webhook,
+// push, Edge Functions and monitor settings.
+func TestLoad_Subsystems(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, Database{
+		MaxConns: 10, MaxConnLifetime: 30 * time.Minute, MaxConnIdleTime: 5 * time.Minute, ConnectTimeout: 5 * time.Second,
+		MaxReplicaLag: 10 * time.Second, ReplicaCheckInterval: 5 * time.Second, StatementTimeout: 30 * time.Second, TxMaxAttempts: 3,
+	}, cfg.Database)
+	assert.Equal(t, QueryCache{Enabled: true, TTL: time.Minute}, cfg.QueryCache)
+	assert.Equal(t, Jobs{
+		Workers: 4, PollInterval: time.Second, Timeout: 5 * time.Minute, MaxAttempts: 5, BackoffMin: 10 * time.Second, BackoffMax: time.Hour,
+	}, cfg.Jobs)
+	assert.Equal(t, Resource{Retention: 720 * time.Hour, PurgeInterval: time.Hour, CacheTTL: time.Minute}, cfg.Resource)
+	assert.Equal(t, Webhook{DedupTTL: 72 * time.Hour}, cfg.Webhook)
+	assert.Equal(t, Push{Workers: 4, QueueSize: 1000, Retries: 3, RetryBackoff: 2 * time.Second}, cfg.Push)
+	assert.Equal(t, Functions{Timeout: 30 * time.Second, RetryBackoff: 200 * time.Millisecond}, cfg.Functions)
+	assert.Equal(t, Monitor{Enabled: true, Interval: 15 * time.Second}, cfg.Monitor)
+
+	t.Setenv("DATABASE_REPLICA_URLS", "postgres://replica-1, ,postgres://replica-2")
+	t.Setenv("JOBS_WORKERS", "0")
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "new, old")
+	t.Setenv("FUNCTIONS_ALLOWED", "hello-world,compute")
+	t.Setenv("QUERY_CACHE", "false")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"postgres://replica-1", "postgres://replica-2"}, cfg.Database.ReplicaURLs)
+	assert.Equal(t, 0, cfg.Jobs.Workers)
+	assert.Equal(t, []string{"new", "old"}, cfg.Webhook.GitHubSecrets)
+	assert.Equal(t, []string{"hello-world", "compute"}, cfg.Functions.Allowed)
+	assert.False(t, cfg.QueryCache.Enabled)
+
+	t.Setenv("DATABASE_MIN_CONNS", "20")
+	t.Setenv("JOBS_BACKOFF_MIN", "2h")
+	t.Setenv("RESOURCE_RETENTION", "-1h")
+	t.Setenv("PUSH_WORKERS", "0")
+	t.Setenv("APNS_KEY_FILE", "AuthKey.p8")
+	t.Setenv("MONITOR", "no")
+	_, err = Load()
+	require.Error(t, err)
+	for _, name := range []string{
+		"DATABASE_MIN_CONNS (20)", "JOBS_BACKOFF_MAX (1h0m0s)", "RESOURCE_RETENTION", "PUSH_WORKERS", "APNS_KEY_ID", "MONITOR",
+	} {
+		assert.Contains(t, err.Error(), name)
+	}
+}
+
+// TestLoadFiles tests that .env.<GO_ENV> wins over .env and the environment wins over both.
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("PORT=3000\nSCOPE_CLAIM=scope\nRATE_LIMIT_MAX=100\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env.staging"), []byte("PORT=4000\nRATE_LIMIT_MAX=200\n"), 0o600))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	clearEnv(t)
+	t.Setenv("GO_ENV", "staging")
+	t.Setenv("RATE_LIMIT_MAX", "300")
+	// godotenv only fills unset variables
+	for _, name := range []string{"PORT", "SCOPE_CLAIM"} {
+		os.Unsetenv(name)
+	}
+
+	LoadFiles()
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "4000", cfg.Port)
+	assert.Equal(t, "scope", cfg.Auth.ScopeClaim)
+	assert.Equal(t, 300, cfg.RateLimit.Max)
+}
+
+// TestReloadFiles tests that reloading applies edits of the files, unsets the variables removed
+// from them, and leaves the environment's variables alone.
+func TestReloadFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0o600))
+	}
+	write("PORT=3000\nSCOPE_CLAIM=roles\nRATE_LIMIT_MAX=100\n")
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	clearEnv(t)
+	t.Setenv("RATE_LIMIT_MAX", "300")
+	for _, name := range []string{"PORT", "SCOPE_CLAIM"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	LoadFiles()
+	write("PORT=4000\nRATE_LIMIT_MAX=200\n")
+	ReloadFiles()
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "4000", cfg.Port)
+	assert.Equal(t, "scope", cfg.Auth.ScopeClaim, "removed from the file, back to the default")
+	assert.Equal(t, 300, cfg.RateLimit.Max)
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PricesSubscription is the name of the built-in subscription feeding artist prices to the cache
+// (price:<artist_id>) and to WebSocket clients (price_update). Its table, schema, filter, columns
+// (artist_id and price) and cache_ttl can be changed by listing a subscription with this name; its
+// cache key, topic and events can't, since the GraphQL proxy and the WebSocket protocol depend on
+// them.
+const PricesSubscription = "prices"
+
+// RealtimeSubscription is one table the Realtime subscriber listens to (see REALTIME_SUBSCRIPTIONS).
+type RealtimeSubscription struct {
+	Name   string `json:"name"`   // Unique, used in logs and messages (default: the table)
+	Schema string `json:"schema"` // Default public
+	Table  string `json:"table"`
+
+	// Filter limits the rows Supabase sends, in Realtime filter syntax (e.g. "status=eq.live").
+	// It replaces the REALTIME_TENANT_IDS filter on the server; tenants are still checked here.
+	Filter string `json:"filter,omitempty"`
+
+	// Columns maps the fields of the cached value and WebSocket message to table columns
+	// ({"id": "listing_id"}). Empty: every column, under its own name.
+	Columns map[string]string `json:"columns,omitempty"`
+
+	// CacheKey is the key template the row is cached under, with {field} placeholders
+	// ("listing:{id}"), scoped to the row's tenant. Empty: not cached.
+	CacheKey string        `json:"cache_key,omitempty"`
+	CacheTTL time.Duration `json:"-"` // cache_ttl, e.g. "10m" (default 5m)
+
+	// Topic is the WebSocket message type rows are broadcast as (e.g. "listing_update"). Empty:
+	// not broadcast.
+	Topic string `json:"topic,omitempty"`
+
+	// Events are the change types handled: INSERT, UPDATE and DELETE (default INSERT and UPDATE).
+	// Deleted rows are removed from the cache.
+	Events []string `json:"events,omitempty"`
+}
+
+// UnmarshalJSON reads a subscription with cache_ttl as a duration string.
+func (s *RealtimeSubscription) UnmarshalJSON(data []byte) error {
+	type plain RealtimeSubscription
+	var raw struct {
+		plain
+		CacheTTL string `json:"cache_ttl"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	*s = RealtimeSubscription(raw.plain)
+	if raw.CacheTTL != "" {
+		ttl, err := time.ParseDuration(raw.CacheTTL)
+		if err != nil {
+			return fmt.Errorf("cache_ttl: %w", err)
+		}
+		s.CacheTTL = ttl
+	}
+	return nil
+}
+
+// HandlesEvent reports whether the subscription handles changes of type event.
+func (s RealtimeSubscription) HandlesEvent(event string) bool {
+	return slices.Contains(s.Events, event)
+}
+
+// DefaultRealtimeSubscriptions returns the built-in subscriptions: artist prices from
+// public.artist_metrics.
+func DefaultRealtimeSubscriptions() []RealtimeSubscription {
+	return []RealtimeSubscription{{
+		Name:     PricesSubscription,
+		Schema:   "public",
+		Table:    "artist_metrics",
+		Columns:  map[string]string{"artist_id": "artist_id", "price": "price"},
+		CacheKey: "price:{artist_id}",
+		CacheTTL: 5 * time.Minute,
+		Topic:    "price_update",
+		Events:   []string{"INSERT", "UPDATE"},
+	}}
+}
+
+// filterPattern is a Realtime filter: column=operator.value.
+var filterPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(eq|neq|lt|lte|gt|gte|in)\.(.+)$`)
+
+// placeholderPattern is a {field} placeholder of a cache key template.
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// subscriptions reads REALTIME_SUBSCRIPTIONS (a JSON array) or the JSON file named by
+// REALTIME_SUBSCRIPTIONS_FILE, and returns them after the built-in ones. A subscription named
+// "prices" changes the built-in one instead.
+func (l *loader) subscriptions(name, fileName string) []RealtimeSubscription {
+	subscriptions := DefaultRealtimeSubscriptions()
+
+	raw := strings.TrimSpace(os.Getenv(name))
+	source := name
+	if path := strings.TrimSpace(os.Getenv(fileName)); path != "" {
+		if raw != "" {
+			l.fail("set %s or %s, not both", name, fileName)
+			return subscriptions
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.fail("%s: %v", fileName, err)
+			return subscriptions
+		}
+		raw, source = string(data), fileName
+	}
+	if raw == "" {
+		return subscriptions
+	}
+
+	var configured []RealtimeSubscription
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		l.fail("%s must be a JSON array of subscriptions: %v", source, err)
+		return subscriptions
+	}
+
+	for _, subscription := range configured {
+		if subscription.Name == PricesSubscription {
+			builtin := subscriptions[0]
+			if (subscription.CacheKey != "" && subscription.CacheKey != builtin.CacheKey) ||
+				(subscription.Topic != "" && subscription.Topic != builtin.Topic) || len(subscription.Events) > 0 {
+				l.fail("%s: cache_key, topic and events of the prices subscription can't be changed", source)
+			}
+			subscriptions[0] = mergePrices(builtin, subscription)
+			continue
+		}
+		if subscription.Name == "" {
+			subscription.Name = subscription.Table
+		}
+		if subscription.Schema == "" {
+			subscription.Schema = "public"
+		}
+		if subscription.CacheTTL == 0 {
+			subscription.CacheTTL = 5 * time.Minute
+		}
+		if len(subscription.Events) == 0 {
+			subscription.Events = []string{"INSERT", "UPDATE"}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	names := make(map[string]bool, len(subscriptions))
+	tables := make(map[string]bool, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if names[subscription.Name] {
+			l.fail("%s: subscription %q is listed twice", source, subscription.Name)
+		}
+		names[subscription.Name] = true
+
+		// The Realtime channel is per table, so changes are told apart by their table
+		table := subscription.Schema + "." + subscription.Table
+		if tables[table] {
+			l.fail("%s: table %s has more than one subscription", source, table)
+		}
+		tables[table] = true
+
+		l.validateSubscription(source, subscription)
+	}
+	return subscriptions
+}
+
+// mergePrices applies the configured fields of the "prices" subscription to the built-in one
+// (all but its cache key, topic and events).
+func mergePrices(builtin, configured RealtimeSubscription) RealtimeSubscription {
+	if configured.Schema != "" {
+		builtin.Schema = configured.Schema
+	}
+	if configured.Table != "" {
+		builtin.Table = configured.Table
+	}
+	if configured.Filter != "" {
+		builtin.Filter = configured.Filter
+	}
+	for field, column := range configured.Columns {
+		builtin.Columns[field] = column
+	}
+	if configured.CacheTTL != 0 {
+		builtin.CacheTTL = configured.CacheTTL
+	}
+	return builtin
+}
+
+// validateSubscription checks one subscription.
+func (l *loader) validateSubscription(source string, s RealtimeSubscription) {
+	prefix := fmt.Sprintf("%s: subscription %q", source, s.Name)
+	if !validColumn(s.Table) {
+		l.fail("%s: table must be a table name (letters, digits and _), got %q", prefix, s.Table)
+	}
+	if !validColumn(s.Schema) {
+		l.fail("%s: schema must be a schema name (letters, digits and _), got %q", prefix, s.Schema)
+	}
+	if s.Filter != "" && !filterPattern.MatchString(s.Filter) {
+		l.fail("%s: filter must look like column=eq.value (eq, neq, lt, lte, gt, gte or in), got %q", prefix, s.Filter)
+	}
+	for field, column := range s.Columns {
+		if field == "" || !validColumn(column) {
+			l.fail("%s: columns must map field names to column names, got %q: %q", prefix, field, column)
+		}
+	}
+	for _, event := range s.Events {
+		if event != "INSERT" && event != "UPDATE" && event != "DELETE" {
+			l.fail("%s: events must be INSERT, UPDATE or DELETE, got %q", prefix, event)
+		}
+	}
+	if s.CacheTTL < 0 {
+		l.fail("%s: cache_ttl must not be negative", prefix)
+	}
+	if s.Name == PricesSubscription {
+		return
+	}
+
+	if s.CacheKey == "" && s.Topic == "" {
+		l.fail("%s: needs a cache_key, a topic or both", prefix)
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(s.CacheKey, -1) {
+		if _, ok := s.Columns[match[1]]; !ok && len(s.Columns) > 0 {
+			l.fail("%s: cache_key placeholder {%s} is not one of its columns", prefix, match[1])
+		}
+	}
+	if s.CacheKey != "" && !placeholderPattern.MatchString(s.CacheKey) {
+		l.fail("%s: cache_key needs a {field} placeholder, or every row would share one key", prefix)
+	}
+}
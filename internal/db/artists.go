@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"boilerplate/internal/querycache"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Artist is a row of the artists table (see internal/resource/schema.sql).
+type Artist struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"-"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+// ArtistRepository reads and writes a tenant's live (not soft-deleted) artists. It is the
+// example to copy for other tables: SQL stays in the repository, callers get typed rows and
+// ErrNotFound.
+type ArtistRepository struct {
+	q     Querier
+	cache *querycache.Cache // Of reads, see WithCache
+}
+
+// artistColumns are the columns scanned by scanArtist, in order.
+const artistColumns = `id, tenant_id, name, created_at, updated_at, version`
+
+// NewArtistRepository returns a repository querying q: the pool, or a transaction.
+func NewArtistRepository(q Querier) *ArtistRepository {
+	return &ArtistRepository{q: q}
+}
+
+// WithCache returns a copy of the repository caching its reads in c (nil caches nothing): Get
+// tagged with ArtistTag, List and Count with ArtistsTag. Rename invalidates both. Don't cache a
+// repository on a transaction, whose writes aren't committed yet: invalidate the tags once
+// WithTx returns instead. Nor with WithReadOnly contexts: a lagging replica's rows would be
+// cached as current.
+func (r *ArtistRepository) WithCache(c *querycache.Cache) *ArtistRepository {
+	return &ArtistRepository{q: r.q, cache: c}
+}
+
+// ArtistTag returns the query cache tag of an artist.
+func ArtistTag(id string) string {
+	return querycache.Tag("artist", id)
+}
+
+// ArtistsTag returns the query cache tag of a tenant's artist list.
+func ArtistsTag(tenantID string) string {
+	return querycache.Tag("artists", tenantID)
+}
+
+// Get returns an artist of the tenant, or ErrNotFound.
+func (r *ArtistRepository) Get(ctx context.Context, tenantID, id string) (*Artist, error) {
+	artist, err := querycache.Fetch(r.cache, querycache.Query{
+		Name: "artists.get",
+		Args: []any{tenantID, id},
+		Tags: []string{ArtistTag(id)},
+	}, func() (*Artist, error) { return r.get(ctx, tenantID, id) })
+	if artist != nil {
+		artist.TenantID = tenantID // Not cached: it isn't serialized
+	}
+	return artist, err
+}
+
+// get reads an artist from the database.
+func (r *ArtistRepository) get(ctx context.Context, tenantID, id string) (*Artist, error) {
+	row := r.q.QueryRow(ctx, `select `+artistColumns+` from artists
+		where tenant_id = $1 and id = $2 and deleted_at is null`, tenantID, id)
+	return scanArtist(row)
+}
+
+// List returns up to limit of the tenant's artists by name, skipping the first offset.
+func (r *ArtistRepository) List(ctx context.Context, tenantID string, limit, offset int) ([]Artist, error) {
+	artists, err := querycache.Fetch(r.cache, querycache.Query{
+		Name: "artists.list",
+		Args: []any{tenantID, limit, offset},
+		Tags: []string{ArtistsTag(tenantID)},
+	}, func() ([]Artist, error) { return r.list(ctx, tenantID, limit, offset) })
+	for i := range artists {
+		artists[i].TenantID = tenantID
+	}
+	return artists, err
+}
+
+// list reads a page of artists from the database.
+func (r *ArtistRepository) list(ctx context.Context, tenantID string, limit, offset int) ([]Artist, error) {
+	rows, err := r.q.Query(ctx, `select `+artistColumns+` from artists
+		where tenant_id = $1 and deleted_at is null
+		order by name, id
+		limit $2 offset $3`, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artists := []Artist{}
+	for rows.Next() {
+		artist, err := scanArtist(rows)
+		if err != nil {
+			return nil, err
+		}
+		artists = append(artists, *artist)
+	}
+	return artists, rows.Err()
+}
+
+// Count returns the number of the tenant's artists.
+func (r *ArtistRepository) Count(ctx context.Context, tenantID string) (int, error) {
+	return querycache.Fetch(r.cache, querycache.Query{
+		Name: "artists.count",
+		Args: []any{tenantID},
+		Tags: []string{ArtistsTag(tenantID)},
+	}, func() (int, error) { return r.count(ctx, tenantID) })
+}
+
+// count counts artists in the database.
+func (r *ArtistRepository) count(ctx context.Context, tenantID string) (int, error) {
+	var count int
+	err := r.q.QueryRow(ctx, `select count(*) from artists where tenant_id = $1 and deleted_at is null`, tenantID).Scan(&count)
+	return count, err
+}
+
+// Rename sets an artist's name if it is still at version, and returns the updated row:
+// ErrConflict if it changed since, ErrNotFound if it doesn't exist.
+func (r *ArtistRepository) Rename(ctx context.Context, tenantID, id, name string, version int) (*Artist, error) {
+	row := r.q.QueryRow(ctx, `update artists
+		set name = $4, updated_at = now(), version = version + 1
+		where tenant_id = $1 and id = $2 and version = $3 and deleted_at is null
+		returning `+artistColumns, tenantID, id, version, name)
+	artist, err := scanArtist(row)
+	if err == nil {
+		if invalidateErr := r.cache.Invalidate(ArtistTag(id), ArtistsTag(tenantID)); invalidateErr != nil {
+			// Cached reads stay stale until their TTL ends
+			slog.Warn("Failed to invalidate cached artists", "artist", id, "error", invalidateErr)
+		}
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return artist, err
+	}
+	// Nothing updated: tell a stale version from a missing row, reading the database
+	if _, getErr := r.get(ctx, tenantID, id); getErr != nil {
+		return nil, getErr
+	}
+	return nil, ErrConflict
+}
+
+// scanArtist scans a row of artistColumns.
+func scanArtist(row pgx.Row) (*Artist, error) {
+	var artist Artist
+	err := row.Scan(&artist.ID, &artist.TenantID, &artist.Name, &artist.CreatedAt, &artist.UpdatedAt, &artist.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
@@ -0,0 +1,294 @@
+package db
+
+// Package db queries the Supabase Postgres database directly, over a pgx connection pool, for
+// server-side queries that don't fit the GraphQL and REST proxies (joins, aggregates, writes
+// spanning several tables) or that shouldn't pay for an HTTP round trip.
+//
+// DATABASE_URL is the connection string from the Supabase dashboard (Project Settings >
+// Database), e.g. postgres://postgres.<ref>:<password>@aws-0-eu-central-1.pooler.supabase.com:5432/postgres.
+// Both the session (5432) and transaction (6543) pooler ports work: statements are not prepared
+// by name, which transaction pooling doesn't support. Without DATABASE_URL the package is
+// disabled and Get returns nil.
+//
+// The connection bypasses row level security, like the service role key: queries must filter by
+// user and tenant themselves. Repositories (see ArtistRepository) keep those queries in one place.
+//
+//	artists := db.NewArtistRepository(db.Get())
+//	artist, err := artists.Get(ctx, tenant.ID(c), id)
+//
+// Pool settings: DATABASE_MAX_CONNS (default 10: Supabase limits connections per project),
+// DATABASE_MIN_CONNS (default 0), DATABASE_MAX_CONN_LIFETIME (default 30m),
+// DATABASE_MAX_CONN_IDLE_TIME (default 5m) and DATABASE_CONNECT_TIMEOUT (default 5s). The schema
+// is managed by the migrations of internal/db/migrate.
+//
+// DATABASE_REPLICA_URLS lists read replicas (Supabase read replicas, or pgbouncer endpoints in
+// front of them), comma separated. Queries with a context from WithReadOnly run on them, round
+// robin; RunReplicaMonitor checks their lag every DATABASE_REPLICA_CHECK_INTERVAL (default 5s)
+// and reads go to the primary while a replica is unreachable or more than
+// DATABASE_REPLICA_MAX_LAG (default 10s) behind.
+//
+// WithTx runs a function in a transaction: it commits or rolls back, cancels statements running
+// longer than DATABASE_STATEMENT_TIMEOUT (default 30s), and runs the transaction again after a
+// serialization failure or deadlock, up to DATABASE_TX_MAX_ATTEMPTS times (default 3).
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/startup"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Defaults of the pool settings.
+const (
+	defaultMaxConns        = 10
+	defaultMaxConnLifetime = 30 * time.Minute
+	defaultMaxConnIdleTime = 5 * time.Minute
+	defaultConnectTimeout  = 5 * time.Second
+)
+
+var (
+	// DefaultDB is the pool the application queries. It is nil until Init() or SetDefault() is
+	// called, and stays nil without DATABASE_URL.
+	DefaultDB *DB
+
+	// ErrNotFound is returned by repositories for rows that don't exist (or aren't visible to the
+	// caller's tenant).
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned by repositories for writes made at a version the row is no longer at.
+	ErrConflict = errors.New("row was modified concurrently")
+)
+
+// Querier runs queries: a *DB, or a pgx.Tx inside a transaction. Repositories take a Querier so
+// they can be used either way.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// DB is a connection pool to the database, and to its read replicas.
+type DB struct {
+	pool           *pgxpool.Pool
+	replicas       []*replica
+	next           atomic.Uint64 // Round robin over the replicas
+	maxLag         time.Duration
+	checkInterval  time.Duration
+	connectTimeout time.Duration
+
+	statementTimeout time.Duration // Of WithTx transactions
+	txMaxAttempts    int
+}
+
+// Options configures a pool. Zero values use the defaults.
+type Options struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	ConnectTimeout  time.Duration // Of the first connection, made by Open
+
+	ReplicaURLs          []string      // Read replicas, with the same pool settings
+	MaxReplicaLag        time.Duration // Beyond it, reads go to the primary
+	ReplicaCheckInterval time.Duration // Of RunReplicaMonitor
+
+	StatementTimeout time.Duration // Of WithTx transactions' statements
+	TxMaxAttempts    int           // Of WithTx transactions failing with serialization errors
+}
+
+// Init opens the default pool from DATABASE_URL and the DATABASE_* settings. Without DATABASE_URL
+// the database is disabled. On error (invalid URL, unreachable database) DefaultDB stays nil.
+func Init(cfg config.Database) error {
+	DefaultDB = nil
+	url := cfg.URL
+	if url == "" {
+		startup.Report("database", false, "DATABASE_URL not set")
+		return nil
+	}
+
+	opts := Options{
+		MaxConns:        int32(cfg.MaxConns),
+		MinConns:        int32(cfg.MinConns),
+		MaxConnLifetime: cfg.MaxConnLifetime,
+		MaxConnIdleTime: cfg.MaxConnIdleTime,
+		ConnectTimeout:  cfg.ConnectTimeout,
+
+		ReplicaURLs:          cfg.ReplicaURLs,
+		MaxReplicaLag:        cfg.MaxReplicaLag,
+		ReplicaCheckInterval: cfg.ReplicaCheckInterval,
+
+		StatementTimeout: cfg.StatementTimeout,
+		TxMaxAttempts:    cfg.TxMaxAttempts,
+	}
+	ctx := context.Background()
+	database, err := Open(ctx, url, opts)
+	if err != nil {
+		startup.Report("database", false, err.Error())
+		return err
+	}
+
+	detail := fmt.Sprintf("%s, up to %d connections", database.pool.Config().ConnConfig.Host, opts.MaxConns)
+	if len(database.replicas) > 0 {
+		usable := 0
+		for _, status := range database.Replicas() {
+			if status.Usable {
+				usable++
+			}
+		}
+		detail += fmt.Sprintf(", %d/%d read replicas usable", usable, len(database.replicas))
+	}
+	DefaultDB = database
+	startup.Report("database", true, detail)
+	return nil
+}
+
+// Open connects to the database at url (a postgres:// URL or key=value connection string) and
+// checks the connection. Replicas are checked once, and read from when they answer.
+func Open(ctx context.Context, url string, opts Options) (*DB, error) {
+	if opts.MaxConns <= 0 {
+		opts.MaxConns = defaultMaxConns
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = defaultConnectTimeout
+	}
+	config, err := poolConfig(url, opts)
+	if err != nil {
+		return nil, errors.New("invalid DATABASE_URL")
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database pool: %w", err)
+	}
+	database := &DB{
+		pool:           pool,
+		maxLag:         orDefault(opts.MaxReplicaLag, defaultMaxReplicaLag),
+		checkInterval:  orDefault(opts.ReplicaCheckInterval, defaultReplicaCheckInterval),
+		connectTimeout: opts.ConnectTimeout,
+
+		statementTimeout: orDefault(opts.StatementTimeout, defaultStatementTimeout),
+		txMaxAttempts:    opts.TxMaxAttempts,
+	}
+	if database.txMaxAttempts <= 0 {
+		database.txMaxAttempts = defaultTxMaxAttempts
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+	defer cancel()
+	if err := database.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+
+	database.replicas, err = openReplicas(opts.ReplicaURLs, opts)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	database.CheckReplicas(ctx)
+	return database, nil
+}
+
+// poolConfig parses url and applies the pool settings of opts (with its defaults set).
+func poolConfig(url string, opts Options) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		// The error may quote the URL, and with it the password: callers replace it
+		return nil, err
+	}
+	config.MaxConns = opts.MaxConns
+	config.MinConns = min(opts.MinConns, opts.MaxConns)
+	config.MaxConnLifetime = orDefault(opts.MaxConnLifetime, defaultMaxConnLifetime)
+	config.MaxConnIdleTime = orDefault(opts.MaxConnIdleTime, defaultMaxConnIdleTime)
+	config.ConnConfig.ConnectTimeout = opts.ConnectTimeout
+	// Unnamed statements work through Supabase's transaction pooler (and pgbouncer)
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	return config, nil
+}
+
+// SetDefault sets the default pool (nil disables the database). Mainly useful in tests.
+func SetDefault(database *DB) {
+	DefaultDB = database
+}
+
+// Get returns the default pool, or nil when the database is not configured.
+func Get() *DB {
+	return DefaultDB
+}
+
+// Close closes the default pool, waiting for queries in progress. Call it on shutdown.
+func Close() {
+	if DefaultDB != nil {
+		DefaultDB.Close()
+	}
+}
+
+// Exec runs a statement that returns no rows.
+func (d *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return d.pool.Exec(ctx, sql, args...)
+}
+
+// Query runs a query returning rows, on a replica when ctx is from WithReadOnly. Close the rows
+// (or read them all) to release the connection.
+func (d *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return d.query(ctx, sql, args...)
+}
+
+// QueryRow runs a query returning at most one row, on a replica when ctx is from WithReadOnly;
+// its error is returned by Scan (pgx.ErrNoRows when there is none).
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if len(d.replicas) == 0 || !IsReadOnly(ctx) {
+		return d.pool.QueryRow(ctx, sql, args...)
+	}
+	rows, err := d.query(ctx, sql, args...)
+	return fallbackRow{rows: rows, err: err}
+}
+
+// Begin starts a transaction on the primary. Roll it back (a no-op after Commit) with defer.
+// Prefer WithTx, which also sets the statement timeout and retries serialization failures.
+func (d *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return d.pool.Begin(ctx)
+}
+
+// Ping checks that a connection to the primary can be acquired and answers.
+func (d *DB) Ping(ctx context.Context) error {
+	return d.pool.Ping(ctx)
+}
+
+// Stats returns the pool's statistics (connections in use, idle, waits).
+func (d *DB) Stats() *pgxpool.Stat {
+	return d.pool.Stat()
+}
+
+// Pool returns the primary's pgx pool, for what DB doesn't wrap (COPY, LISTEN, batches).
+func (d *DB) Pool() *pgxpool.Pool {
+	return d.pool
+}
+
+// Close closes the pools' connections, waiting for those in use to be released.
+func (d *DB) Close() {
+	d.pool.Close()
+	closeReplicas(d.replicas)
+}
+
+// orDefault returns value, or fallback when value isn't positive.
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// Compile-time checks that DB and transactions are Queriers.
+var (
+	_ Querier = (*DB)(nil)
+	_ Querier = (pgx.Tx)(nil)
+)
@@ -0,0 +1,143 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/db"
+)
+
+// Dir is where `migrate create` writes new migrations, relative to the repository root.
+const Dir = "internal/db/migrate/migrations"
+
+// usage lists the commands of Command.
+const usage = `usage: migrate <command>
+
+  up                 apply the pending migrations
+  down [-steps n]    revert the last n applied migrations (default 1)
+  status             list the migrations and whether they are applied
+  create <name>      write an empty migration with the next version`
+
+// slugChars are the characters replaced in the names of created migrations.
+var slugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Command runs a migrations command (see usage) on the database at DATABASE_URL, writing its
+// report to out. It implements cmd/migrate and `server -migrate` (which runs "up").
+func Command(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	steps := flags.Int("steps", 1, "migrations to revert")
+	dir := flags.String("dir", Dir, "directory of the migration files")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+
+	if command == "create" {
+		if flags.NArg() != 1 {
+			return errors.New(usage)
+		}
+		path, err := create(*dir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created %s\n", path)
+		return nil
+	}
+	if command != "up" && command != "down" && command != "status" {
+		return fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
+
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		return errors.New("DATABASE_URL not set")
+	}
+	database, err := db.Open(ctx, url, db.Options{MaxConns: 2})
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch command {
+	case "up":
+		names, err := Up(ctx, database)
+		report(out, "Applied", names)
+		return err
+	case "down":
+		names, err := Down(ctx, database, *steps)
+		report(out, "Reverted", names)
+		return err
+	default:
+		states, err := Status(ctx, database)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.AppliedAt != nil {
+				status = "applied " + state.AppliedAt.Format(time.RFC3339)
+			}
+			if state.Modified {
+				status += " (file changed since)"
+			}
+			if state.Missing {
+				status += " (file missing)"
+			}
+			fmt.Fprintf(out, "%-50s %s\n", state.Name, status)
+		}
+		return nil
+	}
+}
+
+// report writes the migrations a command applied or reverted.
+func report(out io.Writer, verb string, names []string) {
+	if len(names) == 0 {
+		fmt.Fprintln(out, "No migrations to run")
+		return
+	}
+	for _, name := range names {
+		fmt.Fprintf(out, "%s %s\n", verb, name)
+	}
+}
+
+// create writes an empty migration named after name in dir, with the version after the highest
+// one there, and returns its path.
+func create(dir, name string) (string, error) {
+	slug := strings.Trim(slugChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", fmt.Errorf("invalid migration name %q", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir), ".")
+	if err != nil {
+		return "", err
+	}
+	next := 1
+	if len(migrations) > 0 {
+		last, err := strconv.Atoi(migrations[len(migrations)-1].Version)
+		if err != nil {
+			return "", fmt.Errorf("migration %s: version is not a number", migrations[len(migrations)-1].Name)
+		}
+		next = last + 1
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%04d_%s.sql", next, slug))
+	contents := fmt.Sprintf("-- %s\n\n\n%s\n", name, downMarker)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,350 @@
+package migrate
+
+// Package migrate ships the database schema with the application: SQL files embedded from
+// migrations/, applied in version order and recorded in the schema_migrations table.
+//
+// Files are named <version>_<description>.sql (0002_add_artist_genre.sql; `migrate create` picks
+// the next version). Everything above a `-- +migrate Down` line is applied by Up, everything below
+// it reverts the change for Down:
+//
+//	alter table artists add column genre text;
+//
+//	-- +migrate Down
+//	alter table artists drop column genre;
+//
+// Each migration runs in a transaction, unless the file has a `-- +migrate NoTransaction` line
+// (for statements Postgres refuses in one, like `create index concurrently`). Such a file holds a
+// single statement per section, written so it can be re-run (`if not exists`).
+//
+// Migrations are applied by `go run ./cmd/migrate up`, by `server -migrate` (e.g. as the release
+// command of a deploy), or at startup with DATABASE_MIGRATE=true (see Init). Instances running
+// them together take turns on an advisory lock.
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/db"
+	"boilerplate/internal/startup"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// files are the embedded migrations.
+//
+//go:embed migrations/*.sql
+var files embed.FS
+
+// lockID is the advisory lock held while migrations run, so instances starting together don't
+// apply them twice.
+const lockID = 7_274_001
+
+// Annotations recognized in migration files.
+const (
+	downMarker          = "-- +migrate Down"
+	noTransactionMarker = "-- +migrate NoTransaction"
+)
+
+// Migration is one embedded schema change.
+type Migration struct {
+	Version       string // e.g. 0001
+	Name          string // File name, e.g. 0001_artists_tenant_name_index.sql
+	Up            string
+	Down          string // Empty when the migration can't be reverted
+	NoTransaction bool
+	Checksum      string // Of Up, to detect files edited after they were applied
+}
+
+// State is a migration's state in a database.
+type State struct {
+	Version   string     `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // Nil while pending
+	Modified  bool       `json:"modified,omitempty"`   // Applied from a file that has changed since
+	Missing   bool       `json:"missing,omitempty"`    // Applied, but no longer embedded
+}
+
+// applied is a row of schema_migrations.
+type applied struct {
+	name      string
+	checksum  string // Empty for rows recorded before checksums were
+	appliedAt time.Time
+}
+
+// Init applies the pending migrations to the default database when DATABASE_MIGRATE=true. If they
+// fail, the database is closed and disabled, since queries may expect the new schema.
+func Init(cfg config.Database) error {
+	database := db.Get()
+	if !cfg.Migrate || database == nil {
+		return nil
+	}
+
+	names, err := Up(context.Background(), database)
+	if err != nil {
+		database.Close()
+		db.SetDefault(nil)
+		startup.Report("migrations", false, err.Error())
+		return err
+	}
+	startup.Report("migrations", true, fmt.Sprintf("%d applied", len(names)))
+	return nil
+}
+
+// Migrations returns the embedded migrations, in version order.
+func Migrations() ([]Migration, error) {
+	return Load(files, "migrations")
+}
+
+// Load reads the .sql files of dir, ordered by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	names, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(names))
+	seen := make(map[string]string, len(names))
+	for _, name := range names {
+		base := path.Base(name)
+		version, _, ok := strings.Cut(base, "_")
+		if !ok || version == "" {
+			return nil, fmt.Errorf("migration %s: expected <version>_<description>.sql", base)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, base)
+		}
+		seen[version] = base
+		contents, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migration := parse(string(contents))
+		migration.Version, migration.Name = version, base
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parse splits a migration file into its Up and Down sections.
+func parse(contents string) Migration {
+	var migration Migration
+	up, down, hasDown := contents, "", false
+	for offset := 0; offset < len(contents); {
+		line, _, _ := strings.Cut(contents[offset:], "\n")
+		switch strings.TrimSpace(line) {
+		case noTransactionMarker:
+			migration.NoTransaction = true
+		case downMarker:
+			if !hasDown {
+				up, down, hasDown = contents[:offset], contents[offset+len(line):], true
+			}
+		}
+		offset += len(line) + 1
+	}
+	migration.Up = strings.TrimSpace(up)
+	migration.Down = strings.TrimSpace(down)
+	sum := sha256.Sum256([]byte(migration.Up))
+	migration.Checksum = hex.EncodeToString(sum[:])
+	return migration
+}
+
+// Up applies the embedded migrations database doesn't have yet and returns the names of those it
+// applied. It stops at the first failure, leaving the later ones for the next run.
+func Up(ctx context.Context, database *db.DB) ([]string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = withLock(ctx, database, func(conn *pgxpool.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if record, ok := done[migration.Version]; ok {
+				if record.checksum != "" && record.checksum != migration.Checksum {
+					slog.Warn("Database migration changed after it was applied; add a new one instead", "migration", migration.Name)
+				}
+				continue
+			}
+			err := run(ctx, conn, migration, migration.Up,
+				`insert into schema_migrations (version, name, checksum) values ($1, $2, $3)`,
+				migration.Version, migration.Name, migration.Checksum)
+			if err != nil {
+				return err
+			}
+			slog.Info("Applied database migration", "migration", migration.Name)
+			names = append(names, migration.Name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns their names. Every
+// one must still be embedded and have a Down section.
+func Down(ctx context.Context, database *db.DB, steps int) ([]string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[string]Migration, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var names []string
+	err = withLock(ctx, database, func(conn *pgxpool.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]string, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %s is applied but no longer embedded", done[version].name)
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %s has no %q section", migration.Name, downMarker)
+			}
+			err := run(ctx, conn, migration, migration.Down,
+				`delete from schema_migrations where version = $1`, migration.Version)
+			if err != nil {
+				return err
+			}
+			slog.Info("Reverted database migration", "migration", migration.Name)
+			names = append(names, migration.Name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Status returns the state of every embedded migration, and of applied ones no longer embedded,
+// in version order.
+func Status(ctx context.Context, database *db.DB) ([]State, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	err = withLock(ctx, database, func(conn *pgxpool.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := State{Version: migration.Version, Name: migration.Name}
+			if record, ok := done[migration.Version]; ok {
+				state.AppliedAt = &record.appliedAt
+				state.Modified = record.checksum != "" && record.checksum != migration.Checksum
+				delete(done, migration.Version)
+			}
+			states = append(states, state)
+		}
+		for version, record := range done {
+			states = append(states, State{Version: version, Name: record.name, AppliedAt: &record.appliedAt, Missing: true})
+		}
+		return nil
+	})
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, err
+}
+
+// withLock runs fn on a connection holding the migrations lock, after creating schema_migrations.
+func withLock(ctx context.Context, database *db.DB, fn func(conn *pgxpool.Conn) error) error {
+	if database == nil {
+		return errors.New("database not configured: set DATABASE_URL")
+	}
+	conn, err := database.Pool().Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// A session lock (not a transaction one) spans the transactions of every migration
+	if _, err := conn.Exec(ctx, `select pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `select pg_advisory_unlock($1)`, lockID)
+
+	if _, err := conn.Exec(ctx, `create table if not exists schema_migrations (
+		version    text        primary key,
+		name       text        not null,
+		checksum   text,
+		applied_at timestamptz not null default now()
+	);
+	alter table schema_migrations add column if not exists checksum text`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// appliedMigrations reads schema_migrations, by version.
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[string]applied, error) {
+	rows, err := conn.Query(ctx, `select version, name, coalesce(checksum, ''), applied_at from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[string]applied)
+	for rows.Next() {
+		var version string
+		var record applied
+		if err := rows.Scan(&version, &record.name, &record.checksum, &record.appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = record
+	}
+	return done, rows.Err()
+}
+
+// run executes sql for migration and records it with the record statement, in one transaction
+// unless the migration opted out.
+func run(ctx context.Context, conn *pgxpool.Conn, migration Migration, sql, record string, args ...any) error {
+	if migration.NoTransaction {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+		if _, err := conn.Exec(ctx, record, args...); err != nil {
+			return fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+		return nil
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("migration %s: %w", migration.Name, err)
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return fmt.Errorf("migration %s: %w", migration.Name, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("migration %s: %w", migration.Name, err)
+	}
+	return nil
+}
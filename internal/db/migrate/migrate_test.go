@@ -0,0 +1,140 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"boilerplate/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoad tests that migrations are ordered by version and that versions are unique.
+func TestLoad(t *testing.T) {
+	embedded, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, embedded)
+	for _, migration := range embedded {
+		assert.NotEmpty(t, migration.Down, "%s can be reverted", migration.Name)
+	}
+
+	migrations, err := Load(fstest.MapFS{
+		"migrations/0002_b.sql":  {Data: []byte("select 2")},
+		"migrations/0001_a.sql":  {Data: []byte("select 1")},
+		"migrations/README.md":   {Data: []byte("not a migration")},
+		"migrations/0010_c.sql":  {Data: []byte("select 10")},
+		"other/0003_ignored.sql": {Data: []byte("select 3")},
+	}, "migrations")
+	require.NoError(t, err)
+	var names []string
+	for _, migration := range migrations {
+		names = append(names, migration.Name)
+	}
+	assert.Equal(t, []string{"0001_a.sql", "0002_b.sql", "0010_c.sql"}, names)
+	assert.Equal(t, "select 1", migrations[0].Up)
+
+	_, err = Load(fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("select 1")},
+		"migrations/0001_b.sql": {Data: []byte("select 1")},
+	}, "migrations")
+	assert.ErrorContains(t, err, "same version")
+
+	_, err = Load(fstest.MapFS{"migrations/initial.sql": {Data: []byte("select 1")}}, "migrations")
+	assert.Error(t, err)
+}
+
+// TestParse tests the Up and Down sections and the NoTransaction annotation.
+func TestParse(t *testing.T) {
+	migration := parse("-- Genres\nalter table artists add column genre text;\n\n-- +migrate Down\nalter table artists drop column genre;\n")
+	assert.Equal(t, "-- Genres\nalter table artists add column genre text;", migration.Up)
+	assert.Equal(t, "alter table artists drop column genre;", migration.Down)
+	assert.False(t, migration.NoTransaction)
+
+	concurrent := parse("-- +migrate NoTransaction\ncreate index concurrently if not exists a_idx on a (b);")
+	assert.True(t, concurrent.NoTransaction)
+	assert.Empty(t, concurrent.Down)
+
+	assert.Equal(t, parse("select 1\n-- +migrate Down\nselect 2").Checksum, parse("select 1\n-- +migrate Down\nselect 3").Checksum,
+		"the checksum covers the Up section only")
+	assert.NotEqual(t, parse("select 1").Checksum, parse("select 2").Checksum)
+}
+
+// TestCreate tests that created migrations take the next version.
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	require.NoError(t, Command(context.Background(), []string{"create", "-dir", dir, "Add artist genre"}, &out))
+	require.NoError(t, Command(context.Background(), []string{"create", "-dir", dir, "genre index"}, &out))
+	assert.FileExists(t, filepath.Join(dir, "0001_add_artist_genre.sql"))
+	assert.FileExists(t, filepath.Join(dir, "0002_genre_index.sql"))
+
+	migrations, err := Load(os.DirFS(dir), ".")
+	require.NoError(t, err)
+	assert.Equal(t, "-- Add artist genre", migrations[0].Up)
+
+	assert.Error(t, Command(context.Background(), []string{"create", "-dir", dir, "!!"}, &out))
+	assert.Error(t, Command(context.Background(), []string{"sideways"}, &out))
+	assert.Error(t, Command(context.Background(), nil, &out))
+}
+
+// TestUpDown applies and reverts the embedded migrations in a schema of its own. It needs
+// DATABASE_TEST_URL (e.g. a local `supabase start` database).
+func TestUpDown(t *testing.T) {
+	testURL := os.Getenv("DATABASE_TEST_URL")
+	if testURL == "" {
+		t.Skip("DATABASE_TEST_URL not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+
+	admin, err := db.Open(ctx, testURL, db.Options{MaxConns: 1})
+	require.NoError(t, err)
+	defer admin.Close()
+	_, err = admin.Exec(ctx, `create schema `+schema)
+	require.NoError(t, err)
+	defer admin.Exec(ctx, `drop schema `+schema+` cascade`)
+
+	parsed, err := url.Parse(testURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+	database, err := db.Open(ctx, parsed.String(), db.Options{})
+	require.NoError(t, err)
+	defer database.Close()
+	_, err = database.Exec(ctx, `create table artists (id text primary key, name text not null,
+		tenant_id text not null default '', deleted_at timestamptz)`)
+	require.NoError(t, err)
+
+	embedded, err := Migrations()
+	require.NoError(t, err)
+
+	// Migrations apply once
+	applied, err := Up(ctx, database)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(embedded))
+	applied, err = Up(ctx, database)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	states, err := Status(ctx, database)
+	require.NoError(t, err)
+	require.Len(t, states, len(embedded))
+	assert.NotNil(t, states[0].AppliedAt)
+	assert.False(t, states[0].Modified)
+
+	reverted, err := Down(ctx, database, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{embedded[len(embedded)-1].Name}, reverted)
+	states, err = Status(ctx, database)
+	require.NoError(t, err)
+	assert.Nil(t, states[len(states)-1].AppliedAt)
+}
@@ -0,0 +1,5 @@
+-- ArtistRepository lists a tenant's live artists by name.
+create index if not exists artists_tenant_name_idx on artists (tenant_id, name) where deleted_at is null;
+
+-- +migrate Down
+drop index if exists artists_tenant_name_idx;
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"boilerplate/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Defaults of the replica settings.
+const (
+	defaultMaxReplicaLag        = 10 * time.Second
+	defaultReplicaCheckInterval = 5 * time.Second
+)
+
+// lagQuery returns how far a replica is behind its primary, in seconds: 0 when it has replayed
+// everything it received (an idle primary writes nothing to replay), and 0 on a primary, for
+// pgbouncer endpoints in front of one.
+const lagQuery = `select case
+	when not pg_is_in_recovery() or pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() then 0
+	else coalesce(extract(epoch from now() - pg_last_xact_replay_timestamp()), 0)
+end::float8`
+
+// unavailable is the lag of a replica whose last check failed (or that wasn't checked yet).
+const unavailable = -1
+
+// readOnlyKey is the context key set by WithReadOnly.
+type readOnlyKey struct{}
+
+// WithReadOnly returns a context whose queries (Query, QueryRow) may run on a read replica. Use it
+// for reads that tolerate data up to DATABASE_REPLICA_MAX_LAG old: not for reading back what the
+// request just wrote. Exec and Begin always use the primary.
+//
+//	list, err := artists.List(db.WithReadOnly(ctx), tenantID, 50, 0)
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// IsReadOnly reports whether ctx was marked by WithReadOnly.
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+// replica is a read replica's pool and its last measured lag.
+type replica struct {
+	name string // host:port, for logs and metrics
+	pool *pgxpool.Pool
+	lag  atomic.Int64 // nanoseconds, or unavailable
+}
+
+// usable reports whether reads may go to the replica.
+func (r *replica) usable(maxLag time.Duration) bool {
+	lag := r.lag.Load()
+	return lag != unavailable && time.Duration(lag) <= maxLag
+}
+
+// ReplicaStatus is a read replica's state as of its last check.
+type ReplicaStatus struct {
+	Name   string        `json:"name"`
+	Usable bool          `json:"usable"`
+	Lag    time.Duration `json:"lag"` // -1 while unavailable
+}
+
+// openReplicas creates a pool per replica URL, with the primary's settings. Connections are made
+// by the first check, so an unreachable replica doesn't fail startup.
+func openReplicas(urls []string, opts Options) ([]*replica, error) {
+	replicas := make([]*replica, 0, len(urls))
+	for i, url := range urls {
+		config, err := poolConfig(url, opts)
+		if err != nil {
+			closeReplicas(replicas)
+			return nil, fmt.Errorf("invalid DATABASE_REPLICA_URLS entry %d", i+1)
+		}
+		config.MinConns = 0
+		pool, err := pgxpool.NewWithConfig(context.Background(), config)
+		if err != nil {
+			closeReplicas(replicas)
+			return nil, fmt.Errorf("failed to create replica pool: %w", err)
+		}
+		r := &replica{
+			name: config.ConnConfig.Host + ":" + strconv.Itoa(int(config.ConnConfig.Port)),
+			pool: pool,
+		}
+		r.lag.Store(unavailable)
+		replicas = append(replicas, r)
+	}
+	return replicas, nil
+}
+
+// closeReplicas closes the replicas' pools.
+func closeReplicas(replicas []*replica) {
+	for _, r := range replicas {
+		r.pool.Close()
+	}
+}
+
+// reader returns the pool a query with ctx runs on: the next usable replica, round robin, for
+// read-only contexts, and the primary otherwise or when no replica is usable.
+func (d *DB) reader(ctx context.Context) *pgxpool.Pool {
+	if len(d.replicas) == 0 || !IsReadOnly(ctx) {
+		return d.pool
+	}
+	if r := d.pickReplica(); r != nil {
+		metrics.DatabaseReads.WithLabelValues("replica").Inc()
+		return r.pool
+	}
+	metrics.DatabaseReads.WithLabelValues("primary").Inc()
+	return d.pool
+}
+
+// pickReplica returns the next replica within the maximum lag, or nil when none is. The usable
+// replicas share the reads evenly.
+func (d *DB) pickReplica() *replica {
+	usable := make([]*replica, 0, len(d.replicas))
+	for _, r := range d.replicas {
+		if r.usable(d.maxLag) {
+			usable = append(usable, r)
+		}
+	}
+	if len(usable) == 0 {
+		return nil
+	}
+	return usable[d.next.Add(1)%uint64(len(usable))]
+}
+
+// CheckReplicas measures every replica's lag. Replicas that don't answer, or lag more than
+// DATABASE_REPLICA_MAX_LAG, get no reads until a later check finds them caught up.
+func (d *DB) CheckReplicas(ctx context.Context) {
+	for _, r := range d.replicas {
+		wasUsable := r.usable(d.maxLag)
+
+		checkCtx, cancel := context.WithTimeout(ctx, d.connectTimeout)
+		var seconds float64
+		err := r.pool.QueryRow(checkCtx, lagQuery).Scan(&seconds)
+		cancel()
+		if err != nil {
+			r.lag.Store(unavailable)
+			metrics.DatabaseReplicaLag.WithLabelValues(r.name).Set(unavailable)
+			if wasUsable {
+				slog.Warn("Database replica unavailable, reading from the primary", "replica", r.name, "error", err)
+			}
+			continue
+		}
+
+		lag := time.Duration(seconds * float64(time.Second))
+		r.lag.Store(int64(lag))
+		metrics.DatabaseReplicaLag.WithLabelValues(r.name).Set(lag.Seconds())
+		switch usable := r.usable(d.maxLag); {
+		case wasUsable && !usable:
+			slog.Warn("Database replica lagging, reading from the primary", "replica", r.name, "lag", lag.String())
+		case !wasUsable && usable:
+			slog.Info("Database replica in use", "replica", r.name, "lag", lag.String())
+		}
+	}
+}
+
+// Replicas returns the state of the read replicas.
+func (d *DB) Replicas() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(d.replicas))
+	for i, r := range d.replicas {
+		statuses[i] = ReplicaStatus{Name: r.name, Usable: r.usable(d.maxLag), Lag: time.Duration(r.lag.Load())}
+	}
+	return statuses
+}
+
+// RunReplicaMonitor checks the default pool's replicas every DATABASE_REPLICA_CHECK_INTERVAL,
+// until ctx is cancelled. Start it with `go db.RunReplicaMonitor(ctx)`; it returns at once
+// without replicas.
+func RunReplicaMonitor(ctx context.Context) {
+	database := Get()
+	if database == nil || len(database.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(database.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			database.CheckReplicas(ctx)
+		}
+	}
+}
+
+// query runs a query on the pool ctx routes to. A read-only query that can't reach its replica
+// (nothing was sent) is retried on the primary.
+func (d *DB) query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	pool := d.reader(ctx)
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil && pool != d.pool && isConnectError(err) && ctx.Err() == nil {
+		metrics.DatabaseReads.WithLabelValues("primary").Inc()
+		return d.pool.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+// isConnectError reports whether err means no connection could be made.
+func isConnectError(err error) bool {
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr)
+}
+
+// fallbackRow is the row of a read-only QueryRow, which goes through query to get its fallback.
+type fallbackRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+// Scan reads the first row, like pgx's QueryRow.
+func (r fallbackRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"boilerplate/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Defaults of the transaction settings.
+const (
+	defaultStatementTimeout = 30 * time.Second
+	defaultTxMaxAttempts    = 3
+)
+
+// Delays between attempts of a transaction: short, since the transactions it conflicted with
+// have already ended.
+const (
+	txBackoffMin = 20 * time.Millisecond
+	txBackoffMax = time.Second
+)
+
+// SQLSTATE codes of the errors after which a transaction is run again.
+const (
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+// ErrNotConfigured is returned by WithTx when the database is not configured.
+var ErrNotConfigured = errors.New("database not configured")
+
+// TxOptions configures a transaction. Zero values use the pool's settings.
+type TxOptions struct {
+	IsoLevel         pgx.TxIsoLevel // Default: read committed
+	ReadOnly         bool
+	StatementTimeout time.Duration // Of each statement; DATABASE_STATEMENT_TIMEOUT by default
+	MaxAttempts      int           // Including the first; DATABASE_TX_MAX_ATTEMPTS by default
+}
+
+// WithTx runs fn in a transaction on the default pool. See DB.WithTx.
+func WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	database := Get()
+	if database == nil {
+		return ErrNotConfigured
+	}
+	return database.WithTx(ctx, fn)
+}
+
+// WithTx runs fn in a transaction on the primary, with the default options: it commits when fn
+// returns nil and rolls back when it returns an error or panics. See WithTxOptions.
+//
+//	err := db.WithTx(ctx, func(tx pgx.Tx) error {
+//		artists := db.NewArtistRepository(tx)
+//		...
+//	})
+func (d *DB) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return d.WithTxOptions(ctx, TxOptions{}, fn)
+}
+
+// WithTxOptions runs fn in a transaction configured by opts. Each statement is cancelled after
+// the statement timeout. When the transaction fails with a serialization failure or a deadlock
+// (from a statement or from the commit) it is rolled back and run again, after a short backoff,
+// up to opts.MaxAttempts times: fn must not have side effects outside the transaction, and must
+// return the errors of its statements (wrapped or not) for them to be retried.
+func (d *DB) WithTxOptions(ctx context.Context, opts TxOptions, fn func(tx pgx.Tx) error) error {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = d.txMaxAttempts
+	}
+	timeout := orDefault(opts.StatementTimeout, d.statementTimeout)
+	txOpts := pgx.TxOptions{IsoLevel: opts.IsoLevel}
+	if opts.ReadOnly {
+		txOpts.AccessMode = pgx.ReadOnly
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := d.runTx(ctx, txOpts, timeout, fn)
+		code := retryableCode(err)
+		if code == "" || attempt >= maxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := txBackoff(attempt, rand.Float64)
+		metrics.DatabaseTxRetries.WithLabelValues(code).Inc()
+		slog.Debug("Retrying database transaction", "attempt", attempt, "sqlstate", code, "retry_in", delay.String())
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runTx runs one attempt of a transaction.
+func (d *DB) runTx(ctx context.Context, opts pgx.TxOptions, timeout time.Duration, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := d.pool.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			tx.Rollback(context.WithoutCancel(ctx))
+			panic(recovered)
+		}
+		if err != nil {
+			// A cancelled ctx must not keep the connection from being returned cleanly
+			tx.Rollback(context.WithoutCancel(ctx))
+		}
+	}()
+
+	// set_config with is_local=true is "set local": it ends with the transaction, so it works
+	// through the transaction pooler
+	if _, err := tx.Exec(ctx, `select set_config('statement_timeout', $1, true)`, strconv.FormatInt(timeout.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("failed to set the statement timeout: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// retryableCode returns the SQLSTATE of err when running its transaction again may succeed, and
+// "" otherwise.
+func retryableCode(err error) string {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ""
+	}
+	switch pgErr.Code {
+	case codeSerializationFailure, codeDeadlockDetected:
+		return pgErr.Code
+	}
+	return ""
+}
+
+// txBackoff returns the delay after attempt: the minimum, doubling with every attempt up to the
+// maximum, randomly shortened by up to half so conflicting transactions don't meet again.
+func txBackoff(attempt int, jitter func() float64) time.Duration {
+	delay := txBackoffMin
+	for i := 1; i < attempt && delay < txBackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, txBackoffMax)
+	return delay - time.Duration(jitter()*float64(delay)/2)
+}
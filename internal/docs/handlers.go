@@ -0,0 +1,64 @@
+package docs
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// EndpointsHandler returns the documented endpoint list as JSON, built from the app's live routes.
+// The demo page loads its endpoint lists from here.
+func EndpointsHandler(app *fiber.App) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"endpoints": DefaultRegistry.Endpoints(app.GetRoutes(true)),
+		})
+	}
+}
+
+// OpenAPIHandler returns the OpenAPI document of the app's live routes (GET /openapi.json).
+func OpenAPIHandler(app *fiber.App) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(OpenAPI(DefaultInfo, DefaultRegistry.Endpoints(app.GetRoutes(true))))
+	}
+}
+
+// PageHandler serves Swagger UI for the document at /openapi.json (GET /docs).
+func PageHandler(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.SendString(docsPageHTML)
+}
+
+// swaggerUIVersion is the swagger-ui-dist release the docs page loads from jsDelivr.
+const swaggerUIVersion = "5.17.14"
+
+// docsPageHTML loads Swagger UI, which renders /openapi.json with a try-it console. Tokens
+// entered with "Authorize" are kept across reloads.
+var docsPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>API Documentation</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+    <style>
+        body { margin: 0; }
+        .back { font-family: sans-serif; padding: 0.75rem 1.25rem; background: #667eea; }
+        .back a { color: white; }
+    </style>
+</head>
+<body>
+    <div class="back"><a href="/demo">Back to demo</a></div>
+    <div id="swagger-ui"></div>
+
+    <script src="https://cdn.jsdelivr.net/npm/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js" crossorigin></script>
+    <script>
+        window.ui = SwaggerUIBundle({
+            url: '/openapi.json',
+            dom_id: '#swagger-ui',
+            deepLinking: true,
+            persistAuthorization: true,
+            tryItOutEnabled: true
+        });
+    </script>
+</body>
+</html>
+`
@@ -0,0 +1,228 @@
+package docs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OpenAPIVersion is the OpenAPI version of the generated document.
+const OpenAPIVersion = "3.0.3"
+
+// Document is an OpenAPI 3 document.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"` // Path, then lowercase method
+	Components Components                      `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation is one method on a path.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path parameter.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody is the JSON body an operation takes.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is one response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the security schemes operations refer to.
+type Components struct {
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is how a client authenticates.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`   // Of apiKey schemes: header, query or cookie
+	Name         string `json:"name,omitempty"` // Of apiKey schemes: the header, query parameter or cookie
+	Description  string `json:"description,omitempty"`
+}
+
+// Security schemes of authenticated endpoints: bearerAuth for all, apiKeyAuth as an alternative
+// on the endpoints accepting API keys.
+const (
+	bearerAuth = "bearerAuth"
+	apiKeyAuth = "apiKeyAuth"
+)
+
+// DefaultInfo describes the API in the document served at /openapi.json.
+var DefaultInfo = Info{
+	Title:   "Go Fiber Backend API",
+	Version: "1.0.0",
+	Description: "Generated from the routes registered on this server. Authenticated endpoints take a Supabase " +
+		"access token as a Bearer token.",
+}
+
+// OpenAPI builds the OpenAPI document of the endpoints (see Registry.Endpoints): one operation
+// per endpoint, with its path parameters, request body, success response and, for authenticated
+// endpoints, the bearer scheme and the 401 (and 403 for admin or scoped endpoints) it may return.
+func OpenAPI(info Info, endpoints []Endpoint) Document {
+	document := Document{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]map[string]Operation),
+		Components: Components{SecuritySchemes: map[string]SecurityScheme{
+			bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Supabase access token"},
+			apiKeyAuth: {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key of a machine client"},
+		}},
+	}
+
+	for _, endpoint := range endpoints {
+		path, parameters := openAPIPath(endpoint.Path)
+		if document.Paths[path] == nil {
+			document.Paths[path] = make(map[string]Operation)
+		}
+		operation := newOperation(endpoint)
+		operation.Parameters = parameters
+		document.Paths[path][strings.ToLower(endpoint.Method)] = operation
+	}
+	return document
+}
+
+// newOperation describes an endpoint, apart from its path parameters.
+func newOperation(endpoint Endpoint) Operation {
+	operation := Operation{
+		OperationID: operationID(endpoint),
+		Summary:     endpoint.Summary,
+		Description: endpoint.Description,
+		Tags:        endpoint.Tags,
+		Responses:   make(map[string]Response),
+	}
+
+	// Step 1: The request body, typed by Request, with the example body (if any) as its example
+	if endpoint.Request != nil || endpoint.ExampleBody != "" {
+		schema := SchemaOf(endpoint.Request)
+		if schema == nil {
+			schema = &Schema{Type: "object"}
+		}
+		var example any
+		if json.Unmarshal([]byte(endpoint.ExampleBody), &example) == nil {
+			schema.Example = example
+		}
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{fiber.MIMEApplicationJSON: {Schema: schema}},
+		}
+	}
+
+	// Step 2: The success response, typed by Response
+	switch {
+	case endpoint.WebSocket:
+		operation.Responses[strconv.Itoa(fiber.StatusSwitchingProtocols)] = Response{Description: "Switched to the WebSocket protocol"}
+	case endpoint.Response != nil:
+		operation.Responses[strconv.Itoa(fiber.StatusOK)] = Response{
+			Description: http.StatusText(fiber.StatusOK),
+			Content:     map[string]MediaType{fiber.MIMEApplicationJSON: {Schema: SchemaOf(endpoint.Response)}},
+		}
+	default:
+		operation.Responses[strconv.Itoa(fiber.StatusOK)] = Response{Description: http.StatusText(fiber.StatusOK)}
+	}
+
+	// Step 3: Authentication
+	if endpoint.Auth {
+		operation.Security = []map[string][]string{{bearerAuth: {}}}
+		if endpoint.APIKey {
+			operation.Security = append(operation.Security, map[string][]string{apiKeyAuth: {}})
+		}
+		operation.Responses[strconv.Itoa(fiber.StatusUnauthorized)] = Response{Description: "Missing or invalid token"}
+	}
+	if endpoint.Admin || len(endpoint.Scopes) > 0 {
+		description := "Not an admin"
+		if !endpoint.Admin {
+			description = "Token lacks the scopes " + strings.Join(endpoint.Scopes, ", ")
+		}
+		operation.Responses[strconv.Itoa(fiber.StatusForbidden)] = Response{Description: description}
+	}
+	return operation
+}
+
+// openAPIPath converts a Fiber route path to an OpenAPI path and its parameters:
+// /api/users/:id becomes /api/users/{id}, and a wildcard (* or +) becomes {path}.
+func openAPIPath(path string) (string, []Parameter) {
+	var parameters []Parameter
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name := ""
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name = strings.TrimPrefix(segment, ":")
+			name, _, _ = strings.Cut(name, "<") // Constraints, e.g. :id<int>
+			name = strings.TrimSuffix(name, "?")
+		case segment == "*" || segment == "+":
+			name = "path"
+		default:
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		parameters = append(parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	return strings.Join(segments, "/"), parameters
+}
+
+// operationID names an operation after its method and path, as the generated SDKs name their
+// methods: PUT /api/admin/ratelimit/overrides/:key is putAdminRatelimitOverridesByKey.
+func operationID(endpoint Endpoint) string {
+	id := strings.ToLower(endpoint.Method)
+	for _, segment := range strings.Split(endpoint.Path, "/") {
+		switch {
+		case segment == "" || segment == "api" || segment == "*" || segment == "+":
+			continue
+		case strings.HasPrefix(segment, ":"):
+			name, _, _ := strings.Cut(strings.TrimPrefix(segment, ":"), "<")
+			id += "By" + pascal(strings.TrimSuffix(name, "?"))
+		default:
+			id += pascal(segment)
+		}
+	}
+	return id
+}
+
+// pascal converts snake_case, kebab-case and dotted names to PascalCase.
+func pascal(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package docs
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaNode struct {
+	schemaBase
+	Name      string            `json:"name"`
+	Score     float64           `json:"score,omitempty"`
+	Tags      []string          `json:"tags"`
+	Meta      map[string]any    `json:"meta"`
+	Parent    *schemaNode       `json:"parent"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	Raw       json.RawMessage   `json:"raw"`
+	Secret    string            `json:"-"`
+	internal  string            // Not encoded
+	Counts    map[string]uint64 `json:"counts"`
+}
+
+// TestSchemaOf tests that schemas follow the JSON encoding of the type.
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(schemaNode{})
+	require.NotNil(t, schema)
+	assert.Equal(t, "object", schema.Type)
+
+	assert.Equal(t, "string", schema.Properties["id"].Type, "embedded fields are flattened")
+	assert.Equal(t, "number", schema.Properties["score"].Type)
+	assert.Equal(t, "string", schema.Properties["tags"].Items.Type)
+	assert.Equal(t, &Schema{}, schema.Properties["meta"].AdditionalProperties)
+	assert.Equal(t, "integer", schema.Properties["counts"].AdditionalProperties.Type)
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time", Nullable: true}, schema.Properties["updated_at"])
+	assert.Equal(t, &Schema{}, schema.Properties["raw"])
+
+	// Recursive types end in a plain object
+	assert.Equal(t, &Schema{Type: "object", Nullable: true}, schema.Properties["parent"])
+
+	assert.NotContains(t, schema.Properties, "Secret")
+	assert.NotContains(t, schema.Properties, "internal")
+	assert.Len(t, schema.Properties, 9)
+
+	assert.Nil(t, SchemaOf(nil))
+
+	declared := &Schema{Type: "object", Required: []string{"name"}}
+	copied := SchemaOf(declared)
+	copied.Example = "changed"
+	assert.Nil(t, declared.Example, "declared schemas are copied")
+}
+
+// TestSchemaOf_ValidateTags tests that validation rules OpenAPI can express end up in the schema.
+func TestSchemaOf_ValidateTags(t *testing.T) {
+	type body struct {
+		Name   string   `json:"name" validate:"required,max=100"`
+		Format string   `json:"format" validate:"omitempty,oneof=pdf csv"`
+		Emails []string `json:"emails" validate:"max=10,dive,email"`
+		Note   string   `json:"note"`
+	}
+	schema := SchemaOf(body{})
+
+	assert.Equal(t, []string{"name"}, schema.Required)
+	assert.Equal(t, 100, schema.Properties["name"].MaxLength)
+	assert.Equal(t, []string{"pdf", "csv"}, schema.Properties["format"].Enum)
+	assert.Equal(t, 0, schema.Properties["emails"].MaxLength, "max on arrays is not a length")
+	assert.Equal(t, "email", schema.Properties["emails"].Items.Format)
+	assert.Equal(t, &Schema{Type: "string"}, schema.Properties["note"])
+}
+
+// TestOpenAPI tests paths, parameters, bodies and security of the generated operations.
+func TestOpenAPI(t *testing.T) {
+	document := OpenAPI(Info{Title: "Test", Version: "1"}, []Endpoint{
+		{Method: "GET", Path: "/health", Summary: "Health", Tags: []string{"system"}},
+		{
+			Method: "PUT", Path: "/api/admin/ratelimit/overrides/:key", Summary: "Override",
+			Auth: true, Admin: true, ExampleBody: `{"max": 10}`, Request: struct {
+				Max int `json:"max"`
+			}{},
+		},
+		{Method: "GET", Path: "/api/reports/:id<int>", Summary: "Report", Auth: true, Scopes: []string{"reports:read"}, Response: schemaBase{}},
+		{Method: "GET", Path: "/rest/*", Summary: "REST proxy"},
+		{Method: "GET", Path: "/ws", Summary: "WebSocket", WebSocket: true},
+	})
+
+	assert.Equal(t, OpenAPIVersion, document.OpenAPI)
+	assert.Equal(t, "Test", document.Info.Title)
+	assert.Contains(t, document.Components.SecuritySchemes, bearerAuth)
+
+	health := document.Paths["/health"]["get"]
+	assert.Equal(t, "getHealth", health.OperationID)
+	assert.Empty(t, health.Security)
+	assert.Equal(t, []string{"200"}, keys(health.Responses))
+
+	override := document.Paths["/api/admin/ratelimit/overrides/{key}"]["put"]
+	assert.Equal(t, "putAdminRatelimitOverridesByKey", override.OperationID)
+	assert.Equal(t, []Parameter{{Name: "key", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, override.Parameters)
+	assert.Equal(t, []map[string][]string{{bearerAuth: {}}}, override.Security)
+	assert.ElementsMatch(t, []string{"200", "401", "403"}, keys(override.Responses))
+	body := override.RequestBody.Content[fiber.MIMEApplicationJSON].Schema
+	assert.Equal(t, "integer", body.Properties["max"].Type)
+	assert.Equal(t, map[string]any{"max": float64(10)}, body.Example)
+
+	report := document.Paths["/api/reports/{id}"]["get"]
+	assert.Equal(t, "getReportsById", report.OperationID)
+	assert.Contains(t, report.Responses["403"].Description, "reports:read")
+	assert.Equal(t, "string", report.Responses["200"].Content[fiber.MIMEApplicationJSON].Schema.Properties["id"].Type)
+	assert.Nil(t, report.RequestBody)
+
+	rest := document.Paths["/rest/{path}"]["get"]
+	assert.Equal(t, "path", rest.Parameters[0].Name)
+
+	assert.Contains(t, document.Paths["/ws"]["get"].Responses, "101")
+}
+
+// TestOpenAPIHandler tests that /openapi.json documents the app's live routes.
+func TestOpenAPIHandler(t *testing.T) {
+	app := fiber.New()
+	app.Get("/openapi.json", OpenAPIHandler(app))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/openapi.json", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var document Document
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&document))
+	assert.Equal(t, OpenAPIVersion, document.OpenAPI)
+	assert.Contains(t, document.Paths, "/openapi.json")
+}
+
+// keys returns the keys of responses.
+func keys(responses map[string]Response) []string {
+	result := make([]string, 0, len(responses))
+	for key := range responses {
+		result = append(result, key)
+	}
+	return result
+}
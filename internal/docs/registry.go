@@ -0,0 +1,124 @@
+package docs
+
+// Package docs generates API documentation from the routes the app actually registers.
+// Route metadata (summary, auth, request and response types, example body) is declared next to
+// the route with Register, and merged at request time with fiber's route table, so the docs
+// can't drift from the code. The result is served as an OpenAPI 3 document (/openapi.json),
+// browsed with Swagger UI at /docs, and as the plain endpoint list the demo page and the SDK
+// generator read (/docs/endpoints).
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Endpoint describes a single API endpoint.
+type Endpoint struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Auth        bool     `json:"auth"`                   // Requires a Bearer token
+	APIKey      bool     `json:"api_key,omitempty"`      // Also accepts an X-API-Key instead of the token
+	Admin       bool     `json:"admin,omitempty"`        // Only for admins (ADMIN_USER_IDS)
+	Scopes      []string `json:"scopes,omitempty"`       // Token scopes required on top of Auth
+	ExampleBody string   `json:"example_body,omitempty"` // Prefilled in the try-it console
+	WebSocket   bool     `json:"websocket,omitempty"`    // Upgrade endpoint, not testable with fetch
+	Documented  bool     `json:"documented"`             // false for routes without registered metadata
+
+	// Request and Response are values of the request body's and the success response's types,
+	// e.g. profile.Update{}, or a *Schema; the OpenAPI document describes them with SchemaOf.
+	Request  any `json:"-"`
+	Response any `json:"-"`
+}
+
+// Registry holds endpoint metadata keyed by method and path.
+type Registry struct {
+	mu        sync.RWMutex
+	endpoints map[string]Endpoint
+}
+
+// DefaultRegistry is the registry used by Register and the docs handlers.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{endpoints: make(map[string]Endpoint)}
+}
+
+// Register adds or replaces metadata for an endpoint in the default registry.
+func Register(endpoint Endpoint) {
+	DefaultRegistry.Register(endpoint)
+}
+
+// Register adds or replaces metadata for an endpoint.
+func (r *Registry) Register(endpoint Endpoint) {
+	endpoint.Method = strings.ToUpper(endpoint.Method)
+	endpoint.Documented = true
+
+	r.mu.Lock()
+	r.endpoints[endpointKey(endpoint.Method, endpoint.Path)] = endpoint
+	r.mu.Unlock()
+}
+
+// Endpoints merges registered metadata with the routes actually registered on the app
+// (pass app.GetRoutes(true) to exclude app.Use middleware entries).
+// Only routes that exist are returned. Routes without metadata are listed as undocumented,
+// unless another method on the same path is documented (e.g. app.All catch-alls).
+func (r *Registry) Endpoints(routes []fiber.Route) []Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	documentedPaths := make(map[string]bool)
+	for _, endpoint := range r.endpoints {
+		documentedPaths[endpoint.Path] = true
+	}
+
+	seen := make(map[string]bool)
+	result := make([]Endpoint, 0, len(routes))
+
+	for _, route := range routes {
+		// Skip fiber's automatic HEAD routes and methods nobody documents
+		if route.Method == fiber.MethodHead || route.Method == fiber.MethodConnect || route.Method == fiber.MethodTrace {
+			continue
+		}
+
+		key := endpointKey(route.Method, route.Path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if endpoint, ok := r.endpoints[key]; ok {
+			result = append(result, endpoint)
+			continue
+		}
+		if documentedPaths[route.Path] {
+			continue
+		}
+
+		result = append(result, Endpoint{
+			Method:  route.Method,
+			Path:    route.Path,
+			Summary: "Undocumented route",
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	return result
+}
+
+// endpointKey builds the registry map key.
+func endpointKey(method, path string) string {
+	return method + " " + path
+}
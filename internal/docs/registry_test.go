@@ -0,0 +1,66 @@
+package docs
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistry_Endpoints tests that metadata is merged with the live route table.
+func TestRegistry_Endpoints(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Endpoint{Method: "get", Path: "/health", Summary: "Health check"})
+	registry.Register(Endpoint{Method: "POST", Path: "/graphql", Summary: "GraphQL proxy"})
+	registry.Register(Endpoint{Method: "GET", Path: "/removed", Summary: "No longer registered"})
+
+	app := fiber.New()
+	noop := func(c *fiber.Ctx) error { return nil }
+	app.Use(noop)
+	app.Get("/health", noop)
+	app.All("/graphql", noop)
+	app.Get("/secret", noop)
+
+	endpoints := registry.Endpoints(app.GetRoutes(true))
+
+	byKey := make(map[string]Endpoint)
+	for _, endpoint := range endpoints {
+		byKey[endpoint.Method+" "+endpoint.Path] = endpoint
+	}
+
+	// Documented routes carry their metadata
+	assert.Equal(t, "Health check", byKey["GET /health"].Summary)
+	assert.True(t, byKey["GET /health"].Documented)
+
+	// app.All catch-alls only show the documented method
+	assert.Contains(t, byKey, "POST /graphql")
+	assert.NotContains(t, byKey, "PUT /graphql")
+
+	// Routes that exist without metadata are listed as undocumented
+	assert.Contains(t, byKey, "GET /secret")
+	assert.False(t, byKey["GET /secret"].Documented)
+
+	// Metadata for routes that don't exist is not shown, nor are HEAD routes
+	assert.NotContains(t, byKey, "GET /removed")
+	assert.NotContains(t, byKey, "HEAD /health")
+}
+
+// TestEndpointsHandler tests that the JSON endpoint reflects the app's routes.
+func TestEndpointsHandler(t *testing.T) {
+	app := fiber.New()
+	app.Get("/docs/endpoints", EndpointsHandler(app))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/docs/endpoints", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Endpoints []Endpoint `json:"endpoints"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Endpoints, 1)
+	assert.Equal(t, "/docs/endpoints", body.Endpoints[0].Path)
+}
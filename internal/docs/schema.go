@@ -0,0 +1,161 @@
+package docs
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI 3.0 schema object (the subset generated from Go types).
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MaxLength            int                `json:"maxLength,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Example              any                `json:"example,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the JSON encoding of value's type, following encoding/json:
+// json tags name the fields ("-" hides them), embedded structs are flattened and pointers are
+// nullable. Rules in validate tags (see internal/validation) that OpenAPI can express become
+// required, maxLength, enum and format. Interfaces, and types with their own MarshalJSON, accept
+// any value. A *Schema (for bodies whose fields are only known at runtime) is returned as a copy.
+// nil returns nil.
+func SchemaOf(value any) *Schema {
+	if value == nil {
+		return nil
+	}
+	if schema, ok := value.(*Schema); ok {
+		copied := *schema
+		return &copied
+	}
+	return schemaOf(reflect.TypeOf(value), make(map[reflect.Type]bool))
+}
+
+// schemaOf returns the schema of t. visiting holds the struct types being described, so
+// recursive types end in a plain object instead of looping.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if t.Kind() == reflect.Pointer {
+		schema := schemaOf(t.Elem(), visiting)
+		schema.Nullable = true
+		return schema
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if t == rawMessageType || t.Implements(jsonMarshalerType) {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"} // encoding/json base64-encodes []byte
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return &Schema{Type: "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		addFields(schema, t, visiting)
+		return schema
+	default:
+		// Interfaces hold any value; channels and functions are not encoded
+		return &Schema{}
+	}
+}
+
+// addFields adds the encoded fields of struct type t to schema's properties.
+func addFields(schema *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			addFields(schema, fieldType, visiting)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := schemaOf(field.Type, visiting)
+		if applyRules(property, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// applyRules adds the validate tag's rules to a field's schema, and returns whether the field is
+// required. Rules after dive apply to the items of arrays.
+func applyRules(schema *Schema, tag string) (required bool) {
+	if tag == "" || tag == "-" {
+		return false
+	}
+	target := schema
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			if target.Items == nil {
+				return required
+			}
+			target = target.Items
+		case "required":
+			required = required || target == schema
+		case "max", "lte":
+			if n, err := strconv.Atoi(param); err == nil && target.Type == "string" {
+				target.MaxLength = n
+			}
+		case "oneof":
+			if target.Type == "string" {
+				target.Enum = strings.Fields(param)
+			}
+		case "email":
+			target.Format = "email"
+		case "url":
+			target.Format = "uri"
+		case "uuid":
+			target.Format = "uuid"
+		}
+	}
+	return required
+}
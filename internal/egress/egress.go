@@ -0,0 +1,247 @@
+package egress
+
+// Package egress guards outbound HTTP requests (the GraphQL proxy, the JWKS fetcher, the
+// PostgREST and Storage clients, ...) against misconfiguration and SSRF-style bugs.
+//
+// Clients built with NewClient check every request, redirects included, against the policy set
+// by Init: the scheme must be allowed (EGRESS_ALLOWED_SCHEMES, default https) and the host must be
+// allowlisted (EGRESS_ALLOWED_HOSTS, plus the hosts of SUPABASE_URL and UPSTASH_REDIS_URL).
+// Redirects are also refused when the target resolves to a private, loopback, link-local or
+// shared (CGNAT) address, so an allowlisted upstream can't bounce a request into the internal
+// network. That check runs in the dialer, on the address actually connected to, so a DNS answer
+// that changes between a check and the connection (DNS rebinding) can't get around it.
+//
+// Clients that don't use net/http (the Realtime WebSocket connection) dial through
+// NetDialContext, which checks the host.
+//
+// Outside production localhost is always allowed (EGRESS_ALLOW_LOOPBACK), for a local Supabase
+// stack and tests. Until Init is called no policy applies.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/startup"
+)
+
+// maxRedirects is the most redirects a client follows (as http.Client does by default).
+const maxRedirects = 10
+
+// ErrBlocked is returned (wrapped) for requests the policy doesn't allow.
+var ErrBlocked = errors.New("outbound request blocked")
+
+// Policy is the set of schemes and hosts outbound requests may go to.
+type Policy struct {
+	hosts         []string // Lowercase; "*.example.com" matches subdomains
+	schemes       []string
+	allowLoopback bool
+}
+
+// DefaultPolicy is the policy clients from NewClient enforce. Nil means no restriction.
+var DefaultPolicy *Policy
+
+// sharedAddressSpace is 100.64.0.0/10 (RFC 6598), used by carrier-grade NAT and by some cloud
+// providers for internal services.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// New creates a policy from cfg.
+func New(cfg config.Egress) *Policy {
+	policy := &Policy{schemes: cfg.AllowedSchemes, allowLoopback: cfg.AllowLoopback}
+	for _, host := range cfg.AllowedHosts {
+		policy.hosts = append(policy.hosts, strings.ToLower(strings.TrimSpace(host)))
+	}
+	return policy
+}
+
+// Init sets DefaultPolicy from cfg.
+func Init(cfg config.Egress) {
+	SetDefault(New(cfg))
+
+	detail := fmt.Sprintf("%d allowed host(s), schemes: %s", len(cfg.AllowedHosts), strings.Join(cfg.AllowedSchemes, ","))
+	if cfg.AllowLoopback {
+		detail += ", localhost allowed"
+	}
+	startup.Report("egress", true, detail)
+}
+
+// SetDefault replaces DefaultPolicy (nil lifts every restriction).
+func SetDefault(policy *Policy) {
+	DefaultPolicy = policy
+}
+
+// Check returns an error wrapping ErrBlocked unless the policy allows requests to u.
+func (p *Policy) Check(u *url.URL) error {
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Hostname())
+
+	// Step 1: localhost, if allowed, over any scheme
+	if p.allowLoopback && isLoopback(host) {
+		return nil
+	}
+
+	// Step 2: The scheme must be allowed
+	if !contains(p.schemes, scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrBlocked, scheme)
+	}
+
+	// Step 3: So must the host
+	return p.checkHost(host, strings.ToLower(u.Host))
+}
+
+// checkHost returns an error wrapping ErrBlocked unless hostname (hostPort with its port) is
+// allowlisted.
+func (p *Policy) checkHost(hostname, hostPort string) error {
+	for _, allowed := range p.hosts {
+		if matchHost(allowed, hostname, hostPort) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q is not allowed", ErrBlocked, hostPort)
+}
+
+// netDialer dials the connections of NetDialContext.
+var netDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// NetDialContext dials address ("host:port") if DefaultPolicy allows the host (localhost
+// included, when allowed). Set it as the NetDialContext of clients that don't go through an
+// http.Client, such as a websocket.Dialer; the scheme is the caller's to check.
+func NetDialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if policy := DefaultPolicy; policy != nil {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid address %q", ErrBlocked, address)
+		}
+		host = strings.ToLower(host)
+		if !policy.allowLoopback || !isLoopback(host) {
+			if err := policy.checkHost(host, strings.ToLower(address)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return netDialer.DialContext(ctx, network, address)
+}
+
+// refusePrivate is the Control of the dialer of redirects: it runs once the target is resolved,
+// right before connecting, and refuses private addresses.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: invalid address %q", ErrBlocked, address)
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+		return fmt.Errorf("%w: redirect to private address %s", ErrBlocked, host)
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client that enforces DefaultPolicy on every request and redirect.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &Transport{},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if policy := DefaultPolicy; policy != nil {
+				return policy.Check(req.URL) // The address is checked when the redirect is dialed
+			}
+			return nil
+		},
+	}
+}
+
+// Transport is an http.RoundTripper that enforces DefaultPolicy before sending a request.
+//
+// Redirects go through a copy of Base (when it's an *http.Transport) with its own connection
+// pool, whose dialer refuses private addresses. Redirects are sent directly, not through the
+// HTTP proxy of the environment, so that the dialer sees the target's address.
+type Transport struct {
+	Base http.RoundTripper // http.DefaultTransport if nil
+
+	once     sync.Once
+	redirect http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if policy := DefaultPolicy; policy != nil {
+		if err := policy.Check(req.URL); err != nil {
+			if req.Body != nil {
+				req.Body.Close() // RoundTrip must always close the body
+			}
+			return nil, err
+		}
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Response != nil && DefaultPolicy != nil { // Set by http.Client on redirects
+		t.once.Do(func() { t.redirect = guarded(base) })
+		return t.redirect.RoundTrip(req)
+	}
+	return base.RoundTrip(req)
+}
+
+// guarded returns a copy of base that only connects to public addresses. Round trippers other
+// than *http.Transport are replaced by a copy of http.DefaultTransport.
+func guarded(base http.RoundTripper) http.RoundTripper {
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	copied := transport.Clone()
+	copied.Proxy = nil
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: refusePrivate}
+	copied.DialContext = dialer.DialContext
+	copied.DialTLSContext = nil
+	return copied
+}
+
+// matchHost reports whether the allowlist entry allowed matches a request to hostname (hostPort
+// with its port): "example.com" and "example.com:8443" match exactly, "*.example.com" matches
+// any subdomain.
+func matchHost(allowed, hostname, hostPort string) bool {
+	if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+		return strings.HasSuffix(hostname, "."+suffix)
+	}
+	if _, _, err := net.SplitHostPort(allowed); err == nil {
+		return allowed == hostPort
+	}
+	return allowed == hostname
+}
+
+// isLoopback reports whether host is localhost or a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isPrivate reports whether ip is not a public address.
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// contains reports whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package egress
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"boilerplate/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setPolicy installs a policy for the test.
+func setPolicy(t *testing.T, cfg config.Egress) {
+	t.Helper()
+	original := DefaultPolicy
+	SetDefault(New(cfg))
+	t.Cleanup(func() { SetDefault(original) })
+}
+
+// TestPolicy_Check tests the scheme and host checks.
+func TestPolicy_Check(t *testing.T) {
+	policy := New(config.Egress{
+		AllowedHosts:   []string{"project.supabase.co", "*.example.com", "api.test:8443"},
+		AllowedSchemes: []string{"https"},
+	})
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://project.supabase.co/graphql/v1", true},
+		{"https://PROJECT.supabase.co/rest/v1/artists", true},
+		{"http://project.supabase.co/graphql/v1", false},
+		{"https://other.supabase.co/graphql/v1", false},
+		{"https://cdn.example.com/file", true},
+		{"https://example.com/file", false},
+		{"https://evil-example.com/file", false},
+		{"https://api.test:8443/", true},
+		{"https://api.test/", false},
+		{"https://localhost:54321/", false},
+		{"file:///etc/passwd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			err = policy.Check(u)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrBlocked)
+			}
+		})
+	}
+
+	// Outside production localhost is allowed over any scheme
+	local := New(config.Egress{AllowedSchemes: []string{"https"}, AllowLoopback: true})
+	for _, target := range []string{"http://localhost:54321/", "http://127.0.0.1:8080/", "http://[::1]/"} {
+		u, _ := url.Parse(target)
+		assert.NoError(t, local.Check(u), target)
+	}
+}
+
+// TestNewClient tests that clients refuse disallowed hosts and redirects to private addresses.
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		case "/self":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		case "/internal":
+			http.Redirect(w, r, "http://10.0.0.5/secret", http.StatusFound)
+		default:
+			// A name, refused once it is resolved to the loopback address
+			_, port, _ := net.SplitHostPort(r.Host)
+			http.Redirect(w, r, "http://localhost:"+port+"/ok", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	setPolicy(t, config.Egress{
+		AllowedHosts:   []string{"10.0.0.5"},
+		AllowedSchemes: []string{"http"},
+		AllowLoopback:  true,
+	})
+	client := NewClient(0)
+
+	// Requests to allowed hosts go through
+	resp, err := client.Get(server.URL + "/ok")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Other hosts are refused before anything is sent
+	_, err = client.Get("http://attacker.test/")
+	assert.ErrorIs(t, err, ErrBlocked)
+
+	// Redirects must not lead into the internal network, even to allowed hosts or localhost
+	for _, path := range []string{"/internal", "/redirect", "/self"} {
+		_, err = client.Get(server.URL + path)
+		assert.ErrorIs(t, err, ErrBlocked, path)
+	}
+
+	// Without a policy nothing is checked
+	SetDefault(nil)
+	resp, err = client.Get(server.URL + "/self")
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+// TestIsPrivate tests which addresses redirects may not connect to.
+func TestIsPrivate(t *testing.T) {
+	for _, address := range []string{"10.0.0.5", "172.16.0.1", "192.168.1.1", "127.0.0.1", "169.254.169.254", "100.64.0.1", "100.127.255.254", "::1", "fd00::1", "0.0.0.0"} {
+		assert.True(t, isPrivate(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{"1.1.1.1", "100.63.255.255", "100.128.0.0", "2606:4700::1111"} {
+		assert.False(t, isPrivate(net.ParseIP(address)), address)
+	}
+}
+
+// TestNetDialContext tests that non-HTTP clients can only dial allowed hosts.
+func TestNetDialContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	ctx := t.Context()
+
+	setPolicy(t, config.Egress{AllowedHosts: []string{"api.example.com"}, AllowedSchemes: []string{"https"}, AllowLoopback: true})
+	conn, err := NetDialContext(ctx, "tcp", listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	_, err = NetDialContext(ctx, "tcp", "attacker.test:443")
+	assert.ErrorIs(t, err, ErrBlocked)
+
+	setPolicy(t, config.Egress{AllowedHosts: []string{"api.example.com"}, AllowedSchemes: []string{"https"}})
+	_, err = NetDialContext(ctx, "tcp", listener.Addr().String())
+	assert.ErrorIs(t, err, ErrBlocked)
+}
@@ -0,0 +1,139 @@
+package events
+
+// Package events is an in-process event bus between subsystems. Publishers and subscribers
+// only share the event types below, so e.g. the Realtime subscriber announces price changes
+// without importing the WebSocket hub that broadcasts them.
+//
+// The event type is the topic: Subscribe(func(e PriceChanged) {...}) receives every
+// Publish(PriceChanged{...}). Subscribers run synchronously, in the publisher's goroutine and in
+// subscription order, so they must not block (hand slow work to a goroutine or a queue). A
+// subscriber that panics is logged and skipped; the others still run.
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PriceChanged is published for every artist price change received from Supabase Realtime
+// (live or replayed after a reconnect). Its JSON form is the price_update WebSocket message.
+type PriceChanged struct {
+	ArtistID string          `json:"artist_id"`
+	Price    decimal.Decimal `json:"price"`               // Exact, serialized as a string ("45.67")
+	Event    string          `json:"event"`               // INSERT or UPDATE
+	TenantID string          `json:"tenant_id,omitempty"` // "" for single-tenant tables
+}
+
+// RowChanged is published for every change of a table subscribed with REALTIME_SUBSCRIPTIONS
+// (see internal/realtime). Its JSON form is the data of the WebSocket message of type Topic.
+type RowChanged struct {
+	Subscription string                 `json:"subscription"`
+	Topic        string                 `json:"-"`                   // WebSocket message type ("" not broadcast)
+	Event        string                 `json:"event"`               // INSERT, UPDATE or DELETE
+	TenantID     string                 `json:"tenant_id,omitempty"` // "" for single-tenant tables
+	Record       map[string]interface{} `json:"record"`              // The subscription's fields
+}
+
+// UserRegistered is published when a user first saves their profile, i.e. becomes a user of
+// this app (accounts themselves are created in Supabase Auth).
+type UserRegistered struct {
+	UserID   string
+	TenantID string
+	Time     time.Time
+}
+
+// AlertTriggered is published when an objective burns its error budget too fast (see
+// internal/slo), next to the configured alert hooks.
+type AlertTriggered struct {
+	Route    string
+	Kind     string  // latency or availability
+	Target   float64 // e.g. 0.999
+	BurnRate float64 // In the short window
+	Time     time.Time
+}
+
+// NotificationSent is published for every notification sent to a user who receives them over the
+// WebSocket (see internal/notify). Its JSON form is the notification WebSocket message.
+type NotificationSent struct {
+	UserID   string            `json:"-"`
+	TenantID string            `json:"-"`
+	Type     string            `json:"type"` // e.g. price_alert
+	Title    string            `json:"title"`
+	Body     string            `json:"body"`
+	Data     map[string]string `json:"data,omitempty"`
+	Priority string            `json:"priority"` // high or low
+}
+
+// Event is the set of event types that can be published.
+type Event interface {
+	PriceChanged | RowChanged | UserRegistered | AlertTriggered | NotificationSent
+}
+
+// subscription is a subscriber, with an ID so it can be removed.
+type subscription struct {
+	id      uint64
+	handler interface{} // func(E) for the topic's type E
+}
+
+var (
+	mu          sync.RWMutex
+	nextID      uint64
+	subscribers = make(map[reflect.Type][]subscription)
+)
+
+// Subscribe calls handler for every event of type E published from now on.
+// It returns a function that removes the subscription.
+func Subscribe[E Event](handler func(E)) (unsubscribe func()) {
+	topic := reflect.TypeFor[E]()
+
+	mu.Lock()
+	nextID++
+	id := nextID
+	subscribers[topic] = append(subscribers[topic], subscription{id: id, handler: handler})
+	mu.Unlock()
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		current := subscribers[topic]
+		for i, sub := range current {
+			if sub.id == id {
+				subscribers[topic] = append(current[:i:i], current[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers event to every subscriber of its type.
+func Publish[E Event](event E) {
+	topic := reflect.TypeFor[E]()
+
+	mu.RLock()
+	current := subscribers[topic]
+	mu.RUnlock()
+
+	for _, sub := range current {
+		deliver(topic, sub.handler.(func(E)), event)
+	}
+}
+
+// deliver calls one subscriber, logging instead of propagating a panic.
+func deliver[E Event](topic reflect.Type, handler func(E), event E) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Event subscriber panicked", "topic", topic.Name(), "panic", r)
+		}
+	}()
+	handler(event)
+}
+
+// Reset removes all subscribers. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	subscribers = make(map[reflect.Type][]subscription)
+	mu.Unlock()
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPublish tests that subscribers receive events of their type only, in subscription order,
+// until they unsubscribe.
+func TestPublish(t *testing.T) {
+	defer Reset()
+
+	var got []string
+	unsubscribe := Subscribe(func(e PriceChanged) { got = append(got, "first "+e.ArtistID) })
+	Subscribe(func(e PriceChanged) { got = append(got, "second "+e.ArtistID) })
+	Subscribe(func(e UserRegistered) { got = append(got, "user "+e.UserID) })
+
+	Publish(PriceChanged{ArtistID: "a1", Price: decimal.RequireFromString("9.99")})
+	assert.Equal(t, []string{"first a1", "second a1"}, got)
+
+	got = nil
+	unsubscribe()
+	Publish(PriceChanged{ArtistID: "a2"})
+	Publish(UserRegistered{UserID: "u1"})
+	assert.Equal(t, []string{"second a2", "user u1"}, got)
+
+	// Without subscribers, publishing does nothing
+	Publish(AlertTriggered{Route: "GET /api/profile"})
+}
+
+// TestPublish_PanickingSubscriber tests that a panicking subscriber doesn't stop the others or
+// the publisher.
+func TestPublish_PanickingSubscriber(t *testing.T) {
+	defer Reset()
+
+	delivered := false
+	Subscribe(func(e AlertTriggered) { panic("boom") })
+	Subscribe(func(e AlertTriggered) { delivered = true })
+
+	assert.NotPanics(t, func() { Publish(AlertTriggered{Kind: "latency"}) })
+	assert.True(t, delivered)
+}
@@ -0,0 +1,155 @@
+package frontend
+
+// Package frontend serves a single-page app build (React, Vue, Svelte, ...) from the API server,
+// so small deployments can ship frontend and backend as one binary or one container.
+//
+// The build is read from FRONTEND_DIR, or embedded in the binary (build with
+// -tags embed_frontend after copying the build into web/dist, see web/embed.go). Files are
+// served with cache headers suited to bundler output, and any other path that is not an API
+// path returns index.html so the client-side router can handle it.
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+// indexFile is the app's entry point, returned for client-side routes.
+const indexFile = "index.html"
+
+// Embedded is the build compiled into the binary, if any (set by cmd/server when built with
+// -tags embed_frontend). FRONTEND_DIR takes precedence over it.
+var Embedded fs.FS
+
+// DefaultSite is the site mounted by the app; nil when no frontend is configured.
+var DefaultSite *Site
+
+// Site serves one frontend build.
+type Site struct {
+	fsys   fs.FS
+	maxAge time.Duration // Cache lifetime of files without a content hash in their name
+}
+
+// New returns a site serving the build in fsys, which must contain index.html at its root.
+// maxAge is how long files without a content hash in their name may be cached.
+func New(fsys fs.FS, maxAge time.Duration) (*Site, error) {
+	if _, err := fs.Stat(fsys, indexFile); err != nil {
+		return nil, fmt.Errorf("frontend build has no %s: %w", indexFile, err)
+	}
+	return &Site{fsys: fsys, maxAge: maxAge}, nil
+}
+
+// Init configures the default site from FRONTEND_DIR or the embedded build.
+// Without either the frontend is disabled and / keeps serving the demo page.
+func Init() {
+	fsys, source := Embedded, "embedded"
+	if dir := os.Getenv("FRONTEND_DIR"); dir != "" {
+		fsys, source = os.DirFS(dir), dir
+	}
+	if fsys == nil {
+		startup.Report("frontend", false, "FRONTEND_DIR not set and no embedded build")
+		DefaultSite = nil
+		return
+	}
+
+	site, err := New(fsys, getMaxAge())
+	if err != nil {
+		log.Printf("WARNING: Frontend disabled: %v", err)
+		startup.Report("frontend", false, err.Error())
+		DefaultSite = nil
+		return
+	}
+
+	DefaultSite = site
+	log.Printf("Frontend initialized (%s)", source)
+	startup.Report("frontend", true, source)
+}
+
+// SetDefault replaces the default site (nil disables the frontend). Mainly useful in tests.
+func SetDefault(site *Site) {
+	DefaultSite = site
+}
+
+// Get returns the default site, or nil if the frontend is disabled.
+func Get() *Site {
+	return DefaultSite
+}
+
+// hashedName matches file names with a bundler content hash, e.g. index-BdK3xY9a.js (Vite) or
+// main.3f2a1b4c.css (webpack). Their content never changes, so they can be cached forever.
+var hashedName = regexp.MustCompile(`[.-][A-Za-z0-9_]{8,}\.[A-Za-z0-9]+$`)
+
+// Handler serves the build. Mount it last, for GET, on a catch-all path (/*):
+//   - existing files are sent as-is (index.html for directories)
+//   - missing paths with a file extension (e.g. an old /assets/app-1234abcd.js) fall through to
+//     the 404 handler instead of returning HTML the browser would try to execute
+//   - /api/* paths fall through too, so unknown API routes keep returning 404
+//   - any other path returns index.html for the client-side router
+//
+// index.html is sent with "no-cache" so new deployments are picked up immediately; hashed files
+// are cached for a year, other files for FRONTEND_CACHE_MAX_AGE.
+func (s *Site) Handler() fiber.Handler {
+	root := http.FS(s.fsys)
+
+	return func(c *fiber.Ctx) error {
+		urlPath := path.Clean("/" + c.Path())
+		if urlPath == "/api" || strings.HasPrefix(urlPath, "/api/") {
+			return c.Next()
+		}
+
+		name := strings.TrimPrefix(urlPath, "/")
+		if info, err := fs.Stat(s.fsys, name); err == nil && info.IsDir() {
+			name = path.Join(name, indexFile)
+		}
+		if _, err := fs.Stat(s.fsys, name); err != nil {
+			if path.Ext(name) != "" {
+				return c.Next()
+			}
+			name = indexFile
+		}
+
+		if err := filesystem.SendFile(c, root, name); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderCacheControl, s.cacheControl(name))
+		return nil
+	}
+}
+
+// cacheControl returns the Cache-Control header for a file of the build.
+func (s *Site) cacheControl(name string) string {
+	switch {
+	case path.Base(name) == indexFile:
+		return "no-cache"
+	case hashedName.MatchString(path.Base(name)):
+		return "public, max-age=31536000, immutable"
+	default:
+		return "public, max-age=" + strconv.Itoa(int(s.maxAge/time.Second))
+	}
+}
+
+// getMaxAge returns FRONTEND_CACHE_MAX_AGE, defaulting to 1 hour if unset or invalid.
+func getMaxAge() time.Duration {
+	value := os.Getenv("FRONTEND_CACHE_MAX_AGE")
+	if value == "" {
+		return time.Hour
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("WARNING: Invalid FRONTEND_CACHE_MAX_AGE %q, using 1h", value)
+		return time.Hour
+	}
+	return parsed
+}
@@ -0,0 +1,114 @@
+package frontend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBuild is a typical bundler output.
+var testBuild = fstest.MapFS{
+	"index.html":                {Data: []byte("<!doctype html><div id=app></div>")},
+	"favicon.ico":               {Data: []byte("icon")},
+	"assets/index-BdK3xY9a.js":  {Data: []byte("console.log('app')")},
+	"assets/index-3f2a1b4c.css": {Data: []byte("body{}")},
+	"docs/index.html":           {Data: []byte("<!doctype html>static docs")},
+}
+
+// newTestApp mounts the site like the app does: after the API routes, on a catch-all path.
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	site, err := New(testBuild, 10*time.Minute)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/api/known", func(c *fiber.Ctx) error { return c.SendString("api") })
+	app.Get("/*", site.Handler())
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, path string) (*http.Response, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+// TestHandler_ServesFiles tests that files are served with their content type and cache policy.
+func TestHandler_ServesFiles(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		path         string
+		body         string
+		contentType  string
+		cacheControl string
+	}{
+		{"/", "<!doctype html><div id=app></div>", "text/html", "no-cache"},
+		{"/assets/index-BdK3xY9a.js", "console.log('app')", "javascript", "public, max-age=31536000, immutable"},
+		{"/assets/index-3f2a1b4c.css", "body{}", "text/css", "public, max-age=31536000, immutable"},
+		{"/favicon.ico", "icon", "", "public, max-age=600"},
+		{"/docs/", "<!doctype html>static docs", "text/html", "no-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, body := get(t, app, tt.path)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.body, body)
+			assert.Contains(t, resp.Header.Get("Content-Type"), tt.contentType)
+			assert.Equal(t, tt.cacheControl, resp.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+// TestHandler_Fallback tests the index.html fallback for client-side routes, and that API paths
+// and missing assets still return 404.
+func TestHandler_Fallback(t *testing.T) {
+	app := newTestApp(t)
+
+	resp, body := get(t, app, "/artists/123/history")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "<!doctype html><div id=app></div>", body)
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	resp, body = get(t, app, "/api/known")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "api", body)
+
+	for _, path := range []string{"/api/unknown", "/api", "/assets/index-oldhash1.js", "/../api/unknown"} {
+		resp, _ = get(t, app, path)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+// TestNew_RequiresIndex tests that a build without index.html is rejected.
+func TestNew_RequiresIndex(t *testing.T) {
+	_, err := New(fstest.MapFS{"app.js": {Data: []byte("x")}}, time.Hour)
+	assert.Error(t, err)
+}
+
+// TestInit tests the FRONTEND_DIR and embedded sources.
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil); Embedded = nil })
+
+	t.Setenv("FRONTEND_DIR", "")
+	Init()
+	assert.Nil(t, Get(), "disabled without a build")
+
+	Embedded = testBuild
+	Init()
+	assert.NotNil(t, Get(), "embedded build")
+
+	t.Setenv("FRONTEND_DIR", t.TempDir())
+	Init()
+	assert.Nil(t, Get(), "FRONTEND_DIR takes precedence, and has no index.html")
+}
@@ -0,0 +1,293 @@
+package functions
+
+// Package functions invokes Supabase Edge Functions (<SUPABASE_URL>/functions/v1/<name>), from
+// server-side code and through the /api/functions/:name proxy, so handlers compose with edge
+// functions without hand-rolling HTTP calls.
+//
+// Auth: a call made for a user forwards their access token, so the function sees the same user
+// (and row level security) as if the client had called it. Calls without a token (workers,
+// webhooks) use the service role key. The anon key is always sent as apikey, as the Supabase
+// gateway requires.
+//
+// Every call has a timeout (FUNCTIONS_TIMEOUT, default 30s). Calls marked Retry are retried
+// FUNCTIONS_RETRIES times (default 0) when the function can't be reached or answers 502, 503 or
+// 504 (cold starts, deploys), waiting FUNCTIONS_RETRY_BACKOFF (default 200ms), doubled each
+// time. Only mark calls that can safely run twice.
+//
+//	var result struct{ Total int `json:"total"` }
+//	err := functions.Get().InvokeJSON(ctx, "compute-portfolio", token, input, &result)
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/startup"
+)
+
+// Defaults of FUNCTIONS_TIMEOUT and FUNCTIONS_RETRY_BACKOFF.
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultRetryBackoff = 200 * time.Millisecond
+)
+
+// maxResponseSize bounds the response bodies read from functions.
+const maxResponseSize = 10 << 20
+
+var (
+	// DefaultClient invokes the project's functions. It is nil until Init() or SetDefault() is
+	// called, and stays nil when Supabase is not configured.
+	DefaultClient *Client
+
+	// ErrNotConfigured is returned when functions are invoked without a client.
+	ErrNotConfigured = errors.New("edge functions not configured")
+
+	// ErrInvalidName is returned for function names that aren't a single path segment.
+	ErrInvalidName = errors.New("invalid edge function name")
+)
+
+// validName matches function names: letters, digits, - and _ (as the Supabase CLI allows).
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}$`)
+
+// Options configures a Client.
+type Options struct {
+	Timeout      time.Duration // Of each attempt (0: defaultTimeout)
+	Retries      int           // Of calls marked Retry
+	RetryBackoff time.Duration // Before the first retry, doubled each time
+	Allowed      []string      // Functions the HTTP proxy may invoke (empty: all)
+}
+
+// Client invokes the Edge Functions of one Supabase project.
+type Client struct {
+	baseURL    string // e.g. https://xxx.supabase.co/functions/v1
+	anonKey    string
+	serviceKey string
+	client     *http.Client
+	opts       Options
+}
+
+// Request is one invocation.
+type Request struct {
+	Method string      // Default POST
+	Body   []byte      //
+	Header http.Header // Sent as is, e.g. Content-Type (Authorization and apikey are set by the client)
+	Query  url.Values  //
+	Token  string      // The user's access token, forwarded; "" to call with the service role key
+	Retry  bool        // Safe to run twice: retried on connection errors, 502, 503 and 504
+}
+
+// Response is a function's response, whatever its status.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Error is a non-2xx response to InvokeJSON.
+type Error struct {
+	Function string
+	Status   int
+	Body     []byte
+}
+
+func (e *Error) Error() string {
+	body := string(e.Body)
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return fmt.Sprintf("edge function %s returned %d: %s", e.Function, e.Status, body)
+}
+
+// Init configures the default client from SUPABASE_URL, SUPABASE_ANON_KEY and
+// SUPABASE_SERVICE_ROLE_KEY, and the FUNCTIONS_* settings. Without SUPABASE_URL and
+// SUPABASE_ANON_KEY functions are disabled.
+func Init(cfg config.Functions, supabase config.Supabase) {
+	if supabase.URL == "" || supabase.AnonKey == "" {
+		startup.Report("functions", false, "SUPABASE_URL or SUPABASE_ANON_KEY not set")
+		DefaultClient = nil
+		return
+	}
+
+	opts := Options{
+		Timeout:      cfg.Timeout,
+		Retries:      cfg.Retries,
+		RetryBackoff: cfg.RetryBackoff,
+		Allowed:      cfg.Allowed,
+	}
+	DefaultClient = NewClient(supabase.URL, supabase.AnonKey, supabase.ServiceRoleKey, opts)
+
+	proxied := "all functions proxied"
+	if len(opts.Allowed) > 0 {
+		proxied = strings.Join(opts.Allowed, ", ") + " proxied"
+	}
+	startup.Report("functions", true, fmt.Sprintf("timeout %s, %d retries, %s", opts.Timeout, opts.Retries, proxied))
+}
+
+// NewClient creates a client for the Edge Functions of a Supabase project. serviceKey may be
+// empty, in which case calls without a user token only carry the anon key.
+func NewClient(supabaseURL, anonKey, serviceKey string, opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/functions/v1",
+		anonKey:    anonKey,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(opts.Timeout),
+		opts:       opts,
+	}
+}
+
+// SetDefault replaces the default client (nil disables functions). Mainly useful in tests.
+func SetDefault(client *Client) {
+	DefaultClient = client
+}
+
+// Get returns the default client, or nil if functions are not configured.
+func Get() *Client {
+	return DefaultClient
+}
+
+// ValidName reports whether name can be a function name.
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Allowed reports whether the HTTP proxy may invoke the function name (FUNCTIONS_ALLOWED).
+func (c *Client) Allowed(name string) bool {
+	return len(c.opts.Allowed) == 0 || slices.Contains(c.opts.Allowed, name)
+}
+
+// Invoke calls the function name and returns its response, whatever its status. The error is
+// for calls that got no response (invalid name, timeout, connection refused).
+func (c *Client) Invoke(ctx context.Context, name string, req Request) (*Response, error) {
+	if c == nil {
+		return nil, ErrNotConfigured
+	}
+	if !ValidName(name) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	target := c.baseURL + "/" + name
+	if len(req.Query) > 0 {
+		target += "?" + req.Query.Encode()
+	}
+
+	retries := 0
+	if req.Retry {
+		retries = c.opts.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, method, target, req)
+		if attempt >= retries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := c.opts.RetryBackoff << attempt
+		slog.Warn("Edge function unavailable, retrying", "function", name, "attempt", attempt+1, "wait", wait.String(), "error", describe(resp, err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// InvokeJSON calls the function name with in as its JSON body and decodes its JSON response into
+// out (unless nil), forwarding token (see Request.Token). Non-2xx responses are *Error.
+func (c *Client) InvokeJSON(ctx context.Context, name, token string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode the input of %s: %w", name, err)
+	}
+	resp, err := c.Invoke(ctx, name, Request{
+		Body:   body,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Token:  token,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Status < 200 || resp.Status >= 300 {
+		return &Error{Function: name, Status: resp.Status, Body: resp.Body}
+	}
+	if out == nil || len(resp.Body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("failed to decode the response of %s: %w", name, err)
+	}
+	return nil
+}
+
+// do sends one attempt of req.
+func (c *Client) do(ctx context.Context, method, target string, req Request) (*Response, error) {
+	var body io.Reader
+	if req.Body != nil {
+		body = bytes.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range req.Header {
+		httpReq.Header[http.CanonicalHeaderKey(key)] = values
+	}
+	httpReq.Header.Set("apikey", c.anonKey)
+	switch {
+	case req.Token != "":
+		httpReq.Header.Set("Authorization", "Bearer "+req.Token)
+	case c.serviceKey != "":
+		httpReq.Header.Set("Authorization", "Bearer "+c.serviceKey)
+	default:
+		httpReq.Header.Set("Authorization", "Bearer "+c.anonKey)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach edge function: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read edge function response: %w", err)
+	}
+	return &Response{Status: resp.StatusCode, Header: resp.Header, Body: data}, nil
+}
+
+// retryable reports whether a failed attempt may succeed when retried.
+func retryable(resp *Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, egress.ErrBlocked) && !errors.Is(err, context.Canceled)
+	}
+	switch resp.Status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// describe returns why an attempt failed, for the retry log.
+func describe(resp *Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "status " + strconv.Itoa(resp.Status)
+}
@@ -0,0 +1,121 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInvoke_Auth tests that the user's token is forwarded, and the service role key used
+// without one.
+func TestInvoke_Auth(t *testing.T) {
+	var authorization, apikey, path, query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization, apikey = r.Header.Get("Authorization"), r.Header.Get("apikey")
+		path, query = r.URL.Path, r.URL.RawQuery
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/", "anon", "service", Options{})
+
+	resp, err := client.Invoke(context.Background(), "hello-world", Request{Body: []byte("hi"), Token: "user-token", Query: map[string][]string{"a": {"1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Status)
+	assert.Equal(t, "hi", string(resp.Body))
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "/functions/v1/hello-world", path)
+	assert.Equal(t, "a=1", query)
+	assert.Equal(t, "Bearer user-token", authorization)
+	assert.Equal(t, "anon", apikey)
+
+	_, err = client.Invoke(context.Background(), "hello-world", Request{})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer service", authorization)
+
+	_, err = client.Invoke(context.Background(), "../rest/v1/users", Request{})
+	assert.ErrorIs(t, err, ErrInvalidName)
+
+	var none *Client
+	_, err = none.Invoke(context.Background(), "hello-world", Request{})
+	assert.ErrorIs(t, err, ErrNotConfigured)
+}
+
+// TestInvoke_Retries tests that only calls marked Retry are retried, up to Options.Retries.
+func TestInvoke_Retries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "payload", string(body), "every attempt carries the body")
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "anon", "", Options{Retries: 2, RetryBackoff: time.Millisecond})
+
+	resp, err := client.Invoke(context.Background(), "flaky", Request{Body: []byte("payload"), Retry: true})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, int32(3), requests.Load())
+
+	requests.Store(0)
+	resp, err = client.Invoke(context.Background(), "flaky", Request{Body: []byte("payload")})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Status)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+// TestInvoke_Timeout tests that a function that doesn't answer fails after the timeout.
+func TestInvoke_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client := NewClient(server.URL, "anon", "", Options{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := client.Invoke(context.Background(), "slow", Request{})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// TestInvokeJSON tests decoding and non-2xx responses.
+func TestInvokeJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if r.URL.Path == "/functions/v1/broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "missing amount"}`))
+			return
+		}
+		w.Write([]byte(`{"total": 42}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "anon", "", Options{})
+
+	var out struct {
+		Total int `json:"total"`
+	}
+	require.NoError(t, client.InvokeJSON(context.Background(), "sum", "", map[string]int{"a": 40, "b": 2}, &out))
+	assert.Equal(t, 42, out.Total)
+
+	err := client.InvokeJSON(context.Background(), "broken", "", nil, &out)
+	var fnErr *Error
+	require.True(t, errors.As(err, &fnErr))
+	assert.Equal(t, http.StatusBadRequest, fnErr.Status)
+	assert.Contains(t, err.Error(), "missing amount")
+}
@@ -0,0 +1,389 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/templates"
+)
+
+// Export statuses.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Export formats.
+const (
+	FormatJSON = "json"
+	FormatZIP  = "zip"
+)
+
+// exportTimeout bounds how long assembling one export may take.
+const exportTimeout = 2 * time.Minute
+
+// Export is an asynchronous data export for one user.
+type Export struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Status    string    `json:"status"`
+	Format    string    `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"` // The file and its download link expire together
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	// ErrExportNotFound is returned for unknown or expired exports.
+	ErrExportNotFound = errors.New("export not found")
+
+	// fallbackExportStore holds exports when no cache is configured (single instance only).
+	fallbackExportStore = cache.NewMemoryStore()
+
+	// generatedSigningKey is used when neither GDPR_EXPORT_SECRET nor JWT_SECRET is set.
+	generatedSigningKey     []byte
+	generatedSigningKeyOnce sync.Once
+)
+
+// exportStore returns where export status and files are kept. The shared cache is preferred,
+// so any instance can serve the download link.
+func exportStore() cache.Store {
+	if store := cache.GetClient(); store != nil {
+		return store
+	}
+	return fallbackExportStore
+}
+
+// getExportTTL returns GDPR_EXPORT_TTL, defaulting to 24 hours.
+func getExportTTL() time.Duration {
+	if raw := os.Getenv("GDPR_EXPORT_TTL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("WARNING: Invalid GDPR_EXPORT_TTL %q, using 24h", raw)
+	}
+	return 24 * time.Hour
+}
+
+// StartExport returns the user's current export if it is still pending or downloadable in the
+// requested format, otherwise it starts assembling a new one in the background.
+// account is included as-is in the export (e.g. the token claims describing the user).
+func StartExport(ctx context.Context, userID, format string, account map[string]interface{}) (*Export, error) {
+	if format != FormatJSON && format != FormatZIP {
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	// Step 1: Reuse an export that is in progress or still downloadable
+	existing, err := LatestExport(userID)
+	if err != nil && !errors.Is(err, ErrExportNotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.Format == format && existing.Status != ExportFailed &&
+		now().Before(existing.ExpiresAt) {
+		return existing, nil
+	}
+
+	// Step 2: Record the new export as pending
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	createdAt := now().UTC()
+	export := &Export{
+		ID:        id,
+		UserID:    userID,
+		Status:    ExportPending,
+		Format:    format,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(getExportTTL()),
+	}
+	if err := saveExport(export); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Assemble it in the background (the request context ends with the response).
+	// The job works on its own copy, since the caller is about to encode export.
+	job := *export
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		runExport(runCtx, &job, account)
+	}()
+
+	return export, nil
+}
+
+// LatestExport returns the user's most recent export, or ErrExportNotFound.
+func LatestExport(userID string) (*Export, error) {
+	raw, err := exportStore().Get("export:user:" + userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load export: %w", err)
+	}
+	if raw == "" {
+		return nil, ErrExportNotFound
+	}
+
+	var export Export
+	if err := json.Unmarshal([]byte(raw), &export); err != nil {
+		return nil, fmt.Errorf("failed to parse export: %w", err)
+	}
+	return &export, nil
+}
+
+// ExportFile returns the finished file and its format for an export ID, or ErrExportNotFound.
+func ExportFile(id string) ([]byte, string, error) {
+	raw, err := exportStore().Get("export:file:" + id)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load export file: %w", err)
+	}
+	if raw == "" {
+		return nil, "", ErrExportNotFound
+	}
+
+	// Stored as "<format>:<base64 file>" because cache values are strings
+	format, encoded, _ := strings.Cut(raw, ":")
+	file, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode export file: %w", err)
+	}
+	return file, format, nil
+}
+
+// DownloadQuery returns the signed query string for an export's download link,
+// valid until the export expires.
+func DownloadQuery(export *Export) string {
+	expires := strconv.FormatInt(export.ExpiresAt.Unix(), 10)
+	params := url.Values{}
+	params.Set("expires", expires)
+	params.Set("sig", signDownload(export.ID, expires))
+	return params.Encode()
+}
+
+// VerifyDownload checks a download link's expiry and signature.
+func VerifyDownload(id, expires, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(signDownload(id, expires)))
+}
+
+// signDownload returns the hex HMAC-SHA256 of "id.expires".
+func signDownload(id, expires string) string {
+	mac := hmac.New(sha256.New, getSigningKey())
+	mac.Write([]byte(id + "." + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getSigningKey returns GDPR_EXPORT_SECRET, falling back to JWT_SECRET, then to a random key
+// (download links then only work on the instance that created them, until it restarts).
+func getSigningKey() []byte {
+	if secret := os.Getenv("GDPR_EXPORT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	generatedSigningKeyOnce.Do(func() {
+		log.Println("WARNING: GDPR_EXPORT_SECRET and JWT_SECRET not set, export links are signed with a random per-process key")
+		generatedSigningKey = make([]byte, 32)
+		if _, err := rand.Read(generatedSigningKey); err != nil {
+			log.Printf("ERROR: Failed to generate export signing key: %v", err)
+		}
+	})
+	return generatedSigningKey
+}
+
+// saveExport stores the export status until it expires.
+func saveExport(export *Export) error {
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("failed to encode export: %w", err)
+	}
+	if err := exportStore().Set("export:user:"+export.UserID, string(encoded), export.ExpiresAt.Sub(now())); err != nil {
+		return fmt.Errorf("failed to save export: %w", err)
+	}
+	return nil
+}
+
+// runExport assembles the export file and marks the export ready (or failed).
+func runExport(ctx context.Context, export *Export, account map[string]interface{}) {
+	file, err := buildExport(ctx, export, account)
+	if err == nil {
+		encoded := export.Format + ":" + base64.StdEncoding.EncodeToString(file)
+		err = exportStore().Set("export:file:"+export.ID, encoded, export.ExpiresAt.Sub(now()))
+	}
+
+	if err != nil {
+		log.Printf("ERROR: Data export %s failed: %v", export.ID, err)
+		export.Status = ExportFailed
+		export.Error = "Export failed, please try again"
+	} else {
+		export.Status = ExportReady
+	}
+
+	if err := saveExport(export); err != nil {
+		log.Printf("ERROR: Failed to save data export %s: %v", export.ID, err)
+	}
+}
+
+// buildExport collects the user's data into one JSON document, or a ZIP with one JSON file
+// per section.
+func buildExport(ctx context.Context, export *Export, account map[string]interface{}) ([]byte, error) {
+	// Step 1: Collect every section
+	sections, err := collectSections(ctx, export.UserID, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: A single JSON document
+	if export.Format == FormatJSON {
+		return json.MarshalIndent(map[string]interface{}{
+			"exported_at": export.CreatedAt,
+			"user_id":     export.UserID,
+			"data":        sections,
+		}, "", "  ")
+	}
+
+	// Step 3: A ZIP archive with one file per section, and a README describing them
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	readme, err := archive.Create("README.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write README: %w", err)
+	}
+	err = templates.Render(readme, "exports/readme.txt", "", map[string]any{
+		"ExportedAt": export.CreatedAt,
+		"UserID":     export.UserID,
+		"Sections":   names,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write README: %w", err)
+	}
+	for name, section := range sections {
+		encoded, err := json.MarshalIndent(section, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		file, err := archive.Create(name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if _, err := file.Write(encoded); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// collectSections gathers the account details, the rows of every registered table
+// (the same tables that are erased on deletion), the user's audit records and their
+// deletion request.
+func collectSections(ctx context.Context, userID string, account map[string]interface{}) (map[string]interface{}, error) {
+	sections := map[string]interface{}{
+		"account": account,
+	}
+
+	// Step 1: Rows from the registered tables, keyed by table name
+	targetsMu.RLock()
+	tableTargets := append([]tableTarget(nil), tables...)
+	targetsMu.RUnlock()
+
+	supabaseURL := strings.TrimSuffix(os.Getenv("SUPABASE_URL"), "/")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if len(tableTargets) > 0 && (supabaseURL == "" || serviceKey == "") {
+		return nil, fmt.Errorf("SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY are required to export table rows")
+	}
+
+	client := egress.NewClient(30 * time.Second)
+	for _, target := range tableTargets {
+		endpoint := supabaseURL + "/rest/v1/" + target.Table + "?select=*&" + target.Column + "=eq." + url.QueryEscape(userID)
+		rows, err := supabaseSelect(ctx, client, endpoint, serviceKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", target.Table, err)
+		}
+		sections[target.Table] = rows
+	}
+
+	// Step 2: Actions the user performed that were audited
+	if audit.DefaultStore != nil {
+		records, err := audit.DefaultStore.List(ctx, audit.Query{Actor: userID, Limit: 1000})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export audit records: %w", err)
+		}
+		sections["audit_log"] = records
+	}
+
+	// Step 3: The account deletion request, if any
+	if DefaultStore != nil {
+		request, err := DefaultStore.Latest(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export deletion request: %w", err)
+		}
+		if request != nil {
+			sections["deletion_request"] = request
+		}
+	}
+
+	return sections, nil
+}
+
+// supabaseSelect runs an authenticated PostgREST select and returns the rows as raw JSON.
+func supabaseSelect(ctx context.Context, client *http.Client, endpoint, serviceKey string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", serviceKey)
+	req.Header.Set("Authorization", "Bearer "+serviceKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(body))
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("invalid JSON from Supabase")
+	}
+	return body, nil
+}
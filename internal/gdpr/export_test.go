@@ -0,0 +1,134 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"boilerplate/internal/audit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForExport polls until the user's export leaves the pending state.
+func waitForExport(t *testing.T, userID string) *Export {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		export, err := LatestExport(userID)
+		require.NoError(t, err)
+		if export.Status != ExportPending {
+			return export
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("export did not finish in time")
+	return nil
+}
+
+// TestStartExport_ZIPWithEverySection tests that the ZIP contains the account, the registered
+// tables and the audit records, and that a second call reuses the finished export.
+func TestStartExport_ZIPWithEverySection(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/v1/watchlists", r.URL.Path)
+		assert.Equal(t, "eq.u1", r.URL.Query().Get("user_id"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"artist_id":"a1"}]`))
+	}))
+	defer server.Close()
+	t.Setenv("SUPABASE_URL", server.URL)
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "service-key")
+
+	require.NoError(t, RegisterTable("watchlists", "user_id"))
+	require.NoError(t, audit.Log(ctx, "u1", "cache.flush", "price:a1", nil, nil))
+
+	started, err := StartExport(ctx, "u1", FormatZIP, map[string]interface{}{"sub": "u1", "email": "u1@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, ExportPending, started.Status)
+
+	export := waitForExport(t, "u1")
+	require.Equal(t, ExportReady, export.Status)
+
+	file, format, err := ExportFile(export.ID)
+	require.NoError(t, err)
+	assert.Equal(t, FormatZIP, format)
+
+	archive, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+	contents := make(map[string]string)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(data)
+	}
+	assert.Contains(t, contents["account.json"], "u1@example.com")
+	assert.JSONEq(t, `[{"artist_id":"a1"}]`, contents["watchlists.json"])
+	assert.Contains(t, contents["audit_log.json"], "cache.flush")
+	assert.Contains(t, contents["README.txt"], "  - watchlists.json\n", "the README lists the sections")
+
+	again, err := StartExport(ctx, "u1", FormatZIP, nil)
+	require.NoError(t, err)
+	assert.Equal(t, export.ID, again.ID)
+}
+
+// TestStartExport_JSONAndFailure tests the JSON format and that a failing source marks the
+// export failed (and a new call starts over).
+func TestStartExport_JSONAndFailure(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	started, err := StartExport(ctx, "u2", FormatJSON, map[string]interface{}{"sub": "u2"})
+	require.NoError(t, err)
+	export := waitForExport(t, "u2")
+	require.Equal(t, ExportReady, export.Status)
+
+	file, format, err := ExportFile(started.ID)
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(file, &doc))
+	assert.Equal(t, "u2", doc["user_id"])
+
+	// A registered table without Supabase credentials can't be exported
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "")
+	require.NoError(t, RegisterTable("orders", "user_id"))
+	_, err = StartExport(ctx, "u3", FormatJSON, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ExportFailed, waitForExport(t, "u3").Status)
+
+	_, err = StartExport(ctx, "u2", "xml", nil)
+	assert.Error(t, err)
+}
+
+// TestVerifyDownload tests the signed download link.
+func TestVerifyDownload(t *testing.T) {
+	setupTest(t)
+	t.Setenv("GDPR_EXPORT_SECRET", "export-secret")
+
+	export := &Export{ID: "abc", ExpiresAt: now().Add(time.Hour)}
+	query, err := url.ParseQuery(DownloadQuery(export))
+	require.NoError(t, err)
+
+	assert.True(t, VerifyDownload("abc", query.Get("expires"), query.Get("sig")))
+	assert.False(t, VerifyDownload("other", query.Get("expires"), query.Get("sig")))
+	assert.False(t, VerifyDownload("abc", query.Get("expires"), "bad"))
+
+	// Expired links are rejected even with a valid signature
+	later := now().Add(2 * time.Hour)
+	now = func() time.Time { return later }
+	assert.False(t, VerifyDownload("abc", query.Get("expires"), query.Get("sig")))
+}
@@ -0,0 +1,226 @@
+package gdpr
+
+// Package gdpr implements the data subject rights workflows: account deletion
+// ("right to erasure") and data export ("data portability", see export.go).
+//
+// A user calls DELETE /api/me, which schedules a deletion request after a grace period
+// (GDPR_GRACE_PERIOD, default 30 days) and emails a confirmation. Until then the user (or an
+// admin) can cancel it. A background worker (RunWorker) picks up due requests and erases the
+// user's data: registered Postgres tables, cache keys, rate-limit overrides, the Supabase auth
+// user, and the user's ID in the audit log (pseudonymized, since the log is append-only).
+// Admins can also expedite a request to skip the grace period.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"boilerplate/internal/mail"
+	"boilerplate/internal/startup"
+)
+
+// Request statuses.
+const (
+	StatusPending   = "pending"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Request is a scheduled account deletion.
+type Request struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	TenantID     string     `json:"tenant_id,omitempty"`
+	Email        string     `json:"email,omitempty"` // For the confirmation emails; cleared on completion
+	Status       string     `json:"status"`
+	RequestedBy  string     `json:"requested_by"` // The user, or the admin who scheduled it
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// Store persists deletion requests.
+type Store interface {
+	// Create inserts a new request.
+	Create(ctx context.Context, request *Request) error
+
+	// Latest returns the most recent request for userID, or nil if there is none.
+	Latest(ctx context.Context, userID string) (*Request, error)
+
+	// Due returns pending requests scheduled at or before now, oldest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]*Request, error)
+
+	// Update saves the status, schedule, attempts and error of an existing request.
+	Update(ctx context.Context, request *Request) error
+}
+
+var (
+	// DefaultStore is the store used by the workflow functions.
+	// It is nil until Init() or SetDefault() is called.
+	DefaultStore Store
+
+	// ErrNoRequest is returned when a user has no deletion request.
+	ErrNoRequest = errors.New("no deletion request")
+
+	// ErrNotPending is returned when a request can no longer be changed.
+	ErrNotPending = errors.New("deletion request is not pending")
+
+	// now is the clock used by the workflow (overridable in tests).
+	now = time.Now
+)
+
+// Init initializes the default store.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, requests are stored in the
+// deletion_requests table (see schema.sql). Otherwise they are kept in memory, which
+// means pending deletions are lost on restart.
+func Init() {
+	registerFromEnv()
+
+	// Reported here rather than in RunWorker, which runs in its own goroutine
+	startup.Report("jobs", true, "account deletion worker every "+getWorkerInterval().String())
+
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+
+	if supabaseURL == "" || serviceKey == "" {
+		log.Println("WARNING: SUPABASE_SERVICE_ROLE_KEY not set, account deletion requests are kept in memory only")
+		DefaultStore = NewMemoryStore()
+		return
+	}
+
+	DefaultStore = NewPostgRESTStore(supabaseURL, serviceKey)
+	log.Println("Account deletion workflow initialized (Supabase Postgres)")
+}
+
+// SetDefault replaces the default store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// getGracePeriod returns GDPR_GRACE_PERIOD (a Go duration), defaulting to 30 days.
+func getGracePeriod() time.Duration {
+	if raw := os.Getenv("GDPR_GRACE_PERIOD"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed >= 0 {
+			return parsed
+		}
+		log.Printf("WARNING: Invalid GDPR_GRACE_PERIOD %q, using 30 days", raw)
+	}
+	return 30 * 24 * time.Hour
+}
+
+// Schedule creates a deletion request for userID after the grace period and emails a
+// confirmation. If the user already has a pending request, that request is returned unchanged.
+func Schedule(ctx context.Context, userID, tenantID, email, requestedBy string) (*Request, error) {
+	if DefaultStore == nil {
+		return nil, fmt.Errorf("deletion store not initialized")
+	}
+
+	// Step 1: Deleting twice is a no-op
+	existing, err := DefaultStore.Latest(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Status == StatusPending {
+		return existing, nil
+	}
+
+	// Step 2: Create the request
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	createdAt := now().UTC()
+	request := &Request{
+		ID:           id,
+		UserID:       userID,
+		TenantID:     tenantID,
+		Email:        email,
+		Status:       StatusPending,
+		RequestedBy:  requestedBy,
+		ScheduledFor: createdAt.Add(getGracePeriod()),
+		CreatedAt:    createdAt,
+	}
+	if err := DefaultStore.Create(ctx, request); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Confirm by email (a failed email doesn't undo the request)
+	if request.Email != "" {
+		if err := mail.SendTemplate(request.Email, "deletion_requested", "", request); err != nil {
+			log.Printf("ERROR: Failed to send deletion confirmation for request %s: %v", request.ID, err)
+		}
+	}
+
+	log.Printf("Account deletion scheduled: request=%s scheduled_for=%s", request.ID, request.ScheduledFor.Format(time.RFC3339))
+	return request, nil
+}
+
+// Get returns the latest deletion request for userID, or ErrNoRequest.
+func Get(ctx context.Context, userID string) (*Request, error) {
+	if DefaultStore == nil {
+		return nil, fmt.Errorf("deletion store not initialized")
+	}
+
+	request, err := DefaultStore.Latest(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, ErrNoRequest
+	}
+	return request, nil
+}
+
+// Cancel cancels the user's pending deletion request.
+func Cancel(ctx context.Context, userID string) (*Request, error) {
+	request, err := Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != StatusPending {
+		return request, ErrNotPending
+	}
+
+	request.Status = StatusCancelled
+	if err := DefaultStore.Update(ctx, request); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Account deletion cancelled: request=%s", request.ID)
+	return request, nil
+}
+
+// Expedite moves the user's pending request to now, so the next worker run erases the data.
+// This is the admin override for the grace period.
+func Expedite(ctx context.Context, userID string) (*Request, error) {
+	request, err := Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != StatusPending {
+		return request, ErrNotPending
+	}
+
+	request.ScheduledFor = now().UTC()
+	if err := DefaultStore.Update(ctx, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// newID returns a random 128-bit hex ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate request ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
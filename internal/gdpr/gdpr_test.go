@@ -0,0 +1,200 @@
+package gdpr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMailer records sent emails.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []string // Subjects
+}
+
+func (f *fakeMailer) Send(to, subject, body string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, to+": "+subject)
+	return nil
+}
+
+// setupTest swaps in memory stores, a fake mailer and a fixed clock, and clears registered targets.
+func setupTest(t *testing.T) (*MemoryStore, *fakeMailer) {
+	t.Helper()
+
+	originalStore, originalMailer := DefaultStore, mail.DefaultMailer
+	originalAudit, originalCache := audit.DefaultStore, cache.GetClient()
+	t.Cleanup(func() {
+		SetDefault(originalStore)
+		mail.SetDefault(originalMailer)
+		audit.SetDefault(originalAudit)
+		cache.SetDefault(originalCache)
+		now = time.Now
+		targetsMu.Lock()
+		tables, cacheKeys = nil, nil
+		targetsMu.Unlock()
+	})
+
+	store := NewMemoryStore()
+	SetDefault(store)
+	mailer := &fakeMailer{}
+	mail.SetDefault(mailer)
+	audit.SetDefault(audit.NewMemoryStore())
+	cache.SetDefault(cache.NewMemoryStore())
+
+	fixed := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+
+	return store, mailer
+}
+
+// TestSchedule_GracePeriodAndIdempotency tests that a request is scheduled after the grace
+// period, confirmed by email, and that scheduling twice returns the same request.
+func TestSchedule_GracePeriodAndIdempotency(t *testing.T) {
+	_, mailer := setupTest(t)
+	t.Setenv("GDPR_GRACE_PERIOD", "48h")
+	ctx := context.Background()
+
+	first, err := Schedule(ctx, "u1", "acme", "u1@example.com", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, first.Status)
+	assert.Equal(t, now().Add(48*time.Hour), first.ScheduledFor)
+	assert.Equal(t, []string{"u1@example.com: Your account deletion request"}, mailer.sent)
+
+	second, err := Schedule(ctx, "u1", "acme", "u1@example.com", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Len(t, mailer.sent, 1)
+}
+
+// TestCancelAndExpedite tests cancelling, expediting and the not-pending error.
+func TestCancelAndExpedite(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	_, err := Cancel(ctx, "u1")
+	assert.ErrorIs(t, err, ErrNoRequest)
+
+	_, err = Schedule(ctx, "u1", "", "", "u1")
+	require.NoError(t, err)
+
+	expedited, err := Expedite(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, now(), expedited.ScheduledFor)
+
+	cancelled, err := Cancel(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, cancelled.Status)
+
+	_, err = Cancel(ctx, "u1")
+	assert.ErrorIs(t, err, ErrNotPending)
+}
+
+// TestProcessDue_ErasesUserData tests that a due request deletes table rows, cache keys,
+// the rate-limit override and the auth user, pseudonymizes the audit log and clears the email.
+func TestProcessDue_ErasesUserData(t *testing.T) {
+	store, mailer := setupTest(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	deleted := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		deleted = append(deleted, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		assert.Equal(t, "Bearer service-key", r.Header.Get("Authorization"))
+		if r.URL.Path == "/auth/v1/admin/users/u1" {
+			w.WriteHeader(http.StatusNotFound) // Already gone counts as done
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	t.Setenv("SUPABASE_URL", server.URL)
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "service-key")
+
+	require.NoError(t, RegisterTable("notifications", "user_id"))
+	assert.Error(t, RegisterTable("notifications;drop", "user_id"))
+	RegisterCacheKey("profile:{user_id}")
+	require.NoError(t, cache.GetClient().Set("tenant:acme:profile:u1", "{}", time.Minute))
+	middleware.SetRateLimitOverride("tenant:acme:user:u1", 500)
+	require.NoError(t, audit.Log(ctx, "u1", "cache.flush", "user:u1", nil, nil))
+
+	request, err := Schedule(ctx, "u1", "acme", "u1@example.com", "u1")
+	require.NoError(t, err)
+
+	// Not due yet
+	completed, err := ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, completed)
+
+	_, err = Expedite(ctx, "u1")
+	require.NoError(t, err)
+	completed, err = ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, completed)
+
+	assert.Equal(t, []string{
+		"DELETE /rest/v1/notifications?user_id=eq.u1",
+		"DELETE /auth/v1/admin/users/u1",
+	}, deleted)
+
+	cached, err := cache.GetClient().Get("tenant:acme:profile:u1")
+	require.NoError(t, err)
+	assert.Equal(t, "", cached)
+
+	_, hasOverride := middleware.GetRateLimitOverride("tenant:acme:user:u1")
+	assert.False(t, hasOverride)
+
+	records, err := audit.DefaultStore.List(ctx, audit.Query{})
+	require.NoError(t, err)
+	assert.Equal(t, "deleted-user-"+request.ID, records[0].Actor)
+	assert.Equal(t, "user:deleted-user-"+request.ID, records[0].Target)
+
+	saved, err := store.Latest(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, saved.Status)
+	assert.Empty(t, saved.Email)
+	require.NotNil(t, saved.CompletedAt)
+	assert.Contains(t, mailer.sent, "u1@example.com: Your account has been deleted")
+}
+
+// TestProcessDue_RecordsFailures tests that a failed erasure stays pending with the error.
+func TestProcessDue_RecordsFailures(t *testing.T) {
+	store, _ := setupTest(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	t.Setenv("SUPABASE_URL", server.URL)
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "service-key")
+	t.Setenv("GDPR_GRACE_PERIOD", "0s")
+
+	require.NoError(t, RegisterTable("notifications", "user_id"))
+	_, err := Schedule(ctx, "u1", "", "", "u1")
+	require.NoError(t, err)
+
+	completed, err := ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, completed)
+
+	saved, err := store.Latest(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, saved.Status)
+	assert.Equal(t, 1, saved.Attempts)
+	assert.Contains(t, saved.LastError, "notifications")
+}
@@ -0,0 +1,79 @@
+package gdpr
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps deletion requests in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	requests []*Request
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Create stores a copy of the request.
+func (m *MemoryStore) Create(ctx context.Context, request *Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *request
+	m.requests = append(m.requests, &stored)
+	return nil
+}
+
+// Latest returns a copy of the most recent request for userID, or nil.
+func (m *MemoryStore) Latest(ctx context.Context, userID string) (*Request, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		if m.requests[i].UserID == userID {
+			found := *m.requests[i]
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+// Due returns copies of pending requests scheduled at or before now, oldest first.
+func (m *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]*Request, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	due := make([]*Request, 0)
+	for _, request := range m.requests {
+		if request.Status == StatusPending && !request.ScheduledFor.After(now) {
+			found := *request
+			due = append(due, &found)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].ScheduledFor.Before(due[j].ScheduledFor) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Update replaces the stored request with the same ID.
+func (m *MemoryStore) Update(ctx context.Context, request *Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, stored := range m.requests {
+		if stored.ID == request.ID {
+			updated := *request
+			m.requests[i] = &updated
+			return nil
+		}
+	}
+	return ErrNoRequest
+}
@@ -0,0 +1,156 @@
+package gdpr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// tableName is the Postgres table holding deletion requests (see schema.sql).
+const tableName = "deletion_requests"
+
+// PostgRESTStore keeps deletion requests in Postgres through the Supabase REST API (PostgREST).
+// It uses the service role key, because the table has RLS enabled with no policies.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/deletion_requests
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Create inserts a request.
+func (s *PostgRESTStore) Create(ctx context.Context, request *Request) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode deletion request: %w", err)
+	}
+
+	resp, err := s.do(ctx, "POST", s.baseURL, body, "return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Latest returns the most recent request for userID, or nil.
+func (s *PostgRESTStore) Latest(ctx context.Context, userID string) (*Request, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("user_id", "eq."+userID)
+	params.Set("order", "created_at.desc")
+	params.Set("limit", "1")
+
+	requests, err := s.list(ctx, params)
+	if err != nil || len(requests) == 0 {
+		return nil, err
+	}
+	return requests[0], nil
+}
+
+// Due returns pending requests scheduled at or before now, oldest first.
+func (s *PostgRESTStore) Due(ctx context.Context, now time.Time, limit int) ([]*Request, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("status", "eq."+StatusPending)
+	params.Set("scheduled_for", "lte."+now.UTC().Format(time.RFC3339Nano))
+	params.Set("order", "scheduled_for.asc")
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	return s.list(ctx, params)
+}
+
+// Update saves the mutable fields of a request.
+func (s *PostgRESTStore) Update(ctx context.Context, request *Request) error {
+	// Send every mutable column explicitly, so cleared values (e.g. email, last_error) are written
+	body, err := json.Marshal(map[string]interface{}{
+		"email":         request.Email,
+		"status":        request.Status,
+		"scheduled_for": request.ScheduledFor,
+		"completed_at":  request.CompletedAt,
+		"attempts":      request.Attempts,
+		"last_error":    request.LastError,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode deletion request: %w", err)
+	}
+
+	resp, err := s.do(ctx, "PATCH", s.baseURL+"?id=eq."+url.QueryEscape(request.ID), body, "return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// list runs a select and decodes the rows.
+func (s *PostgRESTStore) list(ctx context.Context, params url.Values) ([]*Request, error) {
+	resp, err := s.do(ctx, "GET", s.baseURL+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	requests := make([]*Request, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&requests); err != nil {
+		return nil, fmt.Errorf("failed to parse deletion requests: %w", err)
+	}
+	return requests, nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
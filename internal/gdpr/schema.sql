@@ -0,0 +1,21 @@
+-- Account deletion requests (GDPR erasure). Run this in the Supabase SQL editor.
+
+create table if not exists deletion_requests (
+    id            text        primary key,
+    user_id       text        not null,
+    tenant_id     text        not null default '',
+    email         text        not null default '', -- Cleared once the deletion completes
+    status        text        not null check (status in ('pending', 'cancelled', 'completed')),
+    requested_by  text        not null,
+    scheduled_for timestamptz not null,
+    created_at    timestamptz not null default now(),
+    completed_at  timestamptz,
+    attempts      integer     not null default 0,
+    last_error    text        not null default ''
+);
+
+create index if not exists deletion_requests_user_idx on deletion_requests (user_id, created_at desc);
+create index if not exists deletion_requests_due_idx on deletion_requests (scheduled_for) where status = 'pending';
+
+-- RLS with no policies: only the service role (used by the backend) can access the table.
+alter table deletion_requests enable row level security;
@@ -0,0 +1,251 @@
+package gdpr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/tenant"
+)
+
+// batchSize is how many due requests one worker run processes.
+const batchSize = 20
+
+// identifierPattern restricts table and column names to plain Postgres identifiers.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tableTarget is a table holding user data, deleted by matching column = user ID.
+type tableTarget struct {
+	Table  string
+	Column string
+}
+
+var (
+	targetsMu sync.RWMutex
+	tables    []tableTarget
+	cacheKeys []string // Templates with a {user_id} placeholder
+)
+
+// RegisterTable adds a table whose rows with column = user ID are deleted on erasure.
+// Tables can also be listed in GDPR_TABLES as "table.column" pairs.
+func RegisterTable(table, column string) error {
+	if !identifierPattern.MatchString(table) || !identifierPattern.MatchString(column) {
+		return fmt.Errorf("invalid table or column name: %s.%s", table, column)
+	}
+
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	tables = append(tables, tableTarget{Table: table, Column: column})
+	return nil
+}
+
+// RegisterCacheKey adds a cache key template (e.g. "profile:{user_id}") that is deleted
+// on erasure, scoped to the user's tenant. Templates can also be listed in GDPR_CACHE_KEYS.
+func RegisterCacheKey(template string) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	cacheKeys = append(cacheKeys, template)
+}
+
+// registerFromEnv registers the targets listed in GDPR_TABLES and GDPR_CACHE_KEYS.
+// Called by Init().
+func registerFromEnv() {
+	for _, entry := range splitList(os.Getenv("GDPR_TABLES")) {
+		table, column, ok := strings.Cut(entry, ".")
+		if !ok {
+			log.Printf("WARNING: Ignoring GDPR_TABLES entry %q (expected table.column)", entry)
+			continue
+		}
+		if err := RegisterTable(table, column); err != nil {
+			log.Printf("WARNING: Ignoring GDPR_TABLES entry: %v", err)
+		}
+	}
+
+	for _, template := range splitList(os.Getenv("GDPR_CACHE_KEYS")) {
+		RegisterCacheKey(template)
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(raw string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+// getWorkerInterval returns GDPR_WORKER_INTERVAL, defaulting to one minute.
+func getWorkerInterval() time.Duration {
+	if raw := os.Getenv("GDPR_WORKER_INTERVAL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("WARNING: Invalid GDPR_WORKER_INTERVAL %q, using 1m", raw)
+	}
+	return time.Minute
+}
+
+// RunWorker processes due deletion requests every GDPR_WORKER_INTERVAL.
+// Call it in a goroutine after Init(); it runs until ctx is cancelled.
+func RunWorker(ctx context.Context) {
+	interval := getWorkerInterval()
+	log.Printf("Account deletion worker started (every %s)", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("ERROR: Account deletion worker: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue erases the data of every due request and returns how many completed.
+// A failed erasure is recorded on the request (attempts, last_error) and retried next run;
+// every step is idempotent, so retrying a half-finished erasure is safe.
+func ProcessDue(ctx context.Context) (int, error) {
+	if DefaultStore == nil {
+		return 0, fmt.Errorf("deletion store not initialized")
+	}
+
+	due, err := DefaultStore.Due(ctx, now().UTC(), batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load due deletion requests: %w", err)
+	}
+
+	completed := 0
+	for _, request := range due {
+		if err := erase(ctx, request); err != nil {
+			request.Attempts++
+			request.LastError = err.Error()
+			log.Printf("ERROR: Account deletion %s failed (attempt %d): %v", request.ID, request.Attempts, err)
+			if updateErr := DefaultStore.Update(ctx, request); updateErr != nil {
+				log.Printf("ERROR: Failed to save deletion request %s: %v", request.ID, updateErr)
+			}
+			continue
+		}
+
+		// Send the completion email while we still have the address, then forget it
+		if request.Email != "" {
+			if err := mail.SendTemplate(request.Email, "deletion_completed", "", request); err != nil {
+				log.Printf("ERROR: Failed to send deletion completion email for request %s: %v", request.ID, err)
+			}
+		}
+
+		completedAt := now().UTC()
+		request.Status = StatusCompleted
+		request.CompletedAt = &completedAt
+		request.Email = ""
+		request.LastError = ""
+		if err := DefaultStore.Update(ctx, request); err != nil {
+			log.Printf("ERROR: Failed to save deletion request %s: %v", request.ID, err)
+			continue
+		}
+
+		log.Printf("Account deletion completed: request=%s", request.ID)
+		completed++
+	}
+	return completed, nil
+}
+
+// erase deletes everything known about the request's user.
+func erase(ctx context.Context, request *Request) error {
+	supabaseURL := strings.TrimSuffix(os.Getenv("SUPABASE_URL"), "/")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	client := egress.NewClient(10 * time.Second)
+
+	targetsMu.RLock()
+	tableTargets := append([]tableTarget(nil), tables...)
+	keyTemplates := append([]string(nil), cacheKeys...)
+	targetsMu.RUnlock()
+
+	// Step 1: Delete rows from the registered tables
+	if len(tableTargets) > 0 && (supabaseURL == "" || serviceKey == "") {
+		return fmt.Errorf("SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY are required to delete table rows")
+	}
+	for _, target := range tableTargets {
+		endpoint := supabaseURL + "/rest/v1/" + target.Table + "?" + target.Column + "=eq." + url.QueryEscape(request.UserID)
+		if err := supabaseDelete(ctx, client, endpoint, serviceKey, false); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", target.Table, err)
+		}
+	}
+
+	// Step 2: Delete cached data (scoped to the user's tenant)
+	if store := tenant.CacheFor(request.TenantID); store != nil {
+		for _, template := range keyTemplates {
+			key := strings.ReplaceAll(template, "{user_id}", request.UserID)
+			if err := store.Del(key); err != nil {
+				return fmt.Errorf("failed to delete cache key: %w", err)
+			}
+		}
+	}
+
+	// Step 3: Drop any rate-limit override keyed on the user
+	middleware.RemoveRateLimitOverride(tenant.Prefix(request.TenantID, "user:"+request.UserID))
+
+	// Step 4: Replace the user ID in the audit log with an alias that can't be traced back
+	// (the request ID is random, so the alias reveals nothing about the user)
+	if audit.DefaultStore != nil {
+		if _, err := audit.Pseudonymize(ctx, request.UserID, "deleted-user-"+request.ID); err != nil {
+			return fmt.Errorf("failed to pseudonymize audit log: %w", err)
+		}
+	}
+
+	// Step 5: Delete the Supabase auth user last, so a failure above can still be retried
+	// while the account exists
+	if supabaseURL != "" && serviceKey != "" {
+		endpoint := supabaseURL + "/auth/v1/admin/users/" + url.PathEscape(request.UserID)
+		if err := supabaseDelete(ctx, client, endpoint, serviceKey, true); err != nil {
+			return fmt.Errorf("failed to delete auth user: %w", err)
+		}
+	} else {
+		log.Printf("WARNING: Supabase not configured, auth user for deletion request %s was not deleted", request.ID)
+	}
+
+	return nil
+}
+
+// supabaseDelete sends an authenticated DELETE. With allowNotFound, 404 counts as success
+// (the auth user is already gone); for tables it doesn't, because PostgREST answers 404 for
+// a table that doesn't exist, which is a configuration error rather than a finished deletion.
+func supabaseDelete(ctx context.Context, client *http.Client, endpoint, serviceKey string, allowNotFound bool) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", serviceKey)
+	req.Header.Set("Authorization", "Bearer "+serviceKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if (allowNotFound && resp.StatusCode == http.StatusNotFound) || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("Supabase error (status %d): %s", resp.StatusCode, string(respBody))
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DeleteAccount schedules deletion of the current user's account and data (DELETE /api/me).
+// The data is erased after the grace period by the background worker; until then the user
+// can cancel with DELETE /api/me/deletion. A confirmation email goes to the token's email claim.
+func DeleteAccount(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	// Step 1: Take the email address from the token (Supabase includes it in access tokens)
+	email := ""
+	if claims, ok := c.Locals("claims").(jwt.MapClaims); ok {
+		email, _ = claims["email"].(string)
+	}
+
+	// Step 2: Schedule the deletion (idempotent: an existing pending request is returned)
+	request, err := gdpr.Schedule(c.UserContext(), userID, tenant.ID(c), email, userID)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to schedule account deletion", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to schedule account deletion",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+// GetAccountDeletion returns the current user's latest deletion request (GET /api/me/deletion).
+func GetAccountDeletion(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	request, err := gdpr.Get(c.UserContext(), userID)
+	if errors.Is(err, gdpr.ErrNoRequest) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No deletion request",
+		})
+	}
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to load account deletion request", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load deletion request",
+		})
+	}
+
+	return c.JSON(request)
+}
+
+// CancelAccountDeletion cancels the current user's pending deletion (DELETE /api/me/deletion).
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	request, err := gdpr.Cancel(c.UserContext(), userID)
+	switch {
+	case errors.Is(err, gdpr.ErrNoRequest):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No deletion request",
+		})
+	case errors.Is(err, gdpr.ErrNotPending):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Deletion request can no longer be cancelled",
+			"status": request.Status,
+		})
+	case err != nil:
+		logging.FromRequest(c).Error("Failed to cancel account deletion", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to cancel deletion request",
+		})
+	}
+
+	return c.JSON(request)
+}
+
+// ExportAccount returns the current user's data export (GET /api/me/export).
+//
+// The export is assembled in the background: the first call returns 202 with status
+// "pending"; poll until the status is "ready", then download from download_url (a signed link
+// that works without the Authorization header until the export expires).
+// Query parameter: format=zip (default, one JSON file per section) or format=json.
+func ExportAccount(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	// Copied: fiber reuses the request buffer once the handler returns, and the export job
+	// keeps using the format in the background
+	format := strings.Clone(c.Query("format", gdpr.FormatZIP))
+	if format != gdpr.FormatZIP && format != gdpr.FormatJSON {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be zip or json",
+		})
+	}
+
+	// The token claims describe the account (email, metadata) and go into the export as-is
+	account := map[string]interface{}{"id": userID}
+	if claims, ok := c.Locals("claims").(jwt.MapClaims); ok {
+		account = claims
+	}
+
+	export, err := gdpr.StartExport(c.UserContext(), userID, format, account)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to start data export", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to start data export",
+		})
+	}
+
+	if export.Status != gdpr.ExportReady {
+		return c.Status(fiber.StatusAccepted).JSON(export)
+	}
+	return c.JSON(fiber.Map{
+		"id":           export.ID,
+		"status":       export.Status,
+		"format":       export.Format,
+		"created_at":   export.CreatedAt,
+		"expires_at":   export.ExpiresAt,
+		"download_url": c.BaseURL() + "/exports/" + export.ID + "?" + gdpr.DownloadQuery(export),
+	})
+}
+
+// DownloadExport serves a finished export file (GET /exports/:id).
+// Access is granted by the link signature, so the route is public.
+func DownloadExport(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if !gdpr.VerifyDownload(id, c.Query("expires"), c.Query("sig")) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Invalid or expired download link",
+		})
+	}
+
+	file, format, err := gdpr.ExportFile(id)
+	if errors.Is(err, gdpr.ErrExportNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Export not found or expired",
+		})
+	}
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to load data export", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load export",
+		})
+	}
+
+	filename, contentType := "export-"+id+".json", fiber.MIMEApplicationJSON
+	if format == gdpr.FormatZIP {
+		filename, contentType = "export-"+id+".zip", "application/zip"
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(file)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+)
+
+// fakeConn is a simulated WebSocket client that discards everything written to it.
+type fakeConn struct {
+	writes int
+}
+
+func (f *fakeConn) WriteMessage(messageType int, data []byte) error {
+	f.writes++
+	return nil
+}
+
+func (f *fakeConn) Close() error { return nil }
+
+// BenchmarkHubFanOut measures broadcasting one price update to many connected clients.
+// Fan-out only queues the message; the clients' write pumps write it in the background.
+func BenchmarkHubFanOut(b *testing.B) {
+	message := []byte(`{"artist_id":"artist-123","price":45.67,"event":"UPDATE"}`)
+
+	for _, clients := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			hub := newHub()
+			for i := 0; i < clients; i++ {
+				hub.addClient(&fakeConn{}, clientInfo{schema: SchemaV1})
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				hub.fanOut(hubMessage{data: message})
+			}
+		})
+	}
+}
+
+// BenchmarkHubFanOutEncodings measures fan-out to clients on each message format.
+// Each format is encoded once per message, so the cost should stay close to BenchmarkHubFanOut.
+func BenchmarkHubFanOutEncodings(b *testing.B) {
+	data := []byte(`{"artist_id":"artist-123","price":"45.67","event":"UPDATE"}`)
+	formats := map[string]clientInfo{
+		"json-v1":  {schema: SchemaV1},
+		"json-v2":  {schema: SchemaV2},
+		"protobuf": {schema: SchemaV2, encoding: EncodingProtobuf},
+	}
+
+	for name, info := range formats {
+		b.Run(name, func(b *testing.B) {
+			hub := newHub()
+			for i := 0; i < 10000; i++ {
+				hub.addClient(&fakeConn{}, info)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				hub.fanOut(newHubMessage(MessageTypePriceUpdate, data))
+			}
+		})
+	}
+}
+
+// BenchmarkInjectCachedPrices measures price injection on large GraphQL responses
+// where half of the artists have a cached price.
+func BenchmarkInjectCachedPrices(b *testing.B) {
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+
+	// Per-hit log lines would dominate the measurement
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	queryBody := []byte(`{"query": "{ artists { id name currentPrice } }"}`)
+
+	for _, artists := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("artists=%d", artists), func(b *testing.B) {
+			store := cache.NewMemoryStore()
+			list := make([]map[string]interface{}, artists)
+			for i := range list {
+				id := "artist-" + strconv.Itoa(i)
+				list[i] = map[string]interface{}{"id": id, "name": "Artist " + strconv.Itoa(i)}
+				if i%2 == 0 {
+					store.Set("price:"+id, "45.67", time.Hour)
+				}
+			}
+			cache.SetDefault(store)
+
+			responseBody, _ := json.Marshal(map[string]interface{}{
+				"data": map[string]interface{}{"artists": list},
+			})
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(responseBody)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				injectCachedPrices(cache.GetClient(), queryBody, responseBody)
+			}
+		})
+	}
+}
@@ -256,6 +256,7 @@ var demoPageHTML = `<!DOCTYPE html>
         <nav class="nav">
             <ul class="nav-links">
                 <li><a href="#getting-started">Getting Started</a></li>
+                <li><a href="/docs">API Docs</a></li>
                 <li><a href="#api-tester">API Tester</a></li>
                 <li><a href="#websocket">WebSocket</a></li>
                 <li><a href="#graphql">GraphQL</a></li>
@@ -293,7 +294,7 @@ var demoPageHTML = `<!DOCTYPE html>
         <!-- API Tester -->
         <section id="api-tester" class="section">
             <h2>🧪 API Endpoint Tester</h2>
-            <p>Test any API endpoint directly from this page.</p>
+            <p>Test any API endpoint directly from this page. See <a href="/docs">API Docs</a> (Swagger UI for the generated <a href="/openapi.json">OpenAPI document</a>) for every endpoint with its schemas and a try-it console.</p>
             
             <div class="input-group">
                 <label>HTTP Method</label>
@@ -307,7 +308,8 @@ var demoPageHTML = `<!DOCTYPE html>
 
             <div class="input-group">
                 <label>Endpoint URL</label>
-                <input type="text" id="endpointUrl" value="/health" placeholder="/api/profile">
+                <input type="text" id="endpointUrl" value="/health" placeholder="/api/profile" list="endpointList">
+                <datalist id="endpointList"></datalist>
             </div>
 
             <div class="input-group">
@@ -347,7 +349,7 @@ var demoPageHTML = `<!DOCTYPE html>
 
             <div class="input-group">
                 <label>Send Message (JSON)</label>
-                <textarea id="wsMessage" placeholder='{"message": "test"}'></textarea>
+                <textarea id="wsMessage" placeholder='{"type": "subscribe", "topic": "prices:*", "ref": "1"}'></textarea>
                 <button class="btn" onclick="sendWebSocketMessage()" style="margin-top: 0.5rem;">Send Message</button>
             </div>
 
@@ -435,7 +437,6 @@ var demoPageHTML = `<!DOCTYPE html>
                         <label>Endpoint to Test</label>
                         <select id="rateLimitEndpoint">
                             <option value="/health">/health (Public)</option>
-                            <option value="/api/profile">/api/profile (Protected - requires auth)</option>
                         </select>
                     </div>
                     <div class="input-group">
@@ -485,7 +486,9 @@ var demoPageHTML = `<!DOCTYPE html>
         <!-- Frontend Integration -->
         <section id="integrations" class="section">
             <h2>💻 Frontend Integration Examples</h2>
-            <p>Complete code examples for connecting your frontend apps to this backend.</p>
+            <p>Typed clients are generated from this server's routes and WebSocket message schema: download
+               <a href="/docs/sdk/typescript">client.ts</a> or <a href="/docs/sdk/dart">client.dart</a>, or run
+               <code>go run ./cmd/server gen-sdk -lang typescript,dart -out ./sdk</code>. Regenerate after the API changes.</p>
 
             <div class="tabs">
                 <button class="tab active" onclick="showTab('react')">React</button>
@@ -497,37 +500,30 @@ var demoPageHTML = `<!DOCTYPE html>
             <div id="react" class="tab-content active">
                 <h3>React Integration</h3>
                 <div class="code-block">
-                    <code id="reactCode">// API Configuration
-const API_URL = 'http://localhost:3000';
-
-// Making authenticated requests
-async function fetchProfile(token) {
-  const response = await fetch(API_URL + '/api/profile', {
-    headers: {
-      'Authorization': 'Bearer ' + token,
-      'Content-Type': 'application/json'
-    }
-  });
-  return response.json();
-}
+                    <code id="reactCode">// Copy client.ts into src/api/
+import { ApiClient, subscribe } from './api/client';
 
-// WebSocket connection
-const ws = new WebSocket('ws://localhost:3000/ws');
-ws.onmessage = (event) => {
-  const data = JSON.parse(event.data);
-  console.log('Received:', data);
-};
+const api = new ApiClient({
+  baseUrl: 'http://localhost:3000',
+  token: () => localStorage.getItem('token') ?? undefined,
+});
 
-// Using in React component
 function ProfileComponent() {
   const [profile, setProfile] = useState(null);
-  const token = localStorage.getItem('token');
+  const [prices, setPrices] = useState({});
 
   useEffect(() => {
-    fetchProfile(token).then(setProfile);
-  }, [token]);
+    api.getProfile().then(setProfile);
+
+    // Typed realtime updates; onClose explains server disconnects (4429, 4503, ...)
+    const socket = subscribe('http://localhost:3000', {
+      onPriceUpdate: (update) => setPrices(p => ({ ...p, [update.artist_id]: update.price })),
+      onClose: (code, reason, error) => console.log('Closed', code, error?.message ?? reason),
+    });
+    return () => socket.close();
+  }, []);
 
-  return <div>{profile && <p>User: {profile.user}</p>}</div>;
+  return profile ? 'User: ' + profile.user : null;
 }</code>
                     <button class="copy-btn" onclick="copyToClipboard('reactCode')">Copy</button>
                 </div>
@@ -536,33 +532,21 @@ function ProfileComponent() {
             <div id="nextjs" class="tab-content">
                 <h3>Next.js Integration</h3>
                 <div class="code-block">
-                    <code id="nextjsCode">// Server Component (app directory)
-async function getProfile(token) {
-  const res = await fetch(process.env.BACKEND_URL + '/api/profile', {
-    headers: { 'Authorization': 'Bearer ' + token },
-    cache: 'no-store'
+                    <code id="nextjsCode">// Copy client.ts into lib/api/
+import { ApiClient } from '@/lib/api/client';
+
+// Server Component: fetch with the user's token (no caching for per-user data)
+export default async function Profile({ token }) {
+  const api = new ApiClient({
+    baseUrl: process.env.BACKEND_URL,
+    token,
+    fetch: (url, init) => fetch(url, { ...init, cache: 'no-store' }),
   });
-  return res.json();
+  const profile = await api.getProfile();
+  return profile.user;
 }
 
-// Client Component
-'use client';
-import { useEffect, useState } from 'react';
-
-export default function Profile() {
-  const [data, setData] = useState(null);
-  const token = localStorage.getItem('token');
-
-  useEffect(() => {
-    fetch(process.env.NEXT_PUBLIC_BACKEND_URL + '/api/profile', {
-      headers: { 'Authorization': 'Bearer ' + token }
-    })
-    .then(res => res.json())
-    .then(setData);
-  }, [token]);
-
-  return <div>{data?.user}</div>;
-}</code>
+// Client Components use subscribe() from the same file for realtime updates</code>
                     <button class="copy-btn" onclick="copyToClipboard('nextjsCode')">Copy</button>
                 </div>
             </div>
@@ -575,35 +559,18 @@ dependencies:
   http: ^1.1.0
   web_socket_channel: ^2.4.0
 
-// API Service
-import 'package:http/http.dart' as http;
-
-class ApiService {
-  static const String baseUrl = 'http://localhost:3000';
-
-  Future<Map<String, dynamic>> getProfile(String token) async {
-    final response = await http.get(
-      Uri.parse('$baseUrl/api/profile'),
-      headers: {
-        'Authorization': 'Bearer $token',
-        'Content-Type': 'application/json',
-      },
-    );
-    return json.decode(response.body);
-  }
-}
+// Copy client.dart into lib/api/
+import 'api/client.dart';
 
-// WebSocket
-import 'package:web_socket_channel/web_socket_channel.dart';
+final api = ApiClient('http://localhost:3000', token: () async => await storage.read('token'));
 
-final channel = WebSocketChannel.connect(
-  Uri.parse('ws://localhost:3000/ws'),
-);
+final profile = await api.getProfile();
 
-channel.stream.listen((message) {
-  final data = json.decode(message);
-  print('Received: $data');
-});</code>
+final channel = subscribe(
+  'http://localhost:3000',
+  onPriceUpdate: (update, envelope) => print('${update.artistId}: ${update.price}'),
+  onClose: (code, reason, error) => print('Closed $code ${error?.message ?? reason}'),
+);</code>
                     <button class="copy-btn" onclick="copyToClipboard('flutterCode')">Copy</button>
                 </div>
             </div>
@@ -612,29 +579,23 @@ channel.stream.listen((message) {
                 <h3>React Native Integration</h3>
                 <div class="code-block">
                     <code id="reactnativeCode">// Install: npm install @react-native-async-storage/async-storage
-
+// Copy client.ts into src/api/
 import AsyncStorage from '@react-native-async-storage/async-storage';
+import { ApiClient, subscribe, CloseCode } from './api/client';
 
-const API_URL = 'http://localhost:3000';
-
-// Store token
-await AsyncStorage.setItem('token', userToken);
-
-// Fetch with token
-const token = await AsyncStorage.getItem('token');
-const response = await fetch(API_URL + '/api/profile', {
-  headers: {
-        'Authorization': 'Bearer ' + token,
-    'Content-Type': 'application/json'
-  }
+const api = new ApiClient({
+  baseUrl: 'http://localhost:3000',
+  token: () => AsyncStorage.getItem('token').then(t => t ?? undefined),
 });
 
-// WebSocket
-const ws = new WebSocket('ws://localhost:3000/ws');
-ws.onmessage = (event) => {
-  const data = JSON.parse(event.data);
-  console.log('Received:', data);
-};</code>
+const profile = await api.getProfile();
+
+const socket = subscribe('http://localhost:3000', {
+  onPriceUpdate: (update) => console.log(update.artist_id, update.price),
+  onClose: (code) => {
+    if (code === CloseCode.Draining) reconnect(); // Server restarting: reconnect right away
+  },
+});</code>
                     <button class="copy-btn" onclick="copyToClipboard('reactnativeCode')">Copy</button>
                 </div>
             </div>
@@ -687,6 +648,36 @@ ws.onmessage = (event) => {
 
         let ws = null;
 
+        // Load the endpoint list generated from the server's live routes
+        async function loadEndpoints() {
+            try {
+                const response = await fetch(baseUrl + '/docs/endpoints');
+                const data = await response.json();
+                const datalist = document.getElementById('endpointList');
+                const rateLimitSelect = document.getElementById('rateLimitEndpoint');
+                rateLimitSelect.innerHTML = '';
+
+                data.endpoints.forEach(endpoint => {
+                    if (endpoint.websocket) return;
+
+                    const option = document.createElement('option');
+                    option.value = endpoint.path;
+                    option.label = endpoint.method + ' ' + endpoint.summary;
+                    datalist.appendChild(option);
+
+                    if (endpoint.method === 'GET') {
+                        const rateOption = document.createElement('option');
+                        rateOption.value = endpoint.path;
+                        rateOption.textContent = endpoint.path + (endpoint.auth ? ' (Protected - requires auth)' : ' (Public)');
+                        rateLimitSelect.appendChild(rateOption);
+                    }
+                });
+            } catch (error) {
+                console.error('Failed to load endpoints', error);
+            }
+        }
+        loadEndpoints();
+
         // API Tester
         async function testEndpoint() {
             const method = document.getElementById('httpMethod').value;
@@ -750,8 +741,11 @@ ws.onmessage = (event) => {
                 addWsMessage('Error: ' + error, 'error');
             };
 
-            ws.onclose = () => {
-                document.getElementById('wsStatus').textContent = 'Disconnected';
+            ws.onclose = (event) => {
+                // Application close codes (4401, 4429, 4503, ...) come with a reason
+                document.getElementById('wsStatus').textContent = event.code >= 4000
+                    ? 'Disconnected (' + event.code + ' ' + event.reason + ')'
+                    : 'Disconnected';
                 document.getElementById('wsStatus').className = 'status-badge status-disconnected';
                 document.getElementById('wsConnectBtn').disabled = false;
                 document.getElementById('wsDisconnectBtn').disabled = true;
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Optimistic concurrency for PUT endpoints: responses carry the row's version as an ETag
+// (e.g. "3"), and a client sends it back in If-Match so its update is rejected with 409 if
+// another request (another device) wrote in between, instead of silently overwriting it.
+
+// setETag sets the ETag header to a version.
+func setETag(c *fiber.Ctx, version int) {
+	c.Set(fiber.HeaderETag, `"`+strconv.Itoa(version)+`"`)
+}
+
+// ifMatch returns the version in the If-Match header, or anyVersion without the header or with
+// "*". ok is false if the header is not a single version ETag.
+//
+// Weak ETags (W/"3") are accepted like strong ones: proxies that compress responses weaken the
+// ETag, and the version identifies the row either way.
+func ifMatch(c *fiber.Ctx, anyVersion int) (version int, ok bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return anyVersion, true
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// badIfMatch responds to a malformed If-Match header.
+func badIfMatch(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": `If-Match must be a single ETag from a previous response, e.g. "3"`,
+	})
+}
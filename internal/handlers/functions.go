@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/functions"
+	"boilerplate/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// functionRequestHeaders are the request headers forwarded to edge functions (Authorization and
+// apikey are set by the functions client).
+var functionRequestHeaders = []string{fiber.HeaderContentType, fiber.HeaderAccept, fiber.HeaderAcceptLanguage}
+
+// functionResponseHeaders are the response headers copied back from edge functions.
+var functionResponseHeaders = []string{fiber.HeaderContentType, fiber.HeaderCacheControl, fiber.HeaderContentDisposition}
+
+// InvokeFunction forwards the request to the Supabase Edge Function :name with its method, query,
+// body and the caller's access token, and returns the function's status and body as is.
+// GET and HEAD requests are retried as configured (FUNCTIONS_RETRIES). Functions not listed in
+// FUNCTIONS_ALLOWED (when set) get a 404.
+func InvokeFunction(c *fiber.Ctx) error {
+	client := functions.Get()
+	if client == nil {
+		return apperror.Write(c, apperror.Unavailable("Edge functions are not configured", nil))
+	}
+	name := c.Params("name")
+	if !functions.ValidName(name) {
+		return apperror.Write(c, apperror.BadRequest("Invalid function name: letters, digits, - and _ only"))
+	}
+	if !client.Allowed(name) {
+		return apperror.Write(c, apperror.NotFound("Unknown function"))
+	}
+
+	req := functions.Request{
+		Method: c.Method(),
+		Body:   c.Body(),
+		Header: make(map[string][]string),
+		Token:  strings.TrimSpace(strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")),
+		Retry:  c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead,
+	}
+	for _, header := range functionRequestHeaders {
+		if value := c.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	// Pass the correlation ID on, so the function's logs can be matched with ours
+	if requestID := logging.GetRequestID(c); requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
+	if query, err := url.ParseQuery(string(c.Request().URI().QueryString())); err == nil {
+		req.Query = query
+	}
+
+	resp, err := client.Invoke(c.UserContext(), name, req)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to invoke edge function", "function", name, "error", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return apperror.Write(c, apperror.Timeout("Failed to invoke edge function", nil))
+		}
+		return apperror.Write(c, apperror.BadGateway("Failed to invoke edge function", nil))
+	}
+
+	for _, header := range functionResponseHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			c.Set(header, value)
+		}
+	}
+	return c.Status(resp.Status).Send(resp.Body)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"boilerplate/internal/functions"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInvokeFunction tests that the method, query, body and token reach the function, and its
+// response comes back as is.
+func TestInvokeFunction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "/functions/v1/greet", r.URL.Path)
+		assert.Equal(t, "PUT", r.Method)
+		assert.Equal(t, "lang=en", r.URL.RawQuery)
+		assert.Equal(t, "Bearer user-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "anon", r.Header.Get("apikey"))
+		assert.Empty(t, r.Header.Get("Cookie"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"echo": ` + string(body) + `}`))
+	}))
+	defer server.Close()
+	defer functions.SetDefault(functions.Get())
+	functions.SetDefault(functions.NewClient(server.URL, "anon", "service", functions.Options{Allowed: []string{"greet"}}))
+
+	app := fiber.New()
+	app.All("/api/functions/:name", InvokeFunction)
+	send := func(method, path string) *http.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"name": "Ada"}`))
+		req.Header.Set("Authorization", "Bearer user-token")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Cookie", "session=secret")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := send("PUT", "/api/functions/greet?lang=en")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"echo": {"name": "Ada"}}`, string(body))
+
+	assert.Equal(t, http.StatusNotFound, send("POST", "/api/functions/other").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/api/functions/..%2Frest").StatusCode)
+
+	functions.SetDefault(nil)
+	assert.Equal(t, http.StatusServiceUnavailable, send("POST", "/api/functions/greet").StatusCode)
+}
@@ -4,27 +4,36 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
+	"boilerplate/internal/apperror"
 	"boilerplate/internal/cache"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/price"
+	"boilerplate/internal/status"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/timing"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
 )
 
 // GraphQLProxy forwards GraphQL requests to Supabase's GraphQL endpoint.
 // It preserves the request method, body, and headers (especially Authorization)
-// and returns the response from Supabase.
+// and returns the response from Supabase. POST bodies are validated first (see
+// validateGraphQLRequest): invalid ones get a 400 listing the problems and are not forwarded.
+// Read queries may be answered from the response cache (see InitGraphQLCache).
 func GraphQLProxy(c *fiber.Ctx) error {
+	logger := logging.FromRequest(c)
 	supabaseURL := os.Getenv("SUPABASE_URL")
 	if supabaseURL == "" {
-		log.Println("ERROR: SUPABASE_URL environment variable is not set")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "GraphQL proxy configuration error",
-		})
+		logger.Error("SUPABASE_URL environment variable is not set")
+		return apperror.Write(c, apperror.New(fiber.StatusInternalServerError, apperror.CodeInternal, "GraphQL proxy configuration error"))
 	}
 
 	// Build the target URL
@@ -36,13 +45,106 @@ func GraphQLProxy(c *fiber.Ctx) error {
 		body = []byte{}
 	}
 
+	// Reject malformed requests here with the reason, rather than relaying Supabase's opaque error
+	if c.Method() == fiber.MethodPost {
+		if details := validateGraphQLRequest(body, getMaxQueryLength()); len(details) > 0 {
+			return apperror.Write(c, apperror.BadRequest("Invalid GraphQL request").With("details", details))
+		}
+	}
+
+	// Answer read queries from the response cache when possible (see graphql_cache.go)
+	cacheEntry, cacheHeader := graphQLCacheFor(c, body)
+	if cached := cacheEntry.get(); cached != nil {
+		c.Set(GraphQLCacheHeader, GraphQLCacheHit)
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return sendGraphQLResponse(c, body, fiber.StatusOK, cached)
+	}
+
+	// Forward the request to Supabase
+	statusCode, respBody, err := forwardToSupabase(c, targetURL, body, isGraphQLQuery(c, body))
+	if err != nil {
+		return respondProxyError(c, err)
+	}
+	if cacheHeader != "" {
+		c.Set(GraphQLCacheHeader, cacheHeader)
+	}
+
+	// Cache successful query responses before prices are injected, so hits get current prices
+	cacheEntry.put(statusCode, respBody)
+
+	return sendGraphQLResponse(c, body, statusCode, respBody)
+}
+
+// isGraphQLQuery reports whether a request only reads: a GET, or a POST running a query (not a
+// mutation or subscription).
+func isGraphQLQuery(c *fiber.Ctx, body []byte) bool {
+	if c.Method() == fiber.MethodGet {
+		return true
+	}
+	var req struct {
+		Query         string `json:"query"`
+		OperationName string `json:"operationName"`
+	}
+	if c.Method() != fiber.MethodPost || json.Unmarshal(body, &req) != nil {
+		return false
+	}
+	kind, _ := graphQLOperation(req.Query, req.OperationName)
+	return kind == "query"
+}
+
+// sendGraphQLResponse sends a response from Supabase or the response cache, with cached prices
+// injected if the query requests currentPrice.
+func sendGraphQLResponse(c *fiber.Ctx, body []byte, statusCode int, respBody []byte) error {
+	// Inject cached prices if query requests currentPrice
+	// (prices are read from the request tenant's cache namespace)
+	if statusCode == http.StatusOK && strings.Contains(string(body), "currentPrice") {
+		// Live prices come from the cache, which Realtime keeps fresh: if either is down (or the
+		// table no longer has the columns Realtime reads) the prices may be stale or missing, and
+		// status.Middleware flags the response as degraded
+		status.Uses(c, status.Cache, status.Realtime, status.RealtimeSchema)
+
+		// Re-encoding the response is serialization; the cache reads inside count as cache
+		stopSerialization := timing.Start(c, timing.PhaseSerialization)
+		// With ?price_meta=true each price also gets currency, precision and a display string
+		respBody = injectCachedPricesWithMeta(tenant.Cache(c), body, respBody, price.FromRequest(c))
+		stopSerialization()
+	}
+
+	return c.Status(statusCode).Send(respBody)
+}
+
+// proxyError is a failure to reach Supabase, answered with a problem with its status and message.
+type proxyError struct {
+	status  int
+	message string
+}
+
+func (e *proxyError) Error() string {
+	return e.message
+}
+
+// respondProxyError answers a failed forwardToSupabase.
+func respondProxyError(c *fiber.Ctx, err error) error {
+	proxyErr, ok := err.(*proxyError)
+	if !ok {
+		proxyErr = &proxyError{status: fiber.StatusBadGateway, message: err.Error()}
+	}
+	return apperror.Write(c, apperror.New(proxyErr.status, apperror.CodeFor(proxyErr.status), proxyErr.message))
+}
+
+// forwardToSupabase sends the request to targetURL with the client's method, body and headers
+// (especially Authorization and apikey, so Supabase applies the caller's row level security) and
+// returns Supabase's status and body. Supabase's response headers are copied to the response.
+// Errors are *proxyError, answered with respondProxyError. Idempotent requests (that may run
+// twice without harm) are retried as configured by InitProxy.
+func forwardToSupabase(c *fiber.Ctx, targetURL string, body []byte, idempotent bool) (int, []byte, error) {
+	logger := logging.FromRequest(c)
+
 	// Create a new request to Supabase
-	req, err := http.NewRequest(c.Method(), targetURL, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(c.UserContext(), c.Method(), targetURL, bytes.NewReader(body))
 	if err != nil {
-		log.Printf("ERROR: Failed to create request to Supabase: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create proxy request",
-		})
+		logger.Error("Failed to create request to Supabase", "error", err)
+		return 0, nil, &proxyError{status: fiber.StatusInternalServerError, message: "Failed to create proxy request"}
 	}
 
 	// Copy all headers from the original request
@@ -54,44 +156,40 @@ func GraphQLProxy(c *fiber.Ctx) error {
 			req.Header.Set(keyStr, valueStr)
 		}
 	})
+	// Pass the correlation ID on, so Supabase-side logs can be matched with ours
+	if requestID := logging.GetRequestID(c); requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
 
-	// Make the request to Supabase
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Make the request to Supabase (timed as the upstream phase, including reading the body)
+	stopUpstream := timing.Start(c, timing.PhaseUpstream)
+	upstreamStart := time.Now()
+	resp, err := doWithRetries(logger, req, idempotent)
 	if err != nil {
-		log.Printf("ERROR: Failed to proxy request to Supabase: %v", err)
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"error": "Failed to connect to Supabase",
-		})
+		stopUpstream()
+		metrics.SupabaseProxyDuration.WithLabelValues("error").Observe(time.Since(upstreamStart).Seconds())
+		logger.Error("Failed to proxy request to Supabase", "error", err)
+		return 0, nil, &proxyError{status: fiber.StatusBadGateway, message: "Failed to connect to Supabase"}
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	respBody, err := io.ReadAll(resp.Body)
+	stopUpstream()
+	metrics.SupabaseProxyDuration.WithLabelValues(metrics.StatusClass(resp.StatusCode)).Observe(time.Since(upstreamStart).Seconds())
 	if err != nil {
-		log.Printf("ERROR: Failed to read response from Supabase: %v", err)
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"error": "Failed to read response from Supabase",
-		})
+		logger.Error("Failed to read response from Supabase", "error", err)
+		return 0, nil, &proxyError{status: fiber.StatusBadGateway, message: "Failed to read response from Supabase"}
 	}
 
 	// Copy response headers (excluding hop-by-hop headers)
 	copyResponseHeaders(c, resp)
 
-	// Set status code
-	statusCode := resp.StatusCode
-
 	// Log 5xx errors
-	if statusCode >= 500 {
-		log.Printf("ERROR: Supabase returned 5xx error: %d - %s", statusCode, string(respBody))
-	}
-
-	// Inject cached prices if query requests currentPrice
-	if statusCode == http.StatusOK && strings.Contains(string(body), "currentPrice") {
-		respBody = injectCachedPrices(body, respBody)
+	if resp.StatusCode >= 500 {
+		logger.Error("Supabase returned 5xx error", "upstream_status", resp.StatusCode, "body", string(respBody))
 	}
-
-	return c.Status(statusCode).Send(respBody)
+	return resp.StatusCode, respBody, nil
 }
 
 // isHopByHopHeader checks if a header is a hop-by-hop header that shouldn't be forwarded.
@@ -145,7 +243,7 @@ type graphQLResponse struct {
 func parseGraphQLQuery(queryBody []byte) string {
 	var req graphQLRequest
 	if err := json.Unmarshal(queryBody, &req); err != nil {
-		log.Printf("WARNING: Failed to parse GraphQL query: %v", err)
+		slog.Warn("Failed to parse GraphQL query", "error", err)
 		return ""
 	}
 	return req.Query
@@ -179,28 +277,32 @@ func findArtistIDsInResponse(responseData map[string]interface{}) map[string]int
 	return artistIDs
 }
 
-// getCachedPrices fetches cached prices from Redis for the given artist IDs.
+// getCachedPrices fetches cached prices from Redis for the given artist IDs, in one MGET.
 // Returns a map of artist ID to cached price.
 // Only includes prices that were found in the cache.
-func getCachedPrices(artistIDs []string) map[string]float64 {
-	redisClient := cache.GetClient()
-	if redisClient == nil {
-		return nil // No cache available
+func getCachedPrices(redisClient cache.Store, artistIDs []string) map[string]decimal.Decimal {
+	if redisClient == nil || len(artistIDs) == 0 {
+		return nil // No cache available, or nothing to look up
 	}
 
-	cachedPrices := make(map[string]float64)
+	cacheKeys := make([]string, len(artistIDs))
+	for i, artistID := range artistIDs {
+		cacheKeys[i] = "price:" + artistID
+	}
+	cachedValues, err := redisClient.MGet(cacheKeys...)
+	if err != nil {
+		slog.Warn("Failed to fetch cached prices", "artists", len(artistIDs), "error", err)
+		return nil
+	}
 
-	// Try to get each artist's price from cache
-	for _, artistID := range artistIDs {
-		cacheKey := "price:" + artistID
-		cachedValue, err := redisClient.Get(cacheKey)
-		
-		// If we got a value and no error, parse it as a float
-		if err == nil && cachedValue != "" {
-			if price, err := strconv.ParseFloat(cachedValue, 64); err == nil {
-				cachedPrices[artistID] = price
-				log.Printf("Cache hit for artist %s: %.2f", artistID, price)
-			}
+	cachedPrices := make(map[string]decimal.Decimal)
+	for i, cachedValue := range cachedValues {
+		if i >= len(artistIDs) || cachedValue == "" {
+			continue // Cache miss
+		}
+		if amount, err := price.Parse(cachedValue); err == nil {
+			cachedPrices[artistIDs[i]] = amount
+			slog.Debug("Cache hit for artist price", "artist_id", artistIDs[i], "price", amount.String())
 		}
 	}
 
@@ -208,23 +310,34 @@ func getCachedPrices(artistIDs []string) map[string]float64 {
 }
 
 // injectPriceIntoArtist injects a cached price into an artist object in the response.
-// Modifies the artist map in place by adding a "currentPrice" field.
-func injectPriceIntoArtist(artistMap map[string]interface{}, price float64) {
-	artistMap["currentPrice"] = price
+// Modifies the artist map in place by adding a "currentPrice" field, and a "currentPriceMeta"
+// field (currency, precision, display string) when format is not nil.
+// currentPrice stays a JSON number (clients read it as a Float) but is written from the decimal's
+// exact digits, so it never picks up float artifacts like 45.670000000000002.
+func injectPriceIntoArtist(artistMap map[string]interface{}, amount decimal.Decimal, format *price.Format) {
+	artistMap["currentPrice"] = json.Number(price.String(amount))
+	if format != nil {
+		artistMap["currentPriceMeta"] = format.Describe(amount)
+	}
 }
 
 // injectCachedPrices is the main function that injects cached prices into a GraphQL response.
 // Flow:
-//   1. Check if cache is available
-//   2. Parse the GraphQL query to see if it requests currentPrice
-//   3. Parse the GraphQL response
-//   4. Find artist IDs in the response
-//   5. Get cached prices from Redis
-//   6. Inject cached prices into the response
-//   7. Return the modified response
-func injectCachedPrices(queryBody, responseBody []byte) []byte {
+//  1. Check if cache is available
+//  2. Parse the GraphQL query to see if it requests currentPrice
+//  3. Parse the GraphQL response
+//  4. Find artist IDs in the response
+//  5. Get cached prices from Redis
+//  6. Inject cached prices into the response
+//  7. Return the modified response
+func injectCachedPrices(redisClient cache.Store, queryBody, responseBody []byte) []byte {
+	return injectCachedPricesWithMeta(redisClient, queryBody, responseBody, nil)
+}
+
+// injectCachedPricesWithMeta is injectCachedPrices with price display metadata in format
+// (nil for none).
+func injectCachedPricesWithMeta(redisClient cache.Store, queryBody, responseBody []byte, format *price.Format) []byte {
 	// Step 1: Check if cache is available
-	redisClient := cache.GetClient()
 	if redisClient == nil {
 		return responseBody // No cache, return original response
 	}
@@ -239,7 +352,7 @@ func injectCachedPrices(queryBody, responseBody []byte) []byte {
 	// Step 3: Parse the GraphQL response
 	var resp graphQLResponse
 	if err := json.Unmarshal(responseBody, &resp); err != nil {
-		log.Printf("WARNING: Failed to parse GraphQL response: %v", err)
+		slog.Warn("Failed to parse GraphQL response", "error", err)
 		return responseBody
 	}
 
@@ -266,7 +379,7 @@ func injectCachedPrices(queryBody, responseBody []byte) []byte {
 	for id := range artistIDMap {
 		artistIDs = append(artistIDs, id)
 	}
-	cachedPrices := getCachedPrices(artistIDs)
+	cachedPrices := getCachedPrices(redisClient, artistIDs)
 	if len(cachedPrices) == 0 {
 		return responseBody // No cache hits
 	}
@@ -278,7 +391,7 @@ func injectCachedPrices(queryBody, responseBody []byte) []byte {
 	}
 
 	// For each artist that has a cached price, inject it
-	for artistID, price := range cachedPrices {
+	for artistID, cachedPrice := range cachedPrices {
 		index, found := artistIDMap[artistID]
 		if !found {
 			continue // Artist not in response (shouldn't happen)
@@ -290,17 +403,16 @@ func injectCachedPrices(queryBody, responseBody []byte) []byte {
 		}
 
 		// Inject the cached price
-		injectPriceIntoArtist(artistMap, price)
-		log.Printf("Injected cached price for artist %s: %.2f", artistID, price)
+		injectPriceIntoArtist(artistMap, cachedPrice, format)
+		slog.Debug("Injected cached price", "artist_id", artistID, "price", cachedPrice.String())
 	}
 
 	// Step 9: Marshal the modified response back to JSON
 	modifiedBody, err := json.Marshal(resp)
 	if err != nil {
-		log.Printf("WARNING: Failed to create modified response: %v", err)
+		slog.Warn("Failed to create modified response", "error", err)
 		return responseBody
 	}
 
 	return modifiedBody
 }
-
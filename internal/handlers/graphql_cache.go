@@ -0,0 +1,356 @@
+package handlers
+
+// GraphQL response cache.
+//
+// Read queries can be answered from the cache instead of Supabase. A response is cached under a
+// hash of the query, its variables, the operation name and the caller (the authenticated user,
+// else the token or API key sent), in the request tenant's namespace, so callers never see each
+// other's rows. Only successful POST queries are cached: mutations, subscriptions and responses
+// with errors always reach Supabase. Cached prices are injected after the lookup, so a cached
+// response still carries the latest prices.
+//
+// GRAPHQL_CACHE_TTL is how long queries are cached (0, the default, turns caching off) and
+// GRAPHQL_CACHE_OPERATIONS overrides it per operation name. Clients skip the cache with
+// Cache-Control: no-cache (fetch from Supabase and refresh the cached response) or no-store
+// (fetch from Supabase, cache nothing). Responses say which happened in X-Cache.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GraphQLCacheHeader is the response header saying how the GraphQL cache was used.
+const GraphQLCacheHeader = "X-Cache"
+
+// Values of GraphQLCacheHeader.
+const (
+	GraphQLCacheHit    = "HIT"    // Answered from the cache
+	GraphQLCacheMiss   = "MISS"   // Fetched from Supabase and cached if successful
+	GraphQLCacheBypass = "BYPASS" // Fetched from Supabase and not cached (no-store)
+)
+
+// graphQLCacheSettings are the TTLs of cached queries.
+type graphQLCacheSettings struct {
+	defaultTTL time.Duration            // 0: queries are not cached unless listed in operations
+	operations map[string]time.Duration // By operation name; 0 turns caching off for the operation
+}
+
+var (
+	graphQLCacheMu sync.RWMutex
+	graphQLCache   graphQLCacheSettings
+)
+
+// InitGraphQLCache reads GRAPHQL_CACHE_TTL and GRAPHQL_CACHE_OPERATIONS. Invalid settings are
+// logged and leave the cache off.
+func InitGraphQLCache() {
+	s, err := loadGraphQLCacheSettings()
+	if err != nil {
+		slog.Error("Invalid GraphQL cache settings, responses are not cached", "error", err)
+		startup.Report("graphql cache", false, err.Error())
+		return
+	}
+	ConfigureGraphQLCache(s.defaultTTL, s.operations)
+	if !s.enabled() {
+		startup.Report("graphql cache", false, "GRAPHQL_CACHE_TTL not set")
+		return
+	}
+	startup.Report("graphql cache", true, fmt.Sprintf("queries cached for %s, %d operation overrides", s.defaultTTL, len(s.operations)))
+}
+
+// loadGraphQLCacheSettings reads the GraphQL cache settings from the environment.
+func loadGraphQLCacheSettings() (graphQLCacheSettings, error) {
+	var s graphQLCacheSettings
+	if value := strings.TrimSpace(os.Getenv("GRAPHQL_CACHE_TTL")); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return s, fmt.Errorf("GRAPHQL_CACHE_TTL must be a duration such as 30s, got %q", value)
+		}
+		s.defaultTTL = ttl
+	}
+
+	raw := strings.TrimSpace(os.Getenv("GRAPHQL_CACHE_OPERATIONS"))
+	if raw == "" {
+		return s, nil
+	}
+	var operations map[string]string
+	if err := json.Unmarshal([]byte(raw), &operations); err != nil {
+		return s, fmt.Errorf("GRAPHQL_CACHE_OPERATIONS must be a JSON object of operation names to durations: %w", err)
+	}
+	s.operations = make(map[string]time.Duration, len(operations))
+	for name, value := range operations {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return s, fmt.Errorf("GRAPHQL_CACHE_OPERATIONS: operation %q needs a duration such as 30s, got %q", name, value)
+		}
+		s.operations[name] = ttl
+	}
+	return s, nil
+}
+
+// enabled reports whether any query is cached.
+func (s graphQLCacheSettings) enabled() bool {
+	if s.defaultTTL > 0 {
+		return true
+	}
+	for _, ttl := range s.operations {
+		if ttl > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ttl returns how long the response to an operation is cached (0: not cached).
+func (s graphQLCacheSettings) ttl(operationName string) time.Duration {
+	if ttl, ok := s.operations[operationName]; ok && operationName != "" {
+		return ttl
+	}
+	return s.defaultTTL
+}
+
+// ConfigureGraphQLCache sets the default TTL of cached queries and the TTLs by operation name.
+// InitGraphQLCache calls it from the environment; it is mainly useful in tests.
+func ConfigureGraphQLCache(defaultTTL time.Duration, operations map[string]time.Duration) {
+	graphQLCacheMu.Lock()
+	defer graphQLCacheMu.Unlock()
+	graphQLCache = graphQLCacheSettings{defaultTTL: defaultTTL, operations: operations}
+}
+
+// graphQLCacheEntry is where the response to a query is cached.
+type graphQLCacheEntry struct {
+	store cache.Store
+	key   string
+	ttl   time.Duration
+	read  bool // false with Cache-Control: no-cache, which only refreshes the entry
+}
+
+// graphQLCacheFor returns where the response to a request is cached and the GraphQLCacheHeader
+// value for a miss. The entry is nil if the response isn't cached: the cache is off or
+// unavailable, the request is not a POST query, its operation isn't cached, or the client sent
+// Cache-Control: no-store (header BYPASS). header is empty if the request is not cacheable.
+func graphQLCacheFor(c *fiber.Ctx, body []byte) (entry *graphQLCacheEntry, header string) {
+	graphQLCacheMu.RLock()
+	settings := graphQLCache
+	graphQLCacheMu.RUnlock()
+	if !settings.enabled() || c.Method() != fiber.MethodPost {
+		return nil, ""
+	}
+
+	var req struct {
+		Query         string          `json:"query"`
+		Variables     json.RawMessage `json:"variables"`
+		OperationName string          `json:"operationName"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, ""
+	}
+	kind, name := graphQLOperation(req.Query, req.OperationName)
+	if kind != "query" {
+		return nil, "" // Mutations and subscriptions always reach Supabase, as do ambiguous documents
+	}
+	ttl := settings.ttl(name)
+	if ttl <= 0 {
+		return nil, ""
+	}
+
+	directives := strings.ToLower(c.Get(fiber.HeaderCacheControl))
+	if strings.Contains(directives, "no-store") {
+		return nil, GraphQLCacheBypass
+	}
+	store := tenant.Cache(c)
+	if store == nil {
+		return nil, ""
+	}
+
+	variables, err := canonicalJSON(req.Variables)
+	if err != nil {
+		return nil, ""
+	}
+	return &graphQLCacheEntry{
+		store: store,
+		key:   graphQLCacheKey(graphQLSubject(c), name, req.Query, variables),
+		ttl:   ttl,
+		read:  !strings.Contains(directives, "no-cache") && !strings.Contains(directives, "max-age=0"),
+	}, GraphQLCacheMiss
+}
+
+// get returns the cached response, or nil on a miss (or for a nil entry).
+func (e *graphQLCacheEntry) get() []byte {
+	if e == nil || !e.read {
+		return nil
+	}
+	value, err := e.store.Get(e.key)
+	if err != nil || value == "" {
+		return nil
+	}
+	return []byte(value)
+}
+
+// put caches a response from Supabase if it is a successful one (data and no errors). It does
+// nothing for a nil entry.
+func (e *graphQLCacheEntry) put(statusCode int, respBody []byte) {
+	if e == nil || statusCode != fiber.StatusOK {
+		return
+	}
+	var resp graphQLResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil || resp.Data == nil || len(resp.Errors) > 0 {
+		return
+	}
+	if err := e.store.Set(e.key, string(respBody), e.ttl); err != nil {
+		slog.Warn("Failed to cache GraphQL response", "error", err)
+	}
+}
+
+// graphQLSubject identifies the caller whose permissions the response reflects: the user set by
+// Auth, else a hash of the token or API key Supabase evaluates row level security with.
+func graphQLSubject(c *fiber.Ctx) string {
+	if userID, _ := c.Locals("user").(string); userID != "" {
+		return "user:" + userID
+	}
+	if authorization := c.Get(fiber.HeaderAuthorization); authorization != "" {
+		return "token:" + hashHex(authorization)
+	}
+	if apiKey := c.Get("apikey"); apiKey != "" {
+		return "key:" + hashHex(apiKey)
+	}
+	return "anon"
+}
+
+// graphQLCacheKey returns the cache key of a query: "graphql:" and a hash of its parts.
+func graphQLCacheKey(subject, operationName, query string, variables []byte) string {
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(subject), []byte(operationName), []byte(query), variables} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return "graphql:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// hashHex returns the hex SHA-256 of value.
+func hashHex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON re-encodes a JSON value with sorted object keys, so variables sent in another
+// order share a cache entry. Numbers keep their digits.
+func canonicalJSON(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 || isJSONNull(raw) {
+		return nil, nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// graphQLOperation returns the type (query, mutation or subscription) and name of the operation
+// a document runs: the one named operationName, else its only operation. kind is empty if there
+// is no such operation. Only the top level of the document is read, skipping strings and
+// comments, which is enough to tell the operations apart without a full parser.
+func graphQLOperation(document, operationName string) (kind, name string) {
+	type operation struct{ kind, name string }
+	var operations []operation
+	var pending *operation // Definition whose selection set hasn't started yet
+	depth := 0
+
+	for i := 0; i < len(document); {
+		ch := document[i]
+		switch {
+		case ch == '#':
+			for i < len(document) && document[i] != '\n' {
+				i++
+			}
+			continue
+		case ch == '"':
+			if strings.HasPrefix(document[i:], `"""`) {
+				end := strings.Index(document[i+3:], `"""`)
+				if end < 0 {
+					return "", ""
+				}
+				i += end + 6
+				continue
+			}
+			for i++; i < len(document) && document[i] != '"'; i++ {
+				if document[i] == '\\' {
+					i++
+				}
+			}
+			i++
+			continue
+		case ch == '{' || ch == '(' || ch == '[':
+			if ch == '{' && depth == 0 {
+				if pending == nil {
+					pending = &operation{kind: "query"} // Shorthand { ... } query
+				}
+				operations = append(operations, *pending)
+				pending = nil
+			}
+			depth++
+		case ch == '}' || ch == ')' || ch == ']':
+			depth--
+		case isNameStart(ch):
+			start := i
+			for i < len(document) && isNameChar(document[i]) {
+				i++
+			}
+			if depth > 0 || start > 0 && document[start-1] == '@' {
+				continue // Inside a definition, or a directive
+			}
+			// A definition starts with its type, then its name (fragments go on with "on Type")
+			if word := document[start:i]; pending == nil {
+				pending = &operation{kind: word}
+			} else if pending.name == "" {
+				pending.name = word
+			}
+			continue
+		}
+		i++
+	}
+
+	var selected *operation
+	for j := range operations {
+		op := &operations[j]
+		if op.kind == "fragment" {
+			continue
+		}
+		if operationName != "" && op.name != operationName {
+			continue
+		}
+		if selected != nil {
+			return "", "" // Ambiguous: Supabase would reject it
+		}
+		selected = op
+	}
+	if selected == nil {
+		return "", ""
+	}
+	return selected.kind, selected.name
+}
+
+// isNameStart reports whether ch can start a GraphQL name.
+func isNameStart(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+// isNameChar reports whether ch can be part of a GraphQL name.
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupGraphQLCache points the proxy at a mock Supabase counting its requests, with an in-memory
+// cache and the given TTLs, and returns an app serving the proxy.
+func setupGraphQLCache(t *testing.T, defaultTTL time.Duration, operations map[string]time.Duration) (*fiber.App, *atomic.Int32) {
+	t.Helper()
+	originalCache := cache.GetClient()
+	cache.SetDefault(cache.NewMemoryStore())
+	ConfigureGraphQLCache(defaultTTL, operations)
+
+	var calls atomic.Int32
+	mockSupabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if bytes.Contains(body, []byte("broken")) {
+			w.Write([]byte(`{"errors":[{"message":"unknown field"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"artists":[{"id":"123","name":"Artist 1"}]}}`))
+	}))
+	originalURL := os.Getenv("SUPABASE_URL")
+	os.Setenv("SUPABASE_URL", mockSupabase.URL)
+	t.Cleanup(func() {
+		mockSupabase.Close()
+		os.Setenv("SUPABASE_URL", originalURL)
+		ConfigureGraphQLCache(0, nil)
+		cache.SetDefault(originalCache)
+	})
+
+	app := fiber.New()
+	app.All("/graphql", GraphQLProxy)
+	return app, &calls
+}
+
+// postGraphQL sends a GraphQL request and returns the response and its X-Cache header.
+func postGraphQL(t *testing.T, app *fiber.App, body string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp, resp.Header.Get(GraphQLCacheHeader)
+}
+
+// TestGraphQLProxy_ResponseCache tests that repeated queries are answered from the cache, per
+// caller and variables, and that errors and mutations are not cached.
+func TestGraphQLProxy_ResponseCache(t *testing.T) {
+	app, calls := setupGraphQLCache(t, time.Minute, nil)
+	query := `{"query":"query Artists($limit: Int) { artists(first: $limit) { id name } }","variables":{"limit":10,"offset":0}}`
+	alice := map[string]string{"Authorization": "Bearer alice"}
+
+	resp, header := postGraphQL(t, app, query, alice)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, GraphQLCacheMiss, header)
+	resp, header = postGraphQL(t, app, query, alice)
+	assert.Equal(t, GraphQLCacheHit, header)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var result map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.NotNil(t, result["data"])
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Variables in another order share the entry; another caller doesn't
+	_, header = postGraphQL(t, app, `{"query":"query Artists($limit: Int) { artists(first: $limit) { id name } }","variables":{"offset":0,"limit":10}}`, alice)
+	assert.Equal(t, GraphQLCacheHit, header)
+	_, header = postGraphQL(t, app, query, map[string]string{"Authorization": "Bearer bob"})
+	assert.Equal(t, GraphQLCacheMiss, header)
+	_, header = postGraphQL(t, app, `{"query":"query Artists($limit: Int) { artists(first: $limit) { id name } }","variables":{"limit":20}}`, alice)
+	assert.Equal(t, GraphQLCacheMiss, header)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Responses with errors and mutations always reach Supabase
+	for i := 0; i < 2; i++ {
+		postGraphQL(t, app, `{"query":"{ broken }"}`, alice)
+		_, header = postGraphQL(t, app, `{"query":"mutation { insertIntoArtistsCollection(objects: []) { affectedCount } }"}`, alice)
+		assert.Empty(t, header)
+	}
+	assert.Equal(t, int32(7), calls.Load())
+}
+
+// TestGraphQLProxy_ResponseCacheBypass tests the Cache-Control request directives.
+func TestGraphQLProxy_ResponseCacheBypass(t *testing.T) {
+	app, calls := setupGraphQLCache(t, time.Minute, nil)
+	query := `{"query":"{ artists { id name } }"}`
+
+	// no-store neither reads nor writes the cache
+	_, header := postGraphQL(t, app, query, map[string]string{"Cache-Control": "no-store"})
+	assert.Equal(t, GraphQLCacheBypass, header)
+	_, header = postGraphQL(t, app, query, nil)
+	assert.Equal(t, GraphQLCacheMiss, header)
+
+	// no-cache skips the cached response but refreshes it
+	_, header = postGraphQL(t, app, query, map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, GraphQLCacheMiss, header)
+	_, header = postGraphQL(t, app, query, nil)
+	assert.Equal(t, GraphQLCacheHit, header)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+// TestGraphQLProxy_ResponseCacheOperations tests the TTLs by operation name.
+func TestGraphQLProxy_ResponseCacheOperations(t *testing.T) {
+	app, calls := setupGraphQLCache(t, 0, map[string]time.Duration{"Artists": time.Minute, "Live": 0})
+
+	for i := 0; i < 2; i++ {
+		postGraphQL(t, app, `{"query":"query Artists { artists { id } }"}`, nil)
+		postGraphQL(t, app, `{"query":"query Other { artists { id } }"}`, nil)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+// TestGraphQLOperation tests finding the type and name of the operation a document runs.
+func TestGraphQLOperation(t *testing.T) {
+	tests := []struct {
+		document, operationName, kind, name string
+	}{
+		{"{ artists { id } }", "", "query", ""},
+		{"query { artists { id } }", "", "query", ""},
+		{"query Artists($id: ID = \"{\") @cached { artists { id } }", "", "query", "Artists"},
+		{"mutation Save { save { id } }", "", "mutation", "Save"},
+		{"subscription Prices { prices { id } }", "", "subscription", "Prices"},
+		{"# mutation Hidden\nquery Q { a(text: \"mutation { }\") }", "", "query", "Q"},
+		{"query A { a } mutation B { b }", "B", "mutation", "B"},
+		{"query A { a } mutation B { b }", "A", "query", "A"},
+		{"query A { a } mutation B { b }", "", "", ""},
+		{"query A { ...F } fragment F on Artist { id }", "", "query", "A"},
+		{"query A { a }", "Missing", "", ""},
+	}
+	for _, tt := range tests {
+		kind, name := graphQLOperation(tt.document, tt.operationName)
+		assert.Equal(t, tt.kind, kind, tt.document)
+		assert.Equal(t, tt.name, name, tt.document)
+	}
+}
+
+// TestLoadGraphQLCacheSettings tests reading the cache settings from the environment.
+func TestLoadGraphQLCacheSettings(t *testing.T) {
+	t.Setenv("GRAPHQL_CACHE_TTL", "30s")
+	t.Setenv("GRAPHQL_CACHE_OPERATIONS", `{"Artists": "5m", "Me": "0"}`)
+	s, err := loadGraphQLCacheSettings()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, s.ttl(""))
+	assert.Equal(t, 5*time.Minute, s.ttl("Artists"))
+	assert.Equal(t, time.Duration(0), s.ttl("Me"))
+
+	t.Setenv("GRAPHQL_CACHE_OPERATIONS", `{"Artists": 300}`)
+	_, err = loadGraphQLCacheSettings()
+	assert.Error(t, err)
+
+	t.Setenv("GRAPHQL_CACHE_OPERATIONS", "")
+	t.Setenv("GRAPHQL_CACHE_TTL", "soon")
+	_, err = loadGraphQLCacheSettings()
+	assert.Error(t, err)
+}
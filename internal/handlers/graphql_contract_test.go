@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/testutil/fixtures"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const graphQLFixturePath = "testdata/supabase/graphql_artists.json"
+
+// TestGraphQLProxy_Contract replays recorded Supabase GraphQL responses through the proxy.
+// Run with SUPABASE_RECORD=1 (and real SUPABASE_URL/SUPABASE_ANON_KEY) to re-record the fixture.
+func TestGraphQLProxy_Contract(t *testing.T) {
+	defer SetProxyClient(nil)
+
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+
+	store := cache.NewMemoryStore()
+	require.NoError(t, store.Set("price:artist-1", "45.67", time.Minute))
+	cache.SetDefault(store)
+
+	// Step 1: Choose record or replay mode
+	var recorder *fixtures.Recorder
+	if fixtures.Recording() {
+		if os.Getenv("SUPABASE_URL") == "" || os.Getenv("SUPABASE_ANON_KEY") == "" {
+			t.Skip("SUPABASE_RECORD=1 requires SUPABASE_URL and SUPABASE_ANON_KEY")
+		}
+		recorder = &fixtures.Recorder{}
+		SetProxyClient(&http.Client{Transport: recorder})
+	} else {
+		fixture, err := fixtures.LoadHTTP(graphQLFixturePath)
+		require.NoError(t, err)
+		SetProxyClient(&http.Client{Transport: fixtures.NewReplayer(fixture)})
+		t.Setenv("SUPABASE_URL", "https://fixtures.invalid")
+	}
+
+	app := fiber.New()
+	app.All("/graphql", GraphQLProxy)
+
+	query := func(q string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]string{"query": q})
+		req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("apikey", os.Getenv("SUPABASE_ANON_KEY"))
+
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	// Step 2: Artist list shape: data.artists is an array of objects with string ids
+	result := query("{ artists { id name } }")
+	data, ok := result["data"].(map[string]interface{})
+	require.True(t, ok, "response must contain a data object")
+	artists, ok := data["artists"].([]interface{})
+	require.True(t, ok, "data.artists must be an array")
+	require.NotEmpty(t, artists)
+	for _, artist := range artists {
+		artistMap, ok := artist.(map[string]interface{})
+		require.True(t, ok, "each artist must be an object")
+		assert.IsType(t, "", artistMap["id"], "artist id must be a string")
+	}
+
+	// Step 3: Cache injection still works against the recorded shape
+	result = query("{ artists { id name currentPrice } }")
+	artists = result["data"].(map[string]interface{})["artists"].([]interface{})
+	assert.Equal(t, 45.67, artists[0].(map[string]interface{})["currentPrice"])
+
+	// Step 4: GraphQL errors are relayed unchanged
+	result = query("{ unknownField }")
+	assert.NotEmpty(t, result["errors"])
+
+	// Step 5: Save the fixture when recording
+	if recorder != nil {
+		fixture := recorder.Fixture()
+		fixture.Description = "GraphQL proxy contract. Re-record with SUPABASE_RECORD=1 go test ./internal/handlers -run Contract"
+		require.NoError(t, fixture.Save(graphQLFixturePath))
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+)
+
+// FuzzInjectCachedPrices feeds arbitrary query and response bodies through price injection.
+// It must never panic, and it must return either the original body or valid JSON.
+func FuzzInjectCachedPrices(f *testing.F) {
+	f.Add(`{"query":"{ artists { id currentPrice } }"}`, `{"data":{"artists":[{"id":"a1"},{"id":"a2"}]}}`)
+	f.Add(`{"query":"{ artists { id currentPrice } }"}`, `{"data":{"artists":[{"id":"a1"},{"id":"a1"}]}}`)
+	f.Add(`{"query":"{ artists { id currentPrice } }"}`, `{"data":{"artists":[1,"x",null,{"id":5}]}}`)
+	f.Add(`{"query":"{ artists { id currentPrice } }"}`, `{"errors":[{"message":"boom"}]}`)
+	f.Add(`{"query":7}`, `{"data":null}`)
+	f.Add(`garbage`, `garbage`)
+
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+
+	store := cache.NewMemoryStore()
+	store.Set("price:a1", "45.67", time.Hour)
+	store.Set("price:a2", "not-a-number", time.Hour)
+	cache.SetDefault(store)
+
+	// Per-hit log lines would slow the fuzzer down considerably
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	f.Fuzz(func(t *testing.T, query, response string) {
+		result := injectCachedPrices(store, []byte(query), []byte(response))
+
+		if string(result) != response && !json.Valid(result) {
+			t.Fatalf("injection produced invalid JSON %q from %q", result, response)
+		}
+	})
+}
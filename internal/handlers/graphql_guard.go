@@ -0,0 +1,325 @@
+package handlers
+
+// GraphQL proxy protections.
+//
+// GraphQLGuard checks queries before GraphQLProxy forwards them, so expensive or unexpected
+// queries never reach Supabase:
+//
+//   - Persisted queries: GRAPHQL_PERSISTED_QUERIES names a JSON file of documents by the hex
+//     SHA-256 of their text (an object of hash to document, or an Apollo persisted query
+//     manifest). Clients may then send only the hash, as Apollo's automatic persisted queries do
+//     ({"extensions": {"persistedQuery": {"version": 1, "sha256Hash": "..."}}}), and
+//     GRAPHQL_ALLOWLIST_ONLY=true rejects every document not in the file.
+//   - GRAPHQL_MAX_DEPTH (default 10) limits how deeply fields nest, fragments included, and
+//     GRAPHQL_MAX_COMPLEXITY (default 0, off) the query's cost: one per field, with the cost of
+//     a list's fields multiplied by its first or last argument.
+//   - Mutations need a signed-in user's token (Authorization: Bearer), unless
+//     GRAPHQL_ANONYMOUS_MUTATIONS=true.
+//   - GRAPHQL_INTROSPECTION turns __schema and __type queries off; it defaults to false in
+//     production and true elsewhere.
+//
+// Only the operation the request runs (operationName) is checked. Rejections are counted in
+// graphql_rejected_requests_total{reason}.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultMaxDepth is the deepest query accepted when GRAPHQL_MAX_DEPTH is not set.
+const defaultMaxDepth = 10
+
+// Reasons of rejected GraphQL requests, as counted in graphql_rejected_requests_total.
+const (
+	rejectNotAllowed        = "not_allowed"
+	rejectUnknownPersisted  = "unknown_persisted_query"
+	rejectInvalid           = "invalid"
+	rejectDepth             = "depth"
+	rejectComplexity        = "complexity"
+	rejectAnonymousMutation = "anonymous_mutation"
+	rejectIntrospection     = "introspection"
+)
+
+// GraphQLGuardSettings are the protections GraphQLGuard applies. The zero value applies none.
+type GraphQLGuardSettings struct {
+	Persisted               map[string]string // Documents by the hex SHA-256 of their text
+	AllowlistOnly           bool              // Reject documents not in Persisted
+	MaxDepth                int               // 0: no limit
+	MaxComplexity           int               // 0: no limit
+	BlockAnonymousMutations bool
+	BlockIntrospection      bool
+}
+
+var (
+	graphQLGuardMu sync.RWMutex
+	graphQLGuard   GraphQLGuardSettings
+)
+
+// InitGraphQLGuard reads the GraphQL protection settings; production turns introspection off by
+// default. Invalid numbers are logged and replaced by their default. A persisted query file that
+// can't be read is logged and leaves the allow-list empty: with GRAPHQL_ALLOWLIST_ONLY=true every
+// query is then rejected, rather than none checked.
+func InitGraphQLGuard(production bool) {
+	s, err := loadGraphQLGuardSettings(production)
+	if err != nil {
+		slog.Error("Invalid GraphQL persisted queries, no query is allow-listed", "error", err)
+	}
+	ConfigureGraphQLGuard(s)
+
+	var protections []string
+	if s.Persisted != nil {
+		detail := fmt.Sprintf("%d persisted queries", len(s.Persisted))
+		if s.AllowlistOnly {
+			detail += " (allow-list only)"
+		}
+		protections = append(protections, detail)
+	}
+	if s.MaxDepth > 0 {
+		protections = append(protections, "depth "+strconv.Itoa(s.MaxDepth))
+	}
+	if s.MaxComplexity > 0 {
+		protections = append(protections, "complexity "+strconv.Itoa(s.MaxComplexity))
+	}
+	if s.BlockAnonymousMutations {
+		protections = append(protections, "no anonymous mutations")
+	}
+	if s.BlockIntrospection {
+		protections = append(protections, "no introspection")
+	}
+	if len(protections) == 0 {
+		startup.Report("graphql guard", false, "every query is forwarded")
+		return
+	}
+	startup.Report("graphql guard", true, strings.Join(protections, ", "))
+}
+
+// loadGraphQLGuardSettings reads the GraphQL protection settings from the environment.
+func loadGraphQLGuardSettings(production bool) (GraphQLGuardSettings, error) {
+	s := GraphQLGuardSettings{
+		AllowlistOnly:           os.Getenv("GRAPHQL_ALLOWLIST_ONLY") == "true",
+		MaxDepth:                getGraphQLLimit("GRAPHQL_MAX_DEPTH", defaultMaxDepth),
+		MaxComplexity:           getGraphQLLimit("GRAPHQL_MAX_COMPLEXITY", 0),
+		BlockAnonymousMutations: os.Getenv("GRAPHQL_ANONYMOUS_MUTATIONS") != "true",
+		BlockIntrospection:      production,
+	}
+	if value := os.Getenv("GRAPHQL_INTROSPECTION"); value != "" {
+		s.BlockIntrospection = value != "true"
+	}
+
+	path := strings.TrimSpace(os.Getenv("GRAPHQL_PERSISTED_QUERIES"))
+	if path == "" {
+		if s.AllowlistOnly {
+			s.Persisted = map[string]string{}
+			return s, errors.New("GRAPHQL_ALLOWLIST_ONLY=true needs GRAPHQL_PERSISTED_QUERIES")
+		}
+		return s, nil
+	}
+	persisted, err := loadPersistedQueries(path)
+	if err != nil {
+		s.Persisted = map[string]string{}
+		return s, fmt.Errorf("GRAPHQL_PERSISTED_QUERIES: %w", err)
+	}
+	s.Persisted = persisted
+	return s, nil
+}
+
+// loadPersistedQueries reads a persisted query file: a JSON object of documents by hash, or an
+// Apollo persisted query manifest ({"operations": [{"id": hash, "body": document}]}). Every hash
+// must be the hex SHA-256 of its document.
+func loadPersistedQueries(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Operations []struct {
+			ID   string `json:"id"`
+			Body string `json:"body"`
+		} `json:"operations"`
+	}
+	documents := make(map[string]string)
+	if err := json.Unmarshal(data, &manifest); err == nil && manifest.Operations != nil {
+		for _, operation := range manifest.Operations {
+			documents[operation.ID] = operation.Body
+		}
+	} else if err := json.Unmarshal(data, &documents); err != nil {
+		return nil, errors.New("must be a JSON object of documents by SHA-256 hash, or an Apollo persisted query manifest")
+	}
+
+	persisted := make(map[string]string, len(documents))
+	for hash, document := range documents {
+		if documentHash(document) != strings.ToLower(hash) {
+			return nil, fmt.Errorf("%q is not the SHA-256 hash of its document", hash)
+		}
+		persisted[strings.ToLower(hash)] = document
+	}
+	return persisted, nil
+}
+
+// active reports whether any protection applies.
+func (s GraphQLGuardSettings) active() bool {
+	return s.Persisted != nil || s.AllowlistOnly || s.MaxDepth > 0 || s.MaxComplexity > 0 ||
+		s.BlockAnonymousMutations || s.BlockIntrospection
+}
+
+// ConfigureGraphQLGuard sets the protections GraphQLGuard applies. InitGraphQLGuard calls it from
+// the environment; it is mainly useful in tests.
+func ConfigureGraphQLGuard(s GraphQLGuardSettings) {
+	graphQLGuardMu.Lock()
+	defer graphQLGuardMu.Unlock()
+	graphQLGuard = s
+}
+
+// GraphQLGuard applies the GraphQL protections (see InitGraphQLGuard) before GraphQLProxy. It
+// replaces a persisted query's hash with its document, so the proxy forwards the full query. cfg
+// validates the tokens of mutations. Requests it can't read are passed on for GraphQLProxy to
+// reject with the reason.
+func GraphQLGuard(cfg config.Auth) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		graphQLGuardMu.RLock()
+		settings := graphQLGuard
+		graphQLGuardMu.RUnlock()
+		if !settings.active() || c.Method() != fiber.MethodPost {
+			// GET requests are forwarded without their query string: queries are sent with POST
+			return c.Next()
+		}
+
+		// Step 1: Read the request
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(c.Body(), &fields); err != nil || fields == nil {
+			return c.Next()
+		}
+		var req struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+			Extensions    struct {
+				PersistedQuery struct {
+					SHA256Hash string `json:"sha256Hash"`
+				} `json:"persistedQuery"`
+			} `json:"extensions"`
+		}
+		_ = json.Unmarshal(c.Body(), &req) // Invalid fields are reported by the proxy's validation
+
+		// Step 2: Fill in a persisted query sent by hash
+		hash := strings.ToLower(req.Extensions.PersistedQuery.SHA256Hash)
+		if hash != "" && req.Query == "" {
+			document, ok := settings.Persisted[hash]
+			if !ok {
+				return rejectGraphQL(c, rejectUnknownPersisted, persistedQueryNotFound(c))
+			}
+			req.Query = document
+			fields["query"], _ = json.Marshal(document)
+			body, err := json.Marshal(fields)
+			if err != nil {
+				return apperror.Write(c, apperror.Internal(err))
+			}
+			c.Request().SetBody(body)
+		} else if hash != "" && documentHash(req.Query) != hash {
+			return rejectGraphQL(c, rejectInvalid, apperror.Write(c, apperror.BadRequest("persistedQuery sha256Hash does not match the query")))
+		}
+		if req.Query == "" {
+			return c.Next()
+		}
+
+		// Step 3: The allow-list
+		if settings.AllowlistOnly {
+			if _, ok := settings.Persisted[documentHash(req.Query)]; !ok {
+				return rejectGraphQL(c, rejectNotAllowed, apperror.Write(c, apperror.Forbidden("Query is not in the allow-list of persisted queries")))
+			}
+		}
+
+		// Step 4: The operation the request runs
+		doc, err := parseGraphQL(req.Query)
+		if err != nil {
+			return rejectGraphQL(c, rejectInvalid, apperror.Write(c, apperror.BadRequest("Invalid GraphQL query").With("details", []string{err.Error()})))
+		}
+		operation := doc.operation(req.OperationName)
+		if operation == nil {
+			return c.Next() // Supabase rejects it without running anything
+		}
+
+		// Step 5: Introspection, anonymous mutations, depth and complexity
+		if settings.BlockIntrospection && doc.selects(operation.selections, "__schema", "__type") {
+			return rejectGraphQL(c, rejectIntrospection, apperror.Write(c, apperror.Forbidden("GraphQL introspection is disabled")))
+		}
+		if settings.BlockAnonymousMutations && operation.kind == "mutation" && !signedIn(c, cfg) {
+			return rejectGraphQL(c, rejectAnonymousMutation, apperror.Write(c, apperror.Unauthorized("Sign in to run mutations")))
+		}
+		if settings.MaxDepth > 0 {
+			if depth := doc.depth(operation.selections); depth > settings.MaxDepth {
+				return rejectGraphQL(c, rejectDepth, apperror.Write(c, apperror.BadRequest(
+					fmt.Sprintf("Query is %d levels deep, the maximum is %d", depth, settings.MaxDepth)).
+					With("depth", depth).With("max_depth", settings.MaxDepth)))
+			}
+		}
+		if settings.MaxComplexity > 0 {
+			if complexity := doc.complexity(operation.selections, req.Variables); complexity > settings.MaxComplexity {
+				return rejectGraphQL(c, rejectComplexity, apperror.Write(c, apperror.BadRequest(
+					fmt.Sprintf("Query complexity is %d, the maximum is %d", complexity, settings.MaxComplexity)).
+					With("complexity", complexity).With("max_complexity", settings.MaxComplexity)))
+			}
+		}
+		return c.Next()
+	}
+}
+
+// rejectGraphQL counts a rejected request and returns the response's error.
+func rejectGraphQL(c *fiber.Ctx, reason string, err error) error {
+	metrics.GraphQLRejections.WithLabelValues(reason).Inc()
+	return err
+}
+
+// persistedQueryNotFound answers a hash that isn't persisted the way Apollo clients expect, with a
+// GraphQL error they react to by sending the full query.
+func persistedQueryNotFound(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"errors": []fiber.Map{{
+			"message":    "PersistedQueryNotFound",
+			"extensions": fiber.Map{"code": "PERSISTED_QUERY_NOT_FOUND"},
+		}},
+	})
+}
+
+// signedIn reports whether the request carries a valid token of a user (not the anon key).
+func signedIn(c *fiber.Ctx, cfg config.Auth) bool {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	_, _, err := middleware.UserFromToken(cfg, token)
+	return err == nil
+}
+
+// documentHash returns the hex SHA-256 of a GraphQL document, its persisted query ID.
+func documentHash(document string) string {
+	return hashHex(document)
+}
+
+// getGraphQLLimit reads a non-negative limit from the environment (0 disables it).
+func getGraphQLLimit(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		slog.Warn("Invalid "+name+", using the default", "value", value, "default", fallback)
+		return fallback
+	}
+	return limit
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseGraphQL_Measures tests depth, complexity and introspection detection, through
+// fragments, aliases, arguments and variables.
+func TestParseGraphQL_Measures(t *testing.T) {
+	doc, err := parseGraphQL(`
+		# Artists with their albums
+		query Artists($first: Int = 10, $filter: ArtistFilter) @cached {
+			top: artistsCollection(first: $first, filter: $filter, orderBy: [{name: AscNullsLast}]) {
+				edges { node { ...ArtistFields } }
+			}
+			__typename
+		}
+		fragment ArtistFields on Artist {
+			id
+			name(format: "long \"quoted\"")
+			albumsCollection(first: 5) { edges { node { id ... on Album { title } } } }
+		}
+		mutation Save { save(input: {tags: ["a", "b"], rating: 4.5, draft: false}) { id } }
+	`)
+	require.NoError(t, err)
+	require.Len(t, doc.operations, 2)
+	assert.Nil(t, doc.operation(""), "two operations and no operationName")
+
+	query := doc.operation("Artists")
+	require.NotNil(t, query)
+	assert.Equal(t, "query", query.kind)
+	assert.Equal(t, 7, doc.depth(query.selections))
+	// albums: 1 + 5 * (edges 1 + node (1 + id 1 + title 1)) = 21; artist node: 1 + id, name, albums 23 = 24
+	assert.Equal(t, 1+3*(1+24)+1, doc.complexity(query.selections, map[string]interface{}{"first": 3.0}))
+	assert.False(t, doc.selects(query.selections, "__schema", "__type"))
+	assert.Equal(t, "mutation", doc.operation("Save").kind)
+
+	introspection, err := parseGraphQL(`{ ...Types } fragment Types on Query { __schema { types { name } } }`)
+	require.NoError(t, err)
+	assert.True(t, introspection.selects(introspection.operation("").selections, "__schema", "__type"))
+
+	for _, document := range []string{"", "{ }", "{ a(b: ) }", `{ a(b: "unterminated) }`, "query { a", "subscription S", "{ a } }"} {
+		_, err := parseGraphQL(document)
+		assert.Error(t, err, document)
+	}
+}
+
+// TestParseGraphQL_FragmentCycle tests that fragments spreading themselves, and fragments spread
+// many times over, are measured without looping or blowing up.
+func TestParseGraphQL_FragmentCycle(t *testing.T) {
+	doc, err := parseGraphQL(`{ ...A } fragment A on Q { a { ...A } }
+		fragment B on Q { x: f { ...C } y: f { ...C } } fragment C on Q { x: g { ...D } y: g { ...D } }
+		fragment D on Q { leaf }`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, doc.depth(doc.operation("").selections))
+	assert.Equal(t, 3, doc.depth(doc.fragments["B"]))
+	assert.Equal(t, 2*(1+2*(1+1)), doc.complexity(doc.fragments["B"], nil))
+}
+
+// TestGraphQLGuard tests the allow-list, persisted queries sent by hash, the limits, anonymous
+// mutations and introspection.
+func TestGraphQLGuard(t *testing.T) {
+	_, calls := setupGraphQLCache(t, 0, nil)
+	auth := config.Auth{JWTSecret: "guard-secret"}
+	app := fiber.New()
+	app.All("/graphql", GraphQLGuard(auth), GraphQLProxy)
+
+	allowed := "query Artists { artists { id name } }"
+	hash := documentHash(allowed)
+	ConfigureGraphQLGuard(GraphQLGuardSettings{
+		Persisted:               map[string]string{hash: allowed, documentHash("mutation { save { id } }"): "mutation { save { id } }"},
+		AllowlistOnly:           true,
+		MaxDepth:                2,
+		BlockAnonymousMutations: true,
+		BlockIntrospection:      true,
+	})
+	t.Cleanup(func() { ConfigureGraphQLGuard(GraphQLGuardSettings{}) })
+
+	post := func(body string, headers map[string]string) int {
+		t.Helper()
+		resp, _ := postGraphQL(t, app, body, headers)
+		return resp.StatusCode
+	}
+	encode := func(query string) string {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		return string(body)
+	}
+
+	// Allow-listed documents, in full or by hash
+	assert.Equal(t, fiber.StatusOK, post(encode(allowed), nil))
+	assert.Equal(t, fiber.StatusOK, post(`{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"`+hash+`"}}}`, nil))
+	assert.EqualValues(t, 2, calls.Load())
+
+	// Unknown hashes get Apollo's error, other documents are refused
+	resp, _ := postGraphQL(t, app, `{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"abc"}}}`, nil)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Contains(t, body["errors"], map[string]interface{}{"message": "PersistedQueryNotFound", "extensions": map[string]interface{}{"code": "PERSISTED_QUERY_NOT_FOUND"}})
+	assert.Equal(t, fiber.StatusForbidden, post(encode("{ artists { id } }"), nil))
+	assert.EqualValues(t, 2, calls.Load())
+
+	// Without the allow-list: depth, introspection and anonymous mutations
+	ConfigureGraphQLGuard(GraphQLGuardSettings{MaxDepth: 2, BlockAnonymousMutations: true, BlockIntrospection: true})
+	assert.Equal(t, fiber.StatusBadRequest, post(encode("{ artists { albums { id } } }"), nil))
+	assert.Equal(t, fiber.StatusBadRequest, post(encode("{ artists { "), nil))
+	assert.Equal(t, fiber.StatusForbidden, post(encode("{ __schema { types } }"), nil))
+	assert.Equal(t, fiber.StatusOK, post(encode("{ artists { __typename } }"), nil))
+
+	mutation := encode("mutation { save { id } }")
+	assert.Equal(t, fiber.StatusUnauthorized, post(mutation, nil))
+	anon, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"role": "anon", "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte(auth.JWTSecret))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, post(mutation, map[string]string{"Authorization": "Bearer " + anon}))
+	user, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte(auth.JWTSecret))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, post(mutation, map[string]string{"Authorization": "Bearer " + user}))
+}
+
+// TestLoadPersistedQueries tests both file formats and that hashes must match their documents.
+func TestLoadPersistedQueries(t *testing.T) {
+	dir := t.TempDir()
+	document := "{ artists { id } }"
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+	encoded, _ := json.Marshal(document)
+
+	persisted, err := loadPersistedQueries(write("map.json", `{"`+documentHash(document)+`": `+string(encoded)+`}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{documentHash(document): document}, persisted)
+
+	persisted, err = loadPersistedQueries(write("manifest.json", `{"format":"apollo-persisted-query-manifest","version":1,"operations":[{"id":"`+documentHash(document)+`","name":"Artists","type":"query","body":`+string(encoded)+`}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{documentHash(document): document}, persisted)
+
+	_, err = loadPersistedQueries(write("wrong.json", `{"abc": `+string(encoded)+`}`))
+	assert.Error(t, err)
+}
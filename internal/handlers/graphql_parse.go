@@ -0,0 +1,622 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxGraphQLCost caps complexity scores, so nested list sizes can't overflow.
+const maxGraphQLCost = 1 << 40
+
+// gqlDocument is a parsed GraphQL document, reduced to what the guard checks: the shape of each
+// operation's selections and the int arguments sizing lists.
+type gqlDocument struct {
+	operations []gqlOperation
+	fragments  map[string][]gqlSelection
+}
+
+// gqlOperation is a query, mutation or subscription of a document.
+type gqlOperation struct {
+	kind, name string
+	selections []gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment.
+type gqlSelection struct {
+	field     string            // Field name; empty for fragments
+	arguments map[string]string // The field's Int literal and variable ("$first") arguments
+	spread    string            // Name of a spread fragment
+	children  []gqlSelection    // Selection set of a field or an inline fragment
+}
+
+// parseGraphQL parses a GraphQL document. It checks the syntax, not the schema.
+func parseGraphQL(document string) (*gqlDocument, error) {
+	p := &gqlParser{lexer: gqlLexer{src: document}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &gqlDocument{fragments: make(map[string][]gqlSelection)}
+	for p.token.kind != gqlEOF {
+		if err := p.definition(doc); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, errors.New("the document has no operation")
+	}
+	return doc, nil
+}
+
+// operation returns the operation named name, else the document's only operation. It returns
+// nil when there is no such operation, or several without a name to choose.
+func (d *gqlDocument) operation(name string) *gqlOperation {
+	var selected *gqlOperation
+	for i := range d.operations {
+		op := &d.operations[i]
+		if name != "" && op.name != name {
+			continue
+		}
+		if selected != nil {
+			return nil
+		}
+		selected = op
+	}
+	return selected
+}
+
+// depth returns how deeply fields nest in selections (1 for fields without a selection set).
+// Fragments count as the fields they contain.
+func (d *gqlDocument) depth(selections []gqlSelection) int {
+	return d.measure(selections, make(map[string]int), make(map[string]bool), func(s gqlSelection, children int) int {
+		return 1 + children
+	}, maxInt)
+}
+
+// complexity scores selections: every field costs 1, plus the cost of its selection set
+// multiplied by its first or last argument (the page size of a list, read from variables when
+// it is one), so a list of 100 items with 3 fields costs 301.
+func (d *gqlDocument) complexity(selections []gqlSelection, variables map[string]interface{}) int {
+	return d.measure(selections, make(map[string]int), make(map[string]bool), func(s gqlSelection, children int) int {
+		multiplier := 1
+		for _, argument := range []string{"first", "last"} {
+			if size, ok := listSize(s.arguments[argument], variables); ok {
+				multiplier = max(multiplier, size)
+			}
+		}
+		return min(1+multiplier*children, maxGraphQLCost)
+	}, func(a, b int) int { return min(a+b, maxGraphQLCost) })
+}
+
+// measure folds selections: field scores a field from its children's result, and combine merges
+// the results of sibling selections. Fragments are measured once (memo); fragments spread inside
+// themselves count as empty.
+func (d *gqlDocument) measure(selections []gqlSelection, memo map[string]int, visiting map[string]bool,
+	field func(s gqlSelection, children int) int, combine func(a, b int) int) int {
+	total := 0
+	for _, s := range selections {
+		var result int
+		switch {
+		case s.spread != "":
+			if cached, ok := memo[s.spread]; ok {
+				result = cached
+			} else if !visiting[s.spread] {
+				visiting[s.spread] = true
+				result = d.measure(d.fragments[s.spread], memo, visiting, field, combine)
+				visiting[s.spread] = false
+				memo[s.spread] = result
+			}
+		case s.field == "":
+			result = d.measure(s.children, memo, visiting, field, combine)
+		default:
+			result = field(s, d.measure(s.children, memo, visiting, field, combine))
+		}
+		total = combine(total, result)
+	}
+	return total
+}
+
+// selects reports whether selections select one of names, at any depth.
+func (d *gqlDocument) selects(selections []gqlSelection, names ...string) bool {
+	return d.measure(selections, make(map[string]int), make(map[string]bool), func(s gqlSelection, children int) int {
+		for _, name := range names {
+			if s.field == name {
+				return 1
+			}
+		}
+		return children
+	}, maxInt) > 0
+}
+
+// maxInt returns the larger of a and b.
+func maxInt(a, b int) int {
+	return max(a, b)
+}
+
+// listSize reads a page size argument: an Int literal or a variable holding a number.
+func listSize(value string, variables map[string]interface{}) (int, bool) {
+	if name, ok := strings.CutPrefix(value, "$"); ok {
+		size, ok := variables[name].(float64)
+		if !ok || size < 0 {
+			return 0, false
+		}
+		return int(min(size, maxGraphQLCost)), true
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return min(size, maxGraphQLCost), true
+}
+
+// gqlParser is a recursive descent parser of GraphQL documents.
+type gqlParser struct {
+	lexer gqlLexer
+	token gqlToken
+}
+
+// advance reads the next token.
+func (p *gqlParser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+// is reports whether the current token is the punctuator or name value.
+func (p *gqlParser) is(kind gqlTokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+// expect consumes the punctuator or name value, failing on anything else.
+func (p *gqlParser) expect(kind gqlTokenKind, value string) error {
+	if !p.is(kind, value) {
+		return p.unexpected("expected " + strconv.Quote(value))
+	}
+	return p.advance()
+}
+
+// name consumes a name and returns it.
+func (p *gqlParser) name() (string, error) {
+	if p.token.kind != gqlName {
+		return "", p.unexpected("expected a name")
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+// unexpected returns a syntax error at the current token.
+func (p *gqlParser) unexpected(reason string) error {
+	if p.token.kind == gqlEOF {
+		return fmt.Errorf("syntax error at the end of the document: %s", reason)
+	}
+	return fmt.Errorf("syntax error at offset %d (%q): %s", p.token.offset, p.token.value, reason)
+}
+
+// definition parses an operation or a fragment definition.
+func (p *gqlParser) definition(doc *gqlDocument) error {
+	if p.is(gqlPunctuator, "{") {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return err
+		}
+		doc.operations = append(doc.operations, gqlOperation{kind: "query", selections: selections})
+		return nil
+	}
+	if p.token.kind != gqlName {
+		return p.unexpected("expected an operation or a fragment")
+	}
+
+	switch kind := p.token.value; kind {
+	case "fragment":
+		if err := p.advance(); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(gqlName, "on"); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if err := p.directives(); err != nil {
+			return err
+		}
+		selections, err := p.selectionSet()
+		if err != nil {
+			return err
+		}
+		doc.fragments[name] = selections
+		return nil
+	case "query", "mutation", "subscription":
+		if err := p.advance(); err != nil {
+			return err
+		}
+		op := gqlOperation{kind: kind}
+		if p.token.kind == gqlName {
+			op.name = p.token.value
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+		if err := p.variableDefinitions(); err != nil {
+			return err
+		}
+		if err := p.directives(); err != nil {
+			return err
+		}
+		selections, err := p.selectionSet()
+		if err != nil {
+			return err
+		}
+		op.selections = selections
+		doc.operations = append(doc.operations, op)
+		return nil
+	default:
+		return p.unexpected("expected an operation or a fragment")
+	}
+}
+
+// variableDefinitions parses an operation's optional ($name: Type = default, ...).
+func (p *gqlParser) variableDefinitions() error {
+	if !p.is(gqlPunctuator, "(") {
+		return nil
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	for !p.is(gqlPunctuator, ")") {
+		if err := p.expect(gqlPunctuator, "$"); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if err := p.expect(gqlPunctuator, ":"); err != nil {
+			return err
+		}
+		if err := p.typeReference(); err != nil {
+			return err
+		}
+		if p.is(gqlPunctuator, "=") {
+			if err := p.advance(); err != nil {
+				return err
+			}
+			if _, err := p.value(); err != nil {
+				return err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return err
+		}
+	}
+	return p.advance()
+}
+
+// typeReference parses a type: Name, [Type], either followed by "!".
+func (p *gqlParser) typeReference() error {
+	if p.is(gqlPunctuator, "[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.typeReference(); err != nil {
+			return err
+		}
+		if err := p.expect(gqlPunctuator, "]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.is(gqlPunctuator, "!") {
+		return p.advance()
+	}
+	return nil
+}
+
+// directives parses optional @name(arguments) directives.
+func (p *gqlParser) directives() error {
+	for p.is(gqlPunctuator, "@") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if _, err := p.arguments(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectionSet parses { selections }.
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect(gqlPunctuator, "{"); err != nil {
+		return nil, err
+	}
+	var selections []gqlSelection
+	for !p.is(gqlPunctuator, "}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, p.unexpected("empty selection set")
+	}
+	return selections, p.advance()
+}
+
+// selection parses a field, a fragment spread (...Name) or an inline fragment (... on Type { }).
+func (p *gqlParser) selection() (gqlSelection, error) {
+	if p.is(gqlPunctuator, "...") {
+		if err := p.advance(); err != nil {
+			return gqlSelection{}, err
+		}
+		if p.token.kind == gqlName && p.token.value != "on" {
+			name := p.token.value
+			if err := p.advance(); err != nil {
+				return gqlSelection{}, err
+			}
+			return gqlSelection{spread: name}, p.directives()
+		}
+		if p.is(gqlName, "on") {
+			if err := p.advance(); err != nil {
+				return gqlSelection{}, err
+			}
+			if _, err := p.name(); err != nil {
+				return gqlSelection{}, err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return gqlSelection{}, err
+		}
+		children, err := p.selectionSet()
+		return gqlSelection{children: children}, err
+	}
+
+	// Field: [alias:] name [(arguments)] [directives] [{ selections }]
+	name, err := p.name()
+	if err != nil {
+		return gqlSelection{}, err
+	}
+	if p.is(gqlPunctuator, ":") {
+		if err := p.advance(); err != nil {
+			return gqlSelection{}, err
+		}
+		if name, err = p.name(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	selection := gqlSelection{field: name}
+	if selection.arguments, err = p.arguments(); err != nil {
+		return gqlSelection{}, err
+	}
+	if err := p.directives(); err != nil {
+		return gqlSelection{}, err
+	}
+	if p.is(gqlPunctuator, "{") {
+		if selection.children, err = p.selectionSet(); err != nil {
+			return gqlSelection{}, err
+		}
+	}
+	return selection, nil
+}
+
+// arguments parses optional (name: value, ...), returning the Int literal and variable values.
+func (p *gqlParser) arguments() (map[string]string, error) {
+	if !p.is(gqlPunctuator, "(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	arguments := make(map[string]string)
+	for !p.is(gqlPunctuator, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(gqlPunctuator, ":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			arguments[name] = value
+		}
+	}
+	return arguments, p.advance()
+}
+
+// value parses a value. It returns Int literals and variables ("$name"), and "" for the others.
+func (p *gqlParser) value() (string, error) {
+	token := p.token
+	switch {
+	case p.is(gqlPunctuator, "$"):
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		name, err := p.name()
+		return "$" + name, err
+	case p.is(gqlPunctuator, "["):
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		for !p.is(gqlPunctuator, "]") {
+			if _, err := p.value(); err != nil {
+				return "", err
+			}
+		}
+		return "", p.advance()
+	case p.is(gqlPunctuator, "{"):
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		for !p.is(gqlPunctuator, "}") {
+			if _, err := p.name(); err != nil {
+				return "", err
+			}
+			if err := p.expect(gqlPunctuator, ":"); err != nil {
+				return "", err
+			}
+			if _, err := p.value(); err != nil {
+				return "", err
+			}
+		}
+		return "", p.advance()
+	case token.kind == gqlInt:
+		return token.value, p.advance()
+	case token.kind == gqlFloat, token.kind == gqlString, token.kind == gqlName:
+		return "", p.advance() // Floats, strings, booleans, null and enum values
+	default:
+		return "", p.unexpected("expected a value")
+	}
+}
+
+// gqlTokenKind is the kind of a lexical token.
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunctuator
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+// gqlToken is a lexical token and where it starts in the document.
+type gqlToken struct {
+	kind   gqlTokenKind
+	value  string
+	offset int
+}
+
+// gqlLexer splits a GraphQL document into tokens, skipping whitespace, commas and comments.
+type gqlLexer struct {
+	src string
+	pos int
+}
+
+// next returns the next token (gqlEOF at the end of the document).
+func (l *gqlLexer) next() (gqlToken, error) {
+	// Step 1: Skip ignored characters: whitespace, commas, comments and a byte order mark
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ',' {
+			l.pos++
+		} else if ch == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		} else if strings.HasPrefix(l.src[l.pos:], "\uFEFF") {
+			l.pos += len("\uFEFF")
+		} else {
+			break
+		}
+	}
+	start := l.pos
+	if start >= len(l.src) {
+		return gqlToken{kind: gqlEOF, offset: start}, nil
+	}
+
+	// Step 2: Read the token
+	ch := l.src[start]
+	switch {
+	case strings.HasPrefix(l.src[start:], "..."):
+		l.pos += 3
+		return gqlToken{kind: gqlPunctuator, value: "...", offset: start}, nil
+	case strings.IndexByte("!$&()=:@[]{}|", ch) >= 0:
+		l.pos++
+		return gqlToken{kind: gqlPunctuator, value: string(ch), offset: start}, nil
+	case isNameStart(ch):
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return gqlToken{kind: gqlName, value: l.src[start:l.pos], offset: start}, nil
+	case ch == '-' || ch >= '0' && ch <= '9':
+		return l.number(start)
+	case ch == '"':
+		return l.string(start)
+	default:
+		return gqlToken{}, fmt.Errorf("syntax error at offset %d: unexpected character %q", start, ch)
+	}
+}
+
+// number reads an Int or a Float.
+func (l *gqlLexer) number(start int) (gqlToken, error) {
+	digits := func() int {
+		from := l.pos
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+		}
+		return l.pos - from
+	}
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if digits() == 0 {
+		return gqlToken{}, fmt.Errorf("syntax error at offset %d: invalid number", start)
+	}
+	kind := gqlInt
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		kind = gqlFloat
+		if digits() == 0 {
+			return gqlToken{}, fmt.Errorf("syntax error at offset %d: invalid number", start)
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		kind = gqlFloat
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if digits() == 0 {
+			return gqlToken{}, fmt.Errorf("syntax error at offset %d: invalid number", start)
+		}
+	}
+	if l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || l.src[l.pos] == '.') {
+		return gqlToken{}, fmt.Errorf("syntax error at offset %d: invalid number", start)
+	}
+	return gqlToken{kind: kind, value: l.src[start:l.pos], offset: start}, nil
+}
+
+// string reads a "string" or a """block string""". Its value is not decoded: only its extent
+// matters to the guard.
+func (l *gqlLexer) string(start int) (gqlToken, error) {
+	if strings.HasPrefix(l.src[start:], `"""`) {
+		for l.pos = start + 3; l.pos < len(l.src); l.pos++ {
+			if strings.HasPrefix(l.src[l.pos:], `\"""`) {
+				l.pos += 3
+			} else if strings.HasPrefix(l.src[l.pos:], `"""`) {
+				l.pos += 3
+				return gqlToken{kind: gqlString, value: l.src[start:l.pos], offset: start}, nil
+			}
+		}
+		return gqlToken{}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+	}
+	for l.pos = start + 1; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '\n', '\r':
+			return gqlToken{}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+		case '"':
+			l.pos++
+			return gqlToken{kind: gqlString, value: l.src[start:l.pos], offset: start}, nil
+		}
+	}
+	return gqlToken{}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxQueryLength is the longest GraphQL query (in bytes) accepted when
+// GRAPHQL_MAX_QUERY_LENGTH is not set.
+const defaultMaxQueryLength = 10000
+
+// validateGraphQLRequest checks that a GraphQL request body is a JSON object with a non-empty
+// string query of at most maxQueryLength bytes (0 for no limit), and, when present, object
+// variables and a string operationName. It returns every problem found (none if the body is valid).
+func validateGraphQLRequest(body []byte, maxQueryLength int) []string {
+	// Step 1: The body must be a JSON object
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return []string{"body must be a JSON object"}
+	}
+
+	var details []string
+
+	// Step 2: query is a required, non-empty string within the length limit
+	var query string
+	if raw, ok := fields["query"]; !ok || isJSONNull(raw) {
+		details = append(details, "query is required")
+	} else if err := json.Unmarshal(raw, &query); err != nil {
+		details = append(details, "query must be a string")
+	} else if strings.TrimSpace(query) == "" {
+		details = append(details, "query must not be empty")
+	} else if maxQueryLength > 0 && len(query) > maxQueryLength {
+		details = append(details, fmt.Sprintf("query is %d bytes long, the maximum is %d", len(query), maxQueryLength))
+	}
+
+	// Step 3: variables, if any, is an object
+	if raw, ok := fields["variables"]; ok && !isJSONNull(raw) {
+		var variables map[string]interface{}
+		if err := json.Unmarshal(raw, &variables); err != nil {
+			details = append(details, "variables must be an object")
+		}
+	}
+
+	// Step 4: operationName, if any, is a string
+	if raw, ok := fields["operationName"]; ok && !isJSONNull(raw) {
+		var operationName string
+		if err := json.Unmarshal(raw, &operationName); err != nil {
+			details = append(details, "operationName must be a string")
+		}
+	}
+
+	return details
+}
+
+// isJSONNull reports whether raw is the JSON literal null.
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// getMaxQueryLength returns GRAPHQL_MAX_QUERY_LENGTH, the longest query in bytes forwarded to
+// Supabase (default 10000, 0 disables the limit).
+func getMaxQueryLength() int {
+	value := os.Getenv("GRAPHQL_MAX_QUERY_LENGTH")
+	if value == "" {
+		return defaultMaxQueryLength
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		slog.Warn("Invalid GRAPHQL_MAX_QUERY_LENGTH, using the default", "value", value, "default", defaultMaxQueryLength)
+		return defaultMaxQueryLength
+	}
+	return length
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"boilerplate/internal/logging"
+	"boilerplate/internal/plan"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPlan returns the current user's plan with its features and quotas, and how much of each
+// quota is used (GET /api/plan). plan is null when plans are not enforced.
+func GetPlan(c *fiber.Ctx) error {
+	p, err := plan.Resolve(c)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to resolve plan", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load plan",
+		})
+	}
+	if p == nil {
+		return c.JSON(fiber.Map{"plan": nil})
+	}
+
+	userID, _ := c.Locals("user").(string)
+	response := fiber.Map{
+		"plan":     p.Name,
+		"features": p.Features,
+		"quotas": fiber.Map{
+			"daily_requests":   p.DailyRequests,
+			"monthly_requests": p.MonthlyRequests,
+		},
+	}
+
+	// Usage is informative here; the plan is still returned when the counters are unavailable
+	day, month, err := usage.Current(tenant.ID(c), userID)
+	if err != nil {
+		logging.FromRequest(c).Warn("Failed to read usage counters", "error", err)
+	} else {
+		response["usage"] = fiber.Map{
+			"day":   day.Count,
+			"month": month.Count,
+		}
+	}
+
+	if plan.DefaultStore != nil {
+		subscription, err := plan.DefaultStore.Get(c.UserContext(), userID)
+		if err != nil {
+			logging.FromRequest(c).Warn("Failed to load subscription", "error", err)
+		} else if subscription != nil {
+			response["subscription"] = fiber.Map{
+				"plan":               subscription.Plan,
+				"status":             subscription.Status,
+				"current_period_end": subscription.CurrentPeriodEnd,
+			}
+		}
+	}
+	return c.JSON(response)
+}
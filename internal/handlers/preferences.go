@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"sort"
+
+	"boilerplate/internal/logging"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPreferences returns every preference of the current user, defaults included (GET /api/preferences).
+func GetPreferences(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	values, err := preferences.Get(c.UserContext(), tenant.ID(c), userID)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to load preferences", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load preferences",
+		})
+	}
+	return c.JSON(fiber.Map{"preferences": values})
+}
+
+// UpdatePreferences changes some preferences of the current user and keeps the others
+// (PUT /api/preferences). A null value resets a preference to its default. The user's other
+// connections (WebSocket clients that connected with ?token=) receive a "preferences" message.
+func UpdatePreferences(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	var changes map[string]interface{}
+	if err := json.NewDecoder(bytes.NewReader(c.Body())).Decode(&changes); err != nil || changes == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Body must be a JSON object of preference keys and values",
+		})
+	}
+
+	values, err := preferences.Set(c.UserContext(), tenant.ID(c), userID, changes)
+	if err != nil {
+		return profileError(c, err, "Failed to update preferences")
+	}
+	publishPreferences(userID, values, sortedKeys(changes))
+	return c.JSON(fiber.Map{"preferences": values})
+}
+
+// PreferenceSchema lists the allowed preference keys with their type and default
+// (GET /api/preferences/schema).
+func PreferenceSchema(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"settings": preferences.Schema()})
+}
+
+// publishPreferences pushes the user's preferences and the keys that changed to their WebSocket
+// connections, so their other devices apply the change without polling.
+func publishPreferences(userID string, values map[string]interface{}, changed []string) {
+	message, err := json.Marshal(fiber.Map{"preferences": values, "changed": changed})
+	if err != nil {
+		slog.Warn("Failed to encode preferences message", "user_id", userID, "error", err)
+		return
+	}
+	GetHub().PublishToUser(userID, MessageTypePreferences, message)
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
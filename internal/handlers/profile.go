@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"boilerplate/internal/logging"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/profile"
+	"boilerplate/internal/storage"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/version"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetProfile returns the current user and their profile (GET /api/profile).
+// v1 returns the bare user ID, v2 a user object; both carry the profile alongside. The ETag is
+// the profile's version.
+func GetProfile(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	stored, err := profile.Get(c.UserContext(), tenant.ID(c), userID)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to load profile", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to load profile",
+		})
+	}
+	setETag(c, stored.Version)
+	return c.JSON(profileResponse(c, stored))
+}
+
+// UpdateProfile updates the current user's display name and/or preferences (PUT /api/profile).
+// Omitted fields are left unchanged; preferences replace the stored object as a whole and are
+// checked against the preference schema (see internal/preferences).
+//
+// With If-Match set to the ETag of a previous response, the update is rejected with 409 and the
+// current profile if it changed in the meantime.
+func UpdateProfile(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+	version, ok := ifMatch(c, profile.AnyVersion)
+	if !ok {
+		return badIfMatch(c)
+	}
+
+	var update profile.Update
+	decoder := json.NewDecoder(bytes.NewReader(c.Body()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Body must be a JSON object with display_name and/or preferences",
+		})
+	}
+
+	if update.Preferences != nil {
+		if err := preferences.Validate(update.Preferences); err != nil {
+			return profileError(c, err, "Failed to update profile")
+		}
+	}
+
+	updated, err := profile.Apply(c.UserContext(), tenant.ID(c), userID, update, version)
+	if err != nil {
+		return profileError(c, err, "Failed to update profile")
+	}
+	if update.Preferences != nil {
+		// The object was replaced, so any key may have changed
+		values := preferences.Resolve(updated.Preferences)
+		publishPreferences(userID, values, sortedKeys(values))
+	}
+	setETag(c, updated.Version)
+	return c.JSON(profileResponse(c, updated))
+}
+
+// UploadAvatar sets the current user's avatar (PUT /api/profile/avatar). The body is the raw
+// image, with its Content-Type (PNG, JPEG, WebP or GIF, up to 2 MB).
+func UploadAvatar(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	// Copied: fiber reuses the request buffer once the handler returns
+	contentType := strings.TrimSpace(strings.Split(string(c.Request().Header.ContentType()), ";")[0])
+	data := append([]byte(nil), c.Body()...)
+
+	updated, err := profile.SetAvatar(c.UserContext(), tenant.ID(c), userID, contentType, data)
+	if err != nil {
+		return profileError(c, err, "Failed to upload avatar")
+	}
+	setETag(c, updated.Version)
+	return c.JSON(profileResponse(c, updated))
+}
+
+// profileResponse serializes the user and profile in the request's API version.
+func profileResponse(c *fiber.Ctx, stored *profile.Profile) fiber.Map {
+	serialize := version.Pick(c, map[int]func() fiber.Map{
+		1: func() fiber.Map {
+			return fiber.Map{"user": c.Locals("user"), "profile": stored}
+		},
+		2: func() fiber.Map {
+			user := fiber.Map{"id": c.Locals("user")}
+			if tenantID := tenant.ID(c); tenantID != "" {
+				user["tenant_id"] = tenantID
+			}
+			return fiber.Map{"user": user, "profile": stored}
+		},
+	})
+	return serialize()
+}
+
+// profileError maps profile errors to responses: 422 with the field for validation errors,
+// 409 with the current profile for version conflicts, 503 when storage is missing or failed.
+func profileError(c *fiber.Ctx, err error, message string) error {
+	var invalid *profile.ValidationError
+	var conflict *profile.ConflictError
+	switch {
+	case errors.As(err, &invalid):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": invalid.Field + " " + invalid.Message,
+			"field": invalid.Field,
+		})
+	case errors.As(err, &conflict):
+		setETag(c, conflict.Current.Version)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":           "Profile was changed by another request",
+			"current_version": conflict.Current.Version,
+			"current":         conflict.Current,
+		})
+	case errors.Is(err, storage.ErrNotConfigured):
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Avatar uploads are not configured",
+		})
+	default:
+		logging.FromRequest(c).Error(message, "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+}
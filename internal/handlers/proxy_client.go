@@ -0,0 +1,141 @@
+package handlers
+
+// The HTTP client of the Supabase proxies.
+//
+// GraphQLProxy and RESTProxy share one client, built once by InitProxy: a pool of keep-alive
+// connections to Supabase (PROXY_MAX_IDLE_CONNS, PROXY_MAX_CONNS) so busy instances don't pay a
+// TCP and TLS handshake per request, and timeouts on every step (dial, TLS handshake, response
+// headers, whole request) so a hung upstream answers 502 instead of tying up the request.
+//
+// Idempotent requests (GraphQL queries, REST GET and HEAD) can be retried when Supabase can't be
+// reached or answers 502, 503 or 504 (PROXY_RETRIES), with exponential backoff from
+// PROXY_RETRY_BACKOFF. Mutations are never retried: Supabase may have applied them already.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+)
+
+// proxyKeepAlive is the TCP keep-alive period of proxy connections.
+const proxyKeepAlive = 30 * time.Second
+
+var (
+	// proxyClient is the HTTP client used to reach Supabase (restricted to allowed hosts, see
+	// egress). Tests replace it (see SetProxyClient) to record or replay upstream traffic.
+	proxyClient = egress.NewClient(0)
+
+	// defaultProxyClient is the client SetProxyClient(nil) restores: InitProxy's, if it was called.
+	defaultProxyClient = proxyClient
+
+	// proxyRetries and proxyRetryBackoff are PROXY_RETRIES and PROXY_RETRY_BACKOFF.
+	proxyRetries      = 0
+	proxyRetryBackoff = 100 * time.Millisecond
+)
+
+// InitProxy builds the HTTP client of the GraphQL and REST proxies from cfg.
+func InitProxy(cfg config.Proxy) {
+	defaultProxyClient = NewProxyClient(cfg)
+	proxyClient = defaultProxyClient
+	proxyRetries, proxyRetryBackoff = cfg.Retries, cfg.RetryBackoff
+
+	maxConns := "unlimited"
+	if cfg.MaxConns > 0 {
+		maxConns = fmt.Sprint(cfg.MaxConns)
+	}
+	startup.Report("proxy", true, fmt.Sprintf("%d idle / %s connections, response timeout %s, timeout %s, %d retries",
+		cfg.MaxIdleConns, maxConns, cfg.ResponseTimeout, cfg.Timeout, cfg.Retries))
+}
+
+// NewProxyClient returns an HTTP client with the connection pool and timeouts of cfg, restricted
+// to the allowed hosts (see egress).
+func NewProxyClient(cfg config.Proxy) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: proxyKeepAlive}
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DialContext:       dialer.DialContext,
+		ForceAttemptHTTP2: true,
+		// Every request goes to the one Supabase host, so the whole pool may go to it
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConns,
+		MaxConnsPerHost:       cfg.MaxConns,
+		IdleConnTimeout:       cfg.IdleTimeout,
+		TLSHandshakeTimeout:   cfg.TLSTimeout,
+		ResponseHeaderTimeout: cfg.ResponseTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	client := egress.NewClient(cfg.Timeout)
+	client.Transport = &egress.Transport{Base: transport}
+	return client
+}
+
+// SetProxyClient replaces the HTTP client used by GraphQLProxy and RESTProxy.
+// Passing nil restores the default client.
+func SetProxyClient(client *http.Client) {
+	if client == nil {
+		client = defaultProxyClient
+	}
+	proxyClient = client
+}
+
+// doWithRetries sends req, retrying it up to PROXY_RETRIES times if idempotent while Supabase
+// can't be reached or answers 502, 503 or 504. Retries resend the body from req.GetBody. The
+// request's context cancels the wait between attempts.
+func doWithRetries(logger *slog.Logger, req *http.Request, idempotent bool) (*http.Response, error) {
+	client, retries, backoff := proxyClient, proxyRetries, proxyRetryBackoff
+	if !idempotent || (req.Body != nil && req.GetBody == nil) {
+		retries = 0
+	}
+
+	attempt := req
+	for i := 0; ; i++ {
+		resp, err := client.Do(attempt)
+		if i >= retries || !retryable(resp, err) {
+			return resp, err
+		}
+		wait := backoff << i
+		if resp != nil {
+			logger.Warn("Supabase unavailable, retrying", "upstream_status", resp.StatusCode, "attempt", i+1, "wait", wait.String())
+			io.Copy(io.Discard, resp.Body) // So the connection goes back to the pool
+			resp.Body.Close()
+		} else {
+			logger.Warn("Failed to reach Supabase, retrying", "error", err, "attempt", i+1, "wait", wait.String())
+		}
+		metrics.SupabaseProxyRetries.Inc()
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		attempt = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if attempt.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryable reports whether a failed attempt may succeed when retried: the request didn't reach
+// Supabase, or a gateway in front of it failed.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, egress.ErrBlocked) // Blocked requests stay blocked
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
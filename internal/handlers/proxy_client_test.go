@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProxyConfig is a proxy configuration with short timeouts and two retries.
+var testProxyConfig = config.Proxy{
+	MaxIdleConns: 4, IdleTimeout: time.Minute, DialTimeout: time.Second, TLSTimeout: time.Second,
+	ResponseTimeout: 200 * time.Millisecond, Timeout: time.Second, Retries: 2, RetryBackoff: time.Millisecond,
+}
+
+// flakySupabase answers 503 to the first failures requests, then echoes the request body.
+func flakySupabase(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("SUPABASE_URL", server.URL)
+	return server, &requests
+}
+
+// useProxy installs a proxy client built from cfg for the test.
+func useProxy(t *testing.T, cfg config.Proxy) {
+	client, defaultClient, retries, backoff := proxyClient, defaultProxyClient, proxyRetries, proxyRetryBackoff
+	t.Cleanup(func() {
+		proxyClient, defaultProxyClient, proxyRetries, proxyRetryBackoff = client, defaultClient, retries, backoff
+	})
+	InitProxy(cfg)
+}
+
+// proxyGraphQL sends a GraphQL document to GraphQLProxy.
+func proxyGraphQL(t *testing.T, document string) *http.Response {
+	app := fiber.New()
+	app.Post("/graphql", GraphQLProxy)
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "`+document+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, 5000)
+	require.NoError(t, err)
+	return resp
+}
+
+// TestGraphQLProxy_RetriesQueries tests that queries are retried with their body on 503, and
+// mutations are not.
+func TestGraphQLProxy_RetriesQueries(t *testing.T) {
+	useProxy(t, testProxyConfig)
+
+	_, requests := flakySupabase(t, 2)
+	resp := proxyGraphQL(t, "{ artists { id } }")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"query": "{ artists { id } }"}`, string(body))
+	assert.Equal(t, int32(3), requests.Load())
+
+	_, requests = flakySupabase(t, 3)
+	resp = proxyGraphQL(t, "{ artists { id } }")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode) // Out of retries
+	assert.Equal(t, int32(3), requests.Load())
+
+	_, requests = flakySupabase(t, 1)
+	resp = proxyGraphQL(t, "mutation { deleteArtist(id: 1) { id } }")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+// TestGraphQLProxy_ResponseTimeout tests that an upstream that doesn't answer gets a 502.
+func TestGraphQLProxy_ResponseTimeout(t *testing.T) {
+	cfg := testProxyConfig
+	cfg.Retries = 0
+	useProxy(t, cfg)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	t.Setenv("SUPABASE_URL", server.URL)
+
+	start := time.Now()
+	resp := proxyGraphQL(t, "{ artists { id } }")
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// TestNewProxyClient tests that the client reuses its connections.
+func TestNewProxyClient(t *testing.T) {
+	client := NewProxyClient(testProxyConfig)
+	assert.Equal(t, time.Second, client.Timeout)
+
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(1), connections.Load())
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+
+	"boilerplate/internal/logging"
+	"boilerplate/internal/push"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeviceRequest is the body of POST /api/push/devices.
+type DeviceRequest struct {
+	Token    string `json:"token" validate:"required,max=4096"`
+	Platform string `json:"platform" validate:"required,oneof=android ios web"`
+}
+
+// RegisterDevice saves a push notification token of the current user's device
+// (POST /api/push/devices). Apps call it on every start, since tokens rotate; a token already
+// registered (by this or another user) moves to this user.
+func RegisterDevice(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	body, err := validation.BindAndValidate[DeviceRequest](c)
+	if err != nil {
+		return validation.Respond(c, err)
+	}
+
+	device := push.Device{Token: body.Token, Platform: body.Platform, UserID: userID, TenantID: tenant.ID(c)}
+	if err := push.Register(c.UserContext(), device); err != nil {
+		return pushError(c, err, "Failed to register device")
+	}
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// UnregisterDevice deletes a push notification token of the current user
+// (DELETE /api/push/devices/:token), e.g. on sign-out. Unknown tokens are ignored.
+func UnregisterDevice(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	if err := push.Get().Unregister(c.UserContext(), userID, c.Params("token")); err != nil {
+		return pushError(c, err, "Failed to unregister device")
+	}
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// ListDevices returns the current user's registered devices (GET /api/push/devices).
+func ListDevices(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+
+	devices, err := push.Get().Devices(c.UserContext(), tenant.ID(c), userID)
+	if err != nil {
+		return pushError(c, err, "Failed to load devices")
+	}
+	return c.JSON(fiber.Map{"devices": devices})
+}
+
+// pushError maps a push error to its response: 422 for invalid devices, 503 otherwise.
+func pushError(c *fiber.Ctx, err error, message string) error {
+	if errors.Is(err, push.ErrInvalidDevice) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	logging.FromRequest(c).Error(message, "error", err)
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"boilerplate/internal/audit"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/resource"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ResourceHandlers serves the endpoints of a resource (see internal/resource). Owned resources
+// act on the current user's rows; shared ones on the tenant's, and their writes (admin only) are
+// written to the audit log.
+type ResourceHandlers struct {
+	resource *resource.Resource
+}
+
+// NewResourceHandlers creates the handlers of a resource.
+func NewResourceHandlers(r *resource.Resource) *ResourceHandlers {
+	return &ResourceHandlers{resource: r}
+}
+
+// List returns a page of rows, newest first.
+//
+// Query parameters: page (default 1), limit (default 50, max 200), deleted=true for the trash.
+func (h *ResourceHandlers) List(c *fiber.Ctx) error {
+	page, limit := c.QueryInt("page", 1), c.QueryInt("limit", resource.DefaultPageSize)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > resource.MaxPageSize {
+		limit = resource.DefaultPageSize
+	}
+
+	records, hasMore, err := h.resource.List(c.UserContext(), owner(c), c.QueryBool("deleted"), page, limit)
+	if err != nil {
+		return h.error(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"items":    records,
+		"page":     page,
+		"limit":    limit,
+		"has_more": hasMore,
+	})
+}
+
+// Get returns one live row. The ETag is its version.
+func (h *ResourceHandlers) Get(c *fiber.Ctx) error {
+	record, err := h.resource.Get(c.UserContext(), owner(c), c.Params("id"))
+	if err != nil {
+		return h.error(c, err)
+	}
+	setETag(c, record.Version())
+	return c.JSON(record)
+}
+
+// Create adds a row and returns it with 201.
+func (h *ResourceHandlers) Create(c *fiber.Ctx) error {
+	input, ok := decodeObject(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Body must be a JSON object",
+		})
+	}
+
+	record, err := h.resource.Create(c.UserContext(), owner(c), input)
+	if err != nil {
+		return h.error(c, err)
+	}
+	h.audit(c, "create", record.ID(), nil, record)
+	setETag(c, record.Version())
+	return c.Status(fiber.StatusCreated).JSON(record)
+}
+
+// Update changes the fields present in the body; null clears an optional field.
+//
+// With If-Match set to the ETag of a previous response, the update is rejected with 409 and the
+// current row if it changed in the meantime.
+func (h *ResourceHandlers) Update(c *fiber.Ctx) error {
+	version, ok := ifMatch(c, resource.AnyVersion)
+	if !ok {
+		return badIfMatch(c)
+	}
+	input, ok := decodeObject(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Body must be a JSON object",
+		})
+	}
+
+	var before resource.Record
+	if !h.resource.Owned {
+		before, _ = h.resource.Get(c.UserContext(), owner(c), c.Params("id")) // For the audit log
+	}
+	record, err := h.resource.Update(c.UserContext(), owner(c), c.Params("id"), input, version)
+	if err != nil {
+		return h.error(c, err)
+	}
+	h.audit(c, "update", record.ID(), before, record)
+	setETag(c, record.Version())
+	return c.JSON(record)
+}
+
+// Delete soft-deletes a row and returns it (with deleted_at set). It can be restored until the
+// purge (RESOURCE_RETENTION).
+func (h *ResourceHandlers) Delete(c *fiber.Ctx) error {
+	record, err := h.resource.Delete(c.UserContext(), owner(c), c.Params("id"))
+	if err != nil {
+		return h.error(c, err)
+	}
+	h.audit(c, "delete", record.ID(), nil, fiber.Map{"deleted_at": record[resource.ColumnDeletedAt]})
+	setETag(c, record.Version())
+	return c.JSON(record)
+}
+
+// Restore undeletes a row; 409 if it isn't deleted.
+func (h *ResourceHandlers) Restore(c *fiber.Ctx) error {
+	record, err := h.resource.Restore(c.UserContext(), owner(c), c.Params("id"))
+	if err != nil {
+		return h.error(c, err)
+	}
+	h.audit(c, "restore", record.ID(), nil, record)
+	setETag(c, record.Version())
+	return c.JSON(record)
+}
+
+// Bulk runs several operations in one request (POST /api/<name>/bulk) and returns a status per
+// operation, in order:
+//
+//	{"atomic": false, "operations": [
+//	    {"op": "create", "fields": {"artist_id": "a1"}},
+//	    {"op": "update", "id": "...", "fields": {"note": "x"}, "version": 2},
+//	    {"op": "delete", "id": "..."}
+//	]}
+//
+// Each result has the HTTP status the single-row endpoint would have returned, with the row or
+// the error. With "atomic": true, either every operation is written or none is; the valid ones
+// of a failed batch report 424. The response is 200 if every operation succeeded, 207 otherwise.
+func (h *ResourceHandlers) Bulk(c *fiber.Ctx) error {
+	var request struct {
+		Atomic     bool                     `json:"atomic"`
+		Operations []resource.BulkOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(c.Body())).Decode(&request); err != nil || len(request.Operations) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Body must be a JSON object with a non-empty operations array",
+		})
+	}
+
+	results, err := h.resource.Bulk(c.UserContext(), owner(c), request.Operations, request.Atomic)
+	if errors.Is(err, resource.ErrTooManyOperations) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return h.error(c, err)
+	}
+
+	// Step 1: One entry per operation, shaped like the single-row response
+	items := make([]fiber.Map, len(results))
+	succeeded := 0
+	for i, result := range results {
+		if result.Err != nil {
+			status, body := h.errorBody(result.Err)
+			body["index"] = i
+			body["status"] = status
+			items[i] = body
+			continue
+		}
+
+		status := fiber.StatusOK
+		if request.Operations[i].Op == resource.OpCreate {
+			status = fiber.StatusCreated
+		}
+		items[i] = fiber.Map{"index": i, "status": status, "item": result.Record}
+		succeeded++
+	}
+
+	// Step 2: 207 Multi-Status unless everything succeeded
+	status := fiber.StatusOK
+	if succeeded < len(results) {
+		status = fiber.StatusMultiStatus
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"atomic":    request.Atomic,
+		"results":   items,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+// error maps resource errors to responses.
+func (h *ResourceHandlers) error(c *fiber.Ctx, err error) error {
+	var conflict *resource.ConflictError
+	if errors.As(err, &conflict) {
+		setETag(c, conflict.Current.Version())
+	}
+	status, body := h.errorBody(err)
+	return c.Status(status).JSON(body)
+}
+
+// errorBody returns the status and body for a resource error (also used per item by Bulk).
+func (h *ResourceHandlers) errorBody(err error) (int, fiber.Map) {
+	var invalid *resource.ValidationError
+	var conflict *resource.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return fiber.StatusConflict, fiber.Map{
+			"error":           "Changed by another request",
+			"current_version": conflict.Current.Version(),
+			"current":         conflict.Current,
+		}
+	case errors.As(err, &invalid):
+		return fiber.StatusUnprocessableEntity, fiber.Map{
+			"error": invalid.Field + " " + invalid.Message,
+			"field": invalid.Field,
+		}
+	case errors.Is(err, resource.ErrNotFound):
+		return fiber.StatusNotFound, fiber.Map{"error": "Not found"}
+	case errors.Is(err, resource.ErrNotDeleted):
+		return fiber.StatusConflict, fiber.Map{"error": "Not deleted"}
+	case errors.Is(err, resource.ErrNotApplied):
+		return fiber.StatusFailedDependency, fiber.Map{"error": "Not applied: another operation in the batch failed"}
+	default:
+		slog.Error("Resource request failed", "resource", h.resource.Name, "error", err)
+		return fiber.StatusServiceUnavailable, fiber.Map{"error": "Failed to access " + h.resource.Name}
+	}
+}
+
+// audit records writes to shared resources, which only admins can make (e.g. artists.delete).
+// Writes to a user's own rows are not audited.
+func (h *ResourceHandlers) audit(c *fiber.Ctx, action, id string, before, after interface{}) {
+	if h.resource.Owned {
+		return
+	}
+
+	actor, _ := c.Locals("user").(string)
+	action = h.resource.Name + "." + action
+	if err := audit.Log(c.UserContext(), actor, action, id, before, after); err != nil {
+		logging.FromRequest(c).Error("Failed to write audit log", "action", action, "target", id, "error", err)
+	}
+}
+
+// owner is who the request acts as.
+func owner(c *fiber.Ctx) resource.Owner {
+	userID, _ := c.Locals("user").(string)
+	return resource.Owner{UserID: userID, TenantID: tenant.ID(c)}
+}
+
+// decodeObject parses the body as a JSON object.
+func decodeObject(c *fiber.Ctx) (map[string]interface{}, bool) {
+	var input map[string]interface{}
+	if err := json.NewDecoder(bytes.NewReader(c.Body())).Decode(&input); err != nil || input == nil {
+		return nil, false
+	}
+	return input, true
+}
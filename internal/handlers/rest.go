@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/price"
+	"boilerplate/internal/status"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/timing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// restPriceParam asks RESTProxy to inject cached prices (?current_price=true). It is not
+// forwarded to Supabase, which would take it for a column filter; neither are price_meta and,
+// with price_meta=true, locale (see price.FromRequest).
+const restPriceParam = "current_price"
+
+// restPriceTable is the table whose rows get cached prices, by their id.
+const restPriceTable = "artists"
+
+// restPathSegment is one segment of a proxied REST path: a table, view or "rpc" and a function.
+var restPathSegment = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// RESTProxy forwards requests under /rest/ to Supabase's REST API (PostgREST) at /rest/v1/, the
+// way GraphQLProxy forwards GraphQL: same method, body and headers (Authorization, apikey,
+// Prefer, Range, ...), with Supabase's status, headers and body sent back, so supabase-js REST
+// calls can use this backend as their URL (it requests /rest/v1/<table>, which is accepted too). With ?current_price=true, rows of the artists table
+// get their cached price as currentPrice (and currentPriceMeta with ?price_meta=true).
+//
+// Paths must be table, view or rpc/function names: anything else (.., empty segments) gets a
+// 400 rather than reaching another Supabase API.
+func RESTProxy(c *fiber.Ctx) error {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	if supabaseURL == "" {
+		logging.FromRequest(c).Error("SUPABASE_URL environment variable is not set")
+		return apperror.Write(c, apperror.New(fiber.StatusInternalServerError, apperror.CodeInternal, "REST proxy configuration error"))
+	}
+
+	// supabase-js calls <url>/rest/v1/<table>: both /rest/v1/artists and /rest/artists work
+	path := strings.TrimPrefix(c.Params("*"), "v1/")
+	if !validRESTPath(path) {
+		return apperror.Write(c, apperror.BadRequest("Invalid REST path: expected /rest/<table> or /rest/rpc/<function>"))
+	}
+
+	query, injectPrices := restQuery(string(c.Request().URI().QueryString()))
+	targetURL := strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + path
+	if query != "" {
+		targetURL += "?" + query
+	}
+
+	// Reads may be retried; writes and RPC calls (which may write) are not
+	idempotent := c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+	statusCode, respBody, err := forwardToSupabase(c, targetURL, c.Body(), idempotent)
+	if err != nil {
+		return respondProxyError(c, err)
+	}
+
+	if injectPrices && path == restPriceTable && statusCode >= 200 && statusCode < 300 {
+		// Prices come from the cache Realtime keeps fresh (see GraphQLProxy)
+		status.Uses(c, status.Cache, status.Realtime, status.RealtimeSchema)
+
+		stopSerialization := timing.Start(c, timing.PhaseSerialization)
+		respBody = injectCachedPricesIntoRows(tenant.Cache(c), respBody, price.FromRequest(c))
+		stopSerialization()
+	}
+
+	return c.Status(statusCode).Send(respBody)
+}
+
+// validRESTPath reports whether path is a table, view or function name ("artists",
+// "rpc/search_artists").
+func validRESTPath(path string) bool {
+	segments := strings.Split(path, "/")
+	if len(segments) > 2 || (len(segments) == 2) != (segments[0] == "rpc") {
+		return false // Tables are one segment, functions are rpc/<function>
+	}
+	for _, segment := range segments {
+		if !restPathSegment.MatchString(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// restQuery returns the query string to forward, without this proxy's own parameters
+// (current_price, price_meta and its locale), and whether current_price=true was among them.
+// The rest is forwarded as sent, since PostgREST filters are sensitive to encoding and order.
+func restQuery(raw string) (string, bool) {
+	params := strings.Split(raw, "&")
+	priceMeta := false
+	for _, param := range params {
+		if param == "price_meta=true" {
+			priceMeta = true
+		}
+	}
+
+	var forwarded []string
+	injectPrices := false
+	for _, param := range params {
+		name, value, _ := strings.Cut(param, "=")
+		switch {
+		case name == "":
+			continue
+		case name == restPriceParam:
+			injectPrices = value == "true"
+			continue
+		case name == "price_meta", name == "locale" && priceMeta:
+			continue
+		}
+		forwarded = append(forwarded, param)
+	}
+	return strings.Join(forwarded, "&"), injectPrices
+}
+
+// injectCachedPricesIntoRows adds currentPrice (and currentPriceMeta when format is not nil) to
+// the rows of a PostgREST response that have a cached price, by their id. The response is a
+// JSON array of rows, or one row (Accept: application/vnd.pgrst.object+json); anything else is
+// returned unchanged. Other numbers keep their exact digits.
+func injectCachedPricesIntoRows(store cache.Store, responseBody []byte, format *price.Format) []byte {
+	if store == nil {
+		return responseBody
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(responseBody))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return responseBody
+	}
+
+	var rows []map[string]interface{}
+	switch value := decoded.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if row, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, row)
+			}
+		}
+	case map[string]interface{}:
+		rows = append(rows, value)
+	default:
+		return responseBody
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if id, ok := rowID(row); ok {
+			ids = append(ids, id)
+		}
+	}
+	cachedPrices := getCachedPrices(store, ids)
+	if len(cachedPrices) == 0 {
+		return responseBody
+	}
+
+	for _, row := range rows {
+		id, _ := rowID(row)
+		if amount, ok := cachedPrices[id]; ok {
+			injectPriceIntoArtist(row, amount, format)
+		}
+	}
+
+	modifiedBody, err := json.Marshal(decoded)
+	if err != nil {
+		slog.Warn("Failed to create modified response", "error", err)
+		return responseBody
+	}
+	return modifiedBody
+}
+
+// rowID returns a row's id as a string (PostgREST sends uuid and text ids as strings and
+// integer ids as numbers).
+func rowID(row map[string]interface{}) (string, bool) {
+	switch id := row["id"].(type) {
+	case string:
+		return id, id != ""
+	case json.Number:
+		return id.String(), true
+	default:
+		return "", false
+	}
+}
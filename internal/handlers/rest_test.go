@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRESTProxy points the proxy at a mock PostgREST that records the last request and
+// answers with body, and returns an app serving the proxy.
+func setupRESTProxy(t *testing.T, body string) (*fiber.App, *http.Request) {
+	t.Helper()
+	received := &http.Request{}
+	mockSupabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received = *r.Clone(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Range", "0-1/2")
+		w.Write([]byte(body))
+	}))
+	originalURL := os.Getenv("SUPABASE_URL")
+	os.Setenv("SUPABASE_URL", mockSupabase.URL)
+	t.Cleanup(func() {
+		mockSupabase.Close()
+		os.Setenv("SUPABASE_URL", originalURL)
+	})
+
+	app := fiber.New()
+	app.All("/rest/*", RESTProxy)
+	return app, received
+}
+
+// TestRESTProxy_Forwards tests that the method, path, query and headers reach PostgREST as sent
+// and its headers come back.
+func TestRESTProxy_Forwards(t *testing.T) {
+	app, received := setupRESTProxy(t, `[{"id":"123","name":"Artist 1"}]`)
+
+	req := httptest.NewRequest("GET", "/rest/v1/artists?select=id,name&name=ilike.*nina*&order=name.asc", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("apikey", "anon-key")
+	req.Header.Set("Prefer", "count=exact")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0-1/2", resp.Header.Get("Content-Range"))
+	assert.Equal(t, "GET", received.Method)
+	assert.Equal(t, "/rest/v1/artists", received.URL.Path)
+	assert.Equal(t, "select=id,name&name=ilike.*nina*&order=name.asc", received.URL.RawQuery)
+	assert.Equal(t, "Bearer user-token", received.Header.Get("Authorization"))
+	assert.Equal(t, "anon-key", received.Header.Get("apikey"))
+	assert.Equal(t, "count=exact", received.Header.Get("Prefer"))
+
+	// Writes and functions go through with their body
+	req = httptest.NewRequest("POST", "/rest/rpc/search_artists", strings.NewReader(`{"term":"nina"}`))
+	req.Header.Set("Content-Type", "application/json")
+	_, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, "POST", received.Method)
+	assert.Equal(t, "/rest/v1/rpc/search_artists", received.URL.Path)
+}
+
+// TestRESTProxy_InvalidPath tests that paths outside tables and functions are rejected before
+// reaching Supabase.
+func TestRESTProxy_InvalidPath(t *testing.T) {
+	app, received := setupRESTProxy(t, `[]`)
+
+	for _, path := range []string{"/rest/", "/rest/artists/..%2F..%2Fauth%2Fv1%2Fadmin", "/rest/v1/artists/1", "/rest/a.b", "/rest/rpc/"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+	assert.Empty(t, received.Method)
+}
+
+// TestRESTProxy_PriceInjection tests that ?current_price=true adds cached prices to artists rows
+// and is not forwarded.
+func TestRESTProxy_PriceInjection(t *testing.T) {
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	store := cache.NewMemoryStore()
+	require.NoError(t, store.Set("price:123", "45.67", time.Minute))
+	cache.SetDefault(store)
+
+	app, received := setupRESTProxy(t, `[{"id":"123","followers":12345678901234567890},{"id":"456"}]`)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/rest/artists?select=*&current_price=true&price_meta=true&locale=de", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "select=*", received.URL.RawQuery)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var rows []map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &rows))
+	require.Len(t, rows, 2)
+	assert.Equal(t, "45.67", string(rows[0]["currentPrice"]))
+	assert.Contains(t, rows[0], "currentPriceMeta")
+	assert.Equal(t, "12345678901234567890", string(rows[0]["followers"]))
+	assert.NotContains(t, rows[1], "currentPrice")
+
+	// Without the parameter the response is passed through untouched
+	resp, err = app.Test(httptest.NewRequest("GET", "/rest/artists?select=*", nil))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "currentPrice")
+}
+
+// TestRESTQuery tests separating the proxy's own parameters from PostgREST's.
+func TestRESTQuery(t *testing.T) {
+	query, inject := restQuery("select=id&current_price=true&locale=eq.de")
+	assert.Equal(t, "select=id&locale=eq.de", query)
+	assert.True(t, inject)
+
+	query, inject = restQuery("price_meta=true&locale=de&id=eq.1")
+	assert.Equal(t, "id=eq.1", query)
+	assert.False(t, inject)
+}
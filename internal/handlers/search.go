@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+
+	"boilerplate/internal/logging"
+	"boilerplate/internal/search"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Search returns artists matching ?q=, best first (GET /api/search).
+//
+// Query parameters: q (required, up to 100 characters), page (default 1), limit (default 20,
+// max 50).
+func Search(c *fiber.Ctx) error {
+	page, limit := c.QueryInt("page", 1), c.QueryInt("limit", search.DefaultLimit)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > search.MaxLimit {
+		limit = search.DefaultLimit
+	}
+
+	results, hasMore, err := search.Search(c.UserContext(), tenant.ID(c), c.Query("q"), page, limit)
+	if err != nil {
+		return searchError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"query":    c.Query("q"),
+		"results":  results,
+		"page":     page,
+		"limit":    limit,
+		"has_more": hasMore,
+	})
+}
+
+// SearchSuggest returns up to ?limit= (default 8, max 20) artists whose name, or a word of it,
+// starts with ?q=, for typeahead (GET /api/search/suggest).
+func SearchSuggest(c *fiber.Ctx) error {
+	suggestions, err := search.Suggest(c.UserContext(), tenant.ID(c), c.Query("q"), c.QueryInt("limit", search.DefaultSuggestLimit))
+	if err != nil {
+		return searchError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"query":       c.Query("q"),
+		"suggestions": suggestions,
+	})
+}
+
+// searchError maps search errors to responses: 400 for bad queries, 503 otherwise.
+func searchError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, search.ErrEmptyQuery) || errors.Is(err, search.ErrQueryTooLong) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "q " + err.Error(),
+		})
+	}
+	logging.FromRequest(c).Error("Search failed", "error", err)
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error": "Search is unavailable",
+	})
+}
@@ -0,0 +1,289 @@
+package handlers
+
+// Session endpoints.
+//
+// Login, Refresh and Logout sign browser clients in through Supabase Auth (GoTrue), so they
+// never call Supabase Auth themselves and cookies and CORS are handled in one place:
+//
+//   - POST /auth/login exchanges {"email", "password"} for a session.
+//   - POST /auth/refresh exchanges the refresh token cookie for a new session.
+//   - POST /auth/logout ends the session in Supabase and clears the cookie.
+//
+// The refresh token never reaches scripts: it is kept in an HttpOnly cookie (AUTH_COOKIE_NAME,
+// default refresh_token) scoped to /auth, and responses only carry the access token, which the
+// client keeps in memory and sends as Authorization: Bearer. Supabase rotates refresh tokens, so
+// every refresh replaces the cookie too. Fetches from another origin need credentials: "include"
+// (the /auth routes accept the app's origins with credentials).
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/timing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// sessionCookiePath limits the refresh token cookie to the /auth endpoints.
+const sessionCookiePath = "/auth"
+
+// maxAuthResponse bounds the Supabase Auth responses read (a session with its user is a few KB).
+const maxAuthResponse = 1 << 20
+
+// LoginRequest is the body of POST /auth/login.
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// SessionResponse is the body of a successful login or refresh: Supabase's session without the
+// refresh token, which is set as a cookie instead.
+type SessionResponse struct {
+	AccessToken string          `json:"access_token"`
+	TokenType   string          `json:"token_type"`
+	ExpiresIn   int             `json:"expires_in"`           // Seconds the access token is valid
+	ExpiresAt   int64           `json:"expires_at,omitempty"` // Unix time it expires
+	User        json.RawMessage `json:"user,omitempty"`
+}
+
+// supabaseSession is a session as Supabase Auth returns it.
+type supabaseSession struct {
+	SessionResponse
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Login signs a user in with their email and password (POST /auth/login), setting the refresh
+// token cookie.
+func Login(cfg config.Session) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !cfg.Enabled() {
+			return apperror.Write(c, apperror.Unavailable("Sign-in is not configured", nil))
+		}
+		var credentials LoginRequest
+		if err := json.Unmarshal(c.Body(), &credentials); err != nil {
+			return apperror.Write(c, apperror.BadRequest("Body must be a JSON object with email and password"))
+		}
+		credentials.Email = strings.TrimSpace(credentials.Email)
+		switch {
+		case credentials.Email == "":
+			return apperror.Write(c, apperror.Validation("email", "is required"))
+		case credentials.Password == "":
+			return apperror.Write(c, apperror.Validation("password", "is required"))
+		}
+
+		body, _ := json.Marshal(credentials)
+		statusCode, respBody, err := callSupabaseAuth(c, cfg, "token?grant_type=password", body, "")
+		if err != nil {
+			return respondProxyError(c, err)
+		}
+		if statusCode != fiber.StatusOK {
+			return apperror.Write(c, authFailure(statusCode, respBody, "Invalid email or password"))
+		}
+		return startSession(c, cfg, respBody)
+	}
+}
+
+// Refresh exchanges the refresh token cookie for a new session (POST /auth/refresh), replacing
+// the cookie. A refresh token Supabase refuses (expired, revoked or already used) clears the
+// cookie: the user has to sign in again.
+func Refresh(cfg config.Session) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !cfg.Enabled() {
+			return apperror.Write(c, apperror.Unavailable("Sign-in is not configured", nil))
+		}
+		refreshToken := c.Cookies(cfg.CookieName)
+		if refreshToken == "" {
+			return apperror.Write(c, apperror.Unauthorized("Not signed in"))
+		}
+
+		statusCode, respBody, err := refreshSession(c, cfg, refreshToken)
+		if err != nil {
+			return respondProxyError(c, err)
+		}
+		if statusCode != fiber.StatusOK {
+			if sessionRevoked(statusCode) {
+				clearSessionCookie(c, cfg)
+			}
+			return apperror.Write(c, authFailure(statusCode, respBody, "Session expired, sign in again"))
+		}
+		return startSession(c, cfg, respBody)
+	}
+}
+
+// Logout signs the user out (POST /auth/logout): the session is revoked in Supabase, with the
+// access token of Authorization or else one the refresh token cookie is exchanged for, and the
+// cookie is cleared. It answers 204 even when Supabase can't be reached, since the browser no
+// longer holds the session either way.
+func Logout(cfg config.Session) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		clearSessionCookie(c, cfg)
+		if !cfg.Enabled() {
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+		logger := logging.FromRequest(c)
+
+		accessToken := ""
+		if authorization := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(authorization, "Bearer ") {
+			accessToken = strings.TrimPrefix(authorization, "Bearer ")
+		} else if refreshToken := c.Cookies(cfg.CookieName); refreshToken != "" {
+			statusCode, respBody, err := refreshSession(c, cfg, refreshToken)
+			var session supabaseSession
+			if err == nil && statusCode == fiber.StatusOK && json.Unmarshal(respBody, &session) == nil {
+				accessToken = session.AccessToken
+			}
+		}
+		if accessToken == "" {
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+
+		// scope=local ends this session only, not the user's other devices
+		statusCode, _, err := callSupabaseAuth(c, cfg, "logout?scope=local", nil, accessToken)
+		if err == nil && statusCode >= 300 && !sessionRevoked(statusCode) {
+			err = errors.New(http.StatusText(statusCode))
+		}
+		if err != nil {
+			logger.Warn("Failed to end the session in Supabase Auth", "error", err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// refreshSession asks Supabase Auth for a new session with refreshToken.
+func refreshSession(c *fiber.Ctx, cfg config.Session, refreshToken string) (int, []byte, error) {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	return callSupabaseAuth(c, cfg, "token?grant_type=refresh_token", body, "")
+}
+
+// startSession answers a successful login or refresh: the refresh token goes into the cookie,
+// the rest of the session into the body.
+func startSession(c *fiber.Ctx, cfg config.Session, respBody []byte) error {
+	var session supabaseSession
+	if err := json.Unmarshal(respBody, &session); err != nil || session.AccessToken == "" || session.RefreshToken == "" {
+		if err == nil {
+			err = errors.New("the session has no access or refresh token")
+		}
+		return apperror.Write(c, apperror.BadGateway("Unexpected response from Supabase Auth", err))
+	}
+	setSessionCookie(c, cfg, session.RefreshToken)
+	return c.JSON(session.SessionResponse)
+}
+
+// callSupabaseAuth POSTs body to path under Supabase Auth's /auth/v1/ with the anon key, and
+// returns its status and body. accessToken, if set, is sent as Authorization. Errors are
+// *proxyError, answered with respondProxyError. Requests are never retried: a refresh token is
+// only good once.
+func callSupabaseAuth(c *fiber.Ctx, cfg config.Session, path string, body []byte, accessToken string) (int, []byte, error) {
+	logger := logging.FromRequest(c)
+	targetURL := strings.TrimSuffix(cfg.SupabaseURL, "/") + "/auth/v1/" + path
+	req, err := http.NewRequestWithContext(c.UserContext(), fiber.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		logger.Error("Failed to create request to Supabase Auth", "error", err)
+		return 0, nil, &proxyError{status: fiber.StatusInternalServerError, message: "Failed to create proxy request"}
+	}
+	req.Header.Set("apikey", cfg.AnonKey)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if accessToken != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+accessToken)
+	}
+	if requestID := logging.GetRequestID(c); requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
+
+	stopUpstream := timing.Start(c, timing.PhaseUpstream)
+	upstreamStart := time.Now()
+	resp, err := doWithRetries(logger, req, false)
+	if err != nil {
+		stopUpstream()
+		metrics.SupabaseProxyDuration.WithLabelValues("error").Observe(time.Since(upstreamStart).Seconds())
+		logger.Error("Failed to reach Supabase Auth", "error", err)
+		return 0, nil, &proxyError{status: fiber.StatusBadGateway, message: "Failed to connect to Supabase Auth"}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthResponse))
+	stopUpstream()
+	metrics.SupabaseProxyDuration.WithLabelValues(metrics.StatusClass(resp.StatusCode)).Observe(time.Since(upstreamStart).Seconds())
+	if err != nil {
+		logger.Error("Failed to read response from Supabase Auth", "error", err)
+		return 0, nil, &proxyError{status: fiber.StatusBadGateway, message: "Failed to read response from Supabase Auth"}
+	}
+	if resp.StatusCode >= 500 {
+		logger.Error("Supabase Auth returned 5xx error", "upstream_status", resp.StatusCode)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// sessionRevoked reports whether Supabase Auth refused a token for good (rather than failing or
+// rate limiting): 400 (invalid grant), 401, 403 or 404 (the session no longer exists).
+func sessionRevoked(statusCode int) bool {
+	switch statusCode {
+	case fiber.StatusBadRequest, fiber.StatusUnauthorized, fiber.StatusForbidden, fiber.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// authFailure returns the problem answering a refused Supabase Auth request: 429 when it rate
+// limits, 502 when it fails (5xx or an unexpected status), and otherwise 401 with its message ("Email not confirmed", ...),
+// or fallback.
+func authFailure(statusCode int, respBody []byte, fallback string) *apperror.Error {
+	switch {
+	case statusCode == fiber.StatusTooManyRequests:
+		return apperror.RateLimited("Too many sign-in attempts, try again later")
+	case !sessionRevoked(statusCode) && statusCode != fiber.StatusUnprocessableEntity:
+		return apperror.BadGateway("Supabase Auth failed", errors.New(http.StatusText(statusCode)))
+	}
+	// GoTrue's errors are {"msg": ...} or, from the token endpoint, {"error_description": ...}
+	var failure struct {
+		Message     string `json:"msg"`
+		Description string `json:"error_description"`
+	}
+	_ = json.Unmarshal(respBody, &failure)
+	switch {
+	case failure.Description != "":
+		return apperror.Unauthorized(failure.Description)
+	case failure.Message != "":
+		return apperror.Unauthorized(failure.Message)
+	default:
+		return apperror.Unauthorized(fallback)
+	}
+}
+
+// setSessionCookie sets the refresh token cookie.
+func setSessionCookie(c *fiber.Ctx, cfg config.Session, refreshToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     cfg.CookieName,
+		Value:    refreshToken,
+		Path:     sessionCookiePath,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   int(cfg.CookieMaxAge.Seconds()),
+		Expires:  time.Now().Add(cfg.CookieMaxAge),
+		Secure:   cfg.CookieSecure,
+		HTTPOnly: true,
+		SameSite: cfg.CookieSameSite,
+	})
+}
+
+// clearSessionCookie deletes the refresh token cookie, with the attributes it was set with.
+func clearSessionCookie(c *fiber.Ctx, cfg config.Session) {
+	c.Cookie(&fiber.Cookie{
+		Name:     cfg.CookieName,
+		Path:     sessionCookiePath,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   -1,
+		Expires:  fasthttp.CookieExpireDelete,
+		Secure:   cfg.CookieSecure,
+		HTTPOnly: true,
+		SameSite: cfg.CookieSameSite,
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSupabaseAuth is a Supabase Auth that signs in ada@example.com with "secret" and accepts
+// each refresh token once, rotating it.
+type mockSupabaseAuth struct {
+	refreshToken string   // The only valid refresh token
+	requests     []string // Method, path and query of every request
+	logouts      []string // Authorization of the logouts
+}
+
+func (m *mockSupabaseAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.requests = append(m.requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+	if r.Header.Get("apikey") != "anon-key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.URL.Path == "/auth/v1/logout":
+		m.logouts = append(m.logouts, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case r.URL.Query().Get("grant_type") == "password" && body["email"] == "ada@example.com" && body["password"] == "secret":
+	case r.URL.Query().Get("grant_type") == "refresh_token" && body["refresh_token"] == m.refreshToken:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant", "error_description": "Invalid login credentials"}`))
+		return
+	}
+	m.refreshToken += "+"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access-" + m.refreshToken,
+		"token_type":    "bearer",
+		"expires_in":    3600,
+		"refresh_token": m.refreshToken,
+		"user":          map[string]string{"id": "user-1"},
+	})
+}
+
+// setupSession returns an app serving the /auth endpoints against a mock Supabase Auth.
+func setupSession(t *testing.T) (*fiber.App, *mockSupabaseAuth) {
+	t.Helper()
+	auth := &mockSupabaseAuth{refreshToken: "r"}
+	server := httptest.NewServer(auth)
+	t.Cleanup(server.Close)
+
+	cfg := config.Session{
+		SupabaseURL:    server.URL,
+		AnonKey:        "anon-key",
+		CookieName:     "refresh_token",
+		CookieMaxAge:   time.Hour,
+		CookieSecure:   true,
+		CookieSameSite: config.SameSiteStrict,
+	}
+	app := fiber.New()
+	app.Post("/auth/login", Login(cfg))
+	app.Post("/auth/refresh", Refresh(cfg))
+	app.Post("/auth/logout", Logout(cfg))
+	return app, auth
+}
+
+// sessionCookie returns the refresh token cookie a response sets.
+func sessionCookie(t *testing.T, resp *http.Response) *http.Cookie {
+	t.Helper()
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "refresh_token" {
+			return cookie
+		}
+	}
+	require.Fail(t, "no refresh_token cookie")
+	return nil
+}
+
+// TestLogin tests that a login sets the refresh token as an HttpOnly cookie and only returns the
+// access token, and that refused credentials get a 401.
+func TestLogin(t *testing.T) {
+	app, auth := setupSession(t)
+
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"email": " ada@example.com ", "password": "secret"}`))
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"POST /auth/v1/token?grant_type=password"}, auth.requests)
+
+	cookie := sessionCookie(t, resp)
+	assert.Equal(t, "r+", cookie.Value)
+	assert.Equal(t, "/auth", cookie.Path)
+	assert.Equal(t, 3600, cookie.MaxAge)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"access_token": "access-r+", "token_type": "bearer", "expires_in": 3600, "user": {"id": "user-1"}}`, string(body))
+
+	req = httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"email": "ada@example.com", "password": "wrong"}`))
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, resp.Cookies())
+	body, _ = io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "Invalid login credentials")
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"email": "ada@example.com"}`)))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Len(t, auth.requests, 2, "invalid bodies don't reach Supabase")
+}
+
+// TestRefresh tests that a refresh rotates the cookie, and that a refused refresh token clears it.
+func TestRefresh(t *testing.T) {
+	app, auth := setupSession(t)
+
+	refresh := func(token string) *http.Response {
+		req := httptest.NewRequest("POST", "/auth/refresh", nil)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "refresh_token", Value: token})
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := refresh("")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, auth.requests)
+
+	resp = refresh("r")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "r+", sessionCookie(t, resp).Value)
+	body, _ := io.ReadAll(resp.Body)
+	assert.NotContains(t, string(body), "refresh_token")
+
+	// The old token was used up
+	resp = refresh("r")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	cleared := sessionCookie(t, resp)
+	assert.Empty(t, cleared.Value)
+	assert.Equal(t, "/auth", cleared.Path)
+	assert.Negative(t, cleared.MaxAge)
+}
+
+// TestLogout tests that logout revokes the session with the access token, or one the cookie is
+// exchanged for, and always clears the cookie.
+func TestLogout(t *testing.T) {
+	app, auth := setupSession(t)
+
+	req := httptest.NewRequest("POST", "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer access-1")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Negative(t, sessionCookie(t, resp).MaxAge)
+	assert.Equal(t, []string{"Bearer access-1"}, auth.logouts)
+	assert.Equal(t, []string{"POST /auth/v1/logout?scope=local"}, auth.requests)
+
+	req = httptest.NewRequest("POST", "/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "r"})
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []string{"Bearer access-1", "Bearer access-r+"}, auth.logouts)
+
+	// Without a session there is nothing to revoke
+	resp, err = app.Test(httptest.NewRequest("POST", "/auth/logout", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Len(t, auth.logouts, 2)
+}
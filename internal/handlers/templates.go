@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+
+	"boilerplate/internal/logging"
+	"boilerplate/internal/price"
+	"boilerplate/internal/templates"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// templatePreview is one template on the preview page.
+type templatePreview struct {
+	Name    string   // Path without extension, e.g. emails/digest
+	Formats []string // Extensions without the dot, e.g. html, txt
+}
+
+// TemplatePreviews lists every template with links to their previews (GET /dev/templates,
+// development only).
+func TemplatePreviews(c *fiber.Ctx) error {
+	set := templates.Get()
+	var previews []templatePreview
+	for _, name := range set.Names() {
+		base, format := strings.TrimSuffix(name, path.Ext(name)), strings.TrimPrefix(path.Ext(name), ".")
+		if n := len(previews); n > 0 && previews[n-1].Name == base {
+			previews[n-1].Formats = append(previews[n-1].Formats, format)
+			continue
+		}
+		previews = append(previews, templatePreview{Name: base, Formats: []string{format}})
+	}
+
+	c.Type("html", "utf-8")
+	return set.Render(c, "pages/preview.html", price.ResolveLocale(c), fiber.Map{
+		"Templates": previews,
+		"Locales":   set.Locales(),
+	})
+}
+
+// PreviewTemplate renders a template with its sample data (GET /dev/templates/:dir/:file,
+// development only), in the locale from ?locale= or Accept-Language. Emails show their subject; plain-text
+// ones on the first line.
+func PreviewTemplate(c *fiber.Ctx) error {
+	set := templates.Get()
+	name := c.Params("dir") + "/" + c.Params("file")
+	if !slices.Contains(set.Names(), name) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Template not found",
+		})
+	}
+
+	data, err := set.Sample(name)
+	if err != nil {
+		return previewError(c, err)
+	}
+	locale := price.ResolveLocale(c)
+
+	if base, ok := strings.CutPrefix(name, "emails/"); ok {
+		email, err := set.Email(strings.TrimSuffix(base, path.Ext(base)), locale, data)
+		if err != nil {
+			return previewError(c, err)
+		}
+		c.Set("X-Email-Subject", email.Subject)
+		if path.Ext(name) == ".html" {
+			c.Type("html", "utf-8")
+			return c.SendString(email.HTML)
+		}
+		c.Type("txt", "utf-8")
+		return c.SendString("Subject: " + email.Subject + "\n\n" + email.Text)
+	}
+
+	var rendered bytes.Buffer
+	if err := set.Render(&rendered, name, locale, data); err != nil {
+		return previewError(c, err)
+	}
+	c.Type(strings.TrimPrefix(path.Ext(name), "."), "utf-8")
+	return c.Send(rendered.Bytes())
+}
+
+// previewError reports a template that failed to render, with the error: the preview is for
+// template authors.
+func previewError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, templates.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	logging.FromRequest(c).Warn("Failed to render template preview", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"boilerplate/internal/logging"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Usage history pagination.
+const (
+	defaultUsageHistory = 30
+	maxUsageHistory     = 366
+)
+
+// GetUsage returns the current user's request counts (GET /api/usage): today and this month
+// from the live counters, and the stored history of one period.
+//
+// Query parameters: period (day, the default, or month), limit (default 30, max 366).
+func GetUsage(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user").(string)
+	tenantID := tenant.ID(c)
+
+	period := c.Query("period", usage.Day)
+	if period != usage.Day && period != usage.Month {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "period must be day or month",
+		})
+	}
+	limit := c.QueryInt("limit", defaultUsageHistory)
+	if limit < 1 || limit > maxUsageHistory {
+		limit = defaultUsageHistory
+	}
+
+	day, month, err := usage.Current(tenantID, userID)
+	if err != nil {
+		logging.FromRequest(c).Error("Failed to read usage counters", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Usage counters unavailable",
+		})
+	}
+
+	history := make([]usage.Rollup, 0)
+	if usage.DefaultStore != nil {
+		history, err = usage.DefaultStore.List(c.UserContext(), usage.Query{
+			TenantID: &tenantID,
+			Subject:  userID,
+			Period:   period,
+			Limit:    limit,
+		})
+		if err != nil {
+			logging.FromRequest(c).Error("Failed to load usage history", "error", err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Failed to load usage history",
+			})
+		}
+	}
+
+	// The live counters are ahead of the stored rollups of the current periods
+	for i := range history {
+		switch {
+		case history[i].Period == usage.Day && history[i].PeriodStart == day.PeriodStart:
+			history[i] = day
+		case history[i].Period == usage.Month && history[i].PeriodStart == month.PeriodStart:
+			history[i] = month
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id": userID,
+		"day":     day,
+		"month":   month,
+		"history": history,
+	})
+}
@@ -4,43 +4,154 @@ package handlers
 // The Hub pattern is used to manage multiple WebSocket connections and broadcast messages to all clients.
 
 import (
-	"log"
+	"encoding/json"
+	"log/slog"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+	"boilerplate/internal/events"
+	"boilerplate/internal/handlers/wsproto"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/memory"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/monitor"
+	"boilerplate/internal/price"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// clientConn is the part of a WebSocket connection the hub needs.
+// *websocket.Conn satisfies it; benchmarks and tests use lightweight fakes.
+type clientConn interface {
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// clientRegistration is sent on the register channel: a connection and the tenant it belongs to.
+type clientRegistration struct {
+	conn   clientConn
+	client clientInfo
+}
+
+// clientInfo is what the hub keeps for each connected client.
+type clientInfo struct {
+	tenant   string // "" for clients without a tenant
+	user     string // "" for anonymous clients (no access token, see ws_user.go)
+	schema   int    // Message schema version the client negotiated (see ws_schema.go)
+	encoding string // EncodingJSON or EncodingProtobuf (see ws_proto.go)
+
+	// requestID is the correlation ID of the upgrade request (see logging.RequestID)
+	requestID string
+
+	// delta batches the client's price updates when it connected with ?mode=delta (see ws_delta.go)
+	delta *deltaBatcher
+
+	// send queues the client's messages for its write pump (see ws_send.go)
+	send *clientSender
+
+	// throttle conflates the updates of the client's throttled subscriptions (see ws_throttle.go)
+	throttle *topicThrottle
+
+	// stats counts the connection's traffic, logged when it ends (see ws_stats.go)
+	stats *connStats
+}
+
+// logger returns the default logger with the client's request ID, user and tenant attached.
+func (c clientInfo) logger() *slog.Logger {
+	logger := slog.Default().With("request_id", c.requestID)
+	if c.user != "" {
+		logger = logger.With("user_id", c.user)
+	}
+	if c.tenant != "" {
+		logger = logger.With("tenant", c.tenant)
+	}
+	return logger
+}
+
+// hubMessage is a message queued for fan-out.
+// Scoped messages only go to clients of one tenant; unscoped messages go to everyone.
+// Messages with a user only go to that user's connections.
+type hubMessage struct {
+	data   []byte
+	tenant string
+	scoped bool
+	user   string
+
+	// topics restrict the message to the clients subscribed to one of them, and those without
+	// subscriptions (see ws_topics.go). Messages without topics reach every client
+	topics []string
+
+	// origin is the replica that published the message when it came through the Redis bridge,
+	// "" when it was published here (see ws_bridge.go). realtime marks the price and row changes
+	// of the Realtime subscriber, only relayed when a single replica consumes Realtime
+	origin   string
+	realtime bool
+
+	// Envelope fields for schema 2+ clients (see ws_schema.go)
+	kind     string
+	ts       time.Time
+	id       string
+	envelope []byte // Encoded JSON envelope, built on first use
+	protobuf []byte // Encoded protobuf envelope, built on first use
+
+	change *priceChange // Parsed price update for delta clients, built on first use
+}
+
 // Hub is the central manager for all WebSocket connections.
 // It uses channels to safely handle client registration, unregistration, and message broadcasting
 // from multiple goroutines (threads).
 //
 // Architecture:
-//   - clients: Map of all active WebSocket connections
+//   - clients: Map of all active WebSocket connections (and their tenant)
 //   - register: Channel for new clients to join
 //   - unregister: Channel for clients to leave
-//   - broadcast: Channel for messages to send to all clients
+//   - broadcast: Channel for messages to send to all clients (or all clients of one tenant)
 //   - mu: Mutex (lock) to prevent race conditions when accessing the clients map
+//
+// The hub only queues messages; each client's write pump writes them (see ws_send.go), so one
+// slow client never stalls a broadcast.
 type Hub struct {
 	// clients stores all active WebSocket connections.
-	// The boolean value is just a placeholder (we only care about the keys).
-	clients map[*websocket.Conn]bool
+	// The value holds the client's tenant ID ("" if the connection has no tenant) and schema version.
+	clients map[clientConn]clientInfo
 
-	// broadcast is a channel that receives messages to send to all connected clients.
-	// When a message is sent here, the hub will forward it to every client.
-	broadcast chan []byte
+	// broadcast is a channel that receives messages to send to connected clients.
+	// When a message is sent here, the hub will forward it to every matching client.
+	broadcast chan hubMessage
 
 	// register is a channel for new clients to join the hub.
-	// When a client connects, it sends itself through this channel.
-	register chan *websocket.Conn
+	// When a client connects, it sends itself (and its tenant) through this channel.
+	register chan clientRegistration
 
 	// unregister is a channel for clients to leave the hub.
 	// When a client disconnects, it sends itself through this channel.
-	unregister chan *websocket.Conn
+	unregister chan clientConn
 
 	// mu is a read-write mutex to safely access the clients map from multiple goroutines.
 	// This prevents race conditions (data corruption) when multiple threads access the map at once.
 	mu sync.RWMutex
+
+	// sendBuffer is how many messages each client may have queued (WS_SEND_BUFFER).
+	sendBuffer int
+
+	// topics indexes the clients' topic subscriptions (see ws_topics.go), guarded by mu.
+	topics *topicIndex
+
+	// bridge relays the hub's messages to the other replicas' hubs, nil without WS_REDIS_BRIDGE
+	// (see ws_bridge.go).
+	bridge atomic.Pointer[hubBridge]
+
+	// realtime queues the Realtime subscriber's changes until the hub takes them (see ws_queue.go).
+	realtime *realtimeQueue
 }
 
 var (
@@ -49,22 +160,71 @@ var (
 	DefaultHub *Hub
 )
 
+// subscribeOnce subscribes the default hub to events the first time InitHub is called.
+var subscribeOnce sync.Once
+
 // InitHub creates and starts the default WebSocket hub.
-// This should be called once when the application starts.
+// This should be called once when the application starts. The hub broadcasts every
+// events.PriceChanged (published by the Realtime subscriber) as a price update, and every
+// events.RowChanged with a topic as a message of that type, through the Realtime queue (see
+// ws_queue.go). Every events.NotificationSent goes to its user's connections as a notification
+// message.
 func InitHub() {
-	// Create a new hub with empty clients map and channels
-	DefaultHub = &Hub{
-		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan []byte, 256), // Buffer up to 256 messages
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-	}
+	DefaultHub = newHub()
+	subscribeOnce.Do(func() {
+		events.Subscribe(func(change events.PriceChanged) {
+			if message, ok := newPriceMessage(change); ok {
+				GetHub().queueRealtime(message.tenant+" "+message.topics[0], message)
+			}
+		})
+		events.Subscribe(func(change events.RowChanged) {
+			if message, ok := newRowMessage(change); ok {
+				key := "" // Changes of rows without an id are all sent
+				if message.topics[0] != change.Subscription {
+					key = message.tenant + " " + message.topics[0]
+				}
+				GetHub().queueRealtime(key, message)
+			}
+		})
+		events.Subscribe(func(notification events.NotificationSent) {
+			GetHub().PublishNotification(notification)
+		})
+		// Near the memory limit, close a share of the clients (see internal/memory)
+		memory.RegisterShedder("websocket", func(fraction float64) int {
+			return GetHub().Shed(fraction)
+		})
+		monitor.RegisterChannel("hub.broadcast", func() (int, int) {
+			hub := GetHub()
+			return len(hub.broadcast), cap(hub.broadcast)
+		})
+		monitor.RegisterChannel("hub.realtime", func() (int, int) {
+			hub := GetHub()
+			return hub.realtime.len(), hub.realtime.size
+		})
+	})
 
 	// Start the hub's main loop in a separate goroutine (background thread)
 	// This loop runs forever, handling client connections and message broadcasting
 	go DefaultHub.Run()
+	go DefaultHub.pumpRealtime()
 
-	log.Println("WebSocket hub initialized")
+	slog.Info("WebSocket hub initialized")
+	startup.Report("websocket", true, "hub at /ws, delta interval "+getDeltaInterval().String()+
+		", send buffer "+strconv.Itoa(DefaultHub.sendBuffer)+
+		", Realtime queue "+strconv.Itoa(DefaultHub.realtime.size))
+}
+
+// newHub creates a hub with an empty clients map and channels. Call Run to start it.
+func newHub() *Hub {
+	return &Hub{
+		clients:    make(map[clientConn]clientInfo),
+		broadcast:  make(chan hubMessage, 256), // Buffer up to 256 messages
+		register:   make(chan clientRegistration),
+		unregister: make(chan clientConn),
+		sendBuffer: getSendBuffer(),
+		topics:     newTopicIndex(),
+		realtime:   newRealtimeQueue(getRealtimeQueueSize(), getRealtimeQueueTimeout()),
+	}
 }
 
 // GetHub returns the default WebSocket hub instance.
@@ -72,11 +232,22 @@ func GetHub() *Hub {
 	return DefaultHub
 }
 
+// ClientCount returns the number of currently registered WebSocket clients.
+func (h *Hub) ClientCount() int {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
 // Run is the hub's main event loop that runs forever.
 // It listens for three types of events:
-//   1. New clients registering (joining)
-//   2. Clients unregistering (leaving)
-//   3. Messages to broadcast to all clients
+//  1. New clients registering (joining)
+//  2. Clients unregistering (leaving)
+//  3. Messages to broadcast to all clients
 //
 // This function runs in a separate goroutine and blocks forever.
 func (h *Hub) Run() {
@@ -84,61 +255,237 @@ func (h *Hub) Run() {
 		// The select statement waits for one of these events to happen
 		select {
 		// Case 1: A new client wants to join
-		case conn := <-h.register:
-			// Lock the clients map before modifying it (thread safety)
-			h.mu.Lock()
-			h.clients[conn] = true // Add the new client
-			h.mu.Unlock()
-			log.Printf("WebSocket client connected. Total clients: %d", len(h.clients))
+		case registration := <-h.register:
+			h.addClient(registration.conn, registration.client)
+			registration.client.logger().Info("WebSocket client connected", "clients", h.ClientCount())
 
 		// Case 2: A client wants to leave
 		case conn := <-h.unregister:
 			// Lock the clients map before modifying it
 			h.mu.Lock()
-			if _, exists := h.clients[conn]; exists {
-				delete(h.clients, conn) // Remove the client
-				conn.Close()            // Close the WebSocket connection
-				log.Printf("WebSocket client disconnected. Total clients: %d", len(h.clients))
+			h.topics.removeAll(conn)
+			if client, exists := h.clients[conn]; exists {
+				// Remove the client. The connection and its write pump are closed by
+				// WebSocketHandler, which owns them (Fiber recycles the Conn once the handler returns).
+				delete(h.clients, conn)
+				metrics.WebSocketClients.Set(float64(len(h.clients)))
+				client.logger().Info("WebSocket client disconnected", "clients", len(h.clients))
 			}
 			h.mu.Unlock()
 
 		// Case 3: A message needs to be broadcast to all clients
 		case message := <-h.broadcast:
-			// Use read lock since we're only reading from the map
-			h.mu.RLock()
-			// Send the message to every connected client
-			for conn := range h.clients {
-				err := conn.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					// If we can't send to a client, they're probably disconnected
-					log.Printf("Error sending message to client: %v", err)
-					// Remove the broken connection (we'll clean it up on next unregister)
-					delete(h.clients, conn)
-					conn.Close()
-				}
+			metrics.WebSocketBroadcastQueueDepth.Set(float64(len(h.broadcast)))
+			h.fanOut(message)
+		}
+	}
+}
+
+// addClient adds a client to the hub. Clients without a sender get one with the hub's buffer
+// size, started here; WebSocketHandler starts its own so it can wait for it before returning.
+func (h *Hub) addClient(conn clientConn, client clientInfo) {
+	if client.send == nil {
+		client.send = newClientSender(conn, client, h.sendBuffer)
+		go client.send.run()
+	}
+	if client.throttle == nil {
+		client.throttle = newTopicThrottle(client.send)
+	}
+
+	// Lock the clients map before modifying it (thread safety)
+	h.mu.Lock()
+	h.clients[conn] = client
+	metrics.WebSocketClients.Set(float64(len(h.clients)))
+	h.mu.Unlock()
+}
+
+// fanOut queues a message for every connected client (of the message's tenant, if scoped, and
+// subscribed to its topics if the client has subscriptions). Clients whose send buffer is full are
+// removed from the hub and disconnected by their write pump with CloseSlowClient.
+func (h *Hub) fanOut(message hubMessage) {
+	// Lock the clients map since slow clients are removed while iterating
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Send the message to every matching client, in the schema version it negotiated
+	recipients := h.recipients(message)
+	for conn, client := range h.clients {
+		if message.scoped && client.tenant != message.tenant {
+			continue // Another tenant's client
+		}
+		if message.user != "" && client.user != message.user {
+			continue // Another user's (or an anonymous) client
+		}
+		throttle, ok := recipients[conn]
+		if recipients != nil && !ok && h.topics.subscribed(conn) {
+			continue // Subscribed to other topics
+		}
+		if client.delta != nil {
+			if change := message.priceChange(); change != nil {
+				client.delta.add(change) // Sent with the client's next price_delta
+				client.stats.topic(MessageTypePriceDelta)
+				continue
 			}
-			h.mu.RUnlock()
+		}
+
+		messageType, data := message.encodeFor(client)
+		var queued bool
+		if throttle > 0 {
+			// Sent now, or conflated with the topic's next updates (see ws_throttle.go)
+			queued = client.throttle.offer(message.topics[0], throttle, outgoingFrame{messageType: messageType, data: data})
+		} else {
+			queued = client.send.enqueue(messageType, data)
+		}
+		if queued {
+			client.stats.topic(message.kind)
+		} else {
+			// The client isn't reading fast enough: drop it rather than buffer without limit
+			delete(h.clients, conn)
+			metrics.WebSocketClients.Set(float64(len(h.clients)))
+			client.send.evictSlow()
 		}
 	}
 }
 
-// Broadcast sends a message to all connected WebSocket clients.
-// This is the main way to send real-time updates to all connected users.
+// Broadcast sends a message of type "broadcast" to all connected WebSocket clients.
 //
-// Example: hub.Broadcast([]byte(`{"artist_id": "123", "price": 45.67}`))
+// Example: hub.Broadcast([]byte(`{"notice": "maintenance at 22:00"}`))
 func (h *Hub) Broadcast(message []byte) {
+	h.Publish(MessageTypeBroadcast, message)
+}
+
+// BroadcastToTenant sends a message of type "broadcast" only to clients that connected for tenantID.
+// An empty tenantID reaches clients without a tenant (single-tenant deployments).
+func (h *Hub) BroadcastToTenant(tenantID string, message []byte) {
+	h.PublishToTenant(tenantID, MessageTypeBroadcast, message)
+}
+
+// Publish sends a typed message to all connected WebSocket clients.
+// This is the main way to send real-time updates to all connected users. Schema 1 clients
+// receive message as is; schema 2 clients receive it as the data of an envelope of type kind.
+//
+// Example: hub.Publish(MessageTypePriceUpdate, []byte(`{"artist_id": "123", "price": "45.67"}`))
+func (h *Hub) Publish(kind string, message []byte) {
+	h.enqueue(newHubMessage(kind, message))
+}
+
+// PublishToTenant sends a typed message only to clients that connected for tenantID.
+func (h *Hub) PublishToTenant(tenantID, kind string, message []byte) {
+	hm := newHubMessage(kind, message)
+	hm.tenant, hm.scoped = tenantID, true
+	h.enqueue(hm)
+}
+
+// PublishPriceChange sends a price update to the clients of the change's tenant (everyone for
+// changes without a tenant), on the topic prices:<artist_id> and those of RegisterPriceTopics.
+// The changes of the Realtime subscriber go through the Realtime queue instead (see ws_queue.go).
+func (h *Hub) PublishPriceChange(change events.PriceChanged) {
 	if h == nil {
 		return // Hub not initialized, ignore
 	}
+	if message, ok := newPriceMessage(change); ok {
+		h.enqueue(message)
+	}
+}
+
+// newPriceMessage returns the hub message of a price change.
+func newPriceMessage(change events.PriceChanged) (hubMessage, bool) {
+	message, err := json.Marshal(change)
+	if err != nil {
+		slog.Error("Failed to create price update message", "error", err)
+		return hubMessage{}, false
+	}
+
+	// Tenant rows only go to that tenant's clients
+	hm := newHubMessage(MessageTypePriceUpdate, message)
+	hm.tenant, hm.scoped = change.TenantID, change.TenantID != ""
+	hm.topics = topicsOfPrice(change)
+	hm.realtime = true
+	return hm, true
+}
+
+// PublishRowChange sends a change of a subscribed table as a message of its topic, to the
+// clients of the change's tenant (everyone for changes without a tenant), on the hub topic
+// <subscription>:<id> (see topicOfRow). Changes without a topic are not broadcast. The changes
+// of the Realtime subscriber go through the Realtime queue instead (see ws_queue.go).
+func (h *Hub) PublishRowChange(change events.RowChanged) {
+	if h == nil {
+		return
+	}
+	if message, ok := newRowMessage(change); ok {
+		h.enqueue(message)
+	}
+}
+
+// newRowMessage returns the hub message of a row change, or false for changes without a topic.
+func newRowMessage(change events.RowChanged) (hubMessage, bool) {
+	if change.Topic == "" {
+		return hubMessage{}, false
+	}
+	message, err := json.Marshal(change)
+	if err != nil {
+		slog.Error("Failed to create row change message", "subscription", change.Subscription, "error", err)
+		return hubMessage{}, false
+	}
+
+	hm := newHubMessage(change.Topic, message)
+	hm.tenant, hm.scoped = change.TenantID, change.TenantID != ""
+	hm.topics = []string{topicOfRow(change)}
+	hm.realtime = true
+	return hm, true
+}
+
+// PublishNotification sends a notification to the connections of its user.
+func (h *Hub) PublishNotification(notification events.NotificationSent) {
+	if h == nil {
+		return
+	}
+	message, err := json.Marshal(notification)
+	if err != nil {
+		slog.Error("Failed to create notification message", "type", notification.Type, "error", err)
+		return
+	}
+	h.PublishToUser(notification.UserID, MessageTypeNotification, message)
+}
+
+// PublishToUser sends a typed message only to the connections of userID (clients that connected
+// with an access token), e.g. to sync a change made on one of the user's devices to the others.
+// See also SendToUser.
+func (h *Hub) PublishToUser(userID, kind string, message []byte) {
+	if userID == "" {
+		return // Would otherwise reach everyone
+	}
+	hm := newHubMessage(kind, message)
+	hm.user = userID
+	h.enqueue(hm)
+}
+
+// enqueue hands a message to the hub's main loop without blocking, and to the Redis bridge if
+// it was published on this replica.
+func (h *Hub) enqueue(message hubMessage) {
+	if h == nil {
+		return // Hub not initialized, ignore
+	}
+	h.relay(message)
 
 	// Try to send the message to the broadcast channel
 	// If the channel is full, drop the message (non-blocking)
 	select {
 	case h.broadcast <- message:
 		// Message sent successfully, hub will broadcast it
+		metrics.WebSocketBroadcastQueueDepth.Set(float64(len(h.broadcast)))
 	default:
 		// Channel is full, drop this message to prevent blocking
-		log.Println("Broadcast channel full, dropping message")
+		slog.Warn("Broadcast channel full, dropping message")
+		metrics.WebSocketDroppedMessages.WithLabelValues(metrics.DropHubFull).Inc()
+	}
+}
+
+// relay hands a message to the Redis bridge, which publishes it to the other replicas if it was
+// published on this one (see ws_bridge.go).
+func (h *Hub) relay(message hubMessage) {
+	if bridge := h.bridge.Load(); bridge != nil {
+		bridge.offer(message)
 	}
 }
 
@@ -146,67 +493,200 @@ func (h *Hub) Broadcast(message []byte) {
 // This function is called by Fiber for each new WebSocket connection.
 //
 // Flow:
-//   1. Client connects via WebSocket
-//   2. Register client with the hub
-//   3. Listen for messages from the client
-//   4. When client disconnects, unregister them
+//  1. Client connects via WebSocket
+//  2. Register client with the hub
+//  3. Listen for messages from the client
+//  4. When client disconnects, unregister them
 func WebSocketHandler(c *websocket.Conn) {
-	// Get the hub instance
+	// Step 1: Register this client with the hub
+	// This adds the client to the hub's clients map. The tenant was resolved from the
+	// request (see tenant.Resolve) before the upgrade; it scopes which updates we receive.
+	tenantID, _ := c.Locals(tenant.LocalsKey).(string)
+	userID, _ := c.Locals("user").(string)
+
+	// The message schema and encoding come from the negotiated subprotocol or ?schema= and
+	// ?encoding= (see ws_schema.go and ws_proto.go). Protobuf frames always use the schema 2
+	// envelope. Schema 2+ clients get a welcome message confirming it before any update.
+	queriedSchema, _ := c.Locals(schemaLocalsKey).(int)
+	queriedEncoding, _ := c.Locals(encodingLocalsKey).(string)
+	requestID, _ := c.Locals(logging.RequestIDKey).(string)
+	stats, _ := c.Locals(statsLocalsKey).(*connStats)
+	info := clientInfo{
+		tenant:    tenantID,
+		user:      userID,
+		schema:    resolveSchema(c.Subprotocol(), queriedSchema),
+		encoding:  resolveEncoding(c.Subprotocol(), queriedEncoding),
+		requestID: requestID,
+		stats:     stats,
+	}
+	if info.encoding == EncodingProtobuf {
+		info.schema = SchemaV2
+	}
+
+	// Every message written to the client is counted for the session log (see ws_stats.go)
+	counted := &countingConn{clientConn: c, stats: info.stats}
+	defer info.stats.log(info)
+
+	// Get the hub instance; without it the client is told to try again (another instance)
 	hub := GetHub()
 	if hub == nil {
-		log.Println("ERROR: WebSocket hub not initialized")
-		c.Close()
+		info.logger().Error("WebSocket hub not initialized")
+		closeClient(counted, info, NewCloseError(CloseDraining, "realtime updates are unavailable on this instance"))
 		return
 	}
+	if info.schema >= SchemaV2 {
+		if err := counted.WriteMessage(welcomeMessage(info)); err != nil {
+			info.stats.closed(reasonWriteFailed, 0)
+			c.Close()
+			return
+		}
+		info.stats.topic(MessageTypeWelcome)
+	}
 
-	// Step 1: Register this client with the hub
-	// This adds the client to the hub's clients map
-	hub.register <- c
+	// Hub messages are written by the client's write pump, replies and close messages by this
+	// goroutine (and price deltas by the batcher), so every write to the connection goes
+	// through a lock.
+	locked := &lockedConn{clientConn: counted}
+	var client clientConn = locked
+	var writer clientConn = locked
+
+	// Clients that connected with ?mode=delta get batched price_delta messages instead of
+	// price updates (see ws_delta.go)
+	if interval, _ := c.Locals(deltaLocalsKey).(time.Duration); interval > 0 {
+		info.delta = newDeltaBatcher(locked, info, interval)
+		go info.delta.Run()
+	}
+
+	// Clients that connected with ?price_meta=true get price updates with display metadata
+	// for their locale (see ws_price.go)
+	if format, ok := c.Locals(priceMetaLocalsKey).(*price.Format); ok && format != nil {
+		client = &priceMetaConn{clientConn: client, format: format}
+	}
+
+	// The write pump writes the hub's messages; it is ours, so we can wait for it below
+	info.send = newClientSender(client, info, hub.sendBuffer)
+	go info.send.run()
+	info.throttle = newTopicThrottle(info.send)
+	hub.register <- clientRegistration{conn: client, client: info}
 
 	// Step 2: Make sure we unregister when this function exits (client disconnects)
-	// The defer statement runs this code when the function ends
+	// The defer statement runs this code when the function ends. Closing the connection
+	// unblocks a write pump stuck on a slow client; nothing may write once we return.
 	defer func() {
-		hub.unregister <- c
+		hub.unregister <- client
+		info.throttle.stop()
+		info.send.stop()
+		if info.delta != nil {
+			info.delta.Stop()
+		}
+		c.Close()
+		info.send.wait()
 	}()
 
 	// Step 3: Listen for messages from this client
-	// This loop runs until the client disconnects
+	// This loop runs until the client disconnects. Clients sending more than
+	// WS_CLIENT_MESSAGE_LIMIT messages per second are disconnected with CloseRateLimited.
+	limiter := newMessageLimiter(getClientMessageLimit())
+	topics := clientTopics{hub: hub, conn: client}
 	for {
 		// Read a message from the client
 		messageType, msg, err := c.ReadMessage()
 		if err != nil {
+			info.stats.readFailed(err)
 			// Client disconnected or error occurred
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				info.logger().Warn("WebSocket error", "error", err)
 			}
 			break // Exit the loop, which will trigger the defer (unregister)
 		}
 
-		// For now, just echo the message back to the client
-		// TODO: Later, parse JSON messages like {"subscribe": "prices:artist123"}
-		//       to allow clients to subscribe to specific updates
+		info.stats.read(messageType, msg)
+		if !limiter.allow() {
+			info.logger().Warn("WebSocket client exceeded the message limit, disconnecting", "limit_per_second", limiter.max)
+			closeErr := NewCloseError(CloseRateLimited, "too many messages")
+			closeErr.RetryAfter = 1
+			closeClient(writer, info, closeErr)
+			break
+		}
+
+		// Every frame is answered with a protocol frame: an ack, a pong or an error (see wsproto)
+		info.logger().Debug("Received message from client", "message", string(msg))
+		reply := wsproto.Refuse("", &wsproto.Error{Code: wsproto.CodeInvalidFrame, Message: "frames must be JSON text"})
 		if messageType == websocket.TextMessage {
-			log.Printf("Received message from client: %s", string(msg))
-			
-			// Echo the message back to the client
-			if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
-				log.Printf("Error writing message: %v", err)
-				break // Exit if we can't write
-			}
+			reply = wsproto.Handle(msg, topics)
+		}
+		if reply.Type == wsproto.TypeError {
+			info.logger().Debug("Refused client frame", "reply", string(reply.Payload))
+		}
+		if err := writer.WriteMessage(websocket.TextMessage, reply.Encode()); err != nil {
+			info.logger().Warn("Error writing message", "error", err)
+			info.stats.closed(reasonWriteFailed, 0)
+			break // Exit if we can't write
 		}
 	}
 }
 
-// UpgradeWebSocket is a middleware function that checks if an HTTP request
+// UpgradeWebSocket returns the middleware that checks if an HTTP request
 // is trying to upgrade to a WebSocket connection.
-// This is required by Fiber to handle WebSocket upgrades.
-func UpgradeWebSocket(c *fiber.Ctx) error {
-	// Check if this is a WebSocket upgrade request
-	if websocket.IsWebSocketUpgrade(c) {
-		// Allow the request to proceed to the WebSocket handler
-		c.Locals("allowed", true)
-		return c.Next()
-	}
-	// Not a WebSocket request, return an error
-	return fiber.ErrUpgradeRequired
+// This is required by Fiber to handle WebSocket upgrades. The access token, if any, is validated
+// with cfg, and its tenant checked against the subdomain's (see tenant.Handshake).
+func UpgradeWebSocket(cfg config.Auth) fiber.Handler {
+	checkTenant := tenant.Handshake()
+
+	return func(c *fiber.Ctx) error {
+		// Check if this is a WebSocket upgrade request
+		if websocket.IsWebSocketUpgrade(c) {
+			// Allow the request to proceed to the WebSocket handler
+			c.Locals("allowed", true)
+
+			// Session statistics, logged when the connection ends (see ws_stats.go)
+			c.Locals(statsLocalsKey, newConnStats(c))
+
+			// Resolve the price display format now: the handshake carries the query and headers
+			c.Locals(priceMetaLocalsKey, price.FromRequest(c))
+
+			// Message schema and encoding requested with ?schema= and ?encoding=
+			// (subprotocols are negotiated by the upgrader)
+			schema, err := schemaFromQuery(c)
+			if err != nil {
+				return err
+			}
+			c.Locals(schemaLocalsKey, schema)
+
+			encoding, err := encodingFromQuery(c)
+			if err != nil {
+				return err
+			}
+			c.Locals(encodingLocalsKey, encoding)
+
+			// Delta mode requested with ?mode=delta (and optionally ?delta_interval=)
+			interval, err := deltaFromQuery(c)
+			if err != nil {
+				return err
+			}
+			c.Locals(deltaLocalsKey, interval)
+
+			// Optional user identity from the token subprotocol or ?token= (see ws_user.go).
+			// Anonymous clients still get public updates, but not user messages.
+			var claims jwt.MapClaims
+			if token := handshakeToken(c); token != "" {
+				userID, tokenClaims, err := middleware.UserFromToken(cfg, token)
+				if err != nil {
+					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+						"error": "Authentication failed",
+					})
+				}
+				c.Locals("user", userID)
+				claims = tokenClaims
+			}
+			// The connection's tenant scopes the updates it receives: tenant subdomains need a
+			// token of that tenant
+			if err := checkTenant(c, claims); err != nil {
+				return apperror.Write(c, err)
+			}
+			return c.Next()
+		}
+		// Not a WebSocket request, return an error
+		return fiber.ErrUpgradeRequired
+	}
 }
@@ -0,0 +1,274 @@
+package handlers
+
+// Fan-out across replicas.
+//
+// A hub only reaches the clients connected to its own replica. With WS_REDIS_BRIDGE=true, every
+// message published on a replica's hub (Broadcast, Publish, PublishToTopic, PublishToUser,
+// notifications, ...) is also published on a Redis pub/sub channel (WS_REDIS_CHANNEL). Every
+// replica subscribes to the channel and fans the other replicas' messages out to its own
+// clients, with their tenant, user and topics, and the same id and timestamp: a client gets the
+// message whichever replica it is connected to.
+//
+// Price and row changes come from the Realtime subscriber. With REALTIME_LEADER_ELECTION only the
+// leader consumes Realtime, so its changes are relayed like any other message; otherwise every
+// replica receives them itself, and relaying them would deliver them twice.
+//
+// Pub/sub delivers at most once: the messages published while a replica is disconnected from
+// Redis don't reach its clients (go-redis subscribes again once it reconnects). A replica's own
+// clients get its messages with or without Redis.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/leader"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// bridgeStartupName is the bridge's entry in the startup summary.
+const bridgeStartupName = "websocket.bridge"
+
+const (
+	bridgeQueueSize      = 1024            // Messages waiting to be published
+	bridgePublishTimeout = 5 * time.Second // Per publish, and for the initial subscribe
+)
+
+// Results of bridged messages, the "result" label of WebSocketBridgeMessages.
+const (
+	bridgePublished = "published"
+	bridgeReceived  = "received"
+	bridgeDropped   = "dropped"
+)
+
+// bridgeMessage is a hub message on the pub/sub channel.
+type bridgeMessage struct {
+	Origin string    `json:"origin"` // The publishing replica, which skips its own messages
+	ID     string    `json:"id"`
+	Kind   string    `json:"kind"`
+	TS     time.Time `json:"ts"`
+	Data   []byte    `json:"data"`
+	Tenant string    `json:"tenant,omitempty"`
+	Scoped bool      `json:"scoped,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Topics []string  `json:"topics,omitempty"`
+}
+
+// hubBridge relays a hub's messages to the other replicas' hubs, and theirs to it.
+type hubBridge struct {
+	client        *redis.Client
+	pubsub        *redis.PubSub
+	channel       string
+	origin        string // This replica's ID
+	relayRealtime bool   // A single replica consumes Realtime (see above)
+
+	outgoing chan hubMessage // Messages waiting to be published
+	cancel   context.CancelFunc
+	done     sync.WaitGroup
+}
+
+// newHubBridge creates a bridge with an empty queue and no connection; StartBridge connects it.
+func newHubBridge(channel string, relayRealtime bool) *hubBridge {
+	return &hubBridge{
+		channel:       channel,
+		origin:        leader.InstanceID(),
+		relayRealtime: relayRealtime,
+		outgoing:      make(chan hubMessage, bridgeQueueSize),
+	}
+}
+
+// StartBridge connects the default hub to the other replicas' hubs over Redis pub/sub when
+// cfg.RedisBridge is set (see above). realtimeElected reports whether a single replica consumes
+// Realtime, whose changes must then be relayed. Call it after InitHub; StopBridge disconnects.
+func StartBridge(cfg config.Hub, realtimeElected bool) error {
+	if !cfg.RedisBridge {
+		startup.Report(bridgeStartupName, true, "off, messages only reach this replica's clients")
+		return nil
+	}
+	hub := GetHub()
+	if hub == nil {
+		return errors.New("the WebSocket hub is not initialized")
+	}
+	if hub.bridge.Load() != nil {
+		return nil // Already started
+	}
+
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		startup.Report(bridgeStartupName, false, "invalid REDIS_URL")
+		return fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	// Wait for Redis to confirm the subscription, so a replica without Redis fails to start the
+	// bridge instead of silently missing the others' messages
+	ctx, cancel := context.WithTimeout(context.Background(), bridgePublishTimeout)
+	defer cancel()
+	pubsub := client.Subscribe(ctx, cfg.Channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		client.Close()
+		startup.Report(bridgeStartupName, false, err.Error())
+		return fmt.Errorf("failed to subscribe to %s: %w", cfg.Channel, err)
+	}
+
+	bridge := newHubBridge(cfg.Channel, realtimeElected)
+	bridge.client, bridge.pubsub = client, pubsub
+	bridge.start(hub)
+	hub.bridge.Store(bridge)
+
+	slog.Info("WebSocket Redis bridge started", "channel", cfg.Channel, "instance", bridge.origin, "relay_realtime", realtimeElected)
+	startup.Report(bridgeStartupName, true, "Redis pub/sub on "+cfg.Channel)
+	return nil
+}
+
+// StopBridge disconnects the default hub from the other replicas' hubs, dropping the messages not
+// published yet. It does nothing when the bridge isn't running.
+func StopBridge(ctx context.Context) error {
+	hub := GetHub()
+	if hub == nil {
+		return nil
+	}
+	bridge := hub.bridge.Swap(nil)
+	if bridge == nil {
+		return nil
+	}
+	return bridge.stop(ctx)
+}
+
+// start runs the publish and receive loops.
+func (b *hubBridge) start(hub *Hub) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.done.Add(2)
+	go func() {
+		defer b.done.Done()
+		b.publishLoop(ctx)
+	}()
+	go func() {
+		defer b.done.Done()
+		b.receiveLoop(ctx, hub)
+	}()
+}
+
+// stop ends the loops and closes the connections, waiting for the loops until ctx ends.
+func (b *hubBridge) stop(ctx context.Context) error {
+	b.cancel()
+	b.pubsub.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		b.done.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.client.Close()
+}
+
+// offer queues a message published on this replica for the other replicas, without blocking.
+// Messages received from the bridge, and Realtime changes every replica receives itself, are not
+// relayed.
+func (b *hubBridge) offer(message hubMessage) {
+	if message.origin != "" || (message.realtime && !b.relayRealtime) {
+		return
+	}
+	select {
+	case b.outgoing <- message:
+	default:
+		slog.Warn("WebSocket bridge queue full, not relaying message", "type", message.kind)
+		metrics.WebSocketBridgeMessages.WithLabelValues(bridgeDropped).Inc()
+	}
+}
+
+// publishLoop publishes the queued messages until ctx is cancelled.
+func (b *hubBridge) publishLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-b.outgoing:
+			payload, err := b.encode(message)
+			if err == nil {
+				publishCtx, cancel := context.WithTimeout(ctx, bridgePublishTimeout)
+				err = b.client.Publish(publishCtx, b.channel, payload).Err()
+				cancel()
+			}
+			if err != nil {
+				slog.Warn("Failed to relay WebSocket message to the other replicas", "type", message.kind, "error", err)
+				metrics.WebSocketBridgeMessages.WithLabelValues(bridgeDropped).Inc()
+				continue
+			}
+			metrics.WebSocketBridgeMessages.WithLabelValues(bridgePublished).Inc()
+		}
+	}
+}
+
+// receiveLoop fans the other replicas' messages out to this hub's clients until ctx is cancelled.
+func (b *hubBridge) receiveLoop(ctx context.Context, hub *Hub) {
+	messages := b.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case received, ok := <-messages:
+			if !ok {
+				return // Closed by stop
+			}
+			if message, ok := b.decode([]byte(received.Payload)); ok {
+				metrics.WebSocketBridgeMessages.WithLabelValues(bridgeReceived).Inc()
+				hub.enqueue(message)
+			}
+		}
+	}
+}
+
+// encode returns the pub/sub payload of a message published on this replica.
+func (b *hubBridge) encode(message hubMessage) ([]byte, error) {
+	return json.Marshal(bridgeMessage{
+		Origin: b.origin,
+		ID:     message.id,
+		Kind:   message.kind,
+		TS:     message.ts,
+		Data:   message.data,
+		Tenant: message.tenant,
+		Scoped: message.scoped,
+		User:   message.user,
+		Topics: message.topics,
+	})
+}
+
+// decode returns the hub message of a pub/sub payload, or false for this replica's own messages
+// and invalid payloads.
+func (b *hubBridge) decode(payload []byte) (hubMessage, bool) {
+	var received bridgeMessage
+	if err := json.Unmarshal(payload, &received); err != nil {
+		slog.Warn("Invalid message on the WebSocket bridge", "channel", b.channel, "error", err)
+		return hubMessage{}, false
+	}
+	if received.Origin == b.origin || received.Origin == "" {
+		return hubMessage{}, false // Our own (already fanned out), or not a replica's
+	}
+	return hubMessage{
+		data:   received.Data,
+		tenant: received.Tenant,
+		scoped: received.Scoped,
+		user:   received.User,
+		topics: received.Topics,
+		origin: received.Origin,
+		kind:   received.Kind,
+		ts:     received.TS,
+		id:     received.ID,
+	}, true
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+
+	"boilerplate/internal/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relayed returns the kinds of the messages waiting to be published by a bridge.
+func relayed(bridge *hubBridge) []string {
+	var kinds []string
+	for {
+		select {
+		case message := <-bridge.outgoing:
+			kinds = append(kinds, message.kind)
+		default:
+			return kinds
+		}
+	}
+}
+
+// TestHubBridge_Offer tests which messages are relayed to the other replicas: those published
+// here, and Realtime changes only when a single replica consumes Realtime.
+func TestHubBridge_Offer(t *testing.T) {
+	hub := newHub()
+	bridge := newHubBridge("ws:hub", false)
+	hub.bridge.Store(bridge)
+
+	hub.Broadcast([]byte(`{"notice": "maintenance"}`))
+	hub.PublishToUser("u1", MessageTypeNotification, []byte(`{}`))
+	hub.PublishPriceChange(events.PriceChanged{ArtistID: "a1"})
+	hub.PublishRowChange(events.RowChanged{Subscription: "listings", Topic: "listing_update"})
+	assert.Equal(t, []string{MessageTypeBroadcast, MessageTypeNotification}, relayed(bridge))
+
+	remote := newHubMessage(MessageTypeBroadcast, []byte(`{}`))
+	remote.origin = "other-replica"
+	hub.enqueue(remote)
+	assert.Empty(t, relayed(bridge), "messages from the bridge go back to no one")
+
+	bridge.relayRealtime = true
+	hub.PublishPriceChange(events.PriceChanged{ArtistID: "a1"})
+	assert.Equal(t, []string{MessageTypePriceUpdate}, relayed(bridge))
+}
+
+// TestHubBridge_RoundTrip tests that a message reaches the other replicas as published, and that
+// a replica skips its own messages.
+func TestHubBridge_RoundTrip(t *testing.T) {
+	sender, receiver := newHubBridge("ws:hub", true), newHubBridge("ws:hub", true)
+
+	message := newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a1","price":"45.67"}`))
+	message.tenant, message.scoped, message.user = "acme", true, "u1"
+	message.topics = []string{"prices:a1"}
+	payload, err := sender.encode(message)
+	require.NoError(t, err)
+
+	received, ok := receiver.decode(payload)
+	require.True(t, ok)
+	assert.Equal(t, sender.origin, received.origin)
+	received.origin = ""
+	assert.True(t, received.ts.Equal(message.ts))
+	received.ts = message.ts
+	assert.Equal(t, message, received)
+
+	_, ok = sender.decode(payload)
+	assert.False(t, ok, "a replica's own messages were already fanned out")
+	_, ok = receiver.decode([]byte("not json"))
+	assert.False(t, ok)
+}
+
+// TestHubBridge_FanOut tests that messages received from the bridge reach this replica's
+// clients.
+func TestHubBridge_FanOut(t *testing.T) {
+	hub := newHub()
+	conn := &recordingConn{}
+	hub.addClient(conn, clientInfo{schema: SchemaV1})
+
+	payload, err := newHubBridge("ws:hub", false).encode(newHubMessage(MessageTypeBroadcast, []byte("notice")))
+	require.NoError(t, err)
+	message, ok := newHubBridge("ws:hub", false).decode(payload)
+	require.True(t, ok)
+	hub.fanOut(message)
+	stopSenders(hub)
+	assert.Equal(t, [][]byte{[]byte("notice")}, conn.messages)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// Application close codes, sent in the close frame when the server disconnects a client.
+// RFC 6455 reserves 4000-4999 for applications; ours are 4000 + the matching HTTP status, so
+// client SDKs can decide whether and when to reconnect:
+//   - 4401: re-authenticate first (token missing, invalid or expired)
+//   - 4403: don't reconnect with the same credentials
+//   - 4408: reconnect with backoff (the client didn't read its messages fast enough)
+//   - 4429: reconnect after retry_after seconds
+//   - 4500: reconnect with backoff (also sent when the instance sheds load near its memory limit)
+//   - 4503: reconnect right away (the instance is draining; the load balancer picks another)
+const (
+	CloseUnauthorized  = 4401
+	CloseForbidden     = 4403
+	CloseSlowClient    = 4408
+	CloseRateLimited   = 4429
+	CloseInternalError = 4500
+	CloseDraining      = 4503
+)
+
+// closeReasons are the machine-readable reasons for each close code (the "error" field).
+var closeReasons = map[int]string{
+	CloseUnauthorized:  "unauthorized",
+	CloseForbidden:     "forbidden",
+	CloseSlowClient:    "slow_client",
+	CloseRateLimited:   "rate_limited",
+	CloseInternalError: "internal_error",
+	CloseDraining:      "draining",
+}
+
+// CloseError is the payload of the error message sent before the close frame:
+// {"error": "rate_limited", "code": 4429, "message": "...", "retry_after": 1}.
+// Schema 1 clients receive it bare, schema 2 clients as the data of an "error" envelope.
+type CloseError struct {
+	Error      string `json:"error"`                 // Machine-readable reason, e.g. "rate_limited"
+	Code       int    `json:"code"`                  // Close code, also sent in the close frame
+	Message    string `json:"message"`               // Human-readable explanation
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds to wait before reconnecting
+}
+
+// NewCloseError returns the error for a close code with a human-readable message.
+func NewCloseError(code int, message string) CloseError {
+	return CloseError{Error: closeReasons[code], Code: code, Message: message}
+}
+
+// closeWriteTimeout bounds how long closing waits on a client that doesn't read.
+const closeWriteTimeout = time.Second
+
+// closeClient tells a client why it is being disconnected, then closes the connection:
+// an error message in the client's schema and encoding, then a close frame with the code.
+// Errors are ignored: the connection is closed either way.
+func closeClient(conn clientConn, client clientInfo, closeErr CloseError) {
+	client.stats.closed(closeErr.Error, closeErr.Code)
+	setWriteDeadline(conn, time.Now().Add(closeWriteTimeout))
+
+	data, _ := json.Marshal(closeErr)
+	message := newHubMessage(MessageTypeError, data)
+	conn.WriteMessage(message.encodeFor(client))
+
+	// The close reason is limited to 123 bytes; the full message went in the error message
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeErr.Code, closeErr.Error))
+	conn.Close()
+}
+
+// CloseAll disconnects every client with closeErr, e.g. CloseDraining on shutdown, and
+// removes them from the hub. Each client's handler sees the closed connection and exits.
+func (h *Hub) CloseAll(closeErr CloseError) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for conn, client := range h.clients {
+		if client.send != nil {
+			client.send.stop()
+		}
+		closeClient(conn, client, closeErr)
+		delete(h.clients, conn)
+	}
+	metrics.WebSocketClients.Set(0)
+	slog.Info("Closed all WebSocket clients", "code", closeErr.Code, "reason", closeErr.Error)
+}
+
+// Shed disconnects about fraction (0-1] of the clients, at least one, with CloseInternalError so
+// they reconnect with backoff, possibly to another instance. Clients with the most messages
+// queued go first: they hold the most memory. It returns how many were disconnected. Registered
+// as the "websocket" shedder of the memory watchdog (see internal/memory).
+func (h *Hub) Shed(fraction float64) int {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) == 0 {
+		return 0
+	}
+	conns := make([]clientConn, 0, len(h.clients))
+	for conn := range h.clients {
+		conns = append(conns, conn)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return h.clients[conns[i]].queued() > h.clients[conns[j]].queued()
+	})
+
+	count := min(len(conns), max(1, int(math.Ceil(fraction*float64(len(conns))))))
+	closeErr := NewCloseError(CloseInternalError, "server is low on memory, reconnect later")
+	for _, conn := range conns[:count] {
+		client := h.clients[conn]
+		if client.send != nil {
+			client.send.stop()
+		}
+		closeClient(conn, client, closeErr)
+		delete(h.clients, conn)
+	}
+	metrics.WebSocketClients.Set(float64(len(h.clients)))
+	slog.Warn("Shed WebSocket clients near the memory limit", "closed", count, "clients", len(h.clients))
+	return count
+}
+
+// queued returns how many messages wait in the client's send buffer.
+func (c clientInfo) queued() int {
+	if c.send == nil {
+		return 0
+	}
+	return len(c.send.queue)
+}
+
+// messageLimiter counts the messages a client sends per second.
+type messageLimiter struct {
+	mu          sync.Mutex
+	max         int // Messages per second; 0 means unlimited
+	windowStart time.Time
+	count       int
+	now         func() time.Time // Overridable clock for tests
+}
+
+// newMessageLimiter returns a limiter allowing max messages per second (0: unlimited).
+func newMessageLimiter(max int) *messageLimiter {
+	return &messageLimiter{max: max, now: time.Now}
+}
+
+// allow records a message and reports whether the client is within its limit.
+func (l *messageLimiter) allow() bool {
+	if l.max <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.windowStart) >= time.Second {
+		l.windowStart, l.count = now, 0
+	}
+	l.count++
+	return l.count <= l.max
+}
+
+// getClientMessageLimit returns WS_CLIENT_MESSAGE_LIMIT, the messages per second a client may
+// send before it is disconnected with CloseRateLimited (default 20, 0 disables the limit).
+func getClientMessageLimit() int {
+	value := os.Getenv("WS_CLIENT_MESSAGE_LIMIT")
+	if value == "" {
+		return 20
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		slog.Warn("Invalid WS_CLIENT_MESSAGE_LIMIT, using 20", "value", value)
+		return 20
+	}
+	return limit
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"boilerplate/internal/realtimepb"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// frame is one message written to a closingConn.
+type frame struct {
+	messageType int
+	data        []byte
+}
+
+// closingConn records frames and whether it was closed.
+type closingConn struct {
+	frames []frame
+	closed bool
+}
+
+func (c *closingConn) WriteMessage(messageType int, data []byte) error {
+	c.frames = append(c.frames, frame{messageType, data})
+	return nil
+}
+
+func (c *closingConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// TestCloseClient tests the error message and close frame in each schema and encoding.
+func TestCloseClient(t *testing.T) {
+	closeErr := NewCloseError(CloseRateLimited, "too many messages")
+	closeErr.RetryAfter = 1
+
+	// Schema 1: the bare payload
+	conn := &closingConn{}
+	closeClient(conn, clientInfo{schema: SchemaV1}, closeErr)
+	require.Len(t, conn.frames, 2)
+	assert.Equal(t, websocket.TextMessage, conn.frames[0].messageType)
+	assert.JSONEq(t, `{"error":"rate_limited","code":4429,"message":"too many messages","retry_after":1}`, string(conn.frames[0].data))
+	assert.Equal(t, websocket.CloseMessage, conn.frames[1].messageType)
+	assert.Equal(t, websocket.FormatCloseMessage(4429, "rate_limited"), conn.frames[1].data)
+	assert.True(t, conn.closed)
+
+	// Schema 2: an error envelope
+	conn = &closingConn{}
+	closeClient(conn, clientInfo{schema: SchemaV2}, closeErr)
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(conn.frames[0].data, &envelope))
+	assert.Equal(t, MessageTypeError, envelope.Type)
+	assert.JSONEq(t, `{"error":"rate_limited","code":4429,"message":"too many messages","retry_after":1}`, string(envelope.Data))
+
+	// Protobuf: Envelope.error
+	conn = &closingConn{}
+	closeClient(conn, clientInfo{schema: SchemaV2, encoding: EncodingProtobuf}, NewCloseError(CloseDraining, "server shutting down"))
+	assert.Equal(t, websocket.BinaryMessage, conn.frames[0].messageType)
+	pb := &realtimepb.Envelope{}
+	require.NoError(t, proto.Unmarshal(conn.frames[0].data, pb))
+	assert.Equal(t, MessageTypeError, pb.GetType())
+	assert.Equal(t, int32(CloseDraining), pb.GetError().GetCode())
+	assert.Equal(t, "draining", pb.GetError().GetError())
+	assert.Equal(t, "server shutting down", pb.GetError().GetMessage())
+	assert.Equal(t, websocket.FormatCloseMessage(4503, "draining"), conn.frames[1].data)
+}
+
+// TestHub_CloseAll tests that every client is told why, closed and removed from the hub.
+func TestHub_CloseAll(t *testing.T) {
+	hub := newHub()
+	first, second := &closingConn{}, &closingConn{}
+	hub.clients[first] = clientInfo{schema: SchemaV1}
+	hub.clients[second] = clientInfo{tenant: "acme", schema: SchemaV2}
+
+	hub.CloseAll(NewCloseError(CloseDraining, "server shutting down"))
+
+	assert.Equal(t, 0, hub.ClientCount())
+	for _, conn := range []*closingConn{first, second} {
+		require.Len(t, conn.frames, 2)
+		assert.Equal(t, websocket.CloseMessage, conn.frames[1].messageType)
+		assert.True(t, conn.closed)
+	}
+
+	// A nil hub (not initialized) is a no-op
+	var nilHub *Hub
+	nilHub.CloseAll(NewCloseError(CloseDraining, "server shutting down"))
+}
+
+// TestHub_Shed tests that the clients with the most queued messages are closed first, and that at
+// least one is.
+func TestHub_Shed(t *testing.T) {
+	hub := newHub()
+	conns := make([]*closingConn, 4)
+	for i := range conns {
+		conns[i] = &closingConn{}
+		client := clientInfo{schema: SchemaV1}
+		client.send = newClientSender(conns[i], client, 8)
+		for j := 0; j < i; j++ {
+			client.send.enqueue(websocket.TextMessage, []byte("{}"))
+		}
+		hub.clients[conns[i]] = client
+	}
+
+	assert.Equal(t, 2, hub.Shed(0.5))
+	assert.Equal(t, 2, hub.ClientCount())
+	for i, conn := range conns {
+		assert.Equal(t, i >= 2, conn.closed, "client %d", i)
+	}
+	assert.JSONEq(t, `{"error":"internal_error","code":4500,"message":"server is low on memory, reconnect later"}`, string(conns[3].frames[0].data))
+
+	assert.Equal(t, 1, hub.Shed(0.01))
+	assert.Equal(t, 1, hub.ClientCount())
+
+	var nilHub *Hub
+	assert.Equal(t, 0, nilHub.Shed(0.5))
+	assert.Equal(t, 0, newHub().Shed(0.5))
+}
+
+// TestMessageLimiter tests the per-second message window.
+func TestMessageLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newMessageLimiter(2)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.allow())
+	assert.True(t, limiter.allow())
+	assert.False(t, limiter.allow())
+
+	now = now.Add(time.Second)
+	assert.True(t, limiter.allow(), "new window")
+
+	unlimited := newMessageLimiter(0)
+	for i := 0; i < 100; i++ {
+		assert.True(t, unlimited.allow())
+	}
+}
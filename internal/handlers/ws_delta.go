@@ -0,0 +1,243 @@
+package handlers
+
+// Delta-only update mode.
+//
+// Clients watching many artists can connect with ?mode=delta. Instead of one message per price
+// change, they receive a "price_delta" message every interval (?delta_interval=, default
+// WS_DELTA_INTERVAL) holding only the latest price of each artist that changed since the previous
+// frame. Intervals without changes send nothing. Other message types are delivered immediately.
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Update modes.
+const (
+	ModeFull  = "full"  // One message per change (the default)
+	ModeDelta = "delta" // Batched price_delta messages on an interval
+)
+
+// Delta interval bounds; requested intervals are clamped to them.
+const (
+	minDeltaInterval     = 100 * time.Millisecond
+	maxDeltaInterval     = time.Minute
+	defaultDeltaInterval = time.Second
+)
+
+// deltaLocalsKey is where UpgradeWebSocket stores the delta interval (0 for full mode).
+const deltaLocalsKey = "ws_delta_interval"
+
+// PriceDelta is the data of a price_delta message.
+type PriceDelta struct {
+	Prices  map[string]string `json:"prices"`            // artist_id -> latest exact decimal price
+	Removed []string          `json:"removed,omitempty"` // Artists deleted since the previous frame
+}
+
+// getDeltaInterval returns WS_DELTA_INTERVAL, defaulting to one second.
+func getDeltaInterval() time.Duration {
+	if raw := os.Getenv("WS_DELTA_INTERVAL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			return clampDeltaInterval(parsed)
+		}
+		slog.Warn("Invalid WS_DELTA_INTERVAL, using 1s", "value", raw)
+	}
+	return defaultDeltaInterval
+}
+
+// clampDeltaInterval keeps an interval between minDeltaInterval and maxDeltaInterval.
+func clampDeltaInterval(interval time.Duration) time.Duration {
+	if interval < minDeltaInterval {
+		return minDeltaInterval
+	}
+	if interval > maxDeltaInterval {
+		return maxDeltaInterval
+	}
+	return interval
+}
+
+// deltaFromQuery resolves ?mode= and ?delta_interval= to the connection's delta interval
+// (0 for full mode).
+func deltaFromQuery(c *fiber.Ctx) (time.Duration, error) {
+	switch c.Query("mode") {
+	case "", ModeFull:
+		if c.Query("delta_interval") != "" {
+			return 0, fiber.NewError(fiber.StatusBadRequest, "delta_interval requires mode=delta")
+		}
+		return 0, nil
+	case ModeDelta:
+	default:
+		return 0, fiber.NewError(fiber.StatusBadRequest, "mode must be full or delta")
+	}
+
+	raw := c.Query("delta_interval")
+	if raw == "" {
+		return getDeltaInterval(), nil
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "delta_interval must be a positive duration (e.g. 500ms)")
+	}
+	return clampDeltaInterval(interval), nil
+}
+
+// priceChange is the part of a price update a delta batch keeps.
+type priceChange struct {
+	artistID string
+	price    string
+	removed  bool
+}
+
+// priceChange parses a price_update message once per message (nil if it is not one).
+func (m *hubMessage) priceChange() *priceChange {
+	if m.kind != MessageTypePriceUpdate {
+		return nil
+	}
+	if m.change == nil {
+		var update struct {
+			ArtistID string      `json:"artist_id"`
+			Price    json.Number `json:"price"`
+			Event    string      `json:"event"`
+		}
+		if err := json.Unmarshal(m.data, &update); err != nil || update.ArtistID == "" {
+			m.change = &priceChange{} // Unparseable: remembered so it is not parsed again
+		} else {
+			m.change = &priceChange{artistID: update.ArtistID, price: update.Price.String(), removed: update.Event == "DELETE"}
+		}
+	}
+	if m.change.artistID == "" {
+		return nil
+	}
+	return m.change
+}
+
+// deltaBatcher collects one client's price changes and writes them as a price_delta message
+// every interval. The hub adds changes from its goroutine; the batcher writes from its own, so
+// the connection it writes to must be safe for concurrent writes (see lockedConn).
+type deltaBatcher struct {
+	conn     clientConn
+	client   clientInfo
+	interval time.Duration
+
+	mu      sync.Mutex
+	prices  map[string]string
+	removed map[string]bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newDeltaBatcher creates a batcher writing to conn in client's schema and encoding. Call Run to start it.
+func newDeltaBatcher(conn clientConn, client clientInfo, interval time.Duration) *deltaBatcher {
+	return &deltaBatcher{
+		conn:     conn,
+		client:   client,
+		interval: interval,
+		prices:   make(map[string]string),
+		removed:  make(map[string]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// add records a change; a later change of the same artist replaces it.
+func (b *deltaBatcher) add(change *priceChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if change.removed {
+		delete(b.prices, change.artistID)
+		b.removed[change.artistID] = true
+		return
+	}
+	delete(b.removed, change.artistID)
+	b.prices[change.artistID] = change.price
+}
+
+// take returns the pending changes and starts a new batch (nil if nothing changed).
+func (b *deltaBatcher) take() *PriceDelta {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.prices) == 0 && len(b.removed) == 0 {
+		return nil
+	}
+	delta := &PriceDelta{Prices: b.prices}
+	for artistID := range b.removed {
+		delta.Removed = append(delta.Removed, artistID)
+	}
+	sort.Strings(delta.Removed)
+
+	b.prices = make(map[string]string)
+	b.removed = make(map[string]bool)
+	return delta
+}
+
+// flush writes the pending changes, if any.
+func (b *deltaBatcher) flush() error {
+	delta := b.take()
+	if delta == nil {
+		return nil
+	}
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+	message := newHubMessage(MessageTypePriceDelta, data)
+	return b.conn.WriteMessage(message.encodeFor(b.client))
+}
+
+// Run flushes every interval until Stop is called. A failed write stops the batcher; the
+// connection's read loop notices the broken connection and cleans up.
+func (b *deltaBatcher) Run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.flush(); err != nil {
+				b.client.logger().Warn("Error sending price delta to client", "error", err)
+				return
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Stop stops Run and waits for it to return, so nothing is written after the connection closes.
+func (b *deltaBatcher) Stop() {
+	close(b.stop)
+	<-b.done
+}
+
+// lockedConn serializes writes to a connection written from more than one goroutine
+// (the write pump, the connection's handler and a deltaBatcher).
+type lockedConn struct {
+	clientConn
+	mu sync.Mutex
+}
+
+// WriteMessage writes a message while holding the connection's write lock.
+func (c *lockedConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clientConn.WriteMessage(messageType, data)
+}
+
+// SetWriteDeadline sets the write deadline of the next writes, once the current one is done.
+func (c *lockedConn) SetWriteDeadline(deadline time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	setWriteDeadline(c.clientConn, deadline)
+	return nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"boilerplate/internal/realtimepb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestHub_FanOutDelta tests that delta clients collect price updates into one batch with the
+// latest price per artist, while other messages are delivered immediately.
+func TestHub_FanOutDelta(t *testing.T) {
+	hub := newHub()
+	conn := &recordingConn{}
+	batcher := newDeltaBatcher(conn, clientInfo{schema: SchemaV1}, time.Second)
+	hub.addClient(conn, clientInfo{schema: SchemaV1, delta: batcher})
+
+	hub.fanOut(newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a1","price":"1.5","event":"UPDATE"}`)))
+	hub.fanOut(newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a2","price":"7","event":"INSERT"}`)))
+	hub.fanOut(newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a1","price":"2.25","event":"UPDATE"}`)))
+	hub.fanOut(newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a3","price":"3","event":"DELETE"}`)))
+	hub.fanOut(newHubMessage(MessageTypeBroadcast, []byte(`{"notice":"hi"}`)))
+	stopSenders(hub)
+
+	require.Len(t, conn.messages, 1) // Only the broadcast so far
+	assert.JSONEq(t, `{"notice":"hi"}`, string(conn.messages[0]))
+
+	require.NoError(t, batcher.flush())
+	require.Len(t, conn.messages, 2)
+	assert.JSONEq(t, `{"prices":{"a1":"2.25","a2":"7"},"removed":["a3"]}`, string(conn.messages[1]))
+
+	// Nothing changed since: nothing is sent
+	require.NoError(t, batcher.flush())
+	assert.Len(t, conn.messages, 2)
+}
+
+// TestDeltaBatcher_Encodings tests price_delta messages in the schema 2 envelope and protobuf.
+func TestDeltaBatcher_Encodings(t *testing.T) {
+	change := &priceChange{artistID: "a1", price: "45.67"}
+
+	enveloped := &recordingConn{}
+	batcher := newDeltaBatcher(enveloped, clientInfo{schema: SchemaV2}, time.Second)
+	batcher.add(change)
+	require.NoError(t, batcher.flush())
+	require.Len(t, enveloped.messages, 1)
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(enveloped.messages[0], &envelope))
+	assert.Equal(t, MessageTypePriceDelta, envelope.Type)
+	assert.JSONEq(t, `{"prices":{"a1":"45.67"}}`, string(envelope.Data))
+
+	binary := &recordingConn{}
+	batcher = newDeltaBatcher(binary, clientInfo{schema: SchemaV2, encoding: EncodingProtobuf}, time.Second)
+	batcher.add(change)
+	batcher.add(&priceChange{artistID: "a2", removed: true})
+	require.NoError(t, batcher.flush())
+	require.Len(t, binary.messages, 1)
+	decoded := &realtimepb.Envelope{}
+	require.NoError(t, proto.Unmarshal(binary.messages[0], decoded))
+	assert.Equal(t, map[string]string{"a1": "45.67"}, decoded.GetPriceDelta().GetPrices())
+	assert.Equal(t, []string{"a2"}, decoded.GetPriceDelta().GetRemoved())
+}
+
+// TestClampDeltaInterval tests the interval bounds and the WS_DELTA_INTERVAL default.
+func TestClampDeltaInterval(t *testing.T) {
+	assert.Equal(t, minDeltaInterval, clampDeltaInterval(time.Millisecond))
+	assert.Equal(t, maxDeltaInterval, clampDeltaInterval(time.Hour))
+	assert.Equal(t, 500*time.Millisecond, clampDeltaInterval(500*time.Millisecond))
+
+	t.Setenv("WS_DELTA_INTERVAL", "250ms")
+	assert.Equal(t, 250*time.Millisecond, getDeltaInterval())
+	t.Setenv("WS_DELTA_INTERVAL", "soon")
+	assert.Equal(t, defaultDeltaInterval, getDeltaInterval())
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"boilerplate/internal/price"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// priceMetaLocalsKey is where UpgradeWebSocket stores the client's price format (nil if the
+// client did not ask for price metadata).
+const priceMetaLocalsKey = "price_format"
+
+// priceMetaConn adds a "price_meta" object (currency, precision, display string) to every
+// price update written to a client that connected with ?price_meta=true. The hub broadcasts the
+// same bytes to everyone; the per-client locale is applied here, on the way out.
+type priceMetaConn struct {
+	clientConn
+	format *price.Format
+}
+
+// WriteMessage writes message, adding price metadata to price updates.
+func (c *priceMetaConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.BinaryMessage {
+		return c.clientConn.WriteMessage(messageType, addPriceMetaProtobuf(data, c.format))
+	}
+	return c.clientConn.WriteMessage(messageType, addPriceMeta(data, c.format))
+}
+
+// SetWriteDeadline sets the write deadline of the wrapped connection.
+func (c *priceMetaConn) SetWriteDeadline(deadline time.Time) error {
+	setWriteDeadline(c.clientConn, deadline)
+	return nil
+}
+
+// addPriceMeta returns data with "price_meta" added if it is a price update
+// ({"artist_id": ..., "price": "45.67"}, bare or as the data of a schema 2 envelope);
+// anything else is returned unchanged.
+func addPriceMeta(data []byte, format *price.Format) []byte {
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return data
+	}
+
+	// Schema 2: rewrite the envelope's data
+	if _, ok := message["version"]; ok {
+		var kind string
+		if err := json.Unmarshal(message["type"], &kind); err != nil || kind != MessageTypePriceUpdate {
+			return data
+		}
+		message["data"] = addPriceMeta(message["data"], format)
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			return data
+		}
+		return encoded
+	}
+
+	if _, ok := message["artist_id"]; !ok {
+		return data
+	}
+	var rawPrice interface{}
+	if err := json.Unmarshal(message["price"], &rawPrice); err != nil {
+		return data
+	}
+	amount, err := price.Parse(rawPrice)
+	if err != nil {
+		return data
+	}
+
+	meta, err := json.Marshal(format.Describe(amount))
+	if err != nil {
+		return data
+	}
+	message["price_meta"] = meta
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return data
+	}
+	return encoded
+}
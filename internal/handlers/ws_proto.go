@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"boilerplate/internal/price"
+	"boilerplate/internal/realtimepb"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Message encodings. Protobuf clients receive binary frames, each one realtimepb.Envelope
+// (see internal/realtimepb/realtime.proto); they always get the schema 2 envelope semantics.
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// protobufSubprotocol selects protobuf frames during the handshake (alternative to ?encoding=protobuf).
+const protobufSubprotocol = "app.ws.proto"
+
+// encodingLocalsKey is where UpgradeWebSocket stores the encoding requested with ?encoding=.
+const encodingLocalsKey = "ws_encoding"
+
+// protoJSON reads the JSON payloads into the generated types; unknown fields are dropped
+// (new JSON fields appear in protobuf once they are added to realtime.proto).
+var protoJSON = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// encodingFromQuery resolves ?encoding= ("" if absent).
+func encodingFromQuery(c *fiber.Ctx) (string, error) {
+	switch encoding := c.Query("encoding"); encoding {
+	case "", EncodingJSON, EncodingProtobuf:
+		return encoding, nil
+	default:
+		return "", fiber.NewError(fiber.StatusBadRequest, "encoding must be json or protobuf")
+	}
+}
+
+// resolveEncoding picks a connection's encoding: the protobuf subprotocol, then ?encoding=, then JSON.
+func resolveEncoding(subprotocol, queried string) string {
+	if subprotocol == protobufSubprotocol || queried == EncodingProtobuf {
+		return EncodingProtobuf
+	}
+	return EncodingJSON
+}
+
+// encodeProtobuf returns the message as a binary realtimepb.Envelope, built once per message.
+func (m *hubMessage) encodeProtobuf() []byte {
+	if m.protobuf == nil {
+		envelope := &realtimepb.Envelope{
+			Type:    m.kind,
+			Version: SchemaV2,
+			Ts:      timestamppb.New(m.ts),
+			Id:      m.id,
+		}
+		setProtobufData(envelope, m.data)
+
+		encoded, err := proto.Marshal(envelope)
+		if err != nil {
+			return nil
+		}
+		m.protobuf = encoded
+	}
+	return m.protobuf
+}
+
+// setProtobufData fills the envelope's oneof from the JSON payload, by message type.
+// Payloads that don't parse, and types the schema doesn't know yet, are left unset.
+func setProtobufData(envelope *realtimepb.Envelope, data []byte) {
+	switch envelope.Type {
+	case MessageTypePriceUpdate:
+		update := &realtimepb.PriceUpdate{}
+		if err := protoJSON.Unmarshal(data, update); err == nil {
+			envelope.Data = &realtimepb.Envelope_PriceUpdate{PriceUpdate: update}
+		}
+	case MessageTypePriceDelta:
+		delta := &realtimepb.PriceDelta{}
+		if err := protoJSON.Unmarshal(data, delta); err == nil {
+			envelope.Data = &realtimepb.Envelope_PriceDelta{PriceDelta: delta}
+		}
+	case MessageTypeWelcome:
+		welcome := &realtimepb.Welcome{}
+		if err := protoJSON.Unmarshal(data, welcome); err == nil {
+			envelope.Data = &realtimepb.Envelope_Welcome{Welcome: welcome}
+		}
+	case MessageTypeBroadcast:
+		envelope.Data = &realtimepb.Envelope_Broadcast{Broadcast: &realtimepb.Broadcast{Json: data}}
+	case MessageTypeError:
+		closeErr := &realtimepb.Error{}
+		if err := protoJSON.Unmarshal(data, closeErr); err == nil {
+			envelope.Data = &realtimepb.Envelope_Error{Error: closeErr}
+		}
+	case MessageTypePreferences:
+		envelope.Data = &realtimepb.Envelope_Preferences{Preferences: &realtimepb.Preferences{Json: data}}
+	}
+}
+
+// addPriceMetaProtobuf is addPriceMeta for protobuf frames.
+func addPriceMetaProtobuf(data []byte, format *price.Format) []byte {
+	envelope := &realtimepb.Envelope{}
+	if err := proto.Unmarshal(data, envelope); err != nil {
+		return data
+	}
+	update := envelope.GetPriceUpdate()
+	if update == nil {
+		return data
+	}
+	amount, err := price.Parse(update.GetPrice())
+	if err != nil {
+		return data
+	}
+
+	meta := format.Describe(amount)
+	update.PriceMeta = &realtimepb.PriceMeta{
+		Currency:  meta.Currency,
+		Precision: int32(meta.Precision),
+		Amount:    meta.Amount,
+		Display:   meta.Display,
+		Locale:    meta.Locale,
+	}
+
+	encoded, err := proto.Marshal(envelope)
+	if err != nil {
+		return data
+	}
+	return encoded
+}
+
+// frameType returns the WebSocket frame type for an encoding.
+func frameType(encoding string) int {
+	if encoding == EncodingProtobuf {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
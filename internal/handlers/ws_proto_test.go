@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"testing"
+
+	"boilerplate/internal/realtimepb"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestHubMessage_EncodeProtobuf tests the protobuf envelope for each message type.
+func TestHubMessage_EncodeProtobuf(t *testing.T) {
+	protobufClient := clientInfo{schema: SchemaV2, encoding: EncodingProtobuf}
+
+	message := newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a1","price":"45.67","event":"UPDATE","tenant_id":"acme"}`))
+	frameType, data := message.encodeFor(protobufClient)
+	assert.Equal(t, websocket.BinaryMessage, frameType)
+
+	envelope := &realtimepb.Envelope{}
+	require.NoError(t, proto.Unmarshal(data, envelope))
+	assert.Equal(t, MessageTypePriceUpdate, envelope.GetType())
+	assert.Equal(t, int32(SchemaV2), envelope.GetVersion())
+	assert.Equal(t, message.id, envelope.GetId())
+	assert.Equal(t, message.ts, envelope.GetTs().AsTime())
+	update := envelope.GetPriceUpdate()
+	require.NotNil(t, update)
+	assert.Equal(t, "a1", update.GetArtistId())
+	assert.Equal(t, "45.67", update.GetPrice())
+	assert.Equal(t, "acme", update.GetTenantId())
+
+	// Smaller than the JSON envelope carrying the same update
+	_, jsonData := message.encodeFor(clientInfo{schema: SchemaV2})
+	assert.Less(t, len(data), len(jsonData))
+
+	// Broadcasts carry their free-form JSON as bytes
+	broadcast := newHubMessage(MessageTypeBroadcast, []byte(`{"notice":"hi"}`))
+	_, data = broadcast.encodeFor(protobufClient)
+	envelope = &realtimepb.Envelope{}
+	require.NoError(t, proto.Unmarshal(data, envelope))
+	assert.JSONEq(t, `{"notice":"hi"}`, string(envelope.GetBroadcast().GetJson()))
+}
+
+// TestAddPriceMetaProtobuf tests price metadata on protobuf frames.
+func TestAddPriceMetaProtobuf(t *testing.T) {
+	message := newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a1","price":"2"}`))
+	data := addPriceMetaProtobuf(message.encodeProtobuf(), testPriceFormat)
+
+	envelope := &realtimepb.Envelope{}
+	require.NoError(t, proto.Unmarshal(data, envelope))
+	meta := envelope.GetPriceUpdate().GetPriceMeta()
+	require.NotNil(t, meta)
+	assert.Equal(t, "USD", meta.GetCurrency())
+	assert.Equal(t, "2.00", meta.GetAmount())
+	assert.Equal(t, "$2.00", meta.GetDisplay())
+
+	// Anything else passes through
+	assert.Equal(t, []byte("garbage"), addPriceMetaProtobuf([]byte("garbage"), testPriceFormat))
+}
@@ -0,0 +1,191 @@
+package handlers
+
+// Realtime queue.
+//
+// The Realtime subscriber publishes its changes on the event bus, in its own goroutine. The hub
+// doesn't hand them straight to its broadcast channel, which drops what doesn't fit: they go
+// through a bounded queue (WS_REALTIME_QUEUE messages), which a pump moves into the hub as fast
+// as the hub takes them. A bulk update of thousands of rows is smoothed out instead of
+// overflowing the hub:
+//
+//   - Conflation: a change of a price or row still waiting in the queue is replaced by the newer
+//     one, in place. Clients get the latest state of each row, only later than the intermediate
+//     ones would have arrived.
+//   - Backpressure: when the queue is full of distinct rows, the subscriber waits for room, up to
+//     WS_REALTIME_QUEUE_TIMEOUT, which slows down how fast it reads Realtime. Only a change still
+//     without room then is dropped, and counted (reason realtime_queue_full).
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"boilerplate/internal/metrics"
+)
+
+// Realtime queue defaults (WS_REALTIME_QUEUE, WS_REALTIME_QUEUE_TIMEOUT).
+const (
+	defaultRealtimeQueueSize    = 4096
+	defaultRealtimeQueueTimeout = 2 * time.Second
+)
+
+// realtimeQueue is a bounded FIFO of hub messages in which a message replaces the waiting one
+// with the same key.
+type realtimeQueue struct {
+	size    int
+	timeout time.Duration
+
+	mu      sync.Mutex
+	order   []string              // Keys, oldest first
+	pending map[string]hubMessage // By key
+	seq     uint64                // Makes keys of messages that are never conflated
+
+	ready chan struct{} // Signalled when a message is added
+	room  chan struct{} // Signalled when a message is taken
+}
+
+func newRealtimeQueue(size int, timeout time.Duration) *realtimeQueue {
+	return &realtimeQueue{
+		size:    size,
+		timeout: timeout,
+		pending: make(map[string]hubMessage),
+		ready:   make(chan struct{}, 1),
+		room:    make(chan struct{}, 1),
+	}
+}
+
+// push adds a message, replacing the waiting message with the same key ("": never replaced).
+// When the queue is full it waits for room, up to the queue's timeout; it returns false if the
+// message was dropped.
+func (q *realtimeQueue) push(key string, message hubMessage) bool {
+	var waited time.Time
+	var timeout <-chan time.Time
+	for {
+		q.mu.Lock()
+		if _, ok := q.pending[key]; ok && key != "" {
+			q.pending[key] = message // Keeps its place in the queue
+			q.mu.Unlock()
+			metrics.WebSocketRealtimeQueueConflated.Inc()
+			return true
+		}
+		if len(q.order) < q.size {
+			if key == "" {
+				q.seq++
+				key = "\x00" + strconv.FormatUint(q.seq, 10)
+			}
+			q.order = append(q.order, key)
+			q.pending[key] = message
+			metrics.WebSocketRealtimeQueueDepth.Set(float64(len(q.order)))
+			q.mu.Unlock()
+			signal(q.ready)
+			if !waited.IsZero() {
+				metrics.WebSocketRealtimeBackpressure.Add(time.Since(waited).Seconds())
+			}
+			return true
+		}
+		q.mu.Unlock()
+
+		// Full: wait for the pump to take a message
+		if timeout == nil {
+			waited = time.Now()
+			timer := time.NewTimer(q.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-q.room:
+		case <-timeout:
+			slog.Warn("Realtime queue full, dropping change", "type", message.kind, "queued", q.size)
+			metrics.WebSocketRealtimeBackpressure.Add(time.Since(waited).Seconds())
+			metrics.WebSocketDroppedMessages.WithLabelValues(metrics.DropRealtimeQueueFull).Inc()
+			return false
+		}
+	}
+}
+
+// pop removes the oldest message, waiting for one if the queue is empty.
+func (q *realtimeQueue) pop() hubMessage {
+	for {
+		q.mu.Lock()
+		if len(q.order) > 0 {
+			key := q.order[0]
+			q.order[0] = ""
+			q.order = q.order[1:]
+			message := q.pending[key]
+			delete(q.pending, key)
+			metrics.WebSocketRealtimeQueueDepth.Set(float64(len(q.order)))
+			q.mu.Unlock()
+			signal(q.room)
+			return message
+		}
+		q.mu.Unlock()
+		<-q.ready
+	}
+}
+
+// len returns the number of waiting messages.
+func (q *realtimeQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.order)
+}
+
+// signal wakes up the waiter of a one-slot channel, if any, without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// queueRealtime queues a Realtime change for the hub (see above). Messages with the same key
+// replace each other while they wait.
+func (h *Hub) queueRealtime(key string, message hubMessage) {
+	if h == nil {
+		return
+	}
+	h.realtime.push(key, message)
+}
+
+// pumpRealtime moves the queued Realtime changes into the hub, waiting while its broadcast
+// channel is full. It runs forever, like Run.
+func (h *Hub) pumpRealtime() {
+	for {
+		message := h.realtime.pop()
+		h.relay(message)
+		h.broadcast <- message
+		metrics.WebSocketBroadcastQueueDepth.Set(float64(len(h.broadcast)))
+	}
+}
+
+// getRealtimeQueueSize returns WS_REALTIME_QUEUE, the Realtime changes waiting for the hub before
+// the subscriber has to wait (default 4096).
+func getRealtimeQueueSize() int {
+	value := os.Getenv("WS_REALTIME_QUEUE")
+	if value == "" {
+		return defaultRealtimeQueueSize
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		slog.Warn("Invalid WS_REALTIME_QUEUE, using the default", "value", value, "default", defaultRealtimeQueueSize)
+		return defaultRealtimeQueueSize
+	}
+	return size
+}
+
+// getRealtimeQueueTimeout returns WS_REALTIME_QUEUE_TIMEOUT, how long the subscriber waits for
+// room in a full Realtime queue before dropping a change (default 2s, 0 to drop at once).
+func getRealtimeQueueTimeout() time.Duration {
+	value := os.Getenv("WS_REALTIME_QUEUE_TIMEOUT")
+	if value == "" {
+		return defaultRealtimeQueueTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		slog.Warn("Invalid WS_REALTIME_QUEUE_TIMEOUT, using the default", "value", value, "default", defaultRealtimeQueueTimeout.String())
+		return defaultRealtimeQueueTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRealtimeQueue_Conflation tests that a change replaces the waiting change of the same row in
+// place, while unkeyed changes are all kept, in order.
+func TestRealtimeQueue_Conflation(t *testing.T) {
+	queue := newRealtimeQueue(10, time.Second)
+	for _, push := range []struct{ key, data string }{
+		{"prices:a1", "a1: 1"}, {"prices:a2", "a2: 1"}, {"", "row"}, {"prices:a1", "a1: 2"}, {"", "row"},
+	} {
+		require.True(t, queue.push(push.key, newHubMessage(MessageTypePriceUpdate, []byte(push.data))))
+	}
+
+	var popped []string
+	for queue.len() > 0 {
+		popped = append(popped, string(queue.pop().data))
+	}
+	assert.Equal(t, []string{"a1: 2", "a2: 1", "row", "row"}, popped)
+
+	require.True(t, queue.push("prices:a1", newHubMessage(MessageTypePriceUpdate, []byte("a1: 3"))))
+	assert.Equal(t, "a1: 3", string(queue.pop().data), "taken changes are not conflated")
+}
+
+// TestRealtimeQueue_Backpressure tests that a push into a full queue waits for room, and drops
+// the change once the timeout passes.
+func TestRealtimeQueue_Backpressure(t *testing.T) {
+	queue := newRealtimeQueue(1, 50*time.Millisecond)
+	require.True(t, queue.push("prices:a1", newHubMessage(MessageTypePriceUpdate, []byte("a1"))))
+	require.True(t, queue.push("prices:a1", newHubMessage(MessageTypePriceUpdate, []byte("a1: 2"))), "conflated without room")
+
+	started := time.Now()
+	assert.False(t, queue.push("prices:a2", newHubMessage(MessageTypePriceUpdate, []byte("a2"))))
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	queue.timeout = time.Second
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		queue.pop()
+	}()
+	assert.True(t, queue.push("prices:a2", newHubMessage(MessageTypePriceUpdate, []byte("a2"))), "room made while waiting")
+	assert.Equal(t, "a2", string(queue.pop().data))
+}
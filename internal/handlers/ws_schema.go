@@ -0,0 +1,195 @@
+package handlers
+
+// WebSocket message schema versioning.
+//
+// Clients declare the schema they support during the handshake, either as a subprotocol
+// (Sec-WebSocket-Protocol: app.ws.v2, listing every version they understand) or with ?schema=2.
+// Clients that declare nothing get schema 1, the original bare messages, so existing apps keep
+// working. Schema 2 wraps every server-pushed message in an envelope:
+//
+//	{"type": "price_update", "version": 2, "data": {...}, "ts": "2024-01-01T12:00:00Z", "id": "..."}
+//
+// Compatibility policy: within a schema version, changes are additive only (new message types,
+// new fields in data); clients must ignore types and fields they don't know. Removing or renaming
+// anything needs a new schema version, and the previous one keeps being served until it is retired
+// from SchemaOldest. A client asking for a newer version than the server knows gets SchemaLatest.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Schema versions.
+const (
+	SchemaV1 = 1 // The bare payload, e.g. {"artist_id": ..., "price": ..., "event": ...}
+	SchemaV2 = 2 // The payload wrapped in an Envelope
+
+	SchemaOldest = SchemaV1
+	SchemaLatest = SchemaV2
+)
+
+// Message types (the envelope's "type").
+const (
+	MessageTypePriceUpdate  = "price_update" // Realtime price changes
+	MessageTypePriceDelta   = "price_delta"  // Batched price changes for ?mode=delta clients
+	MessageTypeBroadcast    = "broadcast"    // Admin broadcasts (POST /api/admin/broadcast)
+	MessageTypeWelcome      = "welcome"      // First message on schema 2+ connections
+	MessageTypeError        = "error"        // Sent just before the server closes a connection (see ws_close.go)
+	MessageTypePreferences  = "preferences"  // The user's preferences changed (clients that connected with ?token=)
+	MessageTypeNotification = "notification" // A notification for the user (clients that connected with ?token=, see internal/notify)
+)
+
+// schemaSubprotocolPrefix is the subprotocol form of a schema version (app.ws.v2).
+const schemaSubprotocolPrefix = "app.ws.v"
+
+// schemaLocalsKey is where UpgradeWebSocket stores the schema requested with ?schema=.
+const schemaLocalsKey = "ws_schema"
+
+// Envelope is the schema 2 wrapper around every server-pushed message.
+type Envelope struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+	TS      time.Time       `json:"ts"`
+	ID      string          `json:"id"` // Unique per message, the same for every recipient
+}
+
+// Subprotocols lists the subprotocols the server accepts, in order of preference: protobuf
+// frames, then schema versions newest first. Pass it to websocket.Config so the chosen
+// subprotocol is echoed in the handshake.
+func Subprotocols() []string {
+	protocols := []string{protobufSubprotocol}
+	for v := SchemaLatest; v >= SchemaOldest; v-- {
+		protocols = append(protocols, SchemaSubprotocol(v))
+	}
+	return protocols
+}
+
+// SchemaSubprotocol returns the subprotocol declaring a schema version, e.g. app.ws.v2.
+func SchemaSubprotocol(version int) string {
+	return schemaSubprotocolPrefix + strconv.Itoa(version)
+}
+
+// schemaFromSubprotocol returns the version of a negotiated subprotocol (0 if there is none).
+func schemaFromSubprotocol(protocol string) int {
+	if !strings.HasPrefix(protocol, schemaSubprotocolPrefix) {
+		return 0
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(protocol, schemaSubprotocolPrefix))
+	if err != nil || v < SchemaOldest || v > SchemaLatest {
+		return 0
+	}
+	return v
+}
+
+// schemaFromQuery resolves ?schema= (0 if absent). Versions newer than SchemaLatest are served
+// SchemaLatest; versions older than SchemaOldest (or not numbers) are an error.
+func schemaFromQuery(c *fiber.Ctx) (int, error) {
+	raw := c.Query("schema")
+	if raw == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < SchemaOldest {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Unsupported WebSocket schema version")
+	}
+	if v > SchemaLatest {
+		v = SchemaLatest
+	}
+	return v, nil
+}
+
+// supportedSchemas lists every schema version the server serves, oldest first.
+func supportedSchemas() []int {
+	versions := make([]int, 0, SchemaLatest-SchemaOldest+1)
+	for v := SchemaOldest; v <= SchemaLatest; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// resolveSchema picks a connection's schema: the negotiated subprotocol, then ?schema=, then v1.
+func resolveSchema(subprotocol string, queried int) int {
+	if v := schemaFromSubprotocol(subprotocol); v != 0 {
+		return v
+	}
+	if queried != 0 {
+		return queried
+	}
+	return SchemaV1
+}
+
+// encodeFor returns the frame type and bytes of a message as sent to client: a protobuf
+// Envelope (see ws_proto.go), the bare data for JSON schema 1 or a JSON envelope for schema 2.
+// Each form is built once per message, whatever the number of recipients.
+func (m *hubMessage) encodeFor(client clientInfo) (int, []byte) {
+	if client.encoding == EncodingProtobuf {
+		return websocket.BinaryMessage, m.encodeProtobuf()
+	}
+	return websocket.TextMessage, m.encodeJSON(client.schema)
+}
+
+// encodeJSON returns a message as sent to JSON clients on schema: the bare data for v1, an
+// envelope for v2.
+func (m *hubMessage) encodeJSON(schema int) []byte {
+	if schema < SchemaV2 {
+		return m.data
+	}
+
+	if m.envelope == nil {
+		encoded, err := json.Marshal(Envelope{
+			Type:    m.kind,
+			Version: SchemaV2,
+			Data:    envelopeData(m.data),
+			TS:      m.ts,
+			ID:      m.id,
+		})
+		if err != nil {
+			return m.data
+		}
+		m.envelope = encoded
+	}
+	return m.envelope
+}
+
+// envelopeData returns data as a JSON value for the envelope; non-JSON payloads become a string.
+func envelopeData(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return data
+	}
+	encoded, _ := json.Marshal(string(data))
+	return encoded
+}
+
+// welcomeMessage is sent first on schema 2+ (and protobuf) connections to confirm the
+// negotiated version.
+func welcomeMessage(client clientInfo) (int, []byte) {
+	data, _ := json.Marshal(fiber.Map{
+		"schema":    client.schema,
+		"supported": supportedSchemas(),
+	})
+	message := newHubMessage(MessageTypeWelcome, data)
+	return message.encodeFor(client)
+}
+
+// newHubMessage stamps a message with its type, time and ID.
+func newHubMessage(kind string, data []byte) hubMessage {
+	return hubMessage{kind: kind, data: data, ts: time.Now().UTC(), id: newMessageID()}
+}
+
+// newMessageID returns a random 96-bit hex ID.
+func newMessageID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConn records every message written to it.
+type recordingConn struct {
+	messages [][]byte
+}
+
+func (r *recordingConn) WriteMessage(messageType int, data []byte) error {
+	r.messages = append(r.messages, data)
+	return nil
+}
+
+func (r *recordingConn) Close() error { return nil }
+
+// TestHub_FanOutPerSchema tests that each client receives the message in its schema version.
+func TestHub_FanOutPerSchema(t *testing.T) {
+	hub := newHub()
+	legacy, enveloped, other := &recordingConn{}, &recordingConn{}, &recordingConn{}
+	hub.addClient(legacy, clientInfo{schema: SchemaV1})
+	hub.addClient(enveloped, clientInfo{schema: SchemaV2})
+	hub.addClient(other, clientInfo{tenant: "globex", schema: SchemaV2})
+
+	payload := []byte(`{"artist_id":"a1","price":"45.67","event":"UPDATE"}`)
+	message := newHubMessage(MessageTypePriceUpdate, payload)
+	message.scoped = true
+	hub.fanOut(message)
+	stopSenders(hub)
+
+	require.Len(t, legacy.messages, 1)
+	assert.Equal(t, payload, legacy.messages[0])
+	assert.Empty(t, other.messages) // Scoped to clients without a tenant
+
+	require.Len(t, enveloped.messages, 1)
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(enveloped.messages[0], &envelope))
+	assert.Equal(t, MessageTypePriceUpdate, envelope.Type)
+	assert.Equal(t, SchemaV2, envelope.Version)
+	assert.JSONEq(t, string(payload), string(envelope.Data))
+	assert.Equal(t, message.id, envelope.ID)
+	assert.False(t, envelope.TS.IsZero())
+}
+
+// TestResolveSchema tests negotiation precedence and the compatibility rules.
+func TestResolveSchema(t *testing.T) {
+	assert.Equal(t, SchemaV1, resolveSchema("", 0))
+	assert.Equal(t, SchemaV2, resolveSchema("", SchemaV2))
+	assert.Equal(t, SchemaV2, resolveSchema("app.ws.v2", SchemaV1)) // Subprotocol wins
+	assert.Equal(t, SchemaV1, resolveSchema("app.ws.v9", 0))        // Unknown subprotocol ignored
+	assert.Equal(t, []string{"app.ws.proto", "app.ws.v2", "app.ws.v1"}, Subprotocols())
+
+	// Non-JSON payloads are carried as a JSON string
+	assert.JSONEq(t, `"hello"`, string(envelopeData([]byte("hello"))))
+}
+
+// TestAddPriceMeta_Envelope tests that price metadata goes inside a schema 2 envelope.
+func TestAddPriceMeta_Envelope(t *testing.T) {
+	message := newHubMessage(MessageTypePriceUpdate, []byte(`{"artist_id":"a1","price":"2"}`))
+	result := addPriceMeta(message.encodeJSON(SchemaV2), testPriceFormat)
+
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(result, &envelope))
+	assert.JSONEq(t, `{"artist_id":"a1","price":"2","price_meta":`+
+		`{"currency":"USD","precision":2,"amount":"2.00","display":"$2.00","locale":"en-US"}}`, string(envelope.Data))
+
+	// Other envelope types are left alone
+	broadcast := newHubMessage(MessageTypeBroadcast, []byte(`{"artist_id":"a1","price":"2"}`))
+	encoded := broadcast.encodeJSON(SchemaV2)
+	assert.Equal(t, encoded, addPriceMeta(encoded, testPriceFormat))
+}
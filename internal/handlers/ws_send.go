@@ -0,0 +1,176 @@
+package handlers
+
+// Per-client write pumps.
+//
+// The hub never writes to a connection itself: fanOut encodes each message for a client and
+// queues it on the client's sender, whose own goroutine writes it. A slow client therefore only
+// delays itself. A client whose send buffer (WS_SEND_BUFFER messages) is full when the next
+// message arrives has fallen too far behind: it is removed from the hub and disconnected with
+// CloseSlowClient, and the message is counted as dropped.
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"boilerplate/internal/metrics"
+)
+
+// Send buffer and write timeout defaults (WS_SEND_BUFFER, WS_WRITE_TIMEOUT).
+const (
+	defaultSendBuffer   = 64
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// outgoingFrame is a message encoded for one client, waiting in its send buffer.
+type outgoingFrame struct {
+	messageType int
+	data        []byte
+}
+
+// clientSender owns the writes of hub messages to one connection.
+type clientSender struct {
+	conn         clientConn
+	client       clientInfo // Schema and encoding of the close message on eviction
+	writeTimeout time.Duration
+
+	queue   chan outgoingFrame
+	evicted chan struct{} // Closed by evict
+	stopped chan struct{} // Closed by stop
+	done    chan struct{} // Closed when run returns
+
+	evictOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// newClientSender creates a sender buffering up to size messages for conn. Call run to start it.
+func newClientSender(conn clientConn, client clientInfo, size int) *clientSender {
+	return &clientSender{
+		conn:         conn,
+		client:       client,
+		writeTimeout: getWriteTimeout(),
+		queue:        make(chan outgoingFrame, size),
+		evicted:      make(chan struct{}),
+		stopped:      make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// enqueue adds a frame without blocking. It returns false if the send buffer is full.
+func (s *clientSender) enqueue(messageType int, data []byte) bool {
+	select {
+	case s.queue <- outgoingFrame{messageType: messageType, data: data}:
+		return true
+	default:
+		return false
+	}
+}
+
+// run writes queued frames until stop or evict is called, or a write fails.
+// A failed write closes the connection, so the client's read loop exits and unregisters it.
+func (s *clientSender) run() {
+	defer close(s.done)
+
+	for {
+		select {
+		case frame := <-s.queue:
+			if !s.write(frame) {
+				return
+			}
+		case <-s.evicted:
+			closeClient(s.conn, s.client, NewCloseError(CloseSlowClient, "too slow to keep up with updates"))
+			return
+		case <-s.stopped:
+			// Write what is already queued, then stop
+			for {
+				select {
+				case frame := <-s.queue:
+					if !s.write(frame) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes one frame within the write timeout, closing the connection if it fails.
+func (s *clientSender) write(frame outgoingFrame) bool {
+	setWriteDeadline(s.conn, time.Now().Add(s.writeTimeout))
+	if err := s.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+		// If we can't send to a client, they're probably disconnected
+		s.client.logger().Warn("Error sending message to client", "error", err)
+		s.client.stats.closed(reasonWriteFailed, 0)
+		s.conn.Close()
+		return false
+	}
+	return true
+}
+
+// evict makes run disconnect the client with CloseSlowClient instead of writing what is queued.
+func (s *clientSender) evict() {
+	s.evictOnce.Do(func() { close(s.evicted) })
+}
+
+// evictSlow evicts the client because a message found its send buffer full, counting the
+// message as dropped and, once per client, the eviction.
+func (s *clientSender) evictSlow() {
+	metrics.WebSocketDroppedMessages.WithLabelValues(metrics.DropSlowClient).Inc()
+	s.evictOnce.Do(func() {
+		s.client.logger().Warn("WebSocket client too slow, disconnecting it", "queued", cap(s.queue))
+		metrics.WebSocketSlowClientEvictions.Inc()
+		close(s.evicted)
+	})
+}
+
+// stop makes run return once the queue is written. Call it after the client left the hub.
+func (s *clientSender) stop() {
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
+// wait blocks until run has returned, so nothing is written after the connection is recycled.
+func (s *clientSender) wait() {
+	<-s.done
+}
+
+// setWriteDeadline sets the write deadline of conn if it supports one (*websocket.Conn and the
+// wrappers around it do; test fakes don't).
+func setWriteDeadline(conn clientConn, deadline time.Time) {
+	if c, ok := conn.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		c.SetWriteDeadline(deadline)
+	}
+}
+
+// getSendBuffer returns WS_SEND_BUFFER, the messages queued per client before it is evicted
+// as too slow (default 64).
+func getSendBuffer() int {
+	value := os.Getenv("WS_SEND_BUFFER")
+	if value == "" {
+		return defaultSendBuffer
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		slog.Warn("Invalid WS_SEND_BUFFER, using the default", "value", value, "default", defaultSendBuffer)
+		return defaultSendBuffer
+	}
+	return size
+}
+
+// getWriteTimeout returns WS_WRITE_TIMEOUT, how long a single write to a client may take
+// before the connection is dropped (default 10s).
+func getWriteTimeout() time.Duration {
+	value := os.Getenv("WS_WRITE_TIMEOUT")
+	if value == "" {
+		return defaultWriteTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		slog.Warn("Invalid WS_WRITE_TIMEOUT, using the default", "value", value, "default", defaultWriteTimeout.String())
+		return defaultWriteTimeout
+	}
+	return timeout
+}
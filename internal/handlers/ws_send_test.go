@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stopSenders stops every client's write pump once it has written what was queued, so a test
+// can read what its fake connections received.
+func stopSenders(hub *Hub) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for _, client := range hub.clients {
+		client.send.stop()
+		client.send.wait()
+	}
+}
+
+// blockedConn is a client that never finishes a write until it is released.
+type blockedConn struct {
+	closingConn
+	mu      sync.Mutex
+	writing chan struct{} // Receives when a write starts
+	release chan struct{}
+}
+
+func (c *blockedConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case c.writing <- struct{}{}:
+	default:
+	}
+	<-c.release
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closingConn.WriteMessage(messageType, data)
+}
+
+func (c *blockedConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closingConn.Close()
+}
+
+// TestHub_SlowClientEvicted tests that a client that stops reading doesn't hold up the others,
+// and is disconnected with CloseSlowClient once its send buffer is full.
+func TestHub_SlowClientEvicted(t *testing.T) {
+	hub := newHub()
+	hub.sendBuffer = 2
+	slow := &blockedConn{writing: make(chan struct{}, 1), release: make(chan struct{})}
+	fast := &recordingConn{}
+	fastSender := newClientSender(fast, clientInfo{schema: SchemaV1}, 10)
+	go fastSender.run()
+	hub.addClient(slow, clientInfo{schema: SchemaV1})
+	hub.addClient(fast, clientInfo{schema: SchemaV1, send: fastSender})
+	dropped := testutil.ToFloat64(metrics.WebSocketDroppedMessages.WithLabelValues(metrics.DropSlowClient))
+
+	// The slow client's pump gets stuck on the first message; two more fill its buffer
+	hub.fanOut(newHubMessage(MessageTypeBroadcast, []byte(`{"n":1}`)))
+	<-slow.writing
+	for i := 0; i < 3; i++ {
+		hub.fanOut(newHubMessage(MessageTypeBroadcast, []byte(`{"n":1}`)))
+	}
+	assert.Equal(t, 1, hub.ClientCount(), "the slow client is removed")
+	assert.Equal(t, dropped+1, testutil.ToFloat64(metrics.WebSocketDroppedMessages.WithLabelValues(metrics.DropSlowClient)))
+
+	fastSender.stop()
+	fastSender.wait()
+	assert.Len(t, fast.messages, 4)
+
+	// Once its write returns, the slow client is told why and closed
+	close(slow.release)
+	require.Eventually(t, func() bool {
+		slow.mu.Lock()
+		defer slow.mu.Unlock()
+		return slow.closed
+	}, time.Second, 10*time.Millisecond)
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	last := slow.frames[len(slow.frames)-1]
+	assert.Equal(t, websocket.CloseMessage, last.messageType)
+	assert.Equal(t, websocket.FormatCloseMessage(CloseSlowClient, "slow_client"), last.data)
+}
+
+// TestGetSendBuffer tests the WS_SEND_BUFFER and WS_WRITE_TIMEOUT defaults.
+func TestGetSendBuffer(t *testing.T) {
+	t.Setenv("WS_SEND_BUFFER", "")
+	assert.Equal(t, defaultSendBuffer, getSendBuffer())
+	t.Setenv("WS_SEND_BUFFER", "256")
+	assert.Equal(t, 256, getSendBuffer())
+	t.Setenv("WS_SEND_BUFFER", "0")
+	assert.Equal(t, defaultSendBuffer, getSendBuffer())
+
+	t.Setenv("WS_WRITE_TIMEOUT", "2s")
+	assert.Equal(t, 2*time.Second, getWriteTimeout())
+	t.Setenv("WS_WRITE_TIMEOUT", "never")
+	assert.Equal(t, defaultWriteTimeout, getWriteTimeout())
+}
@@ -0,0 +1,185 @@
+package handlers
+
+// Per-connection statistics.
+//
+// A WebSocket session only shows up in the access log as its upgrade request (status 101, a few
+// milliseconds), however long it lasts and whatever it carries. When a connection ends,
+// WebSocketHandler logs one "WebSocket session" line with the same request_id, method, path, ip
+// and user_id fields as the access log, plus the session's duration, messages and bytes in each
+// direction, the message types it was sent ("topics") and why it ended, so log-based traffic
+// analysis can treat sessions like requests.
+//
+// Disconnect reasons: the close reason sent by the server (slow_client, rate_limited, draining,
+// internal_error, ...), client_closed (with the client's close code), connection_lost (the
+// connection dropped without a close frame) or write_failed.
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Disconnect reasons that are not close reasons sent by the server (see closeReasons).
+const (
+	reasonClientClosed   = "client_closed"
+	reasonConnectionLost = "connection_lost"
+	reasonWriteFailed    = "write_failed"
+)
+
+// statsLocalsKey holds the connStats started by UpgradeWebSocket.
+const statsLocalsKey = "ws_stats"
+
+// connStats counts the traffic of one connection. Counters are updated by the read loop and the
+// writers concurrently.
+type connStats struct {
+	method string
+	path   string
+	ip     string
+	start  time.Time
+
+	sent          atomic.Int64
+	received      atomic.Int64
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+
+	mu     sync.Mutex
+	topics map[string]struct{}
+	reason string // The first reason recorded wins
+	code   int    // Close code, 0 when none was exchanged
+}
+
+// newConnStats starts the statistics of the connection upgraded by c.
+func newConnStats(c *fiber.Ctx) *connStats {
+	return &connStats{
+		method: c.Method(),
+		path:   c.Path(),
+		ip:     c.IP(),
+		start:  time.Now(),
+		topics: make(map[string]struct{}),
+	}
+}
+
+// wrote records a message written to the client. Control frames (close, ping, pong) aren't counted.
+func (s *connStats) wrote(messageType int, data []byte) {
+	if s == nil || !isDataMessage(messageType) {
+		return
+	}
+	s.sent.Add(1)
+	s.bytesSent.Add(int64(len(data)))
+}
+
+// read records a message received from the client.
+func (s *connStats) read(messageType int, data []byte) {
+	if s == nil || !isDataMessage(messageType) {
+		return
+	}
+	s.received.Add(1)
+	s.bytesReceived.Add(int64(len(data)))
+}
+
+// topic records that the client was sent a message of type kind.
+func (s *connStats) topic(kind string) {
+	if s == nil || kind == "" {
+		return
+	}
+	s.mu.Lock()
+	s.topics[kind] = struct{}{}
+	s.mu.Unlock()
+}
+
+// closed records why the connection ended, unless a reason was already recorded.
+func (s *connStats) closed(reason string, code int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reason == "" {
+		s.reason, s.code = reason, code
+	}
+}
+
+// readFailed records why the read loop ended: a close frame from the client or a lost connection.
+func (s *connStats) readFailed(err error) {
+	var closeErr *fastws.CloseError // The error type of gofiber/websocket's connections
+	if errors.As(err, &closeErr) {
+		s.closed(reasonClientClosed, closeErr.Code)
+		return
+	}
+	s.closed(reasonConnectionLost, 0)
+}
+
+// attrs returns the session's log fields.
+func (s *connStats) attrs() []slog.Attr {
+	s.mu.Lock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	reason, code := s.reason, s.code
+	s.mu.Unlock()
+	sort.Strings(topics)
+	if reason == "" {
+		reason = reasonConnectionLost
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", s.method),
+		slog.String("path", s.path),
+		slog.Int("status", fiber.StatusSwitchingProtocols),
+		slog.Float64("duration_ms", float64(time.Since(s.start).Microseconds())/1000),
+		slog.String("ip", s.ip),
+		slog.Int64("messages_sent", s.sent.Load()),
+		slog.Int64("messages_received", s.received.Load()),
+		slog.Int64("bytes_sent", s.bytesSent.Load()),
+		slog.Int64("bytes_received", s.bytesReceived.Load()),
+		slog.Any("topics", topics),
+		slog.String("disconnect_reason", reason),
+	}
+	if code != 0 {
+		attrs = append(attrs, slog.Int("close_code", code))
+	}
+	return attrs
+}
+
+// log writes the session's summary line with the client's logger.
+func (s *connStats) log(client clientInfo) {
+	if s == nil {
+		return
+	}
+	client.logger().LogAttrs(context.Background(), slog.LevelInfo, "WebSocket session", s.attrs()...)
+}
+
+// isDataMessage reports whether messageType is a text or binary message.
+func isDataMessage(messageType int) bool {
+	return messageType == websocket.TextMessage || messageType == websocket.BinaryMessage
+}
+
+// countingConn counts the messages written to a connection in its stats.
+type countingConn struct {
+	clientConn
+	stats *connStats
+}
+
+// WriteMessage writes a message, counting it once written.
+func (c *countingConn) WriteMessage(messageType int, data []byte) error {
+	if err := c.clientConn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	c.stats.wrote(messageType, data)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of the wrapped connection.
+func (c *countingConn) SetWriteDeadline(deadline time.Time) error {
+	setWriteDeadline(c.clientConn, deadline)
+	return nil
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/websocket/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConnStats_Log tests the session line: traffic in both directions, topics and the first
+// disconnect reason recorded.
+func TestConnStats_Log(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	stats := &connStats{method: "GET", path: "/ws", ip: "10.0.0.1", start: time.Now(), topics: make(map[string]struct{})}
+	conn := &countingConn{clientConn: &closingConn{}, stats: stats}
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"a":1}`)))
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{1, 2, 3}))
+	require.NoError(t, conn.WriteMessage(websocket.PingMessage, nil)) // Not counted
+	stats.read(websocket.TextMessage, []byte("hello"))
+	stats.topic(MessageTypePriceUpdate)
+	stats.topic(MessageTypeBroadcast)
+	stats.topic(MessageTypePriceUpdate)
+
+	closeClient(conn, clientInfo{schema: SchemaV1, stats: stats}, NewCloseError(CloseSlowClient, "too slow"))
+	stats.readFailed(errors.New("use of closed network connection")) // After the server closed it
+	stats.log(clientInfo{requestID: "req-1", user: "user-1", stats: stats})
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line), buf.String())
+	assert.Equal(t, "WebSocket session", line["msg"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, "user-1", line["user_id"])
+	assert.Equal(t, "/ws", line["path"])
+	assert.Equal(t, float64(101), line["status"])
+	assert.Equal(t, float64(3), line["messages_sent"]) // Two, then the error message of the close
+	assert.Equal(t, float64(1), line["messages_received"])
+	assert.Equal(t, float64(5), line["bytes_received"])
+	assert.Equal(t, []any{"broadcast", "price_update"}, line["topics"])
+	assert.Equal(t, "slow_client", line["disconnect_reason"])
+	assert.Equal(t, float64(CloseSlowClient), line["close_code"])
+}
+
+// TestConnStats_ReadFailed tests the reasons of connections ended by the client.
+func TestConnStats_ReadFailed(t *testing.T) {
+	stats := &connStats{topics: make(map[string]struct{})}
+	stats.readFailed(&fastws.CloseError{Code: websocket.CloseGoingAway})
+	assert.Equal(t, reasonClientClosed, stats.reason)
+	assert.Equal(t, websocket.CloseGoingAway, stats.code)
+
+	stats = &connStats{topics: make(map[string]struct{})}
+	stats.readFailed(errors.New("unexpected EOF"))
+	assert.Equal(t, reasonConnectionLost, stats.reason)
+	assert.Equal(t, 0, stats.code)
+
+	var none *connStats // Connections upgraded without UpgradeWebSocket
+	none.readFailed(errors.New("unexpected EOF"))
+	none.log(clientInfo{})
+}
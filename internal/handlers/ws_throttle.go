@@ -0,0 +1,106 @@
+package handlers
+
+// Per-subscription throttling.
+//
+// A client can subscribe with a throttle, to get at most one update per topic every interval:
+//
+//	{"type": "subscribe", "topic": "prices:*", "payload": {"throttle": "1s"}}
+//
+// The first update of a topic is sent at once. The updates arriving during the following interval
+// are conflated: each replaces the previous one, and the latest is sent when the interval ends,
+// which starts the next one. A topic without updates for a whole interval is forgotten, so its
+// next update is sent at once again. Every topic is throttled on its own (prices:123 and
+// prices:456 each get one update per interval): a dashboard following prices:* still sees every
+// artist, just no faster than it can use. The updates are keyed by the message's first topic.
+
+import (
+	"sync"
+	"time"
+
+	"boilerplate/internal/metrics"
+)
+
+// maxThrottledTopics bounds the topics tracked per client; updates of further topics are sent
+// unthrottled.
+const maxThrottledTopics = 10000
+
+// topicThrottle conflates the updates of one client's throttled subscriptions.
+type topicThrottle struct {
+	send *clientSender
+
+	mu      sync.Mutex
+	topics  map[string]*throttledTopic
+	stopped bool
+}
+
+// throttledTopic is a topic in its throttle interval.
+type throttledTopic struct {
+	interval time.Duration
+	pending  *outgoingFrame // The latest update, sent when the interval ends
+	timer    *time.Timer
+}
+
+func newTopicThrottle(send *clientSender) *topicThrottle {
+	return &topicThrottle{send: send, topics: make(map[string]*throttledTopic)}
+}
+
+// offer sends an update of topic now if the topic is outside its interval, or keeps it to send
+// when the interval ends. It returns false if the update had to be sent now and the client's send
+// buffer was full.
+func (t *topicThrottle) offer(topic string, interval time.Duration, frame outgoingFrame) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return true
+	}
+
+	if throttled := t.topics[topic]; throttled != nil {
+		if throttled.pending != nil {
+			metrics.WebSocketConflatedMessages.Inc()
+		}
+		throttled.pending = &frame
+		throttled.interval = interval // The latest subscribe applies from the next interval
+		return true
+	}
+	if len(t.topics) < maxThrottledTopics {
+		t.topics[topic] = &throttledTopic{
+			interval: interval,
+			timer:    time.AfterFunc(interval, func() { t.flush(topic) }),
+		}
+	}
+	return t.send.enqueue(frame.messageType, frame.data)
+}
+
+// flush ends a topic's interval: it sends the pending update and starts the next interval, or
+// forgets the topic if there is none. A client whose send buffer is full is evicted, as fanOut
+// does; it leaves the hub when its connection closes.
+func (t *topicThrottle) flush(topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	throttled := t.topics[topic]
+	if t.stopped || throttled == nil {
+		return
+	}
+	if throttled.pending == nil {
+		delete(t.topics, topic)
+		return
+	}
+
+	frame := *throttled.pending
+	throttled.pending = nil
+	throttled.timer.Reset(throttled.interval)
+	if !t.send.enqueue(frame.messageType, frame.data) {
+		t.send.evictSlow()
+	}
+}
+
+// stop drops the pending updates. Call it when the client disconnects.
+func (t *topicThrottle) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	for _, throttled := range t.topics {
+		throttled.timer.Stop()
+	}
+	t.topics = nil
+}
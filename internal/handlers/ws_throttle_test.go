@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queued returns the frames waiting in a sender's queue, without a write pump running.
+func queued(send *clientSender) []string {
+	var frames []string
+	for {
+		select {
+		case frame := <-send.queue:
+			frames = append(frames, string(frame.data))
+		default:
+			return frames
+		}
+	}
+}
+
+// TestTopicThrottle tests that the first update of a topic is sent at once, the next ones are
+// conflated into the latest at the end of the interval, and topics are throttled separately.
+func TestTopicThrottle(t *testing.T) {
+	send := newClientSender(&recordingConn{}, clientInfo{}, 8)
+	throttle := newTopicThrottle(send)
+	defer throttle.stop()
+	frame := func(data string) outgoingFrame {
+		return outgoingFrame{messageType: websocket.TextMessage, data: []byte(data)}
+	}
+	interval := 100 * time.Millisecond
+
+	for _, update := range []string{"a1: 1", "a1: 2", "a1: 3"} {
+		require.True(t, throttle.offer("prices:a1", interval, frame(update)))
+	}
+	require.True(t, throttle.offer("prices:a2", interval, frame("a2: 1")))
+	assert.Equal(t, []string{"a1: 1", "a2: 1"}, queued(send))
+
+	time.Sleep(interval * 3 / 2)
+	assert.Equal(t, []string{"a1: 3"}, queued(send), "the latest update, once the interval ended")
+
+	require.True(t, throttle.offer("prices:a1", interval, frame("a1: 4")))
+	assert.Empty(t, queued(send), "still in the interval started by the flush")
+
+	// Once a whole interval passes without updates, the topic is forgotten
+	assert.Eventually(t, func() bool {
+		throttle.mu.Lock()
+		defer throttle.mu.Unlock()
+		return len(throttle.topics) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a1: 4"}, queued(send))
+	require.True(t, throttle.offer("prices:a1", interval, frame("a1: 5")))
+	assert.Equal(t, []string{"a1: 5"}, queued(send))
+}
+
+// TestHub_FanOutThrottled tests that fanOut throttles the updates of throttled subscriptions
+// only, with the shortest throttle of the subscriptions a topic matches.
+func TestHub_FanOutThrottled(t *testing.T) {
+	hub := newHub()
+	throttled, unthrottled := &recordingConn{}, &recordingConn{}
+	hub.addClient(throttled, clientInfo{schema: SchemaV1})
+	hub.addClient(unthrottled, clientInfo{schema: SchemaV1})
+	require.NoError(t, hub.subscribe(throttled, "prices:*", time.Minute))
+	require.NoError(t, hub.subscribe(throttled, "prices:a2", 0))
+	require.NoError(t, hub.subscribe(unthrottled, "prices:*", 0))
+
+	for _, update := range []string{"a1: 1", "a1: 2", "a2: 1", "a2: 2"} {
+		message := newHubMessage(MessageTypePriceUpdate, []byte(update))
+		message.topics = []string{"prices:" + update[:2]}
+		hub.fanOut(message)
+	}
+	stopSenders(hub)
+
+	assert.Equal(t, [][]byte{[]byte("a1: 1"), []byte("a2: 1"), []byte("a2: 2")}, throttled.messages)
+	assert.Len(t, unthrottled.messages, 4)
+}
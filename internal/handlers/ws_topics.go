@@ -0,0 +1,311 @@
+package handlers
+
+// Topic subscriptions.
+//
+// Messages published on the hub can carry topics: colon-separated names such as prices:123 (a
+// price update of artist 123) or listings:42 (a change of row 42 of the listings subscription).
+// Clients subscribe by sending {"type": "subscribe", "topic": ...} frames (see wsproto).
+// A client that subscribes to topics only receives the topic messages matching one of its
+// subscriptions; messages without a topic (broadcasts, notifications) still reach it. A client
+// that never subscribes receives every message, as before subscriptions existed.
+//
+// A subscription is a topic, or a pattern ending in * that matches every topic under its prefix:
+// prices:* matches prices, prices:123 and prices:genre:rock:123, and * matches everything.
+// Subscriptions are kept in a trie of topic segments, so finding the clients of a message walks
+// its topic once, however many clients and patterns there are.
+//
+// A subscription can be throttled (see ws_throttle.go): its client then gets at most one update
+// per topic every interval, the latest.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/events"
+	"boilerplate/internal/handlers/wsproto"
+)
+
+// Subscription limits, per client.
+const (
+	maxSubscriptions = 100
+	maxTopicLength   = 200
+)
+
+// Topic syntax.
+const (
+	topicSeparator = ":"
+	topicWildcard  = "*"
+	topicPrices    = "prices" // Price updates are published on prices:<artist_id>
+)
+
+// errTooManySubscriptions is returned when a client subscribes to more than maxSubscriptions
+// topics.
+var errTooManySubscriptions = fmt.Errorf("at most %d subscriptions per connection", maxSubscriptions)
+
+// topicIndex is the trie of the clients' subscriptions, with their throttle (0: none). It is
+// guarded by the hub's mu.
+type topicIndex struct {
+	root     *topicNode
+	patterns map[clientConn]map[string]time.Duration // By client
+}
+
+// topicNode is a topic segment of the trie.
+type topicNode struct {
+	children map[string]*topicNode
+	exact    map[clientConn]time.Duration // Subscribed to the topic ending here
+	prefix   map[clientConn]time.Duration // Subscribed to the topics under it (a pattern ending in *)
+}
+
+func newTopicIndex() *topicIndex {
+	return &topicIndex{root: &topicNode{}, patterns: make(map[clientConn]map[string]time.Duration)}
+}
+
+// validateTopic checks a subscription: non-empty segments, with * only as the last one.
+func validateTopic(pattern string) error {
+	if pattern == "" || len(pattern) > maxTopicLength {
+		return fmt.Errorf("topic must be 1 to %d characters", maxTopicLength)
+	}
+	segments := strings.Split(pattern, topicSeparator)
+	for i, segment := range segments {
+		if segment == "" {
+			return errors.New("topic segments can't be empty")
+		}
+		if strings.Contains(segment, topicWildcard) && (segment != topicWildcard || i != len(segments)-1) {
+			return errors.New("* can only be the last segment of a topic")
+		}
+	}
+	return nil
+}
+
+// add subscribes a client to a valid pattern. Subscribing again to a pattern only replaces its
+// throttle.
+func (t *topicIndex) add(conn clientConn, pattern string, throttle time.Duration) error {
+	subscribed := t.patterns[conn]
+	if _, ok := subscribed[pattern]; !ok && len(subscribed) >= maxSubscriptions {
+		return errTooManySubscriptions
+	}
+	if subscribed == nil {
+		subscribed = make(map[string]time.Duration)
+		t.patterns[conn] = subscribed
+	}
+	subscribed[pattern] = throttle
+
+	node, wildcard := t.root, false
+	for _, segment := range strings.Split(pattern, topicSeparator) {
+		if segment == topicWildcard {
+			wildcard = true
+			break
+		}
+		child := node.children[segment]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*topicNode)
+			}
+			child = &topicNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	if wildcard {
+		node.prefix = addConn(node.prefix, conn, throttle)
+	} else {
+		node.exact = addConn(node.exact, conn, throttle)
+	}
+	return nil
+}
+
+// remove unsubscribes a client from a pattern, pruning the nodes left empty.
+func (t *topicIndex) remove(conn clientConn, pattern string) {
+	if _, ok := t.patterns[conn][pattern]; !ok {
+		return
+	}
+	delete(t.patterns[conn], pattern)
+	if len(t.patterns[conn]) == 0 {
+		delete(t.patterns, conn)
+	}
+
+	segments := strings.Split(pattern, topicSeparator)
+	wildcard := segments[len(segments)-1] == topicWildcard
+	if wildcard {
+		segments = segments[:len(segments)-1]
+	}
+	path := []*topicNode{t.root}
+	for _, segment := range segments {
+		path = append(path, path[len(path)-1].children[segment])
+	}
+	node := path[len(path)-1]
+	if wildcard {
+		delete(node.prefix, conn)
+	} else {
+		delete(node.exact, conn)
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if n := path[i]; len(n.children) > 0 || len(n.exact) > 0 || len(n.prefix) > 0 {
+			break
+		}
+		delete(path[i-1].children, segments[i-1])
+	}
+}
+
+// removeAll unsubscribes a client from everything.
+func (t *topicIndex) removeAll(conn clientConn) {
+	for pattern := range t.patterns[conn] {
+		t.remove(conn, pattern)
+	}
+}
+
+// subscribed reports whether a client has subscriptions, and so only receives the topic messages
+// matching them.
+func (t *topicIndex) subscribed(conn clientConn) bool {
+	return len(t.patterns[conn]) > 0
+}
+
+// match adds the clients subscribed to topic to matched, walking its segments once. A client
+// matching several subscriptions gets the shortest throttle of them.
+func (t *topicIndex) match(topic string, matched map[clientConn]time.Duration) {
+	node := t.root
+	for {
+		matchAll(matched, node.prefix)
+		segment, rest, more := strings.Cut(topic, topicSeparator)
+		if node = node.children[segment]; node == nil {
+			return
+		}
+		if !more {
+			matchAll(matched, node.exact)
+			matchAll(matched, node.prefix)
+			return
+		}
+		topic = rest
+	}
+}
+
+// matchAll adds the clients of set to matched, keeping the shortest throttle of each.
+func matchAll(matched, set map[clientConn]time.Duration) {
+	for conn, throttle := range set {
+		if current, ok := matched[conn]; !ok || throttle < current {
+			matched[conn] = throttle
+		}
+	}
+}
+
+// addConn adds conn to set with its throttle, creating set if needed.
+func addConn(set map[clientConn]time.Duration, conn clientConn, throttle time.Duration) map[clientConn]time.Duration {
+	if set == nil {
+		set = make(map[clientConn]time.Duration)
+	}
+	set[conn] = throttle
+	return set
+}
+
+// recipients returns the clients subscribed to one of the message's topics, with the throttle of
+// their subscription, or nil when every client receives it (no topic, or no client has
+// subscriptions). Callers hold the hub's mu.
+func (h *Hub) recipients(message hubMessage) map[clientConn]time.Duration {
+	if len(message.topics) == 0 || len(h.topics.patterns) == 0 {
+		return nil
+	}
+	matched := make(map[clientConn]time.Duration)
+	for _, topic := range message.topics {
+		h.topics.match(topic, matched)
+	}
+	return matched
+}
+
+// subscribe subscribes a client to a topic or pattern, throttled to one update per topic every
+// throttle (0: every update).
+func (h *Hub) subscribe(conn clientConn, pattern string, throttle time.Duration) error {
+	if err := validateTopic(pattern); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.topics.add(conn, pattern, throttle)
+}
+
+// unsubscribe removes a client's subscription.
+func (h *Hub) unsubscribe(conn clientConn, pattern string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.topics.remove(conn, pattern)
+}
+
+// PublishToTopic sends a typed message to the clients of a topic: those subscribed to it (or to
+// a pattern matching it) and those without subscriptions.
+//
+// Example: hub.PublishToTopic("charts:weekly", "chart_update", []byte(`{"top": ["123", "456"]}`))
+func (h *Hub) PublishToTopic(topic, kind string, message []byte) {
+	hm := newHubMessage(kind, message)
+	hm.topics = []string{topic}
+	h.enqueue(hm)
+}
+
+var (
+	priceTopicsMu sync.RWMutex
+	priceTopics   []func(change events.PriceChanged) []string
+)
+
+// RegisterPriceTopics adds topics to price updates, besides prices:<artist_id>: e.g. a category
+// clients can follow as a whole,
+//
+//	handlers.RegisterPriceTopics(func(change events.PriceChanged) []string {
+//		return []string{"prices:genre:" + genres.Of(change.ArtistID) + ":" + change.ArtistID}
+//	})
+//
+// so a dashboard subscribing to prices:genre:rock:* gets the updates of every rock artist. The
+// function runs for every price change, in the publisher's goroutine: it must be fast.
+func RegisterPriceTopics(topics func(change events.PriceChanged) []string) {
+	priceTopicsMu.Lock()
+	defer priceTopicsMu.Unlock()
+	priceTopics = append(priceTopics, topics)
+}
+
+// topicsOfPrice returns the topics of a price update.
+func topicsOfPrice(change events.PriceChanged) []string {
+	topics := []string{topicPrices + topicSeparator + change.ArtistID}
+	priceTopicsMu.RLock()
+	defer priceTopicsMu.RUnlock()
+	for _, more := range priceTopics {
+		topics = append(topics, more(change)...)
+	}
+	return topics
+}
+
+// topicOfRow returns the topic of a row change: <subscription>:<id>, or the subscription alone
+// for records without an id field.
+func topicOfRow(change events.RowChanged) string {
+	switch id := change.Record["id"].(type) {
+	case string:
+		if id != "" {
+			return change.Subscription + topicSeparator + id
+		}
+	case float64:
+		return change.Subscription + topicSeparator + strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	return change.Subscription
+}
+
+// clientTopics applies the subscribe and unsubscribe frames of one client (see wsproto).
+type clientTopics struct {
+	hub  *Hub
+	conn clientConn
+}
+
+func (c clientTopics) Subscribe(topic string, options wsproto.SubscribeOptions) error {
+	if err := c.hub.subscribe(c.conn, topic, options.Throttle); err != nil {
+		code := wsproto.CodeInvalidTopic
+		if errors.Is(err, errTooManySubscriptions) {
+			code = wsproto.CodeTooManySubscriptions
+		}
+		return &wsproto.Error{Code: code, Message: err.Error()}
+	}
+	return nil
+}
+
+func (c clientTopics) Unsubscribe(topic string) error {
+	c.hub.unsubscribe(c.conn, topic)
+	return nil
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"boilerplate/internal/events"
+	"boilerplate/internal/handlers/wsproto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateTopic tests which subscriptions are accepted.
+func TestValidateTopic(t *testing.T) {
+	for _, valid := range []string{"prices:123", "prices:*", "prices:genre:rock:*", "*", "announcements"} {
+		assert.NoError(t, validateTopic(valid), valid)
+	}
+	for _, invalid := range []string{"", "prices:", ":prices", "prices::123", "prices:*:rock", "prices:12*", string(make([]byte, maxTopicLength+1))} {
+		assert.Error(t, validateTopic(invalid), invalid)
+	}
+}
+
+// TestTopicIndex tests exact and prefix matches, and that removed subscriptions leave no nodes.
+func TestTopicIndex(t *testing.T) {
+	index := newTopicIndex()
+	exact, prices, rock, all := &recordingConn{}, &recordingConn{}, &recordingConn{}, &recordingConn{}
+	require.NoError(t, index.add(exact, "prices:123", 0))
+	require.NoError(t, index.add(prices, "prices:*", 0))
+	require.NoError(t, index.add(rock, "prices:genre:rock:*", 0))
+	require.NoError(t, index.add(all, "*", 0))
+
+	matches := func(topic string) []clientConn {
+		matched := make(map[clientConn]time.Duration)
+		index.match(topic, matched)
+		conns := make([]clientConn, 0, len(matched))
+		for _, conn := range []clientConn{exact, prices, rock, all} {
+			if _, ok := matched[conn]; ok {
+				conns = append(conns, conn)
+			}
+		}
+		return conns
+	}
+	assert.Equal(t, []clientConn{exact, prices, all}, matches("prices:123"))
+	assert.Equal(t, []clientConn{prices, all}, matches("prices:456"))
+	assert.Equal(t, []clientConn{prices, rock, all}, matches("prices:genre:rock:456"))
+	assert.Equal(t, []clientConn{prices, all}, matches("prices:genre:jazz:456"))
+	assert.Equal(t, []clientConn{prices, all}, matches("prices"))
+	assert.Equal(t, []clientConn{all}, matches("listings:42"))
+
+	for _, conn := range []clientConn{exact, prices, rock, all} {
+		index.removeAll(conn)
+	}
+	assert.Empty(t, index.patterns)
+	assert.Empty(t, index.root.children)
+	assert.Empty(t, index.root.prefix)
+}
+
+// TestTopicIndex_Limit tests that a client can't subscribe to more than maxSubscriptions topics.
+func TestTopicIndex_Limit(t *testing.T) {
+	index := newTopicIndex()
+	conn := &recordingConn{}
+	for i := 0; i < maxSubscriptions; i++ {
+		require.NoError(t, index.add(conn, fmt.Sprintf("prices:%d", i), 0))
+	}
+	require.NoError(t, index.add(conn, "prices:0", 0), "already subscribed")
+	assert.ErrorIs(t, index.add(conn, "prices:*", 0), errTooManySubscriptions)
+}
+
+// TestHub_FanOutTopics tests that subscribed clients only get the topic messages they match,
+// while clients without subscriptions and messages without topics are unaffected.
+func TestHub_FanOutTopics(t *testing.T) {
+	hub := newHub()
+	everything, artist, rock := &recordingConn{}, &recordingConn{}, &recordingConn{}
+	hub.addClient(everything, clientInfo{schema: SchemaV1})
+	hub.addClient(artist, clientInfo{schema: SchemaV1})
+	hub.addClient(rock, clientInfo{schema: SchemaV1})
+	require.NoError(t, hub.subscribe(artist, "prices:a1", 0))
+	require.NoError(t, hub.subscribe(rock, "prices:genre:rock:*", 0))
+
+	RegisterPriceTopics(func(change events.PriceChanged) []string {
+		if change.ArtistID == "a2" {
+			return []string{"prices:genre:rock:a2"}
+		}
+		return nil
+	})
+	t.Cleanup(func() { priceTopics = nil })
+
+	for _, id := range []string{"a1", "a2", "a3"} {
+		message := newHubMessage(MessageTypePriceUpdate, []byte(id))
+		message.topics = topicsOfPrice(events.PriceChanged{ArtistID: id})
+		hub.fanOut(message)
+	}
+	hub.fanOut(newHubMessage(MessageTypeBroadcast, []byte("notice")))
+	stopSenders(hub)
+
+	assert.Equal(t, [][]byte{[]byte("a1"), []byte("a2"), []byte("a3"), []byte("notice")}, everything.messages)
+	assert.Equal(t, [][]byte{[]byte("a1"), []byte("notice")}, artist.messages)
+	assert.Equal(t, [][]byte{[]byte("a2"), []byte("notice")}, rock.messages)
+}
+
+// TestClientTopics tests subscribe and unsubscribe frames and their replies.
+func TestClientTopics(t *testing.T) {
+	hub := newHub()
+	conn := &recordingConn{}
+	topics := clientTopics{hub: hub, conn: conn}
+
+	reply := wsproto.Handle([]byte(`{"type": "subscribe", "topic": "prices:*", "ref": "1"}`), topics)
+	assert.Equal(t, wsproto.Frame{Type: wsproto.TypeAck, Topic: "prices:*", Ref: "1"}, reply)
+	assert.True(t, hub.topics.subscribed(conn))
+
+	reply = wsproto.Handle([]byte(`{"type": "subscribe", "topic": "prices:*:x", "ref": "2"}`), topics)
+	assert.Equal(t, wsproto.TypeError, reply.Type)
+	assert.JSONEq(t, `{"error": "invalid_topic", "message": "* can only be the last segment of a topic"}`, string(reply.Payload))
+
+	for i := 1; i < maxSubscriptions; i++ {
+		require.NoError(t, topics.Subscribe(fmt.Sprintf("prices:%d", i), wsproto.SubscribeOptions{}))
+	}
+	reply = wsproto.Handle([]byte(`{"type": "subscribe", "topic": "listings:*"}`), topics)
+	assert.JSONEq(t, `{"error": "too_many_subscriptions", "message": "at most 100 subscriptions per connection"}`, string(reply.Payload))
+
+	reply = wsproto.Handle([]byte(`{"type": "unsubscribe", "topic": "prices:*", "ref": "3"}`), topics)
+	assert.Equal(t, wsproto.Frame{Type: wsproto.TypeAck, Topic: "prices:*", Ref: "3"}, reply)
+	hub.topics.removeAll(conn)
+	assert.False(t, hub.topics.subscribed(conn))
+}
+
+// TestTopicOfRow tests the topics of row changes.
+func TestTopicOfRow(t *testing.T) {
+	assert.Equal(t, "listings:42", topicOfRow(events.RowChanged{Subscription: "listings", Record: map[string]interface{}{"id": float64(42)}}))
+	assert.Equal(t, "listings:l-1", topicOfRow(events.RowChanged{Subscription: "listings", Record: map[string]interface{}{"id": "l-1"}}))
+	assert.Equal(t, "listings", topicOfRow(events.RowChanged{Subscription: "listings", Record: map[string]interface{}{"title": "x"}}))
+}
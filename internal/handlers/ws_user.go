@@ -0,0 +1,70 @@
+package handlers
+
+// Per-user channels.
+//
+// A client that sends an access token with the handshake is identified as that user: in the
+// app.ws.token.<token> subprotocol, or as ?token= for clients that can't set subprotocols.
+// Browsers can't set headers on WebSocket handshakes, and the subprotocol keeps the token out of
+// URLs (proxy and access logs). Clients without a token are anonymous and only get public updates.
+//
+// The backend reaches every connection of one user, on any device, with Hub.SendToUser, e.g. an
+// order fill, or the user's preferences changed on another device.
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TokenSubprotocolPrefix prefixes the access token when it is sent as a subprotocol, e.g.
+// new WebSocket(url, ["app.ws.v2", "app.ws.token." + accessToken]). The server never selects
+// it, so clients must offer a schema subprotocol too (browsers reject a handshake answering
+// none of the offered ones).
+const TokenSubprotocolPrefix = "app.ws.token."
+
+// handshakeToken returns the access token of a WebSocket handshake: the token subprotocol, then
+// ?token=, or "" for an anonymous client.
+func handshakeToken(c *fiber.Ctx) string {
+	for _, protocol := range strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+		if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), TokenSubprotocolPrefix); ok && token != "" {
+			return token
+		}
+	}
+	return c.Query("token")
+}
+
+// SendToUser sends a typed message with payload encoded as JSON to every connection of userID,
+// returning how many there are. 0 means the user isn't connected to this instance, e.g. to fall
+// back to a push notification or email.
+func (h *Hub) SendToUser(userID, kind string, payload any) (int, error) {
+	if h == nil || userID == "" {
+		return 0, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	connections := h.UserConnections(userID)
+	if connections > 0 {
+		h.PublishToUser(userID, kind, data)
+	}
+	return connections, nil
+}
+
+// UserConnections returns how many connections userID has to this instance.
+func (h *Hub) UserConnections(userID string) int {
+	if h == nil || userID == "" {
+		return 0
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for _, client := range h.clients {
+		if client.user == userID {
+			count++
+		}
+	}
+	return count
+}
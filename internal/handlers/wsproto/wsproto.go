@@ -0,0 +1,166 @@
+package wsproto
+
+// Package wsproto is the protocol of the frames WebSocket clients send to /ws, and of the
+// server's replies to them. Every frame is a JSON text frame with the same fields:
+//
+//	{"type": "subscribe", "topic": "prices:*", "ref": "1"}
+//	{"type": "ack", "topic": "prices:*", "ref": "1"}
+//
+// Clients send subscribe and unsubscribe (with a topic) and ping (with any payload); the server
+// answers ack, pong or error. A subscribe's payload may throttle the subscription, to at most one
+// update per topic every interval (see SubscribeOptions):
+//
+//	{"type": "subscribe", "topic": "prices:*", "payload": {"throttle": "1s"}}
+//
+// ref is chosen by the client and copied to the reply, so a client can match replies to its
+// requests; it is optional. Error replies carry a payload
+// {"error": code, "message": text}, with the codes below.
+//
+// The updates the server pushes (price updates, broadcasts, ...) keep their own format, chosen
+// with the message schema (see ws_schema.go); only replies to client frames use this one.
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Frame types.
+const (
+	TypeSubscribe   = "subscribe"   // Client: receive the updates of topic (see ws_topics.go)
+	TypeUnsubscribe = "unsubscribe" // Client: stop receiving them
+	TypePing        = "ping"        // Client: check the connection; answered by a pong
+	TypePong        = "pong"        // Server: the reply to a ping, with its payload
+	TypeAck         = "ack"         // Server: the subscribe or unsubscribe was applied
+	TypeError       = "error"       // Server: the frame was refused
+)
+
+// Error codes of error frames.
+const (
+	CodeInvalidFrame         = "invalid_frame"          // Not a JSON object with a type
+	CodeUnknownType          = "unknown_type"           // A type clients can't send
+	CodeInvalidTopic         = "invalid_topic"          // See the topic syntax in ws_topics.go
+	CodeTooManySubscriptions = "too_many_subscriptions" // The connection's limit was reached
+	CodeInternal             = "internal_error"
+)
+
+// maxRefLength bounds the refs copied to replies.
+const maxRefLength = 64
+
+// Bounds of a subscription's throttle.
+const (
+	MinThrottle = 100 * time.Millisecond
+	MaxThrottle = time.Minute
+)
+
+// Frame is a protocol frame, sent by the client or the server.
+type Frame struct {
+	Type    string          `json:"type"`
+	Topic   string          `json:"topic,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Ref     string          `json:"ref,omitempty"`
+}
+
+// Error is a refused frame's reason, sent as an error frame.
+type Error struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// SubscribeOptions are the settings of a subscription, from the subscribe frame's payload.
+type SubscribeOptions struct {
+	// Throttle sends at most one update per topic every Throttle: the latest one (0: every
+	// update). Subscribing again to a topic replaces its throttle.
+	Throttle time.Duration
+}
+
+// Handler applies the requests of one connection. Returning an *Error sends its code; other
+// errors are sent as CodeInternal.
+type Handler interface {
+	Subscribe(topic string, options SubscribeOptions) error
+	Unsubscribe(topic string) error
+}
+
+// Parse decodes a client frame.
+func Parse(data []byte) (Frame, error) {
+	var frame Frame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return Frame{}, &Error{Code: CodeInvalidFrame, Message: "frames must be JSON objects"}
+	}
+	if frame.Type == "" {
+		return frame, &Error{Code: CodeInvalidFrame, Message: "type is required"}
+	}
+	if len(frame.Ref) > maxRefLength {
+		frame.Ref = ""
+		return frame, &Error{Code: CodeInvalidFrame, Message: "ref is too long"}
+	}
+	return frame, nil
+}
+
+// Handle applies a client frame with handler and returns the reply to send.
+func Handle(data []byte, handler Handler) Frame {
+	frame, err := Parse(data)
+	if err != nil {
+		return Refuse(frame.Ref, err)
+	}
+
+	switch frame.Type {
+	case TypeSubscribe:
+		var options SubscribeOptions
+		if options, err = parseSubscribeOptions(frame.Payload); err == nil {
+			err = handler.Subscribe(frame.Topic, options)
+		}
+	case TypeUnsubscribe:
+		err = handler.Unsubscribe(frame.Topic)
+	case TypePing:
+		return Frame{Type: TypePong, Payload: frame.Payload, Ref: frame.Ref}
+	default:
+		return Refuse(frame.Ref, &Error{Code: CodeUnknownType, Message: "unknown frame type " + frame.Type})
+	}
+	if err != nil {
+		return Refuse(frame.Ref, err)
+	}
+	return Frame{Type: TypeAck, Topic: frame.Topic, Ref: frame.Ref}
+}
+
+// parseSubscribeOptions reads a subscribe frame's payload: {"throttle": "1s"}, or nothing.
+func parseSubscribeOptions(payload json.RawMessage) (SubscribeOptions, error) {
+	var options SubscribeOptions
+	if len(payload) == 0 || string(payload) == "null" {
+		return options, nil
+	}
+	var fields struct {
+		Throttle string `json:"throttle"`
+	}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return options, &Error{Code: CodeInvalidFrame, Message: `subscribe payload must be an object like {"throttle": "1s"}`}
+	}
+	if fields.Throttle != "" {
+		throttle, err := time.ParseDuration(fields.Throttle)
+		if err != nil || throttle < MinThrottle || throttle > MaxThrottle {
+			return options, &Error{Code: CodeInvalidFrame, Message: "throttle must be a duration from " + MinThrottle.String() + " to " + MaxThrottle.String()}
+		}
+		options.Throttle = throttle
+	}
+	return options, nil
+}
+
+// Refuse returns the error frame answering the frame of ref with err.
+func Refuse(ref string, err error) Frame {
+	var protoErr *Error
+	if !errors.As(err, &protoErr) {
+		protoErr = &Error{Code: CodeInternal, Message: "the frame could not be handled"}
+	}
+	payload, _ := json.Marshal(protoErr)
+	return Frame{Type: TypeError, Payload: payload, Ref: ref}
+}
+
+// Encode returns the frame's JSON.
+func (f Frame) Encode() []byte {
+	data, _ := json.Marshal(f)
+	return data
+}
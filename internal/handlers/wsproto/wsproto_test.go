@@ -0,0 +1,74 @@
+package wsproto
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// handler records the topics subscribed to and their throttle, refusing those in refused.
+type handler struct {
+	subscribed map[string]time.Duration
+	refused    map[string]error
+}
+
+func (h *handler) Subscribe(topic string, options SubscribeOptions) error {
+	if err := h.refused[topic]; err != nil {
+		return err
+	}
+	if h.subscribed == nil {
+		h.subscribed = make(map[string]time.Duration)
+	}
+	h.subscribed[topic] = options.Throttle
+	return nil
+}
+
+func (h *handler) Unsubscribe(topic string) error {
+	return h.refused[topic]
+}
+
+// TestHandle tests the reply to each kind of client frame.
+func TestHandle(t *testing.T) {
+	h := &handler{refused: map[string]error{
+		"bad":    &Error{Code: CodeInvalidTopic, Message: "invalid"},
+		"broken": errors.New("store unavailable"),
+	}}
+
+	tests := []struct {
+		name  string
+		frame string
+		reply string
+	}{
+		{"subscribe", `{"type": "subscribe", "topic": "prices:*", "ref": "1"}`, `{"type": "ack", "topic": "prices:*", "ref": "1"}`},
+		{"throttled", `{"type": "subscribe", "topic": "listings:*", "payload": {"throttle": "1s"}}`, `{"type": "ack", "topic": "listings:*"}`},
+		{"invalid throttle", `{"type": "subscribe", "topic": "x", "payload": {"throttle": "10ms"}}`, `{"type": "error", "payload": {"error": "invalid_frame", "message": "throttle must be a duration from 100ms to 1m0s"}}`},
+		{"invalid payload", `{"type": "subscribe", "topic": "x", "payload": "1s"}`, `{"type": "error", "payload": {"error": "invalid_frame", "message": "subscribe payload must be an object like {\"throttle\": \"1s\"}"}}`},
+		{"unsubscribe without ref", `{"type": "unsubscribe", "topic": "prices:*"}`, `{"type": "ack", "topic": "prices:*"}`},
+		{"ping", `{"type": "ping", "payload": {"t": 1}, "ref": "2"}`, `{"type": "pong", "payload": {"t": 1}, "ref": "2"}`},
+		{"refused topic", `{"type": "subscribe", "topic": "bad", "ref": "3"}`, `{"type": "error", "payload": {"error": "invalid_topic", "message": "invalid"}, "ref": "3"}`},
+		{"handler failure", `{"type": "unsubscribe", "topic": "broken"}`, `{"type": "error", "payload": {"error": "internal_error", "message": "the frame could not be handled"}}`},
+		{"unknown type", `{"type": "publish", "ref": "4"}`, `{"type": "error", "payload": {"error": "unknown_type", "message": "unknown frame type publish"}, "ref": "4"}`},
+		{"no type", `{"topic": "prices:*"}`, `{"type": "error", "payload": {"error": "invalid_frame", "message": "type is required"}}`},
+		{"not JSON", `hello`, `{"type": "error", "payload": {"error": "invalid_frame", "message": "frames must be JSON objects"}}`},
+		{"not an object", `["subscribe"]`, `{"type": "error", "payload": {"error": "invalid_frame", "message": "frames must be JSON objects"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.JSONEq(t, tt.reply, string(Handle([]byte(tt.frame), h).Encode()))
+		})
+	}
+	assert.Equal(t, map[string]time.Duration{"prices:*": 0, "listings:*": time.Second}, h.subscribed)
+}
+
+// TestParse_LongRef tests that refs too long to copy are refused, without being copied.
+func TestParse_LongRef(t *testing.T) {
+	long := make([]byte, maxRefLength+1)
+	for i := range long {
+		long[i] = 'r'
+	}
+	reply := Handle([]byte(`{"type": "ping", "ref": "`+string(long)+`"}`), &handler{})
+	assert.Equal(t, TypeError, reply.Type)
+	assert.Empty(t, reply.Ref)
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/db"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/status"
+)
+
+// Check names (see READINESS_REQUIRED).
+const (
+	CheckCache    = status.Cache
+	CheckSupabase = "supabase"
+	CheckJWKS     = "jwks"
+	CheckRealtime = status.Realtime
+	CheckDatabase = "database"
+)
+
+// isCheckName reports whether name is one of the built-in checks.
+func isCheckName(name string) bool {
+	switch name {
+	case CheckCache, CheckSupabase, CheckJWKS, CheckRealtime, CheckDatabase:
+		return true
+	}
+	return false
+}
+
+// cacheProbeKey is read by the cache check. It is never written: a miss is a success.
+const cacheProbeKey = "health:probe"
+
+// defaultChecks returns the checks of the dependencies cfg configures.
+func defaultChecks(cfg *config.Config) []Check {
+	var configured []Check
+	if store := cache.GetClient(); store != nil {
+		configured = append(configured, Check{Name: CheckCache, Run: cacheCheck(store)})
+	}
+	if cfg.Supabase.URL != "" {
+		configured = append(configured,
+			Check{Name: CheckSupabase, Run: supabaseCheck(cfg.Supabase)},
+			Check{Name: CheckJWKS, Run: jwksCheck(cfg.Auth.SupabaseURL)},
+		)
+	}
+	if cfg.Realtime.Enabled() {
+		configured = append(configured, Check{Name: CheckRealtime, Run: realtimeCheck})
+	}
+	if database := db.Get(); database != nil {
+		configured = append(configured, Check{Name: CheckDatabase, Run: database.Ping})
+	}
+	return configured
+}
+
+// cacheCheck reads a key from store.
+func cacheCheck(store cache.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := store.Get(cacheProbeKey)
+		return err
+	}
+}
+
+// supabaseClient sends the Supabase check, only to allowed hosts (see egress). Checks are
+// bounded by their context.
+var supabaseClient = egress.NewClient(0)
+
+// supabaseCheck requests Supabase's REST API root. Any answer but a 5xx means Supabase is
+// reachable: what the anon key may read there is not the point.
+func supabaseCheck(cfg config.Supabase) func(ctx context.Context) error {
+	url := strings.TrimSuffix(cfg.URL, "/") + "/rest/v1/"
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if cfg.AnonKey != "" {
+			req.Header.Set("apikey", cfg.AnonKey)
+		}
+		resp, err := supabaseClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// jwksCheck fetches the JWKS from Supabase.
+func jwksCheck(supabaseURL string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return middleware.CheckJWKS(ctx, supabaseURL)
+	}
+}
+
+// realtimeCheck fails while the subscriber reports its subscription down. Before it reports
+// anything (still connecting, or another replica holds the Realtime leader lock) it passes.
+func realtimeCheck(ctx context.Context) error {
+	if dependency, ok := status.Get(status.Realtime); ok && dependency.State == status.StateDown {
+		return errors.New(dependency.Error)
+	}
+	return nil
+}
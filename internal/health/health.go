@@ -0,0 +1,280 @@
+package health
+
+// Package health answers the orchestrator's probes.
+//
+// GET /healthz (liveness) only says the process serves requests: it is always 200, so a
+// dependency being down never gets the instance restarted. Its body lists the dependencies
+// reported to internal/status, with "degraded" while any is down (as /health, kept for existing
+// monitors, always did).
+//
+// GET /readyz (readiness) actively checks the dependencies the instance is configured with:
+// the cache (a read), Supabase (its REST API answers), the JWKS RS256 tokens are verified with
+// (it can be fetched), the Realtime subscription (not reported down) and the database pool (a
+// ping, see internal/db). It answers 503 while
+// the instance drains (see status.SetDraining) or while a required check fails, and lists every
+// check's state and latency either way.
+//
+// READINESS_REQUIRED lists the checks that make the instance unready (default: all of them;
+// "none" to only report them, so an instance keeps serving degraded responses while a
+// dependency is down). READINESS_TIMEOUT bounds each check (default 2s) and results are reused
+// for READINESS_CACHE_TTL (default 5s), so frequent probes don't load the dependencies.
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/status"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Check is one readiness check.
+type Check struct {
+	Name     string
+	Run      func(ctx context.Context) error
+	Required bool // A failure makes the instance unready
+}
+
+// Result is the outcome of one check, as listed by /readyz.
+type Result struct {
+	State     string `json:"state"` // status.StateUp or status.StateDown
+	Required  bool   `json:"required"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Default settings.
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 5 * time.Second
+)
+
+var (
+	mu       sync.Mutex // Held while checks run, so concurrent probes share one run
+	checks   []Check
+	timeout  = defaultTimeout
+	cacheTTL = defaultCacheTTL
+
+	lastResults map[string]Result
+	lastRun     time.Time
+)
+
+// Init configures the readiness checks of the dependencies cfg configures, with
+// READINESS_REQUIRED, READINESS_TIMEOUT and READINESS_CACHE_TTL. Call it after cache.Init and
+// db.Init.
+// Invalid settings are logged and leave readiness to draining only.
+func Init(cfg *config.Config) {
+	available := defaultChecks(cfg)
+	required, checkTimeout, ttl, err := loadSettings(available)
+	if err != nil {
+		slog.Error("Invalid readiness settings, /readyz only fails while draining", "error", err)
+		startup.Report("readiness", false, err.Error())
+		Reset()
+		return
+	}
+
+	names := make([]string, 0, len(available))
+	for i := range available {
+		available[i].Required = required[available[i].Name]
+		name := available[i].Name
+		if !available[i].Required {
+			name += " (reported)"
+		}
+		names = append(names, name)
+	}
+	Configure(available, checkTimeout, ttl)
+
+	if len(available) == 0 {
+		startup.Report("readiness", false, "no dependencies configured, /readyz only fails while draining")
+		return
+	}
+	startup.Report("readiness", true, strings.Join(names, ", "))
+}
+
+// loadSettings reads the readiness settings from the environment: which of available are
+// required, the timeout of a check and how long results are reused.
+func loadSettings(available []Check) (map[string]bool, time.Duration, time.Duration, error) {
+	required := make(map[string]bool, len(available))
+
+	switch value := strings.ToLower(strings.TrimSpace(os.Getenv("READINESS_REQUIRED"))); value {
+	case "":
+		for _, check := range available {
+			required[check.Name] = true
+		}
+	case "none":
+	default:
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if !isCheckName(name) {
+				return nil, 0, 0, fmt.Errorf("READINESS_REQUIRED: unknown check %q (cache, supabase, jwks, realtime or database)", name)
+			}
+			// Checks of unconfigured dependencies (e.g. cache without a backend) don't run
+			required[name] = true
+		}
+	}
+
+	checkTimeout, err := durationSetting("READINESS_TIMEOUT", defaultTimeout)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if checkTimeout == 0 {
+		return nil, 0, 0, fmt.Errorf("READINESS_TIMEOUT must be positive")
+	}
+	ttl, err := durationSetting("READINESS_CACHE_TTL", defaultCacheTTL)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return required, checkTimeout, ttl, nil
+}
+
+// durationSetting reads a non-negative duration from the environment.
+func durationSetting(name string, fallback time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%s must be a duration such as 5s, got %q", name, value)
+	}
+	return duration, nil
+}
+
+// Configure sets the readiness checks, the timeout of each and how long results are reused
+// (0 runs the checks on every probe). Mainly useful in tests.
+func Configure(configured []Check, checkTimeout, ttl time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks = configured
+	timeout = checkTimeout
+	cacheTTL = ttl
+	lastResults, lastRun = nil, time.Time{}
+}
+
+// Reset removes every check and restores the default settings. Mainly useful in tests.
+func Reset() {
+	Configure(nil, defaultTimeout, defaultCacheTTL)
+}
+
+// Run returns the result of every check, running them (concurrently) unless the last results
+// are recent enough, and whether every required check passed.
+func Run(ctx context.Context) (map[string]Result, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if lastResults == nil || time.Since(lastRun) >= cacheTTL {
+		lastResults = runChecks(ctx, checks, timeout)
+		lastRun = time.Now()
+	}
+
+	ready := true
+	for _, result := range lastResults {
+		if result.Required && result.State != status.StateUp {
+			ready = false
+		}
+	}
+	return lastResults, ready
+}
+
+// runChecks runs checks concurrently, each with its own timeout.
+func runChecks(ctx context.Context, checks []Check, timeout time.Duration) map[string]Result {
+	results := make(map[string]Result, len(checks))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			started := time.Now()
+			err := runWithContext(checkCtx, check.Run)
+			result := Result{
+				State:     status.StateUp,
+				Required:  check.Required,
+				LatencyMS: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				result.State, result.Error = status.StateDown, err.Error()
+			}
+
+			resultsMu.Lock()
+			results[check.Name] = result
+			resultsMu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+	return results
+}
+
+// runWithContext runs a check, giving up when ctx is done even if the check ignores ctx (the
+// cache clients take no context).
+func runWithContext(ctx context.Context, run func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- run(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out: %w", ctx.Err())
+	}
+}
+
+// LiveHandler answers liveness probes (GET /healthz, and /health): always 200, with the reported
+// dependencies. A dependency being down makes the status "degraded", not the process dead.
+func LiveHandler(c *fiber.Ctx) error {
+	healthStatus := "ok"
+	if len(status.Down()) > 0 {
+		healthStatus = "degraded"
+	}
+	return c.JSON(fiber.Map{
+		"status":       healthStatus,
+		"dependencies": status.Snapshot(),
+	})
+}
+
+// ReadyHandler answers readiness probes (GET /readyz): 200 when ready, 503 while draining or
+// while a required check fails, with the result of every check.
+func ReadyHandler(c *fiber.Ctx) error {
+	if draining, since := status.Draining(); draining {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "draining",
+			"since":  since,
+		})
+	}
+
+	// Not the request's context: the results are shared with other probes
+	results, ready := Run(context.Background())
+	if !ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unready",
+			"failed": failedChecks(results),
+			"checks": results,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status": "ready",
+		"checks": results,
+	})
+}
+
+// failedChecks returns the required checks that failed, sorted.
+func failedChecks(results map[string]Result) []string {
+	failed := make([]string, 0)
+	for name, result := range results {
+		if result.Required && result.State != status.StateUp {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
@@ -0,0 +1,184 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/status"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readyzBody is the body of /readyz.
+type readyzBody struct {
+	Status string            `json:"status"`
+	Failed []string          `json:"failed"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// probe sends GET /readyz to a fresh app and decodes the answer.
+func probe(t *testing.T) (int, readyzBody) {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/readyz", ReadyHandler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	require.NoError(t, err)
+
+	var body readyzBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func pass(ctx context.Context) error { return nil }
+
+func fail(ctx context.Context) error { return errors.New("connection refused") }
+
+// TestReadyHandler tests that required checks failing, or draining, make the instance unready
+// while other failures are only reported.
+func TestReadyHandler(t *testing.T) {
+	status.Reset()
+	defer status.Reset()
+	defer Reset()
+
+	Configure([]Check{
+		{Name: CheckCache, Run: pass, Required: true},
+		{Name: CheckSupabase, Run: fail, Required: true},
+	}, time.Second, 0)
+	code, body := probe(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unready", body.Status)
+	assert.Equal(t, []string{CheckSupabase}, body.Failed)
+	assert.Equal(t, status.StateUp, body.Checks[CheckCache].State)
+	assert.Equal(t, "connection refused", body.Checks[CheckSupabase].Error)
+
+	Configure([]Check{
+		{Name: CheckCache, Run: pass, Required: true},
+		{Name: CheckSupabase, Run: fail},
+	}, time.Second, 0)
+	code, body = probe(t)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body.Status)
+	assert.Equal(t, status.StateDown, body.Checks[CheckSupabase].State)
+	assert.False(t, body.Checks[CheckSupabase].Required)
+
+	status.SetDraining(true)
+	code, body = probe(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", body.Status)
+}
+
+// TestRun_CacheTTL tests that results are reused for the cache TTL.
+func TestRun_CacheTTL(t *testing.T) {
+	defer Reset()
+
+	var calls atomic.Int32
+	counted := []Check{{Name: CheckCache, Required: true, Run: func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}}}
+
+	Configure(counted, time.Second, time.Hour)
+	Run(context.Background())
+	Run(context.Background())
+	assert.Equal(t, int32(1), calls.Load())
+
+	Configure(counted, time.Second, 0)
+	Run(context.Background())
+	Run(context.Background())
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+// TestRun_Timeout tests that a check ignoring its context fails at the timeout.
+func TestRun_Timeout(t *testing.T) {
+	defer Reset()
+
+	release := make(chan struct{})
+	defer close(release)
+	Configure([]Check{{Name: CheckCache, Required: true, Run: func(ctx context.Context) error {
+		<-release
+		return nil
+	}}}, 50*time.Millisecond, 0)
+
+	started := time.Now()
+	results, ready := Run(context.Background())
+	assert.Less(t, time.Since(started), time.Second)
+	assert.False(t, ready)
+	assert.Contains(t, results[CheckCache].Error, "timed out")
+}
+
+// TestInit tests the checks of the configured dependencies against a fake Supabase, and
+// READINESS_REQUIRED.
+func TestInit(t *testing.T) {
+	status.Reset()
+	defer status.Reset()
+	defer Reset()
+
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	cache.SetDefault(cache.NewMemoryStore())
+
+	var supabaseDown atomic.Bool
+	supabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if supabaseDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/rest/v1/":
+			assert.Equal(t, "anon-key", r.Header.Get("apikey"))
+			w.Write([]byte(`{}`))
+		case "/.well-known/jwks.json":
+			w.Write([]byte(`{"keys":[{"kid":"key-1","kty":"RSA","n":"AQAB","e":"AQAB"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer supabase.Close()
+
+	cfg := &config.Config{
+		Supabase: config.Supabase{URL: supabase.URL, AnonKey: "anon-key"},
+		Auth:     config.Auth{SupabaseURL: supabase.URL},
+		Realtime: config.Realtime{SupabaseURL: supabase.URL, AnonKey: "anon-key"},
+	}
+	t.Setenv("READINESS_CACHE_TTL", "0")
+	Init(cfg)
+
+	code, body := probe(t)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body.Checks, 4)
+	for name, result := range body.Checks {
+		assert.Equal(t, status.StateUp, result.State, name)
+	}
+
+	supabaseDown.Store(true)
+	status.SetDown(status.Realtime, errors.New("connection lost"))
+	code, body = probe(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{CheckJWKS, CheckRealtime, CheckSupabase}, body.Failed)
+	assert.Equal(t, "connection lost", body.Checks[CheckRealtime].Error)
+
+	// Only the Realtime subscription is required now
+	t.Setenv("READINESS_REQUIRED", "realtime")
+	Init(cfg)
+	status.SetUp(status.Realtime)
+	code, body = probe(t)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, status.StateDown, body.Checks[CheckSupabase].State)
+
+	// Invalid settings leave only draining
+	t.Setenv("READINESS_REQUIRED", "search")
+	Init(cfg)
+	code, body = probe(t)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body.Checks)
+}
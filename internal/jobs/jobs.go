@@ -0,0 +1,376 @@
+package jobs
+
+// Package jobs runs work outside of requests (recomputing artist metrics, sending notifications)
+// on a pool of workers, with retries.
+//
+// Handlers are registered by job type, and jobs enqueued with a JSON payload:
+//
+//	jobs.Register("artists.recompute_metrics", func(ctx context.Context, job jobs.Job) error {
+//		var payload struct{ ArtistID string `json:"artist_id"` }
+//		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+//			return err
+//		}
+//		return recomputeMetrics(ctx, payload.ArtistID)
+//	})
+//
+//	id, err := jobs.Enqueue("artists.recompute_metrics", map[string]string{"artist_id": id}, jobs.Options{})
+//
+// Jobs are kept in Redis sorted sets (see cache.Queue), so any instance may run a job another one
+// enqueued: jobs:queued (by the time they are due), jobs:running (by the end of their lease) and
+// jobs:dead. Every instance runs JOBS_WORKERS workers (default 4; 0 only enqueues), which claim
+// due jobs every JOBS_POLL_INTERVAL (default 1s) and give each JOBS_TIMEOUT (default 5m).
+//
+// A job whose handler returns an error (or panics) is retried with exponential backoff, from
+// JOBS_BACKOFF_MIN (default 10s) doubling up to JOBS_BACKOFF_MAX (default 1h), until it has made
+// JOBS_MAX_ATTEMPTS attempts (default 5); then it moves to the dead-letter set, where
+// /api/admin/jobs lists it and can retry or discard it. A job whose instance stopped mid-run is
+// queued again once its lease ends: handlers must be safe to run twice. Without a cache, jobs are
+// kept in memory and lost on restart.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/monitor"
+	"boilerplate/internal/startup"
+)
+
+// Queue keys (see cache.Queue).
+const (
+	queuedKey  = "jobs:queued"
+	runningKey = "jobs:running"
+	deadKey    = "jobs:dead"
+)
+
+// States of jobs, as listed by /api/admin/jobs.
+const (
+	StateQueued  = "queued"
+	StateRunning = "running"
+	StateDead    = "dead"
+)
+
+// Defaults of the zero Config fields (see config.Jobs for the JOBS_* settings).
+const (
+	defaultPollInterval = time.Second
+	defaultTimeout      = 5 * time.Minute
+	defaultMaxAttempts  = 5
+	defaultBackoffMin   = 10 * time.Second
+	defaultBackoffMax   = time.Hour
+)
+
+// leaseGrace is how long past its timeout a running job stays claimed before it is queued again.
+const leaseGrace = 30 * time.Second
+
+// maxScanned bounds the jobs read to find one by ID.
+const maxScanned = 1000
+
+var (
+	// DefaultQueue is the queue the application enqueues on. It is nil until Init() or
+	// SetDefault() is called.
+	DefaultQueue *Queue
+
+	// ErrNotConfigured is returned by Enqueue before Init.
+	ErrNotConfigured = errors.New("job queue not configured")
+
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]Handler)
+)
+
+// Handler runs a job. Returning an error retries it (see the package doc); ctx ends at
+// JOBS_TIMEOUT.
+type Handler func(ctx context.Context, job Job) error
+
+// Job is a unit of work, stored as JSON in the queues.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	EnqueuedAt  time.Time       `json:"enqueued_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	FailedAt    *time.Time      `json:"failed_at,omitempty"` // When it moved to the dead-letter set
+}
+
+// Options of Enqueue. Zero values use the defaults.
+type Options struct {
+	Delay       time.Duration // Before the first attempt
+	MaxAttempts int           // Default JOBS_MAX_ATTEMPTS
+}
+
+// Queue enqueues jobs and runs them.
+type Queue struct {
+	backend cache.Queue
+	shared  bool // backend is the cache (not a store of this instance)
+
+	workers      int
+	pollInterval time.Duration
+	timeout      time.Duration
+	maxAttempts  int
+	backoffMin   time.Duration
+	backoffMax   time.Duration
+
+	now     func() time.Time
+	jitter  func() float64 // Returns [0, 1); overridable in tests
+	wake    chan struct{}  // Signals Run that a job was enqueued here or a worker is free
+	slots   chan struct{}  // One value per busy worker
+	running sync.WaitGroup // Busy workers
+}
+
+// Config configures a queue. Zero values use the defaults.
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	BackoffMin   time.Duration
+	BackoffMax   time.Duration
+}
+
+// Init creates the default queue on the cache (call it after cache.Init) from the JOBS_*
+// settings. Start the workers with StartWorkers once the handlers are registered.
+func Init(cfg config.Jobs) {
+	queue := New(cache.GetQueue(), Config{
+		Workers:      cfg.Workers,
+		PollInterval: cfg.PollInterval,
+		Timeout:      cfg.Timeout,
+		MaxAttempts:  cfg.MaxAttempts,
+		BackoffMin:   cfg.BackoffMin,
+		BackoffMax:   cfg.BackoffMax,
+	})
+	DefaultQueue = queue
+	monitor.RegisterChannel("jobs.workers", func() (int, int) {
+		return len(queue.slots), cap(queue.slots)
+	})
+
+	detail := fmt.Sprintf("%d workers, up to %d attempts", queue.workers, queue.maxAttempts)
+	if queue.workers == 0 {
+		detail = "enqueue only (JOBS_WORKERS=0)"
+	}
+	if !queue.shared {
+		slog.Warn("No shared cache, background jobs are kept in memory and lost on restart")
+		detail += ", in memory (no shared cache)"
+	}
+	startup.Report("jobs", true, detail)
+}
+
+// New creates a queue on backend. Without a backend (no shared cache) jobs are kept in memory.
+func New(backend cache.Queue, cfg Config) *Queue {
+	queue := &Queue{
+		backend:      backend,
+		shared:       backend != nil,
+		workers:      cfg.Workers,
+		pollInterval: orDefault(cfg.PollInterval, defaultPollInterval),
+		timeout:      orDefault(cfg.Timeout, defaultTimeout),
+		maxAttempts:  cfg.MaxAttempts,
+		backoffMin:   orDefault(cfg.BackoffMin, defaultBackoffMin),
+		backoffMax:   orDefault(cfg.BackoffMax, defaultBackoffMax),
+		now:          time.Now,
+		jitter:       mathrand.Float64,
+		wake:         make(chan struct{}, 1),
+	}
+	if backend == nil {
+		queue.backend = cache.NewMemoryStore()
+	}
+	if queue.workers < 0 {
+		queue.workers = 0
+	}
+	queue.slots = make(chan struct{}, queue.workers)
+	if queue.maxAttempts <= 0 {
+		queue.maxAttempts = defaultMaxAttempts
+	}
+	return queue
+}
+
+// SetDefault sets the default queue. Mainly useful in tests.
+func SetDefault(queue *Queue) {
+	DefaultQueue = queue
+}
+
+// Get returns the default queue (nil if Init has not been called).
+func Get() *Queue {
+	return DefaultQueue
+}
+
+// Register sets the handler of a job type, replacing any previous one. Jobs of types without a
+// handler fail (and are retried, in case an instance that has one picks them up).
+func Register(jobType string, handler Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[jobType] = handler
+}
+
+// handlerFor returns the handler of a job type, or nil.
+func handlerFor(jobType string) Handler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	return handlers[jobType]
+}
+
+// Enqueue adds a job to the default queue and returns its ID.
+func Enqueue(jobType string, payload any, opts Options) (string, error) {
+	queue := Get()
+	if queue == nil {
+		return "", ErrNotConfigured
+	}
+	return queue.Enqueue(jobType, payload, opts)
+}
+
+// Enqueue adds a job of jobType with payload (marshaled to JSON) and returns its ID.
+func (q *Queue) Enqueue(jobType string, payload any, opts Options) (string, error) {
+	if jobType == "" {
+		return "", errors.New("job type is required")
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid payload of job %s: %w", jobType, err)
+	}
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	now := q.now()
+	job := Job{
+		ID:          id,
+		Type:        jobType,
+		Payload:     raw,
+		MaxAttempts: opts.MaxAttempts,
+		EnqueuedAt:  now,
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = q.maxAttempts
+	}
+	if err := q.schedule(queuedKey, job, now.Add(opts.Delay)); err != nil {
+		return "", err
+	}
+	q.signal()
+	return id, nil
+}
+
+// Stats returns the number of jobs in each state.
+func (q *Queue) Stats() (map[string]int64, error) {
+	stats := make(map[string]int64, 3)
+	for state, key := range map[string]string{StateQueued: queuedKey, StateRunning: runningKey, StateDead: deadKey} {
+		count, err := q.backend.QueueLen(key)
+		if err != nil {
+			return nil, err
+		}
+		stats[state] = count
+	}
+	return stats, nil
+}
+
+// List returns up to limit jobs in state: queued ones in due order, running ones by the end of
+// their lease, dead ones oldest first.
+func (q *Queue) List(state string, limit int) ([]Job, error) {
+	key, ok := keyOf(state)
+	if !ok {
+		return nil, fmt.Errorf("unknown job state %q", state)
+	}
+	members, err := q.backend.Scheduled(key, limit)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]Job, 0, len(members))
+	for _, member := range members {
+		var job Job
+		if err := json.Unmarshal([]byte(member), &job); err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Retry queues a dead job again, with its attempts reset, and reports whether it was found.
+func (q *Queue) Retry(id string) (bool, error) {
+	member, job, err := q.findDead(id)
+	if err != nil || member == "" {
+		return false, err
+	}
+	job.Attempts, job.FailedAt = 0, nil
+	if err := q.schedule(queuedKey, job, q.now()); err != nil {
+		return false, err
+	}
+	if _, err := q.backend.Unschedule(deadKey, member); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Discard deletes a dead job and reports whether it was found.
+func (q *Queue) Discard(id string) (bool, error) {
+	member, _, err := q.findDead(id)
+	if err != nil || member == "" {
+		return false, err
+	}
+	return q.backend.Unschedule(deadKey, member)
+}
+
+// findDead returns the dead job with id and its stored form (empty when there is none).
+func (q *Queue) findDead(id string) (string, Job, error) {
+	members, err := q.backend.Scheduled(deadKey, maxScanned)
+	if err != nil {
+		return "", Job{}, err
+	}
+	for _, member := range members {
+		var job Job
+		if json.Unmarshal([]byte(member), &job) == nil && job.ID == id {
+			return member, job, nil
+		}
+	}
+	return "", Job{}, nil
+}
+
+// schedule stores job in the queue at key, due at due.
+func (q *Queue) schedule(key string, job Job, due time.Time) error {
+	member, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := q.backend.Schedule(key, string(member), due); err != nil {
+		return fmt.Errorf("failed to store job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// keyOf returns the queue key of a state.
+func keyOf(state string) (string, bool) {
+	switch state {
+	case StateQueued:
+		return queuedKey, true
+	case StateRunning:
+		return runningKey, true
+	case StateDead:
+		return deadKey, true
+	}
+	return "", false
+}
+
+// newID returns a random 128-bit hex ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// orDefault returns value, or fallback when value isn't positive.
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestQueue creates a queue in memory with a clock the test moves and no jitter.
+func newTestQueue(t *testing.T, now *time.Time) *Queue {
+	queue := New(cache.NewMemoryStore(), Config{Workers: 2, MaxAttempts: 3, BackoffMin: time.Second, BackoffMax: 3 * time.Second})
+	queue.now = func() time.Time { return *now }
+	queue.jitter = func() float64 { return 0 }
+	return queue
+}
+
+// register registers a handler for the test only.
+func register(t *testing.T, jobType string, handler Handler) {
+	Register(jobType, handler)
+	t.Cleanup(func() {
+		handlersMu.Lock()
+		delete(handlers, jobType)
+		handlersMu.Unlock()
+	})
+}
+
+// claimOne claims the next due job, as a worker would.
+func claimOne(t *testing.T, queue *Queue) string {
+	now := queue.now()
+	members, err := queue.backend.Claim(queuedKey, runningKey, now, now.Add(queue.timeout+leaseGrace), 1)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	return members[0]
+}
+
+// TestProcess_RetriesAndDeadLetter tests backoff between attempts, the dead-letter set and retrying
+// from it.
+func TestProcess_RetriesAndDeadLetter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	queue := newTestQueue(t, &now)
+	var attempts atomic.Int32
+	register(t, "test.flaky", func(ctx context.Context, job Job) error {
+		attempts.Add(1)
+		var payload map[string]string
+		require.NoError(t, json.Unmarshal(job.Payload, &payload))
+		assert.Equal(t, "a1", payload["artist_id"])
+		return errors.New("upstream unavailable")
+	})
+
+	id, err := queue.Enqueue("test.flaky", map[string]string{"artist_id": "a1"}, Options{})
+	require.NoError(t, err)
+
+	queue.process(context.Background(), claimOne(t, queue))
+	queued, err := queue.List(StateQueued, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	assert.Equal(t, 1, queued[0].Attempts)
+	assert.Equal(t, "upstream unavailable", queued[0].LastError)
+
+	// Not due until the backoff (1s, then 2s) has passed
+	members, _ := queue.backend.Claim(queuedKey, runningKey, now, now, 1)
+	assert.Empty(t, members)
+	now = now.Add(time.Second)
+	queue.process(context.Background(), claimOne(t, queue))
+	now = now.Add(2 * time.Second)
+	queue.process(context.Background(), claimOne(t, queue))
+	assert.Equal(t, int32(3), attempts.Load())
+
+	stats, err := queue.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{StateQueued: 0, StateRunning: 0, StateDead: 1}, stats)
+	dead, _ := queue.List(StateDead, 10)
+	require.Len(t, dead, 1)
+	assert.Equal(t, id, dead[0].ID)
+	assert.NotNil(t, dead[0].FailedAt)
+
+	retried, err := queue.Retry(id)
+	require.NoError(t, err)
+	assert.True(t, retried)
+	queued, _ = queue.List(StateQueued, 10)
+	require.Len(t, queued, 1)
+	assert.Equal(t, 0, queued[0].Attempts)
+
+	retried, _ = queue.Retry("missing")
+	assert.False(t, retried)
+}
+
+// TestProcess_Panic tests that a panicking handler fails its attempt instead of the worker.
+func TestProcess_Panic(t *testing.T) {
+	now := time.Now()
+	queue := newTestQueue(t, &now)
+	register(t, "test.panic", func(ctx context.Context, job Job) error { panic("boom") })
+
+	_, err := queue.Enqueue("test.panic", nil, Options{MaxAttempts: 1})
+	require.NoError(t, err)
+	queue.process(context.Background(), claimOne(t, queue))
+
+	dead, _ := queue.List(StateDead, 10)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "panic: boom", dead[0].LastError)
+
+	discarded, err := queue.Discard(dead[0].ID)
+	require.NoError(t, err)
+	assert.True(t, discarded)
+}
+
+// TestRequeueExpired tests that jobs left running by a stopped instance are queued again.
+func TestRequeueExpired(t *testing.T) {
+	now := time.Now()
+	queue := newTestQueue(t, &now)
+	_, err := queue.Enqueue("test.unhandled", nil, Options{})
+	require.NoError(t, err)
+	claimOne(t, queue)
+
+	queue.requeueExpired()
+	stats, _ := queue.Stats()
+	assert.Equal(t, int64(1), stats[StateRunning], "the lease hasn't ended")
+
+	now = now.Add(queue.timeout + leaseGrace)
+	queue.requeueExpired()
+	stats, _ = queue.Stats()
+	assert.Equal(t, int64(1), stats[StateQueued])
+}
+
+// TestRun tests that the workers run enqueued jobs.
+func TestRun(t *testing.T) {
+	queue := New(nil, Config{Workers: 2, PollInterval: time.Hour})
+	done := make(chan string, 3)
+	register(t, "test.echo", func(ctx context.Context, job Job) error {
+		done <- job.ID
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	var ids []string
+	for range 3 {
+		id, err := queue.Enqueue("test.echo", nil, Options{})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	var ran []string
+	for range 3 {
+		select {
+		case id := <-done:
+			ran = append(ran, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("jobs didn't run")
+		}
+	}
+	assert.ElementsMatch(t, ids, ran)
+}
@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"boilerplate/internal/lifecycle"
+	"boilerplate/internal/metrics"
+)
+
+// Results of attempts, as counted in jobs_processed_total.
+const (
+	resultSucceeded = "succeeded"
+	resultRetried   = "retried"
+	resultDead      = "dead"
+)
+
+// workers runs the default queue's workers (see StartWorkers).
+var workers lifecycle.Runner
+
+// StartWorkers starts the default queue's workers in the background, after Init() and after
+// registering the handlers (nothing runs with JOBS_WORKERS=0). It fails while workers started
+// earlier are still stopping.
+func StartWorkers() error {
+	queue := Get()
+	if queue == nil || queue.workers == 0 {
+		return nil
+	}
+	if !workers.Start(queue.Run) {
+		return errors.New("previous job workers are still stopping")
+	}
+	return nil
+}
+
+// StopWorkers stops the workers started by StartWorkers, and waits until ctx ends for their
+// running jobs: these get their context cancelled, and are retried if they fail.
+func StopWorkers(ctx context.Context) error {
+	return workers.Stop(ctx)
+}
+
+// Run claims due jobs for the queue's workers every poll interval, and as soon as one is
+// enqueued here or a worker finishes, until ctx is cancelled; it then waits for the running jobs.
+// Every poll interval it also queues again the jobs whose lease ended.
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	q.requeueExpired()
+	for {
+		q.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			q.running.Wait()
+			return
+		case <-ticker.C:
+			q.requeueExpired()
+		case <-q.wake:
+		}
+	}
+}
+
+// dispatch claims as many due jobs as there are free workers, until none are due.
+func (q *Queue) dispatch(ctx context.Context) {
+	for {
+		free := cap(q.slots) - len(q.slots)
+		if free == 0 {
+			return
+		}
+		now := q.now()
+		members, err := q.backend.Claim(queuedKey, runningKey, now, now.Add(q.timeout+leaseGrace), free)
+		if err != nil {
+			slog.Warn("Failed to claim jobs", "error", err)
+			return
+		}
+		for _, member := range members {
+			q.slots <- struct{}{}
+			q.running.Add(1)
+			go func() {
+				defer q.running.Done()
+				defer q.signal() // A worker is free: claim the next job without waiting
+				defer func() { <-q.slots }()
+				q.process(ctx, member)
+			}()
+		}
+		if len(members) < free {
+			return
+		}
+	}
+}
+
+// signal wakes Run up.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default: // Already signaled
+	}
+}
+
+// requeueExpired queues again the running jobs whose lease ended: their instance stopped (or
+// lost the cache) before finishing them.
+func (q *Queue) requeueExpired() {
+	now := q.now()
+	members, err := q.backend.Claim(runningKey, queuedKey, now, now, maxScanned)
+	if err != nil {
+		slog.Warn("Failed to requeue expired jobs", "error", err)
+		return
+	}
+	if len(members) > 0 {
+		slog.Warn("Requeued jobs whose lease ended", "count", len(members))
+	}
+}
+
+// process runs a claimed job and then removes it from the running set: done, queued again with
+// backoff, or moved to the dead-letter set.
+func (q *Queue) process(ctx context.Context, member string) {
+	var job Job
+	if err := json.Unmarshal([]byte(member), &job); err != nil {
+		slog.Error("Dropping an invalid job", "error", err)
+		q.backend.Unschedule(runningKey, member)
+		return
+	}
+
+	started := q.now()
+	err := q.call(ctx, job)
+	job.Attempts++
+	now := q.now()
+
+	switch {
+	case err == nil:
+		metrics.JobsProcessed.WithLabelValues(job.Type, resultSucceeded).Inc()
+		slog.Info("Job succeeded", "job", job.ID, "type", job.Type, "attempt", job.Attempts, "duration", now.Sub(started).String())
+	case job.Attempts < job.MaxAttempts:
+		job.LastError = err.Error()
+		delay := q.backoff(job.Attempts)
+		if scheduleErr := q.schedule(queuedKey, job, now.Add(delay)); scheduleErr != nil {
+			// Leave it running: it is queued again when its lease ends
+			slog.Error("Failed to queue a job for retry", "job", job.ID, "type", job.Type, "error", scheduleErr)
+			return
+		}
+		metrics.JobsProcessed.WithLabelValues(job.Type, resultRetried).Inc()
+		slog.Warn("Job failed, retrying", "job", job.ID, "type", job.Type, "attempt", job.Attempts, "retry_in", delay.String(), "error", err)
+	default:
+		job.LastError = err.Error()
+		job.FailedAt = &now
+		if scheduleErr := q.schedule(deadKey, job, now); scheduleErr != nil {
+			slog.Error("Failed to move a job to the dead-letter set", "job", job.ID, "type", job.Type, "error", scheduleErr)
+			return
+		}
+		metrics.JobsProcessed.WithLabelValues(job.Type, resultDead).Inc()
+		slog.Error("Job failed for the last time", "job", job.ID, "type", job.Type, "attempts", job.Attempts, "error", err)
+	}
+
+	if _, err := q.backend.Unschedule(runningKey, member); err != nil {
+		slog.Warn("Failed to remove a finished job from the running set", "job", job.ID, "error", err)
+	}
+}
+
+// call runs job's handler with the queue's timeout, turning a panic into an error.
+func (q *Queue) call(ctx context.Context, job Job) (err error) {
+	handler := handlerFor(job.Type)
+	if handler == nil {
+		return fmt.Errorf("no handler registered for job type %q", job.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("Job panicked", "job", job.ID, "type", job.Type, "panic", recovered, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before the attempt after attempt: the minimum, doubling with every
+// attempt up to the maximum, randomly shortened by up to half.
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.backoffMin
+	for i := 1; i < attempt && delay < q.backoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, q.backoffMax)
+	return delay - time.Duration(q.jitter()*float64(delay)/2)
+}
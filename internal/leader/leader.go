@@ -0,0 +1,138 @@
+package leader
+
+// Package leader elects one replica to run a singleton task (e.g. consuming Supabase Realtime)
+// using a lock in Redis. Every replica runs an Elector on the same key; the one holding the lock
+// is the leader and refreshes it every TTL/3. If the leader dies or loses Redis, the lock expires
+// after TTL and another replica takes over on its next attempt.
+//
+// The leader steps down as soon as it can't be sure it still holds the lock (a refresh that
+// returns false, or refreshes failing for a whole TTL), so two replicas are never leader at once
+// for longer than one refresh interval.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+)
+
+// Elector campaigns for one lock key.
+type Elector struct {
+	locker cache.Locker
+	key    string
+	id     string // This replica's owner ID, stored in the lock
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	leading bool
+	now     func() time.Time // Overridable clock for tests
+}
+
+// New returns an elector for key. id identifies this replica (see InstanceID); ttl is how long
+// the lock survives without refreshes, i.e. the worst-case failover time.
+func New(locker cache.Locker, key, id string, ttl time.Duration) *Elector {
+	return &Elector{locker: locker, key: key, id: id, ttl: ttl, now: time.Now}
+}
+
+// ID returns this replica's owner ID.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this replica currently holds the lock.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Run campaigns until ctx is cancelled. Each time this replica becomes leader, lead is started
+// in a new goroutine with a context that is cancelled when leadership is lost (or ctx is done);
+// lead should stop its work promptly when it is. The lock is released when Run returns.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	interval := e.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var stopLeading context.CancelFunc
+	var lastRefresh time.Time
+
+	stepDown := func(reason string) {
+		if stopLeading == nil {
+			return
+		}
+		log.Printf("WARNING: Lost leadership of %s: %s", e.key, reason)
+		stopLeading()
+		stopLeading = nil
+		e.setLeading(false)
+	}
+
+	for {
+		if stopLeading == nil {
+			// Step 1: Campaign for the lock
+			acquired, err := e.locker.Acquire(e.key, e.id, e.ttl)
+			if err != nil {
+				log.Printf("WARNING: Leader election for %s failed: %v", e.key, err)
+			} else if acquired {
+				log.Printf("INFO: Elected leader of %s (instance %s)", e.key, e.id)
+				var leadCtx context.Context
+				leadCtx, stopLeading = context.WithCancel(ctx)
+				lastRefresh = e.now()
+				e.setLeading(true)
+				go lead(leadCtx)
+			}
+		} else {
+			// Step 2: Keep the lock while leading
+			held, err := e.locker.Refresh(e.key, e.id, e.ttl)
+			switch {
+			case err != nil && e.now().Sub(lastRefresh) >= e.ttl:
+				stepDown("lock could not be refreshed: " + err.Error())
+			case err != nil:
+				log.Printf("WARNING: Failed to refresh leadership of %s: %v", e.key, err)
+			case !held:
+				stepDown("lock expired or taken over")
+			default:
+				lastRefresh = e.now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if stopLeading != nil {
+				stopLeading()
+				e.setLeading(false)
+				if err := e.locker.Release(e.key, e.id); err != nil {
+					log.Printf("WARNING: Failed to release leadership of %s: %v", e.key, err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setLeading records the leadership state.
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	e.leading = leading
+	e.mu.Unlock()
+}
+
+// InstanceID returns an ID for this replica: the hostname (the pod or machine name on most
+// platforms) with a random suffix, so restarts on the same host get a new identity.
+func InstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "instance"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return host
+	}
+	return host + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,83 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// campaign starts an elector and returns a counter of currently running lead functions.
+func campaign(ctx context.Context, elector *Elector) *int32 {
+	var running int32
+	go elector.Run(ctx, func(leadCtx context.Context) {
+		atomic.AddInt32(&running, 1)
+		<-leadCtx.Done()
+		atomic.AddInt32(&running, -1)
+	})
+	return &running
+}
+
+// TestElector_OneLeaderAndFailover tests that exactly one replica leads and another takes over
+// when it stops.
+func TestElector_OneLeaderAndFailover(t *testing.T) {
+	store := cache.NewMemoryStore()
+	ttl := 90 * time.Millisecond
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	defer stopA()
+	a := New(store, "test:leader", "a", ttl)
+	runningA := campaign(ctxA, a)
+	require.Eventually(t, a.IsLeader, time.Second, 5*time.Millisecond)
+
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	b := New(store, "test:leader", "b", ttl)
+	runningB := campaign(ctxB, b)
+
+	// b keeps campaigning but never wins while a refreshes the lock
+	time.Sleep(3 * ttl)
+	assert.True(t, a.IsLeader())
+	assert.False(t, b.IsLeader())
+	assert.Equal(t, int32(1), atomic.LoadInt32(runningA))
+	assert.Equal(t, int32(0), atomic.LoadInt32(runningB))
+
+	// a shuts down: its lead function stops and b takes over
+	stopA()
+	require.Eventually(t, b.IsLeader, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(runningA) == 0 }, time.Second, 5*time.Millisecond)
+	assert.False(t, a.IsLeader())
+	// lead runs in its own goroutine, started right after IsLeader turns true
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(runningB) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+// TestElector_StepsDownWhenLockLost tests that the leader stops leading when another owner
+// holds the lock (e.g. after a pause longer than the TTL).
+func TestElector_StepsDownWhenLockLost(t *testing.T) {
+	store := cache.NewMemoryStore()
+	ttl := 90 * time.Millisecond
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	a := New(store, "test:leader", "a", ttl)
+	running := campaign(ctx, a)
+	require.Eventually(t, a.IsLeader, time.Second, 5*time.Millisecond)
+
+	// Another replica took the lock while a was not refreshing
+	require.NoError(t, store.Release("test:leader", "a"))
+	acquired, err := store.Acquire("test:leader", "b", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	assert.Eventually(t, func() bool { return !a.IsLeader() && atomic.LoadInt32(running) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+// TestInstanceID tests that instance IDs are unique per call.
+func TestInstanceID(t *testing.T) {
+	assert.NotEqual(t, InstanceID(), InstanceID())
+}
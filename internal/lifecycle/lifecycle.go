@@ -0,0 +1,376 @@
+package lifecycle
+
+// Package lifecycle starts and stops the server's subsystems in a fixed order. Each subsystem
+// registers a Service with its Start and Stop hooks and the services it depends on; main.go
+// registers them all and calls StartAll before serving, and StopAll once the HTTP server has shut
+// down:
+//
+//	lifecycle.Register(lifecycle.Service{
+//		Name:        "jobs",
+//		DependsOn:   []string{"cache"},
+//		Restartable: true,
+//		Start: func(ctx context.Context) error {
+//			jobs.Init(cfg.Jobs)
+//			return jobs.StartWorkers()
+//		},
+//		Stop: jobs.StopWorkers,
+//	})
+//
+// Services start in registration order, each after the services it depends on, and stop in the
+// reverse order: a subsystem never starts before what it uses, nor outlives it. Every hook runs
+// with a timeout (StartTimeout, StopTimeout), so a hung dependency can't block startup or
+// shutdown. A service failing to start is logged and left stopped, and startup goes on without
+// it. Background wraps a loop (a worker, a periodic refresh) as a service.
+//
+// Restartable services can also be restarted while the process keeps running: to apply changed
+// settings or to recover a stuck subsystem without dropping the HTTP server's connections.
+// Restarting a service restarts the restartable services depending on it too, since they hold on
+// to what it created. POST /api/admin/restart/:service restarts one. Restarts run one at a time.
+//
+// Runner runs a subsystem's background loop so that it can be stopped and started again.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Default hook timeouts.
+const (
+	DefaultStartTimeout = 30 * time.Second
+	DefaultStopTimeout  = 10 * time.Second
+)
+
+// Errors returned by Restart.
+var (
+	ErrUnknownService = errors.New("unknown service")
+	ErrNotRestartable = errors.New("service can't be restarted")
+)
+
+// Service is a subsystem started and stopped with the process.
+type Service struct {
+	Name      string
+	DependsOn []string // Started before this one and stopped after it
+
+	Start func(ctx context.Context) error // nil: nothing to start
+	Stop  func(ctx context.Context) error // nil: nothing to stop
+
+	StartTimeout time.Duration // 0: DefaultStartTimeout
+	StopTimeout  time.Duration // 0: DefaultStopTimeout
+	Restartable  bool          // Can be restarted on its own (see Restart)
+}
+
+// Status is a registered service and whether it is running.
+type Status struct {
+	Name        string   `json:"name"`
+	DependsOn   []string `json:"depends_on,omitempty"`
+	Running     bool     `json:"running"`
+	Restartable bool     `json:"restartable"`
+}
+
+// entry is a registered service and its state.
+type entry struct {
+	Service
+	running bool
+}
+
+var (
+	mu       sync.Mutex // Also held while services start and stop
+	services []*entry
+)
+
+// Register adds a service, replacing one registered under the same name (which keeps its state).
+func Register(service Service) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, existing := range services {
+		if existing.Name == service.Name {
+			existing.Service = service
+			return
+		}
+	}
+	services = append(services, &entry{Service: service})
+}
+
+// Services returns the registered services, in start order.
+func Services() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+	ordered := order(services)
+	statuses := make([]Status, len(ordered))
+	for i, e := range ordered {
+		statuses[i] = Status{Name: e.Name, DependsOn: e.DependsOn, Running: e.running, Restartable: e.Restartable}
+	}
+	return statuses
+}
+
+// Reset removes the registered services, without stopping them. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	services = nil
+}
+
+// StartAll starts the services that are not running, in order. A service failing to start is
+// left stopped and startup goes on; the errors are returned together.
+func StartAll(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	started := time.Now()
+	var errs []error
+	count := 0
+	for _, e := range order(services) {
+		if e.running {
+			continue
+		}
+		if err := e.start(ctx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		count++
+	}
+	slog.Info("Started services", "started", count, "failed", len(errs), "duration", time.Since(started).String())
+	return errors.Join(errs...)
+}
+
+// StopAll stops the running services in the reverse order of StartAll. A service failing to stop
+// doesn't keep the others running; the errors are returned together.
+func StopAll(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	started := time.Now()
+	var errs []error
+	ordered := order(services)
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if e := ordered[i]; e.running {
+			if err := e.stop(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	slog.Info("Stopped services", "failed", len(errs), "duration", time.Since(started).String())
+	return errors.Join(errs...)
+}
+
+// Restart stops a restartable service and the restartable services depending on it (directly or
+// not), then starts them again, name first. It returns the names of the restarted services in
+// the order they were started. A service failing to stop or start ends the restart with its
+// error: the services stopped and not started again stay stopped until the next restart.
+func Restart(ctx context.Context, name string) ([]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	i := slices.IndexFunc(services, func(e *entry) bool { return e.Name == name })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	if !services[i].Restartable {
+		return nil, fmt.Errorf("%w: %s", ErrNotRestartable, name)
+	}
+
+	started := time.Now()
+	affected := dependents(name)
+	for j := len(affected) - 1; j >= 0; j-- {
+		if affected[j].running {
+			if err := affected[j].stop(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	names := make([]string, 0, len(affected))
+	for _, e := range affected {
+		if err := e.start(ctx); err != nil {
+			return names, err
+		}
+		names = append(names, e.Name)
+	}
+	slog.Info("Restarted services", "services", names, "duration", time.Since(started).String())
+	return names, nil
+}
+
+// start runs the service's Start hook, marking it running if it succeeds. Callers hold mu.
+func (e *entry) start(ctx context.Context) error {
+	if err := call(ctx, e.Start, orDefault(e.StartTimeout, DefaultStartTimeout)); err != nil {
+		slog.Error("Failed to start service", "service", e.Name, "error", err)
+		return fmt.Errorf("failed to start %s: %w", e.Name, err)
+	}
+	e.running = true
+	return nil
+}
+
+// stop runs the service's Stop hook. The service counts as stopped even if it fails, so it is
+// started again by the next restart. Callers hold mu.
+func (e *entry) stop(ctx context.Context) error {
+	e.running = false
+	if err := call(ctx, e.Stop, orDefault(e.StopTimeout, DefaultStopTimeout)); err != nil {
+		slog.Error("Failed to stop service", "service", e.Name, "error", err)
+		return fmt.Errorf("failed to stop %s: %w", e.Name, err)
+	}
+	return nil
+}
+
+// call runs hook with a context ending after timeout, and stops waiting for it then: the hook
+// goes on in the background, but startup or shutdown doesn't wait for it any longer.
+func call(ctx context.Context, hook func(ctx context.Context) error, timeout time.Duration) error {
+	if hook == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up after %s: %w", timeout, ctx.Err())
+	}
+}
+
+// dependents returns name and the restartable services depending on it, in start order. Callers
+// hold mu.
+func dependents(name string) []*entry {
+	affected := map[string]bool{name: true}
+	for changed := true; changed; {
+		changed = false
+		for _, e := range services {
+			if affected[e.Name] || !e.Restartable {
+				continue
+			}
+			if slices.ContainsFunc(e.DependsOn, func(dependency string) bool { return affected[dependency] }) {
+				affected[e.Name], changed = true, true
+			}
+		}
+	}
+
+	var selected []*entry
+	for _, e := range order(services) {
+		if affected[e.Name] {
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
+
+// order returns entries in registration order, each moved after the entries it depends on.
+// Dependencies that are not registered are ignored, and a cycle is started in registration order.
+func order(entries []*entry) []*entry {
+	registered := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		registered[e.Name] = true
+	}
+
+	ordered := make([]*entry, 0, len(entries))
+	placed := make(map[string]bool, len(entries))
+	for len(ordered) < len(entries) {
+		progress := false
+		for _, e := range entries {
+			if placed[e.Name] {
+				continue
+			}
+			ready := !slices.ContainsFunc(e.DependsOn, func(dependency string) bool {
+				return registered[dependency] && !placed[dependency]
+			})
+			if ready {
+				ordered = append(ordered, e)
+				placed[e.Name], progress = true, true
+				break // Restart from the first entry, to keep registration order
+			}
+		}
+		if !progress {
+			// A cycle: place the first remaining entry
+			for _, e := range entries {
+				if !placed[e.Name] {
+					ordered = append(ordered, e)
+					placed[e.Name] = true
+					break
+				}
+			}
+		}
+	}
+	return ordered
+}
+
+// Background returns a service running loop in a goroutine: Start starts it, and Stop cancels its
+// context and waits for it to return.
+func Background(name string, loop func(ctx context.Context), dependsOn ...string) Service {
+	runner := &Runner{}
+	return Service{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			if !runner.Start(loop) {
+				return errors.New("the previous loop is still stopping")
+			}
+			return nil
+		},
+		Stop: runner.Stop,
+	}
+}
+
+// Runner runs a background loop that can be stopped and started again. The zero value is ready
+// to use.
+type Runner struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start runs loop in a goroutine with a context Stop cancels. It does nothing if a loop started
+// earlier is still running, and reports whether it started this one.
+func (r *Runner) Start(loop func(ctx context.Context)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done != nil {
+		select {
+		case <-r.done:
+		default:
+			return false
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.cancel, r.done = cancel, done
+	go func() {
+		defer close(done)
+		loop(ctx)
+	}()
+	return true
+}
+
+// Stop cancels the running loop's context and waits for it to return, or for ctx to end. It
+// returns nil when no loop is running.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// orDefault returns value, or fallback when value is not positive.
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
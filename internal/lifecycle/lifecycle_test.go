@@ -0,0 +1,204 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// record registers a restartable service appending its stops and starts to calls.
+func record(calls *[]string, name string, dependsOn ...string) {
+	Register(Service{
+		Name:        name,
+		DependsOn:   dependsOn,
+		Restartable: true,
+		Stop: func(context.Context) error {
+			*calls = append(*calls, "stop "+name)
+			return nil
+		},
+		Start: func(context.Context) error {
+			*calls = append(*calls, "start "+name)
+			return nil
+		},
+	})
+}
+
+// TestRestart tests that the services depending on a service, directly or not, restart with it:
+// stopped before it and started after it.
+func TestRestart(t *testing.T) {
+	t.Cleanup(Reset)
+	var calls []string
+	record(&calls, "jobs", "cache")
+	record(&calls, "cache")
+	record(&calls, "reports", "jobs")
+	record(&calls, "realtime")
+	require.NoError(t, StartAll(context.Background()))
+
+	calls = nil
+	restarted, err := Restart(context.Background(), "cache")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cache", "jobs", "reports"}, restarted)
+	assert.Equal(t, []string{
+		"stop reports", "stop jobs", "stop cache",
+		"start cache", "start jobs", "start reports",
+	}, calls)
+
+	calls = nil
+	restarted, err = Restart(context.Background(), "realtime")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"realtime"}, restarted)
+	assert.Equal(t, []string{"stop realtime", "start realtime"}, calls)
+
+	_, err = Restart(context.Background(), "search")
+	assert.ErrorIs(t, err, ErrUnknownService)
+}
+
+// TestRestart_NotRestartable tests that only restartable services restart, on their own or with
+// the service they depend on.
+func TestRestart_NotRestartable(t *testing.T) {
+	t.Cleanup(Reset)
+	var calls []string
+	record(&calls, "cache")
+	Register(Service{Name: "webhook", DependsOn: []string{"cache"}})
+	record(&calls, "jobs", "webhook")
+
+	_, err := Restart(context.Background(), "webhook")
+	assert.ErrorIs(t, err, ErrNotRestartable)
+
+	restarted, err := Restart(context.Background(), "cache")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cache"}, restarted, "jobs depends on the cache through webhook only")
+}
+
+// TestRestartFailure tests that a failing start ends the restart with the services started so far.
+func TestRestartFailure(t *testing.T) {
+	t.Cleanup(Reset)
+	var calls []string
+	record(&calls, "cache")
+	Register(Service{
+		Name:        "jobs",
+		DependsOn:   []string{"cache"},
+		Restartable: true,
+		Start:       func(context.Context) error { return errors.New("no queue") },
+	})
+
+	restarted, err := Restart(context.Background(), "cache")
+	assert.EqualError(t, err, "failed to start jobs: no queue")
+	assert.Equal(t, []string{"cache"}, restarted)
+}
+
+// TestStartAll tests that services start in registration order, each moved after its
+// dependencies, and stop in the reverse order.
+func TestStartAll(t *testing.T) {
+	t.Cleanup(Reset)
+	var calls []string
+	record(&calls, "jobs", "cache", "db")
+	record(&calls, "cache")
+	record(&calls, "templates")
+	record(&calls, "db")
+	record(&calls, "health", "missing")
+
+	require.NoError(t, StartAll(context.Background()))
+	assert.Equal(t, []string{"start cache", "start templates", "start db", "start jobs", "start health"}, calls)
+	for _, service := range Services() {
+		assert.True(t, service.Running, service.Name)
+	}
+
+	calls = nil
+	require.NoError(t, StartAll(context.Background()), "running services are not started again")
+	assert.Empty(t, calls)
+
+	require.NoError(t, StopAll(context.Background()))
+	assert.Equal(t, []string{"stop health", "stop jobs", "stop db", "stop templates", "stop cache"}, calls)
+	for _, service := range Services() {
+		assert.False(t, service.Running, service.Name)
+	}
+}
+
+// TestStartAll_Failures tests that a service failing or timing out is left stopped and the others
+// still start, and that StopAll only stops running services.
+func TestStartAll_Failures(t *testing.T) {
+	t.Cleanup(Reset)
+	var calls []string
+	record(&calls, "cache")
+	Register(Service{
+		Name:  "db",
+		Start: func(context.Context) error { return errors.New("connection refused") },
+		Stop: func(context.Context) error {
+			calls = append(calls, "stop db")
+			return nil
+		},
+	})
+	release := make(chan struct{})
+	defer close(release)
+	Register(Service{
+		Name:         "realtime",
+		StartTimeout: 10 * time.Millisecond,
+		Start: func(context.Context) error {
+			<-release // Ignores its context
+			return nil
+		},
+	})
+	record(&calls, "jobs", "cache")
+
+	err := StartAll(context.Background())
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "failed to start db: connection refused")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"start cache", "start jobs"}, calls)
+
+	calls = nil
+	require.NoError(t, StopAll(context.Background()))
+	assert.Equal(t, []string{"stop jobs", "stop cache"}, calls)
+}
+
+// TestBackground tests that a background service's loop runs until the service stops.
+func TestBackground(t *testing.T) {
+	t.Cleanup(Reset)
+	stopped := make(chan struct{})
+	Register(Background("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	}))
+
+	require.NoError(t, StartAll(context.Background()))
+	require.NoError(t, StopAll(context.Background()))
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("the loop is still running")
+	}
+}
+
+// TestRunner tests that a loop can be stopped and started again, but not started twice.
+func TestRunner(t *testing.T) {
+	var runner Runner
+	require.NoError(t, runner.Stop(context.Background()), "nothing to stop")
+
+	started := make(chan struct{}, 2)
+	loop := func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+	}
+	require.True(t, runner.Start(loop))
+	<-started
+	assert.False(t, runner.Start(loop), "still running")
+
+	require.NoError(t, runner.Stop(context.Background()))
+	require.True(t, runner.Start(loop))
+	<-started
+	require.NoError(t, runner.Stop(context.Background()))
+
+	// Stop gives up waiting when its context ends
+	release := make(chan struct{})
+	require.True(t, runner.Start(func(context.Context) { <-release }))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, runner.Stop(ctx), context.DeadlineExceeded)
+	assert.False(t, runner.Start(loop))
+	close(release)
+}
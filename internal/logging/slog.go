@@ -0,0 +1,208 @@
+package logging
+
+// Structured logging.
+//
+// Init installs a log/slog logger writing one JSON object per line (LOG_FORMAT=text for
+// key=value lines) through the redacting writer, at LOG_LEVEL and above. Lines still written
+// with the standard log package are bridged into it, their "ERROR: ", "WARNING: " and "INFO: "
+// prefixes becoming the level. RequestID gives every request a correlation ID (X-Request-ID),
+// FromRequest returns a logger carrying it, and AccessLog logs one line per request.
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// RequestIDHeader carries the correlation ID, from the client (or a proxy in front) and back.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the fiber Locals key (copied to WebSocket connections) holding the request ID.
+const RequestIDKey = "request_id"
+
+// maxRequestIDLength bounds client-supplied IDs; longer ones are replaced.
+const maxRequestIDLength = 128
+
+// Log formats (LOG_FORMAT).
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// NewLogger creates a logger writing to out (through the redacting writer) in format, at level
+// and above.
+func NewLogger(out io.Writer, format string, level slog.Level) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if format == FormatText {
+		return slog.New(slog.NewTextHandler(NewWriter(out), options))
+	}
+	return slog.New(slog.NewJSONHandler(NewWriter(out), options))
+}
+
+// initSlog installs the structured logger from LOG_FORMAT and LOG_LEVEL and bridges the
+// standard logger into it.
+func initSlog() {
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT")))
+	if format != FormatText {
+		format = FormatJSON
+	}
+	level, levelErr := parseLevel(os.Getenv("LOG_LEVEL"))
+
+	logger := NewLogger(os.Stderr, format, level)
+	slog.SetDefault(logger)
+	Bridge(logger)
+
+	if levelErr != nil {
+		slog.Warn("Invalid LOG_LEVEL, using info", "value", os.Getenv("LOG_LEVEL"))
+	}
+}
+
+// parseLevel parses LOG_LEVEL (debug, info, warn or error; info when empty).
+func parseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(value) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return slog.LevelInfo, err
+	}
+	return level, nil
+}
+
+// Bridge sends lines written with the standard log package to logger. Call it after
+// slog.SetDefault (which points the standard logger at the handler, always at info).
+func Bridge(logger *slog.Logger) {
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(&bridge{logger: logger})
+}
+
+// bridge turns each standard log line into a record, leveled by its prefix.
+type bridge struct {
+	logger *slog.Logger
+}
+
+// levelPrefixes map the prefixes used with the standard logger to levels.
+var levelPrefixes = []struct {
+	prefix string
+	level  slog.Level
+}{
+	{"ERROR: ", slog.LevelError},
+	{"WARNING: ", slog.LevelWarn},
+	{"WARN: ", slog.LevelWarn},
+	{"INFO: ", slog.LevelInfo},
+	{"DEBUG: ", slog.LevelDebug},
+}
+
+// Write logs p as one record. It reports len(p) so the standard logger never sees a short write.
+func (b *bridge) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\n")
+	level := slog.LevelInfo
+	for _, lp := range levelPrefixes {
+		if strings.HasPrefix(message, lp.prefix) {
+			message, level = strings.TrimPrefix(message, lp.prefix), lp.level
+			break
+		}
+	}
+	b.logger.Log(context.Background(), level, message)
+	return len(p), nil
+}
+
+// RequestID is the middleware assigning each request its correlation ID: the client's
+// X-Request-ID if it is a reasonable token, a new UUID otherwise. The ID is stored in Locals
+// and echoed in the response header.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = utils.UUIDv4()
+		}
+		c.Locals(RequestIDKey, id)
+		c.Set(RequestIDHeader, id)
+		return c.Next()
+	}
+}
+
+// validRequestID accepts IDs made of letters, digits and -_.: only, so they can't forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// GetRequestID returns the request's correlation ID ("" outside RequestID).
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(RequestIDKey).(string)
+	return id
+}
+
+// FromRequest returns the default logger with the request's ID, method, path and (once
+// authenticated) user ID attached.
+func FromRequest(c *fiber.Ctx) *slog.Logger {
+	logger := slog.Default().With(
+		"request_id", GetRequestID(c),
+		"method", c.Method(),
+		"path", c.Path(),
+	)
+	if userID, _ := c.Locals("user").(string); userID != "" {
+		logger = logger.With("user_id", userID)
+	}
+	return logger
+}
+
+// AccessLog is the middleware logging one line per request: request ID, user ID, method, path,
+// status, latency and client IP. 5xx responses are logged as errors.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// Let the error handler write the response first, so the logged status is the one sent
+		if err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", GetRequestID(c)),
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", c.IP()),
+		}
+		if userID, _ := c.Locals("user").(string); userID != "" {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+		var fiberErr *fiber.Error
+		if err != nil && !errors.As(err, &fiberErr) {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		slog.Default().LogAttrs(c.UserContext(), level, "Request", attrs...)
+		return nil
+	}
+}
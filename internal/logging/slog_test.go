@@ -0,0 +1,173 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useLogger makes a JSON logger writing to the returned buffer the default for one test.
+func useLogger(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	original := slog.Default()
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, FormatJSON, slog.LevelDebug)
+	slog.SetDefault(logger)
+	Bridge(logger)
+	t.Cleanup(func() {
+		slog.SetDefault(original)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	})
+	return &buf
+}
+
+// records decodes the JSON lines in buf.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		out = append(out, record)
+	}
+	return out
+}
+
+// TestBridge tests that standard log lines become records leveled by their prefix.
+func TestBridge(t *testing.T) {
+	buf := useLogger(t)
+
+	log.Printf("ERROR: Failed to load profile: %v", "boom")
+	log.Println("WARNING: Cache not initialized")
+	log.Println("Server starting")
+
+	got := records(t, buf)
+	require.Len(t, got, 3)
+	assert.Equal(t, "ERROR", got[0]["level"])
+	assert.Equal(t, "Failed to load profile: boom", got[0]["msg"])
+	assert.Equal(t, "WARN", got[1]["level"])
+	assert.Equal(t, "Cache not initialized", got[1]["msg"])
+	assert.Equal(t, "INFO", got[2]["level"])
+}
+
+// TestNewLogger_Redacts tests that structured attributes are redacted too.
+func TestNewLogger_Redacts(t *testing.T) {
+	buf := useLogger(t)
+
+	slog.Error("Upstream failed", "header", "Authorization: Bearer "+testJWT)
+	assert.NotContains(t, buf.String(), testJWT)
+	assert.Contains(t, buf.String(), Mask)
+}
+
+// TestParseLevel tests LOG_LEVEL parsing.
+func TestParseLevel(t *testing.T) {
+	level, err := parseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelInfo, level)
+
+	level, err = parseLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	_, err = parseLevel("loud")
+	assert.Error(t, err)
+}
+
+// TestRequestID tests that valid client IDs are kept and missing or unsafe ones replaced.
+func TestRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetRequestID(c))
+	})
+
+	testCases := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"client id", "abc-123_x.y:z", true},
+		{"missing", "", false},
+		{"unsafe characters", "abc\" injected=1", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				req.Header.Set(RequestIDHeader, tc.header)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			id := resp.Header.Get(RequestIDHeader)
+			require.NotEmpty(t, id)
+			if tc.keep {
+				assert.Equal(t, tc.header, id)
+			} else {
+				assert.NotEqual(t, tc.header, id)
+			}
+		})
+	}
+}
+
+// TestAccessLog tests the per-request record, including the user set by a later handler and
+// the status written by the error handler.
+func TestAccessLog(t *testing.T) {
+	buf := useLogger(t)
+
+	app := fiber.New()
+	app.Use(RequestID(), AccessLog())
+	app.Get("/me", func(c *fiber.Ctx) error {
+		c.Locals("user", "user-1")
+		FromRequest(c).Info("Loading profile")
+		return c.SendString("ok")
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "down")
+	})
+
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	_, err := app.Test(req)
+	require.NoError(t, err)
+	resp, err := app.Test(httptest.NewRequest("GET", "/broken", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+
+	got := records(t, buf)
+	require.Len(t, got, 3)
+
+	// The handler's own line carries the request's fields
+	assert.Equal(t, "Loading profile", got[0]["msg"])
+	assert.Equal(t, "req-1", got[0]["request_id"])
+	assert.Equal(t, "user-1", got[0]["user_id"])
+	assert.Equal(t, "/me", got[0]["path"])
+
+	assert.Equal(t, "Request", got[1]["msg"])
+	assert.Equal(t, "INFO", got[1]["level"])
+	assert.Equal(t, "req-1", got[1]["request_id"])
+	assert.Equal(t, "user-1", got[1]["user_id"])
+	assert.Equal(t, "GET", got[1]["method"])
+	assert.Equal(t, float64(200), got[1]["status"])
+	assert.Contains(t, got[1], "latency_ms")
+
+	assert.Equal(t, "ERROR", got[2]["level"])
+	assert.Equal(t, float64(503), got[2]["status"])
+	assert.NotEmpty(t, got[2]["request_id"])
+	assert.NotContains(t, got[2], "user_id")
+}
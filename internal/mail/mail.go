@@ -0,0 +1,161 @@
+package mail
+
+// Package mail sends transactional emails (e.g. account deletion confirmations).
+// With SMTP_HOST set, messages go out over SMTP; otherwise they are logged (without the
+// recipient address) and dropped, so local development needs no mail server.
+//
+// SendTemplate renders an email from internal/templates (plain text, plus an HTML alternative
+// when the template has one) in the recipient's locale.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+
+	"boilerplate/internal/startup"
+	"boilerplate/internal/templates"
+)
+
+// Mailer sends a plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// HTMLMailer is implemented by mailers that can send an HTML alternative to the plain text.
+// Mailers without it get the plain text only.
+type HTMLMailer interface {
+	SendHTML(to, subject, text, html string) error
+}
+
+// DefaultMailer is the mailer used by Send. It logs messages until Init() or SetDefault() is called.
+var DefaultMailer Mailer = logMailer{}
+
+// Init configures the default mailer from the environment.
+//
+// SMTP settings: SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM.
+func Init() {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("WARNING: SMTP_HOST not set, emails will be logged instead of sent")
+		startup.Report("mail", false, "SMTP_HOST not set, emails are logged instead of sent")
+		DefaultMailer = logMailer{}
+		return
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USERNAME")
+	}
+
+	DefaultMailer = &SMTPMailer{
+		Addr:     host + ":" + port,
+		Host:     host,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+	log.Printf("Mailer initialized (SMTP %s:%s)", host, port)
+	startup.Report("mail", true, "SMTP "+host+":"+port)
+}
+
+// SetDefault replaces the default mailer. Mainly useful in tests.
+func SetDefault(mailer Mailer) {
+	DefaultMailer = mailer
+}
+
+// Send sends an email with the default mailer.
+func Send(to, subject, body string) error {
+	if DefaultMailer == nil {
+		return fmt.Errorf("mailer not initialized")
+	}
+	return DefaultMailer.Send(to, subject, body)
+}
+
+// SendTemplate renders the email template name (see internal/templates) in locale ("" for the
+// default) and sends it with the default mailer.
+func SendTemplate(to, name, locale string, data any) error {
+	if DefaultMailer == nil {
+		return fmt.Errorf("mailer not initialized")
+	}
+	email, err := templates.RenderEmail(name, locale, data)
+	if err != nil {
+		return err
+	}
+	if html, ok := DefaultMailer.(HTMLMailer); ok && email.HTML != "" {
+		return html.SendHTML(to, email.Subject, email.Text, email.HTML)
+	}
+	return DefaultMailer.Send(to, email.Subject, email.Text)
+}
+
+// SMTPMailer sends email through an SMTP server using PLAIN auth (STARTTLS when offered).
+type SMTPMailer struct {
+	Addr     string // host:port
+	Host     string // Used for PLAIN auth
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers a plain-text message.
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	return m.send(to, subject, "Content-Type: text/plain; charset=UTF-8\r\n\r\n"+body)
+}
+
+// SendHTML delivers a message with plain-text and HTML alternatives (multipart/alternative).
+func (m *SMTPMailer) SendHTML(to, subject, text, html string) error {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to generate MIME boundary: %w", err)
+	}
+	boundary := "alt-" + hex.EncodeToString(random)
+	body := "Content-Type: multipart/alternative; boundary=\"" + boundary + "\"\r\n\r\n" +
+		"--" + boundary + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" + text + "\r\n" +
+		"--" + boundary + "\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n\r\n" + html + "\r\n" +
+		"--" + boundary + "--\r\n"
+	return m.send(to, subject, body)
+}
+
+// send delivers a message whose content headers and body are content.
+func (m *SMTPMailer) send(to, subject, content string) error {
+	// Reject header injection through the recipient or subject
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid email header value")
+	}
+
+	message := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("UTF-8", subject) + "\r\n" + // ASCII subjects are unchanged
+		"MIME-Version: 1.0\r\n" +
+		content
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// logMailer logs the subject instead of sending. The recipient is omitted: it's personal data.
+type logMailer struct{}
+
+// Send logs the message subject.
+func (logMailer) Send(to, subject, body string) error {
+	log.Printf("INFO: Email not sent (SMTP not configured): %q", subject)
+	return nil
+}
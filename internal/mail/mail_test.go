@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInit_FallsBackToLogMailer tests that without SMTP_HOST emails are logged, not sent.
+func TestInit_FallsBackToLogMailer(t *testing.T) {
+	original := DefaultMailer
+	defer SetDefault(original)
+
+	originalHost := os.Getenv("SMTP_HOST")
+	defer os.Setenv("SMTP_HOST", originalHost)
+	os.Unsetenv("SMTP_HOST")
+
+	Init()
+	assert.IsType(t, logMailer{}, DefaultMailer)
+	assert.NoError(t, Send("user@example.com", "Hello", "Body"))
+}
+
+// TestInit_ConfiguresSMTP tests the SMTP settings and defaults.
+func TestInit_ConfiguresSMTP(t *testing.T) {
+	original := DefaultMailer
+	defer SetDefault(original)
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("SMTP_USERNAME", "noreply@example.com")
+	t.Setenv("SMTP_FROM", "")
+
+	Init()
+	mailer, ok := DefaultMailer.(*SMTPMailer)
+	require.True(t, ok)
+	assert.Equal(t, "smtp.example.com:587", mailer.Addr)
+	assert.Equal(t, "noreply@example.com", mailer.From)
+}
+
+// TestSMTPMailer_RejectsHeaderInjection tests that CR/LF in headers is refused before connecting.
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	mailer := &SMTPMailer{Addr: "127.0.0.1:1", From: "noreply@example.com"}
+
+	assert.Error(t, mailer.Send("user@example.com\r\nBcc: victim@example.com", "Hi", "Body"))
+	assert.Error(t, mailer.Send("user@example.com", "Hi\r\nBcc: victim@example.com", "Body"))
+}
+
+// htmlMailer records the alternatives of sent emails.
+type htmlMailer struct {
+	subject, text, html string
+}
+
+func (m *htmlMailer) Send(to, subject, body string) error {
+	m.subject, m.text = subject, body
+	return nil
+}
+
+func (m *htmlMailer) SendHTML(to, subject, text, html string) error {
+	m.subject, m.text, m.html = subject, text, html
+	return nil
+}
+
+// TestSendTemplate tests that templates are rendered in the locale, with the HTML alternative
+// for mailers supporting it.
+func TestSendTemplate(t *testing.T) {
+	original := DefaultMailer
+	defer SetDefault(original)
+
+	mailer := &htmlMailer{}
+	SetDefault(mailer)
+	require.NoError(t, SendTemplate("user@example.com", "deletion_completed", "de", nil))
+	assert.Equal(t, "Dein Konto wurde gelöscht", mailer.subject)
+	assert.Contains(t, mailer.html, "</html>")
+
+	assert.Error(t, SendTemplate("user@example.com", "missing", "", nil))
+}
@@ -0,0 +1,258 @@
+package memory
+
+// Package memory keeps the server within its memory budget, so a small instance (a 256-512 MB
+// Fly.io machine or Render service) degrades under broadcast load instead of being OOM-killed.
+//
+// Budget: Init applies GOMEMLIMIT (or MEMORY_LIMIT_PERCENT of the container's cgroup limit) as
+// the runtime's soft memory limit, and GOGC as its GC target. Near the limit the GC runs more
+// often to stay under it, which costs CPU but not the process.
+//
+// Watchdog: the GC can only free garbage. When live data itself grows towards the limit (many
+// WebSocket clients with full send buffers, a large in-memory cache), RunWatchdog sheds load:
+// every MEMORY_WATCHDOG_INTERVAL it compares the memory the runtime holds with the limit, logs
+// once past MEMORY_WARN_THRESHOLD, and past MEMORY_SHED_THRESHOLD calls the registered shedders
+// with MEMORY_SHED_FRACTION, e.g. to close that share of WebSocket clients and drop that share
+// of cached entries, then returns the freed memory to the OS. It keeps shedding on every check
+// until usage is back under the threshold.
+//
+// Subsystems holding memory that can be given up register a Shedder from their Init, like
+// gdpr.RegisterTable:
+//
+//	memory.RegisterShedder("websocket", hub.Shed)
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	appmetrics "boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+)
+
+// Shedder releases about fraction (0-1] of the memory a subsystem holds, returning how many
+// items (clients, entries, ...) it released.
+type Shedder func(fraction float64) int
+
+// Watchdog states, logged when they change.
+const (
+	stateOK   = "ok"
+	stateWarn = "warn"
+	stateShed = "shed"
+)
+
+// cgroupLimitFiles hold the container's memory limit: cgroup v2, then v1. Overridden in tests.
+var cgroupLimitFiles = []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"}
+
+// watchdog holds the settings and state of the watchdog.
+type watchdog struct {
+	limit         int64 // Bytes; 0: no limit, nothing to watch
+	interval      time.Duration
+	warnThreshold float64
+	shedThreshold float64
+	shedFraction  float64
+
+	state string
+	inUse func() uint64 // Overridable for tests
+}
+
+var (
+	mu       sync.Mutex
+	current  = &watchdog{state: stateOK, inUse: readInUse}
+	shedders []namedShedder
+)
+
+// namedShedder is a registered Shedder.
+type namedShedder struct {
+	name string
+	shed Shedder
+}
+
+// Init applies the memory limit and GC target of cfg to the runtime and configures the watchdog.
+// A MEMORY_LIMIT_PERCENT without a container limit to take it from is logged and ignored.
+func Init(cfg config.Memory) {
+	limit, source := cfg.Limit, "GOMEMLIMIT"
+	if limit == 0 && cfg.LimitPercent > 0 {
+		container := containerLimit()
+		if container == 0 {
+			slog.Warn("MEMORY_LIMIT_PERCENT set but no container memory limit found, memory is not limited")
+		} else {
+			limit = container / 100 * int64(cfg.LimitPercent)
+			source = fmt.Sprintf("%d%% of the container's %s", cfg.LimitPercent, formatBytes(container))
+		}
+	}
+	if limit > 0 {
+		debug.SetMemoryLimit(limit)
+	}
+	debug.SetGCPercent(cfg.GCPercent)
+	Configure(limit, cfg)
+
+	gc := "GOGC " + strconv.Itoa(cfg.GCPercent)
+	if cfg.GCPercent < 0 {
+		gc = "GOGC off"
+	}
+	switch {
+	case limit == 0:
+		startup.Report("memory", false, "GOMEMLIMIT and MEMORY_LIMIT_PERCENT not set, "+gc)
+	case cfg.WatchdogInterval == 0:
+		startup.Report("memory", true, fmt.Sprintf("limit %s (%s), %s, watchdog off", formatBytes(limit), source, gc))
+	default:
+		startup.Report("memory", true, fmt.Sprintf("limit %s (%s), %s, shedding above %.0f%% every %s",
+			formatBytes(limit), source, gc, cfg.ShedThreshold*100, cfg.WatchdogInterval))
+	}
+}
+
+// Configure sets the limit (in bytes, 0 for none) and watchdog settings of cfg, without changing
+// the runtime's. Mainly useful in tests.
+func Configure(limit int64, cfg config.Memory) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = &watchdog{
+		limit:         limit,
+		interval:      cfg.WatchdogInterval,
+		warnThreshold: cfg.WarnThreshold,
+		shedThreshold: cfg.ShedThreshold,
+		shedFraction:  cfg.ShedFraction,
+		state:         stateOK,
+		inUse:         current.inUse,
+	}
+}
+
+// RegisterShedder adds a shedder called when memory in use passes MEMORY_SHED_THRESHOLD,
+// replacing one registered under the same name (e.g. by a restarted subsystem).
+func RegisterShedder(name string, shed Shedder) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, existing := range shedders {
+		if existing.name == name {
+			shedders[i].shed = shed
+			return
+		}
+	}
+	shedders = append(shedders, namedShedder{name: name, shed: shed})
+}
+
+// Reset removes the shedders and the limit. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	shedders = nil
+	current = &watchdog{state: stateOK, inUse: readInUse}
+}
+
+// RunWatchdog checks memory in use every MEMORY_WATCHDOG_INTERVAL, until ctx is cancelled. It
+// returns right away without a limit or with the watchdog disabled. Start it in a goroutine after
+// Init.
+func RunWatchdog(ctx context.Context) {
+	mu.Lock()
+	limit, interval := current.limit, current.interval
+	mu.Unlock()
+	if limit == 0 || interval == 0 {
+		return
+	}
+	slog.Info("Memory watchdog started", "limit", formatBytes(limit), "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// check compares memory in use with the limit, logging state changes and shedding past the shed
+// threshold.
+func check() {
+	mu.Lock()
+	defer mu.Unlock()
+	w := current
+	if w.limit == 0 {
+		return
+	}
+
+	inUse := w.inUse()
+	appmetrics.MemoryInUse.Set(float64(inUse))
+	share := float64(inUse) / float64(w.limit)
+	state := stateOK
+	switch {
+	case share >= w.shedThreshold:
+		state = stateShed
+	case share >= w.warnThreshold:
+		state = stateWarn
+	}
+
+	attrs := []any{"in_use", formatBytes(int64(inUse)), "limit", formatBytes(w.limit), "percent", int(share * 100)}
+	if state != w.state {
+		switch state {
+		case stateOK:
+			slog.Info("Memory in use back under the warning threshold", attrs...)
+		case stateWarn:
+			slog.Warn("Memory in use nearing the limit", attrs...)
+		case stateShed:
+			slog.Error("Memory in use near the limit, shedding load", attrs...)
+		}
+		w.state = state
+	}
+	if state != stateShed {
+		return
+	}
+
+	for _, shedder := range shedders {
+		released := shedder.shed(w.shedFraction)
+		appmetrics.MemoryShed.WithLabelValues(shedder.name).Add(float64(released))
+		slog.Warn("Shed load", "shedder", shedder.name, "released", released)
+	}
+	debug.FreeOSMemory() // Collect what was released now, and give it back to the OS
+}
+
+// inUseMetrics are the runtime metrics read for the memory in use: everything the runtime
+// holds, minus heap memory already returned to the OS. It is what the memory limit counts.
+var inUseMetrics = []string{"/memory/classes/total:bytes", "/memory/classes/heap/released:bytes"}
+
+// readInUse returns the memory the runtime holds, as the memory limit counts it.
+func readInUse() uint64 {
+	samples := []metrics.Sample{{Name: inUseMetrics[0]}, {Name: inUseMetrics[1]}}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// containerLimit returns the container's memory limit in bytes, or 0 if it has none.
+func containerLimit() int64 {
+	for _, name := range cgroupLimitFiles {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		// "max" (v2) or a huge number (v1, rounded down from MaxInt64) mean no limit
+		if err != nil || limit <= 0 || limit >= 1<<60 {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
+
+// formatBytes formats a size in the largest binary unit it reaches, to one decimal: 450MiB, 1.5GiB.
+func formatBytes(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n >= unit.size {
+			return strings.TrimSuffix(strconv.FormatFloat(float64(n)/float64(unit.size), 'f', 1, 64), ".0") + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
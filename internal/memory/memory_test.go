@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// settings are the default watchdog settings.
+var settings = config.Memory{GCPercent: 100, WatchdogInterval: time.Second, WarnThreshold: 0.8, ShedThreshold: 0.9, ShedFraction: 0.1}
+
+// TestCheck tests that shedders are only called past the shed threshold, with the shed fraction,
+// on every check until usage is back under it.
+func TestCheck(t *testing.T) {
+	t.Cleanup(Reset)
+	Configure(1000, settings)
+	inUse := uint64(500)
+	current.inUse = func() uint64 { return inUse }
+
+	var calls []float64
+	RegisterShedder("test", func(fraction float64) int {
+		calls = append(calls, fraction)
+		return 3
+	})
+
+	check()
+	assert.Equal(t, stateOK, current.state)
+	inUse = 850
+	check()
+	assert.Equal(t, stateWarn, current.state)
+	assert.Empty(t, calls)
+
+	inUse = 950
+	check()
+	check()
+	assert.Equal(t, stateShed, current.state)
+	assert.Equal(t, []float64{0.1, 0.1}, calls)
+
+	inUse = 100
+	check()
+	assert.Equal(t, stateOK, current.state)
+	assert.Len(t, calls, 2)
+
+	// Without a limit there is nothing to watch
+	Configure(0, settings)
+	inUse = 1 << 40
+	check()
+	assert.Len(t, calls, 2)
+}
+
+// TestContainerLimit tests reading the cgroup v2 and v1 limits.
+func TestContainerLimit(t *testing.T) {
+	original := cgroupLimitFiles
+	t.Cleanup(func() { cgroupLimitFiles = original })
+	dir := t.TempDir()
+	file := filepath.Join(dir, "memory.max")
+	cgroupLimitFiles = []string{filepath.Join(dir, "missing"), file}
+
+	for content, expected := range map[string]int64{
+		"536870912\n":           512 << 20,
+		"max\n":                 0,
+		"9223372036854771712\n": 0, // cgroup v1 without a limit
+	} {
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+		assert.Equal(t, expected, containerLimit(), content)
+	}
+	require.NoError(t, os.Remove(file))
+	assert.Equal(t, int64(0), containerLimit())
+}
+
+// TestFormatBytes tests the sizes in logs and the startup report.
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "450MiB", formatBytes(450<<20))
+	assert.Equal(t, "1.5GiB", formatBytes(3<<29))
+	assert.Equal(t, "512B", formatBytes(512))
+}
+
+// TestReadInUse tests that the runtime reports memory in use.
+func TestReadInUse(t *testing.T) {
+	assert.Greater(t, readInUse(), uint64(0))
+}
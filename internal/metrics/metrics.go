@@ -0,0 +1,511 @@
+package metrics
+
+// Package metrics exposes Prometheus metrics for the application at /metrics.
+// Metrics are registered on a dedicated registry (not the global default) so tests
+// can inspect values without interference from other packages.
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Auth failure reasons used as the "reason" label of AuthFailures.
+const (
+	ReasonMissingHeader   = "missing_header"
+	ReasonInvalidHeader   = "invalid_header"
+	ReasonMalformed       = "malformed"
+	ReasonBadSignature    = "bad_signature"
+	ReasonExpired         = "expired"
+	ReasonNotYetValid     = "not_yet_valid"
+	ReasonUnknownKid      = "unknown_kid"
+	ReasonJWKSUnavailable = "jwks_unavailable"
+	ReasonUnsupportedAlg  = "unsupported_alg"
+	ReasonMisconfigured   = "misconfigured"
+	ReasonMissingUserID   = "missing_user_id"
+	ReasonInvalidAPIKey   = "invalid_api_key" // Unknown, revoked or expired X-API-Key
+	ReasonOther           = "other"
+)
+
+// Reasons a WebSocket message was dropped, used as the "reason" label of WebSocketDroppedMessages.
+const (
+	DropHubFull           = "hub_full"            // The hub's broadcast queue was full
+	DropSlowClient        = "slow_client"         // A client's send buffer was full (the client is evicted)
+	DropRealtimeQueueFull = "realtime_queue_full" // The Realtime queue stayed full for WS_REALTIME_QUEUE_TIMEOUT
+)
+
+// Cache lookup results, used as the "result" label of CacheLookups.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+var (
+	// Registry holds every application metric.
+	Registry = prometheus.NewRegistry()
+
+	// AuthFailures counts rejected authentication attempts by reason.
+	// A spike in bad_signature/unknown_kid usually means a key rotation problem;
+	// a spike in bad_signature from many IPs can indicate credential stuffing.
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_failures_total",
+		Help: "Rejected authentication attempts by reason.",
+	}, []string{"reason"})
+
+	// JWKSFetchFailures counts failed attempts to download the Supabase JWKS.
+	JWKSFetchFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_jwks_fetch_failures_total",
+		Help: "Failed attempts to fetch the Supabase JWKS document.",
+	})
+
+	// HTTPRequestDuration is the latency of every request, by method, route pattern and status.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds, by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// SupabaseProxyDuration is the time the GraphQL proxy waits for Supabase (including reading
+	// the response), by status class (2xx, 4xx, 5xx, or error when the request failed).
+	SupabaseProxyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "supabase_proxy_duration_seconds",
+		Help:    "Supabase GraphQL upstream latency in seconds, by status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"status"})
+
+	// SupabaseProxyRetries counts idempotent proxy requests retried after failing to reach
+	// Supabase or getting a 502, 503 or 504 (see PROXY_RETRIES).
+	SupabaseProxyRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "supabase_proxy_retries_total",
+		Help: "Supabase proxy requests retried after a connection error or a 502, 503 or 504.",
+	})
+
+	// GraphQLRejections counts GraphQL requests the proxy refused to forward, by reason
+	// (not_allowed, unknown_persisted_query, invalid, depth, complexity, anonymous_mutation,
+	// introspection).
+	GraphQLRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_rejected_requests_total",
+		Help: "GraphQL requests rejected by the proxy's protections, by reason.",
+	}, []string{"reason"})
+
+	// CacheLookups counts cache reads by result; the hit ratio is hit / (hit + miss).
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookups_total",
+		Help: "Cache reads by result (hit or miss).",
+	}, []string{"result"})
+
+	// SecurityResponses counts 401 and 403 responses per route.
+	SecurityResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_security_responses_total",
+		Help: "HTTP 401/403 responses by route and status code.",
+	}, []string{"route", "status"})
+
+	// SlowRequests counts requests slower than SLOW_REQUEST_THRESHOLD per route.
+	SlowRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_slow_requests_total",
+		Help: "Requests slower than the slow request threshold, by route.",
+	}, []string{"route"})
+
+	// SlowRequestPhaseSeconds sums the time slow requests spent in each phase
+	// (auth, cache, upstream, serialization, other), to show which dependency is slow.
+	SlowRequestPhaseSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_slow_request_phase_seconds_total",
+		Help: "Time spent by slow requests in each phase, in seconds.",
+	}, []string{"phase"})
+
+	// SLOCompliance is the fraction of good requests per objective and window (5m, 1h).
+	SLOCompliance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "slo_compliance_ratio",
+		Help: "Fraction of requests meeting the objective, by route, objective kind and window.",
+	}, []string{"route", "kind", "window"})
+
+	// SLOBurnRate is how many times faster than allowed the error budget is being spent.
+	// 1 means the budget lasts exactly the SLO period.
+	SLOBurnRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "slo_error_budget_burn_rate",
+		Help: "Error budget burn rate, by route, objective kind and window.",
+	}, []string{"route", "kind", "window"})
+
+	// SLOAlerts counts burn rate alerts sent to the alert hooks.
+	SLOAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slo_alerts_total",
+		Help: "SLO burn rate alerts, by route and objective kind.",
+	}, []string{"route", "kind"})
+
+	// DependencyUp is 1 while a dependency (cache, realtime) is healthy and 0 while it is down.
+	DependencyUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dependency_up",
+		Help: "Whether a dependency is healthy (1) or down (0).",
+	}, []string{"dependency"})
+
+	// RealtimeLeader is 1 on the replica consuming Supabase Realtime (the elected leader when
+	// REALTIME_LEADER_ELECTION is on) and 0 on the others.
+	RealtimeLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "realtime_leader",
+		Help: "Whether this replica consumes Supabase Realtime (1) or not (0).",
+	})
+
+	// RealtimeReconnects counts reconnections to Supabase Realtime after the connection dropped.
+	RealtimeReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "realtime_reconnects_total",
+		Help: "Reconnections to Supabase Realtime after a lost connection.",
+	})
+
+	// RealtimeBackfilledRows counts rows replayed from Supabase after a Realtime reconnect.
+	RealtimeBackfilledRows = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "realtime_backfilled_rows_total",
+		Help: "Rows changed while Realtime was disconnected and replayed on reconnect.",
+	})
+
+	// RealtimeSchemaMissingColumns is the number of columns the Realtime subscriber reads that are
+	// missing from a subscribed table (0 when the schema matches).
+	RealtimeSchemaMissingColumns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "realtime_schema_missing_columns",
+		Help: "Columns read by the Realtime subscriber that are missing from the table, by table.",
+	}, []string{"table"})
+
+	// WebSocketClients is the number of WebSocket clients connected to this replica.
+	WebSocketClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_clients",
+		Help: "WebSocket clients currently connected.",
+	})
+
+	// WebSocketBroadcastQueueDepth is the number of messages waiting in the hub's broadcast queue
+	// (capacity 256; messages are dropped when it is full).
+	WebSocketBroadcastQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_broadcast_queue_depth",
+		Help: "Messages waiting in the WebSocket hub's broadcast queue.",
+	})
+
+	// WebSocketDroppedMessages counts messages that never reached a client, by reason.
+	WebSocketDroppedMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_dropped_messages_total",
+		Help: "WebSocket messages dropped before delivery, by reason.",
+	}, []string{"reason"})
+
+	// WebSocketSlowClientEvictions counts clients disconnected for not reading fast enough.
+	WebSocketSlowClientEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "websocket_slow_client_evictions_total",
+		Help: "WebSocket clients disconnected because their send buffer was full.",
+	})
+
+	// WebSocketRealtimeQueueDepth is the number of Realtime changes waiting for the hub (see
+	// WS_REALTIME_QUEUE).
+	WebSocketRealtimeQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_realtime_queue_depth",
+		Help: "Realtime changes waiting in the queue in front of the WebSocket hub.",
+	})
+
+	// WebSocketRealtimeQueueConflated counts Realtime changes replaced in the queue by a newer
+	// change of the same row before the hub took them.
+	WebSocketRealtimeQueueConflated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "websocket_realtime_queue_conflated_total",
+		Help: "Realtime changes superseded by a newer change of the same row while queued for the WebSocket hub.",
+	})
+
+	// WebSocketRealtimeBackpressure counts the time the Realtime subscriber waited for room in a
+	// full queue.
+	WebSocketRealtimeBackpressure = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "websocket_realtime_backpressure_seconds_total",
+		Help: "Seconds the Realtime subscriber waited for room in the WebSocket hub's queue.",
+	})
+
+	// WebSocketBridgeMessages counts the hub messages relayed between replicas over Redis pub/sub
+	// (see WS_REDIS_BRIDGE), by result: published, received, or dropped (not relayed because
+	// the bridge's queue was full or the publish failed).
+	WebSocketBridgeMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_bridge_messages_total",
+		Help: "WebSocket hub messages relayed between replicas over Redis pub/sub, by result.",
+	}, []string{"result"})
+
+	// WebSocketConflatedMessages counts updates of throttled subscriptions replaced by a newer
+	// update of the same topic before they were sent.
+	WebSocketConflatedMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "websocket_conflated_messages_total",
+		Help: "WebSocket updates of throttled subscriptions superseded before being sent.",
+	})
+
+	// MemoryInUse is the memory the runtime holds, as the memory limit counts it (updated by the
+	// memory watchdog; see internal/memory).
+	MemoryInUse = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "memory_in_use_bytes",
+		Help: "Memory held by the Go runtime, as counted against GOMEMLIMIT.",
+	})
+
+	// MemoryShed counts what the memory watchdog released near the limit, by shedder
+	// (websocket clients, cache entries).
+	MemoryShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "memory_shed_total",
+		Help: "Items released by the memory watchdog near the memory limit, by shedder.",
+	}, []string{"shedder"})
+
+	// PushDeliveries counts push notification attempts by provider (fcm, apns) and result
+	// (sent, retried, unregistered, failed, dropped, no_provider).
+	PushDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "push_deliveries_total",
+		Help: "Push notification delivery attempts, by provider and result.",
+	}, []string{"provider", "result"})
+
+	// PushQueueDepth is the number of push notifications waiting for a delivery worker.
+	PushQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "push_queue_depth",
+		Help: "Push notifications waiting in the delivery queue.",
+	})
+
+	// NotificationsSent counts notifications by channel (ws, email, push, digest) and result
+	// (sent, queued for the digest, skipped by the user's preferences, failed).
+	NotificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_sent_total",
+		Help: "User notifications, by channel and result.",
+	}, []string{"channel", "result"})
+
+	// AbuseDecisions counts requests an abuse rule applied to, by rule and action (tag, throttle,
+	// block, or banned for clients already banned).
+	AbuseDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "abuse_decisions_total",
+		Help: "Requests tagged, throttled or blocked by abuse rules, by rule and action.",
+	}, []string{"rule", "action"})
+
+	// DatabaseReplicaLag is how far each read replica is behind the primary, in seconds (-1 while
+	// it doesn't answer).
+	DatabaseReplicaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "database_replica_lag_seconds",
+		Help: "Replication lag of each database read replica, -1 while unreachable.",
+	}, []string{"replica"})
+
+	// DatabaseReads counts read-only queries by where they ran: a replica, or the primary when no
+	// replica was usable.
+	DatabaseReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "database_reads_total",
+		Help: "Read-only database queries, by target (replica or primary).",
+	}, []string{"target"})
+
+	// DatabaseTxRetries counts transactions run again by db.WithTx, by the SQLSTATE of the error
+	// (40001 serialization failure, 40P01 deadlock).
+	DatabaseTxRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "database_tx_retries_total",
+		Help: "Database transactions retried after a serialization failure or deadlock, by SQLSTATE.",
+	}, []string{"sqlstate"})
+
+	// QueryCacheRequests counts query cache lookups by query name and result (hit, miss, or stale
+	// when a tag of the cached result was invalidated).
+	QueryCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "query_cache_requests_total",
+		Help: "Query cache lookups, by query and result (hit, miss or stale).",
+	}, []string{"query", "result"})
+
+	// SchedulerRuns counts scheduled task occurrences by task and result (succeeded, failed, or
+	// skipped while running elsewhere or still running).
+	SchedulerRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_runs_total",
+		Help: "Scheduled task runs, by task and result (succeeded, failed or skipped).",
+	}, []string{"task", "result"})
+
+	// SchedulerLastSuccess is when each scheduled task last succeeded on this instance, as a Unix
+	// timestamp; alert on it to catch tasks that stopped succeeding.
+	SchedulerLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_last_success_timestamp_seconds",
+		Help: "Unix time of each scheduled task's last successful run on this instance.",
+	}, []string{"task"})
+
+	// JobsProcessed counts background job attempts by type and result (succeeded, retried, or
+	// dead when it was the last attempt).
+	JobsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "Background job attempts, by job type and result.",
+	}, []string{"type", "result"})
+
+	// WebhookEvents counts webhook deliveries by provider and result (processed, duplicate,
+	// ignored without a handler, rejected by the verifier, or failed and left to be retried).
+	WebhookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_events_total",
+		Help: "Webhook deliveries, by provider and result.",
+	}, []string{"provider", "result"})
+
+	// GoroutinesTracked is the number of goroutines running under each name tracked by
+	// internal/monitor (go_goroutines counts all of them).
+	GoroutinesTracked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "goroutines_tracked",
+		Help: "Running goroutines, by tracked name.",
+	}, []string{"name"})
+
+	// GoroutinesLeaked is how many goroutines above its bound each tracked name has been running
+	// for several checks in a row (0 when it is back under it).
+	GoroutinesLeaked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "goroutines_leaked",
+		Help: "Goroutines running above their expected count, by tracked name.",
+	}, []string{"name"})
+
+	// ChannelBufferLength is the number of values waiting in each registered channel's buffer.
+	ChannelBufferLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "channel_buffer_length",
+		Help: "Values waiting in a channel's buffer, by channel.",
+	}, []string{"channel"})
+
+	// ChannelBufferUtilization is the used share (0-1) of each registered channel's buffer; a
+	// channel staying at 1 has a consumer that can't keep up.
+	ChannelBufferUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "channel_buffer_utilization",
+		Help: "Used share of a channel's buffer (0-1), by channel.",
+	}, []string{"channel"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		AuthFailures,
+		JWKSFetchFailures,
+		HTTPRequestDuration,
+		SupabaseProxyDuration,
+		SupabaseProxyRetries,
+		GraphQLRejections,
+		CacheLookups,
+		SecurityResponses,
+		SlowRequests,
+		SlowRequestPhaseSeconds,
+		SLOCompliance,
+		SLOBurnRate,
+		SLOAlerts,
+		DependencyUp,
+		RealtimeLeader,
+		RealtimeReconnects,
+		RealtimeBackfilledRows,
+		RealtimeSchemaMissingColumns,
+		WebSocketClients,
+		WebSocketBroadcastQueueDepth,
+		WebSocketDroppedMessages,
+		WebSocketSlowClientEvictions,
+		WebSocketConflatedMessages,
+		WebSocketBridgeMessages,
+		WebSocketRealtimeQueueDepth,
+		WebSocketRealtimeQueueConflated,
+		WebSocketRealtimeBackpressure,
+		MemoryInUse,
+		MemoryShed,
+		PushDeliveries,
+		PushQueueDepth,
+		NotificationsSent,
+		AbuseDecisions,
+		DatabaseReplicaLag,
+		DatabaseReads,
+		DatabaseTxRetries,
+		QueryCacheRequests,
+		SchedulerRuns,
+		SchedulerLastSuccess,
+		JobsProcessed,
+		WebhookEvents,
+		GoroutinesTracked,
+		GoroutinesLeaked,
+		ChannelBufferLength,
+		ChannelBufferUtilization,
+	)
+}
+
+// RecordAuthFailure increments the auth failure counter for reason.
+func RecordAuthFailure(reason string) {
+	AuthFailures.WithLabelValues(reason).Inc()
+}
+
+// RecordCacheLookup counts a cache read as a hit or a miss (an empty value).
+func RecordCacheLookup(value string) {
+	if value == "" {
+		CacheLookups.WithLabelValues(CacheMiss).Inc()
+		return
+	}
+	CacheLookups.WithLabelValues(CacheHit).Inc()
+}
+
+// StatusClass returns the class of an HTTP status code ("2xx", "5xx", ...).
+func StatusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// Middleware records every request's latency in HTTPRequestDuration.
+// Register it globally, early, so the time spent in the other middleware is included.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		// Prometheus keeps label values, and the method is a view into the request's buffer
+		// (route paths are the registered routes')
+		HTTPRequestDuration.WithLabelValues(strings.Clone(c.Method()), routeLabel(c), strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// SecurityMiddleware counts 401 and 403 responses per route.
+// Register it globally; it inspects the status after the rest of the chain has run.
+func SecurityMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		}
+
+		if status == fiber.StatusUnauthorized || status == fiber.StatusForbidden {
+			SecurityResponses.WithLabelValues(routeLabel(c), statusLabel(status)).Inc()
+		}
+		return err
+	}
+}
+
+// routeLabel returns the matched route pattern (e.g. /api/profile), never the raw URL,
+// so label cardinality stays bounded.
+func routeLabel(c *fiber.Ctx) string {
+	if route := c.Route(); route != nil && route.Path != "" {
+		return route.Path
+	}
+	return "unmatched"
+}
+
+// statusLabel converts a status code to its label value.
+func statusLabel(status int) string {
+	if status == fiber.StatusForbidden {
+		return "403"
+	}
+	return "401"
+}
+
+// Handler serves the metrics in Prometheus text format.
+// If METRICS_TOKEN is set, scrapers must send "Authorization: Bearer <token>".
+func Handler() fiber.Handler {
+	token := os.Getenv("METRICS_TOKEN")
+	if token != "" {
+		startup.Report("metrics", true, "/metrics, Bearer token required")
+	} else {
+		startup.Report("metrics", true, "/metrics, open (METRICS_TOKEN not set)")
+	}
+	promHandler := adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+
+	return func(c *fiber.Ctx) error {
+		if token != "" && c.Get("Authorization") != "Bearer "+token {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid metrics token",
+			})
+		}
+		return promHandler(c)
+	}
+}
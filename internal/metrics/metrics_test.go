@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMiddleware tests that request latency is recorded by route pattern and status.
+func TestMiddleware(t *testing.T) {
+	HTTPRequestDuration.Reset()
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/api/artists/:id", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "down")
+	})
+
+	for _, path := range []string{"/api/artists/1", "/api/artists/2", "/broken"} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, testutil.CollectAndCount(HTTPRequestDuration))
+	assert.Equal(t, uint64(2), sampleCount(t, "GET", "/api/artists/:id", "200"))
+	assert.Equal(t, uint64(1), sampleCount(t, "GET", "/broken", "503"))
+}
+
+// sampleCount returns the number of observations of HTTPRequestDuration for the labels.
+func sampleCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				values[pair.GetName()] = pair.GetValue()
+			}
+			if values["method"] == labels[0] && values["route"] == labels[1] && values["status"] == labels[2] {
+				return metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+// TestRecordCacheLookup tests that empty values count as misses.
+func TestRecordCacheLookup(t *testing.T) {
+	CacheLookups.Reset()
+
+	RecordCacheLookup("9.99")
+	RecordCacheLookup("")
+	RecordCacheLookup("")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(CacheLookups.WithLabelValues(CacheHit)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(CacheLookups.WithLabelValues(CacheMiss)))
+}
+
+// TestStatusClass tests status class labels.
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", StatusClass(204))
+	assert.Equal(t, "5xx", StatusClass(502))
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"log/slog"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAdmin only lets through users listed in cfg.AdminUserIDs (ADMIN_USER_IDS).
+// It must run after Auth(), which sets the "user" local.
+// With ADMIN_USER_IDS unset nobody is an admin, so admin routes are closed by default.
+func RequireAdmin(cfg config.Auth) fiber.Handler {
+	admins := make(map[string]bool, len(cfg.AdminUserIDs))
+	for _, id := range cfg.AdminUserIDs {
+		admins[id] = true
+	}
+	if len(admins) == 0 {
+		slog.Warn("ADMIN_USER_IDS not set, admin endpoints are disabled")
+	}
+
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user").(string)
+		if userID == "" || !admins[userID] {
+			return apperror.Write(c, apperror.Forbidden("Admin access required"))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boilerplate/internal/apikey"
+	"boilerplate/internal/config"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingKeyStore is an apikey.Store whose lookups fail.
+type failingKeyStore struct{}
+
+func (failingKeyStore) Lookup(ctx context.Context, hash string) (*apikey.Key, error) {
+	return nil, errors.New("database down")
+}
+
+// useKeys installs a store holding keys for the test.
+func useKeys(t *testing.T, keys ...apikey.Key) {
+	original := apikey.Get()
+	apikey.SetDefault(apikey.NewMemoryStore(keys...))
+	t.Cleanup(func() { apikey.SetDefault(original) })
+}
+
+// sendKey sends a GET to app with key as X-API-Key (none if empty).
+func sendKey(t *testing.T, app *fiber.App, path, key string) *http.Response {
+	req := httptest.NewRequest("GET", path, nil)
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+// readBody returns the body of resp.
+func readBody(resp *http.Response) string {
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+// TestAPIKeyAuth tests which keys are accepted, and that accepted keys set the caller and scopes.
+func TestAPIKeyAuth(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	useKeys(t,
+		apikey.Key{ID: "owned", Hash: apikey.Hash("sk_owned"), UserID: "user-1", Scopes: []string{"reports:read"}},
+		apikey.Key{ID: "service", Hash: apikey.Hash("sk_service")},
+		apikey.Key{ID: "revoked", Hash: apikey.Hash("sk_revoked"), Revoked: true},
+		apikey.Key{ID: "expired", Hash: apikey.Hash("sk_expired"), ExpiresAt: &past},
+	)
+	cfg := config.Auth{ScopeClaim: "scope"}
+
+	app := fiber.New()
+	app.Get("/whoami", APIKeyAuth(cfg), func(c *fiber.Ctx) error {
+		auth := GetAuthContext(c)
+		return c.JSON(fiber.Map{"user": c.Locals("user"), "role": auth.Role, "key": auth.APIKey.ID})
+	})
+	app.Get("/reports", APIKeyAuth(cfg), RequireScopes(cfg, "reports:read"), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	resp := sendKey(t, app, "/whoami", "sk_owned")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]string{"user": "user-1", "role": RoleAPIKey, "key": "owned"}, body)
+
+	resp = sendKey(t, app, "/whoami", "sk_service")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "apikey:service", body["user"])
+
+	assert.Equal(t, http.StatusOK, sendKey(t, app, "/reports", "sk_owned").StatusCode)
+	assert.Equal(t, http.StatusForbidden, sendKey(t, app, "/reports", "sk_service").StatusCode)
+
+	for _, key := range []string{"", "sk_unknown", "sk_revoked", "sk_expired"} {
+		assert.Equal(t, http.StatusUnauthorized, sendKey(t, app, "/whoami", key).StatusCode, key)
+	}
+
+	apikey.SetDefault(failingKeyStore{})
+	assert.Equal(t, http.StatusServiceUnavailable, sendKey(t, app, "/whoami", "sk_owned").StatusCode)
+	apikey.SetDefault(nil)
+	assert.Equal(t, http.StatusUnauthorized, sendKey(t, app, "/whoami", "sk_owned").StatusCode)
+}
+
+// TestAPIKeyAuth_Tenant tests that tenant-bound keys set their tenant and are rejected on
+// another tenant's host.
+func TestAPIKeyAuth_Tenant(t *testing.T) {
+	useKeys(t, apikey.Key{ID: "acme", Hash: apikey.Hash("sk_acme"), TenantID: "acme"})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if host := c.Query("host"); host != "" {
+			c.Locals(tenant.LocalsKey, host)
+		}
+		return c.Next()
+	})
+	app.Get("/tenant", APIKeyAuth(config.Auth{}), func(c *fiber.Ctx) error {
+		return c.SendString(tenant.ID(c))
+	})
+
+	resp := sendKey(t, app, "/tenant", "sk_acme")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "acme", readBody(resp))
+	assert.Equal(t, http.StatusOK, sendKey(t, app, "/tenant?host=acme", "sk_acme").StatusCode)
+	assert.Equal(t, http.StatusForbidden, sendKey(t, app, "/tenant?host=globex", "sk_acme").StatusCode)
+}
+
+// TestAuthOrAPIKey tests that either credential is accepted.
+func TestAuthOrAPIKey(t *testing.T) {
+	useKeys(t, apikey.Key{ID: "k1", Hash: apikey.Hash("sk_valid")})
+	cfg := config.Auth{JWTSecret: "test-secret-key"}
+
+	app := fiber.New()
+	app.Get("/data", AuthOrAPIKey(cfg), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("user").(string))
+	})
+
+	resp := sendKey(t, app, "/data", "sk_valid")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "apikey:k1", readBody(resp))
+
+	req := httptest.NewRequest("GET", "/data", nil)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-secret-key"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", readBody(resp))
+
+	assert.Equal(t, http.StatusUnauthorized, sendKey(t, app, "/data", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, sendKey(t, app, "/data", "sk_invalid").StatusCode)
+}
+
+// TestRateLimit_APIKeyTiers tests that keys are limited per key, with their tier's limit.
+func TestRateLimit_APIKeyTiers(t *testing.T) {
+	useKeys(t,
+		apikey.Key{ID: "partner", Hash: apikey.Hash("sk_partner"), Tier: "partner"},
+		apikey.Key{ID: "basic", Hash: apikey.Hash("sk_basic")},
+	)
+	cfg := config.RateLimit{Max: 2, StrictMax: 1, WebSocketMax: 1, Storage: config.RateLimitMemory, Tiers: map[string]int{"partner": 4}}
+
+	app := fiber.New()
+	app.Get("/data", APIKeyAuth(config.Auth{}), RateLimitProfile(cfg, ProfileDefault), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	allowed := func(key string) int {
+		count := 0
+		for i := 0; i < 6; i++ {
+			if sendKey(t, app, "/data", key).StatusCode == http.StatusOK {
+				count++
+			}
+		}
+		return count
+	}
+	assert.Equal(t, 4, allowed("sk_partner"))
+	assert.Equal(t, 2, allowed("sk_basic"))
+}
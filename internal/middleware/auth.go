@@ -1,17 +1,25 @@
 package middleware
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/timing"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -24,59 +32,125 @@ var (
 	cacheTTL      = 1 * time.Hour
 )
 
+// Sentinel errors used to classify auth failures for metrics.
+var (
+	errMissingAuthHeader = errors.New("missing Authorization header")
+	errInvalidAuthHeader = errors.New("invalid Authorization header format")
+	errUnknownKid        = errors.New("unknown key id")
+	errJWKSUnavailable   = errors.New("JWKS unavailable")
+	errUnsupportedAlg    = errors.New("unsupported signing method")
+	errAuthMisconfigured = errors.New("auth not configured")
+)
+
 // Auth validates JWT tokens and attaches the user ID to the request context.
-// Supports both HS256 (symmetric) and RS256 (asymmetric) signing methods.
-func Auth() fiber.Handler {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	supabaseURL := os.Getenv("SUPABASE_URL")
+// Supports both HS256 (symmetric, cfg.JWTSecret) and RS256 (asymmetric, keys from the JWKS of
+// cfg.SupabaseURL) signing methods.
+func Auth(cfg config.Auth) fiber.Handler {
+	jwtSecret, supabaseURL := cfg.JWTSecret, cfg.SupabaseURL
 
 	return func(c *fiber.Ctx) error {
+		// Time token validation (stopped before the rest of the chain runs)
+		stopTimer := timing.Start(c, timing.PhaseAuth)
+		defer stopTimer()
+
 		// Extract token from Authorization header
 		tokenString, err := extractTokenFromHeader(c)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+			metrics.RecordAuthFailure(classifyHeaderError(err))
+			return apperror.Write(c, apperror.Unauthorized(err.Error()))
 		}
 
 		// Validate token and get claims
 		claims, err := validateToken(tokenString, jwtSecret, supabaseURL)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Authentication failed",
-			})
+			metrics.RecordAuthFailure(classifyTokenError(err))
+			return apperror.Write(c, apperror.Unauthorized("Authentication failed"))
 		}
 
 		// Extract user ID from claims
 		userID, err := extractUserIDFromClaims(claims)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+			metrics.RecordAuthFailure(metrics.ReasonMissingUserID)
+			return apperror.Write(c, apperror.Unauthorized(err.Error()))
 		}
 
-		// Attach user ID to context for use in handlers
+		// Attach user ID (and the full claims, e.g. for tenant resolution) to the context, along
+		// with the typed caller (roles, app_metadata) for RequireRole and handlers
 		c.Locals("user", userID)
+		c.Locals("claims", claims)
+		c.Locals(AuthContextKey, newAuthContext(userID, claims))
+		stopTimer()
 		return c.Next()
 	}
 }
 
+// UserFromToken validates a JWT the same way Auth does and returns its user ID and claims.
+// It is for requests that carry the token elsewhere than the Authorization header, such as the
+// WebSocket handshake (?token=). Failures are counted in the auth failure metrics.
+func UserFromToken(cfg config.Auth, tokenString string) (string, jwt.MapClaims, error) {
+	claims, err := validateToken(tokenString, cfg.JWTSecret, cfg.SupabaseURL)
+	if err != nil {
+		metrics.RecordAuthFailure(classifyTokenError(err))
+		return "", nil, err
+	}
+
+	userID, err := extractUserIDFromClaims(claims)
+	if err != nil {
+		metrics.RecordAuthFailure(metrics.ReasonMissingUserID)
+		return "", nil, err
+	}
+	return userID, claims, nil
+}
+
 // extractTokenFromHeader extracts the JWT token from the Authorization header.
 // Returns an error if the header is missing or malformed.
 func extractTokenFromHeader(c *fiber.Ctx) (string, error) {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("missing Authorization header")
+		return "", errMissingAuthHeader
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return "", fmt.Errorf("invalid Authorization header format")
+		return "", errInvalidAuthHeader
 	}
 
 	return parts[1], nil
 }
 
+// classifyHeaderError maps an extractTokenFromHeader error to a metrics reason.
+func classifyHeaderError(err error) string {
+	if errors.Is(err, errMissingAuthHeader) {
+		return metrics.ReasonMissingHeader
+	}
+	return metrics.ReasonInvalidHeader
+}
+
+// classifyTokenError maps a validateToken error to a metrics reason.
+// jwt/v5 wraps both its own sentinel errors and our key lookup errors, so errors.Is sees both.
+func classifyTokenError(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return metrics.ReasonMalformed
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return metrics.ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return metrics.ReasonNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return metrics.ReasonBadSignature
+	case errors.Is(err, errUnknownKid):
+		return metrics.ReasonUnknownKid
+	case errors.Is(err, errJWKSUnavailable):
+		return metrics.ReasonJWKSUnavailable
+	case errors.Is(err, errUnsupportedAlg):
+		return metrics.ReasonUnsupportedAlg
+	case errors.Is(err, errAuthMisconfigured):
+		return metrics.ReasonMisconfigured
+	default:
+		return metrics.ReasonOther
+	}
+}
+
 // validateToken parses and validates a JWT token.
 // Returns the token claims if valid, or an error if validation fails.
 func validateToken(tokenString, jwtSecret, supabaseURL string) (jwt.MapClaims, error) {
@@ -125,7 +199,7 @@ func getSigningKey(token *jwt.Token, jwtSecret, supabaseURL, kid string) (interf
 	// Handle HS256 (symmetric) tokens
 	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
 		if jwtSecret == "" {
-			return nil, fmt.Errorf("JWT_SECRET not configured")
+			return nil, fmt.Errorf("JWT_SECRET not configured: %w", errAuthMisconfigured)
 		}
 		return []byte(jwtSecret), nil
 	}
@@ -133,15 +207,15 @@ func getSigningKey(token *jwt.Token, jwtSecret, supabaseURL, kid string) (interf
 	// Handle RS256 (asymmetric) tokens
 	if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
 		if supabaseURL == "" {
-			return nil, fmt.Errorf("SUPABASE_URL not configured for RS256")
+			return nil, fmt.Errorf("SUPABASE_URL not configured for RS256: %w", errAuthMisconfigured)
 		}
 		if kid == "" {
-			return nil, fmt.Errorf("kid header missing from token")
+			return nil, fmt.Errorf("kid header missing from token: %w", errUnknownKid)
 		}
 		return getSupabasePublicKey(supabaseURL, kid)
 	}
 
-	return nil, fmt.Errorf("unsupported signing method: %v", token.Header["alg"])
+	return nil, fmt.Errorf("%w: %v", errUnsupportedAlg, token.Header["alg"])
 }
 
 // extractUserIDFromClaims extracts the user ID from JWT claims.
@@ -205,15 +279,16 @@ func fetchAndCacheKey(supabaseURL, kid string) (*rsa.PublicKey, error) {
 	}
 
 	// Fetch JWKS from Supabase
-	jwks, err := fetchJWKS(supabaseURL)
+	jwks, err := fetchJWKS(context.Background(), supabaseURL)
 	if err != nil {
-		return nil, err
+		metrics.JWKSFetchFailures.Inc()
+		return nil, fmt.Errorf("%w: %v", errJWKSUnavailable, err)
 	}
 
 	// Find the key matching the kid
 	keyData := findKeyByKid(jwks, kid)
 	if keyData == nil {
-		return nil, fmt.Errorf("key with kid '%s' not found in JWKS", kid)
+		return nil, fmt.Errorf("key with kid '%s' not found in JWKS: %w", kid, errUnknownKid)
 	}
 
 	// Build RSA public key from JWKS data
@@ -258,11 +333,56 @@ type jwksResponse struct {
 	Keys []jwksKey `json:"keys"`
 }
 
+// jwksClient fetches JWKS documents, only from allowed hosts (see egress).
+var jwksClient = egress.NewClient(10 * time.Second)
+
+// CheckJWKS reports whether the JWKS RS256 tokens are verified with can be fetched from
+// Supabase (see health, which runs it on readiness probes). Cached keys are not used.
+func CheckJWKS(ctx context.Context, supabaseURL string) error {
+	_, err := fetchJWKS(ctx, supabaseURL)
+	return err
+}
+
+// RefreshJWKS fetches the JWKS and caches every RSA key in it for another cache TTL, so requests
+// don't wait for a fetch when a cached key expires, and keys Supabase rotated in are ready before
+// the first token signed with them. Keys that fail to build are skipped, and nothing is fetched
+// without a Supabase URL. Run it on every instance (see the "jwks-refresh" scheduled task).
+func RefreshJWKS(ctx context.Context, supabaseURL string) error {
+	if supabaseURL == "" {
+		return nil // RS256 tokens aren't accepted
+	}
+	jwks, err := fetchJWKS(ctx, supabaseURL)
+	if err != nil {
+		metrics.JWKSFetchFailures.Inc()
+		return err
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	for i := range jwks.Keys {
+		keyData := &jwks.Keys[i]
+		if keyData.Kid == "" || keyData.Kty != "RSA" {
+			continue
+		}
+		publicKey, err := buildRSAPublicKey(keyData)
+		if err != nil {
+			continue
+		}
+		cachedKeys[keyData.Kid] = publicKey
+		cacheExpiries[keyData.Kid] = time.Now().Add(cacheTTL)
+	}
+	return nil
+}
+
 // fetchJWKS fetches the JWKS from Supabase.
-func fetchJWKS(supabaseURL string) (*jwksResponse, error) {
+func fetchJWKS(ctx context.Context, supabaseURL string) (*jwksResponse, error) {
 	jwksURL := strings.TrimSuffix(supabaseURL, "/") + "/.well-known/jwks.json"
 
-	resp, err := http.Get(jwksURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	resp, err := jwksClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
 	}
@@ -272,8 +392,13 @@ func fetchJWKS(supabaseURL string) (*jwksResponse, error) {
 		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
 	}
 
+	return decodeJWKS(resp.Body)
+}
+
+// decodeJWKS decodes a JWKS document. The input is remote data, so it is treated as untrusted.
+func decodeJWKS(r io.Reader) (*jwksResponse, error) {
 	var jwks jwksResponse
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+	if err := json.NewDecoder(r).Decode(&jwks); err != nil {
 		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
 	}
 
@@ -308,12 +433,24 @@ func buildRSAPublicKey(keyData *jwksKey) (*rsa.PublicKey, error) {
 		return nil, fmt.Errorf("failed to decode exponent: %w", err)
 	}
 
+	// Reject values that can't form a usable key (and would overflow the exponent int)
+	if len(nBytes) == 0 {
+		return nil, fmt.Errorf("empty modulus")
+	}
+	if len(eBytes) == 0 || len(eBytes) > 4 {
+		return nil, fmt.Errorf("invalid exponent length: %d bytes", len(eBytes))
+	}
+
 	// Convert exponent bytes to int
 	var eInt int
 	for _, b := range eBytes {
 		eInt = eInt<<8 | int(b)
 	}
 
+	if eInt < 2 {
+		return nil, fmt.Errorf("invalid exponent: %d", eInt)
+	}
+
 	// Create RSA public key
 	return &rsa.PublicKey{
 		N: new(big.Int).SetBytes(nBytes),
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzDecodeJWKS feeds arbitrary JWKS documents through decoding and key construction.
+// Neither step may panic, and any key that is built must be usable.
+func FuzzDecodeJWKS(f *testing.F) {
+	f.Add(`{"keys":[{"kty":"RSA","use":"sig","kid":"k1","n":"sXchDaQebHnPiGvyDOAT4saGEUetSyo9MKLOoWFsueri23bOdgWp4Dy1WlUzewbgBHod5pcM9H95GQRV3JDXboIRROSBigeC5yjU1hGzHHyXss8UDprecbAYxknTcQkhslANGRUZmdTOQ5qTRsLAt6BTYuyvVRdhS8exSZEy_c4gs_7svlJJQ4H9_NxsiIoLwAEk7-Q3UXERGYw_75IDrGA84-lA_-Ct4eTlXHBIY2EaV7t7LjJaynVJCpkv4LKjTTAumiGUIuQhrNhZLuF_RJLqHpM2kgWFLU7-VTdL1VbC2tejvcI2BlMkEpk1BzBZI0KQB0GaDWFLN-aEAw3vRw","e":"AQAB"}]}`)
+	f.Add(`{"keys":[]}`)
+	f.Add(`{"keys":[{"kid":"k1","n":"","e":""}]}`)
+	f.Add(`{"keys":[{"kid":"k1","n":"AQ","e":"AQABAQABAQAB"}]}`)
+	f.Add(`not json`)
+
+	f.Fuzz(func(t *testing.T, document string) {
+		jwks, err := decodeJWKS(strings.NewReader(document))
+		if err != nil {
+			return
+		}
+
+		for i := range jwks.Keys {
+			_ = findKeyByKid(jwks, jwks.Keys[i].Kid)
+
+			key, err := buildRSAPublicKey(&jwks.Keys[i])
+			if err != nil {
+				continue
+			}
+			if key.N == nil || key.N.Sign() <= 0 {
+				t.Fatalf("built key with invalid modulus from %q", document)
+			}
+			if key.E < 2 {
+				t.Fatalf("built key with invalid exponent %d from %q", key.E, document)
+			}
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuth_FailureMetrics tests that each rejected request increments the counter for its reason.
+func TestAuth_FailureMetrics(t *testing.T) {
+	cfg := config.Auth{JWTSecret: "metrics-secret"}
+
+	app := fiber.New()
+	app.Use(metrics.SecurityMiddleware())
+	app.Get("/protected", Auth(cfg), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	sign := func(secret string, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return "Bearer " + token
+	}
+
+	testCases := []struct {
+		name       string
+		authHeader string
+		reason     string
+	}{
+		{"missing header", "", metrics.ReasonMissingHeader},
+		{"invalid header", "Basic abc", metrics.ReasonInvalidHeader},
+		{"malformed token", "Bearer not-a-jwt", metrics.ReasonMalformed},
+		{"bad signature", sign("wrong-secret", jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()}), metrics.ReasonBadSignature},
+		{"expired", sign("metrics-secret", jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(-time.Hour).Unix()}), metrics.ReasonExpired},
+		{"missing user id", sign("metrics-secret", jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}), metrics.ReasonMissingUserID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := promtest.ToFloat64(metrics.AuthFailures.WithLabelValues(tc.reason))
+			before401 := promtest.ToFloat64(metrics.SecurityResponses.WithLabelValues("/protected", "401"))
+
+			req := httptest.NewRequest("GET", "/protected", nil)
+			if tc.authHeader != "" {
+				req.Header.Set("Authorization", tc.authHeader)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+			assert.Equal(t, before+1, promtest.ToFloat64(metrics.AuthFailures.WithLabelValues(tc.reason)))
+			assert.Equal(t, before401+1, promtest.ToFloat64(metrics.SecurityResponses.WithLabelValues("/protected", "401")))
+		})
+	}
+}
+
+// TestClassifyTokenError_UnknownKid tests that JWKS lookup failures are classified separately.
+func TestClassifyTokenError_UnknownKid(t *testing.T) {
+	_, err := getSigningKey(&jwt.Token{Method: jwt.SigningMethodRS256, Header: map[string]interface{}{}}, "", "https://example.supabase.co", "")
+	require.Error(t, err)
+	assert.Equal(t, metrics.ReasonUnknownKid, classifyTokenError(err))
+
+	_, err = getSigningKey(&jwt.Token{Method: jwt.SigningMethodHS256}, "", "", "")
+	require.Error(t, err)
+	assert.Equal(t, metrics.ReasonMisconfigured, classifyTokenError(err))
+}
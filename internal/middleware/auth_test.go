@@ -3,10 +3,11 @@ package middleware
 import (
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
+	"boilerplate/internal/config"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -15,14 +16,12 @@ import (
 
 // TestAuth_MissingToken tests that requests without Authorization header are rejected.
 func TestAuth_MissingToken(t *testing.T) {
-	// Set up environment
-	originalSecret := os.Getenv("JWT_SECRET")
-	os.Setenv("JWT_SECRET", "test-secret")
-	defer os.Setenv("JWT_SECRET", originalSecret)
+	// Set up configuration
+	cfg := config.Auth{JWTSecret: "test-secret"}
 
 	// Create Fiber app with auth middleware
 	app := fiber.New()
-	app.Get("/protected", Auth(), func(c *fiber.Ctx) error {
+	app.Get("/protected", Auth(cfg), func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "success"})
 	})
 
@@ -38,14 +37,12 @@ func TestAuth_MissingToken(t *testing.T) {
 
 // TestAuth_InvalidTokenFormat tests that malformed Authorization headers are rejected.
 func TestAuth_InvalidTokenFormat(t *testing.T) {
-	// Set up environment
-	originalSecret := os.Getenv("JWT_SECRET")
-	os.Setenv("JWT_SECRET", "test-secret")
-	defer os.Setenv("JWT_SECRET", originalSecret)
+	// Set up configuration
+	cfg := config.Auth{JWTSecret: "test-secret"}
 
 	// Create Fiber app with auth middleware
 	app := fiber.New()
-	app.Get("/protected", Auth(), func(c *fiber.Ctx) error {
+	app.Get("/protected", Auth(cfg), func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "success"})
 	})
 
@@ -70,10 +67,8 @@ func TestAuth_InvalidTokenFormat(t *testing.T) {
 
 // TestAuth_ValidHS256Token tests that valid HS256 tokens are accepted.
 func TestAuth_ValidHS256Token(t *testing.T) {
-	// Set up environment
-	originalSecret := os.Getenv("JWT_SECRET")
-	os.Setenv("JWT_SECRET", "test-secret-key")
-	defer os.Setenv("JWT_SECRET", originalSecret)
+	// Set up configuration
+	cfg := config.Auth{JWTSecret: "test-secret-key"}
 
 	// Create a valid JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -85,7 +80,7 @@ func TestAuth_ValidHS256Token(t *testing.T) {
 
 	// Create Fiber app with auth middleware
 	app := fiber.New()
-	app.Get("/protected", Auth(), func(c *fiber.Ctx) error {
+	app.Get("/protected", Auth(cfg), func(c *fiber.Ctx) error {
 		userID := c.Locals("user")
 		return c.JSON(fiber.Map{"user": userID})
 	})
@@ -104,9 +99,7 @@ func TestAuth_ValidHS256Token(t *testing.T) {
 // TestAuth_InvalidSecret tests that tokens signed with wrong secret are rejected.
 func TestAuth_InvalidSecret(t *testing.T) {
 	// Set up environment with one secret
-	originalSecret := os.Getenv("JWT_SECRET")
-	os.Setenv("JWT_SECRET", "correct-secret")
-	defer os.Setenv("JWT_SECRET", originalSecret)
+	cfg := config.Auth{JWTSecret: "correct-secret"}
 
 	// Create a token signed with wrong secret
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -118,7 +111,7 @@ func TestAuth_InvalidSecret(t *testing.T) {
 
 	// Create Fiber app with auth middleware
 	app := fiber.New()
-	app.Get("/protected", Auth(), func(c *fiber.Ctx) error {
+	app.Get("/protected", Auth(cfg), func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "success"})
 	})
 
@@ -135,10 +128,8 @@ func TestAuth_InvalidSecret(t *testing.T) {
 
 // TestAuth_ExpiredToken tests that expired tokens are rejected.
 func TestAuth_ExpiredToken(t *testing.T) {
-	// Set up environment
-	originalSecret := os.Getenv("JWT_SECRET")
-	os.Setenv("JWT_SECRET", "test-secret")
-	defer os.Setenv("JWT_SECRET", originalSecret)
+	// Set up configuration
+	cfg := config.Auth{JWTSecret: "test-secret"}
 
 	// Create an expired JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -150,7 +141,7 @@ func TestAuth_ExpiredToken(t *testing.T) {
 
 	// Create Fiber app with auth middleware
 	app := fiber.New()
-	app.Get("/protected", Auth(), func(c *fiber.Ctx) error {
+	app.Get("/protected", Auth(cfg), func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "success"})
 	})
 
@@ -1,9 +1,9 @@
 package middleware
 
 import (
-	"os"
-	"strconv"
-	"time"
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+	"boilerplate/internal/tenant"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
@@ -21,48 +21,52 @@ import (
 // - TRUSTED_PROXIES set to your proxy IP ranges
 // This ensures c.IP() returns the real client IP from X-Forwarded-For header.
 // Without proper configuration, all users behind the same proxy will share a rate limit.
-func RateLimit() fiber.Handler {
-	maxRequests := getMaxRequests()
+//
+// With RATE_LIMIT_STORAGE=redis requests are counted in the shared cache, so the limit holds
+// across replicas (see newRedisLimiter).
+//
+// Admins can raise or lower the limit for a single key at runtime with SetRateLimitOverride.
+// RateLimit uses the default profile (cfg.Max); see RateLimitProfile for the others.
+func RateLimit(cfg config.RateLimit) fiber.Handler {
+	return RateLimitProfile(cfg, ProfileDefault)
+}
 
+// newLimiter creates a limiter allowing max requests per minute per key: fiber's in-memory
+// limiter, or one counting in the shared cache with RATE_LIMIT_STORAGE=redis (see
+// newRedisLimiter). name separates the cache counters of profiles.
+func newLimiter(storage, name string, max int) fiber.Handler {
+	if storage == config.RateLimitRedis {
+		return newRedisLimiter(name, max)
+	}
 	return limiter.New(limiter.Config{
-		Max:        maxRequests,
-		Expiration: 1 * time.Minute,
+		Max:        max,
+		Expiration: rateLimitWindow,
 		KeyGenerator: generateRateLimitKey,
 		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded",
-			})
+			return apperror.Write(c, apperror.RateLimited("Rate limit exceeded"))
 		},
 	})
 }
 
-// getMaxRequests returns the maximum number of requests allowed per minute.
-// Defaults to 100 if RATE_LIMIT_MAX is not set or invalid.
-func getMaxRequests() int {
-	maxStr := os.Getenv("RATE_LIMIT_MAX")
-	if maxStr == "" {
-		return 100
-	}
+// generateRateLimitKey generates a unique key for rate limiting.
+// Uses the API key or user ID if authenticated, otherwise falls back to IP address.
+// Keys are prefixed with the tenant (if any), so tenants never share a budget.
+func generateRateLimitKey(c *fiber.Ctx) string {
+	tenantID := tenant.ID(c)
 
-	parsed, err := strconv.Atoi(maxStr)
-	if err != nil || parsed <= 0 {
-		return 100
+	// API keys have their own budget, even when they act as a user
+	if key := apiKeyOf(c); key != nil {
+		return tenant.Prefix(tenantID, "apikey:"+key.ID)
 	}
 
-	return parsed
-}
-
-// generateRateLimitKey generates a unique key for rate limiting.
-// Uses user ID if authenticated, otherwise falls back to IP address.
-func generateRateLimitKey(c *fiber.Ctx) string {
 	// Prefer user ID if available (more accurate for authenticated users)
 	if userID := c.Locals("user"); userID != nil {
 		if userIDStr, ok := userID.(string); ok && userIDStr != "" {
-			return "user:" + userIDStr
+			return tenant.Prefix(tenantID, "user:"+userIDStr)
 		}
 	}
 
 	// Fall back to IP address for unauthenticated requests
 	// Note: c.IP() returns the real client IP if proxy support is configured
-	return c.IP()
+	return tenant.Prefix(tenantID, c.IP())
 }
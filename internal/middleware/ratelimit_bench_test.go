@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"testing"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// BenchmarkGenerateRateLimitKey measures key generation for anonymous and authenticated requests.
+func BenchmarkGenerateRateLimitKey(b *testing.B) {
+	app := fiber.New()
+
+	b.Run("ip", func(b *testing.B) {
+		c := app.AcquireCtx(&fasthttp.RequestCtx{})
+		defer app.ReleaseCtx(c)
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			generateRateLimitKey(c)
+		}
+	})
+
+	b.Run("user", func(b *testing.B) {
+		c := app.AcquireCtx(&fasthttp.RequestCtx{})
+		defer app.ReleaseCtx(c)
+		c.Locals("user", "user-123")
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			generateRateLimitKey(c)
+		}
+	})
+}
+
+// BenchmarkRateLimit measures the full limiter middleware on the request hot path.
+func BenchmarkRateLimit(b *testing.B) {
+	app := fiber.New()
+	app.Get("/api/test", RateLimit(config.RateLimit{Max: 1000000000}), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	handler := app.Handler()
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/api/test")
+	ctx.Request.Header.SetMethod(fiber.MethodGet)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(&ctx)
+	}
+}
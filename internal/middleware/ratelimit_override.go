@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rate-limit overrides let admins change the per-minute limit for a single rate-limit key
+// (e.g. "user:123" or an IP address) without a restart.
+// Overrides live in memory, so each instance keeps its own set and they reset on restart.
+var (
+	overridesMu sync.RWMutex
+	overrides   = make(map[string]int)
+
+	// overrideLimiters holds one limiter per distinct override max, created on first use
+	overrideLimitersMu sync.Mutex
+	overrideLimiters   = make(map[int]fiber.Handler)
+)
+
+// SetRateLimitOverride sets the per-minute limit for key.
+// Returns the previous override and whether one existed.
+func SetRateLimitOverride(key string, max int) (int, bool) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	previous, existed := overrides[key]
+	overrides[key] = max
+	return previous, existed
+}
+
+// RemoveRateLimitOverride removes the override for key so the default limit applies again.
+// Returns the removed override and whether one existed.
+func RemoveRateLimitOverride(key string) (int, bool) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	previous, existed := overrides[key]
+	delete(overrides, key)
+	return previous, existed
+}
+
+// GetRateLimitOverride returns the override for key, if any.
+func GetRateLimitOverride(key string) (int, bool) {
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+
+	max, ok := overrides[key]
+	return max, ok
+}
+
+// overrideLimiter returns the shared limiter for the given max, creating it if needed.
+func overrideLimiter(storage string, max int) fiber.Handler {
+	overrideLimitersMu.Lock()
+	defer overrideLimitersMu.Unlock()
+
+	handler, ok := overrideLimiters[max]
+	if !ok {
+		handler = newLimiter(storage, "override-"+strconv.Itoa(max), max)
+		overrideLimiters[max] = handler
+	}
+	return handler
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRateLimit_Override tests that an override replaces the default limit for one key only.
+func TestRateLimit_Override(t *testing.T) {
+	cfg := config.RateLimit{Max: 1}
+
+	_, existed := SetRateLimitOverride("user:vip", 3)
+	assert.False(t, existed)
+	defer RemoveRateLimitOverride("user:vip")
+
+	app := fiber.New()
+	app.Get("/api/test", func(c *fiber.Ctx) error {
+		c.Locals("user", c.Query("user"))
+		return c.Next()
+	}, RateLimit(cfg), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	statusFor := func(user string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/test?user="+user, nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Default key: 1 request per minute
+	assert.Equal(t, http.StatusOK, statusFor("regular"))
+	assert.Equal(t, http.StatusTooManyRequests, statusFor("regular"))
+
+	// Overridden key: 3 requests per minute
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, statusFor("vip"), "request %d", i+1)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, statusFor("vip"))
+
+	previous, existed := RemoveRateLimitOverride("user:vip")
+	assert.True(t, existed)
+	assert.Equal(t, 3, previous)
+}
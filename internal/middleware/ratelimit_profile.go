@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rate-limit profiles. Each profile has its own per-minute budget per key, so requests to
+// routes of one profile don't use up the budget of another.
+const (
+	ProfileDefault = "default" // RATE_LIMIT_MAX per minute (default 100)
+	ProfileStrict  = "strict"  // RATE_LIMIT_STRICT_MAX per minute (default 10), for expensive endpoints
+	ProfileNone    = "none"    // Not rate limited
+
+	// ProfileWebSocket limits WebSocket upgrade attempts: RATE_LIMIT_WS_MAX per minute (default 30).
+	// Handshakes carry the token in the query and it is verified after the limiter, so attempts
+	// are counted per IP, failed ones included; a client stuck in a reconnect loop is cut off
+	// without touching the budget of its /api requests.
+	ProfileWebSocket = "websocket"
+)
+
+// RateLimitMax returns the per-minute limit of a profile, and false for unknown profiles
+// (including ProfileNone, which has no limit).
+func RateLimitMax(cfg config.RateLimit, profile string) (int, bool) {
+	switch profile {
+	case ProfileDefault:
+		return cfg.Max, true
+	case ProfileStrict:
+		return cfg.StrictMax, true
+	case ProfileWebSocket:
+		return cfg.WebSocketMax, true
+	default:
+		return 0, false
+	}
+}
+
+// RateLimitProfile applies rate limiting with the limit of profile, keyed like RateLimit
+// (API key or user ID if authenticated, IP otherwise). Admin overrides apply to every profile;
+// API keys with a tier listed in cfg.Tiers (RATE_LIMIT_TIERS) get the tier's limit instead of the
+// default profile's.
+// Unknown profiles use the default limit. Create one handler per profile and share it between
+// routes, as each handler counts requests separately (in memory; with RATE_LIMIT_STORAGE=redis the
+// handlers of a profile share the profile's counters).
+func RateLimitProfile(cfg config.RateLimit, profile string) fiber.Handler {
+	maxRequests, ok := RateLimitMax(cfg, profile)
+	if !ok {
+		maxRequests = cfg.Max
+	}
+	profileLimiter := newLimiter(cfg.Storage, profile, maxRequests)
+
+	return func(c *fiber.Ctx) error {
+		// Keys with an override are counted by a limiter configured with the override's max
+		if overrideMax, ok := GetRateLimitOverride(generateRateLimitKey(c)); ok {
+			return overrideLimiter(cfg.Storage, overrideMax)(c)
+		}
+		// API keys of a tier are counted by the tier's limiter instead of the default profile's
+		if key := apiKeyOf(c); key != nil && profile == ProfileDefault {
+			if tierMax, ok := cfg.Tiers[key.Tier]; ok {
+				return tierLimiter(cfg.Storage, key.Tier, tierMax)(c)
+			}
+		}
+		return profileLimiter(c)
+	}
+}
+
+var (
+	// tierLimiters holds one limiter per API key tier and limit, created on first use
+	tierLimitersMu sync.Mutex
+	tierLimiters   = make(map[string]fiber.Handler)
+)
+
+// tierLimiter returns the shared limiter of tier, creating it with max if needed.
+func tierLimiter(storage, tier string, max int) fiber.Handler {
+	tierLimitersMu.Lock()
+	defer tierLimitersMu.Unlock()
+
+	name := "tier-" + tier + "-" + strconv.Itoa(max)
+	handler, ok := tierLimiters[name]
+	if !ok {
+		handler = newLimiter(storage, name, max)
+		tierLimiters[name] = handler
+	}
+	return handler
+}
@@ -0,0 +1,108 @@
+package middleware
+
+// Distributed rate limiting (RATE_LIMIT_STORAGE=redis).
+//
+// fiber's limiter counts requests in process memory: every replica has its own budget, so N
+// replicas allow N times the limit, and restarts reset it. With RATE_LIMIT_STORAGE=redis the
+// counters live in the shared cache (REDIS_URL or Upstash) and all replicas draw from one budget.
+//
+// The algorithm is a sliding window approximated from two fixed one-minute windows: the count
+// of the current window plus the previous window's count weighted by how much of it still
+// overlaps the last minute. Each request is one INCR, so concurrent replicas never lose counts,
+// and a burst at the end of one window can't be followed by a full budget at the start of the
+// next, as it can with fiber's fixed window.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rateLimitWindow is the period the limits are counted over.
+const rateLimitWindow = time.Minute
+
+// slidingWindowLimiter counts the requests of one profile in the shared cache.
+type slidingWindowLimiter struct {
+	name   string // Profile (or override), part of the keys so profiles don't share counters
+	max    int
+	window time.Duration
+	now    func() time.Time // Overridable clock for tests
+}
+
+// newRedisLimiter creates a handler allowing max requests per minute per key, counted in the
+// cache under "ratelimit:<name>:<key>:<window>". If the cache fails, requests are let through.
+func newRedisLimiter(name string, max int) fiber.Handler {
+	limiter := &slidingWindowLimiter{name: name, max: max, window: rateLimitWindow, now: time.Now}
+	return limiter.handle
+}
+
+// handle counts the request and rejects it with 429 once the key is over the limit, setting
+// the same headers as fiber's limiter.
+func (l *slidingWindowLimiter) handle(c *fiber.Ctx) error {
+	remaining, reset, err := l.hit(generateRateLimitKey(c))
+	if err != nil {
+		// Failing open: a cache outage shouldn't take the API down with it
+		logging.FromRequest(c).Warn("Rate limit check failed, allowing request", "limiter", l.name, "error", err)
+		return c.Next()
+	}
+
+	resetSeconds := strconv.Itoa(int(math.Ceil(reset.Seconds())))
+	if remaining < 0 {
+		c.Set(fiber.HeaderRetryAfter, resetSeconds)
+		return apperror.Write(c, apperror.RateLimited("Rate limit exceeded"))
+	}
+
+	err = c.Next()
+	c.Set("X-RateLimit-Limit", strconv.Itoa(l.max))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("X-RateLimit-Reset", resetSeconds)
+	return err
+}
+
+// hit counts one request for key. It returns the requests left in the sliding window (negative
+// once over the limit) and the time until the current window ends.
+func (l *slidingWindowLimiter) hit(key string) (int, time.Duration, error) {
+	store := cache.GetClient()
+	if store == nil {
+		return 0, 0, fmt.Errorf("cache not initialized")
+	}
+
+	// Step 1: Count the request in the current window
+	now := l.now()
+	index := now.UnixNano() / int64(l.window)
+	windowStart := time.Unix(0, index*int64(l.window))
+	current, err := store.Incr(l.key(key, index))
+	if err != nil {
+		return 0, 0, err
+	}
+	if current == 1 {
+		// The previous window's count is still read during the next one
+		if err := store.Expire(l.key(key, index), 2*l.window); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Step 2: Add the part of the previous window that overlaps the last minute
+	value, err := store.Get(l.key(key, index-1))
+	if err != nil {
+		return 0, 0, err
+	}
+	previous, _ := strconv.ParseInt(value, 10, 64) // 0 if there was no request
+	elapsed := now.Sub(windowStart)
+	weight := 1 - float64(elapsed)/float64(l.window)
+	estimated := float64(previous)*weight + float64(current)
+
+	return l.max - int(math.Ceil(estimated)), l.window - elapsed, nil
+}
+
+// key returns the counter key of key in window index.
+func (l *slidingWindowLimiter) key(key string, index int64) string {
+	return "ratelimit:" + l.name + ":" + key + ":" + strconv.FormatInt(index, 10)
+}
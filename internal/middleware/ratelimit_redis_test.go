@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useCache replaces the default cache store for one test.
+func useCache(t *testing.T, store cache.Store) {
+	t.Helper()
+	original := cache.GetClient()
+	cache.SetDefault(store)
+	t.Cleanup(func() { cache.SetDefault(original) })
+}
+
+// TestRedisRateLimit_SharedBetweenInstances tests that two instances draw from one budget.
+func TestRedisRateLimit_SharedBetweenInstances(t *testing.T) {
+	useCache(t, cache.NewMemoryStore())
+	cfg := config.RateLimit{Max: 3, Storage: config.RateLimitRedis}
+
+	// Two apps stand in for two replicas sharing the cache
+	var apps []*fiber.App
+	for i := 0; i < 2; i++ {
+		app := fiber.New()
+		app.Get("/api/test", RateLimit(cfg), func(c *fiber.Ctx) error {
+			return c.SendString("ok")
+		})
+		apps = append(apps, app)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := apps[i%2].Test(httptest.NewRequest("GET", "/api/test", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Request %d should succeed", i+1)
+		assert.Equal(t, "3", resp.Header.Get("X-RateLimit-Limit"))
+	}
+
+	resp, err := apps[1].Test(httptest.NewRequest("GET", "/api/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get(fiber.HeaderRetryAfter))
+
+	// Other profiles have their own counters
+	resp, err = apps[0].Test(httptest.NewRequest("GET", "/api/test", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	strict := fiber.New()
+	strict.Get("/api/export", RateLimitProfile(config.RateLimit{StrictMax: 1, Storage: config.RateLimitRedis}, ProfileStrict), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	resp, err = strict.Test(httptest.NewRequest("GET", "/api/export", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestSlidingWindowLimiter_Hit tests that the previous window counts for the part of it that
+// overlaps the last minute.
+func TestSlidingWindowLimiter_Hit(t *testing.T) {
+	useCache(t, cache.NewMemoryStore())
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(50 * time.Second)
+	limiter := &slidingWindowLimiter{name: "test", max: 3, window: time.Minute, now: func() time.Time { return now }}
+
+	for i := 0; i < 3; i++ {
+		remaining, reset, err := limiter.hit("user:1")
+		require.NoError(t, err)
+		assert.Equal(t, 2-i, remaining)
+		assert.Equal(t, 10*time.Second, reset)
+	}
+
+	// 10s into the next window, 5/6 of the previous one still counts: 2.5 + 1 rounds up to 4
+	now = start.Add(70 * time.Second)
+	remaining, _, err := limiter.hit("user:1")
+	require.NoError(t, err)
+	assert.Equal(t, -1, remaining)
+
+	// 40s into it, a third still counts: 1 + 2 (the rejected request is counted too)
+	now = start.Add(100 * time.Second)
+	remaining, _, err = limiter.hit("user:1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+}
+
+// TestRedisRateLimit_FailsOpen tests that requests are allowed when the cache is unavailable.
+func TestRedisRateLimit_FailsOpen(t *testing.T) {
+	useCache(t, nil)
+
+	app := fiber.New()
+	app.Get("/api/test", RateLimit(config.RateLimit{Max: 1, Storage: config.RateLimitRedis}), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/test", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"strings"
+
+	"boilerplate/internal/apikey"
+	"boilerplate/internal/apperror"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuthContextKey is the c.Locals key holding the *AuthContext set by Auth.
+const AuthContextKey = "auth"
+
+// AuthContext is the authenticated caller, extracted from the JWT claims by Auth (or from the
+// API key by APIKeyAuth).
+//
+// Roles come from two places. Role is the token's "role" claim, which Supabase sets to the
+// Postgres role ("authenticated", "anon" or "service_role"). AppRoles are application roles
+// from app_metadata.roles (an array) and app_metadata.role (a string). Only the service role can
+// write app_metadata, so users can't grant themselves roles; user_metadata is never read.
+type AuthContext struct {
+	UserID      string
+	Email       string
+	Role        string
+	AppRoles    []string
+	AppMetadata map[string]interface{}
+	Claims      jwt.MapClaims
+	APIKey      *apikey.Key // Set for callers authenticated with an API key
+}
+
+// newAuthContext builds the AuthContext of a validated token.
+func newAuthContext(userID string, claims jwt.MapClaims) *AuthContext {
+	auth := &AuthContext{UserID: userID, Claims: claims}
+	auth.Email, _ = claims["email"].(string)
+	auth.Role, _ = claims["role"].(string)
+
+	metadata, _ := claims["app_metadata"].(map[string]interface{})
+	auth.AppMetadata = metadata
+	if role, ok := metadata["role"].(string); ok && role != "" {
+		auth.AppRoles = append(auth.AppRoles, role)
+	}
+	if roles, ok := metadata["roles"].([]interface{}); ok {
+		for _, item := range roles {
+			if role, ok := item.(string); ok && role != "" && !auth.hasAppRole(role) {
+				auth.AppRoles = append(auth.AppRoles, role)
+			}
+		}
+	}
+	return auth
+}
+
+// HasRole reports whether the caller has role, as its Postgres role or an application role.
+func (a *AuthContext) HasRole(role string) bool {
+	return a != nil && (a.Role == role || a.hasAppRole(role))
+}
+
+// hasAppRole reports whether role is one of the application roles.
+func (a *AuthContext) hasAppRole(role string) bool {
+	for _, r := range a.AppRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAuthContext returns the caller set by Auth, or nil on routes without Auth.
+func GetAuthContext(c *fiber.Ctx) *AuthContext {
+	auth, _ := c.Locals(AuthContextKey).(*AuthContext)
+	return auth
+}
+
+// RequireRole only lets through callers with role. It must run after Auth().
+func RequireRole(role string) fiber.Handler {
+	return RequireAnyRole(role)
+}
+
+// RequireAnyRole only lets through callers with at least one of roles. It must run after Auth().
+func RequireAnyRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		auth := GetAuthContext(c)
+		for _, role := range roles {
+			if auth.HasRole(role) {
+				return c.Next()
+			}
+		}
+		return apperror.Write(c, apperror.Forbidden("Missing role: "+strings.Join(roles, " or ")))
+	}
+}
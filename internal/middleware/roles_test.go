@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewAuthContext tests that the Postgres role and the app_metadata roles are extracted.
+func TestNewAuthContext(t *testing.T) {
+	auth := newAuthContext("user-1", jwt.MapClaims{
+		"email": "ada@example.com",
+		"role":  "authenticated",
+		"app_metadata": map[string]interface{}{
+			"provider": "email",
+			"role":     "editor",
+			"roles":    []interface{}{"moderator", "editor", 42},
+		},
+		"user_metadata": map[string]interface{}{"role": "admin"},
+	})
+
+	assert.Equal(t, "user-1", auth.UserID)
+	assert.Equal(t, "ada@example.com", auth.Email)
+	assert.Equal(t, "authenticated", auth.Role)
+	assert.Equal(t, []string{"editor", "moderator"}, auth.AppRoles)
+	assert.Equal(t, "email", auth.AppMetadata["provider"])
+	assert.True(t, auth.HasRole("authenticated"))
+	assert.True(t, auth.HasRole("moderator"))
+	assert.False(t, auth.HasRole("admin"), "user_metadata is writable by the user")
+
+	var none *AuthContext
+	assert.False(t, none.HasRole("authenticated"))
+}
+
+// TestRequireAnyRole tests role checks, including requests that never went through Auth.
+func TestRequireAnyRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		handler    fiber.Handler
+		wantStatus int
+	}{
+		{"app role", jwt.MapClaims{"app_metadata": map[string]interface{}{"role": "admin"}}, RequireRole("admin"), http.StatusOK},
+		{"postgres role", jwt.MapClaims{"role": "service_role"}, RequireAnyRole("admin", "service_role"), http.StatusOK},
+		{"other role", jwt.MapClaims{"role": "authenticated"}, RequireAnyRole("admin", "moderator"), http.StatusForbidden},
+		{"no auth", nil, RequireRole("admin"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/admin", func(c *fiber.Ctx) error {
+				if tt.claims != nil {
+					c.Locals(AuthContextKey, newAuthContext("user-1", tt.claims))
+				}
+				return c.Next()
+			}, tt.handler, func(c *fiber.Ctx) error {
+				return c.SendString("ok")
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/admin", nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"strings"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RequireScopes only lets through tokens granted every one of scopes.
+// It must run after Auth(), which sets the "claims" local. Scopes are read from the claim named
+// by cfg.ScopeClaim (SCOPE_CLAIM, default "scope"), either a space-separated string (OAuth style)
+// or an array.
+func RequireScopes(cfg config.Auth, scopes ...string) fiber.Handler {
+	claimName := cfg.ScopeClaim
+	if claimName == "" {
+		claimName = "scope"
+	}
+
+	return func(c *fiber.Ctx) error {
+		claims, _ := c.Locals("claims").(jwt.MapClaims)
+		granted := grantedScopes(claims[claimName])
+
+		for _, scope := range scopes {
+			if !granted[scope] {
+				return apperror.Write(c, apperror.Forbidden("Missing scope: "+scope).With("scope", scope))
+			}
+		}
+		return c.Next()
+	}
+}
+
+// grantedScopes parses a scope claim ("read write" or ["read", "write"]) into a lookup set.
+func grantedScopes(claim interface{}) map[string]bool {
+	granted := make(map[string]bool)
+	switch value := claim.(type) {
+	case string:
+		for _, scope := range strings.Fields(value) {
+			granted[scope] = true
+		}
+	case []interface{}:
+		for _, item := range value {
+			if scope, ok := item.(string); ok {
+				granted[scope] = true
+			}
+		}
+	}
+	return granted
+}
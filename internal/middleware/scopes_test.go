@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"boilerplate/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequireScopes tests scope checks against string and array claims.
+func TestRequireScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		claimName  string
+		claims     jwt.MapClaims
+		wantStatus int
+	}{
+		{"space-separated string", "", jwt.MapClaims{"scope": "reports:read reports:write"}, http.StatusOK},
+		{"array", "", jwt.MapClaims{"scope": []interface{}{"reports:read", "reports:write"}}, http.StatusOK},
+		{"missing one scope", "", jwt.MapClaims{"scope": "reports:read"}, http.StatusForbidden},
+		{"no scope claim", "", jwt.MapClaims{}, http.StatusForbidden},
+		{"custom claim name", "permissions", jwt.MapClaims{"permissions": []interface{}{"reports:read", "reports:write"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/reports", func(c *fiber.Ctx) error {
+				c.Locals("claims", tt.claims)
+				return c.Next()
+			}, RequireScopes(config.Auth{ScopeClaim: tt.claimName}, "reports:read", "reports:write"), func(c *fiber.Ctx) error {
+				return c.SendString("ok")
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/reports", nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package monitor
+
+// Package monitor watches the health of the process's goroutines and channels, exporting what
+// the Go runtime metrics (go_goroutines) can't tell apart:
+//
+// Tracked goroutines: long-lived goroutines count themselves under a name while they run, and
+// packages declare how many of each should run at most:
+//
+//	monitor.Expect("realtime.supervisor", 1)
+//
+//	done := monitor.Track("realtime.supervisor")
+//	go func() {
+//		defer done()
+//		supervise(ctx)
+//	}()
+//
+// A name running more than its expected count for leakChecks checks in a row is reported as a
+// leak: logged, counted in goroutines_leaked and listed by GET /api/admin/debug/runtime, until the
+// count is back under the bound. Short overlaps (a session ending while the next one starts) stay
+// under the threshold.
+//
+// Channel buffers: packages register their buffered channels (the WebSocket hub's broadcast
+// queue, the job workers' slots), and every MONITOR_INTERVAL (default 15s) their length and
+// utilization are exported as channel_buffer_length and channel_buffer_utilization. A channel
+// staying full means its consumer can't keep up. MONITOR=false turns the checks off; tracking
+// still counts goroutines for the admin endpoint.
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+)
+
+// defaultInterval is how often goroutines and channels are checked (MONITOR_INTERVAL).
+const defaultInterval = 15 * time.Second
+
+// leakChecks is how many checks in a row a name must run above its bound to be reported.
+const leakChecks = 2
+
+// Channel returns the length and capacity of a buffered channel.
+type Channel func() (length, capacity int)
+
+// GoroutineStatus is the state of a tracked goroutine name.
+type GoroutineStatus struct {
+	Name     string `json:"name"`
+	Running  int    `json:"running"`
+	Expected int    `json:"expected,omitempty"` // 0: no bound
+	Leaked   bool   `json:"leaked"`
+}
+
+// ChannelStatus is the buffer usage of a registered channel.
+type ChannelStatus struct {
+	Name        string  `json:"name"`
+	Length      int     `json:"length"`
+	Capacity    int     `json:"capacity"`
+	Utilization float64 `json:"utilization"`
+}
+
+// Snapshot is the state of the process's goroutines and registered channels.
+type Snapshot struct {
+	Goroutines int               `json:"goroutines"` // Every goroutine of the process
+	Tracked    []GoroutineStatus `json:"tracked"`
+	Channels   []ChannelStatus   `json:"channels"`
+}
+
+// tracked is the state of a tracked goroutine name.
+type tracked struct {
+	running  int
+	expected int
+	over     int // Checks in a row above expected
+	leaked   bool
+}
+
+var (
+	mu         sync.Mutex
+	goroutines = map[string]*tracked{}
+	channels   = map[string]Channel{}
+	interval   = defaultInterval // 0: checks off
+)
+
+// Init configures the checks from MONITOR and MONITOR_INTERVAL.
+func Init(cfg config.Monitor) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !cfg.Enabled {
+		interval = 0
+		startup.Report("monitor", false, "MONITOR=false")
+		return
+	}
+	interval = cfg.Interval
+	startup.Report("monitor", true, "goroutines and channel buffers checked every "+interval.String())
+}
+
+// Track counts a goroutine running under name until done is called. Call it before starting the
+// goroutine and defer done in it.
+func Track(name string) (done func()) {
+	mu.Lock()
+	t := get(name)
+	t.running++
+	metrics.GoroutinesTracked.WithLabelValues(name).Set(float64(t.running))
+	mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			t.running--
+			metrics.GoroutinesTracked.WithLabelValues(name).Set(float64(t.running))
+			mu.Unlock()
+		})
+	}
+}
+
+// Expect sets how many goroutines may run under name at most (0 removes the bound).
+func Expect(name string, max int) {
+	mu.Lock()
+	defer mu.Unlock()
+	get(name).expected = max
+}
+
+// RegisterChannel adds a channel whose buffer usage is exported under name, replacing one
+// registered under the same name.
+func RegisterChannel(name string, channel Channel) {
+	mu.Lock()
+	defer mu.Unlock()
+	channels[name] = channel
+}
+
+// Reset removes the tracked names and channels. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	goroutines = map[string]*tracked{}
+	channels = map[string]Channel{}
+	interval = defaultInterval
+}
+
+// RunMonitor checks goroutines and channels every MONITOR_INTERVAL, until ctx is cancelled. It
+// returns right away with MONITOR=false. Start it in a goroutine after Init.
+func RunMonitor(ctx context.Context) {
+	mu.Lock()
+	every := interval
+	mu.Unlock()
+	if every == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Check()
+		}
+	}
+}
+
+// Check exports channel usage and reports tracked names running above their bound for
+// leakChecks checks in a row, and those back under it.
+func Check() {
+	snapshot := Status()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, t := range goroutines {
+		if t.expected == 0 || t.running <= t.expected {
+			t.over = 0
+			if t.leaked {
+				t.leaked = false
+				metrics.GoroutinesLeaked.WithLabelValues(name).Set(0)
+				slog.Info("Leaked goroutines ended", "name", name, "running", t.running, "expected", t.expected)
+			}
+			continue
+		}
+		t.over++
+		if t.over >= leakChecks {
+			metrics.GoroutinesLeaked.WithLabelValues(name).Set(float64(t.running - t.expected))
+			if !t.leaked {
+				t.leaked = true
+				slog.Warn("Goroutines leaked, more are running than expected", "name", name,
+					"running", t.running, "expected", t.expected, "checks", t.over)
+			}
+		}
+	}
+
+	for _, channel := range snapshot.Channels {
+		metrics.ChannelBufferLength.WithLabelValues(channel.Name).Set(float64(channel.Length))
+		metrics.ChannelBufferUtilization.WithLabelValues(channel.Name).Set(channel.Utilization)
+	}
+}
+
+// Status returns the number of goroutines, the tracked names and the registered channels,
+// sorted by name.
+func Status() Snapshot {
+	mu.Lock()
+	snapshot := Snapshot{Goroutines: runtime.NumGoroutine(), Tracked: []GoroutineStatus{}, Channels: []ChannelStatus{}}
+	for name, t := range goroutines {
+		snapshot.Tracked = append(snapshot.Tracked, GoroutineStatus{Name: name, Running: t.running, Expected: t.expected, Leaked: t.leaked})
+	}
+	registered := make(map[string]Channel, len(channels))
+	for name, channel := range channels {
+		registered[name] = channel
+	}
+	mu.Unlock()
+
+	// Channels are read outside the lock: they may take their owner's
+	for name, channel := range registered {
+		length, capacity := channel()
+		status := ChannelStatus{Name: name, Length: length, Capacity: capacity}
+		if capacity > 0 {
+			status.Utilization = float64(length) / float64(capacity)
+		}
+		snapshot.Channels = append(snapshot.Channels, status)
+	}
+
+	sort.Slice(snapshot.Tracked, func(i, j int) bool { return snapshot.Tracked[i].Name < snapshot.Tracked[j].Name })
+	sort.Slice(snapshot.Channels, func(i, j int) bool { return snapshot.Channels[i].Name < snapshot.Channels[j].Name })
+	return snapshot
+}
+
+// get returns the state of name, adding it. Callers hold mu.
+func get(name string) *tracked {
+	t, ok := goroutines[name]
+	if !ok {
+		t = &tracked{}
+		goroutines[name] = t
+	}
+	return t
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trackedStatus returns the status of a tracked name.
+func trackedStatus(t *testing.T, name string) GoroutineStatus {
+	t.Helper()
+	for _, status := range Status().Tracked {
+		if status.Name == name {
+			return status
+		}
+	}
+	t.Fatalf("%s is not tracked", name)
+	return GoroutineStatus{}
+}
+
+// TestTrack tests that goroutines are counted while running, and that done only counts once.
+func TestTrack(t *testing.T) {
+	t.Cleanup(Reset)
+
+	first := Track("worker")
+	second := Track("worker")
+	assert.Equal(t, 2, trackedStatus(t, "worker").Running)
+
+	first()
+	first()
+	assert.Equal(t, 1, trackedStatus(t, "worker").Running)
+	second()
+	assert.Equal(t, 0, trackedStatus(t, "worker").Running)
+}
+
+// TestCheckLeaks tests that a name is reported as leaked after leakChecks checks above its bound,
+// not after a single one, and cleared once back under it.
+func TestCheckLeaks(t *testing.T) {
+	t.Cleanup(Reset)
+	Expect("supervisor", 1)
+
+	done := Track("supervisor")
+	defer done()
+	Check()
+	assert.False(t, trackedStatus(t, "supervisor").Leaked)
+
+	extra := Track("supervisor")
+	Check()
+	assert.False(t, trackedStatus(t, "supervisor").Leaked, "a short overlap is not a leak")
+	Check()
+	status := trackedStatus(t, "supervisor")
+	assert.True(t, status.Leaked)
+	assert.Equal(t, 2, status.Running)
+	assert.Equal(t, 1, status.Expected)
+
+	extra()
+	Check()
+	assert.False(t, trackedStatus(t, "supervisor").Leaked)
+
+	// Unbounded names never leak
+	for range 3 {
+		Track("unbounded")
+	}
+	Check()
+	Check()
+	assert.False(t, trackedStatus(t, "unbounded").Leaked)
+}
+
+// TestStatusChannels tests that registered channels report their length, capacity and
+// utilization, sorted by name.
+func TestStatusChannels(t *testing.T) {
+	t.Cleanup(Reset)
+	queue := make(chan int, 4)
+	queue <- 1
+	RegisterChannel("queue", func() (int, int) { return len(queue), cap(queue) })
+	RegisterChannel("empty", func() (int, int) { return 0, 0 })
+
+	snapshot := Status()
+	assert.Positive(t, snapshot.Goroutines)
+	require.Len(t, snapshot.Channels, 2)
+	assert.Equal(t, ChannelStatus{Name: "empty"}, snapshot.Channels[0])
+	assert.Equal(t, ChannelStatus{Name: "queue", Length: 1, Capacity: 4, Utilization: 0.25}, snapshot.Channels[1])
+
+	// Registering a name again replaces the channel
+	RegisterChannel("queue", func() (int, int) { return 4, 4 })
+	assert.Equal(t, 1.0, Status().Channels[1].Utilization)
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"boilerplate/internal/events"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/price"
+	"boilerplate/internal/resource"
+)
+
+// maxAlertsPerChange bounds how many alerts one price change evaluates.
+const maxAlertsPerChange = 1000
+
+// alertTimeout bounds the evaluation of one price change.
+const alertTimeout = 30 * time.Second
+
+// subscribeOnce subscribes to price changes the first time WatchPriceAlerts is called.
+var subscribeOnce sync.Once
+
+// WatchPriceAlerts evaluates users' price alerts (resource.Alerts) on every events.PriceChanged:
+// an active alert whose threshold the new price crosses is deactivated, so it fires once, and
+// its owner is sent a low-priority notification (see Send) unless they turned off
+// notifications.price_alerts.
+//
+// With several replicas, each sees the change; deactivating uses the alert's version, so only
+// one of them notifies.
+func WatchPriceAlerts() {
+	subscribeOnce.Do(func() {
+		events.Subscribe(func(change events.PriceChanged) {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+				defer cancel()
+				if _, err := EvaluateAlerts(ctx, change); err != nil {
+					slog.Error("Failed to evaluate price alerts", "artist_id", change.ArtistID, "error", err)
+				}
+			}()
+		})
+	})
+}
+
+// EvaluateAlerts fires the active alerts the price change crosses and returns how many fired.
+func EvaluateAlerts(ctx context.Context, change events.PriceChanged) (int, error) {
+	alerts, err := resource.Alerts.Match(ctx, change.TenantID, map[string]string{
+		"artist_id": change.ArtistID,
+		"active":    "true",
+	}, maxAlertsPerChange)
+	if err != nil {
+		return 0, err
+	}
+
+	fired := 0
+	for _, alert := range alerts {
+		threshold, err := price.Parse(alert["threshold"])
+		if err != nil {
+			continue
+		}
+		direction, _ := alert["direction"].(string)
+		crossed := (direction == "above" && change.Price.GreaterThanOrEqual(threshold)) ||
+			(direction == "below" && change.Price.LessThanOrEqual(threshold))
+		if !crossed {
+			continue
+		}
+
+		// Deactivate first: whoever loses the race (another replica, the user editing it) skips it
+		userID, _ := alert[resource.ColumnUserID].(string)
+		owner := resource.Owner{UserID: userID, TenantID: change.TenantID}
+		var conflict *resource.ConflictError
+		_, err = resource.Alerts.Update(ctx, owner, alert.ID(), map[string]interface{}{"active": false}, alert.Version())
+		if errors.As(err, &conflict) || errors.Is(err, resource.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fired, err
+		}
+		fired++
+
+		values, err := preferences.Get(ctx, change.TenantID, userID)
+		if err == nil && !enabled(values, "notifications.price_alerts") {
+			continue
+		}
+		current := price.String(change.Price)
+		err = Send(ctx, Recipient{UserID: userID, TenantID: change.TenantID}, Notification{
+			Type:        "price_alert",
+			Title:       "Price alert",
+			Body:        fmt.Sprintf("%s is now %s %s (%s)", change.ArtistID, direction, price.String(threshold), current),
+			Data:        map[string]string{"alert_id": alert.ID(), "artist_id": change.ArtistID, "price": current},
+			Priority:    PriorityLow,
+			CollapseKey: "price-alert-" + alert.ID(),
+		})
+		if err != nil {
+			slog.Warn("Failed to send price alert", "alert_id", alert.ID(), "error", err)
+		}
+	}
+	return fired, nil
+}
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/leader"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/preferences"
+)
+
+// maxDigestRecipients is how many users one SendDigests run emails; the rest wait for the next
+// check.
+const maxDigestRecipients = 500
+
+// digestCheckInterval is how often RunDigester checks whether the digest is due.
+const digestCheckInterval = 5 * time.Minute
+
+// Item is a notification waiting for the digest.
+type Item struct {
+	ID        string    `json:"id,omitempty"`
+	UserID    string    `json:"user_id"`
+	TenantID  string    `json:"tenant_id"`
+	Email     string    `json:"email,omitempty"` // As passed to Send; looked up if empty
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps notifications waiting for the digest.
+type Store interface {
+	// Add queues an item.
+	Add(ctx context.Context, item Item) error
+
+	// Recipients returns up to limit users with queued items, oldest items first.
+	Recipients(ctx context.Context, limit int) ([]Recipient, error)
+
+	// Take removes and returns the queued items of the user, oldest first. Items are taken
+	// atomically: two concurrent calls never return the same item.
+	Take(ctx context.Context, tenantID, userID string) ([]Item, error)
+}
+
+// RunDigester sends the daily digest once a day, at NOTIFY_DIGEST_HOUR (UTC). Call it in a
+// goroutine after Init(); it runs until ctx is cancelled. With several replicas sharing a cache,
+// only the first to take the day's lock sends it.
+func RunDigester(ctx context.Context) {
+	hour := getDigestHour()
+	slog.Info("Notification digest job started", "next", nextDigest(now(), hour).Format(time.RFC3339))
+
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	lastRun := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		today := now().UTC()
+		day := today.Format(time.DateOnly)
+		if today.Hour() < hour || day == lastRun || !claimDigest(day) {
+			continue
+		}
+		lastRun = day
+		sent, err := SendDigests(ctx)
+		if err != nil {
+			slog.Error("Failed to send notification digests", "error", err)
+		}
+		slog.Info("Notification digests sent", "emails", sent)
+	}
+}
+
+// claimDigest takes the day's digest lock, so one replica sends it. Without a shared cache, every
+// instance sends (the store hands each item to only one of them).
+func claimDigest(day string) bool {
+	locker := cache.GetLocker()
+	if locker == nil {
+		return true
+	}
+	acquired, err := locker.Acquire("notify:digest:"+day, leader.InstanceID(), 25*time.Hour)
+	if err != nil {
+		slog.Warn("Failed to take the notification digest lock, sending anyway", "error", err)
+		return true
+	}
+	return acquired
+}
+
+// SendDigests emails every user with queued notifications one digest of them, and returns how
+// many digests were sent. Users who turned email off since have their items dropped; users who
+// switched to immediate emails still get what was queued.
+func SendDigests(ctx context.Context) (int, error) {
+	if DefaultStore == nil {
+		return 0, nil
+	}
+	recipients, err := DefaultStore.Recipients(ctx, maxDigestRecipients)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list digest recipients: %w", err)
+	}
+
+	sent := 0
+	for _, recipient := range recipients {
+		items, err := DefaultStore.Take(ctx, recipient.TenantID, recipient.UserID)
+		if err != nil {
+			return sent, fmt.Errorf("failed to take digest items: %w", err)
+		}
+		if len(items) == 0 {
+			continue // Another instance took them
+		}
+		values, err := preferences.Get(ctx, recipient.TenantID, recipient.UserID)
+		if err != nil {
+			values = preferences.Resolve(nil)
+		} else if !enabled(values, "notifications.email") {
+			record(ChannelDigest, "skipped")
+			continue
+		}
+
+		for _, item := range items {
+			if item.Email != "" {
+				recipient.Email = item.Email
+			}
+		}
+		address, err := emailOf(ctx, recipient)
+		if err != nil {
+			record(ChannelDigest, "failed")
+			slog.Warn("Failed to send notification digest", "user_id", recipient.UserID, "error", err)
+			continue
+		}
+		if err := mail.SendTemplate(address, "digest", localeOf(values), struct{ Items []Item }{items}); err != nil {
+			record(ChannelDigest, "failed")
+			slog.Warn("Failed to send notification digest", "user_id", recipient.UserID, "error", err)
+			continue
+		}
+		record(ChannelDigest, "sent")
+		sent++
+	}
+	return sent, nil
+}
+
+// nextDigest returns when the first digest after t is due, at hour (UTC).
+func nextDigest(t time.Time, hour int) time.Time {
+	t = t.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
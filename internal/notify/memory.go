@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MemoryStore keeps digest items in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu     sync.Mutex
+	items  []Item
+	nextID int
+}
+
+// NewMemoryStore creates an empty in-memory digest store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Add queues an item.
+func (m *MemoryStore) Add(ctx context.Context, item Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	item.ID = strconv.Itoa(m.nextID)
+	m.items = append(m.items, item)
+	return nil
+}
+
+// Recipients returns up to limit users with queued items, oldest items first.
+func (m *MemoryStore) Recipients(ctx context.Context, limit int) ([]Recipient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	items := append([]Item(nil), m.items...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return recipientsOf(items, limit), nil
+}
+
+// Take removes and returns the queued items of the user, oldest first.
+func (m *MemoryStore) Take(ctx context.Context, tenantID, userID string) ([]Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	taken := make([]Item, 0)
+	kept := m.items[:0]
+	for _, item := range m.items {
+		if item.TenantID == tenantID && item.UserID == userID {
+			taken = append(taken, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	m.items = kept
+	sort.SliceStable(taken, func(i, j int) bool { return taken[i].CreatedAt.Before(taken[j].CreatedAt) })
+	return taken, nil
+}
+
+// recipientsOf returns the distinct users of items, in order, up to limit.
+func recipientsOf(items []Item, limit int) []Recipient {
+	seen := make(map[Recipient]bool)
+	recipients := make([]Recipient, 0)
+	for _, item := range items {
+		recipient := Recipient{UserID: item.UserID, TenantID: item.TenantID}
+		if seen[recipient] {
+			continue
+		}
+		seen[recipient] = true
+		recipients = append(recipients, recipient)
+		if len(recipients) == limit {
+			break
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,291 @@
+package notify
+
+// Package notify sends notifications to users over the channels each of them chose with their
+// preferences:
+//
+//   - notifications.ws: a notification message on the user's WebSocket connections
+//   - notifications.push: a push notification on their devices (see internal/push)
+//   - notifications.email: an email (see internal/mail)
+//
+// High-priority notifications (security, billing) are emailed right away. Low-priority ones
+// (price alerts) are emailed right away only if notifications.email_frequency is "immediate";
+// with "daily" (the default) they are kept in the notification_digest table (see schema.sql; in
+// memory without SUPABASE_SERVICE_ROLE_KEY) and sent as one digest email a day, at
+// NOTIFY_DIGEST_HOUR (UTC, default 8). The WebSocket and push channels always deliver right away.
+//
+// Email addresses are read from Supabase Auth (admin API, service role key) unless the caller
+// passes one, e.g. from the token's email claim.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+	"boilerplate/internal/events"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/push"
+	"boilerplate/internal/startup"
+)
+
+// Priorities.
+const (
+	PriorityHigh = "high" // Always emailed right away
+	PriorityLow  = "low"  // Emailed in the daily digest unless the user wants them right away
+)
+
+// Channels, as used in metrics.
+const (
+	ChannelWebSocket = "ws"
+	ChannelPush      = "push"
+	ChannelEmail     = "email"
+	ChannelDigest    = "digest"
+)
+
+// Email frequencies (the notifications.email_frequency preference).
+const (
+	FrequencyImmediate = "immediate"
+	FrequencyDaily     = "daily"
+)
+
+// Notification is a message to one user.
+type Notification struct {
+	Type     string            // e.g. price_alert; apps use it to route taps
+	Title    string            // Email subject, push title
+	Body     string            // Plain text
+	Data     map[string]string // Extra fields for apps (WebSocket and push only)
+	Priority string            // PriorityHigh or PriorityLow (the default)
+
+	// CollapseKey, if set, replaces an undelivered push notification with the same key.
+	CollapseKey string
+}
+
+// Recipient is who a notification is for.
+type Recipient struct {
+	UserID   string `json:"user_id"`
+	TenantID string `json:"tenant_id"`
+	Email    string `json:"email,omitempty"` // Looked up in Supabase Auth if empty
+}
+
+// ErrNoEmail is returned for email notifications to users whose address can't be found.
+var ErrNoEmail = errors.New("no email address for user")
+
+// tableName is the Postgres table holding digest items (see schema.sql).
+const tableName = "notification_digest"
+
+var (
+	// DefaultStore keeps notifications waiting for the digest. It is nil until Init() or
+	// SetDefault() is called.
+	DefaultStore Store
+
+	// LookupEmail returns the email address of a user, or "" if they have none. Init sets it to
+	// a Supabase Auth lookup; tests replace it.
+	LookupEmail = func(ctx context.Context, userID string) (string, error) { return "", nil }
+
+	// now is the clock used for digests (overridable in tests).
+	now = time.Now
+)
+
+// Init configures the digest store and email lookup from the environment, and starts evaluating
+// price alerts (see WatchPriceAlerts).
+func Init() {
+	supabaseURL, serviceKey := os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	detail := fmt.Sprintf("daily digest at %02d:00 UTC", getDigestHour())
+	if supabaseURL == "" || serviceKey == "" {
+		slog.Warn("SUPABASE_SERVICE_ROLE_KEY not set, notification digests are kept in memory and emails need an address from the caller")
+		DefaultStore = NewMemoryStore()
+		LookupEmail = func(ctx context.Context, userID string) (string, error) { return "", nil }
+		detail += ", kept in memory (SUPABASE_SERVICE_ROLE_KEY not set)"
+	} else {
+		if err := gdpr.RegisterTable(tableName, "user_id"); err != nil {
+			slog.Warn("Failed to register notification digests for GDPR erasure", "error", err)
+		}
+		DefaultStore = NewPostgRESTStore(supabaseURL, serviceKey)
+		LookupEmail = supabaseEmailLookup(supabaseURL, serviceKey)
+	}
+	WatchPriceAlerts()
+	startup.Report("notifications", true, detail)
+}
+
+// SetDefault replaces the digest store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// Send delivers a notification to the user over every channel their preferences allow. A channel
+// that fails doesn't stop the others; their errors are joined.
+func Send(ctx context.Context, recipient Recipient, notification Notification) error {
+	if notification.Priority == "" {
+		notification.Priority = PriorityLow
+	}
+	values, err := preferences.Get(ctx, recipient.TenantID, recipient.UserID)
+	if err != nil {
+		slog.Warn("Failed to read notification preferences, using the defaults", "error", err)
+		values = preferences.Resolve(nil)
+	}
+
+	var errs []error
+	if enabled(values, "notifications.ws") {
+		events.Publish(events.NotificationSent{
+			UserID:   recipient.UserID,
+			TenantID: recipient.TenantID,
+			Type:     notification.Type,
+			Title:    notification.Title,
+			Body:     notification.Body,
+			Data:     notification.Data,
+			Priority: notification.Priority,
+		})
+		record(ChannelWebSocket, "sent")
+	} else {
+		record(ChannelWebSocket, "skipped")
+	}
+
+	if enabled(values, "notifications.push") {
+		_, err := push.Get().Notify(ctx, recipient.TenantID, recipient.UserID, push.Message{
+			Title:       notification.Title,
+			Body:        notification.Body,
+			Data:        notification.Data,
+			CollapseKey: notification.CollapseKey,
+		})
+		switch {
+		case errors.Is(err, push.ErrNotConfigured):
+		case err != nil:
+			record(ChannelPush, "failed")
+			errs = append(errs, fmt.Errorf("push: %w", err))
+		default:
+			record(ChannelPush, "sent")
+		}
+	} else {
+		record(ChannelPush, "skipped")
+	}
+
+	if enabled(values, "notifications.email") {
+		if err := sendEmail(ctx, recipient, notification, values); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	} else {
+		record(ChannelEmail, "skipped")
+	}
+	return errors.Join(errs...)
+}
+
+// sendEmail emails the notification right away (in the user's locale), or queues it for the
+// digest.
+func sendEmail(ctx context.Context, recipient Recipient, notification Notification, values map[string]interface{}) error {
+	if notification.Priority == PriorityLow && values["notifications.email_frequency"] == FrequencyDaily && DefaultStore != nil {
+		err := DefaultStore.Add(ctx, Item{
+			UserID:    recipient.UserID,
+			TenantID:  recipient.TenantID,
+			Email:     recipient.Email,
+			Type:      notification.Type,
+			Title:     notification.Title,
+			Body:      notification.Body,
+			CreatedAt: now().UTC(),
+		})
+		if err != nil {
+			record(ChannelEmail, "failed")
+			return fmt.Errorf("failed to queue for the digest: %w", err)
+		}
+		record(ChannelEmail, "queued")
+		return nil
+	}
+
+	address, err := emailOf(ctx, recipient)
+	if err != nil {
+		record(ChannelEmail, "failed")
+		return err
+	}
+	if err := mail.SendTemplate(address, "notification", localeOf(values), notification); err != nil {
+		record(ChannelEmail, "failed")
+		return err
+	}
+	record(ChannelEmail, "sent")
+	return nil
+}
+
+// emailOf returns the recipient's address, looking it up if the caller didn't pass one.
+func emailOf(ctx context.Context, recipient Recipient) (string, error) {
+	if recipient.Email != "" {
+		return recipient.Email, nil
+	}
+	address, err := LookupEmail(ctx, recipient.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up email address: %w", err)
+	}
+	if address == "" {
+		return "", ErrNoEmail
+	}
+	return address, nil
+}
+
+// enabled reports whether the boolean preference key is on.
+func enabled(values map[string]interface{}, key string) bool {
+	on, ok := values[key].(bool)
+	return !ok || on
+}
+
+// localeOf returns the locale preference, or "" for the default.
+func localeOf(values map[string]interface{}) string {
+	locale, _ := values["locale"].(string)
+	return locale
+}
+
+// record counts a notification in the metrics.
+func record(channel, result string) {
+	metrics.NotificationsSent.WithLabelValues(channel, result).Inc()
+}
+
+// supabaseEmailLookup returns a LookupEmail reading users from the Supabase Auth admin API.
+func supabaseEmailLookup(supabaseURL, serviceKey string) func(ctx context.Context, userID string) (string, error) {
+	client := egress.NewClient(10 * time.Second)
+	base := strings.TrimSuffix(supabaseURL, "/") + "/auth/v1/admin/users/"
+	return func(ctx context.Context, userID string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+url.PathEscape(userID), nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("apikey", serviceKey)
+		req.Header.Set("Authorization", "Bearer "+serviceKey)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to connect to Supabase: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("Supabase Auth error (status %d)", resp.StatusCode)
+		}
+		var user struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+			return "", fmt.Errorf("failed to parse user: %w", err)
+		}
+		return user.Email, nil
+	}
+}
+
+// getDigestHour returns NOTIFY_DIGEST_HOUR (0-23, UTC), defaulting to 8.
+func getDigestHour() int {
+	if raw := os.Getenv("NOTIFY_DIGEST_HOUR"); raw != "" {
+		if hour, err := strconv.Atoi(raw); err == nil && hour >= 0 && hour <= 23 {
+			return hour
+		}
+		slog.Warn("Invalid NOTIFY_DIGEST_HOUR, using 8", "value", raw)
+	}
+	return 8
+}
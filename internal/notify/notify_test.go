@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/events"
+	"boilerplate/internal/mail"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/profile"
+	"boilerplate/internal/push"
+	"boilerplate/internal/resource"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMailer records sent emails.
+type fakeMailer struct {
+	mu     sync.Mutex
+	sent   []string // "to: subject"
+	bodies []string
+}
+
+func (f *fakeMailer) Send(to, subject, body string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, to+": "+subject)
+	f.bodies = append(f.bodies, body)
+	return nil
+}
+
+// setupTest swaps in memory stores, a fake mailer and an email lookup, and records the
+// notifications published for the WebSocket.
+func setupTest(t *testing.T) (*MemoryStore, *fakeMailer, *[]events.NotificationSent) {
+	t.Helper()
+	originalStore, originalMailer, originalLookup := DefaultStore, mail.DefaultMailer, LookupEmail
+	originalProfiles, originalCache, originalPush := profile.DefaultStore, cache.GetClient(), push.Get()
+
+	store := NewMemoryStore()
+	SetDefault(store)
+	mailer := &fakeMailer{}
+	mail.SetDefault(mailer)
+	LookupEmail = func(ctx context.Context, userID string) (string, error) { return userID + "@example.com", nil }
+	profile.SetDefault(profile.NewMemoryStore())
+	cache.SetDefault(cache.NewMemoryStore())
+	push.SetDefault(nil)
+
+	var published []events.NotificationSent
+	unsubscribe := events.Subscribe(func(n events.NotificationSent) { published = append(published, n) })
+	t.Cleanup(func() {
+		unsubscribe()
+		SetDefault(originalStore)
+		mail.SetDefault(originalMailer)
+		LookupEmail = originalLookup
+		profile.SetDefault(originalProfiles)
+		cache.SetDefault(originalCache)
+		push.SetDefault(originalPush)
+	})
+	return store, mailer, &published
+}
+
+// TestSend tests the channels chosen by the preferences, and that low-priority emails wait for
+// the digest unless the user wants them right away.
+func TestSend(t *testing.T) {
+	store, mailer, published := setupTest(t)
+	ctx := context.Background()
+	u1 := Recipient{UserID: "u1"}
+
+	require.NoError(t, Send(ctx, u1, Notification{Type: "price_alert", Title: "Low", Body: "b"}))
+	require.NoError(t, Send(ctx, u1, Notification{Type: "security", Title: "High", Body: "b", Priority: PriorityHigh}))
+	require.Len(t, *published, 2)
+	assert.Equal(t, "u1", (*published)[0].UserID)
+	assert.Equal(t, PriorityLow, (*published)[0].Priority)
+	assert.Equal(t, []string{"u1@example.com: High"}, mailer.sent, "only the high-priority email goes out now")
+	recipients, _ := store.Recipients(ctx, 10)
+	assert.Equal(t, []Recipient{{UserID: "u1"}}, recipients)
+
+	_, err := preferences.Set(ctx, "", "u2", map[string]interface{}{"notifications.email_frequency": FrequencyImmediate, "notifications.ws": false})
+	require.NoError(t, err)
+	require.NoError(t, Send(ctx, Recipient{UserID: "u2", Email: "ada@example.com"}, Notification{Title: "Low", Body: "b"}))
+	assert.Equal(t, "ada@example.com: Low", mailer.sent[1])
+	assert.Len(t, *published, 2, "u2 turned the WebSocket channel off")
+
+	_, err = preferences.Set(ctx, "", "u3", map[string]interface{}{"notifications.email": false})
+	require.NoError(t, err)
+	require.NoError(t, Send(ctx, Recipient{UserID: "u3"}, Notification{Title: "High", Body: "b", Priority: PriorityHigh}))
+	assert.Len(t, mailer.sent, 2)
+
+	LookupEmail = func(ctx context.Context, userID string) (string, error) { return "", nil }
+	assert.ErrorIs(t, Send(ctx, Recipient{UserID: "u4"}, Notification{Title: "High", Priority: PriorityHigh}), ErrNoEmail)
+}
+
+// TestSendDigests tests that each user gets one email of their queued notifications, once.
+func TestSendDigests(t *testing.T) {
+	store, mailer, _ := setupTest(t)
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i, title := range []string{"First", "Second"} {
+		require.NoError(t, store.Add(ctx, Item{UserID: "u1", Title: title, Body: "b", CreatedAt: start.Add(time.Duration(i) * time.Minute)}))
+	}
+	require.NoError(t, store.Add(ctx, Item{UserID: "u2", Title: "Dropped", Body: "b", CreatedAt: start}))
+	_, err := preferences.Set(ctx, "", "u2", map[string]interface{}{"notifications.email": false})
+	require.NoError(t, err)
+
+	sent, err := SendDigests(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"u1@example.com: Your daily summary: 2 notifications"}, mailer.sent)
+	assert.Less(t, strings.Index(mailer.bodies[0], "First"), strings.Index(mailer.bodies[0], "Second"))
+
+	sent, err = SendDigests(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent, "items are sent once")
+}
+
+// TestNextDigest tests the digest schedule.
+func TestNextDigest(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2026, 1, 1, hour, minute, 0, 0, time.UTC) }
+	assert.Equal(t, at(8, 0), nextDigest(at(7, 59), 8))
+	assert.Equal(t, at(8, 0).AddDate(0, 0, 1), nextDigest(at(8, 0), 8))
+}
+
+// TestEvaluateAlerts tests that crossed alerts fire once and notify their owner.
+func TestEvaluateAlerts(t *testing.T) {
+	store, _, published := setupTest(t)
+	originalResources := resource.DefaultStore
+	resource.SetDefault(resource.NewMemoryStore())
+	t.Cleanup(func() { resource.SetDefault(originalResources) })
+	ctx := context.Background()
+
+	create := func(userID, direction, threshold string) {
+		_, err := resource.Alerts.Create(ctx, resource.Owner{UserID: userID}, map[string]interface{}{
+			"artist_id": "a1", "direction": direction, "threshold": threshold,
+		})
+		require.NoError(t, err)
+	}
+	create("u1", "above", "40")
+	create("u2", "above", "50")
+	create("u2", "below", "30")
+
+	change := events.PriceChanged{ArtistID: "a1", Price: decimal.RequireFromString("45.5")}
+	fired, err := EvaluateAlerts(ctx, change)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fired)
+	require.Len(t, *published, 1)
+	assert.Equal(t, "u1", (*published)[0].UserID)
+	assert.Equal(t, "a1", (*published)[0].Data["artist_id"])
+	recipients, _ := store.Recipients(ctx, 10)
+	assert.Len(t, recipients, 1, "the email waits for the digest")
+
+	fired, err = EvaluateAlerts(ctx, change)
+	require.NoError(t, err)
+	assert.Zero(t, fired, "alerts fire once")
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// recipientScan is how many queued items Recipients reads to find distinct users.
+const recipientScan = 5000
+
+// PostgRESTStore keeps digest items in Postgres through the Supabase REST API (PostgREST), with
+// the service role key. See schema.sql for the table.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/notification_digest
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Add queues an item.
+func (s *PostgRESTStore) Add(ctx context.Context, item Item) error {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode digest item: %w", err)
+	}
+	resp, err := s.do(ctx, "POST", s.baseURL, body, "return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Recipients returns up to limit users with queued items, oldest items first. PostgREST has no
+// DISTINCT, so it reads the oldest items' users and deduplicates them.
+func (s *PostgRESTStore) Recipients(ctx context.Context, limit int) ([]Recipient, error) {
+	params := url.Values{}
+	params.Set("select", "user_id,tenant_id")
+	params.Set("order", "created_at.asc")
+	params.Set("limit", fmt.Sprint(recipientScan))
+
+	items, err := s.list(ctx, "GET", params)
+	if err != nil {
+		return nil, err
+	}
+	return recipientsOf(items, limit), nil
+}
+
+// Take deletes the queued items of the user and returns them, oldest first. The DELETE returns
+// the rows it removed, so concurrent calls never return the same item.
+func (s *PostgRESTStore) Take(ctx context.Context, tenantID, userID string) ([]Item, error) {
+	params := url.Values{}
+	params.Set("tenant_id", "eq."+tenantID)
+	params.Set("user_id", "eq."+userID)
+	params.Set("order", "created_at.asc")
+	return s.list(ctx, "DELETE", params)
+}
+
+// list sends a GET or DELETE returning rows.
+func (s *PostgRESTStore) list(ctx context.Context, method string, params url.Values) ([]Item, error) {
+	resp, err := s.do(ctx, method, s.baseURL+"?"+params.Encode(), nil, "return=representation")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	items := make([]Item, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to parse digest items: %w", err)
+	}
+	return items, nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
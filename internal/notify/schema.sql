@@ -0,0 +1,19 @@
+-- Low-priority notifications waiting for the daily digest email (see internal/notify). Run this
+-- in the Supabase SQL editor.
+
+create table if not exists notification_digest (
+    id         uuid        primary key default gen_random_uuid(),
+    user_id    text        not null,                 -- Supabase auth user ID (the JWT sub)
+    tenant_id  text        not null default '',
+    email      text,                                 -- Address passed by the sender, if any
+    type       text        not null default '',
+    title      text        not null,
+    body       text        not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists notification_digest_user_idx on notification_digest (tenant_id, user_id, created_at);
+create index if not exists notification_digest_created_idx on notification_digest (created_at);
+
+-- Only the backend (service role key) reads and writes the queue.
+alter table notification_digest enable row level security;
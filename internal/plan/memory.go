@@ -0,0 +1,48 @@
+package plan
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps subscriptions in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription // By user ID
+}
+
+// NewMemoryStore creates an empty in-memory subscription store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{subscriptions: make(map[string]Subscription)}
+}
+
+// Get returns a copy of the subscription of userID, or nil.
+func (m *MemoryStore) Get(ctx context.Context, userID string) (*Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if subscription, ok := m.subscriptions[userID]; ok {
+		return &subscription, nil
+	}
+	return nil, nil
+}
+
+// GetByCustomer returns a copy of the subscription with the Stripe customer ID, or nil.
+func (m *MemoryStore) GetByCustomer(ctx context.Context, customerID string) (*Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, subscription := range m.subscriptions {
+		if subscription.StripeCustomerID == customerID {
+			return &subscription, nil
+		}
+	}
+	return nil, nil
+}
+
+// Save inserts or replaces the subscription of its user.
+func (m *MemoryStore) Save(ctx context.Context, subscription Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[subscription.UserID] = subscription
+	return nil
+}
@@ -0,0 +1,73 @@
+package plan
+
+import (
+	"strconv"
+	"time"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/usage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireFeature only lets through users whose plan includes feature; others get 402 with the
+// feature and their plan, so the client can offer an upgrade. It must run after Auth(). Routes
+// declare it with router.Route.Feature.
+func RequireFeature(feature string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := Resolve(c)
+		if err != nil {
+			return apperror.Write(c, apperror.Unavailable("Failed to load plan", err))
+		}
+		if p == nil || p.HasFeature(feature) {
+			return c.Next()
+		}
+		return apperror.Write(c, apperror.New(fiber.StatusPaymentRequired, apperror.CodePaymentRequired, "Your plan does not include this feature").
+			With("feature", feature).
+			With("plan", p.Name))
+	}
+}
+
+// EnforceQuota rejects requests of users who used up their plan's daily or monthly requests
+// with 429 and a Retry-After until the period ends. Counts come from internal/usage; if they
+// can't be read the request is let through. It must run after Auth(); the router adds it to
+// every authenticated, non-admin route.
+func EnforceQuota() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := Resolve(c)
+		if err != nil {
+			// Failing open, like the rate limiter: a billing lookup shouldn't take the API down
+			logging.FromRequest(c).Warn("Failed to resolve plan, skipping quota", "error", err)
+			return c.Next()
+		}
+		if p == nil || (p.DailyRequests == 0 && p.MonthlyRequests == 0) {
+			return c.Next()
+		}
+
+		userID, _ := c.Locals("user").(string)
+		day, month, err := usage.Current(tenant.ID(c), userID)
+		if err != nil {
+			logging.FromRequest(c).Warn("Failed to read usage, skipping quota", "error", err)
+			return c.Next()
+		}
+
+		period, limit, reset := "", int64(0), time.Time{}
+		switch start, _ := time.Parse(time.DateOnly, month.PeriodStart); {
+		case p.MonthlyRequests > 0 && month.Count >= p.MonthlyRequests:
+			period, limit, reset = usage.Month, p.MonthlyRequests, start.AddDate(0, 1, 0)
+		case p.DailyRequests > 0 && day.Count >= p.DailyRequests:
+			dayStart, _ := time.Parse(time.DateOnly, day.PeriodStart)
+			period, limit, reset = usage.Day, p.DailyRequests, dayStart.AddDate(0, 0, 1)
+		default:
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(time.Until(reset).Seconds())+1))
+		return apperror.Write(c, apperror.New(fiber.StatusTooManyRequests, apperror.CodeQuotaExceeded, "Plan quota exceeded").
+			With("plan", p.Name).
+			With("period", period).
+			With("limit", limit))
+	}
+}
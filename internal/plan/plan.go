@@ -0,0 +1,354 @@
+package plan
+
+// Package plan resolves which billing plan a user is on and gates features and request quotas by
+// it, the enforcement skeleton of a SaaS product built on this server.
+//
+// Plans are declared in PLANS as JSON, e.g.
+//
+//	{"free": {"daily_requests": 1000},
+//	 "pro":  {"features": ["export", "search"], "monthly_requests": 1000000}}
+//
+// A user's plan is, in order: their subscription (kept up to date by the Stripe webhook, see
+// stripe.go), the plan named by the PLAN_CLAIM token claim (default app_metadata.plan, which only
+// the service role can write) for apps that manage plans themselves, or DEFAULT_PLAN. Lookups are
+// cached per user for PLAN_CACHE_TTL, and dropped when a webhook changes the subscription.
+//
+// Without PLANS nothing is enforced: every feature is allowed and there are no quotas.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AllFeatures in a plan's features includes every feature.
+const AllFeatures = "*"
+
+// Plan is a billing plan and what it allows.
+type Plan struct {
+	Name            string   `json:"name"`
+	Features        []string `json:"features"`
+	DailyRequests   int64    `json:"daily_requests,omitempty"`   // 0: unlimited
+	MonthlyRequests int64    `json:"monthly_requests,omitempty"` // 0: unlimited
+}
+
+// HasFeature reports whether the plan includes feature.
+func (p *Plan) HasFeature(feature string) bool {
+	return slices.Contains(p.Features, AllFeatures) || slices.Contains(p.Features, feature)
+}
+
+// Subscription statuses (Stripe's). A subscription only grants its plan while it is active,
+// trialing or past_due (Stripe is still retrying the payment).
+const (
+	StatusActive   = "active"
+	StatusTrialing = "trialing"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+)
+
+// Subscription is the billing state of one user.
+type Subscription struct {
+	UserID               string     `json:"user_id"`
+	TenantID             string     `json:"tenant_id"`
+	Plan                 string     `json:"plan"`
+	Status               string     `json:"status"`
+	StripeCustomerID     string     `json:"stripe_customer_id,omitempty"`
+	StripeSubscriptionID string     `json:"stripe_subscription_id,omitempty"`
+	CurrentPeriodEnd     *time.Time `json:"current_period_end,omitempty"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// Grants reports whether the subscription currently grants its plan.
+func (s *Subscription) Grants() bool {
+	return s.Status == StatusActive || s.Status == StatusTrialing || s.Status == StatusPastDue
+}
+
+// Store persists subscriptions.
+type Store interface {
+	// Get returns the subscription of userID, or nil if the user has none.
+	Get(ctx context.Context, userID string) (*Subscription, error)
+
+	// GetByCustomer returns the subscription with the Stripe customer ID, or nil if none has it.
+	GetByCustomer(ctx context.Context, customerID string) (*Subscription, error)
+
+	// Save inserts or replaces the subscription of its user.
+	Save(ctx context.Context, subscription Subscription) error
+}
+
+// ErrUnknownPlan is returned for plan names that are not in PLANS.
+var ErrUnknownPlan = errors.New("unknown plan")
+
+// DefaultStore is the subscription store. It is nil until Init() or SetDefault() is called.
+var DefaultStore Store
+
+// tableName is the Postgres table holding subscriptions (see schema.sql).
+const tableName = "subscriptions"
+
+// settings are the plans and how they are resolved.
+type settings struct {
+	plans       map[string]*Plan // nil: enforcement off
+	defaultPlan string
+	claim       string
+	cacheTTL    time.Duration
+}
+
+var (
+	settingsMu sync.RWMutex
+	current    = settings{claim: "app_metadata.plan", cacheTTL: time.Minute}
+)
+
+// Init reads the plans (PLANS, DEFAULT_PLAN, PLAN_CLAIM, PLAN_CACHE_TTL), the Stripe webhook
+// settings and the subscription store. Invalid plans are logged and leave enforcement off.
+func Init() {
+	// Cached plans are deleted on erasure in both modes
+	gdpr.RegisterCacheKey(cacheKey("{user_id}"))
+
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	storeDetail := "subscriptions in Supabase Postgres"
+	if supabaseURL == "" || serviceKey == "" {
+		slog.Warn("SUPABASE_SERVICE_ROLE_KEY not set, subscriptions are kept in memory only")
+		storeDetail = "subscriptions in memory (SUPABASE_SERVICE_ROLE_KEY not set)"
+		DefaultStore = NewMemoryStore()
+	} else {
+		if err := gdpr.RegisterTable(tableName, "user_id"); err != nil {
+			slog.Warn("Failed to register subscriptions for GDPR erasure", "error", err)
+		}
+		DefaultStore = NewPostgRESTStore(supabaseURL, serviceKey)
+	}
+	initStripe()
+
+	s, err := loadSettings()
+	if err != nil {
+		slog.Error("Invalid plan settings, plans are not enforced", "error", err)
+		startup.Report("plans", false, err.Error())
+		return
+	}
+	Configure(s.plans, s.defaultPlan, s.claim, s.cacheTTL)
+	if s.plans == nil {
+		startup.Report("plans", false, "PLANS not set, nothing enforced")
+		return
+	}
+	startup.Report("plans", true, strings.Join(Names(), ", ")+" (default "+s.defaultPlan+"), "+storeDetail)
+}
+
+// loadSettings reads the plan settings from the environment.
+func loadSettings() (settings, error) {
+	s := settings{
+		defaultPlan: envOr("DEFAULT_PLAN", "free"),
+		claim:       envOr("PLAN_CLAIM", "app_metadata.plan"),
+		cacheTTL:    time.Minute,
+	}
+	if value := os.Getenv("PLAN_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			slog.Warn("Invalid PLAN_CACHE_TTL, using 1m", "value", value)
+		} else {
+			s.cacheTTL = parsed
+		}
+	}
+
+	raw := os.Getenv("PLANS")
+	if raw == "" {
+		return s, nil
+	}
+	var plans map[string]*Plan
+	if err := json.Unmarshal([]byte(raw), &plans); err != nil {
+		return s, fmt.Errorf("PLANS must be a JSON object of plans: %w", err)
+	}
+	for name, p := range plans {
+		if p == nil {
+			return s, fmt.Errorf("PLANS: plan %q is null", name)
+		}
+		if p.DailyRequests < 0 || p.MonthlyRequests < 0 {
+			return s, fmt.Errorf("PLANS: plan %q has a negative quota", name)
+		}
+		p.Name = name
+		if p.Features == nil {
+			p.Features = []string{}
+		}
+	}
+	if plans[s.defaultPlan] == nil {
+		return s, fmt.Errorf("DEFAULT_PLAN %q is not one of PLANS", s.defaultPlan)
+	}
+	s.plans = plans
+	return s, nil
+}
+
+// Configure sets the plans, the default plan, the plan claim and the cache TTL. nil plans turn
+// enforcement off. Init calls it from the environment; it is mainly useful in tests.
+func Configure(plans map[string]*Plan, defaultPlan, claim string, cacheTTL time.Duration) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	current = settings{plans: plans, defaultPlan: defaultPlan, claim: claim, cacheTTL: cacheTTL}
+}
+
+// SetDefault replaces the default store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// Enabled reports whether plans are enforced (PLANS is set).
+func Enabled() bool {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return current.plans != nil
+}
+
+// Names returns the configured plan names, sorted.
+func Names() []string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	names := make([]string, 0, len(current.plans))
+	for name := range current.plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the plan called name, or ErrUnknownPlan.
+func Get(name string) (*Plan, error) {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	if p, ok := current.plans[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPlan, name)
+}
+
+// Resolve returns the plan of the request's user, or nil when plans are not enforced.
+// It must run after Auth().
+func Resolve(c *fiber.Ctx) (*Plan, error) {
+	if !Enabled() {
+		return nil, nil
+	}
+	if p, ok := c.Locals(localsKey).(*Plan); ok {
+		return p, nil
+	}
+
+	var claims jwt.MapClaims
+	if auth := middleware.GetAuthContext(c); auth != nil {
+		claims = auth.Claims
+	}
+	userID, _ := c.Locals("user").(string)
+	p, err := For(c.UserContext(), tenant.ID(c), userID, claims)
+	if err != nil {
+		return nil, err
+	}
+	c.Locals(localsKey, p)
+	return p, nil
+}
+
+// localsKey is the fiber.Ctx Locals key caching the resolved plan for the rest of the request.
+const localsKey = "plan"
+
+// For returns the plan of userID with the given token claims (nil if there are none), or nil when
+// plans are not enforced.
+func For(ctx context.Context, tenantID, userID string, claims jwt.MapClaims) (*Plan, error) {
+	settingsMu.RLock()
+	s := current
+	settingsMu.RUnlock()
+	if s.plans == nil {
+		return nil, nil
+	}
+
+	// Step 1: The subscription, from the cache when possible
+	name, err := subscribedPlan(ctx, tenantID, userID, s.cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: The claim, then the default
+	if name == "" {
+		if claimed := lookupClaim(claims, s.claim); s.plans[claimed] != nil {
+			name = claimed
+		}
+	}
+	if name == "" || s.plans[name] == nil {
+		name = s.defaultPlan
+	}
+	return s.plans[name], nil
+}
+
+// noSubscription is cached for users without a subscription that grants a plan.
+const noSubscription = "-"
+
+// subscribedPlan returns the plan granted by the user's subscription, "" if there is none.
+func subscribedPlan(ctx context.Context, tenantID, userID string, ttl time.Duration) (string, error) {
+	if DefaultStore == nil || userID == "" {
+		return "", nil
+	}
+
+	store := tenant.CacheFor(tenantID)
+	if store != nil {
+		if cached, err := store.Get(cacheKey(userID)); err == nil && cached != "" {
+			if cached == noSubscription {
+				return "", nil
+			}
+			return cached, nil
+		}
+	}
+
+	subscription, err := DefaultStore.Get(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load subscription: %w", err)
+	}
+	name := noSubscription
+	if subscription != nil && subscription.Grants() && subscription.Plan != "" {
+		name = subscription.Plan
+	}
+
+	if store != nil {
+		if err := store.Set(cacheKey(userID), name, ttl); err != nil {
+			slog.Warn("Failed to cache plan", "error", err)
+		}
+	}
+	if name == noSubscription {
+		return "", nil
+	}
+	return name, nil
+}
+
+// cacheKey is the cache key of a user's subscribed plan.
+func cacheKey(userID string) string {
+	return "plan:" + userID
+}
+
+// lookupClaim returns the string at a dotted path in the claims ("" if absent).
+func lookupClaim(claims jwt.MapClaims, path string) string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[part]
+	}
+	name, _ := value.(string)
+	return name
+}
+
+// envOr returns the environment variable name, or fallback if it is unset.
+func envOr(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
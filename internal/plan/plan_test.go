@@ -0,0 +1,181 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/usage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setup gives one test a memory cache and subscription store, and the free and pro plans.
+func setup(t *testing.T) *MemoryStore {
+	t.Helper()
+	originalCache, originalStore := cache.GetClient(), DefaultStore
+	settingsMu.RLock()
+	original := current
+	settingsMu.RUnlock()
+
+	cache.SetDefault(cache.NewMemoryStore())
+	store := NewMemoryStore()
+	SetDefault(store)
+	Configure(map[string]*Plan{
+		"free": {Name: "free", Features: []string{}, DailyRequests: 2},
+		"pro":  {Name: "pro", Features: []string{"export"}, MonthlyRequests: 1000},
+	}, "free", "app_metadata.plan", time.Minute)
+	t.Cleanup(func() {
+		cache.SetDefault(originalCache)
+		SetDefault(originalStore)
+		Configure(original.plans, original.defaultPlan, original.claim, original.cacheTTL)
+	})
+	return store
+}
+
+// authenticate stands in for Auth(): the user and claims come from the query.
+func authenticate(c *fiber.Ctx) error {
+	userID := c.Query("user")
+	claims := jwt.MapClaims{"sub": userID}
+	if claimed := c.Query("claim"); claimed != "" {
+		claims["app_metadata"] = map[string]interface{}{"plan": claimed}
+	}
+	c.Locals("user", userID)
+	c.Locals(middleware.AuthContextKey, &middleware.AuthContext{UserID: userID, Claims: claims})
+	return c.Next()
+}
+
+// TestFor tests the resolution order: subscription, then claim, then the default plan.
+func TestFor(t *testing.T) {
+	store := setup(t)
+	ctx := context.Background()
+	claims := jwt.MapClaims{"app_metadata": map[string]interface{}{"plan": "pro"}}
+
+	p, err := For(ctx, "", "u1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "free", p.Name)
+
+	p, err = For(ctx, "", "u1", claims)
+	require.NoError(t, err)
+	assert.Equal(t, "pro", p.Name)
+
+	// Unknown claimed plans fall back to the default
+	p, err = For(ctx, "", "u1", jwt.MapClaims{"app_metadata": map[string]interface{}{"plan": "gold"}})
+	require.NoError(t, err)
+	assert.Equal(t, "free", p.Name)
+
+	// A granting subscription wins over the claim; the lookup is cached
+	require.NoError(t, store.Save(ctx, Subscription{UserID: "u2", Plan: "pro", Status: StatusActive}))
+	p, err = For(ctx, "", "u2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "pro", p.Name)
+	cached, err := cache.GetClient().Get("plan:u2")
+	require.NoError(t, err)
+	assert.Equal(t, "pro", cached)
+
+	require.NoError(t, store.Save(ctx, Subscription{UserID: "u3", Plan: "pro", Status: StatusCanceled}))
+	p, err = For(ctx, "", "u3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "free", p.Name)
+
+	// Without plans nothing is resolved
+	Configure(nil, "", "app_metadata.plan", time.Minute)
+	p, err = For(ctx, "", "u2", claims)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+}
+
+// TestRequireFeature tests that users on plans without the feature get 402.
+func TestRequireFeature(t *testing.T) {
+	setup(t)
+
+	app := fiber.New()
+	app.Get("/export", authenticate, RequireFeature("export"), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/export?user=u1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusPaymentRequired, resp.StatusCode)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "export", body["feature"])
+	assert.Equal(t, "free", body["plan"])
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/export?user=u1&claim=pro", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+// TestEnforceQuota tests that requests over the plan's daily quota get 429 with a Retry-After.
+func TestEnforceQuota(t *testing.T) {
+	setup(t)
+
+	app := fiber.New()
+	app.Use(usage.Middleware())
+	app.Get("/data", authenticate, EnforceQuota(), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/data?user=u1", nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/data?user=u1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	retryAfter, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	require.NoError(t, err)
+	assert.True(t, retryAfter > 0 && retryAfter <= 86400+1, "Retry-After %d", retryAfter)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, usage.Day, body["period"])
+
+	// Other users and plans without a daily quota are not affected
+	resp, err = app.Test(httptest.NewRequest("GET", "/data?user=u2", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	resp, err = app.Test(httptest.NewRequest("GET", "/data?user=u1&claim=pro", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+// TestLoadSettings tests that PLANS is parsed and checked against DEFAULT_PLAN.
+func TestLoadSettings(t *testing.T) {
+	t.Setenv("PLANS", `{"free": {"daily_requests": 10}, "pro": {"features": ["*"]}}`)
+	t.Setenv("DEFAULT_PLAN", "")
+	s, err := loadSettings()
+	require.NoError(t, err)
+	assert.Equal(t, "free", s.defaultPlan)
+	assert.Equal(t, "pro", s.plans["pro"].Name)
+	assert.True(t, s.plans["pro"].HasFeature("anything"))
+	assert.Equal(t, []string{}, s.plans["free"].Features)
+
+	t.Setenv("DEFAULT_PLAN", "basic")
+	_, err = loadSettings()
+	assert.ErrorContains(t, err, "DEFAULT_PLAN")
+
+	t.Setenv("PLANS", `{"free": {"daily_requests": -1}}`)
+	t.Setenv("DEFAULT_PLAN", "free")
+	_, err = loadSettings()
+	assert.ErrorContains(t, err, "negative")
+
+	t.Setenv("PLANS", `["free"]`)
+	_, err = loadSettings()
+	assert.Error(t, err)
+
+	t.Setenv("PLANS", "")
+	s, err = loadSettings()
+	require.NoError(t, err)
+	assert.Nil(t, s.plans)
+}
@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// PostgRESTStore keeps subscriptions in Postgres through the Supabase REST API (PostgREST).
+// It uses the service role key; users can read their own row but not change it.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/subscriptions
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Get returns the subscription of userID, or nil.
+func (s *PostgRESTStore) Get(ctx context.Context, userID string) (*Subscription, error) {
+	return s.getOne(ctx, "user_id", userID)
+}
+
+// GetByCustomer returns the subscription with the Stripe customer ID, or nil.
+func (s *PostgRESTStore) GetByCustomer(ctx context.Context, customerID string) (*Subscription, error) {
+	return s.getOne(ctx, "stripe_customer_id", customerID)
+}
+
+// getOne returns the row whose column equals value, or nil.
+func (s *PostgRESTStore) getOne(ctx context.Context, column, value string) (*Subscription, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set(column, "eq."+value)
+	params.Set("limit", "1")
+
+	resp, err := s.do(ctx, "GET", s.baseURL+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var rows []Subscription
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// Save upserts the subscription on its user ID.
+func (s *PostgRESTStore) Save(ctx context.Context, subscription Subscription) error {
+	body, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to encode subscription: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("on_conflict", "user_id")
+	resp, err := s.do(ctx, "POST", s.baseURL+"?"+params.Encode(), body, "resolution=merge-duplicates,return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,20 @@
+-- Billing state per user, kept up to date by the Stripe webhook (see internal/plan). Run this in
+-- the Supabase SQL editor.
+
+create table if not exists subscriptions (
+    user_id                text        primary key,   -- Supabase auth user ID (the JWT sub)
+    tenant_id              text        not null default '',
+    plan                   text        not null default '',
+    status                 text        not null default '',  -- Stripe's: active, trialing, past_due, canceled, ...
+    stripe_customer_id     text        unique,
+    stripe_subscription_id text,
+    current_period_end     timestamptz,
+    updated_at             timestamptz not null default now()
+);
+
+-- The backend reads and writes with the service role key. This policy also lets apps read their
+-- own subscription directly through Supabase (e.g. supabase-js); only webhooks change it.
+alter table subscriptions enable row level security;
+
+create policy "Subscriptions are readable by their owner" on subscriptions
+    for select using (auth.uid()::text = user_id);
@@ -0,0 +1,255 @@
+package plan
+
+// Stripe webhook ingestion. Point a Stripe webhook endpoint at POST /webhooks/stripe with the
+// events checkout.session.completed and customer.subscription.created/updated/deleted, and set
+// STRIPE_WEBHOOK_SECRET to its signing secret. Deliveries are verified and deduplicated by
+// internal/webhook, which other packages can also register Stripe event handlers with.
+//
+// Checkout links a Stripe customer to a user: create the Checkout Session with
+// client_reference_id set to the user ID (and metadata.tenant_id for tenant users). Subscriptions
+// can also carry metadata.user_id themselves. A subscription's plan is taken from
+// STRIPE_PRICE_PLANS ("price_123=pro,price_456=team"), else from its price's lookup key when it
+// names a plan, else from metadata.plan.
+//
+// Subscription events for customers that can't be linked to a user yet get 404, so Stripe retries
+// them after the checkout event arrived. Events older than the stored state are ignored, since
+// Stripe does not guarantee delivery order.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/tenant"
+	"boilerplate/internal/webhook"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	stripeMu   sync.RWMutex
+	pricePlans map[string]string // Stripe price ID -> plan name
+)
+
+// initStripe reads STRIPE_WEBHOOK_SECRET and STRIPE_PRICE_PLANS.
+func initStripe() {
+	prices := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("STRIPE_PRICE_PLANS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		price, name, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(price) == "" || strings.TrimSpace(name) == "" {
+			slog.Warn("Ignoring invalid STRIPE_PRICE_PLANS entry, expected price_id=plan", "entry", pair)
+			continue
+		}
+		prices[strings.TrimSpace(price)] = strings.TrimSpace(name)
+	}
+	ConfigureStripe(webhook.SplitList(os.Getenv("STRIPE_WEBHOOK_SECRET")), prices)
+}
+
+// ConfigureStripe sets the webhook signing secrets (several while rotating) and the
+// price-to-plan mapping. No secret disables the webhook. Init calls it from the environment; it
+// is mainly useful in tests.
+func ConfigureStripe(secrets []string, prices map[string]string) {
+	stripeMu.Lock()
+	pricePlans = prices
+	stripeMu.Unlock()
+
+	if len(secrets) == 0 {
+		webhook.Register("stripe", nil)
+		return
+	}
+	webhook.Register("stripe", webhook.Stripe(secrets...))
+}
+
+// stripeEvent is the part of a Stripe event the webhook reads.
+type stripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// checkoutSession is the part of a Checkout Session the webhook reads.
+type checkoutSession struct {
+	ClientReferenceID string            `json:"client_reference_id"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+// stripeSubscription is the part of a Stripe subscription the webhook reads.
+type stripeSubscription struct {
+	ID               string            `json:"id"`
+	Customer         string            `json:"customer"`
+	Status           string            `json:"status"`
+	CurrentPeriodEnd int64             `json:"current_period_end"`
+	Metadata         map[string]string `json:"metadata"`
+	Items            struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"` // Newer API versions set it here
+			Price            struct {
+				ID        string `json:"id"`
+				LookupKey string `json:"lookup_key"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// errUnknownCustomer is returned for subscriptions that can't be linked to a user (yet).
+var errUnknownCustomer = errors.New("unknown customer")
+
+// Registers the events the plans apply; ConfigureStripe registers the provider.
+func init() {
+	for _, eventType := range []string{"checkout.session.completed", "customer.subscription.created",
+		"customer.subscription.updated", "customer.subscription.deleted"} {
+		webhook.Handle("stripe", eventType, handleStripeEvent)
+	}
+}
+
+// handleStripeEvent applies a verified Stripe event.
+func handleStripeEvent(ctx context.Context, delivered webhook.Event) error {
+	var event stripeEvent
+	if err := json.Unmarshal(delivered.Payload, &event); err != nil {
+		return err
+	}
+
+	var err error
+	if event.Type == "checkout.session.completed" {
+		err = applyCheckout(ctx, event)
+	} else {
+		err = applySubscription(ctx, event)
+	}
+	if errors.Is(err, errUnknownCustomer) {
+		// Answered 404 so Stripe retries it after the checkout event arrived
+		return fiber.NewError(fiber.StatusNotFound, "Unknown customer")
+	}
+	return err
+}
+
+// applyCheckout links the session's customer to its user (client_reference_id).
+func applyCheckout(ctx context.Context, event stripeEvent) error {
+	var session checkoutSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return err
+	}
+	if session.ClientReferenceID == "" || session.Customer == "" {
+		slog.Warn("Checkout session without client_reference_id or customer, not linked", "event_id", event.ID)
+		return nil
+	}
+
+	subscription, err := DefaultStore.Get(ctx, session.ClientReferenceID)
+	if err != nil {
+		return err
+	}
+	if subscription == nil {
+		// The plan and status come with the subscription events; UpdatedAt stays zero until then
+		subscription = &Subscription{UserID: session.ClientReferenceID}
+	}
+	subscription.StripeCustomerID = session.Customer
+	if session.Subscription != "" {
+		subscription.StripeSubscriptionID = session.Subscription
+	}
+	if tenantID := session.Metadata["tenant_id"]; tenantID != "" {
+		subscription.TenantID = tenantID
+	}
+	return save(ctx, *subscription)
+}
+
+// applySubscription stores the subscription's plan and status for its user.
+func applySubscription(ctx context.Context, event stripeEvent) error {
+	var object stripeSubscription
+	if err := json.Unmarshal(event.Data.Object, &object); err != nil {
+		return err
+	}
+
+	// Find the user: the subscription's metadata, else the customer linked at checkout
+	existing, err := DefaultStore.GetByCustomer(ctx, object.Customer)
+	if err != nil {
+		return err
+	}
+	userID := object.Metadata["user_id"]
+	if userID != "" && (existing == nil || existing.UserID != userID) {
+		if existing, err = DefaultStore.Get(ctx, userID); err != nil {
+			return err
+		}
+	}
+	if userID == "" {
+		if existing == nil {
+			return errUnknownCustomer
+		}
+		userID = existing.UserID
+	}
+
+	updatedAt := time.Unix(event.Created, 0).UTC()
+	if existing != nil && existing.UpdatedAt.After(updatedAt) {
+		slog.Info("Ignoring out-of-order Stripe event", "event_id", event.ID, "user_id", userID)
+		return nil
+	}
+
+	subscription := Subscription{UserID: userID}
+	if existing != nil {
+		subscription = *existing
+	}
+	if tenantID := object.Metadata["tenant_id"]; tenantID != "" {
+		subscription.TenantID = tenantID
+	}
+	subscription.Plan = planOf(object)
+	subscription.Status = object.Status
+	if event.Type == "customer.subscription.deleted" {
+		subscription.Status = StatusCanceled
+	}
+	subscription.StripeCustomerID = object.Customer
+	subscription.StripeSubscriptionID = object.ID
+	subscription.CurrentPeriodEnd = nil
+	periodEnd := object.CurrentPeriodEnd
+	if periodEnd == 0 && len(object.Items.Data) > 0 {
+		periodEnd = object.Items.Data[0].CurrentPeriodEnd
+	}
+	if periodEnd > 0 {
+		end := time.Unix(periodEnd, 0).UTC()
+		subscription.CurrentPeriodEnd = &end
+	}
+	subscription.UpdatedAt = updatedAt
+	return save(ctx, subscription)
+}
+
+// planOf returns the plan of a Stripe subscription ("" if none can be found).
+func planOf(object stripeSubscription) string {
+	stripeMu.RLock()
+	prices := pricePlans
+	stripeMu.RUnlock()
+
+	for _, item := range object.Items.Data {
+		if name, ok := prices[item.Price.ID]; ok {
+			return name
+		}
+	}
+	for _, item := range object.Items.Data {
+		if _, err := Get(item.Price.LookupKey); err == nil {
+			return item.Price.LookupKey
+		}
+	}
+	return object.Metadata["plan"]
+}
+
+// save stores the subscription and drops the user's cached plan.
+func save(ctx context.Context, subscription Subscription) error {
+	if err := DefaultStore.Save(ctx, subscription); err != nil {
+		return err
+	}
+	if store := tenant.CacheFor(subscription.TenantID); store != nil {
+		if err := store.Del(cacheKey(subscription.UserID)); err != nil {
+			slog.Warn("Failed to drop cached plan", "user_id", subscription.UserID, "error", err)
+		}
+	}
+	return nil
+}
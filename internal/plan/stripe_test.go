@@ -0,0 +1,117 @@
+package plan
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "whsec_test"
+
+// setupStripe configures the webhook, deduplicating in memory, and returns an app serving it.
+func setupStripe(t *testing.T) *fiber.App {
+	t.Helper()
+	ConfigureStripe([]string{testSecret}, map[string]string{"price_pro": "pro"})
+	webhook.Configure(cache.NewMemoryStore(), time.Hour)
+	t.Cleanup(func() {
+		ConfigureStripe(nil, nil)
+		webhook.Configure(nil, 0)
+	})
+
+	app := fiber.New()
+	app.Post("/webhooks/:provider", webhook.Receive)
+	return app
+}
+
+// deliver posts a signed event and returns the response status.
+func deliver(t *testing.T, app *fiber.App, body string) int {
+	t.Helper()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest("POST", "/webhooks/stripe", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", "t="+timestamp+",v1="+webhook.SignStripe([]byte(body), timestamp, testSecret))
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+// TestStripeWebhookHandler tests that checkout links the customer and subscription events set
+// the plan, drop the cached plan and ignore out-of-order deliveries.
+func TestStripeWebhookHandler(t *testing.T) {
+	store := setup(t)
+	app := setupStripe(t)
+	ctx := context.Background()
+
+	// Unsigned requests are rejected
+	resp, err := app.Test(httptest.NewRequest("POST", "/webhooks/stripe", strings.NewReader(`{}`)))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	// The subscription can't be linked before checkout: Stripe should retry
+	subscriptionEvent := `{"id":"evt_2","type":"customer.subscription.created","created":1799999990,
+		"data":{"object":{"id":"sub_1","customer":"cus_1","status":"active","current_period_end":1802592000,
+		"items":{"data":[{"price":{"id":"price_pro"}}]}}}}`
+	assert.Equal(t, fiber.StatusNotFound, deliver(t, app, subscriptionEvent))
+
+	assert.Equal(t, fiber.StatusOK, deliver(t, app, `{"id":"evt_1","type":"checkout.session.completed","created":1799999995,
+		"data":{"object":{"client_reference_id":"u1","customer":"cus_1","subscription":"sub_1"}}}`))
+
+	// The user is on free and it is cached until the subscription arrives
+	p, err := For(ctx, "", "u1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "free", p.Name)
+
+	assert.Equal(t, fiber.StatusOK, deliver(t, app, subscriptionEvent))
+	subscription, err := store.Get(ctx, "u1")
+	require.NoError(t, err)
+	require.NotNil(t, subscription)
+	assert.Equal(t, "pro", subscription.Plan)
+	assert.Equal(t, StatusActive, subscription.Status)
+	require.NotNil(t, subscription.CurrentPeriodEnd)
+	assert.Equal(t, int64(1802592000), subscription.CurrentPeriodEnd.Unix())
+	cached, err := cache.GetClient().Get("plan:u1")
+	require.NoError(t, err)
+	assert.Empty(t, cached)
+
+	p, err = For(ctx, "", "u1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "pro", p.Name)
+
+	// Cancelling takes the plan away; an older update delivered late doesn't restore it
+	assert.Equal(t, fiber.StatusOK, deliver(t, app, `{"id":"evt_4","type":"customer.subscription.deleted","created":1800000000,
+		"data":{"object":{"id":"sub_1","customer":"cus_1","status":"canceled","items":{"data":[{"price":{"id":"price_pro"}}]}}}}`))
+	assert.Equal(t, fiber.StatusOK, deliver(t, app, `{"id":"evt_3","type":"customer.subscription.updated","created":1799999998,
+		"data":{"object":{"id":"sub_1","customer":"cus_1","status":"active","items":{"data":[{"price":{"id":"price_pro"}}]}}}}`))
+	subscription, err = store.Get(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCanceled, subscription.Status)
+
+	p, err = For(ctx, "", "u1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "free", p.Name)
+}
+
+// TestStripeWebhook_Rotation tests that STRIPE_WEBHOOK_SECRET takes a comma-separated list, so
+// deliveries signed with either secret are accepted while rotating.
+func TestStripeWebhook_Rotation(t *testing.T) {
+	app := setupStripe(t)
+	event := `{"id":"evt_r","type":"invoice.paid","created":1800000000}`
+
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_old, "+testSecret)
+	initStripe()
+	assert.Equal(t, fiber.StatusOK, deliver(t, app, event))
+
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_old")
+	initStripe()
+	assert.Equal(t, fiber.StatusBadRequest, deliver(t, app, event))
+}
@@ -0,0 +1,251 @@
+package preferences
+
+// Package preferences is a typed settings API on top of the profile's preferences object: a
+// schema of allowed keys, each with a type and a default, that every write is checked against.
+//
+// Values are stored in the profiles table (profiles.preferences) and read through the profile
+// cache, so a read costs no more than GET /api/profile. Users only store what they changed;
+// everything else resolves to the schema default, so changing a default reaches every user who
+// never picked a value. Apps add their own settings with Register.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"boilerplate/internal/price"
+	"boilerplate/internal/profile"
+)
+
+// Kind is the JSON type of a setting's value.
+type Kind string
+
+// Setting kinds.
+const (
+	KindString  Kind = "string"
+	KindBoolean Kind = "boolean"
+	KindNumber  Kind = "number"
+)
+
+// Setting describes one allowed preference key.
+type Setting struct {
+	Key         string      `json:"key"`  // e.g. "theme" or "notifications.email"
+	Kind        Kind        `json:"type"` // JSON type of the value
+	Default     interface{} `json:"default"`
+	Allowed     []string    `json:"allowed,omitempty"` // Strings only: the accepted values (empty: any)
+	Pattern     string      `json:"pattern,omitempty"` // Strings only: a regexp the value must match
+	Min         *float64    `json:"min,omitempty"`     // Numbers only
+	Max         *float64    `json:"max,omitempty"`     // Numbers only
+	Description string      `json:"description"`
+
+	// DefaultFunc, if set, computes Default on every read, for defaults that come from the
+	// environment (which isn't loaded yet when settings are registered at init).
+	DefaultFunc func() interface{} `json:"-"`
+
+	pattern *regexp.Regexp // Compiled Pattern
+}
+
+// keyPattern restricts keys to lowercase words separated by dots or underscores.
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z][a-z0-9_]*)*$`)
+
+var (
+	// registry holds the schema, by key.
+	registry   = map[string]*Setting{}
+	registryMu sync.RWMutex
+)
+
+// Built-in settings.
+func init() {
+	for _, setting := range []Setting{
+		{Key: "theme", Kind: KindString, Default: "system", Allowed: []string{"light", "dark", "system"}, Description: "Color scheme"},
+		{Key: "currency", Kind: KindString, DefaultFunc: func() interface{} { return price.Currency() }, Pattern: `^[A-Z]{3}$`, Description: "Currency prices are shown in (ISO 4217)"},
+		{Key: "locale", Kind: KindString, DefaultFunc: func() interface{} { return price.DefaultLocale() }, Pattern: `^[a-z]{2}(-[A-Z]{2})?$`, Description: "Language of emails, e.g. en-US or de"},
+		{Key: "notifications.email", Kind: KindBoolean, Default: true, Description: "Receive emails (account and price alerts)"},
+		{Key: "notifications.push", Kind: KindBoolean, Default: true, Description: "Receive push notifications"},
+		{Key: "notifications.price_alerts", Kind: KindBoolean, Default: true, Description: "Be notified when a followed artist's price moves"},
+		{Key: "notifications.ws", Kind: KindBoolean, Default: true, Description: "Receive notifications in open apps (WebSocket)"},
+		{Key: "notifications.email_frequency", Kind: KindString, Default: "daily", Allowed: []string{"immediate", "daily"}, Description: "Email low-priority notifications right away or in a daily digest"},
+	} {
+		if err := Register(setting); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds a setting to the schema, replacing any setting with the same key.
+//
+// Example: preferences.Register(preferences.Setting{Key: "compact_mode", Kind: preferences.KindBoolean, Default: false})
+func Register(setting Setting) error {
+	if !keyPattern.MatchString(setting.Key) {
+		return fmt.Errorf("invalid preference key %q", setting.Key)
+	}
+	switch setting.Kind {
+	case KindString, KindBoolean, KindNumber:
+	default:
+		return fmt.Errorf("preference %s: unknown type %q", setting.Key, setting.Kind)
+	}
+	if setting.Pattern != "" {
+		compiled, err := regexp.Compile(setting.Pattern)
+		if err != nil {
+			return fmt.Errorf("preference %s: invalid pattern: %w", setting.Key, err)
+		}
+		setting.pattern = compiled
+	}
+	if err := setting.check(setting.defaultValue()); err != nil {
+		return fmt.Errorf("preference %s: invalid default: %w", setting.Key, err)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[setting.Key] = &setting
+	return nil
+}
+
+// Schema returns every setting, sorted by key.
+func Schema() []Setting {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	settings := make([]Setting, 0, len(registry))
+	for _, setting := range registry {
+		copied := *setting
+		copied.Default = setting.defaultValue()
+		settings = append(settings, copied)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// Validate checks values against the schema. A nil value means "reset to the default" and is
+// always valid. Errors are *profile.ValidationError with the key as the field.
+func Validate(values map[string]interface{}) error {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	// Sorted so the reported key doesn't depend on map order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		setting, ok := registry[key]
+		if !ok {
+			return &profile.ValidationError{Field: key, Message: "is not a known preference"}
+		}
+		if values[key] == nil {
+			continue
+		}
+		if err := setting.check(values[key]); err != nil {
+			return &profile.ValidationError{Field: key, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+// Get returns every preference of userID: the stored value, or the default for settings the user
+// never changed (or whose stored value no longer fits the schema).
+func Get(ctx context.Context, tenantID, userID string) (map[string]interface{}, error) {
+	stored, err := profile.Get(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(stored.Preferences), nil
+}
+
+// Set validates changes and saves them, keeping the other preferences. A nil value resets the
+// setting to its default. Returns every preference after the change.
+func Set(ctx context.Context, tenantID, userID string, changes map[string]interface{}) (map[string]interface{}, error) {
+	if err := Validate(changes); err != nil {
+		return nil, err
+	}
+
+	updated, err := profile.MergePreferences(ctx, tenantID, userID, changes)
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(updated.Preferences), nil
+}
+
+// Resolve returns the preferences in a stored object: defaults fill in missing or invalid values,
+// and keys outside the schema are dropped.
+func Resolve(stored map[string]interface{}) map[string]interface{} {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	resolved := make(map[string]interface{}, len(registry))
+	for key, setting := range registry {
+		value, ok := stored[key]
+		if !ok || value == nil || setting.check(value) != nil {
+			value = setting.defaultValue()
+		}
+		resolved[key] = value
+	}
+	return resolved
+}
+
+// defaultValue returns the setting's default.
+func (s *Setting) defaultValue() interface{} {
+	if s.DefaultFunc != nil {
+		return s.DefaultFunc()
+	}
+	return s.Default
+}
+
+// check returns an error describing why value doesn't fit the setting.
+func (s *Setting) check(value interface{}) error {
+	switch s.Kind {
+	case KindString:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		if len(s.Allowed) > 0 && !contains(s.Allowed, text) {
+			return fmt.Errorf("must be one of %s", strings.Join(s.Allowed, ", "))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(text) {
+			return fmt.Errorf("must match %s", s.Pattern)
+		}
+	case KindBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be true or false")
+		}
+	case KindNumber:
+		number, ok := toFloat(value)
+		if !ok {
+			return fmt.Errorf("must be a number")
+		}
+		if s.Min != nil && number < *s.Min {
+			return fmt.Errorf("must be at least %v", *s.Min)
+		}
+		if s.Max != nil && number > *s.Max {
+			return fmt.Errorf("must be at most %v", *s.Max)
+		}
+	}
+	return nil
+}
+
+// toFloat accepts JSON numbers (float64) and the integer literals used for defaults in code.
+func toFloat(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	default:
+		return 0, false
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
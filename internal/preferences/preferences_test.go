@@ -0,0 +1,111 @@
+package preferences
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/profile"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTest swaps in a memory profile store and cache.
+func setupTest(t *testing.T) *profile.MemoryStore {
+	t.Helper()
+
+	originalStore, originalCache := profile.DefaultStore, cache.GetClient()
+	t.Cleanup(func() {
+		profile.SetDefault(originalStore)
+		cache.SetDefault(originalCache)
+	})
+
+	store := profile.NewMemoryStore()
+	profile.SetDefault(store)
+	cache.SetDefault(cache.NewMemoryStore())
+	return store
+}
+
+// TestValidate tests the type, enum and pattern checks, and that null (reset) is always valid.
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		values map[string]interface{}
+		field  string // "" if valid
+	}{
+		"valid":         {map[string]interface{}{"theme": "dark", "currency": "EUR", "notifications.email": false}, ""},
+		"reset":         {map[string]interface{}{"theme": nil}, ""},
+		"unknown key":   {map[string]interface{}{"font": "serif"}, "font"},
+		"wrong type":    {map[string]interface{}{"notifications.push": "yes"}, "notifications.push"},
+		"not allowed":   {map[string]interface{}{"theme": "neon"}, "theme"},
+		"pattern":       {map[string]interface{}{"currency": "euro"}, "currency"},
+		"first by name": {map[string]interface{}{"theme": 1, "currency": 1}, "currency"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := Validate(tc.values)
+			if tc.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var invalid *profile.ValidationError
+			require.True(t, errors.As(err, &invalid))
+			assert.Equal(t, tc.field, invalid.Field)
+		})
+	}
+}
+
+// TestSetAndGet tests defaults, merging with stored values, resets, and that stored values which
+// no longer fit the schema fall back to the default.
+func TestSetAndGet(t *testing.T) {
+	store := setupTest(t)
+	t.Setenv("PRICE_CURRENCY", "EUR")
+	ctx := context.Background()
+
+	values, err := Get(ctx, "", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "system", values["theme"])
+	assert.Equal(t, "EUR", values["currency"]) // Default read from the environment
+	assert.Equal(t, true, values["notifications.email"])
+
+	_, err = Set(ctx, "", "u1", map[string]interface{}{"theme": "dark"})
+	require.NoError(t, err)
+	values, err = Set(ctx, "", "u1", map[string]interface{}{"notifications.email": false})
+	require.NoError(t, err)
+	assert.Equal(t, "dark", values["theme"])
+	assert.Equal(t, false, values["notifications.email"])
+
+	values, err = Set(ctx, "", "u1", map[string]interface{}{"theme": nil})
+	require.NoError(t, err)
+	assert.Equal(t, "system", values["theme"])
+
+	// Written behind the schema's back (e.g. an old client through PUT /api/profile)
+	require.NoError(t, store.Upsert(ctx, &profile.Profile{UserID: "u2", Preferences: map[string]interface{}{"theme": "neon", "legacy": 1}, Version: 1}, 0))
+	values, err = Get(ctx, "", "u2")
+	require.NoError(t, err)
+	assert.Equal(t, "system", values["theme"])
+	assert.NotContains(t, values, "legacy")
+
+	_, err = Set(ctx, "", "u1", map[string]interface{}{"theme": "neon"})
+	var invalid *profile.ValidationError
+	assert.True(t, errors.As(err, &invalid))
+}
+
+// TestRegister tests custom settings, including number bounds and rejected definitions.
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "chart.days")
+		registryMu.Unlock()
+	})
+
+	low, high := 1.0, 365.0
+	require.NoError(t, Register(Setting{Key: "chart.days", Kind: KindNumber, Default: 30, Min: &low, Max: &high}))
+	assert.NoError(t, Validate(map[string]interface{}{"chart.days": 90.0}))
+	assert.Error(t, Validate(map[string]interface{}{"chart.days": 0.0}))
+
+	assert.Error(t, Register(Setting{Key: "Chart Days", Kind: KindNumber, Default: 30}))
+	assert.Error(t, Register(Setting{Key: "chart.kind", Kind: "date", Default: "x"}))
+	assert.Error(t, Register(Setting{Key: "chart.kind", Kind: KindString, Default: "pie", Allowed: []string{"line"}}))
+}
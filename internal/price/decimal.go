@@ -0,0 +1,55 @@
+package price
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Scale is the number of decimal places prices are kept to. Prices are rounded (half away from
+// zero) to Scale when they enter the system, so arithmetic and serialization stay exact.
+const Scale = 4
+
+// Parse converts a price from a database record, a JSON document or the cache to a decimal.
+// It accepts json.Number (decode with UseNumber to keep every digit), numeric strings
+// (Postgres numeric columns may arrive as strings), float64 and integers.
+func Parse(value interface{}) (decimal.Decimal, error) {
+	var (
+		amount decimal.Decimal
+		err    error
+	)
+
+	switch v := value.(type) {
+	case json.Number:
+		amount, err = decimal.NewFromString(v.String())
+	case string:
+		amount, err = decimal.NewFromString(strings.TrimSpace(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return decimal.Decimal{}, fmt.Errorf("invalid price %v", v)
+		}
+		amount = decimal.NewFromFloat(v) // Shortest representation: 45.67, not 45.670000000000002
+	case float32:
+		amount = decimal.NewFromFloat32(v)
+	case int:
+		amount = decimal.NewFromInt(int64(v))
+	case int64:
+		amount = decimal.NewFromInt(v)
+	default:
+		return decimal.Decimal{}, fmt.Errorf("unsupported price type %T", value)
+	}
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("invalid price %v: %w", value, err)
+	}
+
+	return amount.Round(Scale), nil
+}
+
+// String returns the canonical string form of a price: at most Scale decimals, no trailing
+// zeros, no exponent (e.g. "45.67"). This is what the cache stores.
+func String(amount decimal.Decimal) string {
+	return amount.Round(Scale).String()
+}
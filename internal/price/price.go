@@ -0,0 +1,267 @@
+package price
+
+// Package price builds display metadata for prices: the currency code, its decimal precision and
+// a display string formatted for the client's locale (e.g. "1.234,50 €" for de-DE), so thin
+// clients (watch apps, widgets) can show prices without their own formatting logic.
+//
+// Metadata is opt-in: clients ask for it with ?price_meta=true on price-bearing endpoints
+// (GraphQL currentPrice, the /ws handshake). The locale is resolved from ?locale=, then the
+// Accept-Language header, then PRICE_DEFAULT_LOCALE (default en-US). Prices are stored in a
+// single currency, PRICE_CURRENCY (default USD); the locale only changes how they are written,
+// never the amount.
+//
+// Amounts are decimals (shopspring/decimal), never float64: see Parse and String in decimal.go.
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+)
+
+// Meta is the display metadata sent alongside a price.
+type Meta struct {
+	Currency  string `json:"currency"`  // ISO 4217 code, e.g. "EUR"
+	Precision int    `json:"precision"` // Digits after the decimal separator
+	Amount    string `json:"amount"`    // Exact amount at Precision, e.g. "1234.50"
+	Display   string `json:"display"`   // Ready to show, e.g. "1.234,50 €"
+	Locale    string `json:"locale"`    // The locale used for Display
+}
+
+// Format formats prices in one currency for one locale.
+type Format struct {
+	Currency string
+	Locale   string
+}
+
+// localeFormat describes how a locale writes amounts.
+type localeFormat struct {
+	decimal     string // Decimal separator
+	group       string // Thousands separator
+	symbolAfter bool   // "1,50 €" rather than "€1.50"
+	space       bool   // Space between the amount and the symbol
+}
+
+// locales are the supported locales. A bare language ("de") uses the first listed region.
+var locales = map[string]localeFormat{
+	"en-US": {decimal: ".", group: ","},
+	"en-GB": {decimal: ".", group: ","},
+	"de-DE": {decimal: ",", group: ".", symbolAfter: true, space: true},
+	"fr-FR": {decimal: ",", group: "\u202f", symbolAfter: true, space: true},
+	"es-ES": {decimal: ",", group: ".", symbolAfter: true, space: true},
+	"it-IT": {decimal: ",", group: ".", symbolAfter: true, space: true},
+	"nl-NL": {decimal: ",", group: ".", space: true},
+	"pt-BR": {decimal: ",", group: ".", space: true},
+	"ja-JP": {decimal: ".", group: ","},
+}
+
+// languageDefaults maps a bare language to its default locale.
+var languageDefaults = map[string]string{
+	"en": "en-US",
+	"de": "de-DE",
+	"fr": "fr-FR",
+	"es": "es-ES",
+	"it": "it-IT",
+	"nl": "nl-NL",
+	"pt": "pt-BR",
+	"ja": "ja-JP",
+}
+
+// currency is a currency's symbol and minor unit digits.
+type currency struct {
+	symbol    string
+	precision int
+}
+
+// currencies are the known currencies. Unknown codes are written with the code as symbol
+// and two decimals.
+var currencies = map[string]currency{
+	"USD": {symbol: "$", precision: 2},
+	"EUR": {symbol: "€", precision: 2},
+	"GBP": {symbol: "£", precision: 2},
+	"JPY": {symbol: "¥", precision: 0},
+	"BRL": {symbol: "R$", precision: 2},
+	"CHF": {symbol: "CHF", precision: 2},
+	"INR": {symbol: "₹", precision: 2},
+}
+
+// defaultLocale and defaultCurrency are used when nothing else is configured.
+const (
+	defaultLocale   = "en-US"
+	defaultCurrency = "USD"
+)
+
+// Currency returns PRICE_CURRENCY (the currency prices are stored in), defaulting to USD.
+func Currency() string {
+	if code := strings.ToUpper(strings.TrimSpace(os.Getenv("PRICE_CURRENCY"))); code != "" {
+		return code
+	}
+	return defaultCurrency
+}
+
+// DefaultLocale returns PRICE_DEFAULT_LOCALE if it is supported, else en-US.
+func DefaultLocale() string {
+	if raw := os.Getenv("PRICE_DEFAULT_LOCALE"); raw != "" {
+		if locale, ok := Match(raw); ok {
+			return locale
+		}
+		log.Printf("WARNING: Unsupported PRICE_DEFAULT_LOCALE %q, using %s", raw, defaultLocale)
+	}
+	return defaultLocale
+}
+
+// Match returns the supported locale for a tag ("de-de", "de_DE", "de-AT" and "de" all
+// match de-DE). ok is false if neither the tag nor its language is supported.
+func Match(tag string) (string, bool) {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return "", false
+	}
+
+	language, region, _ := strings.Cut(tag, "-")
+	language = strings.ToLower(language)
+	if region != "" {
+		candidate := language + "-" + strings.ToUpper(region)
+		if _, ok := locales[candidate]; ok {
+			return candidate, true
+		}
+	}
+	if locale, ok := languageDefaults[language]; ok {
+		return locale, true
+	}
+	return "", false
+}
+
+// Requested reports whether the client asked for price metadata (?price_meta=true).
+func Requested(c *fiber.Ctx) bool {
+	return c.QueryBool("price_meta", false)
+}
+
+// FromRequest returns the client's format if it asked for price metadata, or nil.
+func FromRequest(c *fiber.Ctx) *Format {
+	if !Requested(c) {
+		return nil
+	}
+	return &Format{Currency: Currency(), Locale: ResolveLocale(c)}
+}
+
+// ResolveLocale picks the locale for a request: ?locale=, then Accept-Language (by quality),
+// then the default locale.
+func ResolveLocale(c *fiber.Ctx) string {
+	if locale, ok := Match(c.Query("locale")); ok {
+		return locale
+	}
+	if locale, ok := fromAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage)); ok {
+		return locale
+	}
+	return DefaultLocale()
+}
+
+// fromAcceptLanguage returns the highest-quality supported locale in an Accept-Language header.
+func fromAcceptLanguage(header string) (string, bool) {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if tag != "" && tag != "*" && quality > 0 {
+			candidates = append(candidates, candidate{tag: tag, quality: quality})
+		}
+	}
+
+	// Highest quality first; equal qualities keep the client's order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	for _, c := range candidates {
+		if locale, ok := Match(c.tag); ok {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// Describe returns the metadata for amount in this format.
+func (f *Format) Describe(amount decimal.Decimal) Meta {
+	cur, ok := currencies[f.Currency]
+	if !ok {
+		cur = currency{symbol: f.Currency, precision: 2}
+	}
+
+	locale, ok := Match(f.Locale)
+	if !ok {
+		locale = defaultLocale
+	}
+
+	return Meta{
+		Currency:  f.Currency,
+		Precision: cur.precision,
+		Amount:    amount.StringFixed(int32(cur.precision)),
+		Display:   display(amount, cur, locales[locale]),
+		Locale:    locale,
+	}
+}
+
+// display writes amount with the currency symbol the way the locale does.
+func display(amount decimal.Decimal, cur currency, lf localeFormat) string {
+	// StringFixed rounds half away from zero, as people expect for money
+	formatted := amount.Abs().StringFixed(int32(cur.precision))
+	negative := amount.IsNegative() && !amount.Round(int32(cur.precision)).IsZero()
+
+	whole, fraction, _ := strings.Cut(formatted, ".")
+	number := groupThousands(whole, lf.group)
+	if fraction != "" {
+		number += lf.decimal + fraction
+	}
+
+	separator := ""
+	if lf.space {
+		separator = "\u00a0" // Non-breaking, so the symbol never wraps onto its own line
+	}
+
+	var result string
+	if lf.symbolAfter {
+		result = number + separator + cur.symbol
+	} else {
+		result = cur.symbol + separator + number
+	}
+
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
+
+// groupThousands inserts separator between groups of three digits.
+func groupThousands(digits, separator string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(separator)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package price
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFormat_Describe tests display strings across locales and currencies.
+func TestFormat_Describe(t *testing.T) {
+	tests := []struct {
+		currency, locale string
+		amount           float64
+		want             string
+		precision        int
+	}{
+		{"USD", "en-US", 1234.5, "$1,234.50", 2},
+		{"USD", "en-US", 0.125, "$0.13", 2},
+		{"EUR", "de-DE", 1234.5, "1.234,50 €", 2},
+		{"EUR", "fr-FR", 1234567.891, "1 234 567,89 €", 2},
+		{"EUR", "nl-NL", 45.67, "€ 45,67", 2},
+		{"JPY", "ja-JP", 1234.5, "¥1,235", 0}, // No minor unit
+		{"USD", "en-US", -3.5, "-$3.50", 2},
+		{"USD", "en-US", -0.001, "$0.00", 2}, // No "-$0.00"
+		{"XYZ", "en-US", 1, "XYZ1.00", 2},    // Unknown currency: code as symbol
+		{"USD", "zz-ZZ", 1, "$1.00", 2},      // Unknown locale: default
+	}
+
+	for _, tt := range tests {
+		meta := (&Format{Currency: tt.currency, Locale: tt.locale}).Describe(decimal.NewFromFloat(tt.amount))
+		assert.Equal(t, tt.want, meta.Display, "%s %s %v", tt.currency, tt.locale, tt.amount)
+		assert.Equal(t, tt.precision, meta.Precision)
+		assert.Equal(t, tt.currency, meta.Currency)
+	}
+}
+
+// TestMatch tests locale tag normalization and language fallback.
+func TestMatch(t *testing.T) {
+	for tag, want := range map[string]string{"de-de": "de-DE", "de_DE": "de-DE", "de-AT": "de-DE", "de": "de-DE", "EN-gb": "en-GB"} {
+		locale, ok := Match(tag)
+		assert.True(t, ok, tag)
+		assert.Equal(t, want, locale, tag)
+	}
+
+	_, ok := Match("zz")
+	assert.False(t, ok)
+}
+
+// TestFromRequest tests opt-in and locale resolution order.
+func TestFromRequest(t *testing.T) {
+	t.Setenv("PRICE_CURRENCY", "eur")
+	t.Setenv("PRICE_DEFAULT_LOCALE", "")
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		format := FromRequest(c)
+		if format == nil {
+			return c.SendString("none")
+		}
+		return c.SendString(format.Currency + " " + format.Locale)
+	})
+
+	get := func(path, acceptLanguage string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return string(body[:n])
+	}
+
+	assert.Equal(t, "none", get("/", "de-DE"))
+	assert.Equal(t, "EUR en-US", get("/?price_meta=true", ""))
+	assert.Equal(t, "EUR fr-FR", get("/?price_meta=true", "zz, de;q=0.5, fr-CA;q=0.8"))
+	assert.Equal(t, "EUR it-IT", get("/?price_meta=true&locale=it", "fr-FR"))
+}
+
+// TestParse tests exact parsing from every supported source type.
+func TestParse(t *testing.T) {
+	for _, value := range []interface{}{json.Number("45.67"), "45.67", " 45.67 ", 45.67, json.Number("45.670000000000002")} {
+		amount, err := Parse(value)
+		require.NoError(t, err, "%v", value)
+		assert.Equal(t, "45.67", String(amount), "%v", value)
+	}
+
+	amount, err := Parse(int64(3))
+	require.NoError(t, err)
+	assert.Equal(t, "3", String(amount))
+
+	// Rounded to Scale, half away from zero
+	amount, err = Parse("0.00005")
+	require.NoError(t, err)
+	assert.Equal(t, "0.0001", String(amount))
+
+	for _, value := range []interface{}{"x", true, nil, math.NaN()} {
+		_, err := Parse(value)
+		assert.Error(t, err, "%v", value)
+	}
+}
@@ -0,0 +1,57 @@
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// MemoryStore keeps profiles in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	profiles map[string]*Profile
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{profiles: make(map[string]*Profile)}
+}
+
+// Get returns a copy of the profile of userID, or nil.
+func (m *MemoryStore) Get(ctx context.Context, userID string) (*Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.profiles[userID]
+	if !ok {
+		return nil, nil
+	}
+	return clone(stored), nil
+}
+
+// Upsert stores a copy of the profile if the stored one is still at version.
+func (m *MemoryStore) Upsert(ctx context.Context, profile *Profile, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := 0
+	if stored, ok := m.profiles[profile.UserID]; ok {
+		current = stored.Version
+	}
+	if current != version {
+		return ErrConflict
+	}
+	m.profiles[profile.UserID] = clone(profile)
+	return nil
+}
+
+// clone deep-copies a profile, so callers can't modify stored preferences.
+func clone(profile *Profile) *Profile {
+	copied := *profile
+	if encoded, err := json.Marshal(profile.Preferences); err == nil {
+		copied.Preferences = nil
+		json.Unmarshal(encoded, &copied.Preferences)
+	}
+	return &copied
+}
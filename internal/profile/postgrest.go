@@ -0,0 +1,144 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// tableName is the Postgres table holding profiles (see schema.sql).
+const tableName = "profiles"
+
+// PostgRESTStore keeps profiles in Postgres through the Supabase REST API (PostgREST).
+// It uses the service role key; the table's RLS policies only matter to clients that query
+// Supabase directly.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/profiles
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Get returns the profile of userID, or nil.
+func (s *PostgRESTStore) Get(ctx context.Context, userID string) (*Profile, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("user_id", "eq."+userID)
+
+	resp, err := s.do(ctx, "GET", s.baseURL+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	profiles := make([]*Profile, 0, 1)
+	if err := json.NewDecoder(resp.Body).Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	return profiles[0], nil
+}
+
+// Upsert inserts the profile (version 0), or replaces it where the row is still at version.
+// The version check is part of the statement, so it holds against concurrent writers.
+func (s *PostgRESTStore) Upsert(ctx context.Context, profile *Profile, version int) error {
+	body, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	// A first write is a plain insert: if another one created the row first, the primary key
+	// rejects it with 409
+	if version == 0 {
+		resp, err := s.do(ctx, "POST", s.baseURL, body, "return=minimal")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// Later writes only update the row at the expected version; ask for the matched rows back to
+	// know whether it still was
+	params := url.Values{}
+	params.Set("user_id", "eq."+profile.UserID)
+	params.Set("version", "eq."+strconv.Itoa(version))
+	params.Set("select", "user_id")
+	resp, err := s.do(ctx, "PATCH", s.baseURL+"?"+params.Encode(), body, "return=representation")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var updated []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		return fmt.Errorf("failed to parse updated profiles: %w", err)
+	}
+	if len(updated) == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrConflict, string(respBody))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
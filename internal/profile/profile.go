@@ -0,0 +1,412 @@
+package profile
+
+// Package profile manages user profiles: display name, avatar and free-form preferences, one
+// row per user in the profiles table (see schema.sql), keyed by the Supabase user ID.
+//
+// Users without a row get an empty profile; the row is created on their first update. Reads are
+// cached per user (PROFILE_CACHE_TTL, scoped to the tenant) and invalidated on every write.
+// Avatars are uploaded to the storage subsystem (see internal/storage) and the profile keeps
+// their public URL.
+//
+// Every write increments the profile's version and only succeeds if the stored version is still
+// the one it read (optimistic locking), so two devices editing at once can't silently overwrite
+// each other. Clients get the version as an ETag and can send it back in If-Match to have their
+// update rejected with a *ConflictError if someone else wrote in between.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"boilerplate/internal/events"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/storage"
+	"boilerplate/internal/tenant"
+)
+
+// Validation limits.
+const (
+	MaxDisplayNameLength = 50      // Characters
+	MaxPreferencesSize   = 4096    // Bytes of encoded JSON
+	MaxAvatarSize        = 2 << 20 // 2 MB
+)
+
+// avatarTypes are the accepted avatar content types and their file extensions.
+var avatarTypes = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/webp": "webp",
+	"image/gif":  "gif",
+}
+
+// Profile is a user's profile.
+type Profile struct {
+	UserID      string                 `json:"user_id"`
+	TenantID    string                 `json:"tenant_id,omitempty"`
+	DisplayName string                 `json:"display_name"`
+	AvatarURL   string                 `json:"avatar_url"`
+	Preferences map[string]interface{} `json:"preferences"`
+	UpdatedAt   *time.Time             `json:"updated_at,omitempty"` // nil until the first update
+	Version     int                    `json:"version"`              // Incremented on every write; 0 until the first
+}
+
+// AnyVersion is passed as the expected version to write whatever the current version is.
+const AnyVersion = -1
+
+// maxAttempts is how many times a write without an expected version is retried when another
+// write gets in first.
+const maxAttempts = 3
+
+// Update is a partial update (PUT /api/profile): nil fields are left unchanged.
+// Preferences replace the stored object as a whole.
+type Update struct {
+	DisplayName *string                `json:"display_name"`
+	Preferences map[string]interface{} `json:"preferences"`
+}
+
+// Store persists profiles.
+type Store interface {
+	// Get returns the profile of userID, or nil if the user has none yet.
+	Get(ctx context.Context, userID string) (*Profile, error)
+
+	// Upsert creates or replaces the profile of profile.UserID, if its stored version is still
+	// version (0: the user has no profile yet). Otherwise it returns ErrConflict and writes nothing.
+	Upsert(ctx context.Context, profile *Profile, version int) error
+}
+
+// ValidationError is a rejected update, reported to the client with the offending field.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ConflictError is an update rejected because the profile changed since the version the client
+// read. Current is the profile as it is now, for the client to merge and retry.
+type ConflictError struct {
+	Current *Profile
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("profile has changed (now version %d)", e.Current.Version)
+}
+
+var (
+	// DefaultStore is the store used by the package functions.
+	// It is nil until Init() or SetDefault() is called.
+	DefaultStore Store
+
+	// ErrNotConfigured is returned when the store is not initialized.
+	ErrNotConfigured = errors.New("profile store not initialized")
+
+	// ErrConflict is returned by Store.Upsert when the stored version is not the expected one.
+	ErrConflict = errors.New("profile was modified concurrently")
+
+	// now is the clock used for UpdatedAt (overridable in tests).
+	now = time.Now
+)
+
+// Init initializes the default store.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, profiles are stored in the profiles table
+// (see schema.sql), which is also registered for GDPR erasure and export. Otherwise they are kept
+// in memory and lost on restart.
+func Init() {
+	// Cached profiles are deleted on erasure in both modes
+	gdpr.RegisterCacheKey(cacheKey("{user_id}"))
+
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if supabaseURL == "" || serviceKey == "" {
+		log.Println("WARNING: SUPABASE_SERVICE_ROLE_KEY not set, profiles are kept in memory only")
+		startup.Report("profiles", true, "in memory (SUPABASE_SERVICE_ROLE_KEY not set)")
+		DefaultStore = NewMemoryStore()
+		return
+	}
+
+	if err := gdpr.RegisterTable(tableName, "user_id"); err != nil {
+		log.Printf("WARNING: Failed to register profiles for GDPR erasure: %v", err)
+	}
+	DefaultStore = NewPostgRESTStore(supabaseURL, serviceKey)
+	log.Println("Profiles initialized (Supabase Postgres)")
+	startup.Report("profiles", true, "Supabase Postgres, cache TTL "+getCacheTTL().String())
+}
+
+// SetDefault replaces the default store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// Get returns the profile of userID (an empty one if the user has none), from the cache when
+// possible.
+func Get(ctx context.Context, tenantID, userID string) (*Profile, error) {
+	if DefaultStore == nil {
+		return nil, ErrNotConfigured
+	}
+
+	// Step 1: Try the cache
+	store := tenant.CacheFor(tenantID)
+	if store != nil {
+		if cached, err := store.Get(cacheKey(userID)); err == nil && cached != "" {
+			var profile Profile
+			if err := json.Unmarshal([]byte(cached), &profile); err == nil {
+				return &profile, nil
+			}
+		}
+	}
+
+	// Step 2: Load from the store
+	profile, err := DefaultStore.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		profile = &Profile{UserID: userID, TenantID: tenantID}
+	}
+	if profile.Preferences == nil {
+		profile.Preferences = map[string]interface{}{}
+	}
+
+	// Step 3: Cache it (empty profiles too, so users who never set one don't hit the database)
+	if store != nil {
+		if encoded, err := json.Marshal(profile); err == nil {
+			if err := store.Set(cacheKey(userID), string(encoded), getCacheTTL()); err != nil {
+				log.Printf("WARNING: Failed to cache profile: %v", err)
+			}
+		}
+	}
+	return profile, nil
+}
+
+// Apply validates update and saves it to the profile of userID.
+// Invalid updates return a *ValidationError and change nothing. If version is not AnyVersion and
+// the profile is no longer at that version, it returns a *ConflictError.
+func Apply(ctx context.Context, tenantID, userID string, update Update, version int) (*Profile, error) {
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	return modify(ctx, tenantID, userID, version, func(profile *Profile) {
+		if update.DisplayName != nil {
+			profile.DisplayName = strings.TrimSpace(*update.DisplayName)
+		}
+		if update.Preferences != nil {
+			profile.Preferences = update.Preferences
+		}
+	})
+}
+
+// MergePreferences sets some preferences of userID and keeps the others; a nil value removes the
+// key. Callers validate the values (see internal/preferences). Concurrent merges of different keys
+// both apply: a merge that loses the race is retried on the new version.
+func MergePreferences(ctx context.Context, tenantID, userID string, changes map[string]interface{}) (*Profile, error) {
+	if err := (Update{Preferences: changes}).Validate(); err != nil {
+		return nil, err
+	}
+
+	return modify(ctx, tenantID, userID, AnyVersion, func(profile *Profile) {
+		if profile.Preferences == nil {
+			profile.Preferences = map[string]interface{}{}
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(profile.Preferences, key)
+				continue
+			}
+			profile.Preferences[key] = value
+		}
+	})
+}
+
+// Validate checks an update against the limits.
+func (u Update) Validate() error {
+	if u.DisplayName != nil {
+		name := strings.TrimSpace(*u.DisplayName)
+		if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+			return &ValidationError{Field: "display_name", Message: fmt.Sprintf("must be at most %d characters", MaxDisplayNameLength)}
+		}
+		for _, r := range name {
+			if unicode.IsControl(r) {
+				return &ValidationError{Field: "display_name", Message: "must not contain control characters"}
+			}
+		}
+	}
+
+	if u.Preferences != nil {
+		encoded, err := json.Marshal(u.Preferences)
+		if err != nil {
+			return &ValidationError{Field: "preferences", Message: "must be a JSON object"}
+		}
+		if len(encoded) > MaxPreferencesSize {
+			return &ValidationError{Field: "preferences", Message: fmt.Sprintf("must be at most %d bytes", MaxPreferencesSize)}
+		}
+	}
+	return nil
+}
+
+// SetAvatar uploads an image to storage and sets it as the avatar of userID. The object name
+// carries a hash of the content, so a new avatar gets a new URL that browsers haven't cached;
+// the previous object is deleted.
+func SetAvatar(ctx context.Context, tenantID, userID, contentType string, data []byte) (*Profile, error) {
+	// Step 1: Check the image
+	extension, ok := avatarTypes[contentType]
+	if !ok {
+		return nil, &ValidationError{Field: "avatar", Message: "must be a PNG, JPEG, WebP or GIF image"}
+	}
+	if len(data) == 0 || len(data) > MaxAvatarSize {
+		return nil, &ValidationError{Field: "avatar", Message: fmt.Sprintf("must be between 1 byte and %d bytes", MaxAvatarSize)}
+	}
+	objects := storage.Get()
+	if objects == nil {
+		return nil, storage.ErrNotConfigured
+	}
+
+	// Step 2: Upload under avatars/<tenant>/<user>-<hash>.<ext>
+	sum := sha256.Sum256(data)
+	key := avatarKey(tenantID, userID) + "-" + hex.EncodeToString(sum[:6]) + "." + extension
+	avatarURL, err := objects.Put(ctx, key, contentType, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload avatar: %w", err)
+	}
+
+	// Step 3: Point the profile at it, then remove the previous image
+	var previous string
+	profile, err := modify(ctx, tenantID, userID, AnyVersion, func(profile *Profile) {
+		previous = profile.AvatarURL
+		profile.AvatarURL = avatarURL
+	})
+	if err != nil {
+		return nil, err
+	}
+	if previous != "" && previous != avatarURL {
+		if previousKey := keyFromURL(previous, tenantID, userID); previousKey != "" {
+			if err := objects.Delete(ctx, previousKey); err != nil {
+				log.Printf("WARNING: Failed to delete previous avatar: %v", err)
+			}
+		}
+	}
+	return profile, nil
+}
+
+// modify loads a profile, applies change, saves it as the next version and invalidates the cache.
+//
+// With an expected version, a profile at another version is a *ConflictError. With AnyVersion,
+// losing a race to another write reloads the profile and applies change again, so change must
+// only depend on the profile it is given.
+func modify(ctx context.Context, tenantID, userID string, version int, change func(*Profile)) (*Profile, error) {
+	if DefaultStore == nil {
+		return nil, ErrNotConfigured
+	}
+
+	for attempt := 1; ; attempt++ {
+		// Step 1: Load the stored profile (not the cached one, which may be stale)
+		profile, err := load(ctx, tenantID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if version != AnyVersion && profile.Version != version {
+			return nil, &ConflictError{Current: profile}
+		}
+
+		// Step 2: Change it and write it, if nobody else has in the meantime
+		current := profile.Version
+		change(profile)
+		if profile.Preferences == nil {
+			profile.Preferences = map[string]interface{}{}
+		}
+		updatedAt := now().UTC()
+		profile.UpdatedAt = &updatedAt
+		profile.Version = current + 1
+
+		err = DefaultStore.Upsert(ctx, profile, current)
+		if errors.Is(err, ErrConflict) {
+			if version == AnyVersion && attempt < maxAttempts {
+				continue
+			}
+			latest, loadErr := load(ctx, tenantID, userID)
+			if loadErr != nil {
+				return nil, loadErr
+			}
+			return nil, &ConflictError{Current: latest}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Step 3: Invalidate the cached profile
+		if store := tenant.CacheFor(tenantID); store != nil {
+			if err := store.Del(cacheKey(userID)); err != nil {
+				log.Printf("WARNING: Failed to invalidate cached profile: %v", err)
+			}
+		}
+
+		// Step 4: A first write means a new user of the app
+		if current == 0 {
+			events.Publish(events.UserRegistered{UserID: userID, TenantID: tenantID, Time: updatedAt})
+		}
+		return profile, nil
+	}
+}
+
+// load reads a profile from the store, or an empty one (version 0) if the user has none.
+func load(ctx context.Context, tenantID, userID string) (*Profile, error) {
+	profile, err := DefaultStore.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		profile = &Profile{UserID: userID, TenantID: tenantID}
+	}
+	return profile, nil
+}
+
+// cacheKey is the cache key of a user's profile (within the tenant's cache).
+func cacheKey(userID string) string {
+	return "profile:" + userID
+}
+
+// avatarKey is the storage path prefix of a user's avatars.
+func avatarKey(tenantID, userID string) string {
+	if tenantID == "" {
+		return "avatars/" + userID
+	}
+	return "avatars/" + tenantID + "/" + userID
+}
+
+// keyFromURL returns the storage key of one of the user's previous avatars, or "" if avatarURL
+// doesn't point to one (e.g. an avatar set by another system).
+func keyFromURL(avatarURL, tenantID, userID string) string {
+	prefix := avatarKey(tenantID, userID) + "-"
+	index := strings.LastIndex(avatarURL, prefix)
+	if index < 0 {
+		return ""
+	}
+	return avatarURL[index:]
+}
+
+// getCacheTTL returns PROFILE_CACHE_TTL, defaulting to 5 minutes if unset or invalid.
+func getCacheTTL() time.Duration {
+	value := os.Getenv("PROFILE_CACHE_TTL")
+	if value == "" {
+		return 5 * time.Minute
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("WARNING: Invalid PROFILE_CACHE_TTL %q, using 5m", value)
+		return 5 * time.Minute
+	}
+	return parsed
+}
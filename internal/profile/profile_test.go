@@ -0,0 +1,200 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/events"
+	"boilerplate/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTest swaps in memory stores and a fixed clock.
+func setupTest(t *testing.T) (*MemoryStore, *storage.MemoryStore) {
+	t.Helper()
+
+	originalStore, originalCache, originalStorage := DefaultStore, cache.GetClient(), storage.Get()
+	t.Cleanup(func() {
+		SetDefault(originalStore)
+		cache.SetDefault(originalCache)
+		storage.SetDefault(originalStorage)
+		now = time.Now
+	})
+
+	store := NewMemoryStore()
+	SetDefault(store)
+	cache.SetDefault(cache.NewMemoryStore())
+	objects := storage.NewMemoryStore("https://storage.test")
+	storage.SetDefault(objects)
+
+	fixed := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+
+	return store, objects
+}
+
+func stringPtr(s string) *string { return &s }
+
+// TestGet_EmptyProfile tests that a user without a row gets an empty profile.
+func TestGet_EmptyProfile(t *testing.T) {
+	setupTest(t)
+
+	profile, err := Get(context.Background(), "acme", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", profile.UserID)
+	assert.Equal(t, "acme", profile.TenantID)
+	assert.Empty(t, profile.DisplayName)
+	assert.NotNil(t, profile.Preferences)
+	assert.Nil(t, profile.UpdatedAt)
+}
+
+// TestApply_Validation tests that invalid updates are rejected with the offending field and
+// change nothing.
+func TestApply_Validation(t *testing.T) {
+	store, _ := setupTest(t)
+	ctx := context.Background()
+
+	cases := map[string]struct {
+		update Update
+		field  string
+	}{
+		"long name":     {Update{DisplayName: stringPtr(strings.Repeat("é", MaxDisplayNameLength+1))}, "display_name"},
+		"control chars": {Update{DisplayName: stringPtr("Ada\u0000")}, "display_name"},
+		"large prefs":   {Update{Preferences: map[string]interface{}{"blob": strings.Repeat("x", MaxPreferencesSize)}}, "preferences"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Apply(ctx, "", "u1", tc.update, AnyVersion)
+			var invalid *ValidationError
+			require.True(t, errors.As(err, &invalid))
+			assert.Equal(t, tc.field, invalid.Field)
+		})
+	}
+
+	saved, err := store.Get(ctx, "u1")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+
+	// The limit is in characters, not bytes, and surrounding spaces are trimmed
+	updated, err := Apply(ctx, "", "u1", Update{DisplayName: stringPtr("  " + strings.Repeat("é", MaxDisplayNameLength) + " ")}, AnyVersion)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("é", MaxDisplayNameLength), updated.DisplayName)
+}
+
+// TestApply_PartialUpdateAndCache tests that omitted fields are kept and that updates
+// invalidate the cached profile.
+func TestApply_PartialUpdateAndCache(t *testing.T) {
+	store, _ := setupTest(t)
+	ctx := context.Background()
+
+	_, err := Apply(ctx, "acme", "u1", Update{DisplayName: stringPtr("Ada"), Preferences: map[string]interface{}{"theme": "dark"}}, AnyVersion)
+	require.NoError(t, err)
+
+	// Cached on read: a change behind the cache's back is not seen
+	first, err := Get(ctx, "acme", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", first.DisplayName)
+	require.NoError(t, store.Upsert(ctx, &Profile{UserID: "u1", DisplayName: "Changed", Version: 2}, 1))
+	cached, err := Get(ctx, "acme", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", cached.DisplayName)
+
+	// An update invalidates it, and leaves omitted fields alone
+	require.NoError(t, store.Upsert(ctx, &Profile{UserID: "u1", DisplayName: "Ada", Preferences: map[string]interface{}{"theme": "dark"}, Version: 3}, 2))
+	_, err = Apply(ctx, "acme", "u1", Update{Preferences: map[string]interface{}{"theme": "light"}}, AnyVersion)
+	require.NoError(t, err)
+
+	fresh, err := Get(ctx, "acme", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", fresh.DisplayName)
+	assert.Equal(t, "light", fresh.Preferences["theme"])
+	require.NotNil(t, fresh.UpdatedAt)
+	assert.Equal(t, now(), *fresh.UpdatedAt)
+}
+
+// TestApply_UserRegistered tests that only a user's first write is published as a registration.
+func TestApply_UserRegistered(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	var registered []events.UserRegistered
+	unsubscribe := events.Subscribe(func(e events.UserRegistered) { registered = append(registered, e) })
+	defer unsubscribe()
+
+	for _, name := range []string{"Ada", "Grace"} {
+		_, err := Apply(ctx, "acme", "u1", Update{DisplayName: stringPtr(name)}, AnyVersion)
+		require.NoError(t, err)
+	}
+	require.Len(t, registered, 1)
+	assert.Equal(t, events.UserRegistered{UserID: "u1", TenantID: "acme", Time: now()}, registered[0])
+}
+
+// TestApply_VersionConflict tests that an update based on an old version is rejected with the
+// current profile and changes nothing.
+func TestApply_VersionConflict(t *testing.T) {
+	store, _ := setupTest(t)
+	ctx := context.Background()
+
+	// The first write expects no profile yet (version 0)
+	created, err := Apply(ctx, "", "u1", Update{DisplayName: stringPtr("Ada")}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, created.Version)
+
+	_, err = Apply(ctx, "", "u1", Update{DisplayName: stringPtr("Grace")}, 1)
+	require.NoError(t, err)
+
+	_, err = Apply(ctx, "", "u1", Update{DisplayName: stringPtr("Stale")}, 1)
+	var conflict *ConflictError
+	require.True(t, errors.As(err, &conflict), "expected a conflict, got %v", err)
+	assert.Equal(t, 2, conflict.Current.Version)
+	assert.Equal(t, "Grace", conflict.Current.DisplayName)
+
+	saved, err := store.Get(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Grace", saved.DisplayName)
+
+	// The store itself refuses a stale write, e.g. one that raced with another
+	assert.ErrorIs(t, store.Upsert(ctx, &Profile{UserID: "u1", Version: 2}, 1), ErrConflict)
+	assert.ErrorIs(t, store.Upsert(ctx, &Profile{UserID: "u9", Version: 1}, 3), ErrConflict)
+}
+
+// TestSetAvatar tests the upload, the type and size checks, and that a new avatar replaces the
+// previous object.
+func TestSetAvatar(t *testing.T) {
+	_, objects := setupTest(t)
+	ctx := context.Background()
+
+	_, err := SetAvatar(ctx, "acme", "u1", "text/html", []byte("<svg/>"))
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "avatar", invalid.Field)
+
+	_, err = SetAvatar(ctx, "acme", "u1", "image/png", make([]byte, MaxAvatarSize+1))
+	require.True(t, errors.As(err, &invalid))
+
+	first, err := SetAvatar(ctx, "acme", "u1", "image/png", []byte("first"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(first.AvatarURL, "https://storage.test/avatars/acme/u1-"))
+	firstKey := strings.TrimPrefix(first.AvatarURL, "https://storage.test/")
+	object, ok := objects.Object(firstKey)
+	require.True(t, ok)
+	assert.Equal(t, "image/png", object.ContentType)
+
+	second, err := SetAvatar(ctx, "acme", "u1", "image/jpeg", []byte("second"))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.AvatarURL, second.AvatarURL)
+	assert.True(t, strings.HasSuffix(second.AvatarURL, ".jpg"))
+	_, ok = objects.Object(firstKey)
+	assert.False(t, ok)
+
+	// Without storage, uploads fail with ErrNotConfigured
+	storage.SetDefault(nil)
+	_, err = SetAvatar(ctx, "acme", "u1", "image/png", []byte("third"))
+	assert.ErrorIs(t, err, storage.ErrNotConfigured)
+}
@@ -0,0 +1,22 @@
+-- User profiles. Run this in the Supabase SQL editor.
+
+create table if not exists profiles (
+    user_id      text        primary key,          -- Supabase auth user ID (the JWT sub)
+    tenant_id    text        not null default '',
+    display_name text        not null default '',
+    avatar_url   text        not null default '',
+    preferences  jsonb       not null default '{}'::jsonb,
+    updated_at   timestamptz not null default now(),
+    version      integer     not null default 1    -- Optimistic locking: incremented on every write
+);
+
+-- For tables created before the version column
+alter table profiles add column if not exists version integer not null default 1;
+
+-- The backend reads and writes with the service role key. This policy also lets apps read their
+-- own profile directly through Supabase (e.g. supabase-js); writes go through PUT /api/profile,
+-- which validates them.
+alter table profiles enable row level security;
+
+create policy "Profiles are readable by their owner" on profiles
+    for select using (auth.uid()::text = user_id);
@@ -0,0 +1,168 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"boilerplate/internal/egress"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APNs hosts.
+const (
+	apnsProduction = "https://api.push.apple.com"
+	apnsSandbox    = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is how long a provider token is reused. Apple rejects tokens older than an
+// hour and refreshing more often than every 20 minutes.
+const apnsTokenLifetime = 40 * time.Minute
+
+// APNs sends messages with the Apple Push Notification service HTTP/2 API, authenticated with a
+// provider token: a JWT signed with a .p8 token signing key.
+type APNs struct {
+	host     string // apnsProduction or apnsSandbox
+	keyID    string
+	teamID   string
+	topic    string      // The app's bundle ID
+	key      interface{} // *ecdsa.PrivateKey
+	client   *http.Client
+	mu       sync.Mutex
+	token    string
+	signedAt time.Time
+}
+
+// NewAPNsFromFile creates an APNs provider from the .p8 key at path (APNS_KEY_FILE), sending to
+// the sandbox if sandbox is true. It returns nil if path is "".
+func NewAPNsFromFile(path, keyID, teamID, topic string, sandbox bool) (*APNs, error) {
+	if path == "" {
+		return nil, nil
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNS_KEY_FILE: %w", err)
+	}
+	return NewAPNs(key, keyID, teamID, topic, sandbox)
+}
+
+// NewAPNs creates an APNs provider from a .p8 key's content, its key ID, the Apple developer
+// team ID and the app's bundle ID.
+func NewAPNs(key []byte, keyID, teamID, topic string, sandbox bool) (*APNs, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required with APNS_KEY_FILE")
+	}
+	signingKey, err := jwt.ParseECPrivateKeyFromPEM(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %w", err)
+	}
+	host := apnsProduction
+	if sandbox {
+		host = apnsSandbox
+	}
+	return &APNs{
+		host:   host,
+		keyID:  keyID,
+		teamID: teamID,
+		topic:  topic,
+		key:    signingKey,
+		client: egress.NewClient(sendTimeout),
+	}, nil
+}
+
+// Name implements Provider.
+func (a *APNs) Name() string {
+	return "apns"
+}
+
+// Send implements Provider.
+func (a *APNs) Send(ctx context.Context, device Device, message Message) error {
+	token, err := a.providerToken(false)
+	if err != nil {
+		return err
+	}
+
+	// Data keys sit next to "aps", where the app reads them from the notification's userInfo
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": message.Title, "body": message.Body},
+			"sound": "default",
+		},
+	}
+	for key, value := range message.Data {
+		if key != "aps" {
+			payload[key] = value
+		}
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode APNs payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+device.Token, bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	if message.CollapseKey != "" {
+		req.Header.Set("apns-collapse-id", message.CollapseKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		if errors.Is(err, egress.ErrBlocked) {
+			return err
+		}
+		return &TemporaryError{Err: fmt.Errorf("failed to connect to APNs: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(resp.Body).Decode(&failure)
+	err = fmt.Errorf("APNs error (status %d): %s", resp.StatusCode, failure.Reason)
+	switch {
+	case resp.StatusCode == http.StatusGone, failure.Reason == "BadDeviceToken", failure.Reason == "Unregistered":
+		return ErrUnregistered
+	case failure.Reason == "ExpiredProviderToken":
+		a.providerToken(true)
+		return &TemporaryError{Err: err}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &TemporaryError{Err: err, RetryAfter: retryAfter(resp)}
+	}
+	return err
+}
+
+// providerToken returns the provider token, signing a new one when it is older than
+// apnsTokenLifetime or renew is set.
+func (a *APNs) providerToken(renew bool) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && !renew && time.Since(a.signedAt) < apnsTokenLifetime {
+		return a.token, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": a.teamID, "iat": now.Unix()})
+	token.Header["kid"] = a.keyID
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign APNs provider token: %w", err)
+	}
+	a.token, a.signedAt = signed, now
+	return signed, nil
+}
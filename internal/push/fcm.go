@@ -0,0 +1,241 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/egress"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FCM endpoints.
+const (
+	fcmEndpoint    = "https://fcm.googleapis.com/v1/projects/"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	fcmScope       = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// FCM sends messages with the Firebase Cloud Messaging HTTP v1 API, authenticated as a service
+// account: it signs a JWT with the account's key and exchanges it for an OAuth access token,
+// reused until shortly before it expires.
+type FCM struct {
+	projectID   string
+	email       string
+	key         interface{} // *rsa.PrivateKey
+	tokenURL    string
+	endpoint    string // fcmEndpoint, overridable in tests
+	client      *http.Client
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// serviceAccount is the part of a Google service account key file FCM uses.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCMFromFile creates an FCM provider from the service account key file at path
+// (FCM_CREDENTIALS_FILE). projectID defaults to the key's project. It returns nil if path is "".
+func NewFCMFromFile(path, projectID string) (*FCM, error) {
+	if path == "" {
+		return nil, nil
+	}
+	credentials, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM_CREDENTIALS_FILE: %w", err)
+	}
+	return NewFCM(credentials, projectID)
+}
+
+// NewFCM creates an FCM provider from a service account key file's content. projectID defaults
+// to the key's project.
+func NewFCM(credentials []byte, projectID string) (*FCM, error) {
+	var account serviceAccount
+	if err := json.Unmarshal(credentials, &account); err != nil {
+		return nil, fmt.Errorf("invalid FCM service account key: %w", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM service account private key: %w", err)
+	}
+	if projectID == "" {
+		projectID = account.ProjectID
+	}
+	if projectID == "" || account.ClientEmail == "" {
+		return nil, errors.New("FCM service account key has no project_id or client_email")
+	}
+	tokenURL := account.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	return &FCM{
+		projectID: projectID,
+		email:     account.ClientEmail,
+		key:       key,
+		tokenURL:  tokenURL,
+		endpoint:  fcmEndpoint,
+		client:    egress.NewClient(sendTimeout),
+	}, nil
+}
+
+// Name implements Provider.
+func (f *FCM) Name() string {
+	return "fcm"
+}
+
+// fcmMessage is the body of a send request.
+type fcmMessage struct {
+	Message struct {
+		Token        string            `json:"token"`
+		Notification map[string]string `json:"notification"`
+		Data         map[string]string `json:"data,omitempty"`
+		Android      map[string]string `json:"android,omitempty"`
+		Webpush      map[string]any    `json:"webpush,omitempty"`
+	} `json:"message"`
+}
+
+// Send implements Provider.
+func (f *FCM) Send(ctx context.Context, device Device, message Message) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return &TemporaryError{Err: err}
+	}
+
+	var body fcmMessage
+	body.Message.Token = device.Token
+	body.Message.Notification = map[string]string{"title": message.Title, "body": message.Body}
+	body.Message.Data = message.Data
+	if message.CollapseKey != "" {
+		body.Message.Android = map[string]string{"collapse_key": message.CollapseKey}
+		body.Message.Webpush = map[string]any{"headers": map[string]string{"Topic": message.CollapseKey}}
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode FCM message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint+f.projectID+"/messages:send", bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, egress.ErrBlocked) {
+			return err
+		}
+		return &TemporaryError{Err: fmt.Errorf("failed to connect to FCM: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// Errors carry an FCM code in their details, e.g. UNREGISTERED for stale tokens
+	respBody, _ := io.ReadAll(resp.Body)
+	var failure struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(respBody, &failure)
+	err = fmt.Errorf("FCM error (status %d): %s", resp.StatusCode, failure.Error.Message)
+	for _, detail := range failure.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return ErrUnregistered
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUnregistered
+	case resp.StatusCode == http.StatusUnauthorized:
+		f.mu.Lock()
+		f.accessToken = "" // Fetch a new one for the retry
+		f.mu.Unlock()
+		return &TemporaryError{Err: err}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &TemporaryError{Err: err, RetryAfter: retryAfter(resp)}
+	}
+	return err
+}
+
+// token returns an access token, fetching a new one if the current one expires within a minute.
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Until(f.expiresAt) > time.Minute {
+		return f.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.email,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token request: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch FCM access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("FCM access token error (status %d): %s", resp.StatusCode, string(body))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid FCM access token response")
+	}
+	f.accessToken = token.AccessToken
+	f.expiresAt = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
+
+// retryAfter returns the response's Retry-After in seconds, or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,51 @@
+package push
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps devices in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	devices map[string]Device // By token
+}
+
+// NewMemoryStore creates an empty in-memory device store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{devices: make(map[string]Device)}
+}
+
+// Save inserts or replaces the device with device.Token.
+func (m *MemoryStore) Save(ctx context.Context, device Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.devices[device.Token] = device
+	return nil
+}
+
+// Delete removes the device with token, if it belongs to userID ("" for any user).
+func (m *MemoryStore) Delete(ctx context.Context, userID, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if device, ok := m.devices[token]; ok && (userID == "" || device.UserID == userID) {
+		delete(m.devices, token)
+	}
+	return nil
+}
+
+// List returns the devices of userID in tenantID, most recently registered first.
+func (m *MemoryStore) List(ctx context.Context, tenantID, userID string) ([]Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	devices := make([]Device, 0)
+	for _, device := range m.devices {
+		if device.UserID == userID && device.TenantID == tenantID {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].UpdatedAt.After(devices[j].UpdatedAt) })
+	return devices, nil
+}
@@ -0,0 +1,124 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// PostgRESTStore keeps devices in Postgres through the Supabase REST API (PostgREST), with the
+// service role key. See schema.sql for the table.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/push_devices
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Save upserts the device on its token.
+func (s *PostgRESTStore) Save(ctx context.Context, device Device) error {
+	body, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to encode device: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("on_conflict", "token")
+	resp, err := s.do(ctx, "POST", s.baseURL+"?"+params.Encode(), body, "resolution=merge-duplicates,return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Delete removes the device with token, if it belongs to userID ("" for any user).
+func (s *PostgRESTStore) Delete(ctx context.Context, userID, token string) error {
+	params := url.Values{}
+	params.Set("token", "eq."+token)
+	if userID != "" {
+		params.Set("user_id", "eq."+userID)
+	}
+	resp, err := s.do(ctx, "DELETE", s.baseURL+"?"+params.Encode(), nil, "return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns the devices of userID in tenantID, most recently registered first.
+func (s *PostgRESTStore) List(ctx context.Context, tenantID, userID string) ([]Device, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("tenant_id", "eq."+tenantID)
+	params.Set("user_id", "eq."+userID)
+	params.Set("order", "updated_at.desc")
+
+	resp, err := s.do(ctx, "GET", s.baseURL+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	devices := make([]Device, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, fmt.Errorf("failed to parse devices: %w", err)
+	}
+	return devices, nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
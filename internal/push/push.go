@@ -0,0 +1,413 @@
+package push
+
+// Package push delivers push notifications to users' devices: FCM for Android and web, APNs for
+// iOS.
+//
+// Apps register each device's token (POST /api/push/devices) after the user grants permission;
+// tokens are stored per user in the push_devices table (see schema.sql; in memory without
+// SUPABASE_SERVICE_ROLE_KEY). Notify sends a message to every device of a user who hasn't turned
+// off the notifications.push preference.
+//
+// Sends go through an in-process delivery queue (PUSH_QUEUE_SIZE, default 1000) drained by
+// PUSH_WORKERS workers (default 4), so callers never wait on FCM or APNs. Failed sends the
+// provider reports as temporary (429, 5xx, connection errors) are retried PUSH_RETRIES times
+// (default 3), waiting PUSH_RETRY_BACKOFF (default 2s, doubled each time) or the provider's
+// Retry-After. Tokens the provider reports as no longer valid (app uninstalled, token rotated)
+// are deleted. The queue lives in memory: messages still queued on shutdown are lost.
+//
+// Providers are configured with FCM_PROJECT_ID and FCM_CREDENTIALS_FILE (a service account key),
+// and APNS_KEY_FILE, APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC (a .p8 token signing key). Without
+// them messages for that platform are logged and dropped.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/startup"
+)
+
+// Platforms of devices.
+const (
+	PlatformAndroid = "android" // FCM
+	PlatformWeb     = "web"     // FCM (web push)
+	PlatformIOS     = "ios"     // APNs
+)
+
+// Platforms lists every platform, in docs order.
+var Platforms = []string{PlatformAndroid, PlatformIOS, PlatformWeb}
+
+// maxTokenLength bounds device tokens (FCM tokens are ~160 characters, APNs tokens 64).
+const maxTokenLength = 4096
+
+// sendTimeout bounds one send to a provider.
+const sendTimeout = 10 * time.Second
+
+// Device is a registered device of a user.
+type Device struct {
+	Token     string    `json:"token"`
+	Platform  string    `json:"platform"`
+	UserID    string    `json:"user_id"`
+	TenantID  string    `json:"tenant_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Message is a notification.
+type Message struct {
+	Title       string            `json:"title"`
+	Body        string            `json:"body"`
+	Data        map[string]string `json:"data,omitempty"`         // Delivered to the app, e.g. {"artist_id": "a1"}
+	CollapseKey string            `json:"collapse_key,omitempty"` // A newer message with the same key replaces an undelivered one
+}
+
+// Provider sends messages to the devices of the platforms it serves.
+type Provider interface {
+	// Name identifies the provider in logs and metrics (fcm, apns).
+	Name() string
+
+	// Send delivers message to device. It returns ErrUnregistered for tokens that are no longer
+	// valid, and a *TemporaryError for failures worth retrying.
+	Send(ctx context.Context, device Device, message Message) error
+}
+
+// ErrUnregistered is returned by providers for device tokens that are no longer valid; the
+// device is deleted.
+var ErrUnregistered = errors.New("device token is no longer registered")
+
+// ErrInvalidDevice is returned by Register for an unknown platform or an empty or oversized token.
+var ErrInvalidDevice = errors.New("invalid device")
+
+// ErrNotConfigured is returned when push is used before Init() or SetDefault().
+var ErrNotConfigured = errors.New("push notifications not configured")
+
+// TemporaryError is a failure the provider may not repeat, e.g. a 503 or a connection error.
+type TemporaryError struct {
+	Err        error
+	RetryAfter time.Duration // The provider's Retry-After, if any
+}
+
+func (e *TemporaryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemporaryError) Unwrap() error {
+	return e.Err
+}
+
+// Store persists devices.
+type Store interface {
+	// Save inserts or replaces the device with device.Token (a token moves to the user who
+	// registered it last, e.g. when someone else signs in on the device).
+	Save(ctx context.Context, device Device) error
+
+	// Delete removes the device with token, if it belongs to userID ("" for any user).
+	Delete(ctx context.Context, userID, token string) error
+
+	// List returns the devices of userID in tenantID.
+	List(ctx context.Context, tenantID, userID string) ([]Device, error)
+}
+
+// Options configures a Service.
+type Options struct {
+	Workers      int           // Delivery goroutines (default 4)
+	QueueSize    int           // Messages waiting for a worker before new ones are dropped (default 1000)
+	Retries      int           // Of temporary failures
+	RetryBackoff time.Duration // Before the first retry, doubled each time (default 2s)
+}
+
+// Service registers devices and delivers messages to them.
+type Service struct {
+	store     Store
+	providers map[string]Provider // By platform
+	opts      Options
+
+	queue chan delivery
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// delivery is one message to one device, queued.
+type delivery struct {
+	device  Device
+	message Message
+	attempt int
+}
+
+// Default is the service used by the package functions. It is nil until Init() or SetDefault()
+// is called.
+var Default *Service
+
+// tableName is the Postgres table holding devices (see schema.sql).
+const tableName = "push_devices"
+
+// Init configures the default service from the PUSH_*, FCM_* and APNS_* settings and starts its
+// workers.
+func Init(cfg config.Push, supabase config.Supabase) {
+	var store Store
+	storeDetail := "devices in Supabase Postgres"
+	if supabase.URL == "" || supabase.ServiceRoleKey == "" {
+		slog.Warn("SUPABASE_SERVICE_ROLE_KEY not set, push devices are kept in memory only")
+		storeDetail = "devices in memory (SUPABASE_SERVICE_ROLE_KEY not set)"
+		store = NewMemoryStore()
+	} else {
+		if err := gdpr.RegisterTable(tableName, "user_id"); err != nil {
+			slog.Warn("Failed to register push devices for GDPR erasure", "error", err)
+		}
+		store = NewPostgRESTStore(supabase.URL, supabase.ServiceRoleKey)
+	}
+
+	providers := make(map[string]Provider)
+	var names []string
+	if fcm, err := NewFCMFromFile(cfg.FCMCredentialsFile, cfg.FCMProjectID); err != nil {
+		slog.Error("FCM not configured", "error", err)
+	} else if fcm != nil {
+		providers[PlatformAndroid], providers[PlatformWeb] = fcm, fcm
+		names = append(names, "FCM")
+		checkEgress(fcmEndpoint, googleTokenURL)
+	}
+	if apns, err := NewAPNsFromFile(cfg.APNsKeyFile, cfg.APNsKeyID, cfg.APNsTeamID, cfg.APNsTopic, cfg.APNsSandbox); err != nil {
+		slog.Error("APNs not configured", "error", err)
+	} else if apns != nil {
+		providers[PlatformIOS] = apns
+		names = append(names, "APNs")
+		checkEgress(apns.host)
+	}
+
+	opts := Options{
+		Workers:      cfg.Workers,
+		QueueSize:    cfg.QueueSize,
+		Retries:      cfg.Retries,
+		RetryBackoff: cfg.RetryBackoff,
+	}
+	if Default != nil {
+		Default.Close()
+	}
+	Default = NewService(store, providers, opts)
+
+	if len(names) == 0 {
+		startup.Report("push", false, "no FCM or APNs credentials, messages are logged; "+storeDetail)
+		return
+	}
+	startup.Report("push", true, fmt.Sprintf("%s, %d workers, %d retries; %s", strings.Join(names, " and "), opts.Workers, opts.Retries, storeDetail))
+}
+
+// NewService creates a service delivering with providers (by platform) and starts its workers.
+// Platforms without a provider have their messages logged and dropped.
+func NewService(store Store, providers map[string]Provider, opts Options) *Service {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 2 * time.Second
+	}
+	s := &Service{
+		store:     store,
+		providers: providers,
+		opts:      opts,
+		queue:     make(chan delivery, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// SetDefault replaces the default service (nil disables push). Mainly useful in tests.
+func SetDefault(service *Service) {
+	Default = service
+}
+
+// Get returns the default service, or nil if push is not configured.
+func Get() *Service {
+	return Default
+}
+
+// Close stops the workers once they finish their current send. Queued messages are dropped.
+func (s *Service) Close() {
+	s.once.Do(func() { close(s.done) })
+	s.wg.Wait()
+}
+
+// Register saves a device of the user, validating its platform and token.
+func (s *Service) Register(ctx context.Context, device Device) error {
+	if s == nil {
+		return ErrNotConfigured
+	}
+	device.Token = strings.TrimSpace(device.Token)
+	if device.Token == "" || len(device.Token) > maxTokenLength {
+		return fmt.Errorf("%w: token must be 1 to %d characters", ErrInvalidDevice, maxTokenLength)
+	}
+	if !slices.Contains(Platforms, device.Platform) {
+		return fmt.Errorf("%w: platform must be one of %s", ErrInvalidDevice, strings.Join(Platforms, ", "))
+	}
+	device.UpdatedAt = time.Now().UTC()
+	return s.store.Save(ctx, device)
+}
+
+// Unregister deletes the user's device with token (e.g. on sign-out). Unknown tokens are ignored.
+func (s *Service) Unregister(ctx context.Context, userID, token string) error {
+	if s == nil {
+		return ErrNotConfigured
+	}
+	return s.store.Delete(ctx, userID, token)
+}
+
+// Devices returns the user's devices.
+func (s *Service) Devices(ctx context.Context, tenantID, userID string) ([]Device, error) {
+	if s == nil {
+		return nil, ErrNotConfigured
+	}
+	return s.store.List(ctx, tenantID, userID)
+}
+
+// Notify queues message for every device of the user, unless they turned off the
+// notifications.push preference. It returns how many sends were queued; delivery happens in the
+// background.
+func (s *Service) Notify(ctx context.Context, tenantID, userID string, message Message) (int, error) {
+	if s == nil {
+		return 0, ErrNotConfigured
+	}
+	if !Enabled(ctx, tenantID, userID, "notifications.push") {
+		return 0, nil
+	}
+	devices, err := s.store.List(ctx, tenantID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list devices: %w", err)
+	}
+	queued := 0
+	for _, device := range devices {
+		if s.enqueue(delivery{device: device, message: message}) {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// Enabled reports whether the boolean preference key of the user is on. Preferences that can't
+// be read count as on (their defaults are), so a profile outage doesn't silence notifications.
+func Enabled(ctx context.Context, tenantID, userID, key string) bool {
+	values, err := preferences.Get(ctx, tenantID, userID)
+	if err != nil {
+		slog.Warn("Failed to read notification preferences, sending anyway", "error", err)
+		return true
+	}
+	enabled, ok := values[key].(bool)
+	return !ok || enabled
+}
+
+// enqueue queues a delivery, and drops it if the queue is full or the service is closed.
+func (s *Service) enqueue(d delivery) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.queue <- d:
+		metrics.PushQueueDepth.Set(float64(len(s.queue)))
+		return true
+	default:
+		metrics.PushDeliveries.WithLabelValues(s.providerName(d.device), "dropped").Inc()
+		slog.Warn("Push queue full, dropping message", "platform", d.device.Platform)
+		return false
+	}
+}
+
+// work delivers queued messages until the service is closed.
+func (s *Service) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case d := <-s.queue:
+			metrics.PushQueueDepth.Set(float64(len(s.queue)))
+			s.deliver(d)
+		}
+	}
+}
+
+// deliver sends one message, then retries, deletes the device or gives up depending on the result.
+func (s *Service) deliver(d delivery) {
+	provider := s.providers[d.device.Platform]
+	if provider == nil {
+		metrics.PushDeliveries.WithLabelValues(d.device.Platform, "no_provider").Inc()
+		slog.Info("Push notification (no provider configured)", "platform", d.device.Platform, "title", d.message.Title)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	err := provider.Send(ctx, d.device, d.message)
+
+	var temporary *TemporaryError
+	switch {
+	case err == nil:
+		metrics.PushDeliveries.WithLabelValues(provider.Name(), "sent").Inc()
+	case errors.Is(err, ErrUnregistered):
+		metrics.PushDeliveries.WithLabelValues(provider.Name(), "unregistered").Inc()
+		if err := s.store.Delete(ctx, "", d.device.Token); err != nil {
+			slog.Warn("Failed to delete unregistered push device", "provider", provider.Name(), "error", err)
+		}
+	case errors.As(err, &temporary) && d.attempt < s.opts.Retries:
+		metrics.PushDeliveries.WithLabelValues(provider.Name(), "retried").Inc()
+		wait := max(s.opts.RetryBackoff<<d.attempt, temporary.RetryAfter)
+		d.attempt++
+		slog.Warn("Push notification failed, retrying", "provider", provider.Name(), "attempt", d.attempt, "wait", wait.String(), "error", err)
+		time.AfterFunc(wait, func() { s.enqueue(d) })
+	default:
+		metrics.PushDeliveries.WithLabelValues(provider.Name(), "failed").Inc()
+		slog.Error("Push notification failed", "provider", provider.Name(), "attempts", d.attempt+1, "error", err)
+	}
+}
+
+// providerName returns the metrics label of the provider of device's platform.
+func (s *Service) providerName(device Device) string {
+	if provider := s.providers[device.Platform]; provider != nil {
+		return provider.Name()
+	}
+	return device.Platform
+}
+
+// Register saves a device with the default service.
+func Register(ctx context.Context, device Device) error {
+	return Default.Register(ctx, device)
+}
+
+// Notify queues message for the user's devices with the default service.
+func Notify(ctx context.Context, tenantID, userID string, message Message) (int, error) {
+	return Default.Notify(ctx, tenantID, userID, message)
+}
+
+// checkEgress warns when the egress policy blocks a provider's endpoint.
+func checkEgress(endpoints ...string) {
+	if egress.DefaultPolicy == nil {
+		return
+	}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			continue
+		}
+		if err := egress.DefaultPolicy.Check(u); err != nil {
+			slog.Warn("Push provider host is not allowed, add it to EGRESS_ALLOWED_HOSTS", "host", u.Host)
+		}
+	}
+}
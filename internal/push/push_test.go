@@ -0,0 +1,238 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/preferences"
+	"boilerplate/internal/profile"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider records sends and fails them with the queued errors.
+type fakeProvider struct {
+	mu     sync.Mutex
+	errs   []error
+	sent   []Message
+	tokens []string
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Send(ctx context.Context, device Device, message Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens = append(p.tokens, device.Token)
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return err
+	}
+	p.sent = append(p.sent, message)
+	return nil
+}
+
+// sends returns how many sends were attempted.
+func (p *fakeProvider) sends() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.tokens)
+}
+
+// setupTest creates a service sending through provider, with memory stores for devices and
+// profiles (preferences).
+func setupTest(t *testing.T, provider Provider) (*Service, *MemoryStore) {
+	t.Helper()
+	originalProfiles, originalCache := profile.DefaultStore, cache.GetClient()
+	profile.SetDefault(profile.NewMemoryStore())
+	cache.SetDefault(cache.NewMemoryStore())
+
+	store := NewMemoryStore()
+	service := NewService(store, map[string]Provider{PlatformAndroid: provider, PlatformIOS: provider}, Options{
+		Workers: 1, Retries: 2, RetryBackoff: time.Millisecond,
+	})
+	original := Get()
+	SetDefault(service)
+	t.Cleanup(func() {
+		service.Close()
+		SetDefault(original)
+		profile.SetDefault(originalProfiles)
+		cache.SetDefault(originalCache)
+	})
+	return service, store
+}
+
+// TestRegister tests validation, listing and that a token moves to the user registering it last.
+func TestRegister(t *testing.T) {
+	service, _ := setupTest(t, &fakeProvider{})
+	ctx := context.Background()
+
+	assert.ErrorIs(t, service.Register(ctx, Device{Token: "t1", Platform: "windows", UserID: "u1"}), ErrInvalidDevice)
+	assert.ErrorIs(t, service.Register(ctx, Device{Token: " ", Platform: PlatformIOS, UserID: "u1"}), ErrInvalidDevice)
+
+	require.NoError(t, service.Register(ctx, Device{Token: "t1", Platform: PlatformIOS, UserID: "u1"}))
+	require.NoError(t, service.Register(ctx, Device{Token: "t2", Platform: PlatformAndroid, UserID: "u1"}))
+	devices, err := service.Devices(ctx, "", "u1")
+	require.NoError(t, err)
+	assert.Len(t, devices, 2)
+
+	require.NoError(t, service.Register(ctx, Device{Token: "t1", Platform: PlatformIOS, UserID: "u2"}))
+	devices, _ = service.Devices(ctx, "", "u1")
+	assert.Len(t, devices, 1)
+
+	require.NoError(t, service.Unregister(ctx, "u1", "t1"), "someone else's token is ignored")
+	devices, _ = service.Devices(ctx, "", "u2")
+	assert.Len(t, devices, 1)
+	require.NoError(t, service.Unregister(ctx, "u2", "t1"))
+	devices, _ = service.Devices(ctx, "", "u2")
+	assert.Empty(t, devices)
+}
+
+// TestNotify tests delivery to every device, retries of temporary failures, removal of
+// unregistered tokens and the notifications.push preference.
+func TestNotify(t *testing.T) {
+	provider := &fakeProvider{errs: []error{&TemporaryError{Err: errors.New("503")}, ErrUnregistered}}
+	service, store := setupTest(t, provider)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, Device{Token: "a", Platform: PlatformAndroid, UserID: "u1"}))
+	require.NoError(t, store.Save(ctx, Device{Token: "b", Platform: PlatformAndroid, UserID: "u1"}))
+
+	queued, err := service.Notify(ctx, "", "u1", Message{Title: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+
+	// One send fails temporarily and is retried, the other finds its token unregistered
+	require.Eventually(t, func() bool { return provider.sends() == 3 }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		devices, _ := store.List(ctx, "", "u1")
+		return len(devices) == 1
+	}, time.Second, time.Millisecond)
+	assert.Len(t, provider.sent, 1)
+
+	_, err = preferences.Set(ctx, "", "u1", map[string]interface{}{"notifications.push": false})
+	require.NoError(t, err)
+	queued, err = service.Notify(ctx, "", "u1", Message{Title: "Hi"})
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+}
+
+// TestNotify_GivesUp tests that temporary failures are retried Options.Retries times.
+func TestNotify_GivesUp(t *testing.T) {
+	temporary := &TemporaryError{Err: errors.New("503")}
+	provider := &fakeProvider{errs: []error{temporary, temporary, temporary, temporary}}
+	service, store := setupTest(t, provider)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, Device{Token: "a", Platform: PlatformIOS, UserID: "u1"}))
+
+	_, err := service.Notify(ctx, "", "u1", Message{Title: "Hi"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return provider.sends() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 3, provider.sends())
+	devices, _ := store.List(ctx, "", "u1")
+	assert.Len(t, devices, 1, "temporary failures keep the device")
+}
+
+// TestFCM tests the token exchange, the message sent and the mapping of errors.
+func TestFCM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			assert.NotEmpty(t, r.FormValue("assertion"))
+			w.Write([]byte(`{"access_token": "access", "expires_in": 3600}`))
+			return
+		}
+		assert.Equal(t, "/projects/demo/messages:send", r.URL.Path)
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		var body fcmMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body.Message.Token {
+		case "stale":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"status": "NOT_FOUND", "details": [{"errorCode": "UNREGISTERED"}]}}`))
+		case "busy":
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			assert.Equal(t, "Hi", body.Message.Notification["title"])
+			w.Write([]byte(`{"name": "projects/demo/messages/1"}`))
+		}
+	}))
+	defer server.Close()
+
+	credentials, _ := json.Marshal(serviceAccount{ProjectID: "demo", ClientEmail: "push@demo.iam.gserviceaccount.com", PrivateKey: string(keyPEM), TokenURI: server.URL + "/token"})
+	fcm, err := NewFCM(credentials, "")
+	require.NoError(t, err)
+	fcm.endpoint = server.URL + "/projects/"
+
+	ctx := context.Background()
+	assert.NoError(t, fcm.Send(ctx, Device{Token: "ok"}, Message{Title: "Hi"}))
+	assert.ErrorIs(t, fcm.Send(ctx, Device{Token: "stale"}, Message{Title: "Hi"}), ErrUnregistered)
+	var temporary *TemporaryError
+	require.ErrorAs(t, fcm.Send(ctx, Device{Token: "busy"}, Message{Title: "Hi"}), &temporary)
+	assert.Equal(t, 7*time.Second, temporary.RetryAfter)
+	assert.Equal(t, 1, tokenRequests, "the access token is reused")
+}
+
+// TestAPNs tests the request sent and the mapping of errors.
+func TestAPNs(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "com.example.app", r.Header.Get("apns-topic"))
+		assert.Contains(t, r.Header.Get("Authorization"), "bearer ")
+		switch r.URL.Path {
+		case "/3/device/gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason": "Unregistered"}`))
+		case "/3/device/bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason": "BadDeviceToken"}`))
+		default:
+			var payload map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			assert.Equal(t, "a1", payload["artist_id"])
+			assert.Equal(t, "c1", r.Header.Get("apns-collapse-id"))
+		}
+	}))
+	defer server.Close()
+
+	_, err = NewAPNs(keyPEM, "", "TEAM", "com.example.app", false)
+	assert.Error(t, err, "the key ID is required")
+	apns, err := NewAPNs(keyPEM, "KEY", "TEAM", "com.example.app", true)
+	require.NoError(t, err)
+	assert.Equal(t, apnsSandbox, apns.host)
+	apns.host = server.URL
+
+	ctx := context.Background()
+	message := Message{Title: "Hi", Data: map[string]string{"artist_id": "a1"}, CollapseKey: "c1"}
+	assert.NoError(t, apns.Send(ctx, Device{Token: "ok"}, message))
+	assert.ErrorIs(t, apns.Send(ctx, Device{Token: "gone"}, message), ErrUnregistered)
+	assert.ErrorIs(t, apns.Send(ctx, Device{Token: "bad"}, message), ErrUnregistered)
+}
@@ -0,0 +1,14 @@
+-- Push notification devices per user (see internal/push). Run this in the Supabase SQL editor.
+
+create table if not exists push_devices (
+    token      text        primary key,              -- FCM registration token or APNs device token
+    platform   text        not null,                 -- android, ios or web
+    user_id    text        not null,                 -- Supabase auth user ID (the JWT sub)
+    tenant_id  text        not null default '',
+    updated_at timestamptz not null default now()
+);
+
+create index if not exists push_devices_user_idx on push_devices (tenant_id, user_id);
+
+-- Only the backend (service role key) reads and writes devices; tokens are not exposed to apps.
+alter table push_devices enable row level security;
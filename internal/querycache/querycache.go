@@ -0,0 +1,260 @@
+package querycache
+
+// Package querycache caches the results of repository reads in the cache, keyed by a fingerprint
+// of the query (its name and arguments) and tagged with the entities it read, e.g. "artist:123".
+// Writes invalidate tags, and every cached result carrying one of them becomes stale at once:
+//
+//	artist, err := querycache.Fetch(qc, querycache.Query{
+//		Name: "artists.get",
+//		Args: []any{tenantID, id},
+//		Tags: []string{querycache.Tag("artist", id)},
+//	}, func() (*db.Artist, error) {
+//		return artists.Get(ctx, tenantID, id)
+//	})
+//
+//	// After the write committed
+//	qc.Invalidate(querycache.Tag("artist", id))
+//
+// Tags are versions, not lists of keys: each tag has a counter that Invalidate increments, and a
+// result is stored with the counters of its tags as they were before the query ran. A read
+// compares them with the current counters (one MGET), so invalidating costs one INCR per tag
+// whatever the number of results, works on every cache backend, and a result loaded
+// concurrently with a write is never served as fresh after it.
+//
+// Results are cached for QUERY_CACHE_TTL (default 1m) unless the query sets its own, at most
+// maxTTL. The cache is disabled with QUERY_CACHE=false or without a cache store: reads then
+// always run the query. Cache errors never fail a read.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+)
+
+// Key prefixes of results and tag versions.
+const (
+	resultPrefix = "qc:"
+	tagPrefix    = "qc:tag:"
+)
+
+// defaultTTL is how long results are cached by default (QUERY_CACHE_TTL).
+const defaultTTL = time.Minute
+
+// maxTTL bounds the TTL of results. Tag versions live for tagTTL after their last invalidation,
+// longer than any result: a tag version that expired (back to 0) can't match a result stored at 0
+// before an invalidation.
+const (
+	maxTTL = time.Hour
+	tagTTL = 2 * maxTTL
+)
+
+// Results of lookups, as counted in query_cache_requests_total.
+const (
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultStale = "stale"
+)
+
+var (
+	// DefaultCache caches the application's queries. It is nil until Init() or SetDefault() is
+	// called, and stays nil while the query cache is disabled.
+	DefaultCache *Cache
+)
+
+// Cache caches query results in a store.
+type Cache struct {
+	store cache.Store
+	ttl   time.Duration
+}
+
+// Query identifies a cached read.
+type Query struct {
+	Name string        // Names the query, e.g. "artists.list"; part of the key and metrics label
+	Args []any         // Everything the result depends on (tenant, IDs, paging), JSON encoded
+	Tags []string      // Entities the result depends on, see Tag
+	TTL  time.Duration // 0 uses the cache's TTL
+}
+
+// entry is a cached result with the versions of its tags when it was loaded.
+type entry struct {
+	Tags  map[string]int64 `json:"tags,omitempty"`
+	Value json.RawMessage  `json:"value"`
+}
+
+// Init creates the default cache on the default cache store (call it after cache.Init) from
+// QUERY_CACHE and QUERY_CACHE_TTL.
+func Init(cfg config.QueryCache) {
+	DefaultCache = nil
+	if !cfg.Enabled {
+		startup.Report("query cache", false, "QUERY_CACHE=false")
+		return
+	}
+	store := cache.GetClient()
+	if store == nil {
+		startup.Report("query cache", false, "no cache configured")
+		return
+	}
+	DefaultCache = New(store, cfg.TTL)
+	startup.Report("query cache", true, "results kept "+DefaultCache.ttl.String())
+}
+
+// New creates a cache storing results in store for ttl (defaultTTL when 0, at most maxTTL).
+// A nil store returns nil, a valid cache that never caches.
+func New(store cache.Store, ttl time.Duration) *Cache {
+	if store == nil {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Cache{store: store, ttl: min(ttl, maxTTL)}
+}
+
+// SetDefault sets the default cache (nil disables it). Mainly useful in tests.
+func SetDefault(c *Cache) {
+	DefaultCache = c
+}
+
+// Get returns the default cache, or nil when it is disabled. A nil *Cache is usable: Fetch runs
+// every query and Invalidate does nothing.
+func Get() *Cache {
+	return DefaultCache
+}
+
+// Tag returns the tag of an entity: Tag("artist", "123") == "artist:123".
+func Tag(entity, id string) string {
+	return entity + ":" + id
+}
+
+// Fetch returns the cached result of q, or runs load and caches its result. Errors of load are
+// returned and not cached. T must survive a JSON round trip: fields tagged json:"-" are lost.
+func Fetch[T any](c *Cache, q Query, load func() (T, error)) (T, error) {
+	if c == nil {
+		return load()
+	}
+	key := c.key(q)
+
+	// The versions are read before load runs, so a write committed in between makes this result
+	// stale instead of hiding the write
+	versions, err := c.versions(q.Tags)
+	if err != nil {
+		slog.Warn("Failed to read query cache tags", "query", q.Name, "error", err)
+		return load()
+	}
+
+	if raw, err := c.store.Get(key); err != nil {
+		slog.Warn("Failed to read the query cache", "query", q.Name, "error", err)
+	} else if raw != "" {
+		var cached entry
+		var value T
+		switch {
+		case json.Unmarshal([]byte(raw), &cached) != nil || !sameVersions(cached.Tags, versions):
+			metrics.QueryCacheRequests.WithLabelValues(q.Name, resultStale).Inc()
+		case json.Unmarshal(cached.Value, &value) != nil:
+			metrics.QueryCacheRequests.WithLabelValues(q.Name, resultStale).Inc()
+		default:
+			metrics.QueryCacheRequests.WithLabelValues(q.Name, resultHit).Inc()
+			return value, nil
+		}
+	} else {
+		metrics.QueryCacheRequests.WithLabelValues(q.Name, resultMiss).Inc()
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	c.save(key, q, versions, value)
+	return value, nil
+}
+
+// Invalidate makes every cached result tagged with one of tags stale. Call it after the write
+// is committed (after WithTx returns): invalidating inside the transaction lets a concurrent read
+// cache the old rows again under the new version.
+func (c *Cache) Invalidate(tags ...string) error {
+	if c == nil {
+		return nil
+	}
+	for _, tag := range tags {
+		if _, err := c.store.Incr(tagPrefix + tag); err != nil {
+			return fmt.Errorf("failed to invalidate %s: %w", tag, err)
+		}
+		if err := c.store.Expire(tagPrefix+tag, tagTTL); err != nil {
+			return fmt.Errorf("failed to invalidate %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// key returns the cache key of q's result: its name and a hash of its arguments.
+func (c *Cache) key(q Query) string {
+	args, err := json.Marshal(q.Args)
+	if err != nil {
+		// Arguments are IDs and numbers; fmt formats anything JSON can't encode
+		args = []byte(fmt.Sprint(q.Args...))
+	}
+	sum := sha256.Sum256(args)
+	return resultPrefix + q.Name + ":" + hex.EncodeToString(sum[:16])
+}
+
+// versions returns the current version of each tag (0 for tags never invalidated).
+func (c *Cache) versions(tags []string) (map[string]int64, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = tagPrefix + tag
+	}
+	values, err := c.store.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]int64, len(tags))
+	for i, tag := range tags {
+		versions[tag], _ = strconv.ParseInt(values[i], 10, 64) // "" (never invalidated) is 0
+	}
+	return versions, nil
+}
+
+// save caches value as q's result, loaded at versions.
+func (c *Cache) save(key string, q Query, versions map[string]int64, value any) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		slog.Warn("Failed to encode a query result", "query", q.Name, "error", err)
+		return
+	}
+	encoded, err := json.Marshal(entry{Tags: versions, Value: raw})
+	if err != nil {
+		return
+	}
+	ttl := c.ttl
+	if q.TTL > 0 {
+		ttl = min(q.TTL, maxTTL)
+	}
+	if err := c.store.Set(key, string(encoded), ttl); err != nil {
+		slog.Warn("Failed to write the query cache", "query", q.Name, "error", err)
+	}
+}
+
+// sameVersions reports whether a result's tag versions are the current ones.
+func sameVersions(cached, current map[string]int64) bool {
+	if len(cached) != len(current) {
+		return false
+	}
+	for tag, version := range current {
+		if cached[tag] != version {
+			return false
+		}
+	}
+	return true
+}
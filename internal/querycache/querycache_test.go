@@ -0,0 +1,84 @@
+package querycache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// item is a cached test result.
+type item struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TestFetch_Invalidate tests that results are cached per arguments until one of their tags is
+// invalidated.
+func TestFetch_Invalidate(t *testing.T) {
+	qc := New(cache.NewMemoryStore(), time.Minute)
+	loads := 0
+	name := "Ada"
+	fetch := func(id string) item {
+		value, err := Fetch(qc, Query{Name: "items.get", Args: []any{"t1", id}, Tags: []string{Tag("item", id)}}, func() (item, error) {
+			loads++
+			return item{ID: id, Name: name}, nil
+		})
+		require.NoError(t, err)
+		return value
+	}
+
+	assert.Equal(t, item{ID: "1", Name: "Ada"}, fetch("1"))
+	assert.Equal(t, item{ID: "1", Name: "Ada"}, fetch("1"))
+	assert.Equal(t, 1, loads, "the second read is cached")
+	fetch("2")
+	assert.Equal(t, 2, loads, "other arguments are another key")
+
+	name = "Grace"
+	require.NoError(t, qc.Invalidate(Tag("item", "1")))
+	assert.Equal(t, item{ID: "1", Name: "Grace"}, fetch("1"))
+	assert.Equal(t, 3, loads)
+	fetch("2")
+	assert.Equal(t, 3, loads, "other tags stay cached")
+}
+
+// TestFetch_WriteDuringLoad tests that a result loaded while its tag was invalidated isn't served
+// afterwards: it may predate the write.
+func TestFetch_WriteDuringLoad(t *testing.T) {
+	qc := New(cache.NewMemoryStore(), time.Minute)
+	q := Query{Name: "items.list", Tags: []string{Tag("items", "t1")}}
+
+	_, err := Fetch(qc, q, func() ([]item, error) {
+		require.NoError(t, qc.Invalidate(Tag("items", "t1"))) // Committed while the query ran
+		return []item{{ID: "old"}}, nil
+	})
+	require.NoError(t, err)
+
+	list, err := Fetch(qc, q, func() ([]item, error) { return []item{{ID: "new"}}, nil })
+	require.NoError(t, err)
+	assert.Equal(t, []item{{ID: "new"}}, list)
+}
+
+// TestFetch_Errors tests that errors aren't cached, and that a nil cache runs every query.
+func TestFetch_Errors(t *testing.T) {
+	qc := New(cache.NewMemoryStore(), time.Minute)
+	q := Query{Name: "items.count"}
+	_, err := Fetch(qc, q, func() (int, error) { return 0, errors.New("database down") })
+	assert.Error(t, err)
+	count, err := Fetch(qc, q, func() (int, error) { return 3, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	var disabled *Cache
+	loads := 0
+	for range 2 {
+		Fetch(disabled, q, func() (int, error) { loads++; return 1, nil })
+	}
+	assert.Equal(t, 2, loads)
+	assert.NoError(t, disabled.Invalidate("items:t1"))
+	assert.Nil(t, New(nil, time.Minute))
+}
@@ -0,0 +1,151 @@
+package realtime
+
+// Backfill of changes missed while disconnected.
+//
+// Realtime only delivers changes while the connection is up: rows changed during a reconnect
+// would never reach the cache or the WebSocket clients. The subscriber remembers the commit
+// timestamp of the last change it processed (the checkpoint, see checkpoint.go). After each
+// reconnect, and on startup when a checkpoint was saved, it asks the Supabase REST API for the
+// rows of every subscribed table whose REALTIME_BACKFILL_COLUMN is at or after the checkpoint and
+// replays them through handleChange, the same path live changes take.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/tenant"
+)
+
+// backfillOverlap is subtracted from the checkpoint when querying. updated_at is usually set
+// with now(), the start of the transaction, which is earlier than its commit timestamp; the
+// margin also absorbs clock differences. Replaying a row twice is harmless.
+const backfillOverlap = 5 * time.Second
+
+// commitTimestamp returns the commit_timestamp of a postgres_changes payload (either shape,
+// see parsePriceUpdate).
+func commitTimestamp(payload map[string]interface{}) (time.Time, bool) {
+	if data, ok := payload["data"].(map[string]interface{}); ok {
+		payload = data
+	}
+	value, _ := payload["commit_timestamp"].(string)
+	return parseTimestamp(value)
+}
+
+// parseTimestamp parses a Postgres timestamp as returned by Realtime and PostgREST
+// ("2025-01-01T12:00:00.123Z", "2025-01-01T12:00:00.123456+00:00"). Timestamps without a
+// time zone are taken as UTC.
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// backfill replays the rows changed since the checkpoint and returns how many it replayed.
+// It does nothing without a checkpoint or with REALTIME_BACKFILL_LIMIT=0. A table that can't be
+// read doesn't stop the others; the first error is returned.
+func backfill(ctx context.Context, supabaseURL, supabaseKey string) (int, error) {
+	cfg := current()
+	since := lastCheckpoint()
+	if cfg.BackfillLimit <= 0 || since.IsZero() {
+		return 0, nil
+	}
+	column := backfillColumn(cfg)
+
+	replayed := 0
+	var firstErr error
+	for _, subscription := range subscriptions() {
+		// Step 1: Fetch the rows, newest first, so a truncated backfill still has the latest values
+		rows, err := fetchChangedRows(ctx, supabaseURL, supabaseKey, subscription, column, since.Add(-backfillOverlap), cfg.BackfillLimit)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", subscription.Name, err)
+			}
+			continue
+		}
+		if len(rows) == cfg.BackfillLimit {
+			slog.Warn("Realtime backfill hit REALTIME_BACKFILL_LIMIT, older changes were skipped",
+				"subscription", subscription.Name, "limit", cfg.BackfillLimit, "since", since.Format(time.RFC3339))
+		}
+
+		// Step 2: Replay them oldest first, like live changes
+		for i := len(rows) - 1; i >= 0; i-- {
+			row := rows[i]
+			handleChange(subscription, map[string]interface{}{"eventType": "UPDATE", "new": row})
+			if value, ok := row[column].(string); ok {
+				if t, ok := parseTimestamp(value); ok {
+					advanceCheckpoint(t)
+				}
+			}
+		}
+
+		metrics.RealtimeBackfilledRows.Add(float64(len(rows)))
+		replayed += len(rows)
+	}
+	return replayed, firstErr
+}
+
+// fetchChangedRows returns up to limit rows of the subscription's table whose column is at or
+// after since, newest first, limited to its filter and the tenants this instance serves.
+func fetchChangedRows(ctx context.Context, supabaseURL, supabaseKey string, subscription Subscription, column string, since time.Time, limit int) ([]map[string]interface{}, error) {
+	// Step 1: Build the PostgREST query (Realtime filters use the PostgREST syntax)
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set(column, "gte."+since.UTC().Format(time.RFC3339Nano))
+	params.Set("order", column+".desc")
+	params.Set("limit", strconv.Itoa(limit))
+	if tenants := getTenantFilter(); len(tenants) > 0 {
+		params.Set(tenant.Column, "in.("+strings.Join(tenants, ",")+")")
+	}
+	if filterColumn, condition, ok := strings.Cut(subscription.Filter, "="); ok {
+		params.Set(filterColumn, condition)
+	}
+	endpoint := strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + subscription.Table + "?" + params.Encode()
+
+	// Step 2: Send the request with the same key as the Realtime connection
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", supabaseKey)
+	req.Header.Set("Authorization", "Bearer "+supabaseKey)
+	if subscription.Schema != "public" {
+		req.Header.Set("Accept-Profile", subscription.Schema) // PostgREST serves other schemas on request
+	}
+
+	resp, err := egress.NewClient(30 * time.Second).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	// Step 3: Decode the rows, keeping prices exact (see readMessage)
+	var rows []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to parse rows: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,131 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setCheckpoint replaces the checkpoint for one test, as if nothing had been saved yet.
+func setCheckpoint(t *testing.T, at time.Time) {
+	t.Helper()
+	checkpointMu.Lock()
+	original, originalSaved, originalSavedAt := checkpoint, saved, savedAt
+	checkpoint, saved, savedAt = at, time.Time{}, time.Time{}
+	checkpointMu.Unlock()
+	t.Cleanup(func() {
+		checkpointMu.Lock()
+		checkpoint, saved, savedAt = original, originalSaved, originalSavedAt
+		checkpointMu.Unlock()
+	})
+}
+
+// TestBackfill tests that rows changed since the checkpoint are replayed into the cache and
+// move the checkpoint forward.
+func TestBackfill(t *testing.T) {
+	var query http.Header
+	var params map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/v1/artist_metrics", r.URL.Path)
+		query = r.Header
+		params = map[string]string{}
+		for name := range r.URL.Query() {
+			params[name] = r.URL.Query().Get(name)
+		}
+		// Newest first, as requested
+		w.Write([]byte(`[
+			{"artist_id": "a1", "price": 12.50, "tenant_id": "acme", "updated_at": "2025-01-01T12:00:09.5+00:00"},
+			{"artist_id": "a1", "price": 11.00, "tenant_id": "acme", "updated_at": "2025-01-01T12:00:08+00:00"},
+			{"artist_id": "a2", "price": 7.25, "tenant_id": "acme", "updated_at": "2025-01-01T12:00:07"}
+		]`))
+	}))
+	defer server.Close()
+
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	store := cache.NewMemoryStore()
+	cache.SetDefault(store)
+
+	original := current()
+	defer configure(original)
+	configure(config.Realtime{TenantIDs: []string{"acme"}, BackfillColumn: "updated_at", BackfillLimit: 10})
+	setCheckpoint(t, time.Date(2025, 1, 1, 12, 0, 5, 0, time.UTC))
+
+	replayed, err := backfill(context.Background(), server.URL, "anon")
+	require.NoError(t, err)
+	assert.Equal(t, 3, replayed)
+
+	assert.Equal(t, "anon", query.Get("apikey"))
+	assert.Equal(t, "gte.2025-01-01T12:00:00Z", params["updated_at"])
+	assert.Equal(t, "updated_at.desc", params["order"])
+	assert.Equal(t, "10", params["limit"])
+	assert.Equal(t, "in.(acme)", params["tenant_id"])
+
+	// The newest row wins
+	value, err := store.Get("tenant:acme:price:a1")
+	require.NoError(t, err)
+	assert.Equal(t, "12.5", value)
+	value, err = store.Get("tenant:acme:price:a2")
+	require.NoError(t, err)
+	assert.Equal(t, "7.25", value)
+
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 9, 5e8, time.UTC), lastCheckpoint())
+}
+
+// TestBackfill_Disabled tests that nothing is fetched before the first subscription or with a
+// zero limit.
+func TestBackfill_Disabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected backfill request")
+	}))
+	defer server.Close()
+
+	original := current()
+	defer configure(original)
+
+	configure(config.Realtime{BackfillLimit: 10})
+	setCheckpoint(t, time.Time{})
+	replayed, err := backfill(context.Background(), server.URL, "anon")
+	require.NoError(t, err)
+	assert.Zero(t, replayed)
+
+	configure(config.Realtime{BackfillLimit: 0})
+	setCheckpoint(t, time.Now())
+	replayed, err = backfill(context.Background(), server.URL, "anon")
+	require.NoError(t, err)
+	assert.Zero(t, replayed)
+}
+
+// TestHandleMessage_Checkpoint tests that processed changes advance the checkpoint.
+func TestHandleMessage_Checkpoint(t *testing.T) {
+	setCheckpoint(t, time.Time{})
+
+	handleMessage(map[string]interface{}{
+		"event": "postgres_changes",
+		"payload": map[string]interface{}{"data": map[string]interface{}{
+			"type":             "UPDATE",
+			"commit_timestamp": "2025-01-01T12:00:05.000Z",
+			"record":           map[string]interface{}{"artist_id": "a1", "price": "1.00"},
+		}},
+	})
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 5, 0, time.UTC), lastCheckpoint())
+
+	// An older commit doesn't move it back
+	handleMessage(map[string]interface{}{
+		"event": "postgres_changes",
+		"payload": map[string]interface{}{
+			"eventType":        "UPDATE",
+			"commit_timestamp": "2025-01-01T12:00:01Z",
+			"new":              map[string]interface{}{"artist_id": "a1", "price": "1.00"},
+		},
+	})
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 5, 0, time.UTC), lastCheckpoint())
+}
@@ -0,0 +1,241 @@
+package realtime
+
+// The checkpoint: the commit timestamp of the last change processed, where the backfill resumes.
+//
+// It is kept in memory and, with REALTIME_CHECKPOINT_STORE (redis by default when the cache is
+// set, or postgres), saved at most every REALTIME_CHECKPOINT_INTERVAL and when the connection
+// drops. Each subscription starts from the later of the in-memory and the saved checkpoint, so a
+// restarted replica or a newly elected leader catches up on the changes made while no replica
+// was consuming, instead of starting from scratch.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+)
+
+// checkpointTTL is how long a saved checkpoint outlives the last save in the cache. Older
+// checkpoints would replay more than REALTIME_BACKFILL_LIMIT rows anyway.
+const checkpointTTL = 30 * 24 * time.Hour
+
+// checkpoint is the commit timestamp of the last change processed (zero before the first
+// subscription), and saved the value last written to the store.
+var (
+	checkpointMu sync.Mutex
+	checkpoint   time.Time
+	saved        time.Time
+	savedAt      time.Time
+)
+
+// lastCheckpoint returns the checkpoint.
+func lastCheckpoint() time.Time {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+	return checkpoint
+}
+
+// advanceCheckpoint moves the checkpoint to t if it is later.
+func advanceCheckpoint(t time.Time) {
+	checkpointMu.Lock()
+	if t.After(checkpoint) {
+		checkpoint = t
+	}
+	checkpointMu.Unlock()
+}
+
+// checkpointStore persists checkpoints by name (see checkpointName).
+type checkpointStore interface {
+	// load returns the saved checkpoint, zero if there is none.
+	load(ctx context.Context, name string) (time.Time, error)
+	save(ctx context.Context, name string, at time.Time) error
+}
+
+// newCheckpointStore returns the store configured by REALTIME_CHECKPOINT_STORE, nil for none.
+func newCheckpointStore() checkpointStore {
+	cfg := current()
+	switch cfg.CheckpointStore {
+	case config.CheckpointRedis:
+		return cacheCheckpoints{}
+	case config.CheckpointPostgres:
+		return newPostgresCheckpoints(cfg.SupabaseURL, cfg.ServiceRoleKey)
+	default:
+		return nil
+	}
+}
+
+// checkpointName is the name the checkpoint is saved under: the table, plus the tenants for
+// replicas that only consume some (they see different changes).
+func checkpointName() string {
+	name := "artist_metrics"
+	if filter := getTenantFilter(); len(filter) > 0 {
+		name += ":" + strings.Join(filter, ",")
+	}
+	return name
+}
+
+// restoreCheckpoint advances the checkpoint to the saved one, if it is later.
+func restoreCheckpoint(ctx context.Context) {
+	store := newCheckpointStore()
+	if store == nil {
+		return
+	}
+	at, err := store.load(ctx, checkpointName())
+	if err != nil {
+		slog.Warn("Failed to load the Realtime checkpoint", "error", err)
+		return
+	}
+	if !at.IsZero() {
+		advanceCheckpoint(at)
+		checkpointMu.Lock()
+		if at.After(saved) {
+			saved = at
+		}
+		checkpointMu.Unlock()
+	}
+}
+
+// persistCheckpoint saves the checkpoint if it moved since the last save, and (unless force) the
+// last save is at least REALTIME_CHECKPOINT_INTERVAL old.
+func persistCheckpoint(ctx context.Context, force bool) {
+	store := newCheckpointStore()
+	if store == nil {
+		return
+	}
+
+	checkpointMu.Lock()
+	at := checkpoint
+	due := at.After(saved) && (force || time.Since(savedAt) >= current().CheckpointInterval)
+	checkpointMu.Unlock()
+	if !due {
+		return
+	}
+
+	if err := store.save(ctx, checkpointName(), at); err != nil {
+		slog.Warn("Failed to save the Realtime checkpoint", "error", err)
+		return
+	}
+	checkpointMu.Lock()
+	if at.After(saved) {
+		saved = at
+	}
+	savedAt = time.Now()
+	checkpointMu.Unlock()
+}
+
+// cacheCheckpoints saves checkpoints in the cache under "realtime:checkpoint:<name>".
+type cacheCheckpoints struct{}
+
+func (cacheCheckpoints) load(ctx context.Context, name string) (time.Time, error) {
+	store := cache.GetClient()
+	if store == nil {
+		return time.Time{}, fmt.Errorf("cache not initialized")
+	}
+	value, err := store.Get("realtime:checkpoint:" + name)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	at, ok := parseTimestamp(value)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid checkpoint %q", value)
+	}
+	return at, nil
+}
+
+func (cacheCheckpoints) save(ctx context.Context, name string, at time.Time) error {
+	store := cache.GetClient()
+	if store == nil {
+		return fmt.Errorf("cache not initialized")
+	}
+	return store.Set("realtime:checkpoint:"+name, at.UTC().Format(time.RFC3339Nano), checkpointTTL)
+}
+
+// postgresCheckpoints saves checkpoints in the realtime_checkpoints table (see schema.sql)
+// through the Supabase REST API, with the service role key.
+type postgresCheckpoints struct {
+	baseURL    string
+	serviceKey string
+	client     *http.Client
+}
+
+// newPostgresCheckpoints creates a store for the given Supabase project.
+func newPostgresCheckpoints(supabaseURL, serviceKey string) *postgresCheckpoints {
+	return &postgresCheckpoints{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/realtime_checkpoints",
+		serviceKey: serviceKey,
+		client:     egress.NewClient(5 * time.Second),
+	}
+}
+
+func (p *postgresCheckpoints) load(ctx context.Context, name string) (time.Time, error) {
+	params := url.Values{}
+	params.Set("select", "committed_at")
+	params.Set("name", "eq."+name)
+
+	var rows []struct {
+		CommittedAt string `json:"committed_at"`
+	}
+	if err := p.do(ctx, "GET", p.baseURL+"?"+params.Encode(), nil, &rows); err != nil {
+		return time.Time{}, err
+	}
+	if len(rows) == 0 {
+		return time.Time{}, nil
+	}
+	at, ok := parseTimestamp(rows[0].CommittedAt)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid checkpoint %q", rows[0].CommittedAt)
+	}
+	return at, nil
+}
+
+func (p *postgresCheckpoints) save(ctx context.Context, name string, at time.Time) error {
+	body, err := json.Marshal(map[string]string{"name": name, "committed_at": at.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	// Upsert on the primary key
+	return p.do(ctx, "POST", p.baseURL+"?on_conflict=name", body, nil)
+}
+
+// do sends a request and decodes the response into out (if not nil).
+func (p *postgresCheckpoints) do(ctx context.Context, method, endpoint string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", p.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+p.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Prefer", "resolution=merge-duplicates,return=minimal")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckpoint_Cache tests that the checkpoint is saved to the cache at most once per interval
+// and restored by the next process.
+func TestCheckpoint_Cache(t *testing.T) {
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	store := cache.NewMemoryStore()
+	cache.SetDefault(store)
+
+	original := current()
+	defer configure(original)
+	configure(config.Realtime{TenantIDs: []string{"acme"}, CheckpointStore: config.CheckpointRedis, CheckpointInterval: time.Hour})
+
+	first := time.Date(2025, 1, 1, 12, 0, 5, 0, time.UTC)
+	setCheckpoint(t, first)
+	persistCheckpoint(context.Background(), false)
+	value, err := store.Get("realtime:checkpoint:artist_metrics:acme")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01-01T12:00:05Z", value)
+
+	// Within the interval only a forced save writes
+	advanceCheckpoint(first.Add(time.Second))
+	persistCheckpoint(context.Background(), false)
+	value, _ = store.Get("realtime:checkpoint:artist_metrics:acme")
+	assert.Equal(t, "2025-01-01T12:00:05Z", value)
+	persistCheckpoint(context.Background(), true)
+	value, _ = store.Get("realtime:checkpoint:artist_metrics:acme")
+	assert.Equal(t, "2025-01-01T12:00:06Z", value)
+
+	// A restarted process starts from the saved checkpoint
+	setCheckpoint(t, time.Time{})
+	restoreCheckpoint(context.Background())
+	assert.Equal(t, first.Add(time.Second), lastCheckpoint())
+
+	// A later in-memory checkpoint wins over an older saved one
+	setCheckpoint(t, first.Add(time.Minute))
+	restoreCheckpoint(context.Background())
+	assert.Equal(t, first.Add(time.Minute), lastCheckpoint())
+}
+
+// TestCheckpoint_Postgres tests the realtime_checkpoints table store.
+func TestCheckpoint_Postgres(t *testing.T) {
+	var mu sync.Mutex
+	rows := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/v1/realtime_checkpoints", r.URL.Path)
+		assert.Equal(t, "Bearer service", r.Header.Get("Authorization"))
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case "POST":
+			assert.Equal(t, "name", r.URL.Query().Get("on_conflict"))
+			assert.Contains(t, r.Header.Get("Prefer"), "resolution=merge-duplicates")
+			var row map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&row))
+			rows[row["name"]] = row["committed_at"]
+			w.WriteHeader(http.StatusCreated)
+		case "GET":
+			name := r.URL.Query().Get("name")[len("eq."):]
+			if committed, ok := rows[name]; ok {
+				json.NewEncoder(w).Encode([]map[string]string{{"committed_at": committed}})
+				return
+			}
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	store := newPostgresCheckpoints(server.URL, "service")
+	at, err := store.load(context.Background(), "artist_metrics")
+	require.NoError(t, err)
+	assert.True(t, at.IsZero())
+
+	committed := time.Date(2025, 1, 1, 12, 0, 5, 250e6, time.UTC)
+	require.NoError(t, store.save(context.Background(), "artist_metrics", committed))
+	at, err = store.load(context.Background(), "artist_metrics")
+	require.NoError(t, err)
+	assert.Equal(t, committed, at)
+}
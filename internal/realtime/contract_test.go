@@ -0,0 +1,100 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/testutil/fixtures"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const realtimeFixturePath = "testdata/supabase/realtime_artist_metrics.json"
+
+// TestRealtime_Contract replays recorded Supabase Realtime messages through the subscriber.
+// Run with SUPABASE_RECORD=1 (and real SUPABASE_URL/SUPABASE_ANON_KEY) to capture new events;
+// change some artist_metrics rows while it records (SUPABASE_RECORD_DURATION, default 30s).
+func TestRealtime_Contract(t *testing.T) {
+	if fixtures.Recording() {
+		recordRealtimeFixture(t)
+	}
+
+	fixture, err := fixtures.LoadRealtime(realtimeFixturePath)
+	require.NoError(t, err)
+	messages, err := fixture.Decode()
+	require.NoError(t, err)
+
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	store := cache.NewMemoryStore()
+	cache.SetDefault(store)
+
+	// Every postgres_changes event must parse (or be a deliberately ignored event type)
+	var lastPrices = make(map[string]decimal.Decimal)
+	for i, message := range messages {
+		if message["event"] != "postgres_changes" {
+			continue
+		}
+
+		payload, ok := message["payload"].(map[string]interface{})
+		require.True(t, ok, "message %d: payload must be an object", i)
+
+		update, err := parsePriceUpdate(payload)
+		if errors.Is(err, errIgnoredEvent) {
+			continue
+		}
+		require.NoError(t, err, "message %d: payload shape changed", i)
+		lastPrices[update.ArtistID] = update.Price
+
+		handleMessage(message)
+	}
+	require.NotEmpty(t, lastPrices, "fixture must contain at least one INSERT/UPDATE")
+
+	// The cache must hold the latest price for every artist seen
+	for artistID, price := range lastPrices {
+		cached, err := store.Get("price:" + artistID)
+		require.NoError(t, err)
+		assert.Equal(t, formatPrice(price), cached)
+	}
+}
+
+// recordRealtimeFixture connects to real Supabase Realtime and saves every message received.
+func recordRealtimeFixture(t *testing.T) {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	supabaseKey := os.Getenv("SUPABASE_ANON_KEY")
+	if supabaseURL == "" || supabaseKey == "" {
+		t.Skip("SUPABASE_RECORD=1 requires SUPABASE_URL and SUPABASE_ANON_KEY")
+	}
+
+	duration := 30 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("SUPABASE_RECORD_DURATION")); err == nil {
+		duration = d
+	}
+
+	conn, _, err := connectToRealtime(t.Context(), supabaseURL, supabaseKey)
+	require.NoError(t, err)
+	defer conn.Close()
+	prices, _ := priceSubscription()
+	require.NoError(t, subscribeToTable(conn, prices, "1"))
+
+	fixture := &fixtures.RealtimeFixture{
+		Description: "Realtime contract for artist_metrics. Re-record with SUPABASE_RECORD=1 go test ./internal/realtime -run Contract",
+	}
+	conn.SetReadDeadline(time.Now().Add(duration))
+	for {
+		var raw json.RawMessage
+		if err := conn.ReadJSON(&raw); err != nil {
+			break // Deadline reached (or connection closed)
+		}
+		fixture.Messages = append(fixture.Messages, raw)
+	}
+
+	require.NoError(t, fixture.Save(realtimeFixturePath))
+	t.Logf("recorded %d realtime messages", len(fixture.Messages))
+}
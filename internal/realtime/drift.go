@@ -0,0 +1,191 @@
+package realtime
+
+// Schema drift detection.
+//
+// If a subscribed table loses a column the subscriber reads (e.g. price is renamed), every change
+// fails to parse and prices silently stop updating. Every REALTIME_SCHEMA_CHECK_INTERVAL, and
+// shortly after a change fails to parse, the subscriber reads the tables' columns from the
+// PostgREST OpenAPI description and compares them with the ones it needs. Missing columns are
+// logged as an error, counted in realtime_schema_missing_columns and mark the realtime_schema
+// dependency down, so /healthz reports "degraded" and price responses are flagged.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/status"
+	"boilerplate/internal/tenant"
+)
+
+// schemaRecheckDelay is the least time between a check and one triggered by a failed parse.
+const schemaRecheckDelay = time.Minute
+
+// schemaCheckRequests wakes the schema watcher after a change failed to parse.
+var schemaCheckRequests = make(chan struct{}, 1)
+
+// requestSchemaCheck asks the watcher to check the schema soon (without blocking).
+func requestSchemaCheck() {
+	select {
+	case schemaCheckRequests <- struct{}{}:
+	default:
+	}
+}
+
+// expectedColumns returns the columns of the subscription's table the subscriber reads: its
+// mapped columns (sorted; artist_id and price first for prices), the tenant column and the
+// backfill column.
+func expectedColumns(subscription Subscription) []string {
+	cfg := current()
+	var columns []string
+	if subscription.Name == config.PricesSubscription {
+		artistIDColumn, priceColumn := priceColumns()
+		columns = append(columns, artistIDColumn, priceColumn)
+	} else {
+		for _, column := range subscription.Columns {
+			if !slices.Contains(columns, column) {
+				columns = append(columns, column)
+			}
+		}
+		sort.Strings(columns)
+	}
+	if len(getTenantFilter()) > 0 {
+		columns = append(columns, tenant.Column)
+	}
+	if cfg.BackfillLimit > 0 && cfg.BackfillColumn != "" {
+		columns = append(columns, cfg.BackfillColumn)
+	}
+	return columns
+}
+
+// watchSchema checks the schema now, every interval and when requested, until ctx is done.
+func watchSchema(ctx context.Context, supabaseURL, supabaseKey string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	checkSchema(ctx, supabaseURL, supabaseKey)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-schemaCheckRequests:
+			if time.Since(lastCheck) < schemaRecheckDelay {
+				continue
+			}
+		}
+		lastCheck = time.Now()
+		checkSchema(ctx, supabaseURL, supabaseKey)
+	}
+}
+
+// checkSchema compares the columns of every subscribed table with the expected ones and reports
+// drift. It returns the missing columns. Tables whose columns can't be read are not reported.
+func checkSchema(ctx context.Context, supabaseURL, supabaseKey string) []string {
+	var missing []string
+	var problems []error
+	for _, subscription := range subscriptions() {
+		table := subscription.Table
+
+		// Step 1: Read the table's columns
+		columns, found, err := fetchColumns(ctx, supabaseURL, supabaseKey, subscription.Schema, table)
+		if err != nil {
+			slog.Warn("Failed to check the table schema", "table", table, "error", err)
+			continue
+		}
+
+		// Step 2: Compare them with the ones the subscriber reads
+		var tableMissing []string
+		for _, column := range expectedColumns(subscription) {
+			if !found || !columns[column] {
+				tableMissing = append(tableMissing, column)
+			}
+		}
+		metrics.RealtimeSchemaMissingColumns.WithLabelValues(table).Set(float64(len(tableMissing)))
+		if len(tableMissing) == 0 {
+			continue
+		}
+
+		if !found {
+			err = fmt.Errorf("table %s not found (or not readable with the anon key)", table)
+		} else {
+			err = fmt.Errorf("table %s is missing column(s) %s", table, strings.Join(tableMissing, ", "))
+		}
+		slog.Error("Schema drift: changes can't be processed", "subscription", subscription.Name, "error", err,
+			"columns_found", strings.Join(sortedKeys(columns), ", "))
+		missing = append(missing, tableMissing...)
+		problems = append(problems, err)
+	}
+
+	// Step 3: Report
+	if len(problems) == 0 {
+		status.SetUp(status.RealtimeSchema)
+		return nil
+	}
+	status.SetDown(status.RealtimeSchema, errors.Join(problems...))
+	return missing
+}
+
+// fetchColumns returns the columns of schema.table from the PostgREST OpenAPI description
+// (GET /rest/v1/), and false if the table isn't in it.
+func fetchColumns(ctx context.Context, supabaseURL, supabaseKey, schema, table string) (map[string]bool, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(supabaseURL, "/")+"/rest/v1/", nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", supabaseKey)
+	req.Header.Set("Authorization", "Bearer "+supabaseKey)
+	req.Header.Set("Accept", "application/openapi+json")
+	if schema != "" && schema != "public" {
+		req.Header.Set("Accept-Profile", schema)
+	}
+
+	resp, err := egress.NewClient(10 * time.Second).Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, false, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var spec struct {
+		Definitions map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		return nil, false, fmt.Errorf("failed to parse OpenAPI description: %w", err)
+	}
+
+	definition, found := spec.Definitions[table]
+	columns := make(map[string]bool, len(definition.Properties))
+	for column := range definition.Properties {
+		columns[column] = true
+	}
+	return columns, found, nil
+}
+
+// sortedKeys returns the keys of set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
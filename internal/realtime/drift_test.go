@@ -0,0 +1,52 @@
+package realtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/status"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckSchema tests that missing columns mark the realtime_schema dependency down, and that
+// it recovers once they are back.
+func TestCheckSchema(t *testing.T) {
+	status.Reset()
+	defer status.Reset()
+
+	spec := `{"definitions": {"artist_metrics": {"properties": {"artist_id": {}, "amount": {}, "updated_at": {}}}}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/v1/", r.URL.Path)
+		assert.Equal(t, "anon", r.Header.Get("apikey"))
+		io.WriteString(w, spec)
+	}))
+	defer server.Close()
+
+	original := current()
+	defer configure(original)
+	configure(config.Realtime{TenantIDs: []string{"acme"}, BackfillColumn: "updated_at", BackfillLimit: 10})
+
+	// price was renamed to amount, and the tenant filter needs tenant_id
+	assert.Equal(t, []string{"price", "tenant_id"}, checkSchema(context.Background(), server.URL, "anon"))
+	dependency, ok := status.Get(status.RealtimeSchema)
+	require.True(t, ok)
+	assert.Equal(t, status.StateDown, dependency.State)
+	assert.Contains(t, dependency.Error, "missing column(s) price, tenant_id")
+
+	spec = `{"definitions": {"artist_metrics": {"properties": {"artist_id": {}, "price": {}, "tenant_id": {}, "updated_at": {}}}}}`
+	assert.Empty(t, checkSchema(context.Background(), server.URL, "anon"))
+	dependency, _ = status.Get(status.RealtimeSchema)
+	assert.Equal(t, status.StateUp, dependency.State)
+
+	// A missing table is drift too
+	spec = `{"definitions": {}}`
+	assert.Len(t, checkSchema(context.Background(), server.URL, "anon"), 4)
+	dependency, _ = status.Get(status.RealtimeSchema)
+	assert.Contains(t, dependency.Error, "table artist_metrics not found")
+}
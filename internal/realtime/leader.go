@@ -0,0 +1,54 @@
+package realtime
+
+import (
+	"strings"
+	"sync"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/leader"
+)
+
+// leaderKey is the lock key replicas campaign for. Replicas serving different tenants
+// (REALTIME_TENANT_IDS) elect a leader per tenant set.
+const leaderKey = "realtime:leader"
+
+// currentElector is this replica's elector, nil without leader election.
+var (
+	electorMu      sync.Mutex
+	currentElector *leader.Elector
+)
+
+// newElector returns an elector when REALTIME_LEADER_ELECTION is on and the cache is shared
+// between replicas, nil otherwise (every replica consumes Realtime).
+func newElector() *leader.Elector {
+	cfg := current()
+	if !cfg.LeaderElection {
+		return nil
+	}
+	locker := cache.GetLocker()
+	if locker == nil {
+		return nil
+	}
+
+	key := leaderKey
+	if filter := getTenantFilter(); len(filter) > 0 {
+		key += ":" + strings.Join(filter, ",")
+	}
+	return leader.New(locker, key, leader.InstanceID(), cfg.LeaderTTL)
+}
+
+// setElector records this replica's elector.
+func setElector(elector *leader.Elector) {
+	electorMu.Lock()
+	currentElector = elector
+	electorMu.Unlock()
+}
+
+// IsLeader reports whether this replica consumes Realtime: always true without leader election.
+func IsLeader() bool {
+	electorMu.Lock()
+	elector := currentElector
+	electorMu.Unlock()
+
+	return elector == nil || elector.IsLeader()
+}
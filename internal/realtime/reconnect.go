@@ -0,0 +1,230 @@
+package realtime
+
+// Keeping the Realtime connection up.
+//
+// Supabase Realtime speaks the Phoenix channels protocol and closes connections that don't send
+// a heartbeat for about a minute, so every connection sends one every REALTIME_HEARTBEAT_INTERVAL.
+// A heartbeat still unanswered when the next is due means the connection is dead even if the
+// socket looks open (e.g. a NAT dropped it); it is closed so the subscriber reconnects.
+//
+// One supervisor loop owns the connection: it runs a session (connect, subscribe, backfill,
+// listen), and when the session ends waits with exponential backoff and jitter before the next.
+// Many replicas reconnecting after the same outage spread out instead of retrying in lockstep.
+// A session that stayed up for stableSession resets the backoff. After REALTIME_MAX_RECONNECTS
+// failed reconnects in a row the supervisor gives up until POST /api/admin/realtime/restart.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/status"
+
+	"github.com/gorilla/websocket"
+)
+
+// stableSession is how long a session must stay up to count as a successful reconnect.
+const stableSession = time.Minute
+
+// heartbeatWriteTimeout bounds a single heartbeat write.
+const heartbeatWriteTimeout = 10 * time.Second
+
+// handshakeTimeout bounds connecting to Realtime (TCP, TLS and the WebSocket handshake), so a
+// hung connection attempt doesn't block the supervisor.
+const handshakeTimeout = 15 * time.Second
+
+// errGaveUp is the status error reported after the supervisor gives up.
+var errGaveUp = errors.New("gave up reconnecting (REALTIME_MAX_RECONNECTS)")
+
+// Restart requests for a waiting supervisor (see wakeSupervisor).
+var (
+	restartRequests = make(chan struct{}, 1)
+	supervisorIdle  atomic.Bool // Waiting to reconnect, or given up
+)
+
+// supervise runs sessions until ctx is cancelled (Stop, or the leadership lost), reconnecting with
+// backoff in between.
+func supervise(ctx context.Context, supabaseURL, supabaseKey string) {
+	cfg := current()
+	retry := newBackoff(cfg.ReconnectMinDelay, cfg.ReconnectMaxDelay)
+	failures := 0
+
+	for {
+		// A restart requested while connected already happened by closing the connection
+		select {
+		case <-restartRequests:
+		default:
+		}
+
+		up, err := runSession(ctx, supabaseURL, supabaseKey)
+		if ctx.Err() != nil {
+			slog.Info("Realtime subscription stopped")
+			return
+		}
+		status.SetDown(status.Realtime, err)
+
+		// Step 1: A session that stayed up starts a new series of attempts
+		if up >= stableSession {
+			retry.reset()
+			failures = 0
+		}
+		failures++
+
+		// Step 2: Give up after too many failed reconnects, until an admin restarts it
+		if cfg.MaxReconnects > 0 && failures > cfg.MaxReconnects {
+			slog.Error("Giving up on Supabase Realtime, restart it with POST /api/admin/realtime/restart",
+				"failed_reconnects", failures-1, "error", err)
+			status.SetDown(status.Realtime, errGaveUp)
+			if !waitForRestart(ctx, nil) {
+				return
+			}
+			retry.reset()
+			failures = 0
+			metrics.RealtimeReconnects.Inc()
+			continue
+		}
+
+		// Step 3: Wait, then reconnect
+		delay := retry.next()
+		slog.Error("Realtime connection lost, reconnecting", "error", err, "delay", delay.String(), "attempt", failures)
+		if !waitForRestart(ctx, time.After(delay)) {
+			return
+		}
+		metrics.RealtimeReconnects.Inc()
+	}
+}
+
+// waitForRestart blocks until timeout fires (nil: never), a restart is requested or ctx is
+// cancelled. It returns false in the last case.
+func waitForRestart(ctx context.Context, timeout <-chan time.Time) bool {
+	supervisorIdle.Store(true)
+	defer supervisorIdle.Store(false)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timeout:
+	case <-restartRequests:
+	}
+	return true
+}
+
+// wakeSupervisor makes a waiting supervisor reconnect now. It returns false if none is waiting.
+func wakeSupervisor() bool {
+	if !supervisorIdle.Load() {
+		return false
+	}
+	select {
+	case restartRequests <- struct{}{}:
+	default: // Already requested
+	}
+	return true
+}
+
+// backoff computes reconnect delays: min, doubling with every attempt up to max, each randomly
+// shortened by up to half (jitter).
+type backoff struct {
+	min, max time.Duration
+	attempt  int
+	jitter   func() float64 // Returns [0, 1); overridable in tests
+}
+
+// newBackoff creates a backoff starting at min and capped at max.
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max, jitter: rand.Float64}
+}
+
+// next returns the delay before the next attempt.
+func (b *backoff) next() time.Duration {
+	delay := b.min
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.max)
+	b.attempt++
+	return delay - time.Duration(b.jitter()*float64(delay)/2)
+}
+
+// reset starts over at min.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
+
+// heartbeat sends Phoenix heartbeats on one connection and closes it when one goes unanswered.
+// It is the connection's only writer once the subscription is joined.
+type heartbeat struct {
+	conn    *websocket.Conn
+	mu      sync.Mutex
+	sent    int
+	pending string // Ref of the unanswered heartbeat, "" if there is none
+}
+
+// newHeartbeat creates the heartbeat of conn.
+func newHeartbeat(conn *websocket.Conn) *heartbeat {
+	return &heartbeat{conn: conn}
+}
+
+// run sends a heartbeat every interval until ctx is cancelled or the connection is dropped.
+func (h *heartbeat) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := h.beat(); err != nil {
+			slog.Warn("Realtime heartbeat failed, dropping the connection", "error", err)
+			h.conn.Close()
+			return
+		}
+	}
+}
+
+// beat sends the next heartbeat, or fails if the previous one was never answered.
+func (h *heartbeat) beat() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pending != "" {
+		return fmt.Errorf("no reply to heartbeat %s", h.pending)
+	}
+
+	h.sent++
+	h.pending = "hb-" + strconv.Itoa(h.sent)
+	h.conn.SetWriteDeadline(time.Now().Add(heartbeatWriteTimeout))
+	return h.conn.WriteJSON(map[string]interface{}{
+		"topic":   "phoenix",
+		"event":   "heartbeat",
+		"payload": map[string]interface{}{},
+		"ref":     h.pending,
+	})
+}
+
+// acknowledge reports whether message is a heartbeat reply, and marks the pending heartbeat
+// answered if it is its reply.
+func (h *heartbeat) acknowledge(message map[string]interface{}) bool {
+	topic, _ := message["topic"].(string)
+	event, _ := message["event"].(string)
+	if topic != "phoenix" || event != "phx_reply" {
+		return false
+	}
+
+	ref, _ := message["ref"].(string)
+	h.mu.Lock()
+	if ref == h.pending {
+		h.pending = ""
+	}
+	h.mu.Unlock()
+	return true
+}
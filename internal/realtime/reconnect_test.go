@@ -0,0 +1,143 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/config"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackoff tests that delays double up to the maximum, are shortened by the jitter, and start
+// over after a reset.
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 5*time.Second)
+	b.jitter = func() float64 { return 0 }
+
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delays = append(delays, b.next())
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+
+	b.reset()
+	b.jitter = func() float64 { return 0.5 }
+	assert.Equal(t, 750*time.Millisecond, b.next())
+
+	// Many attempts don't overflow
+	b.attempt = 200
+	assert.Equal(t, 3750*time.Millisecond, b.next())
+}
+
+// fakeRealtime is a Realtime server that accepts connections and hands each to serve.
+func fakeRealtime(t *testing.T, serve func(conn *websocket.Conn)) (url string, connections *atomic.Int32) {
+	t.Helper()
+	connections = &atomic.Int32{}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connections.Add(1)
+		serve(conn)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, connections
+}
+
+// TestHeartbeat tests that heartbeats are sent, answered ones keep the connection, and an
+// unanswered one drops it.
+func TestHeartbeat(t *testing.T) {
+	answer := atomic.Bool{}
+	answer.Store(true)
+	received := make(chan map[string]interface{}, 10)
+	url, _ := fakeRealtime(t, func(conn *websocket.Conn) {
+		for {
+			var message map[string]interface{}
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+			received <- message
+			if answer.Load() {
+				conn.WriteJSON(map[string]interface{}{"topic": "phoenix", "event": "phx_reply", "ref": message["ref"]})
+			}
+		}
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+url[len("http"):], nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	beats := newHeartbeat(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go beats.run(ctx, 20*time.Millisecond)
+
+	ended := make(chan error, 1)
+	go func() { ended <- listenForUpdates(ctx, conn, beats) }()
+
+	first := <-received
+	assert.Equal(t, "phoenix", first["topic"])
+	assert.Equal(t, "heartbeat", first["event"])
+	assert.Equal(t, "hb-1", first["ref"])
+	assert.Equal(t, "hb-2", (<-received)["ref"])
+
+	// Stop answering: the next heartbeat is sent, the one after finds it unanswered
+	answer.Store(false)
+	select {
+	case err := <-ended:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not dropped after an unanswered heartbeat")
+	}
+}
+
+// TestSupervise tests that the supervisor reconnects with backoff, gives up after
+// REALTIME_MAX_RECONNECTS failed reconnects, and starts over on Restart.
+func TestSupervise(t *testing.T) {
+	original := current()
+	configure(config.Realtime{
+		HeartbeatInterval: time.Minute,
+		ReconnectMinDelay: time.Millisecond,
+		ReconnectMaxDelay: 5 * time.Millisecond,
+		MaxReconnects:     2,
+	})
+	t.Cleanup(func() { configure(original) })
+
+	// Every connection is dropped right after the join
+	url, connections := fakeRealtime(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		supervise(ctx, url, "anon")
+		close(done)
+	}()
+
+	// The first connection and two reconnects, then it gives up
+	require.Eventually(t, func() bool { return connections.Load() == 3 && supervisorIdle.Load() }, 2*time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(3), connections.Load())
+
+	require.NoError(t, Restart())
+	require.Eventually(t, func() bool { return connections.Load() == 6 }, 2*time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	assert.ErrorIs(t, Restart(), errNotConnected)
+}
@@ -0,0 +1,11 @@
+-- Realtime checkpoints, written by the backend when REALTIME_CHECKPOINT_STORE=postgres.
+-- Run this in the Supabase SQL editor.
+
+create table if not exists realtime_checkpoints (
+    name         text        primary key,        -- Table, plus ":<tenants>" for tenant-filtered replicas
+    committed_at timestamptz not null,           -- Commit timestamp of the last change processed
+    updated_at   timestamptz not null default now()
+);
+
+-- RLS with no policies: only the service role (used by the backend) can access the table.
+alter table realtime_checkpoints enable row level security;
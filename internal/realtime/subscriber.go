@@ -2,62 +2,179 @@ package realtime
 
 // Package realtime handles Supabase Realtime subscriptions to listen for database changes.
 // When prices change in the artist_metrics table, we cache them in Redis and broadcast to WebSocket clients.
+// Other tables can be subscribed to with REALTIME_SUBSCRIPTIONS (see subscriptions.go).
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"boilerplate/internal/cache"
-	"boilerplate/internal/handlers"
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/events"
+	"boilerplate/internal/lifecycle"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/monitor"
+	"boilerplate/internal/price"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/status"
+	"boilerplate/internal/tenant"
 
 	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
 )
 
 // PriceUpdate represents a price update from the artist_metrics table.
 // This is the message format we send to WebSocket clients.
 type PriceUpdate struct {
-	ArtistID string  `json:"artist_id"` // The ID of the artist
-	Price    float64 `json:"price"`     // The new price
-	Event    string  `json:"event"`     // Type of change: INSERT, UPDATE, or DELETE
+	ArtistID string          `json:"artist_id"`           // The ID of the artist
+	Price    decimal.Decimal `json:"price"`               // The new price, serialized as an exact string ("45.67")
+	Event    string          `json:"event"`               // Type of change: INSERT, UPDATE, or DELETE
+	TenantID string          `json:"tenant_id,omitempty"` // Tenant owning the row (multi-tenant tables only)
 }
 
-// Init initializes the Supabase Realtime client.
-// Currently a placeholder - no initialization needed for raw WebSocket approach.
-func Init() error {
+// currentConn is the live Realtime connection, tracked so Restart can drop it.
+var (
+	currentConnMu sync.Mutex
+	currentConn   *websocket.Conn
+)
+
+// errNotConnected is returned by Restart when there is no live connection to restart.
+var errNotConnected = errors.New("realtime subscriber is not connected")
+
+// settings is the configuration given to Init or Start.
+var (
+	settingsMu sync.Mutex
+	settings   config.Realtime
+)
+
+// configure records the configuration used by the subscriber.
+func configure(cfg config.Realtime) {
+	settingsMu.Lock()
+	settings = cfg
+	settingsMu.Unlock()
+}
+
+// current returns the configuration used by the subscriber.
+func current() config.Realtime {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	return settings
+}
+
+// Init initializes the Supabase Realtime client from cfg.
+// No connection is opened here (see Start); Init only reports the configuration.
+func Init(cfg config.Realtime) error {
+	configure(cfg)
+	if !cfg.Enabled() {
+		startup.Report("realtime", false, "SUPABASE_URL or SUPABASE_ANON_KEY not set")
+		return nil
+	}
+
+	tenants := "all tenants"
+	if filter := getTenantFilter(); len(filter) > 0 {
+		tenants = "tenants " + strings.Join(filter, ",")
+	}
+
+	consumer := "every replica consumes"
+	if cfg.LeaderElection {
+		if cache.GetLocker() == nil {
+			slog.Warn("REALTIME_LEADER_ELECTION=true but the cache is not shared (no REDIS_URL or UPSTASH_REDIS_URL), every replica will consume Realtime")
+		} else {
+			consumer = "leader election (ttl " + cfg.LeaderTTL.String() + ")"
+		}
+	}
+	names := make([]string, 0, len(subscriptions()))
+	for _, subscription := range subscriptions() {
+		names = append(names, subscription.Name+" ("+subscription.Schema+"."+subscription.Table+")")
+	}
+	// One supervisor, with one heartbeat: more means a session or a former leader's supervisor
+	// didn't stop (see internal/monitor)
+	monitor.Expect("realtime.supervisor", 1)
+	monitor.Expect("realtime.heartbeat", 1)
+
+	startup.Report("realtime", true, "Supabase Realtime, "+strings.Join(names, ", ")+", "+tenants+", "+consumer)
 	return nil
 }
 
-// SubscribeToPrices is the main entry point for subscribing to price updates.
-// It sets up the connection to Supabase Realtime and listens for changes.
-func SubscribeToPrices() {
-	// Step 1: Get configuration from environment variables
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	supabaseKey := os.Getenv("SUPABASE_ANON_KEY")
+// subscriber runs the subscription started by Start.
+var subscriber lifecycle.Runner
 
-	if supabaseURL == "" || supabaseKey == "" {
-		log.Println("WARNING: SUPABASE_URL or SUPABASE_ANON_KEY not set, skipping Realtime subscription")
-		return
+// errStillRunning is returned by Start while the previous subscription is still stopping.
+var errStillRunning = errors.New("previous Realtime subscription is still stopping")
+
+// Start is the main entry point for subscribing to price updates: it connects to Supabase
+// Realtime in the background and listens for changes, until Stop.
+func Start(cfg config.Realtime) error {
+	configure(cfg)
+	if !cfg.Enabled() {
+		slog.Warn("SUPABASE_URL or SUPABASE_ANON_KEY not set, skipping Realtime subscription")
+		return nil
 	}
+	if !subscriber.Start(func(ctx context.Context) { subscribe(ctx, cfg) }) {
+		return errStillRunning
+	}
+	return nil
+}
 
-	// Step 2: Make sure Redis cache is initialized
+// Stop closes the subscription started by Start (releasing the leadership with leader election)
+// and waits until ctx ends for it to stop.
+func Stop(ctx context.Context) error {
+	return subscriber.Stop(ctx)
+}
+
+// subscribe sets up the connection to Supabase Realtime and listens for changes until ctx is
+// cancelled.
+func subscribe(ctx context.Context, cfg config.Realtime) {
+	// Step 1: Get the Supabase credentials from the configuration
+	supabaseURL, supabaseKey := cfg.SupabaseURL, cfg.AnonKey
+
+	// Step 2: The cache is initialized by cache.Init; without it we can still broadcast updates
 	if cache.GetClient() == nil {
-		if err := cache.Init(); err != nil {
-			log.Printf("ERROR: Failed to initialize Redis cache: %v", err)
-			// Continue without cache - we can still broadcast updates
-		}
+		slog.Warn("Cache not initialized, prices will be broadcast but not cached")
 	}
 
-	// Step 3: Make sure WebSocket hub is initialized
-	if handlers.GetHub() == nil {
-		handlers.InitHub()
+	// Step 3: Watch for columns the subscriber reads disappearing from the table
+	if cfg.SchemaCheckInterval > 0 {
+		go watchSchema(ctx, supabaseURL, supabaseKey, cfg.SchemaCheckInterval)
 	}
 
-	// Step 4: Start the WebSocket subscription
-	subscribeViaWebSocket(supabaseURL, supabaseKey)
+	// Step 4: With leader election, only the replica holding the lock consumes Realtime;
+	// the others take over if it goes away
+	if elector := newElector(); elector != nil {
+		slog.Info("Realtime leader election enabled", "instance", elector.ID())
+		setElector(elector)
+		var supervisors sync.WaitGroup
+		elector.Run(ctx, func(ctx context.Context) {
+			metrics.RealtimeLeader.Set(1)
+			done := monitor.Track("realtime.supervisor")
+			supervisors.Add(1)
+			go func() {
+				defer supervisors.Done()
+				defer done()
+				supervise(ctx, supabaseURL, supabaseKey)
+			}()
+			<-ctx.Done()
+			metrics.RealtimeLeader.Set(0)
+		})
+		supervisors.Wait()
+		setElector(nil)
+		return
+	}
+
+	// Step 5: Start the WebSocket subscription, reconnecting whenever it drops
+	metrics.RealtimeLeader.Set(1)
+	defer metrics.RealtimeLeader.Set(0)
+	defer monitor.Track("realtime.supervisor")()
+	supervise(ctx, supabaseURL, supabaseKey)
 }
 
 // buildRealtimeURL converts a Supabase HTTP URL to a WebSocket URL for Realtime.
@@ -66,16 +183,17 @@ func buildRealtimeURL(supabaseURL string) string {
 	// Replace https:// with wss:// (WebSocket Secure) or http:// with ws://
 	realtimeURL := strings.Replace(supabaseURL, "https://", "wss://", 1)
 	realtimeURL = strings.Replace(realtimeURL, "http://", "ws://", 1)
-	
+
 	// Add the Realtime WebSocket endpoint path
 	realtimeURL = strings.TrimSuffix(realtimeURL, "/") + "/realtime/v1/websocket"
-	
+
 	return realtimeURL
 }
 
-// connectToRealtime establishes a WebSocket connection to Supabase Realtime.
-// Returns the connection and the full URL with API key, or an error.
-func connectToRealtime(supabaseURL, supabaseKey string) (*websocket.Conn, string, error) {
+// connectToRealtime establishes a WebSocket connection to Supabase Realtime, giving up when ctx
+// is cancelled or after handshakeTimeout. Returns the connection and the full URL with API key,
+// or an error.
+func connectToRealtime(ctx context.Context, supabaseURL, supabaseKey string) (*websocket.Conn, string, error) {
 	// Step 1: Build the WebSocket URL
 	realtimeURL := buildRealtimeURL(supabaseURL)
 
@@ -92,29 +210,30 @@ func connectToRealtime(supabaseURL, supabaseKey string) (*websocket.Conn, string
 	u.RawQuery = q.Encode()
 	fullURL := u.String()
 
-	log.Printf("Connecting to Supabase Realtime at %s", fullURL)
+	// Log the URL without the query string: it carries the anon key
+	slog.Info("Connecting to Supabase Realtime", "url", realtimeURL)
 
-	// Step 3: Dial (connect) to the WebSocket server
-	dialer := websocket.Dialer{}
-	conn, _, err := dialer.Dial(fullURL, nil)
+	// Step 3: Dial (connect) to the WebSocket server, through the egress policy
+	dialer := websocket.Dialer{HandshakeTimeout: handshakeTimeout, NetDialContext: egress.NetDialContext}
+	conn, _, err := dialer.DialContext(ctx, fullURL, nil)
 	if err != nil {
 		return nil, "", err
 	}
 
-	log.Println("Connected to Supabase Realtime successfully")
+	slog.Info("Connected to Supabase Realtime successfully")
 	return conn, fullURL, nil
 }
 
 // subscribeToTable sends a subscription message to Supabase to listen for changes
-// on a specific database table.
-func subscribeToTable(conn *websocket.Conn, tableName string) error {
+// on the subscription's table. ref identifies the message (one per subscription).
+func subscribeToTable(conn *websocket.Conn, subscription Subscription, ref string) error {
 	// Build the subscription message
 	// Supabase uses Phoenix channels protocol - "phx_join" means "join this channel"
 	subscribeMsg := map[string]interface{}{
-		"topic":   "realtime:public:" + tableName, // Channel name: realtime:public:artist_metrics
-		"event":   "phx_join",                      // Event type: join the channel
-		"payload": map[string]interface{}{},        // Empty payload for join
-		"ref":     "1",                             // Reference ID for this message
+		"topic":   channelTopic(subscription), // Channel name: realtime:public:artist_metrics
+		"event":   "phx_join",                 // Event type: join the channel
+		"payload": buildJoinPayload(subscription, getTenantFilter()),
+		"ref":     ref, // Reference ID for this message
 	}
 
 	// Send the subscription message as JSON
@@ -122,182 +241,393 @@ func subscribeToTable(conn *websocket.Conn, tableName string) error {
 		return err
 	}
 
-	log.Printf("Subscribed to table: %s", tableName)
+	slog.Info("Subscribed to table", "subscription", subscription.Name, "table", subscription.Schema+"."+subscription.Table)
 	return nil
 }
 
+// getTenantFilter returns the tenants this instance subscribes to (REALTIME_TENANT_IDS).
+// An empty list means "all rows", as in a single-tenant deployment.
+func getTenantFilter() []string {
+	var tenants []string
+	for _, id := range current().TenantIDs {
+		if !tenant.Valid(id) {
+			slog.Warn("Ignoring invalid tenant ID in REALTIME_TENANT_IDS", "tenant", id)
+			continue
+		}
+		tenants = append(tenants, id)
+	}
+	return tenants
+}
+
+// buildJoinPayload builds the phx_join payload. With a subscription filter, it asks Supabase to
+// only send the matching rows; otherwise, with tenants configured, only rows for those tenants
+// (e.g. filter "tenant_id=in.(acme,globex)"). Realtime takes one filter per table, so with both
+// the tenants are only checked here (see allowedTenant).
+func buildJoinPayload(subscription Subscription, tenants []string) map[string]interface{} {
+	filter := subscription.Filter
+	if filter == "" && len(tenants) > 0 {
+		filter = tenant.Column + "=in.(" + strings.Join(tenants, ",") + ")"
+	}
+	if filter == "" {
+		return map[string]interface{}{} // Empty payload for join: all rows
+	}
+
+	return map[string]interface{}{
+		"config": map[string]interface{}{
+			"postgres_changes": []map[string]interface{}{{
+				"event":  "*",
+				"schema": subscription.Schema,
+				"table":  subscription.Table,
+				"filter": filter,
+			}},
+		},
+	}
+}
+
+// allowedTenant reports whether an update for tenantID should be processed.
+// The server-side filter already limits rows; this is a second check in case the
+// server ignores the filter (older Realtime versions do).
+func allowedTenant(tenantID string, tenants []string) bool {
+	if len(tenants) == 0 {
+		return true
+	}
+	for _, id := range tenants {
+		if id == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// priceColumns returns the columns holding the artist ID and the price (artist_id and price
+// unless the prices subscription maps them elsewhere).
+func priceColumns() (artistIDColumn, priceColumn string) {
+	artistIDColumn, priceColumn = "artist_id", "price"
+	if subscription, ok := priceSubscription(); ok {
+		if column := subscription.Columns["artist_id"]; column != "" {
+			artistIDColumn = column
+		}
+		if column := subscription.Columns["price"]; column != "" {
+			priceColumn = column
+		}
+	}
+	return artistIDColumn, priceColumn
+}
+
 // extractPriceFromRecord extracts the artist_id and price from a database record.
 // Returns empty values if the record doesn't have the expected structure.
-func extractPriceFromRecord(record map[string]interface{}) (artistID string, price float64, ok bool) {
+func extractPriceFromRecord(record map[string]interface{}) (artistID string, amount decimal.Decimal, ok bool) {
+	artistIDColumn, priceColumn := priceColumns()
+
 	// Try to get artist_id
-	artistIDValue, found := record["artist_id"]
+	artistIDValue, found := record[artistIDColumn]
 	if !found {
-		return "", 0, false
+		return "", decimal.Decimal{}, false
 	}
 
 	// Convert artist_id to string (it might be different types)
 	artistID, ok = artistIDValue.(string)
-	if !ok {
-		return "", 0, false
+	if !ok || artistID == "" {
+		return "", decimal.Decimal{}, false
 	}
 
 	// Try to get price
-	priceValue, found := record["price"]
+	priceValue, found := record[priceColumn]
 	if !found {
-		return "", 0, false
+		return "", decimal.Decimal{}, false
 	}
 
-	// Convert price to float64 (handle different number types)
-	switch v := priceValue.(type) {
-	case float64:
-		price = v
-	case float32:
-		price = float64(v)
-	case int:
-		price = float64(v)
-	case int64:
-		price = float64(v)
-	default:
-		return "", 0, false // Unknown type
+	// Convert price to a decimal (JSON numbers, numeric strings, floats and ints)
+	amount, err := price.Parse(priceValue)
+	if err != nil {
+		return "", decimal.Decimal{}, false
 	}
 
-	return artistID, price, true
+	return artistID, amount, true
 }
 
-// handlePriceUpdate processes a price update from Supabase Realtime.
-// It caches the price in Redis and broadcasts it to all WebSocket clients.
-func handlePriceUpdate(payload map[string]interface{}) {
+// errIgnoredEvent is returned by parsePriceUpdate for events we deliberately skip (e.g. DELETE).
+var errIgnoredEvent = errors.New("event type ignored")
+
+// parsePriceUpdate extracts a PriceUpdate from a postgres_changes payload.
+// Supports both payload shapes Supabase has used:
+//   - legacy: {"eventType": "UPDATE", "new": {...}}
+//   - current: {"data": {"type": "UPDATE", "record": {...}}}
+func parsePriceUpdate(payload map[string]interface{}) (PriceUpdate, error) {
 	// Step 1: Extract the event type (INSERT, UPDATE, or DELETE)
-	eventType := ""
-	if evt, ok := payload["eventType"].(string); ok {
-		eventType = evt
-	} else if evt, ok := payload["event"].(string); ok {
-		eventType = evt
-	} else {
-		log.Println("WARNING: Could not find event type in payload")
-		return
+	eventType, err := changeType(payload)
+	if err != nil {
+		return PriceUpdate{}, err
 	}
 
 	// Step 2: Only process INSERT and UPDATE events (ignore DELETE)
 	if eventType != "INSERT" && eventType != "UPDATE" {
-		return
+		return PriceUpdate{}, errIgnoredEvent
 	}
 
 	// Step 3: Extract the new record data
-	// Supabase sends the new record in the "new" field (or sometimes "record")
-	var newRecord map[string]interface{}
-	if new, ok := payload["new"].(map[string]interface{}); ok {
-		newRecord = new
-	} else if record, ok := payload["record"].(map[string]interface{}); ok {
-		newRecord = record
-	} else {
-		log.Println("WARNING: Could not find record data in payload")
-		return
+	newRecord, err := changedRecord(payload, eventType)
+	if err != nil {
+		return PriceUpdate{}, err
 	}
 
 	// Step 4: Extract artist_id and price from the record
-	artistID, price, ok := extractPriceFromRecord(newRecord)
+	artistID, amount, ok := extractPriceFromRecord(newRecord)
 	if !ok {
-		log.Println("WARNING: Could not extract artist_id or price from record")
-		return
+		return PriceUpdate{}, errors.New("could not extract artist_id or price from record")
 	}
 
-	// Step 5: Cache the price in Redis
-	// Cache key format: "price:artist123"
-	redisClient := cache.GetClient()
-	if redisClient != nil {
-		cacheKey := "price:" + artistID
-		priceString := formatPrice(price)
-		
-		if err := redisClient.Set(cacheKey, priceString, 5*time.Minute); err != nil {
-			log.Printf("ERROR: Failed to cache price in Redis: %v", err)
-		} else {
-			log.Printf("Cached price for artist %s: %.2f", artistID, price)
-		}
+	// Step 5: Tenant of the row, if the table is tenant-scoped
+	tenantID, _ := newRecord[tenant.Column].(string)
+	if tenantID != "" && !tenant.Valid(tenantID) {
+		return PriceUpdate{}, errors.New("invalid tenant_id in record")
 	}
 
-	// Step 6: Create the update message for WebSocket clients
-	update := PriceUpdate{
+	return PriceUpdate{
 		ArtistID: artistID,
-		Price:    price,
+		Price:    amount,
 		Event:    eventType,
+		TenantID: tenantID,
+	}, nil
+}
+
+// changeType returns the event type (INSERT, UPDATE or DELETE) of a postgres_changes payload.
+func changeType(payload map[string]interface{}) (string, error) {
+	// Unwrap the current protocol's "data" envelope if present
+	if data, ok := payload["data"].(map[string]interface{}); ok {
+		payload = data
+	}
+	for _, field := range []string{"eventType", "type", "event"} {
+		if eventType, ok := payload[field].(string); ok {
+			return eventType, nil
+		}
 	}
+	return "", errors.New("could not find event type in payload")
+}
 
-	// Step 7: Broadcast the update to all connected WebSocket clients
-	hub := handlers.GetHub()
-	if hub != nil {
-		message, err := json.Marshal(update)
-		if err != nil {
-			log.Printf("ERROR: Failed to create message: %v", err)
-			return
+// changedRecord returns the row of a postgres_changes payload: the new record, or the old one
+// for DELETE. Supabase sends it in "new" (or sometimes "record"), and "old" (or "old_record").
+func changedRecord(payload map[string]interface{}, eventType string) (map[string]interface{}, error) {
+	if data, ok := payload["data"].(map[string]interface{}); ok {
+		payload = data
+	}
+	fields := []string{"new", "record"}
+	if eventType == "DELETE" {
+		fields = []string{"old", "old_record"}
+	}
+	for _, field := range fields {
+		if record, ok := payload[field].(map[string]interface{}); ok {
+			return record, nil
 		}
-		
-		hub.Broadcast(message)
-		log.Printf("Broadcasted price update: artist_id=%s, price=%.2f", artistID, price)
 	}
+	return nil, errors.New("could not find record data in payload")
 }
 
-// formatPrice converts a float64 price to a string for storage in Redis.
-func formatPrice(price float64) string {
-	// Use JSON marshaling to ensure consistent formatting
-	b, _ := json.Marshal(price)
-	return string(b)
+// handlePriceUpdate processes a price update from Supabase Realtime.
+// It caches the price in Redis and publishes it as an events.PriceChanged.
+func handlePriceUpdate(payload map[string]interface{}) {
+	// Step 1: Parse the payload into a PriceUpdate
+	update, err := parsePriceUpdate(payload)
+	if errors.Is(err, errIgnoredEvent) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to parse price update", "error", err)
+		// The table may have changed under us (see drift.go)
+		requestSchemaCheck()
+		return
+	}
+	artistID, amount := update.ArtistID, update.Price
+
+	if !allowedTenant(update.TenantID, getTenantFilter()) {
+		return // Another instance serves this tenant
+	}
+
+	// Step 2: Cache the price in Redis
+	if err := cachePrice(update.TenantID, artistID, amount); err != nil {
+		slog.Error("Failed to cache price in Redis", "artist_id", artistID, "error", err)
+	} else {
+		slog.Debug("Cached price", "artist_id", artistID, "price", formatPrice(amount))
+	}
+
+	// Step 3: Announce the change; the WebSocket hub broadcasts it to the clients (see internal/events)
+	events.Publish(events.PriceChanged{
+		ArtistID: artistID,
+		Price:    amount,
+		Event:    update.Event,
+		TenantID: update.TenantID,
+	})
+	slog.Debug("Published price change", "artist_id", artistID, "price", amount.String(), "tenant", update.TenantID)
 }
 
-// listenForUpdates listens for messages from Supabase Realtime and processes them.
-// This function runs in a loop until the connection is closed.
-func listenForUpdates(conn *websocket.Conn, supabaseURL, supabaseKey string) {
-	log.Println("Listening for database changes...")
+// cachePrice caches an artist's price for priceCacheTTL, under "price:artist123"
+// ("tenant:acme:price:artist123" for tenant rows). It does nothing without a cache.
+func cachePrice(tenantID, artistID string, amount decimal.Decimal) error {
+	redisClient := tenant.CacheFor(tenantID)
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Set(priceKey(artistID), formatPrice(amount), priceCacheTTL())
+}
+
+// priceKey returns the cache key of an artist's price, before the tenant prefix.
+func priceKey(artistID string) string {
+	return "price:" + artistID
+}
+
+// priceCacheTTL is how long prices are cached (the prices subscription's cache_ttl, default 5m).
+func priceCacheTTL() time.Duration {
+	if subscription, ok := priceSubscription(); ok && subscription.CacheTTL > 0 {
+		return subscription.CacheTTL
+	}
+	return 5 * time.Minute
+}
+
+// formatPrice converts a price to its exact string form for storage in Redis ("45.67").
+func formatPrice(amount decimal.Decimal) string {
+	return price.String(amount)
+}
+
+// listenForUpdates processes messages from Supabase Realtime until the connection ends, and
+// returns the error that ended it.
+func listenForUpdates(ctx context.Context, conn *websocket.Conn, beats *heartbeat) error {
+	slog.Info("Listening for database changes...")
 
 	for {
 		// Read a message from the WebSocket connection
 		var message map[string]interface{}
-		if err := conn.ReadJSON(&message); err != nil {
-			log.Printf("ERROR: Connection lost: %v", err)
-			log.Println("Attempting to reconnect in 5 seconds...")
-			
-			// Wait 5 seconds before reconnecting
-			time.Sleep(5 * time.Second)
-			
-			// Reconnect in a new goroutine (don't block)
-			go subscribeViaWebSocket(supabaseURL, supabaseKey)
-			return
+		if err := readMessage(conn, &message); err != nil {
+			// Save how far we got for the next connection, which may be another replica's
+			persistCheckpoint(context.Background(), true)
+			return err
 		}
 
-		// Check what type of message we received
-		event, _ := message["event"].(string)
-		
-		// If it's a database change event, process it
-		if event == "postgres_changes" {
-			payload, ok := message["payload"].(map[string]interface{})
-			if ok {
-				handlePriceUpdate(payload)
+		if beats.acknowledge(message) {
+			continue
+		}
+		handleMessage(message)
+		persistCheckpoint(ctx, false)
+	}
+}
+
+// readMessage reads one JSON message, keeping numbers as json.Number so prices are never
+// rounded through float64.
+func readMessage(conn *websocket.Conn, message *map[string]interface{}) error {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(message)
+}
+
+// handleMessage dispatches a single message received from Supabase Realtime.
+func handleMessage(message map[string]interface{}) {
+	// Check what type of message we received
+	event, _ := message["event"].(string)
+
+	// If it's a database change event, process it with its table's subscription
+	if event == "postgres_changes" {
+		payload, ok := message["payload"].(map[string]interface{})
+		if ok {
+			if subscription, found := subscriptionFor(message); found {
+				handleChange(subscription, payload)
+			} else {
+				slog.Debug("Ignoring change of a table without a subscription", "topic", message["topic"])
+			}
+			// Remember how far we got, for the backfill after a reconnect
+			if committed, ok := commitTimestamp(payload); ok {
+				advanceCheckpoint(committed)
 			}
 		}
-		// Other events (like "phx_reply" for subscription confirmation) are ignored
 	}
+	// Other events (like "phx_reply" for subscription confirmation) are ignored
 }
 
-// subscribeViaWebSocket is the main function that orchestrates the Realtime subscription.
-// It connects, subscribes, and listens for updates.
-func subscribeViaWebSocket(supabaseURL, supabaseKey string) {
+// runSession connects, subscribes and processes changes until the connection ends or ctx is
+// cancelled. It returns how long the subscription was up (0 if it never was) and why it ended;
+// supervise decides whether and when to reconnect.
+func runSession(ctx context.Context, supabaseURL, supabaseKey string) (time.Duration, error) {
 	// Step 1: Connect to Supabase Realtime WebSocket
-	conn, _, err := connectToRealtime(supabaseURL, supabaseKey)
+	conn, _, err := connectToRealtime(ctx, supabaseURL, supabaseKey)
 	if err != nil {
-		log.Printf("ERROR: Failed to connect to Supabase Realtime: %v", err)
-		log.Println("Please ensure:")
-		log.Println("  1. SUPABASE_URL and SUPABASE_ANON_KEY are set correctly")
-		log.Println("  2. Supabase Realtime is enabled for the artist_metrics table")
-		return
+		slog.Error("Failed to connect to Supabase Realtime: check that SUPABASE_URL and SUPABASE_ANON_KEY are set correctly and Realtime is enabled for the subscribed tables",
+			"error", err)
+		return 0, err
 	}
 	defer conn.Close() // Make sure we close the connection when done
 
-	// Step 2: Subscribe to the artist_metrics table
-	if err := subscribeToTable(conn, "artist_metrics"); err != nil {
-		log.Printf("ERROR: Failed to subscribe to table: %v", err)
-		return
+	// Close the connection when ctx is cancelled (leadership lost), which ends the listen loop
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	setCurrentConn(conn)
+	defer setCurrentConn(nil)
+
+	// Step 2: Subscribe to the tables (artist_metrics, plus REALTIME_SUBSCRIPTIONS)
+	for i, subscription := range subscriptions() {
+		if err := subscribeToTable(conn, subscription, strconv.Itoa(i+1)); err != nil {
+			slog.Error("Failed to subscribe to table", "subscription", subscription.Name, "error", err)
+			return 0, err
+		}
+	}
+	status.SetUp(status.Realtime)
+	subscribed := time.Now()
+
+	// Step 3: Replay changes missed while disconnected, from the saved checkpoint if it is later
+	// (e.g. after a restart). Without any checkpoint there is nothing to catch up on: start it now
+	restoreCheckpoint(ctx)
+	if lastCheckpoint().IsZero() {
+		advanceCheckpoint(time.Now())
+	} else if replayed, err := backfill(ctx, supabaseURL, supabaseKey); err != nil {
+		slog.Error("Realtime backfill failed, changes made while disconnected may be missing", "error", err)
+	} else if replayed > 0 {
+		slog.Info("Realtime backfill replayed changed rows", "rows", replayed)
+	}
+	persistCheckpoint(ctx, true)
+
+	// Step 4: Keep the connection alive; Supabase drops connections without heartbeats. Started
+	// after the backfill, whose replies would only be read once listening starts
+	beats := newHeartbeat(conn)
+	heartbeatCtx, cancelHeartbeat := context.WithCancel(ctx)
+	defer cancelHeartbeat()
+	done := monitor.Track("realtime.heartbeat")
+	go func() {
+		defer done()
+		beats.run(heartbeatCtx, current().HeartbeatInterval)
+	}()
+
+	// Step 5: Process updates until the connection ends
+	err = listenForUpdates(ctx, conn, beats)
+	return time.Since(subscribed), err
+}
+
+// setCurrentConn records the live connection (nil when disconnected).
+func setCurrentConn(conn *websocket.Conn) {
+	currentConnMu.Lock()
+	currentConn = conn
+	currentConnMu.Unlock()
+}
+
+// Restart drops the current Realtime connection. The supervisor sees the closed connection and
+// reconnects (and resubscribes) through its normal retry path. While the supervisor is waiting
+// to reconnect, or has given up (REALTIME_MAX_RECONNECTS), it reconnects right away instead.
+// Returns an error if the subscriber is not running.
+func Restart() error {
+	currentConnMu.Lock()
+	conn := currentConn
+	currentConnMu.Unlock()
+
+	if conn == nil {
+		if !wakeSupervisor() {
+			return errNotConnected
+		}
+		slog.Info("Reconnecting to Supabase Realtime now...")
+		return nil
 	}
 
-	// Step 3: Start listening for updates (this blocks forever)
-	listenForUpdates(conn, supabaseURL, supabaseKey)
+	slog.Info("Restarting Supabase Realtime connection...")
+	return conn.Close()
 }
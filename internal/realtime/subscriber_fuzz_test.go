@@ -0,0 +1,39 @@
+package realtime
+
+import (
+	"encoding/json"
+	"testing"
+
+	"boilerplate/internal/cache"
+)
+
+// FuzzHandleMessage feeds arbitrary Realtime messages through parsing and handling.
+// Handling must never panic, and any parsed update must have a usable artist ID.
+func FuzzHandleMessage(f *testing.F) {
+	f.Add(`{"event":"postgres_changes","payload":{"eventType":"UPDATE","new":{"artist_id":"a1","price":45.67}}}`)
+	f.Add(`{"event":"postgres_changes","payload":{"data":{"type":"INSERT","record":{"artist_id":"a1","price":1}}}}`)
+	f.Add(`{"event":"postgres_changes","payload":{"data":{"type":"DELETE","old_record":{"artist_id":"a1"}}}}`)
+	f.Add(`{"event":"postgres_changes","payload":{"eventType":"UPDATE","new":{"artist_id":7,"price":"x"}}}`)
+	f.Add(`{"event":"phx_reply","payload":{"status":"ok"}}`)
+	f.Add(`{"event":"postgres_changes","payload":null}`)
+
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	cache.SetDefault(cache.NewMemoryStore())
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &message); err != nil {
+			return
+		}
+
+		if payload, ok := message["payload"].(map[string]interface{}); ok {
+			update, err := parsePriceUpdate(payload)
+			if err == nil && update.ArtistID == "" {
+				t.Fatalf("parsed update without artist ID from %q", raw)
+			}
+		}
+
+		handleMessage(message)
+	})
+}
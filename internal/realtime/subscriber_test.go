@@ -0,0 +1,77 @@
+package realtime
+
+import (
+	"encoding/json"
+	"testing"
+
+	"boilerplate/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParsePriceUpdate_Tenant tests that the tenant column is carried into the update.
+func TestParsePriceUpdate_Tenant(t *testing.T) {
+	update, err := parsePriceUpdate(map[string]interface{}{
+		"eventType": "UPDATE",
+		"new":       map[string]interface{}{"artist_id": "a1", "price": 10.0, "tenant_id": "acme"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", update.TenantID)
+
+	_, err = parsePriceUpdate(map[string]interface{}{
+		"eventType": "UPDATE",
+		"new":       map[string]interface{}{"artist_id": "a1", "price": 10.0, "tenant_id": "bad:tenant"},
+	})
+	assert.Error(t, err)
+}
+
+// TestParsePriceUpdate_Decimal tests that prices keep their exact digits end to end.
+func TestParsePriceUpdate_Decimal(t *testing.T) {
+	for _, price := range []interface{}{json.Number("45.67"), "45.67", 45.67} {
+		update, err := parsePriceUpdate(map[string]interface{}{
+			"eventType": "UPDATE",
+			"new":       map[string]interface{}{"artist_id": "a1", "price": price},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "45.67", formatPrice(update.Price))
+
+		encoded, err := json.Marshal(update)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"artist_id":"a1","price":"45.67","event":"UPDATE"}`, string(encoded))
+	}
+
+	// Arithmetic stays exact too (0.1 + 0.2 is 0.30000000000000004 in float64)
+	a, _ := parsePriceUpdate(map[string]interface{}{"eventType": "UPDATE", "new": map[string]interface{}{"artist_id": "a1", "price": json.Number("0.1")}})
+	b, _ := parsePriceUpdate(map[string]interface{}{"eventType": "UPDATE", "new": map[string]interface{}{"artist_id": "a1", "price": json.Number("0.2")}})
+	assert.Equal(t, "0.3", formatPrice(a.Price.Add(b.Price)))
+}
+
+// TestBuildJoinPayload tests the server-side filter sent when joining the channel: the
+// subscription's, else the tenants'.
+func TestBuildJoinPayload(t *testing.T) {
+	prices := config.DefaultRealtimeSubscriptions()[0]
+	assert.Empty(t, buildJoinPayload(prices, nil))
+
+	payload := buildJoinPayload(prices, []string{"acme", "globex"})
+	changes := payload["config"].(map[string]interface{})["postgres_changes"].([]map[string]interface{})
+	require.Len(t, changes, 1)
+	assert.Equal(t, "artist_metrics", changes[0]["table"])
+	assert.Equal(t, "public", changes[0]["schema"])
+	assert.Equal(t, "tenant_id=in.(acme,globex)", changes[0]["filter"])
+
+	listings := Subscription{Name: "listings", Schema: "market", Table: "listings", Filter: "status=eq.live"}
+	payload = buildJoinPayload(listings, []string{"acme"})
+	changes = payload["config"].(map[string]interface{})["postgres_changes"].([]map[string]interface{})
+	assert.Equal(t, "market", changes[0]["schema"])
+	assert.Equal(t, "status=eq.live", changes[0]["filter"])
+}
+
+// TestAllowedTenant tests the client-side tenant check.
+func TestAllowedTenant(t *testing.T) {
+	assert.True(t, allowedTenant("", nil))
+	assert.True(t, allowedTenant("anyone", nil))
+	assert.True(t, allowedTenant("acme", []string{"acme", "globex"}))
+	assert.False(t, allowedTenant("initech", []string{"acme", "globex"}))
+	assert.False(t, allowedTenant("", []string{"acme"}))
+}
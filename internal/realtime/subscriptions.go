@@ -0,0 +1,177 @@
+package realtime
+
+// Table subscriptions.
+//
+// The subscriber joins one Realtime channel per subscription (config.RealtimeSubscription): the
+// built-in prices subscription on artist_metrics, plus the tables listed in
+// REALTIME_SUBSCRIPTIONS. Price changes take the typed path (handlePriceUpdate); changes of
+// other tables are mapped to the subscription's fields, cached as JSON under its key template
+// and published as events.RowChanged, which the WebSocket hub broadcasts as messages of its topic.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/events"
+	"boilerplate/internal/tenant"
+)
+
+// Subscription is one table the subscriber listens to (see config.RealtimeSubscription).
+type Subscription = config.RealtimeSubscription
+
+// subscriptions returns the configured subscriptions, or the built-in ones if none are (e.g. a
+// config.Realtime built by hand).
+func subscriptions() []Subscription {
+	if configured := current().Subscriptions; len(configured) > 0 {
+		return configured
+	}
+	return config.DefaultRealtimeSubscriptions()
+}
+
+// priceSubscription returns the prices subscription, or false if it isn't configured.
+func priceSubscription() (Subscription, bool) {
+	for _, subscription := range subscriptions() {
+		if subscription.Name == config.PricesSubscription {
+			return subscription, true
+		}
+	}
+	return Subscription{}, false
+}
+
+// channelTopic is the Realtime channel a subscription joins, e.g. "realtime:public:artist_metrics".
+func channelTopic(subscription Subscription) string {
+	return "realtime:" + subscription.Schema + ":" + subscription.Table
+}
+
+// subscriptionFor returns the subscription a message belongs to: by its channel, else by the
+// table named in its payload. Messages that name neither are price changes (older Realtime
+// versions and the recorded fixtures).
+func subscriptionFor(message map[string]interface{}) (Subscription, bool) {
+	topic, _ := message["topic"].(string)
+	payload, _ := message["payload"].(map[string]interface{})
+	if data, ok := payload["data"].(map[string]interface{}); ok {
+		payload = data
+	}
+	schema, _ := payload["schema"].(string)
+	table, _ := payload["table"].(string)
+
+	for _, subscription := range subscriptions() {
+		if topic == channelTopic(subscription) {
+			return subscription, true
+		}
+	}
+	for _, subscription := range subscriptions() {
+		if table == subscription.Table && (schema == "" || schema == subscription.Schema) {
+			return subscription, true
+		}
+	}
+	if topic == "" && table == "" {
+		return priceSubscription()
+	}
+	return Subscription{}, false
+}
+
+// handleChange processes one postgres_changes payload of a subscription.
+func handleChange(subscription Subscription, payload map[string]interface{}) {
+	if subscription.Name == config.PricesSubscription {
+		handlePriceUpdate(payload)
+		return
+	}
+	handleRowChange(subscription, payload)
+}
+
+// parseRowChange maps a postgres_changes payload to the subscription's fields. Deleted rows
+// are read from the old record, which only holds the primary key unless the table has
+// REPLICA IDENTITY FULL.
+func parseRowChange(subscription Subscription, payload map[string]interface{}) (events.RowChanged, error) {
+	eventType, err := changeType(payload)
+	if err != nil {
+		return events.RowChanged{}, err
+	}
+	if !subscription.HandlesEvent(eventType) {
+		return events.RowChanged{}, errIgnoredEvent
+	}
+	record, err := changedRecord(payload, eventType)
+	if err != nil {
+		return events.RowChanged{}, err
+	}
+
+	tenantID, _ := record[tenant.Column].(string)
+	if tenantID != "" && !tenant.Valid(tenantID) {
+		return events.RowChanged{}, errors.New("invalid tenant_id in record")
+	}
+
+	fields := record
+	if len(subscription.Columns) > 0 {
+		fields = make(map[string]interface{}, len(subscription.Columns))
+		for field, column := range subscription.Columns {
+			if value, ok := record[column]; ok {
+				fields[field] = value
+			}
+		}
+	}
+
+	return events.RowChanged{
+		Subscription: subscription.Name,
+		Topic:        subscription.Topic,
+		Event:        eventType,
+		TenantID:     tenantID,
+		Record:       fields,
+	}, nil
+}
+
+// handleRowChange caches a change of a subscribed table and publishes it as an events.RowChanged.
+func handleRowChange(subscription Subscription, payload map[string]interface{}) {
+	change, err := parseRowChange(subscription, payload)
+	if errors.Is(err, errIgnoredEvent) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to parse row change", "subscription", subscription.Name, "error", err)
+		requestSchemaCheck()
+		return
+	}
+	if !allowedTenant(change.TenantID, getTenantFilter()) {
+		return // Another instance serves this tenant
+	}
+
+	// Cache the row under its key ("listing:42", "tenant:acme:listing:42" for tenant rows)
+	if store := tenant.CacheFor(change.TenantID); store != nil && subscription.CacheKey != "" {
+		if key, ok := cacheKeyFor(subscription.CacheKey, change.Record); !ok {
+			slog.Warn("Row change lacks a field of the cache key, not cached", "subscription", subscription.Name, "cache_key", subscription.CacheKey)
+		} else if change.Event == "DELETE" {
+			if err := store.Del(key); err != nil {
+				slog.Error("Failed to delete cached row", "subscription", subscription.Name, "key", key, "error", err)
+			}
+		} else if value, err := json.Marshal(change.Record); err != nil {
+			slog.Error("Failed to encode row", "subscription", subscription.Name, "error", err)
+		} else if err := store.Set(key, string(value), subscription.CacheTTL); err != nil {
+			slog.Error("Failed to cache row", "subscription", subscription.Name, "key", key, "error", err)
+		}
+	}
+
+	events.Publish(change)
+	slog.Debug("Published row change", "subscription", subscription.Name, "event", change.Event, "tenant", change.TenantID)
+}
+
+// placeholder is a {field} placeholder of a cache key template.
+var placeholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// cacheKeyFor fills the {field} placeholders of template from record. It returns false if a
+// field is missing or empty.
+func cacheKeyFor(template string, record map[string]interface{}) (string, bool) {
+	ok := true
+	key := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		value, found := record[match[1:len(match)-1]]
+		if !found || value == nil || value == "" {
+			ok = false
+			return ""
+		}
+		return fmt.Sprint(value)
+	})
+	return key, ok
+}
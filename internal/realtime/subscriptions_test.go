@@ -0,0 +1,113 @@
+package realtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandleMessage_Subscriptions tests that changes are routed by table: prices take the price
+// path, other subscriptions are mapped to their fields, cached under their key and published.
+func TestHandleMessage_Subscriptions(t *testing.T) {
+	originalCache := cache.GetClient()
+	defer cache.SetDefault(originalCache)
+	store := cache.NewMemoryStore()
+	cache.SetDefault(store)
+
+	original := current()
+	defer configure(original)
+	listings := Subscription{
+		Name:     "listings",
+		Schema:   "public",
+		Table:    "listings",
+		Columns:  map[string]string{"id": "listing_id", "title": "title"},
+		CacheKey: "listing:{id}",
+		CacheTTL: time.Minute,
+		Topic:    "listing_update",
+		Events:   []string{"INSERT", "UPDATE", "DELETE"},
+	}
+	configure(config.Realtime{Subscriptions: append(config.DefaultRealtimeSubscriptions(), listings)})
+
+	var published []events.RowChanged
+	defer events.Reset()
+	events.Subscribe(func(change events.RowChanged) { published = append(published, change) })
+
+	handleMessage(map[string]interface{}{
+		"topic": "realtime:public:listings",
+		"event": "postgres_changes",
+		"payload": map[string]interface{}{"data": map[string]interface{}{
+			"type":   "INSERT",
+			"table":  "listings",
+			"record": map[string]interface{}{"listing_id": json.Number("42"), "title": "Poster", "secret": "x", "tenant_id": "acme"},
+		}},
+	})
+	require.Len(t, published, 1)
+	assert.Equal(t, "listings", published[0].Subscription)
+	assert.Equal(t, "listing_update", published[0].Topic)
+	assert.Equal(t, "acme", published[0].TenantID)
+	assert.Equal(t, map[string]interface{}{"id": json.Number("42"), "title": "Poster"}, published[0].Record)
+
+	cached, err := store.Get("tenant:acme:listing:42")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id": 42, "title": "Poster"}`, cached)
+
+	// Deletes are read from the old record and drop the cached row
+	handleMessage(map[string]interface{}{
+		"topic":   "realtime:public:listings",
+		"event":   "postgres_changes",
+		"payload": map[string]interface{}{"eventType": "DELETE", "old": map[string]interface{}{"listing_id": "42", "tenant_id": "acme"}},
+	})
+	require.Len(t, published, 2)
+	assert.Equal(t, "DELETE", published[1].Event)
+	cached, _ = store.Get("tenant:acme:listing:42")
+	assert.Empty(t, cached)
+
+	// Prices still take the price path; tables without a subscription are ignored
+	handleMessage(map[string]interface{}{
+		"topic":   "realtime:public:artist_metrics",
+		"event":   "postgres_changes",
+		"payload": map[string]interface{}{"eventType": "UPDATE", "new": map[string]interface{}{"artist_id": "a1", "price": json.Number("9.99")}},
+	})
+	cached, _ = store.Get("price:a1")
+	assert.Equal(t, "9.99", cached)
+	handleMessage(map[string]interface{}{
+		"topic":   "realtime:public:orders",
+		"event":   "postgres_changes",
+		"payload": map[string]interface{}{"eventType": "INSERT", "new": map[string]interface{}{"id": "o1"}},
+	})
+	assert.Len(t, published, 2)
+}
+
+// TestPriceColumns tests that the prices subscription can read prices from other columns.
+func TestPriceColumns(t *testing.T) {
+	original := current()
+	defer configure(original)
+	prices := config.DefaultRealtimeSubscriptions()
+	prices[0].Columns["price"] = "amount"
+	configure(config.Realtime{Subscriptions: prices})
+
+	update, err := parsePriceUpdate(map[string]interface{}{
+		"eventType": "UPDATE",
+		"new":       map[string]interface{}{"artist_id": "a1", "amount": json.Number("12.5")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "12.5", formatPrice(update.Price))
+	assert.Equal(t, []string{"artist_id", "amount"}, expectedColumns(prices[0]))
+}
+
+// TestCacheKeyFor tests filling the cache key template.
+func TestCacheKeyFor(t *testing.T) {
+	key, ok := cacheKeyFor("listing:{id}:{lang}", map[string]interface{}{"id": json.Number("7"), "lang": "en"})
+	assert.True(t, ok)
+	assert.Equal(t, "listing:7:en", key)
+
+	_, ok = cacheKeyFor("listing:{id}", map[string]interface{}{"title": "x"})
+	assert.False(t, ok)
+}
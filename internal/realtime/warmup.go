@@ -0,0 +1,102 @@
+package realtime
+
+// Scheduled price cache maintenance (see internal/scheduler).
+//
+// Realtime only caches the prices that change: after a cache flush, an epoch bump or a quiet
+// period longer than the price TTL, the GraphQL proxy finds no price to inject until the next
+// change. WarmPrices re-caches the latest prices from the table. Realtime ignores deleted rows, so
+// an artist deleted in the database keeps its cached price until it expires; ClearDeletedPrices
+// removes those.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/tenant"
+)
+
+// maxWarmedPrices bounds the rows one WarmPrices or ClearDeletedPrices run reads.
+const maxWarmedPrices = 1000
+
+// artistsTable is the table whose soft-deleted rows ClearDeletedPrices looks up (see
+// internal/resource/schema.sql).
+var artistsTable = Subscription{Name: "artists", Schema: "public", Table: "artists"}
+
+// WarmPrices caches the prices of the most recently updated rows of the prices table (up to
+// maxWarmedPrices, by REALTIME_BACKFILL_COLUMN) for the price TTL. It does nothing without
+// Realtime or a cache. A change cached while it runs may be overwritten by the previous price,
+// until the next change or warmup.
+func WarmPrices(ctx context.Context) error {
+	cfg := current()
+	subscription, ok := priceSubscription()
+	if !cfg.Enabled() || !ok || cache.GetClient() == nil {
+		return nil
+	}
+	rows, err := fetchChangedRows(ctx, cfg.SupabaseURL, cfg.AnonKey, subscription, backfillColumn(cfg), time.Time{}, maxWarmedPrices)
+	if err != nil {
+		return fmt.Errorf("failed to read prices: %w", err)
+	}
+
+	warmed := 0
+	var errs []error
+	for _, row := range rows {
+		artistID, amount, ok := extractPriceFromRecord(row)
+		tenantID, _ := row[tenant.Column].(string)
+		if !ok || (tenantID != "" && !tenant.Valid(tenantID)) {
+			continue
+		}
+		if err := cachePrice(tenantID, artistID, amount); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		warmed++
+	}
+	slog.Info("Warmed price cache", "prices", warmed)
+	return errors.Join(errs...)
+}
+
+// ClearDeletedPrices removes the cached prices of the artists soft-deleted within the price TTL
+// (older ones have expired). It does nothing without Realtime or a cache.
+func ClearDeletedPrices(ctx context.Context) error {
+	cfg := current()
+	if !cfg.Enabled() || cache.GetClient() == nil {
+		return nil
+	}
+	since := time.Now().Add(-priceCacheTTL())
+	rows, err := fetchChangedRows(ctx, cfg.SupabaseURL, cfg.AnonKey, artistsTable, "deleted_at", since, maxWarmedPrices)
+	if err != nil {
+		return fmt.Errorf("failed to read deleted artists: %w", err)
+	}
+
+	cleared := 0
+	var errs []error
+	for _, row := range rows {
+		id, _ := row["id"].(string)
+		tenantID, _ := row[tenant.Column].(string)
+		if id == "" || (tenantID != "" && !tenant.Valid(tenantID)) {
+			continue
+		}
+		if err := tenant.CacheFor(tenantID).Del(priceKey(id)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		cleared++
+	}
+	if cleared > 0 {
+		slog.Info("Cleared cached prices of deleted artists", "artists", cleared)
+	}
+	return errors.Join(errs...)
+}
+
+// backfillColumn returns REALTIME_BACKFILL_COLUMN, the column rows are ordered by.
+func backfillColumn(cfg config.Realtime) string {
+	if cfg.BackfillColumn == "" {
+		return "updated_at"
+	}
+	return cfg.BackfillColumn
+}
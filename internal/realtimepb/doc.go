@@ -0,0 +1,7 @@
+package realtimepb
+
+// Package realtimepb holds the protobuf types for realtime push messages, generated from
+// realtime.proto. WebSocket clients that connect with ?encoding=protobuf receive each message as
+// a binary frame containing one Envelope; other transports can reuse the same types.
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative realtime.proto
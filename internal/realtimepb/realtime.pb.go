@@ -0,0 +1,761 @@
+// Realtime push messages (WebSocket frames with ?encoding=protobuf).
+//
+// Every frame is one Envelope. The JSON schema 2 envelope (see internal/handlers/ws_schema.go)
+// maps field for field: type, version, ts, id, and the payload in the oneof matching type.
+// Compatibility policy: fields are only ever added, never renumbered or reused; clients must
+// ignore unknown fields and unset oneof cases.
+//
+// Regenerate realtime.pb.go with `make proto` after editing.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: realtime.proto
+
+package realtimepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Envelope wraps every server-pushed message.
+type Envelope struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Type    string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`        // price_update, price_delta, broadcast, welcome, error, preferences
+	Version int32                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"` // Message schema version (2)
+	Ts      *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=ts,proto3" json:"ts,omitempty"`            // When the server published the message
+	Id      string                 `protobuf:"bytes,4,opt,name=id,proto3" json:"id,omitempty"`            // Unique per message, the same for every recipient
+	// Types that are valid to be assigned to Data:
+	//
+	//	*Envelope_PriceUpdate
+	//	*Envelope_Broadcast
+	//	*Envelope_Welcome
+	//	*Envelope_PriceDelta
+	//	*Envelope_Error
+	//	*Envelope_Preferences
+	Data          isEnvelope_Data `protobuf_oneof:"data"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Envelope) Reset() {
+	*x = Envelope{}
+	mi := &file_realtime_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Envelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Envelope) ProtoMessage() {}
+
+func (x *Envelope) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Envelope.ProtoReflect.Descriptor instead.
+func (*Envelope) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Envelope) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Envelope) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Envelope) GetTs() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Ts
+	}
+	return nil
+}
+
+func (x *Envelope) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Envelope) GetData() isEnvelope_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Envelope) GetPriceUpdate() *PriceUpdate {
+	if x != nil {
+		if x, ok := x.Data.(*Envelope_PriceUpdate); ok {
+			return x.PriceUpdate
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetBroadcast() *Broadcast {
+	if x != nil {
+		if x, ok := x.Data.(*Envelope_Broadcast); ok {
+			return x.Broadcast
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetWelcome() *Welcome {
+	if x != nil {
+		if x, ok := x.Data.(*Envelope_Welcome); ok {
+			return x.Welcome
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetPriceDelta() *PriceDelta {
+	if x != nil {
+		if x, ok := x.Data.(*Envelope_PriceDelta); ok {
+			return x.PriceDelta
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Data.(*Envelope_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetPreferences() *Preferences {
+	if x != nil {
+		if x, ok := x.Data.(*Envelope_Preferences); ok {
+			return x.Preferences
+		}
+	}
+	return nil
+}
+
+type isEnvelope_Data interface {
+	isEnvelope_Data()
+}
+
+type Envelope_PriceUpdate struct {
+	PriceUpdate *PriceUpdate `protobuf:"bytes,10,opt,name=price_update,json=priceUpdate,proto3,oneof"`
+}
+
+type Envelope_Broadcast struct {
+	Broadcast *Broadcast `protobuf:"bytes,11,opt,name=broadcast,proto3,oneof"`
+}
+
+type Envelope_Welcome struct {
+	Welcome *Welcome `protobuf:"bytes,12,opt,name=welcome,proto3,oneof"`
+}
+
+type Envelope_PriceDelta struct {
+	PriceDelta *PriceDelta `protobuf:"bytes,13,opt,name=price_delta,json=priceDelta,proto3,oneof"`
+}
+
+type Envelope_Error struct {
+	Error *Error `protobuf:"bytes,14,opt,name=error,proto3,oneof"`
+}
+
+type Envelope_Preferences struct {
+	Preferences *Preferences `protobuf:"bytes,15,opt,name=preferences,proto3,oneof"`
+}
+
+func (*Envelope_PriceUpdate) isEnvelope_Data() {}
+
+func (*Envelope_Broadcast) isEnvelope_Data() {}
+
+func (*Envelope_Welcome) isEnvelope_Data() {}
+
+func (*Envelope_PriceDelta) isEnvelope_Data() {}
+
+func (*Envelope_Error) isEnvelope_Data() {}
+
+func (*Envelope_Preferences) isEnvelope_Data() {}
+
+// PriceUpdate is a change to an artist's price (artist_metrics).
+type PriceUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ArtistId      string                 `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	Price         string                 `protobuf:"bytes,2,opt,name=price,proto3" json:"price,omitempty"`                          // Exact decimal string, e.g. "45.67"
+	Event         string                 `protobuf:"bytes,3,opt,name=event,proto3" json:"event,omitempty"`                          // INSERT or UPDATE
+	TenantId      string                 `protobuf:"bytes,4,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`    // Empty for single-tenant tables
+	PriceMeta     *PriceMeta             `protobuf:"bytes,5,opt,name=price_meta,json=priceMeta,proto3" json:"price_meta,omitempty"` // Set when the client asked for ?price_meta=true
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PriceUpdate) Reset() {
+	*x = PriceUpdate{}
+	mi := &file_realtime_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PriceUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriceUpdate) ProtoMessage() {}
+
+func (x *PriceUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriceUpdate.ProtoReflect.Descriptor instead.
+func (*PriceUpdate) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PriceUpdate) GetArtistId() string {
+	if x != nil {
+		return x.ArtistId
+	}
+	return ""
+}
+
+func (x *PriceUpdate) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *PriceUpdate) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+func (x *PriceUpdate) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *PriceUpdate) GetPriceMeta() *PriceMeta {
+	if x != nil {
+		return x.PriceMeta
+	}
+	return nil
+}
+
+// PriceDelta batches the prices that changed since the previous frame, for connections in
+// delta mode (?mode=delta).
+type PriceDelta struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prices        map[string]string      `protobuf:"bytes,1,rep,name=prices,proto3" json:"prices,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // artist_id -> latest exact decimal price
+	Removed       []string               `protobuf:"bytes,2,rep,name=removed,proto3" json:"removed,omitempty"`                                                                         // Artists deleted since the previous frame
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PriceDelta) Reset() {
+	*x = PriceDelta{}
+	mi := &file_realtime_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PriceDelta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriceDelta) ProtoMessage() {}
+
+func (x *PriceDelta) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriceDelta.ProtoReflect.Descriptor instead.
+func (*PriceDelta) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PriceDelta) GetPrices() map[string]string {
+	if x != nil {
+		return x.Prices
+	}
+	return nil
+}
+
+func (x *PriceDelta) GetRemoved() []string {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+// PriceMeta is display metadata for a price in the client's locale.
+type PriceMeta struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Currency      string                 `protobuf:"bytes,1,opt,name=currency,proto3" json:"currency,omitempty"`    // ISO 4217 code
+	Precision     int32                  `protobuf:"varint,2,opt,name=precision,proto3" json:"precision,omitempty"` // Digits after the decimal separator
+	Amount        string                 `protobuf:"bytes,3,opt,name=amount,proto3" json:"amount,omitempty"`        // Exact amount at precision, e.g. "1234.50"
+	Display       string                 `protobuf:"bytes,4,opt,name=display,proto3" json:"display,omitempty"`      // Ready to show, e.g. "1.234,50 €"
+	Locale        string                 `protobuf:"bytes,5,opt,name=locale,proto3" json:"locale,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PriceMeta) Reset() {
+	*x = PriceMeta{}
+	mi := &file_realtime_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PriceMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriceMeta) ProtoMessage() {}
+
+func (x *PriceMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriceMeta.ProtoReflect.Descriptor instead.
+func (*PriceMeta) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PriceMeta) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *PriceMeta) GetPrecision() int32 {
+	if x != nil {
+		return x.Precision
+	}
+	return 0
+}
+
+func (x *PriceMeta) GetAmount() string {
+	if x != nil {
+		return x.Amount
+	}
+	return ""
+}
+
+func (x *PriceMeta) GetDisplay() string {
+	if x != nil {
+		return x.Display
+	}
+	return ""
+}
+
+func (x *PriceMeta) GetLocale() string {
+	if x != nil {
+		return x.Locale
+	}
+	return ""
+}
+
+// Broadcast is an admin broadcast (POST /api/admin/broadcast). The payload is free-form JSON.
+type Broadcast struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Json          []byte                 `protobuf:"bytes,1,opt,name=json,proto3" json:"json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Broadcast) Reset() {
+	*x = Broadcast{}
+	mi := &file_realtime_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Broadcast) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Broadcast) ProtoMessage() {}
+
+func (x *Broadcast) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Broadcast.ProtoReflect.Descriptor instead.
+func (*Broadcast) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Broadcast) GetJson() []byte {
+	if x != nil {
+		return x.Json
+	}
+	return nil
+}
+
+// Welcome is the first frame on a connection and confirms the negotiated schema.
+type Welcome struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schema        int32                  `protobuf:"varint,1,opt,name=schema,proto3" json:"schema,omitempty"`
+	Supported     []int32                `protobuf:"varint,2,rep,packed,name=supported,proto3" json:"supported,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Welcome) Reset() {
+	*x = Welcome{}
+	mi := &file_realtime_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Welcome) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Welcome) ProtoMessage() {}
+
+func (x *Welcome) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Welcome.ProtoReflect.Descriptor instead.
+func (*Welcome) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Welcome) GetSchema() int32 {
+	if x != nil {
+		return x.Schema
+	}
+	return 0
+}
+
+func (x *Welcome) GetSupported() []int32 {
+	if x != nil {
+		return x.Supported
+	}
+	return nil
+}
+
+// Error is sent just before the server closes the connection; the close frame carries the
+// same code (4401 unauthorized, 4429 rate limited, 4503 draining, ...).
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          int32                  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`                               // WebSocket close code
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`                              // Machine-readable reason, e.g. "rate_limited"
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`                          // Human-readable explanation
+	RetryAfter    int32                  `protobuf:"varint,4,opt,name=retry_after,json=retryAfter,proto3" json:"retry_after,omitempty"` // Seconds to wait before reconnecting (0: no hint)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_realtime_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Error) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Error) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetRetryAfter() int32 {
+	if x != nil {
+		return x.RetryAfter
+	}
+	return 0
+}
+
+// Preferences is sent to a user's connections when their preferences change (see
+// PUT /api/preferences). json holds {"preferences": {...}, "changed": [...]}, since settings are
+// typed by the server's schema rather than by this file.
+type Preferences struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Json          []byte                 `protobuf:"bytes,1,opt,name=json,proto3" json:"json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Preferences) Reset() {
+	*x = Preferences{}
+	mi := &file_realtime_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Preferences) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Preferences) ProtoMessage() {}
+
+func (x *Preferences) ProtoReflect() protoreflect.Message {
+	mi := &file_realtime_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Preferences.ProtoReflect.Descriptor instead.
+func (*Preferences) Descriptor() ([]byte, []int) {
+	return file_realtime_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Preferences) GetJson() []byte {
+	if x != nil {
+		return x.Json
+	}
+	return nil
+}
+
+var File_realtime_proto protoreflect.FileDescriptor
+
+const file_realtime_proto_rawDesc = "" +
+	"\n" +
+	"\x0erealtime.proto\x12\x0fapp.realtime.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe3\x03\n" +
+	"\bEnvelope\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\x12*\n" +
+	"\x02ts\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x02ts\x12\x0e\n" +
+	"\x02id\x18\x04 \x01(\tR\x02id\x12A\n" +
+	"\fprice_update\x18\n" +
+	" \x01(\v2\x1c.app.realtime.v1.PriceUpdateH\x00R\vpriceUpdate\x12:\n" +
+	"\tbroadcast\x18\v \x01(\v2\x1a.app.realtime.v1.BroadcastH\x00R\tbroadcast\x124\n" +
+	"\awelcome\x18\f \x01(\v2\x18.app.realtime.v1.WelcomeH\x00R\awelcome\x12>\n" +
+	"\vprice_delta\x18\r \x01(\v2\x1b.app.realtime.v1.PriceDeltaH\x00R\n" +
+	"priceDelta\x12.\n" +
+	"\x05error\x18\x0e \x01(\v2\x16.app.realtime.v1.ErrorH\x00R\x05error\x12@\n" +
+	"\vpreferences\x18\x0f \x01(\v2\x1c.app.realtime.v1.PreferencesH\x00R\vpreferencesB\x06\n" +
+	"\x04data\"\xae\x01\n" +
+	"\vPriceUpdate\x12\x1b\n" +
+	"\tartist_id\x18\x01 \x01(\tR\bartistId\x12\x14\n" +
+	"\x05price\x18\x02 \x01(\tR\x05price\x12\x14\n" +
+	"\x05event\x18\x03 \x01(\tR\x05event\x12\x1b\n" +
+	"\ttenant_id\x18\x04 \x01(\tR\btenantId\x129\n" +
+	"\n" +
+	"price_meta\x18\x05 \x01(\v2\x1a.app.realtime.v1.PriceMetaR\tpriceMeta\"\xa2\x01\n" +
+	"\n" +
+	"PriceDelta\x12?\n" +
+	"\x06prices\x18\x01 \x03(\v2'.app.realtime.v1.PriceDelta.PricesEntryR\x06prices\x12\x18\n" +
+	"\aremoved\x18\x02 \x03(\tR\aremoved\x1a9\n" +
+	"\vPricesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8f\x01\n" +
+	"\tPriceMeta\x12\x1a\n" +
+	"\bcurrency\x18\x01 \x01(\tR\bcurrency\x12\x1c\n" +
+	"\tprecision\x18\x02 \x01(\x05R\tprecision\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\tR\x06amount\x12\x18\n" +
+	"\adisplay\x18\x04 \x01(\tR\adisplay\x12\x16\n" +
+	"\x06locale\x18\x05 \x01(\tR\x06locale\"\x1f\n" +
+	"\tBroadcast\x12\x12\n" +
+	"\x04json\x18\x01 \x01(\fR\x04json\"?\n" +
+	"\aWelcome\x12\x16\n" +
+	"\x06schema\x18\x01 \x01(\x05R\x06schema\x12\x1c\n" +
+	"\tsupported\x18\x02 \x03(\x05R\tsupported\"l\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1f\n" +
+	"\vretry_after\x18\x04 \x01(\x05R\n" +
+	"retryAfter\"!\n" +
+	"\vPreferences\x12\x12\n" +
+	"\x04json\x18\x01 \x01(\fR\x04jsonB!Z\x1fboilerplate/internal/realtimepbb\x06proto3"
+
+var (
+	file_realtime_proto_rawDescOnce sync.Once
+	file_realtime_proto_rawDescData []byte
+)
+
+func file_realtime_proto_rawDescGZIP() []byte {
+	file_realtime_proto_rawDescOnce.Do(func() {
+		file_realtime_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_realtime_proto_rawDesc), len(file_realtime_proto_rawDesc)))
+	})
+	return file_realtime_proto_rawDescData
+}
+
+var file_realtime_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_realtime_proto_goTypes = []any{
+	(*Envelope)(nil),              // 0: app.realtime.v1.Envelope
+	(*PriceUpdate)(nil),           // 1: app.realtime.v1.PriceUpdate
+	(*PriceDelta)(nil),            // 2: app.realtime.v1.PriceDelta
+	(*PriceMeta)(nil),             // 3: app.realtime.v1.PriceMeta
+	(*Broadcast)(nil),             // 4: app.realtime.v1.Broadcast
+	(*Welcome)(nil),               // 5: app.realtime.v1.Welcome
+	(*Error)(nil),                 // 6: app.realtime.v1.Error
+	(*Preferences)(nil),           // 7: app.realtime.v1.Preferences
+	nil,                           // 8: app.realtime.v1.PriceDelta.PricesEntry
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+}
+var file_realtime_proto_depIdxs = []int32{
+	9, // 0: app.realtime.v1.Envelope.ts:type_name -> google.protobuf.Timestamp
+	1, // 1: app.realtime.v1.Envelope.price_update:type_name -> app.realtime.v1.PriceUpdate
+	4, // 2: app.realtime.v1.Envelope.broadcast:type_name -> app.realtime.v1.Broadcast
+	5, // 3: app.realtime.v1.Envelope.welcome:type_name -> app.realtime.v1.Welcome
+	2, // 4: app.realtime.v1.Envelope.price_delta:type_name -> app.realtime.v1.PriceDelta
+	6, // 5: app.realtime.v1.Envelope.error:type_name -> app.realtime.v1.Error
+	7, // 6: app.realtime.v1.Envelope.preferences:type_name -> app.realtime.v1.Preferences
+	3, // 7: app.realtime.v1.PriceUpdate.price_meta:type_name -> app.realtime.v1.PriceMeta
+	8, // 8: app.realtime.v1.PriceDelta.prices:type_name -> app.realtime.v1.PriceDelta.PricesEntry
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_realtime_proto_init() }
+func file_realtime_proto_init() {
+	if File_realtime_proto != nil {
+		return
+	}
+	file_realtime_proto_msgTypes[0].OneofWrappers = []any{
+		(*Envelope_PriceUpdate)(nil),
+		(*Envelope_Broadcast)(nil),
+		(*Envelope_Welcome)(nil),
+		(*Envelope_PriceDelta)(nil),
+		(*Envelope_Error)(nil),
+		(*Envelope_Preferences)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_realtime_proto_rawDesc), len(file_realtime_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_realtime_proto_goTypes,
+		DependencyIndexes: file_realtime_proto_depIdxs,
+		MessageInfos:      file_realtime_proto_msgTypes,
+	}.Build()
+	File_realtime_proto = out.File
+	file_realtime_proto_goTypes = nil
+	file_realtime_proto_depIdxs = nil
+}
@@ -0,0 +1,195 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MaxBulkSize is the most operations one Bulk call accepts.
+const MaxBulkSize = 100
+
+// Bulk operation kinds.
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpRestore = "restore"
+)
+
+// BulkOperation is one item of a bulk request.
+type BulkOperation struct {
+	Op      string                 `json:"op"`                // create, update, delete or restore
+	ID      string                 `json:"id,omitempty"`      // All but create
+	Fields  map[string]interface{} `json:"fields,omitempty"`  // create and update
+	Version *int                   `json:"version,omitempty"` // Optional expected version, like If-Match
+}
+
+// BulkResult is the outcome of one operation: the written row, or why it failed.
+type BulkResult struct {
+	Record Record
+	Err    error // nil on success; ErrNotApplied for valid operations of a failed atomic batch
+}
+
+var (
+	// ErrNotApplied is the result of the operations of an atomic batch that were valid but not
+	// written because another operation failed.
+	ErrNotApplied = errors.New("not applied: another operation in the batch failed")
+
+	// ErrTooManyOperations is returned for bulk requests over MaxBulkSize.
+	ErrTooManyOperations = fmt.Errorf("at most %d operations per request", MaxBulkSize)
+)
+
+// Bulk runs several operations for the owner and returns one result per operation, in order.
+//
+// Individually (atomic false), each operation is applied on its own, like the single-row
+// methods, and the others go ahead whatever its outcome. Atomically, every operation is checked
+// first and then all are written in one transaction (Store.Apply); if any fails, none is written,
+// the failing one reports why and the others report ErrNotApplied.
+//
+// The error is only for failures of the request as a whole: too many operations, or (atomic)
+// the store failing.
+func (r *Resource) Bulk(ctx context.Context, owner Owner, operations []BulkOperation, atomic bool) ([]BulkResult, error) {
+	if DefaultStore == nil {
+		return nil, ErrNotConfigured
+	}
+	if len(operations) > MaxBulkSize {
+		return nil, ErrTooManyOperations
+	}
+
+	if !atomic {
+		results := make([]BulkResult, len(operations))
+		for i, operation := range operations {
+			results[i].Record, results[i].Err = r.apply(ctx, owner, operation)
+		}
+		return results, nil
+	}
+	return r.applyAtomic(ctx, owner, operations)
+}
+
+// apply runs one operation on its own.
+func (r *Resource) apply(ctx context.Context, owner Owner, operation BulkOperation) (Record, error) {
+	version := AnyVersion
+	if operation.Version != nil {
+		version = *operation.Version
+	}
+
+	switch operation.Op {
+	case OpCreate:
+		return r.Create(ctx, owner, operation.Fields)
+	case OpUpdate:
+		return r.Update(ctx, owner, operation.ID, operation.Fields, version)
+	case OpDelete:
+		return r.modify(ctx, owner, operation.ID, version, deleteChange)
+	case OpRestore:
+		return r.modify(ctx, owner, operation.ID, version, restoreChange)
+	}
+	return nil, &ValidationError{Field: "op", Message: "must be create, update, delete or restore"}
+}
+
+// applyAtomic checks every operation, then writes them all in one transaction.
+func (r *Resource) applyAtomic(ctx context.Context, owner Owner, operations []BulkOperation) ([]BulkResult, error) {
+	results := make([]BulkResult, len(operations))
+	writes := make([]Write, len(operations))
+	failed := false
+
+	// Step 1: Check every operation and build its write, without writing anything
+	seen := make(map[string]bool, len(operations))
+	for i, operation := range operations {
+		if operation.ID != "" && seen[operation.ID] {
+			results[i].Err = &ValidationError{Field: "id", Message: "appears more than once in an atomic batch"}
+			failed = true
+			continue
+		}
+		seen[operation.ID] = true
+
+		writes[i], results[i].Record, results[i].Err = r.prepare(ctx, owner, operation)
+		if results[i].Err != nil {
+			failed = true
+		}
+	}
+
+	// Step 2: Write them together
+	if !failed {
+		err := DefaultStore.Apply(ctx, r.Table, writes)
+		var batchErr *BatchError
+		switch {
+		case errors.As(err, &batchErr) && batchErr.Index >= 0 && batchErr.Index < len(results):
+			// Another request changed the row since step 1
+			latest, loadErr := r.load(ctx, owner, operations[batchErr.Index].ID)
+			if loadErr != nil {
+				results[batchErr.Index].Err = loadErr
+			} else {
+				results[batchErr.Index].Err = &ConflictError{Current: latest}
+			}
+			failed = true
+		case err != nil:
+			return nil, fmt.Errorf("failed to apply %s bulk writes: %w", r.Name, err)
+		default:
+			r.invalidate(owner)
+		}
+	}
+
+	// Step 3: Nothing was written if anything failed
+	if failed {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = BulkResult{Err: ErrNotApplied}
+			} else {
+				results[i].Record = nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// prepare checks an operation and returns its write and the row as it will be once written.
+func (r *Resource) prepare(ctx context.Context, owner Owner, operation BulkOperation) (Write, Record, error) {
+	if operation.Op == OpCreate {
+		record, err := r.newRecord(owner, operation.Fields)
+		if err != nil {
+			return Write{}, nil, err
+		}
+		return Write{ID: record.ID(), Fields: record}, record, nil
+	}
+
+	var change func(Record) (Record, error)
+	switch operation.Op {
+	case OpUpdate:
+		fields, err := r.validate(operation.Fields, false)
+		if err != nil {
+			return Write{}, nil, err
+		}
+		change = func(record Record) (Record, error) {
+			if record.Deleted() {
+				return nil, ErrNotFound
+			}
+			return fields, nil
+		}
+	case OpDelete:
+		change = deleteChange
+	case OpRestore:
+		change = restoreChange
+	default:
+		return Write{}, nil, &ValidationError{Field: "op", Message: "must be create, update, delete or restore"}
+	}
+
+	record, err := r.load(ctx, owner, operation.ID)
+	if err != nil {
+		return Write{}, nil, err
+	}
+	fields, err := change(record)
+	if err != nil {
+		return Write{}, nil, err
+	}
+	if operation.Version != nil && record.Version() != *operation.Version {
+		return Write{}, nil, &ConflictError{Current: record}
+	}
+
+	current := record.Version()
+	changes := withVersion(fields, current)
+	for column, value := range changes {
+		record[column] = value
+	}
+	return Write{ID: record.ID(), Version: current, Fields: changes}, record, nil
+}
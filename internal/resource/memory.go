@@ -0,0 +1,179 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps rows in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	tables map[string]map[string]Record // table -> id -> row
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tables: make(map[string]map[string]Record)}
+}
+
+// List returns copies of the matching rows, newest first.
+func (m *MemoryStore) List(ctx context.Context, table string, filter Filter) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := make([]Record, 0)
+	for _, record := range m.tables[table] {
+		if record[ColumnTenantID] != filter.TenantID || record.Deleted() != filter.Deleted {
+			continue
+		}
+		if filter.UserID != "" && record[ColumnUserID] != filter.UserID {
+			continue
+		}
+		if !equals(record, filter.Equals) {
+			continue
+		}
+		matches = append(matches, clone(record))
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, _ := matches[i][ColumnCreatedAt].(string)
+		b, _ := matches[j][ColumnCreatedAt].(string)
+		if a != b {
+			return a > b
+		}
+		return matches[i].ID() > matches[j].ID()
+	})
+
+	if filter.Offset >= len(matches) {
+		return []Record{}, nil
+	}
+	matches = matches[filter.Offset:]
+	if filter.Limit > 0 && len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+	}
+	return matches, nil
+}
+
+// equals reports whether every column of values has its value in record, compared as text.
+func equals(record Record, values map[string]string) bool {
+	for column, value := range values {
+		if record[column] == nil || fmt.Sprint(record[column]) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns a copy of the row with id, or nil.
+func (m *MemoryStore) Get(ctx context.Context, table, id string) (Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.tables[table][id]
+	if !ok {
+		return nil, nil
+	}
+	return clone(record), nil
+}
+
+// Insert stores a copy of the row.
+func (m *MemoryStore) Insert(ctx context.Context, table string, record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tables[table] == nil {
+		m.tables[table] = make(map[string]Record)
+	}
+	m.tables[table][record.ID()] = clone(record)
+	return nil
+}
+
+// Update sets columns of the row with id if it is still at version.
+func (m *MemoryStore) Update(ctx context.Context, table, id string, version int, fields Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.tables[table][id]
+	if !ok || record.Version() != version {
+		return ErrConflict
+	}
+	for column, value := range clone(fields) {
+		record[column] = value
+	}
+	return nil
+}
+
+// Purge removes the rows soft-deleted before before.
+func (m *MemoryStore) Purge(ctx context.Context, table string, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, record := range m.tables[table] {
+		deletedAt, _ := record[ColumnDeletedAt].(string)
+		if deletedAt == "" {
+			continue
+		}
+		if parsed, err := time.Parse(time.RFC3339Nano, deletedAt); err == nil && parsed.Before(before) {
+			delete(m.tables[table], id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Apply applies every write or none: they are checked and staged first, then committed together.
+func (m *MemoryStore) Apply(ctx context.Context, table string, writes []Write) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Stage the writes on copies, so a failure leaves the table untouched
+	staged := make(map[string]Record, len(writes))
+	for i, write := range writes {
+		current, ok := staged[write.ID]
+		if !ok {
+			if stored, exists := m.tables[table][write.ID]; exists {
+				current = clone(stored)
+			}
+		}
+
+		if write.Version == 0 {
+			if current != nil {
+				return &BatchError{Index: i, Err: ErrConflict}
+			}
+			staged[write.ID] = clone(write.Fields)
+			continue
+		}
+		if current == nil || current.Version() != write.Version {
+			return &BatchError{Index: i, Err: ErrConflict}
+		}
+		for column, value := range clone(write.Fields) {
+			current[column] = value
+		}
+		staged[write.ID] = current
+	}
+
+	if m.tables[table] == nil {
+		m.tables[table] = make(map[string]Record)
+	}
+	for id, record := range staged {
+		m.tables[table][id] = record
+	}
+	return nil
+}
+
+// clone deep-copies a row through JSON, so it looks the same as one read back from Postgres
+// (numbers as float64) and callers can't modify stored values.
+func clone(record Record) Record {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return Record{}
+	}
+	var copied Record
+	json.Unmarshal(encoded, &copied)
+	return copied
+}
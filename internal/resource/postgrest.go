@@ -0,0 +1,256 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// PostgRESTStore keeps rows in Postgres through the Supabase REST API (PostgREST).
+// It uses the service role key; access control is done by Resource (owner checks), not RLS.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/",
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// List returns the matching rows, newest first.
+func (s *PostgRESTStore) List(ctx context.Context, table string, filter Filter) ([]Record, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set(ColumnTenantID, "eq."+filter.TenantID)
+	if filter.UserID != "" {
+		params.Set(ColumnUserID, "eq."+filter.UserID)
+	}
+	for column, value := range filter.Equals {
+		params.Set(column, "eq."+value)
+	}
+	if filter.Deleted {
+		params.Set(ColumnDeletedAt, "not.is.null")
+	} else {
+		params.Set(ColumnDeletedAt, "is.null")
+	}
+	params.Set("order", "created_at.desc,id.desc")
+	if filter.Limit > 0 {
+		params.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.Offset > 0 {
+		params.Set("offset", strconv.Itoa(filter.Offset))
+	}
+	return s.list(ctx, table, params)
+}
+
+// Get returns the row with id, or nil.
+func (s *PostgRESTStore) Get(ctx context.Context, table, id string) (Record, error) {
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set(ColumnID, "eq."+id)
+
+	records, err := s.list(ctx, table, params)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// Insert adds a row.
+func (s *PostgRESTStore) Insert(ctx context.Context, table string, record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode row: %w", err)
+	}
+
+	resp, err := s.do(ctx, "POST", s.baseURL+table, body, "return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Update sets columns of the row with id if it is still at version. The version check is part
+// of the statement, so it holds against concurrent writers.
+func (s *PostgRESTStore) Update(ctx context.Context, table, id string, version int, fields Record) error {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode row: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set(ColumnID, "eq."+id)
+	params.Set(ColumnVersion, "eq."+strconv.Itoa(version))
+	params.Set("select", ColumnID)
+
+	// Ask for the matched rows back to know whether the row was still at version
+	resp, err := s.do(ctx, "PATCH", s.baseURL+table+"?"+params.Encode(), body, "return=representation")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var updated []Record
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		return fmt.Errorf("failed to parse updated rows: %w", err)
+	}
+	if len(updated) == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Purge deletes the rows soft-deleted before before.
+func (s *PostgRESTStore) Purge(ctx context.Context, table string, before time.Time) (int, error) {
+	params := url.Values{}
+	params.Set(ColumnDeletedAt, "lt."+before.UTC().Format(time.RFC3339Nano))
+	params.Set("select", ColumnID)
+
+	// Ask for the deleted IDs back to count them
+	resp, err := s.do(ctx, "DELETE", s.baseURL+table+"?"+params.Encode(), nil, "return=representation")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var deleted []Record
+	if err := json.NewDecoder(resp.Body).Decode(&deleted); err != nil {
+		return 0, fmt.Errorf("failed to parse purged rows: %w", err)
+	}
+	return len(deleted), nil
+}
+
+// Apply sends the writes to the resource_apply_writes function (see schema.sql), which runs them
+// in one transaction.
+func (s *PostgRESTStore) Apply(ctx context.Context, table string, writes []Write) error {
+	type write struct {
+		ID      string `json:"id"`
+		Version int    `json:"version"`
+		Fields  Record `json:"fields"`
+	}
+	payload := struct {
+		Table  string  `json:"p_table"`
+		Writes []write `json:"p_writes"`
+	}{Table: table, Writes: make([]write, len(writes))}
+	for i, w := range writes {
+		payload.Writes[i] = write{ID: w.ID, Version: w.Version, Fields: w.Fields}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode writes: %w", err)
+	}
+	resp, err := s.do(ctx, "POST", s.baseURL+"rpc/resource_apply_writes", body, "")
+	var failed *restError
+	if errors.As(err, &failed) {
+		return failed.batchError()
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// list runs a select on table and decodes the rows.
+func (s *PostgRESTStore) list(ctx context.Context, table string, params url.Values) ([]Record, error) {
+	resp, err := s.do(ctx, "GET", s.baseURL+table+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	records := make([]Record, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to parse %s rows: %w", table, err)
+	}
+	return records, nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &restError{status: resp.StatusCode, body: respBody}
+	}
+	return resp, nil
+}
+
+// restError is a failed PostgREST request.
+type restError struct {
+	status int
+	body   []byte // {"code": "...", "message": "...", "details": "..."}
+}
+
+func (e *restError) Error() string {
+	return fmt.Sprintf("Supabase REST error (status %d): %s", e.status, string(e.body))
+}
+
+// batchError converts the error of a failed resource_apply_writes call: a version conflict
+// (SQLSTATE P0409, with the write's index as details) or a duplicate insert (23505) is a
+// *BatchError wrapping ErrConflict. Anything else is returned as is.
+func (e *restError) batchError() error {
+	var failure struct {
+		Code    string `json:"code"`
+		Details string `json:"details"`
+	}
+	if json.Unmarshal(e.body, &failure) != nil {
+		return e
+	}
+	switch failure.Code {
+	case "P0409", "23505":
+		index, err := strconv.Atoi(failure.Details)
+		if err != nil {
+			index = -1 // Postgres doesn't say which insert was a duplicate
+		}
+		return &BatchError{Index: index, Err: ErrConflict}
+	}
+	return e
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
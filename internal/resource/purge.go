@@ -0,0 +1,49 @@
+package resource
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunPurger hard-deletes rows soft-deleted more than RESOURCE_RETENTION ago, every
+// RESOURCE_PURGE_INTERVAL. Call it in a goroutine after Init(); it runs until ctx is cancelled.
+func RunPurger(ctx context.Context) {
+	interval := settings.PurgeInterval
+	log.Printf("Resource purge job started (every %s, retention %s)", interval, settings.Retention)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		PurgeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeAll purges every resource and returns how many rows were removed. Failures are logged
+// and the other resources are still purged; the next run retries.
+func PurgeAll(ctx context.Context) int {
+	if DefaultStore == nil {
+		return 0
+	}
+
+	before := now().UTC().Add(-settings.Retention)
+	total := 0
+	for _, r := range All() {
+		purged, err := DefaultStore.Purge(ctx, r.Table, before)
+		if err != nil {
+			log.Printf("ERROR: Failed to purge deleted %s: %v", r.Name, err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("INFO: Purged %d deleted %s", purged, r.Name)
+		}
+		total += purged
+	}
+	return total
+}
@@ -0,0 +1,760 @@
+package resource
+
+// Package resource provides the first-party CRUD resources (watchlist, alerts, artists), each
+// declared as data: a table, its writable fields and whether rows belong to a user. The HTTP
+// endpoints are generated from the definition (see internal/handlers/resource.go and
+// resourceRoutes in internal/app/routes.go).
+//
+// Deletes are soft: DELETE sets deleted_at, default queries skip deleted rows, restore clears it
+// again, and a purge job removes rows deleted more than RESOURCE_RETENTION ago. Hard deletes left
+// the cache and realtime layers pointing at rows that no longer existed (a cached list, a price
+// update already in flight); a soft-deleted row stays resolvable until the purge, and every write
+// invalidates the cached lists.
+//
+// Every write increments the row's version and only applies if the row is still at the version
+// it read (optimistic locking). Update also takes the version the client last saw (its If-Match
+// header) and returns a *ConflictError instead of overwriting a newer edit from another device.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/price"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+)
+
+// Standard columns, present on every resource table and managed by this package.
+const (
+	ColumnID        = "id"
+	ColumnUserID    = "user_id" // Owned resources only
+	ColumnTenantID  = "tenant_id"
+	ColumnCreatedAt = "created_at"
+	ColumnUpdatedAt = "updated_at"
+	ColumnDeletedAt = "deleted_at" // null while the row is live
+	ColumnVersion   = "version"    // 1 on insert, incremented on every write
+)
+
+// AnyVersion is passed as the expected version to write whatever the current version is.
+const AnyVersion = -1
+
+// maxAttempts is how many times a write without an expected version is retried when another
+// write gets in first.
+const maxAttempts = 3
+
+// Page size limits for List.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// DefaultMaxLength is the maximum length of string fields without a MaxLength.
+const DefaultMaxLength = 200
+
+// Kind is the type of a field's value.
+type Kind string
+
+// Field kinds.
+const (
+	KindString  Kind = "string"
+	KindNumber  Kind = "number"
+	KindBoolean Kind = "boolean"
+	KindDecimal Kind = "decimal" // Exact decimal, stored and returned as a string (e.g. "45.67")
+)
+
+// Record is one row, as a JSON object.
+type Record map[string]interface{}
+
+// ID returns the record's id.
+func (r Record) ID() string {
+	id, _ := r[ColumnID].(string)
+	return id
+}
+
+// Deleted reports whether the record is soft-deleted.
+func (r Record) Deleted() bool {
+	return r[ColumnDeletedAt] != nil
+}
+
+// Version returns the record's version (0 if unset). Decoded rows hold it as a float64.
+func (r Record) Version() int {
+	switch version := r[ColumnVersion].(type) {
+	case float64:
+		return int(version)
+	case int:
+		return version
+	}
+	return 0
+}
+
+// Field is a writable column.
+type Field struct {
+	Name      string
+	Kind      Kind
+	Required  bool        // Must be set on create
+	Default   interface{} // Value on create when omitted (nil: column default)
+	MaxLength int         // Strings: maximum characters (0: DefaultMaxLength)
+	Allowed   []string    // Strings: the accepted values (empty: any)
+}
+
+// Definition declares a resource.
+type Definition struct {
+	Name   string  // Plural path segment (/api/<name>), also used in cache keys and audit actions
+	Table  string  // Postgres table (see schema.sql)
+	Owned  bool    // Rows belong to the user who created them; otherwise shared and written by admins
+	Fields []Field // Writable columns, in docs order
+}
+
+// Resource is a registered definition with its operations.
+type Resource struct {
+	Definition
+}
+
+// Owner is who a request acts as: the user (for owned resources) within a tenant.
+type Owner struct {
+	UserID   string
+	TenantID string
+}
+
+// Filter selects rows for Store.List.
+type Filter struct {
+	UserID   string            // Owned resources: only this user's rows
+	TenantID string            // Only this tenant's rows ("" for single-tenant deployments)
+	Deleted  bool              // Only soft-deleted rows (the trash) instead of live ones
+	Equals   map[string]string // Only rows whose column (key) has the value, e.g. {"active": "true"}
+	Limit    int
+	Offset   int
+}
+
+// Store persists resource rows.
+type Store interface {
+	// List returns the rows of table matching filter, newest first.
+	List(ctx context.Context, table string, filter Filter) ([]Record, error)
+
+	// Get returns the row with id (deleted or not), or nil.
+	Get(ctx context.Context, table, id string) (Record, error)
+
+	// Insert adds a row.
+	Insert(ctx context.Context, table string, record Record) error
+
+	// Update sets some columns of the row with id, if it is still at version. Otherwise (or if
+	// the row is gone) it returns ErrConflict and writes nothing.
+	Update(ctx context.Context, table, id string, version int, fields Record) error
+
+	// Purge hard-deletes the rows soft-deleted before before and returns how many.
+	Purge(ctx context.Context, table string, before time.Time) (int, error)
+
+	// Apply applies every write in one transaction, or none of them. A write whose row is not at
+	// its version (or, for an insert, already exists) fails the batch with a *BatchError.
+	Apply(ctx context.Context, table string, writes []Write) error
+}
+
+// Write is one write of an atomic batch (see Store.Apply).
+type Write struct {
+	ID      string
+	Version int    // The row's expected version; 0 inserts a new row
+	Fields  Record // The whole row for an insert, the changed columns for an update
+}
+
+// BatchError reports which write of a batch failed.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("write %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is a rejected field, reported to the client with its name.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ConflictError is an update rejected because the row changed since the version the client read.
+// Current is the row as it is now, for the client to merge and retry.
+type ConflictError struct {
+	Current Record
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("row has changed (now version %d)", e.Current.Version())
+}
+
+var (
+	// DefaultStore is the store used by every resource.
+	// It is nil until Init() or SetDefault() is called.
+	DefaultStore Store
+
+	// ErrNotConfigured is returned when the store is not initialized.
+	ErrNotConfigured = errors.New("resource store not initialized")
+
+	// ErrNotFound is returned for rows that don't exist, belong to someone else, or (except for
+	// Restore) are deleted.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNotDeleted is returned when restoring a row that isn't deleted.
+	ErrNotDeleted = errors.New("not deleted")
+
+	// ErrConflict is returned by Store.Update when the row is not at the expected version.
+	ErrConflict = errors.New("row was modified concurrently")
+
+	// now is the clock used for timestamps (overridable in tests).
+	now = time.Now
+
+	// settings are the RESOURCE_* settings, set by Init.
+	settings = config.Resource{Retention: 30 * 24 * time.Hour, PurgeInterval: time.Hour, CacheTTL: time.Minute}
+
+	// identifierPattern restricts names, tables and fields to safe identifiers.
+	identifierPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+	// registry holds every resource, in registration order.
+	registry   []*Resource
+	registryMu sync.RWMutex
+
+	// changeHooks are called after every write (see OnChange).
+	changeHooks   []ChangeHook
+	changeHooksMu sync.RWMutex
+)
+
+// Built-in resources.
+var (
+	// Watchlist is the artists a user follows.
+	Watchlist = MustRegister(Definition{
+		Name:  "watchlist",
+		Table: "watchlist_items",
+		Owned: true,
+		Fields: []Field{
+			{Name: "artist_id", Kind: KindString, Required: true, MaxLength: 64},
+			{Name: "note", Kind: KindString, MaxLength: 200},
+		},
+	})
+
+	// Alerts are a user's price alerts: notify when an artist's price goes above or below a threshold.
+	Alerts = MustRegister(Definition{
+		Name:  "alerts",
+		Table: "price_alerts",
+		Owned: true,
+		Fields: []Field{
+			{Name: "artist_id", Kind: KindString, Required: true, MaxLength: 64},
+			{Name: "direction", Kind: KindString, Required: true, Allowed: []string{"above", "below"}},
+			{Name: "threshold", Kind: KindDecimal, Required: true},
+			{Name: "active", Kind: KindBoolean, Default: true},
+		},
+	})
+
+	// Artists are shared: every user reads them, admins write them.
+	Artists = MustRegister(Definition{
+		Name:  "artists",
+		Table: "artists",
+		Fields: []Field{
+			{Name: "name", Kind: KindString, Required: true, MaxLength: 100},
+		},
+	})
+)
+
+// Register adds a resource. Its routes are mounted by NewApp, so register before it runs.
+func Register(definition Definition) (*Resource, error) {
+	if !identifierPattern.MatchString(definition.Name) || !identifierPattern.MatchString(definition.Table) {
+		return nil, fmt.Errorf("invalid resource name or table: %s (%s)", definition.Name, definition.Table)
+	}
+	for _, field := range definition.Fields {
+		if !identifierPattern.MatchString(field.Name) || isStandardColumn(field.Name) {
+			return nil, fmt.Errorf("resource %s: invalid field name %q", definition.Name, field.Name)
+		}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name == definition.Name {
+			return nil, fmt.Errorf("resource %s already registered", definition.Name)
+		}
+	}
+	r := &Resource{Definition: definition}
+	registry = append(registry, r)
+	return r, nil
+}
+
+// MustRegister is Register for package-level declarations; it panics on an invalid definition.
+func MustRegister(definition Definition) *Resource {
+	r, err := Register(definition)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// All returns every registered resource, in registration order.
+func All() []*Resource {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]*Resource(nil), registry...)
+}
+
+// Init initializes the default store, and the purge job and cache from the RESOURCE_* settings.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, rows are stored in Postgres (see
+// schema.sql) and the tables of owned resources are registered for GDPR erasure and export.
+// Otherwise they are kept in memory and lost on restart.
+func Init(cfg config.Resource, supabase config.Supabase) {
+	settings = cfg
+	names := make([]string, 0, len(All()))
+	for _, r := range All() {
+		names = append(names, r.Name)
+		if r.Owned {
+			gdpr.RegisterCacheKey(r.cacheKey(Owner{UserID: "{user_id}"}))
+		}
+	}
+
+	if supabase.URL == "" || supabase.ServiceRoleKey == "" {
+		log.Println("WARNING: SUPABASE_SERVICE_ROLE_KEY not set, resources are kept in memory only")
+		startup.Report("resources", true, "in memory (SUPABASE_SERVICE_ROLE_KEY not set): "+strings.Join(names, ", "))
+		DefaultStore = NewMemoryStore()
+		return
+	}
+
+	for _, r := range All() {
+		if !r.Owned {
+			continue
+		}
+		if err := gdpr.RegisterTable(r.Table, ColumnUserID); err != nil {
+			log.Printf("WARNING: Failed to register %s for GDPR erasure: %v", r.Table, err)
+		}
+	}
+	DefaultStore = NewPostgRESTStore(supabase.URL, supabase.ServiceRoleKey)
+	log.Println("Resources initialized (Supabase Postgres)")
+	startup.Report("resources", true, fmt.Sprintf("Supabase Postgres: %s; purged %s after deletion",
+		strings.Join(names, ", "), settings.Retention))
+}
+
+// SetDefault replaces the default store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// List returns a page of the owner's live rows, or of their deleted rows (the trash), newest
+// first. hasMore reports whether there is another page. The first page of live rows is cached
+// for RESOURCE_CACHE_TTL.
+func (r *Resource) List(ctx context.Context, owner Owner, deleted bool, page, limit int) (records []Record, hasMore bool, err error) {
+	if DefaultStore == nil {
+		return nil, false, ErrNotConfigured
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+
+	// Step 1: Try the cache (first page of live rows at the default size, the common request)
+	cacheable := !deleted && page == 1 && limit == DefaultPageSize
+	store := tenant.CacheFor(owner.TenantID)
+	if cacheable && store != nil {
+		if cached, err := store.Get(r.cacheKey(owner)); err == nil && cached != "" {
+			var page cachedPage
+			if err := json.Unmarshal([]byte(cached), &page); err == nil {
+				return page.Records, page.HasMore, nil
+			}
+		}
+	}
+
+	// Step 2: Load one extra row to know whether there is another page
+	filter := Filter{TenantID: owner.TenantID, Deleted: deleted, Limit: limit + 1, Offset: (page - 1) * limit}
+	if r.Owned {
+		filter.UserID = owner.UserID
+	}
+	records, err = DefaultStore.List(ctx, r.Table, filter)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list %s: %w", r.Name, err)
+	}
+	if hasMore = len(records) > limit; hasMore {
+		records = records[:limit]
+	}
+
+	// Step 3: Cache it
+	if cacheable && store != nil {
+		if encoded, err := json.Marshal(cachedPage{Records: records, HasMore: hasMore}); err == nil {
+			if err := store.Set(r.cacheKey(owner), string(encoded), settings.CacheTTL); err != nil {
+				log.Printf("WARNING: Failed to cache %s: %v", r.Name, err)
+			}
+		}
+	}
+	return records, hasMore, nil
+}
+
+// Match returns up to limit live rows of the tenant, of every user, whose fields have the given
+// values (compared as text, e.g. {"artist_id": "a1", "active": "true"}), newest first. It is for
+// background work across users, such as evaluating price alerts; requests use List.
+func (r *Resource) Match(ctx context.Context, tenantID string, equals map[string]string, limit int) ([]Record, error) {
+	if DefaultStore == nil {
+		return nil, ErrNotConfigured
+	}
+	for column := range equals {
+		if r.field(column) == nil && !isStandardColumn(column) {
+			return nil, fmt.Errorf("%s has no field %q", r.Name, column)
+		}
+	}
+	records, err := DefaultStore.List(ctx, r.Table, Filter{TenantID: tenantID, Equals: equals, Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to match %s: %w", r.Name, err)
+	}
+	return records, nil
+}
+
+// cachedPage is a cached first page.
+type cachedPage struct {
+	Records []Record `json:"records"`
+	HasMore bool     `json:"has_more"`
+}
+
+// Get returns one of the owner's live rows.
+func (r *Resource) Get(ctx context.Context, owner Owner, id string) (Record, error) {
+	record, err := r.load(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Deleted() {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// Create validates input and inserts a row for the owner.
+func (r *Resource) Create(ctx context.Context, owner Owner, input map[string]interface{}) (Record, error) {
+	if DefaultStore == nil {
+		return nil, ErrNotConfigured
+	}
+
+	record, err := r.newRecord(owner, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := DefaultStore.Insert(ctx, r.Table, record); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", r.Name, err)
+	}
+	r.invalidate(owner)
+	return record, nil
+}
+
+// newRecord validates input and returns the row to insert for the owner.
+func (r *Resource) newRecord(owner Owner, input map[string]interface{}) (Record, error) {
+	record, err := r.validate(input, true)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := now().UTC().Format(time.RFC3339Nano)
+	record[ColumnID] = id
+	record[ColumnTenantID] = owner.TenantID
+	record[ColumnCreatedAt] = timestamp
+	record[ColumnUpdatedAt] = timestamp
+	record[ColumnDeletedAt] = nil
+	record[ColumnVersion] = 1
+	if r.Owned {
+		record[ColumnUserID] = owner.UserID
+	}
+	return record, nil
+}
+
+// Update validates input and changes the given fields of one of the owner's live rows.
+// If version is not AnyVersion and the row is no longer at that version, it returns a
+// *ConflictError.
+func (r *Resource) Update(ctx context.Context, owner Owner, id string, input map[string]interface{}, version int) (Record, error) {
+	fields, err := r.validate(input, false)
+	if err != nil {
+		return nil, err
+	}
+	return r.modify(ctx, owner, id, version, func(record Record) (Record, error) {
+		if record.Deleted() {
+			return nil, ErrNotFound
+		}
+		return fields, nil
+	})
+}
+
+// Delete soft-deletes one of the owner's live rows. It can be restored until the purge.
+func (r *Resource) Delete(ctx context.Context, owner Owner, id string) (Record, error) {
+	return r.modify(ctx, owner, id, AnyVersion, deleteChange)
+}
+
+// Restore undeletes one of the owner's soft-deleted rows.
+func (r *Resource) Restore(ctx context.Context, owner Owner, id string) (Record, error) {
+	return r.modify(ctx, owner, id, AnyVersion, restoreChange)
+}
+
+// deleteChange is the change made by Delete.
+func deleteChange(record Record) (Record, error) {
+	if record.Deleted() {
+		return nil, ErrNotFound
+	}
+	return Record{ColumnDeletedAt: now().UTC().Format(time.RFC3339Nano)}, nil
+}
+
+// restoreChange is the change made by Restore.
+func restoreChange(record Record) (Record, error) {
+	if !record.Deleted() {
+		return nil, ErrNotDeleted
+	}
+	return Record{ColumnDeletedAt: nil}, nil
+}
+
+// modify loads one of the owner's rows, asks change for the columns to write and saves them as
+// the next version.
+//
+// With an expected version, a row at another version is a *ConflictError. With AnyVersion,
+// losing a race to another write reloads the row and calls change again.
+func (r *Resource) modify(ctx context.Context, owner Owner, id string, version int, change func(Record) (Record, error)) (Record, error) {
+	for attempt := 1; ; attempt++ {
+		record, err := r.load(ctx, owner, id)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := change(record)
+		if err != nil {
+			return nil, err
+		}
+		if version != AnyVersion && record.Version() != version {
+			return nil, &ConflictError{Current: record}
+		}
+
+		saved, err := r.save(ctx, owner, record, fields)
+		if !errors.Is(err, ErrConflict) {
+			return saved, err
+		}
+		if version == AnyVersion && attempt < maxAttempts {
+			continue
+		}
+		latest, err := r.load(ctx, owner, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &ConflictError{Current: latest}
+	}
+}
+
+// load returns one of the owner's rows, deleted or not.
+func (r *Resource) load(ctx context.Context, owner Owner, id string) (Record, error) {
+	if DefaultStore == nil {
+		return nil, ErrNotConfigured
+	}
+
+	record, err := DefaultStore.Get(ctx, r.Table, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", r.Name, err)
+	}
+	if record == nil || record[ColumnTenantID] != owner.TenantID {
+		return nil, ErrNotFound
+	}
+	if r.Owned && record[ColumnUserID] != owner.UserID {
+		return nil, ErrNotFound // Someone else's: indistinguishable from a missing row
+	}
+	return record, nil
+}
+
+// save writes fields (plus updated_at and the next version) to a loaded row, if it is still at
+// the version it was loaded at, invalidates the cache and returns the updated row.
+func (r *Resource) save(ctx context.Context, owner Owner, record, fields Record) (Record, error) {
+	current := record.Version()
+	changes := withVersion(fields, current)
+	if err := DefaultStore.Update(ctx, r.Table, record.ID(), current, changes); err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", r.Name, err)
+	}
+	r.invalidate(owner)
+
+	for column, value := range changes {
+		record[column] = value
+	}
+	return record, nil
+}
+
+// withVersion returns the columns to write to a row at version: fields, updated_at and the next
+// version.
+func withVersion(fields Record, version int) Record {
+	changes := Record{
+		ColumnUpdatedAt: now().UTC().Format(time.RFC3339Nano),
+		ColumnVersion:   version + 1,
+	}
+	for column, value := range fields {
+		changes[column] = value
+	}
+	return changes
+}
+
+// ChangeHook is called after rows of a resource were written on behalf of owner.
+type ChangeHook func(r *Resource, owner Owner)
+
+// OnChange registers a hook called after every successful write (create, update, delete,
+// restore, bulk), e.g. to invalidate data derived from the rows elsewhere. Hooks run on the
+// request's goroutine, so keep them fast.
+func OnChange(hook ChangeHook) {
+	changeHooksMu.Lock()
+	defer changeHooksMu.Unlock()
+	changeHooks = append(changeHooks, hook)
+}
+
+// invalidate deletes the owner's cached list (for shared resources, everyone's in the tenant)
+// and runs the change hooks.
+func (r *Resource) invalidate(owner Owner) {
+	if store := tenant.CacheFor(owner.TenantID); store != nil {
+		if err := store.Del(r.cacheKey(owner)); err != nil {
+			log.Printf("WARNING: Failed to invalidate cached %s: %v", r.Name, err)
+		}
+	}
+
+	changeHooksMu.RLock()
+	hooks := changeHooks
+	changeHooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(r, owner)
+	}
+}
+
+// cacheKey is the cache key of the owner's first page (within the tenant's cache).
+func (r *Resource) cacheKey(owner Owner) string {
+	if r.Owned {
+		return "resource:" + r.Name + ":" + owner.UserID
+	}
+	return "resource:" + r.Name
+}
+
+// validate checks input against the fields and returns the row values to write. On create,
+// required fields must be present and omitted ones get their default.
+func (r *Resource) validate(input map[string]interface{}, creating bool) (Record, error) {
+	record := Record{}
+	for name := range input {
+		if r.field(name) == nil {
+			return nil, &ValidationError{Field: name, Message: "is not a writable field"}
+		}
+	}
+
+	for _, field := range r.Fields {
+		value, present := input[field.Name]
+		switch {
+		case !present:
+			if creating && field.Required {
+				return nil, &ValidationError{Field: field.Name, Message: "is required"}
+			}
+			if creating && field.Default != nil {
+				record[field.Name] = field.Default
+			}
+			continue
+		case value == nil:
+			if field.Required {
+				return nil, &ValidationError{Field: field.Name, Message: "must not be null"}
+			}
+			record[field.Name] = nil // Clears an optional field
+			continue
+		}
+
+		normalized, err := field.check(value)
+		if err != nil {
+			return nil, &ValidationError{Field: field.Name, Message: err.Error()}
+		}
+		record[field.Name] = normalized
+	}
+	return record, nil
+}
+
+// field returns the writable field called name, or nil.
+func (r *Resource) field(name string) *Field {
+	for i := range r.Fields {
+		if r.Fields[i].Name == name {
+			return &r.Fields[i]
+		}
+	}
+	return nil
+}
+
+// check validates a value and returns it in its stored form.
+func (f *Field) check(value interface{}) (interface{}, error) {
+	switch f.Kind {
+	case KindString:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		text = strings.TrimSpace(text)
+		maxLength := f.MaxLength
+		if maxLength == 0 {
+			maxLength = DefaultMaxLength
+		}
+		if utf8.RuneCountInString(text) > maxLength {
+			return nil, fmt.Errorf("must be at most %d characters", maxLength)
+		}
+		if len(f.Allowed) > 0 && !contains(f.Allowed, text) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(f.Allowed, ", "))
+		}
+		return text, nil
+	case KindNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return number, nil
+	case KindBoolean:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return flag, nil
+	case KindDecimal:
+		amount, err := price.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a decimal number")
+		}
+		return price.String(amount), nil
+	}
+	return nil, fmt.Errorf("has an unknown type")
+}
+
+// isStandardColumn reports whether name is managed by this package.
+func isStandardColumn(name string) bool {
+	switch name {
+	case ColumnID, ColumnUserID, ColumnTenantID, ColumnCreatedAt, ColumnUpdatedAt, ColumnDeletedAt, ColumnVersion:
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newID returns a random 128-bit hex ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
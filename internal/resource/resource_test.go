@@ -0,0 +1,410 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTest swaps in memory stores and a controllable clock.
+func setupTest(t *testing.T) (*MemoryStore, *cache.MemoryStore, *time.Time) {
+	t.Helper()
+
+	originalStore, originalCache, originalSettings := DefaultStore, cache.GetClient(), settings
+	t.Cleanup(func() {
+		SetDefault(originalStore)
+		cache.SetDefault(originalCache)
+		settings = originalSettings
+		now = time.Now
+	})
+
+	store := NewMemoryStore()
+	SetDefault(store)
+	cacheStore := cache.NewMemoryStore()
+	cache.SetDefault(cacheStore)
+
+	clock := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	return store, cacheStore, &clock
+}
+
+// TestCreate_Validation tests that invalid input is rejected with the offending field.
+func TestCreate_Validation(t *testing.T) {
+	setupTest(t)
+	owner := Owner{UserID: "u1"}
+
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		field string
+	}{
+		{"missing required", map[string]interface{}{"direction": "above", "threshold": "10"}, "artist_id"},
+		{"not allowed", map[string]interface{}{"artist_id": "a1", "direction": "sideways", "threshold": "10"}, "direction"},
+		{"bad decimal", map[string]interface{}{"artist_id": "a1", "direction": "above", "threshold": "ten"}, "threshold"},
+		{"wrong type", map[string]interface{}{"artist_id": "a1", "direction": "above", "threshold": "10", "active": "yes"}, "active"},
+		{"unknown field", map[string]interface{}{"artist_id": "a1", "direction": "above", "threshold": "10", "user_id": "u2"}, "user_id"},
+		{"null required", map[string]interface{}{"artist_id": nil, "direction": "above", "threshold": "10"}, "artist_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Alerts.Create(context.Background(), owner, tt.input)
+			var invalid *ValidationError
+			require.True(t, errors.As(err, &invalid), "expected a validation error, got %v", err)
+			assert.Equal(t, tt.field, invalid.Field)
+		})
+	}
+}
+
+// TestCreate_Defaults tests that the standard columns are set, defaults applied and decimals
+// normalized.
+func TestCreate_Defaults(t *testing.T) {
+	setupTest(t)
+
+	record, err := Alerts.Create(context.Background(), Owner{UserID: "u1", TenantID: "acme"}, map[string]interface{}{
+		"artist_id": " a1 ", "direction": "below", "threshold": 12.5,
+	})
+	require.NoError(t, err)
+	assert.Len(t, record.ID(), 32)
+	assert.Equal(t, "u1", record[ColumnUserID])
+	assert.Equal(t, "acme", record[ColumnTenantID])
+	assert.Equal(t, "a1", record["artist_id"])
+	assert.Equal(t, "12.5", record["threshold"])
+	assert.Equal(t, true, record["active"])
+	assert.Equal(t, "2025-01-01T12:00:00Z", record[ColumnCreatedAt])
+	assert.False(t, record.Deleted())
+}
+
+// TestList_CacheInvalidation tests that the first page is cached and every write invalidates it.
+func TestList_CacheInvalidation(t *testing.T) {
+	_, cacheStore, _ := setupTest(t)
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	records, hasMore, err := Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.False(t, hasMore)
+	cached, _ := cacheStore.Get("resource:watchlist:u1")
+	assert.NotEmpty(t, cached)
+
+	_, err = Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a1"})
+	require.NoError(t, err)
+	cached, _ = cacheStore.Get("resource:watchlist:u1")
+	assert.Empty(t, cached, "create should invalidate the cached list")
+
+	records, _, err = Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+// TestList_Pagination tests that pages are newest first and hasMore is reported.
+func TestList_Pagination(t *testing.T) {
+	_, _, clock := setupTest(t)
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	for _, artist := range []string{"a1", "a2", "a3"} {
+		_, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": artist})
+		require.NoError(t, err)
+		*clock = clock.Add(time.Second)
+	}
+
+	records, hasMore, err := Watchlist.List(ctx, owner, false, 1, 2)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.True(t, hasMore)
+	assert.Equal(t, "a3", records[0]["artist_id"])
+
+	records, hasMore, err = Watchlist.List(ctx, owner, false, 2, 2)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.False(t, hasMore)
+	assert.Equal(t, "a1", records[0]["artist_id"])
+}
+
+// TestDelete_SoftDeleteAndRestore tests that deleted rows leave the default list, show up in
+// the trash and come back when restored.
+func TestDelete_SoftDeleteAndRestore(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	created, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a1"})
+	require.NoError(t, err)
+
+	_, err = Watchlist.Restore(ctx, owner, created.ID())
+	assert.ErrorIs(t, err, ErrNotDeleted)
+
+	deleted, err := Watchlist.Delete(ctx, owner, created.ID())
+	require.NoError(t, err)
+	assert.True(t, deleted.Deleted())
+
+	live, _, err := Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Empty(t, live)
+	trash, _, err := Watchlist.List(ctx, owner, true, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Len(t, trash, 1)
+
+	_, err = Watchlist.Get(ctx, owner, created.ID())
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = Watchlist.Update(ctx, owner, created.ID(), map[string]interface{}{"note": "x"}, AnyVersion)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = Watchlist.Delete(ctx, owner, created.ID())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	restored, err := Watchlist.Restore(ctx, owner, created.ID())
+	require.NoError(t, err)
+	assert.False(t, restored.Deleted())
+
+	live, _, err = Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Len(t, live, 1)
+}
+
+// TestUpdate_VersionConflict tests that an update based on an old version is rejected with the
+// current row, and that writes without a version still apply.
+func TestUpdate_VersionConflict(t *testing.T) {
+	store, _, _ := setupTest(t)
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	created, err := Alerts.Create(ctx, owner, map[string]interface{}{"artist_id": "a1", "direction": "above", "threshold": "10"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, created.Version())
+
+	// Two devices read version 1; the first write wins
+	first, err := Alerts.Update(ctx, owner, created.ID(), map[string]interface{}{"threshold": "20"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, first.Version())
+
+	_, err = Alerts.Update(ctx, owner, created.ID(), map[string]interface{}{"threshold": "30"}, 1)
+	var conflict *ConflictError
+	require.True(t, errors.As(err, &conflict), "expected a conflict, got %v", err)
+	assert.Equal(t, 2, conflict.Current.Version())
+	assert.Equal(t, "20", conflict.Current["threshold"])
+
+	// Without a version the write applies to whatever is current
+	_, err = Alerts.Update(ctx, owner, created.ID(), map[string]interface{}{"active": false}, AnyVersion)
+	require.NoError(t, err)
+	deleted, err := Alerts.Delete(ctx, owner, created.ID())
+	require.NoError(t, err)
+	assert.Equal(t, 4, deleted.Version())
+
+	// The store refuses a write based on a stale version, e.g. one that raced with the above
+	assert.ErrorIs(t, store.Update(ctx, Alerts.Table, created.ID(), 3, Record{"active": true}), ErrConflict)
+}
+
+// TestOwnership tests that users and tenants can't see or change each other's rows.
+func TestOwnership(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	created, err := Watchlist.Create(ctx, Owner{UserID: "u1", TenantID: "acme"}, map[string]interface{}{"artist_id": "a1"})
+	require.NoError(t, err)
+
+	for _, other := range []Owner{{UserID: "u2", TenantID: "acme"}, {UserID: "u1", TenantID: "globex"}} {
+		_, err = Watchlist.Get(ctx, other, created.ID())
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = Watchlist.Delete(ctx, other, created.ID())
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		records, _, err := Watchlist.List(ctx, other, false, 1, DefaultPageSize)
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	}
+
+	// Shared resources are visible to every user of the tenant
+	artist, err := Artists.Create(ctx, Owner{UserID: "admin", TenantID: "acme"}, map[string]interface{}{"name": "Nina"})
+	require.NoError(t, err)
+	_, err = Artists.Get(ctx, Owner{UserID: "u2", TenantID: "acme"}, artist.ID())
+	assert.NoError(t, err)
+}
+
+// TestMatch tests that matching crosses users but not tenants, and skips deleted rows.
+func TestMatch(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+
+	create := func(owner Owner, artistID string, active bool) Record {
+		record, err := Alerts.Create(ctx, owner, map[string]interface{}{
+			"artist_id": artistID, "direction": "above", "threshold": "10", "active": active,
+		})
+		require.NoError(t, err)
+		return record
+	}
+	first := create(Owner{UserID: "u1", TenantID: "acme"}, "a1", true)
+	second := create(Owner{UserID: "u2", TenantID: "acme"}, "a1", true)
+	create(Owner{UserID: "u3", TenantID: "acme"}, "a1", false)
+	create(Owner{UserID: "u1", TenantID: "acme"}, "a2", true)
+	create(Owner{UserID: "u1", TenantID: "globex"}, "a1", true)
+	deleted := create(Owner{UserID: "u4", TenantID: "acme"}, "a1", true)
+	_, err := Alerts.Delete(ctx, Owner{UserID: "u4", TenantID: "acme"}, deleted.ID())
+	require.NoError(t, err)
+
+	records, err := Alerts.Match(ctx, "acme", map[string]string{"artist_id": "a1", "active": "true"}, 10)
+	require.NoError(t, err)
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ID())
+	}
+	assert.ElementsMatch(t, []string{first.ID(), second.ID()}, ids)
+
+	_, err = Alerts.Match(ctx, "acme", map[string]string{"price": "1"}, 10)
+	assert.Error(t, err, "unknown fields are rejected")
+}
+
+// TestPurgeAll tests that only rows deleted longer ago than the retention are removed.
+func TestPurgeAll(t *testing.T) {
+	store, _, clock := setupTest(t)
+	settings.Retention = 24 * time.Hour
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	old, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a1"})
+	require.NoError(t, err)
+	_, err = Watchlist.Delete(ctx, owner, old.ID())
+	require.NoError(t, err)
+
+	*clock = clock.Add(12 * time.Hour)
+	recent, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a2"})
+	require.NoError(t, err)
+	_, err = Watchlist.Delete(ctx, owner, recent.ID())
+	require.NoError(t, err)
+	live, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a3"})
+	require.NoError(t, err)
+
+	*clock = clock.Add(13 * time.Hour)
+	assert.Equal(t, 1, PurgeAll(ctx))
+
+	gone, _ := store.Get(ctx, Watchlist.Table, old.ID())
+	assert.Nil(t, gone)
+	kept, _ := store.Get(ctx, Watchlist.Table, recent.ID())
+	assert.NotNil(t, kept)
+	kept, _ = store.Get(ctx, Watchlist.Table, live.ID())
+	assert.NotNil(t, kept)
+}
+
+// TestRegister_Invalid tests that bad definitions are rejected.
+func TestRegister_Invalid(t *testing.T) {
+	_, err := Register(Definition{Name: "watchlist", Table: "other"})
+	assert.Error(t, err, "duplicate name")
+
+	_, err = Register(Definition{Name: "things", Table: "things", Fields: []Field{{Name: ColumnDeletedAt, Kind: KindString}}})
+	assert.Error(t, err, "standard column as a field")
+}
+
+// TestBulk_Individual tests that each operation is applied on its own and failures don't stop
+// the others.
+func TestBulk_Individual(t *testing.T) {
+	setupTest(t)
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	existing, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a1"})
+	require.NoError(t, err)
+
+	stale := 5
+	results, err := Watchlist.Bulk(ctx, owner, []BulkOperation{
+		{Op: OpCreate, Fields: map[string]interface{}{"artist_id": "a2"}},
+		{Op: OpCreate, Fields: map[string]interface{}{"note": "no artist"}},
+		{Op: OpUpdate, ID: existing.ID(), Fields: map[string]interface{}{"note": "x"}, Version: &stale},
+		{Op: OpDelete, ID: existing.ID()},
+		{Op: "archive", ID: existing.ID()},
+	}, false)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "a2", results[0].Record["artist_id"])
+	var invalid *ValidationError
+	assert.True(t, errors.As(results[1].Err, &invalid))
+	var conflict *ConflictError
+	assert.True(t, errors.As(results[2].Err, &conflict))
+	assert.NoError(t, results[3].Err)
+	assert.True(t, results[3].Record.Deleted())
+	assert.True(t, errors.As(results[4].Err, &invalid))
+	assert.Equal(t, "op", invalid.Field)
+
+	live, _, err := Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Len(t, live, 1)
+}
+
+// TestBulk_Atomic tests that an atomic batch is written entirely or not at all.
+func TestBulk_Atomic(t *testing.T) {
+	store, _, _ := setupTest(t)
+	ctx := context.Background()
+	owner := Owner{UserID: "u1"}
+
+	existing, err := Watchlist.Create(ctx, owner, map[string]interface{}{"artist_id": "a1"})
+	require.NoError(t, err)
+
+	// One invalid operation: nothing is written, the valid ones report ErrNotApplied
+	results, err := Watchlist.Bulk(ctx, owner, []BulkOperation{
+		{Op: OpCreate, Fields: map[string]interface{}{"artist_id": "a2"}},
+		{Op: OpUpdate, ID: existing.ID(), Fields: map[string]interface{}{"note": "x"}},
+		{Op: OpRestore, ID: existing.ID()},
+	}, true)
+	require.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, ErrNotApplied)
+	assert.Nil(t, results[0].Record)
+	assert.ErrorIs(t, results[1].Err, ErrNotApplied)
+	var invalid *ValidationError
+	assert.True(t, errors.As(results[2].Err, &invalid), "duplicate id")
+
+	stored, _ := store.Get(ctx, Watchlist.Table, existing.ID())
+	assert.Nil(t, stored["note"])
+	live, _, err := Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	assert.Len(t, live, 1)
+
+	// All valid: everything is written
+	results, err = Watchlist.Bulk(ctx, owner, []BulkOperation{
+		{Op: OpCreate, Fields: map[string]interface{}{"artist_id": "a2"}},
+		{Op: OpDelete, ID: existing.ID()},
+	}, true)
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+	assert.True(t, results[1].Record.Deleted())
+	live, _, err = Watchlist.List(ctx, owner, false, 1, DefaultPageSize)
+	require.NoError(t, err)
+	require.Len(t, live, 1)
+	assert.Equal(t, "a2", live[0]["artist_id"])
+
+	// Too many operations
+	_, err = Watchlist.Bulk(ctx, owner, make([]BulkOperation, MaxBulkSize+1), true)
+	assert.ErrorIs(t, err, ErrTooManyOperations)
+}
+
+// TestMemoryStore_Apply tests that a batch with a stale write leaves the table untouched.
+func TestMemoryStore_Apply(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	require.NoError(t, store.Insert(ctx, "t", Record{ColumnID: "r1", ColumnVersion: 1}))
+
+	err := store.Apply(ctx, "t", []Write{
+		{ID: "r2", Fields: Record{ColumnID: "r2", ColumnVersion: 1}},
+		{ID: "r1", Version: 1, Fields: Record{"note": "x", ColumnVersion: 2}},
+		{ID: "r1", Version: 1, Fields: Record{"note": "y", ColumnVersion: 2}}, // Stale after the previous write
+	})
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 2, batchErr.Index)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	added, _ := store.Get(ctx, "t", "r2")
+	assert.Nil(t, added)
+	unchanged, _ := store.Get(ctx, "t", "r1")
+	assert.Nil(t, unchanged["note"])
+}
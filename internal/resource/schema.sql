@@ -0,0 +1,95 @@
+-- Tables of the built-in resources (see resource.go). Run this in the Supabase SQL editor.
+--
+-- deleted_at is set by DELETE (soft delete) and cleared by restore. Rows deleted more than
+-- RESOURCE_RETENTION ago are removed by the purge job.
+
+create table if not exists watchlist_items (
+    id         text        primary key,
+    user_id    text        not null,               -- Supabase auth user ID (the JWT sub)
+    tenant_id  text        not null default '',
+    artist_id  text        not null,
+    note       text,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    version    integer     not null default 1     -- Optimistic locking: incremented on every write
+);
+
+create table if not exists price_alerts (
+    id         text        primary key,
+    user_id    text        not null,
+    tenant_id  text        not null default '',
+    artist_id  text        not null,
+    direction  text        not null check (direction in ('above', 'below')),
+    threshold  numeric     not null,
+    active     boolean     not null default true,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    version    integer     not null default 1     -- Optimistic locking: incremented on every write
+);
+
+-- Artists already exist (they are served by GraphQL); add the columns the resource needs.
+alter table artists add column if not exists tenant_id  text        not null default '';
+alter table artists add column if not exists created_at timestamptz not null default now();
+alter table artists add column if not exists updated_at timestamptz not null default now();
+alter table artists add column if not exists deleted_at timestamptz;
+alter table artists add column if not exists version    integer     not null default 1;
+
+-- Default queries only read live rows of one owner; the purge job scans deleted ones.
+create index if not exists watchlist_items_user_idx on watchlist_items (user_id, created_at desc) where deleted_at is null;
+create index if not exists watchlist_items_deleted_idx on watchlist_items (deleted_at) where deleted_at is not null;
+create index if not exists price_alerts_user_idx on price_alerts (user_id, created_at desc) where deleted_at is null;
+create index if not exists price_alerts_deleted_idx on price_alerts (deleted_at) where deleted_at is not null;
+create index if not exists artists_deleted_idx on artists (deleted_at) where deleted_at is not null;
+
+-- The backend reads and writes with the service role key. These policies let apps read their own
+-- live rows directly through Supabase (e.g. supabase-js); writes go through the API, which
+-- validates them.
+alter table watchlist_items enable row level security;
+alter table price_alerts enable row level security;
+
+create policy "Watchlist items are readable by their owner" on watchlist_items
+    for select using (auth.uid()::text = user_id and deleted_at is null);
+
+create policy "Price alerts are readable by their owner" on price_alerts
+    for select using (auth.uid()::text = user_id and deleted_at is null);
+
+-- Atomic bulk writes (POST /api/<resource>/bulk with "atomic": true). Each write is
+-- {"id": ..., "version": ..., "fields": {...}}: version 0 inserts fields as a new row, otherwise
+-- the row is updated only if it is still at that version. Any failure rolls back the whole call;
+-- a version conflict is raised as SQLSTATE P0409 with the write's index as the details.
+create or replace function resource_apply_writes(p_table text, p_writes jsonb)
+returns void
+language plpgsql
+as $$
+declare
+    w        jsonb;
+    i        integer := 0;
+    columns  text;
+    affected integer;
+begin
+    for w in select value from jsonb_array_elements(p_writes) loop
+        if (w->>'version')::integer = 0 then
+            select string_agg(format('%I', key), ', ') into columns from jsonb_object_keys(w->'fields') key;
+            execute format('insert into %I (%s) select %s from jsonb_populate_record(null::%I, $1)',
+                           p_table, columns, columns, p_table)
+                using w->'fields';
+        else
+            select string_agg(format('%I = r.%I', key, key), ', ') into columns from jsonb_object_keys(w->'fields') key;
+            execute format('update %I t set %s from jsonb_populate_record(null::%I, $1) r where t.id = $2 and t.version = $3',
+                           p_table, columns, p_table)
+                using w->'fields', w->>'id', (w->>'version')::integer;
+            get diagnostics affected = row_count;
+            if affected = 0 then
+                raise exception 'version conflict' using errcode = 'P0409', detail = i::text;
+            end if;
+        end if;
+        i := i + 1;
+    end loop;
+end;
+$$;
+
+-- Only the backend (service role) may call it: it takes a table name and bypasses RLS checks on
+-- what is written.
+revoke execute on function resource_apply_writes(text, jsonb) from public, anon, authenticated;
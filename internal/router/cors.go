@@ -0,0 +1,97 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CORSPolicy is which cross-origin browser requests a route group accepts.
+type CORSPolicy int
+
+const (
+	// CORSApp allows the app's origins (ALLOWED_ORIGINS, or the tenant's own origins), with
+	// credentials. Paths outside every group get it, as every route did before groups existed.
+	CORSApp CORSPolicy = iota
+	// CORSPublic allows GET and HEAD from any origin, without credentials, so public responses
+	// can be fetched (and cached) by any site. Other methods fall back to CORSApp.
+	CORSPublic
+	// CORSSameOrigin allows no cross-origin requests: no CORS headers are sent, and requests
+	// whose Origin is another host get 403. Clients that send no Origin (servers, scripts) are
+	// not affected.
+	CORSSameOrigin
+)
+
+// String returns the policy's name, as shown in the startup summary.
+func (p CORSPolicy) String() string {
+	switch p {
+	case CORSApp:
+		return "app origins"
+	case CORSPublic:
+		return "public GETs"
+	case CORSSameOrigin:
+		return "same origin"
+	default:
+		return fmt.Sprintf("CORSPolicy(%d)", int(p))
+	}
+}
+
+// CORSGroup applies a CORS policy to every path under Prefix ("/api" covers /api and
+// /api/profile, not /apiary). The longest matching prefix wins.
+type CORSGroup struct {
+	Prefix string
+	Policy CORSPolicy
+}
+
+// ValidateCORSGroups checks group definitions: prefixes must start with / and be listed once.
+func ValidateCORSGroups(groups []CORSGroup) error {
+	seen := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		prefix := strings.TrimSuffix(group.Prefix, "/")
+		switch {
+		case !strings.HasPrefix(group.Prefix, "/"):
+			return fmt.Errorf("CORS group %q: prefix must start with /", group.Prefix)
+		case seen[prefix]:
+			return fmt.Errorf("CORS group %q is listed twice", group.Prefix)
+		case group.Policy < CORSApp || group.Policy > CORSSameOrigin:
+			return fmt.Errorf("CORS group %q: unknown policy %d", group.Prefix, group.Policy)
+		}
+		seen[prefix] = true
+	}
+	return nil
+}
+
+// CORSPolicyFor returns the policy of the group with the longest prefix matching path, or
+// CORSApp if none does.
+func CORSPolicyFor(groups []CORSGroup, path string) CORSPolicy {
+	policy, longest := CORSApp, -1
+	for _, group := range groups {
+		prefix := strings.TrimSuffix(group.Prefix, "/")
+		matches := path == prefix || strings.HasPrefix(path, prefix+"/")
+		if matches && len(prefix) > longest {
+			policy, longest = group.Policy, len(prefix)
+		}
+	}
+	return policy
+}
+
+// IsPreflight reports whether a request is a CORS preflight: an OPTIONS request with an Origin
+// and an Access-Control-Request-Method. Browsers send it without credentials.
+func IsPreflight(c *fiber.Ctx) bool {
+	return c.Method() == fiber.MethodOptions &&
+		c.Get(fiber.HeaderOrigin) != "" &&
+		c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+}
+
+// skipPreflight answers preflights that reach a route with 204 and no CORS headers, before auth
+// and rate limits run: a preflight carries no token, so auth would answer 401 and the limiter
+// would count it against the client. The CORS middleware answers the preflights it allows; one
+// that gets here is refused (or CORS is disabled), which the browser reads from the missing
+// headers.
+func skipPreflight(c *fiber.Ctx) error {
+	if IsPreflight(c) {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	return c.Next()
+}
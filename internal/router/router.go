@@ -0,0 +1,324 @@
+package router
+
+// Package router builds the Fiber app from declarative route definitions.
+// Each Route declares everything about an endpoint in one place: path and handler, who may call
+// it (auth level, API keys, scopes and plan feature), which rate-limit profile it counts against, its
+// Cache-Control policy, its documentation and its SLO. Mount turns the definitions into Fiber routes with the
+// matching middleware chain, registers the docs and SLOs, and reports rate limits to the startup
+// summary.
+//
+// CORSGroup declares the CORS policy of the routes under a path prefix (see CORSPolicy); the app's
+// CORS middleware applies it, since preflight requests are answered before routing.
+//
+// The app's own routes are declared in internal/app/routes.go. Other packages can add theirs
+// with Register (e.g. from an init function); NewApp mounts them after the built-in ones.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/config"
+	"boilerplate/internal/docs"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/plan"
+	"boilerplate/internal/slo"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MethodAll registers a route for every HTTP method (app.All).
+const MethodAll = "ALL"
+
+// AuthLevel is who may call a route.
+type AuthLevel int
+
+const (
+	// AuthNone routes are public.
+	AuthNone AuthLevel = iota
+	// AuthUser routes need a valid Bearer token (middleware.Auth); the tenant is taken from its claims.
+	AuthUser
+	// AuthAdmin routes also need the user to be listed in ADMIN_USER_IDS.
+	AuthAdmin
+)
+
+// CachePolicy is the Cache-Control header set on successful responses of a route
+// (unless the handler set one itself). The zero value sets nothing.
+type CachePolicy struct {
+	NoStore bool          // "no-store": never cache (user data, health checks)
+	MaxAge  time.Duration // Cacheable for this long
+	Public  bool          // Shared caches (CDNs) may store it too; private otherwise
+}
+
+// Common cache policies.
+var (
+	NoStore = CachePolicy{NoStore: true}
+)
+
+// Route declares one endpoint.
+type Route struct {
+	Method  string // GET, POST, ... or MethodAll
+	Path    string // Full path, e.g. /api/admin/users/:id/deletion
+	Handler fiber.Handler
+
+	Auth   AuthLevel
+	APIKey bool     // AuthUser routes also accept an X-API-Key (see middleware.AuthOrAPIKey)
+	Scopes []string // Token scopes required on top of Auth (see middleware.RequireScopes)
+	Roles  []string // Roles of which the user needs at least one (see middleware.RequireAnyRole)
+
+	// Feature is the plan feature the route needs (see plan.RequireFeature); users on plans
+	// without it get 402. Authenticated non-admin routes also count against plan quotas.
+	Feature string
+
+	// RateLimit is the rate-limit profile (see middleware.RateLimitProfile). Authenticated routes
+	// default to middleware.ProfileDefault; public routes are not limited unless one is set.
+	RateLimit string
+
+	Cache CachePolicy
+
+	// Middleware runs after the auth, rate limit and cache middleware, just before Handler
+	// (e.g. the WebSocket upgrade check).
+	Middleware []fiber.Handler
+
+	// Docs is the endpoint's documentation. Method, Path, Auth, Admin and Scopes are filled in from
+	// the route (set Docs.Method for MethodAll routes); routes without a Summary are listed as
+	// undocumented.
+	Docs docs.Endpoint
+
+	// SLO declares the route's objective; Method (unless set, as MethodAll routes must) and Route
+	// are filled in from the route.
+	SLO *slo.Objective
+}
+
+var (
+	mu         sync.Mutex
+	registered []Route
+)
+
+// Register adds routes that NewApp mounts after the built-in ones.
+func Register(routes ...Route) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, routes...)
+}
+
+// Registered returns the routes added with Register.
+func Registered() []Route {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Route(nil), registered...)
+}
+
+// Reset removes every route added with Register. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = nil
+}
+
+// builder holds the middleware instances shared by the routes of one app, so every route of a
+// rate-limit profile counts against the same budget.
+type builder struct {
+	cfg      *config.Config
+	auth     fiber.Handler
+	authKey  fiber.Handler // Auth or API key
+	claims   fiber.Handler
+	admin    fiber.Handler
+	quota    fiber.Handler
+	limiters map[string]fiber.Handler
+}
+
+// Mount registers routes on app, in order, with middleware configured from cfg (auth, rate
+// limits). It returns an error (and registers nothing) if a route is invalid, e.g. without a
+// handler or with an unknown rate-limit profile.
+func Mount(app *fiber.App, cfg *config.Config, routes []Route) error {
+	for _, route := range routes {
+		if err := validate(cfg, route); err != nil {
+			return err
+		}
+	}
+
+	b := &builder{cfg: cfg, limiters: make(map[string]fiber.Handler)}
+	for _, route := range routes {
+		chain := b.chain(route)
+		if route.Method == MethodAll {
+			app.All(route.Path, chain...)
+		} else {
+			app.Add(route.Method, route.Path, chain...)
+		}
+
+		describe(cfg, route)
+	}
+	return nil
+}
+
+// MustMount is Mount that panics on invalid routes (a programming error).
+func MustMount(app *fiber.App, cfg *config.Config, routes []Route) {
+	if err := Mount(app, cfg, routes); err != nil {
+		panic(err)
+	}
+}
+
+// validate checks a route definition.
+func validate(cfg *config.Config, route Route) error {
+	name := route.Method + " " + route.Path
+	switch {
+	case route.Handler == nil:
+		return fmt.Errorf("route %s: no handler", name)
+	case !strings.HasPrefix(route.Path, "/"):
+		return fmt.Errorf("route %s: path must start with /", name)
+	case route.Auth == AuthNone && len(route.Scopes) > 0:
+		return fmt.Errorf("route %s: scopes need Auth", name)
+	case route.Auth == AuthNone && len(route.Roles) > 0:
+		return fmt.Errorf("route %s: roles need Auth", name)
+	case route.Auth == AuthNone && route.Feature != "":
+		return fmt.Errorf("route %s: features need Auth", name)
+	case route.APIKey && route.Auth != AuthUser:
+		return fmt.Errorf("route %s: API keys need AuthUser", name)
+	}
+	if _, ok := middleware.RateLimitMax(cfg.RateLimit, profileOf(route)); !ok && profileOf(route) != "" {
+		return fmt.Errorf("route %s: unknown rate limit profile %q", name, route.RateLimit)
+	}
+	return nil
+}
+
+// profileOf returns the route's effective rate-limit profile ("" for none).
+func profileOf(route Route) string {
+	if route.RateLimit == "" && route.Auth != AuthNone {
+		return middleware.ProfileDefault
+	}
+	if route.RateLimit == middleware.ProfileNone {
+		return ""
+	}
+	return route.RateLimit
+}
+
+// chain returns the route's handlers: auth, tenant from claims, rate limit, plan quota, admin
+// check, roles, scopes, plan feature, cache policy, the route's own middleware and finally the
+// handler. This is the order the /api group used: the limiter keys on the user set by auth.
+// Routes with auth or a rate limit answer CORS preflights first (see skipPreflight).
+func (b *builder) chain(route Route) []fiber.Handler {
+	var chain []fiber.Handler
+
+	if route.Auth != AuthNone || profileOf(route) != "" {
+		chain = append(chain, skipPreflight)
+	}
+
+	if route.Auth != AuthNone {
+		if b.auth == nil {
+			b.auth, b.claims = middleware.Auth(b.cfg.Auth), tenant.FromClaims()
+		}
+		auth := b.auth
+		if route.APIKey {
+			if b.authKey == nil {
+				b.authKey = middleware.AuthOrAPIKey(b.cfg.Auth)
+			}
+			auth = b.authKey
+		}
+		chain = append(chain, auth, b.claims)
+	}
+
+	if profile := profileOf(route); profile != "" {
+		limiter, ok := b.limiters[profile]
+		if !ok {
+			limiter = middleware.RateLimitProfile(b.cfg.RateLimit, profile)
+			b.limiters[profile] = limiter
+		}
+		chain = append(chain, limiter)
+	}
+
+	if route.Auth == AuthUser {
+		if b.quota == nil {
+			b.quota = plan.EnforceQuota()
+		}
+		chain = append(chain, b.quota)
+	}
+
+	if route.Auth == AuthAdmin {
+		if b.admin == nil {
+			b.admin = middleware.RequireAdmin(b.cfg.Auth)
+		}
+		chain = append(chain, b.admin)
+	}
+	if len(route.Roles) > 0 {
+		chain = append(chain, middleware.RequireAnyRole(route.Roles...))
+	}
+	if len(route.Scopes) > 0 {
+		chain = append(chain, middleware.RequireScopes(b.cfg.Auth, route.Scopes...))
+	}
+	if route.Feature != "" {
+		chain = append(chain, plan.RequireFeature(route.Feature))
+	}
+	if header := route.Cache.header(); header != "" {
+		chain = append(chain, cacheControl(header))
+	}
+
+	chain = append(chain, route.Middleware...)
+	return append(chain, route.Handler)
+}
+
+// describe registers the route's docs and SLO, and its rate limit in the startup summary.
+func describe(cfg *config.Config, route Route) {
+	if route.Docs.Summary != "" {
+		endpoint := route.Docs
+		if endpoint.Method == "" {
+			endpoint.Method = route.Method
+		}
+		endpoint.Path = route.Path
+		endpoint.Auth = route.Auth != AuthNone
+		endpoint.APIKey = route.APIKey
+		endpoint.Admin = route.Auth == AuthAdmin
+		endpoint.Scopes = route.Scopes
+		docs.Register(endpoint)
+	}
+
+	if route.SLO != nil {
+		objective := *route.SLO
+		if objective.Method == "" {
+			objective.Method = route.Method
+		}
+		objective.Route = route.Path
+		slo.MustRegister(objective)
+	}
+
+	if profile := profileOf(route); profile != "" {
+		max, _ := middleware.RateLimitMax(cfg.RateLimit, profile)
+		detail := strconv.Itoa(max) + "/min per user or IP (" + profile + ")"
+		if cfg.RateLimit.Storage == config.RateLimitRedis {
+			detail = strconv.Itoa(max) + "/min per user or IP (" + profile + ", shared)"
+		}
+		startup.RouteRateLimit(route.Method, route.Path, detail)
+	}
+}
+
+// header returns the Cache-Control value for the policy ("" for the zero value).
+func (p CachePolicy) header() string {
+	switch {
+	case p.NoStore:
+		return "no-store"
+	case p.MaxAge > 0:
+		visibility := "private"
+		if p.Public {
+			visibility = "public"
+		}
+		return visibility + ", max-age=" + strconv.Itoa(int(p.MaxAge/time.Second))
+	default:
+		return ""
+	}
+}
+
+// cacheControl sets header as Cache-Control on successful responses that don't set their own.
+func cacheControl(header string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err == nil && c.Response().StatusCode() < fiber.StatusBadRequest &&
+			len(c.Response().Header.Peek(fiber.HeaderCacheControl)) == 0 {
+			c.Set(fiber.HeaderCacheControl, header)
+		}
+		return err
+	}
+}
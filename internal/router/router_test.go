@@ -0,0 +1,362 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/apikey"
+	"boilerplate/internal/config"
+	"boilerplate/internal/docs"
+	"boilerplate/internal/middleware"
+	"boilerplate/internal/plan"
+	"boilerplate/internal/slo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "router-test-secret"
+
+// testConfig loads the configuration from the environment the test has set.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	return cfg
+}
+
+// token returns an HS256 token for userID signed with testSecret, with extra claims merged in.
+func token(t *testing.T, userID string, extra jwt.MapClaims) string {
+	t.Helper()
+	claims := jwt.MapClaims{"sub": userID, "exp": time.Now().Add(time.Hour).Unix()}
+	for key, value := range extra {
+		claims[key] = value
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	return signed
+}
+
+// do sends a request to app, with a Bearer token if bearer is not empty.
+func do(t *testing.T, app *fiber.App, method, path, bearer string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func ok(c *fiber.Ctx) error {
+	return c.SendString("ok")
+}
+
+// TestMount_AuthLevels tests that public, user and admin routes get the matching checks.
+func TestMount_AuthLevels(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("ADMIN_USER_IDS", "admin-1")
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodGet, Path: "/public", Handler: ok},
+		{Method: fiber.MethodGet, Path: "/api/user", Handler: ok, Auth: AuthUser},
+		{Method: fiber.MethodGet, Path: "/api/admin", Handler: ok, Auth: AuthAdmin},
+	}))
+
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/public", "").StatusCode)
+
+	assert.Equal(t, http.StatusUnauthorized, do(t, app, "GET", "/api/user", "").StatusCode)
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/user", token(t, "user-1", nil)).StatusCode)
+
+	assert.Equal(t, http.StatusUnauthorized, do(t, app, "GET", "/api/admin", "").StatusCode)
+	assert.Equal(t, http.StatusForbidden, do(t, app, "GET", "/api/admin", token(t, "user-1", nil)).StatusCode)
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/admin", token(t, "admin-1", nil)).StatusCode)
+}
+
+// TestMount_APIKey tests that only routes with APIKey accept API keys, and still accept tokens.
+func TestMount_APIKey(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	defer apikey.SetDefault(apikey.Get())
+	apikey.SetDefault(apikey.NewMemoryStore(apikey.Key{ID: "k1", Hash: apikey.Hash("sk_test")}))
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodGet, Path: "/api/keys", Handler: ok, Auth: AuthUser, APIKey: true},
+		{Method: fiber.MethodGet, Path: "/api/tokens", Handler: ok, Auth: AuthUser},
+	}))
+	withKey := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(middleware.APIKeyHeader, "sk_test")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, withKey("/api/keys"))
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/keys", token(t, "user-1", nil)).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, withKey("/api/tokens"))
+}
+
+// TestMount_Scopes tests that routes with scopes reject tokens missing one of them.
+func TestMount_Scopes(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodPost, Path: "/api/reports", Handler: ok, Auth: AuthUser, Scopes: []string{"reports:write"}},
+	}))
+
+	resp := do(t, app, "POST", "/api/reports", token(t, "user-1", jwt.MapClaims{"scope": "reports:read"}))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = do(t, app, "POST", "/api/reports", token(t, "user-1", jwt.MapClaims{"scope": "reports:read reports:write"}))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestMount_Roles tests that routes with roles reject users holding none of them.
+func TestMount_Roles(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodGet, Path: "/api/moderation", Handler: ok, Auth: AuthUser, Roles: []string{"moderator", "admin"}},
+	}))
+
+	resp := do(t, app, "GET", "/api/moderation", token(t, "user-1", jwt.MapClaims{"role": "authenticated"}))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = do(t, app, "GET", "/api/moderation", token(t, "user-1", jwt.MapClaims{"app_metadata": map[string]interface{}{"roles": []string{"moderator"}}}))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestMount_Feature tests that routes with a feature reject users whose plan lacks it.
+func TestMount_Feature(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	plan.Configure(map[string]*plan.Plan{
+		"free": {Name: "free"},
+		"pro":  {Name: "pro", Features: []string{"export"}},
+	}, "free", "app_metadata.plan", time.Minute)
+	t.Cleanup(func() { plan.Configure(nil, "", "app_metadata.plan", time.Minute) })
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodGet, Path: "/api/export", Handler: ok, Auth: AuthUser, Feature: "export"},
+	}))
+
+	resp := do(t, app, "GET", "/api/export", token(t, "user-1", nil))
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+
+	resp = do(t, app, "GET", "/api/export", token(t, "user-1", jwt.MapClaims{"app_metadata": map[string]interface{}{"plan": "pro"}}))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestMount_RateLimitProfiles tests that routes of one profile share a budget and other profiles
+// have their own.
+func TestMount_RateLimitProfiles(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("RATE_LIMIT_MAX", "3")
+	t.Setenv("RATE_LIMIT_STRICT_MAX", "1")
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodGet, Path: "/api/a", Handler: ok, Auth: AuthUser},
+		{Method: fiber.MethodGet, Path: "/api/b", Handler: ok, Auth: AuthUser},
+		{Method: fiber.MethodGet, Path: "/api/export", Handler: ok, Auth: AuthUser, RateLimit: middleware.ProfileStrict},
+		{Method: fiber.MethodGet, Path: "/api/unlimited", Handler: ok, Auth: AuthUser, RateLimit: middleware.ProfileNone},
+	}))
+	bearer := token(t, "user-1", nil)
+
+	// The default budget (3) is shared by /api/a and /api/b
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/a", bearer).StatusCode)
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/b", bearer).StatusCode)
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/a", bearer).StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, do(t, app, "GET", "/api/b", bearer).StatusCode)
+
+	// The strict profile has its own budget (1)
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/export", bearer).StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, do(t, app, "GET", "/api/export", bearer).StatusCode)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/unlimited", bearer).StatusCode)
+	}
+}
+
+// TestMount_CachePolicy tests the Cache-Control header set from the route's policy.
+func TestMount_CachePolicy(t *testing.T) {
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: fiber.MethodGet, Path: "/none", Handler: ok},
+		{Method: fiber.MethodGet, Path: "/private", Handler: ok, Cache: NoStore},
+		{Method: fiber.MethodGet, Path: "/public", Handler: ok, Cache: CachePolicy{MaxAge: 5 * time.Minute, Public: true}},
+		{Method: fiber.MethodGet, Path: "/own", Cache: NoStore, Handler: func(c *fiber.Ctx) error {
+			c.Set(fiber.HeaderCacheControl, "max-age=10")
+			return c.SendString("ok")
+		}},
+		{Method: fiber.MethodGet, Path: "/missing", Cache: CachePolicy{MaxAge: time.Minute}, Handler: func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusNotFound)
+		}},
+	}))
+
+	assert.Empty(t, do(t, app, "GET", "/none", "").Header.Get("Cache-Control"))
+	assert.Equal(t, "no-store", do(t, app, "GET", "/private", "").Header.Get("Cache-Control"))
+	assert.Equal(t, "public, max-age=300", do(t, app, "GET", "/public", "").Header.Get("Cache-Control"))
+	assert.Equal(t, "max-age=10", do(t, app, "GET", "/own", "").Header.Get("Cache-Control"), "the handler's header wins")
+	assert.Empty(t, do(t, app, "GET", "/missing", "").Header.Get("Cache-Control"), "errors are never cached")
+}
+
+// TestMount_MiddlewareOrder tests that the route's own middleware runs after auth and before the handler.
+func TestMount_MiddlewareOrder(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	var seenUser interface{}
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{{
+		Method: fiber.MethodGet,
+		Path:   "/api/ordered",
+		Auth:   AuthUser,
+		Middleware: []fiber.Handler{func(c *fiber.Ctx) error {
+			seenUser = c.Locals("user")
+			return c.Next()
+		}},
+		Handler: ok,
+	}}))
+
+	assert.Equal(t, http.StatusOK, do(t, app, "GET", "/api/ordered", token(t, "user-1", nil)).StatusCode)
+	assert.Equal(t, "user-1", seenUser)
+}
+
+// TestMount_MethodAll tests that MethodAll routes answer every method.
+func TestMount_MethodAll(t *testing.T) {
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{{Method: MethodAll, Path: "/any", Handler: ok}}))
+
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		assert.Equal(t, http.StatusOK, do(t, app, method, "/any", "").StatusCode, method)
+	}
+}
+
+// TestMount_Preflight tests that CORS preflights reaching a route skip its auth and rate limit.
+func TestMount_Preflight(t *testing.T) {
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("RATE_LIMIT_MAX", "1")
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{
+		{Method: MethodAll, Path: "/api/any", Handler: ok, Auth: AuthUser},
+	}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("OPTIONS", "/api/any", nil)
+		req.Header.Set("Origin", "https://app.example.test")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+
+	// The budget (1) is untouched, and other OPTIONS requests still need a token
+	assert.Equal(t, http.StatusOK, do(t, app, "POST", "/api/any", token(t, "user-1", nil)).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, do(t, app, "OPTIONS", "/api/any", "").StatusCode)
+}
+
+// TestMount_Invalid tests that invalid routes are rejected before anything is registered.
+func TestMount_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+		want  string
+	}{
+		{"no handler", Route{Method: "GET", Path: "/x"}, "no handler"},
+		{"relative path", Route{Method: "GET", Path: "x", Handler: ok}, "must start with /"},
+		{"scopes without auth", Route{Method: "GET", Path: "/x", Handler: ok, Scopes: []string{"read"}}, "scopes need Auth"},
+		{"roles without auth", Route{Method: "GET", Path: "/x", Handler: ok, Roles: []string{"admin"}}, "roles need Auth"},
+		{"feature without auth", Route{Method: "GET", Path: "/x", Handler: ok, Feature: "export"}, "features need Auth"},
+		{"API key on an admin route", Route{Method: "GET", Path: "/x", Handler: ok, Auth: AuthAdmin, APIKey: true}, "API keys need AuthUser"},
+		{"unknown profile", Route{Method: "GET", Path: "/x", Handler: ok, Auth: AuthUser, RateLimit: "bulk"}, `unknown rate limit profile "bulk"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			err := Mount(app, testConfig(t), []Route{{Method: "GET", Path: "/valid", Handler: ok}, tt.route})
+			require.Error(t, err)
+			assert.True(t, strings.Contains(err.Error(), tt.want), err.Error())
+			assert.Empty(t, app.GetRoutes(true))
+		})
+	}
+}
+
+// TestMount_RegistersDocsAndSLO tests that docs and objectives are filled in from the route.
+func TestMount_RegistersDocsAndSLO(t *testing.T) {
+	slo.Reset()
+	t.Cleanup(slo.Reset)
+
+	app := fiber.New()
+	require.NoError(t, Mount(app, testConfig(t), []Route{{
+		Method:  fiber.MethodGet,
+		Path:    "/api/router-test",
+		Handler: ok,
+		Auth:    AuthUser,
+		Scopes:  []string{"reports:read"},
+		Docs:    docs.Endpoint{Summary: "Router test", Tags: []string{"test"}},
+		SLO:     &slo.Objective{Latency: 200 * time.Millisecond, LatencyTarget: 0.99, Availability: 0.999},
+	}}))
+
+	var found *docs.Endpoint
+	for _, endpoint := range docs.DefaultRegistry.Endpoints(app.GetRoutes(true)) {
+		if endpoint.Path == "/api/router-test" {
+			endpoint := endpoint
+			found = &endpoint
+		}
+	}
+	require.NotNil(t, found)
+	assert.Equal(t, "GET", found.Method)
+	assert.Equal(t, "Router test", found.Summary)
+	assert.True(t, found.Auth)
+	assert.False(t, found.Admin)
+	assert.Equal(t, []string{"reports:read"}, found.Scopes)
+
+	statuses := slo.Snapshot()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "GET", statuses[0].Objective.Method)
+	assert.Equal(t, "/api/router-test", statuses[0].Objective.Route)
+}
+
+// TestRegister tests that registered routes are returned until Reset.
+func TestRegister(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	Register(Route{Method: "GET", Path: "/plugin", Handler: ok})
+	require.Len(t, Registered(), 1)
+	assert.Equal(t, "/plugin", Registered()[0].Path)
+
+	Reset()
+	assert.Empty(t, Registered())
+}
+
+// TestCORSPolicyFor tests that the longest matching group prefix wins, on segment boundaries.
+func TestCORSPolicyFor(t *testing.T) {
+	groups := []CORSGroup{
+		{Prefix: "/", Policy: CORSPublic},
+		{Prefix: "/api/admin", Policy: CORSSameOrigin},
+		{Prefix: "/api/", Policy: CORSApp},
+	}
+	assert.Equal(t, CORSPublic, CORSPolicyFor(groups, "/health"))
+	assert.Equal(t, CORSPublic, CORSPolicyFor(groups, "/apiary"))
+	assert.Equal(t, CORSApp, CORSPolicyFor(groups, "/api"))
+	assert.Equal(t, CORSApp, CORSPolicyFor(groups, "/api/profile"))
+	assert.Equal(t, CORSSameOrigin, CORSPolicyFor(groups, "/api/admin/usage"))
+	assert.Equal(t, CORSApp, CORSPolicyFor(nil, "/health"))
+
+	assert.NoError(t, ValidateCORSGroups(groups))
+	assert.Error(t, ValidateCORSGroups([]CORSGroup{{Prefix: "api"}}))
+	assert.Error(t, ValidateCORSGroups([]CORSGroup{{Prefix: "/api"}, {Prefix: "/api/"}}))
+	assert.Error(t, ValidateCORSGroups([]CORSGroup{{Prefix: "/api", Policy: CORSPolicy(7)}}))
+}
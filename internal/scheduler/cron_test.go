@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParse_Next tests the next run of expressions using each syntax.
+func TestParse_Next(t *testing.T) {
+	from := time.Date(2026, 1, 30, 10, 7, 30, 0, time.UTC) // A Friday
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 30, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 30, 10, 15, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2026, 1, 30, 11, 5, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2026, 1, 30, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * mon", time.Date(2026, 2, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 * *", time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC)}, // February has no 30th
+		{"0 0 1 jan,jul *", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2026, 2, 6, 0, 0, 0, 0, time.UTC)}, // Either the 13th or a Friday
+		{"0 0 * * 7", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},  // 7 is Sunday
+		{"@daily", time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 1, 30, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		require.NoError(t, err, tt.spec)
+		next := schedule.Next(from)
+		assert.Equal(t, tt.next, next, tt.spec)
+		assert.True(t, schedule.Matches(next), tt.spec)
+	}
+
+	never, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, never.Next(from).IsZero(), "30 February never comes")
+}
+
+// TestParse_Invalid tests that malformed expressions are rejected.
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "0 0 * foo *", "@sometimes"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,363 @@
+package scheduler
+
+// Package scheduler runs recurring tasks on cron schedules (see Parse): cache warmups, cleanups,
+// key refreshes. Packages register their tasks at startup, after Init():
+//
+//	scheduler.Register(scheduler.Task{
+//		Name:     "price-warmup",
+//		Schedule: "*/5 * * * *",
+//		Run:      realtime.WarmPrices,
+//	})
+//
+// Schedules are evaluated in UTC. SCHEDULER_<NAME> (the task name in upper case, dashes and dots
+// as underscores, e.g. SCHEDULER_PRICE_WARMUP) replaces a task's schedule, or disables it with
+// "off"; SCHEDULER=false disables every task.
+//
+// With a shared cache, a run takes the task's lock (scheduler:<name>) first, and keeps it until
+// shortly before the next run is due: one instance runs each occurrence, and a run that lasts
+// past the next occurrence makes it skipped instead of overlapping. Without one, and for tasks
+// marked PerInstance, every instance runs the task, never two runs of it at once. Each run is
+// logged with its task, duration and result, and counted in scheduler_runs_total.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/leader"
+	"boilerplate/internal/lifecycle"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+)
+
+// defaultTimeout bounds a run of a task without a Timeout.
+const defaultTimeout = 5 * time.Minute
+
+// lockMargin is how long before the next occurrence a finished run releases the task's lock, so
+// instances whose clocks are slightly ahead can take it.
+const lockMargin = 5 * time.Second
+
+// Results of runs, as counted in scheduler_runs_total.
+const (
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+	resultSkipped   = "skipped"
+)
+
+var (
+	// DefaultScheduler runs the application's tasks. It is nil until Init() or SetDefault() is
+	// called, and stays nil with SCHEDULER=false.
+	DefaultScheduler *Scheduler
+
+	// registered are the tasks given to Register, added again to the scheduler Init creates
+	registeredMu sync.Mutex
+	registered   []Task
+
+	// loop runs the default scheduler (see StartScheduler)
+	loop lifecycle.Runner
+)
+
+// Task is a recurring task.
+type Task struct {
+	Name     string // Unique, e.g. "price-warmup"; names the lock, the env variable and logs
+	Schedule string // Cron expression, unless SCHEDULER_<NAME> is set
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+
+	// PerInstance runs the task on every instance, without the lock: for tasks refreshing this
+	// instance's state, such as its JWKS keys.
+	PerInstance bool
+}
+
+// TaskStatus is a registered task's schedule and last run.
+type TaskStatus struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Enabled      bool       `json:"enabled"`
+	Running      bool       `json:"running"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastResult   string     `json:"last_result,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// task is a registered task with its state.
+type task struct {
+	Task
+	schedule Schedule
+	enabled  bool
+	running  atomic.Bool
+
+	mu   sync.Mutex
+	last TaskStatus // Last* fields only
+}
+
+// Scheduler runs tasks on their schedules.
+type Scheduler struct {
+	locker cache.Locker // nil without a shared cache
+	owner  string
+	now    func() time.Time // Overridable clock for tests
+
+	mu    sync.Mutex
+	tasks []*task
+	runs  sync.WaitGroup
+}
+
+// Init creates the default scheduler on the cache's locks (call it after cache.Init), with the
+// tasks registered so far (reading their SCHEDULER_<NAME> again). Tasks register on it until
+// StartScheduler starts it.
+func Init() {
+	DefaultScheduler = nil
+	if os.Getenv("SCHEDULER") == "false" {
+		startup.Report("scheduler", false, "SCHEDULER=false")
+		return
+	}
+	scheduler := New(cache.GetLocker(), leader.InstanceID())
+	registeredMu.Lock()
+	for _, t := range registered {
+		if err := scheduler.Register(t); err != nil {
+			slog.Error("Failed to schedule task", "task", t.Name, "error", err)
+		}
+	}
+	registeredMu.Unlock()
+	DefaultScheduler = scheduler
+
+	detail := "runs locked in the cache"
+	if DefaultScheduler.locker == nil {
+		detail = "every instance runs its tasks (no shared cache)"
+	}
+	startup.Report("scheduler", true, detail)
+}
+
+// New creates a scheduler taking task locks in locker as owner. A nil locker runs every task on
+// this instance.
+func New(locker cache.Locker, owner string) *Scheduler {
+	return &Scheduler{locker: locker, owner: owner, now: time.Now}
+}
+
+// SetDefault sets the default scheduler (nil disables it). Mainly useful in tests.
+func SetDefault(s *Scheduler) {
+	DefaultScheduler = s
+}
+
+// Get returns the default scheduler, or nil when it is disabled.
+func Get() *Scheduler {
+	return DefaultScheduler
+}
+
+// Register adds a task to the default scheduler (only remembered for the next Init when it is
+// disabled).
+func Register(t Task) error {
+	if DefaultScheduler != nil {
+		if err := DefaultScheduler.Register(t); err != nil {
+			return err
+		}
+	}
+	registeredMu.Lock()
+	registered = append(registered, t)
+	registeredMu.Unlock()
+	return nil
+}
+
+// Register adds a task, with its schedule from SCHEDULER_<NAME> when set. It fails on an invalid
+// schedule, or a name already registered.
+func (s *Scheduler) Register(t Task) error {
+	if t.Name == "" || t.Run == nil {
+		return fmt.Errorf("task needs a name and a function")
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = defaultTimeout
+	}
+	name := EnvName(t.Name)
+	enabled := true
+	if spec := strings.TrimSpace(os.Getenv(name)); spec == "off" {
+		enabled = false
+	} else if spec != "" {
+		t.Schedule = spec
+	}
+	schedule, err := Parse(t.Schedule)
+	if err != nil {
+		return fmt.Errorf("task %s: %w", t.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.tasks {
+		if existing.Name == t.Name {
+			return fmt.Errorf("task %s is already registered", t.Name)
+		}
+	}
+	s.tasks = append(s.tasks, &task{Task: t, schedule: schedule, enabled: enabled})
+	if !enabled {
+		slog.Info("Scheduled task disabled", "task", t.Name, "env", name)
+	}
+	return nil
+}
+
+// EnvName returns the variable that overrides a task's schedule: SCHEDULER_PRICE_WARMUP for
+// "price-warmup".
+func EnvName(taskName string) string {
+	return "SCHEDULER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(taskName))
+}
+
+// StartScheduler runs the default scheduler's tasks in the background, once they are registered.
+// It fails while a scheduler started earlier is still stopping.
+func StartScheduler() error {
+	s := Get()
+	if s == nil {
+		return nil
+	}
+	if !loop.Start(s.Run) {
+		return errors.New("previous scheduler is still stopping")
+	}
+	return nil
+}
+
+// StopScheduler stops the scheduler started by StartScheduler, and waits until ctx ends for the
+// runs in progress, whose context is cancelled.
+func StopScheduler(ctx context.Context) error {
+	return loop.Stop(ctx)
+}
+
+// Run starts the tasks due at the start of every minute, until ctx is cancelled. Runs in
+// progress then get their context cancelled, and Run returns once they end.
+func (s *Scheduler) Run(ctx context.Context) {
+	slog.Info("Scheduler started", "tasks", len(s.Tasks()))
+	for {
+		now := s.now()
+		minute := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(minute.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.runs.Wait()
+			return
+		case <-timer.C:
+		}
+		s.tick(ctx, minute)
+	}
+}
+
+// tick starts the tasks due in minute.
+func (s *Scheduler) tick(ctx context.Context, minute time.Time) {
+	s.mu.Lock()
+	tasks := append([]*task(nil), s.tasks...)
+	s.mu.Unlock()
+
+	for _, t := range tasks {
+		if t.enabled && t.schedule.Matches(minute) {
+			s.runs.Add(1)
+			go func() {
+				defer s.runs.Done()
+				s.run(ctx, t, minute)
+			}()
+		}
+	}
+}
+
+// run runs the occurrence of t due at due, unless it is still running (here, or on another
+// instance) or another instance took this occurrence.
+func (s *Scheduler) run(ctx context.Context, t *task, due time.Time) {
+	if !t.running.CompareAndSwap(false, true) {
+		s.skip(t, due, "previous run still in progress")
+		return
+	}
+	defer t.running.Store(false)
+
+	key := "scheduler:" + t.Name
+	if s.locker != nil && !t.PerInstance {
+		acquired, err := s.locker.Acquire(key, s.owner, t.Timeout+lockMargin)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to take a scheduled task's lock, running anyway", "task", t.Name, "error", err)
+		case !acquired:
+			s.skip(t, due, "running on another instance")
+			return
+		default:
+			defer s.hold(t, key, due)
+		}
+	}
+
+	started := s.now()
+	err := s.call(ctx, t)
+	duration := s.now().Sub(started)
+
+	result := resultSucceeded
+	if err != nil {
+		result = resultFailed
+		slog.Error("Scheduled task failed", "task", t.Name, "due", due.Format(time.RFC3339), "duration", duration.String(), "error", err)
+	} else {
+		metrics.SchedulerLastSuccess.WithLabelValues(t.Name).Set(float64(started.Unix()))
+		slog.Info("Scheduled task succeeded", "task", t.Name, "due", due.Format(time.RFC3339), "duration", duration.String())
+	}
+	metrics.SchedulerRuns.WithLabelValues(t.Name, result).Inc()
+
+	t.mu.Lock()
+	t.last = TaskStatus{LastRun: &started, LastDuration: duration.String(), LastResult: result}
+	if err != nil {
+		t.last.LastError = err.Error()
+	}
+	t.mu.Unlock()
+}
+
+// skip records an occurrence that didn't run.
+func (s *Scheduler) skip(t *task, due time.Time, reason string) {
+	metrics.SchedulerRuns.WithLabelValues(t.Name, resultSkipped).Inc()
+	slog.Debug("Scheduled task skipped", "task", t.Name, "due", due.Format(time.RFC3339), "reason", reason)
+}
+
+// hold keeps the lock of a finished run until shortly before t's next occurrence, so instances
+// that reach this occurrence late don't run it again.
+func (s *Scheduler) hold(t *task, key string, due time.Time) {
+	var err error
+	if remaining := t.schedule.Next(due).Sub(s.now()) - lockMargin; remaining > 0 {
+		_, err = s.locker.Refresh(key, s.owner, remaining)
+	} else {
+		err = s.locker.Release(key, s.owner)
+	}
+	if err != nil {
+		slog.Warn("Failed to update a scheduled task's lock", "task", t.Name, "error", err)
+	}
+}
+
+// call runs t with its timeout, turning a panic into an error.
+func (s *Scheduler) call(ctx context.Context, t *task) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("Scheduled task panicked", "task", t.Name, "panic", recovered, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return t.Run(ctx)
+}
+
+// Tasks returns the registered tasks, with their next and last runs.
+func (s *Scheduler) Tasks() []TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	statuses := make([]TaskStatus, len(s.tasks))
+	for i, t := range s.tasks {
+		t.mu.Lock()
+		status := t.last
+		t.mu.Unlock()
+		status.Name, status.Schedule, status.Enabled, status.Running = t.Name, t.schedule.String(), t.enabled, t.running.Load()
+		if next := t.schedule.Next(now); t.enabled && !next.IsZero() {
+			status.NextRun = &next
+		}
+		statuses[i] = status
+	}
+	return statuses
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegister_Env tests schedules from SCHEDULER_<NAME>, and invalid registrations.
+func TestRegister_Env(t *testing.T) {
+	s := New(nil, "instance-a")
+	noop := func(ctx context.Context) error { return nil }
+
+	t.Setenv("SCHEDULER_PRICE_WARMUP", "0 * * * *")
+	t.Setenv("SCHEDULER_CACHE_CLEANUP", "off")
+	require.NoError(t, s.Register(Task{Name: "price-warmup", Schedule: "*/5 * * * *", Run: noop}))
+	require.NoError(t, s.Register(Task{Name: "cache.cleanup", Schedule: "*/5 * * * *", Run: noop}))
+	assert.Error(t, s.Register(Task{Name: "price-warmup", Schedule: "* * * * *", Run: noop}), "already registered")
+	assert.Error(t, s.Register(Task{Name: "invalid", Schedule: "every minute", Run: noop}))
+
+	tasks := s.Tasks()
+	require.Len(t, tasks, 2)
+	assert.Equal(t, "0 * * * *", tasks[0].Schedule)
+	assert.True(t, tasks[0].Enabled)
+	assert.NotNil(t, tasks[0].NextRun)
+	assert.False(t, tasks[1].Enabled)
+	assert.Nil(t, tasks[1].NextRun)
+}
+
+// TestRun_Lock tests that one instance runs each occurrence, and that a run still in progress
+// makes the next occurrence skipped.
+func TestRun_Lock(t *testing.T) {
+	store := cache.NewMemoryStore()
+	a, b := New(store, "instance-a"), New(store, "instance-b")
+	var runs atomic.Int32
+	release := make(chan struct{})
+	task := Task{Name: "warmup", Schedule: "* * * * *", Run: func(ctx context.Context) error {
+		runs.Add(1)
+		<-release
+		return nil
+	}}
+	require.NoError(t, a.Register(task))
+	require.NoError(t, b.Register(task))
+
+	due := time.Now().Truncate(time.Minute)
+	done := make(chan struct{})
+	go func() {
+		a.run(context.Background(), a.tasks[0], due)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	b.run(context.Background(), b.tasks[0], due)
+	a.run(context.Background(), a.tasks[0], due.Add(time.Minute))
+	assert.Equal(t, int32(1), runs.Load(), "b lost the lock, a's previous run is in progress")
+
+	close(release)
+	<-done
+	assert.Equal(t, "succeeded", a.Tasks()[0].LastResult)
+}
+
+// TestRun_Errors tests that failures and panics are recorded without stopping the scheduler.
+func TestRun_Errors(t *testing.T) {
+	s := New(nil, "instance-a")
+	require.NoError(t, s.Register(Task{Name: "failing", Schedule: "* * * * *", Run: func(ctx context.Context) error {
+		return errors.New("upstream unavailable")
+	}}))
+	require.NoError(t, s.Register(Task{Name: "panicking", Schedule: "* * * * *", Run: func(ctx context.Context) error {
+		panic("boom")
+	}}))
+
+	due := time.Now().Truncate(time.Minute)
+	for _, task := range s.tasks {
+		s.run(context.Background(), task, due)
+	}
+	tasks := s.Tasks()
+	assert.Equal(t, "failed", tasks[0].LastResult)
+	assert.Equal(t, "upstream unavailable", tasks[0].LastError)
+	assert.Equal(t, "panic: boom", tasks[1].LastError)
+	assert.False(t, tasks[1].Running)
+}
+
+// TestInit_Registered tests that Init schedules the tasks registered before it again, reading
+// their SCHEDULER_<NAME> again.
+func TestInit_Registered(t *testing.T) {
+	original := DefaultScheduler
+	t.Cleanup(func() {
+		DefaultScheduler = original
+		registered = nil
+	})
+	t.Setenv("SCHEDULER", "")
+	noop := func(ctx context.Context) error { return nil }
+
+	Init()
+	require.NoError(t, Register(Task{Name: "price-warmup", Schedule: "*/5 * * * *", Run: noop}))
+	require.Len(t, Get().Tasks(), 1)
+
+	t.Setenv("SCHEDULER_PRICE_WARMUP", "0 * * * *")
+	Init()
+	tasks := Get().Tasks()
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "0 * * * *", tasks[0].Schedule)
+}
@@ -0,0 +1,278 @@
+package sdk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dart renders a Dart/Flutter client: an ApiClient class with one method per operation (using
+// package:http) and a subscribe function speaking the WebSocket protocol (using
+// package:web_socket_channel), with a class and fromJson factory per payload type.
+func Dart(spec Spec) []byte {
+	var b strings.Builder
+	p := func(format string, args ...any) { fmt.Fprintf(&b, format+"\n", args...) }
+
+	p("// %s", header)
+	p("//")
+	p("// dependencies: http, web_socket_channel")
+	p("")
+	p("import 'dart:convert';")
+	p("")
+	p("import 'package:http/http.dart' as http;")
+	p("import 'package:web_socket_channel/web_socket_channel.dart';")
+	p("")
+
+	// Step 1: HTTP client
+	p("/// Non-2xx response. body is the decoded problem details (with code and error) when there is one.")
+	p("class ApiException implements Exception {")
+	p("  final int status;")
+	p("  final dynamic body;")
+	p("  ApiException(this.status, this.body);")
+	p("")
+	p("  @override")
+	p("  String toString() => 'ApiException($status): $body';")
+	p("}")
+	p("")
+	p("class ApiClient {")
+	p("  /// Server URL, e.g. https://api.example.com")
+	p("  final String baseUrl;")
+	p("  /// Returns the bearer token for operations that require auth")
+	p("  final Future<String?> Function()? token;")
+	p("  final http.Client _http;")
+	p("")
+	p("  ApiClient(this.baseUrl, {this.token, http.Client? client}) : _http = client ?? http.Client();")
+	p("")
+	for _, op := range spec.Operations {
+		params := make([]string, 0, len(op.PathParams))
+		for _, param := range op.PathParams {
+			params = append(params, "String "+camel(param))
+		}
+		named := []string{"Map<String, String>? query"}
+		body := "null"
+		if op.HasBody {
+			named = append([]string{"Object? body"}, named...)
+			body = "body"
+		}
+		params = append(params, "{"+strings.Join(named, ", ")+"}")
+
+		p("  /// %s (%s %s%s)", op.Summary, op.Method, op.Path, authNote(op.Auth))
+		p("  Future<dynamic> %s(%s) =>", op.Name, strings.Join(params, ", "))
+		p("      _request('%s', %s, %s, query, %t);", op.Method, dartPath(op), body, op.Auth)
+		p("")
+	}
+	p("  Future<dynamic> _request(String method, String path, Object? body, Map<String, String>? query, bool auth) async {")
+	p("    final uri = Uri.parse(baseUrl).resolve(path).replace(queryParameters: query);")
+	p("    final request = http.Request(method, uri)..headers['Accept'] = 'application/json';")
+	p("    if (body != null) {")
+	p("      request.headers['Content-Type'] = 'application/json';")
+	p("      request.body = jsonEncode(body);")
+	p("    }")
+	p("    final bearer = auth && token != null ? await token!() : null;")
+	p("    if (bearer != null) request.headers['Authorization'] = 'Bearer $bearer';")
+	p("")
+	p("    final response = await http.Response.fromStream(await _http.send(request));")
+	p("    dynamic data = response.body;")
+	p("    try {")
+	p("      data = response.body.isEmpty ? null : jsonDecode(response.body);")
+	p("    } on FormatException {")
+	p("      // Not JSON")
+	p("    }")
+	p("    if (response.statusCode < 200 || response.statusCode >= 300) throw ApiException(response.statusCode, data);")
+	p("    return data;")
+	p("  }")
+	p("}")
+	p("")
+
+	// Step 2: WebSocket messages, from the protobuf schema
+	p("/// Subprotocol declaring the message schema this client understands.")
+	p("const subprotocol = '%s';", spec.Subprotocol)
+	p("")
+	p("/// Prefix of the subprotocol carrying the access token (kept out of the URL).")
+	p("const tokenSubprotocolPrefix = '%s';", spec.TokenPrefix)
+	p("")
+	p("/// Message types (the envelope's type).")
+	p("class MessageType {")
+	for _, payload := range spec.Payloads {
+		p("  static const %s = '%s';", camel(payload.Type), payload.Type)
+	}
+	p("}")
+	p("")
+	p("/// Application close codes: the server sends an error message, then closes with one of these.")
+	p("class CloseCode {")
+	for _, code := range spec.CloseCodes {
+		p("  static const %s = %d;", camel(code.Name), code.Code)
+	}
+	p("}")
+	p("")
+	p("/// Every server-pushed message.")
+	p("class Envelope {")
+	p("  final String type;")
+	p("  final int version;")
+	p("  final dynamic data;")
+	p("  final String ts;")
+	p("  final String id;")
+	p("")
+	p("  Envelope.fromJson(Map<String, dynamic> json)")
+	p("      : type = json['type'] as String? ?? '',")
+	p("        version = (json['version'] as num?)?.toInt() ?? 0,")
+	p("        data = json['data'],")
+	p("        ts = json['ts'] as String? ?? '',")
+	p("        id = json['id'] as String? ?? '';")
+	p("}")
+	p("")
+	for _, message := range spec.Messages {
+		p("class %s {", message.Name)
+		for _, field := range message.Fields {
+			p("  final %s %s;", dartFieldType(field), camel(field.Name))
+		}
+		p("")
+		p("  %s.fromJson(Map<String, dynamic> json)", message.Name)
+		for i, field := range message.Fields {
+			separator := ","
+			if i == len(message.Fields)-1 {
+				separator = ";"
+			}
+			prefix := "        "
+			if i == 0 {
+				prefix = "      : "
+			}
+			p("%s%s = %s%s", prefix, camel(field.Name), dartDecode(field), separator)
+		}
+		p("}")
+		p("")
+	}
+
+	// Step 3: subscribe
+	p("/// Opens the realtime WebSocket and dispatches typed messages. Close it with sink.close().")
+	p("WebSocketChannel subscribe(")
+	p("  String baseUrl, {")
+	for _, payload := range spec.Payloads {
+		p("  void Function(%s data, Envelope envelope)? on%s,", dartPayloadType(payload), pascal(payload.Type))
+	}
+	p("  void Function(Envelope envelope)? onMessage,")
+	p("  void Function(int? code, String? reason, %s? error)? onClose,", messageName("Error"))
+	p("  String? mode,")
+	p("  String? deltaInterval,")
+	p("  bool priceMeta = false,")
+	p("  String? token,")
+	p("}) {")
+	p("  final query = <String, String>{")
+	p("    if (mode != null) 'mode': mode,")
+	p("    if (deltaInterval != null) 'delta_interval': deltaInterval,")
+	p("    if (priceMeta) 'price_meta': 'true',")
+	p("  };")
+	p("  final base = Uri.parse(baseUrl);")
+	p("  final uri = base.replace(")
+	p("    scheme: base.scheme == 'https' ? 'wss' : 'ws',")
+	p("    path: '%s',", spec.SocketPath)
+	p("    queryParameters: query.isEmpty ? null : query,")
+	p("  );")
+	p("")
+	p("  final channel = WebSocketChannel.connect(uri, protocols: [")
+	p("    subprotocol,")
+	p("    if (token != null) '$tokenSubprotocolPrefix$token',")
+	p("  ]);")
+	p("  %s? lastError;", messageName("Error"))
+	p("  channel.stream.listen((frame) {")
+	p("    final envelope = Envelope.fromJson(jsonDecode(frame as String) as Map<String, dynamic>);")
+	p("    onMessage?.call(envelope);")
+	p("    switch (envelope.type) {")
+	for _, payload := range spec.Payloads {
+		p("      case MessageType.%s:", camel(payload.Type))
+		decoded := "envelope.data"
+		if payload.Message != "" {
+			decoded = payload.Message + ".fromJson(envelope.data as Map<String, dynamic>)"
+		}
+		if payload.Message == messageName("Error") {
+			p("        lastError = %s;", decoded)
+			decoded = "lastError!"
+		}
+		p("        on%s?.call(%s, envelope);", pascal(payload.Type), decoded)
+		p("        break;")
+	}
+	p("    }")
+	p("  }, onDone: () => onClose?.call(channel.closeCode, channel.closeReason, lastError));")
+	p("  return channel;")
+	p("}")
+
+	return []byte(b.String())
+}
+
+// dartPath renders an operation's path as a Dart string, substituting path params.
+func dartPath(op Operation) string {
+	path := op.Path
+	for _, param := range op.PathParams {
+		path = strings.Replace(path, ":"+param, "${Uri.encodeComponent("+camel(param)+")}", 1)
+	}
+	return "'" + path + "'"
+}
+
+// dartScalarType returns the Dart type of a field's values.
+func dartScalarType(field Field) string {
+	switch field.Type {
+	case TypeNumber:
+		return "int"
+	case TypeBool:
+		return "bool"
+	case TypeMessage:
+		return field.Message
+	default:
+		return "String"
+	}
+}
+
+// dartFieldType returns the Dart type of a payload field. Single message fields are nullable;
+// everything else defaults to its zero value when omitted.
+func dartFieldType(field Field) string {
+	base := dartScalarType(field)
+	switch {
+	case field.Map:
+		return "Map<String, " + base + ">"
+	case field.Repeated:
+		return "List<" + base + ">"
+	case field.Type == TypeMessage:
+		return base + "?"
+	default:
+		return base
+	}
+}
+
+// dartDecode returns the expression decoding a field from json.
+func dartDecode(field Field) string {
+	value := "json['" + field.Name + "']"
+	base := dartScalarType(field)
+
+	element := func(v string) string {
+		switch field.Type {
+		case TypeNumber:
+			return "(" + v + " as num).toInt()"
+		case TypeMessage:
+			return base + ".fromJson(" + v + " as Map<String, dynamic>)"
+		default:
+			return v + " as " + base
+		}
+	}
+
+	switch {
+	case field.Map:
+		return "(" + value + " as Map<String, dynamic>? ?? const {}).map((k, v) => MapEntry(k, " + element("v") + "))"
+	case field.Repeated:
+		return "(" + value + " as List? ?? const []).map((v) => " + element("v") + ").toList()"
+	case field.Type == TypeMessage:
+		return value + " == null ? null : " + element(value)
+	case field.Type == TypeNumber:
+		return "(" + value + " as num?)?.toInt() ?? 0"
+	case field.Type == TypeBool:
+		return value + " as bool? ?? false"
+	default:
+		return value + " as String? ?? ''"
+	}
+}
+
+// dartPayloadType returns the Dart type of a message type's data.
+func dartPayloadType(payload Payload) string {
+	if payload.Message == "" {
+		return "dynamic"
+	}
+	return payload.Message
+}
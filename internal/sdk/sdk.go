@@ -0,0 +1,289 @@
+package sdk
+
+// Package sdk generates typed client bindings (TypeScript, Dart) for the API, so frontend apps
+// don't copy-paste fetch and WebSocket snippets that drift from the server.
+//
+// Both inputs are the server's own definitions: HTTP operations come from the docs registry
+// merged with the live route table (the same list /docs shows), and WebSocket messages come from
+// the protobuf schema in internal/realtimepb, whose Envelope oneof lists every message type.
+// Run `go run ./cmd/server gen-sdk` after changing either.
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"boilerplate/internal/docs"
+	"boilerplate/internal/handlers"
+	"boilerplate/internal/realtimepb"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Spec is everything a client needs to know about the API.
+type Spec struct {
+	Operations  []Operation
+	Messages    []Message   // WebSocket payload types, in schema order
+	Payloads    []Payload   // Message types pushed over the WebSocket
+	CloseCodes  []CloseCode // Application close codes (see handlers/ws_close.go)
+	Subprotocol string      // Subprotocol declaring the latest JSON schema, e.g. app.ws.v2
+	TokenPrefix string      // Prefix of the subprotocol carrying the access token (app.ws.token.)
+	SocketPath  string      // Path of the WebSocket endpoint
+}
+
+// Operation is one HTTP endpoint.
+type Operation struct {
+	Name       string   // Method name in the client, e.g. getProfile
+	Method     string   // HTTP method
+	Path       string   // Route path with :params
+	PathParams []string // Names of the :params, in order
+	Summary    string
+	Auth       bool // Sends the bearer token
+	Body       any  // Decoded example body (nil: none), used to type the request body
+	HasBody    bool // Whether the method takes a request body
+}
+
+// Message is a WebSocket payload type.
+type Message struct {
+	Name   string
+	Fields []Field
+}
+
+// Field is a payload field. Fields at their zero value may be omitted on the wire.
+type Field struct {
+	Name     string // JSON name (snake_case)
+	Type     FieldType
+	Message  string // Message name when Type is TypeMessage
+	Repeated bool
+	Map      bool // map<string, Type>
+}
+
+// FieldType is the wire type of a field.
+type FieldType int
+
+// Field types.
+const (
+	TypeString FieldType = iota
+	TypeNumber
+	TypeBool
+	TypeMessage
+)
+
+// Payload is a message type pushed over the WebSocket ("type" of the envelope).
+type Payload struct {
+	Type    string // e.g. price_update
+	Message string // Payload message name; "" for free-form JSON (broadcasts)
+}
+
+// CloseCode is an application close code.
+type CloseCode struct {
+	Name string
+	Code int
+}
+
+// messageNames renames schema messages that clash with language built-ins (Error).
+var messageNames = map[string]string{"Error": "CloseError"}
+
+// freeFormMessages carry arbitrary JSON on the JSON wire (wrapped as bytes in protobuf).
+var freeFormMessages = map[string]bool{"Broadcast": true, "Preferences": true}
+
+// Build assembles the spec from the documented endpoints (see docs.Registry.Endpoints).
+func Build(endpoints []docs.Endpoint) Spec {
+	spec := Spec{
+		Subprotocol: handlers.SchemaSubprotocol(handlers.SchemaLatest),
+		TokenPrefix: handlers.TokenSubprotocolPrefix,
+		SocketPath:  "/ws",
+		CloseCodes: []CloseCode{
+			{"Unauthorized", handlers.CloseUnauthorized},
+			{"Forbidden", handlers.CloseForbidden},
+			{"SlowClient", handlers.CloseSlowClient},
+			{"RateLimited", handlers.CloseRateLimited},
+			{"InternalError", handlers.CloseInternalError},
+			{"Draining", handlers.CloseDraining},
+		},
+	}
+
+	for _, endpoint := range endpoints {
+		if !includeEndpoint(endpoint) {
+			continue
+		}
+		spec.Operations = append(spec.Operations, newOperation(endpoint))
+	}
+	sort.SliceStable(spec.Operations, func(i, j int) bool {
+		return spec.Operations[i].Name < spec.Operations[j].Name
+	})
+
+	spec.Messages, spec.Payloads = realtimeMessages()
+	return spec
+}
+
+// includeEndpoint reports whether a client would call an endpoint: documented JSON APIs, not
+// pages, downloads, metrics or the WebSocket (which gets its own bindings).
+func includeEndpoint(endpoint docs.Endpoint) bool {
+	if !endpoint.Documented || endpoint.WebSocket {
+		return false
+	}
+	return endpoint.Path == "/health" || endpoint.Path == "/graphql" || strings.HasPrefix(endpoint.Path, "/api/")
+}
+
+// newOperation describes an endpoint as a client method.
+func newOperation(endpoint docs.Endpoint) Operation {
+	op := Operation{
+		Method:  endpoint.Method,
+		Path:    endpoint.Path,
+		Summary: endpoint.Summary,
+		Auth:    endpoint.Auth,
+		HasBody: endpoint.Method != "GET" && endpoint.Method != "DELETE",
+	}
+
+	// Step 1: Name the method after the HTTP method and the path, e.g.
+	// PUT /api/admin/ratelimit/overrides/:key -> putAdminRatelimitOverridesByKey
+	name := strings.ToLower(endpoint.Method)
+	for _, segment := range strings.Split(endpoint.Path, "/") {
+		switch {
+		case segment == "" || segment == "api" || segment == "*":
+			continue
+		case strings.HasPrefix(segment, ":"):
+			param := strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?")
+			op.PathParams = append(op.PathParams, param)
+			name += "By" + pascal(param)
+		default:
+			name += pascal(segment)
+		}
+	}
+	op.Name = name
+
+	// Step 2: Type the body from the documented example
+	if op.HasBody && endpoint.ExampleBody != "" {
+		var body any
+		if err := json.Unmarshal([]byte(endpoint.ExampleBody), &body); err == nil {
+			op.Body = body
+		}
+	}
+	return op
+}
+
+// realtimeMessages reads the WebSocket payload types from the protobuf schema: every case of
+// the Envelope's data oneof is a message type, named after the oneof field.
+func realtimeMessages() ([]Message, []Payload) {
+	var messages []Message
+	fileMessages := realtimepb.File_realtime_proto.Messages()
+	envelope := (&realtimepb.Envelope{}).ProtoReflect().Descriptor()
+
+	for i := 0; i < fileMessages.Len(); i++ {
+		descriptor := fileMessages.Get(i)
+		name := string(descriptor.Name())
+		if descriptor.FullName() == envelope.FullName() || freeFormMessages[name] {
+			continue
+		}
+
+		message := Message{Name: messageName(name)}
+		fields := descriptor.Fields()
+		for j := 0; j < fields.Len(); j++ {
+			message.Fields = append(message.Fields, newField(fields.Get(j)))
+		}
+		messages = append(messages, message)
+	}
+
+	var payloads []Payload
+	cases := envelope.Oneofs().ByName("data").Fields()
+	for i := 0; i < cases.Len(); i++ {
+		field := cases.Get(i)
+		payload := Payload{Type: string(field.Name())}
+		if name := string(field.Message().Name()); !freeFormMessages[name] {
+			payload.Message = messageName(name)
+		}
+		payloads = append(payloads, payload)
+	}
+	sort.SliceStable(payloads, func(i, j int) bool {
+		return payloads[i].Type < payloads[j].Type
+	})
+
+	return messages, payloads
+}
+
+// newField describes a protobuf field.
+func newField(descriptor protoreflect.FieldDescriptor) Field {
+	field := Field{Name: string(descriptor.Name()), Repeated: descriptor.IsList(), Map: descriptor.IsMap()}
+	if field.Map {
+		descriptor = descriptor.MapValue()
+	}
+
+	switch descriptor.Kind() {
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		field.Type = TypeString
+	case protoreflect.BoolKind:
+		field.Type = TypeBool
+	case protoreflect.MessageKind:
+		field.Type = TypeMessage
+		field.Message = messageName(string(descriptor.Message().Name()))
+	default:
+		field.Type = TypeNumber
+	}
+	return field
+}
+
+// messageName returns the client name of a schema message.
+func messageName(name string) string {
+	if renamed, ok := messageNames[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// Languages are the supported targets and their output file names.
+var Languages = map[string]string{
+	"typescript": "client.ts",
+	"dart":       "client.dart",
+}
+
+// Generate renders the client for a language (see Languages).
+func Generate(language string, spec Spec) ([]byte, error) {
+	switch language {
+	case "typescript":
+		return TypeScript(spec), nil
+	case "dart":
+		return Dart(spec), nil
+	default:
+		return nil, fmt.Errorf("unknown SDK language %q (supported: typescript, dart)", language)
+	}
+}
+
+// pascal converts snake_case, kebab-case and dotted names to PascalCase.
+func pascal(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// camel converts snake_case names to camelCase.
+func camel(name string) string {
+	p := pascal(name)
+	if p == "" {
+		return p
+	}
+	return strings.ToLower(p[:1]) + p[1:]
+}
+
+// header is the comment at the top of every generated file.
+const header = "Code generated by `go run ./cmd/server gen-sdk`. DO NOT EDIT."
+
+// Handler serves the generated client for the :language param (typescript or dart), built from
+// the app's live routes, so the demo page can link to an always up-to-date SDK.
+func Handler(app *fiber.App) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		spec := Build(docs.DefaultRegistry.Endpoints(app.GetRoutes(true)))
+		source, err := Generate(c.Params("language"), spec)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		c.Set(fiber.HeaderContentDisposition, `inline; filename="`+Languages[c.Params("language")]+`"`)
+		return c.Send(source)
+	}
+}
@@ -0,0 +1,111 @@
+package sdk
+
+import (
+	"testing"
+
+	"boilerplate/internal/docs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEndpoints is a small route table as returned by docs.Registry.Endpoints.
+var testEndpoints = []docs.Endpoint{
+	{Method: "GET", Path: "/health", Summary: "Health check", Documented: true},
+	{Method: "GET", Path: "/docs", Summary: "API documentation", Documented: true},
+	{Method: "GET", Path: "/ws", Summary: "WebSocket", WebSocket: true, Documented: true},
+	{Method: "GET", Path: "/api/undocumented", Summary: "Undocumented route"},
+	{Method: "GET", Path: "/api/profile", Summary: "Current user", Auth: true, Documented: true},
+	{
+		Method:      "PUT",
+		Path:        "/api/admin/ratelimit/overrides/:key",
+		Summary:     "Override the rate limit",
+		Auth:        true,
+		ExampleBody: `{"max": 1000, "note": "partner"}`,
+		Documented:  true,
+	},
+}
+
+// TestBuild_Operations tests which endpoints become client methods, and how they are named.
+func TestBuild_Operations(t *testing.T) {
+	spec := Build(testEndpoints)
+
+	names := make([]string, 0, len(spec.Operations))
+	for _, op := range spec.Operations {
+		names = append(names, op.Name)
+	}
+	assert.Equal(t, []string{"getHealth", "getProfile", "putAdminRatelimitOverridesByKey"}, names)
+
+	override := spec.Operations[2]
+	assert.Equal(t, []string{"key"}, override.PathParams)
+	assert.True(t, override.Auth)
+	assert.True(t, override.HasBody)
+	assert.Equal(t, "{ max?: number; note?: string }", tsType(override.Body))
+}
+
+// TestBuild_Messages tests that the WebSocket types are read from the protobuf schema.
+func TestBuild_Messages(t *testing.T) {
+	spec := Build(nil)
+
+	types := make(map[string]string)
+	for _, payload := range spec.Payloads {
+		types[payload.Type] = payload.Message
+	}
+	assert.Equal(t, map[string]string{
+		"broadcast":    "", // Free-form JSON
+		"error":        "CloseError",
+		"preferences":  "", // Free-form JSON (typed by the preference schema)
+		"price_delta":  "PriceDelta",
+		"price_update": "PriceUpdate",
+		"welcome":      "Welcome",
+	}, types)
+
+	var update Message
+	for _, message := range spec.Messages {
+		if message.Name == "PriceUpdate" {
+			update = message
+		}
+	}
+	require.NotEmpty(t, update.Fields)
+	assert.Equal(t, Field{Name: "artist_id", Type: TypeString}, update.Fields[0])
+	assert.Equal(t, Field{Name: "price_meta", Type: TypeMessage, Message: "PriceMeta"}, update.Fields[4])
+	assert.Equal(t, "app.ws.v2", spec.Subprotocol)
+}
+
+// TestGenerate tests the rendered clients.
+func TestGenerate(t *testing.T) {
+	spec := Build(testEndpoints)
+
+	typescript, err := Generate("typescript", spec)
+	require.NoError(t, err)
+	for _, want := range []string{
+		"export type PutAdminRatelimitOverridesByKeyBody = { max?: number; note?: string };",
+		"putAdminRatelimitOverridesByKey<T = unknown>(key: string, body?: PutAdminRatelimitOverridesByKeyBody, query?: Query): Promise<T> {",
+		"`/api/admin/ratelimit/overrides/${encodeURIComponent(key)}`",
+		"return this.request<T>('GET', '/health', undefined, query, false);",
+		"export interface PriceDelta {\n  prices: Record<string, string>;\n  removed: string[];\n}",
+		"  price_meta?: PriceMeta;",
+		"  RateLimited: 4429,",
+		"export const SUBPROTOCOL = 'app.ws.v2';",
+		"if (options.token) protocols.push(TOKEN_SUBPROTOCOL_PREFIX + options.token);",
+		"onPriceUpdate?(data: PriceUpdate, envelope: Envelope<PriceUpdate>): void;",
+	} {
+		assert.Contains(t, string(typescript), want)
+	}
+
+	dart, err := Generate("dart", spec)
+	require.NoError(t, err)
+	for _, want := range []string{
+		"Future<dynamic> putAdminRatelimitOverridesByKey(String key, {Object? body, Map<String, String>? query}) =>",
+		"'/api/admin/ratelimit/overrides/${Uri.encodeComponent(key)}'",
+		"retryAfter = (json['retry_after'] as num?)?.toInt() ?? 0;",
+		"static const rateLimited = 4429;",
+		"const tokenSubprotocolPrefix = 'app.ws.token.';",
+		"void Function(PriceUpdate data, Envelope envelope)? onPriceUpdate,",
+	} {
+		assert.Contains(t, string(dart), want)
+	}
+
+	_, err = Generate("cobol", spec)
+	assert.Error(t, err)
+}
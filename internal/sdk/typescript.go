@@ -0,0 +1,280 @@
+package sdk
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TypeScript renders a dependency-free TypeScript client: an ApiClient class with one method per
+// operation (using fetch) and a subscribe function speaking the WebSocket protocol (JSON schema
+// envelopes, typed payloads, close codes).
+func TypeScript(spec Spec) []byte {
+	var b strings.Builder
+	p := func(format string, args ...any) { fmt.Fprintf(&b, format+"\n", args...) }
+
+	p("// %s", header)
+	p("")
+	p("/* eslint-disable */")
+	p("")
+
+	// Step 1: HTTP client
+	p("export interface ClientOptions {")
+	p("  /** Server URL, e.g. https://api.example.com */")
+	p("  baseUrl: string;")
+	p("  /** Bearer token (or a function returning it) for operations that require auth */")
+	p("  token?: string | (() => string | undefined | Promise<string | undefined>);")
+	p("  /** fetch implementation, defaults to the global fetch */")
+	p("  fetch?: typeof fetch;")
+	p("}")
+	p("")
+	p("export type Query = Record<string, string | number | boolean | undefined>;")
+	p("")
+	p("/** Non-2xx response. body is the parsed problem details (with code and error) when there is one. */")
+	p("export class ApiError extends Error {")
+	p("  constructor(public status: number, public body: unknown) {")
+	p("    super(typeof body === 'object' && body !== null && 'error' in body ? String((body as { error: unknown }).error) : 'HTTP ' + status);")
+	p("  }")
+	p("}")
+	p("")
+	for _, op := range spec.Operations {
+		if op.Body != nil {
+			p("export type %sBody = %s;", pascal(op.Name), tsType(op.Body))
+			p("")
+		}
+	}
+
+	p("export class ApiClient {")
+	p("  constructor(private options: ClientOptions) {}")
+	p("")
+	for _, op := range spec.Operations {
+		params := make([]string, 0, len(op.PathParams)+2)
+		for _, param := range op.PathParams {
+			params = append(params, camel(param)+": string")
+		}
+		body := "undefined"
+		if op.HasBody {
+			bodyType := "unknown"
+			if op.Body != nil {
+				bodyType = pascal(op.Name) + "Body"
+			}
+			params = append(params, "body?: "+bodyType)
+			body = "body"
+		}
+		params = append(params, "query?: Query")
+
+		p("  /** %s (%s %s%s) */", op.Summary, op.Method, op.Path, authNote(op.Auth))
+		p("  %s<T = unknown>(%s): Promise<T> {", op.Name, strings.Join(params, ", "))
+		p("    return this.request<T>('%s', %s, %s, query, %t);", op.Method, tsPath(op), body, op.Auth)
+		p("  }")
+		p("")
+	}
+	p("  private async request<T>(method: string, path: string, body: unknown, query: Query | undefined, auth: boolean): Promise<T> {")
+	p("    const url = new URL(path, this.options.baseUrl);")
+	p("    for (const [key, value] of Object.entries(query ?? {})) {")
+	p("      if (value !== undefined) url.searchParams.set(key, String(value));")
+	p("    }")
+	p("    const headers: Record<string, string> = { Accept: 'application/json' };")
+	p("    if (body !== undefined) headers['Content-Type'] = 'application/json';")
+	p("    const token = typeof this.options.token === 'function' ? await this.options.token() : this.options.token;")
+	p("    if (auth && token) headers['Authorization'] = 'Bearer ' + token;")
+	p("")
+	p("    const response = await (this.options.fetch ?? fetch)(url.toString(), {")
+	p("      method,")
+	p("      headers,")
+	p("      body: body === undefined ? undefined : JSON.stringify(body),")
+	p("    });")
+	p("    const text = await response.text();")
+	p("    let data: unknown = text;")
+	p("    try { data = text ? JSON.parse(text) : undefined; } catch { /* not JSON */ }")
+	p("    if (!response.ok) throw new ApiError(response.status, data);")
+	p("    return data as T;")
+	p("  }")
+	p("}")
+	p("")
+
+	// Step 2: WebSocket messages, from the protobuf schema
+	p("/** Subprotocol declaring the message schema this client understands. */")
+	p("export const SUBPROTOCOL = '%s';", spec.Subprotocol)
+	p("/** Prefix of the subprotocol carrying the access token (kept out of the URL). */")
+	p("export const TOKEN_SUBPROTOCOL_PREFIX = '%s';", spec.TokenPrefix)
+	p("")
+	p("/** Message types (the envelope's type). */")
+	p("export const MessageType = {")
+	for _, payload := range spec.Payloads {
+		p("  %s: '%s',", pascal(payload.Type), payload.Type)
+	}
+	p("} as const;")
+	p("")
+	p("/** Application close codes: the server sends an error message, then closes with one of these. */")
+	p("export const CloseCode = {")
+	for _, code := range spec.CloseCodes {
+		p("  %s: %d,", code.Name, code.Code)
+	}
+	p("} as const;")
+	p("")
+	p("/** Every server-pushed message. Fields at their zero value may be omitted. */")
+	p("export interface Envelope<T = unknown> {")
+	p("  type: string;")
+	p("  version: number;")
+	p("  data: T;")
+	p("  ts: string;")
+	p("  id: string;")
+	p("}")
+	p("")
+	for _, message := range spec.Messages {
+		p("export interface %s {", message.Name)
+		for _, field := range message.Fields {
+			optional := ""
+			if field.Type == TypeMessage && !field.Repeated && !field.Map {
+				optional = "?"
+			}
+			p("  %s%s: %s;", field.Name, optional, tsFieldType(field))
+		}
+		p("}")
+		p("")
+	}
+
+	// Step 3: subscribe
+	p("export interface SubscribeOptions {")
+	p("  /** Batched price_delta messages instead of price_update */")
+	p("  mode?: 'delta';")
+	p("  /** Delta batch interval, e.g. '500ms' */")
+	p("  deltaInterval?: string;")
+	p("  /** Display metadata on price updates */")
+	p("  priceMeta?: boolean;")
+	p("  /** Access token, for messages addressed to the user (e.g. preferences) */")
+	p("  token?: string;")
+	p("}")
+	p("")
+	p("export interface SubscribeHandlers {")
+	for _, payload := range spec.Payloads {
+		p("  on%s?(data: %s, envelope: Envelope<%s>): void;", pascal(payload.Type), tsPayloadType(payload), tsPayloadType(payload))
+	}
+	p("  /** Any message, including types this client doesn't know yet */")
+	p("  onMessage?(envelope: Envelope): void;")
+	p("  /** The connection closed; error is the server's explanation, if it sent one */")
+	p("  onClose?(code: number, reason: string, error?: CloseError): void;")
+	p("}")
+	p("")
+	p("/** Opens the realtime WebSocket and dispatches typed messages. Close it with the returned socket. */")
+	p("export function subscribe(baseUrl: string, handlers: SubscribeHandlers, options: SubscribeOptions = {}): WebSocket {")
+	p("  const url = new URL('%s', baseUrl.replace(/^http/, 'ws'));", spec.SocketPath)
+	p("  if (options.mode) url.searchParams.set('mode', options.mode);")
+	p("  if (options.deltaInterval) url.searchParams.set('delta_interval', options.deltaInterval);")
+	p("  if (options.priceMeta) url.searchParams.set('price_meta', 'true');")
+	p("")
+	p("  const protocols = [SUBPROTOCOL];")
+	p("  if (options.token) protocols.push(TOKEN_SUBPROTOCOL_PREFIX + options.token);")
+	p("  const socket = new WebSocket(url.toString(), protocols);")
+	p("  let lastError: CloseError | undefined;")
+	p("  socket.onmessage = (event) => {")
+	p("    const envelope = JSON.parse(String(event.data)) as Envelope;")
+	p("    handlers.onMessage?.(envelope);")
+	p("    switch (envelope.type) {")
+	for _, payload := range spec.Payloads {
+		p("      case MessageType.%s:", pascal(payload.Type))
+		if payload.Message == messageName("Error") {
+			p("        lastError = envelope.data as CloseError;")
+		}
+		p("        handlers.on%s?.(envelope.data as %s, envelope as Envelope<%s>);", pascal(payload.Type), tsPayloadType(payload), tsPayloadType(payload))
+		p("        break;")
+	}
+	p("    }")
+	p("  };")
+	p("  socket.onclose = (event) => handlers.onClose?.(event.code, event.reason, lastError);")
+	p("  return socket;")
+	p("}")
+
+	return []byte(b.String())
+}
+
+// tsPath renders an operation's path as a TypeScript expression, substituting path params.
+func tsPath(op Operation) string {
+	if len(op.PathParams) == 0 {
+		return "'" + op.Path + "'"
+	}
+	path := op.Path
+	for _, param := range op.PathParams {
+		path = strings.Replace(path, ":"+param, "${encodeURIComponent("+camel(param)+")}", 1)
+	}
+	return "`" + path + "`"
+}
+
+// tsFieldType returns the TypeScript type of a payload field.
+func tsFieldType(field Field) string {
+	var base string
+	switch field.Type {
+	case TypeString:
+		base = "string"
+	case TypeNumber:
+		base = "number"
+	case TypeBool:
+		base = "boolean"
+	case TypeMessage:
+		base = field.Message
+	}
+	switch {
+	case field.Map:
+		return "Record<string, " + base + ">"
+	case field.Repeated:
+		return base + "[]"
+	default:
+		return base
+	}
+}
+
+// tsPayloadType returns the TypeScript type of a message type's data.
+func tsPayloadType(payload Payload) string {
+	if payload.Message == "" {
+		return "unknown"
+	}
+	return payload.Message
+}
+
+// identifier matches names usable unquoted as TypeScript properties.
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// tsType infers a TypeScript type from a decoded JSON example.
+func tsType(value any) string {
+	switch v := value.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		if len(v) == 0 {
+			return "unknown[]"
+		}
+		return tsType(v[0]) + "[]"
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]string, 0, len(keys))
+		for _, key := range keys {
+			name := key
+			if !identifier.MatchString(key) {
+				name = fmt.Sprintf("%q", key)
+			}
+			fields = append(fields, name+"?: "+tsType(v[key]))
+		}
+		return "{ " + strings.Join(fields, "; ") + " }"
+	default:
+		return "unknown"
+	}
+}
+
+// authNote marks operations that need a token in doc comments.
+func authNote(auth bool) string {
+	if auth {
+		return ", requires auth"
+	}
+	return ""
+}
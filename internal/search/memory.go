@@ -0,0 +1,102 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"boilerplate/internal/resource"
+)
+
+// MemorySearcher ranks the artists of the resource store in process memory (see Rank).
+// It is used in tests and as a fallback when Postgres is not configured; every query reads all
+// of the tenant's artists, so it only suits small catalogs.
+type MemorySearcher struct{}
+
+// NewMemorySearcher creates a searcher over resource.DefaultStore.
+func NewMemorySearcher() *MemorySearcher {
+	return &MemorySearcher{}
+}
+
+// Search ranks every live artist of the tenant against query.
+func (m *MemorySearcher) Search(ctx context.Context, tenantID, query string, limit, offset int) ([]Result, error) {
+	artists, err := m.artists(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0)
+	for _, artist := range artists {
+		name, _ := artist["name"].(string)
+		if score := Rank(query, name); score > 0 {
+			results = append(results, Result{Type: "artist", ID: artist.ID(), Name: name, Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+
+	if offset >= len(results) {
+		return []Result{}, nil
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Suggest returns the artists whose name or a word of it starts with prefix, shortest first.
+func (m *MemorySearcher) Suggest(ctx context.Context, tenantID, prefix string, limit int) ([]Suggestion, error) {
+	artists, err := m.artists(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]Suggestion, 0)
+	for _, artist := range artists {
+		name, _ := artist["name"].(string)
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, prefix) || strings.Contains(lower, " "+prefix) {
+			suggestions = append(suggestions, Suggestion{ID: artist.ID(), Name: name})
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if len(suggestions[i].Name) != len(suggestions[j].Name) {
+			return len(suggestions[i].Name) < len(suggestions[j].Name)
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// artists reads every live artist of the tenant, a page at a time.
+func (m *MemorySearcher) artists(ctx context.Context, tenantID string) ([]resource.Record, error) {
+	if resource.DefaultStore == nil {
+		return nil, resource.ErrNotConfigured
+	}
+
+	const pageSize = 1000
+	var all []resource.Record
+	for offset := 0; ; offset += pageSize {
+		page, err := resource.DefaultStore.List(ctx, resource.Artists.Table, resource.Filter{
+			TenantID: tenantID,
+			Limit:    pageSize,
+			Offset:   offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all, nil
+		}
+	}
+}
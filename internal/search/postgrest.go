@@ -0,0 +1,100 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// PostgRESTSearcher runs queries as the search_artists and suggest_artists SQL functions (see
+// schema.sql) through the Supabase REST API.
+type PostgRESTSearcher struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/rpc/
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTSearcher creates a searcher for the given Supabase project.
+func NewPostgRESTSearcher(supabaseURL, serviceKey string) *PostgRESTSearcher {
+	return &PostgRESTSearcher{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/rpc/",
+		serviceKey: serviceKey,
+		client:     egress.NewClient(5 * time.Second),
+	}
+}
+
+// Search calls search_artists.
+func (s *PostgRESTSearcher) Search(ctx context.Context, tenantID, query string, limit, offset int) ([]Result, error) {
+	results := make([]Result, 0)
+	err := s.call(ctx, "search_artists", map[string]interface{}{
+		"p_tenant": tenantID,
+		"p_query":  query,
+		"p_limit":  limit,
+		"p_offset": offset,
+	}, &results)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Type = "artist"
+	}
+	return results, nil
+}
+
+// Suggest calls suggest_artists.
+func (s *PostgRESTSearcher) Suggest(ctx context.Context, tenantID, prefix string, limit int) ([]Suggestion, error) {
+	suggestions := make([]Suggestion, 0)
+	err := s.call(ctx, "suggest_artists", map[string]interface{}{
+		"p_tenant": tenantID,
+		"p_prefix": prefix,
+		"p_limit":  limit,
+	}, &suggestions)
+	if err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// call invokes a SQL function and decodes the rows it returns into target.
+func (s *PostgRESTSearcher) call(ctx context.Context, function string, args map[string]interface{}, target interface{}) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+function, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to parse %s rows: %w", function, err)
+	}
+	return nil
+}
+
+// Compile-time checks that both searchers satisfy Searcher.
+var (
+	_ Searcher = (*PostgRESTSearcher)(nil)
+	_ Searcher = (*MemorySearcher)(nil)
+)
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Ranking tiers, added to the trigram similarity (0 to 1) so a better tier always wins.
+// search_artists in schema.sql uses the same formula.
+const (
+	scoreExact      = 3 // The whole name
+	scorePrefix     = 2 // The start of the name
+	scoreWordPrefix = 1 // The start of a later word ("simone" in "nina simone")
+)
+
+// minSimilarity is the trigram similarity from which a name matches without containing the
+// query (pg_trgm's default similarity threshold).
+const minSimilarity = 0.3
+
+// Rank scores how well name matches a normalized query; 0 means no match.
+func Rank(query, name string) float64 {
+	name = strings.ToLower(name)
+	similarity := Similarity(query, name)
+
+	switch {
+	case name == query:
+		return scoreExact + similarity
+	case strings.HasPrefix(name, query):
+		return scorePrefix + similarity
+	case strings.Contains(name, " "+query):
+		return scoreWordPrefix + similarity
+	case strings.Contains(name, query) || similarity >= minSimilarity:
+		return similarity
+	}
+	return 0
+}
+
+// Similarity is the trigram similarity of two strings, as computed by pg_trgm: the share of
+// trigrams they have in common, where each word is padded with two spaces in front and one
+// behind.
+func Similarity(a, b string) float64 {
+	trigramsA, trigramsB := trigrams(a), trigrams(b)
+	if len(trigramsA) == 0 || len(trigramsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range trigramsA {
+		if trigramsB[trigram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(trigramsA)+len(trigramsB)-shared)
+}
+
+// trigrams returns the set of trigrams of the words in s.
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !isWordRune(r) }) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// isWordRune reports whether r is part of a word (pg_trgm ignores everything else).
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,58 @@
+-- Artist search (GET /api/search, GET /api/search/suggest). Run this in the Supabase SQL editor
+-- after internal/resource/schema.sql.
+
+create extension if not exists pg_trgm;
+
+-- Trigram index for fuzzy matches and substring LIKE; text_pattern_ops for prefix LIKE.
+create index if not exists artists_name_trgm_idx on artists using gin (lower(name) gin_trgm_ops) where deleted_at is null;
+create index if not exists artists_name_prefix_idx on artists (tenant_id, lower(name) text_pattern_ops) where deleted_at is null;
+
+-- Ranked search. The score is the match tier (3 exact, 2 name prefix, 1 word prefix, 0 other)
+-- plus the trigram similarity, like Rank in rank.go. p_query is already lowercased.
+create or replace function search_artists(p_tenant text, p_query text, p_limit integer, p_offset integer)
+returns table (id text, name text, score double precision)
+language sql
+stable
+as $$
+    with q as (
+        -- The query as a LIKE pattern, with LIKE's wildcards escaped
+        select p_query as text,
+               replace(replace(replace(p_query, '\', '\\'), '%', '\%'), '_', '\_') as pattern
+    )
+    select a.id::text,
+           a.name,
+           (case
+                when lower(a.name) = q.text then 3
+                when lower(a.name) like q.pattern || '%' then 2
+                when lower(a.name) like '% ' || q.pattern || '%' then 1
+                else 0
+            end + similarity(lower(a.name), q.text))::double precision as score
+    from artists a, q
+    where a.tenant_id = p_tenant
+      and a.deleted_at is null
+      and (lower(a.name) like '%' || q.pattern || '%' or lower(a.name) % q.text)
+    order by score desc, a.name, a.id
+    limit p_limit offset p_offset;
+$$;
+
+-- Typeahead: names, or words of names, starting with the prefix; shortest first.
+create or replace function suggest_artists(p_tenant text, p_prefix text, p_limit integer)
+returns table (id text, name text)
+language sql
+stable
+as $$
+    with q as (
+        select replace(replace(replace(p_prefix, '\', '\\'), '%', '\%'), '_', '\_') as pattern
+    )
+    select a.id::text, a.name
+    from artists a, q
+    where a.tenant_id = p_tenant
+      and a.deleted_at is null
+      and (lower(a.name) like q.pattern || '%' or lower(a.name) like '% ' || q.pattern || '%')
+    order by length(a.name), a.name, a.id
+    limit p_limit;
+$$;
+
+-- Only the backend (service role) calls these; it scopes them to the caller's tenant.
+revoke execute on function search_artists(text, text, integer, integer) from public, anon, authenticated;
+revoke execute on function suggest_artists(text, text, integer) from public, anon, authenticated;
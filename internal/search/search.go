@@ -0,0 +1,310 @@
+package search
+
+// Package search provides full-text search over artists (GET /api/search) and a lighter
+// prefix lookup for typeahead (GET /api/search/suggest).
+//
+// With Postgres configured, both run as SQL functions (see schema.sql) using pg_trgm, so
+// misspelled queries still match ("nina simon" finds "Nina Simone"). Without it, the same ranking
+// (see Rank) is applied in memory to the artists of the resource store.
+//
+// Results for queries asked more than once (SEARCH_CACHE_MIN_HITS) are cached in the tenant's
+// cache for SEARCH_CACHE_TTL, so popular queries don't reach the database. Any write to the
+// artists resource moves the tenant to a new cache generation, invalidating every cached result.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/resource"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+)
+
+// Limits.
+const (
+	DefaultLimit        = 20
+	MaxLimit            = 50
+	DefaultSuggestLimit = 8
+	MaxSuggestLimit     = 20
+	MaxQueryLength      = 100 // Characters
+)
+
+// Result is one search hit, best first.
+type Result struct {
+	Type  string  `json:"type"` // Always "artist" for now
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"` // Higher is better; see Rank
+}
+
+// Suggestion is one typeahead completion.
+type Suggestion struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Searcher runs queries. Queries are already normalized (see Normalize).
+type Searcher interface {
+	// Search returns the artists of the tenant matching query, best first.
+	Search(ctx context.Context, tenantID, query string, limit, offset int) ([]Result, error)
+
+	// Suggest returns artists of the tenant whose name, or a word of it, starts with prefix.
+	Suggest(ctx context.Context, tenantID, prefix string, limit int) ([]Suggestion, error)
+}
+
+var (
+	// DefaultSearcher is the searcher used by the package functions.
+	// It is nil until Init() or SetDefault() is called.
+	DefaultSearcher Searcher
+
+	// ErrNotConfigured is returned when the searcher is not initialized.
+	ErrNotConfigured = errors.New("search not initialized")
+
+	// ErrEmptyQuery is returned for queries without any letters or digits.
+	ErrEmptyQuery = errors.New("query is empty")
+
+	// ErrQueryTooLong is returned for queries over MaxQueryLength characters.
+	ErrQueryTooLong = fmt.Errorf("query must be at most %d characters", MaxQueryLength)
+
+	// popular counts how often each query was asked on this instance.
+	popular = newCounter(10000)
+)
+
+// init invalidates cached results on every write to artists, whichever store is in use.
+func init() {
+	resource.OnChange(func(r *resource.Resource, owner resource.Owner) {
+		if r == resource.Artists {
+			Invalidate(owner.TenantID)
+		}
+	})
+}
+
+// Init initializes the default searcher.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, queries run in Postgres (see schema.sql).
+// Otherwise they run in memory over the resource store. Call it after resource.Init().
+func Init() {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if supabaseURL == "" || serviceKey == "" {
+		log.Println("WARNING: SUPABASE_SERVICE_ROLE_KEY not set, search runs in memory")
+		startup.Report("search", true, "in memory over the resource store (SUPABASE_SERVICE_ROLE_KEY not set)")
+		DefaultSearcher = NewMemorySearcher()
+		return
+	}
+
+	DefaultSearcher = NewPostgRESTSearcher(supabaseURL, serviceKey)
+	log.Println("Search initialized (Supabase Postgres, pg_trgm)")
+	startup.Report("search", true, fmt.Sprintf("Supabase Postgres (pg_trgm), cache TTL %s after %d hits",
+		getCacheTTL(), getCacheMinHits()))
+}
+
+// SetDefault replaces the default searcher. Mainly useful in tests.
+func SetDefault(searcher Searcher) {
+	DefaultSearcher = searcher
+}
+
+// Search returns a page of artists matching query, best first, and whether there is another
+// page. Popular queries are served from the cache.
+func Search(ctx context.Context, tenantID, query string, page, limit int) (results []Result, hasMore bool, err error) {
+	if DefaultSearcher == nil {
+		return nil, false, ErrNotConfigured
+	}
+	query, err = Normalize(query)
+	if err != nil {
+		return nil, false, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > MaxLimit {
+		limit = DefaultLimit
+	}
+
+	// Step 1: Try the cache
+	var cached cachedPage
+	key := "q:" + strconv.Itoa(page) + ":" + strconv.Itoa(limit) + ":" + query
+	if load(tenantID, key, &cached) {
+		return cached.Results, cached.HasMore, nil
+	}
+
+	// Step 2: Ask for one extra result to know whether there is another page
+	results, err = DefaultSearcher.Search(ctx, tenantID, query, limit+1, (page-1)*limit)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search: %w", err)
+	}
+	if hasMore = len(results) > limit; hasMore {
+		results = results[:limit]
+	}
+
+	// Step 3: Cache it if the query is popular
+	store(tenantID, key, cachedPage{Results: results, HasMore: hasMore})
+	return results, hasMore, nil
+}
+
+// cachedPage is a cached page of search results.
+type cachedPage struct {
+	Results []Result `json:"results"`
+	HasMore bool     `json:"has_more"`
+}
+
+// Suggest returns up to limit artists whose name, or a word of it, starts with prefix, shortest
+// names first. Popular prefixes are served from the cache.
+func Suggest(ctx context.Context, tenantID, prefix string, limit int) ([]Suggestion, error) {
+	if DefaultSearcher == nil {
+		return nil, ErrNotConfigured
+	}
+	prefix, err := Normalize(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > MaxSuggestLimit {
+		limit = DefaultSuggestLimit
+	}
+
+	var suggestions []Suggestion
+	key := "suggest:" + strconv.Itoa(limit) + ":" + prefix
+	if load(tenantID, key, &suggestions) {
+		return suggestions, nil
+	}
+
+	suggestions, err = DefaultSearcher.Suggest(ctx, tenantID, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest: %w", err)
+	}
+	store(tenantID, key, suggestions)
+	return suggestions, nil
+}
+
+// Invalidate drops every cached result of the tenant by moving it to a new cache generation.
+// It is called on every write to artists; old entries expire with their TTL.
+func Invalidate(tenantID string) {
+	cacheStore := tenant.CacheFor(tenantID)
+	if cacheStore == nil {
+		return
+	}
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := cacheStore.Set(generationKey, generation, generationTTL); err != nil {
+		log.Printf("WARNING: Failed to invalidate cached search results: %v", err)
+	}
+}
+
+// Normalize lowercases a query and collapses whitespace. It returns ErrEmptyQuery for queries
+// without letters or digits and ErrQueryTooLong past MaxQueryLength.
+func Normalize(query string) (string, error) {
+	query = strings.ToLower(strings.Join(strings.Fields(query), " "))
+	if utf8.RuneCountInString(query) > MaxQueryLength {
+		return "", ErrQueryTooLong
+	}
+	if strings.IndexFunc(query, isWordRune) < 0 {
+		return "", ErrEmptyQuery
+	}
+	return query, nil
+}
+
+// generationKey holds the tenant's current cache generation (part of every result key).
+const generationKey = "search:generation"
+
+// generationTTL outlives any cached result by far; if it expires anyway, the tenant falls back
+// to the initial generation, whose entries have long expired.
+const generationTTL = 30 * 24 * time.Hour
+
+// load reads a cached value of the tenant's current generation into target.
+func load(tenantID, key string, target interface{}) bool {
+	cacheStore := tenant.CacheFor(tenantID)
+	if cacheStore == nil {
+		return false
+	}
+	cached, err := cacheStore.Get(resultKey(cacheStore, key))
+	if err != nil || cached == "" {
+		return false
+	}
+	return json.Unmarshal([]byte(cached), target) == nil
+}
+
+// store caches a value under the tenant's current generation, once the key has been asked for
+// SEARCH_CACHE_MIN_HITS times on this instance.
+func store(tenantID, key string, value interface{}) {
+	cacheStore := tenant.CacheFor(tenantID)
+	if cacheStore == nil || popular.hit(tenantID+"|"+key) < getCacheMinHits() {
+		return
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if err := cacheStore.Set(resultKey(cacheStore, key), string(encoded), getCacheTTL()); err != nil {
+		log.Printf("WARNING: Failed to cache search results: %v", err)
+	}
+}
+
+// resultKey is the cache key of a result in the current generation.
+func resultKey(cacheStore cache.Store, key string) string {
+	generation, err := cacheStore.Get(generationKey)
+	if err != nil || generation == "" {
+		generation = "0"
+	}
+	return "search:" + generation + ":" + key
+}
+
+// counter counts keys, forgetting them all once it holds max keys so it stays bounded.
+type counter struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int
+}
+
+func newCounter(max int) *counter {
+	return &counter{max: max, counts: make(map[string]int)}
+}
+
+// hit increments the count of key and returns it.
+func (c *counter) hit(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.counts) >= c.max {
+		c.counts = make(map[string]int)
+	}
+	c.counts[key]++
+	return c.counts[key]
+}
+
+// getCacheTTL returns SEARCH_CACHE_TTL, defaulting to 5 minutes if unset or invalid.
+func getCacheTTL() time.Duration {
+	value := os.Getenv("SEARCH_CACHE_TTL")
+	if value == "" {
+		return 5 * time.Minute
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("WARNING: Invalid SEARCH_CACHE_TTL %q, using 5m", value)
+		return 5 * time.Minute
+	}
+	return parsed
+}
+
+// getCacheMinHits returns SEARCH_CACHE_MIN_HITS (how many times a query is asked before its
+// results are cached), defaulting to 2 if unset or invalid. 1 caches every query.
+func getCacheMinHits() int {
+	value := os.Getenv("SEARCH_CACHE_MIN_HITS")
+	if value == "" {
+		return 2
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		log.Printf("WARNING: Invalid SEARCH_CACHE_MIN_HITS %q, using 2", value)
+		return 2
+	}
+	return parsed
+}
@@ -0,0 +1,147 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/resource"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTest swaps in memory stores with a few artists and returns the cache.
+func setupTest(t *testing.T, names ...string) *cache.MemoryStore {
+	t.Helper()
+
+	originalSearcher, originalStore, originalCache := DefaultSearcher, resource.DefaultStore, cache.GetClient()
+	t.Cleanup(func() {
+		SetDefault(originalSearcher)
+		resource.SetDefault(originalStore)
+		cache.SetDefault(originalCache)
+		popular = newCounter(10000)
+	})
+
+	SetDefault(NewMemorySearcher())
+	resource.SetDefault(resource.NewMemoryStore())
+	cacheStore := cache.NewMemoryStore()
+	cache.SetDefault(cacheStore)
+	popular = newCounter(10000)
+
+	for _, name := range names {
+		_, err := resource.Artists.Create(context.Background(), resource.Owner{}, map[string]interface{}{"name": name})
+		require.NoError(t, err)
+	}
+	return cacheStore
+}
+
+// names returns the names of results, in order.
+func names(results []Result) []string {
+	list := make([]string, len(results))
+	for i, result := range results {
+		list[i] = result.Name
+	}
+	return list
+}
+
+// TestRank tests the ranking tiers and fuzzy matching.
+func TestRank(t *testing.T) {
+	assert.Greater(t, Rank("nina", "Nina"), Rank("nina", "Nina Simone"), "exact beats prefix")
+	assert.Greater(t, Rank("nina", "Nina Simone"), Rank("nina", "The Nina Project"), "prefix beats word prefix")
+	assert.Greater(t, Rank("nina", "The Nina Project"), Rank("nina", "Anina"), "word prefix beats substring")
+	assert.Greater(t, Rank("nina simon", "Nina Simone"), 0.0, "misspelling still matches")
+	assert.Equal(t, 0.0, Rank("nina", "Miles Davis"))
+}
+
+// TestSimilarity tests the pg_trgm-compatible similarity.
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("word", "WORD"))
+	assert.Equal(t, 0.0, Similarity("abc", "xyz"))
+	// pg_trgm: similarity('word', 'two words') = 0.363636
+	assert.InDelta(t, 0.3636, Similarity("word", "two words"), 0.001)
+}
+
+// TestNormalize tests whitespace, case and the length and content checks.
+func TestNormalize(t *testing.T) {
+	query, err := Normalize("  Nina   SIMONE ")
+	require.NoError(t, err)
+	assert.Equal(t, "nina simone", query)
+
+	_, err = Normalize(" %% ")
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+	_, err = Normalize(strings.Repeat("a", MaxQueryLength+1))
+	assert.ErrorIs(t, err, ErrQueryTooLong)
+}
+
+// TestSearch tests ranking order, pagination and that deleted artists are not found.
+func TestSearch(t *testing.T) {
+	setupTest(t, "Nina Simone", "Nina", "The Nina Project", "Miles Davis", "Ninja Sex Party")
+	ctx := context.Background()
+
+	results, hasMore, err := Search(ctx, "", "Nina", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Nina", "Nina Simone"}, names(results))
+	assert.True(t, hasMore)
+
+	results, _, err = Search(ctx, "", "nina", 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "The Nina Project", results[0].Name)
+
+	// Deleted artists disappear
+	all, _, err := resource.Artists.List(ctx, resource.Owner{}, false, 1, 50)
+	require.NoError(t, err)
+	for _, artist := range all {
+		if artist["name"] == "Nina" {
+			_, err = resource.Artists.Delete(ctx, resource.Owner{}, artist.ID())
+			require.NoError(t, err)
+		}
+	}
+	results, _, err = Search(ctx, "", "nina", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Nina Simone", results[0].Name)
+}
+
+// TestSuggest tests name and word prefixes, shortest first.
+func TestSuggest(t *testing.T) {
+	setupTest(t, "Nina Simone", "Nina", "The Nina Project", "Anina")
+
+	suggestions, err := Suggest(context.Background(), "", "nin", 10)
+	require.NoError(t, err)
+	list := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		list[i] = suggestion.Name
+	}
+	assert.Equal(t, []string{"Nina", "Nina Simone", "The Nina Project"}, list)
+}
+
+// TestSearch_CachesPopularQueries tests that a query is cached from its second request and
+// that a write to artists invalidates it.
+func TestSearch_CachesPopularQueries(t *testing.T) {
+	t.Setenv("SEARCH_CACHE_MIN_HITS", "2")
+	setupTest(t, "Nina Simone")
+	ctx := context.Background()
+
+	// First request: not cached yet
+	_, _, err := Search(ctx, "", "nina", 1, 20)
+	require.NoError(t, err)
+
+	// Second request: cached; a row written behind the resource's back is not seen
+	results, _, err := Search(ctx, "", "nina", 1, 20)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, resource.DefaultStore.Insert(ctx, resource.Artists.Table, resource.Record{
+		resource.ColumnID: "behind", resource.ColumnTenantID: "", "name": "Nina Hagen", resource.ColumnVersion: 1,
+	}))
+	results, _, err = Search(ctx, "", "nina", 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	// A write through the resource invalidates the tenant's cached results
+	_, err = resource.Artists.Create(ctx, resource.Owner{}, map[string]interface{}{"name": "Nina Persson"})
+	require.NoError(t, err)
+	results, _, err = Search(ctx, "", "nina", 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
+}
@@ -0,0 +1,40 @@
+package seo
+
+import (
+	"errors"
+	"log"
+
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RobotsHandler serves /robots.txt.
+func RobotsHandler(c *fiber.Ctx) error {
+	if DefaultSitemaps == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+	}
+	c.Set(fiber.HeaderContentType, "text/plain; charset=utf-8")
+	return c.SendString(DefaultSitemaps.Robots(tenant.ID(c)))
+}
+
+// SitemapHandler serves /sitemap.xml: 404 without SITE_URL, 503 if it can't be generated.
+func SitemapHandler(c *fiber.Ctx) error {
+	if DefaultSitemaps == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sitemap is not configured"})
+	}
+
+	sitemap, err := DefaultSitemaps.Sitemap(c.UserContext(), tenant.ID(c))
+	if errors.Is(err, ErrNoSiteURL) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Sitemap is not configured"})
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to generate sitemap: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Sitemap is unavailable",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Send(sitemap)
+}
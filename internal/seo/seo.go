@@ -0,0 +1,348 @@
+package seo
+
+// Package seo serves /robots.txt and /sitemap.xml for deployments where the backend also fronts a
+// public marketing or SEO site (see internal/frontend).
+//
+// The sitemap lists the static pages in SITEMAP_PATHS plus one page per artist
+// (SITEMAP_ARTIST_PATH, e.g. /artists/{id}), read from the resource store. Generating it reads
+// every artist, so each tenant's sitemap is kept in memory and regenerated every SITEMAP_INTERVAL
+// by RunGenerator rather than on every request. URLs are built from SITE_URL, never from the
+// request's Host header, so a forged host can't end up in a cached sitemap.
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/resource"
+	"boilerplate/internal/startup"
+)
+
+// MaxURLs is the most URLs a sitemap may list (the sitemaps.org limit). Extra artists are left
+// out with a warning.
+const MaxURLs = 50000
+
+// maxSites bounds how many tenants' sitemaps are kept in memory.
+const maxSites = 1000
+
+// Config configures robots.txt and the sitemap.
+type Config struct {
+	// SiteURL is the public site's base URL, e.g. https://example.com. "{tenant}" is replaced
+	// with the request's tenant (https://{tenant}.example.com). Empty disables the sitemap.
+	SiteURL string
+
+	StaticPaths []string // Pages always listed, e.g. "/", "/pricing"
+	ArtistPath  string   // Page of one artist, "{id}" replaced with its ID; empty lists no artists
+	Disallow    []string // Paths crawlers are asked to skip
+	NoIndex     bool     // Ask crawlers to skip everything (staging deployments)
+	Interval    time.Duration
+}
+
+// Sitemaps generates and caches sitemaps.
+type Sitemaps struct {
+	config Config
+
+	mu    sync.Mutex
+	sites map[string]*site // By tenant ID
+}
+
+// site is the cached sitemap of one tenant.
+type site struct {
+	xml         []byte
+	generatedAt time.Time
+}
+
+var (
+	// DefaultSitemaps is the instance used by the handlers.
+	// It is nil until Init() or SetDefault() is called.
+	DefaultSitemaps *Sitemaps
+
+	// ErrNoSiteURL is returned when no site URL is configured for the tenant.
+	ErrNoSiteURL = errors.New("SITE_URL not set")
+
+	// now is replaced in tests.
+	now = time.Now
+)
+
+// New creates sitemaps with the given configuration.
+func New(config Config) *Sitemaps {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	config.SiteURL = strings.TrimSuffix(config.SiteURL, "/")
+	return &Sitemaps{config: config, sites: make(map[string]*site)}
+}
+
+// Init configures the default instance from the environment:
+//   - SITE_URL: public base URL (may contain {tenant}); without it only robots.txt is served
+//   - SITEMAP_PATHS: comma-separated static pages (default "/")
+//   - SITEMAP_ARTIST_PATH: artist page (default "/artists/{id}"; "none" lists no artists)
+//   - SITEMAP_INTERVAL: how often sitemaps are regenerated (default 1h)
+//   - ROBOTS_DISALLOW: comma-separated paths crawlers should skip (default the API paths)
+//   - ROBOTS_NOINDEX: "true" asks crawlers to skip the whole site
+func Init() {
+	config := Config{
+		SiteURL:     os.Getenv("SITE_URL"),
+		StaticPaths: getList("SITEMAP_PATHS", "/"),
+		ArtistPath:  os.Getenv("SITEMAP_ARTIST_PATH"),
+		Disallow:    getList("ROBOTS_DISALLOW", "/api/,/graphql,/ws,/docs,/openapi.json,/metrics,/exports/"),
+		NoIndex:     os.Getenv("ROBOTS_NOINDEX") == "true",
+		Interval:    getInterval(),
+	}
+	switch config.ArtistPath {
+	case "":
+		config.ArtistPath = "/artists/{id}"
+	case "none":
+		config.ArtistPath = ""
+	}
+	DefaultSitemaps = New(config)
+
+	switch {
+	case config.NoIndex:
+		startup.Report("seo", true, "ROBOTS_NOINDEX: crawlers asked to skip the site")
+	case config.SiteURL == "":
+		startup.Report("seo", false, "SITE_URL not set, /sitemap.xml disabled")
+	default:
+		log.Printf("SEO initialized (%s, sitemaps regenerated every %s)", config.SiteURL, config.Interval)
+		startup.Report("seo", true, fmt.Sprintf("%s, sitemaps regenerated every %s", config.SiteURL, config.Interval))
+	}
+}
+
+// SetDefault replaces the default instance. Mainly useful in tests.
+func SetDefault(sitemaps *Sitemaps) {
+	DefaultSitemaps = sitemaps
+}
+
+// Robots returns robots.txt for the tenant.
+func (s *Sitemaps) Robots(tenantID string) string {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if s.config.NoIndex {
+		b.WriteString("Disallow: /\n")
+		return b.String()
+	}
+
+	if len(s.config.Disallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, path := range s.config.Disallow {
+		b.WriteString("Disallow: " + path + "\n")
+	}
+	if base, err := s.baseURL(tenantID); err == nil {
+		b.WriteString("\nSitemap: " + base + "/sitemap.xml\n")
+	}
+	return b.String()
+}
+
+// Sitemap returns the tenant's sitemap, generating it if it is missing or older than the
+// interval. If regenerating fails, the previous sitemap is served.
+func (s *Sitemaps) Sitemap(ctx context.Context, tenantID string) ([]byte, error) {
+	if s.config.NoIndex {
+		return nil, ErrNoSiteURL
+	}
+
+	s.mu.Lock()
+	cached := s.sites[tenantID]
+	s.mu.Unlock()
+	if cached != nil && now().Sub(cached.generatedAt) < s.config.Interval {
+		return cached.xml, nil
+	}
+
+	generated, err := s.refresh(ctx, tenantID)
+	if err != nil {
+		if cached != nil && !errors.Is(err, ErrNoSiteURL) {
+			log.Printf("WARNING: Failed to regenerate sitemap, serving the previous one: %v", err)
+			return cached.xml, nil
+		}
+		return nil, err
+	}
+	return generated, nil
+}
+
+// Refresh regenerates the sitemap of every tenant that has been requested, so requests rarely
+// wait for one. Failures are logged and the previous sitemap is kept.
+func (s *Sitemaps) Refresh(ctx context.Context) {
+	s.mu.Lock()
+	tenants := make([]string, 0, len(s.sites))
+	for tenantID := range s.sites {
+		tenants = append(tenants, tenantID)
+	}
+	s.mu.Unlock()
+
+	for _, tenantID := range tenants {
+		if _, err := s.refresh(ctx, tenantID); err != nil {
+			log.Printf("ERROR: Failed to regenerate sitemap for tenant %q: %v", tenantID, err)
+		}
+	}
+}
+
+// RunGenerator regenerates the default instance's sitemaps every SITEMAP_INTERVAL. Call it in a
+// goroutine after Init(); it runs until ctx is cancelled.
+func RunGenerator(ctx context.Context) {
+	if DefaultSitemaps == nil || DefaultSitemaps.config.SiteURL == "" {
+		return
+	}
+
+	ticker := time.NewTicker(DefaultSitemaps.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			DefaultSitemaps.Refresh(ctx)
+		}
+	}
+}
+
+// refresh generates the tenant's sitemap and caches it.
+func (s *Sitemaps) refresh(ctx context.Context, tenantID string) ([]byte, error) {
+	generated, err := s.generate(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, known := s.sites[tenantID]; !known && len(s.sites) >= maxSites {
+		// Forget every tenant rather than grow without bound; they are regenerated on demand
+		s.sites = make(map[string]*site)
+	}
+	s.sites[tenantID] = &site{xml: generated, generatedAt: now()}
+	return generated, nil
+}
+
+// urlSet is the <urlset> root of a sitemap.
+type urlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapURL is one <url> entry.
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// generate builds the tenant's sitemap: the static pages, then every live artist.
+func (s *Sitemaps) generate(ctx context.Context, tenantID string) ([]byte, error) {
+	base, err := s.baseURL(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Static pages
+	set := urlSet{}
+	for _, path := range s.config.StaticPaths {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + path})
+	}
+
+	// Step 2: Artist pages, a page of artists at a time
+	if s.config.ArtistPath != "" {
+		if resource.DefaultStore == nil {
+			return nil, resource.ErrNotConfigured
+		}
+		const pageSize = 1000
+		for offset := 0; ; offset += pageSize {
+			artists, err := resource.DefaultStore.List(ctx, resource.Artists.Table, resource.Filter{
+				TenantID: tenantID,
+				Limit:    pageSize,
+				Offset:   offset,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list artists: %w", err)
+			}
+			for _, artist := range artists {
+				if len(set.URLs) >= MaxURLs {
+					log.Printf("WARNING: Sitemap for tenant %q truncated to %d URLs", tenantID, MaxURLs)
+					return encode(set)
+				}
+				set.URLs = append(set.URLs, sitemapURL{
+					Loc:     base + strings.ReplaceAll(s.config.ArtistPath, "{id}", url.PathEscape(artist.ID())),
+					LastMod: lastMod(artist),
+				})
+			}
+			if len(artists) < pageSize {
+				break
+			}
+		}
+	}
+
+	return encode(set)
+}
+
+// encode renders a sitemap as XML.
+func encode(set urlSet) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(set); err != nil {
+		return nil, fmt.Errorf("failed to encode sitemap: %w", err)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// baseURL returns the site URL of the tenant.
+func (s *Sitemaps) baseURL(tenantID string) (string, error) {
+	base := s.config.SiteURL
+	if base == "" {
+		return "", ErrNoSiteURL
+	}
+	if strings.Contains(base, "{tenant}") {
+		if tenantID == "" {
+			return "", ErrNoSiteURL
+		}
+		base = strings.ReplaceAll(base, "{tenant}", tenantID)
+	}
+	return base, nil
+}
+
+// lastMod returns the date an artist was last updated, or "" if unknown.
+func lastMod(artist resource.Record) string {
+	updated, _ := artist[resource.ColumnUpdatedAt].(string)
+	parsed, err := time.Parse(time.RFC3339Nano, updated)
+	if err != nil {
+		return ""
+	}
+	return parsed.UTC().Format("2006-01-02")
+}
+
+// getList reads a comma-separated list from the environment.
+func getList(name, fallback string) []string {
+	value, set := os.LookupEnv(name)
+	if !set {
+		value = fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getInterval returns SITEMAP_INTERVAL, defaulting to 1 hour if unset or invalid.
+func getInterval() time.Duration {
+	value := os.Getenv("SITEMAP_INTERVAL")
+	if value == "" {
+		return time.Hour
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("WARNING: Invalid SITEMAP_INTERVAL %q, using 1h", value)
+		return time.Hour
+	}
+	return parsed
+}
@@ -0,0 +1,117 @@
+package seo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/resource"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupArtists swaps in a memory resource store holding the given artists of tenant "".
+func setupArtists(t *testing.T, names ...string) []string {
+	t.Helper()
+
+	original := resource.DefaultStore
+	resource.SetDefault(resource.NewMemoryStore())
+	t.Cleanup(func() { resource.SetDefault(original) })
+
+	ids := make([]string, len(names))
+	for i, name := range names {
+		artist, err := resource.Artists.Create(context.Background(), resource.Owner{}, map[string]interface{}{"name": name})
+		require.NoError(t, err)
+		ids[i] = artist.ID()
+	}
+	return ids
+}
+
+// TestRobots tests the disallowed paths, the sitemap line and noindex.
+func TestRobots(t *testing.T) {
+	s := New(Config{SiteURL: "https://example.com/", Disallow: []string{"/api/"}})
+	assert.Equal(t, "User-agent: *\nDisallow: /api/\n\nSitemap: https://example.com/sitemap.xml\n", s.Robots(""))
+
+	// No site URL: no sitemap line; nothing disallowed: an empty Disallow allows everything
+	s = New(Config{})
+	assert.Equal(t, "User-agent: *\nDisallow:\n", s.Robots(""))
+
+	s = New(Config{SiteURL: "https://example.com", NoIndex: true, Disallow: []string{"/api/"}})
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", s.Robots(""))
+
+	// Tenant sites
+	s = New(Config{SiteURL: "https://{tenant}.example.com"})
+	assert.Contains(t, s.Robots("acme"), "Sitemap: https://acme.example.com/sitemap.xml")
+	assert.NotContains(t, s.Robots(""), "Sitemap:")
+}
+
+// TestSitemap tests static pages, artist pages and that deleted artists are left out.
+func TestSitemap(t *testing.T) {
+	ids := setupArtists(t, "Nina Simone", "Miles Davis")
+	_, err := resource.Artists.Delete(context.Background(), resource.Owner{}, ids[1])
+	require.NoError(t, err)
+
+	s := New(Config{SiteURL: "https://example.com", StaticPaths: []string{"/", "/pricing"}, ArtistPath: "/artists/{id}"})
+	sitemap, err := s.Sitemap(context.Background(), "")
+	require.NoError(t, err)
+
+	xml := string(sitemap)
+	assert.True(t, strings.HasPrefix(xml, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, xml, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	assert.Contains(t, xml, "<loc>https://example.com/</loc>")
+	assert.Contains(t, xml, "<loc>https://example.com/pricing</loc>")
+	assert.Contains(t, xml, "<loc>https://example.com/artists/"+ids[0]+"</loc>")
+	assert.Contains(t, xml, "<lastmod>"+time.Now().UTC().Format("2006-01-02")+"</lastmod>")
+	assert.NotContains(t, xml, ids[1])
+
+	// Without a site URL (or a tenant for a tenant URL) there is no sitemap
+	_, err = New(Config{}).Sitemap(context.Background(), "")
+	assert.ErrorIs(t, err, ErrNoSiteURL)
+	_, err = New(Config{SiteURL: "https://{tenant}.example.com"}).Sitemap(context.Background(), "")
+	assert.ErrorIs(t, err, ErrNoSiteURL)
+}
+
+// TestSitemap_Regeneration tests that sitemaps are cached for the interval, refreshed by Refresh,
+// and that the previous one is served if regenerating fails.
+func TestSitemap_Regeneration(t *testing.T) {
+	setupArtists(t, "Nina Simone")
+	current := time.Now()
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = time.Now })
+
+	s := New(Config{SiteURL: "https://example.com", ArtistPath: "/artists/{id}", Interval: time.Hour})
+	first, err := s.Sitemap(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(first), "<url>"))
+
+	// Cached until the interval passes
+	setupArtists(t, "Nina Simone", "Miles Davis")
+	cached, err := s.Sitemap(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, first, cached)
+
+	// Refresh regenerates the tenants already requested
+	s.Refresh(context.Background())
+	refreshed, err := s.Sitemap(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(refreshed), "<url>"))
+
+	// Past the interval a failing store serves the previous sitemap
+	current = current.Add(2 * time.Hour)
+	resource.SetDefault(failingStore{resource.NewMemoryStore()})
+	stale, err := s.Sitemap(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, refreshed, stale)
+}
+
+// failingStore fails every List.
+type failingStore struct {
+	*resource.MemoryStore
+}
+
+func (failingStore) List(context.Context, string, resource.Filter) ([]resource.Record, error) {
+	return nil, errors.New("database down")
+}
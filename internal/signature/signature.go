@@ -0,0 +1,124 @@
+package signature
+
+// Package signature signs the payloads this server sends out (alert webhooks, data and usage
+// exports) and verifies them, so receivers can tell they come from this server and were not
+// changed or replayed.
+//
+// It follows the Standard Webhooks scheme (https://www.standardwebhooks.com): three headers carry
+// a message ID, a Unix timestamp and the signatures, each "v1," and the base64 HMAC-SHA256 of
+// "<id>.<timestamp>.<body>". Signing with several secrets puts several signatures in the header,
+// separated by spaces: that is how secrets are rotated (sign with the old and the new secret,
+// move receivers to the new one, then drop the old one), and a receiver accepts a payload if any
+// signature matches one of its secrets.
+//
+// This file depends only on the standard library: Go receivers can copy it as is and call
+// Verify. Receivers in other languages can use a Standard Webhooks library.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature headers.
+const (
+	HeaderID        = "Webhook-Id"        // Unique per payload; receivers can use it to drop duplicates
+	HeaderTimestamp = "Webhook-Timestamp" // Unix seconds when the payload was signed
+	HeaderSignature = "Webhook-Signature" // Space-separated "v1,<base64 HMAC-SHA256>" signatures
+)
+
+// DefaultTolerance is how far a payload's timestamp may be from the receiver's clock. Older
+// payloads are rejected, so a captured payload can't be replayed later.
+const DefaultTolerance = 5 * time.Minute
+
+// secretPrefix marks a base64-encoded secret ("whsec_...").
+const secretPrefix = "whsec_"
+
+// Verification errors.
+var (
+	ErrMissingHeaders = errors.New("signature headers missing")
+	ErrTimestamp      = errors.New("signature timestamp invalid or outside the tolerance")
+	ErrNoMatch        = errors.New("no matching signature")
+)
+
+// Secret is a signing key.
+type Secret []byte
+
+// ParseSecret reads a secret: "whsec_" followed by base64, or any other string used as is.
+// Secrets must be at least 16 bytes long.
+func ParseSecret(value string) (Secret, error) {
+	value = strings.TrimSpace(value)
+	secret := []byte(value)
+	if encoded, ok := strings.CutPrefix(value, secretPrefix); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("secret after %q must be base64: %w", secretPrefix, err)
+		}
+		secret = decoded
+	}
+	if len(secret) < 16 {
+		return nil, errors.New("secret must be at least 16 bytes long")
+	}
+	return secret, nil
+}
+
+// Sign returns the signature of a payload with one secret: "v1," and the base64 HMAC-SHA256 of
+// "<id>.<timestamp>.<body>".
+func Sign(secret Secret, id string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + "." + strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Headers returns the signature headers of a payload signed at timestamp with every secret.
+func Headers(id string, timestamp time.Time, body []byte, secrets ...Secret) http.Header {
+	unix := timestamp.Unix()
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		signatures = append(signatures, Sign(secret, id, unix, body))
+	}
+	header := http.Header{}
+	header.Set(HeaderID, id)
+	header.Set(HeaderTimestamp, strconv.FormatInt(unix, 10))
+	header.Set(HeaderSignature, strings.Join(signatures, " "))
+	return header
+}
+
+// Verify checks the signature headers of a payload against the receiver's secrets, with
+// DefaultTolerance for the timestamp. It returns nil if a signature matches any secret.
+func Verify(header http.Header, body []byte, secrets ...Secret) error {
+	return VerifyAt(header, body, time.Now(), DefaultTolerance, secrets...)
+}
+
+// VerifyAt is Verify with the receiver's clock and the timestamp tolerance given.
+func VerifyAt(header http.Header, body []byte, now time.Time, tolerance time.Duration, secrets ...Secret) error {
+	id, timestamp, signatures := header.Get(HeaderID), header.Get(HeaderTimestamp), header.Get(HeaderSignature)
+	if id == "" || timestamp == "" || signatures == "" {
+		return ErrMissingHeaders
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestamp
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrTimestamp
+	}
+
+	for _, secret := range secrets {
+		expected := []byte(Sign(secret, id, unix, body))
+		for _, signature := range strings.Fields(signatures) {
+			if hmac.Equal([]byte(signature), expected) {
+				return nil
+			}
+		}
+	}
+	return ErrNoMatch
+}
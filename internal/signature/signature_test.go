@@ -0,0 +1,94 @@
+package signature
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldSecret = Secret("old-secret-0123456789")
+	newSecret = Secret("new-secret-0123456789")
+)
+
+// TestVerify tests signing and verifying, the timestamp tolerance and rotated secrets.
+func TestVerify(t *testing.T) {
+	signedAt := time.Unix(1_800_000_000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	header := Headers("msg_1", signedAt, body, oldSecret, newSecret)
+	assert.Equal(t, "msg_1", header.Get(HeaderID))
+	assert.Equal(t, "1800000000", header.Get(HeaderTimestamp))
+	assert.Len(t, strings.Fields(header.Get(HeaderSignature)), 2)
+
+	// Receivers on either secret accept it while the secrets rotate
+	assert.NoError(t, VerifyAt(header, body, signedAt, DefaultTolerance, oldSecret))
+	assert.NoError(t, VerifyAt(header, body, signedAt.Add(time.Minute), DefaultTolerance, newSecret))
+	assert.ErrorIs(t, VerifyAt(header, body, signedAt, DefaultTolerance, Secret("other-secret-0123456789")), ErrNoMatch)
+
+	// The body, the ID and the timestamp are all covered
+	assert.ErrorIs(t, VerifyAt(header, []byte(`{"id":"evt_2"}`), signedAt, DefaultTolerance, newSecret), ErrNoMatch)
+	changed := header.Clone()
+	changed.Set(HeaderID, "msg_2")
+	assert.ErrorIs(t, VerifyAt(changed, body, signedAt, DefaultTolerance, newSecret), ErrNoMatch)
+	changed = header.Clone()
+	changed.Set(HeaderTimestamp, "1800000001")
+	assert.ErrorIs(t, VerifyAt(changed, body, signedAt, DefaultTolerance, newSecret), ErrNoMatch)
+
+	assert.ErrorIs(t, VerifyAt(header, body, signedAt.Add(10*time.Minute), DefaultTolerance, newSecret), ErrTimestamp)
+	assert.ErrorIs(t, VerifyAt(http.Header{}, body, signedAt, DefaultTolerance, newSecret), ErrMissingHeaders)
+}
+
+// TestParseSecret tests reading raw and whsec_ secrets.
+func TestParseSecret(t *testing.T) {
+	secret, err := ParseSecret("whsec_" + base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")))
+	require.NoError(t, err)
+	assert.Equal(t, Secret("0123456789abcdef"), secret)
+
+	secret, err = ParseSecret(" raw-secret-0123456789 ")
+	require.NoError(t, err)
+	assert.Equal(t, Secret("raw-secret-0123456789"), secret)
+
+	_, err = ParseSecret("short")
+	assert.Error(t, err)
+	_, err = ParseSecret("whsec_not base64!")
+	assert.Error(t, err)
+}
+
+// TestMiddleware tests that successful responses are signed and errors are not.
+func TestMiddleware(t *testing.T) {
+	Configure(newSecret)
+	defer Configure()
+
+	app := fiber.New()
+	app.Get("/export", Middleware(), func(c *fiber.Ctx) error { return c.SendString("a,b\n1,2\n") })
+	app.Get("/missing", Middleware(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNotFound) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/export", nil))
+	require.NoError(t, err)
+	assert.NoError(t, Verify(resp.Header, []byte("a,b\n1,2\n"), newSecret))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/missing", nil))
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get(HeaderSignature))
+}
+
+// TestSignRequest tests that outgoing requests are signed only when secrets are configured.
+func TestSignRequest(t *testing.T) {
+	body := []byte(`{"text":"alert"}`)
+	req := httptest.NewRequest("POST", "/hook", nil)
+	SignRequest(req, body)
+	assert.Empty(t, req.Header.Get(HeaderSignature))
+
+	Configure(oldSecret)
+	defer Configure()
+	SignRequest(req, body)
+	assert.True(t, strings.HasPrefix(req.Header.Get(HeaderID), "msg_"))
+	assert.NoError(t, Verify(req.Header, body, oldSecret))
+}
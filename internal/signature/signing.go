@@ -0,0 +1,123 @@
+package signature
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/logging"
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The server's own signing: the secrets from SIGNING_SECRETS, applied to outgoing webhook
+// requests (SignRequest) and to responses of routes with Middleware. Unlike signature.go, this
+// file is not meant to be copied.
+
+var (
+	mu      sync.RWMutex
+	secrets []Secret
+)
+
+// now is the signing clock, replaced in tests.
+var now = time.Now
+
+// Init reads SIGNING_SECRETS, a comma-separated list of secrets every payload is signed with
+// (list the new secret next to the old one while rotating). Invalid secrets are logged and leave
+// signing off.
+func Init() {
+	var parsed []Secret
+	for i, value := range strings.Split(os.Getenv("SIGNING_SECRETS"), ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		secret, err := ParseSecret(value)
+		if err != nil {
+			slog.Error("Invalid SIGNING_SECRETS, payloads are not signed", "secret", i+1, "error", err)
+			startup.Report("signing", false, "SIGNING_SECRETS secret "+strconv.Itoa(i+1)+": "+err.Error())
+			Configure()
+			return
+		}
+		parsed = append(parsed, secret)
+	}
+	Configure(parsed...)
+	if len(parsed) == 0 {
+		startup.Report("signing", false, "SIGNING_SECRETS not set, webhooks and exports are not signed")
+		return
+	}
+	startup.Report("signing", true, strconv.Itoa(len(parsed))+" secret(s), webhooks and exports signed")
+}
+
+// Configure sets the signing secrets (none turns signing off). Init calls it from the
+// environment; it is mainly useful in tests.
+func Configure(configured ...Secret) {
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = configured
+}
+
+// Enabled reports whether payloads are signed.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(secrets) > 0
+}
+
+// current returns the signing secrets.
+func current() []Secret {
+	mu.RLock()
+	defer mu.RUnlock()
+	return secrets
+}
+
+// NewID returns a random message ID ("msg_" and 32 hex digits).
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "msg_" + strconv.FormatInt(now().UnixNano(), 16)
+	}
+	return "msg_" + hex.EncodeToString(b)
+}
+
+// SignRequest adds the signature headers for body to an outgoing request. It does nothing when
+// signing is off.
+func SignRequest(req *http.Request, body []byte) {
+	configured := current()
+	if len(configured) == 0 {
+		return
+	}
+	for name, values := range Headers(NewID(), now(), body, configured...) {
+		req.Header[name] = values
+	}
+}
+
+// Middleware signs successful responses of a route, using the request ID as the message ID.
+// Streamed responses can't be signed and are sent unsigned.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		configured := current()
+		status := c.Response().StatusCode()
+		if len(configured) == 0 || status < 200 || status >= 300 || c.Response().IsBodyStream() {
+			return nil
+		}
+
+		id := logging.GetRequestID(c)
+		if id == "" {
+			id = NewID()
+		}
+		for name, values := range Headers(id, now(), c.Response().Body(), configured...) {
+			c.Set(name, values[0])
+		}
+		return nil
+	}
+}
@@ -0,0 +1,419 @@
+package slo
+
+// Package slo tracks service level objectives per route.
+//
+// Routes declare objectives next to their registration, like docs.Register:
+//
+//	slo.Register(slo.Objective{Method: "POST", Route: "/graphql", Latency: time.Second, LatencyTarget: 0.99, Availability: 0.999})
+//
+// Middleware() records every request to a declared route in one-minute buckets. Compliance is
+// computed over a short (5m) and a long (1h) rolling window, and the error budget burn rate is
+// published to Prometheus. When both windows burn faster than SLO_BURN_RATE_ALERT (default 14.4,
+// i.e. a 30-day budget gone in about two days) the alert hooks are called: the log always, and
+// a webhook when SLO_ALERT_WEBHOOK_URL is set. Requiring both windows avoids alerting on a short
+// blip (short window only) or on a problem that has already stopped (long window only).
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"boilerplate/internal/events"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Objective kinds, used in alerts and metric labels.
+const (
+	KindLatency      = "latency"
+	KindAvailability = "availability"
+)
+
+const (
+	// bucketSize is the resolution of the rolling windows.
+	bucketSize = time.Minute
+
+	// ShortWindow and LongWindow are the burn rate windows.
+	ShortWindow = 5 * time.Minute
+	LongWindow  = time.Hour
+
+	// evaluateEvery limits how often an objective is evaluated (it happens on the request path).
+	evaluateEvery = 10 * time.Second
+
+	// Defaults for the environment settings.
+	defaultBurnRateAlert = 14.4
+	defaultMinRequests   = 20
+	defaultAlertCooldown = 15 * time.Minute
+)
+
+// Objective is the SLO of one route. Set Latency and LatencyTarget for a latency objective
+// ("99% of requests faster than 500ms"), Availability for an error-rate objective
+// ("99.9% of requests don't fail with a 5xx"), or both.
+type Objective struct {
+	Method        string        `json:"method,omitempty"` // Empty matches every method
+	Route         string        `json:"route"`            // Route pattern as registered, e.g. /api/items/:id
+	Latency       time.Duration `json:"latency,omitempty"`
+	LatencyTarget float64       `json:"latency_target,omitempty"` // Fraction of requests under Latency, e.g. 0.99
+	Availability  float64       `json:"availability,omitempty"`   // Fraction of requests without a 5xx, e.g. 0.999
+}
+
+// name identifies the objective in logs and metric labels, e.g. "POST /graphql".
+func (o Objective) name() string {
+	if o.Method == "" {
+		return o.Route
+	}
+	return o.Method + " " + o.Route
+}
+
+// Alert describes an objective that is burning its error budget too fast.
+type Alert struct {
+	Route           string    `json:"route"`
+	Kind            string    `json:"kind"`   // latency or availability
+	Target          float64   `json:"target"` // e.g. 0.999
+	ShortBurnRate   float64   `json:"short_burn_rate"`
+	LongBurnRate    float64   `json:"long_burn_rate"`
+	ShortCompliance float64   `json:"short_compliance"`
+	LongCompliance  float64   `json:"long_compliance"`
+	Requests        int64     `json:"requests"` // In the long window
+	Time            time.Time `json:"time"`
+}
+
+// Hook is called for every alert. Hooks run in their own goroutine.
+type Hook func(Alert)
+
+// bucket counts one minute of requests.
+type bucket struct {
+	start  time.Time
+	total  int64
+	errors int64 // 5xx responses
+	slow   int64 // Slower than the latency threshold
+}
+
+// tracker holds the rolling buckets for one objective.
+type tracker struct {
+	objective     Objective
+	buckets       []bucket // Ring buffer covering LongWindow
+	lastEvaluated time.Time
+	lastAlerted   map[string]time.Time // By kind
+}
+
+var (
+	mu       sync.Mutex
+	trackers = make(map[string]*tracker) // By "METHOD route" ("" method for any)
+	hooks    []Hook
+
+	// now is the clock (overridable in tests).
+	now = time.Now
+)
+
+// Register declares an objective. Registering the same method and route again replaces it.
+func Register(objective Objective) error {
+	if objective.Route == "" {
+		return fmt.Errorf("slo: route is required")
+	}
+	if objective.Availability == 0 && (objective.Latency == 0 || objective.LatencyTarget == 0) {
+		return fmt.Errorf("slo: %s declares no objective", objective.name())
+	}
+	for _, target := range []float64{objective.Availability, objective.LatencyTarget} {
+		if target < 0 || target >= 1 {
+			return fmt.Errorf("slo: %s targets must be between 0 and 1 (exclusive)", objective.name())
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	trackers[objective.Method+" "+objective.Route] = &tracker{
+		objective:   objective,
+		buckets:     make([]bucket, int(LongWindow/bucketSize)),
+		lastAlerted: make(map[string]time.Time),
+	}
+	return nil
+}
+
+// MustRegister is Register for objectives declared in code; it panics on an invalid objective.
+func MustRegister(objective Objective) {
+	if err := Register(objective); err != nil {
+		panic(err)
+	}
+}
+
+// AddHook adds an alert hook.
+func AddHook(hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// Init installs the alert hooks from the environment: the log hook always, and a webhook
+// when SLO_ALERT_WEBHOOK_URL is set.
+func Init() {
+	AddHook(LogHook)
+	if url := os.Getenv("SLO_ALERT_WEBHOOK_URL"); url != "" {
+		AddHook(WebhookHook(url))
+		startup.Report("slo_alerts", true, "log and webhook")
+		return
+	}
+	startup.Report("slo_alerts", true, "log only (SLO_ALERT_WEBHOOK_URL not set)")
+}
+
+// Reset removes all objectives and hooks. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	trackers = make(map[string]*tracker)
+	hooks = nil
+}
+
+// Middleware records the outcome of every request to a route with an objective.
+// Register it globally; it inspects the status after the rest of the chain has run.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := now()
+		err := c.Next()
+		elapsed := now().Sub(start)
+
+		route := c.Route()
+		if route == nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		Record(c.Method(), route.Path, status, elapsed)
+		return err
+	}
+}
+
+// Record counts one request against the objective for method and route, if there is one.
+func Record(method, route string, status int, elapsed time.Duration) {
+	mu.Lock()
+	t := trackers[method+" "+route]
+	if t == nil {
+		t = trackers[" "+route]
+	}
+	if t == nil {
+		mu.Unlock()
+		return
+	}
+
+	// Step 1: Count the request in the current minute
+	current := now()
+	b := t.bucketFor(current)
+	b.total++
+	if status >= 500 {
+		b.errors++
+	}
+	if t.objective.Latency > 0 && elapsed > t.objective.Latency {
+		b.slow++
+	}
+
+	// Step 2: Re-evaluate the windows every few seconds
+	var alerts []Alert
+	if current.Sub(t.lastEvaluated) >= evaluateEvery {
+		t.lastEvaluated = current
+		alerts = t.evaluate(current)
+	}
+	currentHooks := hooks
+	mu.Unlock()
+
+	// Step 3: Fire hooks outside the lock, and announce the alert to other subsystems
+	for _, alert := range alerts {
+		for _, hook := range currentHooks {
+			go hook(alert)
+		}
+		events.Publish(events.AlertTriggered{
+			Route:    alert.Route,
+			Kind:     alert.Kind,
+			Target:   alert.Target,
+			BurnRate: alert.ShortBurnRate,
+			Time:     alert.Time,
+		})
+	}
+}
+
+// bucketFor returns the bucket for the minute containing at, resetting it if it is stale.
+// Caller holds mu.
+func (t *tracker) bucketFor(at time.Time) *bucket {
+	start := at.Truncate(bucketSize)
+	index := int(start.Unix()/int64(bucketSize/time.Second)) % len(t.buckets)
+	b := &t.buckets[index]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	return b
+}
+
+// window sums the buckets within d of at. Caller holds mu.
+func (t *tracker) window(at time.Time, d time.Duration) (total, errors, slow int64) {
+	oldest := at.Truncate(bucketSize).Add(-d + bucketSize)
+	for _, b := range t.buckets {
+		if !b.start.Before(oldest) && !b.start.After(at) {
+			total += b.total
+			errors += b.errors
+			slow += b.slow
+		}
+	}
+	return total, errors, slow
+}
+
+// evaluate updates the metrics and returns alerts for objectives burning too fast.
+// Caller holds mu.
+func (t *tracker) evaluate(at time.Time) []Alert {
+	shortTotal, shortErrors, shortSlow := t.window(at, ShortWindow)
+	longTotal, longErrors, longSlow := t.window(at, LongWindow)
+
+	threshold := getBurnRateAlert()
+	minRequests := getMinRequests()
+	cooldown := getAlertCooldown()
+
+	type check struct {
+		kind              string
+		target            float64
+		shortBad, longBad int64
+	}
+	checks := make([]check, 0, 2)
+	if t.objective.Availability > 0 {
+		checks = append(checks, check{KindAvailability, t.objective.Availability, shortErrors, longErrors})
+	}
+	if t.objective.Latency > 0 && t.objective.LatencyTarget > 0 {
+		checks = append(checks, check{KindLatency, t.objective.LatencyTarget, shortSlow, longSlow})
+	}
+
+	alerts := make([]Alert, 0)
+	for _, ch := range checks {
+		shortCompliance, shortBurn := compliance(shortTotal, ch.shortBad, ch.target)
+		longCompliance, longBurn := compliance(longTotal, ch.longBad, ch.target)
+
+		name := t.objective.name()
+		metrics.SLOCompliance.WithLabelValues(name, ch.kind, "5m").Set(shortCompliance)
+		metrics.SLOCompliance.WithLabelValues(name, ch.kind, "1h").Set(longCompliance)
+		metrics.SLOBurnRate.WithLabelValues(name, ch.kind, "5m").Set(shortBurn)
+		metrics.SLOBurnRate.WithLabelValues(name, ch.kind, "1h").Set(longBurn)
+
+		if longTotal < minRequests || shortBurn < threshold || longBurn < threshold {
+			continue
+		}
+		if last, ok := t.lastAlerted[ch.kind]; ok && at.Sub(last) < cooldown {
+			continue
+		}
+		t.lastAlerted[ch.kind] = at
+
+		metrics.SLOAlerts.WithLabelValues(name, ch.kind).Inc()
+		alerts = append(alerts, Alert{
+			Route:           name,
+			Kind:            ch.kind,
+			Target:          ch.target,
+			ShortBurnRate:   shortBurn,
+			LongBurnRate:    longBurn,
+			ShortCompliance: shortCompliance,
+			LongCompliance:  longCompliance,
+			Requests:        longTotal,
+			Time:            at.UTC(),
+		})
+	}
+	return alerts
+}
+
+// compliance returns the fraction of good requests and the burn rate: how many times faster
+// than allowed the error budget (1 - target) is being spent. No traffic means full compliance.
+func compliance(total, bad int64, target float64) (float64, float64) {
+	if total == 0 {
+		return 1, 0
+	}
+	badRatio := float64(bad) / float64(total)
+	return 1 - badRatio, badRatio / (1 - target)
+}
+
+// Status is the current compliance of one objective, for the admin endpoint.
+type Status struct {
+	Objective Objective         `json:"objective"`
+	Windows   map[string]Window `json:"windows"` // "5m" and "1h"
+}
+
+// Window is the request counts and compliance over one window.
+type Window struct {
+	Requests               int64   `json:"requests"`
+	Errors                 int64   `json:"errors"`
+	Slow                   int64   `json:"slow"`
+	AvailabilityCompliance float64 `json:"availability_compliance"`
+	LatencyCompliance      float64 `json:"latency_compliance"`
+}
+
+// Snapshot returns the status of every objective, sorted by route.
+func Snapshot() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	at := now()
+	statuses := make([]Status, 0, len(trackers))
+	for _, t := range trackers {
+		status := Status{Objective: t.objective, Windows: make(map[string]Window)}
+		for label, d := range map[string]time.Duration{"5m": ShortWindow, "1h": LongWindow} {
+			total, errors, slow := t.window(at, d)
+			availability, _ := compliance(total, errors, 0)
+			latency, _ := compliance(total, slow, 0)
+			status.Windows[label] = Window{
+				Requests:               total,
+				Errors:                 errors,
+				Slow:                   slow,
+				AvailabilityCompliance: availability,
+				LatencyCompliance:      latency,
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Objective.name() < statuses[j].Objective.name()
+	})
+	return statuses
+}
+
+// getBurnRateAlert returns SLO_BURN_RATE_ALERT, default 14.4.
+func getBurnRateAlert() float64 {
+	if raw := os.Getenv("SLO_BURN_RATE_ALERT"); raw != "" {
+		if parsed, err := strconv.ParseFloat(raw, 64); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return defaultBurnRateAlert
+}
+
+// getMinRequests returns SLO_MIN_REQUESTS: fewer requests in the long window never alert.
+func getMinRequests() int64 {
+	if raw := os.Getenv("SLO_MIN_REQUESTS"); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return defaultMinRequests
+}
+
+// getAlertCooldown returns SLO_ALERT_COOLDOWN: the minimum time between alerts for one objective.
+func getAlertCooldown() time.Duration {
+	if raw := os.Getenv("SLO_ALERT_COOLDOWN"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return defaultAlertCooldown
+}
+
+// LogHook writes alerts to the log.
+func LogHook(alert Alert) {
+	log.Printf("WARNING: SLO burn rate alert: %s %s objective %.2f%% is burning %.1fx (5m) / %.1fx (1h) too fast "+
+		"(compliance %.3f%% over 1h, %d requests)",
+		alert.Route, alert.Kind, alert.Target*100, alert.ShortBurnRate, alert.LongBurnRate,
+		alert.LongCompliance*100, alert.Requests)
+}
@@ -0,0 +1,159 @@
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupClock resets the package state and installs a controllable clock.
+func setupClock(t *testing.T) *time.Time {
+	t.Helper()
+
+	Reset()
+	current := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	t.Cleanup(func() {
+		Reset()
+		now = time.Now
+	})
+	return &current
+}
+
+// collectAlerts installs a hook that sends alerts to a channel.
+func collectAlerts() chan Alert {
+	alerts := make(chan Alert, 10)
+	AddHook(func(alert Alert) { alerts <- alert })
+	return alerts
+}
+
+// TestRegister_Validation tests that objectives must declare a valid target.
+func TestRegister_Validation(t *testing.T) {
+	setupClock(t)
+
+	assert.Error(t, Register(Objective{Route: ""}))
+	assert.Error(t, Register(Objective{Route: "/x"}))
+	assert.Error(t, Register(Objective{Route: "/x", Availability: 1}))
+	assert.Error(t, Register(Objective{Route: "/x", Latency: time.Second}))
+	assert.NoError(t, Register(Objective{Route: "/x", Availability: 0.99}))
+}
+
+// TestRecord_AlertsWhenBothWindowsBurn tests the burn rate alert, the cooldown and the
+// minimum request count.
+func TestRecord_AlertsWhenBothWindowsBurn(t *testing.T) {
+	current := setupClock(t)
+	alerts := collectAlerts()
+	require.NoError(t, Register(Objective{Method: "GET", Route: "/items/:id", Availability: 0.99}))
+
+	// Too few requests to alert, even though all of them fail
+	for i := 0; i < 5; i++ {
+		Record("GET", "/items/:id", 500, time.Millisecond)
+	}
+	assert.Empty(t, alerts)
+
+	// Enough traffic now; the next request after the evaluation interval triggers the check.
+	// 14 errors in 50 requests against a 1% budget is a burn rate of 28 (over the 14.4 default)
+	for i := 0; i < 45; i++ {
+		status := 200
+		if i%5 == 0 {
+			status = 500
+		}
+		Record("GET", "/items/:id", status, time.Millisecond)
+	}
+	*current = current.Add(evaluateEvery)
+	Record("GET", "/items/:id", 500, time.Millisecond)
+
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, "GET /items/:id", alert.Route)
+		assert.Equal(t, KindAvailability, alert.Kind)
+		assert.Equal(t, int64(51), alert.Requests)
+		assert.InDelta(t, 15.0/51/0.01, alert.LongBurnRate, 0.01)
+	case <-time.After(time.Second):
+		t.Fatal("expected an alert")
+	}
+
+	// Still burning, but within the cooldown
+	*current = current.Add(evaluateEvery)
+	Record("GET", "/items/:id", 500, time.Millisecond)
+	select {
+	case <-alerts:
+		t.Fatal("alert repeated within the cooldown")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Other methods don't count toward this objective
+	Record("POST", "/items/:id", 500, time.Millisecond)
+	assert.Equal(t, int64(52), Snapshot()[0].Windows["1h"].Requests)
+}
+
+// TestRecord_LatencyAndWindows tests latency counting and that old buckets leave the windows.
+func TestRecord_LatencyAndWindows(t *testing.T) {
+	current := setupClock(t)
+	require.NoError(t, Register(Objective{Route: "/slow", Latency: 100 * time.Millisecond, LatencyTarget: 0.9}))
+
+	Record("GET", "/slow", 200, 50*time.Millisecond)
+	Record("GET", "/slow", 200, 150*time.Millisecond)
+
+	status := Snapshot()[0]
+	assert.Equal(t, int64(2), status.Windows["5m"].Requests)
+	assert.Equal(t, int64(1), status.Windows["5m"].Slow)
+	assert.InDelta(t, 0.5, status.Windows["5m"].LatencyCompliance, 0.001)
+
+	// After 10 minutes the requests are only in the long window; after 2 hours in neither
+	*current = current.Add(10 * time.Minute)
+	status = Snapshot()[0]
+	assert.Equal(t, int64(0), status.Windows["5m"].Requests)
+	assert.Equal(t, int64(2), status.Windows["1h"].Requests)
+
+	*current = current.Add(2 * time.Hour)
+	assert.Equal(t, int64(0), Snapshot()[0].Windows["1h"].Requests)
+}
+
+// TestMiddleware_RecordsMatchedRoute tests that the middleware counts 5xx responses per route pattern.
+func TestMiddleware_RecordsMatchedRoute(t *testing.T) {
+	setupClock(t)
+	require.NoError(t, Register(Objective{Method: "GET", Route: "/items/:id", Availability: 0.99}))
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/items/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "broken" {
+			return fiber.NewError(fiber.StatusBadGateway, "upstream down")
+		}
+		return c.SendString("ok")
+	})
+
+	for _, id := range []string{"1", "2", "broken"} {
+		_, err := app.Test(httptest.NewRequest("GET", "/items/"+id, nil))
+		require.NoError(t, err)
+	}
+
+	window := Snapshot()[0].Windows["5m"]
+	assert.Equal(t, int64(3), window.Requests)
+	assert.Equal(t, int64(1), window.Errors)
+}
+
+// TestWebhookHook tests that alerts are posted as JSON with a text summary.
+func TestWebhookHook(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	}))
+	defer server.Close()
+
+	WebhookHook(server.URL)(Alert{Route: "POST /graphql", Kind: KindLatency, LongBurnRate: 20.25})
+
+	body := <-received
+	assert.Equal(t, "POST /graphql", body["route"])
+	assert.Equal(t, "latency", body["kind"])
+	assert.Equal(t, "SLO alert: POST /graphql latency error budget is burning 20.2x too fast", body["text"])
+}
@@ -0,0 +1,57 @@
+package slo
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"boilerplate/internal/egress"
+	"boilerplate/internal/signature"
+)
+
+// webhookClient sends alert webhooks.
+var webhookClient = egress.NewClient(10 * time.Second)
+
+// WebhookHook returns a hook that POSTs each alert as JSON to url. The body also has a "text"
+// field, so Slack and similar incoming webhooks display it as a message. Requests carry the
+// signature headers when SIGNING_SECRETS is set (see internal/signature).
+func WebhookHook(url string) Hook {
+	return func(alert Alert) {
+		payload := struct {
+			Alert
+			Text string `json:"text"`
+		}{
+			Alert: alert,
+			Text: "SLO alert: " + alert.Route + " " + alert.Kind + " error budget is burning " +
+				strconv.FormatFloat(alert.LongBurnRate, 'f', 1, 64) + "x too fast",
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("ERROR: Failed to encode SLO alert: %v", err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("ERROR: Failed to create SLO alert webhook request: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		signature.SignRequest(req, body)
+
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			log.Printf("ERROR: Failed to send SLO alert webhook: %v", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			log.Printf("ERROR: SLO alert webhook returned status %d", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package ssr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// MaxBatchSize is the most requests one batch may hold.
+const MaxBatchSize = 20
+
+// forwardedHeaders are copied from the batch request to every request in it (the caller's
+// identity and the API version), along with the SSR header itself.
+var forwardedHeaders = []string{fiber.HeaderAuthorization, fiber.HeaderAccept, fiber.HeaderAcceptLanguage}
+
+// BatchRequest is one request of a batch.
+type BatchRequest struct {
+	ID   string `json:"id"`   // Chosen by the caller to find the response
+	Path string `json:"path"` // GET path with query string, e.g. /api/artists?limit=10
+}
+
+// BatchResponse is the response to one request of a batch.
+type BatchResponse struct {
+	ID     string          `json:"id"`
+	Status int             `json:"status"`
+	ETag   string          `json:"etag,omitempty"`
+	Body   json.RawMessage `json:"body"` // The JSON body, or a JSON string for other bodies
+}
+
+// BatchHandler resolves several GET requests in one round trip for SSR page builds
+// (POST /internal/ssr/batch):
+//
+//	{"requests": [{"id": "me", "path": "/api/profile"}, {"id": "artists", "path": "/api/artists?limit=10"}]}
+//
+// Each request runs through the app like a separate one (auth with the batch's Authorization
+// header, tenant, rate limits, cache headers), concurrently, and the responses come back in
+// order. Only SSR requests may call it, and only with SSR_TOKEN set; paths must be under /api/.
+func BatchHandler(app *fiber.App) fiber.Handler {
+	header, token := getHeader(), os.Getenv("SSR_TOKEN")
+
+	return func(c *fiber.Ctx) error {
+		// Step 1: Only the SSR server, authenticated by its token
+		if token == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "SSR batching is disabled (SSR_TOKEN not set)",
+			})
+		}
+		if !IsSSR(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only the SSR server may batch requests",
+			})
+		}
+
+		// Step 2: Validate the batch
+		var body struct {
+			Requests []BatchRequest `json:"requests"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+		if err := validateBatch(body.Requests); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// Step 3: Run every request through the app
+		headers := map[string]string{header: c.Get(header)}
+		for _, name := range forwardedHeaders {
+			if value := c.Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		handler, host, remoteAddr := app.Handler(), c.Hostname(), c.Context().RemoteAddr()
+		responses := make([]BatchResponse, len(body.Requests))
+		var wg sync.WaitGroup
+		for i, request := range body.Requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				responses[i] = resolve(handler, host, remoteAddr, request, headers)
+			}()
+		}
+		wg.Wait()
+
+		return c.JSON(fiber.Map{"responses": responses})
+	}
+}
+
+// validateBatch checks the size of a batch, its IDs and paths.
+func validateBatch(requests []BatchRequest) error {
+	if len(requests) == 0 {
+		return fmt.Errorf("requests is required")
+	}
+	if len(requests) > MaxBatchSize {
+		return fmt.Errorf("at most %d requests per batch", MaxBatchSize)
+	}
+
+	seen := make(map[string]bool, len(requests))
+	for i, request := range requests {
+		switch {
+		case request.ID == "":
+			return fmt.Errorf("requests[%d]: id is required", i)
+		case seen[request.ID]:
+			return fmt.Errorf("requests[%d]: duplicate id %q", i, request.ID)
+		case !underAPI(request.Path):
+			return fmt.Errorf("requests[%d]: path must start with /api/", i)
+		}
+		seen[request.ID] = true
+	}
+	return nil
+}
+
+// underAPI reports whether a batch path is under /api/, both as written and as the app routes it:
+// fasthttp decodes and normalizes the path once it is set as the request URI, so
+// "/api/%2e%2e/metrics" is really /metrics.
+func underAPI(raw string) bool {
+	if !strings.HasPrefix(path.Clean(strings.SplitN(raw, "?", 2)[0]), "/api/") {
+		return false
+	}
+	var uri fasthttp.URI
+	if err := uri.Parse(nil, []byte(raw)); err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(uri.Path()), "/api/")
+}
+
+// resolve runs one GET request through the app's handler as if it came from the batch's caller.
+func resolve(handler fasthttp.RequestHandler, host string, remoteAddr net.Addr, request BatchRequest, headers map[string]string) BatchResponse {
+	var req fasthttp.Request
+	req.Header.SetMethod(fiber.MethodGet)
+	req.SetRequestURI(request.Path)
+	req.Header.SetHost(host)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, remoteAddr, nil)
+	handler(&ctx)
+
+	response := BatchResponse{
+		ID:     request.ID,
+		Status: ctx.Response.StatusCode(),
+		ETag:   string(ctx.Response.Header.Peek(fiber.HeaderETag)),
+	}
+	body := ctx.Response.Body()
+	if strings.Contains(string(ctx.Response.Header.ContentType()), "json") && json.Valid(body) {
+		response.Body = append(json.RawMessage(nil), body...)
+	} else {
+		response.Body, _ = json.Marshal(string(body))
+	}
+	return response
+}
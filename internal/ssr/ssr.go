@@ -0,0 +1,84 @@
+package ssr
+
+// Package ssr supports server-side rendering frontends (Next.js, Nuxt, SvelteKit, ...) that call
+// the API from their own server while building a page.
+//
+// Requests carrying SSR_HEADER (default X-SSR-Request) are SSR requests; when SSR_TOKEN is set the
+// header's value must be that token, so browsers can't claim to be the SSR server. The SSR
+// server's data cache is shared by all of its visitors, so per-user responses must never end up
+// in it: authenticated SSR responses are sent with "Cache-Control: private, no-store" whatever
+// the route's cache policy, and vary on Authorization. Every response varies on the SSR header,
+// so shared caches keep SSR and browser responses apart.
+//
+// POST /internal/ssr/batch (see BatchHandler) resolves several GET requests in one round trip.
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LocalsKey is the fiber.Ctx Locals key set to true on SSR requests.
+const LocalsKey = "ssr"
+
+// defaultHeader is the request header marking SSR requests when SSR_HEADER is not set.
+const defaultHeader = "X-SSR-Request"
+
+// IsSSR reports whether the request came from the SSR server (see Middleware).
+func IsSSR(c *fiber.Ctx) bool {
+	ssr, _ := c.Locals(LocalsKey).(bool)
+	return ssr
+}
+
+// Middleware recognizes SSR requests and sets their cache headers. Register it globally,
+// before the routes, so it sees the Cache-Control header set by the route's cache policy.
+func Middleware() fiber.Handler {
+	header, token := getHeader(), os.Getenv("SSR_TOKEN")
+
+	return func(c *fiber.Ctx) error {
+		// Responses can differ for the SSR server, even for the same URL
+		c.Vary(header)
+
+		if !recognized(c, header, token) {
+			return c.Next()
+		}
+		c.Locals(LocalsKey, true)
+
+		err := c.Next()
+
+		// Per-user responses: keep them out of the SSR server's shared data cache
+		if c.Get(fiber.HeaderAuthorization) != "" {
+			c.Vary(fiber.HeaderAuthorization)
+			c.Set(fiber.HeaderCacheControl, "private, no-store")
+		}
+		return err
+	}
+}
+
+// recognized reports whether the request carries the SSR header (with the token, if one is set).
+func recognized(c *fiber.Ctx, header, token string) bool {
+	value := c.Get(header)
+	if value == "" {
+		return false
+	}
+	if token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+}
+
+// Header returns the request header marking SSR requests (SSR_HEADER, default X-SSR-Request). It
+// carries SSR_TOKEN, so request captures mask it.
+func Header() string {
+	return getHeader()
+}
+
+// getHeader returns SSR_HEADER, defaulting to X-SSR-Request.
+func getHeader() string {
+	if header := strings.TrimSpace(os.Getenv("SSR_HEADER")); header != "" {
+		return header
+	}
+	return defaultHeader
+}
@@ -0,0 +1,139 @@
+package ssr
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp returns an app with the middleware, the batch endpoint and two routes that set a
+// private cache policy, one of which echoes the caller's Authorization header.
+func newTestApp() *fiber.App {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Post("/internal/ssr/batch", BatchHandler(app))
+	app.Get("/api/me", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "private, max-age=30")
+		c.Set(fiber.HeaderETag, `"3"`)
+		return c.JSON(fiber.Map{"authorization": c.Get(fiber.HeaderAuthorization), "ssr": IsSSR(c)})
+	})
+	app.Get("/api/text", func(c *fiber.Ctx) error {
+		return c.SendString("plain")
+	})
+	return app
+}
+
+// TestMiddleware tests SSR recognition, the token and the cache headers.
+func TestMiddleware(t *testing.T) {
+	t.Setenv("SSR_TOKEN", "secret")
+	app := newTestApp()
+
+	request := func(ssrValue, authorization string) (cacheControl, vary string) {
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		if ssrValue != "" {
+			req.Header.Set("X-SSR-Request", ssrValue)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.Header.Get("Cache-Control"), resp.Header.Get("Vary")
+	}
+
+	// Browser requests keep the route's policy
+	cacheControl, vary := request("", "Bearer user")
+	assert.Equal(t, "private, max-age=30", cacheControl)
+	assert.Equal(t, "X-SSR-Request", vary)
+
+	// Authenticated SSR requests are never stored
+	cacheControl, vary = request("secret", "Bearer user")
+	assert.Equal(t, "private, no-store", cacheControl)
+	assert.Equal(t, "X-SSR-Request, Authorization", vary)
+
+	// Anonymous SSR requests keep it; a wrong token is not an SSR request
+	cacheControl, _ = request("secret", "")
+	assert.Equal(t, "private, max-age=30", cacheControl)
+	cacheControl, _ = request("guess", "Bearer user")
+	assert.Equal(t, "private, max-age=30", cacheControl)
+}
+
+// TestMiddleware_CustomHeader tests SSR_HEADER without a token.
+func TestMiddleware_CustomHeader(t *testing.T) {
+	t.Setenv("SSR_HEADER", "X-Renderer")
+	app := newTestApp()
+
+	req := httptest.NewRequest("GET", "/api/me", nil)
+	req.Header.Set("X-Renderer", "next")
+	req.Header.Set("Authorization", "Bearer user")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, "private, no-store", resp.Header.Get("Cache-Control"))
+}
+
+// TestBatchHandler tests that requests are resolved in order with the caller's identity.
+func TestBatchHandler(t *testing.T) {
+	t.Setenv("SSR_TOKEN", "secret")
+	app := newTestApp()
+
+	batch := func(ssrValue, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/internal/ssr/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer user")
+		if ssrValue != "" {
+			req.Header.Set("X-SSR-Request", ssrValue)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var decoded map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp.StatusCode, decoded
+	}
+
+	status, body := batch("secret", `{"requests": [
+		{"id": "me", "path": "/api/me"},
+		{"id": "text", "path": "/api/text"},
+		{"id": "missing", "path": "/api/missing"}
+	]}`)
+	require.Equal(t, fiber.StatusOK, status)
+	responses := body["responses"].([]interface{})
+	require.Len(t, responses, 3)
+
+	me := responses[0].(map[string]interface{})
+	assert.Equal(t, "me", me["id"])
+	assert.Equal(t, float64(200), me["status"])
+	assert.Equal(t, `"3"`, me["etag"])
+	assert.Equal(t, map[string]interface{}{"authorization": "Bearer user", "ssr": true}, me["body"])
+	assert.Equal(t, "plain", responses[1].(map[string]interface{})["body"])
+	assert.Equal(t, float64(404), responses[2].(map[string]interface{})["status"])
+
+	// Only the SSR server, and only for /api/ paths
+	status, _ = batch("", `{"requests": [{"id": "me", "path": "/api/me"}]}`)
+	assert.Equal(t, fiber.StatusForbidden, status)
+	for _, escaping := range []string{"/api/../internal/ssr/batch", "/api/%2e%2e/internal/ssr/batch", "/api/%2E%2E/metrics", "/api/..%2fmetrics"} {
+		status, _ = batch("secret", `{"requests": [{"id": "x", "path": "`+escaping+`"}]}`)
+		assert.Equal(t, fiber.StatusBadRequest, status, escaping)
+	}
+	status, _ = batch("secret", `{"requests": [{"id": "a", "path": "/api/me"}, {"id": "a", "path": "/api/me"}]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	status, _ = batch("secret", `{"requests": []}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+// TestBatchHandler_Disabled tests that batching needs SSR_TOKEN.
+func TestBatchHandler_Disabled(t *testing.T) {
+	t.Setenv("SSR_TOKEN", "")
+	app := newTestApp()
+
+	req := httptest.NewRequest("POST", "/internal/ssr/batch", strings.NewReader(`{"requests": [{"id": "me", "path": "/api/me"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SSR-Request", "1")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
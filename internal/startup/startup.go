@@ -0,0 +1,295 @@
+package startup
+
+// Package startup builds the report printed when the server boots (and served at
+// GET /api/admin/startup): every registered route with its middleware chain and effective rate
+// limit, and which subsystems (cache, realtime, jobs, ...) are enabled and how. A misconfigured
+// deployment (no cache, no Realtime credentials, emails only logged) shows up in the first screen
+// of logs instead of in the first bug report.
+//
+// Subsystems describe themselves with Report from their Init functions; the route table is
+// captured from the Fiber app once all routes are registered (see Capture).
+
+import (
+	"log"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Subsystem is one entry of the subsystem report.
+type Subsystem struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Detail  string `json:"detail"` // Backend and settings if enabled, why not if disabled
+}
+
+// Route is one entry of the route table.
+type Route struct {
+	Methods    []string `json:"methods"`              // ["ALL"] for routes registered with app.All
+	Path       string   `json:"path"`                 // Route pattern, e.g. /api/admin/users/:id/deletion
+	Middleware []string `json:"middleware"`           // Route-specific middleware, in order (global middleware excluded)
+	Handler    string   `json:"handler"`              // Final handler
+	RateLimit  string   `json:"rate_limit,omitempty"` // Effective rate limit, if any middleware in the chain limits
+}
+
+// Summary is the full startup report.
+type Summary struct {
+	GeneratedAt      time.Time   `json:"generated_at"`
+	GlobalMiddleware []string    `json:"global_middleware"` // Applied to every route, in order
+	Routes           []Route     `json:"routes"`
+	Subsystems       []Subsystem `json:"subsystems"`
+}
+
+var (
+	mu         sync.RWMutex
+	subsystems = make(map[string]Subsystem)
+	rateLimits = make(map[string]string) // "METHOD path" -> rate limit description
+	routes     []Route
+	global     []string
+	capturedAt time.Time
+)
+
+// Report records the state of a subsystem, replacing any previous report for name.
+// Call it from the subsystem's Init with a short detail, e.g.
+// Report("cache", true, "upstash, compression: gzip") or Report("mail", false, "SMTP_HOST not set").
+func Report(name string, enabled bool, detail string) {
+	mu.Lock()
+	defer mu.Unlock()
+	subsystems[name] = Subsystem{Name: name, Enabled: enabled, Detail: detail}
+}
+
+// RouteRateLimit records the effective rate limit of a route (e.g. "100/min per user or IP").
+// method is the registered method, or "ALL" for routes registered with app.All.
+func RouteRateLimit(method, path, description string) {
+	mu.Lock()
+	defer mu.Unlock()
+	rateLimits[method+" "+path] = description
+}
+
+// Capture records app's route table. Call it once every route is registered.
+func Capture(app *fiber.App) {
+	table, globalMiddleware := buildRoutes(app)
+
+	mu.Lock()
+	defer mu.Unlock()
+	routes, global, capturedAt = table, globalMiddleware, time.Now().UTC()
+}
+
+// Reset forgets every report and the route table. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	subsystems = make(map[string]Subsystem)
+	rateLimits = make(map[string]string)
+	routes, global, capturedAt = nil, nil, time.Time{}
+}
+
+// Get returns the current summary. Subsystems are sorted by name, routes by path.
+func Get() Summary {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	summary := Summary{
+		GeneratedAt:      capturedAt,
+		GlobalMiddleware: global,
+		Routes:           make([]Route, len(routes)),
+		Subsystems:       make([]Subsystem, 0, len(subsystems)),
+	}
+	for i, route := range routes {
+		for _, method := range route.Methods {
+			if description, ok := rateLimits[method+" "+route.Path]; ok {
+				route.RateLimit = description
+			}
+		}
+		summary.Routes[i] = route
+	}
+	for _, subsystem := range subsystems {
+		summary.Subsystems = append(summary.Subsystems, subsystem)
+	}
+	sort.Slice(summary.Subsystems, func(i, j int) bool {
+		return summary.Subsystems[i].Name < summary.Subsystems[j].Name
+	})
+	return summary
+}
+
+// Log prints the summary: subsystems first (disabled ones flagged), then the route table.
+func Log() {
+	summary := Get()
+
+	log.Println("INFO: Startup summary")
+	log.Println("  Subsystems:")
+	for _, subsystem := range summary.Subsystems {
+		state := "enabled "
+		if !subsystem.Enabled {
+			state = "DISABLED"
+		}
+		log.Printf("    %-14s %s  %s", subsystem.Name, state, subsystem.Detail)
+	}
+
+	log.Printf("  Global middleware: %s", strings.Join(summary.GlobalMiddleware, " -> "))
+	log.Printf("  Routes (%d):", len(summary.Routes))
+	for _, route := range summary.Routes {
+		chain := append(append([]string{}, route.Middleware...), route.Handler)
+		line := strings.Join(chain, " -> ")
+		if route.RateLimit != "" {
+			line += "  [rate limit: " + route.RateLimit + "]"
+		}
+		log.Printf("    %-20s %-40s %s", strings.Join(route.Methods, ","), route.Path, line)
+	}
+}
+
+// allMethods is the number of methods app.All registers a route for.
+var allMethods = len(fiber.DefaultMethods)
+
+// buildRoutes walks the app's routing stack. Fiber keeps middleware (app.Use, Group handlers)
+// and routes in one list per method, in registration order; a route's chain is every
+// middleware registered before it whose prefix matches its path. Routes with the same path and
+// chain and handler are merged across methods, and the HEAD route Fiber adds for every GET is
+// left out.
+func buildRoutes(app *fiber.App) ([]Route, []string) {
+	// Routes without middleware, to tell the two apart in the full stack
+	isRoute := make(map[string]bool)
+	for _, route := range app.GetRoutes(true) {
+		isRoute[routeKey(route)] = true
+	}
+
+	type entry struct {
+		route   Route
+		methods map[string]bool
+	}
+	entries := make(map[string]*entry)
+	var order []string
+	var globalMiddleware []string
+
+	for _, stack := range app.Stack() {
+		var uses []*fiber.Route
+		for _, r := range stack {
+			if !isRoute[routeKey(*r)] {
+				uses = append(uses, r)
+				continue
+			}
+
+			var chain []string
+			for _, use := range uses {
+				if use.Path == "/" {
+					continue // Global middleware, listed once
+				}
+				if r.Path == use.Path || strings.HasPrefix(r.Path, strings.TrimSuffix(use.Path, "/")+"/") {
+					for _, handler := range use.Handlers {
+						chain = append(chain, handlerName(handler))
+					}
+				}
+			}
+			for _, handler := range r.Handlers[:len(r.Handlers)-1] {
+				chain = append(chain, handlerName(handler))
+			}
+
+			handler := handlerName(r.Handlers[len(r.Handlers)-1])
+			key := r.Path + " " + strings.Join(chain, ",") + " " + handler
+			e, ok := entries[key]
+			if !ok {
+				e = &entry{
+					route: Route{
+						Path:       r.Path,
+						Middleware: chain,
+						Handler:    handler,
+					},
+					methods: make(map[string]bool),
+				}
+				entries[key] = e
+				order = append(order, key)
+			}
+			e.methods[r.Method] = true
+		}
+
+		if globalMiddleware == nil {
+			globalMiddleware = []string{}
+			for _, use := range uses {
+				if use.Path == "/" {
+					for _, handler := range use.Handlers {
+						globalMiddleware = append(globalMiddleware, handlerName(handler))
+					}
+				}
+			}
+		}
+	}
+
+	table := make([]Route, 0, len(order))
+	for _, key := range order {
+		e := entries[key]
+		if len(e.methods) == allMethods {
+			e.route.Methods = []string{"ALL"}
+		} else {
+			if e.methods[fiber.MethodGet] {
+				delete(e.methods, fiber.MethodHead)
+			}
+			for _, method := range fiber.DefaultMethods {
+				if e.methods[method] {
+					e.route.Methods = append(e.route.Methods, method)
+				}
+			}
+		}
+		table = append(table, e.route)
+	}
+	sort.SliceStable(table, func(i, j int) bool { return table[i].Path < table[j].Path })
+	return table, globalMiddleware
+}
+
+// routeKey identifies a route by method, path and handler functions.
+func routeKey(route fiber.Route) string {
+	var b strings.Builder
+	b.WriteString(route.Method + " " + route.Path)
+	for _, handler := range route.Handlers {
+		b.WriteString(" " + handlerName(handler))
+	}
+	return b.String()
+}
+
+// closureSuffix matches the suffixes the compiler gives closures and method values.
+var closureSuffix = regexp.MustCompile(`(\.func\d+(\.\d+)*|-fm)$`)
+
+// handlerName returns a readable name for a handler: the function that built it, with the
+// package name, e.g. "middleware.Auth" or "cors.New".
+func handlerName(handler fiber.Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	for closureSuffix.MatchString(name) {
+		name = closureSuffix.ReplaceAllString(name, "")
+	}
+
+	// Keep the last path element; for major-version paths (".../websocket/v2.New") keep the one before it too
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		last := name[i+1:]
+		if dir := name[:i]; isMajorVersion(last) {
+			if j := strings.LastIndex(dir, "/"); j >= 0 {
+				dir = dir[j+1:]
+			}
+			last = dir + last[strings.Index(last, "."):]
+		}
+		name = last
+	}
+	return name
+}
+
+// isMajorVersion reports whether a qualified name starts with a "vN" package path element.
+func isMajorVersion(name string) bool {
+	pkg, _, found := strings.Cut(name, ".")
+	if !found || len(pkg) < 2 || pkg[0] != 'v' {
+		return false
+	}
+	for _, r := range pkg[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
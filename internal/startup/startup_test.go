@@ -0,0 +1,73 @@
+package startup
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireUser(c *fiber.Ctx) error { return c.Next() }
+func limit(c *fiber.Ctx) error       { return c.Next() }
+func listItems(c *fiber.Ctx) error   { return nil }
+func createItem(c *fiber.Ctx) error  { return nil }
+func proxy(c *fiber.Ctx) error       { return nil }
+
+// TestCapture_RouteTable tests middleware chains, method merging and rate limit annotations.
+func TestCapture_RouteTable(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	app := fiber.New()
+	app.Use(recover.New())
+	app.Get("/health", listItems)
+	app.All("/graphql", proxy)
+	api := app.Group("/api", requireUser, limit)
+	api.Get("/items", listItems)
+	api.Post("/items", createItem)
+	api.Delete("/items/:id", createItem)
+	api.Put("/items/:id", createItem)
+	Capture(app)
+	RouteRateLimit("GET", "/api/items", "100/min per user or IP")
+
+	summary := Get()
+	assert.Equal(t, []string{"recover.New"}, summary.GlobalMiddleware)
+	assert.False(t, summary.GeneratedAt.IsZero())
+
+	require.Len(t, summary.Routes, 5)
+	assert.Equal(t, Route{Methods: []string{"ALL"}, Path: "/graphql", Handler: "startup.proxy"}, summary.Routes[3])
+	assert.Equal(t, Route{Methods: []string{"GET"}, Path: "/health", Handler: "startup.listItems"}, summary.Routes[4])
+
+	chain := []string{"startup.requireUser", "startup.limit"}
+	assert.Equal(t, Route{Methods: []string{"GET"}, Path: "/api/items", Middleware: chain,
+		Handler: "startup.listItems", RateLimit: "100/min per user or IP"}, summary.Routes[0])
+	assert.Equal(t, "startup.createItem", summary.Routes[1].Handler)
+	assert.Equal(t, []string{"POST"}, summary.Routes[1].Methods)
+	assert.Equal(t, []string{"PUT", "DELETE"}, summary.Routes[2].Methods) // Merged: same path, chain and handler
+}
+
+// TestReport tests the subsystem report ordering and replacement.
+func TestReport(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	Report("realtime", false, "SUPABASE_URL or SUPABASE_ANON_KEY not set")
+	Report("cache", false, "not configured")
+	Report("cache", true, "Upstash REST, compression: none")
+
+	assert.Equal(t, []Subsystem{
+		{Name: "cache", Enabled: true, Detail: "Upstash REST, compression: none"},
+		{Name: "realtime", Enabled: false, Detail: "SUPABASE_URL or SUPABASE_ANON_KEY not set"},
+	}, Get().Subsystems)
+}
+
+// TestHandlerName tests the readable names of closures and versioned import paths.
+func TestHandlerName(t *testing.T) {
+	assert.Equal(t, "recover.New", handlerName(recover.New()))
+	assert.Equal(t, "startup.limit", handlerName(limit))
+	assert.Equal(t, "startup.TestHandlerName", handlerName(func(c *fiber.Ctx) error { return nil }))
+	assert.True(t, isMajorVersion("v2.New"))
+	assert.False(t, isMajorVersion("vendor.New"))
+}
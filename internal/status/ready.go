@@ -0,0 +1,42 @@
+package status
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Readiness: while the instance drains (before a shutdown, or on an admin's request) /readyz
+// fails so load balancers stop sending it new traffic, while /healthz (liveness) stays 200 so
+// the orchestrator doesn't restart it (see internal/health). Requests that still arrive are
+// served normally.
+
+var (
+	drainMu       sync.RWMutex
+	drainingSince time.Time // Zero while ready
+)
+
+// SetDraining starts (true) or stops (false) draining. Returns false if nothing changed.
+func SetDraining(draining bool) bool {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+
+	if draining == !drainingSince.IsZero() {
+		return false
+	}
+	if draining {
+		drainingSince = time.Now().UTC()
+		log.Println("INFO: Draining: /readyz now fails so load balancers stop sending traffic")
+	} else {
+		drainingSince = time.Time{}
+		log.Println("INFO: Draining stopped: /readyz reports ready again")
+	}
+	return true
+}
+
+// Draining reports whether the instance is draining, and since when.
+func Draining() (bool, time.Time) {
+	drainMu.RLock()
+	defer drainMu.RUnlock()
+	return !drainingSince.IsZero(), drainingSince
+}
@@ -0,0 +1,234 @@
+package status
+
+// Package status is a shared registry of dependency health (Redis cache, Supabase Realtime).
+//
+// Clients report what they see: the cache wrapper marks the cache down when a command fails
+// and up again when one succeeds; the Realtime subscriber marks itself up once subscribed and
+// down when the connection drops. Handlers declare which dependencies a response relied on
+// with Uses(c, ...); Middleware() then flags those responses as degraded (X-Degraded header
+// and "meta": {"degraded": true, ...} in JSON bodies) instead of silently serving stale or
+// incomplete data. /healthz reports "degraded" while any dependency is down.
+//
+// /readyz (see internal/health) fails while the instance drains (see SetDraining).
+//
+// A dependency that was never reported (e.g. caching is not configured) is not degraded.
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Dependency names.
+const (
+	Cache    = "cache"
+	Realtime = "realtime"
+
+	// RealtimeSchema is down while the subscribed table lacks columns the subscriber reads.
+	RealtimeSchema = "realtime_schema"
+)
+
+// Dependency states.
+const (
+	StateUp   = "up"
+	StateDown = "down"
+)
+
+// localsKey is where the dependencies used by the request are stored.
+const localsKey = "dependencies"
+
+// degradedHeader lists the down dependencies a response relied on.
+const degradedHeader = "X-Degraded"
+
+// Dependency is the last reported health of one dependency.
+type Dependency struct {
+	State string    `json:"state"`
+	Error string    `json:"error,omitempty"` // The last error while down
+	Since time.Time `json:"since"`           // When the state last changed
+}
+
+var (
+	mu           sync.RWMutex
+	dependencies = make(map[string]Dependency)
+)
+
+// SetUp reports a dependency as healthy.
+func SetUp(name string) {
+	set(name, StateUp, "")
+}
+
+// SetDown reports a dependency as unavailable.
+func SetDown(name string, err error) {
+	message := "unavailable"
+	if err != nil {
+		message = err.Error()
+	}
+	set(name, StateDown, message)
+}
+
+// set records a state and logs transitions.
+func set(name, state, message string) {
+	mu.Lock()
+	previous, known := dependencies[name]
+	changed := !known || previous.State != state
+
+	current := previous
+	current.State = state
+	current.Error = message
+	if changed {
+		current.Since = time.Now().UTC()
+	}
+	dependencies[name] = current
+	mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if state == StateDown {
+		metrics.DependencyUp.WithLabelValues(name).Set(0)
+		log.Printf("WARNING: Dependency %s is down: %s", name, message)
+	} else {
+		metrics.DependencyUp.WithLabelValues(name).Set(1)
+		if known {
+			log.Printf("INFO: Dependency %s recovered", name)
+		}
+	}
+}
+
+// Get returns the last reported health of a dependency.
+func Get(name string) (Dependency, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	dependency, ok := dependencies[name]
+	return dependency, ok
+}
+
+// Snapshot returns every reported dependency.
+func Snapshot() map[string]Dependency {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	snapshot := make(map[string]Dependency, len(dependencies))
+	for name, dependency := range dependencies {
+		snapshot[name] = dependency
+	}
+	return snapshot
+}
+
+// Down returns which of names are currently down (all reported dependencies if names is empty),
+// sorted.
+func Down(names ...string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	down := make([]string, 0)
+	if len(names) == 0 {
+		for name, dependency := range dependencies {
+			if dependency.State == StateDown {
+				down = append(down, name)
+			}
+		}
+	} else {
+		for _, name := range names {
+			if dependencies[name].State == StateDown {
+				down = append(down, name)
+			}
+		}
+	}
+
+	sort.Strings(down)
+	return down
+}
+
+// Reset forgets every reported dependency and stops draining. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	dependencies = make(map[string]Dependency)
+	mu.Unlock()
+
+	drainMu.Lock()
+	drainingSince = time.Time{}
+	drainMu.Unlock()
+}
+
+// Uses records that the current response relies on the named dependencies.
+func Uses(c *fiber.Ctx, names ...string) {
+	used, _ := c.Locals(localsKey).([]string)
+	for _, name := range names {
+		found := false
+		for _, existing := range used {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			used = append(used, name)
+		}
+	}
+	c.Locals(localsKey, used)
+}
+
+// Middleware flags responses that relied on a dependency that is down: it sets the X-Degraded
+// header and, for JSON object bodies, adds "meta": {"degraded": true, "degraded_dependencies": [...]}
+// (merged into an existing "meta" object). Register it globally.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		used, _ := c.Locals(localsKey).([]string)
+		if len(used) == 0 {
+			return err
+		}
+		down := Down(used...)
+		if len(down) == 0 {
+			return err
+		}
+
+		c.Set(degradedHeader, strings.Join(down, ","))
+		// Streamed bodies (see internal/stream) are not read back: only the header is set
+		if strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) && !c.Response().IsBodyStream() {
+			if body, ok := markDegraded(c.Response().Body(), down); ok {
+				c.Response().SetBodyRaw(body)
+			}
+		}
+		return err
+	}
+}
+
+// markDegraded adds the degraded meta to a JSON object. Returns false for anything else.
+func markDegraded(body []byte, down []string) ([]byte, bool) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil || object == nil {
+		return nil, false
+	}
+
+	meta := make(map[string]interface{})
+	if raw, ok := object["meta"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil || meta == nil {
+			return nil, false // "meta" is not an object; leave the body alone
+		}
+	}
+	meta["degraded"] = true
+	meta["degraded_dependencies"] = down
+
+	encodedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, false
+	}
+	object["meta"] = encodedMeta
+
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return nil, false
+	}
+	return encoded, true
+}
@@ -0,0 +1,126 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistry_Transitions tests state changes, Down and the dependency_up gauge.
+func TestRegistry_Transitions(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	// Never reported: not down
+	_, ok := Get(Cache)
+	assert.False(t, ok)
+	assert.Empty(t, Down())
+
+	SetDown(Cache, errors.New("connection refused"))
+	dependency, ok := Get(Cache)
+	require.True(t, ok)
+	assert.Equal(t, StateDown, dependency.State)
+	assert.Equal(t, "connection refused", dependency.Error)
+	assert.Equal(t, 0.0, promtest.ToFloat64(metrics.DependencyUp.WithLabelValues(Cache)))
+
+	// A repeated failure keeps the original Since
+	since := dependency.Since
+	SetDown(Cache, errors.New("timeout"))
+	dependency, _ = Get(Cache)
+	assert.Equal(t, since, dependency.Since)
+	assert.Equal(t, "timeout", dependency.Error)
+
+	SetUp(Realtime)
+	assert.Equal(t, []string{Cache}, Down())
+	assert.Empty(t, Down(Realtime))
+
+	SetUp(Cache)
+	dependency, _ = Get(Cache)
+	assert.Equal(t, StateUp, dependency.State)
+	assert.Empty(t, dependency.Error)
+	assert.Empty(t, Down())
+	assert.Equal(t, 1.0, promtest.ToFloat64(metrics.DependencyUp.WithLabelValues(Cache)))
+	assert.Len(t, Snapshot(), 2)
+}
+
+// TestMiddleware_FlagsDegradedResponses tests the header and the meta injection.
+func TestMiddleware_FlagsDegradedResponses(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/prices", func(c *fiber.Ctx) error {
+		Uses(c, Cache, Realtime)
+		return c.JSON(fiber.Map{"data": []int{1}, "meta": fiber.Map{"page": 1}})
+	})
+	app.Get("/profile", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"user": "u1"})
+	})
+	app.Get("/text", func(c *fiber.Ctx) error {
+		Uses(c, Cache)
+		return c.SendString("plain")
+	})
+
+	get := func(path string) (*http.Response, map[string]interface{}) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		raw, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		var body map[string]interface{}
+		_ = json.Unmarshal(raw, &body)
+		return resp, body
+	}
+
+	// Everything up: the response is untouched
+	resp, body := get("/prices")
+	assert.Empty(t, resp.Header.Get("X-Degraded"))
+	assert.Equal(t, map[string]interface{}{"page": 1.0}, body["meta"])
+
+	// Realtime down: flagged, existing meta kept
+	SetDown(Realtime, errors.New("connection lost"))
+	resp, body = get("/prices")
+	assert.Equal(t, "realtime", resp.Header.Get("X-Degraded"))
+	meta, ok := body["meta"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, true, meta["degraded"])
+	assert.Equal(t, []interface{}{"realtime"}, meta["degraded_dependencies"])
+	assert.Equal(t, 1.0, meta["page"])
+	assert.Equal(t, []interface{}{1.0}, body["data"])
+
+	// Routes that don't use the dependency are not flagged
+	resp, body = get("/profile")
+	assert.Empty(t, resp.Header.Get("X-Degraded"))
+	assert.NotContains(t, body, "meta")
+
+	// Non-JSON bodies only get the header
+	SetDown(Cache, nil)
+	resp, _ = get("/text")
+	assert.Equal(t, "cache", resp.Header.Get("X-Degraded"))
+}
+
+// TestDraining tests starting and stopping draining.
+func TestDraining(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	assert.True(t, SetDraining(true))
+	assert.False(t, SetDraining(true), "already draining")
+	draining, since := Draining()
+	assert.True(t, draining)
+	assert.False(t, since.IsZero())
+
+	assert.True(t, SetDraining(false))
+	draining, _ = Draining()
+	assert.False(t, draining)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// Object is a stored file.
+type Object struct {
+	ContentType string
+	Data        []byte
+}
+
+// MemoryStore keeps objects in process memory. It is used in tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	baseURL string
+	objects map[string]Object
+}
+
+// NewMemoryStore creates an empty store whose URLs start with baseURL.
+func NewMemoryStore(baseURL string) *MemoryStore {
+	return &MemoryStore{baseURL: baseURL, objects: make(map[string]Object)}
+}
+
+// Put stores a copy of data.
+func (m *MemoryStore) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = Object{ContentType: contentType, Data: append([]byte(nil), data...)}
+	return m.baseURL + "/" + key, nil
+}
+
+// Delete removes an object.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	return nil
+}
+
+// Object returns the object under key, if any.
+func (m *MemoryStore) Object(key string) (Object, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	object, ok := m.objects[key]
+	return object, ok
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*SupabaseStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
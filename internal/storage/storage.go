@@ -0,0 +1,66 @@
+package storage
+
+// Package storage stores user-uploaded files (avatars, attachments) in an object store and
+// returns the URL they are served from. The default backend is Supabase Storage; without it,
+// uploads are disabled and the endpoints that need them return 503.
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"boilerplate/internal/startup"
+)
+
+// Store saves and deletes objects by key (a slash-separated path such as avatars/user-1.png).
+type Store interface {
+	// Put saves data under key, replacing any existing object, and returns its public URL.
+	Put(ctx context.Context, key, contentType string, data []byte) (string, error)
+
+	// Delete removes the object under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	// DefaultStore is the object store used by the application.
+	// It is nil until Init() or SetDefault() is called, and stays nil when storage is not configured.
+	DefaultStore Store
+
+	// ErrNotConfigured is returned when uploads are attempted without a store.
+	ErrNotConfigured = errors.New("storage not configured")
+)
+
+// Init configures the default store.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, objects go to the STORAGE_BUCKET bucket
+// (default "public", which must exist and be public so the returned URLs work without a token).
+// Otherwise storage is disabled.
+func Init() {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if supabaseURL == "" || serviceKey == "" {
+		log.Println("WARNING: SUPABASE_SERVICE_ROLE_KEY not set, file uploads are disabled")
+		startup.Report("storage", false, "SUPABASE_SERVICE_ROLE_KEY not set")
+		DefaultStore = nil
+		return
+	}
+
+	bucket := os.Getenv("STORAGE_BUCKET")
+	if bucket == "" {
+		bucket = "public"
+	}
+	DefaultStore = NewSupabaseStore(supabaseURL, serviceKey, bucket)
+	log.Printf("Storage initialized (Supabase Storage bucket %s)", bucket)
+	startup.Report("storage", true, "Supabase Storage bucket "+bucket)
+}
+
+// SetDefault replaces the default store (nil disables uploads). Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// Get returns the default store, or nil if storage is not configured.
+func Get() Store {
+	return DefaultStore
+}
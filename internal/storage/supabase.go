@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// SupabaseStore keeps objects in a Supabase Storage bucket, using the service role key.
+type SupabaseStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/storage/v1
+	bucket     string
+	serviceKey string
+	client     *http.Client
+}
+
+// NewSupabaseStore creates a store for a bucket of the given Supabase project.
+func NewSupabaseStore(supabaseURL, serviceKey, bucket string) *SupabaseStore {
+	return &SupabaseStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/storage/v1",
+		bucket:     bucket,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(30 * time.Second),
+	}
+}
+
+// Put uploads an object (overwriting any existing one) and returns its public URL.
+func (s *SupabaseStore) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.objectURL("object", key), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-upsert", "true")
+
+	if _, err := s.do(req); err != nil {
+		return "", err
+	}
+	return s.objectURL("object/public", key), nil
+}
+
+// Delete removes an object.
+func (s *SupabaseStore) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", s.objectURL("object", key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if status, err := s.do(req); err != nil && status != http.StatusNotFound {
+		return err
+	}
+	return nil
+}
+
+// objectURL builds the URL of an object under one of the Storage API prefixes.
+func (s *SupabaseStore) objectURL(prefix, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.baseURL + "/" + prefix + "/" + url.PathEscape(s.bucket) + "/" + strings.Join(segments, "/")
+}
+
+// do sends an authenticated request and returns the response status, with an error if it is
+// not 2xx (or the request failed, status 0).
+func (s *SupabaseStore) do(req *http.Request) (int, error) {
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to Supabase Storage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("Supabase Storage error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,188 @@
+package stream
+
+// Package stream writes large responses (exports, histories) incrementally, with chunked
+// transfer encoding, instead of building the whole body in memory: items are fetched a page at a
+// time and encoded as they are written, so an instance holds one page and the write buffer
+// whatever the size of the response.
+//
+// Backpressure: every page is flushed to the connection before the next one is fetched, and a
+// flush blocks while the client (or the proxy in front of the app) isn't reading. A slow client
+// slows the queries down rather than piling the response up in memory, and a flush that fails
+// (the client went away) stops the stream before the next query.
+//
+// The status and headers are sent before the first item, so an error after that can't change
+// them. The stream is cut short instead and the error logged: a JSON array is left
+// unterminated, so clients fail to parse it rather than taking a partial export for a complete
+// one.
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"boilerplate/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultPageSize is how many items are fetched, and flushed, at a time.
+const DefaultPageSize = 500
+
+// Pages fetches the items in [offset, offset+limit), in a stable order. A page shorter than
+// limit is the last one.
+type Pages[T any] func(ctx context.Context, offset, limit int) ([]T, error)
+
+// Options configures a stream.
+type Options struct {
+	PageSize int    // Items fetched and flushed at a time (0: DefaultPageSize)
+	Filename string // Sent as an attachment with this name when set
+
+	// Buffer builds the whole body in memory before answering, for responses that must be read
+	// back by a middleware (e.g. signed, see signature.Middleware). Errors are then all returned.
+	Buffer bool
+}
+
+// JSONArray streams every item of pages as a JSON array. It returns the error of the first page,
+// if any, with nothing sent.
+func JSONArray[T any](c *fiber.Ctx, pages Pages[T], opts Options) error {
+	var encoder *json.Encoder
+	written := 0
+	return start(c, pages, opts, fiber.MIMEApplicationJSONCharsetUTF8, writer[T]{
+		begin: func(w *bufio.Writer) error {
+			encoder = json.NewEncoder(w) // One item per line
+			_, err := w.WriteString("[\n")
+			return err
+		},
+		item: func(w *bufio.Writer, item T) error {
+			if written > 0 {
+				if err := w.WriteByte(','); err != nil {
+					return err
+				}
+			}
+			written++
+			return encoder.Encode(item)
+		},
+		end: func(w *bufio.Writer) error {
+			_, err := w.WriteString("]\n")
+			return err
+		},
+	})
+}
+
+// CSV streams every item of pages as a CSV row (see row), after header. It returns the error of
+// the first page, if any, with nothing sent.
+func CSV[T any](c *fiber.Ctx, header []string, pages Pages[T], row func(T) []string, opts Options) error {
+	var rows *csv.Writer
+	return start(c, pages, opts, "text/csv; charset=utf-8", writer[T]{
+		begin: func(w *bufio.Writer) error {
+			rows = csv.NewWriter(w)
+			return rows.Write(header)
+		},
+		item: func(w *bufio.Writer, item T) error {
+			return rows.Write(row(item))
+		},
+		flush: func() error {
+			rows.Flush()
+			return rows.Error()
+		},
+	})
+}
+
+// writer encodes a stream. begin runs before the first page and end after the last (not when
+// the stream is cut short); flush moves the encoder's own buffer to w before each flush.
+type writer[T any] struct {
+	begin func(w *bufio.Writer) error
+	item  func(w *bufio.Writer, item T) error
+	end   func(w *bufio.Writer) error
+	flush func() error
+}
+
+// start fetches the first page of pages, then sets the body stream of c's response to the items
+// of pages, encoded by enc. An error fetching the first page is returned before anything is set,
+// so the handler can still answer with an error. The stream runs after the handler returns, once
+// fiber released c, so everything it needs from the request is copied here.
+func start[T any](c *fiber.Ctx, pages Pages[T], opts Options, contentType string, enc writer[T]) error {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	first, err := pages(c.UserContext(), 0, pageSize)
+	if err != nil {
+		return err
+	}
+
+	if opts.Buffer {
+		if err := run(c.UserContext(), bufio.NewWriter(c.Response().BodyWriter()), first, pages, pageSize, enc); err != nil {
+			c.Response().ResetBody()
+			return err
+		}
+		setHeaders(c, opts, contentType)
+		return nil
+	}
+	setHeaders(c, opts, contentType)
+
+	ctx := context.WithoutCancel(c.UserContext()) // The handler has returned by the time it runs
+	logger := slog.Default().With(
+		"request_id", strings.Clone(logging.GetRequestID(c)),
+		"method", strings.Clone(c.Method()),
+		"path", strings.Clone(c.Path()),
+	)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := run(ctx, w, first, pages, pageSize, enc); err != nil {
+			logger.Warn("Response stream cut short", "error", err)
+		}
+	})
+	return nil
+}
+
+// setHeaders sets the content type of the response, and its filename.
+func setHeaders(c *fiber.Ctx, opts Options, contentType string) {
+	if opts.Filename != "" {
+		c.Attachment(opts.Filename)
+	}
+	c.Set(fiber.HeaderContentType, contentType) // After Attachment, which sets it from the extension
+}
+
+// run writes the stream to w, starting with the first page, flushing every page.
+func run[T any](ctx context.Context, w *bufio.Writer, first []T, pages Pages[T], pageSize int, enc writer[T]) error {
+	if err := enc.begin(w); err != nil {
+		return err
+	}
+	page, offset := first, 0
+	for {
+		for _, item := range page {
+			if err := enc.item(w, item); err != nil {
+				return err
+			}
+		}
+		if enc.flush != nil {
+			if err := enc.flush(); err != nil {
+				return err
+			}
+		}
+		// Blocks while the client isn't reading; fails once it is gone
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			break
+		}
+
+		offset += pageSize
+		var err error
+		if page, err = pages(ctx, offset, pageSize); err != nil {
+			return err
+		}
+	}
+
+	if enc.end != nil {
+		if err := enc.end(w); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
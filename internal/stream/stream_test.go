@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	ID int `json:"id"`
+}
+
+// counting returns pages of total items, counting the pages fetched.
+func counting(total int, fetched *atomic.Int32) Pages[item] {
+	return func(ctx context.Context, offset, limit int) ([]item, error) {
+		fetched.Add(1)
+		page := make([]item, 0, limit)
+		for i := offset; i < total && len(page) < limit; i++ {
+			page = append(page, item{ID: i})
+		}
+		return page, nil
+	}
+}
+
+// get sends GET / to app and returns the response and its body.
+func get(t *testing.T, app *fiber.App) (*http.Response, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// TestJSONArray tests that every page is streamed as one array, including empty ones.
+func TestJSONArray(t *testing.T) {
+	for _, total := range []int{0, 3, 4, 10} {
+		t.Run(strconv.Itoa(total), func(t *testing.T) {
+			var fetched atomic.Int32
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return JSONArray(c, counting(total, &fetched), Options{PageSize: 4, Filename: "items.json"})
+			})
+
+			resp, body := get(t, app)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, fiber.MIMEApplicationJSONCharsetUTF8, resp.Header.Get(fiber.HeaderContentType))
+			assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "items.json")
+
+			var items []item
+			require.NoError(t, json.Unmarshal([]byte(body), &items), body)
+			require.Len(t, items, total)
+			for i, item := range items {
+				assert.Equal(t, i, item.ID)
+			}
+			// Full pages can't tell they are the last one, so one more (empty) page is fetched
+			assert.Equal(t, int32(total/4+1), fetched.Load())
+		})
+	}
+}
+
+// TestJSONArray_Errors tests that an error on the first page is returned with nothing sent, that
+// a later one cuts the array short, and that buffered arrays return every error.
+func TestJSONArray_Errors(t *testing.T) {
+	failing := func(failAt int) Pages[item] {
+		return func(ctx context.Context, offset, limit int) ([]item, error) {
+			switch {
+			case offset >= failAt:
+				return nil, errors.New("connection refused")
+			case offset >= 10:
+				return nil, nil
+			}
+			return []item{{ID: offset}, {ID: offset + 1}}, nil
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		failAt, _ := strconv.Atoi(c.Query("fail_at"))
+		options := Options{PageSize: 2, Filename: "items.json", Buffer: c.QueryBool("buffer")}
+		if err := JSONArray(c, failing(failAt), options); err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/?fail_at=0", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(fiber.HeaderContentDisposition))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/?fail_at=4", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.True(t, strings.HasPrefix(string(body), "[\n"))
+	var items []item
+	assert.Error(t, json.Unmarshal(body, &items), "a cut-short array must not parse")
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/?fail_at=4&buffer=true", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(fiber.HeaderContentDisposition))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/?fail_at=100&buffer=true", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), "items.json")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+	assert.Len(t, items, 10)
+}
+
+// TestCSV tests the header and rows of a CSV stream.
+func TestCSV(t *testing.T) {
+	var fetched atomic.Int32
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return CSV(c, []string{"id"}, counting(3, &fetched), func(item item) []string {
+			return []string{strconv.Itoa(item.ID)}
+		}, Options{PageSize: 2})
+	})
+
+	resp, body := get(t, app)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get(fiber.HeaderContentType))
+	assert.Equal(t, "id\n0\n1\n2\n", body)
+}
+
+// TestJSONArray_Backpressure tests that pages are only fetched as the client reads, and that
+// fetching stops once the client is gone.
+func TestJSONArray_Backpressure(t *testing.T) {
+	var fetched atomic.Int32
+	endless := func(ctx context.Context, offset, limit int) ([]item, error) {
+		fetched.Add(1)
+		page := make([]item, limit)
+		for i := range page {
+			page[i] = item{ID: offset + i}
+		}
+		return page, nil
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return JSONArray(c, endless, Options{PageSize: 1000})
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1024))
+	require.NoError(t, err)
+
+	// Not reading: the stream stalls once the socket buffers are full
+	waitSettled(t, &fetched)
+	stalled := fetched.Load()
+	assert.Less(t, stalled, int32(1000), "pages were fetched without being read")
+
+	// Gone: the next flush fails and nothing more is fetched
+	conn.Close()
+	waitSettled(t, &fetched)
+	gone := fetched.Load()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, gone, fetched.Load())
+}
+
+// waitSettled waits until fetched stops changing.
+func waitSettled(t *testing.T, fetched *atomic.Int32) {
+	t.Helper()
+	last := fetched.Load()
+	for i := 0; i < 50; i++ {
+		time.Sleep(50 * time.Millisecond)
+		current := fetched.Load()
+		if current == last {
+			return
+		}
+		last = current
+	}
+	t.Fatal("pages are still being fetched")
+}
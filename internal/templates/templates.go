@@ -0,0 +1,444 @@
+package templates
+
+// Package templates renders the server's emails, export files and pages from templates embedded
+// in the binary (see files/):
+//
+//   - emails/<name>.txt: the plain-text body, with a "subject" block; emails/<name>.html, if
+//     present, is the HTML alternative. Both fill the "content" block of layouts/email.*.
+//   - exports/<name>.txt: files added to data exports.
+//   - pages/<name>.html: server-rendered pages, filling the "title" and "content" blocks of
+//     layouts/page.html.
+//
+// Text templates use text/template, HTML ones html/template (values are escaped). Templates are
+// localized: strings come from the catalogs in locales/<language>.json through the t and tn
+// functions, and dates are written in the locale's format:
+//
+//	{{t "digest.settings"}}                  the string for the key
+//	{{t "export.readme.user" .UserID}}       with fmt arguments
+//	{{tn "digest.subject" (len .Items)}}     the key's .one or .other form, given the count
+//	{{date .CreatedAt}}                      a time (or RFC 3339 string) in format.date, in UTC
+//	{{date .CreatedAt "format.short"}}       in another format of the catalog
+//	{{locale}}                               the locale rendered, e.g. for <html lang>
+//
+// Locales match like prices do ("de-AT" and "de" use de.json); unknown ones and missing keys fall
+// back to English. With TEMPLATES_DIR set, templates are read from that directory (laid out like
+// files/) and parsed again on every render, so edits show up without a restart; it is meant for
+// development, where GET /dev/templates previews every template with its sample data.
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"boilerplate/internal/price"
+	"boilerplate/internal/startup"
+)
+
+//go:embed files
+var embedded embed.FS
+
+// fallbackLanguage is used for unknown locales and keys missing from a catalog.
+const fallbackLanguage = "en"
+
+// layouts maps a template directory to its layout (without extension).
+var layouts = map[string]string{
+	"emails": "layouts/email",
+	"pages":  "layouts/page",
+}
+
+// ErrNotFound is returned for templates that don't exist.
+var ErrNotFound = errors.New("template not found")
+
+// Email is a rendered email.
+type Email struct {
+	Subject string
+	Text    string
+	HTML    string // Empty if the email has no HTML template
+}
+
+// Set is a parsed set of templates and catalogs.
+type Set struct {
+	fsys     fs.FS
+	reload   bool // Parse again on every render (TEMPLATES_DIR)
+	parsed   *parsed
+	defaults string // Default locale
+}
+
+// parsed holds the templates and catalogs of a set.
+type parsed struct {
+	html     map[string]*htmltemplate.Template // By path, e.g. "emails/digest.html"
+	text     map[string]*texttemplate.Template
+	entries  map[string]string            // The template to execute for each path: its layout's or its own
+	catalogs map[string]map[string]string // By language
+}
+
+var (
+	// Default is the set used by the package functions. Get parses the embedded templates into it
+	// if Init() or SetDefault() wasn't called.
+	Default     *Set
+	defaultOnce sync.Once
+)
+
+// Init configures the default set from TEMPLATES_DIR, or the embedded templates.
+func Init() {
+	if dir := os.Getenv("TEMPLATES_DIR"); dir != "" {
+		set, err := New(os.DirFS(dir), true)
+		if err == nil {
+			Default = set
+			startup.Report("templates", true, dir+" (reloaded on every render)")
+			return
+		}
+		log.Printf("WARNING: Failed to load templates from TEMPLATES_DIR, using the embedded ones: %v", err)
+	}
+	Default = mustEmbedded()
+	startup.Report("templates", true, "embedded, locales "+strings.Join(Default.Locales(), ", "))
+}
+
+// New parses the templates and catalogs in fsys (laid out like files/). With reload, fsys is
+// parsed again on every render.
+func New(fsys fs.FS, reload bool) (*Set, error) {
+	p, err := parse(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{fsys: fsys, reload: reload, parsed: p, defaults: price.DefaultLocale()}, nil
+}
+
+// SetDefault replaces the default set. Mainly useful in tests.
+func SetDefault(set *Set) {
+	Default = set
+}
+
+// Get returns the default set, parsing the embedded templates on first use if needed.
+func Get() *Set {
+	if Default != nil {
+		return Default
+	}
+	defaultOnce.Do(func() {
+		if Default == nil {
+			Default = mustEmbedded()
+		}
+	})
+	return Default
+}
+
+// mustEmbedded parses the embedded templates; they are tested, so errors are bugs.
+func mustEmbedded() *Set {
+	fsys, err := fs.Sub(embedded, "files")
+	if err != nil {
+		panic(err)
+	}
+	set, err := New(fsys, false)
+	if err != nil {
+		panic(fmt.Sprintf("templates: %v", err))
+	}
+	return set
+}
+
+// RenderEmail renders an email of the default set.
+func RenderEmail(name, locale string, data any) (*Email, error) {
+	return Get().Email(name, locale, data)
+}
+
+// Render renders a template of the default set.
+func Render(w io.Writer, name, locale string, data any) error {
+	return Get().Render(w, name, locale, data)
+}
+
+// Email renders emails/<name>.txt (and emails/<name>.html, if present) in locale.
+func (s *Set) Email(name, locale string, data any) (*Email, error) {
+	p, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	base := "emails/" + name
+	if _, ok := p.text[base+".txt"]; !ok {
+		return nil, fmt.Errorf("%w: %s.txt", ErrNotFound, base)
+	}
+
+	var text, subject bytes.Buffer
+	tmpl, err := p.textFor(base+".txt", s.funcs(p, locale))
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.ExecuteTemplate(&text, p.entries[base+".txt"], data); err != nil {
+		return nil, fmt.Errorf("failed to render %s.txt: %w", base, err)
+	}
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render the subject of %s: %w", base, err)
+	}
+	email := &Email{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+
+	if _, ok := p.html[base+".html"]; ok {
+		var html bytes.Buffer
+		if err := s.render(p, &html, base+".html", locale, data); err != nil {
+			return nil, err
+		}
+		email.HTML = html.String()
+	}
+	return email, nil
+}
+
+// Render writes the template at name (its path, e.g. "exports/readme.txt" or
+// "pages/preview.html") rendered in locale to w.
+func (s *Set) Render(w io.Writer, name, locale string, data any) error {
+	p, err := s.current()
+	if err != nil {
+		return err
+	}
+	return s.render(p, w, name, locale, data)
+}
+
+// render executes the template at name, with the functions of locale.
+func (s *Set) render(p *parsed, w io.Writer, name, locale string, data any) error {
+	funcs := s.funcs(p, locale)
+	switch {
+	case p.html[name] != nil:
+		tmpl, err := p.html[name].Clone()
+		if err != nil {
+			return fmt.Errorf("failed to prepare %s: %w", name, err)
+		}
+		if err := tmpl.Funcs(funcs).ExecuteTemplate(w, p.entries[name], data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		return nil
+	case p.text[name] != nil:
+		tmpl, err := p.textFor(name, funcs)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.ExecuteTemplate(w, p.entries[name], data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Names returns the paths of every renderable template, sorted.
+func (s *Set) Names() []string {
+	p, err := s.current()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(p.entries))
+	for name := range p.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locales returns the languages with a catalog, sorted.
+func (s *Set) Locales() []string {
+	p, err := s.current()
+	if err != nil {
+		return nil
+	}
+	languages := make([]string, 0, len(p.catalogs))
+	for language := range p.catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Sample returns the sample data of the template at name (<name without extension>.sample.json),
+// or nil if it has none.
+func (s *Set) Sample(name string) (any, error) {
+	raw, err := fs.ReadFile(s.fsys, strings.TrimSuffix(name, path.Ext(name))+".sample.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("invalid sample data for %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// current returns the parsed templates, parsing them again if the set reloads.
+func (s *Set) current() (*parsed, error) {
+	if s.reload {
+		return parse(s.fsys)
+	}
+	return s.parsed, nil
+}
+
+// textFor returns a copy of the text template at name using funcs.
+func (p *parsed) textFor(name string, funcs map[string]any) (*texttemplate.Template, error) {
+	tmpl, err := p.text[name].Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare %s: %w", name, err)
+	}
+	return tmpl.Funcs(funcs), nil
+}
+
+// parse reads every catalog and template of fsys.
+func parse(fsys fs.FS) (*parsed, error) {
+	p := &parsed{
+		html:     make(map[string]*htmltemplate.Template),
+		text:     make(map[string]*texttemplate.Template),
+		entries:  make(map[string]string),
+		catalogs: make(map[string]map[string]string),
+	}
+
+	catalogs, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range catalogs {
+		raw, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(raw, &catalog); err != nil {
+			return nil, fmt.Errorf("invalid catalog %s: %w", file, err)
+		}
+		p.catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	if p.catalogs[fallbackLanguage] == nil {
+		return nil, fmt.Errorf("no locales/%s.json catalog", fallbackLanguage)
+	}
+
+	for _, dir := range []string{"emails", "exports", "pages"} {
+		for _, ext := range []string{".html", ".txt"} {
+			files, err := fs.Glob(fsys, dir+"/*"+ext)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				if err := p.add(fsys, file, dir, ext); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// add parses one template, with its directory's layout if it has one.
+func (p *parsed) add(fsys fs.FS, file, dir, ext string) error {
+	files := []string{file}
+	entry := path.Base(file)
+	if layout, ok := layouts[dir]; ok {
+		if _, err := fs.Stat(fsys, layout+ext); err == nil {
+			files = []string{layout + ext, file}
+			entry = path.Base(layout + ext)
+		}
+	}
+
+	funcs := placeholderFuncs()
+	if ext == ".html" {
+		tmpl, err := htmltemplate.New(entry).Funcs(funcs).ParseFS(fsys, files...)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		p.html[file] = tmpl
+	} else {
+		tmpl, err := texttemplate.New(entry).Funcs(funcs).ParseFS(fsys, files...)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		p.text[file] = tmpl
+	}
+	p.entries[file] = entry
+	return nil
+}
+
+// placeholderFuncs declares the template functions for parsing; funcs replaces them when
+// rendering.
+func placeholderFuncs() map[string]any {
+	return map[string]any{
+		"t":      func(key string, args ...any) string { return "" },
+		"tn":     func(key string, n int) string { return "" },
+		"date":   func(value any, format ...string) string { return "" },
+		"locale": func() string { return "" },
+	}
+}
+
+// funcs returns the template functions for locale.
+func (s *Set) funcs(p *parsed, locale string) map[string]any {
+	locale, language := s.resolve(p, locale)
+	lookup := func(key string) string {
+		if message, ok := p.catalogs[language][key]; ok {
+			return message
+		}
+		if message, ok := p.catalogs[fallbackLanguage][key]; ok {
+			return message
+		}
+		return key
+	}
+	translate := func(key string, args ...any) string {
+		if len(args) == 0 {
+			return lookup(key)
+		}
+		return fmt.Sprintf(lookup(key), args...)
+	}
+
+	return map[string]any{
+		"t": translate,
+		"tn": func(key string, n int) string {
+			if n == 1 {
+				return translate(key+".one", n)
+			}
+			return translate(key+".other", n)
+		},
+		"date": func(value any, format ...string) string {
+			layout := "format.date"
+			if len(format) > 0 {
+				layout = format[0]
+			}
+			switch v := value.(type) {
+			case time.Time:
+				return v.UTC().Format(lookup(layout))
+			case *time.Time:
+				if v == nil {
+					return ""
+				}
+				return v.UTC().Format(lookup(layout))
+			case string:
+				if parsed, err := time.Parse(time.RFC3339, v); err == nil {
+					return parsed.UTC().Format(lookup(layout))
+				}
+				return v
+			}
+			return fmt.Sprint(value)
+		},
+		"locale": func() string { return locale },
+	}
+}
+
+// resolve returns the locale to render (e.g. de-DE) and the language of its catalog (de, or the
+// fallback if there is none).
+func (s *Set) resolve(p *parsed, locale string) (string, string) {
+	matched, ok := price.Match(locale)
+	if !ok {
+		matched = s.defaults
+	}
+	language, _, _ := strings.Cut(matched, "-")
+	if _, ok := p.catalogs[language]; !ok {
+		return matched, fallbackLanguage
+	}
+	return matched, language
+}
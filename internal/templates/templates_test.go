@@ -0,0 +1,123 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// untranslated matches catalog keys that leaked into the output (t returns the key when missing).
+var untranslated = regexp.MustCompile(`\b(format|email|deletion_requested|deletion_completed|notification|digest|export)\.[a-z_.]+\b`)
+
+// TestEmbedded tests that every template renders with its sample data in every locale, without
+// missing keys.
+func TestEmbedded(t *testing.T) {
+	set := mustEmbedded()
+	require.NotEmpty(t, set.Names())
+	assert.Equal(t, []string{"de", "en"}, set.Locales())
+
+	for _, name := range set.Names() {
+		data, err := set.Sample(name)
+		require.NoError(t, err)
+		for _, locale := range set.Locales() {
+			var out bytes.Buffer
+			require.NoError(t, set.Render(&out, name, locale, data), "%s in %s", name, locale)
+			assert.NotEmpty(t, strings.TrimSpace(out.String()))
+			assert.Empty(t, untranslated.FindAllString(out.String(), -1), "%s in %s", name, locale)
+		}
+	}
+}
+
+// TestCatalogs tests that every catalog has the keys of the English one.
+func TestCatalogs(t *testing.T) {
+	fsys, err := fs.Sub(embedded, "files")
+	require.NoError(t, err)
+	files, err := fs.Glob(fsys, "locales/*.json")
+	require.NoError(t, err)
+
+	catalogs := make(map[string]map[string]string)
+	for _, file := range files {
+		raw, err := fs.ReadFile(fsys, file)
+		require.NoError(t, err)
+		var catalog map[string]string
+		require.NoError(t, json.Unmarshal(raw, &catalog), file)
+		catalogs[file] = catalog
+	}
+	for file, catalog := range catalogs {
+		for key := range catalogs["locales/en.json"] {
+			assert.Contains(t, catalog, key, file)
+		}
+	}
+}
+
+// TestEmail tests subjects, plurals, dates and the HTML alternative.
+func TestEmail(t *testing.T) {
+	set := mustEmbedded()
+	created := time.Date(2026, 11, 14, 9, 30, 0, 0, time.UTC)
+	items := []map[string]any{
+		{"Title": "First", "Body": "One", "CreatedAt": created},
+		{"Title": "Second", "Body": "Two", "CreatedAt": created},
+	}
+
+	email, err := set.Email("digest", "en-US", map[string]any{"Items": items})
+	require.NoError(t, err)
+	assert.Equal(t, "Your daily summary: 2 notifications", email.Subject)
+	assert.Contains(t, email.Text, "First (Nov 14, 09:30 UTC)\nOne\n")
+	assert.Contains(t, email.HTML, "<h3")
+
+	email, err = set.Email("digest", "de-AT", map[string]any{"Items": items[:1]})
+	require.NoError(t, err)
+	assert.Equal(t, "Deine tägliche Zusammenfassung: 1 Benachrichtigung", email.Subject)
+	assert.Contains(t, email.Text, "14.11., 09:30 UTC")
+	assert.Contains(t, email.HTML, `<html lang="de-DE">`, "locales match like prices do")
+
+	email, err = set.Email("deletion_requested", "xx", map[string]any{"ScheduledFor": created})
+	require.NoError(t, err)
+	assert.Equal(t, "Your account deletion request", email.Subject, "unknown locales fall back")
+	assert.Contains(t, email.Text, "deleted on 14 November 2026 09:30 UTC.")
+
+	_, err = set.Email("missing", "en", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// TestEmail_Escaping tests that values are escaped in HTML but not in plain text.
+func TestEmail_Escaping(t *testing.T) {
+	email, err := mustEmbedded().Email("notification", "en", map[string]any{"Title": "Tom & Jerry", "Body": "<script>alert(1)</script>"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Tom & Jerry", email.Subject)
+	assert.Contains(t, email.Text, "<script>alert(1)</script>")
+	assert.NotContains(t, email.HTML, "<script>")
+	assert.Contains(t, email.HTML, "&lt;script&gt;")
+}
+
+// TestNew_Reload tests that a reloading set picks up edits, and that the English catalog is
+// required.
+func TestNew_Reload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json":   {Data: []byte(`{"greeting": "Hello %s"}`)},
+		"exports/hello.txt": {Data: []byte(`{{t "greeting" .}}`)},
+	}
+	set, err := New(fsys, true)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, set.Render(&out, "exports/hello.txt", "en", "Ada"))
+	assert.Equal(t, "Hello Ada", out.String())
+
+	fsys["exports/hello.txt"] = &fstest.MapFile{Data: []byte(`{{t "greeting" .}}!`)}
+	out.Reset()
+	require.NoError(t, set.Render(&out, "exports/hello.txt", "en", "Ada"))
+	assert.Equal(t, "Hello Ada!", out.String())
+
+	_, err = New(fstest.MapFS{"locales/de.json": {Data: []byte(`{}`)}}, false)
+	assert.Error(t, err)
+}
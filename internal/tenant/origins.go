@@ -0,0 +1,247 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// OriginResolver looks up the CORS origins allowed for a tenant.
+//
+// Sources, in order:
+//  1. TENANT_CORS_ORIGINS: JSON object of tenant ID -> origins, e.g. {"acme": ["https://app.acme.com"]}
+//  2. The tenant_cors_origins table in Supabase (TENANT_CORS_DB=true; see schema.sql), cached
+//     for TENANT_CORS_CACHE_TTL (default 5m)
+//
+// A tenant found in neither source gets no origins, and the caller falls back to ALLOWED_ORIGINS.
+// Tenant IDs come from the request's subdomain, so anyone can make up new ones: tenants without
+// origins and failed lookups are cached too (for at most negativeTTL), and the cache holds at most
+// maxOriginEntries tenants.
+type OriginResolver struct {
+	static map[string][]string
+	db     *originTable // nil unless TENANT_CORS_DB=true
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]originsEntry
+	now     func() time.Time // Overridable clock for tests
+}
+
+const (
+	// negativeTTL is the longest a tenant without origins, or a failed lookup, is cached.
+	negativeTTL = 30 * time.Second
+
+	// maxOriginEntries is the most tenants cached.
+	maxOriginEntries = 10000
+)
+
+// originsEntry is a cached database lookup.
+type originsEntry struct {
+	origins   []string
+	expiresAt time.Time
+}
+
+// NewOriginResolver builds a resolver from the environment.
+// Returns nil when no per-tenant origins are configured.
+func NewOriginResolver() *OriginResolver {
+	static, err := parseStaticOrigins(os.Getenv("TENANT_CORS_ORIGINS"))
+	if err != nil {
+		log.Printf("WARNING: Ignoring TENANT_CORS_ORIGINS: %v", err)
+	}
+
+	var db *originTable
+	if os.Getenv("TENANT_CORS_DB") == "true" {
+		supabaseURL := os.Getenv("SUPABASE_URL")
+		serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+		if supabaseURL == "" || serviceKey == "" {
+			log.Println("WARNING: TENANT_CORS_DB=true but SUPABASE_URL or SUPABASE_SERVICE_ROLE_KEY is not set")
+		} else {
+			db = newOriginTable(supabaseURL, serviceKey)
+		}
+	}
+
+	if len(static) == 0 && db == nil {
+		return nil
+	}
+
+	ttl := 5 * time.Minute
+	if raw := os.Getenv("TENANT_CORS_CACHE_TTL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			ttl = parsed
+		}
+	}
+
+	return newOriginResolver(static, db, ttl)
+}
+
+// newOriginResolver creates a resolver from explicit sources.
+func newOriginResolver(static map[string][]string, db *originTable, ttl time.Duration) *OriginResolver {
+	return &OriginResolver{
+		static:  static,
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[string]originsEntry),
+		now:     time.Now,
+	}
+}
+
+// Origins returns the origins allowed for tenantID, or nil if the tenant has none configured.
+// When the database is unreachable, the last known origins are used until it recovers.
+func (r *OriginResolver) Origins(ctx context.Context, tenantID string) []string {
+	if r == nil || tenantID == "" {
+		return nil
+	}
+	if origins, ok := r.static[tenantID]; ok {
+		return origins
+	}
+	if r.db == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	entry, cached := r.entries[tenantID]
+	r.mu.Unlock()
+	if cached && r.now().Before(entry.expiresAt) {
+		return entry.origins
+	}
+
+	origins, err := r.db.lookup(ctx, tenantID)
+	ttl := r.ttl
+	if err != nil {
+		log.Printf("WARNING: Failed to load CORS origins for tenant %s: %v", tenantID, err)
+		origins = entry.origins // Stale (or nil) until the next successful lookup
+	}
+	if err != nil || len(origins) == 0 {
+		ttl = min(ttl, negativeTTL)
+	}
+	r.store(tenantID, originsEntry{origins: origins, expiresAt: r.now().Add(ttl)})
+	return origins
+}
+
+// store caches entry for tenantID, first making room if the cache is full: expired entries are
+// dropped, then arbitrary ones down to 90% of the limit, so that a flood of made-up tenants
+// doesn't scan the cache on every lookup.
+func (r *OriginResolver) store(tenantID string, entry originsEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.entries[tenantID]; !ok && len(r.entries) >= maxOriginEntries {
+		now := r.now()
+		for id, cached := range r.entries {
+			if !now.Before(cached.expiresAt) {
+				delete(r.entries, id)
+			}
+		}
+		if len(r.entries) >= maxOriginEntries {
+			for id := range r.entries {
+				if len(r.entries) <= maxOriginEntries*9/10 {
+					break
+				}
+				delete(r.entries, id)
+			}
+		}
+	}
+	r.entries[strings.Clone(tenantID)] = entry // The ID may point into a request's buffers
+}
+
+// parseStaticOrigins parses the TENANT_CORS_ORIGINS JSON object.
+func parseStaticOrigins(raw string) (map[string][]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var parsed map[string][]string
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	result := make(map[string][]string, len(parsed))
+	for tenantID, origins := range parsed {
+		if !Valid(tenantID) {
+			return nil, fmt.Errorf("invalid tenant ID %q", tenantID)
+		}
+		result[tenantID] = validOrigins(origins)
+	}
+	return result, nil
+}
+
+// validOrigins keeps only well-formed origins like https://app.example.com[:port].
+// Wildcards are rejected: they can't be combined with credentials.
+func validOrigins(origins []string) []string {
+	result := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Path != "" || u.RawQuery != "" || strings.Contains(origin, "*") {
+			log.Printf("WARNING: Ignoring invalid CORS origin %q", origin)
+			continue
+		}
+		result = append(result, strings.ToLower(origin))
+	}
+	return result
+}
+
+// originTable reads tenant origins from the tenant_cors_origins table via the Supabase REST API.
+type originTable struct {
+	baseURL    string
+	serviceKey string
+	client     *http.Client
+}
+
+// newOriginTable creates a reader for the given Supabase project.
+func newOriginTable(supabaseURL, serviceKey string) *originTable {
+	return &originTable{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/tenant_cors_origins",
+		serviceKey: serviceKey,
+		client:     egress.NewClient(5 * time.Second),
+	}
+}
+
+// lookup returns the origins stored for tenantID.
+func (t *originTable) lookup(ctx context.Context, tenantID string) ([]string, error) {
+	params := url.Values{}
+	params.Set("select", "origin")
+	params.Set(Column, "eq."+tenantID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", t.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+t.serviceKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var rows []struct {
+		Origin string `json:"origin"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to parse origins: %w", err)
+	}
+
+	origins := make([]string, 0, len(rows))
+	for _, row := range rows {
+		origins = append(origins, row.Origin)
+	}
+	return validOrigins(origins), nil
+}
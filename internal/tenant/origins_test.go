@@ -0,0 +1,105 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseStaticOrigins tests parsing and validation of TENANT_CORS_ORIGINS.
+func TestParseStaticOrigins(t *testing.T) {
+	origins, err := parseStaticOrigins(`{"acme": ["https://App.Acme.com/", "*", "https://acme.com/path", "ftp://acme.com", "http://localhost:5173"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://app.acme.com", "http://localhost:5173"}, origins["acme"])
+
+	_, err = parseStaticOrigins(`{"Bad Tenant": ["https://x.com"]}`)
+	assert.Error(t, err)
+
+	_, err = parseStaticOrigins(`not json`)
+	assert.Error(t, err)
+
+	origins, err = parseStaticOrigins("")
+	require.NoError(t, err)
+	assert.Nil(t, origins)
+}
+
+// TestOriginResolver_Database tests database lookups, caching and the stale fallback on errors.
+func TestOriginResolver_Database(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "/rest/v1/tenant_cors_origins", r.URL.Path)
+		if r.URL.Query().Get("tenant_id") != "eq.acme" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"origin":"https://app.acme.com"}]`))
+	}))
+	defer server.Close()
+
+	resolver := newOriginResolver(map[string][]string{"globex": {"https://globex.io"}},
+		newOriginTable(server.URL, "service-key"), time.Minute)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Static config wins and never hits the database
+	assert.Equal(t, []string{"https://globex.io"}, resolver.Origins(ctx, "globex"))
+	assert.Nil(t, resolver.Origins(ctx, ""))
+	assert.Equal(t, int32(0), requests.Load())
+
+	// Database lookup, then served from cache
+	assert.Equal(t, []string{"https://app.acme.com"}, resolver.Origins(ctx, "acme"))
+	assert.Equal(t, []string{"https://app.acme.com"}, resolver.Origins(ctx, "acme"))
+	assert.Equal(t, int32(1), requests.Load())
+
+	// After the TTL a failing database keeps serving the last known origins, and is only asked
+	// again after negativeTTL
+	now = now.Add(2 * time.Minute)
+	failing.Store(true)
+	assert.Equal(t, []string{"https://app.acme.com"}, resolver.Origins(ctx, "acme"))
+	assert.Equal(t, []string{"https://app.acme.com"}, resolver.Origins(ctx, "acme"))
+	assert.Equal(t, int32(2), requests.Load())
+	now = now.Add(negativeTTL)
+	resolver.Origins(ctx, "acme")
+	assert.Equal(t, int32(3), requests.Load())
+
+	// Tenants without origins are cached for negativeTTL
+	assert.Empty(t, resolver.Origins(ctx, "ghost"))
+	assert.Empty(t, resolver.Origins(ctx, "ghost"))
+	assert.Equal(t, int32(4), requests.Load())
+	now = now.Add(negativeTTL)
+	assert.Empty(t, resolver.Origins(ctx, "ghost"))
+	assert.Equal(t, int32(5), requests.Load())
+}
+
+// TestOriginResolver_Bounded tests that the cache drops expired entries, then others, when full.
+func TestOriginResolver_Bounded(t *testing.T) {
+	resolver := newOriginResolver(nil, nil, time.Minute)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+	for i := 0; i < maxOriginEntries; i++ {
+		resolver.store(fmt.Sprint("tenant-", i), originsEntry{expiresAt: now.Add(time.Duration(i%2) * time.Minute)})
+	}
+
+	// Half the entries have expired
+	resolver.store("acme", originsEntry{origins: []string{"https://app.acme.com"}, expiresAt: now.Add(time.Minute)})
+	assert.Len(t, resolver.entries, maxOriginEntries/2+1)
+
+	for i := 0; i < maxOriginEntries; i++ {
+		resolver.store(fmt.Sprint("other-", i), originsEntry{expiresAt: now.Add(time.Minute)})
+		require.LessOrEqual(t, len(resolver.entries), maxOriginEntries)
+	}
+}
@@ -0,0 +1,12 @@
+-- Per-tenant CORS origins, read by the backend when TENANT_CORS_DB=true.
+-- Run this in the Supabase SQL editor.
+
+create table if not exists tenant_cors_origins (
+    tenant_id  text not null,
+    origin     text not null,          -- e.g. https://app.acme.com (no path, no wildcard)
+    created_at timestamptz not null default now(),
+    primary key (tenant_id, origin)
+);
+
+-- RLS with no policies: only the service role (used by the backend) can access the table.
+alter table tenant_cors_origins enable row level security;
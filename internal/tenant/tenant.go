@@ -0,0 +1,186 @@
+package tenant
+
+// Package tenant resolves which customer (tenant) a request belongs to, so one deployment can
+// serve several customers without their cached data, rate limits or realtime updates mixing.
+//
+// The tenant ID comes from the request subdomain (acme.api.example.com -> "acme", when
+// TENANT_BASE_DOMAIN=api.example.com) and/or a JWT claim (TENANT_CLAIM, default "tenant_id";
+// dotted paths such as "app_metadata.tenant_id" are supported). When both are present they
+// must agree. Requests without a tenant behave exactly like a single-tenant deployment.
+
+import (
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"boilerplate/internal/apperror"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/timing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LocalsKey is the fiber.Ctx Locals key holding the resolved tenant ID.
+const LocalsKey = "tenant"
+
+// Column is the database column holding the tenant ID on tenant-scoped tables.
+const Column = "tenant_id"
+
+// validID restricts tenant IDs to characters that are safe inside cache keys and filters.
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Valid reports whether id is a well-formed tenant ID.
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+// ID returns the tenant resolved for the request, or "" if there is none.
+func ID(c *fiber.Ctx) string {
+	id, _ := c.Locals(LocalsKey).(string)
+	return id
+}
+
+// Prefix scopes key to a tenant: Prefix("acme", "price:1") == "tenant:acme:price:1".
+// Keys without a tenant are returned unchanged.
+func Prefix(tenantID, key string) string {
+	if tenantID == "" {
+		return key
+	}
+	return "tenant:" + tenantID + ":" + key
+}
+
+// Cache returns the default cache store scoped to the request's tenant,
+// or nil if caching is disabled. Calls are timed as the request's cache phase.
+func Cache(c *fiber.Ctx) cache.Store {
+	return timing.Cache(c, CacheFor(ID(c)))
+}
+
+// CacheFor returns the default cache store scoped to tenantID, or nil if caching is disabled.
+func CacheFor(tenantID string) cache.Store {
+	store := cache.GetClient()
+	if store == nil {
+		return nil
+	}
+	return cache.WithPrefix(store, Prefix(tenantID, ""))
+}
+
+// Resolve sets the tenant from the request subdomain. Register it globally.
+// Unknown or malformed subdomains are ignored, so the bare API domain keeps working.
+func Resolve() fiber.Handler {
+	baseDomain := strings.ToLower(strings.TrimSpace(os.Getenv("TENANT_BASE_DOMAIN")))
+
+	return func(c *fiber.Ctx) error {
+		if id := FromHost(c.Hostname(), baseDomain); id != "" {
+			// The host is a view into the request's buffer, which Fiber reuses: the ID outlives
+			// the request in caches, captures and usage counters
+			c.Locals(LocalsKey, strings.Clone(id))
+		}
+		return c.Next()
+	}
+}
+
+// FromHost extracts the tenant from host when it is exactly one label below baseDomain.
+// Example: FromHost("acme.api.example.com:443", "api.example.com") == "acme".
+func FromHost(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	label, found := strings.CutSuffix(host, "."+baseDomain)
+	if !found || strings.Contains(label, ".") || !Valid(label) {
+		return ""
+	}
+	return label
+}
+
+// FromClaims sets the tenant from the JWT claims attached by middleware.Auth.
+// It must run after Auth. A claim that contradicts the subdomain tenant is rejected,
+// so a token issued for one customer can't be used on another customer's domain.
+// With TENANT_REQUIRED=true, requests that end up without a tenant are rejected.
+func FromClaims() fiber.Handler {
+	rules := loadClaimRules()
+
+	return func(c *fiber.Ctx) error {
+		claims, _ := c.Locals("claims").(jwt.MapClaims)
+		if err := rules.apply(c, claims); err != nil {
+			return apperror.Write(c, err)
+		}
+		return c.Next()
+	}
+}
+
+// Handshake returns the tenant check of WebSocket handshakes, which carry their token outside
+// Authorization (so FromClaims doesn't run) and may be anonymous. claims, nil for anonymous
+// clients, are checked as FromClaims does. A tenant subdomain also requires a valid token: the
+// connection's tenant decides which tenant-scoped updates it receives.
+func Handshake() func(c *fiber.Ctx, claims jwt.MapClaims) error {
+	rules := loadClaimRules()
+
+	return func(c *fiber.Ctx, claims jwt.MapClaims) error {
+		if claims == nil && ID(c) != "" {
+			return apperror.Unauthorized("A token is required on a tenant's domain")
+		}
+		if err := rules.apply(c, claims); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// claimRules are the settings of FromClaims and Handshake.
+type claimRules struct {
+	claimPath string // TENANT_CLAIM
+	required  bool   // TENANT_REQUIRED
+}
+
+func loadClaimRules() claimRules {
+	claimPath := os.Getenv("TENANT_CLAIM")
+	if claimPath == "" {
+		claimPath = Column
+	}
+	return claimRules{claimPath: claimPath, required: os.Getenv("TENANT_REQUIRED") == "true"}
+}
+
+// apply sets the tenant from claims, checking it against the subdomain tenant, and returns the
+// problem to answer with if the request must be rejected.
+func (r claimRules) apply(c *fiber.Ctx, claims jwt.MapClaims) *apperror.Error {
+	claimTenant := lookupClaim(claims, r.claimPath)
+	hostTenant := ID(c)
+
+	if claimTenant != "" {
+		if !Valid(claimTenant) {
+			return apperror.Forbidden("Invalid tenant")
+		}
+		if hostTenant != "" && hostTenant != claimTenant {
+			return apperror.Forbidden("Token does not belong to this tenant")
+		}
+		c.Locals(LocalsKey, claimTenant)
+	}
+
+	if r.required && ID(c) == "" {
+		return apperror.Forbidden("Tenant could not be resolved")
+	}
+	return nil
+}
+
+// lookupClaim returns the string claim at a dotted path, or "" if it is missing.
+func lookupClaim(claims jwt.MapClaims, path string) string {
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = object[part]
+	}
+
+	value, _ := current.(string)
+	return value
+}
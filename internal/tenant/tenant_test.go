@@ -0,0 +1,131 @@
+package tenant
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFromHost tests subdomain extraction.
+func TestFromHost(t *testing.T) {
+	testCases := []struct {
+		host     string
+		base     string
+		expected string
+	}{
+		{"acme.api.example.com", "api.example.com", "acme"},
+		{"ACME.api.example.com:8443", "api.example.com", "acme"},
+		{"api.example.com", "api.example.com", ""},
+		{"a.b.api.example.com", "api.example.com", ""},
+		{"acme.other.com", "api.example.com", ""},
+		{"evil:acme.api.example.com", "api.example.com", ""},
+		{"acme.api.example.com", "", ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, FromHost(tc.host, tc.base), "host %q", tc.host)
+	}
+}
+
+// TestPrefix tests that keys are only prefixed when there is a tenant.
+func TestPrefix(t *testing.T) {
+	assert.Equal(t, "price:1", Prefix("", "price:1"))
+	assert.Equal(t, "tenant:acme:price:1", Prefix("acme", "price:1"))
+}
+
+// TestCacheFor tests that tenant caches are isolated namespaces of the default store.
+func TestCacheFor(t *testing.T) {
+	original := cache.GetClient()
+	defer cache.SetDefault(original)
+
+	store := cache.NewMemoryStore()
+	cache.SetDefault(store)
+
+	require.NoError(t, CacheFor("acme").Set("price:1", "10", time.Minute))
+	require.NoError(t, CacheFor("").Set("price:1", "20", time.Minute))
+
+	value, _ := store.Get("tenant:acme:price:1")
+	assert.Equal(t, "10", value)
+	value, _ = CacheFor("globex").Get("price:1")
+	assert.Equal(t, "", value)
+	value, _ = CacheFor("").Get("price:1")
+	assert.Equal(t, "20", value)
+
+	cache.SetDefault(nil)
+	assert.Nil(t, CacheFor("acme"))
+}
+
+// TestFromClaims tests tenant resolution from JWT claims, including host mismatches.
+func TestFromClaims(t *testing.T) {
+	originalBase := os.Getenv("TENANT_BASE_DOMAIN")
+	originalClaim := os.Getenv("TENANT_CLAIM")
+	originalRequired := os.Getenv("TENANT_REQUIRED")
+	os.Setenv("TENANT_BASE_DOMAIN", "api.example.com")
+	os.Setenv("TENANT_CLAIM", "app_metadata.tenant_id")
+	os.Setenv("TENANT_REQUIRED", "true")
+	defer func() {
+		os.Setenv("TENANT_BASE_DOMAIN", originalBase)
+		os.Setenv("TENANT_CLAIM", originalClaim)
+		os.Setenv("TENANT_REQUIRED", originalRequired)
+	}()
+
+	app := fiber.New()
+	app.Use(Resolve())
+	app.Get("/api/whoami", func(c *fiber.Ctx) error {
+		// Stand-in for middleware.Auth: claims come from a header in this test
+		switch c.Get("X-Test-Tenant") {
+		case "":
+			c.Locals("claims", jwt.MapClaims{"sub": "u1"})
+		default:
+			c.Locals("claims", jwt.MapClaims{"sub": "u1", "app_metadata": map[string]interface{}{"tenant_id": c.Get("X-Test-Tenant")}})
+		}
+		return c.Next()
+	}, FromClaims(), func(c *fiber.Ctx) error {
+		return c.SendString(ID(c))
+	})
+
+	testCases := []struct {
+		name        string
+		host        string
+		claimTenant string
+		status      int
+		tenant      string
+	}{
+		{"claim only", "api.example.com", "acme", fiber.StatusOK, "acme"},
+		{"host only", "acme.api.example.com", "", fiber.StatusOK, "acme"},
+		{"host and claim agree", "acme.api.example.com", "acme", fiber.StatusOK, "acme"},
+		{"host and claim disagree", "globex.api.example.com", "acme", fiber.StatusForbidden, ""},
+		{"invalid claim", "api.example.com", "Acme:Corp", fiber.StatusForbidden, ""},
+		{"no tenant but required", "api.example.com", "", fiber.StatusForbidden, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/whoami", nil)
+			req.Host = tc.host
+			if tc.claimTenant != "" {
+				req.Header.Set("X-Test-Tenant", tc.claimTenant)
+			}
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+			if tc.status == fiber.StatusOK {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.tenant, string(body))
+			}
+		})
+	}
+}
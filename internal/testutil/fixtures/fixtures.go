@@ -0,0 +1,309 @@
+package fixtures
+
+// Package fixtures records real Supabase traffic into JSON files and replays it in tests.
+//
+// Contract tests run in replay mode by default, so CI needs no credentials. To refresh the
+// fixtures against a real project, run the tests with SUPABASE_RECORD=1 and real
+// SUPABASE_URL / SUPABASE_ANON_KEY values; the recorded files are rewritten in testdata/.
+// Review the diff: a changed payload shape there is exactly the protocol drift these tests catch.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Recording reports whether tests should talk to real Supabase and rewrite fixtures.
+func Recording() bool {
+	return os.Getenv("SUPABASE_RECORD") == "1"
+}
+
+// HTTPFixture is a recorded sequence of HTTP interactions.
+type HTTPFixture struct {
+	Description  string        `json:"description,omitempty"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request/response pair.
+// Only the parts needed for matching and replay are stored; request headers
+// (Authorization, apikey) are deliberately never written to disk.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest identifies a request for matching during replay.
+type RecordedRequest struct {
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body,omitempty"`      // JSON bodies, stored readable
+	BodyText string          `json:"body_text,omitempty"` // Non-JSON bodies
+}
+
+// RecordedResponse is the upstream response replayed to the caller.
+type RecordedResponse struct {
+	Status   int               `json:"status"`
+	Header   map[string]string `json:"header,omitempty"`
+	Body     json.RawMessage   `json:"body,omitempty"`      // JSON bodies, stored readable
+	BodyText string            `json:"body_text,omitempty"` // Non-JSON bodies
+}
+
+// recordedResponseHeaders lists the response headers worth keeping in fixtures.
+var recordedResponseHeaders = []string{"Content-Type"}
+
+// LoadHTTP reads an HTTP fixture file.
+func LoadHTTP(path string) (*HTTPFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture HTTPFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// Save writes the fixture as indented JSON, creating parent directories as needed.
+func (f *HTTPFixture) Save(path string) error {
+	return writeJSON(path, f)
+}
+
+// Recorder is an http.RoundTripper that forwards requests to a real transport
+// and records every interaction.
+type Recorder struct {
+	Transport http.RoundTripper // Real transport; defaults to http.DefaultTransport
+
+	mu      sync.Mutex
+	fixture HTTPFixture
+}
+
+// RoundTrip forwards the request and records the interaction.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readAndRestore(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := readAndRestore(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(map[string]string)
+	for _, name := range recordedResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			header[name] = value
+		}
+	}
+
+	recordedReq := RecordedRequest{Method: req.Method, Path: req.URL.Path}
+	recordedReq.Body, recordedReq.BodyText = splitBody(reqBody)
+
+	recordedResp := RecordedResponse{Status: resp.StatusCode, Header: header}
+	recordedResp.Body, recordedResp.BodyText = splitBody(respBody)
+
+	r.mu.Lock()
+	r.fixture.Interactions = append(r.fixture.Interactions, Interaction{
+		Request:  recordedReq,
+		Response: recordedResp,
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// Fixture returns everything recorded so far.
+func (r *Recorder) Fixture() *HTTPFixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := HTTPFixture{
+		Description:  r.fixture.Description,
+		Interactions: append([]Interaction(nil), r.fixture.Interactions...),
+	}
+	return &copied
+}
+
+// Replayer is an http.RoundTripper that answers requests from a fixture.
+// Requests are matched on method, path and (JSON-normalized) body; repeated
+// identical requests are served in recorded order.
+type Replayer struct {
+	mu   sync.Mutex
+	used []bool
+	fix  *HTTPFixture
+}
+
+// NewReplayer creates a Replayer for the given fixture.
+func NewReplayer(fixture *HTTPFixture) *Replayer {
+	return &Replayer{
+		fix:  fixture,
+		used: make([]bool, len(fixture.Interactions)),
+	}
+}
+
+// RoundTrip returns the first unused recorded response matching the request.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readAndRestore(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	wantBody := normalizeJSON(reqBody)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.fix.Interactions {
+		if r.used[i] {
+			continue
+		}
+		if interaction.Request.Method != req.Method || interaction.Request.Path != req.URL.Path {
+			continue
+		}
+		recordedBody := []byte(interaction.Request.Body)
+		if interaction.Request.BodyText != "" {
+			recordedBody = []byte(interaction.Request.BodyText)
+		}
+		if normalizeJSON(recordedBody) != wantBody {
+			continue
+		}
+
+		r.used[i] = true
+		return buildResponse(req, interaction.Response), nil
+	}
+
+	return nil, fmt.Errorf("fixtures: no recorded interaction for %s %s %s", req.Method, req.URL.Path, wantBody)
+}
+
+// buildResponse turns a recorded response into an *http.Response.
+func buildResponse(req *http.Request, recorded RecordedResponse) *http.Response {
+	header := make(http.Header)
+	for name, value := range recorded.Header {
+		header.Set(name, value)
+	}
+
+	body := []byte(recorded.Body)
+	if recorded.BodyText != "" {
+		body = []byte(recorded.BodyText)
+	}
+	return &http.Response{
+		StatusCode:    recorded.Status,
+		Status:        http.StatusText(recorded.Status),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// RealtimeFixture is a recorded sequence of raw Supabase Realtime messages.
+type RealtimeFixture struct {
+	Description string            `json:"description,omitempty"`
+	Messages    []json.RawMessage `json:"messages"`
+}
+
+// LoadRealtime reads a Realtime fixture file.
+func LoadRealtime(path string) (*RealtimeFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture RealtimeFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// Save writes the fixture as indented JSON, creating parent directories as needed.
+func (f *RealtimeFixture) Save(path string) error {
+	return writeJSON(path, f)
+}
+
+// Decode returns the messages decoded as generic JSON objects, the way the subscriber reads them.
+func (f *RealtimeFixture) Decode() ([]map[string]interface{}, error) {
+	messages := make([]map[string]interface{}, 0, len(f.Messages))
+	for i, raw := range f.Messages {
+		var message map[string]interface{}
+		if err := json.Unmarshal(raw, &message); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// readAndRestore reads a body fully and replaces it with a fresh reader so it can be read again.
+func readAndRestore(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, fmt.Errorf("fixtures: failed to read body: %w", err)
+	}
+
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// splitBody returns JSON bodies as raw JSON (readable in fixture files) and anything else as text.
+func splitBody(body []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ""
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body), ""
+	}
+	return nil, string(body)
+}
+
+// normalizeJSON re-encodes JSON so key order and whitespace don't affect matching.
+func normalizeJSON(body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+	normalized, _ := json.Marshal(value)
+	return string(normalized)
+}
+
+// writeJSON writes v as indented JSON to path.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,231 @@
+package testutil
+
+// Package testutil provides end-to-end test scaffolding: the full Fiber app wired to an
+// in-memory cache, a fresh WebSocket hub and a mock Supabase server, plus a WebSocket client.
+//
+// Typical usage from an external test package:
+//
+//	h := testutil.NewHarness(t, testutil.Options{})
+//	resp := h.Do(t, h.NewRequest(t, "GET", "/health", nil))
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/app"
+	"boilerplate/internal/audit"
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/egress"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/handlers"
+	"boilerplate/internal/health"
+	"boilerplate/internal/profile"
+	"boilerplate/internal/realtime"
+	"boilerplate/internal/resource"
+	"boilerplate/internal/search"
+	"boilerplate/internal/seo"
+	"boilerplate/internal/status"
+	"boilerplate/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestJWTSecret is the HS256 secret configured for the app under test.
+const TestJWTSecret = "testutil-jwt-secret"
+
+// Options customizes the harness.
+type Options struct {
+	// Env sets extra environment variables before the app is built (restored after the test).
+	Env map[string]string
+
+	// StartRealtime starts the Realtime subscriber against the mock Supabase server
+	// and waits until it has joined the channel.
+	StartRealtime bool
+}
+
+// Harness is a running instance of the full application for integration tests.
+type Harness struct {
+	App       *fiber.App
+	BaseURL   string // e.g. http://127.0.0.1:54321
+	WSURL     string // e.g. ws://127.0.0.1:54321
+	Cache     *cache.MemoryStore
+	Audit     *audit.MemoryStore
+	Deletion  *gdpr.MemoryStore
+	Profiles  *profile.MemoryStore
+	Storage   *storage.MemoryStore // Uploaded files; URLs start with https://storage.test
+	Resources *resource.MemoryStore
+	Hub       *handlers.Hub
+	Supabase  *MockSupabase
+}
+
+// NewHarness builds the app with fake dependencies and serves it on a random local port.
+// Everything is torn down automatically when the test ends.
+func NewHarness(t testing.TB, opts Options) *Harness {
+	t.Helper()
+
+	// Step 1: Start the mock Supabase server and point the app at it
+	supabase := NewMockSupabase(t)
+	t.Setenv("SUPABASE_URL", supabase.URL())
+	t.Setenv("SUPABASE_ANON_KEY", "testutil-anon-key")
+	t.Setenv("JWT_SECRET", TestJWTSecret)
+	// Subscribers of earlier tests may still report Realtime down: readiness doesn't require it
+	t.Setenv("READINESS_REQUIRED", "cache,supabase,jwks")
+	for key, value := range opts.Env {
+		t.Setenv(key, value)
+	}
+
+	// Step 2: Swap in the in-memory cache
+	originalCache := cache.GetClient()
+	store := cache.NewMemoryStore()
+	cache.SetDefault(store)
+	t.Cleanup(func() { cache.SetDefault(originalCache) })
+
+	// Step 2b: Keep audit records in memory so tests can inspect them
+	originalAudit := audit.DefaultStore
+	auditStore := audit.NewMemoryStore()
+	audit.SetDefault(auditStore)
+	t.Cleanup(func() { audit.SetDefault(originalAudit) })
+
+	// Step 2c: Same for account deletion requests
+	originalDeletion := gdpr.DefaultStore
+	deletionStore := gdpr.NewMemoryStore()
+	gdpr.SetDefault(deletionStore)
+	t.Cleanup(func() { gdpr.SetDefault(originalDeletion) })
+
+	// Step 2d: Profiles, uploaded files and resources too
+	originalProfiles := profile.DefaultStore
+	profileStore := profile.NewMemoryStore()
+	profile.SetDefault(profileStore)
+	t.Cleanup(func() { profile.SetDefault(originalProfiles) })
+
+	originalStorage := storage.Get()
+	objectStore := storage.NewMemoryStore("https://storage.test")
+	storage.SetDefault(objectStore)
+	t.Cleanup(func() { storage.SetDefault(originalStorage) })
+
+	originalResources := resource.DefaultStore
+	resourceStore := resource.NewMemoryStore()
+	resource.SetDefault(resourceStore)
+	t.Cleanup(func() { resource.SetDefault(originalResources) })
+
+	originalSearcher := search.DefaultSearcher
+	search.SetDefault(search.NewMemorySearcher())
+	t.Cleanup(func() { search.SetDefault(originalSearcher) })
+
+	// Sitemaps read the resources above; configure them from opts.Env (SITE_URL, ...)
+	originalSitemaps := seo.DefaultSitemaps
+	seo.Init()
+	t.Cleanup(func() { seo.SetDefault(originalSitemaps) })
+
+	// Step 2e: Start with no dependency reported down
+	status.Reset()
+	t.Cleanup(status.Reset)
+
+	// Step 3: Start a fresh WebSocket hub so tests don't share clients
+	originalHub := handlers.GetHub()
+	handlers.InitHub()
+	hub := handlers.GetHub()
+	t.Cleanup(func() { handlers.DefaultHub = originalHub })
+
+	// Step 4: Build the app from the configuration above and serve it on a random port
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	originalPolicy := egress.DefaultPolicy
+	egress.Init(cfg.Egress)
+	t.Cleanup(func() { egress.SetDefault(originalPolicy) })
+	health.Init(cfg) // Checks the mock Supabase and the in-memory cache
+	t.Cleanup(health.Reset)
+	fiberApp := app.NewApp(cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go fiberApp.Listener(ln)
+	t.Cleanup(func() { fiberApp.Shutdown() })
+
+	addr := ln.Addr().String()
+	h := &Harness{
+		App:       fiberApp,
+		BaseURL:   "http://" + addr,
+		WSURL:     "ws://" + addr,
+		Cache:     store,
+		Audit:     auditStore,
+		Deletion:  deletionStore,
+		Profiles:  profileStore,
+		Storage:   objectStore,
+		Resources: resourceStore,
+		Hub:       hub,
+		Supabase:  supabase,
+	}
+
+	// Step 5: Optionally connect the Realtime subscriber
+	if opts.StartRealtime {
+		if err := realtime.Start(cfg.Realtime); err != nil {
+			t.Fatalf("failed to start the Realtime subscriber: %v", err)
+		}
+		t.Cleanup(func() { _ = realtime.Stop(context.Background()) })
+		supabase.WaitForRealtimeJoin(t, 5*time.Second)
+	}
+
+	return h
+}
+
+// NewRequest builds a request against the running app. body may be empty.
+func (h *Harness) NewRequest(t testing.TB, method, path, body string) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, h.BaseURL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// Do sends a request to the running app. The response body is closed when the test ends.
+func (h *Harness) Do(t testing.TB, req *http.Request) *http.Response {
+	t.Helper()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request %s %s failed: %v", req.Method, req.URL.Path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// DialWS opens a WebSocket connection to path (e.g. "/ws") on the running app.
+func (h *Harness) DialWS(t testing.TB, path string, header http.Header) *WSClient {
+	t.Helper()
+	return DialWS(t, h.WSURL+path, header)
+}
+
+// WaitForClients blocks until the hub has exactly n registered clients or the timeout expires.
+func (h *Harness) WaitForClients(t testing.TB, n int, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if h.Hub.ClientCount() == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d WebSocket clients, have %d", n, h.Hub.ClientCount())
+}
@@ -0,0 +1,245 @@
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestKeyID is the kid of the RSA key served by MockSupabase's JWKS endpoint.
+const TestKeyID = "test-key"
+
+// MockSupabase is an in-process stand-in for a Supabase project.
+// It serves:
+//   - POST /graphql/v1: canned GraphQL responses (see SetGraphQLResponse)
+//   - GET /.well-known/jwks.json: a JWKS containing PrivateKey's public half
+//   - GET /realtime/v1/websocket: a Phoenix-style Realtime socket (see PushRealtime)
+//   - GET /rest/v1/artist_metrics: no rows, for the Realtime backfill
+//   - GET /rest/v1/: an OpenAPI description with the artist_metrics columns (schema drift checks)
+type MockSupabase struct {
+	Server     *httptest.Server
+	PrivateKey *rsa.PrivateKey // Signs RS256 tokens accepted via the JWKS endpoint
+
+	mu              sync.Mutex
+	graphQLStatus   int
+	graphQLBody     string
+	graphQLRequests []RecordedRequest
+	realtimeConns   []*websocket.Conn
+	realtimeJoins   []map[string]interface{}
+	joined          chan struct{}
+}
+
+// RecordedRequest is a request received by the mock server.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// NewMockSupabase starts a mock Supabase server. It is closed automatically when the test ends.
+func NewMockSupabase(t testing.TB) *MockSupabase {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	m := &MockSupabase{
+		PrivateKey:    key,
+		graphQLStatus: http.StatusOK,
+		graphQLBody:   `{"data":{"artists":[]}}`,
+		joined:        make(chan struct{}, 16),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql/v1", m.handleGraphQL)
+	mux.HandleFunc("/.well-known/jwks.json", m.handleJWKS)
+	mux.HandleFunc("/realtime/v1/websocket", m.handleRealtime)
+	mux.HandleFunc("/rest/v1/artist_metrics", m.handleArtistMetrics)
+	mux.HandleFunc("/rest/v1/", m.handleOpenAPI)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// URL returns the base URL to use as SUPABASE_URL.
+func (m *MockSupabase) URL() string {
+	return m.Server.URL
+}
+
+// Close closes all Realtime connections and shuts the server down.
+func (m *MockSupabase) Close() {
+	m.mu.Lock()
+	for _, conn := range m.realtimeConns {
+		conn.Close()
+	}
+	m.realtimeConns = nil
+	m.mu.Unlock()
+
+	m.Server.Close()
+}
+
+// SetGraphQLResponse sets the status and JSON body returned for every GraphQL request.
+func (m *MockSupabase) SetGraphQLResponse(status int, body string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.graphQLStatus = status
+	m.graphQLBody = body
+}
+
+// GraphQLRequests returns a copy of all GraphQL requests received so far.
+func (m *MockSupabase) GraphQLRequests() []RecordedRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RecordedRequest(nil), m.graphQLRequests...)
+}
+
+// handleGraphQL records the request and replies with the configured response.
+func (m *MockSupabase) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	m.mu.Lock()
+	m.graphQLRequests = append(m.graphQLRequests, RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	status, respBody := m.graphQLStatus, m.graphQLBody
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, respBody)
+}
+
+// handleArtistMetrics answers the Realtime backfill after a reconnect: no rows changed.
+func (m *MockSupabase) handleArtistMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`[]`))
+}
+
+// handleOpenAPI describes the artist_metrics table like PostgREST's root endpoint.
+func (m *MockSupabase) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/rest/v1/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/openapi+json")
+	io.WriteString(w, `{"definitions": {"artist_metrics": {"properties": {
+		"artist_id": {"type": "string"}, "price": {"type": "number"},
+		"tenant_id": {"type": "string"}, "updated_at": {"type": "string"}}}}}`)
+}
+
+// handleJWKS serves the public half of PrivateKey in JWKS format.
+func (m *MockSupabase) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := m.PrivateKey.PublicKey
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": TestKeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jwks)
+}
+
+// handleRealtime upgrades to a WebSocket and records phx_join messages from the subscriber.
+func (m *MockSupabase) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.realtimeConns = append(m.realtimeConns, conn)
+	m.mu.Unlock()
+
+	// Read loop: record joins, ignore everything else (e.g. heartbeats)
+	for {
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg["event"] == "phx_join" {
+			m.mu.Lock()
+			m.realtimeJoins = append(m.realtimeJoins, msg)
+			m.mu.Unlock()
+
+			select {
+			case m.joined <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// WaitForRealtimeJoin blocks until the subscriber has joined a channel or the timeout expires.
+func (m *MockSupabase) WaitForRealtimeJoin(t testing.TB, timeout time.Duration) {
+	t.Helper()
+
+	select {
+	case <-m.joined:
+	case <-time.After(timeout):
+		t.Fatalf("realtime subscriber did not join within %s", timeout)
+	}
+}
+
+// RealtimeJoins returns a copy of all phx_join messages received so far.
+func (m *MockSupabase) RealtimeJoins() []map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]map[string]interface{}(nil), m.realtimeJoins...)
+}
+
+// PushRealtime sends a message to every connected Realtime subscriber.
+func (m *MockSupabase) PushRealtime(t testing.TB, message interface{}) {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, conn := range m.realtimeConns {
+		if err := conn.WriteJSON(message); err != nil {
+			t.Fatalf("failed to push realtime message: %v", err)
+		}
+	}
+}
+
+// PushPriceChange sends a postgres_changes event for artist_metrics with the given price.
+func (m *MockSupabase) PushPriceChange(t testing.TB, eventType, artistID string, price float64) {
+	t.Helper()
+
+	m.PushRealtime(t, map[string]interface{}{
+		"topic": "realtime:public:artist_metrics",
+		"event": "postgres_changes",
+		"payload": map[string]interface{}{
+			"eventType": eventType,
+			"new": map[string]interface{}{
+				"artist_id": artistID,
+				"price":     price,
+			},
+		},
+	})
+}
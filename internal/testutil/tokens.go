@@ -0,0 +1,47 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// HS256Token returns a valid HS256 token for userID signed with TestJWTSecret.
+// Extra claims are merged in (and may override the defaults).
+func HS256Token(t testing.TB, userID string, extra jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, buildClaims(userID, extra))
+	signed, err := token.SignedString([]byte(TestJWTSecret))
+	if err != nil {
+		t.Fatalf("failed to sign HS256 token: %v", err)
+	}
+	return signed
+}
+
+// RS256Token returns a valid RS256 token for userID signed with the mock Supabase key,
+// so it validates against the mock JWKS endpoint.
+func (m *MockSupabase) RS256Token(t testing.TB, userID string, extra jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, buildClaims(userID, extra))
+	token.Header["kid"] = TestKeyID
+	signed, err := token.SignedString(m.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to sign RS256 token: %v", err)
+	}
+	return signed
+}
+
+// buildClaims returns standard claims for userID expiring in one hour, merged with extra.
+func buildClaims(userID string, extra jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for key, value := range extra {
+		claims[key] = value
+	}
+	return claims
+}
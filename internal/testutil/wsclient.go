@@ -0,0 +1,76 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSClient is a small WebSocket client for integration tests.
+type WSClient struct {
+	Conn *websocket.Conn
+}
+
+// DialWS connects to a WebSocket URL. The connection is closed when the test ends.
+func DialWS(t testing.TB, url string, header http.Header) *WSClient {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("failed to dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &WSClient{Conn: conn}
+}
+
+// SendText sends a text frame.
+func (c *WSClient) SendText(t testing.TB, message string) {
+	t.Helper()
+
+	if err := c.Conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatalf("failed to send WebSocket message: %v", err)
+	}
+}
+
+// SendJSON sends v encoded as a JSON text frame.
+func (c *WSClient) SendJSON(t testing.TB, v interface{}) {
+	t.Helper()
+
+	if err := c.Conn.WriteJSON(v); err != nil {
+		t.Fatalf("failed to send WebSocket JSON: %v", err)
+	}
+}
+
+// ReadMessage reads the next frame, failing the test if none arrives within timeout.
+func (c *WSClient) ReadMessage(t testing.TB, timeout time.Duration) []byte {
+	t.Helper()
+
+	c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	_, message, err := c.Conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read WebSocket message: %v", err)
+	}
+	return message
+}
+
+// ReadJSON reads the next frame and decodes it into v.
+func (c *WSClient) ReadJSON(t testing.TB, v interface{}, timeout time.Duration) {
+	t.Helper()
+
+	message := c.ReadMessage(t, timeout)
+	if err := json.Unmarshal(message, v); err != nil {
+		t.Fatalf("failed to decode WebSocket message %q: %v", message, err)
+	}
+}
+
+// Close closes the connection with a normal close frame.
+func (c *WSClient) Close() {
+	c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.Conn.Close()
+}
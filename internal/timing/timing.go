@@ -0,0 +1,275 @@
+package timing
+
+// Package timing measures where a request spends its time and reports slow requests.
+//
+// Middleware() stores a Timings value in the request context. Code along the way marks phases:
+//
+//	stop := timing.Start(c, timing.PhaseUpstream)
+//	resp, err := client.Do(req)
+//	stop()
+//
+// Phases can nest; each phase is charged only its own time (a cache lookup inside
+// serialization counts as cache, not both), so the phases plus "other" add up to the total.
+// Requests slower than SLOW_REQUEST_THRESHOLD are logged with the breakdown and counted
+// in Prometheus, so "the API is slow" can be narrowed down to a dependency.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Phases measured by the application. Any other name works too.
+const (
+	PhaseAuth          = "auth"
+	PhaseCache         = "cache"
+	PhaseUpstream      = "upstream"
+	PhaseSerialization = "serialization"
+
+	// PhaseOther is the time not covered by any phase (routing, middleware, handler logic).
+	PhaseOther = "other"
+)
+
+// localsKey is where the request's Timings are stored.
+const localsKey = "timings"
+
+// defaultThreshold is used when SLOW_REQUEST_THRESHOLD is not set.
+const defaultThreshold = time.Second
+
+// Timings accumulates phase durations for one request. Safe for concurrent use.
+type Timings struct {
+	mu     sync.Mutex
+	phases map[string]time.Duration
+	stack  []*timer // Running phases, innermost last
+}
+
+// timer is one running phase.
+type timer struct {
+	phase    string
+	start    time.Time
+	children time.Duration // Time spent in nested phases
+}
+
+// newTimings creates an empty set of timings.
+func newTimings() *Timings {
+	return &Timings{phases: make(map[string]time.Duration)}
+}
+
+// From returns the request's timings, or nil when Middleware() isn't installed.
+func From(c *fiber.Ctx) *Timings {
+	timings, _ := c.Locals(localsKey).(*Timings)
+	return timings
+}
+
+// Start begins timing phase and returns the function that ends it. Calling the returned
+// function more than once is harmless, so it can be both deferred and called early.
+// Without Middleware() installed it does nothing.
+func Start(c *fiber.Ctx, phase string) func() {
+	timings := From(c)
+	if timings == nil {
+		return func() {}
+	}
+	return timings.Start(phase)
+}
+
+// Start begins timing phase; see the package-level Start.
+func (t *Timings) Start(phase string) func() {
+	running := &timer{phase: phase, start: time.Now()}
+
+	t.mu.Lock()
+	t.stack = append(t.stack, running)
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { t.stop(running) })
+	}
+}
+
+// stop charges the timer's own time to its phase and its full time to its parent.
+func (t *Timings) stop(running *timer) {
+	elapsed := time.Since(running.start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Remove the timer from the stack (normally the last entry)
+	index := -1
+	for i := len(t.stack) - 1; i >= 0; i-- {
+		if t.stack[i] == running {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+	t.stack = append(t.stack[:index], t.stack[index+1:]...)
+
+	self := elapsed - running.children
+	if self < 0 {
+		self = 0
+	}
+	t.phases[running.phase] += self
+
+	if index > 0 {
+		t.stack[index-1].children += elapsed
+	}
+}
+
+// Phases returns a copy of the accumulated phase durations.
+func (t *Timings) Phases() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := make(map[string]time.Duration, len(t.phases))
+	for phase, duration := range t.phases {
+		phases[phase] = duration
+	}
+	return phases
+}
+
+// getThreshold returns SLOW_REQUEST_THRESHOLD (a Go duration, 0 disables), default 1s.
+func getThreshold() time.Duration {
+	raw := os.Getenv("SLOW_REQUEST_THRESHOLD")
+	if raw == "" {
+		return defaultThreshold
+	}
+	threshold, err := time.ParseDuration(raw)
+	if err != nil || threshold < 0 {
+		log.Printf("WARNING: Invalid SLOW_REQUEST_THRESHOLD %q, using %s", raw, defaultThreshold)
+		return defaultThreshold
+	}
+	return threshold
+}
+
+// Middleware tracks phase timings for every request and reports requests slower than
+// SLOW_REQUEST_THRESHOLD (default 1s; "0" turns reporting off). Register it globally,
+// early in the chain so the total covers the other middleware.
+func Middleware() fiber.Handler {
+	threshold := getThreshold()
+
+	return func(c *fiber.Ctx) error {
+		timings := newTimings()
+		c.Locals(localsKey, timings)
+
+		start := time.Now()
+		err := c.Next()
+		total := time.Since(start)
+
+		if threshold > 0 && total >= threshold {
+			reportSlow(c, timings, total, threshold, err)
+		}
+		return err
+	}
+}
+
+// reportSlow logs the breakdown and updates the slow request metrics.
+func reportSlow(c *fiber.Ctx, timings *Timings, total, threshold time.Duration, err error) {
+	phases := timings.Phases()
+
+	var covered time.Duration
+	for _, duration := range phases {
+		covered += duration
+	}
+	if other := total - covered; other > 0 {
+		phases[PhaseOther] = other
+	}
+
+	status := c.Response().StatusCode()
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		status = fiberErr.Code
+	}
+
+	route := routeLabel(c)
+	metrics.SlowRequests.WithLabelValues(route).Inc()
+	for phase, duration := range phases {
+		metrics.SlowRequestPhaseSeconds.WithLabelValues(phase).Add(duration.Seconds())
+	}
+
+	log.Printf("WARNING: Slow request: %s %s took %s (threshold %s, status %d) [%s]",
+		c.Method(), route, total.Round(time.Microsecond), threshold, status, formatPhases(phases))
+}
+
+// formatPhases renders phases slowest first, e.g. "upstream=1.2s cache=3ms other=1ms".
+func formatPhases(phases map[string]time.Duration) string {
+	names := make([]string, 0, len(phases))
+	for name := range phases {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if phases[names[i]] != phases[names[j]] {
+			return phases[names[i]] > phases[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, phases[name].Round(time.Microsecond)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// routeLabel returns the matched route pattern rather than the raw path, which may contain IDs.
+func routeLabel(c *fiber.Ctx) string {
+	if route := c.Route(); route != nil && route.Path != "" {
+		return route.Path
+	}
+	return "unmatched"
+}
+
+// Cache wraps store so every call is timed as the cache phase of the request.
+// Returns nil for a nil store, so "caching disabled" checks keep working.
+func Cache(c *fiber.Ctx, store cache.Store) cache.Store {
+	timings := From(c)
+	if store == nil || timings == nil {
+		return store
+	}
+	return &timedStore{store: store, timings: timings}
+}
+
+// timedStore times each cache call.
+type timedStore struct {
+	store   cache.Store
+	timings *Timings
+}
+
+func (s *timedStore) Get(key string) (string, error) {
+	defer s.timings.Start(PhaseCache)()
+	return s.store.Get(key)
+}
+
+func (s *timedStore) Set(key, value string, ttl time.Duration) error {
+	defer s.timings.Start(PhaseCache)()
+	return s.store.Set(key, value, ttl)
+}
+
+func (s *timedStore) Del(key string) error {
+	defer s.timings.Start(PhaseCache)()
+	return s.store.Del(key)
+}
+
+func (s *timedStore) Incr(key string) (int64, error) {
+	defer s.timings.Start(PhaseCache)()
+	return s.store.Incr(key)
+}
+
+func (s *timedStore) Expire(key string, ttl time.Duration) error {
+	defer s.timings.Start(PhaseCache)()
+	return s.store.Expire(key, ttl)
+}
+
+func (s *timedStore) MGet(keys ...string) ([]string, error) {
+	defer s.timings.Start(PhaseCache)()
+	return s.store.MGet(keys...)
+}
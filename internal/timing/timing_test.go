@@ -0,0 +1,99 @@
+package timing
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTimings_NestedPhasesChargeSelfTime tests that a nested phase is not counted twice.
+func TestTimings_NestedPhasesChargeSelfTime(t *testing.T) {
+	timings := newTimings()
+	start := time.Now()
+
+	stopOuter := timings.Start(PhaseSerialization)
+	time.Sleep(20 * time.Millisecond)
+	stopInner := timings.Start(PhaseCache)
+	time.Sleep(30 * time.Millisecond)
+	stopInner()
+	stopInner() // Stopping twice is harmless
+	stopOuter()
+	total := time.Since(start)
+
+	// Both phases got their share, and together they don't exceed the wall time
+	phases := timings.Phases()
+	assert.GreaterOrEqual(t, phases[PhaseCache], 30*time.Millisecond)
+	assert.GreaterOrEqual(t, phases[PhaseSerialization], 20*time.Millisecond)
+	assert.LessOrEqual(t, phases[PhaseSerialization]+phases[PhaseCache], total)
+}
+
+// TestMiddleware_ReportsSlowRequests tests the log line and metrics for a slow request,
+// including cache calls timed through Cache().
+func TestMiddleware_ReportsSlowRequests(t *testing.T) {
+	originalThreshold := os.Getenv("SLOW_REQUEST_THRESHOLD")
+	defer os.Setenv("SLOW_REQUEST_THRESHOLD", originalThreshold)
+	os.Setenv("SLOW_REQUEST_THRESHOLD", "10ms")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	store := cache.NewMemoryStore()
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/slow/:id", func(c *fiber.Ctx) error {
+		stop := Start(c, PhaseUpstream)
+		time.Sleep(20 * time.Millisecond)
+		stop()
+
+		_, err := Cache(c, store).Get("price:1")
+		require.NoError(t, err)
+		return c.SendString("ok")
+	})
+	app.Get("/fast", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	before := promtest.ToFloat64(metrics.SlowRequests.WithLabelValues("/slow/:id"))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/fast", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NotContains(t, logs.String(), "Slow request")
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/slow/42", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	assert.Contains(t, logs.String(), "WARNING: Slow request: GET /slow/:id")
+	assert.Contains(t, logs.String(), "upstream=")
+	assert.Contains(t, logs.String(), "cache=")
+	assert.Equal(t, before+1, promtest.ToFloat64(metrics.SlowRequests.WithLabelValues("/slow/:id")))
+	assert.Greater(t, promtest.ToFloat64(metrics.SlowRequestPhaseSeconds.WithLabelValues(PhaseUpstream)), 0.0)
+}
+
+// TestStartAndCache_WithoutMiddleware tests that timing calls are no-ops without the middleware.
+func TestStartAndCache_WithoutMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		Start(c, PhaseAuth)()
+		assert.Nil(t, Cache(c, nil))
+		store := cache.NewMemoryStore()
+		assert.Same(t, store, Cache(c, store))
+		return nil
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+}
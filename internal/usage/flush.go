@@ -0,0 +1,129 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"boilerplate/internal/tenant"
+)
+
+// RunFlusher copies the counters this instance incremented to the rollup store every
+// USAGE_FLUSH_INTERVAL. Call it in a goroutine after Init(); it runs until ctx is cancelled. Call
+// Flush once more on shutdown so the last interval isn't lost.
+func RunFlusher(ctx context.Context) {
+	interval := getFlushInterval()
+	slog.Info("Usage flush job started", "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := Flush(ctx); err != nil {
+			slog.Error("Failed to flush usage rollups", "error", err)
+		}
+	}
+}
+
+// Flush writes the current value of every counter incremented since the last flush to the rollup
+// store. Counters that could not be read or written stay pending for the next flush.
+func Flush(ctx context.Context) error {
+	if DefaultStore == nil {
+		return nil
+	}
+
+	// Step 1: Take the pending counters
+	dirtyMu.Lock()
+	pending := dirty
+	dirty = make(map[counter]struct{})
+	dirtyMu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Step 2: Read their values, one MGET per tenant
+	byTenant := make(map[string][]counter)
+	for k := range pending {
+		byTenant[k.tenantID] = append(byTenant[k.tenantID], k)
+	}
+
+	updatedAt := now().UTC()
+	rollups := make([]Rollup, 0, len(pending))
+	var failed []counter
+	var readErr error
+	for tenantID, keys := range byTenant {
+		values, err := readCounters(tenantID, keys)
+		if err != nil {
+			failed = append(failed, keys...)
+			readErr = err
+			continue
+		}
+		for i, k := range keys {
+			if values[i] == "" {
+				continue // Expired before it was flushed; the stored rollup is the last word
+			}
+			rollups = append(rollups, k.rollup(values[i], updatedAt))
+		}
+	}
+
+	// Step 3: Store them
+	if len(rollups) > 0 {
+		if err := DefaultStore.Save(ctx, rollups); err != nil {
+			for _, rollup := range rollups {
+				failed = append(failed, counter{rollup.TenantID, rollup.Subject, rollup.Period, rollup.PeriodStart})
+			}
+			requeue(failed)
+			return fmt.Errorf("failed to save usage rollups: %w", err)
+		}
+	}
+
+	requeue(failed)
+	if readErr != nil {
+		return fmt.Errorf("failed to read usage counters: %w", readErr)
+	}
+	return nil
+}
+
+// readCounters returns the cached values of keys in the tenant's key space.
+func readCounters(tenantID string, keys []counter) ([]string, error) {
+	store := tenant.CacheFor(tenantID)
+	if store == nil {
+		return nil, fmt.Errorf("cache not initialized")
+	}
+
+	cacheKeys := make([]string, len(keys))
+	for i, k := range keys {
+		cacheKeys[i] = k.key()
+	}
+	return store.MGet(cacheKeys...)
+}
+
+// requeue marks counters as pending again after a failed flush.
+func requeue(counters []counter) {
+	dirtyMu.Lock()
+	defer dirtyMu.Unlock()
+	for _, k := range counters {
+		dirty[k] = struct{}{}
+	}
+}
+
+// getFlushInterval returns USAGE_FLUSH_INTERVAL, defaulting to 1 minute if unset or invalid.
+func getFlushInterval() time.Duration {
+	value := os.Getenv("USAGE_FLUSH_INTERVAL")
+	if value == "" {
+		return time.Minute
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		slog.Warn("Invalid USAGE_FLUSH_INTERVAL, using 1m", "value", value)
+		return time.Minute
+	}
+	return parsed
+}
@@ -0,0 +1,71 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps rollups in process memory.
+// It is used in tests and as a fallback when Postgres is not configured.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	rollups map[counter]Rollup
+}
+
+// NewMemoryStore creates an empty in-memory rollup store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rollups: make(map[counter]Rollup)}
+}
+
+// Save inserts or replaces rollups.
+func (m *MemoryStore) Save(ctx context.Context, rollups []Rollup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rollup := range rollups {
+		m.rollups[counter{rollup.TenantID, rollup.Subject, rollup.Period, rollup.PeriodStart}] = rollup
+	}
+	return nil
+}
+
+// List returns matching rollups, newest period first, then by subject.
+func (m *MemoryStore) List(ctx context.Context, query Query) ([]Rollup, error) {
+	m.mu.RLock()
+	matched := make([]Rollup, 0)
+	for _, rollup := range m.rollups {
+		if query.TenantID != nil && rollup.TenantID != *query.TenantID {
+			continue
+		}
+		if query.Subject != "" && rollup.Subject != query.Subject {
+			continue
+		}
+		if rollup.Period != query.Period {
+			continue
+		}
+		if (query.From != "" && rollup.PeriodStart < query.From) || (query.To != "" && rollup.PeriodStart > query.To) {
+			continue
+		}
+		matched = append(matched, rollup)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].PeriodStart != matched[j].PeriodStart {
+			return matched[i].PeriodStart > matched[j].PeriodStart
+		}
+		if matched[i].TenantID != matched[j].TenantID {
+			return matched[i].TenantID < matched[j].TenantID
+		}
+		return matched[i].Subject < matched[j].Subject
+	})
+
+	if query.Offset >= len(matched) {
+		return []Rollup{}, nil
+	}
+	matched = matched[query.Offset:]
+	if query.Limit > 0 && len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+	return matched, nil
+}
@@ -0,0 +1,133 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/egress"
+)
+
+// PostgRESTStore keeps rollups in Postgres through the Supabase REST API (PostgREST).
+// It uses the service role key; the usage_rollups table has RLS enabled with a read-only policy
+// for the owner.
+type PostgRESTStore struct {
+	baseURL    string // e.g. https://xxx.supabase.co/rest/v1/usage_rollups
+	serviceKey string
+	client     *http.Client
+}
+
+// NewPostgRESTStore creates a store for the given Supabase project.
+func NewPostgRESTStore(supabaseURL, serviceKey string) *PostgRESTStore {
+	return &PostgRESTStore{
+		baseURL:    strings.TrimSuffix(supabaseURL, "/") + "/rest/v1/" + tableName,
+		serviceKey: serviceKey,
+		client:     egress.NewClient(10 * time.Second),
+	}
+}
+
+// Save upserts rollups on their primary key (tenant_id, subject, period, period_start).
+func (s *PostgRESTStore) Save(ctx context.Context, rollups []Rollup) error {
+	body, err := json.Marshal(rollups)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage rollups: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("on_conflict", "tenant_id,subject,period,period_start")
+	resp, err := s.do(ctx, "POST", s.baseURL+"?"+params.Encode(), body, "resolution=merge-duplicates,return=minimal")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns matching rollups, newest period first, then by subject.
+func (s *PostgRESTStore) List(ctx context.Context, query Query) ([]Rollup, error) {
+	// Step 1: Build the PostgREST query string
+	params := url.Values{}
+	params.Set("select", "*")
+	params.Set("order", "period_start.desc,tenant_id.asc,subject.asc")
+	params.Set("period", "eq."+query.Period)
+	if query.TenantID != nil {
+		params.Set("tenant_id", "eq."+*query.TenantID)
+	}
+	if query.Subject != "" {
+		params.Set("subject", "eq."+query.Subject)
+	}
+	switch {
+	case query.From != "" && query.To != "":
+		params.Set("and", "(period_start.gte."+query.From+",period_start.lte."+query.To+")")
+	case query.From != "":
+		params.Set("period_start", "gte."+query.From)
+	case query.To != "":
+		params.Set("period_start", "lte."+query.To)
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if query.Offset > 0 {
+		params.Set("offset", strconv.Itoa(query.Offset))
+	}
+
+	// Step 2: Send the request
+	resp, err := s.do(ctx, "GET", s.baseURL+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Step 3: Decode the rows
+	rollups := make([]Rollup, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&rollups); err != nil {
+		return nil, fmt.Errorf("failed to parse usage rollups: %w", err)
+	}
+	return rollups, nil
+}
+
+// do sends an authenticated request and returns the response if it succeeded.
+// The caller must close the response body.
+func (s *PostgRESTStore) do(ctx context.Context, method, target string, body []byte, prefer string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Supabase: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Supabase REST error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+// Compile-time checks that both stores satisfy Store.
+var (
+	_ Store = (*PostgRESTStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,22 @@
+-- Request counts per user per day and per month (see internal/usage). Run this in the Supabase
+-- SQL editor. Rows are upserted by the backend with the latest count of each period.
+
+create table if not exists usage_rollups (
+    tenant_id    text        not null default '',
+    subject      text        not null,              -- Supabase auth user ID (the JWT sub)
+    period       text        not null check (period in ('day', 'month')),
+    period_start date        not null,              -- First day of the period
+    count        bigint      not null default 0,
+    updated_at   timestamptz not null default now(),
+    primary key (tenant_id, subject, period, period_start)
+);
+
+-- Admin reports and billing exports list one period across all subjects
+create index if not exists usage_rollups_period_idx on usage_rollups (period, period_start desc);
+
+-- The backend reads and writes with the service role key. This policy also lets users read their
+-- own usage directly through Supabase (e.g. supabase-js).
+alter table usage_rollups enable row level security;
+
+create policy "Usage is readable by its owner" on usage_rollups
+    for select using (auth.uid()::text = subject);
@@ -0,0 +1,256 @@
+package usage
+
+// Package usage counts the requests of every authenticated caller per day and per month, for
+// quotas, plan enforcement and billing exports. Rate limits (internal/middleware) only bound
+// bursts within a minute; this is the running total.
+//
+// Counting: the usage middleware increments two counters in the shared cache for each request
+// that reached an authenticated route, "usage:<subject>:day:2026-10-16" and
+// "usage:<subject>:month:2026-10" (scoped to the tenant). Every replica increments the same
+// counters, so the totals are exact across instances. Requests rejected by the rate limiter (429)
+// and server errors (5xx) are not counted.
+//
+// Rollups: every USAGE_FLUSH_INTERVAL the flusher copies the counters this instance touched to the
+// usage_rollups table in Postgres (see schema.sql). It writes the counter's value, not a delta, so
+// replicas flushing the same counter agree and a retried flush can't count twice. The table keeps
+// the history after the counters expire and is what the admin report and billing exports read.
+//
+// Subjects are Supabase user IDs (the JWT sub); times are UTC.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/gdpr"
+	"boilerplate/internal/startup"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Periods counted.
+const (
+	Day   = "day"
+	Month = "month"
+)
+
+// Counter lifetimes in the cache. They outlive their period so the flush after it ends still
+// reads the final count.
+const (
+	dayTTL   = 48 * time.Hour
+	monthTTL = 40 * 24 * time.Hour
+)
+
+// Rollup is the request count of one subject in one period.
+type Rollup struct {
+	TenantID    string    `json:"tenant_id"`    // "" without a tenant
+	Subject     string    `json:"subject"`      // User ID
+	Period      string    `json:"period"`       // day or month
+	PeriodStart string    `json:"period_start"` // First day of the period, e.g. 2026-10-01
+	Count       int64     `json:"count"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Query filters and paginates rollups. Results are newest period first, then by subject.
+type Query struct {
+	TenantID *string // Optional exact match (nil for every tenant)
+	Subject  string  // Optional exact match
+	Period   string  // day or month (required)
+	From, To string  // Optional inclusive bounds on PeriodStart (YYYY-MM-DD)
+	Limit    int
+	Offset   int
+}
+
+// Store persists rollups.
+type Store interface {
+	// Save inserts rollups, replacing the count of those already stored for the same tenant,
+	// subject, period and start.
+	Save(ctx context.Context, rollups []Rollup) error
+
+	// List returns rollups matching the query.
+	List(ctx context.Context, query Query) ([]Rollup, error)
+}
+
+// DefaultStore is the rollup store. It is nil until Init() or SetDefault() is called.
+var DefaultStore Store
+
+// tableName is the Postgres table holding rollups (see schema.sql).
+const tableName = "usage_rollups"
+
+// now is the clock; overridden in tests.
+var now = time.Now
+
+// Init initializes the rollup store.
+//
+// With SUPABASE_URL and SUPABASE_SERVICE_ROLE_KEY set, rollups go to Postgres through the Supabase
+// REST API. Otherwise an in-memory store is used, which is lost on restart.
+func Init() {
+	supabaseURL := os.Getenv("SUPABASE_URL")
+	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	if supabaseURL == "" || serviceKey == "" {
+		slog.Warn("SUPABASE_SERVICE_ROLE_KEY not set, usage rollups are kept in memory only")
+		startup.Report("usage", true, "in memory (SUPABASE_SERVICE_ROLE_KEY not set)")
+		DefaultStore = NewMemoryStore()
+		return
+	}
+
+	if err := gdpr.RegisterTable(tableName, "subject"); err != nil {
+		slog.Warn("Failed to register usage rollups for GDPR erasure", "error", err)
+	}
+	DefaultStore = NewPostgRESTStore(supabaseURL, serviceKey)
+	slog.Info("Usage accounting initialized (Supabase Postgres)")
+	startup.Report("usage", true, "Supabase Postgres, flushed every "+getFlushInterval().String())
+}
+
+// SetDefault replaces the default store. Mainly useful in tests.
+func SetDefault(store Store) {
+	DefaultStore = store
+}
+
+// counter identifies one cache counter.
+type counter struct {
+	tenantID    string
+	subject     string
+	period      string
+	periodStart string
+}
+
+// key returns the counter's cache key (within the tenant's key space).
+func (k counter) key() string {
+	start := k.periodStart
+	if k.period == Month {
+		start = start[:len("2006-01")]
+	}
+	return "usage:" + k.subject + ":" + k.period + ":" + start
+}
+
+// counters returns the day and month counters of subject at t.
+func counters(tenantID, subject string, t time.Time) (day, month counter) {
+	t = t.UTC()
+	day = counter{tenantID: tenantID, subject: subject, period: Day, periodStart: t.Format(time.DateOnly)}
+	month = counter{tenantID: tenantID, subject: subject, period: Month, periodStart: t.Format("2006-01") + "-01"}
+	return day, month
+}
+
+// dirty holds the counters incremented since the last flush.
+var (
+	dirtyMu sync.Mutex
+	dirty   = make(map[counter]struct{})
+)
+
+// Record counts one request of subject.
+func Record(tenantID, subject string) error {
+	// The counters stay in dirty until the next flush: they must not share memory with the
+	// request (Fiber's strings are views into its buffer, which is reused)
+	tenantID, subject = strings.Clone(tenantID), strings.Clone(subject)
+	store := tenant.CacheFor(tenantID)
+	if store == nil {
+		return fmt.Errorf("cache not initialized")
+	}
+
+	// Both counters in one round trip, then their TTLs in a second when they were just created
+	day, month := counters(tenantID, subject, now())
+	results, err := cache.Pipeline(store,
+		cache.Command{Name: cache.CmdIncr, Key: day.key()},
+		cache.Command{Name: cache.CmdIncr, Key: month.key()},
+	)
+	if err != nil {
+		return err
+	}
+	var expires []cache.Command
+	for i, c := range []struct {
+		counter counter
+		ttl     time.Duration
+	}{{day, dayTTL}, {month, monthTTL}} {
+		if results[i].Err != nil {
+			return results[i].Err
+		}
+		if results[i].Int == 1 {
+			expires = append(expires, cache.Command{Name: cache.CmdExpire, Key: c.counter.key(), TTL: c.ttl})
+		}
+	}
+	if len(expires) > 0 {
+		results, err := cache.Pipeline(store, expires...)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				return result.Err
+			}
+		}
+	}
+
+	dirtyMu.Lock()
+	dirty[day] = struct{}{}
+	dirty[month] = struct{}{}
+	dirtyMu.Unlock()
+	return nil
+}
+
+// Current returns the live request counts of subject for today and the current month.
+func Current(tenantID, subject string) (day, month Rollup, err error) {
+	store := tenant.CacheFor(tenantID)
+	if store == nil {
+		return Rollup{}, Rollup{}, fmt.Errorf("cache not initialized")
+	}
+
+	t := now().UTC()
+	dayCounter, monthCounter := counters(tenantID, subject, t)
+	values, err := store.MGet(dayCounter.key(), monthCounter.key())
+	if err != nil {
+		return Rollup{}, Rollup{}, err
+	}
+	return dayCounter.rollup(values[0], t), monthCounter.rollup(values[1], t), nil
+}
+
+// rollup converts a counter and its cached value ("" for no requests yet) to a Rollup.
+func (k counter) rollup(value string, updatedAt time.Time) Rollup {
+	count, _ := strconv.ParseInt(value, 10, 64)
+	return Rollup{
+		TenantID:    k.tenantID,
+		Subject:     k.subject,
+		Period:      k.period,
+		PeriodStart: k.periodStart,
+		Count:       count,
+		UpdatedAt:   updatedAt,
+	}
+}
+
+// Middleware counts the requests of authenticated callers (see Record). It runs the request
+// first, because the caller is only known once the route's Auth has run. Counting fails open: a
+// cache outage is logged and the request is not counted. Without a cache nothing is counted.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		userID, _ := c.Locals("user").(string)
+		if userID == "" || cache.GetClient() == nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		if status == fiber.StatusTooManyRequests || status >= fiber.StatusInternalServerError {
+			return err
+		}
+
+		if recordErr := Record(tenant.ID(c), userID); recordErr != nil {
+			slog.Warn("Failed to count request usage", "user_id", userID, "error", recordErr)
+		}
+		return err
+	}
+}
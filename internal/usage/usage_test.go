@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setup gives one test a memory cache and rollup store and a fixed clock.
+func setup(t *testing.T, at time.Time) *MemoryStore {
+	t.Helper()
+	originalCache, originalStore, originalNow := cache.GetClient(), DefaultStore, now
+	cache.SetDefault(cache.NewMemoryStore())
+	store := NewMemoryStore()
+	SetDefault(store)
+	now = func() time.Time { return at }
+	t.Cleanup(func() {
+		cache.SetDefault(originalCache)
+		SetDefault(originalStore)
+		now = originalNow
+		dirtyMu.Lock()
+		dirty = make(map[counter]struct{})
+		dirtyMu.Unlock()
+	})
+	return store
+}
+
+// TestMiddleware tests that authenticated requests are counted per user, and anonymous, rate
+// limited and failed requests are not.
+func TestMiddleware(t *testing.T) {
+	setup(t, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Use(func(c *fiber.Ctx) error {
+		if user := c.Query("user"); user != "" {
+			c.Locals("user", user)
+		}
+		if tenantID := c.Query("tenant"); tenantID != "" {
+			c.Locals(tenant.LocalsKey, tenantID)
+		}
+		return c.Next()
+	})
+	app.Get("/ok", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/limited", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusTooManyRequests) })
+	app.Get("/broken", func(c *fiber.Ctx) error { return errors.New("boom") })
+
+	for _, path := range []string{
+		"/ok?user=u1", "/ok?user=u1", "/ok?user=u2", "/ok?user=u1&tenant=acme",
+		"/ok", "/limited?user=u1", "/broken?user=u1",
+	} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+	}
+
+	day, month, err := Current("", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), day.Count)
+	assert.Equal(t, "2026-10-16", day.PeriodStart)
+	assert.Equal(t, int64(2), month.Count)
+	assert.Equal(t, "2026-10-01", month.PeriodStart)
+
+	day, _, err = Current("acme", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), day.Count)
+	value, err := cache.GetClient().Get("tenant:acme:usage:u1:month:2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
+
+// TestFlush tests that counters are stored as absolute values, once per flush, and that a day
+// counter is still flushed after its day ends.
+func TestFlush(t *testing.T) {
+	store := setup(t, time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC))
+	ctx := context.Background()
+
+	require.NoError(t, Record("", "u1"))
+	require.NoError(t, Record("", "u1"))
+	require.NoError(t, Flush(ctx))
+
+	// The next request is in a new day and month; the old counters are flushed with their final count
+	require.NoError(t, Record("", "u1"))
+	now = func() time.Time { return time.Date(2026, 11, 1, 0, 1, 0, 0, time.UTC) }
+	require.NoError(t, Record("", "u1"))
+	require.NoError(t, Flush(ctx))
+
+	days, err := store.List(ctx, Query{Period: Day})
+	require.NoError(t, err)
+	require.Len(t, days, 2)
+	assert.Equal(t, "2026-11-01", days[0].PeriodStart)
+	assert.Equal(t, int64(1), days[0].Count)
+	assert.Equal(t, "2026-10-31", days[1].PeriodStart)
+	assert.Equal(t, int64(3), days[1].Count)
+
+	months, err := store.List(ctx, Query{Period: Month, From: "2026-10-01", To: "2026-10-31"})
+	require.NoError(t, err)
+	require.Len(t, months, 1)
+	assert.Equal(t, int64(3), months[0].Count)
+}
+
+// failingStore is a rollup store whose writes fail.
+type failingStore struct{ *MemoryStore }
+
+func (failingStore) Save(context.Context, []Rollup) error { return errors.New("database down") }
+
+// TestFlush_Retry tests that counters stay pending when the store fails.
+func TestFlush_Retry(t *testing.T) {
+	store := setup(t, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+
+	require.NoError(t, Record("", "u1"))
+	SetDefault(failingStore{store})
+	assert.Error(t, Flush(ctx))
+
+	SetDefault(store)
+	require.NoError(t, Flush(ctx))
+	rollups, err := store.List(ctx, Query{Period: Day, Subject: "u1"})
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, int64(1), rollups[0].Count)
+}
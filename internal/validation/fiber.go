@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"boilerplate/internal/apperror"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BadRequestError is returned by BindAndValidate for bodies that aren't a JSON object.
+type BadRequestError struct {
+	Message string
+}
+
+func (e *BadRequestError) Error() string {
+	return e.Message
+}
+
+// BindAndValidate decodes the request's JSON body into a T and validates it with Struct. Values of
+// the wrong type are reported as field errors alongside the failed rules; an unknown field is
+// reported on its own, since decoding stops there. Pass the error to Respond.
+func BindAndValidate[T any](c *fiber.Ctx) (T, error) {
+	var body T
+	if len(bytes.TrimSpace(c.Body())) == 0 {
+		return body, &BadRequestError{Message: "Body must be a JSON object"}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(c.Body()))
+	decoder.DisallowUnknownFields()
+	var errs Errors
+	if err := decoder.Decode(&body); err != nil {
+		fieldErr, ok := decodeError(err)
+		if !ok {
+			return body, &BadRequestError{Message: "Body must be a JSON object: " + err.Error()}
+		}
+		if fieldErr.Rule == "unknown" {
+			return body, Errors{fieldErr}
+		}
+		errs = append(errs, fieldErr) // The rest of the body was still decoded
+	} else if _, err := decoder.Token(); err != io.EOF {
+		return body, &BadRequestError{Message: "Body must be a single JSON object"}
+	}
+
+	if err := Struct(&body); err != nil {
+		var ruleErrs Errors
+		if !errors.As(err, &ruleErrs) {
+			return body, err
+		}
+		for _, ruleErr := range ruleErrs {
+			if len(errs) == 0 || ruleErr.Field != errs[0].Field {
+				errs = append(errs, ruleErr)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return body, errs
+	}
+	return body, nil
+}
+
+// Respond writes the response for an error from BindAndValidate: 400 for malformed bodies, 422
+// for failed rules, as problem details (see apperror). Like every 422 in the API, the body has
+// "error" and "field" for the first problem, plus "errors" listing all of them:
+//
+//	{"code": "validation_failed", "error": "name is required", "field": "name", "errors": [{"field": "name", "rule": "required", "message": "is required"}], ...}
+func Respond(c *fiber.Ctx, err error) error {
+	var errs Errors
+	var bad *BadRequestError
+	switch {
+	case errors.As(err, &errs) && len(errs) > 0:
+		return apperror.Write(c, apperror.Validation(errs[0].Field, errs[0].Message).With("errors", errs))
+	case errors.As(err, &bad):
+		return apperror.Write(c, apperror.BadRequest(bad.Message))
+	default:
+		return apperror.Write(c, apperror.Wrap(err, fiber.StatusInternalServerError, apperror.CodeInternal, "Failed to validate request"))
+	}
+}
+
+// decodeError turns a decoding error about one field into a FieldError. Syntax errors aren't
+// about a field and return false.
+func decodeError(err error) (FieldError, bool) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: "must be " + describe(typeErr.Type.Kind().String()),
+		}, true
+	}
+	// encoding/json has no type for unknown fields: json: unknown field "name"
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{Field: strings.Trim(name, `"`), Rule: "unknown", Message: "is not a known field"}, true
+	}
+	return FieldError{}, false
+}
+
+// describe names a Go kind the way JSON clients know it.
+func describe(kind string) string {
+	switch {
+	case kind == "string":
+		return "a string"
+	case kind == "bool":
+		return "a boolean"
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "an integer"
+	case strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "slice", kind == "array":
+		return "an array"
+	case kind == "map", kind == "struct", kind == "ptr":
+		return "an object"
+	}
+	return fmt.Sprintf("a %s", kind)
+}
@@ -0,0 +1,383 @@
+package validation
+
+// Package validation checks request bodies against rules declared in struct tags, and turns
+// failures into 422 responses with one message per field. Handlers taking a JSON body use
+// BindAndValidate:
+//
+//	type createReport struct {
+//		Name   string   `json:"name" validate:"required,max=100"`
+//		Format string   `json:"format" validate:"omitempty,oneof=pdf csv"`
+//		Emails []string `json:"emails" validate:"max=10,dive,email"`
+//	}
+//
+//	body, err := validation.BindAndValidate[createReport](c)
+//	if err != nil {
+//		return validation.Respond(c, err)
+//	}
+//
+// Tags use go-playground/validator's syntax, and the rules below behave like its rules of the
+// same name, so bodies written for either validate the same way. Rules are comma-separated;
+// parameters follow "=". Fields are reported by their JSON name ("items[0].name" for nested
+// ones).
+//
+//   - required: not the zero value (non-empty for strings, slices and maps; non-nil pointers)
+//   - omitempty: skip the other rules when the value is the zero value
+//   - min, max, len: length for strings (in characters), slices and maps; value for numbers
+//   - gt, gte, lt, lte: like min and max, exclusive or inclusive
+//   - oneof: one of the space-separated values (strings and numbers)
+//   - email, url, uuid, alphanum: the string's format
+//   - dive: apply the rules after it to every element of a slice or map
+//
+// Add rules with RegisterRule.
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError is one failed rule.
+type FieldError struct {
+	Field   string `json:"field"`           // JSON path, e.g. "name" or "items[0].name"
+	Rule    string `json:"rule"`            // e.g. required, max
+	Param   string `json:"param,omitempty"` // The rule's parameter, e.g. 100 for max=100
+	Message string `json:"message"`         // e.g. "must be at most 100 characters"
+}
+
+// Errors is every rule a value failed, in field order. It is the error returned by Struct.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Rule checks value against param and returns whether it passes.
+type Rule func(value reflect.Value, param string) bool
+
+// rule is a registered rule with the message shown when it fails.
+type rule struct {
+	check   Rule
+	message string // fmt format with the parameter as its only (optional) argument
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]rule{
+		"required": {func(v reflect.Value, _ string) bool { return !isZero(v) }, "is required"},
+		"email":    {isEmail, "must be an email address"},
+		"url":      {isURL, "must be an absolute URL"},
+		"uuid":     {matches(uuidPattern), "must be a UUID"},
+		"alphanum": {matches(alphanumPattern), "must contain only letters and digits"},
+		"oneof":    {isOneOf, "must be one of: %s"},
+	}
+
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	alphanumPattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+	// fieldsCache holds the parsed fields of each struct type.
+	fieldsCache sync.Map // reflect.Type -> []field
+)
+
+// RegisterRule adds a rule (or replaces one with the same name) usable in validate tags.
+// message is shown when it fails, with the tag's parameter in place of an optional %s.
+//
+// Example: validation.RegisterRule("slug", isSlug, "must be lowercase words separated by dashes")
+func RegisterRule(name string, check Rule, message string) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule{check: check, message: message}
+}
+
+// field is a struct field with a validate tag.
+type field struct {
+	index int
+	name  string   // JSON name
+	rules []string // The tag, split on commas
+}
+
+// Struct validates v, a struct or a pointer to one, and returns Errors if any rule fails.
+func Struct(v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return Errors{{Field: "", Rule: "required", Message: "is required"}}
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validation: %T is not a struct", v)
+	}
+
+	var errs Errors
+	validateStruct(value, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateStruct checks every tagged field of a struct, and the fields of nested structs.
+func validateStruct(value reflect.Value, prefix string, errs *Errors) {
+	for _, f := range fieldsOf(value.Type()) {
+		validateValue(value.Field(f.index), join(prefix, f.name), f.rules, errs)
+	}
+}
+
+// validateValue applies rules to value, then descends into structs.
+func validateValue(value reflect.Value, path string, tagRules []string, errs *Errors) {
+	for i, name := range tagRules {
+		if name == "omitempty" {
+			if isZero(value) {
+				return
+			}
+			continue
+		}
+		if name == "dive" {
+			dive(value, path, tagRules[i+1:], errs)
+			return
+		}
+		name, param, _ := strings.Cut(name, "=")
+		if !check(value, name, param, path, errs) {
+			return // Report one failure per field
+		}
+	}
+
+	target := value
+	for target.Kind() == reflect.Pointer && !target.IsNil() {
+		target = target.Elem()
+	}
+	if target.Kind() == reflect.Struct {
+		validateStruct(target, path, errs)
+	}
+}
+
+// dive applies rules to every element of a slice, array or map.
+func dive(value reflect.Value, path string, elementRules []string, errs *Errors) {
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), elementRules, errs)
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			validateValue(value.MapIndex(key), fmt.Sprintf("%s[%v]", path, key.Interface()), elementRules, errs)
+		}
+	}
+}
+
+// check applies one rule and records its failure. It returns whether the rule passed.
+func check(value reflect.Value, name, param, path string, errs *Errors) bool {
+	var passed bool
+	var message string
+	switch name {
+	case "min", "max", "len", "gt", "gte", "lt", "lte":
+		passed, message = compare(value, name, param)
+	default:
+		rulesMu.RLock()
+		r, ok := rules[name]
+		rulesMu.RUnlock()
+		if !ok {
+			panic(fmt.Sprintf("validation: unknown rule %q on %s", name, path))
+		}
+		passed = r.check(indirect(value), param)
+		message = r.message
+		if strings.Contains(message, "%s") {
+			message = fmt.Sprintf(message, strings.ReplaceAll(param, " ", ", "))
+		}
+	}
+	if !passed {
+		*errs = append(*errs, FieldError{Field: path, Rule: name, Param: param, Message: message})
+	}
+	return passed
+}
+
+// compare applies a size rule: the length of strings (in characters), slices and maps, or the
+// value of numbers.
+func compare(value reflect.Value, name, param string) (bool, string) {
+	value = indirect(value)
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: %s needs a number, got %q", name, param))
+	}
+
+	var size float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	case reflect.Invalid:
+		return true, "" // nil pointer: only required rejects it
+	default:
+		panic(fmt.Sprintf("validation: %s does not apply to %s", name, value.Kind()))
+	}
+
+	switch name {
+	case "min", "gte":
+		return size >= limit, "must be at least " + param + unit
+	case "max", "lte":
+		return size <= limit, "must be at most " + param + unit
+	case "gt":
+		return size > limit, "must be more than " + param + unit
+	case "lt":
+		return size < limit, "must be less than " + param + unit
+	default: // len
+		return size == limit, "must be exactly " + param + unit
+	}
+}
+
+// fieldsOf returns the tagged fields of struct type t, parsed once per type.
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+	fields := make([]field, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		tag := sf.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		var tagRules []string
+		if tag != "" {
+			tagRules = strings.Split(tag, ",")
+		}
+		if tagRules == nil && !hasStruct(sf.Type) {
+			continue
+		}
+		if sf.Anonymous && sf.Tag.Get("json") == "" {
+			name = ""
+		}
+		fields = append(fields, field{index: i, name: name, rules: tagRules})
+	}
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// hasStruct reports whether t is a struct (or a pointer to one), whose fields may have rules.
+func hasStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// join appends a field name to a path ("" for embedded structs).
+func join(prefix, name string) string {
+	switch {
+	case name == "":
+		return prefix
+	case prefix == "":
+		return name
+	}
+	return prefix + "." + name
+}
+
+// isZero reports whether v is its type's zero value, or an empty slice or map.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Invalid:
+		return true
+	}
+	return v.IsZero()
+}
+
+// indirect follows pointers; nil pointers become the invalid Value.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// text returns the string in v, if it holds one.
+func text(v reflect.Value) (string, bool) {
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// isEmail reports whether v is a plain email address (no display name).
+func isEmail(v reflect.Value, _ string) bool {
+	s, ok := text(v)
+	if !ok {
+		return false
+	}
+	address, err := mail.ParseAddress(s)
+	return err == nil && address.Address == s
+}
+
+// isURL reports whether v is an absolute URL.
+func isURL(v reflect.Value, _ string) bool {
+	s, ok := text(v)
+	if !ok {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// isOneOf reports whether v (a string or number) is one of the space-separated values.
+func isOneOf(v reflect.Value, param string) bool {
+	var s string
+	switch v.Kind() {
+	case reflect.String:
+		s = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(v.Uint(), 10)
+	default:
+		return false
+	}
+	for _, allowed := range strings.Fields(param) {
+		if s == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns a rule passing strings that match pattern.
+func matches(pattern *regexp.Regexp) Rule {
+	return func(v reflect.Value, _ string) bool {
+		s, ok := text(v)
+		return ok && pattern.MatchString(s)
+	}
+}
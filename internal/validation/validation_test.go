@@ -0,0 +1,174 @@
+package validation
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"len=2"`
+}
+
+type item struct {
+	Name     string `json:"name" validate:"required,max=5"`
+	Quantity int    `json:"quantity" validate:"gte=1,lte=10"`
+}
+
+type order struct {
+	Email    string            `json:"email" validate:"required,email"`
+	Status   string            `json:"status" validate:"omitempty,oneof=draft placed"`
+	Website  string            `json:"website,omitempty" validate:"omitempty,url"`
+	ID       string            `json:"id" validate:"omitempty,uuid"`
+	Code     *string           `json:"code" validate:"omitempty,alphanum"`
+	Tags     []string          `json:"tags" validate:"max=2,dive,min=2"`
+	Items    []item            `json:"items" validate:"required,dive"`
+	Address  *address          `json:"address"`
+	Labels   map[string]string `json:"labels" validate:"dive,max=3"`
+	Internal string            `json:"-" validate:"required"`
+}
+
+func validOrder() order {
+	return order{
+		Email: "ada@example.com",
+		Items: []item{{Name: "pen", Quantity: 2}},
+	}
+}
+
+// TestStruct tests each rule, and that failures are reported by JSON path.
+func TestStruct(t *testing.T) {
+	code := "A1"
+	valid := validOrder()
+	valid.Status, valid.Website, valid.ID, valid.Code = "placed", "https://example.com/x", "123e4567-e89b-12d3-a456-426614174000", &code
+	valid.Tags = []string{"ab", "cd"}
+	valid.Address = &address{City: "Paris", Country: "FR"}
+	require.NoError(t, Struct(valid))
+	require.NoError(t, Struct(&valid))
+
+	tests := []struct {
+		name    string
+		change  func(o *order)
+		field   string
+		rule    string
+		message string
+	}{
+		{"required", func(o *order) { o.Email = "" }, "email", "required", "is required"},
+		{"email", func(o *order) { o.Email = "Ada <ada@example.com>" }, "email", "email", "must be an email address"},
+		{"oneof", func(o *order) { o.Status = "lost" }, "status", "oneof", "must be one of: draft, placed"},
+		{"url", func(o *order) { o.Website = "example.com" }, "website", "url", "must be an absolute URL"},
+		{"uuid", func(o *order) { o.ID = "123" }, "id", "uuid", "must be a UUID"},
+		{"alphanum on pointer", func(o *order) { code := "a-1"; o.Code = &code }, "code", "alphanum", "must contain only letters and digits"},
+		{"max items", func(o *order) { o.Tags = []string{"ab", "cd", "ef"} }, "tags", "max", "must be at most 2 items"},
+		{"dive into strings", func(o *order) { o.Tags = []string{"ab", "c"} }, "tags[1]", "min", "must be at least 2 characters"},
+		{"required slice", func(o *order) { o.Items = []item{} }, "items", "required", "is required"},
+		{"dive into structs", func(o *order) { o.Items[0].Name = "" }, "items[0].name", "required", "is required"},
+		{"max counts characters", func(o *order) { o.Items[0].Name = "crayon" }, "items[0].name", "max", "must be at most 5 characters"},
+		{"gte", func(o *order) { o.Items[0].Quantity = 0 }, "items[0].quantity", "gte", "must be at least 1"},
+		{"lte", func(o *order) { o.Items[0].Quantity = 11 }, "items[0].quantity", "lte", "must be at most 10"},
+		{"nested pointer", func(o *order) { o.Address = &address{Country: "FR"} }, "address.city", "required", "is required"},
+		{"len", func(o *order) { o.Address = &address{City: "Paris", Country: "FRA"} }, "address.country", "len", "must be exactly 2 characters"},
+		{"dive into maps", func(o *order) { o.Labels = map[string]string{"env": "prod"} }, "labels[env]", "max", "must be at most 3 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := validOrder()
+			o.Items = []item{{Name: "pen", Quantity: 2}}
+			tt.change(&o)
+
+			var errs Errors
+			require.ErrorAs(t, Struct(o), &errs)
+			require.Len(t, errs, 1)
+			assert.Equal(t, tt.field, errs[0].Field)
+			assert.Equal(t, tt.rule, errs[0].Rule)
+			assert.Equal(t, tt.message, errs[0].Message)
+		})
+	}
+}
+
+// TestStruct_AllFields tests that every failing field is reported, once, in field order.
+func TestStruct_AllFields(t *testing.T) {
+	err := Struct(order{Email: "", Status: "lost"})
+
+	var errs Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 3)
+	assert.Equal(t, []string{"email", "status", "items"}, []string{errs[0].Field, errs[1].Field, errs[2].Field})
+	assert.Equal(t, "email is required; status must be one of: draft, placed; items is required", err.Error())
+
+	assert.Error(t, Struct("not a struct"))
+}
+
+// TestRegisterRule tests custom rules.
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("lowercase", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && v.String() == strings.ToLower(v.String())
+	}, "must be lowercase")
+
+	type slug struct {
+		Slug string `json:"slug" validate:"lowercase"`
+	}
+	assert.NoError(t, Struct(slug{Slug: "hello"}))
+
+	var errs Errors
+	require.ErrorAs(t, Struct(slug{Slug: "Hello"}), &errs)
+	assert.Equal(t, FieldError{Field: "slug", Rule: "lowercase", Message: "must be lowercase"}, errs[0])
+
+	type unknown struct {
+		Name string `validate:"nope"`
+	}
+	assert.Panics(t, func() { _ = Struct(unknown{}) }, "typos in tags are caught on first use")
+}
+
+// TestBindAndValidate tests the responses for valid, malformed and invalid bodies.
+func TestBindAndValidate(t *testing.T) {
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		body, err := BindAndValidate[item](c)
+		if err != nil {
+			return Respond(c, err)
+		}
+		return c.JSON(body)
+	})
+
+	send := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		return resp.StatusCode, decoded
+	}
+
+	status, body := send(`{"name": "pen", "quantity": 3}`)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "pen", body["name"])
+
+	for _, malformed := range []string{``, `{"name": `, `{} {}`} {
+		status, _ := send(malformed)
+		assert.Equal(t, 400, status, malformed)
+	}
+
+	status, body = send(`{"quantity": 0}`)
+	assert.Equal(t, 422, status)
+	assert.Equal(t, "name is required", body["error"])
+	assert.Equal(t, "name", body["field"])
+	assert.Len(t, body["errors"], 2)
+
+	status, body = send(`{"name": "pen", "quantity": "3"}`)
+	assert.Equal(t, 422, status)
+	assert.Equal(t, "quantity must be an integer", body["error"])
+
+	status, body = send(`{"name": "pen", "quantity": 1, "colour": "red"}`)
+	assert.Equal(t, 422, status)
+	assert.Equal(t, "colour is not a known field", body["error"])
+}
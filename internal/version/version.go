@@ -0,0 +1,190 @@
+package version
+
+// Package version resolves the API version of each request.
+//
+// Clients pick a version in one of two ways:
+//
+//   - Path: /api/v2/profile. The version segment is stripped before routing, so routes are
+//     registered once (as /api/profile) and serve every version.
+//   - Media type: Accept: application/vnd.app.v2+json, for clients that cannot change URLs.
+//     JSON responses are then labelled with the same media type.
+//
+// A version in the path wins over the Accept header. Requests without either get
+// API_DEFAULT_VERSION (default 1), so existing clients keep the original response shapes.
+// Handlers read the result with Get(c) and pick a serializer with Pick.
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Supported versions.
+const (
+	Oldest = 1
+	Latest = 2
+)
+
+// mediaTypePrefix and mediaTypeSuffix surround the version in the vendor media type
+// (application/vnd.app.v2+json).
+const (
+	mediaTypePrefix = "application/vnd.app.v"
+	mediaTypeSuffix = "+json"
+)
+
+// pathPrefix is where path versions are recognized (/api/v2/...).
+const pathPrefix = "/api/v"
+
+// localsKey is where the resolved version is stored.
+const localsKey = "api_version"
+
+// versionHeader echoes the resolved version on every response.
+const versionHeader = "X-API-Version"
+
+// Supported reports whether v is a version this server serves.
+func Supported(v int) bool {
+	return v >= Oldest && v <= Latest
+}
+
+// MediaType returns the vendor media type for v.
+func MediaType(v int) string {
+	return mediaTypePrefix + strconv.Itoa(v) + mediaTypeSuffix
+}
+
+// getDefaultVersion returns API_DEFAULT_VERSION, defaulting to the oldest version.
+func getDefaultVersion() int {
+	if raw := os.Getenv("API_DEFAULT_VERSION"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && Supported(parsed) {
+			return parsed
+		}
+		log.Printf("WARNING: Invalid API_DEFAULT_VERSION %q, using %d", raw, Oldest)
+	}
+	return Oldest
+}
+
+// Get returns the version resolved for the request (the default version if Middleware did not run).
+func Get(c *fiber.Ctx) int {
+	if v, ok := c.Locals(localsKey).(int); ok {
+		return v
+	}
+	return getDefaultVersion()
+}
+
+// Pick returns the entry of byVersion for the request's version: the highest version that is
+// not newer than the requested one. Register a serializer only for the versions that changed it:
+//
+//	body := version.Pick(c, map[int]func() interface{}{1: profileV1, 2: profileV2})()
+func Pick[T any](c *fiber.Ctx, byVersion map[int]T) T {
+	var zero T
+	for v := Get(c); v >= Oldest; v-- {
+		if entry, ok := byVersion[v]; ok {
+			return entry
+		}
+	}
+	return zero
+}
+
+// Middleware resolves the version from the path or the Accept header and stores it for Get.
+// Unsupported versions are rejected with 406. Register it globally, before the routes.
+func Middleware() fiber.Handler {
+	defaultVersion := getDefaultVersion()
+
+	return func(c *fiber.Ctx) error {
+		// Responses differ by Accept even when the URL is the same
+		c.Vary(fiber.HeaderAccept)
+
+		// Step 1: Path version (/api/v2/profile -> /api/profile)
+		v, rest, fromPath, ok := fromPathPrefix(c.Path())
+		if fromPath && !ok {
+			return unsupported(c)
+		}
+		if fromPath {
+			c.Path(rest)
+		}
+
+		// Step 2: Media type version
+		fromAccept := false
+		if !fromPath {
+			v, fromAccept, ok = fromAcceptHeader(c.Get(fiber.HeaderAccept))
+			if fromAccept && !ok {
+				return unsupported(c)
+			}
+		}
+
+		// Step 3: Default
+		if !fromPath && !fromAccept {
+			v = defaultVersion
+		}
+
+		c.Locals(localsKey, v)
+		c.Set(versionHeader, strconv.Itoa(v))
+
+		err := c.Next()
+
+		// Label JSON responses with the media type the client asked for
+		if fromAccept && strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+			c.Set(fiber.HeaderContentType, MediaType(v))
+		}
+		return err
+	}
+}
+
+// fromPathPrefix parses "/api/v<N>/..." and returns N and the path without the version segment.
+// found is false if the path has no version segment; ok is false if the version is unsupported.
+func fromPathPrefix(path string) (v int, rest string, found, ok bool) {
+	if !strings.HasPrefix(path, pathPrefix) {
+		return 0, path, false, false
+	}
+
+	segment := strings.TrimPrefix(path, pathPrefix)
+	remainder := ""
+	if i := strings.IndexByte(segment, '/'); i >= 0 {
+		segment, remainder = segment[:i], segment[i:]
+	}
+
+	parsed, err := strconv.Atoi(segment)
+	if err != nil || segment == "" || segment[0] == '+' || segment[0] == '-' {
+		return 0, path, false, false // e.g. /api/validate: not a version segment
+	}
+	return parsed, "/api" + remainder, true, Supported(parsed)
+}
+
+// fromAcceptHeader returns the first vendor media type version in an Accept header.
+// found is false if the header has no vendor media type; ok is false if none of the
+// vendor versions listed is supported.
+func fromAcceptHeader(accept string) (v int, found, ok bool) {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(mediaRange, ";", 2)[0])
+		mediaType = strings.ToLower(mediaType)
+		if !strings.HasPrefix(mediaType, mediaTypePrefix) || !strings.HasSuffix(mediaType, mediaTypeSuffix) {
+			continue
+		}
+
+		found = true
+		raw := strings.TrimSuffix(strings.TrimPrefix(mediaType, mediaTypePrefix), mediaTypeSuffix)
+		if parsed, err := strconv.Atoi(raw); err == nil && Supported(parsed) {
+			return parsed, true, true
+		}
+	}
+	return 0, found, false
+}
+
+// unsupported rejects a request for a version this server does not serve.
+func unsupported(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotAcceptable).JSON(fiber.Map{
+		"error":     "Unsupported API version",
+		"supported": supportedMediaTypes(),
+	})
+}
+
+// supportedMediaTypes lists the media types of every supported version.
+func supportedMediaTypes() []string {
+	types := make([]string, 0, Latest-Oldest+1)
+	for v := Oldest; v <= Latest; v++ {
+		types = append(types, MediaType(v))
+	}
+	return types
+}
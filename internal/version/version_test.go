@@ -0,0 +1,84 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp returns an app that echoes the resolved version and the routed path.
+func newTestApp() *fiber.App {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/api/thing", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"version": Get(c),
+			"shape":   Pick(c, map[int]string{1: "flat"}),
+		})
+	})
+	return app
+}
+
+// TestMiddleware_Negotiation tests path, Accept and default resolution.
+func TestMiddleware_Negotiation(t *testing.T) {
+	app := newTestApp()
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		wantStatus  int
+		wantVersion float64
+		wantType    string
+	}{
+		{"default", "/api/thing", "", fiber.StatusOK, 1, fiber.MIMEApplicationJSON},
+		{"plain json accept", "/api/thing", "application/json", fiber.StatusOK, 1, fiber.MIMEApplicationJSON},
+		{"path v2", "/api/v2/thing", "", fiber.StatusOK, 2, fiber.MIMEApplicationJSON},
+		{"accept v2", "/api/thing", "application/vnd.app.v2+json", fiber.StatusOK, 2, "application/vnd.app.v2+json"},
+		{"accept first supported", "/api/thing", "application/vnd.app.v9+json, application/vnd.app.v1+json;q=0.9", fiber.StatusOK, 1, "application/vnd.app.v1+json"},
+		{"path wins", "/api/v1/thing", "application/vnd.app.v2+json", fiber.StatusOK, 1, fiber.MIMEApplicationJSON},
+		{"unsupported accept", "/api/thing", "application/vnd.app.v9+json", fiber.StatusNotAcceptable, 0, ""},
+		{"unsupported path", "/api/v9/thing", "", fiber.StatusNotAcceptable, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Contains(t, resp.Header.Get("Vary"), "Accept")
+			if tt.wantStatus != fiber.StatusOK {
+				return
+			}
+
+			assert.Contains(t, resp.Header.Get("Content-Type"), tt.wantType)
+			var body map[string]interface{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tt.wantVersion, body["version"])
+			assert.Equal(t, "flat", body["shape"]) // v2 falls back to the v1 serializer
+		})
+	}
+}
+
+// TestFromPathPrefix tests that only numeric version segments are treated as versions.
+func TestFromPathPrefix(t *testing.T) {
+	v, rest, found, ok := fromPathPrefix("/api/v2")
+	assert.True(t, found)
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, "/api", rest)
+
+	for _, path := range []string{"/api/videos", "/api/v", "/api/v-1/x", "/graphql"} {
+		_, rest, found, _ = fromPathPrefix(path)
+		assert.False(t, found, path)
+		assert.Equal(t, path, rest)
+	}
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"boilerplate/internal/signature"
+)
+
+// stripeTolerance is how old a Stripe delivery's signed timestamp may be, against replays.
+const stripeTolerance = 5 * time.Minute
+
+// ErrInvalidSignature is returned by verifiers for deliveries without a valid signature.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Verifier authenticates a provider's deliveries and reads their ID (the idempotency key) and
+// event type.
+type Verifier interface {
+	Verify(header http.Header, body []byte, now time.Time) (id, eventType string, err error)
+}
+
+// VerifierFunc adapts a function to Verifier.
+type VerifierFunc func(header http.Header, body []byte, now time.Time) (id, eventType string, err error)
+
+// Verify calls f.
+func (f VerifierFunc) Verify(header http.Header, body []byte, now time.Time) (string, string, error) {
+	return f(header, body, now)
+}
+
+// Stripe verifies Stripe deliveries (the Stripe-Signature header) with any of secrets, the
+// endpoint's signing secrets ("whsec_..."). The ID and type are the event's.
+func Stripe(secrets ...string) Verifier {
+	return VerifierFunc(func(header http.Header, body []byte, now time.Time) (string, string, error) {
+		valid := false
+		for _, secret := range secrets {
+			if VerifyStripe(body, header.Get("Stripe-Signature"), secret, now) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", "", ErrInvalidSignature
+		}
+		var event struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+			return "", "", errors.New("invalid Stripe event")
+		}
+		return event.ID, event.Type, nil
+	})
+}
+
+// VerifyStripe checks a Stripe-Signature header ("t=<unix>,v1=<hex>[,v1=...]"): one v1 must be
+// the hex HMAC-SHA256 of "<t>.<body>" with secret, and t must be within five minutes of now.
+func VerifyStripe(body []byte, header, secret string, now time.Time) bool {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return false
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return false
+	}
+
+	expected := SignStripe(body, timestamp, secret)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignStripe returns the hex HMAC-SHA256 of "<timestamp>.<body>", the v1 signature Stripe sends.
+func SignStripe(body []byte, timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GitHub verifies GitHub deliveries (the X-Hub-Signature-256 header, "sha256=" and the hex
+// HMAC-SHA256 of the body) with any of secrets. The ID is X-GitHub-Delivery and the type
+// X-GitHub-Event. GitHub signs no timestamp: replays are only caught by deduplication.
+func GitHub(secrets ...string) Verifier {
+	return VerifierFunc(func(header http.Header, body []byte, _ time.Time) (string, string, error) {
+		signature, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return "", "", ErrInvalidSignature
+		}
+		valid := false
+		for _, secret := range secrets {
+			if hmac.Equal([]byte(signature), []byte(SignGitHub(body, secret))) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", "", ErrInvalidSignature
+		}
+		id := header.Get("X-GitHub-Delivery")
+		if id == "" {
+			return "", "", errors.New("missing X-GitHub-Delivery")
+		}
+		return id, header.Get("X-GitHub-Event"), nil
+	})
+}
+
+// SignGitHub returns the hex HMAC-SHA256 of body, the signature GitHub sends after "sha256=".
+func SignGitHub(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Standard verifies Standard Webhooks deliveries (see internal/signature), as Supabase Auth hooks
+// send them, with any of secrets. The ID is Webhook-Id. The type is the body's "type", prefixed
+// with its "table" when there is one, as in Supabase database webhook payloads
+// ("artists.INSERT").
+func Standard(secrets ...signature.Secret) Verifier {
+	return VerifierFunc(func(header http.Header, body []byte, now time.Time) (string, string, error) {
+		if err := signature.VerifyAt(header, body, now, signature.DefaultTolerance, secrets...); err != nil {
+			return "", "", fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		var payload struct {
+			Type  string `json:"type"`
+			Table string `json:"table"`
+		}
+		_ = json.Unmarshal(body, &payload) // The type is optional; the payload may not be an object
+		eventType := payload.Type
+		if payload.Table != "" {
+			eventType = payload.Table + "." + payload.Type
+		}
+		return header.Get(signature.HeaderID), eventType, nil
+	})
+}
+
+// parseSecrets reads comma-separated Standard Webhooks secrets. Supabase shows them with their
+// version ("v1,whsec_..."), which is skipped.
+func parseSecrets(value string) ([]signature.Secret, error) {
+	var secrets []signature.Secret
+	for _, part := range SplitList(value) {
+		if part == "v1" {
+			continue
+		}
+		secret, err := signature.ParseSecret(part)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// SplitList returns the non-empty items of a comma-separated list, as secret settings are.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,305 @@
+package webhook
+
+// Package webhook receives webhooks from third parties at POST /webhooks/:provider. Each provider
+// has a Verifier, which authenticates deliveries (Stripe, GitHub and Standard Webhooks signatures
+// are built in, see verifiers.go) and reads their ID and event type. Verified events are handed
+// to the Go handlers registered for their type, or enqueued as background jobs:
+//
+//	webhook.Handle("github", "push", func(ctx context.Context, event webhook.Event) error {
+//		var push struct{ Ref string `json:"ref"` }
+//		if err := json.Unmarshal(event.Payload, &push); err != nil {
+//			return err
+//		}
+//		return deploy(ctx, push.Ref)
+//	})
+//
+//	// Runs as a job of type "supabase.user_created", with the Event as its payload
+//	webhook.EnqueueJob("supabase", "users.INSERT", "supabase.user_created")
+//
+// Providers retry deliveries that fail, and some deliver an event more than once: every event is
+// claimed in the cache by provider and ID (webhook:<provider>:<id>) for WEBHOOK_DEDUP_TTL
+// (default 72h, Stripe's retry window) and acknowledged as a duplicate after that. An event whose
+// handler or enqueue fails is released, answered 500 (or the status of a *fiber.Error the
+// handler returned) and processed again on the provider's retry; handlers must be safe to run
+// twice, since the handlers before the failing one run again too. Events without a handler are
+// acknowledged, so providers don't retry events the endpoint wasn't meant to receive.
+//
+// Init registers GitHub (GITHUB_WEBHOOK_SECRET) and Supabase (SUPABASE_WEBHOOK_SECRET, Standard
+// Webhooks as sent by Auth hooks); internal/plan registers Stripe (STRIPE_WEBHOOK_SECRET). Each
+// secret setting takes a comma-separated list, to rotate secrets. Register adds other providers.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/config"
+	"boilerplate/internal/jobs"
+	"boilerplate/internal/logging"
+	"boilerplate/internal/metrics"
+	"boilerplate/internal/startup"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// dedupPrefix prefixes the keys claiming events.
+const dedupPrefix = "webhook:"
+
+// defaultDedupTTL is how long an event ID is remembered (WEBHOOK_DEDUP_TTL).
+const defaultDedupTTL = 72 * time.Hour
+
+// AllEvents registers a handler or job for every event type of a provider.
+const AllEvents = "*"
+
+// Results of deliveries, as counted in webhook_events_total.
+const (
+	resultProcessed = "processed"
+	resultDuplicate = "duplicate"
+	resultIgnored   = "ignored"
+	resultRejected  = "rejected"
+	resultFailed    = "failed"
+)
+
+// Event is a verified webhook delivery.
+type Event struct {
+	Provider   string          `json:"provider"`
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"` // The request body
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// Handler processes an event. Returning an error makes the provider deliver it again.
+type Handler func(ctx context.Context, event Event) error
+
+// route sends events of a type to a handler, or to a job.
+type route struct {
+	eventType string
+	handler   Handler
+	jobType   string
+}
+
+var (
+	mu        sync.RWMutex
+	verifiers = make(map[string]Verifier)
+	known     = make(map[string]bool)    // Providers registered without a verifier (not configured)
+	routes    = make(map[string][]route) // By provider
+	dedup     cache.Store                // nil until Init or Configure: events are not deduplicated
+	dedupTTL  = defaultDedupTTL
+)
+
+// Init registers the GitHub and Supabase providers whose secrets are set, and deduplicates events
+// in the cache (call it after cache.Init, and after the packages registering providers).
+func Init(cfg config.Webhook) {
+	store, where := cache.GetClient(), "deduplicated in the cache"
+	if store == nil {
+		store, where = cache.NewMemoryStore(), "deduplicated in memory (no cache configured)"
+	}
+	Configure(store, cfg.DedupTTL)
+
+	if len(cfg.GitHubSecrets) > 0 {
+		Register("github", GitHub(cfg.GitHubSecrets...))
+	} else {
+		Register("github", nil)
+	}
+	Register("supabase", nil)
+	if cfg.SupabaseSecret != "" {
+		secrets, err := parseSecrets(cfg.SupabaseSecret)
+		if err != nil {
+			slog.Error("Invalid SUPABASE_WEBHOOK_SECRET, Supabase webhooks are rejected", "error", err)
+		} else {
+			Register("supabase", Standard(secrets...))
+		}
+	}
+
+	names := Providers()
+	if len(names) == 0 {
+		startup.Report("webhooks", false, "no provider secret set")
+		return
+	}
+	startup.Report("webhooks", true, "/webhooks/{"+strings.Join(names, ",")+"}, "+where)
+}
+
+// Configure sets the store events are claimed in (nil turns deduplication off) and for how long.
+// Init calls it; it is mainly useful in tests.
+func Configure(store cache.Store, ttl time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	dedup, dedupTTL = store, ttl
+}
+
+// Register sets the verifier of a provider, served at /webhooks/<name>. A nil verifier marks a
+// known provider that is not configured (its secret is unset): its deliveries get 503, while
+// those of providers never registered get 404.
+func Register(name string, verifier Verifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	if verifier == nil {
+		delete(verifiers, name)
+		known[name] = true
+		return
+	}
+	verifiers[name] = verifier
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(verifiers))
+	for name := range verifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handle adds a handler of a provider's events of eventType (AllEvents for every type). Handlers
+// run in the request, in the order they were added, with the request's context.
+func Handle(provider, eventType string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	routes[provider] = append(routes[provider], route{eventType: eventType, handler: handler})
+}
+
+// EnqueueJob enqueues a job of jobType, with the Event as its payload, for every event of a
+// provider of eventType (AllEvents for every type): for work too slow for the provider's timeout
+// (Stripe waits 20s, GitHub 10s).
+func EnqueueJob(provider, eventType, jobType string) {
+	mu.Lock()
+	defer mu.Unlock()
+	routes[provider] = append(routes[provider], route{eventType: eventType, jobType: jobType})
+}
+
+// Reset removes the providers, handlers and jobs. Mainly useful in tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	verifiers = make(map[string]Verifier)
+	known = make(map[string]bool)
+	routes = make(map[string][]route)
+	dedup, dedupTTL = nil, defaultDedupTTL
+}
+
+// Receive verifies a delivery to /webhooks/:provider and dispatches its event.
+func Receive(c *fiber.Ctx) error {
+	name := c.Params("provider")
+	mu.RLock()
+	verifier, registered, store, ttl := verifiers[name], routes[name], dedup, dedupTTL
+	configurable := known[name]
+	mu.RUnlock()
+	switch {
+	case verifier == nil && configurable:
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Webhook provider is not configured",
+		})
+	case verifier == nil:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown webhook provider",
+		})
+	}
+	// Copied: the name is a metric label and goes into events that outlive the request
+	provider := strings.Clone(name)
+
+	// The body is kept past the request when the event is enqueued
+	body := bytes.Clone(c.Body())
+	header := make(http.Header)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+	id, eventType, err := verifier.Verify(header, body, time.Now())
+	if err != nil || id == "" || !json.Valid(body) {
+		metrics.WebhookEvents.WithLabelValues(provider, resultRejected).Inc()
+		logging.FromRequest(c).Warn("Rejected webhook delivery", "provider", provider, "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid signature or payload",
+		})
+	}
+
+	logger := logging.FromRequest(c).With("provider", provider, "event_id", id, "event_type", eventType)
+	matched := matching(registered, eventType)
+	if len(matched) == 0 {
+		metrics.WebhookEvents.WithLabelValues(provider, resultIgnored).Inc()
+		logger.Debug("Ignoring webhook event")
+		return c.JSON(fiber.Map{"received": true})
+	}
+
+	// Claim the event; a claim that fails to be read processes it rather than losing it
+	key := dedupPrefix + provider + ":" + id
+	claimed := false
+	if store != nil {
+		count, err := store.Incr(key)
+		switch {
+		case err != nil:
+			logger.Warn("Failed to deduplicate webhook event, processing it", "error", err)
+		case count > 1:
+			metrics.WebhookEvents.WithLabelValues(provider, resultDuplicate).Inc()
+			logger.Info("Ignoring duplicate webhook event")
+			return c.JSON(fiber.Map{"received": true, "duplicate": true})
+		default:
+			claimed = true
+			if err := store.Expire(key, ttl); err != nil {
+				logger.Warn("Failed to set the webhook event claim's TTL", "error", err)
+			}
+		}
+	}
+
+	event := Event{Provider: provider, ID: id, Type: eventType, Payload: body, ReceivedAt: time.Now().UTC()}
+	if err := dispatch(c.UserContext(), matched, event); err != nil {
+		if claimed {
+			if err := store.Del(key); err != nil {
+				logger.Warn("Failed to release webhook event, the provider's retry will be ignored", "error", err)
+			}
+		}
+		metrics.WebhookEvents.WithLabelValues(provider, resultFailed).Inc()
+
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			logger.Warn("Webhook event refused, the provider will retry", "status", fiberErr.Code, "error", fiberErr.Message)
+			return c.Status(fiberErr.Code).JSON(fiber.Map{
+				"error": fiberErr.Message,
+			})
+		}
+		logger.Error("Failed to handle webhook event", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to handle event",
+		})
+	}
+	metrics.WebhookEvents.WithLabelValues(provider, resultProcessed).Inc()
+	return c.JSON(fiber.Map{"received": true})
+}
+
+// matching returns the routes of eventType.
+func matching(registered []route, eventType string) []route {
+	var matched []route
+	for _, r := range registered {
+		if r.eventType == AllEvents || r.eventType == eventType {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// dispatch runs the handlers and enqueues the jobs of event, stopping at the first error.
+func dispatch(ctx context.Context, matched []route, event Event) error {
+	for _, r := range matched {
+		if r.handler != nil {
+			if err := r.handler(ctx, event); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := jobs.Enqueue(r.jobType, event, jobs.Options{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
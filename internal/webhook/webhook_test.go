@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"boilerplate/internal/cache"
+	"boilerplate/internal/jobs"
+	"boilerplate/internal/signature"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "whsec_test"
+
+// setup registers a GitHub provider, deduplicating in memory, and returns an app serving it.
+func setup(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Cleanup(Reset)
+	Register("github", GitHub(testSecret))
+	Configure(cache.NewMemoryStore(), time.Hour)
+
+	app := fiber.New()
+	app.Post("/webhooks/:provider", Receive)
+	return app
+}
+
+// deliverGitHub posts a signed GitHub delivery and returns the response status.
+func deliverGitHub(t *testing.T, app *fiber.App, id, event, body string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Delivery", id)
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+SignGitHub([]byte(body), testSecret))
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+// TestVerifyStripe tests the signature, its timestamp tolerance and rotated secrets.
+func TestVerifyStripe(t *testing.T) {
+	at := time.Unix(1_800_000_000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	valid := SignStripe(body, timestamp, testSecret)
+
+	assert.True(t, VerifyStripe(body, "t="+timestamp+",v1="+valid, testSecret, at))
+	assert.True(t, VerifyStripe(body, "t="+timestamp+",v1=deadbeef,v1="+valid, testSecret, at))
+	assert.False(t, VerifyStripe(body, "t="+timestamp+",v1="+valid, "whsec_other", at))
+	assert.False(t, VerifyStripe([]byte(`{"id":"evt_2"}`), "t="+timestamp+",v1="+valid, testSecret, at))
+	assert.False(t, VerifyStripe(body, "v1="+valid, testSecret, at))
+	assert.False(t, VerifyStripe(body, "t="+timestamp+",v1="+valid, testSecret, at.Add(10*time.Minute)))
+
+	// The verifier reads the event's ID and type, with any of the secrets
+	header := http.Header{"Stripe-Signature": {"t=" + timestamp + ",v1=" + SignStripe([]byte(`{"id":"evt_1","type":"invoice.paid"}`), timestamp, testSecret)}}
+	id, eventType, err := Stripe("whsec_old", testSecret).Verify(header, []byte(`{"id":"evt_1","type":"invoice.paid"}`), at)
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", id)
+	assert.Equal(t, "invoice.paid", eventType)
+}
+
+// TestGitHub tests that GitHub deliveries need a signature of the body with the secret.
+func TestGitHub(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	header := http.Header{
+		"X-Github-Delivery":   {"d1"},
+		"X-Github-Event":      {"push"},
+		"X-Hub-Signature-256": {"sha256=" + SignGitHub(body, testSecret)},
+	}
+	id, eventType, err := GitHub(testSecret).Verify(header, body, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "d1", id)
+	assert.Equal(t, "push", eventType)
+
+	_, _, err = GitHub("other-secret").Verify(header, body, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, _, err = GitHub(testSecret).Verify(header, []byte(`{"ref":"refs/heads/evil"}`), time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+// TestStandard tests Standard Webhooks deliveries with a secret in Supabase's format, and the
+// type of database webhook payloads.
+func TestStandard(t *testing.T) {
+	raw := []byte("supabase-secret-0123456789")
+	secrets, err := parseSecrets("v1,whsec_" + base64.StdEncoding.EncodeToString(raw))
+	require.NoError(t, err)
+	require.Len(t, secrets, 1)
+
+	at := time.Unix(1_800_000_000, 0)
+	body := []byte(`{"type":"INSERT","table":"artists","record":{"id":"a1"}}`)
+	header := signature.Headers("msg_1", at, body, signature.Secret(raw))
+	id, eventType, err := Standard(secrets...).Verify(header, body, at)
+	require.NoError(t, err)
+	assert.Equal(t, "msg_1", id)
+	assert.Equal(t, "artists.INSERT", eventType)
+
+	_, _, err = Standard(secrets...).Verify(header, body, at.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+// TestReceive tests dispatching to handlers by type, duplicates, and that failed events are
+// released for the provider's retry.
+func TestReceive(t *testing.T) {
+	app := setup(t)
+	var pushes []Event
+	fail := errors.New("deploy failed")
+	Handle("github", "push", func(_ context.Context, event Event) error {
+		pushes = append(pushes, event)
+		return fail
+	})
+	Handle("github", "issues", func(context.Context, Event) error {
+		return fiber.NewError(fiber.StatusConflict, "Not yet")
+	})
+
+	// Unknown, unconfigured providers and unsigned deliveries are rejected
+	resp, err := app.Test(httptest.NewRequest("POST", "/webhooks/gitlab", strings.NewReader(`{}`)))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	Register("stripe", nil)
+	resp, err = app.Test(httptest.NewRequest("POST", "/webhooks/stripe", strings.NewReader(`{}`)))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode, "known providers without a secret are unavailable")
+	resp, err = app.Test(httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(`{}`)))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	// A failed event is processed again on retry, then acknowledged as a duplicate
+	body := `{"ref":"refs/heads/main"}`
+	assert.Equal(t, fiber.StatusInternalServerError, deliverGitHub(t, app, "d1", "push", body))
+	fail = nil
+	assert.Equal(t, fiber.StatusOK, deliverGitHub(t, app, "d1", "push", body))
+	assert.Equal(t, fiber.StatusOK, deliverGitHub(t, app, "d1", "push", body))
+	require.Len(t, pushes, 2)
+	assert.Equal(t, Event{Provider: "github", ID: "d1", Type: "push", Payload: []byte(body), ReceivedAt: pushes[1].ReceivedAt}, pushes[1])
+
+	// A handler's *fiber.Error sets the status; events without a handler are acknowledged
+	assert.Equal(t, fiber.StatusConflict, deliverGitHub(t, app, "d2", "issues", `{}`))
+	assert.Equal(t, fiber.StatusOK, deliverGitHub(t, app, "d3", "star", `{}`))
+}
+
+// TestEnqueueJob tests that events are enqueued as jobs carrying the event.
+func TestEnqueueJob(t *testing.T) {
+	app := setup(t)
+	original := jobs.Get()
+	queue := jobs.New(nil, jobs.Config{})
+	jobs.SetDefault(queue)
+	t.Cleanup(func() { jobs.SetDefault(original) })
+	EnqueueJob("github", AllEvents, "github.event")
+
+	assert.Equal(t, fiber.StatusOK, deliverGitHub(t, app, "d1", "release", `{"action":"published"}`))
+	queued, err := queue.List(jobs.StateQueued, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	assert.Equal(t, "github.event", queued[0].Type)
+	assert.Contains(t, string(queued[0].Payload), `"id":"d1"`)
+
+	// Without a queue the event fails, for the provider to retry
+	jobs.SetDefault(nil)
+	assert.Equal(t, fiber.StatusInternalServerError, deliverGitHub(t, app, "d2", "release", `{}`))
+}
@@ -0,0 +1,12 @@
+package web
+
+// Package web holds the frontend build embedded in the server binary.
+//
+// To ship frontend and backend as one binary, copy the build output (the directory with
+// index.html, e.g. dist/ from Vite or build/ from Create React App) to web/dist and build with
+// the embed_frontend tag:
+//
+//	cp -r ../my-frontend/dist web/dist
+//	go build -tags embed_frontend -o server ./cmd/server
+//
+// Without the tag nothing is embedded and the frontend is only served from FRONTEND_DIR.
@@ -0,0 +1,10 @@
+//go:build embed_frontend
+
+package web
+
+import "embed"
+
+// Dist is the frontend build in web/dist.
+//
+//go:embed all:dist
+var Dist embed.FS